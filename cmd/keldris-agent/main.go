@@ -25,10 +25,15 @@ import (
 	"github.com/MacJediWizard/keldris/internal/agent"
 	"github.com/MacJediWizard/keldris/internal/backup"
 	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/backup/docker"
+	"github.com/MacJediWizard/keldris/internal/backup/fssnapshot"
+	"github.com/MacJediWizard/keldris/internal/backup/kubernetes"
+	"github.com/MacJediWizard/keldris/internal/backup/vms"
 	"github.com/MacJediWizard/keldris/internal/config"
 	"github.com/MacJediWizard/keldris/internal/diagnostics"
 	"github.com/MacJediWizard/keldris/internal/health"
 	"github.com/MacJediWizard/keldris/internal/httpclient"
+	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/MacJediWizard/keldris/internal/support"
 	"github.com/MacJediWizard/keldris/internal/updater"
 	"github.com/google/uuid"
@@ -656,6 +661,7 @@ func runBackup(cfg *config.AgentConfig, scheduleName string, resticBinary string
 		Repository: sched.Repository,
 		Password:   sched.RepositoryPassword,
 		Env:        sched.RepositoryEnv,
+		Options:    sched.RepositoryOptions,
 	}
 
 	// Run the backup
@@ -673,7 +679,49 @@ func runBackup(cfg *config.AgentConfig, scheduleName string, resticBinary string
 	backupCtx, backupCancel := context.WithTimeout(context.Background(), 24*time.Hour)
 	defer backupCancel()
 
-	stats, err := restic.Backup(backupCtx, resticCfg, sched.Paths, sched.Excludes, tags)
+	var opts *backup.BackupOptions
+	if sched.ReadConcurrency != nil {
+		opts = &backup.BackupOptions{ReadConcurrency: sched.ReadConcurrency}
+	}
+
+	var stats *backup.BackupStats
+	var snapshots *fssnapshot.Session
+	switch sched.BackupType {
+	case string(models.BackupTypeKubernetes):
+		stats, err = backupKubernetes(backupCtx, restic, resticCfg, sched, tags, opts, logger)
+	case string(models.BackupTypeLibvirt):
+		stats, err = backupLibvirt(backupCtx, restic, resticCfg, sched, tags, opts, logger)
+	default:
+		snapshots, err = takeFilesystemSnapshots(backupCtx, sched, logger)
+	}
+	if snapshots != nil {
+		defer snapshots.Close()
+		if len(snapshots.Paths) > 0 {
+			if opts == nil {
+				opts = &backup.BackupOptions{}
+			}
+			opts.PathMounts = snapshots.Paths
+		}
+	}
+	if err == nil && stats == nil && (len(sched.Paths) > 0 || !sched.DockerDatabaseDumps) {
+		stats, err = restic.BackupWithOptions(backupCtx, resticCfg, sched.Paths, sched.Excludes, tags, opts)
+	}
+	if err == nil && sched.DockerDatabaseDumps {
+		var dumps []*docker.DatabaseDumpResult
+		dumps, err = dumpDockerDatabases(backupCtx, restic, resticCfg, tags, logger)
+		if err == nil && stats == nil {
+			// Dump-only schedules report the dumps as the backup.
+			if len(dumps) == 0 {
+				err = errors.New("no running database containers found")
+			} else {
+				stats = &backup.BackupStats{SnapshotID: dumps[0].SnapshotID}
+				for _, dump := range dumps {
+					stats.SizeBytes += dump.SizeBytes
+					stats.Duration += dump.Duration
+				}
+			}
+		}
+	}
 
 	completedAt := time.Now()
 
@@ -684,6 +732,19 @@ func runBackup(cfg *config.AgentConfig, scheduleName string, resticBinary string
 		StartedAt:    startedAt,
 		CompletedAt:  completedAt,
 	}
+	if stats != nil {
+		report.Transfer = &agent.TransferReport{
+			BytesProcessed:    stats.Transfer.BytesProcessed,
+			BytesUploaded:     stats.Transfer.BytesUploaded,
+			DurationMs:        stats.Duration.Milliseconds(),
+			OpenDurationMs:    stats.Transfer.OpenDuration.Milliseconds(),
+			UploadBytesPerSec: stats.Transfer.UploadBytesPerSecond(stats.Duration),
+			Retries:           stats.Transfer.Retries,
+			RetryWaitMs:       stats.Transfer.RetryWait.Milliseconds(),
+			BackendErrors:     stats.Transfer.BackendErrors,
+			FileErrors:        stats.Transfer.FileErrors,
+		}
+	}
 
 	if err != nil {
 		fmt.Printf("Backup failed: %v\n", err)
@@ -718,6 +779,143 @@ func runBackup(cfg *config.AgentConfig, scheduleName string, resticBinary string
 	return nil
 }
 
+// backupKubernetes exports the workloads a kubernetes schedule selects from
+// the cluster the agent runs in, using the agent's service account, and backs
+// them up with their PVC data in a single snapshot. Secrets are encrypted
+// with the server key, which agents do not have, so they are left out.
+func backupKubernetes(ctx context.Context, restic *backup.Restic, resticCfg backends.ResticConfig, sched *agent.ScheduleConfig, tags []string, opts *backup.BackupOptions, logger zerolog.Logger) (*backup.BackupStats, error) {
+	kubeOpts := models.DefaultKubernetesOptions()
+	if sched.KubernetesOptions != nil {
+		copied := *sched.KubernetesOptions
+		kubeOpts = &copied
+	}
+	if kubeOpts.IncludeSecrets {
+		fmt.Println("Skipping Secrets, they can only be encrypted by the server")
+		kubeOpts.IncludeSecrets = false
+	}
+
+	clusterCfg, err := kubernetes.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewRESTClient(clusterCfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("connect to kubernetes: %w", err)
+	}
+
+	fmt.Println("Exporting Kubernetes workloads...")
+	run, err := kubernetes.NewBackup(client, nil, logger).Prepare(ctx, kubeOpts)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes backup: %w", err)
+	}
+	// Post hooks and scale-ups must run even if the snapshot fails.
+	defer func() {
+		if err := run.Finish(context.WithoutCancel(ctx)); err != nil {
+			logger.Warn().Err(err).Msg("Kubernetes post-backup steps failed")
+		}
+	}()
+	fmt.Printf("  Namespaces: %s\n", strings.Join(run.Manifest.Namespaces, ", "))
+	fmt.Printf("  Resources:  %d (%d warnings)\n", len(run.Manifest.Resources), len(run.Manifest.Warnings))
+
+	kubeTags := append([]string{"kubernetes"}, tags...)
+	for _, ns := range run.Manifest.Namespaces {
+		kubeTags = append(kubeTags, "namespace:"+ns)
+	}
+	return restic.BackupWithOptions(ctx, resticCfg, run.Paths(), sched.Excludes, kubeTags, opts)
+}
+
+// backupLibvirt backs up the domains a libvirt schedule selects from the
+// libvirt daemon on this host. Running domains write to snapshot overlays
+// while restic reads their frozen images, and are pivoted back afterwards.
+func backupLibvirt(ctx context.Context, restic *backup.Restic, resticCfg backends.ResticConfig, sched *agent.ScheduleConfig, tags []string, opts *backup.BackupOptions, logger zerolog.Logger) (*backup.BackupStats, error) {
+	libvirtOpts := sched.LibvirtOptions
+	if libvirtOpts == nil {
+		libvirtOpts = models.DefaultLibvirtOptions()
+	}
+	if err := libvirtOpts.Validate(); err != nil {
+		return nil, err
+	}
+
+	tempDir, err := os.MkdirTemp("", "keldris-libvirt-backup-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	fmt.Println("Snapshotting libvirt domains...")
+	conn := vms.NewVirshConn(libvirtOpts.ConnectionURI(), nil)
+	run, err := vms.NewLibvirtBackupService(logger).BackupDomains(ctx, conn, libvirtOpts, tempDir)
+	if err != nil {
+		return nil, fmt.Errorf("libvirt backup: %w", err)
+	}
+	// Domains must be pivoted back to their images even if the snapshot fails.
+	defer func() {
+		if err := run.Finish(context.WithoutCancel(ctx)); err != nil {
+			logger.Error().Err(err).Msg("libvirt block commit failed")
+		}
+	}()
+
+	result := run.Result
+	if !result.Success {
+		return nil, fmt.Errorf("libvirt backup: %s", result.ErrorMessage)
+	}
+	if len(result.BackupPaths) == 0 {
+		return nil, fmt.Errorf("libvirt backup: no domains matched the schedule")
+	}
+	fmt.Printf("  Domains: %d (%d bytes)\n", result.VMsBackedUp, result.TotalSize)
+
+	libvirtTags := append([]string{"libvirt", fmt.Sprintf("vms:%d", result.VMsBackedUp)}, tags...)
+	for _, vm := range result.VMResults {
+		libvirtTags = append(libvirtTags, "domain:"+vm.Name)
+	}
+	return restic.BackupWithOptions(ctx, resticCfg, result.BackupPaths, sched.Excludes, libvirtTags, opts)
+}
+
+// takeFilesystemSnapshots snapshots the schedule's paths when it asks for
+// crash-consistent backups, so restic reads the snapshots while recording the
+// original paths. It returns nil when snapshots are off.
+func takeFilesystemSnapshots(ctx context.Context, sched *agent.ScheduleConfig, logger zerolog.Logger) (*fssnapshot.Session, error) {
+	mode := models.FilesystemSnapshotMode(sched.FilesystemSnapshot)
+	if !mode.Enabled() {
+		return nil, nil
+	}
+
+	fmt.Println("Taking filesystem snapshots...")
+	session, err := fssnapshot.NewManager(logger).Snapshot(ctx, sched.Paths, mode == models.FilesystemSnapshotRequired)
+	if err != nil {
+		return nil, fmt.Errorf("filesystem snapshot: %w", err)
+	}
+	for _, path := range session.Live {
+		fmt.Printf("  Reading %s live, it is not on a snapshot-capable volume\n", path)
+	}
+	return session, nil
+}
+
+// dumpDockerDatabases dumps every running database container on the host
+// into its own snapshot. A failed dump does not stop the others.
+func dumpDockerDatabases(ctx context.Context, restic *backup.Restic, resticCfg backends.ResticConfig, tags []string, logger zerolog.Logger) ([]*docker.DatabaseDumpResult, error) {
+	dumper := docker.NewDatabaseDumper(restic, logger)
+	databases, err := dumper.Detect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("detect database containers: %w", err)
+	}
+
+	var results []*docker.DatabaseDumpResult
+	var errs []error
+	for _, db := range databases {
+		fmt.Printf("Dumping %s database in container %s...\n", db.Engine, db.ContainerName)
+		result, err := dumper.Dump(ctx, resticCfg, db, tags, nil)
+		if err != nil {
+			fmt.Printf("  Failed: %v\n", err)
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Printf("  Snapshot %s, %d bytes in %s\n", result.SnapshotID, result.SizeBytes, result.Duration.Round(time.Second))
+		results = append(results, result)
+	}
+	return results, errors.Join(errs...)
+}
+
 func newRestoreCmd() *cobra.Command {
 	var latest bool
 	var snapshotID string
@@ -791,6 +989,7 @@ func runRestore(cfg *config.AgentConfig, latest bool, snapshotID, targetPath str
 		Repository: sched.Repository,
 		Password:   sched.RepositoryPassword,
 		Env:        sched.RepositoryEnv,
+		Options:    sched.RepositoryOptions,
 	}
 
 	restic := backup.NewRestic(logger)
@@ -910,6 +1109,25 @@ func runDaemon(cfg *config.AgentConfig, heartbeatInterval time.Duration) error {
 	scheduleRefreshTicker := time.NewTicker(5 * time.Minute)
 	defer scheduleRefreshTicker.Stop()
 
+	// Remove filesystem snapshots left behind if a backup was interrupted
+	if runtime.GOOS == "linux" && os.Geteuid() == 0 {
+		cleanupCtx, cancelCleanup := context.WithTimeout(context.Background(), 2*time.Minute)
+		if err := fssnapshot.NewManager(logger).CleanupStale(cleanupCtx); err != nil {
+			logger.Warn().Err(err).Msg("failed to clean up stale filesystem snapshots")
+		}
+		cancelCleanup()
+	}
+
+	// Watch Docker events so labelled containers are reported as they change
+	if engine := docker.DefaultEngineClient(logger); engine != nil {
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		handler := &dockerEventHandler{cfg: cfg, client: client, resticBinary: resticBinary, logger: logger}
+		watcher := docker.NewEventWatcher(engine, handler, docker.DefaultEventWatcherConfig(), logger)
+		go watcher.Run(watchCtx)
+		logger.Info().Str("host", engine.Host()).Msg("watching docker events")
+	}
+
 	fmt.Println("Agent daemon running. Press Ctrl+C to stop.")
 
 	for {
@@ -2167,6 +2385,14 @@ func executeCommand(client *agent.Client, cfg *config.AgentConfig, cmd agent.Com
 		result, execErr = executeFileDiff(cfg, cmd.Payload, resticBinary, logger)
 	case "docker_inspect":
 		result, execErr = executeDockerInspect(cfg, cmd.Payload, logger)
+	case "docker_database_restore":
+		result, execErr = executeDockerDatabaseRestore(cfg, cmd.Payload, resticBinary, logger)
+	case "kubernetes_restore":
+		result, execErr = executeKubernetesRestore(cfg, cmd.Payload, resticBinary, logger)
+	case "libvirt_discover":
+		result, execErr = executeLibvirtDiscover(cmd.Payload, logger)
+	case "libvirt_restore":
+		result, execErr = executeLibvirtRestore(cfg, cmd.Payload, resticBinary, logger)
 	default:
 		execErr = fmt.Errorf("unknown command type: %s", cmd.Type)
 	}
@@ -2314,6 +2540,7 @@ func executeDryRun(cfg *config.AgentConfig, payload *agent.CommandPayload, resti
 		Repository: sched.Repository,
 		Password:   sched.RepositoryPassword,
 		Env:        sched.RepositoryEnv,
+		Options:    sched.RepositoryOptions,
 	}
 
 	restic := backup.NewResticWithBinary(resticBinary, *logger)
@@ -2765,6 +2992,7 @@ func findRepoConfig(cfg *config.AgentConfig, repoID string) (*backends.ResticCon
 				Repository: s.Repository,
 				Password:   s.RepositoryPassword,
 				Env:        s.RepositoryEnv,
+				Options:    s.RepositoryOptions,
 			}, nil
 		}
 	}
@@ -2835,6 +3063,7 @@ func executeSnapshotDiff(cfg *config.AgentConfig, payload *agent.CommandPayload,
 			Repository: schedules[0].Repository,
 			Password:   schedules[0].RepositoryPassword,
 			Env:        schedules[0].RepositoryEnv,
+			Options:    schedules[0].RepositoryOptions,
 		}
 	}
 
@@ -2881,6 +3110,7 @@ func executeFileDiff(cfg *config.AgentConfig, payload *agent.CommandPayload, res
 			Repository: schedules[0].Repository,
 			Password:   schedules[0].RepositoryPassword,
 			Env:        schedules[0].RepositoryEnv,
+			Options:    schedules[0].RepositoryOptions,
 		}
 	}
 
@@ -2901,6 +3131,178 @@ func executeFileDiff(cfg *config.AgentConfig, payload *agent.CommandPayload, res
 	}, nil
 }
 
+// executeDockerDatabaseRestore streams a database dump from a snapshot into
+// a running database container.
+func executeDockerDatabaseRestore(cfg *config.AgentConfig, payload *agent.CommandPayload, resticBinary string, logger *zerolog.Logger) (*agent.CommandResultDetail, error) {
+	if payload == nil || payload.SnapshotID == "" || payload.RepositoryID == "" || payload.Container == "" {
+		return nil, fmt.Errorf("snapshot_id, repository_id, and container are required for database restore")
+	}
+
+	resticCfg, err := findRepoConfig(cfg, payload.RepositoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+
+	dumper := docker.NewDatabaseDumper(backup.NewResticWithBinary(resticBinary, *logger), *logger)
+	databases, err := dumper.Detect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("detect database containers: %w", err)
+	}
+	var db *docker.DatabaseContainer
+	for _, candidate := range databases {
+		if candidate.ContainerName == payload.Container || strings.HasPrefix(candidate.ContainerID, payload.Container) {
+			db = candidate
+			break
+		}
+	}
+	if db == nil {
+		return nil, fmt.Errorf("no running database container %q", payload.Container)
+	}
+
+	logger.Info().
+		Str("snapshot_id", payload.SnapshotID).
+		Str("container", db.ContainerName).
+		Str("engine", string(db.Engine)).
+		Msg("restoring database dump into container")
+
+	if err := dumper.Restore(ctx, *resticCfg, payload.SnapshotID, payload.FilePath, db); err != nil {
+		return nil, err
+	}
+	return &agent.CommandResultDetail{
+		Output: fmt.Sprintf("restored %s database in %s from snapshot %s", db.Engine, db.ContainerName, payload.SnapshotID),
+	}, nil
+}
+
+// executeKubernetesRestore restores namespaces from a Kubernetes backup into
+// the cluster the agent runs in, using the agent's service account. Secrets
+// encrypted with the server key cannot be decrypted here and are reported as
+// warnings.
+func executeKubernetesRestore(cfg *config.AgentConfig, payload *agent.CommandPayload, resticBinary string, logger *zerolog.Logger) (*agent.CommandResultDetail, error) {
+	if payload == nil || payload.SnapshotID == "" || payload.RepositoryID == "" {
+		return nil, fmt.Errorf("snapshot_id and repository_id are required for kubernetes restore")
+	}
+
+	resticCfg, err := findRepoConfig(cfg, payload.RepositoryID)
+	if err != nil {
+		return nil, err
+	}
+	clusterCfg, err := kubernetes.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewRESTClient(clusterCfg, *logger)
+	if err != nil {
+		return nil, fmt.Errorf("connect to kubernetes: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+
+	logger.Info().
+		Str("restore_id", payload.RestoreID).
+		Str("snapshot_id", payload.SnapshotID).
+		Strs("namespaces", payload.Namespaces).
+		Msg("restoring kubernetes namespaces")
+
+	opts := kubernetes.RestoreOptions{
+		Namespaces:       payload.Namespaces,
+		NamespaceMapping: payload.NamespaceMapping,
+		NameMapping:      payload.NameMapping,
+		Overwrite:        payload.Overwrite,
+	}
+	restorer := backup.NewKubernetesSnapshotRestorer(backup.NewResticWithBinary(resticBinary, *logger), client, nil,
+		models.DefaultKubernetesOptions().KubeletRootDir, *logger)
+	result, err := restorer.Restore(ctx, *resticCfg, payload.SnapshotID, opts, payload.RestoreVolumes)
+	if err != nil {
+		return nil, err
+	}
+	return &agent.CommandResultDetail{
+		Output: fmt.Sprintf("created %d, updated %d, skipped %d objects; restored %d volumes",
+			result.Created, result.Updated, result.Skipped, result.Volumes),
+		KubernetesRestore: &agent.KubernetesRestoreResultDetail{
+			Created:        result.Created,
+			Updated:        result.Updated,
+			Skipped:        result.Skipped,
+			Volumes:        result.Volumes,
+			PendingVolumes: result.PendingVolumes,
+			Warnings:       result.Warnings,
+		},
+	}, nil
+}
+
+// executeLibvirtDiscover lists the domains of the libvirt daemon on this
+// host. Connection errors are part of the result rather than a failure.
+func executeLibvirtDiscover(payload *agent.CommandPayload, logger *zerolog.Logger) (*agent.CommandResultDetail, error) {
+	uri := models.DefaultLibvirtURI
+	if payload != nil && payload.LibvirtURI != "" {
+		uri = payload.LibvirtURI
+	}
+	if !models.ValidLibvirtURI(uri) {
+		return nil, fmt.Errorf("invalid libvirt URI %q", uri)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	result := vms.NewLibvirtDiscovery(*logger).Discover(ctx, vms.NewVirshConn(uri, nil), uri)
+	info := result.LibvirtInfo
+	return &agent.CommandResultDetail{
+		Output:  fmt.Sprintf("%d domains, %d running", info.DomainCount, info.RunningCount),
+		Libvirt: info,
+	}, nil
+}
+
+// executeLibvirtRestore restores a libvirt domain from a snapshot onto this
+// host. Disk images are only written inside the agent's libvirt images
+// directory, and definitions with devices outside the allowlist are refused.
+func executeLibvirtRestore(cfg *config.AgentConfig, payload *agent.CommandPayload, resticBinary string, logger *zerolog.Logger) (*agent.CommandResultDetail, error) {
+	if payload == nil || payload.SnapshotID == "" || payload.RepositoryID == "" {
+		return nil, fmt.Errorf("snapshot_id and repository_id are required for libvirt restore")
+	}
+	uri := models.DefaultLibvirtURI
+	if payload.LibvirtURI != "" {
+		uri = payload.LibvirtURI
+	}
+	if !models.ValidLibvirtURI(uri) {
+		return nil, fmt.Errorf("invalid libvirt URI %q", uri)
+	}
+
+	resticCfg, err := findRepoConfig(cfg, payload.RepositoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Hour)
+	defer cancel()
+
+	logger.Info().
+		Str("restore_id", payload.RestoreID).
+		Str("snapshot_id", payload.SnapshotID).
+		Str("domain", payload.Domain).
+		Msg("restoring libvirt domain")
+
+	opts := backup.LibvirtRestoreOptions{
+		Domain:    payload.Domain,
+		NewName:   payload.NewName,
+		TargetDir: payload.TargetDir,
+		Overwrite: payload.Overwrite,
+		Start:     payload.StartDomain,
+	}
+	restorer := backup.NewLibvirtSnapshotRestorer(backup.NewResticWithBinary(resticBinary, *logger),
+		vms.NewVirshConn(uri, nil), cfg.LibvirtImagesDir, *logger)
+	result, err := restorer.Restore(ctx, *resticCfg, payload.SnapshotID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &agent.CommandResultDetail{
+		Output:         fmt.Sprintf("defined domain %s with %d disk images", result.Domain, len(result.Disks)),
+		LibvirtRestore: result,
+	}, nil
+}
+
 // executeDockerInspect inspects Docker containers/volumes in a snapshot.
 func executeDockerInspect(_ *config.AgentConfig, payload *agent.CommandPayload, logger *zerolog.Logger) (*agent.CommandResultDetail, error) {
 	if payload == nil || payload.SnapshotID == "" {
@@ -2981,3 +3383,116 @@ func executeDockerInspect(_ *config.AgentConfig, payload *agent.CommandPayload,
 		Output: string(resultJSON),
 	}, nil
 }
+
+// dockerEventHandler reports labelled containers to the server as the Docker
+// event watcher sees them change, and runs the final backup of containers
+// removed with keldris.backup.on-remove=true.
+type dockerEventHandler struct {
+	cfg          *config.AgentConfig
+	client       *agent.Client
+	resticBinary string
+	logger       zerolog.Logger
+}
+
+// ContainersChanged sends the host's containers to the server.
+func (h *dockerEventHandler) ContainersChanged(_ context.Context, containers []docker.ContainerInfo) error {
+	report := &agent.DockerContainerReport{Containers: make([]agent.DockerContainer, 0, len(containers))}
+	for _, c := range containers {
+		container := agent.DockerContainer{
+			ID:     c.ID,
+			Name:   c.Name,
+			Image:  c.Image,
+			Labels: c.Labels,
+			Status: c.Status,
+		}
+		for _, m := range c.Mounts {
+			container.Mounts = append(container.Mounts, agent.DockerMount{
+				Type:        m.Type,
+				Name:        m.Name,
+				Source:      m.Source,
+				Destination: m.Destination,
+				ReadOnly:    m.ReadOnly,
+			})
+		}
+		report.Containers = append(report.Containers, container)
+	}
+	return h.client.ReportDockerContainers(report)
+}
+
+// ContainerRemoved backs up the volumes of a removed container to the
+// repository of the docker schedule that backs it up and reports the result.
+// Without such a schedule nothing is backed up and the server is told so.
+func (h *dockerEventHandler) ContainerRemoved(ctx context.Context, container docker.ContainerInfo) error {
+	paths, excludes := docker.NewLabelParser().BackupPaths(container)
+	if len(paths) == 0 {
+		return h.finalBackupFailed(container, fmt.Errorf("container %s has no volumes to back up", container.Name))
+	}
+
+	schedules, err := h.client.GetSchedules()
+	if err != nil {
+		return fmt.Errorf("fetch schedules: %w", err)
+	}
+	sched := agent.DockerScheduleForContainer(schedules, container.ID, container.Name)
+	if sched == nil {
+		return h.finalBackupFailed(container, fmt.Errorf("no enabled docker schedule backs up container %s", container.Name))
+	}
+
+	resticCfg := backends.ResticConfig{
+		Repository: sched.Repository,
+		Password:   sched.RepositoryPassword,
+		Env:        sched.RepositoryEnv,
+		Options:    sched.RepositoryOptions,
+	}
+	hostname, _ := os.Hostname()
+	tags := []string{
+		"agent:" + h.cfg.AgentID,
+		"schedule:" + sched.ID.String(),
+		"host:" + hostname,
+		"docker-container:" + container.Name,
+		"docker-final",
+	}
+
+	restic := backup.NewResticWithBinary(h.resticBinary, h.logger)
+	startedAt := time.Now()
+	stats, err := restic.Backup(ctx, resticCfg, paths, excludes, tags)
+
+	report := &agent.BackupReport{
+		ScheduleID:   sched.ID,
+		RepositoryID: sched.RepositoryID,
+		StartedAt:    startedAt,
+		CompletedAt:  time.Now(),
+	}
+	if err != nil {
+		report.Status = "failed"
+		errMsg := err.Error()
+		report.ErrorMessage = &errMsg
+	} else {
+		report.Status = "completed"
+		report.SnapshotID = stats.SnapshotID
+		report.SizeBytes = &stats.SizeBytes
+		report.FilesNew = &stats.FilesNew
+		report.FilesChanged = &stats.FilesChanged
+	}
+	if reportErr := h.client.ReportBackup(report); reportErr != nil {
+		h.logger.Warn().Err(reportErr).Str("container", container.Name).Msg("failed to report final backup")
+	}
+
+	if err != nil {
+		return fmt.Errorf("backup removed container %s: %w", container.Name, err)
+	}
+	return nil
+}
+
+// finalBackupFailed reports a final backup that could not run to the server
+// and returns err.
+func (h *dockerEventHandler) finalBackupFailed(container docker.ContainerInfo, err error) error {
+	report := &agent.FinalBackupFailure{
+		ContainerID:   container.ID,
+		ContainerName: container.Name,
+		Error:         err.Error(),
+	}
+	if reportErr := h.client.ReportFinalBackupFailure(report); reportErr != nil {
+		h.logger.Warn().Err(reportErr).Str("container", container.Name).Msg("failed to report final backup failure")
+	}
+	return err
+}
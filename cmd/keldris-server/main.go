@@ -76,6 +76,9 @@ import (
 	"github.com/MacJediWizard/keldris/internal/api/handlers"
 	"github.com/MacJediWizard/keldris/internal/auth"
 	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/backup/databases"
+	"github.com/MacJediWizard/keldris/internal/compliance"
 	"github.com/MacJediWizard/keldris/internal/config"
 	"github.com/MacJediWizard/keldris/internal/crypto"
 	"github.com/MacJediWizard/keldris/internal/db"
@@ -87,6 +90,7 @@ import (
 	"github.com/MacJediWizard/keldris/internal/monitoring"
 	"github.com/MacJediWizard/keldris/internal/notifications"
 	"github.com/MacJediWizard/keldris/internal/reports"
+	"github.com/MacJediWizard/keldris/internal/restserver"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 )
@@ -295,6 +299,8 @@ func run() int {
 	backupSchedulerConfig := backup.DefaultSchedulerConfig()
 	backupSchedulerConfig.PasswordFunc = verificationConfig.PasswordFunc
 	backupSchedulerConfig.DecryptFunc = verificationConfig.DecryptFunc
+	databaseStreamer := databases.NewScheduleStreamer(database, keyManager, logger)
+	backupSchedulerConfig.DatabaseStreamer = databaseStreamer
 	backupScheduler := backup.NewScheduler(database, resticBin, backupSchedulerConfig, nil, logger)
 
 	// Initialize DR test scheduler
@@ -303,6 +309,49 @@ func run() int {
 	drTestConfig.DecryptFunc = verificationConfig.DecryptFunc
 	drTestScheduler := backup.NewDRTestScheduler(database, resticBin, drTestConfig, logger)
 
+	// Initialize repository migrator and resume migrations interrupted by a restart
+	repositoryMigrator := backup.NewRepositoryMigrator(database, resticBin, verificationConfig.DecryptFunc, verificationConfig.PasswordFunc, logger)
+	go repositoryMigrator.ResumeUnfinished(ctx)
+
+	// Initialize Kubernetes namespace restorer
+	kubernetesRestorer := backup.NewKubernetesRestorer(database, resticBin, verificationConfig.DecryptFunc, verificationConfig.PasswordFunc, keyManager, logger)
+
+	// Initialize Proxmox VM restorer
+	proxmoxRestorer := backup.NewProxmoxRestorer(database, resticBin, verificationConfig.DecryptFunc, verificationConfig.PasswordFunc, logger)
+
+	// Initialize PostgreSQL and MySQL restorer
+	databaseRestorer := backup.NewDatabaseRestorer(database, resticBin, databaseStreamer, verificationConfig.DecryptFunc, verificationConfig.PasswordFunc, logger)
+
+	// S3 Object Lock enforcement for immutability locks and legal holds
+	objectLockers := backup.S3ObjectLockers(database, resticBin, verificationConfig.DecryptFunc, verificationConfig.PasswordFunc)
+
+	// Initialize repository maintenance planner
+	maintenancePlannerConfig := backup.DefaultMaintenancePlannerConfig()
+	maintenancePlannerConfig.PasswordFunc = verificationConfig.PasswordFunc
+	maintenancePlannerConfig.DecryptFunc = verificationConfig.DecryptFunc
+	maintenancePlanner := backup.NewMaintenancePlanner(database, resticBin, maintenancePlannerConfig, logger)
+
+	// Ambient cloud credentials resolve to the identity of the machine running
+	// restic, which includes this server, so they are opt-in.
+	ambientCredentials, _ := strconv.ParseBool(os.Getenv("AMBIENT_CLOUD_CREDENTIALS"))
+	backends.SetAmbientCredentialsAllowed(ambientCredentials)
+
+	// Built-in restic REST server for repositories hosted on this server
+	var resticServer *restserver.Server
+	if dir := os.Getenv("REST_SERVER_DIR"); dir != "" {
+		if os.Getenv("SERVER_URL") == "" {
+			logger.Fatal().Msg("SERVER_URL is required when REST_SERVER_DIR is set")
+			return 1
+		}
+		appendOnly, _ := strconv.ParseBool(os.Getenv("REST_SERVER_APPEND_ONLY"))
+		resticServer, err = restserver.New(restserver.Config{Dir: dir, AppendOnly: appendOnly}, database, keyManager, logger)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to initialize restic REST server")
+			return 1
+		}
+		logger.Info().Str("dir", dir).Bool("append_only", appendOnly).Msg("Restic REST server enabled")
+	}
+
 	// Initialize notification service
 	notificationService := notifications.NewService(database, keyManager, logger)
 
@@ -311,6 +360,9 @@ func run() int {
 	alertService := monitoring.NewAlertService(database, alertNotifier, logger)
 	monitor := monitoring.NewMonitor(database, alertService, monitoring.DefaultConfig(), logger)
 
+	// Initialize 3-2-1 backup compliance checker
+	complianceChecker := compliance.NewChecker(database, alertService, compliance.DefaultConfig(), logger)
+
 	// Initialize Docker monitor
 	dockerMonitor := monitoring.NewDockerMonitorWithDB(database, alertService, monitoring.DefaultDockerMonitorConfig(), logger)
 
@@ -380,6 +432,7 @@ func run() int {
 		RateLimitRequests:     rateLimitRequests,
 		RateLimitPeriod:       rateLimitPeriod,
 		RedisURL:              os.Getenv("REDIS_URL"),
+		ServerURL:             os.Getenv("SERVER_URL"),
 		Version:               Version,
 		Commit:                Commit,
 		BuildDate:             BuildDate,
@@ -387,6 +440,14 @@ func run() int {
 		VerificationTrigger:   verificationScheduler,
 		ReportScheduler:       reportScheduler,
 		DRTestRunner:          drTestScheduler,
+		RepositoryMigrator:    repositoryMigrator,
+		MaintenancePlanner:    maintenancePlanner,
+		KubernetesRestorer:    kubernetesRestorer,
+		ProxmoxRestorer:       proxmoxRestorer,
+		DatabaseRestorer:      databaseRestorer,
+		ObjectLockers:         objectLockers,
+		RestServer:            resticServer,
+		ComplianceEvaluator:   complianceChecker,
 		License:               lic,
 		Validator:             validator,
 		LicensePublicKey:      licPubKey,
@@ -394,6 +455,7 @@ func run() int {
 		ActivityFeed:          activityFeed,
 		LogBuffer:             logBuffer,
 		DatabaseBackupService: dbBackupService,
+		NotificationService:   notificationService,
 	}
 
 	router, err := api.NewRouter(routerCfg, database, oidcProvider, sessions, keyManager, logger)
@@ -468,6 +530,14 @@ func run() int {
 	monitor.Start(ctx)
 	defer monitor.Stop()
 
+	// Start backup compliance checker
+	complianceChecker.Start(ctx)
+	defer complianceChecker.Stop()
+
+	// Start repository maintenance planner
+	maintenancePlanner.Start(ctx)
+	defer maintenancePlanner.Stop()
+
 	// Start report scheduler
 	if err := reportScheduler.Start(ctx); err != nil {
 		logger.Error().Err(err).Msg("Failed to start report scheduler")
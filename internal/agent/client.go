@@ -8,8 +8,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/google/uuid"
 )
 
@@ -48,6 +50,62 @@ type ScheduleConfig struct {
 	Repository         string            `json:"repository"`
 	RepositoryPassword string            `json:"repository_password"`
 	RepositoryEnv      map[string]string `json:"repository_env,omitempty"`
+	// RepositoryOptions are global restic flags for the repository, such as
+	// bandwidth limits and backend connection counts.
+	RepositoryOptions []string `json:"repository_options,omitempty"`
+	ReadConcurrency   *int     `json:"read_concurrency,omitempty"`
+	// FilesystemSnapshot is "auto" or "required" when the paths should be
+	// read from LVM, ZFS or btrfs snapshots.
+	FilesystemSnapshot string `json:"filesystem_snapshot,omitempty"`
+	// DockerDatabaseDumps dumps detected database containers into the
+	// repository after the paths are backed up.
+	DockerDatabaseDumps bool `json:"docker_database_dumps,omitempty"`
+	// BackupType is the schedule's backup type, such as "docker".
+	BackupType string `json:"backup_type,omitempty"`
+	// DockerContainerIDs are the containers, by ID or name, a docker
+	// schedule backs up. Empty covers every container on the host.
+	DockerContainerIDs []string `json:"docker_container_ids,omitempty"`
+	// KubernetesOptions select what a kubernetes schedule exports from the
+	// cluster the agent runs in.
+	KubernetesOptions *models.KubernetesBackupOptions `json:"kubernetes_options,omitempty"`
+	// LibvirtOptions select the domains a libvirt schedule backs up from the
+	// libvirt daemon on the agent's host.
+	LibvirtOptions *models.LibvirtBackupOptions `json:"libvirt_options,omitempty"`
+}
+
+// backsUpContainer reports whether a docker schedule lists the container by
+// name or by its full or short ID.
+func (s *ScheduleConfig) backsUpContainer(id, name string) bool {
+	for _, c := range s.DockerContainerIDs {
+		c = strings.TrimPrefix(c, "/")
+		if c == "" {
+			continue
+		}
+		if c == name || c == id || (len(c) >= 12 && strings.HasPrefix(id, c)) {
+			return true
+		}
+	}
+	return false
+}
+
+// DockerScheduleForContainer returns the enabled docker schedule that backs
+// up a container: one that lists it, or else one that covers every
+// container. It returns nil when no docker schedule covers the container.
+func DockerScheduleForContainer(schedules []ScheduleConfig, id, name string) *ScheduleConfig {
+	var all *ScheduleConfig
+	for i := range schedules {
+		s := &schedules[i]
+		if !s.Enabled || s.BackupType != "docker" {
+			continue
+		}
+		if s.backsUpContainer(id, name) {
+			return s
+		}
+		if len(s.DockerContainerIDs) == 0 && all == nil {
+			all = s
+		}
+	}
+	return all
 }
 
 // GetSchedules retrieves the agent's backup schedules with decrypted repo credentials.
@@ -71,6 +129,21 @@ type BackupReport struct {
 	ErrorMessage *string   `json:"error_message,omitempty"`
 	StartedAt    time.Time `json:"started_at"`
 	CompletedAt  time.Time `json:"completed_at"`
+	// Transfer holds the backend metrics restic reported for the run.
+	Transfer *TransferReport `json:"transfer,omitempty"`
+}
+
+// TransferReport describes how a backup run used the repository backend.
+type TransferReport struct {
+	BytesProcessed    int64   `json:"bytes_processed"`
+	BytesUploaded     int64   `json:"bytes_uploaded"`
+	DurationMs        int64   `json:"duration_ms"`
+	OpenDurationMs    int64   `json:"open_duration_ms"`
+	UploadBytesPerSec float64 `json:"upload_bytes_per_sec"`
+	Retries           int     `json:"retries"`
+	RetryWaitMs       int64   `json:"retry_wait_ms"`
+	BackendErrors     int     `json:"backend_errors"`
+	FileErrors        int     `json:"file_errors"`
 }
 
 // ReportBackup reports a completed backup to the server.
@@ -183,6 +256,56 @@ func (c *Client) SendHeartbeat(req *HeartbeatRequest) error {
 	return nil
 }
 
+// DockerContainerReport is the request body for reporting Docker containers.
+type DockerContainerReport struct {
+	Containers []DockerContainer `json:"containers"`
+}
+
+// DockerContainer describes a container and its labels.
+type DockerContainer struct {
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	Image  string            `json:"image"`
+	Labels map[string]string `json:"labels"`
+	Mounts []DockerMount     `json:"mounts,omitempty"`
+	Status string            `json:"status,omitempty"`
+}
+
+// DockerMount describes a container mount.
+type DockerMount struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	ReadOnly    bool   `json:"read_only"`
+}
+
+// FinalBackupFailure reports that the final backup of a removed container
+// could not run.
+type FinalBackupFailure struct {
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	Error         string `json:"error"`
+}
+
+// ReportFinalBackupFailure tells the server, which raises an alert, that a
+// removed container's final backup could not run.
+func (c *Client) ReportFinalBackupFailure(report *FinalBackupFailure) error {
+	if err := c.post("/api/v1/agent/docker/final-backup-failures", report, nil); err != nil {
+		return fmt.Errorf("report final backup failure: %w", err)
+	}
+	return nil
+}
+
+// ReportDockerContainers sends the containers on this host to the server,
+// which updates label-driven container backup configurations.
+func (c *Client) ReportDockerContainers(report *DockerContainerReport) error {
+	if err := c.post("/api/v1/agent/docker/containers", report, nil); err != nil {
+		return fmt.Errorf("report docker containers: %w", err)
+	}
+	return nil
+}
+
 func (c *Client) get(path string, result any) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -268,6 +391,20 @@ type CommandPayload struct {
 	TargetPath          string   `json:"target_path,omitempty"`
 	SnapshotID2         string   `json:"snapshot_id_2,omitempty"`
 	FilePath            string   `json:"file_path,omitempty"`
+	Container           string   `json:"container,omitempty"`
+	// kubernetes_restore
+	RestoreID        string            `json:"restore_id,omitempty"`
+	Namespaces       []string          `json:"namespaces,omitempty"`
+	NamespaceMapping map[string]string `json:"namespace_mapping,omitempty"`
+	NameMapping      map[string]string `json:"name_mapping,omitempty"`
+	Overwrite        bool              `json:"overwrite,omitempty"`
+	RestoreVolumes   bool              `json:"restore_volumes,omitempty"`
+	// libvirt_discover and libvirt_restore
+	LibvirtURI  string `json:"libvirt_uri,omitempty"`
+	Domain      string `json:"domain,omitempty"`
+	NewName     string `json:"new_name,omitempty"`
+	TargetDir   string `json:"target_dir,omitempty"`
+	StartDomain bool   `json:"start_domain,omitempty"`
 }
 
 // CommandsResponse is the server response for polling commands.
@@ -287,6 +424,22 @@ type CommandResultDetail struct {
 	Error       string              `json:"error,omitempty"`
 	Diagnostics map[string]any      `json:"diagnostics,omitempty"`
 	DryRun      *DryRunResultDetail `json:"dry_run,omitempty"`
+	// KubernetesRestore is the result of a kubernetes_restore command.
+	KubernetesRestore *KubernetesRestoreResultDetail `json:"kubernetes_restore,omitempty"`
+	// Libvirt is the result of a libvirt_discover command.
+	Libvirt *models.LibvirtInfo `json:"libvirt,omitempty"`
+	// LibvirtRestore is the result of a libvirt_restore command.
+	LibvirtRestore *models.LibvirtRestoreResult `json:"libvirt_restore,omitempty"`
+}
+
+// KubernetesRestoreResultDetail summarizes what a Kubernetes restore applied.
+type KubernetesRestoreResultDetail struct {
+	Created        int      `json:"created"`
+	Updated        int      `json:"updated"`
+	Skipped        int      `json:"skipped"`
+	Volumes        int      `json:"volumes_restored"`
+	PendingVolumes []string `json:"pending_volumes,omitempty"`
+	Warnings       []string `json:"warnings,omitempty"`
 }
 
 // DryRunResultDetail contains dry run backup preview results.
@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDockerScheduleForContainer(t *testing.T) {
+	const id = "3f2a9c1e7b4d8a6f0e1d2c3b4a5f6e7d8c9b0a1f2e3d4c5b6a7f8e9d0c1b2a3f"
+	files := ScheduleConfig{ID: uuid.New(), Enabled: true, BackupType: "file"}
+	all := ScheduleConfig{ID: uuid.New(), Enabled: true, BackupType: "docker"}
+	byName := ScheduleConfig{ID: uuid.New(), Enabled: true, BackupType: "docker", DockerContainerIDs: []string{"/db"}}
+	byShortID := ScheduleConfig{ID: uuid.New(), Enabled: true, BackupType: "docker", DockerContainerIDs: []string{id[:12]}}
+	disabled := ScheduleConfig{ID: uuid.New(), BackupType: "docker", DockerContainerIDs: []string{"db"}}
+	other := ScheduleConfig{ID: uuid.New(), Enabled: true, BackupType: "docker", DockerContainerIDs: []string{"web", id[:4]}}
+
+	tests := []struct {
+		name      string
+		schedules []ScheduleConfig
+		want      *uuid.UUID
+	}{
+		{"listed by name", []ScheduleConfig{files, all, byName}, &byName.ID},
+		{"listed by short id", []ScheduleConfig{byShortID, all}, &byShortID.ID},
+		{"covered by all containers", []ScheduleConfig{files, disabled, other, all}, &all.ID},
+		{"no docker schedule", []ScheduleConfig{files, disabled, other}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DockerScheduleForContainer(tt.schedules, id, "db")
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("got schedule %s, want none", got.ID)
+			case tt.want != nil && (got == nil || got.ID != *tt.want):
+				t.Errorf("got %v, want schedule %s", got, *tt.want)
+			}
+		})
+	}
+}
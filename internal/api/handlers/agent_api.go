@@ -11,6 +11,7 @@ import (
 	"github.com/MacJediWizard/keldris/internal/backup/backends"
 	"github.com/MacJediWizard/keldris/internal/crypto"
 	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/MacJediWizard/keldris/internal/restserver"
 	pkgmodels "github.com/MacJediWizard/keldris/pkg/models"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -37,6 +38,8 @@ type AgentAPIStore interface {
 	UpdateBackup(ctx context.Context, backup *models.Backup) error
 	GetBackupsByAgentID(ctx context.Context, agentID uuid.UUID) ([]*models.Backup, error)
 	GetScheduleByID(ctx context.Context, id uuid.UUID) (*models.Schedule, error)
+	GetRepositoryTransferSettings(ctx context.Context, repositoryID uuid.UUID) (*models.RepositoryTransferSettings, error)
+	CreateBackupTransferMetrics(ctx context.Context, m *models.BackupTransferMetrics) error
 }
 
 // AgentAPIHandler handles agent-facing API endpoints (authenticated via API key).
@@ -68,6 +71,7 @@ func (h *AgentAPIHandler) RegisterRoutes(r *gin.RouterGroup) {
 	r.POST("/commands/:id/result", h.ReportCommandResult)
 	r.POST("/queued-backups", h.ReportQueuedBackups)
 	r.POST("/reconnect", h.NotifyReconnection)
+	r.POST("/docker/final-backup-failures", h.ReportFinalBackupFailure)
 }
 
 // ReportHealth handles agent health reports.
@@ -571,6 +575,27 @@ func (h *AgentAPIHandler) ReportCommandResult(c *gin.Context) {
 			}
 			req.Result.Diagnostics = trimmed
 		}
+		if kr := req.Result.KubernetesRestore; kr != nil {
+			const maxWarnings = 1000
+			if len(kr.Warnings) > maxWarnings {
+				kr.Warnings = kr.Warnings[:maxWarnings]
+			}
+			if len(kr.PendingVolumes) > maxWarnings {
+				kr.PendingVolumes = kr.PendingVolumes[:maxWarnings]
+			}
+		}
+		if lr := req.Result.LibvirtRestore; lr != nil {
+			const maxWarnings = 1000
+			if len(lr.Warnings) > maxWarnings {
+				lr.Warnings = lr.Warnings[:maxWarnings]
+			}
+		}
+		if li := req.Result.Libvirt; li != nil {
+			const maxDomains = 10000
+			if len(li.Domains) > maxDomains {
+				li.Domains = li.Domains[:maxDomains]
+			}
+		}
 	}
 
 	// Update command based on status
@@ -615,6 +640,21 @@ type ReportBackupRequest struct {
 	ErrorMessage *string   `json:"error_message,omitempty"`
 	StartedAt    time.Time `json:"started_at" binding:"required"`
 	CompletedAt  time.Time `json:"completed_at" binding:"required"`
+	// Transfer holds the backend metrics restic reported for the run.
+	Transfer *TransferMetricsReport `json:"transfer,omitempty"`
+}
+
+// TransferMetricsReport describes how a backup run used the repository backend.
+type TransferMetricsReport struct {
+	BytesProcessed    int64   `json:"bytes_processed"`
+	BytesUploaded     int64   `json:"bytes_uploaded"`
+	DurationMs        int64   `json:"duration_ms"`
+	OpenDurationMs    int64   `json:"open_duration_ms"`
+	UploadBytesPerSec float64 `json:"upload_bytes_per_sec"`
+	Retries           int     `json:"retries"`
+	RetryWaitMs       int64   `json:"retry_wait_ms"`
+	BackendErrors     int     `json:"backend_errors"`
+	FileErrors        int     `json:"file_errors"`
 }
 
 // ScheduleConfigResponse is the response for agent schedule configuration.
@@ -629,6 +669,27 @@ type ScheduleConfigResponse struct {
 	Repository         string            `json:"repository"`
 	RepositoryPassword string            `json:"repository_password"`
 	RepositoryEnv      map[string]string `json:"repository_env,omitempty"`
+	// RepositoryOptions are global restic flags from the repository's
+	// transfer settings and the schedule's bandwidth limit.
+	RepositoryOptions []string `json:"repository_options,omitempty"`
+	ReadConcurrency   *int     `json:"read_concurrency,omitempty"`
+	// FilesystemSnapshot is the schedule's filesystem snapshot mode: auto or
+	// required, or empty to read live paths.
+	FilesystemSnapshot string `json:"filesystem_snapshot,omitempty"`
+	// DockerDatabaseDumps asks the agent to dump detected database
+	// containers into the repository alongside the paths.
+	DockerDatabaseDumps bool `json:"docker_database_dumps,omitempty"`
+	// BackupType is the schedule's backup type, such as "docker".
+	BackupType string `json:"backup_type,omitempty"`
+	// DockerContainerIDs are the containers, by ID or name, a docker
+	// schedule backs up. Empty covers every container on the agent.
+	DockerContainerIDs []string `json:"docker_container_ids,omitempty"`
+	// KubernetesOptions are the options of a kubernetes schedule, which the
+	// agent runs against the cluster it is deployed in.
+	KubernetesOptions *models.KubernetesBackupOptions `json:"kubernetes_options,omitempty"`
+	// LibvirtOptions are the options of a libvirt schedule, which the agent
+	// runs against the libvirt daemon on its host.
+	LibvirtOptions *models.LibvirtBackupOptions `json:"libvirt_options,omitempty"`
 }
 
 
@@ -717,17 +778,45 @@ func (h *AgentAPIHandler) GetSchedules(c *gin.Context) {
 
 		resticCfg := backend.ToResticConfig(string(password))
 
+		// Agents reach hosted repositories with their own credentials,
+		// never the server's.
+		if rest, ok := backend.(*backends.RestBackend); ok && rest.Hosted {
+			username, agentPassword := restserver.AgentCredentials(h.keyManager, agent)
+			resticCfg = (&backends.RestBackend{URL: rest.URL}).ToResticConfig(string(password))
+			resticCfg.Env = map[string]string{
+				"RESTIC_REST_USERNAME": username,
+				"RESTIC_REST_PASSWORD": agentPassword,
+			}
+		}
+
+		transfer, err := h.store.GetRepositoryTransferSettings(c.Request.Context(), repo.ID)
+		if err != nil {
+			h.logger.Warn().Err(err).Str("repo_id", repo.ID.String()).Msg("failed to get transfer settings")
+		}
+		var readConcurrency *int
+		if transfer != nil {
+			readConcurrency = transfer.ReadConcurrency
+		}
+
 		responses = append(responses, ScheduleConfigResponse{
-			ID:                 sched.ID,
-			Name:               sched.Name,
-			CronExpression:     sched.CronExpression,
-			Paths:              sched.Paths,
-			Excludes:           sched.Excludes,
-			Enabled:            sched.Enabled,
-			RepositoryID:       repo.ID,
-			Repository:         resticCfg.Repository,
-			RepositoryPassword: resticCfg.Password,
-			RepositoryEnv:      resticCfg.Env,
+			ID:                  sched.ID,
+			Name:                sched.Name,
+			CronExpression:      sched.CronExpression,
+			Paths:               sched.Paths,
+			Excludes:            sched.Excludes,
+			Enabled:             sched.Enabled,
+			RepositoryID:        repo.ID,
+			Repository:          resticCfg.Repository,
+			RepositoryPassword:  resticCfg.Password,
+			RepositoryEnv:       resticCfg.Env,
+			RepositoryOptions:   backends.TransferOptions(repo.Type, transfer, sched.BandwidthLimitKB),
+			ReadConcurrency:     readConcurrency,
+			FilesystemSnapshot:  filesystemSnapshotMode(sched.FilesystemSnapshot),
+			DockerDatabaseDumps: sched.DockerOptions != nil && sched.DockerOptions.DatabaseDumps,
+			BackupType:          string(sched.BackupType),
+			DockerContainerIDs:  dockerContainerIDs(sched),
+			KubernetesOptions:   sched.KubernetesOptions,
+			LibvirtOptions:      sched.LibvirtOptions,
 		})
 	}
 
@@ -739,6 +828,83 @@ func (h *AgentAPIHandler) GetSchedules(c *gin.Context) {
 }
 
 
+// dockerContainerIDs returns the containers a docker schedule is limited to.
+func dockerContainerIDs(sched *models.Schedule) []string {
+	if !sched.IsDockerBackup() || sched.DockerOptions == nil {
+		return nil
+	}
+	return sched.DockerOptions.ContainerIDs
+}
+
+// FinalBackupFailureRequest reports that the final backup of a removed Docker
+// container could not run.
+type FinalBackupFailureRequest struct {
+	ContainerID   string `json:"container_id" binding:"required,max=128"`
+	ContainerName string `json:"container_name" binding:"max=255"`
+	Error         string `json:"error" binding:"required"`
+}
+
+// ReportFinalBackupFailure raises an alert when an agent could not back up a
+// container removed with keldris.backup.on-remove=true, for example because
+// no docker schedule covers it.
+// POST /api/v1/agent/docker/final-backup-failures
+func (h *AgentAPIHandler) ReportFinalBackupFailure(c *gin.Context) {
+	agent := middleware.RequireAgent(c)
+	if agent == nil {
+		return
+	}
+
+	var req FinalBackupFailureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	const maxErrorLen = 4096
+	if len(req.Error) > maxErrorLen {
+		req.Error = req.Error[:maxErrorLen]
+	}
+	name := req.ContainerName
+	if name == "" {
+		name = req.ContainerID
+	}
+
+	alert := models.NewAlert(
+		agent.OrgID,
+		models.AlertTypeDockerFinalBackupFailed,
+		models.AlertSeverityCritical,
+		fmt.Sprintf("Final backup of container %s on %s failed", name, agent.Hostname),
+		req.Error,
+	)
+	alert.SetResource(models.ResourceTypeAgent, agent.ID)
+	alert.Metadata = map[string]any{
+		"hostname":       agent.Hostname,
+		"container_id":   req.ContainerID,
+		"container_name": req.ContainerName,
+	}
+	if err := h.store.CreateAlert(c.Request.Context(), alert); err != nil {
+		h.logger.Error().Err(err).Str("agent_id", agent.ID.String()).Msg("failed to create final backup alert")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record failure"})
+		return
+	}
+
+	h.logger.Warn().
+		Str("agent_id", agent.ID.String()).
+		Str("container", name).
+		Str("error", req.Error).
+		Msg("docker final backup failed")
+
+	c.JSON(http.StatusOK, gin.H{"recorded": true})
+}
+
+// filesystemSnapshotMode returns the mode sent to agents, which omit it when
+// snapshots are off.
+func filesystemSnapshotMode(mode models.FilesystemSnapshotMode) string {
+	if !mode.Enabled() {
+		return ""
+	}
+	return string(mode)
+}
+
 // ReportBackup records a backup result from the agent.
 // POST /api/v1/agent/backups
 func (h *AgentAPIHandler) ReportBackup(c *gin.Context) {
@@ -804,6 +970,12 @@ func (h *AgentAPIHandler) ReportBackup(c *gin.Context) {
 		CompletedAt:  &req.CompletedAt,
 		CreatedAt:    time.Now(),
 	}
+	if schedule.IsKubernetesBackup() {
+		b.BackupType = models.BackupTypeKubernetes
+	}
+	if schedule.IsLibvirtBackup() {
+		b.BackupType = models.BackupTypeLibvirt
+	}
 
 	if err := h.store.CreateBackup(c.Request.Context(), b); err != nil {
 		h.logger.Error().Err(err).Str("agent_id", agent.ID.String()).Msg("failed to create backup record")
@@ -811,6 +983,31 @@ func (h *AgentAPIHandler) ReportBackup(c *gin.Context) {
 		return
 	}
 
+	if t := req.Transfer; t != nil {
+		agentID := agent.ID
+		metrics := &models.BackupTransferMetrics{
+			ID:                uuid.New(),
+			OrgID:             agent.OrgID,
+			RepositoryID:      repo.ID,
+			BackupID:          b.ID,
+			AgentID:           &agentID,
+			BytesProcessed:    t.BytesProcessed,
+			BytesUploaded:     t.BytesUploaded,
+			DurationMs:        t.DurationMs,
+			OpenDurationMs:    t.OpenDurationMs,
+			UploadBytesPerSec: t.UploadBytesPerSec,
+			Retries:           t.Retries,
+			RetryWaitMs:       t.RetryWaitMs,
+			BackendErrors:     t.BackendErrors,
+			FileErrors:        t.FileErrors,
+			Failed:            b.Status == models.BackupStatusFailed,
+			RecordedAt:        req.CompletedAt,
+		}
+		if err := h.store.CreateBackupTransferMetrics(c.Request.Context(), metrics); err != nil {
+			h.logger.Warn().Err(err).Str("backup_id", b.ID.String()).Msg("failed to record transfer metrics")
+		}
+	}
+
 	h.logger.Info().
 		Str("agent_id", agent.ID.String()).
 		Str("backup_id", b.ID.String()).
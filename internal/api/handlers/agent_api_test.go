@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/crypto"
 	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/MacJediWizard/keldris/internal/restserver"
 	pkgmodels "github.com/MacJediWizard/keldris/pkg/models"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -28,6 +32,13 @@ type mockAgentAPIStore struct {
 	createdHistory   *models.AgentHealthHistory
 	createdAlert     *models.Alert
 	resolvedResource bool
+	schedules        []*models.Schedule
+	repo             *models.Repository
+	repoKey          *models.RepositoryKey
+	schedule         *models.Schedule
+	createdBackup    *models.Backup
+	transfer         *models.RepositoryTransferSettings
+	transferMetrics  *models.BackupTransferMetrics
 }
 
 func (m *mockAgentAPIStore) GetAgentByID(_ context.Context, _ uuid.UUID) (*models.Agent, error) {
@@ -62,7 +73,7 @@ func (m *mockAgentAPIStore) ResolveAlertsByResource(_ context.Context, _ models.
 }
 
 func (m *mockAgentAPIStore) GetSchedulesByAgentID(_ context.Context, _ uuid.UUID) ([]*models.Schedule, error) {
-	return nil, nil
+	return m.schedules, nil
 }
 
 func (m *mockAgentAPIStore) CreateAgentLogs(_ context.Context, _ []*models.AgentLog) error {
@@ -82,14 +93,15 @@ func (m *mockAgentAPIStore) UpdateAgentCommand(_ context.Context, _ *models.Agen
 }
 
 func (m *mockAgentAPIStore) GetRepositoryByID(_ context.Context, _ uuid.UUID) (*models.Repository, error) {
-	return nil, nil
+	return m.repo, nil
 }
 
 func (m *mockAgentAPIStore) GetRepositoryKeyByRepositoryID(_ context.Context, _ uuid.UUID) (*models.RepositoryKey, error) {
-	return nil, nil
+	return m.repoKey, nil
 }
 
-func (m *mockAgentAPIStore) CreateBackup(_ context.Context, _ *models.Backup) error {
+func (m *mockAgentAPIStore) CreateBackup(_ context.Context, backup *models.Backup) error {
+	m.createdBackup = backup
 	return nil
 }
 
@@ -102,7 +114,19 @@ func (m *mockAgentAPIStore) GetBackupsByAgentID(_ context.Context, _ uuid.UUID)
 }
 
 func (m *mockAgentAPIStore) GetScheduleByID(_ context.Context, _ uuid.UUID) (*models.Schedule, error) {
-	return nil, nil
+	if m.schedule == nil {
+		return nil, errors.New("not found")
+	}
+	return m.schedule, nil
+}
+
+func (m *mockAgentAPIStore) GetRepositoryTransferSettings(_ context.Context, _ uuid.UUID) (*models.RepositoryTransferSettings, error) {
+	return m.transfer, nil
+}
+
+func (m *mockAgentAPIStore) CreateBackupTransferMetrics(_ context.Context, metrics *models.BackupTransferMetrics) error {
+	m.transferMetrics = metrics
+	return nil
 }
 
 // InjectAgent returns gin middleware that injects an Agent into context.
@@ -745,3 +769,295 @@ func TestReportHealthAgentFieldsUpdated(t *testing.T) {
 		}
 	})
 }
+
+func TestGetSchedulesHostedRepository(t *testing.T) {
+	key, _ := crypto.GenerateMasterKey()
+	km, _ := crypto.NewKeyManager(key)
+
+	orgID := uuid.New()
+	agent := &models.Agent{ID: uuid.New(), OrgID: orgID, APIKeyHash: "agent-key-hash"}
+
+	config, _ := km.Encrypt([]byte(`{"url":"https://keldris.example.com/restic/abc/","username":"keldris","password":"server-secret","hosted":true}`))
+	repo := models.NewRepository(orgID, "hosted", models.RepositoryTypeRest, config)
+	password, _ := km.Encrypt([]byte("repo-password"))
+	sched := models.NewSchedule(agent.ID, "nightly", "0 2 * * *", []string{"/data"})
+	sched.Enabled = true
+	sched.Repositories = []models.ScheduleRepository{{RepositoryID: repo.ID, Enabled: true}}
+
+	store := &mockAgentAPIStore{
+		schedules: []*models.Schedule{sched},
+		repo:      repo,
+		repoKey:   models.NewRepositoryKey(repo.ID, password, false, nil),
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(InjectAgent(agent))
+	NewAgentAPIHandler(store, km, zerolog.Nop()).RegisterRoutes(r.Group("/api/v1/agent"))
+
+	w := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/agent/schedules"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp []ScheduleConfigResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp) != 1 {
+		t.Fatalf("expected 1 schedule, got %d", len(resp))
+	}
+
+	username, agentPassword := restserver.AgentCredentials(km, agent)
+	env := resp[0].RepositoryEnv
+	if env["RESTIC_REST_USERNAME"] != username || env["RESTIC_REST_PASSWORD"] != agentPassword {
+		t.Errorf("RepositoryEnv = %v, want the agent's own credentials", env)
+	}
+	if strings.Contains(resp[0].Repository, "server-secret") || strings.Contains(w.Body.String(), "server-secret") {
+		t.Error("server credentials must not be sent to agents")
+	}
+}
+
+func TestGetSchedulesTransferSettings(t *testing.T) {
+	key, _ := crypto.GenerateMasterKey()
+	km, _ := crypto.NewKeyManager(key)
+
+	orgID := uuid.New()
+	agent := &models.Agent{ID: uuid.New(), OrgID: orgID}
+
+	config, _ := km.Encrypt([]byte(`{"endpoint":"s3.amazonaws.com","bucket":"backups","access_key_id":"a","secret_access_key":"b"}`))
+	repo := models.NewRepository(orgID, "offsite", models.RepositoryTypeS3, config)
+	password, _ := km.Encrypt([]byte("repo-password"))
+	sched := models.NewSchedule(agent.ID, "nightly", "0 2 * * *", []string{"/data"})
+	sched.Enabled = true
+	sched.Repositories = []models.ScheduleRepository{{RepositoryID: repo.ID, Enabled: true}}
+	sched.FilesystemSnapshot = models.FilesystemSnapshotAuto
+	sched.DockerOptions = &models.DockerBackupOptions{DatabaseDumps: true}
+
+	connections, readConcurrency := 8, 4
+	transfer := models.NewRepositoryTransferSettings(orgID, repo.ID)
+	transfer.Connections = &connections
+	transfer.ReadConcurrency = &readConcurrency
+
+	store := &mockAgentAPIStore{
+		schedules: []*models.Schedule{sched},
+		repo:      repo,
+		repoKey:   models.NewRepositoryKey(repo.ID, password, false, nil),
+		transfer:  transfer,
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(InjectAgent(agent))
+	NewAgentAPIHandler(store, km, zerolog.Nop()).RegisterRoutes(r.Group("/api/v1/agent"))
+
+	w := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/agent/schedules"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp []ScheduleConfigResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp) != 1 {
+		t.Fatalf("expected 1 schedule, got %d", len(resp))
+	}
+	if len(resp[0].RepositoryOptions) != 1 || resp[0].RepositoryOptions[0] != "--option=s3.connections=8" {
+		t.Errorf("RepositoryOptions = %v", resp[0].RepositoryOptions)
+	}
+	if resp[0].ReadConcurrency == nil || *resp[0].ReadConcurrency != 4 {
+		t.Errorf("ReadConcurrency = %v, want 4", resp[0].ReadConcurrency)
+	}
+	if resp[0].FilesystemSnapshot != "auto" {
+		t.Errorf("FilesystemSnapshot = %q, want auto", resp[0].FilesystemSnapshot)
+	}
+	if !resp[0].DockerDatabaseDumps {
+		t.Error("DockerDatabaseDumps = false, want true")
+	}
+	if resp[0].BackupType != "file" || resp[0].DockerContainerIDs != nil {
+		t.Errorf("BackupType = %q, DockerContainerIDs = %v", resp[0].BackupType, resp[0].DockerContainerIDs)
+	}
+}
+
+func TestReportFinalBackupFailure(t *testing.T) {
+	agent := &models.Agent{ID: uuid.New(), OrgID: uuid.New(), Hostname: "docker-01"}
+	store := &mockAgentAPIStore{}
+	r := setupAgentAPITestRouter(store, agent)
+
+	w := DoRequest(r, JSONRequest("POST", "/api/v1/agent/docker/final-backup-failures",
+		`{"container_id":"3f2a9c1e7b4d","container_name":"db","error":"no enabled docker schedule backs up container db"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	alert := store.createdAlert
+	if alert == nil || alert.Type != models.AlertTypeDockerFinalBackupFailed || alert.Severity != models.AlertSeverityCritical {
+		t.Fatalf("alert = %+v", alert)
+	}
+	if alert.OrgID != agent.OrgID || alert.ResourceID == nil || *alert.ResourceID != agent.ID || !strings.Contains(alert.Title, "db") {
+		t.Errorf("alert = %+v", alert)
+	}
+
+	w = DoRequest(r, JSONRequest("POST", "/api/v1/agent/docker/final-backup-failures", `{"container_name":"db"}`))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestReportBackupTransferMetrics(t *testing.T) {
+	orgID := uuid.New()
+	agent := &models.Agent{ID: uuid.New(), OrgID: orgID}
+	repo := models.NewRepository(orgID, "offsite", models.RepositoryTypeS3, nil)
+	sched := models.NewSchedule(agent.ID, "nightly", "0 2 * * *", []string{"/data"})
+
+	store := &mockAgentAPIStore{schedule: sched, repo: repo}
+	r := setupAgentAPITestRouter(store, agent)
+
+	now := time.Now()
+	body := map[string]interface{}{
+		"schedule_id":   sched.ID,
+		"repository_id": repo.ID,
+		"status":        "failed",
+		"error_message": "backup failed: unable to open repository",
+		"started_at":    now.Add(-time.Minute),
+		"completed_at":  now,
+		"transfer": map[string]interface{}{
+			"duration_ms":      60000,
+			"open_duration_ms": 45000,
+			"retries":          5,
+			"retry_wait_ms":    12000,
+			"backend_errors":   6,
+		},
+	}
+	payload, _ := json.Marshal(body)
+	w := DoRequest(r, JSONRequest("POST", "/api/v1/agent/backups", string(payload)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	m := store.transferMetrics
+	if m == nil {
+		t.Fatal("expected transfer metrics to be recorded")
+	}
+	if m.BackupID != store.createdBackup.ID || m.RepositoryID != repo.ID || m.OrgID != orgID {
+		t.Errorf("metrics linked to wrong records: %+v", m)
+	}
+	if m.AgentID == nil || *m.AgentID != agent.ID {
+		t.Errorf("AgentID = %v, want %s", m.AgentID, agent.ID)
+	}
+	if !m.Failed || m.Retries != 5 || m.BackendErrors != 6 || m.OpenDurationMs != 45000 {
+		t.Errorf("metrics = %+v", m)
+	}
+}
+
+func TestKubernetesScheduleRunsOnAgent(t *testing.T) {
+	key, _ := crypto.GenerateMasterKey()
+	km, _ := crypto.NewKeyManager(key)
+
+	orgID := uuid.New()
+	agent := &models.Agent{ID: uuid.New(), OrgID: orgID}
+	config, _ := km.Encrypt([]byte(`{"endpoint":"s3.amazonaws.com","bucket":"backups","access_key_id":"a","secret_access_key":"b"}`))
+	repo := models.NewRepository(orgID, "offsite", models.RepositoryTypeS3, config)
+	password, _ := km.Encrypt([]byte("repo-password"))
+	opts := models.DefaultKubernetesOptions()
+	opts.Namespaces = []string{"shop"}
+	sched := models.NewKubernetesSchedule(agent.ID, "cluster", "0 2 * * *", opts)
+	sched.Enabled = true
+	sched.Repositories = []models.ScheduleRepository{{RepositoryID: repo.ID, Enabled: true}}
+
+	store := &mockAgentAPIStore{
+		schedules: []*models.Schedule{sched},
+		schedule:  sched,
+		repo:      repo,
+		repoKey:   models.NewRepositoryKey(repo.ID, password, false, nil),
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(InjectAgent(agent))
+	NewAgentAPIHandler(store, km, zerolog.Nop()).RegisterRoutes(r.Group("/api/v1/agent"))
+
+	w := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/agent/schedules"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp []ScheduleConfigResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp) != 1 || resp[0].BackupType != "kubernetes" || resp[0].KubernetesOptions == nil ||
+		len(resp[0].KubernetesOptions.Namespaces) != 1 || resp[0].KubernetesOptions.Namespaces[0] != "shop" {
+		t.Fatalf("schedules = %+v, want the kubernetes schedule with its options", resp)
+	}
+
+	now := time.Now()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"schedule_id":   sched.ID,
+		"repository_id": repo.ID,
+		"snapshot_id":   "abcd1234",
+		"status":        "completed",
+		"started_at":    now.Add(-time.Minute),
+		"completed_at":  now,
+	})
+	w = DoRequest(r, JSONRequest("POST", "/api/v1/agent/backups", string(payload)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if store.createdBackup == nil || store.createdBackup.BackupType != models.BackupTypeKubernetes {
+		t.Errorf("reported backup = %+v, want a kubernetes backup", store.createdBackup)
+	}
+}
+
+func TestLibvirtScheduleRunsOnAgent(t *testing.T) {
+	key, _ := crypto.GenerateMasterKey()
+	km, _ := crypto.NewKeyManager(key)
+
+	orgID := uuid.New()
+	agent := &models.Agent{ID: uuid.New(), OrgID: orgID}
+	config, _ := km.Encrypt([]byte(`{"endpoint":"s3.amazonaws.com","bucket":"backups","access_key_id":"a","secret_access_key":"b"}`))
+	repo := models.NewRepository(orgID, "offsite", models.RepositoryTypeS3, config)
+	password, _ := km.Encrypt([]byte("repo-password"))
+	opts := models.DefaultLibvirtOptions()
+	opts.Domains = []string{"web"}
+	sched := models.NewLibvirtSchedule(agent.ID, "kvm", "0 2 * * *", opts)
+	sched.Enabled = true
+	sched.Repositories = []models.ScheduleRepository{{RepositoryID: repo.ID, Enabled: true}}
+
+	store := &mockAgentAPIStore{
+		schedules: []*models.Schedule{sched},
+		schedule:  sched,
+		repo:      repo,
+		repoKey:   models.NewRepositoryKey(repo.ID, password, false, nil),
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(InjectAgent(agent))
+	NewAgentAPIHandler(store, km, zerolog.Nop()).RegisterRoutes(r.Group("/api/v1/agent"))
+
+	w := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/agent/schedules"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp []ScheduleConfigResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp) != 1 || resp[0].BackupType != "libvirt" || resp[0].LibvirtOptions == nil ||
+		len(resp[0].LibvirtOptions.Domains) != 1 || resp[0].LibvirtOptions.Domains[0] != "web" {
+		t.Fatalf("schedules = %+v, want the libvirt schedule with its options", resp)
+	}
+
+	now := time.Now()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"schedule_id":   sched.ID,
+		"repository_id": repo.ID,
+		"snapshot_id":   "abcd1234",
+		"status":        "completed",
+		"started_at":    now.Add(-time.Minute),
+		"completed_at":  now,
+	})
+	w = DoRequest(r, JSONRequest("POST", "/api/v1/agent/backups", string(payload)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if store.createdBackup == nil || store.createdBackup.BackupType != models.BackupTypeLibvirt {
+		t.Errorf("reported backup = %+v, want a libvirt backup", store.createdBackup)
+	}
+}
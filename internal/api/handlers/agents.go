@@ -116,8 +116,7 @@ func (h *AgentsHandler) List(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermAgentRead) {
 		return
 	}
 
@@ -128,7 +127,29 @@ func (h *AgentsHandler) List(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"agents": agents})
+	c.JSON(http.StatusOK, gin.H{"agents": h.visibleAgents(c.Request.Context(), user, agents)})
+}
+
+// visibleAgents filters agents down to those the user may read. Users with
+// organization-wide agent:read see all of them; users whose access comes from
+// scoped role bindings only see agents in their agent groups.
+func (h *AgentsHandler) visibleAgents(ctx context.Context, user *auth.SessionUser, agents []*models.Agent) []*models.Agent {
+	if has, err := h.rbac.HasPermission(ctx, user.ID, user.CurrentOrgID, auth.PermAgentRead); err == nil && has {
+		return agents
+	}
+
+	visible := make([]*models.Agent, 0, len(agents))
+	for _, agent := range agents {
+		has, err := h.rbac.HasPermissionForResource(ctx, user.ID, user.CurrentOrgID, auth.PermAgentRead, auth.ResourceScope{AgentID: agent.ID})
+		if err != nil {
+			h.logger.Error().Err(err).Str("agent_id", agent.ID.String()).Msg("failed to check agent permission")
+			continue
+		}
+		if has {
+			visible = append(visible, agent)
+		}
+	}
+	return visible
 }
 
 // Get returns a specific agent by ID.
@@ -157,7 +178,7 @@ func (h *AgentsHandler) Get(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead, auth.ResourceScope{AgentID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -281,7 +302,7 @@ func (h *AgentsHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentDelete); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentDelete, auth.ResourceScope{AgentID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -349,7 +370,7 @@ func (h *AgentsHandler) Heartbeat(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead, auth.ResourceScope{AgentID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -426,7 +447,7 @@ func (h *AgentsHandler) RotateAPIKey(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentUpdate); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentUpdate, auth.ResourceScope{AgentID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -505,7 +526,7 @@ func (h *AgentsHandler) RevokeAPIKey(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentUpdate); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentUpdate, auth.ResourceScope{AgentID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -571,7 +592,7 @@ func (h *AgentsHandler) Stats(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead, auth.ResourceScope{AgentID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -621,7 +642,7 @@ func (h *AgentsHandler) Backups(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead, auth.ResourceScope{AgentID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -668,7 +689,7 @@ func (h *AgentsHandler) Schedules(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead, auth.ResourceScope{AgentID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -728,7 +749,7 @@ func (h *AgentsHandler) HealthHistory(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead, auth.ResourceScope{AgentID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -862,7 +883,7 @@ func (h *AgentsHandler) SetDebugMode(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentUpdate); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentUpdate, auth.ResourceScope{AgentID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -953,7 +974,7 @@ func (h *AgentsHandler) DockerHealth(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead, auth.ResourceScope{AgentID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -1020,7 +1041,7 @@ func (h *AgentsHandler) Logs(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermAgentRead, auth.ResourceScope{AgentID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
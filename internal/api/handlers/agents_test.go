@@ -34,6 +34,7 @@ type mockAgentStore struct {
 	getErr           error
 	updateAPIKeyErr  error
 	revokeAPIKeyErr  error
+	role             models.OrgRole
 }
 
 func (m *mockAgentStore) GetAgentsByOrgID(_ context.Context, orgID uuid.UUID) ([]*models.Agent, error) {
@@ -126,7 +127,11 @@ func (m *mockAgentStore) GetAgentDockerHealth(_ context.Context, _ uuid.UUID) (*
 }
 
 func (m *mockAgentStore) GetMembershipByUserAndOrg(_ context.Context, userID, orgID uuid.UUID) (*models.OrgMembership, error) {
-	return &models.OrgMembership{UserID: userID, OrgID: orgID, Role: models.OrgRoleOwner}, nil
+	role := m.role
+	if role == "" {
+		role = models.OrgRoleOwner
+	}
+	return &models.OrgMembership{UserID: userID, OrgID: orgID, Role: role}, nil
 }
 
 func (m *mockAgentStore) GetMembershipsByUserID(_ context.Context, userID uuid.UUID) ([]*models.OrgMembership, error) {
@@ -1096,3 +1101,50 @@ func TestAgentHealthHistory(t *testing.T) {
 		}
 	})
 }
+
+func TestListAgents_ScopedRoleBinding(t *testing.T) {
+	orgID := uuid.New()
+	allowed := &models.Agent{ID: uuid.New(), OrgID: orgID, Hostname: "db1"}
+	other := &models.Agent{ID: uuid.New(), OrgID: orgID, Hostname: "web1"}
+	group := &models.AgentGroup{ID: uuid.New(), OrgID: orgID, Name: "db-servers"}
+
+	// The membership's built-in role grants nothing; agent:read comes only
+	// from a binding scoped to the db-servers group.
+	store := &mockAgentStore{agents: []*models.Agent{allowed, other}, role: models.OrgRole("restricted")}
+	binding := models.NewUserRoleBinding(orgID, uuid.New(), uuid.New())
+	binding.AgentGroupIDs = []uuid.UUID{group.ID}
+	bindings := &scopedBindingStore{
+		bindings: []*models.EffectiveRoleBinding{{
+			RoleBinding: *binding,
+			Permissions: []string{string(auth.PermAgentRead)},
+		}},
+		agentGroups: map[uuid.UUID][]*models.AgentGroup{allowed.ID: {group}},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	user := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID}
+	r.Use(func(c *gin.Context) {
+		c.Set(string(middleware.UserContextKey), user)
+		c.Next()
+	})
+	rbac := auth.NewRBAC(store)
+	rbac.SetRoleBindingStore(bindings)
+	NewAgentsHandler(store, rbac, zerolog.Nop()).RegisterRoutes(r.Group("/api/v1"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/agents", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Agents []*models.Agent `json:"agents"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(resp.Agents) != 1 || resp.Agents[0].ID != allowed.ID {
+		t.Errorf("expected only the scoped agent, got %+v", resp.Agents)
+	}
+}
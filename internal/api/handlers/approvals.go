@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/approval"
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// ApprovalGate routes destructive operations through four-eyes approval.
+// Handlers register an executor for each action they gate and submit a
+// request instead of executing when the org policy requires approval.
+type ApprovalGate interface {
+	Register(action models.ApprovalAction, exec approval.Executor)
+	Required(ctx context.Context, orgID uuid.UUID, action models.ApprovalAction) (bool, error)
+	Submit(ctx context.Context, req *models.ApprovalRequest) (*models.ApprovalRequest, error)
+}
+
+// requestApproval submits req if the organization requires approval for its
+// action. It returns true when a response has been written, either the
+// pending request or an error, and the caller must not run the operation.
+func requestApproval(c *gin.Context, gate ApprovalGate, logger zerolog.Logger, req *models.ApprovalRequest) bool {
+	if gate == nil {
+		return false
+	}
+
+	required, err := gate.Required(c.Request.Context(), req.OrgID, req.Action)
+	if err != nil {
+		logger.Error().Err(err).Str("action", string(req.Action)).Msg("failed to check approval policy")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check approval policy"})
+		return true
+	}
+	if !required {
+		return false
+	}
+
+	req.Reason = c.Query("reason")
+	pending, err := gate.Submit(c.Request.Context(), req)
+	if errors.Is(err, approval.ErrPendingConflict) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":            err.Error(),
+			"approval_request": pending,
+		})
+		return true
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("action", string(req.Action)).Msg("failed to submit approval request")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to submit approval request"})
+		return true
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":          "approval from a second administrator is required",
+		"approval_request": pending,
+	})
+	return true
+}
+
+// ApprovalUserStore defines the user lookups needed by the approvals handler.
+type ApprovalUserStore interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+}
+
+// ApprovalsHandler handles approval request HTTP endpoints.
+type ApprovalsHandler struct {
+	store   ApprovalUserStore
+	service *approval.Service
+	logger  zerolog.Logger
+}
+
+// NewApprovalsHandler creates a new ApprovalsHandler.
+func NewApprovalsHandler(store ApprovalUserStore, service *approval.Service, logger zerolog.Logger) *ApprovalsHandler {
+	return &ApprovalsHandler{
+		store:   store,
+		service: service,
+		logger:  logger.With().Str("component", "approvals_handler").Logger(),
+	}
+}
+
+// RegisterRoutes registers approval routes on the given router group.
+func (h *ApprovalsHandler) RegisterRoutes(r *gin.RouterGroup) {
+	approvals := r.Group("/approvals")
+	{
+		approvals.GET("", h.List)
+		approvals.GET("/:id", h.Get)
+		approvals.POST("/:id/approve", h.Approve)
+		approvals.POST("/:id/reject", h.Reject)
+		approvals.POST("/:id/cancel", h.Cancel)
+	}
+}
+
+// requireAdmin returns the session user if they are an admin, writing an error response otherwise.
+func (h *ApprovalsHandler) requireAdmin(c *gin.Context) *auth.SessionUser {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return nil
+	}
+
+	dbUser, err := h.store.GetUserByID(c.Request.Context(), user.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to get user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify access"})
+		return nil
+	}
+	if !dbUser.IsAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return nil
+	}
+	return user
+}
+
+// List returns approval requests for the current organization.
+//
+//	@Summary		List approval requests
+//	@Description	Returns approval requests for the current organization, optionally filtered by status (admin only)
+//	@Tags			Approvals
+//	@Produce		json
+//	@Param			status	query		string	false	"Filter by status (pending, executed, failed, rejected, cancelled, expired)"
+//	@Success		200		{object}	map[string][]models.ApprovalRequest
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/approvals [get]
+func (h *ApprovalsHandler) List(c *gin.Context) {
+	user := h.requireAdmin(c)
+	if user == nil {
+		return
+	}
+
+	requests, err := h.service.List(c.Request.Context(), user.CurrentOrgID, models.ApprovalStatus(c.Query("status")))
+	if err != nil {
+		h.logger.Error().Err(err).Str("org_id", user.CurrentOrgID.String()).Msg("failed to list approval requests")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list approval requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"approval_requests": requests})
+}
+
+// Get returns a single approval request.
+//
+//	@Summary		Get approval request
+//	@Description	Returns an approval request by ID (admin only)
+//	@Tags			Approvals
+//	@Produce		json
+//	@Param			id	path		string	true	"Approval request ID"
+//	@Success		200	{object}	models.ApprovalRequest
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/approvals/{id} [get]
+func (h *ApprovalsHandler) Get(c *gin.Context) {
+	user := h.requireAdmin(c)
+	if user == nil {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid approval request ID"})
+		return
+	}
+
+	req, err := h.service.Get(c.Request.Context(), user.CurrentOrgID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "approval request not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// Approve approves a pending request and executes the operation.
+//
+//	@Summary		Approve request
+//	@Description	Approves a pending request from another administrator and executes the operation (admin only)
+//	@Tags			Approvals
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string							true	"Approval request ID"
+//	@Param			request	body		models.ApprovalDecisionRequest	false	"Decision comment"
+//	@Success		200		{object}	models.ApprovalRequest
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		409		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/approvals/{id}/approve [post]
+func (h *ApprovalsHandler) Approve(c *gin.Context) {
+	h.decide(c, h.service.Approve)
+}
+
+// Reject rejects a pending request.
+//
+//	@Summary		Reject request
+//	@Description	Rejects a pending request from another administrator (admin only)
+//	@Tags			Approvals
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string							true	"Approval request ID"
+//	@Param			request	body		models.ApprovalDecisionRequest	false	"Decision comment"
+//	@Success		200		{object}	models.ApprovalRequest
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		409		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/approvals/{id}/reject [post]
+func (h *ApprovalsHandler) Reject(c *gin.Context) {
+	h.decide(c, h.service.Reject)
+}
+
+// Cancel withdraws the caller's own pending request.
+//
+//	@Summary		Cancel request
+//	@Description	Withdraws a pending request submitted by the current user
+//	@Tags			Approvals
+//	@Produce		json
+//	@Param			id	path		string	true	"Approval request ID"
+//	@Success		200	{object}	models.ApprovalRequest
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		409	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/approvals/{id}/cancel [post]
+func (h *ApprovalsHandler) Cancel(c *gin.Context) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid approval request ID"})
+		return
+	}
+
+	req, err := h.service.Cancel(c.Request.Context(), user.CurrentOrgID, id, user.ID)
+	if err != nil {
+		h.writeDecisionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+type decisionFunc func(ctx context.Context, orgID, id, approverID uuid.UUID, comment string) (*models.ApprovalRequest, error)
+
+func (h *ApprovalsHandler) decide(c *gin.Context, fn decisionFunc) {
+	user := h.requireAdmin(c)
+	if user == nil {
+		return
+	}
+
+	// Approving on someone else's behalf would defeat the second pair of eyes
+	if user.IsImpersonating() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "approvals cannot be decided while impersonating"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid approval request ID"})
+		return
+	}
+
+	var body models.ApprovalDecisionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+	}
+
+	req, err := fn(c.Request.Context(), user.CurrentOrgID, id, user.ID, body.Comment)
+	if err != nil {
+		h.writeDecisionError(c, err)
+		return
+	}
+
+	h.logger.Info().
+		Str("approval_request_id", req.ID.String()).
+		Str("status", string(req.Status)).
+		Str("decided_by", user.ID.String()).
+		Msg("approval request decided")
+
+	c.JSON(http.StatusOK, req)
+}
+
+func (h *ApprovalsHandler) writeDecisionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, approval.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "approval request not found"})
+	case errors.Is(err, approval.ErrSelfApproval), errors.Is(err, approval.ErrNotRequester):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, approval.ErrNotPending), errors.Is(err, approval.ErrExpired):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error().Err(err).Msg("failed to decide approval request")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update approval request"})
+	}
+}
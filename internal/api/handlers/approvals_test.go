@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/approval"
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/license"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/MacJediWizard/keldris/internal/settings"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockApprovalStore struct {
+	requests  map[uuid.UUID]*models.ApprovalRequest
+	security  settings.SecuritySettings
+	auditLogs []*models.AuditLog
+}
+
+func newMockApprovalStore(actions ...models.ApprovalAction) *mockApprovalStore {
+	security := settings.DefaultSecuritySettings()
+	for _, a := range actions {
+		security.ApprovalRequiredActions = append(security.ApprovalRequiredActions, string(a))
+	}
+	return &mockApprovalStore{
+		requests: make(map[uuid.UUID]*models.ApprovalRequest),
+		security: security,
+	}
+}
+
+func (m *mockApprovalStore) CreateApprovalRequest(_ context.Context, r *models.ApprovalRequest) error {
+	copied := *r
+	m.requests[r.ID] = &copied
+	return nil
+}
+
+func (m *mockApprovalStore) GetApprovalRequestByID(_ context.Context, id uuid.UUID) (*models.ApprovalRequest, error) {
+	r, ok := m.requests[id]
+	if !ok {
+		return nil, approval.ErrNotFound
+	}
+	copied := *r
+	return &copied, nil
+}
+
+func (m *mockApprovalStore) GetPendingApprovalRequest(_ context.Context, orgID uuid.UUID, action models.ApprovalAction, resourceID string) (*models.ApprovalRequest, error) {
+	for _, r := range m.requests {
+		if r.OrgID == orgID && r.Action == action && r.ResourceID == resourceID && r.IsPending() {
+			copied := *r
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockApprovalStore) GetApprovalRequestsByOrgID(_ context.Context, orgID uuid.UUID, _ models.ApprovalStatus) ([]*models.ApprovalRequest, error) {
+	var out []*models.ApprovalRequest
+	for _, r := range m.requests {
+		if r.OrgID == orgID {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockApprovalStore) DecideApprovalRequest(_ context.Context, r *models.ApprovalRequest) (bool, error) {
+	if !m.requests[r.ID].IsPending() {
+		return false, nil
+	}
+	copied := *r
+	m.requests[r.ID] = &copied
+	return true, nil
+}
+
+func (m *mockApprovalStore) UpdateApprovalRequestResult(_ context.Context, r *models.ApprovalRequest) error {
+	m.requests[r.ID].Status = r.Status
+	return nil
+}
+
+func (m *mockApprovalStore) ExpireApprovalRequests(_ context.Context, _ time.Time) (int, error) {
+	return 0, nil
+}
+
+func (m *mockApprovalStore) GetSecuritySettings(_ context.Context, _ uuid.UUID) (*settings.SecuritySettings, error) {
+	s := m.security
+	return &s, nil
+}
+
+func (m *mockApprovalStore) GetUserByID(_ context.Context, id uuid.UUID) (*models.User, error) {
+	return &models.User{ID: id, Role: models.UserRoleAdmin}, nil
+}
+
+func (m *mockApprovalStore) CreateAuditLog(_ context.Context, log *models.AuditLog) error {
+	m.auditLogs = append(m.auditLogs, log)
+	return nil
+}
+
+func setupApprovalsTestRouter(store *mockApprovalStore, service *approval.Service, user *auth.SessionUser) *gin.Engine {
+	r := SetupTestRouter(user)
+	handler := NewApprovalsHandler(store, service, zerolog.Nop())
+	api := r.Group("/api/v1")
+	handler.RegisterRoutes(api)
+	return r
+}
+
+func TestApprovalsLegalHoldRemoval(t *testing.T) {
+	orgID := uuid.New()
+	requester := adminUser(orgID)
+	approver := adminUser(orgID)
+
+	approvalStore := newMockApprovalStore(models.ApprovalActionLegalHoldRemove)
+	service := approval.NewService(approvalStore, nil, zerolog.Nop())
+
+	holdStore := &mockLegalHoldStore{
+		user: &models.User{ID: requester.ID, Role: models.UserRoleAdmin},
+		hold: &models.LegalHold{ID: uuid.New(), OrgID: orgID, SnapshotID: "snap-1", PlacedBy: requester.ID},
+	}
+	holdRouter := SetupTestRouter(requester)
+	holds := NewLegalHoldsHandler(holdStore, license.NewFeatureChecker(&stubFeatureStore{tier: license.TierEnterprise}), zerolog.Nop())
+	holds.SetApprovalGate(service)
+	holds.RegisterRoutes(holdRouter.Group("/api/v1"))
+
+	resp := DoRequest(holdRouter, AuthenticatedRequest("DELETE", "/api/v1/snapshots/snap-1/hold?reason=case+closed"))
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var body struct {
+		ApprovalRequest models.ApprovalRequest `json:"approval_request"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body.ApprovalRequest.Reason != "case closed" {
+		t.Errorf("reason = %q, want %q", body.ApprovalRequest.Reason, "case closed")
+	}
+	approvePath := "/api/v1/approvals/" + body.ApprovalRequest.ID.String() + "/approve"
+
+	t.Run("requester cannot approve", func(t *testing.T) {
+		r := setupApprovalsTestRouter(approvalStore, service, requester)
+		resp := DoRequest(r, JSONRequest("POST", approvePath, `{"comment":"self"}`))
+		if resp.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+
+	t.Run("second admin approves and hold is removed", func(t *testing.T) {
+		r := setupApprovalsTestRouter(approvalStore, service, approver)
+		resp := DoRequest(r, JSONRequest("POST", approvePath, `{"comment":"verified with legal"}`))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var decided models.ApprovalRequest
+		if err := json.Unmarshal(resp.Body.Bytes(), &decided); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if decided.Status != models.ApprovalStatusExecuted {
+			t.Errorf("status = %s, want executed (error: %s)", decided.Status, decided.ErrorMessage)
+		}
+	})
+
+	t.Run("already decided", func(t *testing.T) {
+		r := setupApprovalsTestRouter(approvalStore, service, adminUser(orgID))
+		resp := DoRequest(r, AuthenticatedRequest("POST", approvePath))
+		if resp.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+}
+
+func TestApprovalsLegalHoldRemovalNotRequired(t *testing.T) {
+	orgID := uuid.New()
+	user := adminUser(orgID)
+
+	service := approval.NewService(newMockApprovalStore(), nil, zerolog.Nop())
+	store := &mockLegalHoldStore{
+		user: &models.User{ID: user.ID, Role: models.UserRoleAdmin},
+		hold: &models.LegalHold{ID: uuid.New(), OrgID: orgID, SnapshotID: "snap-1", PlacedBy: user.ID},
+	}
+	r := SetupTestRouter(user)
+	holds := NewLegalHoldsHandler(store, license.NewFeatureChecker(&stubFeatureStore{tier: license.TierEnterprise}), zerolog.Nop())
+	holds.SetApprovalGate(service)
+	holds.RegisterRoutes(r.Group("/api/v1"))
+
+	resp := DoRequest(r, AuthenticatedRequest("DELETE", "/api/v1/snapshots/snap-1/hold"))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestApprovalsListRequiresAdmin(t *testing.T) {
+	orgID := uuid.New()
+	store := newMockApprovalStore()
+	service := approval.NewService(store, nil, zerolog.Nop())
+	r := SetupTestRouter(adminUser(orgID))
+	handler := NewApprovalsHandler(&mockLegalHoldStore{user: &models.User{Role: models.UserRoleViewer}}, service, zerolog.Nop())
+	handler.RegisterRoutes(r.Group("/api/v1"))
+
+	resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/approvals"))
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", resp.Code)
+	}
+}
+
+func TestApprovalsScheduleRetention(t *testing.T) {
+	orgID := uuid.New()
+	agent := &models.Agent{ID: uuid.New(), OrgID: orgID, Hostname: "test-host"}
+	schedule := &models.Schedule{ID: uuid.New(), AgentID: agent.ID, Name: "nightly", CronExpression: "0 2 * * *", Paths: []string{"/data"}}
+
+	scheduleStore := newMockScheduleStore()
+	scheduleStore.agentByID[agent.ID] = agent
+	scheduleStore.scheduleByID[schedule.ID] = schedule
+
+	approvalStore := newMockApprovalStore(models.ApprovalActionRetentionChange)
+	service := approval.NewService(approvalStore, nil, zerolog.Nop())
+
+	r := SetupTestRouter(adminUser(orgID))
+	handler := NewSchedulesHandler(scheduleStore, auth.NewRBAC(scheduleStore), zerolog.Nop())
+	handler.SetApprovalGate(service)
+	handler.RegisterRoutes(r.Group("/api/v1"))
+	path := "/api/v1/schedules/" + schedule.ID.String()
+
+	t.Run("adding a policy where there was none", func(t *testing.T) {
+		resp := DoRequest(r, JSONRequest("PUT", path, `{"retention_policy":{"keep_last":1}}`))
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if schedule.RetentionPolicy != nil {
+			t.Errorf("retention policy applied without approval: %+v", schedule.RetentionPolicy)
+		}
+	})
+
+	t.Run("resubmitting the same policy", func(t *testing.T) {
+		resp := DoRequest(r, JSONRequest("PUT", path, `{"retention_policy":{"keep_last":1}}`))
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if len(approvalStore.requests) != 1 {
+			t.Errorf("expected one approval request, got %d", len(approvalStore.requests))
+		}
+	})
+
+	t.Run("different policy while one is pending", func(t *testing.T) {
+		resp := DoRequest(r, JSONRequest("PUT", path, `{"name":"renamed","retention_policy":{"keep_last":2}}`))
+		if resp.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if schedule.Name != "nightly" {
+			t.Errorf("update applied despite conflict: name = %q", schedule.Name)
+		}
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"net/http"
 	"time"
 
@@ -36,6 +37,7 @@ type UserStore interface {
 	CreateUserSession(ctx context.Context, session *models.UserSession) error
 	RevokeUserSession(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
 	// Password authentication methods
+	GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	GetUserPasswordInfo(ctx context.Context, userID uuid.UUID) (*models.UserPasswordInfo, error)
 }
@@ -46,6 +48,7 @@ type AuthHandler struct {
 	sessions  *auth.SessionStore
 	userStore UserStore
 	groupSync *auth.GroupSync
+	mfa       *auth.MFAVerifier
 	logger    zerolog.Logger
 }
 
@@ -63,6 +66,11 @@ func NewAuthHandler(oidc *auth.OIDCProvider, sessions *auth.SessionStore, userSt
 	}
 }
 
+// SetMFAVerifier enables second-factor verification for password logins.
+func (h *AuthHandler) SetMFAVerifier(mfa *auth.MFAVerifier) {
+	h.mfa = mfa
+}
+
 // RegisterRoutes registers auth routes on the given router group.
 func (h *AuthHandler) RegisterRoutes(r *gin.RouterGroup) {
 	r.GET("/login", h.Login)
@@ -71,6 +79,8 @@ func (h *AuthHandler) RegisterRoutes(r *gin.RouterGroup) {
 	r.GET("/me", h.Me)
 	// Password authentication routes
 	r.POST("/login/password", h.PasswordLogin)
+	r.POST("/login/mfa", h.PasswordLoginMFA)
+	r.POST("/login/mfa/webauthn", h.PasswordLoginWebAuthnOptions)
 	// Auth status (within /auth group)
 	r.GET("/status", h.AuthStatus)
 }
@@ -272,6 +282,31 @@ func (h *AuthHandler) Callback(c *gin.Context) {
 		currentOrgRole = string(memberships[0].Role)
 	}
 
+	sessionRecordID, err := startLoginSession(c, h.sessions, h.userStore, h.logger, user, currentOrgID, currentOrgRole)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to save user to session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
+		return
+	}
+
+	h.logger.Info().
+		Str("user_id", user.ID.String()).
+		Str("email", user.Email).
+		Str("session_id", sessionRecordID.String()).
+		Msg("user authenticated successfully")
+
+	// Redirect to frontend dashboard
+	c.Redirect(http.StatusFound, "/")
+}
+
+// loginSessionStore defines the persistence needed to record a login session.
+type loginSessionStore interface {
+	CreateUserSession(ctx context.Context, session *models.UserSession) error
+}
+
+// startLoginSession records a session for a user who completed single sign-on
+// and stores the user in the session cookie. It returns the session record ID.
+func startLoginSession(c *gin.Context, sessions *auth.SessionStore, store loginSessionStore, logger zerolog.Logger, user *models.User, orgID uuid.UUID, orgRole string) (uuid.UUID, error) {
 	// Create a session record in the database
 	sessionRecordID := uuid.New()
 	sessionTokenHash := generateSessionTokenHash(sessionRecordID)
@@ -284,8 +319,8 @@ func (h *AuthHandler) Callback(c *gin.Context) {
 	userSession := models.NewUserSession(user.ID, sessionTokenHash, ipAddress, userAgent, &expiresAt)
 	userSession.ID = sessionRecordID
 
-	if err := h.userStore.CreateUserSession(c.Request.Context(), userSession); err != nil {
-		h.logger.Error().Err(err).Msg("failed to create user session record")
+	if err := store.CreateUserSession(c.Request.Context(), userSession); err != nil {
+		logger.Error().Err(err).Msg("failed to create user session record")
 		// Continue anyway - session tracking is not critical for authentication
 	}
 
@@ -296,26 +331,17 @@ func (h *AuthHandler) Callback(c *gin.Context) {
 		Email:           user.Email,
 		Name:            user.Name,
 		AuthenticatedAt: time.Now(),
-		CurrentOrgID:    currentOrgID,
-		CurrentOrgRole:  currentOrgRole,
+		StepUpAt:        time.Now(),
+		CurrentOrgID:    orgID,
+		CurrentOrgRole:  orgRole,
 		SessionRecordID: sessionRecordID,
 		IsSuperuser:     user.IsSuperuser,
 	}
 
-	if err := h.sessions.SetUser(c.Request, c.Writer, sessionUser); err != nil {
-		h.logger.Error().Err(err).Msg("failed to save user to session")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
-		return
+	if err := sessions.SetUser(c.Request, c.Writer, sessionUser); err != nil {
+		return uuid.Nil, err
 	}
-
-	h.logger.Info().
-		Str("user_id", user.ID.String()).
-		Str("email", user.Email).
-		Str("session_id", sessionRecordID.String()).
-		Msg("user authenticated successfully")
-
-	// Redirect to frontend dashboard
-	c.Redirect(http.StatusFound, "/")
+	return sessionRecordID, nil
 }
 
 // findOrCreateUser finds an existing user by OIDC subject or creates a new one.
@@ -528,6 +554,33 @@ func (h *AuthHandler) PasswordLogin(c *gin.Context) {
 		return
 	}
 
+	// Users with an enrolled second factor must complete it before a session is issued
+	if h.mfa != nil {
+		factors, err := h.mfa.ConfirmedFactors(c.Request.Context(), user.ID)
+		if err != nil {
+			h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to get mfa factors")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
+			return
+		}
+		if len(factors) > 0 {
+			if err := h.sessions.SetPendingMFA(c.Request, c.Writer, user.ID); err != nil {
+				h.logger.Error().Err(err).Msg("failed to save pending mfa login")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
+				return
+			}
+			c.JSON(http.StatusOK, MFARequiredResponse{
+				MFARequired: true,
+				Methods:     auth.MFAMethods(factors),
+			})
+			return
+		}
+	}
+
+	h.completePasswordLogin(c, user, passwordInfo, "Password-based login")
+}
+
+// completePasswordLogin issues the session for a fully authenticated local user.
+func (h *AuthHandler) completePasswordLogin(c *gin.Context, user *models.User, passwordInfo *models.UserPasswordInfo, details string) {
 	// Get user's memberships
 	memberships, err := h.userStore.GetMembershipsByUserID(c.Request.Context(), user.ID)
 	if err != nil {
@@ -544,12 +597,14 @@ func (h *AuthHandler) PasswordLogin(c *gin.Context) {
 	}
 
 	// Store user in session
+	now := time.Now()
 	sessionUser := &auth.SessionUser{
 		ID:              user.ID,
 		OIDCSubject:     user.OIDCSubject, // Will be empty for password-only users
 		Email:           user.Email,
 		Name:            user.Name,
-		AuthenticatedAt: time.Now(),
+		AuthenticatedAt: now,
+		StepUpAt:        now,
 		CurrentOrgID:    currentOrgID,
 		CurrentOrgRole:  currentOrgRole,
 	}
@@ -563,7 +618,7 @@ func (h *AuthHandler) PasswordLogin(c *gin.Context) {
 	// Create audit log
 	auditLog := models.NewAuditLog(currentOrgID, models.AuditActionLogin, "user", models.AuditResultSuccess).
 		WithUser(user.ID).
-		WithDetails("Password-based login")
+		WithDetails(details)
 	if err := h.userStore.CreateAuditLog(c.Request.Context(), auditLog); err != nil {
 		h.logger.Warn().Err(err).Msg("failed to create audit log for login")
 	}
@@ -590,3 +645,179 @@ func (h *AuthHandler) PasswordLogin(c *gin.Context) {
 		ExpiresAt:          passwordInfo.PasswordExpiresAt,
 	})
 }
+
+// MFARequiredResponse is returned by password login when a second factor is needed.
+type MFARequiredResponse struct {
+	MFARequired bool     `json:"mfa_required"`
+	Methods     []string `json:"methods"`
+}
+
+// PasswordLoginMFA completes a password login with a second factor.
+//
+//	@Summary		Complete MFA login
+//	@Description	Verifies a TOTP code, WebAuthn assertion or recovery code for a password login that returned mfa_required, then creates the session.
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		models.MFAVerifyRequest	true	"Second factor"
+//	@Success		200		{object}	PasswordLoginResponse
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		429		{object}	map[string]string
+//	@Router			/auth/login/mfa [post]
+func (h *AuthHandler) PasswordLoginMFA(c *gin.Context) {
+	if h.mfa == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MFA not enabled"})
+		return
+	}
+
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Method == models.MFAMethodPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a second factor is required"})
+		return
+	}
+
+	userID, err := h.sessions.GetPendingMFA(c.Request)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no pending login, please sign in again"})
+		return
+	}
+
+	// Failures are counted server-side: the pending login lives in the
+	// session cookie, which a client can replay.
+	locked, err := h.mfa.LoginLocked(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", userID.String()).Msg("failed to check mfa login lockout")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
+		return
+	}
+	if locked {
+		h.rejectLockedMFALogin(c)
+		return
+	}
+
+	var challenge []byte
+	if req.Method == models.MFAMethodWebAuthn {
+		challenge, _ = h.sessions.TakeWebAuthnChallenge(c.Request, c.Writer)
+	}
+
+	if err := h.mfa.Verify(c.Request.Context(), userID, &req, challenge); err != nil {
+		h.logger.Debug().Err(err).Str("user_id", userID.String()).Str("method", req.Method).Msg("mfa login verification failed")
+		if !isMFAVerificationError(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
+			return
+		}
+		locked, err := h.mfa.RecordLoginFailure(c.Request.Context(), userID)
+		if err != nil {
+			h.logger.Error().Err(err).Str("user_id", userID.String()).Msg("failed to record mfa login failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
+			return
+		}
+		if locked {
+			h.logger.Warn().Str("user_id", userID.String()).Msg("mfa logins locked after too many failed attempts")
+			h.rejectLockedMFALogin(c)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid second factor"})
+		return
+	}
+
+	if err := h.mfa.ResetLoginFailures(c.Request.Context(), userID); err != nil {
+		h.logger.Warn().Err(err).Str("user_id", userID.String()).Msg("failed to reset mfa login failures")
+	}
+
+	user, err := h.userStore.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no pending login, please sign in again"})
+		return
+	}
+	passwordInfo, err := h.userStore.GetUserPasswordInfo(c.Request.Context(), user.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to get password info")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
+		return
+	}
+
+	if err := h.sessions.ClearPendingMFA(c.Request, c.Writer); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to clear pending mfa login")
+	}
+
+	h.completePasswordLogin(c, user, passwordInfo, "Password-based login with "+req.Method)
+}
+
+// rejectLockedMFALogin discards the pending login of a user whose MFA logins
+// are locked, so they must sign in with their password again.
+func (h *AuthHandler) rejectLockedMFALogin(c *gin.Context) {
+	if err := h.sessions.ClearPendingMFA(c.Request, c.Writer); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to clear pending mfa login")
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed attempts, please sign in again later"})
+}
+
+// PasswordLoginWebAuthnOptions issues a WebAuthn challenge for a pending MFA login.
+//
+//	@Summary		Begin WebAuthn MFA login
+//	@Description	Returns navigator.credentials.get() options for a password login that returned mfa_required.
+//	@Tags			Auth
+//	@Produce		json
+//	@Success		200	{object}	auth.WebAuthnRequestOptions
+//	@Failure		401	{object}	map[string]string
+//	@Router			/auth/login/mfa/webauthn [post]
+func (h *AuthHandler) PasswordLoginWebAuthnOptions(c *gin.Context) {
+	if h.mfa == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MFA not enabled"})
+		return
+	}
+
+	userID, err := h.sessions.GetPendingMFA(c.Request)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "no pending login, please sign in again"})
+		return
+	}
+
+	options, err := webAuthnRequestOptions(c, h.mfa, h.sessions, userID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", userID.String()).Msg("failed to create webauthn challenge")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create challenge"})
+		return
+	}
+	if options == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no security keys enrolled"})
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+// webAuthnRequestOptions creates and stores a WebAuthn challenge for a user's
+// enrolled credentials. Returns nil options if the user has no WebAuthn factors.
+func webAuthnRequestOptions(c *gin.Context, mfa *auth.MFAVerifier, sessions *auth.SessionStore, userID uuid.UUID) (*auth.WebAuthnRequestOptions, error) {
+	factors, err := mfa.ConfirmedFactors(c.Request.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	credIDs := auth.WebAuthnCredentialIDs(factors)
+	if len(credIDs) == 0 {
+		return nil, nil
+	}
+	challenge, err := auth.NewWebAuthnChallenge()
+	if err != nil {
+		return nil, err
+	}
+	if err := sessions.SetWebAuthnChallenge(c.Request, c.Writer, challenge); err != nil {
+		return nil, err
+	}
+	return auth.NewWebAuthnRequestOptions(mfa.WebAuthn(), challenge, credIDs), nil
+}
+
+// isMFAVerificationError reports whether err is a client-side verification failure
+// rather than an internal error.
+func isMFAVerificationError(err error) bool {
+	return errors.Is(err, auth.ErrMFAInvalid) ||
+		errors.Is(err, auth.ErrMFANotEnrolled) ||
+		errors.Is(err, auth.ErrMFAUnsupportedMethod) ||
+		errors.Is(err, auth.ErrWebAuthnChallengeMismatch)
+}
@@ -30,6 +30,7 @@ type mockUserStore struct {
 	ssoGroups       *models.UserSSOGroups
 	groupMappings   []*models.SSOGroupMapping
 	membershipByOrg map[uuid.UUID]*models.OrgMembership
+	passwordInfo    *models.UserPasswordInfo
 
 	getUserErr          error
 	createUserErr       error
@@ -138,11 +139,24 @@ func (m *mockUserStore) RevokeUserSession(_ context.Context, _ uuid.UUID, _ uuid
 	return nil
 }
 
-func (m *mockUserStore) GetUserByEmail(_ context.Context, _ string) (*models.User, error) {
-	return nil, errors.New("not implemented")
+func (m *mockUserStore) GetUserByID(_ context.Context, id uuid.UUID) (*models.User, error) {
+	if m.user != nil && m.user.ID == id {
+		return m.user, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func (m *mockUserStore) GetUserByEmail(_ context.Context, email string) (*models.User, error) {
+	if m.user != nil && m.user.Email == email {
+		return m.user, nil
+	}
+	return nil, errors.New("user not found")
 }
 
 func (m *mockUserStore) GetUserPasswordInfo(_ context.Context, _ uuid.UUID) (*models.UserPasswordInfo, error) {
+	if m.passwordInfo != nil {
+		return m.passwordInfo, nil
+	}
 	return nil, errors.New("not implemented")
 }
 
@@ -914,3 +928,145 @@ func TestAuth_Callback_NoOIDCProvider(t *testing.T) {
 		t.Fatalf("expected error 'SSO not configured', got %q", resp["error"])
 	}
 }
+
+func TestAuth_PasswordLogin_MFA(t *testing.T) {
+	sessions := newAuthTestSessionStore(t)
+	hash, err := auth.HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword() error: %v", err)
+	}
+	user := &models.User{ID: uuid.New(), Email: "alice@example.com", Name: "Alice", EmailVerified: true}
+	store := &mockUserStore{
+		user:         user,
+		passwordInfo: &models.UserPasswordInfo{UserID: user.ID, PasswordHash: &hash},
+	}
+
+	mfaStore := newMockMFAFactorStore()
+	addConfirmedTOTP(mfaStore, user.ID, "JBSWY3DPEHPK3PXP")
+	webAuthn := auth.WebAuthnConfig{RPID: "localhost", Origins: []string{"http://localhost:8080"}}
+
+	handler := NewAuthHandler(auth.NewOIDCProvider(nil, zerolog.Nop()), sessions, store, zerolog.Nop())
+	handler.SetMFAVerifier(auth.NewMFAVerifier(mfaStore, mfaTestCipher{}, webAuthn, zerolog.Nop()))
+	r := setupAuthTestRouter(handler)
+
+	w := httptest.NewRecorder()
+	req := JSONRequest("POST", "/auth/login/password", `{"email":"alice@example.com","password":"correct horse battery staple"}`)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var pending MFARequiredResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &pending); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if !pending.MFARequired {
+		t.Fatal("expected mfa_required")
+	}
+	cookies := w.Result().Cookies()
+
+	t.Run("not logged in before second factor", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/auth/me", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", w.Code)
+		}
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		req := JSONRequest("POST", "/auth/login/mfa", `{"method":"totp","code":"abcdef"}`)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	code, _ := auth.GenerateTOTPCode("JBSWY3DPEHPK3PXP", time.Now())
+	req = JSONRequest("POST", "/auth/login/mfa", `{"method":"totp","code":"`+code+`"}`)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp PasswordLoginResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.ID != user.ID {
+		t.Errorf("expected user %s, got %s", user.ID, resp.ID)
+	}
+}
+
+func TestAuth_PasswordLoginMFA_NoPendingLogin(t *testing.T) {
+	sessions := newAuthTestSessionStore(t)
+	handler := NewAuthHandler(auth.NewOIDCProvider(nil, zerolog.Nop()), sessions, &mockUserStore{}, zerolog.Nop())
+	handler.SetMFAVerifier(auth.NewMFAVerifier(newMockMFAFactorStore(), mfaTestCipher{}, auth.WebAuthnConfig{}, zerolog.Nop()))
+	r := setupAuthTestRouter(handler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, JSONRequest("POST", "/auth/login/mfa", `{"method":"totp","code":"123456"}`))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAuth_PasswordLoginMFA_TooManyAttempts(t *testing.T) {
+	sessions := newAuthTestSessionStore(t)
+	hash, err := auth.HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword() error: %v", err)
+	}
+	user := &models.User{ID: uuid.New(), Email: "alice@example.com", Name: "Alice", EmailVerified: true}
+	store := &mockUserStore{
+		user:         user,
+		passwordInfo: &models.UserPasswordInfo{UserID: user.ID, PasswordHash: &hash},
+	}
+
+	mfaStore := newMockMFAFactorStore()
+	addConfirmedTOTP(mfaStore, user.ID, "JBSWY3DPEHPK3PXP")
+	handler := NewAuthHandler(auth.NewOIDCProvider(nil, zerolog.Nop()), sessions, store, zerolog.Nop())
+	handler.SetMFAVerifier(auth.NewMFAVerifier(mfaStore, mfaTestCipher{}, auth.WebAuthnConfig{}, zerolog.Nop()))
+	r := setupAuthTestRouter(handler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, JSONRequest("POST", "/auth/login/password", `{"email":"alice@example.com","password":"correct horse battery staple"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	cookies := w.Result().Cookies()
+
+	verify := func(code string) *httptest.ResponseRecorder {
+		req := JSONRequest("POST", "/auth/login/mfa", `{"method":"totp","code":"`+code+`"}`)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 1; i < auth.MaxMFALoginAttempts; i++ {
+		if w := verify("000000"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+	if w := verify("000000"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after %d failures, got %d: %s", auth.MaxMFALoginAttempts, w.Code, w.Body.String())
+	}
+
+	// Replaying the pending login cookie with the right code is refused too.
+	code, _ := auth.GenerateTOTPCode("JBSWY3DPEHPK3PXP", time.Now())
+	if w := verify(code); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while locked, got %d: %s", w.Code, w.Body.String())
+	}
+}
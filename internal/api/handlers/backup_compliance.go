@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// ComplianceEvaluator evaluates an organization against the 3-2-1 backup rule.
+type ComplianceEvaluator interface {
+	EvaluateOrg(ctx context.Context, orgID uuid.UUID) (*models.BackupComplianceReport, error)
+}
+
+// BackupComplianceHandler handles 3-2-1 backup compliance endpoints.
+type BackupComplianceHandler struct {
+	evaluator ComplianceEvaluator
+	logger    zerolog.Logger
+}
+
+// NewBackupComplianceHandler creates a new BackupComplianceHandler.
+func NewBackupComplianceHandler(evaluator ComplianceEvaluator, logger zerolog.Logger) *BackupComplianceHandler {
+	return &BackupComplianceHandler{
+		evaluator: evaluator,
+		logger:    logger.With().Str("component", "backup_compliance_handler").Logger(),
+	}
+}
+
+// RegisterRoutes registers backup compliance routes on the given router group.
+func (h *BackupComplianceHandler) RegisterRoutes(r *gin.RouterGroup) {
+	compliance := r.Group("/backup-compliance")
+	{
+		compliance.GET("", h.GetReport)
+		compliance.GET("/agents/:id", h.GetAgent)
+	}
+}
+
+// GetReport evaluates every agent and schedule of the organization.
+//
+//	@Summary		Get 3-2-1 compliance report
+//	@Description	Scores every agent and enabled schedule against the 3-2-1 rule (3 copies, 2 media types, 1 offsite or immutable copy) and lists the gaps
+//	@Tags			Backup Compliance
+//	@Produce		json
+//	@Success		200	{object}	models.BackupComplianceReport
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/backup-compliance [get]
+func (h *BackupComplianceHandler) GetReport(c *gin.Context) {
+	report := h.evaluate(c)
+	if report == nil {
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetAgent evaluates a single agent's schedules.
+//
+//	@Summary		Get agent 3-2-1 compliance
+//	@Description	Scores an agent's enabled schedules against the 3-2-1 rule
+//	@Tags			Backup Compliance
+//	@Produce		json
+//	@Param			id	path		string	true	"Agent ID"
+//	@Success		200	{object}	models.AgentCompliance
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/backup-compliance/agents/{id} [get]
+func (h *BackupComplianceHandler) GetAgent(c *gin.Context) {
+	agentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid agent ID"})
+		return
+	}
+
+	report := h.evaluate(c)
+	if report == nil {
+		return
+	}
+	for _, agent := range report.Agents {
+		if agent.AgentID == agentID {
+			c.JSON(http.StatusOK, agent)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+}
+
+// evaluate runs the evaluation for the current organization, writing an
+// error response and returning nil on failure.
+func (h *BackupComplianceHandler) evaluate(c *gin.Context) *models.BackupComplianceReport {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return nil
+	}
+
+	if user.CurrentOrgID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no organization selected"})
+		return nil
+	}
+
+	report, err := h.evaluator.EvaluateOrg(c.Request.Context(), user.CurrentOrgID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("org_id", user.CurrentOrgID.String()).Msg("failed to evaluate backup compliance")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to evaluate backup compliance"})
+		return nil
+	}
+	return report
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockComplianceEvaluator struct {
+	report *models.BackupComplianceReport
+	err    error
+}
+
+func (m *mockComplianceEvaluator) EvaluateOrg(_ context.Context, _ uuid.UUID) (*models.BackupComplianceReport, error) {
+	return m.report, m.err
+}
+
+func setupBackupComplianceTestRouter(evaluator ComplianceEvaluator, user *auth.SessionUser) *gin.Engine {
+	r := SetupTestRouter(user)
+	handler := NewBackupComplianceHandler(evaluator, zerolog.Nop())
+	handler.RegisterRoutes(r.Group("/api/v1"))
+	return r
+}
+
+func TestBackupComplianceGetReport(t *testing.T) {
+	orgID := uuid.New()
+	user := testUser(orgID)
+	agentID := uuid.New()
+	report := &models.BackupComplianceReport{
+		OrgID:       orgID,
+		Score:       67,
+		TotalAgents: 1,
+		Agents: []*models.AgentCompliance{
+			{AgentID: agentID, Hostname: "web-01", Score: 67, Gaps: []string{"nightly: no offsite or immutable copy"}},
+		},
+	}
+
+	t.Run("returns report", func(t *testing.T) {
+		r := setupBackupComplianceTestRouter(&mockComplianceEvaluator{report: report}, user)
+		resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/backup-compliance"))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var got models.BackupComplianceReport
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Score != 67 || len(got.Agents) != 1 {
+			t.Errorf("report = %+v", got)
+		}
+	})
+
+	t.Run("returns agent", func(t *testing.T) {
+		r := setupBackupComplianceTestRouter(&mockComplianceEvaluator{report: report}, user)
+		resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/backup-compliance/agents/"+agentID.String()))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+
+	t.Run("unknown agent returns 404", func(t *testing.T) {
+		r := setupBackupComplianceTestRouter(&mockComplianceEvaluator{report: report}, user)
+		resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/backup-compliance/agents/"+uuid.New().String()))
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", resp.Code)
+		}
+	})
+
+	t.Run("invalid agent ID returns 400", func(t *testing.T) {
+		r := setupBackupComplianceTestRouter(&mockComplianceEvaluator{report: report}, user)
+		resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/backup-compliance/agents/not-a-uuid"))
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", resp.Code)
+		}
+	})
+
+	t.Run("evaluation error returns 500", func(t *testing.T) {
+		r := setupBackupComplianceTestRouter(&mockComplianceEvaluator{err: errors.New("db down")}, user)
+		resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/backup-compliance"))
+		if resp.Code != http.StatusInternalServerError {
+			t.Fatalf("expected 500, got %d", resp.Code)
+		}
+	})
+
+	t.Run("no org returns 400", func(t *testing.T) {
+		r := setupBackupComplianceTestRouter(&mockComplianceEvaluator{report: report}, testUserNoOrg())
+		resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/backup-compliance"))
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", resp.Code)
+		}
+	})
+}
@@ -83,8 +83,7 @@ func (h *BackupsHandler) List(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermBackupRead); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermBackupRead) {
 		return
 	}
 
@@ -122,7 +121,7 @@ func (h *BackupsHandler) List(c *gin.Context) {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"backups": filterByStatus(backups, c.Query("status"))})
+		c.JSON(http.StatusOK, gin.H{"backups": filterByStatus(h.visibleBackups(c.Request.Context(), user, backups), c.Query("status"))})
 		return
 	}
 
@@ -149,7 +148,7 @@ func (h *BackupsHandler) List(c *gin.Context) {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"backups": filterByStatus(backups, c.Query("status"))})
+		c.JSON(http.StatusOK, gin.H{"backups": filterByStatus(h.visibleBackups(c.Request.Context(), user, backups), c.Query("status"))})
 		return
 	}
 
@@ -171,7 +170,7 @@ func (h *BackupsHandler) List(c *gin.Context) {
 		allBackups = append(allBackups, backups...)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"backups": filterByStatus(allBackups, c.Query("status"))})
+	c.JSON(http.StatusOK, gin.H{"backups": filterByStatus(h.visibleBackups(c.Request.Context(), user, allBackups), c.Query("status"))})
 }
 
 // Get returns a specific backup by ID.
@@ -200,8 +199,7 @@ func (h *BackupsHandler) Get(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermBackupRead); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermBackupRead) {
 		return
 	}
 
@@ -230,6 +228,9 @@ func (h *BackupsHandler) Get(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "backup not found"})
 		return
 	}
+	if !requireScopedPermission(c, h.rbac, user, auth.PermBackupRead, backupScope(backup)) {
+		return
+	}
 
 	c.JSON(http.StatusOK, backup)
 }
@@ -259,8 +260,7 @@ func (h *BackupsHandler) GetValidation(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermBackupRead); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermBackupRead) {
 		return
 	}
 
@@ -290,6 +290,9 @@ func (h *BackupsHandler) GetValidation(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "backup not found"})
 		return
 	}
+	if !requireScopedPermission(c, h.rbac, user, auth.PermBackupRead, backupScope(backup)) {
+		return
+	}
 
 	// Get validation for this backup
 	validation, err := h.store.GetBackupValidationByBackupID(c.Request.Context(), id)
@@ -302,6 +305,29 @@ func (h *BackupsHandler) GetValidation(c *gin.Context) {
 	c.JSON(http.StatusOK, validation)
 }
 
+// visibleBackups filters backups down to those the user may read. Users with
+// organization-wide backup:read see all of them; users whose access comes
+// from scoped role bindings only see backups of agents and repositories
+// within their scope.
+func (h *BackupsHandler) visibleBackups(ctx context.Context, user *auth.SessionUser, backups []*models.Backup) []*models.Backup {
+	if has, err := h.rbac.HasPermission(ctx, user.ID, user.CurrentOrgID, auth.PermBackupRead); err == nil && has {
+		return backups
+	}
+
+	visible := make([]*models.Backup, 0, len(backups))
+	for _, backup := range backups {
+		has, err := h.rbac.HasPermissionForResource(ctx, user.ID, user.CurrentOrgID, auth.PermBackupRead, backupScope(backup))
+		if err != nil {
+			h.logger.Error().Err(err).Str("backup_id", backup.ID.String()).Msg("failed to check backup permission")
+			continue
+		}
+		if has {
+			visible = append(visible, backup)
+		}
+	}
+	return visible
+}
+
 // filterByStatus filters backups by status if status param is provided.
 func filterByStatus(backups []*models.Backup, status string) []*models.Backup {
 	if status == "" {
@@ -368,8 +394,7 @@ func (h *BackupsHandler) Calendar(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermBackupRead); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermBackupRead) {
 		return
 	}
 
@@ -399,6 +424,8 @@ func (h *BackupsHandler) Calendar(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get backup calendar"})
 		return
 	}
+	backups = h.visibleBackups(c.Request.Context(), user, backups)
+	orgWide, _ := h.rbac.HasPermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermBackupRead)
 
 	// Get all agents and their schedules
 	agents, err := h.store.GetAgentsByOrgID(c.Request.Context(), user.CurrentOrgID)
@@ -472,6 +499,11 @@ func (h *BackupsHandler) Calendar(c *gin.Context) {
 				if !schedule.Enabled {
 					continue
 				}
+				if !orgWide {
+					if has, err := h.rbac.HasPermissionForAnyResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermBackupRead, scheduleScopes(schedule)); err != nil || !has {
+						continue
+					}
+				}
 
 				// Parse cron expression
 				parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
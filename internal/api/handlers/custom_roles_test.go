@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockCustomRoleStore struct {
+	roles       []*models.CustomRole
+	role        *models.CustomRole
+	bindings    []*models.RoleBinding
+	binding     *models.RoleBinding
+	agentGroup  *models.AgentGroup
+	repo        *models.Repository
+	membership  *models.OrgMembership
+	created     *models.RoleBinding
+	createdRole *models.CustomRole
+	listErr     error
+	createErr   error
+}
+
+func (m *mockCustomRoleStore) GetCustomRolesByOrgID(_ context.Context, _ uuid.UUID) ([]*models.CustomRole, error) {
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
+	return m.roles, nil
+}
+
+func (m *mockCustomRoleStore) GetCustomRoleByID(_ context.Context, _ uuid.UUID) (*models.CustomRole, error) {
+	if m.role == nil {
+		return nil, errors.New("not found")
+	}
+	return m.role, nil
+}
+
+func (m *mockCustomRoleStore) CreateCustomRole(_ context.Context, role *models.CustomRole) error {
+	m.createdRole = role
+	return m.createErr
+}
+
+func (m *mockCustomRoleStore) UpdateCustomRole(_ context.Context, _ *models.CustomRole) error {
+	return nil
+}
+
+func (m *mockCustomRoleStore) DeleteCustomRole(_ context.Context, _ uuid.UUID) error {
+	return nil
+}
+
+func (m *mockCustomRoleStore) GetRoleBindingsByOrgID(_ context.Context, _ uuid.UUID) ([]*models.RoleBinding, error) {
+	return m.bindings, nil
+}
+
+func (m *mockCustomRoleStore) GetRoleBindingByID(_ context.Context, _ uuid.UUID) (*models.RoleBinding, error) {
+	if m.binding == nil {
+		return nil, errors.New("not found")
+	}
+	return m.binding, nil
+}
+
+func (m *mockCustomRoleStore) CreateRoleBinding(_ context.Context, b *models.RoleBinding) error {
+	m.created = b
+	return m.createErr
+}
+
+func (m *mockCustomRoleStore) DeleteRoleBinding(_ context.Context, _ uuid.UUID) error {
+	return nil
+}
+
+func (m *mockCustomRoleStore) GetAgentGroupByID(_ context.Context, _ uuid.UUID) (*models.AgentGroup, error) {
+	if m.agentGroup == nil {
+		return nil, errors.New("not found")
+	}
+	return m.agentGroup, nil
+}
+
+func (m *mockCustomRoleStore) GetRepositoryByID(_ context.Context, _ uuid.UUID) (*models.Repository, error) {
+	if m.repo == nil {
+		return nil, errors.New("not found")
+	}
+	return m.repo, nil
+}
+
+func (m *mockCustomRoleStore) GetMembershipByUserAndOrg(_ context.Context, _, _ uuid.UUID) (*models.OrgMembership, error) {
+	return m.membership, nil
+}
+
+func (m *mockCustomRoleStore) CreateAuditLog(_ context.Context, _ *models.AuditLog) error {
+	return nil
+}
+
+func setupCustomRolesTestRouter(store CustomRoleStore, role models.OrgRole, user *auth.SessionUser) *gin.Engine {
+	r := SetupTestRouter(user)
+	memberStore := &mockSSOmembershipStore{}
+	if user != nil {
+		memberStore.membership = &models.OrgMembership{UserID: user.ID, OrgID: user.CurrentOrgID, Role: role}
+	}
+	handler := NewCustomRolesHandler(store, auth.NewRBAC(memberStore), nil, zerolog.Nop())
+	handler.RegisterRoutes(r.Group("/api/v1"))
+	return r
+}
+
+func TestListPermissions(t *testing.T) {
+	orgID := uuid.New()
+	r := setupCustomRolesTestRouter(&mockCustomRoleStore{}, models.OrgRoleReadonly, TestUser(orgID))
+
+	w := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/permissions"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp PermissionsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(resp.Permissions) != len(auth.AllPermissions()) {
+		t.Errorf("expected %d permissions, got %d", len(auth.AllPermissions()), len(resp.Permissions))
+	}
+}
+
+func TestCreateCustomRole(t *testing.T) {
+	orgID := uuid.New()
+
+	t.Run("success", func(t *testing.T) {
+		store := &mockCustomRoleStore{}
+		user := TestUser(orgID)
+		r := setupCustomRolesTestRouter(store, models.OrgRoleAdmin, user)
+
+		body := `{"name":"DBA","permissions":["restore:create","repo:read"]}`
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/organizations/"+orgID.String()+"/custom-roles", body))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		if store.createdRole == nil || store.createdRole.Name != "DBA" {
+			t.Fatal("expected role to be created")
+		}
+		if store.createdRole.CreatedBy == nil || *store.createdRole.CreatedBy != user.ID {
+			t.Error("expected created_by to be set")
+		}
+	})
+
+	t.Run("invalid permission", func(t *testing.T) {
+		r := setupCustomRolesTestRouter(&mockCustomRoleStore{}, models.OrgRoleAdmin, TestUser(orgID))
+
+		body := `{"name":"DBA","permissions":["repo:explode"]}`
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/organizations/"+orgID.String()+"/custom-roles", body))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("permission denied", func(t *testing.T) {
+		r := setupCustomRolesTestRouter(&mockCustomRoleStore{}, models.OrgRoleMember, TestUser(orgID))
+
+		body := `{"name":"DBA","permissions":["repo:read"]}`
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/organizations/"+orgID.String()+"/custom-roles", body))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("owner-only permission", func(t *testing.T) {
+		body := `{"name":"Breakglass","permissions":["org:delete","user:impersonate"]}`
+
+		r := setupCustomRolesTestRouter(&mockCustomRoleStore{}, models.OrgRoleAdmin, TestUser(orgID))
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/organizations/"+orgID.String()+"/custom-roles", body))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("expected 403 for admin, got %d: %s", w.Code, w.Body.String())
+		}
+
+		store := &mockCustomRoleStore{}
+		r = setupCustomRolesTestRouter(store, models.OrgRoleOwner, TestUser(orgID))
+		w = DoRequest(r, JSONRequest("POST", "/api/v1/organizations/"+orgID.String()+"/custom-roles", body))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201 for owner, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		store := &mockCustomRoleStore{createErr: errors.New("db error")}
+		r := setupCustomRolesTestRouter(store, models.OrgRoleOwner, TestUser(orgID))
+
+		body := `{"name":"DBA","permissions":["repo:read"]}`
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/organizations/"+orgID.String()+"/custom-roles", body))
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("expected 500, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestGetCustomRole_OtherOrg(t *testing.T) {
+	orgID := uuid.New()
+	store := &mockCustomRoleStore{
+		role: models.NewCustomRole(uuid.New(), "DBA", "", []string{"repo:read"}),
+	}
+	r := setupCustomRolesTestRouter(store, models.OrgRoleAdmin, TestUser(orgID))
+
+	w := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/organizations/"+orgID.String()+"/custom-roles/"+store.role.ID.String()))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCreateRoleBinding(t *testing.T) {
+	orgID := uuid.New()
+	role := models.NewCustomRole(orgID, "DBA", "", []string{"restore:create"})
+	groupID := uuid.New()
+
+	t.Run("sso group scoped to agent group", func(t *testing.T) {
+		store := &mockCustomRoleStore{
+			role:       role,
+			agentGroup: &models.AgentGroup{ID: groupID, OrgID: orgID, Name: "db-servers"},
+		}
+		r := setupCustomRolesTestRouter(store, models.OrgRoleAdmin, TestUser(orgID))
+
+		body := `{"role_id":"` + role.ID.String() + `","subject_type":"sso_group","sso_group_name":"dba-team","agent_group_ids":["` + groupID.String() + `"]}`
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/organizations/"+orgID.String()+"/role-bindings", body))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		if store.created == nil {
+			t.Fatal("expected binding to be created")
+		}
+		if store.created.SSOGroupName != "dba-team" || !store.created.IsScoped() {
+			t.Errorf("unexpected binding: %+v", store.created)
+		}
+	})
+
+	t.Run("agent group from other org", func(t *testing.T) {
+		store := &mockCustomRoleStore{
+			role:       role,
+			agentGroup: &models.AgentGroup{ID: groupID, OrgID: uuid.New()},
+		}
+		r := setupCustomRolesTestRouter(store, models.OrgRoleAdmin, TestUser(orgID))
+
+		body := `{"role_id":"` + role.ID.String() + `","subject_type":"sso_group","sso_group_name":"dba-team","agent_group_ids":["` + groupID.String() + `"]}`
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/organizations/"+orgID.String()+"/role-bindings", body))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("user must be member", func(t *testing.T) {
+		store := &mockCustomRoleStore{role: role}
+		r := setupCustomRolesTestRouter(store, models.OrgRoleAdmin, TestUser(orgID))
+
+		body := `{"role_id":"` + role.ID.String() + `","subject_type":"user","user_id":"` + uuid.New().String() + `"}`
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/organizations/"+orgID.String()+"/role-bindings", body))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("role with permissions the caller lacks", func(t *testing.T) {
+		ownerRole := models.NewCustomRole(orgID, "Breakglass", "", []string{"user:delete"})
+		user := TestUser(orgID)
+		store := &mockCustomRoleStore{
+			role:       ownerRole,
+			membership: &models.OrgMembership{UserID: user.ID, OrgID: orgID, Role: models.OrgRoleAdmin},
+		}
+		r := setupCustomRolesTestRouter(store, models.OrgRoleAdmin, user)
+
+		body := `{"role_id":"` + ownerRole.ID.String() + `","subject_type":"user","user_id":"` + user.ID.String() + `"}`
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/organizations/"+orgID.String()+"/role-bindings", body))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+		}
+		if store.created != nil {
+			t.Error("binding must not be created")
+		}
+	})
+
+	t.Run("invalid subject type", func(t *testing.T) {
+		store := &mockCustomRoleStore{role: role}
+		r := setupCustomRolesTestRouter(store, models.OrgRoleAdmin, TestUser(orgID))
+
+		body := `{"role_id":"` + role.ID.String() + `","subject_type":"robot"}`
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/organizations/"+orgID.String()+"/role-bindings", body))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
@@ -25,6 +25,7 @@ type DashboardMetricsStore interface {
 	GetCriticalRansomwareAlertCountByOrgID(ctx context.Context, orgID uuid.UUID) (int, error)
 	GetDockerHealthSummary(ctx context.Context, orgID uuid.UUID) (*models.DockerHealthSummary, error)
 	GetRecentContainerRestartEvents(ctx context.Context, orgID uuid.UUID, limit int) ([]*models.ContainerRestartEvent, error)
+	GetScheduleCompliancesByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.ScheduleCompliance, error)
 }
 
 // DashboardMetricsHandler handles dashboard metrics related HTTP endpoints.
@@ -98,6 +99,17 @@ func (h *DashboardMetricsHandler) GetDashboardStats(c *gin.Context) {
 		stats.RansomwareAlertsCritical = criticalCount
 	}
 
+	// Get 3-2-1 compliance from the latest background evaluation
+	compliances, err := h.store.GetScheduleCompliancesByOrgID(c.Request.Context(), user.CurrentOrgID)
+	if err != nil {
+		h.logger.Warn().Err(err).Msg("failed to get backup compliance")
+	} else {
+		summary := models.SummarizeBackupCompliance(compliances)
+		stats.ComplianceScore = summary.Score
+		stats.ComplianceSchedulesCompliant = summary.CompliantSchedules
+		stats.ComplianceSchedulesTotal = summary.TotalSchedules
+	}
+
 	c.JSON(http.StatusOK, stats)
 }
 
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"testing"
@@ -30,6 +31,7 @@ type mockDashboardMetricsStore struct {
 	durationErr    error
 	dailyErr       error
 	summariesErr   error
+	compliances    []*models.ScheduleCompliance
 }
 
 func (m *mockDashboardMetricsStore) GetUserByID(_ context.Context, _ uuid.UUID) (*models.User, error) {
@@ -89,6 +91,10 @@ func (m *mockDashboardMetricsStore) GetCriticalRansomwareAlertCountByOrgID(_ con
 	return 0, nil
 }
 
+func (m *mockDashboardMetricsStore) GetScheduleCompliancesByOrgID(_ context.Context, _ uuid.UUID) ([]*models.ScheduleCompliance, error) {
+	return m.compliances, nil
+}
+
 func (m *mockDashboardMetricsStore) GetDockerHealthSummary(_ context.Context, _ uuid.UUID) (*models.DockerHealthSummary, error) {
 	return nil, nil
 }
@@ -116,12 +122,23 @@ func TestDashboardGetStats(t *testing.T) {
 			dashStats: &models.DashboardStats{AgentTotal: 5},
 			rate7d:    &models.BackupSuccessRate{SuccessPercent: 95.0},
 			rate30d:   &models.BackupSuccessRate{SuccessPercent: 90.0},
+			compliances: []*models.ScheduleCompliance{
+				{Score: 100, Compliant: true},
+				{Score: 56},
+			},
 		}
 		r := setupDashboardMetricsTestRouter(store, user)
 		resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/dashboard-metrics/stats"))
 		if resp.Code != http.StatusOK {
 			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
 		}
+		var stats models.DashboardStats
+		if err := json.Unmarshal(resp.Body.Bytes(), &stats); err != nil {
+			t.Fatal(err)
+		}
+		if stats.ComplianceScore != 78 || stats.ComplianceSchedulesCompliant != 1 || stats.ComplianceSchedulesTotal != 2 {
+			t.Errorf("compliance = %d %d/%d", stats.ComplianceScore, stats.ComplianceSchedulesCompliant, stats.ComplianceSchedulesTotal)
+		}
 	})
 
 	t.Run("dash stats error", func(t *testing.T) {
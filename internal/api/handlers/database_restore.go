@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// DatabaseRestoreStore defines the persistence operations for database restores.
+type DatabaseRestoreStore interface {
+	GetBackupBySnapshotID(ctx context.Context, snapshotID string) (*models.Backup, error)
+	GetScheduleByID(ctx context.Context, id uuid.UUID) (*models.Schedule, error)
+	GetAgentByID(ctx context.Context, id uuid.UUID) (*models.Agent, error)
+	GetRepositoryByID(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	CreateDatabaseRestore(ctx context.Context, restore *models.DatabaseRestore) error
+	GetDatabaseRestoreByID(ctx context.Context, id uuid.UUID) (*models.DatabaseRestore, error)
+	GetDatabaseRestoresByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.DatabaseRestore, error)
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+}
+
+// DatabaseRestoreRunner starts database restores in the background.
+type DatabaseRestoreRunner interface {
+	StartRestore(ctx context.Context, restore *models.DatabaseRestore) error
+}
+
+// DatabaseRestoreHandler handles PostgreSQL and MySQL restore HTTP endpoints.
+type DatabaseRestoreHandler struct {
+	store  DatabaseRestoreStore
+	runner DatabaseRestoreRunner
+	logger zerolog.Logger
+}
+
+// NewDatabaseRestoreHandler creates a new DatabaseRestoreHandler.
+func NewDatabaseRestoreHandler(store DatabaseRestoreStore, runner DatabaseRestoreRunner, logger zerolog.Logger) *DatabaseRestoreHandler {
+	return &DatabaseRestoreHandler{
+		store:  store,
+		runner: runner,
+		logger: logger.With().Str("component", "database_restore_handler").Logger(),
+	}
+}
+
+// RegisterRoutes registers database restore routes on the given router group.
+func (h *DatabaseRestoreHandler) RegisterRoutes(r *gin.RouterGroup) {
+	restores := r.Group("/databases/restores")
+	{
+		restores.GET("", h.ListRestores)
+		restores.POST("", h.CreateRestore)
+		restores.GET("/:id", h.GetRestore)
+	}
+}
+
+// CreateDatabaseRestoreRequest is the request body for restoring a dump
+// taken by a postgres or mysql schedule.
+type CreateDatabaseRestoreRequest struct {
+	SnapshotID string `json:"snapshot_id" binding:"required"`
+	// Filename defaults to the snapshot's only file.
+	Filename string `json:"filename,omitempty" example:"postgres_app.dump"`
+	// Database is required for PostgreSQL custom and tar dumps.
+	Database string `json:"database,omitempty" example:"app"`
+}
+
+// ListRestores returns the organization's database restores.
+//
+//	@Summary		List database restores
+//	@Description	Returns PostgreSQL and MySQL restores for the current organization, newest first (admin only)
+//	@Tags			Databases
+//	@Produce		json
+//	@Success		200	{object}	map[string][]models.DatabaseRestore
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/databases/restores [get]
+func (h *DatabaseRestoreHandler) ListRestores(c *gin.Context) {
+	_, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	restores, err := h.store.GetDatabaseRestoresByOrgID(c.Request.Context(), orgID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("org_id", orgID.String()).Msg("failed to list database restores")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list database restores"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"restores": restores})
+}
+
+// GetRestore returns a database restore with its status and result.
+//
+//	@Summary		Get database restore
+//	@Description	Returns a PostgreSQL or MySQL restore with its status and, once finished, the restored dump's size and SHA-256 (admin only)
+//	@Tags			Databases
+//	@Produce		json
+//	@Param			id	path		string	true	"Restore ID"
+//	@Success		200	{object}	models.DatabaseRestore
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/databases/restores/{id} [get]
+func (h *DatabaseRestoreHandler) GetRestore(c *gin.Context) {
+	_, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid restore ID"})
+		return
+	}
+
+	restore, err := h.store.GetDatabaseRestoreByID(c.Request.Context(), id)
+	if err != nil || restore.OrgID != orgID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "restore not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, restore)
+}
+
+// CreateRestore restores a dump from a snapshot of a postgres or mysql schedule.
+//
+//	@Summary		Restore database dump
+//	@Description	Streams a dump from a snapshot taken by a postgres or mysql schedule with restic dump into psql, pg_restore or mysql on the schedule's database server (admin only).
+//	@Tags			Databases
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateDatabaseRestoreRequest	true	"Restore details"
+//	@Success		202		{object}	models.DatabaseRestore
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		409		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/databases/restores [post]
+func (h *DatabaseRestoreHandler) CreateRestore(c *gin.Context) {
+	userID, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req CreateDatabaseRestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The snapshot's backup record names the schedule, whose database
+	// server the dump is restored into, and the repository holding it.
+	ctx := c.Request.Context()
+	b, err := h.store.GetBackupBySnapshotID(ctx, req.SnapshotID)
+	if err != nil || b.RepositoryID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "snapshot not found"})
+		return
+	}
+	schedule, err := h.store.GetScheduleByID(ctx, b.ScheduleID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "snapshot not found"})
+		return
+	}
+	agent, err := h.store.GetAgentByID(ctx, schedule.AgentID)
+	if err != nil || agent.OrgID != orgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "snapshot not found"})
+		return
+	}
+	repo, err := h.store.GetRepositoryByID(ctx, *b.RepositoryID)
+	if err != nil || repo.OrgID != orgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "snapshot not found"})
+		return
+	}
+	if !schedule.IsPostgresBackup() && !schedule.IsMySQLBackup() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "snapshot is not a postgres or mysql backup"})
+		return
+	}
+
+	restore := models.NewDatabaseRestore(orgID, schedule.ID, repo.ID, req.SnapshotID)
+	restore.Filename = req.Filename
+	restore.Database = req.Database
+	restore.CreatedBy = &userID
+	if err := restore.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.CreateDatabaseRestore(ctx, restore); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create database restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create database restore"})
+		return
+	}
+
+	auditLog := models.NewAuditLog(orgID, models.AuditActionRestore, "database_restore", models.AuditResultSuccess).
+		WithUser(userID).
+		WithResource(restore.ID).
+		WithRequestInfo(c.ClientIP(), c.Request.UserAgent()).
+		WithDetails(fmt.Sprintf("Database restore of snapshot %s into the server of schedule %s", restore.SnapshotID, schedule.Name))
+	if err := h.store.CreateAuditLog(ctx, auditLog); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to create audit log")
+	}
+
+	// The runner updates the restore as it goes, so respond with a copy.
+	resp := *restore
+	if err := h.runner.StartRestore(context.Background(), restore); err != nil {
+		if errors.Is(err, backup.ErrDatabaseRestoreRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error().Err(err).Str("restore_id", restore.ID.String()).Msg("failed to start database restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start database restore"})
+		return
+	}
+
+	h.logger.Info().
+		Str("restore_id", restore.ID.String()).
+		Str("snapshot_id", restore.SnapshotID).
+		Str("schedule_id", schedule.ID.String()).
+		Msg("database restore started")
+
+	c.JSON(http.StatusAccepted, resp)
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockDatabaseRestoreStore struct {
+	backups   map[string]*models.Backup
+	schedules map[uuid.UUID]*models.Schedule
+	agents    map[uuid.UUID]*models.Agent
+	repos     map[uuid.UUID]*models.Repository
+	restores  map[uuid.UUID]*models.DatabaseRestore
+	auditLogs []*models.AuditLog
+}
+
+func (m *mockDatabaseRestoreStore) GetBackupBySnapshotID(_ context.Context, snapshotID string) (*models.Backup, error) {
+	b, ok := m.backups[snapshotID]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return b, nil
+}
+
+func (m *mockDatabaseRestoreStore) GetScheduleByID(_ context.Context, id uuid.UUID) (*models.Schedule, error) {
+	schedule, ok := m.schedules[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return schedule, nil
+}
+
+func (m *mockDatabaseRestoreStore) GetAgentByID(_ context.Context, id uuid.UUID) (*models.Agent, error) {
+	agent, ok := m.agents[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return agent, nil
+}
+
+func (m *mockDatabaseRestoreStore) GetRepositoryByID(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	repo, ok := m.repos[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return repo, nil
+}
+
+func (m *mockDatabaseRestoreStore) CreateDatabaseRestore(_ context.Context, restore *models.DatabaseRestore) error {
+	m.restores[restore.ID] = restore
+	return nil
+}
+
+func (m *mockDatabaseRestoreStore) GetDatabaseRestoreByID(_ context.Context, id uuid.UUID) (*models.DatabaseRestore, error) {
+	restore, ok := m.restores[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return restore, nil
+}
+
+func (m *mockDatabaseRestoreStore) GetDatabaseRestoresByOrgID(_ context.Context, orgID uuid.UUID) ([]*models.DatabaseRestore, error) {
+	var out []*models.DatabaseRestore
+	for _, restore := range m.restores {
+		if restore.OrgID == orgID {
+			out = append(out, restore)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockDatabaseRestoreStore) CreateAuditLog(_ context.Context, log *models.AuditLog) error {
+	m.auditLogs = append(m.auditLogs, log)
+	return nil
+}
+
+type mockDatabaseRestoreRunner struct {
+	started []*models.DatabaseRestore
+	err     error
+}
+
+func (r *mockDatabaseRestoreRunner) StartRestore(_ context.Context, restore *models.DatabaseRestore) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.started = append(r.started, restore)
+	return nil
+}
+
+func setupDatabaseRestoreTestRouter(store *mockDatabaseRestoreStore, runner *mockDatabaseRestoreRunner, user *auth.SessionUser) *gin.Engine {
+	r := SetupTestRouter(user)
+	handler := NewDatabaseRestoreHandler(store, runner, zerolog.Nop())
+	handler.RegisterRoutes(r.Group("/api/v1"))
+	return r
+}
+
+func TestDatabaseCreateRestore(t *testing.T) {
+	orgID := uuid.New()
+	agent := &models.Agent{ID: uuid.New(), OrgID: orgID}
+	foreignAgent := &models.Agent{ID: uuid.New(), OrgID: uuid.New()}
+	repo := models.NewRepository(orgID, "db", models.RepositoryTypeS3, nil)
+	pg := &models.Schedule{ID: uuid.New(), AgentID: agent.ID, Name: "pg", BackupType: models.BackupTypePostgres}
+	files := &models.Schedule{ID: uuid.New(), AgentID: agent.ID, Name: "files", BackupType: models.BackupTypeFile}
+	foreign := &models.Schedule{ID: uuid.New(), AgentID: foreignAgent.ID, Name: "foreign", BackupType: models.BackupTypePostgres}
+	snapshot := func(schedule *models.Schedule, id string) *models.Backup {
+		b := models.NewBackup(schedule.ID, schedule.AgentID, &repo.ID)
+		b.SnapshotID = id
+		return b
+	}
+	newStore := func() *mockDatabaseRestoreStore {
+		return &mockDatabaseRestoreStore{
+			backups: map[string]*models.Backup{
+				"pg000001": snapshot(pg, "pg000001"),
+				"files001": snapshot(files, "files001"),
+				"other001": snapshot(foreign, "other001"),
+			},
+			schedules: map[uuid.UUID]*models.Schedule{pg.ID: pg, files.ID: files, foreign.ID: foreign},
+			agents:    map[uuid.UUID]*models.Agent{agent.ID: agent, foreignAgent.ID: foreignAgent},
+			repos:     map[uuid.UUID]*models.Repository{repo.ID: repo},
+			restores:  make(map[uuid.UUID]*models.DatabaseRestore),
+		}
+	}
+	body := func(extra map[string]interface{}) string {
+		req := map[string]interface{}{"snapshot_id": "pg000001"}
+		for k, v := range extra {
+			req[k] = v
+		}
+		b, _ := json.Marshal(req)
+		return string(b)
+	}
+
+	t.Run("starts a restore into the schedule's server", func(t *testing.T) {
+		store, runner := newStore(), &mockDatabaseRestoreRunner{}
+		r := setupDatabaseRestoreTestRouter(store, runner, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/databases/restores", body(map[string]interface{}{
+			"filename": "postgres_app.dump",
+			"database": "app_restored",
+		})))
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if len(runner.started) != 1 {
+			t.Fatalf("expected restore to start, got %d", len(runner.started))
+		}
+		restore := runner.started[0]
+		if restore.ScheduleID != pg.ID || restore.RepositoryID != repo.ID ||
+			restore.Filename != "postgres_app.dump" || restore.Database != "app_restored" {
+			t.Errorf("restore = %+v", restore)
+		}
+		if _, ok := store.restores[restore.ID]; !ok {
+			t.Error("restore not stored")
+		}
+		if len(store.auditLogs) != 1 || store.auditLogs[0].Action != models.AuditActionRestore {
+			t.Errorf("audit logs = %v", store.auditLogs)
+		}
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		tests := []struct {
+			name string
+			body string
+		}{
+			{"unknown snapshot", body(map[string]interface{}{"snapshot_id": "missing1"})},
+			{"other org snapshot", body(map[string]interface{}{"snapshot_id": "other001"})},
+			{"file backup snapshot", body(map[string]interface{}{"snapshot_id": "files001"})},
+			{"filename with directory", body(map[string]interface{}{"filename": "../etc/passwd"})},
+			{"database option", body(map[string]interface{}{"database": "--help"})},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				store, runner := newStore(), &mockDatabaseRestoreRunner{}
+				r := setupDatabaseRestoreTestRouter(store, runner, adminUser(orgID))
+				resp := DoRequest(r, JSONRequest("POST", "/api/v1/databases/restores", tt.body))
+				if resp.Code != http.StatusBadRequest {
+					t.Errorf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+				}
+				if len(runner.started) != 0 {
+					t.Error("restore must not start")
+				}
+			})
+		}
+	})
+
+	t.Run("already running", func(t *testing.T) {
+		store, runner := newStore(), &mockDatabaseRestoreRunner{err: backup.ErrDatabaseRestoreRunning}
+		r := setupDatabaseRestoreTestRouter(store, runner, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/databases/restores", body(nil)))
+		if resp.Code != http.StatusConflict {
+			t.Errorf("expected 409, got %d", resp.Code)
+		}
+	})
+
+	t.Run("requires admin", func(t *testing.T) {
+		member := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, CurrentOrgRole: "member"}
+		r := setupDatabaseRestoreTestRouter(newStore(), &mockDatabaseRestoreRunner{}, member)
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/databases/restores", body(nil)))
+		if resp.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", resp.Code)
+		}
+	})
+}
+
+func TestDatabaseGetRestore(t *testing.T) {
+	orgID := uuid.New()
+	restore := models.NewDatabaseRestore(orgID, uuid.New(), uuid.New(), "abcd1234")
+	foreign := models.NewDatabaseRestore(uuid.New(), uuid.New(), uuid.New(), "ffff0000")
+	store := &mockDatabaseRestoreStore{restores: map[uuid.UUID]*models.DatabaseRestore{restore.ID: restore, foreign.ID: foreign}}
+	r := setupDatabaseRestoreTestRouter(store, &mockDatabaseRestoreRunner{}, adminUser(orgID))
+
+	resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/databases/restores/"+restore.ID.String()))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.Code)
+	}
+	resp = DoRequest(r, AuthenticatedRequest("GET", "/api/v1/databases/restores/"+foreign.ID.String()))
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another org's restore, got %d", resp.Code)
+	}
+
+	resp = DoRequest(r, AuthenticatedRequest("GET", "/api/v1/databases/restores"))
+	var list struct {
+		Restores []models.DatabaseRestore `json:"restores"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Restores) != 1 || list.Restores[0].ID != restore.ID {
+		t.Errorf("restores = %+v", list.Restores)
+	}
+}
@@ -76,6 +76,12 @@ func (h *DockerBackupHandler) RegisterRoutes(r *gin.RouterGroup) {
 	}
 }
 
+// RegisterAgentRoutes registers the agent-facing Docker routes.
+// This group should have APIKeyMiddleware applied.
+func (h *DockerBackupHandler) RegisterAgentRoutes(r *gin.RouterGroup) {
+	r.POST("/docker/containers", h.ReportAgentContainers)
+}
+
 // ListContainers returns Docker containers for a given agent.
 //
 //	@Summary		List Docker containers
@@ -287,6 +293,11 @@ type ContainerDiscoveryRequest struct {
 	Containers []ContainerInfoRequest `json:"containers" binding:"required"`
 }
 
+// AgentContainerReportRequest is the request body for an agent's container report.
+type AgentContainerReportRequest struct {
+	Containers []ContainerInfoRequest `json:"containers" binding:"required,dive"`
+}
+
 // ContainerInfoRequest represents container info in a discovery request.
 type ContainerInfoRequest struct {
 	ID     string             `json:"id" binding:"required"`
@@ -300,6 +311,7 @@ type ContainerInfoRequest struct {
 // MountInfoRequest represents mount info in a discovery request.
 type MountInfoRequest struct {
 	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
 	Source      string `json:"source"`
 	Destination string `json:"destination"`
 	ReadOnly    bool   `json:"read_only"`
@@ -699,13 +711,70 @@ func (h *DockerBackupHandler) DiscoverContainers(c *gin.Context) {
 		return
 	}
 
-	// Convert request containers to docker.ContainerInfo
-	containers := make([]docker.ContainerInfo, len(req.Containers))
-	for i, rc := range req.Containers {
+	// Run discovery
+	result, err := h.discovery.DiscoverContainers(c.Request.Context(), req.AgentID, toContainerInfos(req.Containers))
+	if err != nil {
+		h.logger.Error().Err(err).Str("agent_id", req.AgentID.String()).Msg("failed to discover containers")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to discover containers"})
+		return
+	}
+
+	h.logger.Info().
+		Str("agent_id", req.AgentID.String()).
+		Int("total_discovered", result.TotalDiscovered).
+		Int("new_containers", result.NewContainers).
+		Msg("container discovery completed")
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ReportAgentContainers processes a container report from the authenticated agent.
+// Agents send it whenever the Docker events stream shows a labelled container
+// being created, changed or removed.
+//
+//	@Summary		Report agent containers
+//	@Description	Syncs backup configurations from the containers and labels reported by the calling agent
+//	@Tags			Docker Backup
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		AgentContainerReportRequest	true	"Containers on the agent host"
+//	@Success		200		{object}	models.DockerDiscoveryResult
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		BearerAuth
+//	@Router			/agent/docker/containers [post]
+func (h *DockerBackupHandler) ReportAgentContainers(c *gin.Context) {
+	agent := middleware.RequireAgent(c)
+	if agent == nil {
+		return
+	}
+
+	var req AgentContainerReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	result, err := h.discovery.DiscoverContainers(c.Request.Context(), agent.ID, toContainerInfos(req.Containers))
+	if err != nil {
+		h.logger.Error().Err(err).Str("agent_id", agent.ID.String()).Msg("failed to sync reported containers")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sync containers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// toContainerInfos converts reported containers for the discovery service.
+func toContainerInfos(reqs []ContainerInfoRequest) []docker.ContainerInfo {
+	containers := make([]docker.ContainerInfo, len(reqs))
+	for i, rc := range reqs {
 		mounts := make([]docker.MountInfo, len(rc.Mounts))
 		for j, rm := range rc.Mounts {
 			mounts[j] = docker.MountInfo{
 				Type:        rm.Type,
+				Name:        rm.Name,
 				Source:      rm.Source,
 				Destination: rm.Destination,
 				ReadOnly:    rm.ReadOnly,
@@ -720,22 +789,7 @@ func (h *DockerBackupHandler) DiscoverContainers(c *gin.Context) {
 			Status: rc.Status,
 		}
 	}
-
-	// Run discovery
-	result, err := h.discovery.DiscoverContainers(c.Request.Context(), req.AgentID, containers)
-	if err != nil {
-		h.logger.Error().Err(err).Str("agent_id", req.AgentID.String()).Msg("failed to discover containers")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to discover containers"})
-		return
-	}
-
-	h.logger.Info().
-		Str("agent_id", req.AgentID.String()).
-		Int("total_discovered", result.TotalDiscovered).
-		Int("new_containers", result.NewContainers).
-		Msg("container discovery completed")
-
-	c.JSON(http.StatusOK, result)
+	return containers
 }
 
 // RefreshContainer refreshes a single container's configuration.
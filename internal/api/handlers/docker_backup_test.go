@@ -11,6 +11,7 @@ import (
 
 	"github.com/MacJediWizard/keldris/internal/api/middleware"
 	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/backup/docker"
 	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -424,3 +425,105 @@ func TestTriggerDockerBackup(t *testing.T) {
 		}
 	})
 }
+
+type mockDiscoveryStore struct {
+	configs []*models.DockerContainerConfig
+	updated []*models.DockerContainerConfig
+}
+
+func (m *mockDiscoveryStore) GetDockerContainersByAgentID(_ context.Context, agentID uuid.UUID) ([]*models.DockerContainerConfig, error) {
+	var out []*models.DockerContainerConfig
+	for _, c := range m.configs {
+		if c.AgentID == agentID {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockDiscoveryStore) GetDockerContainerByID(_ context.Context, _ uuid.UUID) (*models.DockerContainerConfig, error) {
+	return nil, errors.New("not found")
+}
+
+func (m *mockDiscoveryStore) GetDockerContainerByContainerID(_ context.Context, _ uuid.UUID, _ string) (*models.DockerContainerConfig, error) {
+	return nil, errors.New("not found")
+}
+
+func (m *mockDiscoveryStore) CreateDockerContainer(_ context.Context, config *models.DockerContainerConfig) error {
+	m.configs = append(m.configs, config)
+	return nil
+}
+
+func (m *mockDiscoveryStore) UpdateDockerContainer(_ context.Context, config *models.DockerContainerConfig) error {
+	m.updated = append(m.updated, config)
+	return nil
+}
+
+func (m *mockDiscoveryStore) DeleteDockerContainer(_ context.Context, _ uuid.UUID) error {
+	return nil
+}
+
+func (m *mockDiscoveryStore) GetAgentByID(_ context.Context, _ uuid.UUID) (*models.Agent, error) {
+	return nil, errors.New("not found")
+}
+
+func TestReportAgentContainers(t *testing.T) {
+	agent := &models.Agent{ID: uuid.New(), OrgID: uuid.New(), Hostname: "docker-host"}
+	existing := models.NewDockerContainerConfig(agent.ID, "old-db", "db", "postgres:15")
+	existing.Enabled = true
+	removedLabels := models.NewDockerContainerConfig(agent.ID, "cache1", "cache", "redis:7")
+	removedLabels.Enabled = true
+	store := &mockDiscoveryStore{configs: []*models.DockerContainerConfig{existing, removedLabels}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(InjectAgent(agent))
+	discovery := docker.NewDiscoveryService(store, docker.DefaultDiscoveryConfig(), zerolog.Nop())
+	handler := NewDockerBackupHandler(nil, discovery, nil, zerolog.Nop())
+	handler.RegisterAgentRoutes(r.Group("/api/v1/agent"))
+
+	body := `{"containers":[
+		{"id":"new-db","name":"db","image":"postgres:16","labels":{"keldris.backup":"true","keldris.backup.schedule":"hourly"},
+		 "mounts":[{"type":"volume","name":"pgdata","source":"/var/lib/docker/volumes/pgdata/_data","destination":"/var/lib/postgresql/data"}]},
+		{"id":"cache1","name":"cache","image":"redis:7","labels":{"keldris.backup":"false"}},
+		{"id":"web1","name":"web","image":"nginx","labels":{"keldris.backup":"true"}}
+	]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/agent/docker/containers", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result models.DockerDiscoveryResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if result.TotalDiscovered != 2 || result.NewContainers != 1 {
+		t.Errorf("result = %+v", result)
+	}
+
+	// The recreated container keeps its config under the new ID
+	if existing.ContainerID != "new-db" || existing.Schedule != models.DockerBackupScheduleHourly || existing.ImageName != "postgres:16" {
+		t.Errorf("recreated config = %+v", existing)
+	}
+	// Disabling the label stops label-driven backups
+	if removedLabels.Enabled {
+		t.Error("expected config to be disabled after its backup label was turned off")
+	}
+	if len(store.configs) != 3 || store.configs[2].ContainerID != "web1" {
+		t.Errorf("configs = %v", store.configs)
+	}
+
+	t.Run("requires agent", func(t *testing.T) {
+		r := gin.New()
+		handler.RegisterAgentRoutes(r.Group("/api/v1/agent"))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/agent/docker/containers", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", w.Code)
+		}
+	})
+}
@@ -46,6 +46,7 @@ func (h *DockerRestoreHandler) RegisterRoutes(r *gin.RouterGroup) {
 		dockerRestores.GET("", h.ListDockerRestores)
 		dockerRestores.POST("", h.CreateDockerRestore)
 		dockerRestores.POST("/preview", h.PreviewDockerRestore)
+		dockerRestores.POST("/database", h.RestoreDockerDatabase)
 		dockerRestores.GET("/snapshot/:snapshot_id/containers", h.ListContainersInSnapshot)
 		dockerRestores.GET("/snapshot/:snapshot_id/volumes", h.ListVolumesInSnapshot)
 		dockerRestores.GET("/:id", h.GetDockerRestore)
@@ -87,6 +88,16 @@ type DockerRestorePreviewRequest struct {
 	Target        *DockerRestoreTargetRequest `json:"target,omitempty"`
 }
 
+// DockerDatabaseRestoreRequest is the request body for restoring a database
+// dump into a running container.
+type DockerDatabaseRestoreRequest struct {
+	SnapshotID   string `json:"snapshot_id" binding:"required"`
+	AgentID      string `json:"agent_id" binding:"required"`
+	RepositoryID string `json:"repository_id" binding:"required"`
+	Container    string `json:"container" binding:"required"` // Container name or ID
+	Filename     string `json:"filename,omitempty"`           // Dump file in the snapshot, defaults to the container's
+}
+
 // DockerRestoreProgressResponse represents Docker restore progress in API responses.
 type DockerRestoreProgressResponse struct {
 	Status          string  `json:"status"`
@@ -433,6 +444,86 @@ func (h *DockerRestoreHandler) PreviewDockerRestore(c *gin.Context) {
 	})
 }
 
+// RestoreDockerDatabase streams a database dump from a snapshot into a
+// running database container on the agent.
+//
+//	@Summary		Restore database container
+//	@Description	Streams a database dump from a snapshot into a running database container. The dump replaces the container's databases.
+//	@Tags			Docker Restores
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		DockerDatabaseRestoreRequest	true	"Database restore request"
+//	@Success		202		{object}	map[string]string
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/docker-restores/database [post]
+func (h *DockerRestoreHandler) RestoreDockerDatabase(c *gin.Context) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return
+	}
+
+	var req DockerDatabaseRestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	agentID, err := uuid.Parse(req.AgentID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid agent_id"})
+		return
+	}
+	repositoryID, err := uuid.Parse(req.RepositoryID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid repository_id"})
+		return
+	}
+
+	agent, err := h.store.GetAgentByID(c.Request.Context(), agentID)
+	if err != nil || agent.OrgID != user.CurrentOrgID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	repo, err := h.store.GetRepositoryByID(c.Request.Context(), repositoryID)
+	if err != nil || repo.OrgID != user.CurrentOrgID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "repository not found"})
+		return
+	}
+
+	payload := &models.CommandPayload{
+		SnapshotID:   req.SnapshotID,
+		RepositoryID: req.RepositoryID,
+		Container:    req.Container,
+		FilePath:     req.Filename,
+	}
+	cmd := models.NewAgentCommand(agentID, user.CurrentOrgID, models.CommandTypeDockerDatabaseRestore, payload, &user.ID)
+	cmd.CreatedByName = user.Name
+	cmd.TimeoutAt = time.Now().Add(2 * time.Hour)
+
+	if err := h.store.CreateAgentCommand(c.Request.Context(), cmd); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create database restore command")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to initiate database restore"})
+		return
+	}
+
+	h.logger.Info().
+		Str("command_id", cmd.ID.String()).
+		Str("snapshot_id", req.SnapshotID).
+		Str("agent_id", req.AgentID).
+		Str("container", req.Container).
+		Msg("database container restore requested")
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"command_id": cmd.ID.String(),
+		"status":     "pending",
+		"message":    "Database restore initiated. Poll the command status for results.",
+	})
+}
+
 // ListContainersInSnapshot lists all containers available in a snapshot.
 //
 //	@Summary		List containers in snapshot
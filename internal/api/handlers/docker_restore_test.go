@@ -28,6 +28,7 @@ type mockDockerRestoreStore struct {
 	createErr       error
 	updateErr       error
 	createCmdErr    error
+	createdCmd      *models.AgentCommand
 }
 
 func (m *mockDockerRestoreStore) GetAgentByID(_ context.Context, _ uuid.UUID) (*models.Agent, error) {
@@ -80,7 +81,8 @@ func (m *mockDockerRestoreStore) GetDockerRestoresByAgentID(_ context.Context, _
 	return m.restoresByAgent, nil
 }
 
-func (m *mockDockerRestoreStore) CreateAgentCommand(_ context.Context, _ *models.AgentCommand) error {
+func (m *mockDockerRestoreStore) CreateAgentCommand(_ context.Context, cmd *models.AgentCommand) error {
+	m.createdCmd = cmd
 	return m.createCmdErr
 }
 
@@ -164,6 +166,54 @@ func TestDockerRestoreCreate(t *testing.T) {
 	})
 }
 
+func TestDockerRestoreDatabase(t *testing.T) {
+	orgID := uuid.New()
+	user := testUser(orgID)
+	agentID := uuid.New()
+	repoID := uuid.New()
+	body := `{"snapshot_id":"snap1","agent_id":"` + agentID.String() + `","repository_id":"` + repoID.String() + `","container":"shop-db"}`
+
+	t.Run("queues restore command", func(t *testing.T) {
+		store := &mockDockerRestoreStore{
+			agent: &models.Agent{ID: agentID, OrgID: orgID},
+			repo:  &models.Repository{ID: repoID, OrgID: orgID},
+		}
+		r := setupDockerRestoreTestRouter(store, user)
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/docker-restores/database", body))
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+		}
+		cmd := store.createdCmd
+		if cmd == nil || cmd.Type != models.CommandTypeDockerDatabaseRestore {
+			t.Fatalf("expected docker_database_restore command, got %+v", cmd)
+		}
+		if cmd.Payload.Container != "shop-db" || cmd.Payload.SnapshotID != "snap1" || cmd.Payload.RepositoryID != repoID.String() {
+			t.Errorf("unexpected payload %+v", cmd.Payload)
+		}
+	})
+
+	t.Run("repository in another org returns 404", func(t *testing.T) {
+		store := &mockDockerRestoreStore{
+			agent: &models.Agent{ID: agentID, OrgID: orgID},
+			repo:  &models.Repository{ID: repoID, OrgID: uuid.New()},
+		}
+		r := setupDockerRestoreTestRouter(store, user)
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/docker-restores/database", body))
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", resp.Code)
+		}
+	})
+
+	t.Run("missing container returns 400", func(t *testing.T) {
+		store := &mockDockerRestoreStore{}
+		r := setupDockerRestoreTestRouter(store, user)
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/docker-restores/database", `{"snapshot_id":"snap1","agent_id":"`+agentID.String()+`","repository_id":"`+repoID.String()+`"}`))
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", resp.Code)
+		}
+	})
+}
+
 func TestDockerRestoreGet(t *testing.T) {
 	orgID := uuid.New()
 	user := testUser(orgID)
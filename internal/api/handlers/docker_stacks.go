@@ -2,7 +2,13 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/MacJediWizard/keldris/internal/api/middleware"
 	"github.com/MacJediWizard/keldris/internal/models"
@@ -642,7 +648,7 @@ func (h *DockerStacksHandler) DeleteBackup(c *gin.Context) {
 // RestoreBackup restores a docker stack from a backup.
 //
 //	@Summary		Restore Docker stack
-//	@Description	Restores a Docker Compose stack from a backup
+//	@Description	Restores a Docker Compose stack from a backup, optionally onto another agent with remapped project, volume, network, subnet, port and path names. With dry_run the agent only reports the restore plan and any conflicts.
 //	@Tags			Docker Stack Backups
 //	@Accept			json
 //	@Produce		json
@@ -706,6 +712,11 @@ func (h *DockerStacksHandler) RestoreBackup(c *gin.Context) {
 		return
 	}
 
+	if err := validateStackRestoreMappings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Verify target agent belongs to user's org
 	targetAgent, err := h.store.GetAgentByID(c.Request.Context(), targetAgentID)
 	if err != nil || targetAgent.OrgID != user.CurrentOrgID {
@@ -734,6 +745,60 @@ func (h *DockerStacksHandler) RestoreBackup(c *gin.Context) {
 	c.JSON(http.StatusAccepted, restore)
 }
 
+// validateStackRestoreMappings checks the remapping options of a stack
+// restore. Conflicts with resources on the target host are only known to
+// its agent and are reported in the restore plan.
+func validateStackRestoreMappings(req models.RestoreDockerStackRequest) error {
+	if req.ProjectName != "" && !stackProjectNamePattern.MatchString(req.ProjectName) {
+		return fmt.Errorf("invalid project_name %q", req.ProjectName)
+	}
+	for from, to := range req.SubnetMappings {
+		if _, _, err := net.ParseCIDR(from); err != nil {
+			return fmt.Errorf("invalid subnet %q in subnet_mappings", from)
+		}
+		if _, _, err := net.ParseCIDR(to); err != nil {
+			return fmt.Errorf("invalid subnet %q in subnet_mappings", to)
+		}
+	}
+	for from, to := range req.PortMappings {
+		port, proto, hasProto := strings.Cut(from, "/")
+		if hasProto && proto != "tcp" && proto != "udp" && proto != "sctp" {
+			return fmt.Errorf("invalid protocol %q in port_mappings", proto)
+		}
+		if !validPortSpec(port) {
+			return fmt.Errorf("invalid port %q in port_mappings", from)
+		}
+		if !validPortSpec(to) {
+			return fmt.Errorf("invalid port %q in port_mappings", to)
+		}
+	}
+	for _, mappings := range []map[string]string{req.VolumeMappings, req.NetworkMappings, req.PathMappings} {
+		for from, to := range mappings {
+			if from == "" || to == "" {
+				return errors.New("mappings must not contain empty names")
+			}
+		}
+	}
+	return nil
+}
+
+// stackProjectNamePattern matches the project names docker compose accepts.
+var stackProjectNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// validPortSpec reports whether spec is a port or a port range such as "8000-8010".
+func validPortSpec(spec string) bool {
+	from, to, isRange := strings.Cut(spec, "-")
+	first, err := strconv.Atoi(from)
+	if err != nil || first < 1 || first > 65535 {
+		return false
+	}
+	if !isRange {
+		return true
+	}
+	last, err := strconv.Atoi(to)
+	return err == nil && last >= first && last <= 65535
+}
+
 // GetRestore returns a specific docker stack restore by ID.
 //
 //	@Summary		Get Docker stack restore
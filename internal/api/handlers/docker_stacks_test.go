@@ -244,3 +244,72 @@ func TestDockerStacksDelete(t *testing.T) {
 		}
 	})
 }
+
+type mockDockerStackBackupService struct {
+	restoreReq *models.RestoreDockerStackRequest
+}
+
+func (m *mockDockerStackBackupService) TriggerBackup(_ context.Context, _ *models.DockerStack) (*models.DockerStackBackup, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockDockerStackBackupService) RestoreStack(_ context.Context, backup *models.DockerStackBackup, req models.RestoreDockerStackRequest) (*models.DockerStackRestore, error) {
+	m.restoreReq = &req
+	return models.NewDockerStackRestore(backup.OrgID, backup.ID, uuid.MustParse(req.TargetAgentID), req.TargetPath), nil
+}
+
+func (m *mockDockerStackBackupService) DiscoverStacks(_ context.Context, _ uuid.UUID, _ []string) ([]models.DiscoveredDockerStack, error) {
+	return nil, nil
+}
+
+func TestDockerStacksRestoreBackup(t *testing.T) {
+	orgID := uuid.New()
+	user := testUser(orgID)
+	backupID := uuid.New()
+	agentID := uuid.New()
+	url := "/api/v1/docker-stack-backups/" + backupID.String() + "/restore"
+	newStore := func() *mockDockerStackStore {
+		return &mockDockerStackStore{
+			backup: &models.DockerStackBackup{ID: backupID, OrgID: orgID},
+			agent:  &models.Agent{ID: agentID, OrgID: orgID},
+		}
+	}
+
+	t.Run("passes remappings to the agent", func(t *testing.T) {
+		svc := &mockDockerStackBackupService{}
+		r := setupDockerStacksTestRouter(newStore(), svc, user)
+		body := `{"target_agent_id":"` + agentID.String() + `","target_path":"/srv/shop-dr","project_name":"shop-dr",
+			"volume_mappings":{"shop_db":"shop_dr_db"},"subnet_mappings":{"172.28.0.0/16":"10.30.0.0/16"},
+			"port_mappings":{"8080":"18080","53/udp":"5353"},"dry_run":true}`
+		resp := DoRequest(r, JSONRequest("POST", url, body))
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+		}
+		req := svc.restoreReq
+		if req == nil || !req.DryRun || req.ProjectName != "shop-dr" || req.PortMappings["53/udp"] != "5353" || req.VolumeMappings["shop_db"] != "shop_dr_db" {
+			t.Errorf("service got %+v", req)
+		}
+	})
+
+	invalid := map[string]string{
+		"project name": `"project_name":"Shop DR"`,
+		"subnet":       `"subnet_mappings":{"172.28.0.0/16":"10.30.0.0"}`,
+		"port":         `"port_mappings":{"8080":"70000"}`,
+		"protocol":     `"port_mappings":{"8080/icmp":"8081"}`,
+		"empty name":   `"volume_mappings":{"shop_db":""}`,
+	}
+	for name, field := range invalid {
+		t.Run("invalid "+name+" returns 400", func(t *testing.T) {
+			svc := &mockDockerStackBackupService{}
+			r := setupDockerStacksTestRouter(newStore(), svc, user)
+			body := `{"target_agent_id":"` + agentID.String() + `","target_path":"/srv/shop-dr",` + field + `}`
+			resp := DoRequest(r, JSONRequest("POST", url, body))
+			if resp.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+			}
+			if svc.restoreReq != nil {
+				t.Error("restore started despite invalid mappings")
+			}
+		})
+	}
+}
@@ -176,6 +176,10 @@ func (h *GeoReplicationHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "target repository not found"})
 		return
 	}
+	if targetRepo.ReadOnly {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target repository is read-only"})
+		return
+	}
 
 	config := models.NewGeoReplicationConfig(
 		user.CurrentOrgID,
@@ -299,6 +303,10 @@ func (h *GeoReplicationHandler) Update(c *gin.Context) {
 		return
 	}
 
+	if req.Enabled != nil && *req.Enabled && !config.Enabled && h.targetReadOnly(c, config) {
+		return
+	}
+
 	// Apply updates
 	if req.Enabled != nil {
 		config.SetEnabled(*req.Enabled)
@@ -414,6 +422,9 @@ func (h *GeoReplicationHandler) TriggerReplication(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "replication is disabled for this config"})
 		return
 	}
+	if h.targetReadOnly(c, config) {
+		return
+	}
 
 	// Mark as pending to be picked up by the replication processor
 	config.Status = string(models.GeoReplicationStatusPending)
@@ -645,6 +656,21 @@ func (h *GeoReplicationHandler) GetSummary(c *gin.Context) {
 }
 
 // toResponse converts a GeoReplicationConfig to a GeoReplicationResponse.
+// targetReadOnly responds with 400 and returns true if the config replicates
+// into a read-only repository, such as the source of a completed migration.
+func (h *GeoReplicationHandler) targetReadOnly(c *gin.Context, config *models.GeoReplicationConfig) bool {
+	target, err := h.store.GetRepositoryByID(c.Request.Context(), config.TargetRepositoryID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target repository not found"})
+		return true
+	}
+	if target.ReadOnly {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target repository is read-only"})
+		return true
+	}
+	return false
+}
+
 func (h *GeoReplicationHandler) toResponse(ctx context.Context, cfg *models.GeoReplicationConfig) models.GeoReplicationResponse {
 	sourceRegion, _ := backup.GetRegionByCode(cfg.SourceRegion)
 	targetRegion, _ := backup.GetRegionByCode(cfg.TargetRegion)
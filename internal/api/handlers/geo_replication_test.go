@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -155,6 +156,18 @@ func TestGeoReplicationCreate(t *testing.T) {
 		}
 	})
 
+	t.Run("read-only target returns 400", func(t *testing.T) {
+		repo := models.NewRepository(orgID, "migrated", models.RepositoryTypeS3, nil)
+		repo.ReadOnly = true
+		store := &mockGeoReplicationStore{repo: repo}
+		r := setupGeoReplicationTestRouter(store, user, nil)
+		body := `{"source_repository_id":"` + uuid.New().String() + `","target_repository_id":"` + repo.ID.String() + `","source_region":"us-east-1","target_region":"eu-west-1"}`
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/geo-replication/configs", body))
+		if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "read-only") {
+			t.Fatalf("expected 400 for a read-only target, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+
 	t.Run("feature flag blocks free tier", func(t *testing.T) {
 		store := &mockGeoReplicationStore{}
 		// Real FeatureChecker with TierFree blocks FeatureGeoReplication (Enterprise).
@@ -205,6 +218,20 @@ func TestGeoReplicationGet(t *testing.T) {
 	})
 }
 
+func TestGeoReplicationTriggerReadOnlyTarget(t *testing.T) {
+	orgID := uuid.New()
+	repo := models.NewRepository(orgID, "migrated", models.RepositoryTypeS3, nil)
+	repo.ReadOnly = true
+	cfg := models.NewGeoReplicationConfig(orgID, uuid.New(), repo.ID, "us-east-1", "eu-west-1")
+	store := &mockGeoReplicationStore{config: cfg, repo: repo}
+	r := setupGeoReplicationTestRouter(store, testUser(orgID), nil)
+
+	resp := DoRequest(r, AuthenticatedRequest("POST", "/api/v1/geo-replication/configs/"+cfg.ID.String()+"/trigger"))
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "read-only") {
+		t.Fatalf("expected 400 for a read-only target, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
 func TestGeoReplicationDelete(t *testing.T) {
 	orgID := uuid.New()
 	user := testUser(orgID)
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// isAdmin checks if the user has admin or owner role.
+func isAdmin(role string) bool {
+	return role == string(models.OrgRoleAdmin) || role == string(models.OrgRoleOwner)
+}
+
+// requireOrgAdmin returns the user and organization IDs if the session user
+// is an org admin, writing an error response otherwise.
+func requireOrgAdmin(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+	if user.CurrentOrgID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no organization selected"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	if !isAdmin(user.CurrentOrgRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return user.ID, user.CurrentOrgID, true
+}
+
+// requireOrgPermission parses the organization ID from the route and returns
+// the session user if they hold perm in that organization, writing an error
+// response otherwise.
+func requireOrgPermission(c *gin.Context, rbac *auth.RBAC, perm auth.Permission) (*auth.SessionUser, uuid.UUID, bool) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return nil, uuid.Nil, false
+	}
+
+	orgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization ID"})
+		return nil, uuid.Nil, false
+	}
+
+	if err := rbac.RequirePermission(c.Request.Context(), user.ID, orgID, perm); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return nil, uuid.Nil, false
+	}
+
+	return user, orgID, true
+}
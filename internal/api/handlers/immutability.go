@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/MacJediWizard/keldris/internal/api/middleware"
 	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
 	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -34,9 +37,10 @@ type ImmutabilityStore interface {
 
 // ImmutabilityHandler handles immutability-related HTTP endpoints.
 type ImmutabilityHandler struct {
-	store   ImmutabilityStore
-	manager *backup.ImmutabilityManager
-	logger  zerolog.Logger
+	store     ImmutabilityStore
+	manager   *backup.ImmutabilityManager
+	approvals ApprovalGate
+	logger    zerolog.Logger
 }
 
 // NewImmutabilityHandler creates a new ImmutabilityHandler.
@@ -49,6 +53,17 @@ func NewImmutabilityHandler(store ImmutabilityStore, logger zerolog.Logger) *Imm
 	}
 }
 
+// SetObjectLockers enables S3 Object Lock enforcement of snapshot locks.
+func (h *ImmutabilityHandler) SetObjectLockers(resolve backup.ObjectLockerResolver) {
+	h.manager.SetObjectLockers(resolve)
+}
+
+// SetApprovalGate enables four-eyes approval for disabling or shortening repository immutability.
+func (h *ImmutabilityHandler) SetApprovalGate(gate ApprovalGate) {
+	h.approvals = gate
+	gate.Register(models.ApprovalActionImmutabilityReduce, h.executeApprovedSettings)
+}
+
 // RegisterRoutes registers immutability routes on the given router group.
 func (h *ImmutabilityHandler) RegisterRoutes(r *gin.RouterGroup) {
 	immutability := r.Group("/immutability")
@@ -86,6 +101,8 @@ type ImmutabilityLockResponse struct {
 	Reason              string  `json:"reason,omitempty"`
 	RemainingDays       int     `json:"remaining_days"`
 	S3ObjectLockEnabled bool    `json:"s3_object_lock_enabled"`
+	S3ObjectLockStatus  string  `json:"s3_object_lock_status,omitempty"`
+	S3ObjectLockError   string  `json:"s3_object_lock_error,omitempty"`
 	CreatedAt           string  `json:"created_at"`
 }
 
@@ -100,6 +117,8 @@ func toImmutabilityLockResponse(lock *models.SnapshotImmutability) ImmutabilityL
 		Reason:              lock.Reason,
 		RemainingDays:       lock.RemainingDays(),
 		S3ObjectLockEnabled: lock.S3ObjectLockEnabled,
+		S3ObjectLockStatus:  string(lock.S3ObjectLockStatus),
+		S3ObjectLockError:   lock.S3ObjectLockError,
 		CreatedAt:           lock.CreatedAt.Format(time.RFC3339),
 	}
 	if lock.LockedBy != nil {
@@ -116,6 +135,8 @@ type CreateLockRequest struct {
 	Days         int    `json:"days" binding:"required,min=1,max=36500"`
 	Reason       string `json:"reason" binding:"max=500"`
 	EnableS3Lock bool   `json:"enable_s3_lock"`
+	// S3LockMode is the Object Lock retention mode; defaults to GOVERNANCE.
+	S3LockMode string `json:"s3_lock_mode" binding:"omitempty,oneof=GOVERNANCE COMPLIANCE"`
 }
 
 // ExtendLockRequest is the request body for extending an immutability lock.
@@ -133,7 +154,7 @@ type ImmutabilitySettingsRequest struct {
 // CreateLock creates a new immutability lock on a snapshot.
 //
 //	@Summary		Create immutability lock
-//	@Description	Creates an immutability lock on a snapshot to prevent deletion for a specified period
+//	@Description	Creates an immutability lock on a snapshot to prevent deletion for a specified period. With enable_s3_lock the bucket is checked before the lock is created and S3 Object Lock retention is then applied to the snapshot's objects in the background; s3_object_lock_status reports pending, applied or failed.
 //	@Tags			Immutability
 //	@Accept			json
 //	@Produce		json
@@ -196,18 +217,41 @@ func (h *ImmutabilityHandler) CreateLock(c *gin.Context) {
 		shortID = shortID[:8]
 	}
 
-	lock, err := h.manager.LockSnapshot(
-		c.Request.Context(),
-		user.CurrentOrgID,
-		repoID,
-		req.SnapshotID,
-		shortID,
-		req.Days,
-		&dbUser.ID,
-		req.Reason,
-	)
+	var lock *models.SnapshotImmutability
+	if req.EnableS3Lock {
+		mode := models.S3ObjectLockModeGovernance
+		if req.S3LockMode != "" {
+			mode = models.S3ObjectLockMode(req.S3LockMode)
+		}
+		lock, err = h.manager.LockSnapshotWithObjectLock(
+			c.Request.Context(),
+			user.CurrentOrgID,
+			repoID,
+			req.SnapshotID,
+			shortID,
+			req.Days,
+			&dbUser.ID,
+			req.Reason,
+			mode,
+		)
+	} else {
+		lock, err = h.manager.LockSnapshot(
+			c.Request.Context(),
+			user.CurrentOrgID,
+			repoID,
+			req.SnapshotID,
+			shortID,
+			req.Days,
+			&dbUser.ID,
+			req.Reason,
+		)
+	}
 	if err != nil {
 		h.logger.Error().Err(err).Str("snapshot_id", req.SnapshotID).Msg("failed to create lock")
+		if errors.Is(err, backup.ErrObjectLockUnsupported) || errors.Is(err, backends.ErrObjectLockNotEnabled) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
@@ -268,7 +312,7 @@ func (h *ImmutabilityHandler) GetLock(c *gin.Context) {
 // ExtendLock extends an existing immutability lock.
 //
 //	@Summary		Extend immutability lock
-//	@Description	Extends an existing immutability lock by adding additional days
+//	@Description	Extends an existing immutability lock by adding additional days. S3 Object Lock retention is reapplied in the background, which also retries a failed lock; extending while retention is still pending returns 409.
 //	@Tags			Immutability
 //	@Accept			json
 //	@Produce		json
@@ -279,6 +323,7 @@ func (h *ImmutabilityHandler) GetLock(c *gin.Context) {
 //	@Failure		401		{object}	map[string]string
 //	@Failure		403		{object}	map[string]string
 //	@Failure		404		{object}	map[string]string
+//	@Failure		409		{object}	map[string]string
 //	@Failure		500		{object}	map[string]string
 //	@Security		SessionAuth
 //	@Router			/immutability/{id} [put]
@@ -333,6 +378,10 @@ func (h *ImmutabilityHandler) ExtendLock(c *gin.Context) {
 	)
 	if err != nil {
 		h.logger.Error().Err(err).Str("lock_id", id.String()).Msg("failed to extend lock")
+		if errors.Is(err, backup.ErrObjectLockPending) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -588,6 +637,24 @@ func (h *ImmutabilityHandler) UpdateRepositoryImmutabilitySettings(c *gin.Contex
 		DefaultDays: req.DefaultDays,
 	}
 
+	current, err := h.store.GetRepositoryImmutabilitySettings(c.Request.Context(), repoID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("repository_id", repoID.String()).Msg("failed to get settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get settings"})
+		return
+	}
+	if reducesImmutability(current, settings) {
+		approvalReq := models.NewApprovalRequest(user.CurrentOrgID, dbUser.ID, models.ApprovalActionImmutabilityReduce,
+			"repository", repoID.String(), "Reduce immutability for repository "+repo.Name)
+		if err := approvalReq.SetPayload(req); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update settings"})
+			return
+		}
+		if requestApproval(c, h.approvals, h.logger, approvalReq) {
+			return
+		}
+	}
+
 	if err := h.store.UpdateRepositoryImmutabilitySettings(c.Request.Context(), repoID, settings); err != nil {
 		h.logger.Error().Err(err).Str("repository_id", repoID.String()).Msg("failed to update settings")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update settings"})
@@ -603,6 +670,54 @@ func (h *ImmutabilityHandler) UpdateRepositoryImmutabilitySettings(c *gin.Contex
 	c.JSON(http.StatusOK, settings)
 }
 
+// executeApprovedSettings applies immutability settings once the reduction has been approved.
+func (h *ImmutabilityHandler) executeApprovedSettings(ctx context.Context, req *models.ApprovalRequest) error {
+	repoID, err := uuid.Parse(req.ResourceID)
+	if err != nil {
+		return fmt.Errorf("invalid repository ID: %w", err)
+	}
+
+	repo, err := h.store.GetRepository(ctx, repoID)
+	if err != nil || repo.OrgID != req.OrgID {
+		return errors.New("repository not found")
+	}
+
+	var settingsReq ImmutabilitySettingsRequest
+	if err := json.Unmarshal(req.Payload, &settingsReq); err != nil {
+		return fmt.Errorf("decode approved settings: %w", err)
+	}
+
+	settings := &models.RepositoryImmutabilitySettings{
+		Enabled:     settingsReq.Enabled,
+		DefaultDays: settingsReq.DefaultDays,
+	}
+	if err := h.store.UpdateRepositoryImmutabilitySettings(ctx, repoID, settings); err != nil {
+		return fmt.Errorf("update immutability settings: %w", err)
+	}
+
+	h.logger.Info().
+		Str("repository_id", repoID.String()).
+		Bool("enabled", settings.Enabled).
+		Str("approval_request_id", req.ID.String()).
+		Msg("immutability settings updated after approval")
+	return nil
+}
+
+// reducesImmutability reports whether next disables immutability or shortens
+// the default lock period compared to current.
+func reducesImmutability(current, next *models.RepositoryImmutabilitySettings) bool {
+	if current == nil || !current.Enabled {
+		return false
+	}
+	if !next.Enabled {
+		return true
+	}
+	if current.DefaultDays == nil {
+		return false
+	}
+	return next.DefaultDays == nil || *next.DefaultDays < *current.DefaultDays
+}
+
 // CheckDeleteAllowed is a helper to be used by other handlers before deleting a snapshot.
 func (h *ImmutabilityHandler) CheckDeleteAllowed(ctx context.Context, repositoryID uuid.UUID, snapshotID string) error {
 	return h.manager.CheckDeleteAllowed(ctx, repositoryID, snapshotID)
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/backup/kubernetes"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// KubernetesRestoreStore defines the persistence operations for Kubernetes restores.
+type KubernetesRestoreStore interface {
+	GetRepositoryByID(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	CreateKubernetesRestore(ctx context.Context, restore *models.KubernetesRestore) error
+	GetKubernetesRestoreByID(ctx context.Context, id uuid.UUID) (*models.KubernetesRestore, error)
+	GetKubernetesRestoresByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.KubernetesRestore, error)
+	UpdateKubernetesRestore(ctx context.Context, restore *models.KubernetesRestore) error
+	GetAgentByID(ctx context.Context, id uuid.UUID) (*models.Agent, error)
+	CreateAgentCommand(ctx context.Context, cmd *models.AgentCommand) error
+	GetAgentCommandByID(ctx context.Context, id uuid.UUID) (*models.AgentCommand, error)
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+}
+
+// KubernetesRestoreRunner starts Kubernetes namespace restores into another
+// cluster in the background.
+type KubernetesRestoreRunner interface {
+	StartRestore(ctx context.Context, restore *models.KubernetesRestore, target *kubernetes.Config) error
+}
+
+// KubernetesHandler handles Kubernetes restore HTTP endpoints.
+type KubernetesHandler struct {
+	store  KubernetesRestoreStore
+	runner KubernetesRestoreRunner
+	logger zerolog.Logger
+}
+
+// NewKubernetesHandler creates a new KubernetesHandler.
+func NewKubernetesHandler(store KubernetesRestoreStore, runner KubernetesRestoreRunner, logger zerolog.Logger) *KubernetesHandler {
+	return &KubernetesHandler{
+		store:  store,
+		runner: runner,
+		logger: logger.With().Str("component", "kubernetes_handler").Logger(),
+	}
+}
+
+// RegisterRoutes registers Kubernetes routes on the given router group.
+func (h *KubernetesHandler) RegisterRoutes(r *gin.RouterGroup) {
+	restores := r.Group("/kubernetes/restores")
+	{
+		restores.GET("", h.ListRestores)
+		restores.POST("", h.CreateRestore)
+		restores.GET("/:id", h.GetRestore)
+	}
+}
+
+// KubernetesTargetCluster is the API server of another cluster to restore into.
+// The credentials are used for the restore only and are never stored. The
+// server certificate is always verified, against CAData when it is set.
+type KubernetesTargetCluster struct {
+	Server string `json:"server" binding:"required" example:"https://k8s.example.com:6443"`
+	Token  string `json:"token" binding:"required"`
+	CAData string `json:"ca_data,omitempty"` // base64 PEM, as in a kubeconfig
+}
+
+// CreateKubernetesRestoreRequest is the request body for restoring namespaces.
+type CreateKubernetesRestoreRequest struct {
+	RepositoryID     uuid.UUID         `json:"repository_id" binding:"required"`
+	SnapshotID       string            `json:"snapshot_id" binding:"required"`
+	Namespaces       []string          `json:"namespaces,omitempty"`
+	NamespaceMapping map[string]string `json:"namespace_mapping,omitempty"`
+	NameMapping      map[string]string `json:"name_mapping,omitempty"`
+	Overwrite        bool              `json:"overwrite,omitempty"`
+	RestoreVolumes   bool              `json:"restore_volumes,omitempty"`
+	// AgentID is an agent running in the cluster to restore into. It applies
+	// the manifests with its own service account. Exactly one of AgentID and
+	// Target is required.
+	AgentID *uuid.UUID               `json:"agent_id,omitempty"`
+	Target  *KubernetesTargetCluster `json:"target,omitempty"`
+}
+
+func (t *KubernetesTargetCluster) config() (*kubernetes.Config, error) {
+	if !strings.HasPrefix(t.Server, "https://") {
+		return nil, errors.New("target server must be an https:// URL")
+	}
+	cfg := &kubernetes.Config{
+		Server: t.Server,
+		Token:  t.Token,
+	}
+	if t.CAData != "" {
+		ca, err := base64.StdEncoding.DecodeString(t.CAData)
+		if err != nil {
+			return nil, errors.New("target ca_data must be base64 encoded")
+		}
+		cfg.CAData = ca
+	}
+	return cfg, nil
+}
+
+// ListRestores returns the organization's Kubernetes restores.
+//
+//	@Summary		List Kubernetes restores
+//	@Description	Returns Kubernetes namespace restores for the current organization, newest first (admin only)
+//	@Tags			Kubernetes
+//	@Produce		json
+//	@Success		200	{object}	map[string][]models.KubernetesRestore
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/kubernetes/restores [get]
+func (h *KubernetesHandler) ListRestores(c *gin.Context) {
+	_, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	restores, err := h.store.GetKubernetesRestoresByOrgID(c.Request.Context(), orgID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("org_id", orgID.String()).Msg("failed to list kubernetes restores")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list kubernetes restores"})
+		return
+	}
+	for _, restore := range restores {
+		h.syncAgentRestore(c.Request.Context(), restore)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"restores": restores})
+}
+
+// GetRestore returns a Kubernetes restore and its result.
+//
+//	@Summary		Get Kubernetes restore
+//	@Description	Returns a Kubernetes namespace restore with the objects and volumes it restored (admin only)
+//	@Tags			Kubernetes
+//	@Produce		json
+//	@Param			id	path		string	true	"Restore ID"
+//	@Success		200	{object}	models.KubernetesRestore
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/kubernetes/restores/{id} [get]
+func (h *KubernetesHandler) GetRestore(c *gin.Context) {
+	_, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid restore ID"})
+		return
+	}
+
+	restore, err := h.store.GetKubernetesRestoreByID(c.Request.Context(), id)
+	if err != nil || restore.OrgID != orgID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "restore not found"})
+		return
+	}
+	h.syncAgentRestore(c.Request.Context(), restore)
+
+	c.JSON(http.StatusOK, restore)
+}
+
+// syncAgentRestore updates an agent-run restore from its agent command, which
+// the agent reports to.
+func (h *KubernetesHandler) syncAgentRestore(ctx context.Context, restore *models.KubernetesRestore) {
+	if restore.CommandID == nil || restore.IsTerminal() {
+		return
+	}
+	cmd, err := h.store.GetAgentCommandByID(ctx, *restore.CommandID)
+	if err != nil {
+		h.logger.Warn().Err(err).Str("restore_id", restore.ID.String()).Msg("failed to get kubernetes restore command")
+		return
+	}
+	if !restore.ApplyCommand(cmd) {
+		return
+	}
+	if err := h.store.UpdateKubernetesRestore(ctx, restore); err != nil {
+		h.logger.Error().Err(err).Str("restore_id", restore.ID.String()).Msg("failed to update kubernetes restore")
+	}
+}
+
+// CreateRestore restores namespaces from a Kubernetes backup snapshot.
+//
+//	@Summary		Restore Kubernetes namespaces
+//	@Description	Applies the manifests of a Kubernetes backup, optionally renaming namespaces and objects. With agent_id, the in-cluster agent restores into its own cluster and writes PVC data into claims mounted on its node. With target, the server restores into that cluster (admin only).
+//	@Tags			Kubernetes
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateKubernetesRestoreRequest	true	"Restore details"
+//	@Success		202		{object}	models.KubernetesRestore
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		409		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/kubernetes/restores [post]
+func (h *KubernetesHandler) CreateRestore(c *gin.Context) {
+	userID, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req CreateKubernetesRestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	repo, err := h.store.GetRepositoryByID(ctx, req.RepositoryID)
+	if err != nil || repo.OrgID != orgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repository not found"})
+		return
+	}
+
+	if (req.AgentID == nil) == (req.Target == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of agent_id and target is required"})
+		return
+	}
+	var target *kubernetes.Config
+	if req.Target != nil {
+		target, err = req.Target.config()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var agent *models.Agent
+	if req.AgentID != nil {
+		agent, err = h.store.GetAgentByID(ctx, *req.AgentID)
+		if err != nil || agent.OrgID != orgID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "agent not found"})
+			return
+		}
+	}
+
+	restore := models.NewKubernetesRestore(orgID, repo.ID, req.SnapshotID)
+	restore.Namespaces = req.Namespaces
+	restore.NamespaceMapping = req.NamespaceMapping
+	restore.NameMapping = req.NameMapping
+	restore.Overwrite = req.Overwrite
+	restore.RestoreVolumes = req.RestoreVolumes
+	restore.CreatedBy = &userID
+	if target != nil {
+		restore.TargetServer = target.Server
+	}
+	if err := restore.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if agent != nil {
+		h.createAgentRestore(c, restore, agent, userID)
+		return
+	}
+
+	if err := h.store.CreateKubernetesRestore(ctx, restore); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create kubernetes restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create kubernetes restore"})
+		return
+	}
+
+	h.auditRestore(c, restore, userID, restore.TargetServer)
+
+	// The runner updates the restore as it goes, so respond with a copy.
+	resp := *restore
+	if err := h.runner.StartRestore(context.Background(), restore, target); err != nil {
+		if errors.Is(err, backup.ErrKubernetesRestoreRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error().Err(err).Str("restore_id", restore.ID.String()).Msg("failed to start kubernetes restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start kubernetes restore"})
+		return
+	}
+
+	h.logger.Info().
+		Str("restore_id", restore.ID.String()).
+		Str("snapshot_id", restore.SnapshotID).
+		Str("target", restore.TargetServer).
+		Msg("kubernetes restore started")
+
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// createAgentRestore queues a restore into the cluster of an in-cluster
+// agent. The agent applies the manifests with its own service account.
+func (h *KubernetesHandler) createAgentRestore(c *gin.Context, restore *models.KubernetesRestore, agent *models.Agent, userID uuid.UUID) {
+	ctx := c.Request.Context()
+	payload := &models.CommandPayload{
+		SnapshotID:       restore.SnapshotID,
+		RepositoryID:     restore.RepositoryID.String(),
+		RestoreID:        restore.ID.String(),
+		Namespaces:       restore.Namespaces,
+		NamespaceMapping: restore.NamespaceMapping,
+		NameMapping:      restore.NameMapping,
+		Overwrite:        restore.Overwrite,
+		RestoreVolumes:   restore.RestoreVolumes,
+	}
+	cmd := models.NewAgentCommand(agent.ID, restore.OrgID, models.CommandTypeKubernetesRestore, payload, &userID)
+	cmd.TimeoutAt = time.Now().Add(2 * time.Hour)
+	if err := h.store.CreateAgentCommand(ctx, cmd); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create kubernetes restore command")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create kubernetes restore"})
+		return
+	}
+
+	restore.AgentID = &agent.ID
+	restore.CommandID = &cmd.ID
+	if err := h.store.CreateKubernetesRestore(ctx, restore); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create kubernetes restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create kubernetes restore"})
+		return
+	}
+
+	h.auditRestore(c, restore, userID, "cluster of agent "+agent.Hostname)
+
+	h.logger.Info().
+		Str("restore_id", restore.ID.String()).
+		Str("snapshot_id", restore.SnapshotID).
+		Str("agent_id", agent.ID.String()).
+		Str("command_id", cmd.ID.String()).
+		Msg("kubernetes restore queued on agent")
+
+	c.JSON(http.StatusAccepted, restore)
+}
+
+func (h *KubernetesHandler) auditRestore(c *gin.Context, restore *models.KubernetesRestore, userID uuid.UUID, destination string) {
+	auditLog := models.NewAuditLog(restore.OrgID, models.AuditActionRestore, "kubernetes_restore", models.AuditResultSuccess).
+		WithUser(userID).
+		WithResource(restore.ID).
+		WithRequestInfo(c.ClientIP(), c.Request.UserAgent()).
+		WithDetails(fmt.Sprintf("Kubernetes restore of snapshot %s into %s", restore.SnapshotID, destination))
+	if err := h.store.CreateAuditLog(c.Request.Context(), auditLog); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to create audit log")
+	}
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/backup/kubernetes"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockKubernetesRestoreStore struct {
+	repos     map[uuid.UUID]*models.Repository
+	restores  map[uuid.UUID]*models.KubernetesRestore
+	agents    map[uuid.UUID]*models.Agent
+	commands  map[uuid.UUID]*models.AgentCommand
+	updates   int
+	auditLogs []*models.AuditLog
+}
+
+func (m *mockKubernetesRestoreStore) GetRepositoryByID(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	repo, ok := m.repos[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return repo, nil
+}
+
+func (m *mockKubernetesRestoreStore) CreateKubernetesRestore(_ context.Context, restore *models.KubernetesRestore) error {
+	m.restores[restore.ID] = restore
+	return nil
+}
+
+func (m *mockKubernetesRestoreStore) GetKubernetesRestoreByID(_ context.Context, id uuid.UUID) (*models.KubernetesRestore, error) {
+	restore, ok := m.restores[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return restore, nil
+}
+
+func (m *mockKubernetesRestoreStore) GetKubernetesRestoresByOrgID(_ context.Context, orgID uuid.UUID) ([]*models.KubernetesRestore, error) {
+	var out []*models.KubernetesRestore
+	for _, restore := range m.restores {
+		if restore.OrgID == orgID {
+			out = append(out, restore)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockKubernetesRestoreStore) UpdateKubernetesRestore(_ context.Context, restore *models.KubernetesRestore) error {
+	m.restores[restore.ID] = restore
+	m.updates++
+	return nil
+}
+
+func (m *mockKubernetesRestoreStore) GetAgentByID(_ context.Context, id uuid.UUID) (*models.Agent, error) {
+	agent, ok := m.agents[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return agent, nil
+}
+
+func (m *mockKubernetesRestoreStore) CreateAgentCommand(_ context.Context, cmd *models.AgentCommand) error {
+	m.commands[cmd.ID] = cmd
+	return nil
+}
+
+func (m *mockKubernetesRestoreStore) GetAgentCommandByID(_ context.Context, id uuid.UUID) (*models.AgentCommand, error) {
+	cmd, ok := m.commands[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return cmd, nil
+}
+
+func (m *mockKubernetesRestoreStore) CreateAuditLog(_ context.Context, log *models.AuditLog) error {
+	m.auditLogs = append(m.auditLogs, log)
+	return nil
+}
+
+type mockKubernetesRestoreRunner struct {
+	started []*models.KubernetesRestore
+	targets []*kubernetes.Config
+	err     error
+}
+
+func (r *mockKubernetesRestoreRunner) StartRestore(_ context.Context, restore *models.KubernetesRestore, target *kubernetes.Config) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.started = append(r.started, restore)
+	r.targets = append(r.targets, target)
+	return nil
+}
+
+func setupKubernetesTestRouter(store *mockKubernetesRestoreStore, runner *mockKubernetesRestoreRunner, user *auth.SessionUser) *gin.Engine {
+	r := SetupTestRouter(user)
+	handler := NewKubernetesHandler(store, runner, zerolog.Nop())
+	handler.RegisterRoutes(r.Group("/api/v1"))
+	return r
+}
+
+func TestKubernetesCreateRestore(t *testing.T) {
+	orgID := uuid.New()
+	repo := models.NewRepository(orgID, "cluster", models.RepositoryTypeS3, nil)
+	otherOrg := models.NewRepository(uuid.New(), "foreign", models.RepositoryTypeS3, nil)
+	agent := models.NewAgent(orgID, "k8s-node-1", "hash")
+	foreignAgent := models.NewAgent(uuid.New(), "foreign-node", "hash")
+	newStore := func() *mockKubernetesRestoreStore {
+		return &mockKubernetesRestoreStore{
+			repos:    map[uuid.UUID]*models.Repository{repo.ID: repo, otherOrg.ID: otherOrg},
+			restores: make(map[uuid.UUID]*models.KubernetesRestore),
+			agents:   map[uuid.UUID]*models.Agent{agent.ID: agent, foreignAgent.ID: foreignAgent},
+			commands: make(map[uuid.UUID]*models.AgentCommand),
+		}
+	}
+	target := map[string]interface{}{"server": "https://dr.example.com:6443", "token": "dr-token"}
+	body := func(repoID uuid.UUID, extra map[string]interface{}) string {
+		req := map[string]interface{}{"repository_id": repoID.String(), "snapshot_id": "abcd1234"}
+		for k, v := range extra {
+			req[k] = v
+		}
+		b, _ := json.Marshal(req)
+		return string(b)
+	}
+
+	t.Run("restores into another cluster", func(t *testing.T) {
+		store, runner := newStore(), &mockKubernetesRestoreRunner{}
+		r := setupKubernetesTestRouter(store, runner, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/kubernetes/restores", body(repo.ID, map[string]interface{}{
+			"namespaces":        []string{"shop"},
+			"namespace_mapping": map[string]string{"shop": "shop-dr"},
+			"restore_volumes":   true,
+			"target": map[string]interface{}{
+				"server":  "https://dr.example.com:6443",
+				"token":   "dr-token",
+				"ca_data": "LS0tLS1CRUdJTg==",
+			},
+		})))
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if len(runner.started) != 1 {
+			t.Fatalf("expected restore to start, got %d", len(runner.started))
+		}
+		restore, target := runner.started[0], runner.targets[0]
+		if restore.NamespaceMapping["shop"] != "shop-dr" || !restore.RestoreVolumes || restore.TargetServer != "https://dr.example.com:6443" {
+			t.Errorf("restore = %+v", restore)
+		}
+		if target == nil || target.Token != "dr-token" || string(target.CAData) != "-----BEGIN" {
+			t.Errorf("target = %+v", target)
+		}
+		if _, ok := store.restores[restore.ID]; !ok {
+			t.Error("restore not stored")
+		}
+		if len(store.auditLogs) != 1 || store.auditLogs[0].Action != models.AuditActionRestore {
+			t.Errorf("audit logs = %v", store.auditLogs)
+		}
+		if strings.Contains(resp.Body.String(), "dr-token") {
+			t.Error("response must not contain the target token")
+		}
+	})
+
+	t.Run("restores through an in-cluster agent", func(t *testing.T) {
+		store, runner := newStore(), &mockKubernetesRestoreRunner{}
+		r := setupKubernetesTestRouter(store, runner, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/kubernetes/restores", body(repo.ID, map[string]interface{}{
+			"agent_id":          agent.ID.String(),
+			"namespace_mapping": map[string]string{"shop": "shop-dr"},
+			"restore_volumes":   true,
+		})))
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if len(runner.started) != 0 {
+			t.Fatal("the server must not run agent restores")
+		}
+		if len(store.commands) != 1 || len(store.restores) != 1 {
+			t.Fatalf("commands = %d, restores = %d", len(store.commands), len(store.restores))
+		}
+		var got models.KubernetesRestore
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		restore := store.restores[got.ID]
+		if restore == nil || restore.CommandID == nil {
+			t.Fatalf("restore = %+v", restore)
+		}
+		cmd := store.commands[*restore.CommandID]
+		if cmd == nil || cmd.AgentID != agent.ID || cmd.Type != models.CommandTypeKubernetesRestore {
+			t.Fatalf("command = %+v", cmd)
+		}
+		if cmd.Payload.RestoreID != restore.ID.String() || cmd.Payload.RepositoryID != repo.ID.String() ||
+			cmd.Payload.NamespaceMapping["shop"] != "shop-dr" || !cmd.Payload.RestoreVolumes {
+			t.Errorf("payload = %+v", cmd.Payload)
+		}
+		if restore.AgentID == nil || *restore.AgentID != agent.ID || restore.TargetServer != "" {
+			t.Errorf("restore = %+v", restore)
+		}
+		if len(store.auditLogs) != 1 {
+			t.Errorf("audit logs = %v", store.auditLogs)
+		}
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		tests := []struct {
+			name string
+			body string
+		}{
+			{"other org repository", body(otherOrg.ID, map[string]interface{}{"target": target})},
+			{"no agent or target", body(repo.ID, nil)},
+			{"agent and target", body(repo.ID, map[string]interface{}{"agent_id": agent.ID.String(), "target": target})},
+			{"other org agent", body(repo.ID, map[string]interface{}{"agent_id": foreignAgent.ID.String()})},
+			{"missing snapshot", `{"repository_id":"` + repo.ID.String() + `"}`},
+			{"invalid namespace mapping", body(repo.ID, map[string]interface{}{"agent_id": agent.ID.String(), "namespace_mapping": map[string]string{"shop": "Shop_DR"}})},
+			{"plain http target", body(repo.ID, map[string]interface{}{"target": map[string]string{"server": "http://dr:6443", "token": "t"}})},
+			{"bad ca data", body(repo.ID, map[string]interface{}{"target": map[string]string{"server": "https://dr:6443", "token": "t", "ca_data": "%%%"}})},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				store, runner := newStore(), &mockKubernetesRestoreRunner{}
+				r := setupKubernetesTestRouter(store, runner, adminUser(orgID))
+				resp := DoRequest(r, JSONRequest("POST", "/api/v1/kubernetes/restores", tt.body))
+				if resp.Code != http.StatusBadRequest {
+					t.Errorf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+				}
+				if len(runner.started) != 0 || len(store.commands) != 0 {
+					t.Error("restore must not start")
+				}
+			})
+		}
+	})
+
+	t.Run("already running", func(t *testing.T) {
+		store, runner := newStore(), &mockKubernetesRestoreRunner{err: backup.ErrKubernetesRestoreRunning}
+		r := setupKubernetesTestRouter(store, runner, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/kubernetes/restores", body(repo.ID, map[string]interface{}{"target": target})))
+		if resp.Code != http.StatusConflict {
+			t.Errorf("expected 409, got %d", resp.Code)
+		}
+	})
+
+	t.Run("requires admin", func(t *testing.T) {
+		member := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, CurrentOrgRole: "member"}
+		r := setupKubernetesTestRouter(newStore(), &mockKubernetesRestoreRunner{}, member)
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/kubernetes/restores", body(repo.ID, map[string]interface{}{"agent_id": agent.ID.String()})))
+		if resp.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", resp.Code)
+		}
+	})
+}
+
+func TestKubernetesGetRestore(t *testing.T) {
+	orgID := uuid.New()
+	restore := models.NewKubernetesRestore(orgID, uuid.New(), "abcd1234")
+	foreign := models.NewKubernetesRestore(uuid.New(), uuid.New(), "ffff0000")
+	store := &mockKubernetesRestoreStore{
+		restores: map[uuid.UUID]*models.KubernetesRestore{restore.ID: restore, foreign.ID: foreign},
+	}
+	r := setupKubernetesTestRouter(store, &mockKubernetesRestoreRunner{}, adminUser(orgID))
+
+	resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/kubernetes/restores"))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.Code)
+	}
+	var list map[string][]models.KubernetesRestore
+	if err := json.Unmarshal(resp.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list["restores"]) != 1 || list["restores"][0].ID != restore.ID {
+		t.Errorf("restores = %v", list["restores"])
+	}
+
+	if resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/kubernetes/restores/"+restore.ID.String())); resp.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", resp.Code)
+	}
+	if resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/kubernetes/restores/"+foreign.ID.String())); resp.Code != http.StatusNotFound {
+		t.Errorf("other org restore: expected 404, got %d", resp.Code)
+	}
+	if resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/kubernetes/restores/not-a-uuid")); resp.Code != http.StatusBadRequest {
+		t.Errorf("invalid ID: expected 400, got %d", resp.Code)
+	}
+}
+
+func TestKubernetesGetRestore_AgentCommand(t *testing.T) {
+	orgID := uuid.New()
+	agentID := uuid.New()
+	cmd := models.NewAgentCommand(agentID, orgID, models.CommandTypeKubernetesRestore, &models.CommandPayload{}, nil)
+	restore := models.NewKubernetesRestore(orgID, uuid.New(), "abcd1234")
+	restore.AgentID = &agentID
+	restore.CommandID = &cmd.ID
+	store := &mockKubernetesRestoreStore{
+		restores: map[uuid.UUID]*models.KubernetesRestore{restore.ID: restore},
+		commands: map[uuid.UUID]*models.AgentCommand{cmd.ID: cmd},
+	}
+	r := setupKubernetesTestRouter(store, &mockKubernetesRestoreRunner{}, adminUser(orgID))
+	get := func() models.KubernetesRestore {
+		t.Helper()
+		resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/kubernetes/restores/"+restore.ID.String()))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.Code)
+		}
+		var got models.KubernetesRestore
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return got
+	}
+
+	if got := get(); got.Status != models.KubernetesRestoreStatusPending || store.updates != 0 {
+		t.Errorf("status = %s, updates = %d", got.Status, store.updates)
+	}
+
+	cmd.MarkRunning()
+	if got := get(); got.Status != models.KubernetesRestoreStatusRunning {
+		t.Errorf("status = %s, want running", got.Status)
+	}
+
+	cmd.Complete(&models.CommandResult{KubernetesRestore: &models.KubernetesRestoreResult{Created: 3, Warnings: []string{"secret is encrypted"}}})
+	got := get()
+	if got.Status != models.KubernetesRestoreStatusCompleted || got.Result == nil || got.Result.Created != 3 || len(got.Result.Warnings) != 1 {
+		t.Errorf("restore = %+v", got)
+	}
+	if store.updates != 2 {
+		t.Errorf("updates = %d, want 2", store.updates)
+	}
+
+	cmd.Fail("late failure")
+	if got := get(); got.Status != models.KubernetesRestoreStatusCompleted || store.updates != 2 {
+		t.Errorf("completed restore changed: %s", got.Status)
+	}
+}
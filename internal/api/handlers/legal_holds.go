@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/backup"
 	"github.com/MacJediWizard/keldris/internal/license"
 	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/gin-gonic/gin"
@@ -31,9 +34,11 @@ type LegalHoldStore interface {
 
 // LegalHoldsHandler handles legal hold HTTP endpoints.
 type LegalHoldsHandler struct {
-	store   LegalHoldStore
-	checker *license.FeatureChecker
-	logger  zerolog.Logger
+	store         LegalHoldStore
+	checker       *license.FeatureChecker
+	approvals     ApprovalGate
+	objectLockers backup.ObjectLockerResolver
+	logger        zerolog.Logger
 }
 
 // NewLegalHoldsHandler creates a new LegalHoldsHandler.
@@ -45,6 +50,18 @@ func NewLegalHoldsHandler(store LegalHoldStore, checker *license.FeatureChecker,
 	}
 }
 
+// SetApprovalGate enables four-eyes approval for legal hold removal.
+func (h *LegalHoldsHandler) SetApprovalGate(gate ApprovalGate) {
+	h.approvals = gate
+	gate.Register(models.ApprovalActionLegalHoldRemove, h.executeApprovedRemoval)
+}
+
+// SetObjectLockers mirrors legal holds as S3 Object Lock legal holds on the
+// objects of snapshots stored in Object Lock enabled buckets.
+func (h *LegalHoldsHandler) SetObjectLockers(resolve backup.ObjectLockerResolver) {
+	h.objectLockers = resolve
+}
+
 // RegisterRoutes registers legal hold routes on the given router group.
 func (h *LegalHoldsHandler) RegisterRoutes(r *gin.RouterGroup) {
 	// Legal holds list endpoint
@@ -220,6 +237,12 @@ func (h *LegalHoldsHandler) CreateLegalHold(c *gin.Context) {
 
 	hold := models.NewLegalHold(user.CurrentOrgID, snapshotID, req.Reason, dbUser.ID)
 
+	if err := h.applyObjectLegalHold(c.Request.Context(), backup.RepositoryID, hold); err != nil {
+		h.logger.Error().Err(err).Str("snapshot_id", snapshotID).Msg("failed to apply object legal hold")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply legal hold to storage objects"})
+		return
+	}
+
 	if err := h.store.CreateLegalHold(c.Request.Context(), hold); err != nil {
 		h.logger.Error().Err(err).Str("snapshot_id", snapshotID).Msg("failed to create legal hold")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create legal hold"})
@@ -326,26 +349,141 @@ func (h *LegalHoldsHandler) DeleteLegalHold(c *gin.Context) {
 		return
 	}
 
-	if err := h.store.DeleteLegalHold(c.Request.Context(), hold.ID); err != nil {
+	approvalReq := models.NewApprovalRequest(user.CurrentOrgID, dbUser.ID, models.ApprovalActionLegalHoldRemove,
+		"legal_hold", snapshotID, "Remove legal hold from snapshot "+snapshotID)
+	if requestApproval(c, h.approvals, h.logger, approvalReq) {
+		return
+	}
+
+	if err := h.removeLegalHold(c.Request.Context(), hold, dbUser.ID, "Legal hold removed from snapshot "+snapshotID); err != nil {
 		h.logger.Error().Err(err).Str("snapshot_id", snapshotID).Msg("failed to delete legal hold")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete legal hold"})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{"message": "legal hold removed"})
+}
+
+// executeApprovedRemoval removes a legal hold once its removal has been
+// approved. The approver performs the removal, so they are the audit actor;
+// the requester is kept in the details.
+func (h *LegalHoldsHandler) executeApprovedRemoval(ctx context.Context, req *models.ApprovalRequest) error {
+	if req.DecidedBy == nil {
+		return errors.New("approval request has no approver")
+	}
+	hold, err := h.store.GetLegalHoldBySnapshotID(ctx, req.ResourceID, req.OrgID)
+	if err != nil {
+		return errors.New("no legal hold on this snapshot")
+	}
+	details := fmt.Sprintf("Legal hold removed from snapshot %s (approval request %s, requested by %s)",
+		req.ResourceID, req.ID, req.RequestedBy)
+	return h.removeLegalHold(ctx, hold, *req.DecidedBy, details)
+}
+
+// removeLegalHold deletes a hold and records the audit trail.
+func (h *LegalHoldsHandler) removeLegalHold(ctx context.Context, hold *models.LegalHold, removedBy uuid.UUID, details string) error {
+	if err := h.releaseObjectLegalHold(ctx, hold); err != nil {
+		return fmt.Errorf("release object legal hold: %w", err)
+	}
+
+	if err := h.store.DeleteLegalHold(ctx, hold.ID); err != nil {
+		return err
+	}
+
 	// Create audit log
-	auditLog := models.NewAuditLog(user.CurrentOrgID, models.AuditActionDelete, "legal_hold", models.AuditResultSuccess).
-		WithUser(dbUser.ID).
+	auditLog := models.NewAuditLog(hold.OrgID, models.AuditActionDelete, "legal_hold", models.AuditResultSuccess).
+		WithUser(removedBy).
 		WithResource(hold.ID).
-		WithDetails("Legal hold removed from snapshot " + snapshotID)
-	if err := h.store.CreateAuditLog(c.Request.Context(), auditLog); err != nil {
+		WithDetails(details)
+	if err := h.store.CreateAuditLog(ctx, auditLog); err != nil {
 		h.logger.Warn().Err(err).Msg("failed to create audit log")
 	}
 
 	h.logger.Info().
 		Str("hold_id", hold.ID.String()).
-		Str("snapshot_id", snapshotID).
-		Str("removed_by", dbUser.ID.String()).
+		Str("snapshot_id", hold.SnapshotID).
+		Str("removed_by", removedBy.String()).
 		Msg("legal hold removed")
+	return nil
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "legal hold removed"})
+// applyObjectLegalHold mirrors a new hold onto the snapshot's storage objects.
+// Repositories without S3 Object Lock keep the hold in Keldris only.
+func (h *LegalHoldsHandler) applyObjectLegalHold(ctx context.Context, repositoryID *uuid.UUID, hold *models.LegalHold) error {
+	if h.objectLockers == nil || repositoryID == nil {
+		return nil
+	}
+	locker, err := h.objectLockers(ctx, *repositoryID)
+	if errors.Is(err, backup.ErrObjectLockUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	count, err := backup.ApplyObjectLegalHold(ctx, locker, backup.HeldSnapshot{SnapshotID: hold.SnapshotID})
+	if errors.Is(err, backup.ErrObjectLockUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	h.logger.Info().
+		Str("snapshot_id", hold.SnapshotID).
+		Int("objects", count).
+		Msg("s3 object legal hold applied")
+	return nil
+}
+
+// releaseObjectLegalHold lifts the storage legal hold mirrored for hold,
+// keeping it on objects still covered by other holds in the same repository.
+func (h *LegalHoldsHandler) releaseObjectLegalHold(ctx context.Context, hold *models.LegalHold) error {
+	if h.objectLockers == nil {
+		return nil
+	}
+	heldBackup, err := h.store.GetBackupBySnapshotID(ctx, hold.SnapshotID)
+	if err != nil || heldBackup.RepositoryID == nil {
+		return nil
+	}
+	repositoryID := *heldBackup.RepositoryID
+
+	locker, err := h.objectLockers(ctx, repositoryID)
+	if errors.Is(err, backup.ErrObjectLockUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	holds, err := h.store.GetLegalHoldsByOrgID(ctx, hold.OrgID)
+	if err != nil {
+		return fmt.Errorf("list legal holds: %w", err)
+	}
+	var remaining []backup.HeldSnapshot
+	for _, other := range holds {
+		if other.ID == hold.ID {
+			continue
+		}
+		otherBackup, err := h.store.GetBackupBySnapshotID(ctx, other.SnapshotID)
+		if err != nil || otherBackup.RepositoryID == nil || *otherBackup.RepositoryID != repositoryID {
+			continue
+		}
+		remaining = append(remaining, backup.HeldSnapshot{SnapshotID: other.SnapshotID})
+	}
+
+	count, err := backup.ReleaseObjectLegalHold(ctx, locker,
+		backup.HeldSnapshot{SnapshotID: hold.SnapshotID}, remaining)
+	if errors.Is(err, backup.ErrObjectLockUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	h.logger.Info().
+		Str("snapshot_id", hold.SnapshotID).
+		Int("objects", count).
+		Msg("s3 object legal hold released")
+	return nil
 }
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/MacJediWizard/keldris/internal/auth"
@@ -21,6 +22,7 @@ type mockLegalHoldStore struct {
 	agent     *models.Agent
 	statusMap map[string]bool
 	onHold    bool
+	auditLogs []*models.AuditLog
 	err       error
 }
 
@@ -64,7 +66,8 @@ func (m *mockLegalHoldStore) GetAgentByID(_ context.Context, _ uuid.UUID) (*mode
 	return m.agent, m.err
 }
 
-func (m *mockLegalHoldStore) CreateAuditLog(_ context.Context, _ *models.AuditLog) error {
+func (m *mockLegalHoldStore) CreateAuditLog(_ context.Context, log *models.AuditLog) error {
+	m.auditLogs = append(m.auditLogs, log)
 	return nil
 }
 
@@ -140,3 +143,35 @@ func TestLegalHoldsCreateLegalHold(t *testing.T) {
 		}
 	})
 }
+
+func TestLegalHoldsExecuteApprovedRemoval(t *testing.T) {
+	orgID := uuid.New()
+	requester, approver := uuid.New(), uuid.New()
+	store := &mockLegalHoldStore{
+		hold: &models.LegalHold{ID: uuid.New(), OrgID: orgID, SnapshotID: "snap-1"},
+	}
+	handler := NewLegalHoldsHandler(store, nil, zerolog.Nop())
+
+	req := models.NewApprovalRequest(orgID, requester, models.ApprovalActionLegalHoldRemove, "legal_hold", "snap-1", "Remove hold")
+	if err := handler.executeApprovedRemoval(context.Background(), req); err == nil {
+		t.Fatal("expected an error for a request without an approver")
+	}
+	if len(store.auditLogs) != 0 {
+		t.Fatalf("expected no audit log, got %d", len(store.auditLogs))
+	}
+
+	req.DecidedBy = &approver
+	if err := handler.executeApprovedRemoval(context.Background(), req); err != nil {
+		t.Fatalf("executeApprovedRemoval() error: %v", err)
+	}
+	if len(store.auditLogs) != 1 {
+		t.Fatalf("expected 1 audit log, got %d", len(store.auditLogs))
+	}
+	log := store.auditLogs[0]
+	if log.UserID == nil || *log.UserID != approver {
+		t.Errorf("audit actor = %v, want approver %s", log.UserID, approver)
+	}
+	if !strings.Contains(log.Details, requester.String()) {
+		t.Errorf("audit details %q should name the requester %s", log.Details, requester)
+	}
+}
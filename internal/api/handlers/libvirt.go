@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// libvirtRestoreTimeout bounds how long an agent may take to restore a
+// domain's disk images.
+const libvirtRestoreTimeout = 6 * time.Hour
+
+// LibvirtStore defines the persistence operations for libvirt discovery and
+// restores.
+type LibvirtStore interface {
+	GetRepositoryByID(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	CreateLibvirtRestore(ctx context.Context, restore *models.LibvirtRestore) error
+	GetLibvirtRestoreByID(ctx context.Context, id uuid.UUID) (*models.LibvirtRestore, error)
+	GetLibvirtRestoresByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.LibvirtRestore, error)
+	UpdateLibvirtRestore(ctx context.Context, restore *models.LibvirtRestore) error
+	GetAgentByID(ctx context.Context, id uuid.UUID) (*models.Agent, error)
+	CreateAgentCommand(ctx context.Context, cmd *models.AgentCommand) error
+	GetAgentCommandByID(ctx context.Context, id uuid.UUID) (*models.AgentCommand, error)
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+}
+
+// LibvirtHandler handles libvirt/KVM discovery and restore HTTP endpoints.
+// The server never talks to libvirt itself: discovery and restores are
+// queued as commands for the agent on the KVM host.
+type LibvirtHandler struct {
+	store  LibvirtStore
+	logger zerolog.Logger
+}
+
+// NewLibvirtHandler creates a new LibvirtHandler.
+func NewLibvirtHandler(store LibvirtStore, logger zerolog.Logger) *LibvirtHandler {
+	return &LibvirtHandler{
+		store:  store,
+		logger: logger.With().Str("component", "libvirt_handler").Logger(),
+	}
+}
+
+// RegisterRoutes registers libvirt routes on the given router group.
+func (h *LibvirtHandler) RegisterRoutes(r *gin.RouterGroup) {
+	libvirt := r.Group("/libvirt")
+	{
+		libvirt.GET("/domains", h.ListDomains)
+		libvirt.GET("/restores", h.ListRestores)
+		libvirt.POST("/restores", h.CreateRestore)
+		libvirt.GET("/restores/:id", h.GetRestore)
+	}
+}
+
+// CreateLibvirtRestoreRequest is the request body for restoring a libvirt
+// domain from a libvirt backup snapshot.
+type CreateLibvirtRestoreRequest struct {
+	// AgentID is the agent of the KVM host to restore the domain on.
+	AgentID      uuid.UUID `json:"agent_id" binding:"required"`
+	RepositoryID uuid.UUID `json:"repository_id" binding:"required"`
+	SnapshotID   string    `json:"snapshot_id" binding:"required"`
+	URI          string    `json:"uri,omitempty" example:"qemu:///system"`
+	Domain       string    `json:"domain,omitempty"`
+	NewName      string    `json:"new_name,omitempty"`
+	TargetDir    string    `json:"target_dir,omitempty" example:"/var/lib/libvirt/images/dr"`
+	Overwrite    bool      `json:"overwrite,omitempty"`
+	Start        bool      `json:"start,omitempty"`
+}
+
+// ListDomains asks an agent to discover the domains of its libvirt host.
+//
+//	@Summary		Discover libvirt domains
+//	@Description	Queues discovery of the domains of the agent's libvirt host. Poll the agent command for the result, which holds the domains with their state and disks, or the discovery error (admin only).
+//	@Tags			Libvirt
+//	@Produce		json
+//	@Param			agent_id	query		string	true	"Agent on the KVM host"
+//	@Param			uri			query		string	false	"libvirt connection URI on the agent, qemu:///system (default) or qemu:///session"
+//	@Success		202			{object}	map[string]interface{}
+//	@Failure		400			{object}	map[string]string
+//	@Failure		401			{object}	map[string]string
+//	@Failure		403			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/libvirt/domains [get]
+func (h *LibvirtHandler) ListDomains(c *gin.Context) {
+	userID, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	agentID, err := uuid.Parse(c.Query("agent_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id is required"})
+		return
+	}
+	uri := c.DefaultQuery("uri", models.DefaultLibvirtURI)
+	if !models.ValidLibvirtURI(uri) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid libvirt URI"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	agent, err := h.store.GetAgentByID(ctx, agentID)
+	if err != nil || agent.OrgID != orgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent not found"})
+		return
+	}
+
+	payload := &models.CommandPayload{LibvirtURI: uri}
+	cmd := models.NewAgentCommand(agent.ID, orgID, models.CommandTypeLibvirtDiscover, payload, &userID)
+	if err := h.store.CreateAgentCommand(ctx, cmd); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create libvirt discovery command")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to initiate libvirt discovery"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"command_id": cmd.ID.String(),
+		"status":     "pending",
+		"message":    "libvirt discovery initiated. Poll the command status for results.",
+	})
+}
+
+// ListRestores returns the organization's libvirt restores.
+//
+//	@Summary		List libvirt restores
+//	@Description	Returns libvirt domain restores for the current organization, newest first (admin only)
+//	@Tags			Libvirt
+//	@Produce		json
+//	@Success		200	{object}	map[string][]models.LibvirtRestore
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/libvirt/restores [get]
+func (h *LibvirtHandler) ListRestores(c *gin.Context) {
+	_, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	restores, err := h.store.GetLibvirtRestoresByOrgID(c.Request.Context(), orgID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("org_id", orgID.String()).Msg("failed to list libvirt restores")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list libvirt restores"})
+		return
+	}
+	for _, restore := range restores {
+		h.syncAgentRestore(c.Request.Context(), restore)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"restores": restores})
+}
+
+// GetRestore returns a libvirt restore with its status and result.
+//
+//	@Summary		Get libvirt restore
+//	@Description	Returns a libvirt restore with its status and, once finished, the restored disk images and domain (admin only)
+//	@Tags			Libvirt
+//	@Produce		json
+//	@Param			id	path		string	true	"Restore ID"
+//	@Success		200	{object}	models.LibvirtRestore
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/libvirt/restores/{id} [get]
+func (h *LibvirtHandler) GetRestore(c *gin.Context) {
+	_, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid restore ID"})
+		return
+	}
+
+	restore, err := h.store.GetLibvirtRestoreByID(c.Request.Context(), id)
+	if err != nil || restore.OrgID != orgID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "restore not found"})
+		return
+	}
+	h.syncAgentRestore(c.Request.Context(), restore)
+
+	c.JSON(http.StatusOK, restore)
+}
+
+// syncAgentRestore updates a restore from its agent command, which the agent
+// reports to.
+func (h *LibvirtHandler) syncAgentRestore(ctx context.Context, restore *models.LibvirtRestore) {
+	if restore.CommandID == nil || restore.IsTerminal() {
+		return
+	}
+	cmd, err := h.store.GetAgentCommandByID(ctx, *restore.CommandID)
+	if err != nil {
+		h.logger.Warn().Err(err).Str("restore_id", restore.ID.String()).Msg("failed to get libvirt restore command")
+		return
+	}
+	if !restore.ApplyCommand(cmd) {
+		return
+	}
+	if err := h.store.UpdateLibvirtRestore(ctx, restore); err != nil {
+		h.logger.Error().Err(err).Str("restore_id", restore.ID.String()).Msg("failed to update libvirt restore")
+	}
+}
+
+// CreateRestore restores a libvirt domain from a libvirt backup snapshot.
+//
+//	@Summary		Restore libvirt domain
+//	@Description	Queues a restore on the agent of the KVM host. The agent restores the domain's disk images from a snapshot to their original paths or a target directory inside its images directory and redefines the domain, optionally under a new name and started. Definitions with devices outside the allowlist are refused (admin only).
+//	@Tags			Libvirt
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateLibvirtRestoreRequest	true	"Restore details"
+//	@Success		202		{object}	models.LibvirtRestore
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/libvirt/restores [post]
+func (h *LibvirtHandler) CreateRestore(c *gin.Context) {
+	userID, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req CreateLibvirtRestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	repo, err := h.store.GetRepositoryByID(ctx, req.RepositoryID)
+	if err != nil || repo.OrgID != orgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repository not found"})
+		return
+	}
+	agent, err := h.store.GetAgentByID(ctx, req.AgentID)
+	if err != nil || agent.OrgID != orgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent not found"})
+		return
+	}
+
+	restore := models.NewLibvirtRestore(orgID, repo.ID, req.SnapshotID)
+	restore.URI = req.URI
+	restore.Domain = req.Domain
+	restore.NewName = req.NewName
+	restore.TargetDir = req.TargetDir
+	restore.Overwrite = req.Overwrite
+	restore.StartDomain = req.Start
+	restore.CreatedBy = &userID
+	if err := restore.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payload := &models.CommandPayload{
+		SnapshotID:   restore.SnapshotID,
+		RepositoryID: restore.RepositoryID.String(),
+		RestoreID:    restore.ID.String(),
+		LibvirtURI:   restore.ConnectionURI(),
+		Domain:       restore.Domain,
+		NewName:      restore.NewName,
+		TargetDir:    restore.TargetDir,
+		Overwrite:    restore.Overwrite,
+		StartDomain:  restore.StartDomain,
+	}
+	cmd := models.NewAgentCommand(agent.ID, orgID, models.CommandTypeLibvirtRestore, payload, &userID)
+	cmd.TimeoutAt = time.Now().Add(libvirtRestoreTimeout)
+	if err := h.store.CreateAgentCommand(ctx, cmd); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create libvirt restore command")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create libvirt restore"})
+		return
+	}
+
+	restore.AgentID = &agent.ID
+	restore.CommandID = &cmd.ID
+	if err := h.store.CreateLibvirtRestore(ctx, restore); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create libvirt restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create libvirt restore"})
+		return
+	}
+
+	auditLog := models.NewAuditLog(orgID, models.AuditActionRestore, "libvirt_restore", models.AuditResultSuccess).
+		WithUser(userID).
+		WithResource(restore.ID).
+		WithRequestInfo(c.ClientIP(), c.Request.UserAgent()).
+		WithDetails(fmt.Sprintf("libvirt restore of snapshot %s onto %s of agent %s", restore.SnapshotID, restore.ConnectionURI(), agent.Hostname))
+	if err := h.store.CreateAuditLog(ctx, auditLog); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to create audit log")
+	}
+
+	h.logger.Info().
+		Str("restore_id", restore.ID.String()).
+		Str("snapshot_id", restore.SnapshotID).
+		Str("agent_id", agent.ID.String()).
+		Str("command_id", cmd.ID.String()).
+		Msg("libvirt restore queued on agent")
+
+	c.JSON(http.StatusAccepted, restore)
+}
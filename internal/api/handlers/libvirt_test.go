@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockLibvirtStore struct {
+	repos     map[uuid.UUID]*models.Repository
+	agents    map[uuid.UUID]*models.Agent
+	commands  map[uuid.UUID]*models.AgentCommand
+	restores  map[uuid.UUID]*models.LibvirtRestore
+	auditLogs []*models.AuditLog
+}
+
+func (m *mockLibvirtStore) GetRepositoryByID(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	repo, ok := m.repos[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return repo, nil
+}
+
+func (m *mockLibvirtStore) CreateLibvirtRestore(_ context.Context, restore *models.LibvirtRestore) error {
+	m.restores[restore.ID] = restore
+	return nil
+}
+
+func (m *mockLibvirtStore) GetLibvirtRestoreByID(_ context.Context, id uuid.UUID) (*models.LibvirtRestore, error) {
+	restore, ok := m.restores[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return restore, nil
+}
+
+func (m *mockLibvirtStore) GetLibvirtRestoresByOrgID(_ context.Context, orgID uuid.UUID) ([]*models.LibvirtRestore, error) {
+	var out []*models.LibvirtRestore
+	for _, restore := range m.restores {
+		if restore.OrgID == orgID {
+			out = append(out, restore)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockLibvirtStore) CreateAuditLog(_ context.Context, log *models.AuditLog) error {
+	m.auditLogs = append(m.auditLogs, log)
+	return nil
+}
+
+func (m *mockLibvirtStore) UpdateLibvirtRestore(_ context.Context, restore *models.LibvirtRestore) error {
+	m.restores[restore.ID] = restore
+	return nil
+}
+
+func (m *mockLibvirtStore) GetAgentByID(_ context.Context, id uuid.UUID) (*models.Agent, error) {
+	agent, ok := m.agents[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return agent, nil
+}
+
+func (m *mockLibvirtStore) CreateAgentCommand(_ context.Context, cmd *models.AgentCommand) error {
+	if m.commands == nil {
+		m.commands = make(map[uuid.UUID]*models.AgentCommand)
+	}
+	m.commands[cmd.ID] = cmd
+	return nil
+}
+
+func (m *mockLibvirtStore) GetAgentCommandByID(_ context.Context, id uuid.UUID) (*models.AgentCommand, error) {
+	cmd, ok := m.commands[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return cmd, nil
+}
+
+func setupLibvirtTestRouter(store *mockLibvirtStore, user *auth.SessionUser) *gin.Engine {
+	r := SetupTestRouter(user)
+	NewLibvirtHandler(store, zerolog.Nop()).RegisterRoutes(r.Group("/api/v1"))
+	return r
+}
+
+func TestLibvirtListDomains(t *testing.T) {
+	orgID := uuid.New()
+	agent := models.NewAgent(orgID, "kvm1", "hash")
+	foreignAgent := models.NewAgent(uuid.New(), "kvm2", "hash")
+	store := &mockLibvirtStore{agents: map[uuid.UUID]*models.Agent{agent.ID: agent, foreignAgent.ID: foreignAgent}}
+	r := setupLibvirtTestRouter(store, adminUser(orgID))
+
+	resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/libvirt/domains?agent_id="+agent.ID.String()+"&uri=qemu:///session"))
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var body struct {
+		CommandID uuid.UUID `json:"command_id"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	cmd := store.commands[body.CommandID]
+	if cmd == nil || cmd.AgentID != agent.ID || cmd.Type != models.CommandTypeLibvirtDiscover || cmd.Payload.LibvirtURI != "qemu:///session" {
+		t.Fatalf("command = %+v", cmd)
+	}
+
+	for _, query := range []string{
+		"",
+		"agent_id=" + foreignAgent.ID.String(),
+		"agent_id=" + agent.ID.String() + "&uri=-c",
+		"agent_id=" + agent.ID.String() + "&uri=qemu%2Bssh://root@kvm1/system",
+		"agent_id=" + agent.ID.String() + "&uri=qemu%2Bext:///system%3Fcommand=/tmp/x",
+		"agent_id=" + agent.ID.String() + "&uri=qemu:///system%3Fsocket=/tmp/s",
+	} {
+		resp = DoRequest(r, AuthenticatedRequest("GET", "/api/v1/libvirt/domains?"+query))
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", query, resp.Code)
+		}
+	}
+	if len(store.commands) != 1 {
+		t.Errorf("queued commands for rejected requests: %d", len(store.commands))
+	}
+
+	member := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, CurrentOrgRole: "member"}
+	r = setupLibvirtTestRouter(store, member)
+	resp = DoRequest(r, AuthenticatedRequest("GET", "/api/v1/libvirt/domains?agent_id="+agent.ID.String()))
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", resp.Code)
+	}
+}
+
+func TestLibvirtCreateRestore(t *testing.T) {
+	orgID := uuid.New()
+	repo := models.NewRepository(orgID, "kvm", models.RepositoryTypeS3, nil)
+	foreignRepo := models.NewRepository(uuid.New(), "foreign", models.RepositoryTypeS3, nil)
+	agent := models.NewAgent(orgID, "kvm1", "hash")
+	foreignAgent := models.NewAgent(uuid.New(), "kvm2", "hash")
+	newStore := func() *mockLibvirtStore {
+		return &mockLibvirtStore{
+			repos:    map[uuid.UUID]*models.Repository{repo.ID: repo, foreignRepo.ID: foreignRepo},
+			agents:   map[uuid.UUID]*models.Agent{agent.ID: agent, foreignAgent.ID: foreignAgent},
+			restores: make(map[uuid.UUID]*models.LibvirtRestore),
+		}
+	}
+	body := func(repoID uuid.UUID, extra map[string]interface{}) string {
+		req := map[string]interface{}{
+			"repository_id": repoID.String(),
+			"agent_id":      agent.ID.String(),
+			"snapshot_id":   "abcd1234",
+		}
+		for k, v := range extra {
+			req[k] = v
+		}
+		b, _ := json.Marshal(req)
+		return string(b)
+	}
+
+	t.Run("queues a restore on the agent", func(t *testing.T) {
+		store := newStore()
+		r := setupLibvirtTestRouter(store, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/libvirt/restores", body(repo.ID, map[string]interface{}{
+			"domain":     "web",
+			"new_name":   "web-dr",
+			"target_dir": "/var/lib/libvirt/images/dr",
+			"start":      true,
+		})))
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var restore models.LibvirtRestore
+		if err := json.Unmarshal(resp.Body.Bytes(), &restore); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := store.restores[restore.ID]; !ok {
+			t.Fatal("restore not stored")
+		}
+		if restore.AgentID == nil || *restore.AgentID != agent.ID || restore.CommandID == nil {
+			t.Fatalf("restore = %+v", restore)
+		}
+		cmd := store.commands[*restore.CommandID]
+		if cmd == nil || cmd.AgentID != agent.ID || cmd.Type != models.CommandTypeLibvirtRestore || cmd.TimeoutAt.IsZero() {
+			t.Fatalf("command = %+v", cmd)
+		}
+		p := cmd.Payload
+		if p.RepositoryID != repo.ID.String() || p.SnapshotID != "abcd1234" || p.RestoreID != restore.ID.String() ||
+			p.LibvirtURI != models.DefaultLibvirtURI || p.Domain != "web" || p.NewName != "web-dr" ||
+			p.TargetDir != "/var/lib/libvirt/images/dr" || p.Overwrite || !p.StartDomain {
+			t.Errorf("payload = %+v", p)
+		}
+		if len(store.auditLogs) != 1 || store.auditLogs[0].Action != models.AuditActionRestore {
+			t.Errorf("audit logs = %v", store.auditLogs)
+		}
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		tests := []struct {
+			name string
+			body string
+		}{
+			{"other org repository", body(foreignRepo.ID, nil)},
+			{"other org agent", body(repo.ID, map[string]interface{}{"agent_id": foreignAgent.ID.String()})},
+			{"missing agent", body(repo.ID, map[string]interface{}{"agent_id": ""})},
+			{"missing snapshot", body(repo.ID, map[string]interface{}{"snapshot_id": ""})},
+			{"invalid uri", body(repo.ID, map[string]interface{}{"uri": "system"})},
+			{"relative target dir", body(repo.ID, map[string]interface{}{"target_dir": "images"})},
+			{"remote uri", body(repo.ID, map[string]interface{}{"uri": "qemu+ssh://root@kvm1/system"})},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				store := newStore()
+				r := setupLibvirtTestRouter(store, adminUser(orgID))
+				resp := DoRequest(r, JSONRequest("POST", "/api/v1/libvirt/restores", tt.body))
+				if resp.Code != http.StatusBadRequest {
+					t.Errorf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+				}
+				if len(store.commands) != 0 || len(store.restores) != 0 {
+					t.Error("restore must not be queued")
+				}
+			})
+		}
+	})
+}
+
+func TestLibvirtGetRestore(t *testing.T) {
+	orgID := uuid.New()
+	restore := models.NewLibvirtRestore(orgID, uuid.New(), "abcd1234")
+	foreign := models.NewLibvirtRestore(uuid.New(), uuid.New(), "ffff0000")
+	agentID := uuid.New()
+	cmd := models.NewAgentCommand(agentID, orgID, models.CommandTypeLibvirtRestore, nil, nil)
+	cmd.Complete(&models.CommandResult{LibvirtRestore: &models.LibvirtRestoreResult{Domain: "web", Started: true}})
+	restore.AgentID, restore.CommandID = &agentID, &cmd.ID
+	store := &mockLibvirtStore{
+		restores: map[uuid.UUID]*models.LibvirtRestore{restore.ID: restore, foreign.ID: foreign},
+		commands: map[uuid.UUID]*models.AgentCommand{cmd.ID: cmd},
+	}
+	r := setupLibvirtTestRouter(store, adminUser(orgID))
+
+	resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/libvirt/restores/"+restore.ID.String()))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.Code)
+	}
+	var got models.LibvirtRestore
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.LibvirtRestoreStatusCompleted || got.Result == nil || got.Result.Domain != "web" {
+		t.Errorf("restore not synced from its command: %+v", got)
+	}
+	if store.restores[restore.ID].Status != models.LibvirtRestoreStatusCompleted {
+		t.Error("synced restore not stored")
+	}
+	resp = DoRequest(r, AuthenticatedRequest("GET", "/api/v1/libvirt/restores/"+foreign.ID.String()))
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another org's restore, got %d", resp.Code)
+	}
+
+	resp = DoRequest(r, AuthenticatedRequest("GET", "/api/v1/libvirt/restores"))
+	var list struct {
+		Restores []models.LibvirtRestore `json:"restores"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Restores) != 1 || list.Restores[0].ID != restore.ID {
+		t.Errorf("restores = %+v", list.Restores)
+	}
+}
@@ -55,11 +55,6 @@ func (h *MaintenanceHandler) RegisterRoutes(r *gin.RouterGroup) {
 	r.GET("/maintenance/active", h.GetActive)
 }
 
-// isAdmin checks if the user has admin or owner role.
-func isAdmin(role string) bool {
-	return role == string(models.OrgRoleAdmin) || role == string(models.OrgRoleOwner)
-}
-
 // List returns all maintenance windows for the organization.
 // GET /api/v1/maintenance-windows
 func (h *MaintenanceHandler) List(c *gin.Context) {
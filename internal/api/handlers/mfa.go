@@ -0,0 +1,590 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/MacJediWizard/keldris/internal/settings"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// totpIssuer is the issuer shown in authenticator apps.
+const totpIssuer = "Keldris"
+
+// MFAFactorStore defines the interface for MFA enrollment persistence operations.
+type MFAFactorStore interface {
+	GetMFAFactorsByUserID(ctx context.Context, userID uuid.UUID) ([]*models.UserMFAFactor, error)
+	GetMFAFactorByID(ctx context.Context, id uuid.UUID) (*models.UserMFAFactor, error)
+	CreateMFAFactor(ctx context.Context, f *models.UserMFAFactor) error
+	ConfirmMFAFactor(ctx context.Context, id uuid.UUID) error
+	DeleteMFAFactor(ctx context.Context, id uuid.UUID) error
+	ReplaceMFARecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	CountUnusedMFARecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetUserPasswordInfo(ctx context.Context, userID uuid.UUID) (*models.UserPasswordInfo, error)
+	GetSecuritySettings(ctx context.Context, orgID uuid.UUID) (*settings.SecuritySettings, error)
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+}
+
+// MFAHandler handles second-factor enrollment and step-up re-authentication.
+type MFAHandler struct {
+	store    MFAFactorStore
+	verifier *auth.MFAVerifier
+	sessions *auth.SessionStore
+	logger   zerolog.Logger
+}
+
+// NewMFAHandler creates a new MFAHandler.
+func NewMFAHandler(store MFAFactorStore, verifier *auth.MFAVerifier, sessions *auth.SessionStore, logger zerolog.Logger) *MFAHandler {
+	return &MFAHandler{
+		store:    store,
+		verifier: verifier,
+		sessions: sessions,
+		logger:   logger.With().Str("component", "mfa_handler").Logger(),
+	}
+}
+
+// RegisterRoutes registers MFA routes on the given router group.
+func (h *MFAHandler) RegisterRoutes(r *gin.RouterGroup) {
+	mfa := r.Group("/mfa")
+	{
+		mfa.GET("", h.Status)
+		mfa.POST("/totp", h.EnrollTOTP)
+		mfa.POST("/totp/:id/confirm", h.ConfirmTOTP)
+		mfa.POST("/webauthn/register", h.BeginWebAuthnRegistration)
+		mfa.POST("/webauthn/register/finish", h.FinishWebAuthnRegistration)
+		mfa.DELETE("/factors/:id", h.DeleteFactor)
+		mfa.POST("/recovery-codes", h.RegenerateRecoveryCodes)
+		mfa.POST("/step-up/webauthn", h.BeginWebAuthnStepUp)
+		mfa.POST("/step-up", h.StepUp)
+	}
+}
+
+// MFAEnrollmentResponse is returned when a factor is confirmed.
+// Recovery codes are included only when the user's first factor is enrolled.
+type MFAEnrollmentResponse struct {
+	Factor        *models.UserMFAFactor `json:"factor"`
+	RecoveryCodes []string              `json:"recovery_codes,omitempty"`
+}
+
+// StepUpResponse is returned after a successful step-up.
+type StepUpResponse struct {
+	StepUpAt  time.Time `json:"step_up_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Status returns the current user's MFA enrollment.
+// GET /api/v1/mfa
+func (h *MFAHandler) Status(c *gin.Context) {
+	user := h.requireSelf(c)
+	if user == nil {
+		return
+	}
+
+	factors, err := h.store.GetMFAFactorsByUserID(c.Request.Context(), user.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to get mfa factors")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get MFA status"})
+		return
+	}
+	remaining, err := h.store.CountUnusedMFARecoveryCodes(c.Request.Context(), user.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to count recovery codes")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get MFA status"})
+		return
+	}
+
+	resp := models.MFAStatusResponse{
+		Factors:                factors,
+		RecoveryCodesRemaining: remaining,
+	}
+	if resp.Factors == nil {
+		resp.Factors = []*models.UserMFAFactor{}
+	}
+	for _, f := range factors {
+		if f.IsConfirmed() {
+			resp.Enabled = true
+			break
+		}
+	}
+
+	if !resp.Enabled && user.CurrentOrgID != uuid.Nil {
+		security, err := h.store.GetSecuritySettings(c.Request.Context(), user.CurrentOrgID)
+		if err == nil && security.RequireMFA {
+			resp.EnrollmentRequired = true
+			if account, err := h.store.GetUserByID(c.Request.Context(), user.ID); err == nil {
+				since := time.Time{}
+				if security.MFARequiredSince != nil {
+					since = *security.MFARequiredSince
+				}
+				deadline := auth.MFAEnrollmentDeadline(account.CreatedAt, since, security.MFAGracePeriodDays)
+				resp.EnrollmentDeadline = &deadline
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// EnrollTOTP starts TOTP enrollment and returns the secret for the authenticator app.
+// POST /api/v1/mfa/totp
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) {
+	user := h.requireSelf(c)
+	if user == nil {
+		return
+	}
+
+	var req models.TOTPEnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" {
+		req.Name = "Authenticator app"
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to generate totp secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start enrollment"})
+		return
+	}
+	encrypted, err := h.verifier.EncryptSecret(secret)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to encrypt totp secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start enrollment"})
+		return
+	}
+
+	factor := models.NewTOTPFactor(user.ID, req.Name, encrypted)
+	if err := h.store.CreateMFAFactor(c.Request.Context(), factor); err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to create totp factor")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.TOTPEnrollResponse{
+		FactorID:        factor.ID,
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(totpIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTOTP completes TOTP enrollment with a code from the authenticator app.
+// POST /api/v1/mfa/totp/:id/confirm
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	user := h.requireSelf(c)
+	if user == nil {
+		return
+	}
+
+	var req models.TOTPConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	factor := h.loadFactor(c, user.ID)
+	if factor == nil {
+		return
+	}
+	if factor.Type != models.MFAFactorTOTP || factor.IsConfirmed() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "factor is not pending TOTP enrollment"})
+		return
+	}
+
+	secret, err := h.verifier.DecryptSecret(factor.SecretEncrypted)
+	if err != nil {
+		h.logger.Error().Err(err).Str("factor_id", factor.ID.String()).Msg("failed to decrypt totp secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to confirm enrollment"})
+		return
+	}
+	if !auth.ValidateTOTPCode(secret, req.Code, time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid verification code"})
+		return
+	}
+
+	hadFactor, err := h.hasConfirmedFactor(c.Request.Context(), user.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to get mfa factors")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to confirm enrollment"})
+		return
+	}
+
+	if err := h.store.ConfirmMFAFactor(c.Request.Context(), factor.ID); err != nil {
+		h.logger.Error().Err(err).Str("factor_id", factor.ID.String()).Msg("failed to confirm totp factor")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to confirm enrollment"})
+		return
+	}
+	now := time.Now()
+	factor.ConfirmedAt = &now
+
+	h.finishEnrollment(c, user, factor, hadFactor)
+}
+
+// BeginWebAuthnRegistration returns navigator.credentials.create() options.
+// POST /api/v1/mfa/webauthn/register
+func (h *MFAHandler) BeginWebAuthnRegistration(c *gin.Context) {
+	user := h.requireSelf(c)
+	if user == nil {
+		return
+	}
+
+	factors, err := h.verifier.ConfirmedFactors(c.Request.Context(), user.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to get mfa factors")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start registration"})
+		return
+	}
+
+	challenge, err := auth.NewWebAuthnChallenge()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to generate webauthn challenge")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start registration"})
+		return
+	}
+	if err := h.sessions.SetWebAuthnChallenge(c.Request, c.Writer, challenge); err != nil {
+		h.logger.Error().Err(err).Msg("failed to save webauthn challenge")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start registration"})
+		return
+	}
+
+	name := user.Name
+	if name == "" {
+		name = user.Email
+	}
+	c.JSON(http.StatusOK, auth.NewWebAuthnCreationOptions(h.verifier.WebAuthn(), challenge, user.ID[:], user.Email, name, auth.WebAuthnCredentialIDs(factors)))
+}
+
+// FinishWebAuthnRegistration verifies the authenticator's response and enrolls the credential.
+// POST /api/v1/mfa/webauthn/register/finish
+func (h *MFAHandler) FinishWebAuthnRegistration(c *gin.Context) {
+	user := h.requireSelf(c)
+	if user == nil {
+		return
+	}
+
+	var req models.WebAuthnRegisterFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" {
+		req.Name = "Security key"
+	}
+
+	challenge, err := h.sessions.TakeWebAuthnChallenge(c.Request, c.Writer)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no registration in progress"})
+		return
+	}
+	clientData, err := auth.DecodeWebAuthnBase64(req.ClientDataJSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client_data_json"})
+		return
+	}
+	attestation, err := auth.DecodeWebAuthnBase64(req.AttestationObject)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attestation_object"})
+		return
+	}
+
+	cred, err := h.verifier.WebAuthn().VerifyRegistration(challenge, clientData, attestation)
+	if err != nil {
+		h.logger.Warn().Err(err).Str("user_id", user.ID.String()).Msg("webauthn registration rejected")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "security key registration failed"})
+		return
+	}
+
+	hadFactor, err := h.hasConfirmedFactor(c.Request.Context(), user.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to get mfa factors")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register security key"})
+		return
+	}
+
+	factor := models.NewWebAuthnFactor(user.ID, req.Name, cred.ID, cred.PublicKey, cred.Algorithm, cred.SignCount)
+	if err := h.store.CreateMFAFactor(c.Request.Context(), factor); err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to create webauthn factor")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register security key"})
+		return
+	}
+
+	h.finishEnrollment(c, user, factor, hadFactor)
+}
+
+// DeleteFactor removes an enrolled factor. Removing the last factor is refused
+// when the organization requires MFA, and clears recovery codes otherwise.
+// DELETE /api/v1/mfa/factors/:id
+func (h *MFAHandler) DeleteFactor(c *gin.Context) {
+	user := h.requireSelf(c)
+	if user == nil {
+		return
+	}
+
+	factor := h.loadFactor(c, user.ID)
+	if factor == nil {
+		return
+	}
+
+	factors, err := h.verifier.ConfirmedFactors(c.Request.Context(), user.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to get mfa factors")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove factor"})
+		return
+	}
+	lastFactor := factor.IsConfirmed() && len(factors) == 1
+
+	if lastFactor && user.CurrentOrgID != uuid.Nil {
+		security, err := h.store.GetSecuritySettings(c.Request.Context(), user.CurrentOrgID)
+		if err == nil && security.RequireMFA {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "your organization requires MFA; enroll another factor before removing this one"})
+			return
+		}
+	}
+
+	if err := h.store.DeleteMFAFactor(c.Request.Context(), factor.ID); err != nil {
+		h.logger.Error().Err(err).Str("factor_id", factor.ID.String()).Msg("failed to delete mfa factor")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove factor"})
+		return
+	}
+	if lastFactor {
+		if err := h.store.ReplaceMFARecoveryCodes(c.Request.Context(), user.ID, nil); err != nil {
+			h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to clear recovery codes")
+		}
+	}
+
+	h.logAuditEvent(c, user, models.AuditActionDelete, factor.ID, "Removed "+string(factor.Type)+" factor")
+	c.JSON(http.StatusOK, gin.H{"message": "factor removed"})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes.
+// POST /api/v1/mfa/recovery-codes
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	user := h.requireSelf(c)
+	if user == nil {
+		return
+	}
+
+	enabled, err := h.hasConfirmedFactor(c.Request.Context(), user.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to get mfa factors")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "enroll a second factor first"})
+		return
+	}
+
+	codes, err := h.issueRecoveryCodes(c.Request.Context(), user.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to generate recovery codes")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+
+	h.logAuditEvent(c, user, models.AuditActionUpdate, user.ID, "Regenerated MFA recovery codes")
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{Codes: codes})
+}
+
+// BeginWebAuthnStepUp returns navigator.credentials.get() options for step-up.
+// POST /api/v1/mfa/step-up/webauthn
+func (h *MFAHandler) BeginWebAuthnStepUp(c *gin.Context) {
+	user := h.requireSelf(c)
+	if user == nil {
+		return
+	}
+
+	options, err := webAuthnRequestOptions(c, h.verifier, h.sessions, user.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to create webauthn challenge")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create challenge"})
+		return
+	}
+	if options == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no security keys enrolled"})
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+// StepUp re-authenticates the current user before a sensitive operation.
+// Users with an enrolled factor must use it (or a recovery code); local users
+// without MFA may re-enter their password.
+// POST /api/v1/mfa/step-up
+func (h *MFAHandler) StepUp(c *gin.Context) {
+	user := h.requireSelf(c)
+	if user == nil {
+		return
+	}
+
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	enabled, err := h.hasConfirmedFactor(ctx, user.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to get mfa factors")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return
+	}
+
+	if req.Method == models.MFAMethodPassword {
+		if enabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "use your second factor to confirm this action"})
+			return
+		}
+		if !h.verifyPassword(c, user.ID, req.Password) {
+			return
+		}
+	} else {
+		var challenge []byte
+		if req.Method == models.MFAMethodWebAuthn {
+			challenge, _ = h.sessions.TakeWebAuthnChallenge(c.Request, c.Writer)
+		}
+		if err := h.verifier.Verify(ctx, user.ID, &req, challenge); err != nil {
+			if isMFAVerificationError(err) {
+				h.logStepUpFailure(c, user, req.Method)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid second factor"})
+				return
+			}
+			h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("step-up verification failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+			return
+		}
+	}
+
+	now := time.Now()
+	if err := h.sessions.SetStepUp(c.Request, c.Writer, now); err != nil {
+		h.logger.Error().Err(err).Msg("failed to save step-up to session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return
+	}
+
+	window := settings.DefaultStepUpMaxAgeMinutes * time.Minute
+	if user.CurrentOrgID != uuid.Nil {
+		if security, err := h.store.GetSecuritySettings(ctx, user.CurrentOrgID); err == nil {
+			window = security.StepUpMaxAge()
+		}
+	}
+
+	h.logAuditEvent(c, user, models.AuditActionLogin, user.ID, "Step-up re-authentication via "+req.Method)
+	c.JSON(http.StatusOK, StepUpResponse{StepUpAt: now, ExpiresAt: now.Add(window)})
+}
+
+// verifyPassword checks a local user's password for step-up, writing the error response on failure.
+func (h *MFAHandler) verifyPassword(c *gin.Context, userID uuid.UUID, password string) bool {
+	info, err := h.store.GetUserPasswordInfo(c.Request.Context(), userID)
+	if err != nil || info.PasswordHash == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password re-authentication is not available; sign in again to continue"})
+		return false
+	}
+	if password == "" || auth.VerifyPassword(password, *info.PasswordHash) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid password"})
+		return false
+	}
+	return true
+}
+
+// finishEnrollment audits a newly confirmed factor and issues recovery codes for a first factor.
+func (h *MFAHandler) finishEnrollment(c *gin.Context, user *auth.SessionUser, factor *models.UserMFAFactor, hadFactor bool) {
+	resp := MFAEnrollmentResponse{Factor: factor}
+	if !hadFactor {
+		codes, err := h.issueRecoveryCodes(c.Request.Context(), user.ID)
+		if err != nil {
+			h.logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to generate recovery codes")
+		} else {
+			resp.RecoveryCodes = codes
+		}
+	}
+
+	h.logAuditEvent(c, user, models.AuditActionCreate, factor.ID, "Enrolled "+string(factor.Type)+" factor")
+	c.JSON(http.StatusCreated, resp)
+}
+
+// issueRecoveryCodes generates and stores a fresh set of recovery codes.
+func (h *MFAHandler) issueRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	if err := h.store.ReplaceMFARecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hasConfirmedFactor reports whether the user has completed enrollment of any factor.
+func (h *MFAHandler) hasConfirmedFactor(ctx context.Context, userID uuid.UUID) (bool, error) {
+	factors, err := h.verifier.ConfirmedFactors(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return len(factors) > 0, nil
+}
+
+// loadFactor loads the :id factor and verifies it belongs to the user.
+func (h *MFAHandler) loadFactor(c *gin.Context, userID uuid.UUID) *models.UserMFAFactor {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid factor ID"})
+		return nil
+	}
+	factor, err := h.store.GetMFAFactorByID(c.Request.Context(), id)
+	if err != nil || factor.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "factor not found"})
+		return nil
+	}
+	return factor
+}
+
+// requireSelf returns the session user, refusing MFA changes while impersonating
+// so that a superuser cannot enroll or remove factors on another user's account.
+func (h *MFAHandler) requireSelf(c *gin.Context) *auth.SessionUser {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return nil
+	}
+	if user.IsImpersonating() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "MFA cannot be managed while impersonating"})
+		return nil
+	}
+	return user
+}
+
+func (h *MFAHandler) logAuditEvent(c *gin.Context, user *auth.SessionUser, action models.AuditAction, resourceID uuid.UUID, details string) {
+	auditLog := models.NewAuditLog(user.CurrentOrgID, action, "mfa", models.AuditResultSuccess).
+		WithUser(user.ID).
+		WithResource(resourceID).
+		WithRequestInfo(c.ClientIP(), c.Request.UserAgent()).
+		WithDetails(details)
+
+	if err := h.store.CreateAuditLog(c.Request.Context(), auditLog); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create audit log")
+	}
+}
+
+func (h *MFAHandler) logStepUpFailure(c *gin.Context, user *auth.SessionUser, method string) {
+	auditLog := models.NewAuditLog(user.CurrentOrgID, models.AuditActionLogin, "mfa", models.AuditResultFailure).
+		WithUser(user.ID).
+		WithRequestInfo(c.ClientIP(), c.Request.UserAgent()).
+		WithDetails("Step-up re-authentication failed via " + method)
+
+	if err := h.store.CreateAuditLog(c.Request.Context(), auditLog); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create audit log")
+	}
+}
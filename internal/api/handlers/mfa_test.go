@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/MacJediWizard/keldris/internal/settings"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockMFAFactorStore struct {
+	factors       map[uuid.UUID]*models.UserMFAFactor
+	recoveryCodes []string
+	passwordHash  *string
+	security      *settings.SecuritySettings
+	deleted       []uuid.UUID
+	mfaFailures   int
+	mfaLocked     *time.Time
+}
+
+func newMockMFAFactorStore() *mockMFAFactorStore {
+	return &mockMFAFactorStore{factors: make(map[uuid.UUID]*models.UserMFAFactor)}
+}
+
+func (m *mockMFAFactorStore) GetMFAFactorsByUserID(_ context.Context, userID uuid.UUID) ([]*models.UserMFAFactor, error) {
+	var out []*models.UserMFAFactor
+	for _, f := range m.factors {
+		if f.UserID == userID {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockMFAFactorStore) GetMFAFactorByID(_ context.Context, id uuid.UUID) (*models.UserMFAFactor, error) {
+	f, ok := m.factors[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return f, nil
+}
+
+func (m *mockMFAFactorStore) CreateMFAFactor(_ context.Context, f *models.UserMFAFactor) error {
+	m.factors[f.ID] = f
+	return nil
+}
+
+func (m *mockMFAFactorStore) ConfirmMFAFactor(_ context.Context, id uuid.UUID) error {
+	now := time.Now()
+	m.factors[id].ConfirmedAt = &now
+	m.factors[id].LastUsedAt = &now
+	return nil
+}
+
+func (m *mockMFAFactorStore) DeleteMFAFactor(_ context.Context, id uuid.UUID) error {
+	m.deleted = append(m.deleted, id)
+	delete(m.factors, id)
+	return nil
+}
+
+func (m *mockMFAFactorStore) UpdateMFAFactorUsage(_ context.Context, id uuid.UUID, _ uint32) error {
+	now := time.Now()
+	m.factors[id].LastUsedAt = &now
+	return nil
+}
+
+func (m *mockMFAFactorStore) ReplaceMFARecoveryCodes(_ context.Context, _ uuid.UUID, hashes []string) error {
+	m.recoveryCodes = hashes
+	return nil
+}
+
+func (m *mockMFAFactorStore) ConsumeMFARecoveryCode(_ context.Context, _ uuid.UUID, hash string) (bool, error) {
+	for i, h := range m.recoveryCodes {
+		if h == hash {
+			m.recoveryCodes = append(m.recoveryCodes[:i], m.recoveryCodes[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockMFAFactorStore) RecordMFALoginFailure(_ context.Context, _ uuid.UUID, maxAttempts int, lockout time.Duration) (bool, error) {
+	m.mfaFailures++
+	if m.mfaFailures < maxAttempts {
+		return false, nil
+	}
+	m.mfaFailures = 0
+	until := time.Now().Add(lockout)
+	m.mfaLocked = &until
+	return true, nil
+}
+
+func (m *mockMFAFactorStore) GetMFALoginLockedUntil(_ context.Context, _ uuid.UUID) (*time.Time, error) {
+	return m.mfaLocked, nil
+}
+
+func (m *mockMFAFactorStore) ResetMFALoginFailures(_ context.Context, _ uuid.UUID) error {
+	m.mfaFailures = 0
+	return nil
+}
+
+func (m *mockMFAFactorStore) CountUnusedMFARecoveryCodes(_ context.Context, _ uuid.UUID) (int, error) {
+	return len(m.recoveryCodes), nil
+}
+
+func (m *mockMFAFactorStore) GetUserByID(_ context.Context, id uuid.UUID) (*models.User, error) {
+	return &models.User{ID: id, CreatedAt: time.Now()}, nil
+}
+
+func (m *mockMFAFactorStore) GetUserPasswordInfo(_ context.Context, userID uuid.UUID) (*models.UserPasswordInfo, error) {
+	return &models.UserPasswordInfo{UserID: userID, PasswordHash: m.passwordHash}, nil
+}
+
+func (m *mockMFAFactorStore) GetSecuritySettings(_ context.Context, _ uuid.UUID) (*settings.SecuritySettings, error) {
+	if m.security == nil {
+		s := settings.DefaultSecuritySettings()
+		return &s, nil
+	}
+	return m.security, nil
+}
+
+func (m *mockMFAFactorStore) CreateAuditLog(_ context.Context, _ *models.AuditLog) error {
+	return nil
+}
+
+// mfaTestCipher is a no-op secret cipher for handler tests.
+type mfaTestCipher struct{}
+
+func (mfaTestCipher) Encrypt(b []byte) ([]byte, error) { return b, nil }
+func (mfaTestCipher) Decrypt(b []byte) ([]byte, error) { return b, nil }
+
+func setupMFATestRouter(t *testing.T, store *mockMFAFactorStore, user *auth.SessionUser) *gin.Engine {
+	t.Helper()
+	r := SetupTestRouter(user)
+	webAuthn := auth.WebAuthnConfig{RPID: "localhost", RPName: "Keldris", Origins: []string{"http://localhost:8080"}}
+	verifier := auth.NewMFAVerifier(store, mfaTestCipher{}, webAuthn, zerolog.Nop())
+	handler := NewMFAHandler(store, verifier, newAuthTestSessionStore(t), zerolog.Nop())
+	handler.RegisterRoutes(r.Group("/api/v1"))
+	return r
+}
+
+func addConfirmedTOTP(store *mockMFAFactorStore, userID uuid.UUID, secret string) *models.UserMFAFactor {
+	f := models.NewTOTPFactor(userID, "app", []byte(secret))
+	confirmed := time.Now().Add(-time.Hour)
+	f.ConfirmedAt = &confirmed
+	store.factors[f.ID] = f
+	return f
+}
+
+func TestMFA_EnrollAndConfirmTOTP(t *testing.T) {
+	store := newMockMFAFactorStore()
+	user := TestUser(uuid.New())
+	r := setupMFATestRouter(t, store, user)
+
+	w := DoRequest(r, JSONRequest("POST", "/api/v1/mfa/totp", `{"name":"Phone"}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var enroll models.TOTPEnrollResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &enroll); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if enroll.Secret == "" || enroll.ProvisioningURI == "" {
+		t.Fatal("expected secret and provisioning URI")
+	}
+
+	t.Run("wrong code", func(t *testing.T) {
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/mfa/totp/"+enroll.FactorID.String()+"/confirm", `{"code":"abcdef"}`))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	code, _ := auth.GenerateTOTPCode(enroll.Secret, time.Now())
+	w = DoRequest(r, JSONRequest("POST", "/api/v1/mfa/totp/"+enroll.FactorID.String()+"/confirm", `{"code":"`+code+`"}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp MFAEnrollmentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(resp.RecoveryCodes) != auth.RecoveryCodeCount {
+		t.Errorf("expected %d recovery codes for first factor, got %d", auth.RecoveryCodeCount, len(resp.RecoveryCodes))
+	}
+	if !store.factors[enroll.FactorID].IsConfirmed() {
+		t.Error("expected factor to be confirmed")
+	}
+}
+
+func TestMFA_ConfirmOtherUsersFactor(t *testing.T) {
+	store := newMockMFAFactorStore()
+	other := models.NewTOTPFactor(uuid.New(), "app", []byte("JBSWY3DPEHPK3PXP"))
+	store.factors[other.ID] = other
+	r := setupMFATestRouter(t, store, TestUser(uuid.New()))
+
+	w := DoRequest(r, JSONRequest("POST", "/api/v1/mfa/totp/"+other.ID.String()+"/confirm", `{"code":"123456"}`))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMFA_StepUp(t *testing.T) {
+	hash, err := auth.HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword() error: %v", err)
+	}
+
+	t.Run("password without mfa", func(t *testing.T) {
+		store := newMockMFAFactorStore()
+		store.passwordHash = &hash
+		r := setupMFATestRouter(t, store, TestUser(uuid.New()))
+
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/mfa/step-up", `{"method":"password","password":"correct horse battery staple"}`))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		store := newMockMFAFactorStore()
+		store.passwordHash = &hash
+		r := setupMFATestRouter(t, store, TestUser(uuid.New()))
+
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/mfa/step-up", `{"method":"password","password":"nope"}`))
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("password refused when mfa enrolled", func(t *testing.T) {
+		store := newMockMFAFactorStore()
+		store.passwordHash = &hash
+		user := TestUser(uuid.New())
+		addConfirmedTOTP(store, user.ID, "JBSWY3DPEHPK3PXP")
+		r := setupMFATestRouter(t, store, user)
+
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/mfa/step-up", `{"method":"password","password":"correct horse battery staple"}`))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("totp", func(t *testing.T) {
+		store := newMockMFAFactorStore()
+		user := TestUser(uuid.New())
+		addConfirmedTOTP(store, user.ID, "JBSWY3DPEHPK3PXP")
+		r := setupMFATestRouter(t, store, user)
+
+		code, _ := auth.GenerateTOTPCode("JBSWY3DPEHPK3PXP", time.Now())
+		w := DoRequest(r, JSONRequest("POST", "/api/v1/mfa/step-up", `{"method":"totp","code":"`+code+`"}`))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp StepUpResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if !resp.ExpiresAt.After(resp.StepUpAt) {
+			t.Error("expected expiry after step-up time")
+		}
+	})
+}
+
+func TestMFA_DeleteLastFactorWhenRequired(t *testing.T) {
+	store := newMockMFAFactorStore()
+	required := settings.DefaultSecuritySettings()
+	required.RequireMFA = true
+	store.security = &required
+	user := TestUser(uuid.New())
+	factor := addConfirmedTOTP(store, user.ID, "JBSWY3DPEHPK3PXP")
+	r := setupMFATestRouter(t, store, user)
+
+	w := DoRequest(r, AuthenticatedRequest("DELETE", "/api/v1/mfa/factors/"+factor.ID.String()))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(store.deleted) != 0 {
+		t.Error("expected factor to be kept")
+	}
+}
+
+func TestMFA_DeleteLastFactorClearsRecoveryCodes(t *testing.T) {
+	store := newMockMFAFactorStore()
+	store.recoveryCodes = []string{"hash"}
+	user := TestUser(uuid.New())
+	factor := addConfirmedTOTP(store, user.ID, "JBSWY3DPEHPK3PXP")
+	r := setupMFATestRouter(t, store, user)
+
+	w := DoRequest(r, AuthenticatedRequest("DELETE", "/api/v1/mfa/factors/"+factor.ID.String()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(store.recoveryCodes) != 0 {
+		t.Error("expected recovery codes to be cleared")
+	}
+}
+
+func TestMFA_ImpersonationBlocked(t *testing.T) {
+	user := TestUser(uuid.New())
+	user.Impersonating = true
+	user.OriginalUserID = uuid.New()
+	r := setupMFATestRouter(t, newMockMFAFactorStore(), user)
+
+	w := DoRequest(r, JSONRequest("POST", "/api/v1/mfa/totp", `{}`))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMFA_Status(t *testing.T) {
+	store := newMockMFAFactorStore()
+	required := settings.DefaultSecuritySettings()
+	required.RequireMFA = true
+	store.security = &required
+	r := setupMFATestRouter(t, store, TestUser(uuid.New()))
+
+	w := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/mfa"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp models.MFAStatusResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.Enabled || !resp.EnrollmentRequired || resp.EnrollmentDeadline == nil {
+		t.Errorf("unexpected status: %+v", resp)
+	}
+}
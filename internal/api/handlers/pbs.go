@@ -0,0 +1,1007 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/backup/vms"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// PBSStore defines the interface for Proxmox Backup Server connection persistence operations.
+type PBSStore interface {
+	CreatePBSConnection(ctx context.Context, conn *models.PBSConnection) error
+	GetPBSConnectionByID(ctx context.Context, id uuid.UUID) (*models.PBSConnection, error)
+	GetPBSConnectionsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.PBSConnection, error)
+	UpdatePBSConnection(ctx context.Context, conn *models.PBSConnection) error
+	DeletePBSConnection(ctx context.Context, id uuid.UUID) error
+}
+
+// PBSHandler handles Proxmox Backup Server HTTP endpoints: connection
+// management, browsing datastores and snapshots, and running verification,
+// pruning and garbage collection on a managed datastore.
+type PBSHandler struct {
+	store      PBSStore
+	encryption EncryptionService
+	approvals  ApprovalGate
+	logger     zerolog.Logger
+}
+
+// NewPBSHandler creates a new PBSHandler.
+func NewPBSHandler(store PBSStore, encryption EncryptionService, logger zerolog.Logger) *PBSHandler {
+	return &PBSHandler{
+		store:      store,
+		encryption: encryption,
+		logger:     logger.With().Str("component", "pbs_handler").Logger(),
+	}
+}
+
+// SetApprovalGate enables four-eyes approval for pruning a PBS datastore.
+func (h *PBSHandler) SetApprovalGate(gate ApprovalGate) {
+	h.approvals = gate
+	gate.Register(models.ApprovalActionPBSPrune, h.executeApprovedPrune)
+}
+
+// RegisterRoutes registers Proxmox Backup Server routes on the given router group.
+func (h *PBSHandler) RegisterRoutes(r *gin.RouterGroup) {
+	connections := r.Group("/pbs/connections")
+	{
+		connections.GET("", h.ListConnections)
+		connections.POST("", h.CreateConnection)
+		connections.GET("/:id", h.GetConnection)
+		connections.PUT("/:id", h.UpdateConnection)
+		connections.DELETE("/:id", h.DeleteConnection)
+		connections.POST("/:id/test", h.TestConnection)
+		connections.GET("/:id/datastores", h.ListDatastores)
+		connections.GET("/:id/namespaces", h.ListNamespaces)
+		connections.GET("/:id/snapshots", h.ListSnapshots)
+		connections.POST("/:id/verify", h.Verify)
+		connections.POST("/:id/prune", h.Prune)
+		connections.POST("/:id/gc", h.GarbageCollect)
+		connections.GET("/:id/tasks/:upid", h.GetTask)
+	}
+}
+
+// PBSCreateConnectionRequest is the request body for creating a PBS connection.
+type PBSCreateConnectionRequest struct {
+	Name               string                  `json:"name" binding:"required,min=1,max=255"`
+	Host               string                  `json:"host" binding:"required"`
+	Port               int                     `json:"port,omitempty"`
+	Username           string                  `json:"username" binding:"required"`
+	TokenID            string                  `json:"token_id" binding:"required"`
+	TokenSecret        string                  `json:"token_secret" binding:"required"`
+	Fingerprint        string                  `json:"fingerprint,omitempty"`
+	VerifySSL          *bool                   `json:"verify_ssl,omitempty"`
+	Datastore          string                  `json:"datastore" binding:"required"`
+	Namespace          string                  `json:"namespace,omitempty"`
+	Retention          *models.RetentionPolicy `json:"retention,omitempty"`
+	VerifyOutdatedDays int                     `json:"verify_outdated_days,omitempty"`
+}
+
+// PBSUpdateConnectionRequest is the request body for updating a PBS connection.
+type PBSUpdateConnectionRequest struct {
+	Name               string                  `json:"name,omitempty"`
+	Host               string                  `json:"host,omitempty"`
+	Port               *int                    `json:"port,omitempty"`
+	Username           string                  `json:"username,omitempty"`
+	TokenID            string                  `json:"token_id,omitempty"`
+	TokenSecret        string                  `json:"token_secret,omitempty"`
+	Fingerprint        *string                 `json:"fingerprint,omitempty"`
+	VerifySSL          *bool                   `json:"verify_ssl,omitempty"`
+	Datastore          string                  `json:"datastore,omitempty"`
+	Namespace          *string                 `json:"namespace,omitempty"`
+	Retention          *models.RetentionPolicy `json:"retention,omitempty"`
+	VerifyOutdatedDays *int                    `json:"verify_outdated_days,omitempty"`
+	Enabled            *bool                   `json:"enabled,omitempty"`
+}
+
+// PBSConnectionResponse is the response for a PBS connection (excludes sensitive data).
+type PBSConnectionResponse struct {
+	ID                 uuid.UUID               `json:"id"`
+	OrgID              uuid.UUID               `json:"org_id"`
+	Name               string                  `json:"name"`
+	Host               string                  `json:"host"`
+	Port               int                     `json:"port"`
+	Username           string                  `json:"username"`
+	TokenID            string                  `json:"token_id,omitempty"`
+	HasToken           bool                    `json:"has_token"`
+	Fingerprint        string                  `json:"fingerprint,omitempty"`
+	VerifySSL          bool                    `json:"verify_ssl"`
+	Datastore          string                  `json:"datastore"`
+	Namespace          string                  `json:"namespace,omitempty"`
+	Retention          *models.RetentionPolicy `json:"retention,omitempty"`
+	VerifyOutdatedDays int                     `json:"verify_outdated_days,omitempty"`
+	Enabled            bool                    `json:"enabled"`
+	LastConnectedAt    *string                 `json:"last_connected_at,omitempty"`
+	CreatedAt          string                  `json:"created_at"`
+	UpdatedAt          string                  `json:"updated_at"`
+}
+
+// toPBSResponse converts a PBSConnection to a response (without sensitive data).
+func toPBSResponse(conn *models.PBSConnection) PBSConnectionResponse {
+	resp := PBSConnectionResponse{
+		ID:                 conn.ID,
+		OrgID:              conn.OrgID,
+		Name:               conn.Name,
+		Host:               conn.Host,
+		Port:               conn.Port,
+		Username:           conn.Username,
+		TokenID:            conn.TokenID,
+		HasToken:           conn.HasTokenAuth(),
+		Fingerprint:        conn.Fingerprint,
+		VerifySSL:          conn.VerifySSL,
+		Datastore:          conn.Datastore,
+		Namespace:          conn.Namespace,
+		Retention:          conn.Retention,
+		VerifyOutdatedDays: conn.VerifyOutdatedDays,
+		Enabled:            conn.Enabled,
+		CreatedAt:          conn.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:          conn.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if conn.LastConnectedAt != nil {
+		t := conn.LastConnectedAt.Format("2006-01-02T15:04:05Z07:00")
+		resp.LastConnectedAt = &t
+	}
+	return resp
+}
+
+// validatePBSRetention rejects negative keep counts.
+func validatePBSRetention(policy *models.RetentionPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	for _, keep := range []int{policy.KeepLast, policy.KeepHourly, policy.KeepDaily, policy.KeepWeekly, policy.KeepMonthly, policy.KeepYearly} {
+		if keep < 0 {
+			return errors.New("retention keep counts must not be negative")
+		}
+	}
+	return nil
+}
+
+// getConnection loads a connection owned by the user's organization and
+// writes the error response if there is none.
+func (h *PBSHandler) getConnection(c *gin.Context) (*models.PBSConnection, bool) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return nil, false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid connection ID"})
+		return nil, false
+	}
+
+	conn, err := h.store.GetPBSConnectionByID(c.Request.Context(), id)
+	if err != nil || conn.OrgID != user.CurrentOrgID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "connection not found"})
+		return nil, false
+	}
+
+	return conn, true
+}
+
+// getAdminConnection is getConnection for routes that change the connection
+// or delete data on the server, which are limited to organization admins.
+func (h *PBSHandler) getAdminConnection(c *gin.Context) (*models.PBSConnection, bool) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return nil, false
+	}
+	if !isAdmin(user.CurrentOrgRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return nil, false
+	}
+	return h.getConnection(c)
+}
+
+// client decrypts the connection's token and creates an API client.
+func (h *PBSHandler) client(c *gin.Context, conn *models.PBSConnection) (*vms.PBSClient, bool) {
+	client, err := h.newClient(conn)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to decrypt token secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decrypt credentials"})
+		return nil, false
+	}
+	return client, true
+}
+
+// newClient creates an API client with the connection's decrypted token.
+func (h *PBSHandler) newClient(conn *models.PBSConnection) (*vms.PBSClient, error) {
+	var tokenSecret string
+	if len(conn.TokenSecretEncrypted) > 0 {
+		decrypted, err := h.encryption.Decrypt(conn.TokenSecretEncrypted)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt token secret: %w", err)
+		}
+		tokenSecret = string(decrypted)
+	}
+	return vms.NewPBSClientFromConnection(conn, tokenSecret, h.logger), nil
+}
+
+// ListConnections returns all PBS connections for the user's organization.
+//
+//	@Summary		List PBS connections
+//	@Description	Returns all Proxmox Backup Server connections for the current organization
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	map[string][]PBSConnectionResponse
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections [get]
+func (h *PBSHandler) ListConnections(c *gin.Context) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return
+	}
+
+	if user.CurrentOrgID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no organization selected"})
+		return
+	}
+
+	connections, err := h.store.GetPBSConnectionsByOrgID(c.Request.Context(), user.CurrentOrgID)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to list PBS connections")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list connections"})
+		return
+	}
+
+	responses := make([]PBSConnectionResponse, len(connections))
+	for i, conn := range connections {
+		responses[i] = toPBSResponse(conn)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"connections": responses})
+}
+
+// GetConnection returns a specific PBS connection by ID.
+//
+//	@Summary		Get PBS connection
+//	@Description	Returns a specific Proxmox Backup Server connection by ID
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		string	true	"Connection ID"
+//	@Success		200	{object}	PBSConnectionResponse
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections/{id} [get]
+func (h *PBSHandler) GetConnection(c *gin.Context) {
+	conn, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, toPBSResponse(conn))
+}
+
+// CreateConnection creates a new PBS connection.
+//
+//	@Summary		Create PBS connection
+//	@Description	Creates a new Proxmox Backup Server connection for the organization
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		PBSCreateConnectionRequest	true	"Connection details"
+//	@Success		201		{object}	PBSConnectionResponse
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections [post]
+func (h *PBSHandler) CreateConnection(c *gin.Context) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return
+	}
+
+	if user.CurrentOrgID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no organization selected"})
+		return
+	}
+	if !isAdmin(user.CurrentOrgRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return
+	}
+
+	var req PBSCreateConnectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	if err := validatePBSRetention(req.Retention); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.VerifyOutdatedDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "verify_outdated_days must not be negative"})
+		return
+	}
+
+	port := req.Port
+	if port == 0 {
+		port = vms.DefaultPBSPort
+	}
+
+	conn := models.NewPBSConnection(user.CurrentOrgID, req.Name, req.Host, port, req.Username, req.Datastore)
+	conn.Fingerprint = req.Fingerprint
+	conn.Namespace = req.Namespace
+	conn.Retention = req.Retention
+	conn.VerifyOutdatedDays = req.VerifyOutdatedDays
+	if req.VerifySSL != nil {
+		conn.VerifySSL = *req.VerifySSL
+	}
+
+	encrypted, err := h.encryption.Encrypt([]byte(req.TokenSecret))
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to encrypt token secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encrypt credentials"})
+		return
+	}
+	conn.SetTokenAuth(req.TokenID, encrypted)
+
+	if err := h.store.CreatePBSConnection(c.Request.Context(), conn); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create PBS connection")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create connection"})
+		return
+	}
+
+	h.logger.Info().
+		Str("connection_id", conn.ID.String()).
+		Str("name", conn.Name).
+		Str("host", conn.Host).
+		Str("datastore", conn.Datastore).
+		Msg("PBS connection created")
+
+	c.JSON(http.StatusCreated, toPBSResponse(conn))
+}
+
+// UpdateConnection updates an existing PBS connection.
+//
+//	@Summary		Update PBS connection
+//	@Description	Updates an existing Proxmox Backup Server connection, including its retention and verification settings
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string						true	"Connection ID"
+//	@Param			request	body		PBSUpdateConnectionRequest	true	"Connection updates"
+//	@Success		200		{object}	PBSConnectionResponse
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections/{id} [put]
+func (h *PBSHandler) UpdateConnection(c *gin.Context) {
+	conn, ok := h.getAdminConnection(c)
+	if !ok {
+		return
+	}
+
+	var req PBSUpdateConnectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	if err := validatePBSRetention(req.Retention); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.VerifyOutdatedDays != nil && *req.VerifyOutdatedDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "verify_outdated_days must not be negative"})
+		return
+	}
+
+	if req.Name != "" {
+		conn.Name = req.Name
+	}
+	if req.Host != "" {
+		conn.Host = req.Host
+	}
+	if req.Port != nil {
+		conn.Port = *req.Port
+	}
+	if req.Username != "" {
+		conn.Username = req.Username
+	}
+	if req.Fingerprint != nil {
+		conn.Fingerprint = *req.Fingerprint
+	}
+	if req.VerifySSL != nil {
+		conn.VerifySSL = *req.VerifySSL
+	}
+	if req.Datastore != "" {
+		conn.Datastore = req.Datastore
+	}
+	if req.Namespace != nil {
+		conn.Namespace = *req.Namespace
+	}
+	if req.Retention != nil {
+		conn.Retention = req.Retention
+	}
+	if req.VerifyOutdatedDays != nil {
+		conn.VerifyOutdatedDays = *req.VerifyOutdatedDays
+	}
+	if req.Enabled != nil {
+		conn.Enabled = *req.Enabled
+	}
+
+	if req.TokenID != "" {
+		conn.TokenID = req.TokenID
+	}
+	if req.TokenSecret != "" {
+		encrypted, err := h.encryption.Encrypt([]byte(req.TokenSecret))
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to encrypt token secret")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encrypt credentials"})
+			return
+		}
+		conn.TokenSecretEncrypted = encrypted
+	}
+
+	if err := h.store.UpdatePBSConnection(c.Request.Context(), conn); err != nil {
+		h.logger.Error().Err(err).Msg("failed to update PBS connection")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update connection"})
+		return
+	}
+
+	h.logger.Info().Str("connection_id", conn.ID.String()).Msg("PBS connection updated")
+	c.JSON(http.StatusOK, toPBSResponse(conn))
+}
+
+// DeleteConnection removes a PBS connection.
+//
+//	@Summary		Delete PBS connection
+//	@Description	Removes a Proxmox Backup Server connection. Data on the server is not touched.
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		string	true	"Connection ID"
+//	@Success		200	{object}	map[string]string
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections/{id} [delete]
+func (h *PBSHandler) DeleteConnection(c *gin.Context) {
+	conn, ok := h.getAdminConnection(c)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeletePBSConnection(c.Request.Context(), conn.ID); err != nil {
+		h.logger.Error().Err(err).Msg("failed to delete PBS connection")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete connection"})
+		return
+	}
+
+	h.logger.Info().Str("connection_id", conn.ID.String()).Msg("PBS connection deleted")
+	c.JSON(http.StatusOK, gin.H{"message": "connection deleted"})
+}
+
+// TestConnection tests the connection to a PBS server.
+//
+//	@Summary		Test PBS connection
+//	@Description	Tests the connection to a Proxmox Backup Server
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		string	true	"Connection ID"
+//	@Success		200	{object}	TestProxmoxConnectionResponse
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections/{id}/test [post]
+func (h *PBSHandler) TestConnection(c *gin.Context) {
+	conn, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+	client, ok := h.client(c, conn)
+	if !ok {
+		return
+	}
+
+	version, err := client.GetVersion(c.Request.Context())
+	if err != nil {
+		h.logger.Warn().Err(err).Str("connection_id", conn.ID.String()).Msg("PBS connection test failed")
+		c.JSON(http.StatusOK, TestProxmoxConnectionResponse{
+			Success: false,
+			Message: "Connection failed: " + err.Error(),
+		})
+		return
+	}
+
+	conn.MarkConnected()
+	if err := h.store.UpdatePBSConnection(c.Request.Context(), conn); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to update last connected timestamp")
+	}
+
+	c.JSON(http.StatusOK, TestProxmoxConnectionResponse{
+		Success: true,
+		Version: version.Version,
+		Message: "Connection successful",
+	})
+}
+
+// ListDatastores lists the datastores on a PBS server.
+//
+//	@Summary		List PBS datastores
+//	@Description	Lists the datastores the connection's API token can access, with usage
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		string	true	"Connection ID"
+//	@Success		200	{object}	map[string][]vms.PBSDatastore
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections/{id}/datastores [get]
+func (h *PBSHandler) ListDatastores(c *gin.Context) {
+	conn, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+	client, ok := h.client(c, conn)
+	if !ok {
+		return
+	}
+
+	stores, err := client.ListDatastores(c.Request.Context())
+	if err != nil {
+		h.logger.Error().Err(err).Str("connection_id", conn.ID.String()).Msg("failed to list PBS datastores")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list datastores: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"datastores": stores})
+}
+
+// ListNamespaces lists the namespaces in a datastore.
+//
+//	@Summary		List PBS namespaces
+//	@Description	Lists the namespaces in a datastore (default: the connection's datastore)
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		string	true	"Connection ID"
+//	@Param			datastore	query		string	false	"Datastore name"
+//	@Success		200			{object}	map[string][]vms.PBSNamespace
+//	@Failure		400			{object}	map[string]string
+//	@Failure		401			{object}	map[string]string
+//	@Failure		404			{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections/{id}/namespaces [get]
+func (h *PBSHandler) ListNamespaces(c *gin.Context) {
+	conn, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+	client, ok := h.client(c, conn)
+	if !ok {
+		return
+	}
+
+	store := c.DefaultQuery("datastore", conn.Datastore)
+	namespaces, err := client.ListNamespaces(c.Request.Context(), store)
+	if err != nil {
+		h.logger.Error().Err(err).Str("connection_id", conn.ID.String()).Msg("failed to list PBS namespaces")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list namespaces: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"datastore": store, "namespaces": namespaces})
+}
+
+// ListSnapshots lists the snapshots in a datastore namespace.
+//
+//	@Summary		List PBS snapshots
+//	@Description	Lists snapshots, oldest first, optionally limited to one backup group
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		string	true	"Connection ID"
+//	@Param			datastore	query		string	false	"Datastore name"
+//	@Param			namespace	query		string	false	"Namespace"
+//	@Param			backup_type	query		string	false	"Backup type: vm, ct or host"
+//	@Param			backup_id	query		string	false	"Backup ID, such as a VMID"
+//	@Success		200			{object}	map[string][]vms.PBSSnapshot
+//	@Failure		400			{object}	map[string]string
+//	@Failure		401			{object}	map[string]string
+//	@Failure		404			{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections/{id}/snapshots [get]
+func (h *PBSHandler) ListSnapshots(c *gin.Context) {
+	conn, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	filter := vms.PBSSnapshotFilter{
+		Namespace:  c.DefaultQuery("namespace", conn.Namespace),
+		BackupType: c.Query("backup_type"),
+		BackupID:   c.Query("backup_id"),
+	}
+	if !validPBSBackupType(filter.BackupType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "backup_type must be vm, ct or host"})
+		return
+	}
+
+	client, ok := h.client(c, conn)
+	if !ok {
+		return
+	}
+
+	store := c.DefaultQuery("datastore", conn.Datastore)
+	snapshots, err := client.ListSnapshots(c.Request.Context(), store, filter)
+	if err != nil {
+		h.logger.Error().Err(err).Str("connection_id", conn.ID.String()).Msg("failed to list PBS snapshots")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list snapshots: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"datastore": store, "namespace": filter.Namespace, "snapshots": snapshots})
+}
+
+// validPBSBackupType reports whether t is empty or a PBS backup type.
+func validPBSBackupType(t string) bool {
+	return t == "" || t == "vm" || t == "ct" || t == "host"
+}
+
+// PBSVerifyRequest is the request body for starting verification.
+type PBSVerifyRequest struct {
+	Datastore  string  `json:"datastore,omitempty"`
+	Namespace  *string `json:"namespace,omitempty"`
+	BackupType string  `json:"backup_type,omitempty"`
+	BackupID   string  `json:"backup_id,omitempty"`
+	// All re-verifies every snapshot instead of only unverified ones and
+	// those last verified more than verify_outdated_days ago.
+	All bool `json:"all,omitempty"`
+}
+
+// PBSTaskResponse is returned when a task is started on the server.
+type PBSTaskResponse struct {
+	UPID      string `json:"upid"`
+	Datastore string `json:"datastore"`
+}
+
+// Verify starts a verification task on the datastore.
+//
+//	@Summary		Verify PBS snapshots
+//	@Description	Starts verification of a datastore namespace or one backup group, skipping snapshots verified within the connection's verify_outdated_days unless all is set
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string				true	"Connection ID"
+//	@Param			request	body		PBSVerifyRequest	false	"Verification scope"
+//	@Success		202		{object}	PBSTaskResponse
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections/{id}/verify [post]
+func (h *PBSHandler) Verify(c *gin.Context) {
+	conn, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+
+	var req PBSVerifyRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+	}
+	if !validPBSBackupType(req.BackupType) || (req.BackupID != "" && req.BackupType == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "backup_id requires backup_type vm, ct or host"})
+		return
+	}
+
+	client, ok := h.client(c, conn)
+	if !ok {
+		return
+	}
+
+	store := pbsDatastore(req.Datastore, conn)
+	opts := vms.PBSVerifyOptions{
+		Namespace:         conn.Namespace,
+		BackupType:        req.BackupType,
+		BackupID:          req.BackupID,
+		IgnoreVerified:    !req.All,
+		OutdatedAfterDays: conn.VerifyOutdatedDays,
+	}
+	if req.Namespace != nil {
+		opts.Namespace = *req.Namespace
+	}
+
+	upid, err := client.Verify(c.Request.Context(), store, opts)
+	if err != nil {
+		h.logger.Error().Err(err).Str("connection_id", conn.ID.String()).Msg("failed to start PBS verification")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start verification: " + err.Error()})
+		return
+	}
+
+	h.logger.Info().Str("connection_id", conn.ID.String()).Str("datastore", store).Str("upid", upid).Msg("PBS verification started")
+	c.JSON(http.StatusAccepted, PBSTaskResponse{UPID: upid, Datastore: store})
+}
+
+// PBSPruneRequest is the request body for pruning a datastore namespace.
+type PBSPruneRequest struct {
+	Datastore string  `json:"datastore,omitempty"`
+	Namespace *string `json:"namespace,omitempty"`
+	DryRun    bool    `json:"dry_run,omitempty"`
+}
+
+// PBSPruneResponse lists the prune decisions for every snapshot.
+type PBSPruneResponse struct {
+	Datastore string             `json:"datastore"`
+	Namespace string             `json:"namespace,omitempty"`
+	DryRun    bool               `json:"dry_run"`
+	Kept      int                `json:"kept"`
+	Removed   int                `json:"removed"`
+	Snapshots []vms.PBSPruneItem `json:"snapshots"`
+	Errors    []string           `json:"errors,omitempty"`
+}
+
+// Prune applies the connection's retention policy to every backup group.
+//
+//	@Summary		Prune PBS snapshots
+//	@Description	Applies the connection's retention policy to every backup group in the datastore namespace. Run garbage collection afterwards to free space.
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string			true	"Connection ID"
+//	@Param			request	body		PBSPruneRequest	false	"Prune scope"
+//	@Success		200		{object}	PBSPruneResponse
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections/{id}/prune [post]
+func (h *PBSHandler) Prune(c *gin.Context) {
+	conn, ok := h.getAdminConnection(c)
+	if !ok {
+		return
+	}
+
+	var req PBSPruneRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+	}
+
+	if conn.Retention == nil || *conn.Retention == (models.RetentionPolicy{}) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "connection has no retention policy"})
+		return
+	}
+
+	if !req.DryRun {
+		user := middleware.RequireUser(c)
+		approvalReq := models.NewApprovalRequest(user.CurrentOrgID, user.ID, models.ApprovalActionPBSPrune,
+			"pbs_connection", conn.ID.String(), fmt.Sprintf("Prune datastore %s on %s", pbsDatastore(req.Datastore, conn), conn.Name))
+		if err := approvalReq.SetPayload(req); err != nil {
+			h.logger.Error().Err(err).Msg("failed to encode prune request")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to submit approval request"})
+			return
+		}
+		if requestApproval(c, h.approvals, h.logger, approvalReq) {
+			return
+		}
+	}
+
+	client, ok := h.client(c, conn)
+	if !ok {
+		return
+	}
+
+	resp, err := h.prune(c.Request.Context(), client, conn, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list backup groups: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// executeApprovedPrune runs a prune once it has been approved. The
+// connection is loaded again because its retention policy may have changed.
+func (h *PBSHandler) executeApprovedPrune(ctx context.Context, approvalReq *models.ApprovalRequest) error {
+	var req PBSPruneRequest
+	if err := json.Unmarshal(approvalReq.Payload, &req); err != nil {
+		return fmt.Errorf("decode prune request: %w", err)
+	}
+	req.DryRun = false
+
+	id, err := uuid.Parse(approvalReq.ResourceID)
+	if err != nil {
+		return fmt.Errorf("invalid connection ID: %w", err)
+	}
+	conn, err := h.store.GetPBSConnectionByID(ctx, id)
+	if err != nil || conn.OrgID != approvalReq.OrgID {
+		return errors.New("connection not found")
+	}
+	if conn.Retention == nil || *conn.Retention == (models.RetentionPolicy{}) {
+		return errors.New("connection has no retention policy")
+	}
+
+	client, err := h.newClient(conn)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.prune(ctx, client, conn, req)
+	if err != nil {
+		return fmt.Errorf("list backup groups: %w", err)
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("%d backup groups failed to prune: %s", len(resp.Errors), resp.Errors[0])
+	}
+	return nil
+}
+
+// prune applies the connection's retention policy to every backup group in
+// the requested namespace. Failures of single groups are collected in the
+// response; only failing to list the groups is returned as an error.
+func (h *PBSHandler) prune(ctx context.Context, client *vms.PBSClient, conn *models.PBSConnection, req PBSPruneRequest) (PBSPruneResponse, error) {
+	store := pbsDatastore(req.Datastore, conn)
+	namespace := conn.Namespace
+	if req.Namespace != nil {
+		namespace = *req.Namespace
+	}
+
+	groups, err := client.ListGroups(ctx, store, namespace)
+	if err != nil {
+		h.logger.Error().Err(err).Str("connection_id", conn.ID.String()).Msg("failed to list PBS groups")
+		return PBSPruneResponse{}, err
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].BackupType != groups[j].BackupType {
+			return groups[i].BackupType < groups[j].BackupType
+		}
+		return groups[i].BackupID < groups[j].BackupID
+	})
+
+	resp := PBSPruneResponse{Datastore: store, Namespace: namespace, DryRun: req.DryRun, Snapshots: []vms.PBSPruneItem{}}
+	for _, group := range groups {
+		items, err := client.Prune(ctx, store, namespace, group.BackupType, group.BackupID, conn.Retention, req.DryRun)
+		if err != nil {
+			resp.Errors = append(resp.Errors, err.Error())
+			continue
+		}
+		for _, item := range items {
+			if item.Keep {
+				resp.Kept++
+			} else {
+				resp.Removed++
+			}
+		}
+		resp.Snapshots = append(resp.Snapshots, items...)
+	}
+
+	h.logger.Info().
+		Str("connection_id", conn.ID.String()).
+		Str("datastore", store).
+		Bool("dry_run", req.DryRun).
+		Int("kept", resp.Kept).
+		Int("removed", resp.Removed).
+		Int("errors", len(resp.Errors)).
+		Msg("PBS prune completed")
+
+	return resp, nil
+}
+
+// PBSDatastoreRequest names the datastore for a datastore-wide task.
+type PBSDatastoreRequest struct {
+	Datastore string `json:"datastore,omitempty"`
+}
+
+// GarbageCollect starts garbage collection on the datastore.
+//
+//	@Summary		Run PBS garbage collection
+//	@Description	Starts garbage collection on a datastore to free chunks no longer referenced after pruning
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string				true	"Connection ID"
+//	@Param			request	body		PBSDatastoreRequest	false	"Datastore"
+//	@Success		202		{object}	PBSTaskResponse
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections/{id}/gc [post]
+func (h *PBSHandler) GarbageCollect(c *gin.Context) {
+	conn, ok := h.getAdminConnection(c)
+	if !ok {
+		return
+	}
+
+	var req PBSDatastoreRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+			return
+		}
+	}
+
+	client, ok := h.client(c, conn)
+	if !ok {
+		return
+	}
+
+	store := pbsDatastore(req.Datastore, conn)
+	upid, err := client.GarbageCollect(c.Request.Context(), store)
+	if err != nil {
+		h.logger.Error().Err(err).Str("connection_id", conn.ID.String()).Msg("failed to start PBS garbage collection")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start garbage collection: " + err.Error()})
+		return
+	}
+
+	h.logger.Info().Str("connection_id", conn.ID.String()).Str("datastore", store).Str("upid", upid).Msg("PBS garbage collection started")
+	c.JSON(http.StatusAccepted, PBSTaskResponse{UPID: upid, Datastore: store})
+}
+
+// GetTask returns the status of a PBS task.
+//
+//	@Summary		Get PBS task status
+//	@Description	Returns the status of a verification or garbage collection task
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string	true	"Connection ID"
+//	@Param			upid	path		string	true	"Task UPID"
+//	@Success		200		{object}	vms.PBSTask
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/pbs/connections/{id}/tasks/{upid} [get]
+func (h *PBSHandler) GetTask(c *gin.Context) {
+	conn, ok := h.getConnection(c)
+	if !ok {
+		return
+	}
+	client, ok := h.client(c, conn)
+	if !ok {
+		return
+	}
+
+	task, err := client.GetTaskStatus(c.Request.Context(), c.Param("upid"))
+	if err != nil {
+		h.logger.Error().Err(err).Str("connection_id", conn.ID.String()).Msg("failed to get PBS task status")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get task status: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
+
+// pbsDatastore returns the requested datastore or the connection's default.
+func pbsDatastore(requested string, conn *models.PBSConnection) string {
+	if requested != "" {
+		return requested
+	}
+	return conn.Datastore
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/approval"
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockPBSStore struct {
+	conn    *models.PBSConnection
+	conns   []*models.PBSConnection
+	updated *models.PBSConnection
+	err     error
+}
+
+func (m *mockPBSStore) CreatePBSConnection(_ context.Context, c *models.PBSConnection) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.conn = c
+	return nil
+}
+
+func (m *mockPBSStore) GetPBSConnectionByID(_ context.Context, _ uuid.UUID) (*models.PBSConnection, error) {
+	if m.conn == nil {
+		return nil, errors.New("not found")
+	}
+	return m.conn, m.err
+}
+
+func (m *mockPBSStore) GetPBSConnectionsByOrgID(_ context.Context, _ uuid.UUID) ([]*models.PBSConnection, error) {
+	return m.conns, m.err
+}
+
+func (m *mockPBSStore) UpdatePBSConnection(_ context.Context, c *models.PBSConnection) error {
+	m.updated = c
+	return m.err
+}
+
+func (m *mockPBSStore) DeletePBSConnection(_ context.Context, _ uuid.UUID) error {
+	return m.err
+}
+
+func setupPBSTestRouter(store PBSStore, user *auth.SessionUser) *gin.Engine {
+	r := SetupTestRouter(user)
+	handler := NewPBSHandler(store, &noopEncryption{}, zerolog.Nop())
+	api := r.Group("/api/v1")
+	handler.RegisterRoutes(api)
+	return r
+}
+
+// pbsStandIn serves the PBS API calls made by the handler and records
+// the form of every POST.
+func pbsStandIn(t *testing.T, orgID uuid.UUID) (*models.PBSConnection, *[]url.Values) {
+	t.Helper()
+	var posts []url.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api2/json/admin/datastore/backups/groups", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": []map[string]string{
+			{"backup-type": "vm", "backup-id": "101"},
+			{"backup-type": "ct", "backup-id": "200"},
+		}})
+	})
+	mux.HandleFunc("/api2/json/admin/datastore/backups/prune", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		posts = append(posts, r.PostForm)
+		if r.PostForm.Get("backup-id") == "101" {
+			http.Error(w, "group is locked", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": []map[string]interface{}{
+			{"backup-type": "ct", "backup-id": "200", "backup-time": 2, "keep": true},
+			{"backup-type": "ct", "backup-id": "200", "backup-time": 1, "keep": false},
+		}})
+	})
+	mux.HandleFunc("/api2/json/admin/datastore/backups/verify", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		posts = append(posts, r.PostForm)
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": "UPID:pbs:verify"})
+	})
+	ts := httptest.NewTLSServer(mux)
+	t.Cleanup(ts.Close)
+
+	u, _ := url.Parse(ts.URL)
+	host, portStr, _ := net.SplitHostPort(u.Host)
+	port, _ := strconv.Atoi(portStr)
+	conn := models.NewPBSConnection(orgID, "pbs", host, port, "backup@pbs", "backups")
+	conn.VerifySSL = false
+	conn.Namespace = "prod"
+	conn.VerifyOutdatedDays = 30
+	conn.SetTokenAuth("keldris", []byte("secret"))
+	return conn, &posts
+}
+
+func TestPBSCreateConnection(t *testing.T) {
+	user := testUser(uuid.New())
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"invalid json", `{invalid`, http.StatusBadRequest},
+		{"missing token", `{"name":"pbs","host":"pbs.lan","username":"backup@pbs","datastore":"backups"}`, http.StatusBadRequest},
+		{"negative retention", `{"name":"pbs","host":"pbs.lan","username":"backup@pbs","token_id":"k","token_secret":"s","datastore":"backups","retention":{"keep_last":-1}}`, http.StatusBadRequest},
+		{"valid", `{"name":"pbs","host":"pbs.lan","username":"backup@pbs","token_id":"k","token_secret":"s","datastore":"backups","retention":{"keep_daily":7}}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mockPBSStore{}
+			r := setupPBSTestRouter(store, user)
+
+			resp := DoRequest(r, JSONRequest("POST", "/api/v1/pbs/connections", tt.body))
+			if resp.Code != tt.code {
+				t.Fatalf("expected %d, got %d: %s", tt.code, resp.Code, resp.Body.String())
+			}
+			if tt.code != http.StatusCreated {
+				return
+			}
+			if store.conn.Port != 8007 || string(store.conn.TokenSecretEncrypted) != "s" || store.conn.Retention.KeepDaily != 7 {
+				t.Errorf("stored connection = %+v", store.conn)
+			}
+			if strings.Contains(resp.Body.String(), `"s"`) || !strings.Contains(resp.Body.String(), `"has_token":true`) {
+				t.Errorf("response = %s", resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestPBSGetConnection_OtherOrg(t *testing.T) {
+	store := &mockPBSStore{conn: models.NewPBSConnection(uuid.New(), "pbs", "pbs.lan", 8007, "backup@pbs", "backups")}
+	r := setupPBSTestRouter(store, testUser(uuid.New()))
+
+	resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/pbs/connections/"+store.conn.ID.String()))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.Code)
+	}
+}
+
+func TestPBSPrune(t *testing.T) {
+	orgID := uuid.New()
+	conn, posts := pbsStandIn(t, orgID)
+	store := &mockPBSStore{conn: conn}
+	r := setupPBSTestRouter(store, testUser(orgID))
+	path := "/api/v1/pbs/connections/" + conn.ID.String() + "/prune"
+
+	resp := DoRequest(r, JSONRequest("POST", path, `{"dry_run":true}`))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without retention, got %d", resp.Code)
+	}
+
+	conn.Retention = &models.RetentionPolicy{KeepLast: 2, KeepWeekly: 4}
+	resp = DoRequest(r, JSONRequest("POST", path, `{"dry_run":true}`))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	var body PBSPruneResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Kept != 1 || body.Removed != 1 || !body.DryRun || body.Namespace != "prod" {
+		t.Errorf("response = %+v", body)
+	}
+	if len(body.Errors) != 1 || !strings.Contains(body.Errors[0], "vm/101") {
+		t.Errorf("errors = %v, want the locked group", body.Errors)
+	}
+
+	// Groups are pruned in order with the connection's policy.
+	if len(*posts) != 2 {
+		t.Fatalf("got %d prune calls, want 2", len(*posts))
+	}
+	want := url.Values{"backup-type": {"ct"}, "backup-id": {"200"}, "ns": {"prod"}, "keep-last": {"2"}, "keep-weekly": {"4"}, "dry-run": {"true"}}
+	if got := (*posts)[0]; got.Encode() != want.Encode() {
+		t.Errorf("prune form = %v, want %v", got, want)
+	}
+}
+
+func TestPBS_RequiresAdmin(t *testing.T) {
+	orgID := uuid.New()
+	conn := models.NewPBSConnection(orgID, "pbs", "pbs.lan", 8007, "backup@pbs", "backups")
+	conn.Retention = &models.RetentionPolicy{KeepLast: 2}
+	member := testUser(orgID)
+	member.CurrentOrgRole = "member"
+	store := &mockPBSStore{conn: conn}
+	r := setupPBSTestRouter(store, member)
+	path := "/api/v1/pbs/connections/" + conn.ID.String()
+
+	requests := map[string]*http.Request{
+		"create": JSONRequest("POST", "/api/v1/pbs/connections", `{"name":"pbs","host":"pbs.lan","username":"backup@pbs","token_id":"k","token_secret":"s","datastore":"backups"}`),
+		"update": JSONRequest("PUT", path, `{"name":"renamed"}`),
+		"delete": AuthenticatedRequest("DELETE", path),
+		"prune":  JSONRequest("POST", path+"/prune", `{"dry_run":true}`),
+		"gc":     AuthenticatedRequest("POST", path+"/gc"),
+	}
+	for name, req := range requests {
+		t.Run(name, func(t *testing.T) {
+			resp := DoRequest(r, req)
+			if resp.Code != http.StatusForbidden {
+				t.Fatalf("expected 403, got %d: %s", resp.Code, resp.Body.String())
+			}
+		})
+	}
+	if store.updated != nil || store.conn != conn {
+		t.Error("connection changed by a member")
+	}
+}
+
+func TestPBSPrune_Approval(t *testing.T) {
+	orgID := uuid.New()
+	conn, posts := pbsStandIn(t, orgID)
+	conn.Retention = &models.RetentionPolicy{KeepLast: 2}
+	approvalStore := newMockApprovalStore(models.ApprovalActionPBSPrune)
+	service := approval.NewService(approvalStore, nil, zerolog.Nop())
+
+	r := SetupTestRouter(adminUser(orgID))
+	handler := NewPBSHandler(&mockPBSStore{conn: conn}, &noopEncryption{}, zerolog.Nop())
+	handler.SetApprovalGate(service)
+	handler.RegisterRoutes(r.Group("/api/v1"))
+	path := "/api/v1/pbs/connections/" + conn.ID.String() + "/prune"
+
+	resp := DoRequest(r, JSONRequest("POST", path, `{"dry_run":true}`))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a dry run, got %d: %s", resp.Code, resp.Body.String())
+	}
+	*posts = nil
+
+	resp = DoRequest(r, AuthenticatedRequest("POST", path))
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if len(*posts) != 0 {
+		t.Fatalf("pruned before approval: %v", *posts)
+	}
+	var pending struct {
+		ApprovalRequest models.ApprovalRequest `json:"approval_request"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &pending); err != nil {
+		t.Fatal(err)
+	}
+
+	approvals := setupApprovalsTestRouter(approvalStore, service, adminUser(orgID))
+	resp = DoRequest(approvals, AuthenticatedRequest("POST", "/api/v1/approvals/"+pending.ApprovalRequest.ID.String()+"/approve"))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var decided models.ApprovalRequest
+	if err := json.Unmarshal(resp.Body.Bytes(), &decided); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stand-in refuses vm/101, which fails the approved prune.
+	if decided.Status != models.ApprovalStatusFailed || !strings.Contains(decided.ErrorMessage, "vm/101") {
+		t.Errorf("status = %s (error: %s)", decided.Status, decided.ErrorMessage)
+	}
+	if len(*posts) != 2 || (*posts)[0].Get("dry-run") != "" {
+		t.Errorf("prune forms = %v, want two without dry-run", *posts)
+	}
+}
+
+func TestPBSVerify(t *testing.T) {
+	orgID := uuid.New()
+	conn, posts := pbsStandIn(t, orgID)
+	r := setupPBSTestRouter(&mockPBSStore{conn: conn}, testUser(orgID))
+	path := "/api/v1/pbs/connections/" + conn.ID.String() + "/verify"
+
+	resp := DoRequest(r, JSONRequest("POST", path, `{"backup_id":"100"}`))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for backup_id without type, got %d", resp.Code)
+	}
+
+	resp = DoRequest(r, AuthenticatedRequest("POST", path))
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if !strings.Contains(resp.Body.String(), `"upid":"UPID:pbs:verify"`) {
+		t.Errorf("response = %s", resp.Body.String())
+	}
+	want := url.Values{"ns": {"prod"}, "ignore-verified": {"true"}, "outdated-after": {"30"}}
+	if len(*posts) != 1 || (*posts)[0].Encode() != want.Encode() {
+		t.Errorf("verify form = %v, want %v", *posts, want)
+	}
+}
+
+func TestPBSListSnapshots_InvalidType(t *testing.T) {
+	orgID := uuid.New()
+	conn := models.NewPBSConnection(orgID, "pbs", "pbs.lan", 8007, "backup@pbs", "backups")
+	r := setupPBSTestRouter(&mockPBSStore{conn: conn}, testUser(orgID))
+
+	resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/pbs/connections/"+conn.ID.String()+"/snapshots?backup_type=qemu"))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// ProxmoxRestoreStore defines the persistence operations for Proxmox restores.
+type ProxmoxRestoreStore interface {
+	GetProxmoxConnectionByID(ctx context.Context, id uuid.UUID) (*models.ProxmoxConnection, error)
+	GetRepositoryByID(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	CreateProxmoxRestore(ctx context.Context, restore *models.ProxmoxRestore) error
+	GetProxmoxRestoreByID(ctx context.Context, id uuid.UUID) (*models.ProxmoxRestore, error)
+	GetProxmoxRestoresByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.ProxmoxRestore, error)
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+}
+
+// ProxmoxRestoreRunner starts Proxmox VM restores in the background.
+type ProxmoxRestoreRunner interface {
+	StartRestore(ctx context.Context, restore *models.ProxmoxRestore) error
+}
+
+// ProxmoxRestoreHandler handles Proxmox VM restore HTTP endpoints.
+type ProxmoxRestoreHandler struct {
+	store  ProxmoxRestoreStore
+	runner ProxmoxRestoreRunner
+	logger zerolog.Logger
+}
+
+// NewProxmoxRestoreHandler creates a new ProxmoxRestoreHandler.
+func NewProxmoxRestoreHandler(store ProxmoxRestoreStore, runner ProxmoxRestoreRunner, logger zerolog.Logger) *ProxmoxRestoreHandler {
+	return &ProxmoxRestoreHandler{
+		store:  store,
+		runner: runner,
+		logger: logger.With().Str("component", "proxmox_restore_handler").Logger(),
+	}
+}
+
+// RegisterRoutes registers Proxmox restore routes on the given router group.
+func (h *ProxmoxRestoreHandler) RegisterRoutes(r *gin.RouterGroup) {
+	restores := r.Group("/proxmox/restores")
+	{
+		restores.GET("", h.ListRestores)
+		restores.POST("", h.CreateRestore)
+		restores.GET("/:id", h.GetRestore)
+	}
+}
+
+// CreateProxmoxRestoreRequest is the request body for restoring a VM or
+// container into a Proxmox VE cluster.
+type CreateProxmoxRestoreRequest struct {
+	ConnectionID  uuid.UUID `json:"connection_id" binding:"required"`
+	RepositoryID  uuid.UUID `json:"repository_id" binding:"required"`
+	SnapshotID    string    `json:"snapshot_id" binding:"required"`
+	Archive       string    `json:"archive,omitempty"`
+	SourceVMID    int       `json:"source_vmid,omitempty"`
+	TargetNode    string    `json:"target_node,omitempty"`
+	TargetStorage string    `json:"target_storage,omitempty"`
+	UploadStorage string    `json:"upload_storage" binding:"required" example:"local"`
+	NewVMID       int       `json:"new_vmid,omitempty"`
+	Overwrite     bool      `json:"overwrite,omitempty"`
+	Unique        bool      `json:"unique,omitempty"`
+	Start         bool      `json:"start,omitempty"`
+	HealthCheck   bool      `json:"health_check,omitempty"`
+	// HealthTimeoutSeconds defaults to five minutes.
+	HealthTimeoutSeconds int `json:"health_timeout_seconds,omitempty"`
+}
+
+// ListRestores returns the organization's Proxmox restores.
+//
+//	@Summary		List Proxmox restores
+//	@Description	Returns Proxmox VM and container restores for the current organization, newest first (admin only)
+//	@Tags			Proxmox
+//	@Produce		json
+//	@Success		200	{object}	map[string][]models.ProxmoxRestore
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/proxmox/restores [get]
+func (h *ProxmoxRestoreHandler) ListRestores(c *gin.Context) {
+	_, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	restores, err := h.store.GetProxmoxRestoresByOrgID(c.Request.Context(), orgID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("org_id", orgID.String()).Msg("failed to list proxmox restores")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list proxmox restores"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"restores": restores})
+}
+
+// GetRestore returns a Proxmox restore with its current phase and result.
+//
+//	@Summary		Get Proxmox restore
+//	@Description	Returns a Proxmox restore with its current phase, the Proxmox task running it and, once finished, the restored VMID and health check result (admin only)
+//	@Tags			Proxmox
+//	@Produce		json
+//	@Param			id	path		string	true	"Restore ID"
+//	@Success		200	{object}	models.ProxmoxRestore
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/proxmox/restores/{id} [get]
+func (h *ProxmoxRestoreHandler) GetRestore(c *gin.Context) {
+	_, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid restore ID"})
+		return
+	}
+
+	restore, err := h.store.GetProxmoxRestoreByID(c.Request.Context(), id)
+	if err != nil || restore.OrgID != orgID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "restore not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, restore)
+}
+
+// CreateRestore restores a VM or container from a vzdump archive in a snapshot.
+//
+//	@Summary		Restore Proxmox VM
+//	@Description	Streams a vzdump archive from a snapshot to a storage on the target node, restores it with qmrestore or pct restore and optionally starts and health-checks the guest (admin only).
+//	@Tags			Proxmox
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateProxmoxRestoreRequest	true	"Restore details"
+//	@Success		202		{object}	models.ProxmoxRestore
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		409		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/proxmox/restores [post]
+func (h *ProxmoxRestoreHandler) CreateRestore(c *gin.Context) {
+	userID, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req CreateProxmoxRestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	conn, err := h.store.GetProxmoxConnectionByID(ctx, req.ConnectionID)
+	if err != nil || conn.OrgID != orgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "connection not found"})
+		return
+	}
+	if !conn.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "connection is disabled"})
+		return
+	}
+	repo, err := h.store.GetRepositoryByID(ctx, req.RepositoryID)
+	if err != nil || repo.OrgID != orgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repository not found"})
+		return
+	}
+
+	restore := models.NewProxmoxRestore(orgID, conn.ID, repo.ID, req.SnapshotID, req.UploadStorage)
+	restore.Archive = req.Archive
+	restore.SourceVMID = req.SourceVMID
+	restore.TargetNode = req.TargetNode
+	restore.TargetStorage = req.TargetStorage
+	restore.NewVMID = req.NewVMID
+	restore.Overwrite = req.Overwrite
+	restore.Unique = req.Unique
+	restore.StartGuest = req.Start
+	restore.HealthCheck = req.HealthCheck
+	restore.HealthTimeoutSeconds = req.HealthTimeoutSeconds
+	restore.CreatedBy = &userID
+	if err := restore.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.CreateProxmoxRestore(ctx, restore); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create proxmox restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create proxmox restore"})
+		return
+	}
+
+	node := restore.TargetNode
+	if node == "" {
+		node = conn.Node
+	}
+	auditLog := models.NewAuditLog(orgID, models.AuditActionRestore, "proxmox_restore", models.AuditResultSuccess).
+		WithUser(userID).
+		WithResource(restore.ID).
+		WithRequestInfo(c.ClientIP(), c.Request.UserAgent()).
+		WithDetails(fmt.Sprintf("Proxmox restore of snapshot %s onto %s node %s", restore.SnapshotID, conn.Name, node))
+	if err := h.store.CreateAuditLog(ctx, auditLog); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to create audit log")
+	}
+
+	// The runner updates the restore as it goes, so respond with a copy.
+	resp := *restore
+	if err := h.runner.StartRestore(context.Background(), restore); err != nil {
+		if errors.Is(err, backup.ErrProxmoxRestoreRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error().Err(err).Str("restore_id", restore.ID.String()).Msg("failed to start proxmox restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start proxmox restore"})
+		return
+	}
+
+	h.logger.Info().
+		Str("restore_id", restore.ID.String()).
+		Str("snapshot_id", restore.SnapshotID).
+		Str("connection_id", conn.ID.String()).
+		Str("node", node).
+		Msg("proxmox restore started")
+
+	c.JSON(http.StatusAccepted, resp)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockProxmoxRestoreStore struct {
+	conns     map[uuid.UUID]*models.ProxmoxConnection
+	repos     map[uuid.UUID]*models.Repository
+	restores  map[uuid.UUID]*models.ProxmoxRestore
+	auditLogs []*models.AuditLog
+}
+
+func (m *mockProxmoxRestoreStore) GetProxmoxConnectionByID(_ context.Context, id uuid.UUID) (*models.ProxmoxConnection, error) {
+	conn, ok := m.conns[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return conn, nil
+}
+
+func (m *mockProxmoxRestoreStore) GetRepositoryByID(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	repo, ok := m.repos[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return repo, nil
+}
+
+func (m *mockProxmoxRestoreStore) CreateProxmoxRestore(_ context.Context, restore *models.ProxmoxRestore) error {
+	m.restores[restore.ID] = restore
+	return nil
+}
+
+func (m *mockProxmoxRestoreStore) GetProxmoxRestoreByID(_ context.Context, id uuid.UUID) (*models.ProxmoxRestore, error) {
+	restore, ok := m.restores[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return restore, nil
+}
+
+func (m *mockProxmoxRestoreStore) GetProxmoxRestoresByOrgID(_ context.Context, orgID uuid.UUID) ([]*models.ProxmoxRestore, error) {
+	var out []*models.ProxmoxRestore
+	for _, restore := range m.restores {
+		if restore.OrgID == orgID {
+			out = append(out, restore)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockProxmoxRestoreStore) CreateAuditLog(_ context.Context, log *models.AuditLog) error {
+	m.auditLogs = append(m.auditLogs, log)
+	return nil
+}
+
+type mockProxmoxRestoreRunner struct {
+	started []*models.ProxmoxRestore
+	err     error
+}
+
+func (r *mockProxmoxRestoreRunner) StartRestore(_ context.Context, restore *models.ProxmoxRestore) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.started = append(r.started, restore)
+	return nil
+}
+
+func setupProxmoxRestoreTestRouter(store *mockProxmoxRestoreStore, runner *mockProxmoxRestoreRunner, user *auth.SessionUser) *gin.Engine {
+	r := SetupTestRouter(user)
+	handler := NewProxmoxRestoreHandler(store, runner, zerolog.Nop())
+	handler.RegisterRoutes(r.Group("/api/v1"))
+	return r
+}
+
+func TestProxmoxCreateRestore(t *testing.T) {
+	orgID := uuid.New()
+	conn := models.NewProxmoxConnection(orgID, "pve", "pve.lan", 8006, "pve1", "root@pam")
+	disabled := models.NewProxmoxConnection(orgID, "old", "old.lan", 8006, "pve1", "root@pam")
+	disabled.Enabled = false
+	foreignConn := models.NewProxmoxConnection(uuid.New(), "foreign", "pve.example.com", 8006, "pve1", "root@pam")
+	repo := models.NewRepository(orgID, "vms", models.RepositoryTypeS3, nil)
+	foreignRepo := models.NewRepository(uuid.New(), "foreign", models.RepositoryTypeS3, nil)
+	newStore := func() *mockProxmoxRestoreStore {
+		return &mockProxmoxRestoreStore{
+			conns:    map[uuid.UUID]*models.ProxmoxConnection{conn.ID: conn, disabled.ID: disabled, foreignConn.ID: foreignConn},
+			repos:    map[uuid.UUID]*models.Repository{repo.ID: repo, foreignRepo.ID: foreignRepo},
+			restores: make(map[uuid.UUID]*models.ProxmoxRestore),
+		}
+	}
+	body := func(connID, repoID uuid.UUID, extra map[string]interface{}) string {
+		req := map[string]interface{}{
+			"connection_id":  connID.String(),
+			"repository_id":  repoID.String(),
+			"snapshot_id":    "abcd1234",
+			"upload_storage": "local",
+		}
+		for k, v := range extra {
+			req[k] = v
+		}
+		b, _ := json.Marshal(req)
+		return string(b)
+	}
+
+	t.Run("starts a DR test restore", func(t *testing.T) {
+		store, runner := newStore(), &mockProxmoxRestoreRunner{}
+		r := setupProxmoxRestoreTestRouter(store, runner, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/proxmox/restores", body(conn.ID, repo.ID, map[string]interface{}{
+			"source_vmid":    100,
+			"target_node":    "pve2",
+			"target_storage": "local-lvm",
+			"new_vmid":       9100,
+			"unique":         true,
+			"start":          true,
+			"health_check":   true,
+		})))
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if len(runner.started) != 1 {
+			t.Fatalf("expected restore to start, got %d", len(runner.started))
+		}
+		restore := runner.started[0]
+		if restore.SourceVMID != 100 || restore.TargetNode != "pve2" || restore.NewVMID != 9100 ||
+			!restore.Unique || !restore.StartGuest || !restore.HealthCheck || restore.UploadStorage != "local" {
+			t.Errorf("restore = %+v", restore)
+		}
+		if _, ok := store.restores[restore.ID]; !ok {
+			t.Error("restore not stored")
+		}
+		if len(store.auditLogs) != 1 || store.auditLogs[0].Action != models.AuditActionRestore {
+			t.Errorf("audit logs = %v", store.auditLogs)
+		}
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		tests := []struct {
+			name string
+			body string
+		}{
+			{"other org connection", body(foreignConn.ID, repo.ID, nil)},
+			{"disabled connection", body(disabled.ID, repo.ID, nil)},
+			{"other org repository", body(conn.ID, foreignRepo.ID, nil)},
+			{"missing upload storage", body(conn.ID, repo.ID, map[string]interface{}{"upload_storage": ""})},
+			{"health check without start", body(conn.ID, repo.ID, map[string]interface{}{"health_check": true})},
+			{"reserved vmid", body(conn.ID, repo.ID, map[string]interface{}{"new_vmid": 42})},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				store, runner := newStore(), &mockProxmoxRestoreRunner{}
+				r := setupProxmoxRestoreTestRouter(store, runner, adminUser(orgID))
+				resp := DoRequest(r, JSONRequest("POST", "/api/v1/proxmox/restores", tt.body))
+				if resp.Code != http.StatusBadRequest {
+					t.Errorf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+				}
+				if len(runner.started) != 0 {
+					t.Error("restore must not start")
+				}
+			})
+		}
+	})
+
+	t.Run("already running", func(t *testing.T) {
+		store, runner := newStore(), &mockProxmoxRestoreRunner{err: backup.ErrProxmoxRestoreRunning}
+		r := setupProxmoxRestoreTestRouter(store, runner, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/proxmox/restores", body(conn.ID, repo.ID, nil)))
+		if resp.Code != http.StatusConflict {
+			t.Errorf("expected 409, got %d", resp.Code)
+		}
+	})
+
+	t.Run("requires admin", func(t *testing.T) {
+		member := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, CurrentOrgRole: "member"}
+		r := setupProxmoxRestoreTestRouter(newStore(), &mockProxmoxRestoreRunner{}, member)
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/proxmox/restores", body(conn.ID, repo.ID, nil)))
+		if resp.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", resp.Code)
+		}
+	})
+}
+
+func TestProxmoxGetRestore(t *testing.T) {
+	orgID := uuid.New()
+	restore := models.NewProxmoxRestore(orgID, uuid.New(), uuid.New(), "abcd1234", "local")
+	foreign := models.NewProxmoxRestore(uuid.New(), uuid.New(), uuid.New(), "ffff0000", "local")
+	store := &mockProxmoxRestoreStore{restores: map[uuid.UUID]*models.ProxmoxRestore{restore.ID: restore, foreign.ID: foreign}}
+	r := setupProxmoxRestoreTestRouter(store, &mockProxmoxRestoreRunner{}, adminUser(orgID))
+
+	resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/proxmox/restores/"+restore.ID.String()))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.Code)
+	}
+	resp = DoRequest(r, AuthenticatedRequest("GET", "/api/v1/proxmox/restores/"+foreign.ID.String()))
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another org's restore, got %d", resp.Code)
+	}
+
+	resp = DoRequest(r, AuthenticatedRequest("GET", "/api/v1/proxmox/restores"))
+	var list struct {
+		Restores []models.ProxmoxRestore `json:"restores"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Restores) != 1 || list.Restores[0].ID != restore.ID {
+		t.Errorf("restores = %+v", list.Restores)
+	}
+}
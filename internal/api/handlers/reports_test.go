@@ -698,6 +698,10 @@ func (m *mockReportSchedulerStore) GetAlertsByOrgIDAndDateRange(_ context.Contex
 	return []*models.Alert{}, nil
 }
 
+func (m *mockReportSchedulerStore) GetScheduleCompliancesByOrgID(_ context.Context, _ uuid.UUID) ([]*models.ScheduleCompliance, error) {
+	return nil, nil
+}
+
 func (m *mockReportSchedulerStore) GetEnabledReportSchedules(_ context.Context) ([]*models.ReportSchedule, error) {
 	return nil, nil
 }
@@ -3,6 +3,8 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/MacJediWizard/keldris/internal/api/middleware"
@@ -11,6 +13,7 @@ import (
 	"github.com/MacJediWizard/keldris/internal/crypto"
 	"github.com/MacJediWizard/keldris/internal/license"
 	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/MacJediWizard/keldris/internal/restserver"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
@@ -36,7 +39,11 @@ type RepositoriesHandler struct {
 	rbac       *auth.RBAC
 	keyManager *crypto.KeyManager
 	checker    *license.FeatureChecker
-	logger     zerolog.Logger
+	approvals  ApprovalGate
+	// hostedURL is the server URL hosted repositories are served from; empty
+	// when the built-in REST server is disabled.
+	hostedURL string
+	logger    zerolog.Logger
 }
 
 // NewRepositoriesHandler creates a new RepositoriesHandler.
@@ -50,6 +57,18 @@ func NewRepositoriesHandler(store RepositoryStore, rbac *auth.RBAC, keyManager *
 	}
 }
 
+// SetApprovalGate enables four-eyes approval for repository deletion.
+func (h *RepositoriesHandler) SetApprovalGate(gate ApprovalGate) {
+	h.approvals = gate
+	gate.Register(models.ApprovalActionRepositoryDelete, h.executeApprovedDelete)
+}
+
+// SetHostedRepositories enables repositories hosted by the built-in restic
+// REST server at serverURL.
+func (h *RepositoriesHandler) SetHostedRepositories(serverURL string) {
+	h.hostedURL = serverURL
+}
+
 // RegisterRoutes registers repository routes on the given router group.
 func (h *RepositoriesHandler) RegisterRoutes(r *gin.RouterGroup) {
 	repos := r.Group("/repositories")
@@ -86,6 +105,7 @@ type RepositoryResponse struct {
 	Name          string                `json:"name"`
 	Type          models.RepositoryType `json:"type"`
 	EscrowEnabled bool                  `json:"escrow_enabled"`
+	ReadOnly      bool                  `json:"read_only"`
 	CreatedAt     string                `json:"created_at"`
 	UpdatedAt     string                `json:"updated_at"`
 }
@@ -124,6 +144,7 @@ func toRepositoryResponse(r *models.Repository, escrowEnabled bool) RepositoryRe
 		Name:          r.Name,
 		Type:          r.Type,
 		EscrowEnabled: escrowEnabled,
+		ReadOnly:      r.ReadOnly,
 		CreatedAt:     r.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		UpdatedAt:     r.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
 	}
@@ -154,8 +175,7 @@ func (h *RepositoriesHandler) List(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoRead); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermRepoRead) {
 		return
 	}
 
@@ -165,6 +185,7 @@ func (h *RepositoriesHandler) List(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list repositories"})
 		return
 	}
+	repos = h.visibleRepositories(c.Request.Context(), user, repos)
 
 	responses := make([]RepositoryResponse, len(repos))
 	for i, r := range repos {
@@ -180,6 +201,28 @@ func (h *RepositoriesHandler) List(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"repositories": responses})
 }
 
+// visibleRepositories filters repositories down to those the user may read.
+// Users with organization-wide repo:read see all of them; users whose access
+// comes from scoped role bindings only see repositories within their scope.
+func (h *RepositoriesHandler) visibleRepositories(ctx context.Context, user *auth.SessionUser, repos []*models.Repository) []*models.Repository {
+	if has, err := h.rbac.HasPermission(ctx, user.ID, user.CurrentOrgID, auth.PermRepoRead); err == nil && has {
+		return repos
+	}
+
+	visible := make([]*models.Repository, 0, len(repos))
+	for _, repo := range repos {
+		has, err := h.rbac.HasPermissionForResource(ctx, user.ID, user.CurrentOrgID, auth.PermRepoRead, auth.ResourceScope{RepositoryID: repo.ID})
+		if err != nil {
+			h.logger.Error().Err(err).Str("repository_id", repo.ID.String()).Msg("failed to check repository permission")
+			continue
+		}
+		if has {
+			visible = append(visible, repo)
+		}
+	}
+	return visible
+}
+
 // Get returns a specific repository by ID.
 //
 //	@Summary		Get repository
@@ -206,7 +249,7 @@ func (h *RepositoriesHandler) Get(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoRead); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoRead, auth.ResourceScope{RepositoryID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -311,6 +354,25 @@ func (h *RepositoriesHandler) Create(c *gin.Context) {
 		return
 	}
 
+	repo := models.NewRepository(user.CurrentOrgID, req.Name, req.Type, nil)
+
+	// Hosted repositories get their URL and server credentials from the server
+	if isHostedConfig(req.Type, req.Config) {
+		if h.hostedURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "this server does not host repositories"})
+			return
+		}
+		serverPassword, err := h.keyManager.GeneratePassword()
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to generate hosted repository credentials")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate repository credentials"})
+			return
+		}
+		req.Config["url"] = restserver.RepositoryURL(h.hostedURL, repo.ID)
+		req.Config["username"] = restserver.ServerUsername
+		req.Config["password"] = serverPassword
+	}
+
 	// Encrypt the config using AES-256-GCM
 	configJSON, err := json.Marshal(req.Config)
 	if err != nil {
@@ -325,8 +387,7 @@ func (h *RepositoriesHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encrypt config"})
 		return
 	}
-
-	repo := models.NewRepository(user.CurrentOrgID, req.Name, req.Type, configEncrypted)
+	repo.ConfigEncrypted = configEncrypted
 
 	if err := h.store.CreateRepository(c.Request.Context(), repo); err != nil {
 		h.logger.Error().Err(err).Str("name", req.Name).Msg("failed to create repository")
@@ -408,7 +469,7 @@ func (h *RepositoriesHandler) Update(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoUpdate); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoUpdate, auth.ResourceScope{RepositoryID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -444,6 +505,16 @@ func (h *RepositoriesHandler) Update(c *gin.Context) {
 
 	// Update encrypted config if provided
 	if req.Config != nil {
+		// The URL and credentials of a hosted repository are managed by the
+		// server; only settings such as the quota can change.
+		if repo.Type == models.RepositoryTypeRest {
+			if err := h.keepHostedSettings(repo, req.Config); err != nil {
+				h.logger.Error().Err(err).Str("repo_id", id.String()).Msg("failed to read repository config")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process config"})
+				return
+			}
+		}
+
 		configJSON, err := json.Marshal(req.Config)
 		if err != nil {
 			h.logger.Error().Err(err).Msg("failed to marshal config")
@@ -503,7 +574,7 @@ func (h *RepositoriesHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoDelete); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoDelete, auth.ResourceScope{RepositoryID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -526,6 +597,12 @@ func (h *RepositoriesHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	approvalReq := models.NewApprovalRequest(user.CurrentOrgID, user.ID, models.ApprovalActionRepositoryDelete,
+		"repository", id.String(), "Delete repository "+repo.Name)
+	if requestApproval(c, h.approvals, h.logger, approvalReq) {
+		return
+	}
+
 	if err := h.store.DeleteRepository(c.Request.Context(), id); err != nil {
 		h.logger.Error().Err(err).Str("repo_id", id.String()).Msg("failed to delete repository")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete repository"})
@@ -536,6 +613,29 @@ func (h *RepositoriesHandler) Delete(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "repository deleted"})
 }
 
+// executeApprovedDelete deletes a repository once its deletion has been approved.
+func (h *RepositoriesHandler) executeApprovedDelete(ctx context.Context, req *models.ApprovalRequest) error {
+	id, err := uuid.Parse(req.ResourceID)
+	if err != nil {
+		return fmt.Errorf("invalid repository ID: %w", err)
+	}
+
+	repo, err := h.store.GetRepositoryByID(ctx, id)
+	if err != nil || repo.OrgID != req.OrgID {
+		return errors.New("repository not found")
+	}
+
+	if err := h.store.DeleteRepository(ctx, id); err != nil {
+		return fmt.Errorf("delete repository: %w", err)
+	}
+
+	h.logger.Info().
+		Str("repo_id", id.String()).
+		Str("approval_request_id", req.ID.String()).
+		Msg("repository deleted after approval")
+	return nil
+}
+
 // TestRepositoryResponse is the response for repository connection test.
 type TestRepositoryResponse struct {
 	Success bool   `json:"success"`
@@ -575,7 +675,7 @@ func (h *RepositoriesHandler) Test(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoRead); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoRead, auth.ResourceScope{RepositoryID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -748,7 +848,7 @@ func (h *RepositoriesHandler) RecoverKey(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoRead); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoRead, auth.ResourceScope{RepositoryID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -851,7 +951,7 @@ func (h *RepositoriesHandler) Clone(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoCreate); err != nil {
+	if err := h.rbac.RequirePermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermRepoCreate, auth.ResourceScope{RepositoryID: paramUUID(c, "id")}); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 		return
 	}
@@ -914,6 +1014,10 @@ func (h *RepositoriesHandler) Clone(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse source repository configuration"})
 		return
 	}
+	if isHostedConfig(sourceRepo.Type, sourceConfig) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hosted repositories cannot be cloned; create a new hosted repository instead"})
+		return
+	}
 
 	// Build the new config by merging source settings with new credentials
 	newConfig := make(map[string]any)
@@ -1030,10 +1134,38 @@ func isCredentialField(field string) bool {
 		"connection_string":  true,
 		"sas_token":          true,
 		"application_secret": true,
+		"options":            true, // rclone remote parameters, which hold its credentials
 	}
 	return credentialFields[field]
 }
 
+// isHostedConfig reports whether a repository config is for a repository
+// hosted by the built-in restic REST server.
+func isHostedConfig(repoType models.RepositoryType, config map[string]any) bool {
+	hosted, _ := config["hosted"].(bool)
+	return repoType == models.RepositoryTypeRest && hosted
+}
+
+// keepHostedSettings copies the server-managed fields of a hosted
+// repository's current config into an updated config.
+func (h *RepositoriesHandler) keepHostedSettings(repo *models.Repository, config map[string]any) error {
+	configJSON, err := h.keyManager.Decrypt(repo.ConfigEncrypted)
+	if err != nil {
+		return err
+	}
+	var current map[string]any
+	if err := json.Unmarshal(configJSON, &current); err != nil {
+		return err
+	}
+	if !isHostedConfig(repo.Type, current) {
+		return nil
+	}
+	for _, k := range []string{"hosted", "url", "username", "password"} {
+		config[k] = current[k]
+	}
+	return nil
+}
+
 // storageTypeFeature returns the license feature required for a storage backend type.
 // Returns empty string for local storage (free tier).
 func storageTypeFeature(storageType string) license.Feature {
@@ -1048,6 +1180,8 @@ func storageTypeFeature(storageType string) license.Feature {
 		return license.FeatureStorageDropbox
 	case "rest":
 		return license.FeatureStorageRest
+	case "rclone":
+		return license.FeatureStorageRclone
 	default:
 		return ""
 	}
@@ -27,6 +27,8 @@ type mockRepositoryStore struct {
 	createErr  error
 	updateErr  error
 	deleteErr  error
+	created    *models.Repository
+	role       models.OrgRole
 }
 
 func (m *mockRepositoryStore) GetRepositoriesByOrgID(_ context.Context, orgID uuid.UUID) ([]*models.Repository, error) {
@@ -46,7 +48,8 @@ func (m *mockRepositoryStore) GetRepositoryByID(_ context.Context, id uuid.UUID)
 	return nil, errors.New("repository not found")
 }
 
-func (m *mockRepositoryStore) CreateRepository(_ context.Context, _ *models.Repository) error {
+func (m *mockRepositoryStore) CreateRepository(_ context.Context, repo *models.Repository) error {
+	m.created = repo
 	return m.createErr
 }
 
@@ -81,7 +84,11 @@ func (m *mockRepositoryStore) GetRepositoryKeysWithEscrowByOrgID(_ context.Conte
 }
 
 func (m *mockRepositoryStore) GetMembershipByUserAndOrg(_ context.Context, userID, orgID uuid.UUID) (*models.OrgMembership, error) {
-	return &models.OrgMembership{UserID: userID, OrgID: orgID, Role: models.OrgRoleOwner}, nil
+	role := m.role
+	if role == "" {
+		role = models.OrgRoleOwner
+	}
+	return &models.OrgMembership{UserID: userID, OrgID: orgID, Role: role}, nil
 }
 
 func (m *mockRepositoryStore) GetMembershipsByUserID(_ context.Context, userID uuid.UUID) ([]*models.OrgMembership, error) {
@@ -548,6 +555,62 @@ func TestCreateRepository(t *testing.T) {
 	})
 }
 
+func TestCreateHostedRepository(t *testing.T) {
+	orgID := uuid.New()
+	user := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID}
+	km, _ := crypto.NewKeyManager(make([]byte, 32))
+	body := `{"name":"on-server","type":"rest","config":{"hosted":true,"quota_bytes":1073741824,"url":"https://elsewhere.example.com/"}}`
+
+	setup := func(store *mockRepositoryStore, hostedURL string) *gin.Engine {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set(string(middleware.UserContextKey), user)
+			c.Next()
+		})
+		handler := NewRepositoriesHandler(store, auth.NewRBAC(store), km, nil, zerolog.Nop())
+		if hostedURL != "" {
+			handler.SetHostedRepositories(hostedURL)
+		}
+		handler.RegisterRoutes(r.Group("/api/v1"))
+		return r
+	}
+
+	t.Run("server fills in URL and credentials", func(t *testing.T) {
+		store := &mockRepositoryStore{repoByID: make(map[uuid.UUID]*models.Repository)}
+		w := DoRequest(setup(store, "https://keldris.example.com/"), JSONRequest("POST", "/api/v1/repositories", body))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		configJSON, err := km.Decrypt(store.created.ConfigEncrypted)
+		if err != nil {
+			t.Fatalf("failed to decrypt config: %v", err)
+		}
+		var config map[string]any
+		if err := json.Unmarshal(configJSON, &config); err != nil {
+			t.Fatalf("failed to parse config: %v", err)
+		}
+		wantURL := "https://keldris.example.com/restic/" + store.created.ID.String() + "/"
+		if config["url"] != wantURL {
+			t.Errorf("url = %v, want %s", config["url"], wantURL)
+		}
+		if config["username"] != "keldris" || config["password"] == "" || config["password"] == nil {
+			t.Errorf("server credentials not generated: %v", config)
+		}
+		if config["quota_bytes"] != float64(1073741824) {
+			t.Errorf("quota_bytes = %v", config["quota_bytes"])
+		}
+	})
+
+	t.Run("hosting disabled", func(t *testing.T) {
+		store := &mockRepositoryStore{repoByID: make(map[uuid.UUID]*models.Repository)}
+		w := DoRequest(setup(store, ""), JSONRequest("POST", "/api/v1/repositories", body))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
 func TestUpdateRepository(t *testing.T) {
 	orgID := uuid.New()
 	repoID := uuid.New()
@@ -742,3 +805,46 @@ func TestTestConnection(t *testing.T) {
 		}
 	})
 }
+
+func TestListRepositories_ScopedRoleBinding(t *testing.T) {
+	orgID := uuid.New()
+	allowed := &models.Repository{ID: uuid.New(), OrgID: orgID, Name: "db-backups", Type: models.RepositoryTypeS3}
+	other := &models.Repository{ID: uuid.New(), OrgID: orgID, Name: "web-backups", Type: models.RepositoryTypeS3}
+
+	// The membership's built-in role grants nothing; repo:read comes only
+	// from a binding scoped to one repository.
+	store := &mockRepositoryStore{repos: []*models.Repository{allowed, other}, role: models.OrgRole("restricted")}
+	binding := models.NewUserRoleBinding(orgID, uuid.New(), uuid.New())
+	binding.RepositoryIDs = []uuid.UUID{allowed.ID}
+	bindings := &scopedBindingStore{bindings: []*models.EffectiveRoleBinding{{
+		RoleBinding: *binding,
+		Permissions: []string{string(auth.PermRepoRead)},
+	}}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	user := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID}
+	r.Use(func(c *gin.Context) {
+		c.Set(string(middleware.UserContextKey), user)
+		c.Next()
+	})
+	rbac := auth.NewRBAC(store)
+	rbac.SetRoleBindingStore(bindings)
+	NewRepositoriesHandler(store, rbac, nil, nil, zerolog.Nop()).RegisterRoutes(r.Group("/api/v1"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/repositories", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Repositories []RepositoryResponse `json:"repositories"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(resp.Repositories) != 1 || resp.Repositories[0].ID != allowed.ID {
+		t.Errorf("expected only the scoped repository, got %+v", resp.Repositories)
+	}
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// maxUnusedPattern matches restic's --max-unused values such as "5%", "2G" or "unlimited".
+var maxUnusedPattern = regexp.MustCompile(`^(unlimited|\d+(\.\d+)?%|\d+[kKmMgGtT]?)$`)
+
+// repackSizePattern matches restic's --max-repack-size values such as "10G".
+var repackSizePattern = regexp.MustCompile(`^\d+[kKmMgGtT]?$`)
+
+// RepositoryMaintenanceStore defines the persistence operations for repository maintenance.
+type RepositoryMaintenanceStore interface {
+	GetRepositoryByID(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	GetRepositoryMaintenancePolicyByRepositoryID(ctx context.Context, repositoryID uuid.UUID) (*models.RepositoryMaintenancePolicy, error)
+	UpsertRepositoryMaintenancePolicy(ctx context.Context, p *models.RepositoryMaintenancePolicy) error
+	GetRepositoryMaintenanceRuns(ctx context.Context, repositoryID uuid.UUID, limit int) ([]*models.RepositoryMaintenanceRun, error)
+}
+
+// RepositoryMaintenanceRunner plans and starts repository maintenance.
+type RepositoryMaintenanceRunner interface {
+	Plan(ctx context.Context, policy *models.RepositoryMaintenancePolicy) (*models.RepositoryMaintenancePlan, error)
+	StartRun(ctx context.Context, policy *models.RepositoryMaintenancePolicy) error
+	StartPrune(ctx context.Context, orgID, repositoryID uuid.UUID, trigger string) error
+}
+
+// RepositoryMaintenanceHandler handles repository maintenance HTTP endpoints.
+type RepositoryMaintenanceHandler struct {
+	store  RepositoryMaintenanceStore
+	runner RepositoryMaintenanceRunner
+	logger zerolog.Logger
+}
+
+// NewRepositoryMaintenanceHandler creates a new RepositoryMaintenanceHandler.
+func NewRepositoryMaintenanceHandler(store RepositoryMaintenanceStore, runner RepositoryMaintenanceRunner, logger zerolog.Logger) *RepositoryMaintenanceHandler {
+	return &RepositoryMaintenanceHandler{
+		store:  store,
+		runner: runner,
+		logger: logger.With().Str("component", "repository_maintenance_handler").Logger(),
+	}
+}
+
+// RegisterRoutes registers repository maintenance routes on the given router group.
+func (h *RepositoryMaintenanceHandler) RegisterRoutes(r *gin.RouterGroup) {
+	repos := r.Group("/repositories")
+	{
+		repos.GET("/:id/maintenance", h.Get)
+		repos.PUT("/:id/maintenance", h.UpdatePolicy)
+		repos.GET("/:id/maintenance/plan", h.Plan)
+		repos.POST("/:id/maintenance/run", h.Run)
+	}
+}
+
+// RepositoryMaintenanceResponse is the API response for a repository's maintenance.
+type RepositoryMaintenanceResponse struct {
+	Policy     *models.RepositoryMaintenancePolicy `json:"policy"`
+	Configured bool                                `json:"configured"`
+	Runs       []*models.RepositoryMaintenanceRun  `json:"runs"`
+}
+
+// UpdateRepositoryMaintenanceRequest is the request body for a repository's maintenance policy.
+type UpdateRepositoryMaintenanceRequest struct {
+	Enabled                  bool   `json:"enabled"`
+	UpgradeRepository        bool   `json:"upgrade_repository"`
+	RepackUncompressed       bool   `json:"repack_uncompressed"`
+	MaxUnused                string `json:"max_unused" example:"5%"`
+	MaxRepackSize            string `json:"max_repack_size,omitempty" example:"50G"`
+	MinReclaimBytes          int64  `json:"min_reclaim_bytes"`
+	IntervalHours            int    `json:"interval_hours" binding:"required,min=1" example:"168"`
+	RequireMaintenanceWindow bool   `json:"require_maintenance_window"`
+	StorageClass             string `json:"storage_class,omitempty" example:"STANDARD_IA"`
+}
+
+// loadRepository returns the repository and its maintenance policy, or a
+// default unsaved policy, if the session user is an org admin. It writes an
+// error response and returns false otherwise.
+func (h *RepositoryMaintenanceHandler) loadRepository(c *gin.Context) (*models.Repository, *models.RepositoryMaintenancePolicy, bool, bool) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return nil, nil, false, false
+	}
+	if user.CurrentOrgID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no organization selected"})
+		return nil, nil, false, false
+	}
+	if !isAdmin(user.CurrentOrgRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return nil, nil, false, false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid repository ID"})
+		return nil, nil, false, false
+	}
+
+	ctx := c.Request.Context()
+	repo, err := h.store.GetRepositoryByID(ctx, id)
+	if err != nil || repo.OrgID != user.CurrentOrgID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "repository not found"})
+		return nil, nil, false, false
+	}
+
+	policy, err := h.store.GetRepositoryMaintenancePolicyByRepositoryID(ctx, repo.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("repository_id", repo.ID.String()).Msg("failed to get maintenance policy")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get maintenance policy"})
+		return nil, nil, false, false
+	}
+	if policy == nil {
+		return repo, models.NewRepositoryMaintenancePolicy(repo.OrgID, repo.ID), false, true
+	}
+	return repo, policy, true, true
+}
+
+// Get returns a repository's maintenance policy and recent runs.
+//
+//	@Summary		Get repository maintenance
+//	@Description	Returns the repository's maintenance policy (defaults if none is saved) and its recent maintenance runs with before/after stats (admin only)
+//	@Tags			Repositories
+//	@Produce		json
+//	@Param			id	path		string	true	"Repository ID"
+//	@Success		200	{object}	RepositoryMaintenanceResponse
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/repositories/{id}/maintenance [get]
+func (h *RepositoryMaintenanceHandler) Get(c *gin.Context) {
+	repo, policy, configured, ok := h.loadRepository(c)
+	if !ok {
+		return
+	}
+
+	runs, err := h.store.GetRepositoryMaintenanceRuns(c.Request.Context(), repo.ID, 20)
+	if err != nil {
+		h.logger.Error().Err(err).Str("repository_id", repo.ID.String()).Msg("failed to list maintenance runs")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list maintenance runs"})
+		return
+	}
+	if runs == nil {
+		runs = []*models.RepositoryMaintenanceRun{}
+	}
+
+	c.JSON(http.StatusOK, RepositoryMaintenanceResponse{Policy: policy, Configured: configured, Runs: runs})
+}
+
+// UpdatePolicy saves a repository's maintenance policy.
+//
+//	@Summary		Update repository maintenance policy
+//	@Description	Creates or replaces the repository's maintenance policy (admin only)
+//	@Tags			Repositories
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string								true	"Repository ID"
+//	@Param			request	body		UpdateRepositoryMaintenanceRequest	true	"Maintenance policy"
+//	@Success		200		{object}	models.RepositoryMaintenancePolicy
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/repositories/{id}/maintenance [put]
+func (h *RepositoryMaintenanceHandler) UpdatePolicy(c *gin.Context) {
+	repo, policy, _, ok := h.loadRepository(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateRepositoryMaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if req.MaxUnused == "" {
+		req.MaxUnused = "5%"
+	}
+	if !maxUnusedPattern.MatchString(req.MaxUnused) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_unused must be a percentage, a size or \"unlimited\""})
+		return
+	}
+	if req.MaxRepackSize != "" && !repackSizePattern.MatchString(req.MaxRepackSize) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_repack_size must be a size such as \"50G\""})
+		return
+	}
+	if req.MinReclaimBytes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_reclaim_bytes must not be negative"})
+		return
+	}
+
+	policy.Enabled = req.Enabled
+	policy.UpgradeRepository = req.UpgradeRepository
+	policy.RepackUncompressed = req.RepackUncompressed
+	policy.MaxUnused = req.MaxUnused
+	policy.MaxRepackSize = req.MaxRepackSize
+	policy.MinReclaimBytes = req.MinReclaimBytes
+	policy.IntervalHours = req.IntervalHours
+	policy.RequireMaintenanceWindow = req.RequireMaintenanceWindow
+	policy.StorageClass = req.StorageClass
+
+	if err := h.store.UpsertRepositoryMaintenancePolicy(c.Request.Context(), policy); err != nil {
+		h.logger.Error().Err(err).Str("repository_id", repo.ID.String()).Msg("failed to save maintenance policy")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save maintenance policy"})
+		return
+	}
+
+	h.logger.Info().
+		Str("repository_id", repo.ID.String()).
+		Bool("enabled", policy.Enabled).
+		Msg("repository maintenance policy updated")
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// Plan estimates what maintenance would do without changing the repository.
+//
+//	@Summary		Plan repository maintenance
+//	@Description	Runs a prune dry run and reports whether maintenance would upgrade, prune or compress the repository, the space it would reclaim and any early-deletion fees (admin only)
+//	@Tags			Repositories
+//	@Produce		json
+//	@Param			id	path		string	true	"Repository ID"
+//	@Success		200	{object}	models.RepositoryMaintenancePlan
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/repositories/{id}/maintenance/plan [get]
+func (h *RepositoryMaintenanceHandler) Plan(c *gin.Context) {
+	repo, policy, _, ok := h.loadRepository(c)
+	if !ok {
+		return
+	}
+
+	plan, err := h.runner.Plan(c.Request.Context(), policy)
+	if err != nil {
+		h.logger.Error().Err(err).Str("repository_id", repo.ID.String()).Msg("failed to plan repository maintenance")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to plan repository maintenance"})
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// Run starts maintenance immediately, without waiting for a maintenance window.
+//
+//	@Summary		Run repository maintenance
+//	@Description	Starts maintenance for the repository in the background, regardless of maintenance windows (admin only)
+//	@Tags			Repositories
+//	@Produce		json
+//	@Param			id	path		string	true	"Repository ID"
+//	@Success		202	{object}	map[string]string
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		409	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/repositories/{id}/maintenance/run [post]
+func (h *RepositoryMaintenanceHandler) Run(c *gin.Context) {
+	repo, policy, _, ok := h.loadRepository(c)
+	if !ok {
+		return
+	}
+	if repo.ReadOnly {
+		c.JSON(http.StatusConflict, gin.H{"error": backup.ErrRepositoryReadOnly.Error()})
+		return
+	}
+
+	if err := h.runner.StartRun(context.Background(), policy); err != nil {
+		if errors.Is(err, backup.ErrMaintenanceRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error().Err(err).Str("repository_id", repo.ID.String()).Msg("failed to start repository maintenance")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start repository maintenance"})
+		return
+	}
+
+	h.logger.Info().Str("repository_id", repo.ID.String()).Msg("repository maintenance started")
+	c.JSON(http.StatusAccepted, gin.H{"message": "repository maintenance started"})
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockRepositoryMaintenanceStore struct {
+	repos    map[uuid.UUID]*models.Repository
+	policies map[uuid.UUID]*models.RepositoryMaintenancePolicy
+	runs     []*models.RepositoryMaintenanceRun
+}
+
+func (m *mockRepositoryMaintenanceStore) GetRepositoryByID(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	repo, ok := m.repos[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return repo, nil
+}
+
+func (m *mockRepositoryMaintenanceStore) GetRepositoryMaintenancePolicyByRepositoryID(_ context.Context, repositoryID uuid.UUID) (*models.RepositoryMaintenancePolicy, error) {
+	return m.policies[repositoryID], nil
+}
+
+func (m *mockRepositoryMaintenanceStore) UpsertRepositoryMaintenancePolicy(_ context.Context, p *models.RepositoryMaintenancePolicy) error {
+	m.policies[p.RepositoryID] = p
+	return nil
+}
+
+func (m *mockRepositoryMaintenanceStore) GetRepositoryMaintenanceRuns(_ context.Context, _ uuid.UUID, _ int) ([]*models.RepositoryMaintenanceRun, error) {
+	return m.runs, nil
+}
+
+type mockMaintenanceRunner struct {
+	plan    *models.RepositoryMaintenancePlan
+	started []uuid.UUID
+	err     error
+}
+
+func (r *mockMaintenanceRunner) Plan(_ context.Context, _ *models.RepositoryMaintenancePolicy) (*models.RepositoryMaintenancePlan, error) {
+	return r.plan, r.err
+}
+
+func (r *mockMaintenanceRunner) StartRun(_ context.Context, policy *models.RepositoryMaintenancePolicy) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.started = append(r.started, policy.RepositoryID)
+	return nil
+}
+
+func (r *mockMaintenanceRunner) StartPrune(_ context.Context, _, repositoryID uuid.UUID, _ string) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.started = append(r.started, repositoryID)
+	return nil
+}
+
+func setupRepositoryMaintenanceTestRouter(store *mockRepositoryMaintenanceStore, runner *mockMaintenanceRunner, user *auth.SessionUser) *gin.Engine {
+	r := SetupTestRouter(user)
+	handler := NewRepositoryMaintenanceHandler(store, runner, zerolog.Nop())
+	handler.RegisterRoutes(r.Group("/api/v1"))
+	return r
+}
+
+func TestRepositoryMaintenance(t *testing.T) {
+	orgID := uuid.New()
+	repo := models.NewRepository(orgID, "s3", models.RepositoryTypeS3, nil)
+	foreign := models.NewRepository(uuid.New(), "foreign", models.RepositoryTypeS3, nil)
+	newStore := func() *mockRepositoryMaintenanceStore {
+		return &mockRepositoryMaintenanceStore{
+			repos:    map[uuid.UUID]*models.Repository{repo.ID: repo, foreign.ID: foreign},
+			policies: make(map[uuid.UUID]*models.RepositoryMaintenancePolicy),
+		}
+	}
+	path := "/api/v1/repositories/" + repo.ID.String() + "/maintenance"
+
+	t.Run("get returns default policy", func(t *testing.T) {
+		r := setupRepositoryMaintenanceTestRouter(newStore(), &mockMaintenanceRunner{}, adminUser(orgID))
+		resp := DoRequest(r, AuthenticatedRequest("GET", path))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var got RepositoryMaintenanceResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Configured || got.Policy.MaxUnused != "5%" || got.Runs == nil {
+			t.Errorf("response = %+v", got)
+		}
+	})
+
+	t.Run("update saves policy", func(t *testing.T) {
+		store := newStore()
+		r := setupRepositoryMaintenanceTestRouter(store, &mockMaintenanceRunner{}, adminUser(orgID))
+		body := `{"enabled":true,"repack_uncompressed":true,"max_unused":"10%","interval_hours":24,"storage_class":"STANDARD_IA"}`
+		resp := DoRequest(r, JSONRequest("PUT", path, body))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		saved := store.policies[repo.ID]
+		if saved == nil || saved.MaxUnused != "10%" || saved.IntervalHours != 24 || saved.StorageClass != "STANDARD_IA" {
+			t.Errorf("saved = %+v", saved)
+		}
+	})
+
+	for _, tt := range []struct {
+		name string
+		body string
+	}{
+		{"invalid max unused", `{"max_unused":"lots","interval_hours":24}`},
+		{"invalid repack size", `{"max_repack_size":"big","interval_hours":24}`},
+		{"missing interval", `{"max_unused":"5%"}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupRepositoryMaintenanceTestRouter(newStore(), &mockMaintenanceRunner{}, adminUser(orgID))
+			resp := DoRequest(r, JSONRequest("PUT", path, tt.body))
+			if resp.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+			}
+		})
+	}
+
+	t.Run("plan", func(t *testing.T) {
+		runner := &mockMaintenanceRunner{plan: &models.RepositoryMaintenancePlan{RepositoryID: repo.ID, Prune: true, EstimatedReclaimBytes: 1024}}
+		r := setupRepositoryMaintenanceTestRouter(newStore(), runner, adminUser(orgID))
+		resp := DoRequest(r, AuthenticatedRequest("GET", path+"/plan"))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+
+	t.Run("run starts maintenance", func(t *testing.T) {
+		runner := &mockMaintenanceRunner{}
+		r := setupRepositoryMaintenanceTestRouter(newStore(), runner, adminUser(orgID))
+		resp := DoRequest(r, AuthenticatedRequest("POST", path+"/run"))
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if len(runner.started) != 1 || runner.started[0] != repo.ID {
+			t.Errorf("started = %v", runner.started)
+		}
+	})
+
+	t.Run("run conflict", func(t *testing.T) {
+		runner := &mockMaintenanceRunner{err: backup.ErrMaintenanceRunning}
+		r := setupRepositoryMaintenanceTestRouter(newStore(), runner, adminUser(orgID))
+		resp := DoRequest(r, AuthenticatedRequest("POST", path+"/run"))
+		if resp.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d", resp.Code)
+		}
+	})
+
+	t.Run("run on read-only repository", func(t *testing.T) {
+		store, runner := newStore(), &mockMaintenanceRunner{}
+		readOnly := *repo
+		readOnly.ReadOnly = true
+		store.repos[repo.ID] = &readOnly
+		r := setupRepositoryMaintenanceTestRouter(store, runner, adminUser(orgID))
+		resp := DoRequest(r, AuthenticatedRequest("POST", path+"/run"))
+		if resp.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d", resp.Code)
+		}
+		if len(runner.started) != 0 {
+			t.Errorf("started = %v", runner.started)
+		}
+	})
+
+	t.Run("other org repository", func(t *testing.T) {
+		r := setupRepositoryMaintenanceTestRouter(newStore(), &mockMaintenanceRunner{}, adminUser(orgID))
+		resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/repositories/"+foreign.ID.String()+"/maintenance"))
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", resp.Code)
+		}
+	})
+
+	t.Run("not admin", func(t *testing.T) {
+		member := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, CurrentOrgRole: "member"}
+		r := setupRepositoryMaintenanceTestRouter(newStore(), &mockMaintenanceRunner{}, member)
+		resp := DoRequest(r, AuthenticatedRequest("GET", path))
+		if resp.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", resp.Code)
+		}
+	})
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// readDataSubsetPattern matches restic's --read-data-subset values such as "10%" or "1/5".
+var readDataSubsetPattern = regexp.MustCompile(`^(\d+(\.\d+)?%|\d+/\d+)$`)
+
+// RepositoryMigrationStore defines the persistence operations for repository migrations.
+type RepositoryMigrationStore interface {
+	GetRepositoryByID(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	CreateRepositoryMigration(ctx context.Context, m *models.RepositoryMigration) error
+	GetRepositoryMigrationByID(ctx context.Context, id uuid.UUID) (*models.RepositoryMigration, error)
+	GetRepositoryMigrationsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.RepositoryMigration, error)
+	GetOpenRepositoryMigration(ctx context.Context, repositoryID uuid.UUID) (*models.RepositoryMigration, error)
+}
+
+// RepositoryMigrationRunner starts repository migrations in the background.
+type RepositoryMigrationRunner interface {
+	StartMigration(ctx context.Context, migrationID uuid.UUID) error
+}
+
+// RepositoryMigrationsHandler handles repository migration HTTP endpoints.
+type RepositoryMigrationsHandler struct {
+	store  RepositoryMigrationStore
+	runner RepositoryMigrationRunner
+	logger zerolog.Logger
+}
+
+// NewRepositoryMigrationsHandler creates a new RepositoryMigrationsHandler.
+func NewRepositoryMigrationsHandler(store RepositoryMigrationStore, runner RepositoryMigrationRunner, logger zerolog.Logger) *RepositoryMigrationsHandler {
+	return &RepositoryMigrationsHandler{
+		store:  store,
+		runner: runner,
+		logger: logger.With().Str("component", "repository_migrations_handler").Logger(),
+	}
+}
+
+// RegisterRoutes registers repository migration routes on the given router group.
+func (h *RepositoryMigrationsHandler) RegisterRoutes(r *gin.RouterGroup) {
+	migrations := r.Group("/repository-migrations")
+	{
+		migrations.GET("", h.List)
+		migrations.POST("", h.Create)
+		migrations.GET("/:id", h.Get)
+		migrations.POST("/:id/resume", h.Resume)
+	}
+}
+
+// CreateRepositoryMigrationRequest is the request body for starting a repository migration.
+type CreateRepositoryMigrationRequest struct {
+	SourceRepositoryID uuid.UUID `json:"source_repository_id" binding:"required"`
+	TargetRepositoryID uuid.UUID `json:"target_repository_id" binding:"required"`
+	ReadDataSubset     string    `json:"read_data_subset,omitempty" example:"10%"`
+}
+
+// RepositoryMigrationResponse is the API response for a repository migration.
+type RepositoryMigrationResponse struct {
+	*models.RepositoryMigration
+	CopiedSnapshots int     `json:"copied_snapshots"`
+	ProgressPercent float64 `json:"progress_percent"`
+}
+
+func toRepositoryMigrationResponse(m *models.RepositoryMigration) RepositoryMigrationResponse {
+	return RepositoryMigrationResponse{
+		RepositoryMigration: m,
+		CopiedSnapshots:     len(m.CopiedSnapshotIDs),
+		ProgressPercent:     m.ProgressPercent(),
+	}
+}
+
+// List returns the organization's repository migrations.
+//
+//	@Summary		List repository migrations
+//	@Description	Returns repository migrations for the current organization, newest first (admin only)
+//	@Tags			Repositories
+//	@Produce		json
+//	@Success		200	{object}	map[string][]RepositoryMigrationResponse
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/repository-migrations [get]
+func (h *RepositoryMigrationsHandler) List(c *gin.Context) {
+	_, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	migrations, err := h.store.GetRepositoryMigrationsByOrgID(c.Request.Context(), orgID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("org_id", orgID.String()).Msg("failed to list repository migrations")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list repository migrations"})
+		return
+	}
+
+	resp := make([]RepositoryMigrationResponse, len(migrations))
+	for i, m := range migrations {
+		resp[i] = toRepositoryMigrationResponse(m)
+	}
+	c.JSON(http.StatusOK, gin.H{"migrations": resp})
+}
+
+// Get returns a repository migration and its progress.
+//
+//	@Summary		Get repository migration
+//	@Description	Returns a repository migration and its copy progress (admin only)
+//	@Tags			Repositories
+//	@Produce		json
+//	@Param			id	path		string	true	"Migration ID"
+//	@Success		200	{object}	RepositoryMigrationResponse
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/repository-migrations/{id} [get]
+func (h *RepositoryMigrationsHandler) Get(c *gin.Context) {
+	_, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	migration := h.getMigration(c, orgID)
+	if migration == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, toRepositoryMigrationResponse(migration))
+}
+
+// Create starts moving a repository to another repository.
+//
+//	@Summary		Start repository migration
+//	@Description	Initialises the target with the source's chunker parameters, copies every snapshot, verifies the target and repoints schedules and geo-replication configs to it. DR runbooks follow their schedules. The source is kept read-only until it is deleted (admin only).
+//	@Tags			Repositories
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateRepositoryMigrationRequest	true	"Migration details"
+//	@Success		202		{object}	RepositoryMigrationResponse
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		409		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/repository-migrations [post]
+func (h *RepositoryMigrationsHandler) Create(c *gin.Context) {
+	userID, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req CreateRepositoryMigrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.SourceRepositoryID == req.TargetRepositoryID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source and target repository must differ"})
+		return
+	}
+	if req.ReadDataSubset != "" && !readDataSubsetPattern.MatchString(req.ReadDataSubset) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "read_data_subset must be a percentage (10%) or a fraction (1/5)"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	source, err := h.store.GetRepositoryByID(ctx, req.SourceRepositoryID)
+	if err != nil || source.OrgID != orgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source repository not found"})
+		return
+	}
+	target, err := h.store.GetRepositoryByID(ctx, req.TargetRepositoryID)
+	if err != nil || target.OrgID != orgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target repository not found"})
+		return
+	}
+	if source.ReadOnly {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source repository has already been migrated"})
+		return
+	}
+	if target.ReadOnly {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target repository is read-only"})
+		return
+	}
+
+	for _, repoID := range []uuid.UUID{source.ID, target.ID} {
+		open, err := h.store.GetOpenRepositoryMigration(ctx, repoID)
+		if err != nil {
+			h.logger.Error().Err(err).Str("repository_id", repoID.String()).Msg("failed to check open repository migrations")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create repository migration"})
+			return
+		}
+		if open != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "repository is already part of migration " + open.ID.String()})
+			return
+		}
+	}
+
+	migration := models.NewRepositoryMigration(orgID, source, target, &userID)
+	migration.ReadDataSubset = req.ReadDataSubset
+	if err := h.store.CreateRepositoryMigration(ctx, migration); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create repository migration")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create repository migration"})
+		return
+	}
+
+	if err := h.runner.StartMigration(context.Background(), migration.ID); err != nil {
+		h.logger.Error().Err(err).Str("migration_id", migration.ID.String()).Msg("failed to start repository migration")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start repository migration"})
+		return
+	}
+
+	h.logger.Info().
+		Str("migration_id", migration.ID.String()).
+		Str("source_repository_id", source.ID.String()).
+		Str("target_repository_id", target.ID.String()).
+		Msg("repository migration started")
+
+	c.JSON(http.StatusAccepted, toRepositoryMigrationResponse(migration))
+}
+
+// Resume restarts a failed repository migration from where it stopped.
+//
+//	@Summary		Resume repository migration
+//	@Description	Restarts a failed repository migration; snapshots already copied are skipped (admin only)
+//	@Tags			Repositories
+//	@Produce		json
+//	@Param			id	path		string	true	"Migration ID"
+//	@Success		202	{object}	RepositoryMigrationResponse
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		409	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/repository-migrations/{id}/resume [post]
+func (h *RepositoryMigrationsHandler) Resume(c *gin.Context) {
+	_, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	migration := h.getMigration(c, orgID)
+	if migration == nil {
+		return
+	}
+	if !migration.CanResume() {
+		c.JSON(http.StatusConflict, gin.H{"error": "migration is " + string(migration.Status)})
+		return
+	}
+
+	if err := h.runner.StartMigration(context.Background(), migration.ID); err != nil {
+		if errors.Is(err, backup.ErrMigrationRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error().Err(err).Str("migration_id", migration.ID.String()).Msg("failed to resume repository migration")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resume repository migration"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, toRepositoryMigrationResponse(migration))
+}
+
+func (h *RepositoryMigrationsHandler) getMigration(c *gin.Context, orgID uuid.UUID) *models.RepositoryMigration {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid migration ID"})
+		return nil
+	}
+
+	migration, err := h.store.GetRepositoryMigrationByID(c.Request.Context(), id)
+	if err != nil || migration.OrgID != orgID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "migration not found"})
+		return nil
+	}
+	return migration
+}
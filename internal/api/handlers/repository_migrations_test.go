@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockRepositoryMigrationStore struct {
+	repos      map[uuid.UUID]*models.Repository
+	migrations map[uuid.UUID]*models.RepositoryMigration
+}
+
+func (m *mockRepositoryMigrationStore) GetRepositoryByID(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	repo, ok := m.repos[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return repo, nil
+}
+
+func (m *mockRepositoryMigrationStore) CreateRepositoryMigration(_ context.Context, migration *models.RepositoryMigration) error {
+	m.migrations[migration.ID] = migration
+	return nil
+}
+
+func (m *mockRepositoryMigrationStore) GetRepositoryMigrationByID(_ context.Context, id uuid.UUID) (*models.RepositoryMigration, error) {
+	migration, ok := m.migrations[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return migration, nil
+}
+
+func (m *mockRepositoryMigrationStore) GetRepositoryMigrationsByOrgID(_ context.Context, orgID uuid.UUID) ([]*models.RepositoryMigration, error) {
+	var out []*models.RepositoryMigration
+	for _, migration := range m.migrations {
+		if migration.OrgID == orgID {
+			out = append(out, migration)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepositoryMigrationStore) GetOpenRepositoryMigration(_ context.Context, repositoryID uuid.UUID) (*models.RepositoryMigration, error) {
+	for _, migration := range m.migrations {
+		if migration.Status == models.RepositoryMigrationStatusCompleted {
+			continue
+		}
+		if *migration.SourceRepositoryID == repositoryID || *migration.TargetRepositoryID == repositoryID {
+			return migration, nil
+		}
+	}
+	return nil, nil
+}
+
+type mockMigrationRunner struct {
+	started []uuid.UUID
+	err     error
+}
+
+func (r *mockMigrationRunner) StartMigration(_ context.Context, id uuid.UUID) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.started = append(r.started, id)
+	return nil
+}
+
+func setupRepositoryMigrationsTestRouter(store *mockRepositoryMigrationStore, runner *mockMigrationRunner, user *auth.SessionUser) *gin.Engine {
+	r := SetupTestRouter(user)
+	handler := NewRepositoryMigrationsHandler(store, runner, zerolog.Nop())
+	handler.RegisterRoutes(r.Group("/api/v1"))
+	return r
+}
+
+func TestRepositoryMigrationsCreate(t *testing.T) {
+	orgID := uuid.New()
+	source := models.NewRepository(orgID, "b2-old", models.RepositoryTypeB2, nil)
+	target := models.NewRepository(orgID, "s3-new", models.RepositoryTypeS3, nil)
+	readOnly := models.NewRepository(orgID, "retired", models.RepositoryTypeLocal, nil)
+	readOnly.ReadOnly = true
+	otherOrg := models.NewRepository(uuid.New(), "foreign", models.RepositoryTypeLocal, nil)
+
+	newStore := func() *mockRepositoryMigrationStore {
+		return &mockRepositoryMigrationStore{
+			repos: map[uuid.UUID]*models.Repository{
+				source.ID: source, target.ID: target, readOnly.ID: readOnly, otherOrg.ID: otherOrg,
+			},
+			migrations: make(map[uuid.UUID]*models.RepositoryMigration),
+		}
+	}
+	body := func(src, dst uuid.UUID, subset string) string {
+		b, _ := json.Marshal(map[string]string{
+			"source_repository_id": src.String(),
+			"target_repository_id": dst.String(),
+			"read_data_subset":     subset,
+		})
+		return string(b)
+	}
+
+	t.Run("starts migration", func(t *testing.T) {
+		store, runner := newStore(), &mockMigrationRunner{}
+		r := setupRepositoryMigrationsTestRouter(store, runner, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/repository-migrations", body(source.ID, target.ID, "10%")))
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var got RepositoryMigrationResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if got.Status != models.RepositoryMigrationStatusPending || got.ReadDataSubset != "10%" {
+			t.Errorf("migration = %+v", got.RepositoryMigration)
+		}
+		if len(runner.started) != 1 || runner.started[0] != got.ID {
+			t.Errorf("runner started %v, want %s", runner.started, got.ID)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		body   string
+		user   *auth.SessionUser
+		status int
+	}{
+		{"same repository", body(source.ID, source.ID, ""), adminUser(orgID), http.StatusBadRequest},
+		{"invalid subset", body(source.ID, target.ID, "lots"), adminUser(orgID), http.StatusBadRequest},
+		{"read-only source", body(readOnly.ID, target.ID, ""), adminUser(orgID), http.StatusBadRequest},
+		{"read-only target", body(source.ID, readOnly.ID, ""), adminUser(orgID), http.StatusBadRequest},
+		{"other org", body(source.ID, otherOrg.ID, ""), adminUser(orgID), http.StatusBadRequest},
+		{"not admin", body(source.ID, target.ID, ""), &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, CurrentOrgRole: "member"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &mockMigrationRunner{}
+			r := setupRepositoryMigrationsTestRouter(newStore(), runner, tt.user)
+			resp := DoRequest(r, JSONRequest("POST", "/api/v1/repository-migrations", tt.body))
+			if resp.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, resp.Code, resp.Body.String())
+			}
+			if len(runner.started) != 0 {
+				t.Error("migration should not start")
+			}
+		})
+	}
+
+	t.Run("repository already migrating", func(t *testing.T) {
+		store := newStore()
+		existing := models.NewRepositoryMigration(orgID, source, readOnly, nil)
+		store.migrations[existing.ID] = existing
+		r := setupRepositoryMigrationsTestRouter(store, &mockMigrationRunner{}, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/repository-migrations", body(source.ID, target.ID, "")))
+		if resp.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+}
+
+func TestRepositoryMigrationsResume(t *testing.T) {
+	orgID := uuid.New()
+	source := models.NewRepository(orgID, "old", models.RepositoryTypeLocal, nil)
+	target := models.NewRepository(orgID, "new", models.RepositoryTypeLocal, nil)
+
+	failed := models.NewRepositoryMigration(orgID, source, target, nil)
+	failed.Fail("network unreachable")
+	completed := models.NewRepositoryMigration(orgID, source, target, nil)
+	completed.Complete()
+
+	store := &mockRepositoryMigrationStore{
+		repos:      map[uuid.UUID]*models.Repository{source.ID: source, target.ID: target},
+		migrations: map[uuid.UUID]*models.RepositoryMigration{failed.ID: failed, completed.ID: completed},
+	}
+
+	t.Run("failed migration resumes", func(t *testing.T) {
+		runner := &mockMigrationRunner{}
+		r := setupRepositoryMigrationsTestRouter(store, runner, adminUser(orgID))
+		resp := DoRequest(r, AuthenticatedRequest("POST", "/api/v1/repository-migrations/"+failed.ID.String()+"/resume"))
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if len(runner.started) != 1 {
+			t.Error("runner should be started")
+		}
+	})
+
+	t.Run("already running", func(t *testing.T) {
+		runner := &mockMigrationRunner{err: backup.ErrMigrationRunning}
+		r := setupRepositoryMigrationsTestRouter(store, runner, adminUser(orgID))
+		resp := DoRequest(r, AuthenticatedRequest("POST", "/api/v1/repository-migrations/"+failed.ID.String()+"/resume"))
+		if resp.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+
+	t.Run("completed migration", func(t *testing.T) {
+		r := setupRepositoryMigrationsTestRouter(store, &mockMigrationRunner{}, adminUser(orgID))
+		resp := DoRequest(r, AuthenticatedRequest("POST", "/api/v1/repository-migrations/"+completed.ID.String()+"/resume"))
+		if resp.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+
+	t.Run("other org", func(t *testing.T) {
+		r := setupRepositoryMigrationsTestRouter(store, &mockMigrationRunner{}, adminUser(uuid.New()))
+		resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/repository-migrations/"+failed.ID.String()))
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// RepositoryTransferStore defines the persistence operations for repository transfer tuning.
+type RepositoryTransferStore interface {
+	GetRepositoryByID(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	GetRepositoryTransferSettings(ctx context.Context, repositoryID uuid.UUID) (*models.RepositoryTransferSettings, error)
+	UpsertRepositoryTransferSettings(ctx context.Context, s *models.RepositoryTransferSettings) error
+	GetBackupTransferMetrics(ctx context.Context, repositoryID uuid.UUID, limit int) ([]*models.BackupTransferMetrics, error)
+	GetRepositoryTransferTrends(ctx context.Context, repositoryID uuid.UUID, since time.Time) ([]*models.RepositoryTransferTrend, error)
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+}
+
+// RepositoryTransferHandler handles repository transfer tuning and metrics HTTP endpoints.
+type RepositoryTransferHandler struct {
+	store  RepositoryTransferStore
+	logger zerolog.Logger
+}
+
+// NewRepositoryTransferHandler creates a new RepositoryTransferHandler.
+func NewRepositoryTransferHandler(store RepositoryTransferStore, logger zerolog.Logger) *RepositoryTransferHandler {
+	return &RepositoryTransferHandler{
+		store:  store,
+		logger: logger.With().Str("component", "repository_transfer_handler").Logger(),
+	}
+}
+
+// RegisterRoutes registers repository transfer routes on the given router group.
+func (h *RepositoryTransferHandler) RegisterRoutes(r *gin.RouterGroup) {
+	repos := r.Group("/repositories")
+	{
+		repos.GET("/:id/transfer-settings", h.GetSettings)
+		repos.PUT("/:id/transfer-settings", h.UpdateSettings)
+		repos.GET("/:id/transfer-metrics", h.GetMetrics)
+	}
+}
+
+// RepositoryTransferSettingsResponse is the API response for a repository's transfer settings.
+type RepositoryTransferSettingsResponse struct {
+	Settings   *models.RepositoryTransferSettings `json:"settings"`
+	Configured bool                               `json:"configured"`
+	// ResticOptions are the global restic flags the settings produce.
+	ResticOptions []string `json:"restic_options"`
+}
+
+// UpdateRepositoryTransferSettingsRequest is the request body for a repository's transfer settings.
+// Omitted fields reset to restic's defaults.
+type UpdateRepositoryTransferSettingsRequest struct {
+	UploadLimitKB   *int              `json:"upload_limit_kb,omitempty" example:"10240"`
+	DownloadLimitKB *int              `json:"download_limit_kb,omitempty" example:"20480"`
+	Connections     *int              `json:"connections,omitempty" example:"10"`
+	PackSizeMB      *int              `json:"pack_size_mb,omitempty" example:"64"`
+	ReadConcurrency *int              `json:"read_concurrency,omitempty" example:"4"`
+	BackendOptions  map[string]string `json:"backend_options,omitempty"`
+}
+
+// RepositoryTransferMetricsResponse is the API response for a repository's transfer metrics.
+type RepositoryTransferMetricsResponse struct {
+	Runs   []*models.BackupTransferMetrics   `json:"runs"`
+	Trends []*models.RepositoryTransferTrend `json:"trends"`
+}
+
+// loadRepository returns the repository if it belongs to the session user's
+// organization and, when adminOnly is set, the user is an org admin. It writes
+// an error response and returns false otherwise.
+func (h *RepositoryTransferHandler) loadRepository(c *gin.Context, adminOnly bool) (*auth.SessionUser, *models.Repository, bool) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return nil, nil, false
+	}
+	if user.CurrentOrgID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no organization selected"})
+		return nil, nil, false
+	}
+	if adminOnly && !isAdmin(user.CurrentOrgRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return nil, nil, false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid repository ID"})
+		return nil, nil, false
+	}
+
+	repo, err := h.store.GetRepositoryByID(c.Request.Context(), id)
+	if err != nil || repo.OrgID != user.CurrentOrgID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "repository not found"})
+		return nil, nil, false
+	}
+	return user, repo, true
+}
+
+// GetSettings returns a repository's transfer settings.
+//
+//	@Summary		Get repository transfer settings
+//	@Description	Returns the repository's bandwidth limits, backend connections, pack size, read concurrency and extra backend options, with the restic flags they produce
+//	@Tags			Repositories
+//	@Produce		json
+//	@Param			id	path		string	true	"Repository ID"
+//	@Success		200	{object}	RepositoryTransferSettingsResponse
+//	@Failure		400	{object}	map[string]string
+//	@Failure		401	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/repositories/{id}/transfer-settings [get]
+func (h *RepositoryTransferHandler) GetSettings(c *gin.Context) {
+	_, repo, ok := h.loadRepository(c, false)
+	if !ok {
+		return
+	}
+
+	settings, err := h.store.GetRepositoryTransferSettings(c.Request.Context(), repo.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("repository_id", repo.ID.String()).Msg("failed to get transfer settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get transfer settings"})
+		return
+	}
+	configured := settings != nil
+	if settings == nil {
+		settings = models.NewRepositoryTransferSettings(repo.OrgID, repo.ID)
+	}
+
+	c.JSON(http.StatusOK, transferSettingsResponse(repo, settings, configured))
+}
+
+// UpdateSettings saves a repository's transfer settings.
+//
+//	@Summary		Update repository transfer settings
+//	@Description	Creates or replaces the repository's transfer settings. They apply to every restic command on the repository, on the server and on agents; a schedule's bandwidth limit overrides the upload limit (admin only)
+//	@Tags			Repositories
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string									true	"Repository ID"
+//	@Param			request	body		UpdateRepositoryTransferSettingsRequest	true	"Transfer settings"
+//	@Success		200		{object}	RepositoryTransferSettingsResponse
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/repositories/{id}/transfer-settings [put]
+func (h *RepositoryTransferHandler) UpdateSettings(c *gin.Context) {
+	user, repo, ok := h.loadRepository(c, true)
+	if !ok {
+		return
+	}
+
+	var req UpdateRepositoryTransferSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	settings, err := h.store.GetRepositoryTransferSettings(ctx, repo.ID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("repository_id", repo.ID.String()).Msg("failed to get transfer settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get transfer settings"})
+		return
+	}
+	if settings == nil {
+		settings = models.NewRepositoryTransferSettings(repo.OrgID, repo.ID)
+	}
+	settings.UploadLimitKB = req.UploadLimitKB
+	settings.DownloadLimitKB = req.DownloadLimitKB
+	settings.Connections = req.Connections
+	settings.PackSizeMB = req.PackSizeMB
+	settings.ReadConcurrency = req.ReadConcurrency
+	settings.BackendOptions = req.BackendOptions
+
+	if err := settings.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.UpsertRepositoryTransferSettings(ctx, settings); err != nil {
+		h.logger.Error().Err(err).Str("repository_id", repo.ID.String()).Msg("failed to save transfer settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save transfer settings"})
+		return
+	}
+
+	resp := transferSettingsResponse(repo, settings, true)
+	auditLog := models.NewAuditLog(repo.OrgID, models.AuditActionUpdate, "repository", models.AuditResultSuccess).
+		WithUser(user.ID).
+		WithResource(repo.ID).
+		WithRequestInfo(c.ClientIP(), c.Request.UserAgent()).
+		WithDetails(fmt.Sprintf("Transfer settings updated: [%s]", strings.Join(resp.ResticOptions, " ")))
+	if err := h.store.CreateAuditLog(ctx, auditLog); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to create audit log")
+	}
+
+	h.logger.Info().
+		Str("repository_id", repo.ID.String()).
+		Strs("restic_options", resp.ResticOptions).
+		Msg("repository transfer settings updated")
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetMetrics returns a repository's recent backup transfer metrics and daily trends.
+//
+//	@Summary		Get repository transfer metrics
+//	@Description	Returns throughput, repository open latency, retries and backend errors of the repository's recent backups, and their daily aggregates
+//	@Tags			Repositories
+//	@Produce		json
+//	@Param			id		path		string	true	"Repository ID"
+//	@Param			days	query		int		false	"Days of trends to return (1-365, default 30)"
+//	@Param			limit	query		int		false	"Recent runs to return (1-500, default 50)"
+//	@Success		200		{object}	RepositoryTransferMetricsResponse
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/repositories/{id}/transfer-metrics [get]
+func (h *RepositoryTransferHandler) GetMetrics(c *gin.Context) {
+	_, repo, ok := h.loadRepository(c, false)
+	if !ok {
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	runs, err := h.store.GetBackupTransferMetrics(ctx, repo.ID, limit)
+	if err != nil {
+		h.logger.Error().Err(err).Str("repository_id", repo.ID.String()).Msg("failed to get transfer metrics")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get transfer metrics"})
+		return
+	}
+	trends, err := h.store.GetRepositoryTransferTrends(ctx, repo.ID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		h.logger.Error().Err(err).Str("repository_id", repo.ID.String()).Msg("failed to get transfer trends")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get transfer trends"})
+		return
+	}
+	if runs == nil {
+		runs = []*models.BackupTransferMetrics{}
+	}
+	if trends == nil {
+		trends = []*models.RepositoryTransferTrend{}
+	}
+
+	c.JSON(http.StatusOK, RepositoryTransferMetricsResponse{Runs: runs, Trends: trends})
+}
+
+// transferSettingsResponse builds the settings response with the restic
+// flags a backup without a schedule bandwidth limit would use.
+func transferSettingsResponse(repo *models.Repository, settings *models.RepositoryTransferSettings, configured bool) RepositoryTransferSettingsResponse {
+	options := backends.TransferOptions(repo.Type, settings, nil)
+	if settings.ReadConcurrency != nil {
+		options = append(options, "--read-concurrency="+strconv.Itoa(*settings.ReadConcurrency))
+	}
+	if options == nil {
+		options = []string{}
+	}
+	return RepositoryTransferSettingsResponse{Settings: settings, Configured: configured, ResticOptions: options}
+}
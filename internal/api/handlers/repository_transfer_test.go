@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockRepositoryTransferStore struct {
+	repos     map[uuid.UUID]*models.Repository
+	settings  map[uuid.UUID]*models.RepositoryTransferSettings
+	runs      []*models.BackupTransferMetrics
+	trends    []*models.RepositoryTransferTrend
+	since     time.Time
+	auditLogs []*models.AuditLog
+}
+
+func (m *mockRepositoryTransferStore) GetRepositoryByID(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	repo, ok := m.repos[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return repo, nil
+}
+
+func (m *mockRepositoryTransferStore) GetRepositoryTransferSettings(_ context.Context, repositoryID uuid.UUID) (*models.RepositoryTransferSettings, error) {
+	return m.settings[repositoryID], nil
+}
+
+func (m *mockRepositoryTransferStore) UpsertRepositoryTransferSettings(_ context.Context, s *models.RepositoryTransferSettings) error {
+	m.settings[s.RepositoryID] = s
+	return nil
+}
+
+func (m *mockRepositoryTransferStore) GetBackupTransferMetrics(_ context.Context, _ uuid.UUID, limit int) ([]*models.BackupTransferMetrics, error) {
+	if len(m.runs) > limit {
+		return m.runs[:limit], nil
+	}
+	return m.runs, nil
+}
+
+func (m *mockRepositoryTransferStore) GetRepositoryTransferTrends(_ context.Context, _ uuid.UUID, since time.Time) ([]*models.RepositoryTransferTrend, error) {
+	m.since = since
+	return m.trends, nil
+}
+
+func (m *mockRepositoryTransferStore) CreateAuditLog(_ context.Context, log *models.AuditLog) error {
+	m.auditLogs = append(m.auditLogs, log)
+	return nil
+}
+
+func setupRepositoryTransferTestRouter(store *mockRepositoryTransferStore, user *auth.SessionUser) *gin.Engine {
+	r := SetupTestRouter(user)
+	NewRepositoryTransferHandler(store, zerolog.Nop()).RegisterRoutes(r.Group("/api/v1"))
+	return r
+}
+
+func TestRepositoryTransferSettings(t *testing.T) {
+	orgID := uuid.New()
+	repo := models.NewRepository(orgID, "offsite", models.RepositoryTypeS3, nil)
+	foreign := models.NewRepository(uuid.New(), "foreign", models.RepositoryTypeS3, nil)
+	newStore := func() *mockRepositoryTransferStore {
+		return &mockRepositoryTransferStore{
+			repos:    map[uuid.UUID]*models.Repository{repo.ID: repo, foreign.ID: foreign},
+			settings: make(map[uuid.UUID]*models.RepositoryTransferSettings),
+		}
+	}
+	path := "/api/v1/repositories/" + repo.ID.String() + "/transfer-settings"
+	member := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, CurrentOrgRole: "member"}
+
+	t.Run("get returns defaults", func(t *testing.T) {
+		r := setupRepositoryTransferTestRouter(newStore(), member)
+		resp := DoRequest(r, AuthenticatedRequest("GET", path))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var got RepositoryTransferSettingsResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Configured || got.Settings == nil || len(got.ResticOptions) != 0 {
+			t.Errorf("response = %+v", got)
+		}
+	})
+
+	t.Run("update saves settings", func(t *testing.T) {
+		store := newStore()
+		r := setupRepositoryTransferTestRouter(store, adminUser(orgID))
+		body := `{"download_limit_kb":2048,"connections":16,"read_concurrency":4,"backend_options":{"s3.storage-class":"STANDARD_IA","azure.access-tier":"Cool"}}`
+		resp := DoRequest(r, JSONRequest("PUT", path, body))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		saved := store.settings[repo.ID]
+		if saved == nil || *saved.Connections != 16 || saved.BackendOptions["s3.storage-class"] != "STANDARD_IA" {
+			t.Fatalf("saved = %+v", saved)
+		}
+
+		var got RepositoryTransferSettingsResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"--limit-download=2048", "--option=s3.connections=16", "--option=s3.storage-class=STANDARD_IA", "--read-concurrency=4"}
+		if len(got.ResticOptions) != len(want) {
+			t.Fatalf("restic options = %v, want %v", got.ResticOptions, want)
+		}
+		for i := range want {
+			if got.ResticOptions[i] != want[i] {
+				t.Errorf("restic options = %v, want %v", got.ResticOptions, want)
+				break
+			}
+		}
+		if len(store.auditLogs) != 1 || store.auditLogs[0].Action != models.AuditActionUpdate {
+			t.Errorf("audit logs = %+v", store.auditLogs)
+		}
+	})
+
+	for _, tt := range []struct {
+		name string
+		body string
+	}{
+		{"connections out of range", `{"connections":0}`},
+		{"pack size too large", `{"pack_size_mb":512}`},
+		{"invalid option key", `{"backend_options":{"--repo":"x"}}`},
+		{"connections as option", `{"backend_options":{"s3.connections":"8"}}`},
+		{"newline in option value", `{"backend_options":{"s3.storage-class":"STANDARD\n--repo"}}`},
+		{"sftp command", `{"backend_options":{"sftp.command":"sh -c id"}}`},
+		{"sftp args", `{"backend_options":{"sftp.args":"-o ProxyCommand=id"}}`},
+		{"rclone program", `{"backend_options":{"rclone.program":"/bin/sh"}}`},
+		{"invalid option value", `{"backend_options":{"s3.bucket-lookup":"any"}}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newStore()
+			r := setupRepositoryTransferTestRouter(store, adminUser(orgID))
+			resp := DoRequest(r, JSONRequest("PUT", path, tt.body))
+			if resp.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+			}
+			if store.settings[repo.ID] != nil {
+				t.Error("invalid settings must not be saved")
+			}
+		})
+	}
+
+	t.Run("update requires admin", func(t *testing.T) {
+		r := setupRepositoryTransferTestRouter(newStore(), member)
+		resp := DoRequest(r, JSONRequest("PUT", path, `{"connections":4}`))
+		if resp.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", resp.Code)
+		}
+	})
+
+	t.Run("other org repository", func(t *testing.T) {
+		r := setupRepositoryTransferTestRouter(newStore(), adminUser(orgID))
+		resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/repositories/"+foreign.ID.String()+"/transfer-settings"))
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", resp.Code)
+		}
+	})
+}
+
+func TestRepositoryTransferMetrics(t *testing.T) {
+	orgID := uuid.New()
+	repo := models.NewRepository(orgID, "offsite", models.RepositoryTypeSFTP, nil)
+	store := &mockRepositoryTransferStore{
+		repos: map[uuid.UUID]*models.Repository{repo.ID: repo},
+		runs: []*models.BackupTransferMetrics{
+			{ID: uuid.New(), RepositoryID: repo.ID, OpenDurationMs: 42000, Retries: 3, BackendErrors: 3},
+		},
+		trends: []*models.RepositoryTransferTrend{
+			{Day: time.Now().Truncate(24 * time.Hour), Runs: 1, Retries: 3, BackendErrors: 3},
+		},
+	}
+	member := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, CurrentOrgRole: "member"}
+	r := setupRepositoryTransferTestRouter(store, member)
+	path := "/api/v1/repositories/" + repo.ID.String() + "/transfer-metrics"
+
+	resp := DoRequest(r, AuthenticatedRequest("GET", path+"?days=7"))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var got RepositoryTransferMetricsResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Runs) != 1 || got.Runs[0].Retries != 3 || len(got.Trends) != 1 {
+		t.Errorf("response = %+v", got)
+	}
+	if since := time.Since(store.since); since < 7*24*time.Hour-time.Minute || since > 7*24*time.Hour+time.Minute {
+		t.Errorf("trends since %v, want 7 days ago", store.since)
+	}
+
+	for _, query := range []string{"?days=0", "?days=abc", "?limit=1000"} {
+		resp := DoRequest(r, AuthenticatedRequest("GET", path+query))
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, resp.Code)
+		}
+	}
+}
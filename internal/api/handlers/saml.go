@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/MacJediWizard/keldris/internal/settings"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// maxSAMLResponseSize bounds the size of a posted SAMLResponse form.
+const maxSAMLResponseSize = 1 << 20
+
+var errSAMLNotConfigured = errors.New("SAML is not configured for this organization")
+
+// SAMLStore defines the persistence operations needed for SAML login.
+type SAMLStore interface {
+	auth.GroupSyncStore
+	GetSAMLSettings(ctx context.Context, orgID uuid.UUID) (*settings.SAMLSettings, error)
+	GetUserByOIDCSubject(ctx context.Context, subject string) (*models.User, error)
+	CreateUser(ctx context.Context, user *models.User) error
+	CreateUserSession(ctx context.Context, session *models.UserSession) error
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+	auth.SAMLReplayStore
+}
+
+// SAMLHandler handles SAML 2.0 service provider endpoints. Each organization
+// configures its own IdP, so every endpoint is scoped by organization ID.
+type SAMLHandler struct {
+	store     SAMLStore
+	sessions  *auth.SessionStore
+	groupSync *auth.GroupSync
+	serverURL string
+	logger    zerolog.Logger
+}
+
+// NewSAMLHandler creates a new SAMLHandler. serverURL is used to build the
+// default SP entity ID and ACS URL.
+func NewSAMLHandler(store SAMLStore, sessions *auth.SessionStore, serverURL string, logger zerolog.Logger) *SAMLHandler {
+	return &SAMLHandler{
+		store:     store,
+		sessions:  sessions,
+		groupSync: auth.NewGroupSync(store, logger),
+		serverURL: strings.TrimSuffix(serverURL, "/"),
+		logger:    logger.With().Str("component", "saml_handler").Logger(),
+	}
+}
+
+// RegisterRoutes registers SAML routes on the auth router group.
+func (h *SAMLHandler) RegisterRoutes(r *gin.RouterGroup) {
+	saml := r.Group("/saml")
+	{
+		saml.GET("/:org_id/metadata", h.Metadata)
+		saml.GET("/:org_id/login", h.Login)
+		saml.POST("/:org_id/acs", h.ACS)
+	}
+}
+
+// serviceProvider builds the SAML service provider for an organization.
+func (h *SAMLHandler) serviceProvider(c *gin.Context, orgID uuid.UUID) (*auth.SAMLServiceProvider, *settings.SAMLSettings, error) {
+	cfg, err := h.store.GetSAMLSettings(c.Request.Context(), orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !cfg.Enabled || cfg.SPPrivateKey == "" {
+		return nil, nil, errSAMLNotConfigured
+	}
+
+	orgBase := externalBaseURL(c, h.serverURL) + "/auth/saml/" + orgID.String()
+
+	spConfig := auth.SAMLConfig{
+		EntityID:       cfg.SPEntityID,
+		ACSURL:         cfg.ACSURL,
+		IdPEntityID:    cfg.IdPEntityID,
+		IdPSSOURL:      cfg.IdPSSOURL,
+		IdPCertificate: cfg.IdPCertificate,
+		Certificate:    cfg.SPCertificate,
+		PrivateKey:     cfg.SPPrivateKey,
+	}
+	if spConfig.EntityID == "" {
+		spConfig.EntityID = orgBase + "/metadata"
+	}
+	if spConfig.ACSURL == "" {
+		spConfig.ACSURL = orgBase + "/acs"
+	}
+
+	sp, err := auth.NewSAMLServiceProvider(spConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sp, cfg, nil
+}
+
+// externalBaseURL returns the configured server URL, falling back to the
+// scheme and host of the request.
+func externalBaseURL(c *gin.Context, serverURL string) string {
+	if serverURL != "" {
+		return strings.TrimSuffix(serverURL, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// loadServiceProvider parses the org ID and loads its service provider,
+// writing an error response on failure.
+func (h *SAMLHandler) loadServiceProvider(c *gin.Context) (uuid.UUID, *auth.SAMLServiceProvider, *settings.SAMLSettings, bool) {
+	orgID, err := uuid.Parse(c.Param("org_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization ID"})
+		return uuid.Nil, nil, nil, false
+	}
+
+	sp, cfg, err := h.serviceProvider(c, orgID)
+	if err != nil {
+		if errors.Is(err, errSAMLNotConfigured) {
+			c.JSON(http.StatusNotFound, gin.H{"error": errSAMLNotConfigured.Error()})
+		} else {
+			h.logger.Error().Err(err).Str("org_id", orgID.String()).Msg("failed to load SAML configuration")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load SAML configuration"})
+		}
+		return uuid.Nil, nil, nil, false
+	}
+	return orgID, sp, cfg, true
+}
+
+// Metadata returns the SP metadata for an organization.
+//
+//	@Summary		SAML SP metadata
+//	@Description	Returns the SAML service provider metadata to register with the organization's identity provider
+//	@Tags			Auth
+//	@Produce		xml
+//	@Param			org_id	path	string	true	"Organization ID"
+//	@Success		200
+//	@Failure		404	{object}	map[string]string
+//	@Router			/auth/saml/{org_id}/metadata [get]
+func (h *SAMLHandler) Metadata(c *gin.Context) {
+	_, sp, _, ok := h.loadServiceProvider(c)
+	if !ok {
+		return
+	}
+
+	metadata, err := sp.Metadata()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to generate SAML metadata")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate metadata"})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// Login starts SP-initiated SAML login.
+//
+//	@Summary		Initiate SAML login
+//	@Description	Redirects to the organization's SAML identity provider with a signed AuthnRequest
+//	@Tags			Auth
+//	@Param			org_id	path	string	true	"Organization ID"
+//	@Success		302		"Redirect to identity provider"
+//	@Failure		404		{object}	map[string]string
+//	@Router			/auth/saml/{org_id}/login [get]
+func (h *SAMLHandler) Login(c *gin.Context) {
+	orgID, sp, _, ok := h.loadServiceProvider(c)
+	if !ok {
+		return
+	}
+
+	requestID, err := auth.NewSAMLRequestID()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to generate SAML request ID")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to initiate login"})
+		return
+	}
+
+	redirectURL, err := sp.AuthnRequestURL(requestID, h.sessions.SignSAMLRelayState(orgID, requestID))
+	if err != nil {
+		h.logger.Error().Err(err).Str("org_id", orgID.String()).Msg("failed to build SAML AuthnRequest")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to initiate login"})
+		return
+	}
+
+	h.logger.Debug().Str("org_id", orgID.String()).Str("request_id", requestID).Msg("redirecting to SAML IdP")
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// ACS is the assertion consumer service that completes SAML login.
+//
+//	@Summary		SAML assertion consumer service
+//	@Description	Receives the IdP's HTTP-POST SAMLResponse, validates it, signs the user in and redirects to the dashboard
+//	@Tags			Auth
+//	@Accept			x-www-form-urlencoded
+//	@Param			org_id			path		string	true	"Organization ID"
+//	@Param			SAMLResponse	formData	string	true	"Base64 encoded SAML response"
+//	@Param			RelayState		formData	string	true	"Relay state issued at login"
+//	@Success		302				"Redirect to dashboard"
+//	@Failure		400				{object}	map[string]string
+//	@Failure		401				{object}	map[string]string
+//	@Failure		403				{object}	map[string]string
+//	@Router			/auth/saml/{org_id}/acs [post]
+func (h *SAMLHandler) ACS(c *gin.Context) {
+	orgID, sp, cfg, ok := h.loadServiceProvider(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSAMLResponseSize)
+	samlResponse := c.PostForm("SAMLResponse")
+	if samlResponse == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing SAMLResponse"})
+		return
+	}
+
+	relayOrgID, requestID, err := h.sessions.VerifySAMLRelayState(c.PostForm("RelayState"))
+	if err != nil || relayOrgID != orgID {
+		h.logger.Warn().Err(err).Str("org_id", orgID.String()).Msg("invalid SAML relay state")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired login request"})
+		return
+	}
+
+	assertion, err := sp.ParseResponse(samlResponse, requestID)
+	if err == nil {
+		err = auth.UseSAMLAssertion(c.Request.Context(), h.store, orgID, assertion)
+	}
+	if err != nil {
+		h.logger.Warn().Err(err).Str("org_id", orgID.String()).Msg("rejected SAML response")
+		h.auditLogin(c, orgID, nil, models.AuditResultFailure, "SAML login rejected: "+err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "SAML authentication failed"})
+		return
+	}
+
+	user, err := h.findOrCreateUser(c.Request.Context(), orgID, cfg, assertion)
+	if err != nil {
+		h.logger.Warn().Err(err).Str("org_id", orgID.String()).Str("name_id", assertion.NameID).Msg("SAML login denied")
+		h.auditLogin(c, orgID, nil, models.AuditResultDenied, "SAML login denied for "+assertion.NameID+": "+err.Error())
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	groups := h.groupSync.ExtractGroupsFromSAML(assertion, cfg.GroupsAttribute)
+	if len(groups) > 0 {
+		syncResult, err := h.groupSync.SyncUserGroupsForOrg(c.Request.Context(), user.ID, orgID, groups)
+		if err != nil {
+			h.logger.Warn().Err(err).Str("user_id", user.ID.String()).Msg("failed to sync user groups")
+		} else {
+			for _, mapping := range syncResult.MembershipsAdded {
+				auditLog := models.NewAuditLog(mapping.OrgID, models.AuditActionCreate, "membership", models.AuditResultSuccess).
+					WithUser(user.ID).
+					WithDetails("SAML group sync: " + mapping.OIDCGroupName)
+				if err := h.store.CreateAuditLog(c.Request.Context(), auditLog); err != nil {
+					h.logger.Warn().Err(err).Msg("failed to create audit log for group sync")
+				}
+			}
+		}
+	}
+
+	membership, err := h.store.GetMembershipByUserAndOrg(c.Request.Context(), user.ID, orgID)
+	if err != nil {
+		h.auditLogin(c, orgID, &user.ID, models.AuditResultDenied, "SAML login denied: not a member of the organization")
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to this organization"})
+		return
+	}
+
+	sessionRecordID, err := startLoginSession(c, h.sessions, h.store, h.logger, user, orgID, string(membership.Role))
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to save user to session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication failed"})
+		return
+	}
+
+	h.auditLogin(c, orgID, &user.ID, models.AuditResultSuccess, "SAML login")
+	h.logger.Info().
+		Str("user_id", user.ID.String()).
+		Str("org_id", orgID.String()).
+		Str("session_id", sessionRecordID.String()).
+		Msg("user authenticated via SAML")
+
+	c.Redirect(http.StatusFound, "/")
+}
+
+// findOrCreateUser returns the user for the asserted NameID, provisioning a
+// new user and membership when the organization allows it.
+func (h *SAMLHandler) findOrCreateUser(ctx context.Context, orgID uuid.UUID, cfg *settings.SAMLSettings, assertion *auth.SAMLAssertion) (*models.User, error) {
+	subject := auth.SAMLSubject(orgID, assertion.NameID)
+
+	user, err := h.store.GetUserByOIDCSubject(ctx, subject)
+	if err == nil {
+		if !user.IsActive() {
+			return nil, errors.New("user account is not active")
+		}
+		return user, nil
+	}
+
+	if !cfg.AutoCreateUsers {
+		return nil, errors.New("no account exists for this SAML identity")
+	}
+
+	email := samlEmail(cfg, assertion)
+	if email == "" {
+		return nil, errors.New("SAML assertion has no email address")
+	}
+	if !emailDomainAllowed(email, cfg.AllowedDomains) {
+		return nil, errors.New("email domain is not allowed")
+	}
+	name := samlName(cfg, assertion)
+	if name == "" {
+		name = email
+	}
+
+	user = models.NewUser(orgID, subject, email, name, models.UserRoleUser)
+	if err := h.store.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	membership := models.NewOrgMembership(user.ID, orgID, models.OrgRole(cfg.DefaultRole))
+	if err := h.store.CreateMembership(ctx, membership); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create membership for new SAML user")
+	}
+
+	h.logger.Info().
+		Str("user_id", user.ID.String()).
+		Str("email", user.Email).
+		Str("org_id", orgID.String()).
+		Msg("created new user from SAML login")
+
+	return user, nil
+}
+
+func (h *SAMLHandler) auditLogin(c *gin.Context, orgID uuid.UUID, userID *uuid.UUID, result models.AuditResult, details string) {
+	auditLog := models.NewAuditLog(orgID, models.AuditActionLogin, "user", result).
+		WithRequestInfo(c.ClientIP(), c.Request.UserAgent()).
+		WithDetails(details)
+	if userID != nil {
+		auditLog.WithUser(*userID).WithResource(*userID)
+	}
+	if err := h.store.CreateAuditLog(c.Request.Context(), auditLog); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to create audit log for SAML login")
+	}
+}
+
+func samlEmail(cfg *settings.SAMLSettings, assertion *auth.SAMLAssertion) string {
+	names := []string{cfg.EmailAttribute}
+	if cfg.EmailAttribute == "" {
+		names = []string{
+			"email",
+			"mail",
+			"emailaddress",
+			"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+			"urn:oid:0.9.2342.19200300.100.1.3",
+		}
+	}
+	if values := assertion.Attribute(names...); len(values) > 0 {
+		return values[0]
+	}
+	if strings.Contains(assertion.NameID, "@") {
+		return assertion.NameID
+	}
+	return ""
+}
+
+func samlName(cfg *settings.SAMLSettings, assertion *auth.SAMLAssertion) string {
+	names := []string{cfg.NameAttribute}
+	if cfg.NameAttribute == "" {
+		names = []string{
+			"displayName",
+			"name",
+			"cn",
+			"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+			"urn:oid:2.16.840.1.113730.3.1.241",
+			"urn:oid:2.5.4.3",
+		}
+	}
+	if values := assertion.Attribute(names...); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// emailDomainAllowed reports whether email is in one of domains. An empty
+// list allows every domain.
+func emailDomainAllowed(email string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, d := range domains {
+		if strings.ToLower(strings.TrimSpace(d)) == domain {
+			return true
+		}
+	}
+	return false
+}
@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/approval"
 	"github.com/MacJediWizard/keldris/internal/auth"
 	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/gin-gonic/gin"
@@ -33,9 +36,10 @@ type ScheduleStore interface {
 
 // SchedulesHandler handles schedule-related HTTP endpoints.
 type SchedulesHandler struct {
-	store  ScheduleStore
-	rbac   *auth.RBAC
-	logger zerolog.Logger
+	store     ScheduleStore
+	rbac      *auth.RBAC
+	approvals ApprovalGate
+	logger    zerolog.Logger
 }
 
 // NewSchedulesHandler creates a new SchedulesHandler.
@@ -47,6 +51,13 @@ func NewSchedulesHandler(store ScheduleStore, rbac *auth.RBAC, logger zerolog.Lo
 	}
 }
 
+// SetApprovalGate enables four-eyes approval for retention policy changes,
+// which forget and prune snapshots on the schedule's next run.
+func (h *SchedulesHandler) SetApprovalGate(gate ApprovalGate) {
+	h.approvals = gate
+	gate.Register(models.ApprovalActionRetentionChange, h.executeApprovedRetention)
+}
+
 // RegisterRoutes registers schedule routes on the given router group.
 func (h *SchedulesHandler) RegisterRoutes(r *gin.RouterGroup) {
 	schedules := r.Group("/schedules")
@@ -76,7 +87,7 @@ type CreateScheduleRequest struct {
 	AgentID            uuid.UUID                     `json:"agent_id" binding:"required"`
 	Repositories       []ScheduleRepositoryRequest   `json:"repositories" binding:"required,min=1"`
 	Name               string                        `json:"name" binding:"required,min=1,max=255"`
-	BackupType         string                        `json:"backup_type,omitempty"`                 // "file" (default), "docker", "pihole", "postgres", or "proxmox"
+	BackupType         string                        `json:"backup_type,omitempty"`                 // "file" (default), "docker", "pihole", "postgres", "proxmox", "kubernetes", or "libvirt"
 	CronExpression     string                        `json:"cron_expression" binding:"required"`
 	Paths              []string                      `json:"paths,omitempty"`                       // Required for file backups, optional for docker/postgres/proxmox
 	Excludes           []string                      `json:"excludes,omitempty"`
@@ -87,18 +98,23 @@ type CreateScheduleRequest struct {
 	CompressionLevel   *string                       `json:"compression_level,omitempty"`
 	MaxFileSizeMB      *int                          `json:"max_file_size_mb,omitempty"`            // Max file size in MB (0 = disabled)
 	OnMountUnavailable string                        `json:"on_mount_unavailable,omitempty"`        // "skip" or "fail"
+	FilesystemSnapshot string                        `json:"filesystem_snapshot,omitempty"`         // "off" (default), "auto", or "required"
 	Priority           *int                          `json:"priority,omitempty"`                    // 1=high, 2=medium, 3=low
 	Preemptible        *bool                         `json:"preemptible,omitempty"`                 // Can be preempted by higher priority
 	DockerOptions      *models.DockerBackupOptions   `json:"docker_options,omitempty"`              // Docker-specific backup options
 	PostgresOptions    *models.PostgresBackupConfig  `json:"postgres_options,omitempty"`            // PostgreSQL-specific backup options
+	PostgresPasswordEncrypted string                      `json:"postgres_password_encrypted,omitempty"` // From POST /postgres/encrypt-password
+	MySQLOptions       *models.MySQLBackupConfig     `json:"mysql_options,omitempty"`               // MySQL/MariaDB-specific backup options
 	ProxmoxOptions     *models.ProxmoxBackupOptions  `json:"proxmox_options,omitempty"`             // Proxmox-specific backup options
+	KubernetesOptions  *models.KubernetesBackupOptions `json:"kubernetes_options,omitempty"`       // Kubernetes-specific backup options
+	LibvirtOptions     *models.LibvirtBackupOptions  `json:"libvirt_options,omitempty"`             // libvirt/KVM-specific backup options
 	Enabled            *bool                         `json:"enabled,omitempty"`
 }
 
 // UpdateScheduleRequest is the request body for updating a schedule.
 type UpdateScheduleRequest struct {
 	Name               string                        `json:"name,omitempty"`
-	BackupType         string                        `json:"backup_type,omitempty"` // "file", "docker", "pihole", "postgres", or "proxmox"
+	BackupType         string                        `json:"backup_type,omitempty"` // "file", "docker", "pihole", "postgres", "proxmox", "kubernetes", or "libvirt"
 	CronExpression     string                        `json:"cron_expression,omitempty"`
 	Paths              []string                      `json:"paths,omitempty"`
 	Excludes           []string                      `json:"excludes,omitempty"`
@@ -110,11 +126,16 @@ type UpdateScheduleRequest struct {
 	CompressionLevel   *string                       `json:"compression_level,omitempty"`
 	MaxFileSizeMB      *int                          `json:"max_file_size_mb,omitempty"`     // Max file size in MB (0 = disabled)
 	OnMountUnavailable *string                       `json:"on_mount_unavailable,omitempty"` // "skip" or "fail"
+	FilesystemSnapshot *string                       `json:"filesystem_snapshot,omitempty"`  // "off", "auto", or "required"
 	Priority           *int                          `json:"priority,omitempty"`             // 1=high, 2=medium, 3=low
 	Preemptible        *bool                         `json:"preemptible,omitempty"`          // Can be preempted by higher priority
 	DockerOptions      *models.DockerBackupOptions   `json:"docker_options,omitempty"`       // Docker-specific backup options
 	PostgresOptions    *models.PostgresBackupConfig  `json:"postgres_options,omitempty"`     // PostgreSQL-specific backup options
+	PostgresPasswordEncrypted string                      `json:"postgres_password_encrypted,omitempty"` // From POST /postgres/encrypt-password; empty keeps the current one
+	MySQLOptions       *models.MySQLBackupConfig     `json:"mysql_options,omitempty"`        // MySQL/MariaDB-specific backup options
 	ProxmoxOptions     *models.ProxmoxBackupOptions  `json:"proxmox_options,omitempty"`      // Proxmox-specific backup options
+	KubernetesOptions  *models.KubernetesBackupOptions `json:"kubernetes_options,omitempty"` // Kubernetes-specific backup options
+	LibvirtOptions     *models.LibvirtBackupOptions  `json:"libvirt_options,omitempty"`      // libvirt/KVM-specific backup options
 	Enabled            *bool                         `json:"enabled,omitempty"`
 }
 
@@ -164,8 +185,7 @@ func (h *SchedulesHandler) List(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermScheduleRead); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermScheduleRead) {
 		return
 	}
 
@@ -196,7 +216,7 @@ func (h *SchedulesHandler) List(c *gin.Context) {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+		c.JSON(http.StatusOK, gin.H{"schedules": h.visibleSchedules(c.Request.Context(), user, schedules)})
 		return
 	}
 
@@ -218,7 +238,29 @@ func (h *SchedulesHandler) List(c *gin.Context) {
 		allSchedules = append(allSchedules, schedules...)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"schedules": allSchedules})
+	c.JSON(http.StatusOK, gin.H{"schedules": h.visibleSchedules(c.Request.Context(), user, allSchedules)})
+}
+
+// visibleSchedules filters schedules down to those the user may read. Users
+// with organization-wide schedule:read see all of them; users whose access
+// comes from scoped role bindings only see schedules within their scope.
+func (h *SchedulesHandler) visibleSchedules(ctx context.Context, user *auth.SessionUser, schedules []*models.Schedule) []*models.Schedule {
+	if has, err := h.rbac.HasPermission(ctx, user.ID, user.CurrentOrgID, auth.PermScheduleRead); err == nil && has {
+		return schedules
+	}
+
+	visible := make([]*models.Schedule, 0, len(schedules))
+	for _, schedule := range schedules {
+		has, err := h.rbac.HasPermissionForAnyResource(ctx, user.ID, user.CurrentOrgID, auth.PermScheduleRead, scheduleScopes(schedule))
+		if err != nil {
+			h.logger.Error().Err(err).Str("schedule_id", schedule.ID.String()).Msg("failed to check schedule permission")
+			continue
+		}
+		if has {
+			visible = append(visible, schedule)
+		}
+	}
+	return visible
 }
 
 // Get returns a specific schedule by ID.
@@ -247,8 +289,7 @@ func (h *SchedulesHandler) Get(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermScheduleRead); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermScheduleRead) {
 		return
 	}
 
@@ -270,6 +311,9 @@ func (h *SchedulesHandler) Get(c *gin.Context) {
 	if err := h.verifyScheduleAccess(c, user.CurrentOrgID, schedule); err != nil {
 		return
 	}
+	if !requireScopedPermission(c, h.rbac, user, auth.PermScheduleRead, scheduleScopes(schedule)...) {
+		return
+	}
 
 	c.JSON(http.StatusOK, schedule)
 }
@@ -300,8 +344,7 @@ func (h *SchedulesHandler) Create(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermScheduleCreate); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermScheduleCreate) {
 		return
 	}
 
@@ -334,6 +377,10 @@ func (h *SchedulesHandler) Create(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "repository not found: " + repoReq.RepositoryID.String()})
 			return
 		}
+		if repo.ReadOnly {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "repository is read-only: " + repo.Name})
+			return
+		}
 
 		scheduleRepos = append(scheduleRepos, models.ScheduleRepository{
 			RepositoryID: repoReq.RepositoryID,
@@ -352,6 +399,13 @@ func (h *SchedulesHandler) Create(c *gin.Context) {
 	schedule := models.NewSchedule(req.AgentID, req.Name, req.CronExpression, req.Paths)
 	schedule.Repositories = scheduleRepos
 
+	// Every agent and repository pair of the new schedule must be in scope.
+	for _, scope := range scheduleScopes(schedule) {
+		if !requireScopedPermission(c, h.rbac, user, auth.PermScheduleCreate, scope) {
+			return
+		}
+	}
+
 	if req.Excludes != nil {
 		schedule.Excludes = req.Excludes
 	}
@@ -386,6 +440,12 @@ func (h *SchedulesHandler) Create(c *gin.Context) {
 		schedule.OnMountUnavailable = models.MountBehavior(req.OnMountUnavailable)
 	}
 
+	if !models.FilesystemSnapshotMode(req.FilesystemSnapshot).IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "filesystem_snapshot must be off, auto, or required"})
+		return
+	}
+	schedule.FilesystemSnapshot = models.FilesystemSnapshotMode(req.FilesystemSnapshot)
+
 	if req.Priority != nil {
 		if *req.Priority >= 1 && *req.Priority <= 3 {
 			schedule.Priority = models.SchedulePriority(*req.Priority)
@@ -411,13 +471,41 @@ func (h *SchedulesHandler) Create(c *gin.Context) {
 	// Handle PostgreSQL-specific options
 	if req.PostgresOptions != nil {
 		schedule.PostgresConfig = req.PostgresOptions
+		schedule.PostgresConfig.PasswordEncrypted = req.PostgresPasswordEncrypted
+	}
+
+	// Handle MySQL-specific options
+	if req.MySQLOptions != nil {
+		schedule.MySQLConfig = req.MySQLOptions
 	}
 
 	// Handle Proxmox-specific options
 	if req.ProxmoxOptions != nil {
+		if err := req.ProxmoxOptions.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		schedule.ProxmoxOptions = req.ProxmoxOptions
 	}
 
+	// Handle Kubernetes-specific options
+	if req.KubernetesOptions != nil {
+		if err := req.KubernetesOptions.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		schedule.KubernetesOptions = req.KubernetesOptions
+	}
+
+	// Handle libvirt-specific options
+	if req.LibvirtOptions != nil {
+		if err := req.LibvirtOptions.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		schedule.LibvirtOptions = req.LibvirtOptions
+	}
+
 	// Validate paths for file backups
 	if schedule.BackupType == models.BackupTypeFile && len(schedule.Paths) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "paths are required for file backups"})
@@ -430,6 +518,12 @@ func (h *SchedulesHandler) Create(c *gin.Context) {
 		return
 	}
 
+	// Validate MySQL backups name their database connection
+	if schedule.BackupType == models.BackupTypeMySQL && (schedule.MySQLConfig == nil || schedule.MySQLConfig.DatabaseConnectionID == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mysql_options with a database_connection_id are required for MySQL backups"})
+		return
+	}
+
 	if req.Enabled != nil {
 		schedule.Enabled = *req.Enabled
 	}
@@ -478,8 +572,7 @@ func (h *SchedulesHandler) Update(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermScheduleUpdate); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermScheduleUpdate) {
 		return
 	}
 
@@ -505,6 +598,47 @@ func (h *SchedulesHandler) Update(c *gin.Context) {
 	if err := h.verifyScheduleAccess(c, user.CurrentOrgID, schedule); err != nil {
 		return
 	}
+	if !requireScopedPermission(c, h.rbac, user, auth.PermScheduleUpdate, scheduleScopes(schedule)...) {
+		return
+	}
+
+	// Any change to the retention policy, including setting one where there
+	// was none, may need a second admin's approval. The new policy is held
+	// back and submitted before the rest of the update is saved, so a
+	// conflicting pending request rejects the whole update.
+	var pendingRetention *models.ApprovalRequest
+	if h.approvals != nil && req.RetentionPolicy != nil && (schedule.RetentionPolicy == nil || *req.RetentionPolicy != *schedule.RetentionPolicy) {
+		required, err := h.approvals.Required(c.Request.Context(), user.CurrentOrgID, models.ApprovalActionRetentionChange)
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to check approval policy")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check approval policy"})
+			return
+		}
+		if required {
+			approvalReq := models.NewApprovalRequest(user.CurrentOrgID, user.ID, models.ApprovalActionRetentionChange,
+				"schedule", schedule.ID.String(), "Change retention policy for schedule "+schedule.Name)
+			approvalReq.Reason = c.Query("reason")
+			if err := approvalReq.SetPayload(req.RetentionPolicy); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to submit approval request"})
+				return
+			}
+			pending, err := h.approvals.Submit(c.Request.Context(), approvalReq)
+			if errors.Is(err, approval.ErrPendingConflict) {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":            err.Error(),
+					"approval_request": pending,
+				})
+				return
+			}
+			if err != nil {
+				h.logger.Error().Err(err).Str("schedule_id", id.String()).Msg("failed to submit approval request")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to submit approval request"})
+				return
+			}
+			pendingRetention = pending
+			req.RetentionPolicy = nil
+		}
+	}
 
 	// Update fields
 	if req.Name != "" {
@@ -545,6 +679,13 @@ func (h *SchedulesHandler) Update(c *gin.Context) {
 	if req.OnMountUnavailable != nil {
 		schedule.OnMountUnavailable = models.MountBehavior(*req.OnMountUnavailable)
 	}
+	if req.FilesystemSnapshot != nil {
+		if !models.FilesystemSnapshotMode(*req.FilesystemSnapshot).IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "filesystem_snapshot must be off, auto, or required"})
+			return
+		}
+		schedule.FilesystemSnapshot = models.FilesystemSnapshotMode(*req.FilesystemSnapshot)
+	}
 	if req.Priority != nil {
 		if *req.Priority >= 1 && *req.Priority <= 3 {
 			schedule.Priority = models.SchedulePriority(*req.Priority)
@@ -564,16 +705,50 @@ func (h *SchedulesHandler) Update(c *gin.Context) {
 		schedule.DockerOptions = req.DockerOptions
 	}
 
-	// Handle PostgreSQL-specific options
+	// Handle PostgreSQL-specific options, keeping the stored password
+	// unless a new one is given
 	if req.PostgresOptions != nil {
+		if schedule.PostgresConfig != nil {
+			req.PostgresOptions.PasswordEncrypted = schedule.PostgresConfig.PasswordEncrypted
+		}
 		schedule.PostgresConfig = req.PostgresOptions
 	}
+	if req.PostgresPasswordEncrypted != "" && schedule.PostgresConfig != nil {
+		schedule.PostgresConfig.PasswordEncrypted = req.PostgresPasswordEncrypted
+	}
+
+	// Handle MySQL-specific options
+	if req.MySQLOptions != nil {
+		schedule.MySQLConfig = req.MySQLOptions
+	}
 
 	// Handle Proxmox-specific options
 	if req.ProxmoxOptions != nil {
+		if err := req.ProxmoxOptions.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		schedule.ProxmoxOptions = req.ProxmoxOptions
 	}
 
+	// Handle Kubernetes-specific options
+	if req.KubernetesOptions != nil {
+		if err := req.KubernetesOptions.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		schedule.KubernetesOptions = req.KubernetesOptions
+	}
+
+	// Handle libvirt-specific options
+	if req.LibvirtOptions != nil {
+		if err := req.LibvirtOptions.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		schedule.LibvirtOptions = req.LibvirtOptions
+	}
+
 	if req.OnMountUnavailable != nil {
 		schedule.OnMountUnavailable = models.MountBehavior(*req.OnMountUnavailable)
 	}
@@ -595,6 +770,13 @@ func (h *SchedulesHandler) Update(c *gin.Context) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "repository not found: " + repoReq.RepositoryID.String()})
 				return
 			}
+			if repo.ReadOnly {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "repository is read-only: " + repo.Name})
+				return
+			}
+			if !requireScopedPermission(c, h.rbac, user, auth.PermScheduleUpdate, auth.ResourceScope{AgentID: schedule.AgentID, RepositoryID: repo.ID}) {
+				return
+			}
 
 			scheduleRepos = append(scheduleRepos, models.ScheduleRepository{
 				RepositoryID: repoReq.RepositoryID,
@@ -619,9 +801,51 @@ func (h *SchedulesHandler) Update(c *gin.Context) {
 	}
 
 	h.logger.Info().Str("schedule_id", id.String()).Msg("schedule updated")
+
+	if pendingRetention != nil {
+		c.JSON(http.StatusAccepted, gin.H{
+			"schedule":         schedule,
+			"approval_request": pendingRetention,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, schedule)
 }
 
+// executeApprovedRetention applies a retention policy once the change has been approved.
+func (h *SchedulesHandler) executeApprovedRetention(ctx context.Context, req *models.ApprovalRequest) error {
+	id, err := uuid.Parse(req.ResourceID)
+	if err != nil {
+		return fmt.Errorf("invalid schedule ID: %w", err)
+	}
+
+	schedule, err := h.store.GetScheduleByID(ctx, id)
+	if err != nil {
+		return errors.New("schedule not found")
+	}
+	agent, err := h.store.GetAgentByID(ctx, schedule.AgentID)
+	if err != nil || agent.OrgID != req.OrgID {
+		return errors.New("schedule not found")
+	}
+
+	var retention models.RetentionPolicy
+	if err := json.Unmarshal(req.Payload, &retention); err != nil {
+		return fmt.Errorf("decode approved retention policy: %w", err)
+	}
+	schedule.RetentionPolicy = &retention
+
+	if err := h.store.UpdateSchedule(ctx, schedule); err != nil {
+		return fmt.Errorf("update schedule: %w", err)
+	}
+
+	h.logger.Info().
+		Str("schedule_id", id.String()).
+		Str("approval_request_id", req.ID.String()).
+		Msg("retention policy updated after approval")
+	return nil
+}
+
 // Delete removes a schedule.
 //
 //	@Summary		Delete schedule
@@ -649,8 +873,7 @@ func (h *SchedulesHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermScheduleDelete); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermScheduleDelete) {
 		return
 	}
 
@@ -670,6 +893,9 @@ func (h *SchedulesHandler) Delete(c *gin.Context) {
 	if err := h.verifyScheduleAccess(c, user.CurrentOrgID, schedule); err != nil {
 		return
 	}
+	if !requireScopedPermission(c, h.rbac, user, auth.PermScheduleDelete, scheduleScopes(schedule)...) {
+		return
+	}
 
 	if err := h.store.DeleteSchedule(c.Request.Context(), id); err != nil {
 		h.logger.Error().Err(err).Str("schedule_id", id.String()).Msg("failed to delete schedule")
@@ -753,8 +979,7 @@ func (h *SchedulesHandler) Run(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermScheduleRun); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermScheduleRun) {
 		return
 	}
 
@@ -774,6 +999,9 @@ func (h *SchedulesHandler) Run(c *gin.Context) {
 	if err := h.verifyScheduleAccess(c, user.CurrentOrgID, schedule); err != nil {
 		return
 	}
+	if !requireScopedPermission(c, h.rbac, user, auth.PermScheduleRun, scheduleScopes(schedule)...) {
+		return
+	}
 
 	// Dispatch a backup_now command to the agent (the agent will create the
 	// backup record when it actually runs via ReportBackup).
@@ -830,8 +1058,7 @@ func (h *SchedulesHandler) DryRun(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermScheduleRun); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermScheduleRun) {
 		return
 	}
 
@@ -851,6 +1078,9 @@ func (h *SchedulesHandler) DryRun(c *gin.Context) {
 	if err := h.verifyScheduleAccess(c, user.CurrentOrgID, schedule); err != nil {
 		return
 	}
+	if !requireScopedPermission(c, h.rbac, user, auth.PermScheduleRun, scheduleScopes(schedule)...) {
+		return
+	}
 
 	cmd := models.NewAgentCommand(
 		schedule.AgentID,
@@ -879,6 +1109,18 @@ func (h *SchedulesHandler) DryRun(c *gin.Context) {
 	})
 }
 
+// canCreateSchedule reports whether every agent and repository pair of the
+// schedule is within the user's schedule:create scope.
+func (h *SchedulesHandler) canCreateSchedule(ctx context.Context, user *auth.SessionUser, schedule *models.Schedule) (bool, error) {
+	for _, scope := range scheduleScopes(schedule) {
+		has, err := h.rbac.HasPermissionForResource(ctx, user.ID, user.CurrentOrgID, auth.PermScheduleCreate, scope)
+		if err != nil || !has {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
 // verifyScheduleAccess checks if the user has access to the schedule.
 // Returns nil if access is granted, or sends an error response and returns error.
 func (h *SchedulesHandler) verifyScheduleAccess(c *gin.Context, orgID uuid.UUID, schedule *models.Schedule) error {
@@ -909,8 +1151,7 @@ func (h *SchedulesHandler) GetReplicationStatus(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermScheduleRead); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermScheduleRead) {
 		return
 	}
 
@@ -930,6 +1171,9 @@ func (h *SchedulesHandler) GetReplicationStatus(c *gin.Context) {
 	if err := h.verifyScheduleAccess(c, user.CurrentOrgID, schedule); err != nil {
 		return
 	}
+	if !requireScopedPermission(c, h.rbac, user, auth.PermScheduleRead, scheduleScopes(schedule)...) {
+		return
+	}
 
 	statuses, err := h.store.GetReplicationStatusBySchedule(c.Request.Context(), id)
 	if err != nil {
@@ -968,8 +1212,7 @@ func (h *SchedulesHandler) Clone(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermScheduleCreate); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermScheduleCreate) {
 		return
 	}
 
@@ -996,6 +1239,9 @@ func (h *SchedulesHandler) Clone(c *gin.Context) {
 	if err := h.verifyScheduleAccess(c, user.CurrentOrgID, source); err != nil {
 		return
 	}
+	if !requireScopedPermission(c, h.rbac, user, auth.PermScheduleRead, scheduleScopes(source)...) {
+		return
+	}
 
 	// Determine target agent
 	targetAgentID := source.AgentID
@@ -1030,11 +1276,15 @@ func (h *SchedulesHandler) Clone(c *gin.Context) {
 	cloned.CompressionLevel = source.CompressionLevel
 	cloned.MaxFileSizeMB = source.MaxFileSizeMB
 	cloned.OnMountUnavailable = source.OnMountUnavailable
+	cloned.FilesystemSnapshot = source.FilesystemSnapshot
 	cloned.ClassificationLevel = source.ClassificationLevel
 	cloned.ClassificationDataTypes = source.ClassificationDataTypes
 	cloned.DockerOptions = source.DockerOptions
 	cloned.PostgresConfig = source.PostgresConfig
+	cloned.MySQLConfig = source.MySQLConfig
 	cloned.ProxmoxOptions = source.ProxmoxOptions
+	cloned.KubernetesOptions = source.KubernetesOptions
+	cloned.LibvirtOptions = source.LibvirtOptions
 	cloned.Enabled = source.Enabled
 
 	// Handle repositories
@@ -1071,6 +1321,12 @@ func (h *SchedulesHandler) Clone(c *gin.Context) {
 		cloned.Repositories = scheduleRepos
 	}
 
+	for _, scope := range scheduleScopes(cloned) {
+		if !requireScopedPermission(c, h.rbac, user, auth.PermScheduleCreate, scope) {
+			return
+		}
+	}
+
 	if err := h.store.CreateSchedule(c.Request.Context(), cloned); err != nil {
 		h.logger.Error().Err(err).Str("source_id", id.String()).Msg("failed to clone schedule")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clone schedule"})
@@ -1113,8 +1369,7 @@ func (h *SchedulesHandler) BulkClone(c *gin.Context) {
 		return
 	}
 
-	if err := h.rbac.RequirePermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermScheduleCreate); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	if !requirePermissionInAnyScope(c, h.rbac, user, auth.PermScheduleCreate) {
 		return
 	}
 
@@ -1134,6 +1389,9 @@ func (h *SchedulesHandler) BulkClone(c *gin.Context) {
 	if err := h.verifyScheduleAccess(c, user.CurrentOrgID, source); err != nil {
 		return
 	}
+	if !requireScopedPermission(c, h.rbac, user, auth.PermScheduleRead, scheduleScopes(source)...) {
+		return
+	}
 
 	var clonedSchedules []*models.Schedule
 	var errors []string
@@ -1169,11 +1427,15 @@ func (h *SchedulesHandler) BulkClone(c *gin.Context) {
 		cloned.CompressionLevel = source.CompressionLevel
 		cloned.MaxFileSizeMB = source.MaxFileSizeMB
 		cloned.OnMountUnavailable = source.OnMountUnavailable
+		cloned.FilesystemSnapshot = source.FilesystemSnapshot
 		cloned.ClassificationLevel = source.ClassificationLevel
 		cloned.ClassificationDataTypes = source.ClassificationDataTypes
 		cloned.DockerOptions = source.DockerOptions
 		cloned.PostgresConfig = source.PostgresConfig
+		cloned.MySQLConfig = source.MySQLConfig
 		cloned.ProxmoxOptions = source.ProxmoxOptions
+		cloned.KubernetesOptions = source.KubernetesOptions
+		cloned.LibvirtOptions = source.LibvirtOptions
 		cloned.Enabled = source.Enabled
 
 		// Copy repositories from source
@@ -1187,6 +1449,12 @@ func (h *SchedulesHandler) BulkClone(c *gin.Context) {
 		}
 		cloned.Repositories = scheduleRepos
 
+		allowed, err := h.canCreateSchedule(c.Request.Context(), user, cloned)
+		if err != nil || !allowed {
+			errors = append(errors, "permission denied for agent: "+targetAgentID.String())
+			continue
+		}
+
 		if err := h.store.CreateSchedule(c.Request.Context(), cloned); err != nil {
 			h.logger.Error().Err(err).
 				Str("source_id", req.ScheduleID.String()).
@@ -33,6 +33,7 @@ type mockScheduleStore struct {
 	replStatusErr       error
 	createBackupErr     error
 	createCmdErr        error
+	role                models.OrgRole
 }
 
 func newMockScheduleStore() *mockScheduleStore {
@@ -110,7 +111,11 @@ func (m *mockScheduleStore) CreateAgentCommand(_ context.Context, _ *models.Agen
 }
 
 func (m *mockScheduleStore) GetMembershipByUserAndOrg(_ context.Context, userID, orgID uuid.UUID) (*models.OrgMembership, error) {
-	return &models.OrgMembership{UserID: userID, OrgID: orgID, Role: models.OrgRoleOwner}, nil
+	role := m.role
+	if role == "" {
+		role = models.OrgRoleOwner
+	}
+	return &models.OrgMembership{UserID: userID, OrgID: orgID, Role: role}, nil
 }
 
 func (m *mockScheduleStore) GetMembershipsByUserID(_ context.Context, userID uuid.UUID) ([]*models.OrgMembership, error) {
@@ -176,6 +181,53 @@ func TestCreateSchedule(t *testing.T) {
 		}
 	})
 
+	t.Run("filesystem snapshot", func(t *testing.T) {
+		r := setupScheduleTestRouter(store, user)
+		w := httptest.NewRecorder()
+		body := `{
+			"agent_id": "` + agentID.String() + `",
+			"repositories": [{"repository_id": "` + repoID.String() + `", "priority": 0, "enabled": true}],
+			"name": "snapshot-backup",
+			"cron_expression": "0 2 * * *",
+			"paths": ["/srv"],
+			"filesystem_snapshot": "required"
+		}`
+		req, _ := http.NewRequest("POST", "/api/v1/schedules", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp models.Schedule
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if resp.FilesystemSnapshot != models.FilesystemSnapshotRequired {
+			t.Fatalf("expected filesystem_snapshot 'required', got %q", resp.FilesystemSnapshot)
+		}
+	})
+
+	t.Run("invalid filesystem snapshot", func(t *testing.T) {
+		r := setupScheduleTestRouter(store, user)
+		w := httptest.NewRecorder()
+		body := `{
+			"agent_id": "` + agentID.String() + `",
+			"repositories": [{"repository_id": "` + repoID.String() + `", "priority": 0, "enabled": true}],
+			"name": "snapshot-backup",
+			"cron_expression": "0 2 * * *",
+			"paths": ["/srv"],
+			"filesystem_snapshot": "always"
+		}`
+		req, _ := http.NewRequest("POST", "/api/v1/schedules", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", w.Code)
+		}
+	})
+
 	t.Run("invalid body", func(t *testing.T) {
 		r := setupScheduleTestRouter(store, user)
 		w := httptest.NewRecorder()
@@ -946,3 +998,65 @@ func TestGetSchedule(t *testing.T) {
 		}
 	})
 }
+
+// scopedBindingStore grants custom role permissions scoped to repositories
+// or agent groups.
+type scopedBindingStore struct {
+	bindings    []*models.EffectiveRoleBinding
+	agentGroups map[uuid.UUID][]*models.AgentGroup
+}
+
+func (m *scopedBindingStore) GetEffectiveRoleBindings(_ context.Context, _, _ uuid.UUID) ([]*models.EffectiveRoleBinding, error) {
+	return m.bindings, nil
+}
+
+func (m *scopedBindingStore) GetGroupsByAgentID(_ context.Context, agentID uuid.UUID) ([]*models.AgentGroup, error) {
+	return m.agentGroups[agentID], nil
+}
+
+func TestSchedules_ScopedRoleBinding(t *testing.T) {
+	orgID := uuid.New()
+	agent := &models.Agent{ID: uuid.New(), OrgID: orgID, Hostname: "db1"}
+	allowedRepo, otherRepo := uuid.New(), uuid.New()
+	allowed := &models.Schedule{ID: uuid.New(), AgentID: agent.ID, Name: "db", Repositories: []models.ScheduleRepository{{RepositoryID: allowedRepo}}}
+	other := &models.Schedule{ID: uuid.New(), AgentID: agent.ID, Name: "web", Repositories: []models.ScheduleRepository{{RepositoryID: otherRepo}}}
+
+	store := newMockScheduleStore()
+	store.role = models.OrgRoleReadonly
+	store.agentByID[agent.ID] = agent
+	store.agentsByOrg[orgID] = []*models.Agent{agent}
+	store.schedulesByAgent[agent.ID] = []*models.Schedule{allowed, other}
+	store.scheduleByID[allowed.ID] = allowed
+	store.scheduleByID[other.ID] = other
+
+	binding := models.NewUserRoleBinding(orgID, uuid.New(), uuid.New())
+	binding.RepositoryIDs = []uuid.UUID{allowedRepo}
+	bindings := &scopedBindingStore{bindings: []*models.EffectiveRoleBinding{{
+		RoleBinding: *binding,
+		Permissions: []string{string(auth.PermScheduleRun)},
+	}}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	user := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID}
+	r.Use(func(c *gin.Context) {
+		c.Set(string(middleware.UserContextKey), user)
+		c.Next()
+	})
+	rbac := auth.NewRBAC(store)
+	rbac.SetRoleBindingStore(bindings)
+	NewSchedulesHandler(store, rbac, zerolog.Nop()).RegisterRoutes(r.Group("/api/v1"))
+
+	run := func(id uuid.UUID) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/schedules/"+id.String()+"/run", nil)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := run(other.ID); code != http.StatusForbidden {
+		t.Errorf("run outside scope: expected 403, got %d", code)
+	}
+	if code := run(allowed.ID); code == http.StatusForbidden {
+		t.Errorf("run inside scope: expected access, got %d", code)
+	}
+}
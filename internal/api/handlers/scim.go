@@ -0,0 +1,540 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/license"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/MacJediWizard/keldris/internal/scim"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// scimTokenContextKey is the Gin context key for the authenticated SCIM token.
+const scimTokenContextKey = "scim_token"
+
+// SCIMStore defines the persistence operations for SCIM provisioning and
+// SCIM token management.
+type SCIMStore interface {
+	scim.Store
+	CreateSCIMToken(ctx context.Context, t *models.SCIMToken) error
+	GetSCIMTokenByHash(ctx context.Context, tokenHash string) (*models.SCIMToken, error)
+	ListSCIMTokens(ctx context.Context, orgID uuid.UUID) ([]*models.SCIMToken, error)
+	RevokeSCIMToken(ctx context.Context, orgID, id uuid.UUID) (bool, error)
+	TouchSCIMToken(ctx context.Context, id uuid.UUID) error
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+}
+
+// SCIMHandler serves the SCIM 2.0 provisioning API and the endpoints
+// administrators use to manage SCIM tokens.
+type SCIMHandler struct {
+	store     SCIMStore
+	service   *scim.Service
+	rbac      *auth.RBAC
+	checker   *license.FeatureChecker
+	serverURL string
+	logger    zerolog.Logger
+}
+
+// NewSCIMHandler creates a new SCIMHandler.
+func NewSCIMHandler(store SCIMStore, rbac *auth.RBAC, checker *license.FeatureChecker, serverURL string, logger zerolog.Logger) *SCIMHandler {
+	return &SCIMHandler{
+		store:     store,
+		service:   scim.NewService(store, logger),
+		rbac:      rbac,
+		checker:   checker,
+		serverURL: serverURL,
+		logger:    logger.With().Str("component", "scim_handler").Logger(),
+	}
+}
+
+// RegisterRoutes registers SCIM token management routes on the given router group.
+func (h *SCIMHandler) RegisterRoutes(r *gin.RouterGroup) {
+	tokens := r.Group("/organizations/:id/scim-tokens")
+	{
+		tokens.GET("", h.ListTokens)
+		tokens.POST("", h.CreateToken)
+		tokens.DELETE("/:token_id", h.RevokeToken)
+	}
+}
+
+// RegisterSCIMRoutes registers the SCIM 2.0 API, authenticated with SCIM
+// bearer tokens rather than user sessions.
+func (h *SCIMHandler) RegisterSCIMRoutes(r gin.IRouter) {
+	v2 := r.Group("/scim/v2")
+	v2.Use(h.authenticate)
+	{
+		v2.GET("/ServiceProviderConfig", h.ServiceProviderConfig)
+		v2.GET("/ResourceTypes", h.ResourceTypes)
+
+		v2.GET("/Users", h.ListUsers)
+		v2.POST("/Users", h.CreateUser)
+		v2.GET("/Users/:id", h.GetUser)
+		v2.PUT("/Users/:id", h.ReplaceUser)
+		v2.PATCH("/Users/:id", h.PatchUser)
+		v2.DELETE("/Users/:id", h.DeleteUser)
+
+		v2.GET("/Groups", h.ListGroups)
+		v2.POST("/Groups", h.CreateGroup)
+		v2.GET("/Groups/:id", h.GetGroup)
+		v2.PUT("/Groups/:id", h.ReplaceGroup)
+		v2.PATCH("/Groups/:id", h.PatchGroup)
+		v2.DELETE("/Groups/:id", h.DeleteGroup)
+	}
+}
+
+// SCIMTokensResponse wraps a list of SCIM tokens.
+type SCIMTokensResponse struct {
+	Tokens []*models.SCIMToken `json:"tokens"`
+}
+
+// ListTokens returns an organization's SCIM tokens.
+// GET /api/v1/organizations/:id/scim-tokens
+func (h *SCIMHandler) ListTokens(c *gin.Context) {
+	_, orgID, ok := requireOrgPermission(c, h.rbac, auth.PermOrgUpdate)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.store.ListSCIMTokens(c.Request.Context(), orgID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("org_id", orgID.String()).Msg("failed to list SCIM tokens")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list SCIM tokens"})
+		return
+	}
+	if tokens == nil {
+		tokens = []*models.SCIMToken{}
+	}
+
+	c.JSON(http.StatusOK, SCIMTokensResponse{Tokens: tokens})
+}
+
+// CreateToken creates a SCIM token. The plaintext token is only returned here.
+// POST /api/v1/organizations/:id/scim-tokens
+func (h *SCIMHandler) CreateToken(c *gin.Context) {
+	if !middleware.RequireFeature(c, h.checker, license.FeatureSSOSync) {
+		return
+	}
+
+	user, orgID, ok := requireOrgPermission(c, h.rbac, auth.PermOrgUpdate)
+	if !ok {
+		return
+	}
+
+	var req models.CreateSCIMTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	token, err := scim.GenerateToken()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to generate SCIM token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create SCIM token"})
+		return
+	}
+
+	record := models.NewSCIMToken(orgID, req.Name, scim.HashToken(token), scim.TokenDisplayPrefix(token), user.ID)
+	if err := h.store.CreateSCIMToken(c.Request.Context(), record); err != nil {
+		h.logger.Error().Err(err).Str("org_id", orgID.String()).Msg("failed to create SCIM token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create SCIM token"})
+		return
+	}
+
+	h.audit(c.Request.Context(), models.NewAuditLog(orgID, models.AuditActionCreate, "scim_token", models.AuditResultSuccess).
+		WithUser(user.ID).
+		WithResource(record.ID).
+		WithDetails("name: "+record.Name))
+
+	h.logger.Info().
+		Str("org_id", orgID.String()).
+		Str("token_id", record.ID.String()).
+		Str("user_id", user.ID.String()).
+		Msg("SCIM token created")
+
+	c.JSON(http.StatusCreated, models.CreateSCIMTokenResponse{SCIMToken: *record, Token: token})
+}
+
+// RevokeToken revokes a SCIM token.
+// DELETE /api/v1/organizations/:id/scim-tokens/:token_id
+func (h *SCIMHandler) RevokeToken(c *gin.Context) {
+	user, orgID, ok := requireOrgPermission(c, h.rbac, auth.PermOrgUpdate)
+	if !ok {
+		return
+	}
+
+	tokenID, err := uuid.Parse(c.Param("token_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token ID"})
+		return
+	}
+
+	revoked, err := h.store.RevokeSCIMToken(c.Request.Context(), orgID, tokenID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("token_id", tokenID.String()).Msg("failed to revoke SCIM token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke SCIM token"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SCIM token not found"})
+		return
+	}
+
+	h.audit(c.Request.Context(), models.NewAuditLog(orgID, models.AuditActionDelete, "scim_token", models.AuditResultSuccess).
+		WithUser(user.ID).
+		WithResource(tokenID))
+
+	c.JSON(http.StatusOK, gin.H{"message": "SCIM token revoked"})
+}
+
+// authenticate validates the SCIM bearer token and scopes the request to
+// the token's organization.
+func (h *SCIMHandler) authenticate(c *gin.Context) {
+	token := auth.ExtractBearerToken(c.GetHeader("Authorization"))
+	if !strings.HasPrefix(token, scim.TokenPrefix) {
+		h.fail(c, scim.NewError(http.StatusUnauthorized, "bearer token required"))
+		return
+	}
+
+	record, err := h.store.GetSCIMTokenByHash(c.Request.Context(), scim.HashToken(token))
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to look up SCIM token")
+		h.fail(c, err)
+		return
+	}
+	if record == nil || record.IsRevoked() {
+		h.fail(c, scim.NewError(http.StatusUnauthorized, "invalid bearer token"))
+		return
+	}
+
+	if h.checker != nil {
+		allowed, err := h.checker.CheckFeature(c.Request.Context(), record.OrgID, license.FeatureSSOSync)
+		if err != nil || !allowed {
+			h.fail(c, scim.NewError(http.StatusForbidden, "SCIM provisioning is not available for this organization's license"))
+			return
+		}
+	}
+
+	if err := h.store.TouchSCIMToken(c.Request.Context(), record.ID); err != nil {
+		h.logger.Warn().Err(err).Str("token_id", record.ID.String()).Msg("failed to record SCIM token use")
+	}
+
+	c.Set(scimTokenContextKey, record)
+	c.Next()
+}
+
+func scimToken(c *gin.Context) *models.SCIMToken {
+	token, _ := c.MustGet(scimTokenContextKey).(*models.SCIMToken)
+	return token
+}
+
+// ServiceProviderConfig describes the SCIM features this server supports.
+// GET /scim/v2/ServiceProviderConfig
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	supported := func(b bool) gin.H { return gin.H{"supported": b} }
+	h.respond(c, http.StatusOK, gin.H{
+		"schemas":        []string{scim.SchemaServiceProviderConfig},
+		"patch":          supported(true),
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scim.MaxPageSize},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Organization SCIM token created in Keldris",
+			"primary":     true,
+		}},
+	})
+}
+
+// ResourceTypes lists the SCIM resource types this server exposes.
+// GET /scim/v2/ResourceTypes
+func (h *SCIMHandler) ResourceTypes(c *gin.Context) {
+	types := []any{
+		gin.H{"schemas": []string{scim.SchemaResourceType}, "id": "User", "name": "User", "endpoint": "/Users", "schema": scim.SchemaUser},
+		gin.H{"schemas": []string{scim.SchemaResourceType}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": scim.SchemaGroup},
+	}
+	h.respond(c, http.StatusOK, &scim.ListResponse{
+		Schemas:      []string{scim.SchemaListResponse},
+		TotalResults: len(types),
+		StartIndex:   1,
+		ItemsPerPage: len(types),
+		Resources:    types,
+	})
+}
+
+// ListUsers lists provisioned users, optionally filtered.
+// GET /scim/v2/Users
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	token := scimToken(c)
+	filter, err := scim.ParseFilter(c.Query("filter"))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	startIndex, count := scim.ParsePagination(c.Query("startIndex"), c.Query("count"))
+
+	resp, err := h.service.ListUsers(c.Request.Context(), token.OrgID, filter, startIndex, count)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	for _, r := range resp.Resources {
+		h.setLocation(c, r.(*scim.User).Meta, "Users", r.(*scim.User).ID)
+	}
+	h.respond(c, http.StatusOK, resp)
+}
+
+// GetUser returns a provisioned user.
+// GET /scim/v2/Users/:id
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	user, err := h.service.GetUser(c.Request.Context(), scimToken(c).OrgID, c.Param("id"))
+	h.respondUser(c, http.StatusOK, user, err)
+}
+
+// CreateUser provisions a user.
+// POST /scim/v2/Users
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	token := scimToken(c)
+	var in scim.User
+	if !h.bind(c, &in) {
+		return
+	}
+
+	user, err := h.service.CreateUser(c.Request.Context(), token.OrgID, &in)
+	h.auditResource(c, token, models.AuditActionCreate, "scim_user", user, err)
+	h.respondUser(c, http.StatusCreated, user, err)
+}
+
+// ReplaceUser replaces a provisioned user.
+// PUT /scim/v2/Users/:id
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	token := scimToken(c)
+	var in scim.User
+	if !h.bind(c, &in) {
+		return
+	}
+
+	user, err := h.service.ReplaceUser(c.Request.Context(), token.OrgID, c.Param("id"), &in)
+	h.auditResource(c, token, models.AuditActionUpdate, "scim_user", user, err)
+	h.respondUser(c, http.StatusOK, user, err)
+}
+
+// PatchUser updates a provisioned user, including activation state.
+// PATCH /scim/v2/Users/:id
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	token := scimToken(c)
+	var req scim.PatchRequest
+	if !h.bind(c, &req) {
+		return
+	}
+
+	user, err := h.service.PatchUser(c.Request.Context(), token.OrgID, c.Param("id"), &req)
+	h.auditResource(c, token, models.AuditActionUpdate, "scim_user", user, err)
+	h.respondUser(c, http.StatusOK, user, err)
+}
+
+// DeleteUser deprovisions a user.
+// DELETE /scim/v2/Users/:id
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	token := scimToken(c)
+	err := h.service.DeleteUser(c.Request.Context(), token.OrgID, c.Param("id"))
+	h.auditDelete(c, token, "scim_user", err)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroups lists provisioned groups, optionally filtered.
+// GET /scim/v2/Groups
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	token := scimToken(c)
+	filter, err := scim.ParseFilter(c.Query("filter"))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	startIndex, count := scim.ParsePagination(c.Query("startIndex"), c.Query("count"))
+
+	resp, err := h.service.ListGroups(c.Request.Context(), token.OrgID, filter, startIndex, count)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	for _, r := range resp.Resources {
+		h.setLocation(c, r.(*scim.Group).Meta, "Groups", r.(*scim.Group).ID)
+	}
+	h.respond(c, http.StatusOK, resp)
+}
+
+// GetGroup returns a provisioned group.
+// GET /scim/v2/Groups/:id
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	group, err := h.service.GetGroup(c.Request.Context(), scimToken(c).OrgID, c.Param("id"))
+	h.respondGroup(c, http.StatusOK, group, err)
+}
+
+// CreateGroup provisions a group.
+// POST /scim/v2/Groups
+func (h *SCIMHandler) CreateGroup(c *gin.Context) {
+	token := scimToken(c)
+	var in scim.Group
+	if !h.bind(c, &in) {
+		return
+	}
+
+	group, err := h.service.CreateGroup(c.Request.Context(), token.OrgID, &in)
+	h.auditResource(c, token, models.AuditActionCreate, "scim_group", group, err)
+	h.respondGroup(c, http.StatusCreated, group, err)
+}
+
+// ReplaceGroup replaces a provisioned group and its members.
+// PUT /scim/v2/Groups/:id
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	token := scimToken(c)
+	var in scim.Group
+	if !h.bind(c, &in) {
+		return
+	}
+
+	group, err := h.service.ReplaceGroup(c.Request.Context(), token.OrgID, c.Param("id"), &in)
+	h.auditResource(c, token, models.AuditActionUpdate, "scim_group", group, err)
+	h.respondGroup(c, http.StatusOK, group, err)
+}
+
+// PatchGroup updates a provisioned group or its members.
+// PATCH /scim/v2/Groups/:id
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	token := scimToken(c)
+	var req scim.PatchRequest
+	if !h.bind(c, &req) {
+		return
+	}
+
+	group, err := h.service.PatchGroup(c.Request.Context(), token.OrgID, c.Param("id"), &req)
+	h.auditResource(c, token, models.AuditActionUpdate, "scim_group", group, err)
+	h.respondGroup(c, http.StatusOK, group, err)
+}
+
+// DeleteGroup deletes a provisioned group.
+// DELETE /scim/v2/Groups/:id
+func (h *SCIMHandler) DeleteGroup(c *gin.Context) {
+	token := scimToken(c)
+	err := h.service.DeleteGroup(c.Request.Context(), token.OrgID, c.Param("id"))
+	h.auditDelete(c, token, "scim_group", err)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) bind(c *gin.Context, dst any) bool {
+	if err := json.NewDecoder(c.Request.Body).Decode(dst); err != nil {
+		h.fail(c, &scim.Error{Status: http.StatusBadRequest, SCIMType: "invalidSyntax", Detail: "invalid request body"})
+		return false
+	}
+	return true
+}
+
+func (h *SCIMHandler) respondUser(c *gin.Context, status int, user *scim.User, err error) {
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	h.setLocation(c, user.Meta, "Users", user.ID)
+	h.respond(c, status, user)
+}
+
+func (h *SCIMHandler) respondGroup(c *gin.Context, status int, group *scim.Group, err error) {
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	h.setLocation(c, group.Meta, "Groups", group.ID)
+	h.respond(c, status, group)
+}
+
+func (h *SCIMHandler) setLocation(c *gin.Context, meta *scim.Meta, resource, id string) {
+	if meta != nil {
+		meta.Location = externalBaseURL(c, h.serverURL) + "/scim/v2/" + resource + "/" + id
+	}
+}
+
+func (h *SCIMHandler) respond(c *gin.Context, status int, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to encode SCIM response")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, scim.ContentType, data)
+}
+
+func (h *SCIMHandler) fail(c *gin.Context, err error) {
+	scimErr := scim.ErrorFrom(err)
+	if scimErr.Status >= http.StatusInternalServerError {
+		h.logger.Error().Err(err).Str("path", c.Request.URL.Path).Msg("SCIM request failed")
+	}
+	h.respond(c, scimErr.Status, scimErr)
+	c.Abort()
+}
+
+// auditResource records a SCIM change to a user or group. Requests rejected
+// as invalid are not recorded; failures to apply them are.
+func (h *SCIMHandler) auditResource(c *gin.Context, token *models.SCIMToken, action models.AuditAction, resourceType string, resource any, err error) {
+	var id string
+	switch r := resource.(type) {
+	case *scim.User:
+		if r != nil {
+			id = r.ID
+		}
+	case *scim.Group:
+		if r != nil {
+			id = r.ID
+		}
+	}
+	if id == "" {
+		id = c.Param("id")
+	}
+	h.auditSCIM(c, token, action, resourceType, id, err)
+}
+
+func (h *SCIMHandler) auditDelete(c *gin.Context, token *models.SCIMToken, resourceType string, err error) {
+	h.auditSCIM(c, token, models.AuditActionDelete, resourceType, c.Param("id"), err)
+}
+
+func (h *SCIMHandler) auditSCIM(c *gin.Context, token *models.SCIMToken, action models.AuditAction, resourceType, id string, err error) {
+	result := models.AuditResultSuccess
+	details := "via SCIM token " + token.Name
+	if err != nil {
+		if scim.ErrorFrom(err).Status < http.StatusInternalServerError {
+			return
+		}
+		result = models.AuditResultFailure
+	}
+
+	auditLog := models.NewAuditLog(token.OrgID, action, resourceType, result).
+		WithRequestInfo(c.ClientIP(), c.Request.UserAgent()).
+		WithDetails(details)
+	if resourceID, parseErr := uuid.Parse(id); parseErr == nil {
+		auditLog.WithResource(resourceID)
+	}
+	h.audit(c.Request.Context(), auditLog)
+}
+
+func (h *SCIMHandler) audit(ctx context.Context, auditLog *models.AuditLog) {
+	if err := h.store.CreateAuditLog(ctx, auditLog); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create audit log")
+	}
+}
@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+)
+
+// WebDAVPathPrefix is where read-only WebDAV views of snapshots are served.
+const WebDAVPathPrefix = "/webdav/snapshots"
+
+const (
+	// webdavCredentialTTL is how long issued WebDAV credentials stay valid.
+	webdavCredentialTTL = 12 * time.Hour
+	// webdavFSTTL is how long a snapshot's cached directory listings are kept.
+	webdavFSTTL = 10 * time.Minute
+	// webdavFSCacheSize bounds the number of snapshots with cached listings.
+	webdavFSCacheSize = 64
+)
+
+// webdavMethods are the read-only WebDAV methods that are served.
+var webdavMethods = []string{http.MethodGet, http.MethodHead, "PROPFIND"}
+
+// webdavWriteMethods are rejected because snapshots are immutable.
+var webdavWriteMethods = []string{
+	http.MethodPut, http.MethodPost, http.MethodDelete, "MKCOL", "COPY", "MOVE", "PROPPATCH", "LOCK", "UNLOCK",
+}
+
+// snapshotFSCache keeps recently browsed snapshot file systems so that their
+// directory listings survive across WebDAV requests.
+type snapshotFSCache struct {
+	mu      sync.Mutex
+	entries map[string]snapshotFSEntry
+}
+
+type snapshotFSEntry struct {
+	fs      *backup.SnapshotFS
+	expires time.Time
+}
+
+func (c *snapshotFSCache) get(snapshotID string, create func() *backup.SnapshotFS) *backup.SnapshotFS {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if entry, ok := c.entries[snapshotID]; ok && now.Before(entry.expires) {
+		return entry.fs
+	}
+	if len(c.entries) >= webdavFSCacheSize {
+		for id, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, id)
+			}
+		}
+		if len(c.entries) >= webdavFSCacheSize {
+			c.entries = make(map[string]snapshotFSEntry)
+		}
+	}
+
+	fs := create()
+	c.entries[snapshotID] = snapshotFSEntry{fs: fs, expires: now.Add(webdavFSTTL)}
+	return fs
+}
+
+// WebDAVIPFilter checks WebDAV clients against the organization's IP
+// allowlist, which the API applies through middleware.
+type WebDAVIPFilter interface {
+	CheckIP(ctx context.Context, orgID uuid.UUID, ipAddress string, accessType models.IPAllowlistType, isAdmin bool) (bool, string)
+	LogBlockedAttempt(ctx context.Context, orgID uuid.UUID, ipAddress, requestType, path, reason string, userID, agentID *uuid.UUID)
+}
+
+// SetIPFilter enforces the organization's IP allowlist on WebDAV requests.
+func (h *SnapshotsHandler) SetIPFilter(filter WebDAVIPFilter) {
+	h.ipFilter = filter
+}
+
+// SetServerURL sets the public server URL used in WebDAV links. Without it the
+// request's host is used.
+func (h *SnapshotsHandler) SetServerURL(serverURL string) {
+	h.serverURL = strings.TrimRight(serverURL, "/")
+}
+
+// RegisterWebDAVRoutes registers the read-only WebDAV view of snapshots. It is
+// mounted outside the session-authenticated API because file managers only
+// speak Basic auth; requests authenticate with credentials issued by
+// CreateWebDAVAccess.
+func (h *SnapshotsHandler) RegisterWebDAVRoutes(r gin.IRouter) {
+	route := WebDAVPathPrefix + "/:id/*path"
+	r.OPTIONS(route, h.WebDAVOptions)
+	for _, method := range webdavMethods {
+		r.Handle(method, route, h.ServeWebDAV)
+	}
+	for _, method := range webdavWriteMethods {
+		r.Handle(method, route, h.WebDAVOptions)
+	}
+}
+
+// webdavIPAllowed applies the organization's UI IP allowlist to a WebDAV
+// request. The route is outside the API group, so the IP filter middleware
+// does not see it.
+func (h *SnapshotsHandler) webdavIPAllowed(c *gin.Context, orgID, userID uuid.UUID) bool {
+	if h.ipFilter == nil {
+		return true
+	}
+	isAdmin := false
+	if h.rbac != nil {
+		if role, err := h.rbac.GetUserRole(c.Request.Context(), userID, orgID); err == nil {
+			isAdmin = role == models.OrgRoleAdmin || role == models.OrgRoleOwner
+		}
+	}
+
+	clientIP := c.ClientIP()
+	allowed, reason := h.ipFilter.CheckIP(c.Request.Context(), orgID, clientIP, models.IPAllowlistTypeUI, isAdmin)
+	if !allowed {
+		h.ipFilter.LogBlockedAttempt(c.Request.Context(), orgID, clientIP, "webdav", c.Request.URL.Path, reason, &userID, nil)
+	}
+	return allowed
+}
+
+// snapshotAccess resolves a snapshot the user may read in the organization and
+// builds the restic config for its repository. On failure it returns the HTTP
+// status and message to report.
+func (h *SnapshotsHandler) snapshotAccess(ctx context.Context, userID, orgID uuid.UUID, snapshotID string) (*models.Backup, *backup.ResticConfig, int, string) {
+	bkp, err := h.store.GetBackupBySnapshotID(ctx, snapshotID)
+	if err != nil {
+		return nil, nil, http.StatusNotFound, "snapshot not found"
+	}
+
+	agent, err := h.store.GetAgentByID(ctx, bkp.AgentID)
+	if err != nil || agent.OrgID != orgID {
+		return nil, nil, http.StatusNotFound, "snapshot not found"
+	}
+
+	if bkp.RepositoryID == nil {
+		return nil, nil, http.StatusInternalServerError, "backup has no repository"
+	}
+
+	// Reading snapshot contents is equivalent to restoring them.
+	if h.rbac != nil {
+		scope := auth.ResourceScope{AgentID: bkp.AgentID, RepositoryID: *bkp.RepositoryID}
+		if err := h.rbac.RequirePermissionForResource(ctx, userID, orgID, auth.PermRestoreCreate, scope); err != nil {
+			return nil, nil, http.StatusForbidden, "permission denied"
+		}
+	}
+
+	resticCfg, err := h.buildResticConfig(ctx, *bkp.RepositoryID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("snapshot_id", snapshotID).Msg("failed to build restic config for snapshot access")
+		return nil, nil, http.StatusInternalServerError, "failed to access repository"
+	}
+
+	return bkp, resticCfg, 0, ""
+}
+
+// logSnapshotAudit records access to snapshot contents.
+func (h *SnapshotsHandler) logSnapshotAudit(c *gin.Context, orgID, userID uuid.UUID, bkp *models.Backup, action models.AuditAction, details string) {
+	auditLog := models.NewAuditLog(orgID, action, "snapshot", models.AuditResultSuccess).
+		WithUser(userID).
+		WithAgent(bkp.AgentID).
+		WithResource(bkp.ID).
+		WithRequestInfo(c.ClientIP(), c.Request.UserAgent()).
+		WithDetails(details)
+
+	if err := h.store.CreateAuditLog(c.Request.Context(), auditLog); err != nil {
+		h.logger.Error().Err(err).Msg("failed to create audit log")
+	}
+}
+
+// GetArchiveSize returns the size of a snapshot subtree before downloading it.
+//
+//	@Summary		Get snapshot archive size
+//	@Description	Returns the number of files and directories and the uncompressed size of a snapshot subtree
+//	@Tags			Snapshots
+//	@Produce		json
+//	@Param			id		path		string	true	"Snapshot ID"
+//	@Param			path	query		string	false	"Directory or file to archive (default: root)"
+//	@Success		200		{object}	backup.ArchiveSize
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/snapshots/{id}/archive/size [get]
+func (h *SnapshotsHandler) GetArchiveSize(c *gin.Context) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return
+	}
+
+	snapshotID := c.Param("id")
+	_, resticCfg, status, msg := h.snapshotAccess(c.Request.Context(), user.ID, user.CurrentOrgID, snapshotID)
+	if status != 0 {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	size, err := h.restic.ArchiveSize(c.Request.Context(), *resticCfg, snapshotID, c.Query("path"))
+	if err != nil {
+		h.archiveSizeError(c, snapshotID, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, size)
+}
+
+// DownloadArchive streams a snapshot subtree as a tar.gz or zip archive.
+//
+//	@Summary		Download snapshot archive
+//	@Description	Streams a directory subtree (or single file) of a snapshot as a tar.gz or zip archive without a restore job. The X-Archive-Files and X-Archive-Bytes headers report the precalculated file count and uncompressed size.
+//	@Tags			Snapshots
+//	@Produce		application/gzip,application/zip
+//	@Param			id		path		string	true	"Snapshot ID"
+//	@Param			path	query		string	false	"Directory or file to archive (default: root)"
+//	@Param			format	query		string	false	"Archive format: tar.gz (default) or zip"
+//	@Success		200		{file}		binary
+//	@Failure		400		{object}	map[string]string
+//	@Failure		401		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/snapshots/{id}/archive [get]
+func (h *SnapshotsHandler) DownloadArchive(c *gin.Context) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return
+	}
+
+	format, err := backup.ParseArchiveFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	snapshotID := c.Param("id")
+	bkp, resticCfg, status, msg := h.snapshotAccess(c.Request.Context(), user.ID, user.CurrentOrgID, snapshotID)
+	if status != 0 {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	// Sizing the subtree first also validates the path, so errors can still
+	// be reported before the archive starts streaming.
+	size, err := h.restic.ArchiveSize(c.Request.Context(), *resticCfg, snapshotID, c.Query("path"))
+	if err != nil {
+		h.archiveSizeError(c, snapshotID, err)
+		return
+	}
+
+	h.logSnapshotAudit(c, user.CurrentOrgID, user.ID, bkp, models.AuditActionRestore,
+		fmt.Sprintf("Downloaded %s from snapshot %s as %s (%d files, %d bytes)", size.Path, snapshotID, format, size.Files, size.Bytes))
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, archiveFilename(snapshotID, size.Path, format)))
+	c.Header("X-Archive-Files", strconv.Itoa(size.Files))
+	c.Header("X-Archive-Bytes", strconv.FormatInt(size.Bytes, 10))
+	c.Status(http.StatusOK)
+
+	// Large archives outlive the server's write timeout.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	if err := h.restic.WriteArchive(c.Request.Context(), *resticCfg, snapshotID, size.Path, format, c.Writer); err != nil {
+		// Headers are already sent; the truncated archive signals the failure.
+		h.logger.Error().Err(err).Str("snapshot_id", snapshotID).Str("path", size.Path).Msg("snapshot archive download failed")
+	}
+}
+
+func (h *SnapshotsHandler) archiveSizeError(c *gin.Context, snapshotID string, err error) {
+	if errors.Is(err, backup.ErrSnapshotNotFound) || errors.Is(err, backup.ErrSnapshotPathNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	h.logger.Error().Err(err).Str("snapshot_id", snapshotID).Msg("failed to size snapshot subtree")
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read snapshot"})
+}
+
+// archiveFilename names a downloaded archive after the snapshot and subtree.
+func archiveFilename(snapshotID, subtree string, format backup.ArchiveFormat) string {
+	shortID := snapshotID
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+	name := "snapshot-" + shortID
+	if base := path.Base(subtree); base != "/" {
+		name += "-" + strings.Map(func(r rune) rune {
+			if r == '"' || r == '\\' || r < 0x20 {
+				return '_'
+			}
+			return r
+		}, base)
+	}
+	return name + "." + string(format)
+}
+
+// WebDAVAccessResponse holds credentials for browsing a snapshot over WebDAV.
+type WebDAVAccessResponse struct {
+	URL       string    `json:"url"`
+	Username  string    `json:"username"`
+	Password  string    `json:"password"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateWebDAVAccess issues temporary credentials for a read-only WebDAV view
+// of a snapshot.
+//
+//	@Summary		Create WebDAV access
+//	@Description	Issues temporary Basic-auth credentials for mounting a snapshot read-only over WebDAV in an OS file manager. Credentials expire after 12 hours and stop working as soon as the user loses restore permission.
+//	@Tags			Snapshots
+//	@Produce		json
+//	@Param			id	path		string	true	"Snapshot ID"
+//	@Success		201	{object}	WebDAVAccessResponse
+//	@Failure		401	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/snapshots/{id}/webdav [post]
+func (h *SnapshotsHandler) CreateWebDAVAccess(c *gin.Context) {
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return
+	}
+
+	snapshotID := c.Param("id")
+	bkp, _, status, msg := h.snapshotAccess(c.Request.Context(), user.ID, user.CurrentOrgID, snapshotID)
+	if status != 0 {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	expiresAt := time.Now().Add(webdavCredentialTTL).Truncate(time.Second)
+	baseURL := h.serverURL
+	if baseURL == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		baseURL = scheme + "://" + c.Request.Host
+	}
+
+	h.logSnapshotAudit(c, user.CurrentOrgID, user.ID, bkp, models.AuditActionRead,
+		fmt.Sprintf("WebDAV access to snapshot %s granted until %s", snapshotID, expiresAt.Format(time.RFC3339)))
+
+	c.JSON(http.StatusCreated, WebDAVAccessResponse{
+		URL:       baseURL + WebDAVPathPrefix + "/" + snapshotID + "/",
+		Username:  user.ID.String(),
+		Password:  h.webdavPassword(user.ID, user.CurrentOrgID, snapshotID, expiresAt),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// webdavPassword signs the user, organization, snapshot and expiry so that
+// credentials need no server-side state.
+func (h *SnapshotsHandler) webdavPassword(userID, orgID uuid.UUID, snapshotID string, expiresAt time.Time) string {
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	mac := hmac.New(sha256.New, h.keyManager.DeriveKey("snapshot-webdav"))
+	mac.Write([]byte(userID.String() + "\n" + orgID.String() + "\n" + snapshotID + "\n" + expiry))
+	return expiry + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validWebDAVPassword checks a password issued by webdavPassword.
+func (h *SnapshotsHandler) validWebDAVPassword(userID, orgID uuid.UUID, snapshotID, password string) bool {
+	expiry, _, ok := strings.Cut(password, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return false
+	}
+	expiresAt := time.Unix(unix, 0)
+	if !time.Now().Before(expiresAt) {
+		return false
+	}
+	want := h.webdavPassword(userID, orgID, snapshotID, expiresAt)
+	return hmac.Equal([]byte(password), []byte(want))
+}
+
+// WebDAVOptions advertises the read-only WebDAV methods and rejects writes.
+func (h *SnapshotsHandler) WebDAVOptions(c *gin.Context) {
+	c.Header("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+	c.Header("DAV", "1")
+	if c.Request.Method == http.MethodOptions {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.Status(http.StatusMethodNotAllowed)
+}
+
+// ServeWebDAV serves a read-only WebDAV view of a snapshot.
+func (h *SnapshotsHandler) ServeWebDAV(c *gin.Context) {
+	snapshotID := c.Param("id")
+	ctx := c.Request.Context()
+
+	unauthorized := func() {
+		c.Header("WWW-Authenticate", `Basic realm="Keldris snapshot", charset="UTF-8"`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+
+	username, password, ok := c.Request.BasicAuth()
+	if !ok {
+		unauthorized()
+		return
+	}
+	userID, err := uuid.Parse(username)
+	if err != nil {
+		unauthorized()
+		return
+	}
+
+	// The organization is the snapshot's; credentials are bound to it.
+	bkp, err := h.store.GetBackupBySnapshotID(ctx, snapshotID)
+	if err != nil {
+		unauthorized()
+		return
+	}
+	agent, err := h.store.GetAgentByID(ctx, bkp.AgentID)
+	if err != nil || !h.validWebDAVPassword(userID, agent.OrgID, snapshotID, password) {
+		unauthorized()
+		return
+	}
+	user, err := h.store.GetUserByID(ctx, userID)
+	if err != nil || !user.IsActive() {
+		unauthorized()
+		return
+	}
+	if !h.webdavIPAllowed(c, agent.OrgID, userID) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	bkp, resticCfg, status, _ := h.snapshotAccess(ctx, userID, agent.OrgID, snapshotID)
+	if status != 0 {
+		c.AbortWithStatus(status)
+		return
+	}
+
+	filePath := "/" + strings.TrimPrefix(c.Param("path"), "/")
+	if c.Request.Method == http.MethodGet {
+		h.logSnapshotAudit(c, agent.OrgID, userID, bkp, models.AuditActionRestore,
+			fmt.Sprintf("WebDAV download of %s from snapshot %s", path.Clean(filePath), snapshotID))
+	}
+
+	// Avoid content sniffing, which would dump each file twice.
+	if c.Request.Method != "PROPFIND" && mime.TypeByExtension(path.Ext(filePath)) == "" {
+		c.Header("Content-Type", "application/octet-stream")
+	}
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	handler := &webdav.Handler{
+		Prefix: WebDAVPathPrefix + "/" + snapshotID,
+		FileSystem: h.webdavFS.get(snapshotID, func() *backup.SnapshotFS {
+			return backup.NewSnapshotFS(h.restic, *resticCfg, snapshotID)
+		}),
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !errors.Is(err, context.Canceled) {
+				h.logger.Debug().Err(err).Str("method", r.Method).Str("path", r.URL.Path).Msg("webdav request failed")
+			}
+		},
+	}
+	handler.ServeHTTP(c.Writer, c.Request)
+}
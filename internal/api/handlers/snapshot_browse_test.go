@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/crypto"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// fakeSnapshotRestic answers restic ls and dump for a snapshot containing
+// /data/hello.txt.
+const fakeSnapshotRestic = `#!/bin/sh
+for a in "$@"; do
+	case "$a" in
+	ls|dump) cmd=$a ;;
+	--archive) archive=1 ;;
+	esac
+	last=$a
+done
+if [ "$cmd" = ls ]; then
+	case "$last" in
+	/) echo '{"name":"data","type":"dir","path":"/data"}' ;;
+	/data)
+		echo '{"name":"data","type":"dir","path":"/data"}'
+		echo '{"name":"hello.txt","type":"file","path":"/data/hello.txt","size":11}'
+		;;
+	esac
+	exit 0
+fi
+if [ -n "$archive" ]; then
+	printf 'ARCHIVE'
+	exit 0
+fi
+printf 'hello world'
+`
+
+type snapshotBrowseEnv struct {
+	router     *gin.Engine
+	store      *mockSnapshotStore
+	handler    *SnapshotsHandler
+	snapshotID string
+}
+
+func newSnapshotBrowseEnv(t *testing.T, orgID uuid.UUID) *snapshotBrowseEnv {
+	t.Helper()
+	key, _ := crypto.GenerateMasterKey()
+	keys, _ := crypto.NewKeyManager(key)
+
+	config, _ := keys.Encrypt([]byte(`{"path":"/srv/backups"}`))
+	password, _ := keys.Encrypt([]byte("repo-password"))
+	repo := models.NewRepository(orgID, "local", models.RepositoryTypeLocal, config)
+	agent := &models.Agent{ID: uuid.New(), OrgID: orgID, Hostname: "web-01"}
+	snapshotID := "abcdef0123456789"
+	bkp := &models.Backup{ID: uuid.New(), AgentID: agent.ID, RepositoryID: &repo.ID, SnapshotID: snapshotID}
+
+	user := adminUser(orgID)
+	store := &mockSnapshotStore{
+		user:             &models.User{ID: user.ID, Status: models.UserStatusActive},
+		agent:            agent,
+		repo:             repo,
+		repoKey:          &models.RepositoryKey{RepositoryID: repo.ID, EncryptedKey: password},
+		backupBySnapshot: map[string]*models.Backup{snapshotID: bkp},
+	}
+
+	script := filepath.Join(t.TempDir(), "restic")
+	if err := os.WriteFile(script, []byte(fakeSnapshotRestic), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := SetupTestRouter(user)
+	handler := NewSnapshotsHandler(store, keys, zerolog.Nop())
+	handler.restic = backup.NewResticWithBinary(script, zerolog.Nop())
+	handler.SetServerURL("https://keldris.example.com/")
+	handler.RegisterRoutes(r.Group("/api/v1"))
+	handler.RegisterWebDAVRoutes(r)
+
+	return &snapshotBrowseEnv{router: r, store: store, handler: handler, snapshotID: snapshotID}
+}
+
+func TestDownloadArchive(t *testing.T) {
+	orgID := uuid.New()
+
+	t.Run("streams zip", func(t *testing.T) {
+		env := newSnapshotBrowseEnv(t, orgID)
+		resp := DoRequest(env.router, AuthenticatedRequest("GET", "/api/v1/snapshots/"+env.snapshotID+"/archive?path=/data&format=zip"))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if resp.Body.String() != "ARCHIVE" {
+			t.Errorf("body = %q", resp.Body.String())
+		}
+		if got := resp.Header().Get("Content-Disposition"); got != `attachment; filename="snapshot-abcdef01-data.zip"` {
+			t.Errorf("Content-Disposition = %q", got)
+		}
+		if resp.Header().Get("X-Archive-Files") != "1" || resp.Header().Get("X-Archive-Bytes") != "11" {
+			t.Errorf("size headers = %v", resp.Header())
+		}
+		if len(env.store.auditLogs) != 1 || env.store.auditLogs[0].Action != models.AuditActionRestore {
+			t.Errorf("audit logs = %+v", env.store.auditLogs)
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		env := newSnapshotBrowseEnv(t, orgID)
+		resp := DoRequest(env.router, AuthenticatedRequest("GET", "/api/v1/snapshots/"+env.snapshotID+"/archive/size?path=/data"))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var size backup.ArchiveSize
+		if err := json.Unmarshal(resp.Body.Bytes(), &size); err != nil {
+			t.Fatal(err)
+		}
+		if size.Files != 1 || size.Dirs != 1 || size.Bytes != 11 {
+			t.Errorf("size = %+v", size)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"missing path", "?path=/nope", http.StatusNotFound},
+		{"unsupported format", "?format=rar", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newSnapshotBrowseEnv(t, orgID)
+			resp := DoRequest(env.router, AuthenticatedRequest("GET", "/api/v1/snapshots/"+env.snapshotID+"/archive"+tt.query))
+			if resp.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, resp.Code, resp.Body.String())
+			}
+			if len(env.store.auditLogs) != 0 {
+				t.Error("failed download should not be audited")
+			}
+		})
+	}
+
+	t.Run("other org", func(t *testing.T) {
+		env := newSnapshotBrowseEnv(t, orgID)
+		env.store.agent.OrgID = uuid.New()
+		resp := DoRequest(env.router, AuthenticatedRequest("GET", "/api/v1/snapshots/"+env.snapshotID+"/archive"))
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+}
+
+func TestSnapshotWebDAV(t *testing.T) {
+	env := newSnapshotBrowseEnv(t, uuid.New())
+
+	resp := DoRequest(env.router, AuthenticatedRequest("POST", "/api/v1/snapshots/"+env.snapshotID+"/webdav"))
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var access WebDAVAccessResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &access); err != nil {
+		t.Fatal(err)
+	}
+	if access.URL != "https://keldris.example.com/webdav/snapshots/"+env.snapshotID+"/" {
+		t.Errorf("URL = %q", access.URL)
+	}
+
+	webdavRequest := func(method, path, username, password string) *http.Request {
+		req, _ := http.NewRequest(method, WebDAVPathPrefix+"/"+env.snapshotID+path, http.NoBody)
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		if method == "PROPFIND" {
+			req.Header.Set("Depth", "1")
+		}
+		return req
+	}
+
+	t.Run("lists directory", func(t *testing.T) {
+		resp := DoRequest(env.router, webdavRequest("PROPFIND", "/data/", access.Username, access.Password))
+		if resp.Code != http.StatusMultiStatus {
+			t.Fatalf("expected 207, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if !strings.Contains(resp.Body.String(), "hello.txt") {
+			t.Errorf("listing does not include hello.txt: %s", resp.Body.String())
+		}
+	})
+
+	t.Run("downloads file", func(t *testing.T) {
+		audits := len(env.store.auditLogs)
+		resp := DoRequest(env.router, webdavRequest("GET", "/data/hello.txt", access.Username, access.Password))
+		if resp.Code != http.StatusOK || resp.Body.String() != "hello world" {
+			t.Fatalf("got %d: %q", resp.Code, resp.Body.String())
+		}
+		if len(env.store.auditLogs) != audits+1 {
+			t.Error("download should be audited")
+		}
+	})
+
+	t.Run("rejects writes", func(t *testing.T) {
+		resp := DoRequest(env.router, webdavRequest("PUT", "/data/new.txt", access.Username, access.Password))
+		if resp.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("expected 405, got %d", resp.Code)
+		}
+	})
+
+	unauthorized := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{"no credentials", "", ""},
+		{"wrong password", access.Username, "1.bogus"},
+		{"other user", uuid.New().String(), access.Password},
+	}
+	for _, tt := range unauthorized {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := DoRequest(env.router, webdavRequest("PROPFIND", "/", tt.username, tt.password))
+			if resp.Code != http.StatusUnauthorized {
+				t.Fatalf("expected 401, got %d", resp.Code)
+			}
+		})
+	}
+
+	t.Run("disabled user", func(t *testing.T) {
+		env.store.user.Status = models.UserStatusDisabled
+		defer func() { env.store.user.Status = models.UserStatusActive }()
+		resp := DoRequest(env.router, webdavRequest("PROPFIND", "/", access.Username, access.Password))
+		if resp.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", resp.Code)
+		}
+	})
+
+	t.Run("IP not in allowlist", func(t *testing.T) {
+		filter := &stubWebDAVIPFilter{}
+		env.handler.SetIPFilter(filter)
+		defer env.handler.SetIPFilter(nil)
+		resp := DoRequest(env.router, webdavRequest("PROPFIND", "/", access.Username, access.Password))
+		if resp.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", resp.Code)
+		}
+		if filter.blocked != 1 {
+			t.Errorf("blocked attempts logged = %d, want 1", filter.blocked)
+		}
+	})
+
+	t.Run("expired credentials", func(t *testing.T) {
+		userID := uuid.MustParse(access.Username)
+		expired := env.handler.webdavPassword(userID, env.store.agent.OrgID, env.snapshotID, access.ExpiresAt.AddDate(0, 0, -1))
+		resp := DoRequest(env.router, webdavRequest("PROPFIND", "/", access.Username, expired))
+		if resp.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", resp.Code)
+		}
+	})
+}
+
+// stubWebDAVIPFilter denies every address.
+type stubWebDAVIPFilter struct {
+	blocked int
+}
+
+func (f *stubWebDAVIPFilter) CheckIP(_ context.Context, _ uuid.UUID, _ string, _ models.IPAllowlistType, _ bool) (bool, string) {
+	return false, "IP address not in allowlist"
+}
+
+func (f *stubWebDAVIPFilter) LogBlockedAttempt(_ context.Context, _ uuid.UUID, _, _, _, _ string, _, _ *uuid.UUID) {
+	f.blocked++
+}
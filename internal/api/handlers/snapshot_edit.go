@@ -0,0 +1,679 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/crypto"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// SnapshotEditStore defines the persistence operations needed to change
+// snapshot tags and purge paths from snapshots.
+type SnapshotEditStore interface {
+	GetBackupBySnapshotID(ctx context.Context, snapshotID string) (*models.Backup, error)
+	GetAgentByID(ctx context.Context, id uuid.UUID) (*models.Agent, error)
+	GetRepositoryByID(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	GetRepositoryKeyByRepositoryID(ctx context.Context, repositoryID uuid.UUID) (*models.RepositoryKey, error)
+	IsSnapshotOnHold(ctx context.Context, snapshotID string, orgID uuid.UUID) (bool, error)
+	IsSnapshotLocked(ctx context.Context, repositoryID uuid.UUID, snapshotID string) (bool, error)
+	ReplaceSnapshotID(ctx context.Context, repositoryID uuid.UUID, oldID, newID string) error
+	GetTagsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.Tag, error)
+	CreateTag(ctx context.Context, tag *models.Tag) error
+	SetSnapshotTags(ctx context.Context, snapshotID string, tagIDs []uuid.UUID) error
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+}
+
+// SnapshotPruner prunes repositories through the maintenance planner, which
+// runs at most one maintenance operation per repository at a time.
+type SnapshotPruner interface {
+	StartPrune(ctx context.Context, orgID, repositoryID uuid.UUID, trigger string) error
+}
+
+// SnapshotEditHandler handles restic tag changes and snapshot rewrites.
+type SnapshotEditHandler struct {
+	store      SnapshotEditStore
+	keyManager *crypto.KeyManager
+	restic     *backup.Restic
+	approvals  ApprovalGate
+	pruner     SnapshotPruner
+	logger     zerolog.Logger
+}
+
+// NewSnapshotEditHandler creates a new SnapshotEditHandler.
+func NewSnapshotEditHandler(store SnapshotEditStore, keyManager *crypto.KeyManager, logger zerolog.Logger) *SnapshotEditHandler {
+	return &SnapshotEditHandler{
+		store:      store,
+		keyManager: keyManager,
+		restic:     backup.NewRestic(logger),
+		logger:     logger.With().Str("component", "snapshot_edit_handler").Logger(),
+	}
+}
+
+// SetApprovalGate enables four-eyes approval for purging paths from snapshots.
+func (h *SnapshotEditHandler) SetApprovalGate(gate ApprovalGate) {
+	h.approvals = gate
+	gate.Register(models.ApprovalActionSnapshotPurge, h.executeApprovedPurge)
+}
+
+// SetPruner enables pruning after a purge. Without it, purges that request a
+// prune are refused.
+func (h *SnapshotEditHandler) SetPruner(pruner SnapshotPruner) {
+	h.pruner = pruner
+}
+
+// RegisterRoutes registers snapshot edit routes on the given router group.
+func (h *SnapshotEditHandler) RegisterRoutes(r *gin.RouterGroup) {
+	snapshots := r.Group("/snapshots")
+	{
+		snapshots.POST("/purge", h.PurgePaths)
+		snapshots.POST("/:id/tags", h.UpdateTags)
+	}
+}
+
+// UpdateSnapshotTagsRequest changes a snapshot's restic tags. Set replaces all
+// tags and cannot be combined with add or remove; an empty set clears them.
+type UpdateSnapshotTagsRequest struct {
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+	Set    []string `json:"set,omitempty"`
+}
+
+// UpdateSnapshotTagsResponse reports the snapshot's tags after the change.
+type UpdateSnapshotTagsResponse struct {
+	SnapshotID         string   `json:"snapshot_id"`
+	PreviousSnapshotID string   `json:"previous_snapshot_id,omitempty"`
+	Tags               []string `json:"tags"`
+}
+
+// PurgeSnapshotPathsRequest removes paths from snapshots with restic rewrite.
+type PurgeSnapshotPathsRequest struct {
+	SnapshotIDs []string `json:"snapshot_ids" binding:"required,min=1"`
+	Exclude     []string `json:"exclude" binding:"required,min=1"`
+	DryRun      bool     `json:"dry_run"`
+	// Prune starts a prune afterwards so the purged data is removed from
+	// storage rather than only unreferenced.
+	Prune bool `json:"prune"`
+}
+
+// SnapshotPurgeResult describes the outcome for one snapshot.
+type SnapshotPurgeResult struct {
+	SnapshotID    string   `json:"snapshot_id"`
+	NewSnapshotID string   `json:"new_snapshot_id,omitempty"`
+	Excluded      []string `json:"excluded,omitempty"`
+	Modified      bool     `json:"modified"`
+}
+
+// PurgeSnapshotPathsResponse is returned by a purge or its dry-run preview.
+type PurgeSnapshotPathsResponse struct {
+	DryRun       bool                  `json:"dry_run"`
+	Results      []SnapshotPurgeResult `json:"results"`
+	PruneStarted bool                  `json:"prune_started"`
+	// PruneError explains why a requested prune was not started.
+	PruneError string `json:"prune_error,omitempty"`
+}
+
+// SnapshotBlockedResponse lists snapshots that may not be modified.
+type SnapshotBlockedResponse struct {
+	Error   string            `json:"error"`
+	Blocked map[string]string `json:"blocked"`
+}
+
+// errSnapshotNotFound hides snapshots of other organizations.
+var errSnapshotNotFound = errors.New("snapshot not found")
+
+// errMixedRepositories is returned when a purge spans several repositories.
+var errMixedRepositories = errors.New("all snapshots must be in the same repository")
+
+// UpdateTags adds, removes or replaces a snapshot's restic tags and mirrors
+// the result onto the snapshot's Keldris tags.
+//
+//	@Summary		Update snapshot tags
+//	@Description	Changes a snapshot's restic tags with restic tag. The snapshot ID changes because restic rewrites the snapshot file.
+//	@Tags			Snapshots
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string						true	"Snapshot ID"
+//	@Param			request	body		UpdateSnapshotTagsRequest	true	"Tag changes"
+//	@Success		200		{object}	UpdateSnapshotTagsResponse
+//	@Failure		400		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		409		{object}	SnapshotBlockedResponse
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/snapshots/{id}/tags [post]
+func (h *SnapshotEditHandler) UpdateTags(c *gin.Context) {
+	userID, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateSnapshotTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	opts := backup.TagOptions{Add: req.Add, Remove: req.Remove, Set: req.Set}
+	if opts.IsEmpty() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "add, remove or set is required"})
+		return
+	}
+	if opts.Set != nil && (len(opts.Add) > 0 || len(opts.Remove) > 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "set cannot be combined with add or remove"})
+		return
+	}
+	for _, list := range [][]string{opts.Add, opts.Remove, opts.Set} {
+		for _, tag := range list {
+			if err := validateResticTag(tag); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	ctx := c.Request.Context()
+	snapshotID := c.Param("id")
+	bkp, err := h.lookupSnapshot(ctx, orgID, snapshotID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "snapshot not found"})
+		return
+	}
+
+	if err := h.checkWritable(ctx, *bkp.RepositoryID); err != nil {
+		if errors.Is(err, backup.ErrRepositoryReadOnly) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error().Err(err).Str("snapshot_id", snapshotID).Msg("failed to load repository")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to access repository"})
+		return
+	}
+
+	blocked, err := h.blockedSnapshots(ctx, orgID, *bkp.RepositoryID, []string{snapshotID})
+	if err != nil {
+		h.logger.Error().Err(err).Str("snapshot_id", snapshotID).Msg("failed to check snapshot holds")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check snapshot holds"})
+		return
+	}
+	if len(blocked) > 0 {
+		c.JSON(http.StatusConflict, SnapshotBlockedResponse{Error: "snapshot cannot be modified", Blocked: blocked})
+		return
+	}
+
+	cfg, err := h.resticConfig(ctx, *bkp.RepositoryID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("snapshot_id", snapshotID).Msg("failed to build restic config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to access repository"})
+		return
+	}
+
+	current, err := h.currentTags(ctx, cfg, snapshotID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("snapshot_id", snapshotID).Msg("failed to read snapshot tags")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read snapshot tags"})
+		return
+	}
+
+	changes, err := h.restic.Tag(ctx, cfg, []string{snapshotID}, opts)
+	if err != nil {
+		h.logger.Error().Err(err).Str("snapshot_id", snapshotID).Msg("failed to tag snapshot")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update snapshot tags"})
+		return
+	}
+
+	resp := UpdateSnapshotTagsResponse{SnapshotID: snapshotID, Tags: opts.Apply(current)}
+	for _, change := range changes {
+		if strings.HasPrefix(change.OldID, snapshotID) && change.NewID != change.OldID {
+			if err := h.store.ReplaceSnapshotID(ctx, *bkp.RepositoryID, snapshotID, change.NewID); err != nil {
+				h.logger.Error().Err(err).Str("snapshot_id", snapshotID).Str("new_snapshot_id", change.NewID).Msg("failed to record new snapshot ID")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "snapshot tagged but its new ID could not be recorded"})
+				return
+			}
+			resp.SnapshotID = change.NewID
+			resp.PreviousSnapshotID = snapshotID
+		}
+	}
+
+	if err := h.syncKeldrisTags(ctx, orgID, resp.SnapshotID, resp.Tags); err != nil {
+		h.logger.Warn().Err(err).Str("snapshot_id", resp.SnapshotID).Msg("failed to sync Keldris tags")
+	}
+
+	auditLog := models.NewAuditLog(orgID, models.AuditActionUpdate, "snapshot", models.AuditResultSuccess).
+		WithUser(userID).
+		WithRequestInfo(c.ClientIP(), c.Request.UserAgent()).
+		WithDetails(fmt.Sprintf("Snapshot %s tags set to [%s]; new snapshot ID %s",
+			snapshotID, strings.Join(resp.Tags, ", "), resp.SnapshotID))
+	if err := h.store.CreateAuditLog(ctx, auditLog); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to create audit log")
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// PurgePaths removes paths from snapshots with restic rewrite, or previews
+// what would be removed when dry_run is set. Snapshots under legal hold or an
+// immutability lock are refused. When the organization requires approval for
+// snapshot purges, an approval request is submitted instead.
+//
+//	@Summary		Purge paths from snapshots
+//	@Description	Rewrites snapshots without the excluded paths and forgets the originals. All snapshots must be in the same repository. Returns 202 with an approval request when the organization requires approval for snapshot purges.
+//	@Tags			Snapshots
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		PurgeSnapshotPathsRequest	true	"Snapshots and paths to purge"
+//	@Success		200		{object}	PurgeSnapshotPathsResponse
+//	@Success		202		{object}	map[string]interface{}
+//	@Failure		400		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		409		{object}	SnapshotBlockedResponse
+//	@Failure		500		{object}	map[string]string
+//	@Security		SessionAuth
+//	@Router			/snapshots/purge [post]
+func (h *SnapshotEditHandler) PurgePaths(c *gin.Context) {
+	userID, orgID, ok := requireOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req PurgeSnapshotPathsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	for _, pattern := range req.Exclude {
+		if strings.TrimSpace(pattern) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "exclude patterns must not be empty"})
+			return
+		}
+	}
+	if req.Prune && !req.DryRun && h.pruner == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pruning is not available on this server"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	repositoryID, err := h.purgeRepository(ctx, orgID, req.SnapshotIDs)
+	if errors.Is(err, errMixedRepositories) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !req.DryRun {
+		if err := h.checkWritable(ctx, repositoryID); err != nil {
+			if errors.Is(err, backup.ErrRepositoryReadOnly) {
+				h.auditPurge(c, userID, orgID, repositoryID, req, models.AuditResultDenied, err.Error())
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			h.logger.Error().Err(err).Str("repository_id", repositoryID.String()).Msg("failed to load repository")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to access repository"})
+			return
+		}
+	}
+
+	blocked, err := h.blockedSnapshots(ctx, orgID, repositoryID, req.SnapshotIDs)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to check snapshot holds")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check snapshot holds"})
+		return
+	}
+	if len(blocked) > 0 {
+		if !req.DryRun {
+			h.auditPurge(c, userID, orgID, repositoryID, req, models.AuditResultDenied, "snapshots under legal hold or immutability lock")
+		}
+		c.JSON(http.StatusConflict, SnapshotBlockedResponse{Error: "snapshots cannot be modified", Blocked: blocked})
+		return
+	}
+
+	if !req.DryRun {
+		approvalReq := models.NewApprovalRequest(orgID, userID, models.ApprovalActionSnapshotPurge,
+			"repository", repositoryID.String(), fmt.Sprintf("Purge [%s] from %d snapshots",
+				strings.Join(req.Exclude, ", "), len(req.SnapshotIDs)))
+		if err := approvalReq.SetPayload(req); err != nil {
+			h.logger.Error().Err(err).Msg("failed to encode purge request")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to submit approval request"})
+			return
+		}
+		if requestApproval(c, h.approvals, h.logger, approvalReq) {
+			return
+		}
+	}
+
+	resp, failed, err := h.purge(ctx, orgID, repositoryID, req)
+	if err != nil {
+		h.logger.Error().Err(err).Str("repository_id", repositoryID.String()).Msg("failed to rewrite snapshots")
+		if !req.DryRun {
+			h.auditPurge(c, userID, orgID, repositoryID, req, models.AuditResultFailure, err.Error())
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rewrite snapshots"})
+		return
+	}
+
+	if req.DryRun {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	h.auditPurge(c, userID, orgID, repositoryID, req, models.AuditResultSuccess, fmt.Sprintf("%d snapshots rewritten", countModified(resp.Results)))
+
+	if failed {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "snapshots rewritten but some new IDs could not be recorded", "results": resp.Results})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// executeApprovedPurge runs a purge once it has been approved. The snapshots
+// are checked again because they may have been placed on hold meanwhile.
+func (h *SnapshotEditHandler) executeApprovedPurge(ctx context.Context, approvalReq *models.ApprovalRequest) error {
+	var req PurgeSnapshotPathsRequest
+	if err := json.Unmarshal(approvalReq.Payload, &req); err != nil {
+		return fmt.Errorf("decode purge request: %w", err)
+	}
+	req.DryRun = false
+	if req.Prune && h.pruner == nil {
+		return errors.New("pruning is not available on this server")
+	}
+
+	repositoryID, err := h.purgeRepository(ctx, approvalReq.OrgID, req.SnapshotIDs)
+	if err != nil {
+		return err
+	}
+	if repositoryID.String() != approvalReq.ResourceID {
+		return errors.New("snapshots are no longer in the approved repository")
+	}
+
+	audit := func(result models.AuditResult, outcome string) {
+		h.createAuditLog(ctx, purgeAuditLog(approvalReq.OrgID, approvalReq.RequestedBy, repositoryID, req, result,
+			fmt.Sprintf("%s (approval request %s)", outcome, approvalReq.ID)))
+	}
+
+	if err := h.checkWritable(ctx, repositoryID); err != nil {
+		if errors.Is(err, backup.ErrRepositoryReadOnly) {
+			audit(models.AuditResultDenied, err.Error())
+		}
+		return err
+	}
+
+	blocked, err := h.blockedSnapshots(ctx, approvalReq.OrgID, repositoryID, req.SnapshotIDs)
+	if err != nil {
+		return fmt.Errorf("check snapshot holds: %w", err)
+	}
+	if len(blocked) > 0 {
+		audit(models.AuditResultDenied, "snapshots under legal hold or immutability lock")
+		return errors.New("snapshots are under legal hold or immutability lock")
+	}
+
+	resp, failed, err := h.purge(ctx, approvalReq.OrgID, repositoryID, req)
+	if err != nil {
+		audit(models.AuditResultFailure, err.Error())
+		return err
+	}
+	audit(models.AuditResultSuccess, fmt.Sprintf("%d snapshots rewritten", countModified(resp.Results)))
+	if failed {
+		return errors.New("snapshots rewritten but some new IDs could not be recorded")
+	}
+	return nil
+}
+
+// purgeRepository returns the repository holding all of the snapshots.
+func (h *SnapshotEditHandler) purgeRepository(ctx context.Context, orgID uuid.UUID, snapshotIDs []string) (uuid.UUID, error) {
+	var repositoryID uuid.UUID
+	for _, snapshotID := range snapshotIDs {
+		bkp, err := h.lookupSnapshot(ctx, orgID, snapshotID)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("%w: %s", errSnapshotNotFound, snapshotID)
+		}
+		if repositoryID == uuid.Nil {
+			repositoryID = *bkp.RepositoryID
+		} else if repositoryID != *bkp.RepositoryID {
+			return uuid.Nil, errMixedRepositories
+		}
+	}
+	return repositoryID, nil
+}
+
+// purge rewrites the snapshots without the excluded paths, records their new
+// IDs and hands a requested prune to the maintenance planner. It reports
+// whether any new ID could not be recorded.
+func (h *SnapshotEditHandler) purge(ctx context.Context, orgID, repositoryID uuid.UUID, req PurgeSnapshotPathsRequest) (*PurgeSnapshotPathsResponse, bool, error) {
+	cfg, err := h.resticConfig(ctx, repositoryID)
+	if err != nil {
+		return nil, false, fmt.Errorf("access repository: %w", err)
+	}
+
+	rewritten, err := h.restic.Rewrite(ctx, cfg, req.SnapshotIDs, req.Exclude, req.DryRun)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp := &PurgeSnapshotPathsResponse{DryRun: req.DryRun, Results: make([]SnapshotPurgeResult, 0, len(rewritten))}
+	var newIDs []string
+	if !req.DryRun {
+		// restic reports short IDs; resolve the new snapshots to full IDs.
+		snapshots, err := h.restic.Snapshots(ctx, cfg)
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to list rewritten snapshots")
+		}
+		for _, s := range snapshots {
+			newIDs = append(newIDs, s.ID)
+		}
+	}
+
+	var failed bool
+	for _, r := range rewritten {
+		result := SnapshotPurgeResult{
+			SnapshotID: matchSnapshotID(req.SnapshotIDs, r.SnapshotID),
+			Excluded:   r.Excluded,
+			Modified:   r.Modified,
+		}
+		if r.NewSnapshotID != "" {
+			result.NewSnapshotID = matchSnapshotID(newIDs, r.NewSnapshotID)
+			if err := h.store.ReplaceSnapshotID(ctx, repositoryID, result.SnapshotID, result.NewSnapshotID); err != nil {
+				h.logger.Error().Err(err).
+					Str("snapshot_id", result.SnapshotID).
+					Str("new_snapshot_id", result.NewSnapshotID).
+					Msg("failed to record rewritten snapshot ID")
+				failed = true
+			}
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	if req.Prune && !req.DryRun {
+		// Pruning a large repository can take hours, so the planner runs it
+		// in the background.
+		if err := h.pruner.StartPrune(context.Background(), orgID, repositoryID, backup.MaintenanceTriggerPurge); err != nil {
+			h.logger.Warn().Err(err).Str("repository_id", repositoryID.String()).Msg("prune after purge not started")
+			resp.PruneError = err.Error()
+		} else {
+			resp.PruneStarted = true
+		}
+	}
+
+	return resp, failed, nil
+}
+
+func (h *SnapshotEditHandler) auditPurge(c *gin.Context, userID, orgID, repositoryID uuid.UUID, req PurgeSnapshotPathsRequest, result models.AuditResult, outcome string) {
+	h.createAuditLog(c.Request.Context(), purgeAuditLog(orgID, userID, repositoryID, req, result, outcome).
+		WithRequestInfo(c.ClientIP(), c.Request.UserAgent()))
+}
+
+func purgeAuditLog(orgID, userID, repositoryID uuid.UUID, req PurgeSnapshotPathsRequest, result models.AuditResult, outcome string) *models.AuditLog {
+	return models.NewAuditLog(orgID, models.AuditActionDelete, "snapshot_data", result).
+		WithUser(userID).
+		WithResource(repositoryID).
+		WithDetails(fmt.Sprintf("Purge of [%s] from snapshots [%s]: %s",
+			strings.Join(req.Exclude, ", "), strings.Join(req.SnapshotIDs, ", "), outcome))
+}
+
+func (h *SnapshotEditHandler) createAuditLog(ctx context.Context, auditLog *models.AuditLog) {
+	if err := h.store.CreateAuditLog(ctx, auditLog); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to create audit log")
+	}
+}
+
+// lookupSnapshot returns the backup that produced a snapshot of the org.
+func (h *SnapshotEditHandler) lookupSnapshot(ctx context.Context, orgID uuid.UUID, snapshotID string) (*models.Backup, error) {
+	bkp, err := h.store.GetBackupBySnapshotID(ctx, snapshotID)
+	if err != nil || bkp.RepositoryID == nil {
+		return nil, errSnapshotNotFound
+	}
+	agent, err := h.store.GetAgentByID(ctx, bkp.AgentID)
+	if err != nil || agent.OrgID != orgID {
+		return nil, errSnapshotNotFound
+	}
+	return bkp, nil
+}
+
+// blockedSnapshots returns the snapshots under legal hold or an active
+// immutability lock, with the reason for each.
+func (h *SnapshotEditHandler) blockedSnapshots(ctx context.Context, orgID, repositoryID uuid.UUID, snapshotIDs []string) (map[string]string, error) {
+	blocked := make(map[string]string)
+	for _, id := range snapshotIDs {
+		held, err := h.store.IsSnapshotOnHold(ctx, id, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if held {
+			blocked[id] = "legal hold"
+			continue
+		}
+		locked, err := h.store.IsSnapshotLocked(ctx, repositoryID, id)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			blocked[id] = "immutability lock"
+		}
+	}
+	return blocked, nil
+}
+
+// checkWritable returns backup.ErrRepositoryReadOnly if the repository is
+// read-only, such as the source of a completed migration.
+func (h *SnapshotEditHandler) checkWritable(ctx context.Context, repositoryID uuid.UUID) error {
+	repo, err := h.store.GetRepositoryByID(ctx, repositoryID)
+	if err != nil {
+		return fmt.Errorf("get repository: %w", err)
+	}
+	if repo.ReadOnly {
+		return backup.ErrRepositoryReadOnly
+	}
+	return nil
+}
+
+func (h *SnapshotEditHandler) resticConfig(ctx context.Context, repositoryID uuid.UUID) (backup.ResticConfig, error) {
+	repo, err := h.store.GetRepositoryByID(ctx, repositoryID)
+	if err != nil {
+		return backup.ResticConfig{}, fmt.Errorf("get repository: %w", err)
+	}
+	configJSON, err := h.keyManager.Decrypt(repo.ConfigEncrypted)
+	if err != nil {
+		return backup.ResticConfig{}, fmt.Errorf("decrypt config: %w", err)
+	}
+	backend, err := backends.ParseBackend(repo.Type, configJSON)
+	if err != nil {
+		return backup.ResticConfig{}, fmt.Errorf("parse backend: %w", err)
+	}
+	repoKey, err := h.store.GetRepositoryKeyByRepositoryID(ctx, repo.ID)
+	if err != nil {
+		return backup.ResticConfig{}, fmt.Errorf("get repository key: %w", err)
+	}
+	password, err := h.keyManager.Decrypt(repoKey.EncryptedKey)
+	if err != nil {
+		return backup.ResticConfig{}, fmt.Errorf("decrypt password: %w", err)
+	}
+	return backend.ToResticConfig(string(password)), nil
+}
+
+// currentTags reads a snapshot's restic tags.
+func (h *SnapshotEditHandler) currentTags(ctx context.Context, cfg backup.ResticConfig, snapshotID string) ([]string, error) {
+	snapshots, err := h.restic.Snapshots(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range snapshots {
+		if s.ID == snapshotID || s.ShortID == snapshotID {
+			return s.Tags, nil
+		}
+	}
+	return nil, errSnapshotNotFound
+}
+
+// syncKeldrisTags makes the snapshot's Keldris tags match its restic tags,
+// creating org tags for names that do not exist yet.
+func (h *SnapshotEditHandler) syncKeldrisTags(ctx context.Context, orgID uuid.UUID, snapshotID string, names []string) error {
+	existing, err := h.store.GetTagsByOrgID(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("get tags: %w", err)
+	}
+	byName := make(map[string]uuid.UUID, len(existing))
+	for _, t := range existing {
+		byName[t.Name] = t.ID
+	}
+
+	tagIDs := make([]uuid.UUID, 0, len(names))
+	for _, name := range names {
+		id, ok := byName[name]
+		if !ok {
+			tag := models.NewTag(orgID, name, "")
+			if err := h.store.CreateTag(ctx, tag); err != nil {
+				return fmt.Errorf("create tag %q: %w", name, err)
+			}
+			id = tag.ID
+		}
+		tagIDs = append(tagIDs, id)
+	}
+	return h.store.SetSnapshotTags(ctx, snapshotID, tagIDs)
+}
+
+// validateResticTag rejects tags restic cannot store: restic splits tag
+// lists on commas.
+func validateResticTag(tag string) error {
+	switch {
+	case strings.TrimSpace(tag) == "":
+		return errors.New("tags must not be empty")
+	case strings.Contains(tag, ","):
+		return fmt.Errorf("tag %q must not contain a comma", tag)
+	case len(tag) > 100:
+		return fmt.Errorf("tag %q is longer than 100 characters", tag)
+	}
+	return nil
+}
+
+// matchSnapshotID returns the full ID in ids that starts with shortID, or
+// shortID itself if none does.
+func matchSnapshotID(ids []string, shortID string) string {
+	for _, id := range ids {
+		if strings.HasPrefix(id, shortID) {
+			return id
+		}
+	}
+	return shortID
+}
+
+func countModified(results []SnapshotPurgeResult) int {
+	n := 0
+	for _, r := range results {
+		if r.Modified {
+			n++
+		}
+	}
+	return n
+}
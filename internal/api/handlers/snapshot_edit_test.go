@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/approval"
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/crypto"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	editSnapshotID    = "4d0f6c48aa11bb22cc33dd44ee55ff66"
+	taggedSnapshotID  = "7f1c0e5ebb11bb22cc33dd44ee55ff66"
+	purgedSnapshotID  = "1e2d3c4b5a11bb22cc33dd44ee55ff66"
+	fakeSnapshotsJSON = `[{"id":"` + editSnapshotID + `","short_id":"4d0f6c48","tags":["daily"]},` +
+		`{"id":"` + purgedSnapshotID + `","short_id":"1e2d3c4b"}]`
+)
+
+// fakeEditRestic answers restic snapshots, tag and rewrite for editSnapshotID.
+const fakeEditRestic = `#!/bin/sh
+for a in "$@"; do
+	case "$a" in
+	snapshots|tag|rewrite|prune) cmd=$a ;;
+	--dry-run) dry=1 ;;
+	esac
+done
+case "$cmd" in
+snapshots) echo '` + fakeSnapshotsJSON + `' ;;
+tag) echo "old snapshot ID: ` + editSnapshotID + ` -> new snapshot ID: ` + taggedSnapshotID + `" ;;
+rewrite)
+	echo "snapshot 4d0f6c48 of [/srv] at 2024-01-02 10:00:00 +0000 UTC by root@web-01"
+	echo "excluding /srv/app/.env"
+	if [ -n "$dry" ]; then
+		echo "would save new snapshot"
+	else
+		echo "saved new snapshot 1e2d3c4b"
+		echo "removed old snapshot 4d0f6c48"
+	fi
+	;;
+esac
+`
+
+type mockSnapshotEditStore struct {
+	agent        *models.Agent
+	repo         *models.Repository
+	repoKey      *models.RepositoryKey
+	backups      map[string]*models.Backup
+	held         map[string]bool
+	locked       map[string]bool
+	tags         []*models.Tag
+	snapshotTags map[string][]uuid.UUID
+	replaced     map[string]string
+	auditLogs    []*models.AuditLog
+}
+
+func (m *mockSnapshotEditStore) GetBackupBySnapshotID(_ context.Context, snapshotID string) (*models.Backup, error) {
+	if b, ok := m.backups[snapshotID]; ok {
+		return b, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (m *mockSnapshotEditStore) GetAgentByID(_ context.Context, id uuid.UUID) (*models.Agent, error) {
+	if m.agent.ID == id {
+		return m.agent, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (m *mockSnapshotEditStore) GetRepositoryByID(_ context.Context, _ uuid.UUID) (*models.Repository, error) {
+	return m.repo, nil
+}
+
+func (m *mockSnapshotEditStore) GetRepositoryKeyByRepositoryID(_ context.Context, _ uuid.UUID) (*models.RepositoryKey, error) {
+	return m.repoKey, nil
+}
+
+func (m *mockSnapshotEditStore) IsSnapshotOnHold(_ context.Context, snapshotID string, _ uuid.UUID) (bool, error) {
+	return m.held[snapshotID], nil
+}
+
+func (m *mockSnapshotEditStore) IsSnapshotLocked(_ context.Context, _ uuid.UUID, snapshotID string) (bool, error) {
+	return m.locked[snapshotID], nil
+}
+
+func (m *mockSnapshotEditStore) ReplaceSnapshotID(_ context.Context, _ uuid.UUID, oldID, newID string) error {
+	m.replaced[oldID] = newID
+	return nil
+}
+
+func (m *mockSnapshotEditStore) GetTagsByOrgID(_ context.Context, _ uuid.UUID) ([]*models.Tag, error) {
+	return m.tags, nil
+}
+
+func (m *mockSnapshotEditStore) CreateTag(_ context.Context, tag *models.Tag) error {
+	m.tags = append(m.tags, tag)
+	return nil
+}
+
+func (m *mockSnapshotEditStore) SetSnapshotTags(_ context.Context, snapshotID string, tagIDs []uuid.UUID) error {
+	m.snapshotTags[snapshotID] = tagIDs
+	return nil
+}
+
+func (m *mockSnapshotEditStore) CreateAuditLog(_ context.Context, log *models.AuditLog) error {
+	m.auditLogs = append(m.auditLogs, log)
+	return nil
+}
+
+func newSnapshotEditEnv(t *testing.T, user *auth.SessionUser, configure ...func(*SnapshotEditHandler)) (*gin.Engine, *mockSnapshotEditStore) {
+	t.Helper()
+	key, _ := crypto.GenerateMasterKey()
+	keys, _ := crypto.NewKeyManager(key)
+
+	config, _ := keys.Encrypt([]byte(`{"path":"/srv/backups"}`))
+	password, _ := keys.Encrypt([]byte("repo-password"))
+	repo := models.NewRepository(user.CurrentOrgID, "local", models.RepositoryTypeLocal, config)
+	agent := &models.Agent{ID: uuid.New(), OrgID: user.CurrentOrgID, Hostname: "web-01"}
+	store := &mockSnapshotEditStore{
+		agent:   agent,
+		repo:    repo,
+		repoKey: &models.RepositoryKey{RepositoryID: repo.ID, EncryptedKey: password},
+		backups: map[string]*models.Backup{
+			editSnapshotID: {ID: uuid.New(), AgentID: agent.ID, RepositoryID: &repo.ID, SnapshotID: editSnapshotID},
+		},
+		held:         make(map[string]bool),
+		locked:       make(map[string]bool),
+		tags:         []*models.Tag{models.NewTag(user.CurrentOrgID, "daily", "")},
+		snapshotTags: make(map[string][]uuid.UUID),
+		replaced:     make(map[string]string),
+	}
+
+	script := filepath.Join(t.TempDir(), "restic")
+	if err := os.WriteFile(script, []byte(fakeEditRestic), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := SetupTestRouter(user)
+	// Registered next to the snapshots handler to catch route conflicts.
+	NewSnapshotsHandler(&mockSnapshotStore{}, keys, zerolog.Nop()).RegisterRoutes(r.Group("/api/v1"))
+	handler := NewSnapshotEditHandler(store, keys, zerolog.Nop())
+	handler.restic = backup.NewResticWithBinary(script, zerolog.Nop())
+	for _, fn := range configure {
+		fn(handler)
+	}
+	handler.RegisterRoutes(r.Group("/api/v1"))
+	return r, store
+}
+
+func TestSnapshotEdit_UpdateTags(t *testing.T) {
+	orgID := uuid.New()
+	path := "/api/v1/snapshots/" + editSnapshotID + "/tags"
+
+	t.Run("adds tags and syncs Keldris tags", func(t *testing.T) {
+		r, store := newSnapshotEditEnv(t, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", path, `{"add":["keep"]}`))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var got UpdateSnapshotTagsResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.SnapshotID != taggedSnapshotID || got.PreviousSnapshotID != editSnapshotID {
+			t.Errorf("response = %+v", got)
+		}
+		if !reflect.DeepEqual(got.Tags, []string{"daily", "keep"}) {
+			t.Errorf("tags = %v", got.Tags)
+		}
+		if store.replaced[editSnapshotID] != taggedSnapshotID {
+			t.Errorf("replaced = %v", store.replaced)
+		}
+		if len(store.tags) != 2 || len(store.snapshotTags[taggedSnapshotID]) != 2 {
+			t.Errorf("keldris tags = %d, snapshot tags = %v", len(store.tags), store.snapshotTags)
+		}
+		if len(store.auditLogs) != 1 || store.auditLogs[0].Action != models.AuditActionUpdate {
+			t.Errorf("audit logs = %+v", store.auditLogs)
+		}
+	})
+
+	for _, tt := range []struct {
+		name string
+		body string
+	}{
+		{"no change", `{}`},
+		{"set with add", `{"set":["a"],"add":["b"]}`},
+		{"comma in tag", `{"add":["a,b"]}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newSnapshotEditEnv(t, adminUser(orgID))
+			resp := DoRequest(r, JSONRequest("POST", path, tt.body))
+			if resp.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+			}
+		})
+	}
+
+	t.Run("legal hold", func(t *testing.T) {
+		r, store := newSnapshotEditEnv(t, adminUser(orgID))
+		store.held[editSnapshotID] = true
+		resp := DoRequest(r, JSONRequest("POST", path, `{"add":["keep"]}`))
+		if resp.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+
+	t.Run("read-only repository", func(t *testing.T) {
+		r, store := newSnapshotEditEnv(t, adminUser(orgID))
+		store.repo.ReadOnly = true
+		resp := DoRequest(r, JSONRequest("POST", path, `{"add":["keep"]}`))
+		if resp.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if len(store.replaced) != 0 {
+			t.Errorf("replaced = %v", store.replaced)
+		}
+	})
+
+	t.Run("unknown snapshot", func(t *testing.T) {
+		r, _ := newSnapshotEditEnv(t, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/snapshots/ffff/tags", `{"add":["keep"]}`))
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", resp.Code)
+		}
+	})
+
+	t.Run("not admin", func(t *testing.T) {
+		member := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, CurrentOrgRole: "member"}
+		r, _ := newSnapshotEditEnv(t, member)
+		resp := DoRequest(r, JSONRequest("POST", path, `{"add":["keep"]}`))
+		if resp.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", resp.Code)
+		}
+	})
+}
+
+func TestSnapshotEdit_PurgePaths(t *testing.T) {
+	orgID := uuid.New()
+	body := `{"snapshot_ids":["` + editSnapshotID + `"],"exclude":["/srv/app/.env"]`
+
+	t.Run("dry run", func(t *testing.T) {
+		r, store := newSnapshotEditEnv(t, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/snapshots/purge", body+`,"dry_run":true}`))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var got PurgeSnapshotPathsResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !got.DryRun || len(got.Results) != 1 || !got.Results[0].Modified || got.Results[0].NewSnapshotID != "" {
+			t.Errorf("response = %+v", got)
+		}
+		if got.Results[0].SnapshotID != editSnapshotID || got.Results[0].Excluded[0] != "/srv/app/.env" {
+			t.Errorf("result = %+v", got.Results[0])
+		}
+		if len(store.replaced) != 0 || len(store.auditLogs) != 0 {
+			t.Errorf("dry run changed state: replaced=%v audit=%d", store.replaced, len(store.auditLogs))
+		}
+	})
+
+	t.Run("rewrites and audits", func(t *testing.T) {
+		r, store := newSnapshotEditEnv(t, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/snapshots/purge", body+`}`))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var got PurgeSnapshotPathsResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Results[0].NewSnapshotID != purgedSnapshotID {
+			t.Errorf("new snapshot ID = %q", got.Results[0].NewSnapshotID)
+		}
+		if store.replaced[editSnapshotID] != purgedSnapshotID {
+			t.Errorf("replaced = %v", store.replaced)
+		}
+		if len(store.auditLogs) != 1 || store.auditLogs[0].Result != models.AuditResultSuccess {
+			t.Errorf("audit logs = %+v", store.auditLogs)
+		}
+	})
+
+	t.Run("read-only repository", func(t *testing.T) {
+		r, store := newSnapshotEditEnv(t, adminUser(orgID))
+		store.repo.ReadOnly = true
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/snapshots/purge", body+`}`))
+		if resp.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if len(store.replaced) != 0 {
+			t.Errorf("replaced = %v", store.replaced)
+		}
+		if len(store.auditLogs) != 1 || store.auditLogs[0].Result != models.AuditResultDenied {
+			t.Errorf("audit logs = %+v", store.auditLogs)
+		}
+
+		// Previews do not write and stay available.
+		resp = DoRequest(r, JSONRequest("POST", "/api/v1/snapshots/purge", body+`,"dry_run":true}`))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("dry run: expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+
+	t.Run("prune is handed to the maintenance planner", func(t *testing.T) {
+		runner := &mockMaintenanceRunner{}
+		r, store := newSnapshotEditEnv(t, adminUser(orgID), func(h *SnapshotEditHandler) { h.SetPruner(runner) })
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/snapshots/purge", body+`,"prune":true}`))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var got PurgeSnapshotPathsResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !got.PruneStarted || len(runner.started) != 1 || runner.started[0] != store.repo.ID {
+			t.Errorf("prune_started = %v, started = %v", got.PruneStarted, runner.started)
+		}
+	})
+
+	t.Run("prune while maintenance is running", func(t *testing.T) {
+		runner := &mockMaintenanceRunner{err: backup.ErrMaintenanceRunning}
+		r, store := newSnapshotEditEnv(t, adminUser(orgID), func(h *SnapshotEditHandler) { h.SetPruner(runner) })
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/snapshots/purge", body+`,"prune":true}`))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var got PurgeSnapshotPathsResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.PruneStarted || got.PruneError == "" || store.replaced[editSnapshotID] != purgedSnapshotID {
+			t.Errorf("response = %+v, replaced = %v", got, store.replaced)
+		}
+	})
+
+	t.Run("prune without a maintenance planner", func(t *testing.T) {
+		r, store := newSnapshotEditEnv(t, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/snapshots/purge", body+`,"prune":true}`))
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if len(store.replaced) != 0 {
+			t.Errorf("snapshots rewritten: %v", store.replaced)
+		}
+	})
+
+	t.Run("immutability lock is refused and audited", func(t *testing.T) {
+		r, store := newSnapshotEditEnv(t, adminUser(orgID))
+		store.locked[editSnapshotID] = true
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/snapshots/purge", body+`}`))
+		if resp.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", resp.Code, resp.Body.String())
+		}
+		var got SnapshotBlockedResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Blocked[editSnapshotID] != "immutability lock" {
+			t.Errorf("blocked = %v", got.Blocked)
+		}
+		if len(store.auditLogs) != 1 || store.auditLogs[0].Result != models.AuditResultDenied {
+			t.Errorf("audit logs = %+v", store.auditLogs)
+		}
+	})
+
+	t.Run("missing exclude", func(t *testing.T) {
+		r, _ := newSnapshotEditEnv(t, adminUser(orgID))
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/snapshots/purge", `{"snapshot_ids":["`+editSnapshotID+`"]}`))
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", resp.Code)
+		}
+	})
+}
+
+func TestSnapshotEdit_PurgePathsApproval(t *testing.T) {
+	orgID := uuid.New()
+	requester := adminUser(orgID)
+	approvalStore := newMockApprovalStore(models.ApprovalActionSnapshotPurge)
+	service := approval.NewService(approvalStore, nil, zerolog.Nop())
+
+	r, store := newSnapshotEditEnv(t, requester, func(h *SnapshotEditHandler) { h.SetApprovalGate(service) })
+	body := `{"snapshot_ids":["` + editSnapshotID + `"],"exclude":["/srv/app/.env"]`
+
+	t.Run("dry run needs no approval", func(t *testing.T) {
+		resp := DoRequest(r, JSONRequest("POST", "/api/v1/snapshots/purge", body+`,"dry_run":true}`))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+
+	resp := DoRequest(r, JSONRequest("POST", "/api/v1/snapshots/purge", body+`}`))
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if len(store.replaced) != 0 {
+		t.Fatalf("snapshots rewritten before approval: %v", store.replaced)
+	}
+	var pending struct {
+		ApprovalRequest models.ApprovalRequest `json:"approval_request"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &pending); err != nil {
+		t.Fatal(err)
+	}
+
+	approvals := setupApprovalsTestRouter(approvalStore, service, adminUser(orgID))
+	resp = DoRequest(approvals, AuthenticatedRequest("POST", "/api/v1/approvals/"+pending.ApprovalRequest.ID.String()+"/approve"))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var decided models.ApprovalRequest
+	if err := json.Unmarshal(resp.Body.Bytes(), &decided); err != nil {
+		t.Fatal(err)
+	}
+	if decided.Status != models.ApprovalStatusExecuted {
+		t.Fatalf("status = %s (error: %s)", decided.Status, decided.ErrorMessage)
+	}
+	if store.replaced[editSnapshotID] != purgedSnapshotID {
+		t.Errorf("replaced = %v", store.replaced)
+	}
+	if len(store.auditLogs) != 1 || store.auditLogs[0].Result != models.AuditResultSuccess {
+		t.Errorf("audit logs = %+v", store.auditLogs)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/auth"
 	"github.com/MacJediWizard/keldris/internal/backup"
 	"github.com/MacJediWizard/keldris/internal/backup/backends"
 	"github.com/MacJediWizard/keldris/internal/crypto"
@@ -45,6 +46,7 @@ type SnapshotStore interface {
 	GetActiveSnapshotMountsByAgentID(ctx context.Context, agentID uuid.UUID) ([]*models.SnapshotMount, error)
 	DeleteSnapshotMount(ctx context.Context, id uuid.UUID) error
 	CreateAgentCommand(ctx context.Context, cmd *models.AgentCommand) error
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
 }
 
 // SnapshotsHandler handles snapshot and restore HTTP endpoints.
@@ -52,6 +54,10 @@ type SnapshotsHandler struct {
 	store      SnapshotStore
 	keyManager *crypto.KeyManager
 	restic     *backup.Restic
+	rbac       *auth.RBAC
+	serverURL  string
+	webdavFS   *snapshotFSCache
+	ipFilter   WebDAVIPFilter
 	logger     zerolog.Logger
 }
 
@@ -61,10 +67,26 @@ func NewSnapshotsHandler(store SnapshotStore, keyManager *crypto.KeyManager, log
 		store:      store,
 		keyManager: keyManager,
 		restic:     backup.NewRestic(logger),
+		webdavFS:   &snapshotFSCache{entries: make(map[string]snapshotFSEntry)},
 		logger:     logger.With().Str("component", "snapshots_handler").Logger(),
 	}
 }
 
+// SetRBAC enables permission checks for restore operations, including custom
+// roles scoped to the target agent's groups or the source repository.
+func (h *SnapshotsHandler) SetRBAC(rbac *auth.RBAC) {
+	h.rbac = rbac
+}
+
+// authorize checks perm on the given agent and repository when RBAC is
+// enabled, honouring custom roles scoped to agent groups or repositories.
+func (h *SnapshotsHandler) authorize(c *gin.Context, user *auth.SessionUser, perm auth.Permission, scope auth.ResourceScope) bool {
+	if h.rbac == nil {
+		return true
+	}
+	return requireScopedPermission(c, h.rbac, user, perm, scope)
+}
+
 // buildResticConfig builds a ResticConfig from a backup's repository credentials.
 func (h *SnapshotsHandler) buildResticConfig(ctx context.Context, repositoryID uuid.UUID) (*backup.ResticConfig, error) {
 	repo, err := h.store.GetRepositoryByID(ctx, repositoryID)
@@ -108,6 +130,9 @@ func (h *SnapshotsHandler) RegisterRoutes(r *gin.RouterGroup) {
 		snapshots.GET("/compare", h.CompareSnapshots)
 		snapshots.GET("/:id/compare/:compare_id", h.CompareSnapshots)
 		snapshots.GET("/:id/files/diff/:compare_id", h.DiffFile)
+		snapshots.GET("/:id/archive", h.DownloadArchive)
+		snapshots.GET("/:id/archive/size", h.GetArchiveSize)
+		snapshots.POST("/:id/webdav", h.CreateWebDAVAccess)
 		// Mount endpoints
 		snapshots.POST("/:id/mount", h.MountSnapshot)
 		snapshots.DELETE("/:id/mount", h.UnmountSnapshot)
@@ -203,6 +228,19 @@ func (h *SnapshotsHandler) ListSnapshots(c *gin.Context) {
 		agents = filtered
 	}
 
+	// Users without organization-wide backup:read only see snapshots of
+	// agents and repositories their scoped role bindings cover.
+	scoped := false
+	if h.rbac != nil {
+		orgWide, err := h.rbac.HasPermission(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermBackupRead)
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to check snapshot permission")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list snapshots"})
+			return
+		}
+		scoped = !orgWide
+	}
+
 	// Get all backups for the agents (which contain snapshot info)
 	var snapshots []SnapshotResponse
 	for _, agent := range agents {
@@ -217,6 +255,12 @@ func (h *SnapshotsHandler) ListSnapshots(c *gin.Context) {
 			if backup.Status != models.BackupStatusCompleted || backup.SnapshotID == "" {
 				continue
 			}
+			if scoped {
+				has, err := h.rbac.HasPermissionForResource(c.Request.Context(), user.ID, user.CurrentOrgID, auth.PermBackupRead, backupScope(backup))
+				if err != nil || !has {
+					continue
+				}
+			}
 
 			// Get schedule to find repository ID
 			schedule, err := h.store.GetScheduleByID(c.Request.Context(), backup.ScheduleID)
@@ -306,6 +350,9 @@ func (h *SnapshotsHandler) GetSnapshot(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "snapshot not found"})
 		return
 	}
+	if !h.authorize(c, user, auth.PermBackupRead, backupScope(backup)) {
+		return
+	}
 
 	schedule, err := h.store.GetScheduleByID(c.Request.Context(), backup.ScheduleID)
 	if err != nil {
@@ -425,6 +472,9 @@ func (h *SnapshotsHandler) ListFiles(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "snapshot not found"})
 		return
 	}
+	if !h.authorize(c, user, auth.PermBackupRead, backupScope(backup)) {
+		return
+	}
 
 	// Get the path prefix for filtering
 	pathPrefix := c.Query("path")
@@ -765,6 +815,10 @@ func (h *SnapshotsHandler) CreateRestore(c *gin.Context) {
 		return
 	}
 
+	if !h.authorize(c, user, auth.PermRestoreCreate, auth.ResourceScope{AgentID: targetAgentID, RepositoryID: repositoryID}) {
+		return
+	}
+
 	// Verify snapshot exists
 	_, err = h.store.GetBackupBySnapshotID(c.Request.Context(), req.SnapshotID)
 	if err != nil {
@@ -868,6 +922,10 @@ func (h *SnapshotsHandler) PreviewRestore(c *gin.Context) {
 		return
 	}
 
+	if !h.authorize(c, user, auth.PermRestoreCreate, auth.ResourceScope{AgentID: agentID, RepositoryID: repositoryID}) {
+		return
+	}
+
 	// Verify snapshot exists
 	_, err = h.store.GetBackupBySnapshotID(c.Request.Context(), req.SnapshotID)
 	if err != nil {
@@ -998,6 +1056,10 @@ func (h *SnapshotsHandler) CreateCloudRestore(c *gin.Context) {
 		return
 	}
 
+	if !h.authorize(c, user, auth.PermRestoreCreate, auth.ResourceScope{AgentID: agentID, RepositoryID: repositoryID}) {
+		return
+	}
+
 	// Verify snapshot exists
 	_, err = h.store.GetBackupBySnapshotID(c.Request.Context(), req.SnapshotID)
 	if err != nil {
@@ -1280,6 +1342,9 @@ func (h *SnapshotsHandler) ListSnapshotComments(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "snapshot not found"})
 		return
 	}
+	if !h.authorize(c, user, auth.PermBackupRead, backupScope(backup)) {
+		return
+	}
 
 	comments, err := h.store.GetSnapshotCommentsBySnapshotID(c.Request.Context(), snapshotID, user.CurrentOrgID)
 	if err != nil {
@@ -1343,6 +1408,9 @@ func (h *SnapshotsHandler) CreateSnapshotComment(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "snapshot not found"})
 		return
 	}
+	if !h.authorize(c, user, auth.PermBackupRead, backupScope(backup)) {
+		return
+	}
 
 	comment := models.NewSnapshotComment(user.CurrentOrgID, snapshotID, user.ID, req.Content)
 
@@ -1480,6 +1548,9 @@ func (h *SnapshotsHandler) DiffFile(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "first snapshot not found"})
 		return
 	}
+	if !h.authorize(c, user, auth.PermBackupRead, backupScope(backup1)) {
+		return
+	}
 
 	// Verify access to second snapshot
 	backup2, err := h.store.GetBackupBySnapshotID(c.Request.Context(), snapshotID2)
@@ -1493,6 +1564,9 @@ func (h *SnapshotsHandler) DiffFile(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "second snapshot not found"})
 		return
 	}
+	if !h.authorize(c, user, auth.PermBackupRead, backupScope(backup2)) {
+		return
+	}
 
 	h.logger.Info().
 		Str("snapshot_id_1", snapshotID1).
@@ -1575,6 +1649,9 @@ func (h *SnapshotsHandler) CompareSnapshots(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "first snapshot not found"})
 		return
 	}
+	if !h.authorize(c, user, auth.PermBackupRead, backupScope(backup1)) {
+		return
+	}
 
 	// Verify access to second snapshot
 	backup2, err := h.store.GetBackupBySnapshotID(c.Request.Context(), snapshotID2)
@@ -1588,6 +1665,9 @@ func (h *SnapshotsHandler) CompareSnapshots(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "second snapshot not found"})
 		return
 	}
+	if !h.authorize(c, user, auth.PermBackupRead, backupScope(backup2)) {
+		return
+	}
 
 	// Get schedules for paths info
 	schedule1, err := h.store.GetScheduleByID(c.Request.Context(), backup1.ScheduleID)
@@ -1789,6 +1869,10 @@ func (h *SnapshotsHandler) MountSnapshot(c *gin.Context) {
 		return
 	}
 
+	if !h.authorize(c, user, auth.PermRestoreCreate, auth.ResourceScope{AgentID: agentID, RepositoryID: repositoryID}) {
+		return
+	}
+
 	// Verify snapshot exists
 	_, err = h.store.GetBackupBySnapshotID(c.Request.Context(), snapshotID)
 	if err != nil {
@@ -31,6 +31,8 @@ type mockSnapshotStore struct {
 	comments         []*models.SnapshotComment
 	comment          *models.SnapshotComment
 	commentCounts    map[string]int
+	repoKey          *models.RepositoryKey
+	auditLogs        []*models.AuditLog
 
 	getUserErr       error
 	getAgentsErr     error
@@ -105,6 +107,9 @@ func (m *mockSnapshotStore) GetRepositoriesByOrgID(_ context.Context, _ uuid.UUI
 }
 
 func (m *mockSnapshotStore) GetRepositoryKeyByRepositoryID(_ context.Context, _ uuid.UUID) (*models.RepositoryKey, error) {
+	if m.repoKey != nil {
+		return m.repoKey, nil
+	}
 	return nil, errors.New("not implemented in test")
 }
 
@@ -226,6 +231,11 @@ func (m *mockSnapshotStore) CreateAgentCommand(_ context.Context, _ *models.Agen
 	return nil
 }
 
+func (m *mockSnapshotStore) CreateAuditLog(_ context.Context, log *models.AuditLog) error {
+	m.auditLogs = append(m.auditLogs, log)
+	return nil
+}
+
 // setupSnapshotsRouter registers all snapshot/restore routes for testing.
 func setupSnapshotsRouter(store SnapshotStore, user *auth.SessionUser) *gin.Engine {
 	r := SetupTestRouter(user)
@@ -11,7 +11,9 @@ import (
 	"time"
 
 	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/auth"
 	"github.com/MacJediWizard/keldris/internal/license"
+	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/MacJediWizard/keldris/internal/settings"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -25,6 +27,8 @@ type SystemSettingsStore interface {
 	UpdateSMTPSettings(ctx context.Context, orgID uuid.UUID, smtp *settings.SMTPSettings) error
 	GetOIDCSettings(ctx context.Context, orgID uuid.UUID) (*settings.OIDCSettings, error)
 	UpdateOIDCSettings(ctx context.Context, orgID uuid.UUID, oidc *settings.OIDCSettings) error
+	GetSAMLSettings(ctx context.Context, orgID uuid.UUID) (*settings.SAMLSettings, error)
+	UpdateSAMLSettings(ctx context.Context, orgID uuid.UUID, saml *settings.SAMLSettings) error
 	GetStorageDefaultSettings(ctx context.Context, orgID uuid.UUID) (*settings.StorageDefaultSettings, error)
 	UpdateStorageDefaultSettings(ctx context.Context, orgID uuid.UUID, storage *settings.StorageDefaultSettings) error
 	GetSecuritySettings(ctx context.Context, orgID uuid.UUID) (*settings.SecuritySettings, error)
@@ -66,6 +70,9 @@ func (h *SystemSettingsHandler) RegisterRoutes(r *gin.RouterGroup) {
 		sysSettings.PUT("/oidc", h.UpdateOIDC)
 		sysSettings.POST("/oidc/test", h.TestOIDC)
 
+		sysSettings.GET("/saml", h.GetSAML)
+		sysSettings.PUT("/saml", h.UpdateSAML)
+
 		sysSettings.GET("/storage", h.GetStorageDefaults)
 		sysSettings.PUT("/storage", h.UpdateStorageDefaults)
 
@@ -631,6 +638,181 @@ func (h *SystemSettingsHandler) TestOIDC(c *gin.Context) {
 	})
 }
 
+// GetSAML returns SAML settings for the organization.
+// GET /api/v1/system-settings/saml
+func (h *SystemSettingsHandler) GetSAML(c *gin.Context) {
+	if !middleware.RequireFeature(c, h.checker, license.FeatureOIDC) {
+		return
+	}
+
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return
+	}
+
+	if user.CurrentOrgID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no organization selected"})
+		return
+	}
+
+	if !isAdmin(user.CurrentOrgRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return
+	}
+
+	saml, err := h.store.GetSAMLSettings(c.Request.Context(), user.CurrentOrgID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("org_id", user.CurrentOrgID.String()).Msg("failed to get SAML settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get SAML settings"})
+		return
+	}
+
+	// Mask SP private key
+	saml.SPPrivateKey = ""
+
+	c.JSON(http.StatusOK, saml)
+}
+
+// UpdateSAML updates SAML settings for the organization. A signing key pair
+// for AuthnRequests is generated the first time SAML is enabled, or when
+// regenerate_sp_key is set.
+// PUT /api/v1/system-settings/saml
+func (h *SystemSettingsHandler) UpdateSAML(c *gin.Context) {
+	if !middleware.RequireFeature(c, h.checker, license.FeatureOIDC) {
+		return
+	}
+
+	user := middleware.RequireUser(c)
+	if user == nil {
+		return
+	}
+
+	if user.CurrentOrgID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no organization selected"})
+		return
+	}
+
+	if !isAdmin(user.CurrentOrgRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return
+	}
+
+	var req settings.UpdateSAMLSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get current settings
+	current, err := h.store.GetSAMLSettings(c.Request.Context(), user.CurrentOrgID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("org_id", user.CurrentOrgID.String()).Msg("failed to get current SAML settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get current settings"})
+		return
+	}
+
+	// Store old value for audit (mask key)
+	oldCopy := *current
+	oldCopy.SPPrivateKey = "[MASKED]"
+	oldValue, _ := json.Marshal(oldCopy)
+
+	// Apply updates
+	if req.Enabled != nil {
+		current.Enabled = *req.Enabled
+	}
+	if req.IdPEntityID != nil {
+		current.IdPEntityID = *req.IdPEntityID
+	}
+	if req.IdPSSOURL != nil {
+		current.IdPSSOURL = *req.IdPSSOURL
+	}
+	if req.IdPCertificate != nil {
+		current.IdPCertificate = *req.IdPCertificate
+	}
+	if req.SPEntityID != nil {
+		current.SPEntityID = *req.SPEntityID
+	}
+	if req.ACSURL != nil {
+		current.ACSURL = *req.ACSURL
+	}
+	if req.EmailAttribute != nil {
+		current.EmailAttribute = *req.EmailAttribute
+	}
+	if req.NameAttribute != nil {
+		current.NameAttribute = *req.NameAttribute
+	}
+	if req.GroupsAttribute != nil {
+		current.GroupsAttribute = *req.GroupsAttribute
+	}
+	if req.AutoCreateUsers != nil {
+		current.AutoCreateUsers = *req.AutoCreateUsers
+	}
+	if req.DefaultRole != nil {
+		current.DefaultRole = *req.DefaultRole
+	}
+	if req.AllowedDomains != nil {
+		current.AllowedDomains = req.AllowedDomains
+	}
+
+	// Validate
+	if err := current.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if current.IdPCertificate != "" {
+		if _, err := auth.ParseSAMLCertificates(current.IdPCertificate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid SAML IdP certificate: " + err.Error()})
+			return
+		}
+	}
+
+	regenerate := req.RegenerateSPKey != nil && *req.RegenerateSPKey
+	if current.Enabled && (current.SPPrivateKey == "" || regenerate) {
+		certPEM, keyPEM, err := auth.GenerateSAMLKeyPair("keldris-" + user.CurrentOrgID.String())
+		if err != nil {
+			h.logger.Error().Err(err).Str("org_id", user.CurrentOrgID.String()).Msg("failed to generate SAML signing key")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate SAML signing key"})
+			return
+		}
+		current.SPCertificate = certPEM
+		current.SPPrivateKey = keyPEM
+	}
+
+	// Save
+	if err := h.store.UpdateSAMLSettings(c.Request.Context(), user.CurrentOrgID, current); err != nil {
+		h.logger.Error().Err(err).Str("org_id", user.CurrentOrgID.String()).Msg("failed to update SAML settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update settings"})
+		return
+	}
+
+	// Create audit log
+	newCopy := *current
+	newCopy.SPPrivateKey = "[MASKED]"
+	newValue, _ := json.Marshal(newCopy)
+
+	auditLog := settings.NewSettingsAuditLog(
+		user.CurrentOrgID,
+		settings.SettingKeySAML,
+		oldValue,
+		newValue,
+		user.ID,
+		getClientIP(c),
+	)
+	if err := h.store.CreateSettingsAuditLog(c.Request.Context(), auditLog); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to create settings audit log")
+	}
+
+	h.logger.Info().
+		Str("org_id", user.CurrentOrgID.String()).
+		Str("user_id", user.ID.String()).
+		Bool("enabled", current.Enabled).
+		Msg("SAML settings updated")
+
+	// Return updated settings (masked)
+	current.SPPrivateKey = ""
+	c.JSON(http.StatusOK, current)
+}
+
 // GetStorageDefaults returns storage default settings for the organization.
 // GET /api/v1/system-settings/storage
 func (h *SystemSettingsHandler) GetStorageDefaults(c *gin.Context) {
@@ -830,11 +1012,19 @@ func (h *SystemSettingsHandler) UpdateSecurity(c *gin.Context) {
 		current.MaxConcurrentSessions = *req.MaxConcurrentSessions
 	}
 	if req.RequireMFA != nil {
+		if *req.RequireMFA && !current.RequireMFA {
+			// Grace period for existing users starts when the policy is turned on
+			now := time.Now()
+			current.MFARequiredSince = &now
+		}
 		current.RequireMFA = *req.RequireMFA
 	}
 	if req.MFAGracePeriodDays != nil {
 		current.MFAGracePeriodDays = *req.MFAGracePeriodDays
 	}
+	if req.StepUpMaxAgeMinutes != nil {
+		current.StepUpMaxAgeMinutes = *req.StepUpMaxAgeMinutes
+	}
 	if req.AllowedIPRanges != nil {
 		current.AllowedIPRanges = req.AllowedIPRanges
 	}
@@ -862,6 +1052,18 @@ func (h *SystemSettingsHandler) UpdateSecurity(c *gin.Context) {
 	if req.AllowPasswordLogin != nil {
 		current.AllowPasswordLogin = *req.AllowPasswordLogin
 	}
+	if req.ApprovalRequiredActions != nil {
+		for _, action := range req.ApprovalRequiredActions {
+			if !models.ApprovalAction(action).IsValid() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown approval action: " + action})
+				return
+			}
+		}
+		current.ApprovalRequiredActions = req.ApprovalRequiredActions
+	}
+	if req.ApprovalExpiryHours != nil {
+		current.ApprovalExpiryHours = *req.ApprovalExpiryHours
+	}
 
 	// Validate
 	if err := current.Validate(); err != nil {
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/MacJediWizard/keldris/internal/auth"
@@ -18,6 +20,7 @@ type mockSystemSettingsStore struct {
 	all       *settings.SystemSettingsResponse
 	smtp      *settings.SMTPSettings
 	oidc      *settings.OIDCSettings
+	saml      *settings.SAMLSettings
 	storage   *settings.StorageDefaultSettings
 	security  *settings.SecuritySettings
 	audit     []*settings.SettingsAuditLog
@@ -69,6 +72,26 @@ func (m *mockSystemSettingsStore) UpdateOIDCSettings(_ context.Context, _ uuid.U
 	return m.updateErr
 }
 
+func (m *mockSystemSettingsStore) GetSAMLSettings(_ context.Context, _ uuid.UUID) (*settings.SAMLSettings, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	if m.saml != nil {
+		return m.saml, nil
+	}
+	defaults := settings.DefaultSAMLSettings()
+	return &defaults, nil
+}
+
+func (m *mockSystemSettingsStore) UpdateSAMLSettings(_ context.Context, _ uuid.UUID, saml *settings.SAMLSettings) error {
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+	copied := *saml
+	m.saml = &copied
+	return nil
+}
+
 func (m *mockSystemSettingsStore) GetStorageDefaultSettings(_ context.Context, _ uuid.UUID) (*settings.StorageDefaultSettings, error) {
 	if m.getErr != nil {
 		return nil, m.getErr
@@ -210,6 +233,59 @@ func TestSystemSettingsGetOIDC(t *testing.T) {
 	})
 }
 
+func TestSystemSettingsSAML(t *testing.T) {
+	orgID := uuid.New()
+	user := testUser(orgID)
+
+	idpCert, _, err := auth.GenerateSAMLKeyPair("idp.test")
+	if err != nil {
+		t.Fatalf("GenerateSAMLKeyPair() error: %v", err)
+	}
+
+	t.Run("get masks SP private key", func(t *testing.T) {
+		store := &mockSystemSettingsStore{saml: &settings.SAMLSettings{Enabled: true, SPPrivateKey: "secret-key"}}
+		r := setupSystemSettingsTestRouter(store, user)
+		resp := DoRequest(r, AuthenticatedRequest("GET", "/api/v1/system-settings/saml"))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if strings.Contains(resp.Body.String(), "secret-key") {
+			t.Fatal("SP private key must not be returned")
+		}
+	})
+
+	t.Run("enabling generates SP signing key", func(t *testing.T) {
+		store := &mockSystemSettingsStore{}
+		r := setupSystemSettingsTestRouter(store, user)
+		body, _ := json.Marshal(map[string]interface{}{
+			"enabled":         true,
+			"idp_entity_id":   "https://idp.test/metadata",
+			"idp_sso_url":     "https://idp.test/sso",
+			"idp_certificate": idpCert,
+		})
+		resp := DoRequest(r, JSONRequest("PUT", "/api/v1/system-settings/saml", string(body)))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+		}
+		if store.saml == nil || store.saml.SPPrivateKey == "" || store.saml.SPCertificate == "" {
+			t.Fatal("expected SP key pair to be generated and saved")
+		}
+		if strings.Contains(resp.Body.String(), "PRIVATE KEY") {
+			t.Fatal("SP private key must not be returned")
+		}
+	})
+
+	t.Run("invalid IdP certificate returns 400", func(t *testing.T) {
+		store := &mockSystemSettingsStore{}
+		r := setupSystemSettingsTestRouter(store, user)
+		resp := DoRequest(r, JSONRequest("PUT", "/api/v1/system-settings/saml",
+			`{"enabled":true,"idp_entity_id":"https://idp.test","idp_sso_url":"https://idp.test/sso","idp_certificate":"not a cert"}`))
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+}
+
 func TestSystemSettingsGetStorageDefaults(t *testing.T) {
 	orgID := uuid.New()
 	user := testUser(orgID)
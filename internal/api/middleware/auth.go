@@ -3,18 +3,21 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/MacJediWizard/keldris/internal/auth"
 	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog"
 )
 
-// UserStore is the interface for verifying users exist in the database.
+// UserStore is the interface for verifying users and their sessions in the database.
 type UserStore interface {
 	GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetUserSessionByID(ctx context.Context, id uuid.UUID) (*models.UserSession, error)
 }
 
 // ContextKey is the type for context keys used by this package.
@@ -64,7 +67,8 @@ func AuthMiddleware(sessions *auth.SessionStore, logger zerolog.Logger) gin.Hand
 }
 
 // UserVerifyMiddleware returns a Gin middleware that verifies the session user exists in the database.
-// This catches stale sessions after a database reset. Must run after AuthMiddleware.
+// This catches stale sessions after a database reset, and ends sessions of disabled users and
+// sessions revoked from the session list or by deprovisioning. Must run after AuthMiddleware.
 func UserVerifyMiddleware(store UserStore, sessions *auth.SessionStore, logger zerolog.Logger) gin.HandlerFunc {
 	log := logger.With().Str("component", "user_verify_middleware").Logger()
 
@@ -75,22 +79,53 @@ func UserVerifyMiddleware(store UserStore, sessions *auth.SessionStore, logger z
 			return
 		}
 
-		_, err := store.GetUserByID(c.Request.Context(), user.ID)
+		dbUser, err := store.GetUserByID(c.Request.Context(), user.ID)
 		if err != nil {
 			log.Warn().
 				Str("user_id", user.ID.String()).
 				Msg("session user not found in database, clearing stale session")
-			if clearErr := sessions.ClearUser(c.Request, c.Writer); clearErr != nil {
-				log.Warn().Err(clearErr).Msg("failed to clear stale session")
-			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session expired, please log in again"})
+			clearSession(c, sessions, log)
+			return
+		}
+
+		if dbUser.Status == models.UserStatusDisabled {
+			log.Info().
+				Str("user_id", user.ID.String()).
+				Msg("session user is disabled, clearing session")
+			clearSession(c, sessions, log)
 			return
 		}
 
+		if user.SessionRecordID != uuid.Nil {
+			record, err := store.GetUserSessionByID(c.Request.Context(), user.SessionRecordID)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				log.Error().Err(err).
+					Str("user_id", user.ID.String()).
+					Msg("failed to check session revocation")
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to verify session"})
+				return
+			}
+			if err == nil && record.Revoked {
+				log.Info().
+					Str("user_id", user.ID.String()).
+					Str("session_id", record.ID.String()).
+					Msg("session was revoked, clearing session")
+				clearSession(c, sessions, log)
+				return
+			}
+		}
+
 		c.Next()
 	}
 }
 
+func clearSession(c *gin.Context, sessions *auth.SessionStore, log zerolog.Logger) {
+	if err := sessions.ClearUser(c.Request, c.Writer); err != nil {
+		log.Warn().Err(err).Msg("failed to clear stale session")
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session expired, please log in again"})
+}
+
 // GetUser retrieves the authenticated user from the Gin context.
 // Returns nil if no user is authenticated.
 func GetUser(c *gin.Context) *auth.SessionUser {
@@ -13,6 +13,7 @@ import (
 	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog"
 )
 
@@ -261,6 +262,114 @@ func TestAuthMiddleware_RefreshSession(t *testing.T) {
 	}
 }
 
+// mockUserVerifyStore implements UserStore for testing.
+type mockUserVerifyStore struct {
+	user       *models.User
+	session    *models.UserSession
+	sessionErr error
+}
+
+func (m *mockUserVerifyStore) GetUserByID(_ context.Context, id uuid.UUID) (*models.User, error) {
+	if m.user == nil || m.user.ID != id {
+		return nil, fmt.Errorf("user not found")
+	}
+	return m.user, nil
+}
+
+func (m *mockUserVerifyStore) GetUserSessionByID(_ context.Context, id uuid.UUID) (*models.UserSession, error) {
+	if m.sessionErr != nil {
+		return nil, m.sessionErr
+	}
+	if m.session == nil || m.session.ID != id {
+		return nil, fmt.Errorf("get user session by ID: %w", pgx.ErrNoRows)
+	}
+	return m.session, nil
+}
+
+func TestUserVerifyMiddleware(t *testing.T) {
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name     string
+		store    *mockUserVerifyStore
+		wantOK   bool
+		wantCode int
+	}{
+		{
+			name:   "active user",
+			store:  &mockUserVerifyStore{user: &models.User{ID: userID, Status: models.UserStatusActive}},
+			wantOK: true,
+		},
+		{
+			name:  "user deleted",
+			store: &mockUserVerifyStore{},
+		},
+		{
+			name:  "user disabled",
+			store: &mockUserVerifyStore{user: &models.User{ID: userID, Status: models.UserStatusDisabled}},
+		},
+		{
+			name: "session revoked",
+			store: &mockUserVerifyStore{
+				user:    &models.User{ID: userID, Status: models.UserStatusActive},
+				session: &models.UserSession{ID: sessionID, UserID: userID, Revoked: true},
+			},
+		},
+		{
+			name: "session active",
+			store: &mockUserVerifyStore{
+				user:    &models.User{ID: userID, Status: models.UserStatusActive},
+				session: &models.UserSession{ID: sessionID, UserID: userID},
+			},
+			wantOK: true,
+		},
+		{
+			name: "session lookup fails",
+			store: &mockUserVerifyStore{
+				user:       &models.User{ID: userID, Status: models.UserStatusActive},
+				sessionErr: fmt.Errorf("connection refused"),
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := newTestSessionStore(t)
+			r := gin.New()
+			r.Use(AuthMiddleware(sessions, zerolog.Nop()))
+			r.Use(UserVerifyMiddleware(tt.store, sessions, zerolog.Nop()))
+			r.GET("/test", func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"ok": true})
+			})
+
+			cookies := setSessionCookies(t, sessions, &auth.SessionUser{
+				ID:              userID,
+				AuthenticatedAt: time.Now(),
+				SessionRecordID: sessionID,
+			})
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/test", nil)
+			for _, cookie := range cookies {
+				req.AddCookie(cookie)
+			}
+			r.ServeHTTP(w, req)
+
+			if tt.wantOK && w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			wantCode := tt.wantCode
+			if wantCode == 0 {
+				wantCode = http.StatusUnauthorized
+			}
+			if !tt.wantOK && w.Code != wantCode {
+				t.Fatalf("expected status %d, got %d: %s", wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
 func TestGetUser_NoUser(t *testing.T) {
 	r := gin.New()
 	r.GET("/test", func(c *gin.Context) {
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/MacJediWizard/keldris/internal/settings"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// mfaRoutePrefix is always reachable so users can enroll when MFA is enforced.
+const mfaRoutePrefix = "/api/v1/mfa"
+
+// SensitiveOperations lists routes ("METHOD /full/path" as registered in Gin)
+// that require a recent re-authentication, even with a valid session.
+var SensitiveOperations = map[string]bool{
+	"DELETE /api/v1/repositories/:id":                            true,
+	"DELETE /api/v1/snapshots/:id/hold":                          true,
+	"DELETE /api/v1/organizations/:id":                           true,
+	"POST /api/v1/superuser/impersonate/:id":                     true,
+	"POST /api/v1/impersonate/:id":                               true,
+	"POST /api/v1/superuser/users/:id/grant-superuser":           true,
+	"POST /api/v1/superuser/users/:id/revoke-superuser":          true,
+	"DELETE /api/v1/mfa/factors/:id":                             true,
+	"POST /api/v1/mfa/recovery-codes":                            true,
+	"PUT /api/v1/system-settings/security":                       true,
+	"DELETE /api/v1/organizations/:id/members/:user_id":          true,
+	"DELETE /api/v1/organizations/:id/role-bindings/:binding_id": true,
+	"POST /api/v1/approvals/:id/approve":                         true,
+}
+
+// SecuritySettingsStore provides per-organization security settings.
+type SecuritySettingsStore interface {
+	GetSecuritySettings(ctx context.Context, orgID uuid.UUID) (*settings.SecuritySettings, error)
+}
+
+// MFAEnforcementStore is the persistence needed to enforce an org MFA policy.
+type MFAEnforcementStore interface {
+	SecuritySettingsStore
+	GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetMFAFactorsByUserID(ctx context.Context, userID uuid.UUID) ([]*models.UserMFAFactor, error)
+}
+
+// MFAEnforcementMiddleware returns a Gin middleware that blocks local (password)
+// users without a second factor once their organization's MFA grace period has
+// passed. MFA enrollment routes stay reachable. SSO users are not affected;
+// their second factor is enforced by the identity provider.
+func MFAEnforcementMiddleware(store MFAEnforcementStore, logger zerolog.Logger) gin.HandlerFunc {
+	log := logger.With().Str("component", "mfa_enforcement_middleware").Logger()
+
+	return func(c *gin.Context) {
+		user := GetUser(c)
+		if user == nil || user.OIDCSubject != "" || user.CurrentOrgID == uuid.Nil || user.IsImpersonating() ||
+			strings.HasPrefix(c.Request.URL.Path, mfaRoutePrefix) {
+			c.Next()
+			return
+		}
+
+		// The policy is enforced fail-closed: if it cannot be checked, the
+		// request is refused rather than let through.
+		ctx := c.Request.Context()
+		security, err := store.GetSecuritySettings(ctx, user.CurrentOrgID)
+		if err != nil {
+			log.Error().Err(err).Str("org_id", user.CurrentOrgID.String()).Msg("failed to get security settings")
+			abortMFACheckFailed(c)
+			return
+		}
+		if !security.RequireMFA {
+			c.Next()
+			return
+		}
+
+		factors, err := store.GetMFAFactorsByUserID(ctx, user.ID)
+		if err != nil {
+			log.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to get mfa factors")
+			abortMFACheckFailed(c)
+			return
+		}
+		for _, f := range factors {
+			if f.IsConfirmed() {
+				c.Next()
+				return
+			}
+		}
+
+		account, err := store.GetUserByID(ctx, user.ID)
+		if err != nil {
+			log.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to get user")
+			abortMFACheckFailed(c)
+			return
+		}
+		var since time.Time
+		if security.MFARequiredSince != nil {
+			since = *security.MFARequiredSince
+		}
+		deadline := auth.MFAEnrollmentDeadline(account.CreatedAt, since, security.MFAGracePeriodDays)
+		if time.Now().Before(deadline) {
+			c.Header("X-MFA-Enrollment-Deadline", deadline.UTC().Format(time.RFC3339))
+			c.Next()
+			return
+		}
+
+		log.Debug().
+			Str("user_id", user.ID.String()).
+			Str("path", c.Request.URL.Path).
+			Msg("blocked request from user without required MFA")
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":   "mfa_enrollment_required",
+			"message": "Your organization requires multi-factor authentication. Enroll a second factor to continue.",
+		})
+	}
+}
+
+// abortMFACheckFailed refuses a request whose MFA policy could not be checked.
+func abortMFACheckFailed(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+		"error":   "mfa_check_failed",
+		"message": "Unable to verify your organization's MFA policy. Please try again.",
+	})
+}
+
+// StepUpMiddleware returns a Gin middleware that requires a recent
+// re-authentication (via POST /api/v1/mfa/step-up, or a fresh login) before
+// any route in SensitiveOperations. The window comes from the org's security
+// settings.
+func StepUpMiddleware(store SecuritySettingsStore, logger zerolog.Logger) gin.HandlerFunc {
+	log := logger.With().Str("component", "step_up_middleware").Logger()
+
+	return func(c *gin.Context) {
+		if !SensitiveOperations[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		user := GetUser(c)
+		if user == nil {
+			c.Next()
+			return
+		}
+
+		window := settings.DefaultStepUpMaxAgeMinutes * time.Minute
+		if user.CurrentOrgID != uuid.Nil {
+			if security, err := store.GetSecuritySettings(c.Request.Context(), user.CurrentOrgID); err == nil {
+				window = security.StepUpMaxAge()
+			}
+		}
+
+		if !user.StepUpAt.IsZero() && time.Since(user.StepUpAt) <= window {
+			c.Next()
+			return
+		}
+
+		log.Debug().
+			Str("user_id", user.ID.String()).
+			Str("route", c.FullPath()).
+			Msg("sensitive operation requires step-up")
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":   "step_up_required",
+			"message": "Confirm your identity to continue with this action.",
+		})
+	}
+}
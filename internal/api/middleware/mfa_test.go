@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/MacJediWizard/keldris/internal/settings"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockMFAEnforcementStore struct {
+	security *settings.SecuritySettings
+	user     *models.User
+	factors  []*models.UserMFAFactor
+	err      error
+}
+
+func (m *mockMFAEnforcementStore) GetSecuritySettings(_ context.Context, _ uuid.UUID) (*settings.SecuritySettings, error) {
+	if m.security == nil {
+		return nil, errors.New("not found")
+	}
+	return m.security, nil
+}
+
+func (m *mockMFAEnforcementStore) GetUserByID(_ context.Context, _ uuid.UUID) (*models.User, error) {
+	if m.user == nil {
+		return nil, errors.New("not found")
+	}
+	return m.user, nil
+}
+
+func (m *mockMFAEnforcementStore) GetMFAFactorsByUserID(_ context.Context, _ uuid.UUID) ([]*models.UserMFAFactor, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.factors, nil
+}
+
+func serveWith(t *testing.T, mw gin.HandlerFunc, user *auth.SessionUser, method, route, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(injectUser(user), mw)
+	r.Handle(method, route, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestStepUpMiddleware(t *testing.T) {
+	orgID := uuid.New()
+	security := settings.DefaultSecuritySettings()
+	store := &mockMFAEnforcementStore{security: &security}
+	mw := StepUpMiddleware(store, zerolog.Nop())
+	path := "/api/v1/repositories/" + uuid.New().String()
+
+	t.Run("stale session blocked", func(t *testing.T) {
+		user := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, StepUpAt: time.Now().Add(-time.Hour)}
+		w := serveWith(t, mw, user, "DELETE", "/api/v1/repositories/:id", path)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("recent step-up allowed", func(t *testing.T) {
+		user := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, StepUpAt: time.Now().Add(-time.Minute)}
+		w := serveWith(t, mw, user, "DELETE", "/api/v1/repositories/:id", path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+	})
+
+	t.Run("org window applies", func(t *testing.T) {
+		longer := settings.DefaultSecuritySettings()
+		longer.StepUpMaxAgeMinutes = 30
+		mw := StepUpMiddleware(&mockMFAEnforcementStore{security: &longer}, zerolog.Nop())
+		user := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, StepUpAt: time.Now().Add(-20 * time.Minute)}
+		w := serveWith(t, mw, user, "DELETE", "/api/v1/repositories/:id", path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+	})
+
+	t.Run("non-sensitive route unaffected", func(t *testing.T) {
+		user := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID}
+		w := serveWith(t, mw, user, "GET", "/api/v1/repositories/:id", path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+	})
+}
+
+func TestMFAEnforcementMiddleware(t *testing.T) {
+	orgID := uuid.New()
+	required := settings.DefaultSecuritySettings()
+	required.RequireMFA = true
+	required.MFAGracePeriodDays = 7
+	longAgo := time.Now().AddDate(0, 0, -30)
+	required.MFARequiredSince = &longAgo
+
+	localUser := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID}
+
+	t.Run("blocked after grace period", func(t *testing.T) {
+		store := &mockMFAEnforcementStore{security: &required, user: &models.User{CreatedAt: longAgo}}
+		w := serveWith(t, MFAEnforcementMiddleware(store, zerolog.Nop()), localUser, "GET", "/api/v1/agents", "/api/v1/agents")
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("mfa routes reachable", func(t *testing.T) {
+		store := &mockMFAEnforcementStore{security: &required, user: &models.User{CreatedAt: longAgo}}
+		w := serveWith(t, MFAEnforcementMiddleware(store, zerolog.Nop()), localUser, "POST", "/api/v1/mfa/totp", "/api/v1/mfa/totp")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+	})
+
+	t.Run("within grace period", func(t *testing.T) {
+		store := &mockMFAEnforcementStore{security: &required, user: &models.User{CreatedAt: time.Now()}}
+		w := serveWith(t, MFAEnforcementMiddleware(store, zerolog.Nop()), localUser, "GET", "/api/v1/agents", "/api/v1/agents")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		if w.Header().Get("X-MFA-Enrollment-Deadline") == "" {
+			t.Error("expected enrollment deadline header")
+		}
+	})
+
+	t.Run("enrolled user allowed", func(t *testing.T) {
+		confirmed := time.Now()
+		store := &mockMFAEnforcementStore{
+			security: &required,
+			user:     &models.User{CreatedAt: longAgo},
+			factors:  []*models.UserMFAFactor{{Type: models.MFAFactorTOTP, ConfirmedAt: &confirmed}},
+		}
+		w := serveWith(t, MFAEnforcementMiddleware(store, zerolog.Nop()), localUser, "GET", "/api/v1/agents", "/api/v1/agents")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+	})
+
+	t.Run("store errors fail closed", func(t *testing.T) {
+		stores := map[string]*mockMFAEnforcementStore{
+			"security settings": {user: &models.User{CreatedAt: longAgo}},
+			"factors":           {security: &required, user: &models.User{CreatedAt: longAgo}, err: errors.New("db down")},
+			"user":              {security: &required},
+		}
+		for name, store := range stores {
+			w := serveWith(t, MFAEnforcementMiddleware(store, zerolog.Nop()), localUser, "GET", "/api/v1/agents", "/api/v1/agents")
+			if w.Code != http.StatusServiceUnavailable {
+				t.Errorf("%s: expected 503, got %d", name, w.Code)
+			}
+		}
+	})
+
+	t.Run("sso user not enforced", func(t *testing.T) {
+		store := &mockMFAEnforcementStore{security: &required, user: &models.User{CreatedAt: longAgo}}
+		ssoUser := &auth.SessionUser{ID: uuid.New(), CurrentOrgID: orgID, OIDCSubject: "sub-1"}
+		w := serveWith(t, MFAEnforcementMiddleware(store, zerolog.Nop()), ssoUser, "GET", "/api/v1/agents", "/api/v1/agents")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+	})
+}
@@ -11,7 +11,9 @@ import (
 	"github.com/MacJediWizard/keldris/internal/activity"
 	"github.com/MacJediWizard/keldris/internal/api/handlers"
 	"github.com/MacJediWizard/keldris/internal/api/middleware"
+	"github.com/MacJediWizard/keldris/internal/approval"
 	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/backup"
 	"github.com/MacJediWizard/keldris/internal/backup/docker"
 	"github.com/MacJediWizard/keldris/internal/config"
 	"github.com/MacJediWizard/keldris/internal/crypto"
@@ -23,6 +25,7 @@ import (
 	"github.com/MacJediWizard/keldris/internal/monitoring"
 	"github.com/MacJediWizard/keldris/internal/notifications"
 	"github.com/MacJediWizard/keldris/internal/reports"
+	"github.com/MacJediWizard/keldris/internal/restserver"
 	"github.com/MacJediWizard/keldris/internal/telemetry"
 	"github.com/MacJediWizard/keldris/internal/updates"
 	"github.com/MacJediWizard/keldris/internal/webhooks"
@@ -58,6 +61,22 @@ type Config struct {
 	ReportScheduler *reports.Scheduler
 	// DRTestRunner for triggering DR test execution (optional).
 	DRTestRunner handlers.DRTestRunner
+	// RepositoryMigrator for moving repositories between backends (optional).
+	RepositoryMigrator handlers.RepositoryMigrationRunner
+	// MaintenancePlanner for restic repository maintenance (optional).
+	MaintenancePlanner handlers.RepositoryMaintenanceRunner
+	// KubernetesRestorer for restoring namespaces from Kubernetes backups (optional).
+	KubernetesRestorer handlers.KubernetesRestoreRunner
+	// ProxmoxRestorer for restoring VMs from vzdump archives into Proxmox VE (optional).
+	ProxmoxRestorer handlers.ProxmoxRestoreRunner
+	// DatabaseRestorer for restoring PostgreSQL and MySQL dumps of postgres and mysql schedules (optional).
+	DatabaseRestorer handlers.DatabaseRestoreRunner
+	// ObjectLockers enforces immutability locks and legal holds with S3 Object Lock (optional).
+	ObjectLockers backup.ObjectLockerResolver
+	// RestServer hosts restic repositories on the server's own disk (optional).
+	RestServer *restserver.Server
+	// ComplianceEvaluator scores agents and schedules against the 3-2-1 rule (optional).
+	ComplianceEvaluator handlers.ComplianceEvaluator
 	// License is the current server license for feature gating (optional).
 	License *license.License
 	// Validator is the license validator for dynamic license checks (optional).
@@ -85,6 +104,8 @@ type Config struct {
 	MeteringService *metering.Service
 	// EmailService for sending emails (optional).
 	EmailService *notifications.EmailService
+	// NotificationService for channel notifications such as approval requests (optional).
+	NotificationService *notifications.Service
 	// UpdateChecker for checking for new Keldris versions (optional).
 	UpdateChecker *updates.Checker
 	// AirGapPublicKey is the Ed25519 public key for validating offline licenses (optional).
@@ -158,6 +179,14 @@ func NewRouter(
 
 	// Global middleware
 	r.Engine.Use(gin.Recovery())
+
+	// Built-in restic REST server. Registered before the remaining global
+	// middleware: pack uploads exceed the API body limit, restic issues far
+	// more requests than the rate limit allows, and it authenticates itself.
+	if cfg.RestServer != nil {
+		r.Engine.Any(restserver.PathPrefix+"/*path", gin.WrapH(http.StripPrefix(restserver.PathPrefix, cfg.RestServer)))
+	}
+
 	r.Engine.Use(middleware.BodyLimitMiddleware(10 << 20)) // 10 MB default body limit
 	r.Engine.Use(middleware.RequestLogger(logger))
 	r.Engine.Use(middleware.CORS(cfg.AllowedOrigins, cfg.Environment))
@@ -238,11 +267,32 @@ func NewRouter(
 	updatesHandler := handlers.NewUpdatesHandler(cfg.UpdateChecker, logger)
 	updatesHandler.RegisterPublicRoutes(r.Engine)
 
+	// MFA verifier for local-account second factors (TOTP, WebAuthn, recovery codes)
+	var mfaVerifier *auth.MFAVerifier
+	if keyManager != nil {
+		webAuthnURL := cfg.ServerURL
+		if webAuthnURL == "" {
+			webAuthnURL = "http://localhost:8080"
+		}
+		webAuthnCfg, err := auth.WebAuthnConfigFromURL(webAuthnURL, "Keldris", cfg.AllowedOrigins)
+		if err != nil {
+			return nil, err
+		}
+		mfaVerifier = auth.NewMFAVerifier(database, keyManager, webAuthnCfg, logger)
+	}
+
 	// Auth routes (no auth required)
 	authGroup := r.Engine.Group("/auth")
 	authHandler := handlers.NewAuthHandler(oidc, sessions, database, logger)
+	if mfaVerifier != nil {
+		authHandler.SetMFAVerifier(mfaVerifier)
+	}
 	authHandler.RegisterRoutes(authGroup)
 
+	// Per-organization SAML service provider (no auth required)
+	samlHandler := handlers.NewSAMLHandler(database, sessions, cfg.ServerURL, logger)
+	samlHandler.RegisterRoutes(authGroup)
+
 	// Auth status endpoint (public, for login page)
 	authHandler.RegisterPublicRoutes(r.Engine)
 
@@ -273,8 +323,13 @@ func NewRouter(
 	ipFilter := middleware.NewIPFilter(database, logger)
 	apiV1.Use(middleware.IPFilterMiddleware(ipFilter, logger))
 
-	// Create RBAC for permission checks
+	// Org MFA policy and step-up re-authentication for sensitive operations
+	apiV1.Use(middleware.MFAEnforcementMiddleware(database, logger))
+	apiV1.Use(middleware.StepUpMiddleware(database, logger))
+
+	// Create RBAC for permission checks (built-in roles plus custom role bindings)
 	rbac := auth.NewRBAC(database)
+	rbac.SetRoleBindingStore(database)
 
 	// Create feature checker for handler-level gating
 	featureChecker := license.NewFeatureChecker(database)
@@ -332,8 +387,21 @@ func NewRouter(
 	agentImportHandler := handlers.NewAgentImportHandler(database, cfg.ServerURL, logger)
 	agentImportHandler.RegisterRoutes(apiV1)
 
+	// Four-eyes approval for destructive operations
+	var approvalNotifier approval.Notifier
+	if cfg.NotificationService != nil {
+		approvalNotifier = cfg.NotificationService
+	}
+	approvalService := approval.NewService(database, approvalNotifier, logger)
+	approvalsHandler := handlers.NewApprovalsHandler(database, approvalService, logger)
+	approvalsHandler.RegisterRoutes(apiV1)
+
 	// Repositories
 	reposHandler := handlers.NewRepositoriesHandler(database, rbac, keyManager, featureChecker, logger)
+	reposHandler.SetApprovalGate(approvalService)
+	if cfg.RestServer != nil {
+		reposHandler.SetHostedRepositories(cfg.ServerURL)
+	}
 	reposHandler.RegisterRoutes(apiV1)
 
 	repoImportHandler := handlers.NewRepositoryImportHandler(database, keyManager, logger)
@@ -341,6 +409,7 @@ func NewRouter(
 
 	// Schedules
 	schedulesHandler := handlers.NewSchedulesHandler(database, rbac, logger)
+	schedulesHandler.SetApprovalGate(approvalService)
 	schedulesHandler.RegisterRoutes(apiV1)
 
 	backupScriptsHandler := handlers.NewBackupScriptsHandler(database, logger)
@@ -361,7 +430,22 @@ func NewRouter(
 	backupsHandler.RegisterRoutes(apiV1)
 
 	snapshotsHandler := handlers.NewSnapshotsHandler(database, keyManager, logger)
+	snapshotsHandler.SetRBAC(rbac)
+	snapshotsHandler.SetServerURL(cfg.ServerURL)
+	snapshotsHandler.SetIPFilter(ipFilter)
 	snapshotsHandler.RegisterRoutes(apiV1)
+	// Read-only WebDAV view of snapshots, authenticated with credentials
+	// issued by the snapshots API rather than the session cookie; the
+	// handler applies the org IP allowlist itself
+	snapshotsHandler.RegisterWebDAVRoutes(r.Engine)
+
+	// Snapshot tag changes and path purges via restic tag and rewrite
+	snapshotEditHandler := handlers.NewSnapshotEditHandler(database, keyManager, logger)
+	snapshotEditHandler.SetApprovalGate(approvalService)
+	if cfg.MaintenancePlanner != nil {
+		snapshotEditHandler.SetPruner(cfg.MaintenancePlanner)
+	}
+	snapshotEditHandler.RegisterRoutes(apiV1)
 
 	// Backup queue
 	backupQueueHandler := handlers.NewBackupQueueHandler(database, rbac, logger)
@@ -369,6 +453,8 @@ func NewRouter(
 
 	legalHoldsGroup := apiV1.Group("", middleware.FeatureMiddleware(license.FeatureLegalHolds, logger))
 	legalHoldsHandler := handlers.NewLegalHoldsHandler(database, featureChecker, logger)
+	legalHoldsHandler.SetApprovalGate(approvalService)
+	legalHoldsHandler.SetObjectLockers(cfg.ObjectLockers)
 	legalHoldsHandler.RegisterRoutes(legalHoldsGroup)
 
 	fileHistoryHandler := handlers.NewFileHistoryHandler(database, logger)
@@ -436,6 +522,28 @@ func NewRouter(
 		verificationsHandler.RegisterRoutes(apiV1)
 	}
 
+	// Repository migrations between backends
+	if cfg.RepositoryMigrator != nil {
+		repoMigrationsHandler := handlers.NewRepositoryMigrationsHandler(database, cfg.RepositoryMigrator, logger)
+		repoMigrationsHandler.RegisterRoutes(apiV1)
+	}
+
+	// Repository maintenance: format upgrades, compression and pruning
+	if cfg.MaintenancePlanner != nil {
+		repoMaintenanceHandler := handlers.NewRepositoryMaintenanceHandler(database, cfg.MaintenancePlanner, logger)
+		repoMaintenanceHandler.RegisterRoutes(apiV1)
+	}
+
+	// Kubernetes namespace restores
+	if cfg.KubernetesRestorer != nil {
+		kubernetesHandler := handlers.NewKubernetesHandler(database, cfg.KubernetesRestorer, logger)
+		kubernetesHandler.RegisterRoutes(apiV1)
+	}
+
+	// Repository transfer tuning and backend transfer metrics
+	repoTransferHandler := handlers.NewRepositoryTransferHandler(database, logger)
+	repoTransferHandler.RegisterRoutes(apiV1)
+
 	// User management
 	usersHandler := handlers.NewUsersHandler(database, sessions, rbac, logger)
 	usersHandler.RegisterRoutes(apiV1)
@@ -445,6 +553,17 @@ func NewRouter(
 	ssoGroupMappingsHandler := handlers.NewSSOGroupMappingsHandler(database, rbac, featureChecker, logger)
 	ssoGroupMappingsHandler.RegisterRoutes(ssoGroupMappingsGroup)
 
+	// Custom roles and role bindings (feature gated - requires Enterprise)
+	customRolesGroup := apiV1.Group("", middleware.FeatureMiddleware(license.FeatureRBAC, logger))
+	customRolesHandler := handlers.NewCustomRolesHandler(database, rbac, featureChecker, logger)
+	customRolesHandler.RegisterRoutes(customRolesGroup)
+
+	// SCIM provisioning: token management for admins, and the SCIM 2.0 API
+	// authenticated by those org-scoped bearer tokens (feature gated - requires Enterprise)
+	scimHandler := handlers.NewSCIMHandler(database, rbac, featureChecker, cfg.ServerURL, logger)
+	scimHandler.RegisterRoutes(ssoGroupMappingsGroup)
+	scimHandler.RegisterSCIMRoutes(r.Engine)
+
 	maintenanceHandler := handlers.NewMaintenanceHandler(database, logger)
 	maintenanceHandler.RegisterRoutes(apiV1)
 
@@ -452,6 +571,9 @@ func NewRouter(
 	dockerBackupGroup := apiV1.Group("", middleware.FeatureMiddleware(license.FeatureDockerBackup, logger))
 	dockerBackupDiscoveryConfig := docker.DefaultDiscoveryConfig()
 	dockerBackupDiscoveryService := docker.NewDiscoveryService(database, dockerBackupDiscoveryConfig, logger)
+	if dockerEngine := docker.DefaultEngineClient(logger); dockerEngine != nil {
+		dockerBackupDiscoveryService.SetDockerClient(dockerEngine)
+	}
 	dockerBackupHandler := handlers.NewDockerBackupHandler(database, dockerBackupDiscoveryService, featureChecker, logger)
 	dockerBackupHandler.RegisterRoutes(dockerBackupGroup)
 
@@ -506,6 +628,12 @@ func NewRouter(
 	geoReplicationHandler := handlers.NewGeoReplicationHandler(database, featureChecker, logger)
 	geoReplicationHandler.RegisterRoutes(geoReplicationGroup)
 
+	// 3-2-1 backup compliance routes
+	if cfg.ComplianceEvaluator != nil {
+		backupComplianceHandler := handlers.NewBackupComplianceHandler(cfg.ComplianceEvaluator, logger)
+		backupComplianceHandler.RegisterRoutes(apiV1)
+	}
+
 	// Classification routes
 	classificationsHandler := handlers.NewClassificationsHandler(database, logger)
 	classificationsHandler.RegisterRoutes(apiV1)
@@ -571,6 +699,12 @@ func NewRouter(
 	superuserHandler := handlers.NewSuperuserHandler(database, sessions, logger)
 	superuserHandler.RegisterRoutes(apiV1)
 
+	// MFA enrollment and step-up routes
+	if mfaVerifier != nil {
+		mfaHandler := handlers.NewMFAHandler(database, mfaVerifier, sessions, logger)
+		mfaHandler.RegisterRoutes(apiV1)
+	}
+
 	// Telemetry routes (opt-in anonymous usage telemetry)
 	telemetryHandler := handlers.NewTelemetryHandler(database, cfg.TelemetryService, logger)
 	telemetryHandler.RegisterRoutes(apiV1)
@@ -602,6 +736,27 @@ func NewRouter(
 	proxmoxHandler := handlers.NewProxmoxHandler(database, keyManager, logger)
 	proxmoxHandler.RegisterRoutes(apiV1)
 
+	// Proxmox Backup Server routes
+	pbsHandler := handlers.NewPBSHandler(database, keyManager, logger)
+	pbsHandler.SetApprovalGate(approvalService)
+	pbsHandler.RegisterRoutes(apiV1)
+
+	// Proxmox VM restores
+	if cfg.ProxmoxRestorer != nil {
+		proxmoxRestoreHandler := handlers.NewProxmoxRestoreHandler(database, cfg.ProxmoxRestorer, logger)
+		proxmoxRestoreHandler.RegisterRoutes(apiV1)
+	}
+
+	// libvirt/KVM discovery and restores, run by the agent on the KVM host
+	libvirtHandler := handlers.NewLibvirtHandler(database, logger)
+	libvirtHandler.RegisterRoutes(apiV1)
+
+	// PostgreSQL and MySQL restores
+	if cfg.DatabaseRestorer != nil {
+		databaseRestoreHandler := handlers.NewDatabaseRestoreHandler(database, cfg.DatabaseRestorer, logger)
+		databaseRestoreHandler.RegisterRoutes(apiV1)
+	}
+
 	// Activity feed routes
 	if cfg.ActivityFeed != nil {
 		activityHandler := handlers.NewActivityHandler(database, cfg.ActivityFeed, logger)
@@ -625,6 +780,8 @@ func NewRouter(
 
 	// Immutability (snapshot lock) routes
 	immutabilityHandler := handlers.NewImmutabilityHandler(database, logger)
+	immutabilityHandler.SetApprovalGate(approvalService)
+	immutabilityHandler.SetObjectLockers(cfg.ObjectLockers)
 	immutabilityHandler.RegisterRoutes(apiV1)
 
 	// Metadata schema routes
@@ -678,6 +835,9 @@ func NewRouter(
 	agentAPIHandler := handlers.NewAgentAPIHandler(database, keyManager, logger)
 	agentAPIHandler.RegisterRoutes(agentAPI)
 
+	// Container reports from agent Docker event watchers (Pro+)
+	dockerBackupHandler.RegisterAgentRoutes(agentAPI.Group("", middleware.FeatureMiddleware(license.FeatureDockerBackup, logger)))
+
 	// Serve React SPA static files
 	if cfg.WebDir != "" {
 		indexPath := filepath.Join(cfg.WebDir, "index.html")
@@ -0,0 +1,311 @@
+// Package approval implements four-eyes approval for destructive operations.
+//
+// When an organization's security policy lists an action as requiring
+// approval, handlers submit an ApprovalRequest instead of executing the
+// operation. A second administrator approves the request, which runs the
+// executor registered for the action with the stored payload, or rejects it.
+// Requests that are not decided before their deadline expire.
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/MacJediWizard/keldris/internal/settings"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+var (
+	// ErrNotFound is returned when a request does not exist in the organization.
+	ErrNotFound = errors.New("approval request not found")
+	// ErrNotPending is returned when deciding a request that was already decided.
+	ErrNotPending = errors.New("approval request is no longer pending")
+	// ErrExpired is returned when deciding a request past its deadline.
+	ErrExpired = errors.New("approval request has expired")
+	// ErrSelfApproval is returned when the requester tries to approve their own request.
+	ErrSelfApproval = errors.New("approval must come from a different administrator")
+	// ErrNotRequester is returned when someone other than the requester cancels a request.
+	ErrNotRequester = errors.New("only the requester can cancel an approval request")
+	// ErrNoExecutor is returned when no executor is registered for the action.
+	ErrNoExecutor = errors.New("no executor registered for approval action")
+	// ErrPendingConflict is returned when a request with a different payload is
+	// already pending for the same action and resource.
+	ErrPendingConflict = errors.New("a different approval request is already pending for this resource")
+)
+
+// Store defines the persistence operations needed by the approval service.
+type Store interface {
+	CreateApprovalRequest(ctx context.Context, r *models.ApprovalRequest) error
+	GetApprovalRequestByID(ctx context.Context, id uuid.UUID) (*models.ApprovalRequest, error)
+	GetPendingApprovalRequest(ctx context.Context, orgID uuid.UUID, action models.ApprovalAction, resourceID string) (*models.ApprovalRequest, error)
+	GetApprovalRequestsByOrgID(ctx context.Context, orgID uuid.UUID, status models.ApprovalStatus) ([]*models.ApprovalRequest, error)
+	DecideApprovalRequest(ctx context.Context, r *models.ApprovalRequest) (bool, error)
+	UpdateApprovalRequestResult(ctx context.Context, r *models.ApprovalRequest) error
+	ExpireApprovalRequests(ctx context.Context, now time.Time) (int, error)
+	GetSecuritySettings(ctx context.Context, orgID uuid.UUID) (*settings.SecuritySettings, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+}
+
+// Notifier sends approval notifications to approvers.
+type Notifier interface {
+	NotifyApprovalRequested(ctx context.Context, req *models.ApprovalRequest, requestedBy string)
+}
+
+// Executor performs an approved operation using the request payload.
+type Executor func(ctx context.Context, req *models.ApprovalRequest) error
+
+// Service manages the approval request lifecycle.
+type Service struct {
+	store     Store
+	notifier  Notifier
+	executors map[models.ApprovalAction]Executor
+	mu        sync.RWMutex
+	now       func() time.Time
+	logger    zerolog.Logger
+}
+
+// NewService creates a new approval service. notifier may be nil.
+func NewService(store Store, notifier Notifier, logger zerolog.Logger) *Service {
+	return &Service{
+		store:     store,
+		notifier:  notifier,
+		executors: make(map[models.ApprovalAction]Executor),
+		now:       time.Now,
+		logger:    logger.With().Str("component", "approval_service").Logger(),
+	}
+}
+
+// Register sets the executor run when a request for action is approved.
+func (s *Service) Register(action models.ApprovalAction, exec Executor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.executors[action] = exec
+}
+
+func (s *Service) executor(action models.ApprovalAction) (Executor, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	exec, ok := s.executors[action]
+	return exec, ok
+}
+
+// Required reports whether the organization's policy requires approval for action.
+func (s *Service) Required(ctx context.Context, orgID uuid.UUID, action models.ApprovalAction) (bool, error) {
+	security, err := s.store.GetSecuritySettings(ctx, orgID)
+	if err != nil {
+		return false, fmt.Errorf("get security settings: %w", err)
+	}
+	return security.RequiresApproval(string(action)), nil
+}
+
+// Submit records a pending approval request and notifies approvers. If an
+// open request already exists for the same action and resource it is
+// returned instead of creating a duplicate; if that request carries a
+// different payload, it is returned with ErrPendingConflict so the new
+// operation is not silently dropped.
+func (s *Service) Submit(ctx context.Context, req *models.ApprovalRequest) (*models.ApprovalRequest, error) {
+	if _, ok := s.executor(req.Action); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoExecutor, req.Action)
+	}
+
+	existing, err := s.store.GetPendingApprovalRequest(ctx, req.OrgID, req.Action, req.ResourceID)
+	if err != nil {
+		return nil, fmt.Errorf("check pending approval requests: %w", err)
+	}
+	if existing != nil && !existing.IsExpired(s.now()) {
+		if !samePayload(existing.Payload, req.Payload) {
+			return existing, ErrPendingConflict
+		}
+		return existing, nil
+	}
+	if existing != nil {
+		if _, err := s.store.ExpireApprovalRequests(ctx, s.now()); err != nil {
+			return nil, fmt.Errorf("expire approval requests: %w", err)
+		}
+	}
+
+	security, err := s.store.GetSecuritySettings(ctx, req.OrgID)
+	if err != nil {
+		return nil, fmt.Errorf("get security settings: %w", err)
+	}
+	req.Status = models.ApprovalStatusPending
+	req.ExpiresAt = req.CreatedAt.Add(security.ApprovalExpiry())
+
+	if err := s.store.CreateApprovalRequest(ctx, req); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, req, req.RequestedBy, models.AuditActionCreate, models.AuditResultSuccess,
+		fmt.Sprintf("Approval requested: %s", req.Summary))
+
+	s.logger.Info().
+		Str("approval_request_id", req.ID.String()).
+		Str("action", string(req.Action)).
+		Str("resource_id", req.ResourceID).
+		Str("requested_by", req.RequestedBy.String()).
+		Msg("approval requested")
+
+	if s.notifier != nil {
+		requestedBy := req.RequestedBy.String()
+		if user, err := s.store.GetUserByID(ctx, req.RequestedBy); err == nil {
+			requestedBy = user.Email
+		}
+		s.notifier.NotifyApprovalRequested(ctx, req, requestedBy)
+	}
+
+	return req, nil
+}
+
+// Get returns a request in the organization, marking it expired if its
+// deadline has passed.
+func (s *Service) Get(ctx context.Context, orgID, id uuid.UUID) (*models.ApprovalRequest, error) {
+	req, err := s.store.GetApprovalRequestByID(ctx, id)
+	if err != nil || req.OrgID != orgID {
+		return nil, ErrNotFound
+	}
+	if req.IsExpired(s.now()) {
+		req.Status = models.ApprovalStatusExpired
+	}
+	return req, nil
+}
+
+// List returns the organization's requests after expiring stale ones.
+func (s *Service) List(ctx context.Context, orgID uuid.UUID, status models.ApprovalStatus) ([]*models.ApprovalRequest, error) {
+	if _, err := s.store.ExpireApprovalRequests(ctx, s.now()); err != nil {
+		s.logger.Warn().Err(err).Msg("failed to expire approval requests")
+	}
+	return s.store.GetApprovalRequestsByOrgID(ctx, orgID, status)
+}
+
+// Approve records approverID's approval and executes the operation. The
+// returned request reflects the execution outcome; an execution failure is
+// recorded on the request rather than returned as an error.
+func (s *Service) Approve(ctx context.Context, orgID, id, approverID uuid.UUID, comment string) (*models.ApprovalRequest, error) {
+	req, err := s.decide(ctx, orgID, id, approverID, models.ApprovalStatusApproved, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	exec, ok := s.executor(req.Action)
+	if !ok {
+		err = fmt.Errorf("%w: %s", ErrNoExecutor, req.Action)
+	} else {
+		err = exec(ctx, req)
+	}
+
+	if err != nil {
+		req.Status = models.ApprovalStatusFailed
+		req.ErrorMessage = err.Error()
+		s.logger.Error().Err(err).
+			Str("approval_request_id", req.ID.String()).
+			Str("action", string(req.Action)).
+			Msg("approved operation failed")
+	} else {
+		req.Status = models.ApprovalStatusExecuted
+	}
+	if err := s.store.UpdateApprovalRequestResult(ctx, req); err != nil {
+		s.logger.Error().Err(err).Str("approval_request_id", req.ID.String()).Msg("failed to record approval result")
+	}
+
+	result := models.AuditResultSuccess
+	details := fmt.Sprintf("Approved and executed: %s", req.Summary)
+	if req.Status == models.ApprovalStatusFailed {
+		result = models.AuditResultFailure
+		details = fmt.Sprintf("Approved but failed: %s: %s", req.Summary, req.ErrorMessage)
+	}
+	s.audit(ctx, req, approverID, models.AuditActionUpdate, result, details)
+
+	return req, nil
+}
+
+// Reject records approverID's rejection of a pending request.
+func (s *Service) Reject(ctx context.Context, orgID, id, approverID uuid.UUID, comment string) (*models.ApprovalRequest, error) {
+	req, err := s.decide(ctx, orgID, id, approverID, models.ApprovalStatusRejected, comment)
+	if err != nil {
+		return nil, err
+	}
+	s.audit(ctx, req, approverID, models.AuditActionUpdate, models.AuditResultDenied,
+		fmt.Sprintf("Approval rejected: %s", req.Summary))
+	return req, nil
+}
+
+// Cancel withdraws a pending request. Only the requester may cancel.
+func (s *Service) Cancel(ctx context.Context, orgID, id, userID uuid.UUID) (*models.ApprovalRequest, error) {
+	req, err := s.decide(ctx, orgID, id, userID, models.ApprovalStatusCancelled, "")
+	if err != nil {
+		return nil, err
+	}
+	s.audit(ctx, req, userID, models.AuditActionUpdate, models.AuditResultSuccess,
+		fmt.Sprintf("Approval request cancelled: %s", req.Summary))
+	return req, nil
+}
+
+// decide validates and atomically records a decision on a pending request.
+func (s *Service) decide(ctx context.Context, orgID, id, userID uuid.UUID, status models.ApprovalStatus, comment string) (*models.ApprovalRequest, error) {
+	req, err := s.store.GetApprovalRequestByID(ctx, id)
+	if err != nil || req.OrgID != orgID {
+		return nil, ErrNotFound
+	}
+	if !req.IsPending() {
+		return nil, ErrNotPending
+	}
+	if req.IsExpired(s.now()) {
+		if _, err := s.store.ExpireApprovalRequests(ctx, s.now()); err != nil {
+			s.logger.Warn().Err(err).Msg("failed to expire approval requests")
+		}
+		return nil, ErrExpired
+	}
+
+	switch status {
+	case models.ApprovalStatusCancelled:
+		if req.RequestedBy != userID {
+			return nil, ErrNotRequester
+		}
+	default:
+		if req.RequestedBy == userID {
+			return nil, ErrSelfApproval
+		}
+	}
+
+	req.Decide(status, userID, comment)
+	ok, err := s.store.DecideApprovalRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotPending
+	}
+	return req, nil
+}
+
+// audit records an audit log entry linked to the approval request.
+func (s *Service) audit(ctx context.Context, req *models.ApprovalRequest, userID uuid.UUID, action models.AuditAction, result models.AuditResult, details string) {
+	auditLog := models.NewAuditLog(req.OrgID, action, "approval_request", result).
+		WithUser(userID).
+		WithResource(req.ID).
+		WithDetails(details)
+	if err := s.store.CreateAuditLog(ctx, auditLog); err != nil {
+		s.logger.Warn().Err(err).Str("approval_request_id", req.ID.String()).Msg("failed to create audit log")
+	}
+}
+
+// samePayload reports whether two request payloads hold the same JSON value.
+// Payloads are compared decoded because the database may reorder keys.
+func samePayload(a, b json.RawMessage) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	var av, bv interface{}
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
@@ -0,0 +1,307 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/MacJediWizard/keldris/internal/settings"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockStore struct {
+	requests  map[uuid.UUID]*models.ApprovalRequest
+	security  settings.SecuritySettings
+	auditLogs []*models.AuditLog
+}
+
+func newMockStore() *mockStore {
+	return &mockStore{
+		requests: make(map[uuid.UUID]*models.ApprovalRequest),
+		security: settings.DefaultSecuritySettings(),
+	}
+}
+
+func (m *mockStore) CreateApprovalRequest(_ context.Context, r *models.ApprovalRequest) error {
+	copied := *r
+	m.requests[r.ID] = &copied
+	return nil
+}
+
+func (m *mockStore) GetApprovalRequestByID(_ context.Context, id uuid.UUID) (*models.ApprovalRequest, error) {
+	r, ok := m.requests[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	copied := *r
+	return &copied, nil
+}
+
+func (m *mockStore) GetPendingApprovalRequest(_ context.Context, orgID uuid.UUID, action models.ApprovalAction, resourceID string) (*models.ApprovalRequest, error) {
+	for _, r := range m.requests {
+		if r.OrgID == orgID && r.Action == action && r.ResourceID == resourceID && r.IsPending() {
+			copied := *r
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockStore) GetApprovalRequestsByOrgID(_ context.Context, orgID uuid.UUID, status models.ApprovalStatus) ([]*models.ApprovalRequest, error) {
+	var out []*models.ApprovalRequest
+	for _, r := range m.requests {
+		if r.OrgID == orgID && (status == "" || r.Status == status) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockStore) DecideApprovalRequest(_ context.Context, r *models.ApprovalRequest) (bool, error) {
+	stored := m.requests[r.ID]
+	if stored == nil || !stored.IsPending() {
+		return false, nil
+	}
+	copied := *r
+	m.requests[r.ID] = &copied
+	return true, nil
+}
+
+func (m *mockStore) UpdateApprovalRequestResult(_ context.Context, r *models.ApprovalRequest) error {
+	m.requests[r.ID].Status = r.Status
+	m.requests[r.ID].ErrorMessage = r.ErrorMessage
+	return nil
+}
+
+func (m *mockStore) ExpireApprovalRequests(_ context.Context, now time.Time) (int, error) {
+	n := 0
+	for _, r := range m.requests {
+		if r.IsExpired(now) {
+			r.Status = models.ApprovalStatusExpired
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *mockStore) GetSecuritySettings(_ context.Context, _ uuid.UUID) (*settings.SecuritySettings, error) {
+	s := m.security
+	return &s, nil
+}
+
+func (m *mockStore) GetUserByID(_ context.Context, id uuid.UUID) (*models.User, error) {
+	return &models.User{ID: id, Email: "requester@example.com"}, nil
+}
+
+func (m *mockStore) CreateAuditLog(_ context.Context, log *models.AuditLog) error {
+	m.auditLogs = append(m.auditLogs, log)
+	return nil
+}
+
+type mockNotifier struct {
+	notified []*models.ApprovalRequest
+}
+
+func (n *mockNotifier) NotifyApprovalRequested(_ context.Context, req *models.ApprovalRequest, _ string) {
+	n.notified = append(n.notified, req)
+}
+
+func newTestService(t *testing.T) (*Service, *mockStore, *mockNotifier, *int) {
+	t.Helper()
+	store := newMockStore()
+	store.security.ApprovalRequiredActions = []string{string(models.ApprovalActionRepositoryDelete)}
+	notifier := &mockNotifier{}
+	svc := NewService(store, notifier, zerolog.Nop())
+
+	executed := 0
+	svc.Register(models.ApprovalActionRepositoryDelete, func(_ context.Context, _ *models.ApprovalRequest) error {
+		executed++
+		return nil
+	})
+	return svc, store, notifier, &executed
+}
+
+func submitTestRequest(t *testing.T, svc *Service, orgID, requester uuid.UUID) *models.ApprovalRequest {
+	t.Helper()
+	req := models.NewApprovalRequest(orgID, requester, models.ApprovalActionRepositoryDelete, "repository", uuid.New().String(), "Delete repository prod")
+	submitted, err := svc.Submit(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Submit() error: %v", err)
+	}
+	return submitted
+}
+
+func TestService_Required(t *testing.T) {
+	svc, _, _, _ := newTestService(t)
+	orgID := uuid.New()
+
+	required, err := svc.Required(context.Background(), orgID, models.ApprovalActionRepositoryDelete)
+	if err != nil || !required {
+		t.Errorf("expected repository deletion to require approval, got %v, %v", required, err)
+	}
+	required, err = svc.Required(context.Background(), orgID, models.ApprovalActionLegalHoldRemove)
+	if err != nil || required {
+		t.Errorf("expected legal hold removal not to require approval, got %v, %v", required, err)
+	}
+}
+
+func TestService_SubmitAndApprove(t *testing.T) {
+	svc, store, notifier, executed := newTestService(t)
+	orgID, requester, approver := uuid.New(), uuid.New(), uuid.New()
+
+	req := submitTestRequest(t, svc, orgID, requester)
+	if req.Status != models.ApprovalStatusPending {
+		t.Fatalf("status = %s, want pending", req.Status)
+	}
+	if want := req.CreatedAt.Add(settings.DefaultApprovalExpiryHours * time.Hour); !req.ExpiresAt.Equal(want) {
+		t.Errorf("expires_at = %v, want %v", req.ExpiresAt, want)
+	}
+	if len(notifier.notified) != 1 {
+		t.Errorf("expected approvers to be notified once, got %d", len(notifier.notified))
+	}
+
+	t.Run("resubmit returns open request", func(t *testing.T) {
+		dup := models.NewApprovalRequest(orgID, requester, req.Action, req.ResourceType, req.ResourceID, req.Summary)
+		got, err := svc.Submit(context.Background(), dup)
+		if err != nil {
+			t.Fatalf("Submit() error: %v", err)
+		}
+		if got.ID != req.ID {
+			t.Errorf("expected existing request %s, got %s", req.ID, got.ID)
+		}
+	})
+
+	t.Run("resubmit with a different payload conflicts", func(t *testing.T) {
+		dup := models.NewApprovalRequest(orgID, requester, req.Action, req.ResourceType, req.ResourceID, req.Summary)
+		if err := dup.SetPayload(map[string]int{"keep_last": 1}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := svc.Submit(context.Background(), dup)
+		if !errors.Is(err, ErrPendingConflict) {
+			t.Fatalf("expected ErrPendingConflict, got %v", err)
+		}
+		if got == nil || got.ID != req.ID {
+			t.Errorf("expected the pending request to be returned, got %+v", got)
+		}
+	})
+
+	t.Run("requester cannot approve", func(t *testing.T) {
+		if _, err := svc.Approve(context.Background(), orgID, req.ID, requester, ""); !errors.Is(err, ErrSelfApproval) {
+			t.Errorf("expected ErrSelfApproval, got %v", err)
+		}
+	})
+
+	t.Run("other org cannot see request", func(t *testing.T) {
+		if _, err := svc.Approve(context.Background(), uuid.New(), req.ID, approver, ""); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	approved, err := svc.Approve(context.Background(), orgID, req.ID, approver, "looks right")
+	if err != nil {
+		t.Fatalf("Approve() error: %v", err)
+	}
+	if approved.Status != models.ApprovalStatusExecuted {
+		t.Errorf("status = %s, want executed", approved.Status)
+	}
+	if *executed != 1 {
+		t.Errorf("expected executor to run once, ran %d times", *executed)
+	}
+	if store.requests[req.ID].Status != models.ApprovalStatusExecuted {
+		t.Errorf("stored status = %s, want executed", store.requests[req.ID].Status)
+	}
+
+	t.Run("cannot approve twice", func(t *testing.T) {
+		if _, err := svc.Approve(context.Background(), orgID, req.ID, uuid.New(), ""); !errors.Is(err, ErrNotPending) {
+			t.Errorf("expected ErrNotPending, got %v", err)
+		}
+		if *executed != 1 {
+			t.Errorf("executor ran again")
+		}
+	})
+
+	for _, log := range store.auditLogs {
+		if log.ResourceType != "approval_request" || log.ResourceID == nil || *log.ResourceID != req.ID {
+			t.Errorf("audit log not linked to approval request: %+v", log)
+		}
+	}
+}
+
+func TestService_ApproveRecordsExecutionFailure(t *testing.T) {
+	svc, store, _, _ := newTestService(t)
+	svc.Register(models.ApprovalActionRepositoryDelete, func(_ context.Context, _ *models.ApprovalRequest) error {
+		return errors.New("repository not found")
+	})
+	orgID := uuid.New()
+	req := submitTestRequest(t, svc, orgID, uuid.New())
+
+	got, err := svc.Approve(context.Background(), orgID, req.ID, uuid.New(), "")
+	if err != nil {
+		t.Fatalf("Approve() error: %v", err)
+	}
+	if got.Status != models.ApprovalStatusFailed || got.ErrorMessage == "" {
+		t.Errorf("expected failed status with error, got %s %q", got.Status, got.ErrorMessage)
+	}
+	if store.requests[req.ID].Status != models.ApprovalStatusFailed {
+		t.Errorf("stored status = %s, want failed", store.requests[req.ID].Status)
+	}
+}
+
+func TestService_Expiry(t *testing.T) {
+	svc, _, _, executed := newTestService(t)
+	orgID := uuid.New()
+	req := submitTestRequest(t, svc, orgID, uuid.New())
+
+	svc.now = func() time.Time { return req.ExpiresAt.Add(time.Minute) }
+	if _, err := svc.Approve(context.Background(), orgID, req.ID, uuid.New(), ""); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+	if *executed != 0 {
+		t.Error("expired request must not execute")
+	}
+
+	got, err := svc.Get(context.Background(), orgID, req.ID)
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if got.Status != models.ApprovalStatusExpired {
+		t.Errorf("status = %s, want expired", got.Status)
+	}
+}
+
+func TestService_RejectAndCancel(t *testing.T) {
+	svc, _, _, executed := newTestService(t)
+	orgID, requester := uuid.New(), uuid.New()
+
+	rejected := submitTestRequest(t, svc, orgID, requester)
+	got, err := svc.Reject(context.Background(), orgID, rejected.ID, uuid.New(), "not during business hours")
+	if err != nil {
+		t.Fatalf("Reject() error: %v", err)
+	}
+	if got.Status != models.ApprovalStatusRejected || got.DecisionComment == "" {
+		t.Errorf("unexpected rejected request: %+v", got)
+	}
+
+	cancelled := submitTestRequest(t, svc, orgID, requester)
+	if _, err := svc.Cancel(context.Background(), orgID, cancelled.ID, uuid.New()); !errors.Is(err, ErrNotRequester) {
+		t.Errorf("expected ErrNotRequester, got %v", err)
+	}
+	if _, err := svc.Cancel(context.Background(), orgID, cancelled.ID, requester); err != nil {
+		t.Errorf("Cancel() error: %v", err)
+	}
+
+	if *executed != 0 {
+		t.Error("rejected or cancelled requests must not execute")
+	}
+}
+
+func TestService_SubmitWithoutExecutor(t *testing.T) {
+	svc := NewService(newMockStore(), nil, zerolog.Nop())
+	req := models.NewApprovalRequest(uuid.New(), uuid.New(), models.ApprovalActionLegalHoldRemove, "legal_hold", "abc123", "Remove hold")
+	if _, err := svc.Submit(context.Background(), req); !errors.Is(err, ErrNoExecutor) {
+		t.Errorf("expected ErrNoExecutor, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errCBORTruncated is returned when CBOR input ends before a value is complete.
+var errCBORTruncated = errors.New("cbor: unexpected end of input")
+
+// cborMaxDepth bounds nesting so malformed input cannot exhaust the stack.
+const cborMaxDepth = 16
+
+// decodeCBOR decodes a single CBOR data item and returns it together with the
+// remaining input. It supports the subset of RFC 8949 used by WebAuthn
+// attestation objects and COSE keys: integers, byte and text strings, arrays,
+// maps and the simple values false, true and null. Integers decode to int64,
+// maps to map[interface{}]interface{}.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, errors.New("cbor: nesting too deep")
+	}
+	if len(data) == 0 {
+		return nil, nil, errCBORTruncated
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		default:
+			return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+		}
+	}
+
+	arg, data, err := readCBORArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, nil, errors.New("cbor: integer overflow")
+		}
+		return int64(arg), data, nil
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, nil, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(arg), data, nil
+	case 2, 3:
+		if uint64(len(data)) < arg {
+			return nil, nil, errCBORTruncated
+		}
+		b := make([]byte, arg)
+		copy(b, data[:arg])
+		if major == 3 {
+			return string(b), data[arg:], nil
+		}
+		return b, data[arg:], nil
+	case 4:
+		if arg > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			item, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+	case 5:
+		if arg > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value interface{}
+			key, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errors.New("cbor: unsupported map key type")
+			}
+			value, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[key] = value
+		}
+		return m, data, nil
+	default:
+		return nil, nil, fmt.Errorf("cbor: unsupported major type %d", major)
+	}
+}
+
+// readCBORArgument reads the argument that follows the initial byte.
+func readCBORArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		if len(data) < 1 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(data[0]), data[1:], nil
+	case info == 25:
+		if len(data) < 2 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26:
+		if len(data) < 4 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27:
+		if len(data) < 8 {
+			return 0, nil, errCBORTruncated
+		}
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	default:
+		return 0, nil, errors.New("cbor: indefinite-length items are not supported")
+	}
+}
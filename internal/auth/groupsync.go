@@ -90,6 +90,26 @@ func (gs *GroupSync) ExtractGroupsFromToken(ctx context.Context, oidc *OIDC, tok
 	return []string{}, nil
 }
 
+// ExtractGroupsFromSAML returns the groups asserted in a SAML assertion. If
+// attribute is empty, the attribute names commonly used by IdPs are tried.
+func (gs *GroupSync) ExtractGroupsFromSAML(assertion *SAMLAssertion, attribute string) []string {
+	attributeNames := []string{attribute}
+	if attribute == "" {
+		attributeNames = []string{
+			"groups",   // Common (Okta, Keycloak, Google)
+			"memberOf", // LDAP-style
+			"Role",     // Some IdPs use roles
+			"http://schemas.microsoft.com/ws/2008/06/identity/claims/groups", // ADFS, Entra ID
+			"http://schemas.microsoft.com/ws/2008/06/identity/claims/role",   // ADFS
+			"urn:oid:1.3.6.1.4.1.5923.1.5.1.1",                               // eduPerson isMemberOf
+		}
+	}
+
+	groups := assertion.Attribute(attributeNames...)
+	gs.logger.Debug().Strs("groups", groups).Msg("extracted groups from SAML assertion")
+	return groups
+}
+
 // extractStringSlice converts various possible claim formats to a string slice.
 func extractStringSlice(claim interface{}) []string {
 	switch v := claim.(type) {
@@ -114,6 +134,18 @@ func extractStringSlice(claim interface{}) []string {
 // SyncUserGroups syncs a user's OIDC groups to Keldris memberships.
 // This should be called during login after extracting groups from the token.
 func (gs *GroupSync) SyncUserGroups(ctx context.Context, userID uuid.UUID, groups []string) (*models.GroupSyncResult, error) {
+	return gs.syncGroups(ctx, userID, groups, uuid.Nil)
+}
+
+// SyncUserGroupsForOrg syncs groups asserted by an organization's own identity
+// provider, such as its SAML IdP. Only that organization's mappings are
+// applied, so one tenant's IdP cannot grant access to another tenant.
+func (gs *GroupSync) SyncUserGroupsForOrg(ctx context.Context, userID, orgID uuid.UUID, groups []string) (*models.GroupSyncResult, error) {
+	return gs.syncGroups(ctx, userID, groups, orgID)
+}
+
+// syncGroups applies the group mappings for groups, limited to orgID unless it is uuid.Nil.
+func (gs *GroupSync) syncGroups(ctx context.Context, userID uuid.UUID, groups []string, orgID uuid.UUID) (*models.GroupSyncResult, error) {
 	result := &models.GroupSyncResult{
 		UserID:         userID,
 		GroupsReceived: groups,
@@ -135,6 +167,15 @@ func (gs *GroupSync) SyncUserGroups(ctx context.Context, userID uuid.UUID, group
 	if err != nil {
 		return nil, fmt.Errorf("get group mappings: %w", err)
 	}
+	if orgID != uuid.Nil {
+		scoped := mappings[:0]
+		for _, m := range mappings {
+			if m.OrgID == orgID {
+				scoped = append(scoped, m)
+			}
+		}
+		mappings = scoped
+	}
 
 	// Track which groups have mappings
 	mappedGroups := make(map[string]bool)
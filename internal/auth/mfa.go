@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+var (
+	// ErrMFAInvalid is returned when a second-factor response does not verify.
+	ErrMFAInvalid = errors.New("invalid second factor")
+	// ErrMFANotEnrolled is returned when the user has no factor for the requested method.
+	ErrMFANotEnrolled = errors.New("second factor not enrolled")
+	// ErrMFAUnsupportedMethod is returned for unknown verification methods.
+	ErrMFAUnsupportedMethod = errors.New("unsupported MFA method")
+)
+
+// MFAStore defines the persistence needed to verify second factors.
+type MFAStore interface {
+	GetMFAFactorsByUserID(ctx context.Context, userID uuid.UUID) ([]*models.UserMFAFactor, error)
+	UpdateMFAFactorUsage(ctx context.Context, id uuid.UUID, signCount uint32) error
+	ConsumeMFARecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
+	RecordMFALoginFailure(ctx context.Context, userID uuid.UUID, maxAttempts int, lockout time.Duration) (bool, error)
+	GetMFALoginLockedUntil(ctx context.Context, userID uuid.UUID) (*time.Time, error)
+	ResetMFALoginFailures(ctx context.Context, userID uuid.UUID) error
+}
+
+const (
+	// MaxMFALoginAttempts is the number of wrong second factors allowed before
+	// a user's MFA logins are locked.
+	MaxMFALoginAttempts = 5
+	// MFALoginLockout is how long MFA logins stay locked after too many failures.
+	MFALoginLockout = 15 * time.Minute
+)
+
+// SecretCipher encrypts TOTP secrets at rest. It is satisfied by crypto.KeyManager.
+type SecretCipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// MFAVerifier verifies TOTP codes, WebAuthn assertions and recovery codes for
+// local user accounts. It is shared by the login flow and step-up checks.
+type MFAVerifier struct {
+	store    MFAStore
+	cipher   SecretCipher
+	webauthn WebAuthnConfig
+	now      func() time.Time
+	logger   zerolog.Logger
+}
+
+// NewMFAVerifier creates a new MFAVerifier.
+func NewMFAVerifier(store MFAStore, cipher SecretCipher, webauthn WebAuthnConfig, logger zerolog.Logger) *MFAVerifier {
+	return &MFAVerifier{
+		store:    store,
+		cipher:   cipher,
+		webauthn: webauthn,
+		now:      time.Now,
+		logger:   logger.With().Str("component", "mfa").Logger(),
+	}
+}
+
+// WebAuthn returns the relying party configuration.
+func (v *MFAVerifier) WebAuthn() WebAuthnConfig {
+	return v.webauthn
+}
+
+// EncryptSecret encrypts a TOTP secret for storage.
+func (v *MFAVerifier) EncryptSecret(secret string) ([]byte, error) {
+	return v.cipher.Encrypt([]byte(secret))
+}
+
+// DecryptSecret decrypts a stored TOTP secret.
+func (v *MFAVerifier) DecryptSecret(encrypted []byte) (string, error) {
+	plain, err := v.cipher.Decrypt(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("decrypt totp secret: %w", err)
+	}
+	return string(plain), nil
+}
+
+// ConfirmedFactors returns the user's factors that have completed enrollment.
+func (v *MFAVerifier) ConfirmedFactors(ctx context.Context, userID uuid.UUID) ([]*models.UserMFAFactor, error) {
+	factors, err := v.store.GetMFAFactorsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var confirmed []*models.UserMFAFactor
+	for _, f := range factors {
+		if f.IsConfirmed() {
+			confirmed = append(confirmed, f)
+		}
+	}
+	return confirmed, nil
+}
+
+// MFAMethods returns the verification methods available for a set of confirmed factors.
+func MFAMethods(factors []*models.UserMFAFactor) []string {
+	var hasTOTP, hasWebAuthn bool
+	for _, f := range factors {
+		switch f.Type {
+		case models.MFAFactorTOTP:
+			hasTOTP = true
+		case models.MFAFactorWebAuthn:
+			hasWebAuthn = true
+		}
+	}
+	var methods []string
+	if hasWebAuthn {
+		methods = append(methods, models.MFAMethodWebAuthn)
+	}
+	if hasTOTP {
+		methods = append(methods, models.MFAMethodTOTP)
+	}
+	if len(methods) > 0 {
+		methods = append(methods, models.MFAMethodRecoveryCode)
+	}
+	return methods
+}
+
+// WebAuthnCredentialIDs returns the credential IDs of a user's WebAuthn factors.
+func WebAuthnCredentialIDs(factors []*models.UserMFAFactor) [][]byte {
+	var ids [][]byte
+	for _, f := range factors {
+		if f.Type == models.MFAFactorWebAuthn {
+			ids = append(ids, f.CredentialID)
+		}
+	}
+	return ids
+}
+
+// LoginLocked reports whether too many wrong second factors have locked the
+// user's MFA logins.
+func (v *MFAVerifier) LoginLocked(ctx context.Context, userID uuid.UUID) (bool, error) {
+	lockedUntil, err := v.store.GetMFALoginLockedUntil(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return lockedUntil != nil && v.now().Before(*lockedUntil), nil
+}
+
+// RecordLoginFailure counts a wrong second factor for a pending login.
+// Returns true once the failure locks the user's MFA logins.
+func (v *MFAVerifier) RecordLoginFailure(ctx context.Context, userID uuid.UUID) (bool, error) {
+	return v.store.RecordMFALoginFailure(ctx, userID, MaxMFALoginAttempts, MFALoginLockout)
+}
+
+// ResetLoginFailures clears the user's failed second-factor count.
+func (v *MFAVerifier) ResetLoginFailures(ctx context.Context, userID uuid.UUID) error {
+	return v.store.ResetMFALoginFailures(ctx, userID)
+}
+
+// Verify checks a second-factor response against the user's confirmed factors.
+// The challenge is required for WebAuthn and ignored otherwise.
+func (v *MFAVerifier) Verify(ctx context.Context, userID uuid.UUID, req *models.MFAVerifyRequest, challenge []byte) error {
+	switch req.Method {
+	case models.MFAMethodTOTP, models.MFAMethodWebAuthn:
+	case models.MFAMethodRecoveryCode:
+		return v.VerifyRecoveryCode(ctx, userID, req.Code)
+	default:
+		return ErrMFAUnsupportedMethod
+	}
+
+	factors, err := v.ConfirmedFactors(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if req.Method == models.MFAMethodTOTP {
+		return v.VerifyTOTP(ctx, factors, req.Code)
+	}
+	if req.WebAuthn == nil {
+		return ErrMFAInvalid
+	}
+	return v.VerifyWebAuthn(ctx, factors, challenge, req.WebAuthn)
+}
+
+// VerifyTOTP checks a code against each of the user's TOTP factors.
+// A code from a time step at or before the factor's last use is rejected as a replay.
+func (v *MFAVerifier) VerifyTOTP(ctx context.Context, factors []*models.UserMFAFactor, code string) error {
+	enrolled := false
+	now := v.now()
+	for _, f := range factors {
+		if f.Type != models.MFAFactorTOTP {
+			continue
+		}
+		enrolled = true
+
+		secret, err := v.DecryptSecret(f.SecretEncrypted)
+		if err != nil {
+			v.logger.Error().Err(err).Str("factor_id", f.ID.String()).Msg("failed to decrypt totp secret")
+			continue
+		}
+		step, ok := MatchTOTPCode(secret, code, now)
+		if !ok {
+			continue
+		}
+		if f.LastUsedAt != nil && step <= TOTPStep(*f.LastUsedAt) {
+			v.logger.Warn().Str("factor_id", f.ID.String()).Msg("rejected replayed totp code")
+			return ErrMFAInvalid
+		}
+		if err := v.store.UpdateMFAFactorUsage(ctx, f.ID, 0); err != nil {
+			return err
+		}
+		return nil
+	}
+	if !enrolled {
+		return ErrMFANotEnrolled
+	}
+	return ErrMFAInvalid
+}
+
+// VerifyWebAuthn checks an assertion against the matching WebAuthn factor and
+// records the authenticator's new signature counter.
+func (v *MFAVerifier) VerifyWebAuthn(ctx context.Context, factors []*models.UserMFAFactor, challenge []byte, assertion *models.WebAuthnAssertion) error {
+	if len(challenge) == 0 {
+		return ErrWebAuthnChallengeMismatch
+	}
+	credID, err := DecodeWebAuthnBase64(assertion.CredentialID)
+	if err != nil {
+		return ErrMFAInvalid
+	}
+
+	var factor *models.UserMFAFactor
+	for _, f := range factors {
+		if f.Type == models.MFAFactorWebAuthn && bytes.Equal(f.CredentialID, credID) {
+			factor = f
+			break
+		}
+	}
+	if factor == nil {
+		return ErrMFANotEnrolled
+	}
+
+	clientData, err := DecodeWebAuthnBase64(assertion.ClientDataJSON)
+	if err != nil {
+		return ErrMFAInvalid
+	}
+	authData, err := DecodeWebAuthnBase64(assertion.AuthenticatorData)
+	if err != nil {
+		return ErrMFAInvalid
+	}
+	sig, err := DecodeWebAuthnBase64(assertion.Signature)
+	if err != nil {
+		return ErrMFAInvalid
+	}
+
+	cred := &WebAuthnCredential{ID: factor.CredentialID, PublicKey: factor.PublicKey, Algorithm: factor.Algorithm, SignCount: factor.SignCount}
+	signCount, err := v.webauthn.VerifyAssertion(challenge, cred, clientData, authData, sig)
+	if err != nil {
+		v.logger.Warn().Err(err).Str("factor_id", factor.ID.String()).Msg("webauthn assertion rejected")
+		return ErrMFAInvalid
+	}
+	return v.store.UpdateMFAFactorUsage(ctx, factor.ID, signCount)
+}
+
+// VerifyRecoveryCode redeems a single-use recovery code.
+func (v *MFAVerifier) VerifyRecoveryCode(ctx context.Context, userID uuid.UUID, code string) error {
+	if code == "" {
+		return ErrMFAInvalid
+	}
+	ok, err := v.store.ConsumeMFARecoveryCode(ctx, userID, HashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrMFAInvalid
+	}
+	v.logger.Info().Str("user_id", userID.String()).Msg("recovery code redeemed")
+	return nil
+}
+
+// MFAEnrollmentDeadline returns when a user must have enrolled a factor under an
+// org policy that requires MFA, counting the grace period from account creation
+// or from when the policy was enabled, whichever is later.
+func MFAEnrollmentDeadline(userCreatedAt, policySince time.Time, graceDays int) time.Time {
+	start := userCreatedAt
+	if policySince.After(start) {
+		start = policySince
+	}
+	return start.AddDate(0, 0, graceDays)
+}
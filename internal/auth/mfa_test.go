@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// mockMFAStore implements MFAStore for testing.
+type mockMFAStore struct {
+	factors       []*models.UserMFAFactor
+	recoveryCodes map[string]bool // hash -> used
+	usage         map[uuid.UUID]uint32
+}
+
+func (m *mockMFAStore) GetMFAFactorsByUserID(_ context.Context, _ uuid.UUID) ([]*models.UserMFAFactor, error) {
+	return m.factors, nil
+}
+
+func (m *mockMFAStore) UpdateMFAFactorUsage(_ context.Context, id uuid.UUID, signCount uint32) error {
+	if m.usage == nil {
+		m.usage = make(map[uuid.UUID]uint32)
+	}
+	m.usage[id] = signCount
+	now := time.Now()
+	for _, f := range m.factors {
+		if f.ID == id {
+			f.LastUsedAt = &now
+			f.SignCount = signCount
+		}
+	}
+	return nil
+}
+
+func (m *mockMFAStore) RecordMFALoginFailure(_ context.Context, _ uuid.UUID, _ int, _ time.Duration) (bool, error) {
+	return false, nil
+}
+
+func (m *mockMFAStore) GetMFALoginLockedUntil(_ context.Context, _ uuid.UUID) (*time.Time, error) {
+	return nil, nil
+}
+
+func (m *mockMFAStore) ResetMFALoginFailures(_ context.Context, _ uuid.UUID) error {
+	return nil
+}
+
+func (m *mockMFAStore) ConsumeMFARecoveryCode(_ context.Context, _ uuid.UUID, codeHash string) (bool, error) {
+	used, ok := m.recoveryCodes[codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	m.recoveryCodes[codeHash] = true
+	return true, nil
+}
+
+// plainCipher is a no-op SecretCipher for tests.
+type plainCipher struct{}
+
+func (plainCipher) Encrypt(b []byte) ([]byte, error) { return b, nil }
+func (plainCipher) Decrypt(b []byte) ([]byte, error) { return b, nil }
+
+func confirmedTOTPFactor(userID uuid.UUID, secret string) *models.UserMFAFactor {
+	f := models.NewTOTPFactor(userID, "app", []byte(secret))
+	now := time.Now().Add(-time.Hour)
+	f.ConfirmedAt = &now
+	return f
+}
+
+func TestMFAVerifier_VerifyTOTP(t *testing.T) {
+	userID := uuid.New()
+	secret, _ := GenerateTOTPSecret()
+	store := &mockMFAStore{factors: []*models.UserMFAFactor{confirmedTOTPFactor(userID, secret)}}
+	v := NewMFAVerifier(store, plainCipher{}, testWebAuthnConfig, zerolog.Nop())
+
+	code, _ := GenerateTOTPCode(secret, time.Now())
+	req := &models.MFAVerifyRequest{Method: models.MFAMethodTOTP, Code: code}
+
+	if err := v.Verify(context.Background(), userID, req, nil); err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+
+	t.Run("replay rejected", func(t *testing.T) {
+		if err := v.Verify(context.Background(), userID, req, nil); !errors.Is(err, ErrMFAInvalid) {
+			t.Errorf("expected ErrMFAInvalid for replayed code, got %v", err)
+		}
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		bad := &models.MFAVerifyRequest{Method: models.MFAMethodTOTP, Code: "000000"}
+		if code == "000000" {
+			bad.Code = "111111"
+		}
+		if err := v.Verify(context.Background(), userID, bad, nil); !errors.Is(err, ErrMFAInvalid) {
+			t.Errorf("expected ErrMFAInvalid, got %v", err)
+		}
+	})
+
+	t.Run("unconfirmed factor ignored", func(t *testing.T) {
+		pending := &mockMFAStore{factors: []*models.UserMFAFactor{models.NewTOTPFactor(userID, "app", []byte(secret))}}
+		pv := NewMFAVerifier(pending, plainCipher{}, testWebAuthnConfig, zerolog.Nop())
+		fresh, _ := GenerateTOTPCode(secret, time.Now())
+		err := pv.Verify(context.Background(), userID, &models.MFAVerifyRequest{Method: models.MFAMethodTOTP, Code: fresh}, nil)
+		if !errors.Is(err, ErrMFANotEnrolled) {
+			t.Errorf("expected ErrMFANotEnrolled, got %v", err)
+		}
+	})
+}
+
+func TestMFAVerifier_VerifyWebAuthn(t *testing.T) {
+	userID := uuid.New()
+	authr := newTestAuthenticator(t)
+	regChallenge, _ := NewWebAuthnChallenge()
+	cred, err := testWebAuthnConfig.VerifyRegistration(regChallenge,
+		clientDataJSON(t, "webauthn.create", regChallenge, "https://keldris.example.com"),
+		authr.register(t, testWebAuthnConfig.RPID))
+	if err != nil {
+		t.Fatalf("VerifyRegistration() error: %v", err)
+	}
+
+	factor := models.NewWebAuthnFactor(userID, "key", cred.ID, cred.PublicKey, cred.Algorithm, cred.SignCount)
+	store := &mockMFAStore{factors: []*models.UserMFAFactor{factor}}
+	v := NewMFAVerifier(store, plainCipher{}, testWebAuthnConfig, zerolog.Nop())
+
+	challenge, _ := NewWebAuthnChallenge()
+	cd := clientDataJSON(t, "webauthn.get", challenge, "https://keldris.example.com")
+	authData, sig := authr.assert(t, testWebAuthnConfig.RPID, cd)
+	req := &models.MFAVerifyRequest{
+		Method: models.MFAMethodWebAuthn,
+		WebAuthn: &models.WebAuthnAssertion{
+			CredentialID:      b64url.EncodeToString(cred.ID),
+			ClientDataJSON:    b64url.EncodeToString(cd),
+			AuthenticatorData: b64url.EncodeToString(authData),
+			Signature:         b64url.EncodeToString(sig),
+		},
+	}
+
+	if err := v.Verify(context.Background(), userID, req, challenge); err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+	if store.usage[factor.ID] != 1 {
+		t.Errorf("expected sign count 1 to be stored, got %d", store.usage[factor.ID])
+	}
+
+	t.Run("missing challenge", func(t *testing.T) {
+		if err := v.Verify(context.Background(), userID, req, nil); err == nil {
+			t.Error("expected assertion without a challenge to be rejected")
+		}
+	})
+}
+
+func TestMFAVerifier_VerifyRecoveryCode(t *testing.T) {
+	userID := uuid.New()
+	store := &mockMFAStore{recoveryCodes: map[string]bool{HashRecoveryCode("abcde-fghij"): false}}
+	v := NewMFAVerifier(store, plainCipher{}, testWebAuthnConfig, zerolog.Nop())
+	req := &models.MFAVerifyRequest{Method: models.MFAMethodRecoveryCode, Code: "ABCDE-FGHIJ"}
+
+	if err := v.Verify(context.Background(), userID, req, nil); err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+	if err := v.Verify(context.Background(), userID, req, nil); !errors.Is(err, ErrMFAInvalid) {
+		t.Errorf("expected recovery code to be single use, got %v", err)
+	}
+}
+
+func TestMFAVerifier_UnsupportedMethod(t *testing.T) {
+	v := NewMFAVerifier(&mockMFAStore{}, plainCipher{}, testWebAuthnConfig, zerolog.Nop())
+	err := v.Verify(context.Background(), uuid.New(), &models.MFAVerifyRequest{Method: "sms"}, nil)
+	if !errors.Is(err, ErrMFAUnsupportedMethod) {
+		t.Errorf("expected ErrMFAUnsupportedMethod, got %v", err)
+	}
+}
+
+func TestMFAEnrollmentDeadline(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	enabled := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	if got := MFAEnrollmentDeadline(created, enabled, 7); !got.Equal(enabled.AddDate(0, 0, 7)) {
+		t.Errorf("deadline = %v, want grace from policy start", got)
+	}
+	if got := MFAEnrollmentDeadline(enabled, created, 7); !got.Equal(enabled.AddDate(0, 0, 7)) {
+		t.Errorf("deadline = %v, want grace from account creation", got)
+	}
+}
+
+func TestMFAMethods(t *testing.T) {
+	if methods := MFAMethods(nil); len(methods) != 0 {
+		t.Errorf("expected no methods without factors, got %v", methods)
+	}
+
+	factors := []*models.UserMFAFactor{
+		{Type: models.MFAFactorTOTP},
+		{Type: models.MFAFactorWebAuthn},
+	}
+	methods := MFAMethods(factors)
+	want := []string{models.MFAMethodWebAuthn, models.MFAMethodTOTP, models.MFAMethodRecoveryCode}
+	if len(methods) != len(want) {
+		t.Fatalf("methods = %v, want %v", methods, want)
+	}
+	for i := range want {
+		if methods[i] != want[i] {
+			t.Errorf("methods[%d] = %s, want %s", i, methods[i], want[i])
+		}
+	}
+}
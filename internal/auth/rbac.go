@@ -56,8 +56,36 @@ const (
 	// Backup permissions
 	PermBackupRead   Permission = "backup:read"
 	PermBackupCreate Permission = "backup:create"
+
+	// Restore permissions
+	PermRestoreCreate Permission = "restore:create"
 )
 
+// AllPermissions returns the full permission catalog that custom roles can be built from.
+func AllPermissions() []Permission {
+	return []Permission{
+		PermOrgRead, PermOrgUpdate, PermOrgDelete,
+		PermMemberRead, PermMemberInvite, PermMemberUpdate, PermMemberRemove,
+		PermUserRead, PermUserInvite, PermUserUpdate, PermUserDisable, PermUserDelete,
+		PermUserResetPassword, PermUserImpersonate, PermUserActivityView,
+		PermAgentRead, PermAgentCreate, PermAgentUpdate, PermAgentDelete,
+		PermRepoRead, PermRepoCreate, PermRepoUpdate, PermRepoDelete,
+		PermScheduleRead, PermScheduleCreate, PermScheduleUpdate, PermScheduleDelete, PermScheduleRun,
+		PermBackupRead, PermBackupCreate,
+		PermRestoreCreate,
+	}
+}
+
+// IsValidPermission checks if the given string is a permission in the catalog.
+func IsValidPermission(perm string) bool {
+	for _, p := range AllPermissions() {
+		if string(p) == perm {
+			return true
+		}
+	}
+	return false
+}
+
 // rolePermissions maps roles to their allowed permissions.
 var rolePermissions = map[models.OrgRole][]Permission{
 	models.OrgRoleOwner: {
@@ -76,6 +104,8 @@ var rolePermissions = map[models.OrgRole][]Permission{
 		PermScheduleRead, PermScheduleCreate, PermScheduleUpdate, PermScheduleDelete, PermScheduleRun,
 		// Backups
 		PermBackupRead, PermBackupCreate,
+		// Restores
+		PermRestoreCreate,
 	},
 	models.OrgRoleAdmin: {
 		// Organization
@@ -93,6 +123,8 @@ var rolePermissions = map[models.OrgRole][]Permission{
 		PermScheduleRead, PermScheduleCreate, PermScheduleUpdate, PermScheduleDelete, PermScheduleRun,
 		// Backups
 		PermBackupRead, PermBackupCreate,
+		// Restores
+		PermRestoreCreate,
 	},
 	models.OrgRoleMember: {
 		// Organization
@@ -109,6 +141,8 @@ var rolePermissions = map[models.OrgRole][]Permission{
 		PermScheduleRead, PermScheduleCreate, PermScheduleUpdate, PermScheduleDelete, PermScheduleRun,
 		// Backups
 		PermBackupRead, PermBackupCreate,
+		// Restores
+		PermRestoreCreate,
 	},
 	models.OrgRoleReadonly: {
 		// Organization
@@ -134,9 +168,23 @@ type MembershipStore interface {
 	GetMembershipsByUserID(ctx context.Context, userID uuid.UUID) ([]*models.OrgMembership, error)
 }
 
+// RoleBindingStore defines the interface for fetching custom role bindings.
+type RoleBindingStore interface {
+	GetEffectiveRoleBindings(ctx context.Context, orgID, userID uuid.UUID) ([]*models.EffectiveRoleBinding, error)
+	GetGroupsByAgentID(ctx context.Context, agentID uuid.UUID) ([]*models.AgentGroup, error)
+}
+
+// ResourceScope identifies the resource a permission check applies to.
+// Zero-valued fields mean the resource does not belong to that dimension.
+type ResourceScope struct {
+	AgentID      uuid.UUID
+	RepositoryID uuid.UUID
+}
+
 // RBAC provides role-based access control functionality.
 type RBAC struct {
-	store MembershipStore
+	store    MembershipStore
+	bindings RoleBindingStore
 }
 
 // NewRBAC creates a new RBAC instance.
@@ -154,7 +202,212 @@ func (r *RBAC) HasPermission(ctx context.Context, userID, orgID uuid.UUID, perm
 		return false, nil
 	}
 
-	return HasRolePermission(membership.Role, perm), nil
+	if HasRolePermission(membership.Role, perm) {
+		return true, nil
+	}
+
+	return r.hasCustomPermission(ctx, userID, orgID, perm, nil)
+}
+
+// SetRoleBindingStore enables custom role evaluation on top of the built-in roles.
+func (r *RBAC) SetRoleBindingStore(store RoleBindingStore) {
+	r.bindings = store
+}
+
+// HasPermissionForResource checks if the user has the given permission on a
+// specific resource. In addition to the built-in role and organization-wide
+// custom roles, bindings scoped to a matching agent group or repository apply.
+func (r *RBAC) HasPermissionForResource(ctx context.Context, userID, orgID uuid.UUID, perm Permission, scope ResourceScope) (bool, error) {
+	membership, err := r.store.GetMembershipByUserAndOrg(ctx, userID, orgID)
+	if err != nil {
+		return false, fmt.Errorf("get membership: %w", err)
+	}
+	if membership == nil {
+		return false, nil
+	}
+
+	if HasRolePermission(membership.Role, perm) {
+		return true, nil
+	}
+
+	return r.hasCustomPermission(ctx, userID, orgID, perm, &scope)
+}
+
+// RequirePermissionForResource checks resource-scoped permission and returns an error if denied.
+func (r *RBAC) RequirePermissionForResource(ctx context.Context, userID, orgID uuid.UUID, perm Permission, scope ResourceScope) error {
+	has, err := r.HasPermissionForResource(ctx, userID, orgID, perm, scope)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// hasCustomPermission evaluates the user's custom role bindings. With a nil
+// scope only organization-wide bindings are considered.
+func (r *RBAC) hasCustomPermission(ctx context.Context, userID, orgID uuid.UUID, perm Permission, scope *ResourceScope) (bool, error) {
+	if r.bindings == nil {
+		return false, nil
+	}
+
+	bindings, err := r.bindings.GetEffectiveRoleBindings(ctx, orgID, userID)
+	if err != nil {
+		return false, fmt.Errorf("get role bindings: %w", err)
+	}
+
+	var agentGroups map[uuid.UUID]bool
+	for _, b := range bindings {
+		if !b.HasPermission(string(perm)) {
+			continue
+		}
+		if !b.IsScoped() {
+			return true, nil
+		}
+		if scope == nil {
+			continue
+		}
+
+		if len(b.RepositoryIDs) > 0 && !containsUUID(b.RepositoryIDs, scope.RepositoryID) {
+			continue
+		}
+		if len(b.AgentGroupIDs) > 0 {
+			if scope.AgentID == uuid.Nil {
+				continue
+			}
+			if agentGroups == nil {
+				groups, err := r.bindings.GetGroupsByAgentID(ctx, scope.AgentID)
+				if err != nil {
+					return false, fmt.Errorf("get agent groups: %w", err)
+				}
+				agentGroups = make(map[uuid.UUID]bool, len(groups))
+				for _, g := range groups {
+					agentGroups[g.ID] = true
+				}
+			}
+			matched := false
+			for _, id := range b.AgentGroupIDs {
+				if agentGroups[id] {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// HasPermissionForAnyResource checks if the user has the given permission on
+// at least one of the scopes, e.g. any of the repositories a schedule writes to.
+func (r *RBAC) HasPermissionForAnyResource(ctx context.Context, userID, orgID uuid.UUID, perm Permission, scopes []ResourceScope) (bool, error) {
+	membership, err := r.store.GetMembershipByUserAndOrg(ctx, userID, orgID)
+	if err != nil {
+		return false, fmt.Errorf("get membership: %w", err)
+	}
+	if membership == nil {
+		return false, nil
+	}
+
+	if HasRolePermission(membership.Role, perm) {
+		return true, nil
+	}
+
+	for i := range scopes {
+		has, err := r.hasCustomPermission(ctx, userID, orgID, perm, &scopes[i])
+		if err != nil {
+			return false, err
+		}
+		if has {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasPermissionInAnyScope checks if the user holds the permission anywhere in
+// the organization: through their role or through any custom role binding,
+// scoped or not. List endpoints use it before filtering results per resource.
+func (r *RBAC) HasPermissionInAnyScope(ctx context.Context, userID, orgID uuid.UUID, perm Permission) (bool, error) {
+	membership, err := r.store.GetMembershipByUserAndOrg(ctx, userID, orgID)
+	if err != nil {
+		return false, fmt.Errorf("get membership: %w", err)
+	}
+	if membership == nil {
+		return false, nil
+	}
+
+	if HasRolePermission(membership.Role, perm) {
+		return true, nil
+	}
+	if r.bindings == nil {
+		return false, nil
+	}
+
+	bindings, err := r.bindings.GetEffectiveRoleBindings(ctx, orgID, userID)
+	if err != nil {
+		return false, fmt.Errorf("get role bindings: %w", err)
+	}
+	for _, b := range bindings {
+		if b.HasPermission(string(perm)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IsOwnerOnlyPermission reports whether only the owner role holds perm.
+// Custom roles carrying such permissions can only be created or bound by owners.
+func IsOwnerOnlyPermission(perm Permission) bool {
+	return HasRolePermission(models.OrgRoleOwner, perm) && !HasRolePermission(models.OrgRoleAdmin, perm)
+}
+
+// UngrantablePermissions returns the permissions the actor may not put into a
+// custom role or bind to a subject: owner-only permissions unless the actor is
+// an owner, and any permission the actor does not hold organization-wide.
+func (r *RBAC) UngrantablePermissions(ctx context.Context, actorID, orgID uuid.UUID, perms []string) ([]string, error) {
+	membership, err := r.store.GetMembershipByUserAndOrg(ctx, actorID, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("get membership: %w", err)
+	}
+	if membership == nil {
+		return perms, nil
+	}
+
+	var denied []string
+	for _, p := range perms {
+		perm := Permission(p)
+		if IsOwnerOnlyPermission(perm) && membership.Role != models.OrgRoleOwner {
+			denied = append(denied, p)
+			continue
+		}
+		has, err := r.HasPermission(ctx, actorID, orgID, perm)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			denied = append(denied, p)
+		}
+	}
+	return denied, nil
+}
+
+// containsUUID reports whether id is a non-nil member of ids.
+func containsUUID(ids []uuid.UUID, id uuid.UUID) bool {
+	if id == uuid.Nil {
+		return false
+	}
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
 }
 
 // HasRolePermission checks if a role has the given permission.
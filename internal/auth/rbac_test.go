@@ -596,3 +596,251 @@ func TestRBAC_CanAssignRole(t *testing.T) {
 		}
 	})
 }
+
+// mockRoleBindingStore implements RoleBindingStore for testing.
+type mockRoleBindingStore struct {
+	bindings    []*models.EffectiveRoleBinding
+	agentGroups map[uuid.UUID][]*models.AgentGroup
+	err         error
+}
+
+func (m *mockRoleBindingStore) GetEffectiveRoleBindings(_ context.Context, orgID, _ uuid.UUID) ([]*models.EffectiveRoleBinding, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var result []*models.EffectiveRoleBinding
+	for _, b := range m.bindings {
+		if b.OrgID == orgID {
+			result = append(result, b)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockRoleBindingStore) GetGroupsByAgentID(_ context.Context, agentID uuid.UUID) ([]*models.AgentGroup, error) {
+	return m.agentGroups[agentID], nil
+}
+
+func newEffectiveBinding(orgID uuid.UUID, perms []Permission, agentGroupIDs, repoIDs []uuid.UUID) *models.EffectiveRoleBinding {
+	b := models.NewUserRoleBinding(orgID, uuid.New(), uuid.New())
+	if agentGroupIDs != nil {
+		b.AgentGroupIDs = agentGroupIDs
+	}
+	if repoIDs != nil {
+		b.RepositoryIDs = repoIDs
+	}
+	var permStrs []string
+	for _, p := range perms {
+		permStrs = append(permStrs, string(p))
+	}
+	return &models.EffectiveRoleBinding{RoleBinding: *b, RoleName: "custom", Permissions: permStrs}
+}
+
+func TestAllPermissions_Valid(t *testing.T) {
+	for _, p := range AllPermissions() {
+		if !IsValidPermission(string(p)) {
+			t.Errorf("permission %s should be valid", p)
+		}
+	}
+	if IsValidPermission("repo:explode") {
+		t.Error("unknown permission should be invalid")
+	}
+}
+
+func TestRBAC_CustomRole_Unscoped(t *testing.T) {
+	store := newMockMembershipStore()
+	userID := uuid.New()
+	orgID := uuid.New()
+	store.addMembership(userID, orgID, models.OrgRoleReadonly)
+
+	bindings := &mockRoleBindingStore{
+		bindings: []*models.EffectiveRoleBinding{
+			newEffectiveBinding(orgID, []Permission{PermScheduleRun}, nil, nil),
+		},
+	}
+
+	rbac := NewRBAC(store)
+
+	has, err := rbac.HasPermission(context.Background(), userID, orgID, PermScheduleRun)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if has {
+		t.Error("readonly should not run schedules without a role binding store")
+	}
+
+	rbac.SetRoleBindingStore(bindings)
+
+	has, err = rbac.HasPermission(context.Background(), userID, orgID, PermScheduleRun)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !has {
+		t.Error("custom role should grant schedule:run")
+	}
+
+	has, _ = rbac.HasPermission(context.Background(), userID, orgID, PermRepoDelete)
+	if has {
+		t.Error("custom role should not grant repo:delete")
+	}
+}
+
+func TestRBAC_CustomRole_Scoped(t *testing.T) {
+	store := newMockMembershipStore()
+	userID := uuid.New()
+	orgID := uuid.New()
+	store.addMembership(userID, orgID, models.OrgRoleReadonly)
+
+	dbServers := uuid.New()
+	dbAgent := uuid.New()
+	webAgent := uuid.New()
+	allowedRepo := uuid.New()
+
+	bindings := &mockRoleBindingStore{
+		bindings: []*models.EffectiveRoleBinding{
+			newEffectiveBinding(orgID, []Permission{PermRestoreCreate}, []uuid.UUID{dbServers}, nil),
+			newEffectiveBinding(orgID, []Permission{PermRepoUpdate}, nil, []uuid.UUID{allowedRepo}),
+		},
+		agentGroups: map[uuid.UUID][]*models.AgentGroup{
+			dbAgent: {{ID: dbServers, OrgID: orgID, Name: "db-servers"}},
+		},
+	}
+
+	rbac := NewRBAC(store)
+	rbac.SetRoleBindingStore(bindings)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		perm  Permission
+		scope ResourceScope
+		want  bool
+	}{
+		{"restore on db-servers agent", PermRestoreCreate, ResourceScope{AgentID: dbAgent, RepositoryID: uuid.New()}, true},
+		{"restore on other agent", PermRestoreCreate, ResourceScope{AgentID: webAgent}, false},
+		{"restore without agent", PermRestoreCreate, ResourceScope{RepositoryID: allowedRepo}, false},
+		{"update allowed repository", PermRepoUpdate, ResourceScope{RepositoryID: allowedRepo}, true},
+		{"update other repository", PermRepoUpdate, ResourceScope{RepositoryID: uuid.New()}, false},
+		{"builtin role still applies", PermRepoRead, ResourceScope{RepositoryID: uuid.New()}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rbac.HasPermissionForResource(ctx, userID, orgID, tt.perm, tt.scope)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("HasPermissionForResource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Scoped bindings never grant organization-wide permission.
+	has, err := rbac.HasPermission(ctx, userID, orgID, PermRestoreCreate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if has {
+		t.Error("scoped binding should not grant org-wide restore")
+	}
+
+	if err := rbac.RequirePermissionForResource(ctx, userID, orgID, PermRestoreCreate, ResourceScope{AgentID: webAgent}); err != ErrPermissionDenied {
+		t.Errorf("expected ErrPermissionDenied, got %v", err)
+	}
+
+	// A schedule writing to several repositories matches if any of them is allowed.
+	scopes := []ResourceScope{{RepositoryID: uuid.New()}, {RepositoryID: allowedRepo}}
+	if has, _ := rbac.HasPermissionForAnyResource(ctx, userID, orgID, PermRepoUpdate, scopes); !has {
+		t.Error("expected permission through the second scope")
+	}
+	if has, _ := rbac.HasPermissionForAnyResource(ctx, userID, orgID, PermRepoUpdate, scopes[:1]); has {
+		t.Error("expected no permission for unrelated scopes")
+	}
+
+	// List endpoints see the scoped grant, but not permissions nobody holds.
+	if has, _ := rbac.HasPermissionInAnyScope(ctx, userID, orgID, PermRestoreCreate); !has {
+		t.Error("expected scoped binding to count for HasPermissionInAnyScope")
+	}
+	if has, _ := rbac.HasPermissionInAnyScope(ctx, userID, orgID, PermAgentDelete); has {
+		t.Error("expected no agent:delete in any scope")
+	}
+}
+
+func TestRBAC_UngrantablePermissions(t *testing.T) {
+	store := newMockMembershipStore()
+	ownerID, adminID, memberID := uuid.New(), uuid.New(), uuid.New()
+	orgID := uuid.New()
+	store.addMembership(ownerID, orgID, models.OrgRoleOwner)
+	store.addMembership(adminID, orgID, models.OrgRoleAdmin)
+	store.addMembership(memberID, orgID, models.OrgRoleMember)
+
+	rbac := NewRBAC(store)
+	ctx := context.Background()
+	perms := []string{string(PermRepoRead), string(PermOrgDelete), string(PermUserImpersonate), string(PermMemberInvite)}
+
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		want   []string
+	}{
+		{"owner grants anything", ownerID, nil},
+		{"admin cannot grant owner-only", adminID, []string{string(PermOrgDelete), string(PermUserImpersonate)}},
+		{"member cannot grant what it lacks", memberID, []string{string(PermOrgDelete), string(PermUserImpersonate), string(PermMemberInvite)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rbac.UngrantablePermissions(ctx, tt.userID, orgID, perms)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("UngrantablePermissions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, p := range []Permission{PermOrgDelete, PermUserDelete, PermUserImpersonate} {
+		if !IsOwnerOnlyPermission(p) {
+			t.Errorf("%s should be owner-only", p)
+		}
+	}
+	if IsOwnerOnlyPermission(PermOrgUpdate) {
+		t.Error("org:update should not be owner-only")
+	}
+}
+
+func TestRBAC_CustomRole_RequiresMembership(t *testing.T) {
+	store := newMockMembershipStore()
+	userID := uuid.New()
+	orgID := uuid.New()
+
+	rbac := NewRBAC(store)
+	rbac.SetRoleBindingStore(&mockRoleBindingStore{
+		bindings: []*models.EffectiveRoleBinding{
+			newEffectiveBinding(orgID, []Permission{PermAgentRead}, nil, nil),
+		},
+	})
+
+	has, err := rbac.HasPermission(context.Background(), userID, orgID, PermAgentRead)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if has {
+		t.Error("bindings should not grant access to non-members")
+	}
+}
+
+func TestRBAC_CustomRole_StoreError(t *testing.T) {
+	store := newMockMembershipStore()
+	userID := uuid.New()
+	orgID := uuid.New()
+	store.addMembership(userID, orgID, models.OrgRoleReadonly)
+
+	rbac := NewRBAC(store)
+	rbac.SetRoleBindingStore(&mockRoleBindingStore{err: fmt.Errorf("db down")})
+
+	if _, err := rbac.HasPermission(context.Background(), userID, orgID, PermAgentDelete); err == nil {
+		t.Error("expected error from role binding store")
+	}
+}
@@ -0,0 +1,588 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/google/uuid"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// SAML namespaces and identifiers.
+const (
+	SAMLProtocolNS  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	SAMLAssertionNS = "urn:oasis:names:tc:SAML:2.0:assertion"
+	SAMLMetadataNS  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	samlBindingHTTPPost   = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlStatusSuccess     = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer            = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlNameIDUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	samlNameIDEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	samlNameIDPersistent  = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+)
+
+// SAMLMaxClockSkew is the tolerance applied to assertion validity windows.
+const SAMLMaxClockSkew = 2 * time.Minute
+
+// SAMLRequestTimeout bounds how long an AuthnRequest waits for its response.
+const SAMLRequestTimeout = 10 * time.Minute
+
+// Errors returned while validating SAML responses.
+var (
+	ErrSAMLInvalidResponse = errors.New("invalid SAML response")
+	ErrSAMLReplay          = errors.New("SAML assertion has already been used")
+)
+
+// SAMLConfig holds the configuration of a SAML service provider for one
+// organization.
+type SAMLConfig struct {
+	EntityID       string
+	ACSURL         string
+	IdPEntityID    string
+	IdPSSOURL      string
+	IdPCertificate string // PEM, may hold several certificates during rollover
+	Certificate    string // PEM, SP signing certificate
+	PrivateKey     string // PEM, SP signing key
+}
+
+// SAMLServiceProvider signs AuthnRequests, publishes SP metadata and
+// validates responses from a single identity provider.
+type SAMLServiceProvider struct {
+	entityID    string
+	acsURL      string
+	idpEntityID string
+	idpSSOURL   string
+	idpCerts    []*x509.Certificate
+	cert        *x509.Certificate
+	key         *rsa.PrivateKey
+	now         func() time.Time
+}
+
+// NewSAMLServiceProvider creates a service provider from cfg.
+func NewSAMLServiceProvider(cfg SAMLConfig) (*SAMLServiceProvider, error) {
+	if cfg.EntityID == "" || cfg.ACSURL == "" {
+		return nil, errors.New("SAML SP entity ID and ACS URL are required")
+	}
+	if cfg.IdPEntityID == "" || cfg.IdPSSOURL == "" {
+		return nil, errors.New("SAML IdP entity ID and SSO URL are required")
+	}
+
+	idpCerts, err := ParseSAMLCertificates(cfg.IdPCertificate)
+	if err != nil {
+		return nil, fmt.Errorf("parse IdP certificate: %w", err)
+	}
+	certs, err := ParseSAMLCertificates(cfg.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("parse SP certificate: %w", err)
+	}
+	key, err := parseSAMLPrivateKey(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse SP private key: %w", err)
+	}
+
+	return &SAMLServiceProvider{
+		entityID:    cfg.EntityID,
+		acsURL:      cfg.ACSURL,
+		idpEntityID: cfg.IdPEntityID,
+		idpSSOURL:   cfg.IdPSSOURL,
+		idpCerts:    idpCerts,
+		cert:        certs[0],
+		key:         key,
+		now:         time.Now,
+	}, nil
+}
+
+// SAMLSubject returns the user subject for a NameID asserted by an
+// organization's IdP. Subjects are namespaced per organization so NameIDs
+// from different tenants' IdPs can never resolve to the same account.
+func SAMLSubject(orgID uuid.UUID, nameID string) string {
+	return "saml:" + orgID.String() + ":" + nameID
+}
+
+// ParseSAMLCertificates parses one or more PEM encoded certificates. Bare
+// base64 DER, as copied from IdP metadata, is also accepted.
+func ParseSAMLCertificates(data string) ([]*x509.Certificate, error) {
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return nil, errors.New("no certificate provided")
+	}
+	if !strings.HasPrefix(data, "-----BEGIN") {
+		der, err := decodeXMLBase64(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode certificate: %w", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.Certificate{cert}, nil
+	}
+
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found in PEM data")
+	}
+	return certs, nil
+}
+
+func parseSAMLPrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("SP signing key must be an RSA key")
+	}
+	return key, nil
+}
+
+// GenerateSAMLKeyPair creates a self-signed RSA certificate and key for
+// signing AuthnRequests, returned as PEM.
+func GenerateSAMLKeyPair(commonName string) (certPEM, keyPEM string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", fmt.Errorf("generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return "", "", fmt.Errorf("generate serial: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"Keldris"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", fmt.Errorf("create certificate: %w", err)
+	}
+
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	return certPEM, keyPEM, nil
+}
+
+// EntityID returns the SP entity ID.
+func (sp *SAMLServiceProvider) EntityID() string {
+	return sp.entityID
+}
+
+type samlMetadata struct {
+	XMLName  xml.Name            `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID string              `xml:"entityID,attr"`
+	SP       samlSPSSODescriptor `xml:"SPSSODescriptor"`
+}
+
+type samlSPSSODescriptor struct {
+	AuthnRequestsSigned        bool                    `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned       bool                    `xml:"WantAssertionsSigned,attr"`
+	ProtocolSupportEnumeration string                  `xml:"protocolSupportEnumeration,attr"`
+	KeyDescriptor              samlKeyDescriptor       `xml:"KeyDescriptor"`
+	NameIDFormats              []string                `xml:"NameIDFormat"`
+	ACS                        samlAssertionConsumerSv `xml:"AssertionConsumerService"`
+}
+
+type samlKeyDescriptor struct {
+	Use     string `xml:"use,attr"`
+	KeyInfo struct {
+		XMLName  xml.Name `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
+		X509Data struct {
+			Certificate string `xml:"X509Certificate"`
+		} `xml:"X509Data"`
+	}
+}
+
+type samlAssertionConsumerSv struct {
+	Binding   string `xml:"Binding,attr"`
+	Location  string `xml:"Location,attr"`
+	Index     int    `xml:"index,attr"`
+	IsDefault bool   `xml:"isDefault,attr"`
+}
+
+// Metadata returns the SP metadata document to register with the IdP.
+func (sp *SAMLServiceProvider) Metadata() ([]byte, error) {
+	md := samlMetadata{
+		EntityID: sp.entityID,
+		SP: samlSPSSODescriptor{
+			AuthnRequestsSigned:        true,
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: SAMLProtocolNS,
+			NameIDFormats:              []string{samlNameIDPersistent, samlNameIDEmail, samlNameIDUnspecified},
+			ACS: samlAssertionConsumerSv{
+				Binding:   samlBindingHTTPPost,
+				Location:  sp.acsURL,
+				Index:     0,
+				IsDefault: true,
+			},
+		},
+	}
+	md.SP.KeyDescriptor.Use = "signing"
+	md.SP.KeyDescriptor.KeyInfo.X509Data.Certificate = base64.StdEncoding.EncodeToString(sp.cert.Raw)
+
+	out, err := xml.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal SP metadata: %w", err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+type samlAuthnRequest struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	IssueInstant                string   `xml:"IssueInstant,attr"`
+	Destination                 string   `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string   `xml:"ProtocolBinding,attr"`
+	Issuer                      struct {
+		XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+		Value   string   `xml:",chardata"`
+	}
+	NameIDPolicy struct {
+		AllowCreate bool `xml:"AllowCreate,attr"`
+	} `xml:"NameIDPolicy"`
+}
+
+// NewSAMLRequestID generates an ID for an AuthnRequest.
+func NewSAMLRequestID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate request ID: %w", err)
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+// AuthnRequestURL builds a signed HTTP-Redirect binding URL that sends the
+// user to the IdP with an AuthnRequest. The response must reference
+// requestID in InResponseTo.
+func (sp *SAMLServiceProvider) AuthnRequestURL(requestID, relayState string) (string, error) {
+	req := samlAuthnRequest{
+		ID:                          requestID,
+		Version:                     "2.0",
+		IssueInstant:                sp.now().UTC().Format(time.RFC3339),
+		Destination:                 sp.idpSSOURL,
+		AssertionConsumerServiceURL: sp.acsURL,
+		ProtocolBinding:             samlBindingHTTPPost,
+	}
+	req.Issuer.Value = sp.entityID
+	req.NameIDPolicy.AllowCreate = true
+
+	raw, err := xml.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("marshal AuthnRequest: %w", err)
+	}
+
+	var deflated bytes.Buffer
+	w, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	// The redirect binding signs the exact query string, in this order.
+	query := "SAMLRequest=" + url.QueryEscape(base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	if relayState != "" {
+		query += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	query += "&SigAlg=" + url.QueryEscape(dsig.RSASHA256SignatureMethod)
+
+	digest := sha256.Sum256([]byte(query))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, sp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign AuthnRequest: %w", err)
+	}
+	query += "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(signature))
+
+	sep := "?"
+	if strings.Contains(sp.idpSSOURL, "?") {
+		sep = "&"
+	}
+	return sp.idpSSOURL + sep + query, nil
+}
+
+// SAMLAssertion holds the validated identity from a SAML response.
+type SAMLAssertion struct {
+	ID           string
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	NotOnOrAfter time.Time
+	Attributes   map[string][]string
+}
+
+// Attribute returns the values of the first attribute found among names.
+func (a *SAMLAssertion) Attribute(names ...string) []string {
+	for _, name := range names {
+		if values := a.Attributes[name]; len(values) > 0 {
+			return values
+		}
+	}
+	return nil
+}
+
+func samlInvalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrSAMLInvalidResponse, fmt.Sprintf(format, args...))
+}
+
+// ParseResponse validates a base64 encoded HTTP-POST SAMLResponse issued in
+// reply to requestID and returns its assertion. Either the response or the
+// assertion must be signed by the IdP, and the assertion is read from the
+// signed content only. Encrypted assertions are not supported.
+func (sp *SAMLServiceProvider) ParseResponse(samlResponse, requestID string) (*SAMLAssertion, error) {
+	raw, err := decodeXMLBase64(samlResponse)
+	if err != nil {
+		return nil, samlInvalid("decode response: %v", err)
+	}
+	root, err := parseSAMLXML(raw)
+	if err != nil {
+		return nil, samlInvalid("%v", err)
+	}
+	if root.NamespaceURI() != SAMLProtocolNS || root.Tag != "Response" {
+		return nil, samlInvalid("root element is not a Response")
+	}
+
+	now := sp.now()
+	if dest := samlAttr(root, "Destination"); dest != "" && dest != sp.acsURL {
+		return nil, samlInvalid("destination %q does not match ACS URL", dest)
+	}
+	if requestID == "" || samlAttr(root, "InResponseTo") != requestID {
+		return nil, samlInvalid("response is not for the pending request")
+	}
+	if issuer := samlChild(root, SAMLAssertionNS, "Issuer"); issuer != nil && samlText(issuer) != sp.idpEntityID {
+		return nil, samlInvalid("unexpected issuer %q", samlText(issuer))
+	}
+
+	status := samlChild(root, SAMLProtocolNS, "Status")
+	if status == nil {
+		return nil, samlInvalid("missing status")
+	}
+	if code := samlChild(status, SAMLProtocolNS, "StatusCode"); code == nil || samlAttr(code, "Value") != samlStatusSuccess {
+		msg := ""
+		if m := samlChild(status, SAMLProtocolNS, "StatusMessage"); m != nil {
+			msg = samlText(m)
+		}
+		return nil, samlInvalid("IdP returned an error status: %s", msg)
+	}
+
+	if samlChild(root, SAMLAssertionNS, "EncryptedAssertion") != nil {
+		return nil, samlInvalid("encrypted assertions are not supported")
+	}
+	assertions := samlChildren(root, SAMLAssertionNS, "Assertion")
+	if len(assertions) != 1 {
+		return nil, samlInvalid("expected exactly one assertion, got %d", len(assertions))
+	}
+	for _, el := range []*etree.Element{root, assertions[0]} {
+		if id := samlAttr(el, "ID"); id == "" || countSAMLID(root, id) != 1 {
+			return nil, samlInvalid("%s must carry a unique ID", el.Tag)
+		}
+	}
+
+	signedResponse, responseErr := verifySAMLSignature(root, sp.idpCerts, now)
+	if responseErr != nil && !errors.Is(responseErr, errXMLNotSigned) {
+		return nil, samlInvalid("response signature: %v", responseErr)
+	}
+	assertion, err := verifySAMLSignature(assertions[0], sp.idpCerts, now)
+	if err != nil {
+		if !errors.Is(err, errXMLNotSigned) || responseErr != nil {
+			return nil, samlInvalid("assertion signature: %v", err)
+		}
+		// Only the response is signed: take the assertion from its signed copy.
+		signedAssertions := samlChildren(signedResponse, SAMLAssertionNS, "Assertion")
+		if len(signedAssertions) != 1 {
+			return nil, samlInvalid("expected exactly one signed assertion, got %d", len(signedAssertions))
+		}
+		assertion = signedAssertions[0]
+	}
+
+	return sp.validateAssertion(assertion, requestID, now)
+}
+
+func (sp *SAMLServiceProvider) validateAssertion(el *etree.Element, requestID string, now time.Time) (*SAMLAssertion, error) {
+	issuer := samlChild(el, SAMLAssertionNS, "Issuer")
+	if issuer == nil || samlText(issuer) != sp.idpEntityID {
+		return nil, samlInvalid("assertion issuer does not match IdP")
+	}
+
+	result := &SAMLAssertion{
+		ID:         samlAttr(el, "ID"),
+		Attributes: make(map[string][]string),
+	}
+	if result.ID == "" {
+		return nil, samlInvalid("assertion has no ID")
+	}
+
+	subject := samlChild(el, SAMLAssertionNS, "Subject")
+	if subject == nil {
+		return nil, samlInvalid("assertion has no subject")
+	}
+	nameID := samlChild(subject, SAMLAssertionNS, "NameID")
+	if nameID == nil || samlText(nameID) == "" {
+		return nil, samlInvalid("assertion has no NameID")
+	}
+	result.NameID = samlText(nameID)
+	result.NameIDFormat = samlAttr(nameID, "Format")
+
+	if err := sp.validateSubjectConfirmation(subject, requestID, now); err != nil {
+		return nil, err
+	}
+
+	conditions := samlChild(el, SAMLAssertionNS, "Conditions")
+	if conditions == nil {
+		return nil, samlInvalid("assertion has no conditions")
+	}
+	notBefore, err := parseSAMLTime(samlAttr(conditions, "NotBefore"))
+	if err != nil {
+		return nil, samlInvalid("conditions NotBefore: %v", err)
+	}
+	if !notBefore.IsZero() && now.Add(SAMLMaxClockSkew).Before(notBefore) {
+		return nil, samlInvalid("assertion is not yet valid")
+	}
+	notOnOrAfter, err := parseSAMLTime(samlAttr(conditions, "NotOnOrAfter"))
+	if err != nil {
+		return nil, samlInvalid("conditions NotOnOrAfter: %v", err)
+	}
+	if notOnOrAfter.IsZero() || !now.Add(-SAMLMaxClockSkew).Before(notOnOrAfter) {
+		return nil, samlInvalid("assertion has expired")
+	}
+	result.NotOnOrAfter = notOnOrAfter
+
+	audienceOK := false
+	for _, restriction := range samlChildren(conditions, SAMLAssertionNS, "AudienceRestriction") {
+		for _, audience := range samlChildren(restriction, SAMLAssertionNS, "Audience") {
+			if samlText(audience) == sp.entityID {
+				audienceOK = true
+			}
+		}
+	}
+	if !audienceOK {
+		return nil, samlInvalid("assertion audience does not include %s", sp.entityID)
+	}
+
+	if authn := samlChild(el, SAMLAssertionNS, "AuthnStatement"); authn != nil {
+		result.SessionIndex = samlAttr(authn, "SessionIndex")
+	}
+
+	for _, statement := range samlChildren(el, SAMLAssertionNS, "AttributeStatement") {
+		for _, attr := range samlChildren(statement, SAMLAssertionNS, "Attribute") {
+			var values []string
+			for _, v := range samlChildren(attr, SAMLAssertionNS, "AttributeValue") {
+				if s := samlText(v); s != "" {
+					values = append(values, s)
+				}
+			}
+			for _, name := range []string{samlAttr(attr, "Name"), samlAttr(attr, "FriendlyName")} {
+				if name != "" {
+					result.Attributes[name] = append(result.Attributes[name], values...)
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (sp *SAMLServiceProvider) validateSubjectConfirmation(subject *etree.Element, requestID string, now time.Time) error {
+	for _, sc := range samlChildren(subject, SAMLAssertionNS, "SubjectConfirmation") {
+		if samlAttr(sc, "Method") != samlBearer {
+			continue
+		}
+		data := samlChild(sc, SAMLAssertionNS, "SubjectConfirmationData")
+		if data == nil {
+			continue
+		}
+		if samlAttr(data, "Recipient") != sp.acsURL {
+			continue
+		}
+		if irt := samlAttr(data, "InResponseTo"); irt != "" && irt != requestID {
+			continue
+		}
+		notOnOrAfter, err := parseSAMLTime(samlAttr(data, "NotOnOrAfter"))
+		if err != nil || notOnOrAfter.IsZero() || !now.Add(-SAMLMaxClockSkew).Before(notOnOrAfter) {
+			continue
+		}
+		return nil
+	}
+	return samlInvalid("no valid bearer subject confirmation")
+}
+
+func parseSAMLTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// SAMLReplayStore records consumed assertion IDs. It is backed by the
+// database so replay protection holds across server instances.
+type SAMLReplayStore interface {
+	// ConsumeSAMLAssertion records an assertion ID for an organization until
+	// it expires. It returns false if the ID was already recorded.
+	ConsumeSAMLAssertion(ctx context.Context, orgID uuid.UUID, assertionID string, expiresAt time.Time) (bool, error)
+}
+
+// UseSAMLAssertion records the assertion as consumed and returns
+// ErrSAMLReplay if it was already used, so a captured response cannot be
+// posted to the ACS endpoint a second time.
+func UseSAMLAssertion(ctx context.Context, store SAMLReplayStore, orgID uuid.UUID, assertion *SAMLAssertion) error {
+	fresh, err := store.ConsumeSAMLAssertion(ctx, orgID, assertion.ID, assertion.NotOnOrAfter.Add(SAMLMaxClockSkew))
+	if err != nil {
+		return fmt.Errorf("record SAML assertion: %w", err)
+	}
+	if !fresh {
+		return ErrSAMLReplay
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	testSPEntityID  = "https://keldris.test/auth/saml/org/metadata"
+	testACSURL      = "https://keldris.test/auth/saml/org/acs"
+	testIdPEntityID = "https://idp.test/metadata"
+	testIdPSSOURL   = "https://idp.test/sso"
+	testRequestID   = "_req123"
+)
+
+type testIdP struct {
+	key     *rsa.PrivateKey
+	cert    *x509.Certificate
+	certPEM string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	certPEM, keyPEM, err := GenerateSAMLKeyPair("idp.test")
+	if err != nil {
+		t.Fatalf("GenerateSAMLKeyPair() error: %v", err)
+	}
+	key, err := parseSAMLPrivateKey(keyPEM)
+	if err != nil {
+		t.Fatalf("parseSAMLPrivateKey() error: %v", err)
+	}
+	certs, err := ParseSAMLCertificates(certPEM)
+	if err != nil {
+		t.Fatalf("ParseSAMLCertificates() error: %v", err)
+	}
+	return &testIdP{key: key, cert: certs[0], certPEM: certPEM}
+}
+
+// sign adds an enveloped signature to the element serialized in doc,
+// placed after its first Issuer, the way IdPs lay out signed elements.
+func (idp *testIdP) sign(t *testing.T, doc, id string) string {
+	t.Helper()
+	el, err := parseSAMLXML([]byte(doc))
+	if err != nil {
+		t.Fatalf("parse element to sign: %v", err)
+	}
+	if samlAttr(el, "ID") != id {
+		t.Fatalf("element to sign has ID %q, want %q", samlAttr(el, "ID"), id)
+	}
+
+	ctx := dsig.NewDefaultSigningContext(dsig.TLSCertKeyStore(tls.Certificate{
+		Certificate: [][]byte{idp.cert.Raw},
+		PrivateKey:  idp.key,
+	}))
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	signed, err := ctx.SignEnveloped(el)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	// goxmldsig appends the signature; move it up behind the Issuer.
+	sig := samlChild(signed, xmlDSigNS, "Signature")
+	issuer := samlChild(signed, SAMLAssertionNS, "Issuer")
+	var children []etree.Token
+	for _, tok := range signed.Child {
+		if tok == etree.Token(sig) {
+			continue
+		}
+		children = append(children, tok)
+		if tok == etree.Token(issuer) {
+			children = append(children, sig)
+		}
+	}
+	signed.Child = children
+
+	out := etree.NewDocument()
+	out.SetRoot(signed)
+	str, err := out.WriteToString()
+	if err != nil {
+		t.Fatalf("serialize signed element: %v", err)
+	}
+	return str
+}
+
+type testAssertion struct {
+	ID           string
+	InResponseTo string
+	Audience     string
+	Recipient    string
+	NameID       string
+	NotOnOrAfter time.Time
+	Groups       []string
+}
+
+func defaultTestAssertion() testAssertion {
+	return testAssertion{
+		ID:           "_assertion1",
+		InResponseTo: testRequestID,
+		Audience:     testSPEntityID,
+		Recipient:    testACSURL,
+		NameID:       "jdoe@example.com",
+		NotOnOrAfter: time.Now().Add(5 * time.Minute),
+		Groups:       []string{"backup-admins", "ops"},
+	}
+}
+
+func (a testAssertion) xml() string {
+	now := time.Now().UTC()
+	var groups strings.Builder
+	for _, g := range a.Groups {
+		groups.WriteString(`<saml:AttributeValue xsi:type="xs:string">` + g + `</saml:AttributeValue>`)
+	}
+	return `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ` +
+		`xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ` +
+		`ID="` + a.ID + `" Version="2.0" IssueInstant="` + now.Format(time.RFC3339) + `">` +
+		`<saml:Issuer>` + testIdPEntityID + `</saml:Issuer>` +
+		`<saml:Subject><saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">` + a.NameID + `</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">` +
+		`<saml:SubjectConfirmationData InResponseTo="` + a.InResponseTo + `" NotOnOrAfter="` + a.NotOnOrAfter.UTC().Format(time.RFC3339) + `" Recipient="` + a.Recipient + `"/>` +
+		`</saml:SubjectConfirmation></saml:Subject>` +
+		`<saml:Conditions NotBefore="` + now.Add(-time.Minute).Format(time.RFC3339) + `" NotOnOrAfter="` + a.NotOnOrAfter.UTC().Format(time.RFC3339) + `">` +
+		`<saml:AudienceRestriction><saml:Audience>` + a.Audience + `</saml:Audience></saml:AudienceRestriction></saml:Conditions>` +
+		`<saml:AuthnStatement AuthnInstant="` + now.Format(time.RFC3339) + `" SessionIndex="_session1"/>` +
+		`<saml:AttributeStatement>` +
+		`<saml:Attribute Name="http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress" FriendlyName="mail"><saml:AttributeValue>` + a.NameID + `</saml:AttributeValue></saml:Attribute>` +
+		`<saml:Attribute Name="groups">` + groups.String() + `</saml:Attribute>` +
+		`</saml:AttributeStatement></saml:Assertion>`
+}
+
+func testResponse(inResponseTo, inner string) string {
+	return `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ` +
+		`ID="_response1" Version="2.0" IssueInstant="` + time.Now().UTC().Format(time.RFC3339) + `" ` +
+		`Destination="` + testACSURL + `" InResponseTo="` + inResponseTo + `">` +
+		`<saml:Issuer>` + testIdPEntityID + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>` +
+		inner + `</samlp:Response>`
+}
+
+func newTestSP(t *testing.T, idp *testIdP) *SAMLServiceProvider {
+	t.Helper()
+	certPEM, keyPEM, err := GenerateSAMLKeyPair("sp.test")
+	if err != nil {
+		t.Fatalf("GenerateSAMLKeyPair() error: %v", err)
+	}
+	sp, err := NewSAMLServiceProvider(SAMLConfig{
+		EntityID:       testSPEntityID,
+		ACSURL:         testACSURL,
+		IdPEntityID:    testIdPEntityID,
+		IdPSSOURL:      testIdPSSOURL,
+		IdPCertificate: idp.certPEM,
+		Certificate:    certPEM,
+		PrivateKey:     keyPEM,
+	})
+	if err != nil {
+		t.Fatalf("NewSAMLServiceProvider() error: %v", err)
+	}
+	return sp
+}
+
+func encodeResponse(doc string) string {
+	return base64.StdEncoding.EncodeToString([]byte(doc))
+}
+
+func TestSAMLParseResponse_SignedAssertion(t *testing.T) {
+	idp := newTestIdP(t)
+	sp := newTestSP(t, idp)
+	a := defaultTestAssertion()
+
+	doc := testResponse(testRequestID, idp.sign(t, a.xml(), a.ID))
+	assertion, err := sp.ParseResponse(encodeResponse(doc), testRequestID)
+	if err != nil {
+		t.Fatalf("ParseResponse() error: %v", err)
+	}
+
+	if assertion.NameID != a.NameID {
+		t.Errorf("NameID = %q, want %q", assertion.NameID, a.NameID)
+	}
+	if assertion.SessionIndex != "_session1" {
+		t.Errorf("SessionIndex = %q", assertion.SessionIndex)
+	}
+	if got := assertion.Attribute("mail"); len(got) != 1 || got[0] != a.NameID {
+		t.Errorf("mail attribute (by FriendlyName) = %v", got)
+	}
+	groups := NewGroupSync(nil, zerolog.Nop()).ExtractGroupsFromSAML(assertion, "")
+	if len(groups) != 2 || groups[0] != "backup-admins" || groups[1] != "ops" {
+		t.Errorf("groups = %v", groups)
+	}
+}
+
+func TestSAMLParseResponse_SignedResponse(t *testing.T) {
+	idp := newTestIdP(t)
+	sp := newTestSP(t, idp)
+	a := defaultTestAssertion()
+
+	doc := idp.sign(t, testResponse(testRequestID, a.xml()), "_response1")
+	if _, err := sp.ParseResponse(encodeResponse(doc), testRequestID); err != nil {
+		t.Fatalf("ParseResponse() error: %v", err)
+	}
+}
+
+func TestSAMLParseResponse_Rejects(t *testing.T) {
+	idp := newTestIdP(t)
+	sp := newTestSP(t, idp)
+
+	signed := func(mutate func(*testAssertion)) string {
+		a := defaultTestAssertion()
+		if mutate != nil {
+			mutate(&a)
+		}
+		return testResponse(testRequestID, idp.sign(t, a.xml(), a.ID))
+	}
+	otherIdP := newTestIdP(t)
+
+	tests := []struct {
+		name      string
+		doc       string
+		requestID string
+	}{
+		{
+			name: "unsigned",
+			doc:  testResponse(testRequestID, defaultTestAssertion().xml()),
+		},
+		{
+			name: "tampered after signing",
+			doc:  strings.Replace(signed(nil), "jdoe@example.com</saml:NameID>", "admin@example.com</saml:NameID>", 1),
+		},
+		{
+			name: "signed by another key",
+			doc: func() string {
+				a := defaultTestAssertion()
+				return testResponse(testRequestID, otherIdP.sign(t, a.xml(), a.ID))
+			}(),
+		},
+		{
+			name: "wrong audience",
+			doc:  signed(func(a *testAssertion) { a.Audience = "https://other-sp.test" }),
+		},
+		{
+			name: "wrong recipient",
+			doc:  signed(func(a *testAssertion) { a.Recipient = "https://evil.test/acs" }),
+		},
+		{
+			name: "expired",
+			doc:  signed(func(a *testAssertion) { a.NotOnOrAfter = time.Now().Add(-10 * time.Minute) }),
+		},
+		{
+			name: "assertion for another request",
+			doc:  signed(func(a *testAssertion) { a.InResponseTo = "_other" }),
+		},
+		{
+			name:      "response for another request",
+			doc:       signed(nil),
+			requestID: "_other",
+		},
+		{
+			name: "two assertions",
+			doc: func() string {
+				a := defaultTestAssertion()
+				forged := defaultTestAssertion()
+				forged.ID = "_forged"
+				forged.NameID = "admin@example.com"
+				return testResponse(testRequestID, idp.sign(t, a.xml(), a.ID)+forged.xml())
+			}(),
+		},
+		{
+			name: "signature wrapping with duplicate ID",
+			doc: func() string {
+				a := defaultTestAssertion()
+				forged := defaultTestAssertion()
+				forged.NameID = "admin@example.com"
+				original := idp.sign(t, a.xml(), a.ID)
+				forgedXML := strings.Replace(forged.xml(), "</saml:Issuer>", "</saml:Issuer>"+
+					original[strings.Index(original, "<ds:Signature"):strings.Index(original, "</ds:Signature>")+len("</ds:Signature>")], 1)
+				return testResponse(testRequestID,
+					`<samlp:Extensions>`+original+`</samlp:Extensions>`+forgedXML)
+			}(),
+		},
+		{
+			name: "encrypted assertion",
+			doc:  testResponse(testRequestID, `<saml:EncryptedAssertion></saml:EncryptedAssertion>`),
+		},
+		{
+			name: "DTD",
+			doc:  `<!DOCTYPE foo [<!ENTITY x "y">]>` + signed(nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestID := tt.requestID
+			if requestID == "" {
+				requestID = testRequestID
+			}
+			_, err := sp.ParseResponse(encodeResponse(tt.doc), requestID)
+			if !errors.Is(err, ErrSAMLInvalidResponse) {
+				t.Fatalf("expected ErrSAMLInvalidResponse, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSAMLParseResponse_ErrorStatus(t *testing.T) {
+	idp := newTestIdP(t)
+	sp := newTestSP(t, idp)
+	doc := strings.Replace(testResponse(testRequestID, ""), "status:Success", "status:Requester", 1)
+	if _, err := sp.ParseResponse(encodeResponse(doc), testRequestID); !errors.Is(err, ErrSAMLInvalidResponse) {
+		t.Fatalf("expected ErrSAMLInvalidResponse, got %v", err)
+	}
+}
+
+type mockSAMLReplayStore struct {
+	consumed map[string]time.Time
+}
+
+func (m *mockSAMLReplayStore) ConsumeSAMLAssertion(_ context.Context, orgID uuid.UUID, assertionID string, expiresAt time.Time) (bool, error) {
+	key := orgID.String() + "/" + assertionID
+	if _, ok := m.consumed[key]; ok {
+		return false, nil
+	}
+	m.consumed[key] = expiresAt
+	return true, nil
+}
+
+func TestUseSAMLAssertion(t *testing.T) {
+	store := &mockSAMLReplayStore{consumed: make(map[string]time.Time)}
+	orgID := uuid.New()
+	a := &SAMLAssertion{ID: "_a", NotOnOrAfter: time.Now().Add(time.Minute)}
+
+	if err := UseSAMLAssertion(context.Background(), store, orgID, a); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := UseSAMLAssertion(context.Background(), store, orgID, a); !errors.Is(err, ErrSAMLReplay) {
+		t.Fatalf("expected ErrSAMLReplay, got %v", err)
+	}
+	if err := UseSAMLAssertion(context.Background(), store, orgID, &SAMLAssertion{ID: "_b", NotOnOrAfter: a.NotOnOrAfter}); err != nil {
+		t.Fatalf("other assertion: %v", err)
+	}
+	if exp := store.consumed[orgID.String()+"/_a"]; !exp.Equal(a.NotOnOrAfter.Add(SAMLMaxClockSkew)) {
+		t.Errorf("recorded expiry = %v, want NotOnOrAfter plus clock skew", exp)
+	}
+}
+
+func TestSAMLAuthnRequestURL(t *testing.T) {
+	idp := newTestIdP(t)
+	sp := newTestSP(t, idp)
+
+	redirect, err := sp.AuthnRequestURL(testRequestID, "relay-123")
+	if err != nil {
+		t.Fatalf("AuthnRequestURL() error: %v", err)
+	}
+	u, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+	if u.Scheme+"://"+u.Host+u.Path != testIdPSSOURL {
+		t.Errorf("redirect target = %s", u.String())
+	}
+
+	q := u.Query()
+	if q.Get("RelayState") != "relay-123" || q.Get("SigAlg") != dsig.RSASHA256SignatureMethod {
+		t.Errorf("unexpected query: %v", q)
+	}
+
+	// Verify the redirect binding signature against the SP certificate.
+	signed := "SAMLRequest=" + url.QueryEscape(q.Get("SAMLRequest")) +
+		"&RelayState=" + url.QueryEscape(q.Get("RelayState")) +
+		"&SigAlg=" + url.QueryEscape(q.Get("SigAlg"))
+	sig, err := base64.StdEncoding.DecodeString(q.Get("Signature"))
+	if err != nil {
+		t.Fatalf("decode signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(signed))
+	if err := rsa.VerifyPKCS1v15(sp.cert.PublicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], sig); err != nil {
+		t.Fatalf("AuthnRequest signature invalid: %v", err)
+	}
+
+	deflated, err := base64.StdEncoding.DecodeString(q.Get("SAMLRequest"))
+	if err != nil {
+		t.Fatalf("decode SAMLRequest: %v", err)
+	}
+	raw, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatalf("inflate SAMLRequest: %v", err)
+	}
+	req, err := parseSAMLXML(raw)
+	if err != nil {
+		t.Fatalf("parse AuthnRequest: %v", err)
+	}
+	if req.NamespaceURI() != SAMLProtocolNS || req.Tag != "AuthnRequest" {
+		t.Errorf("root = {%s}%s", req.NamespaceURI(), req.Tag)
+	}
+	if samlAttr(req, "ID") != testRequestID || samlAttr(req, "AssertionConsumerServiceURL") != testACSURL {
+		t.Errorf("unexpected AuthnRequest attributes: %s", raw)
+	}
+	if issuer := samlChild(req, SAMLAssertionNS, "Issuer"); issuer == nil || samlText(issuer) != testSPEntityID {
+		t.Errorf("unexpected issuer in %s", raw)
+	}
+}
+
+func TestSAMLMetadata(t *testing.T) {
+	sp := newTestSP(t, newTestIdP(t))
+	md, err := sp.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata() error: %v", err)
+	}
+	root, err := parseSAMLXML(md)
+	if err != nil {
+		t.Fatalf("parse metadata: %v\n%s", err, md)
+	}
+	if root.NamespaceURI() != SAMLMetadataNS || samlAttr(root, "entityID") != testSPEntityID {
+		t.Fatalf("unexpected metadata root: %s", md)
+	}
+	desc := samlChild(root, SAMLMetadataNS, "SPSSODescriptor")
+	if desc == nil || samlAttr(desc, "AuthnRequestsSigned") != "true" {
+		t.Fatalf("missing signed SPSSODescriptor: %s", md)
+	}
+	acs := samlChild(desc, SAMLMetadataNS, "AssertionConsumerService")
+	if acs == nil || samlAttr(acs, "Location") != testACSURL {
+		t.Fatalf("unexpected ACS: %s", md)
+	}
+}
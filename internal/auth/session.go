@@ -1,9 +1,14 @@
 package auth
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/gob"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -52,8 +57,22 @@ const (
 	OriginalUserEmailKey = "original_user_email"
 	// ImpersonationLogIDKey is the session key for the impersonation log ID.
 	ImpersonationLogIDKey = "impersonation_log_id"
+	// StepUpAtKey is the session key for the last successful re-authentication.
+	StepUpAtKey = "step_up_at"
+	// PendingMFAUserIDKey is the session key for a password login awaiting its second factor.
+	PendingMFAUserIDKey = "pending_mfa_user_id"
+	// PendingMFAAtKey is the session key for when the pending MFA login started.
+	PendingMFAAtKey = "pending_mfa_at"
+	// WebAuthnChallengeKey is the session key for the outstanding WebAuthn challenge.
+	WebAuthnChallengeKey = "webauthn_challenge"
+	// WebAuthnChallengeAtKey is the session key for when the WebAuthn challenge was issued.
+	WebAuthnChallengeAtKey = "webauthn_challenge_at"
 )
 
+// PendingMFATimeout bounds how long a password login may wait for its second
+// factor, and how long a WebAuthn challenge stays valid.
+const PendingMFATimeout = 5 * time.Minute
+
 // SessionConfig holds session store configuration.
 type SessionConfig struct {
 	Secret      []byte
@@ -89,6 +108,7 @@ func DefaultSessionConfig(secret []byte, secure bool, maxAge, idleTimeout int) S
 type SessionStore struct {
 	store       *sessions.CookieStore
 	idleTimeout time.Duration
+	relayKey    []byte
 	logger      zerolog.Logger
 }
 
@@ -110,6 +130,7 @@ func NewSessionStore(cfg SessionConfig, logger zerolog.Logger) (*SessionStore, e
 	s := &SessionStore{
 		store:       store,
 		idleTimeout: time.Duration(cfg.IdleTimeout) * time.Second,
+		relayKey:    deriveRelayKey(cfg.Secret),
 		logger:      logger.With().Str("component", "session").Logger(),
 	}
 
@@ -184,6 +205,8 @@ type SessionUser struct {
 	OriginalUserID     uuid.UUID // The original superuser ID (during impersonation)
 	OriginalUserEmail  string
 	ImpersonationLogID uuid.UUID
+	// StepUpAt is when the user last proved their identity (login or step-up).
+	StepUpAt time.Time
 }
 
 // IsImpersonating returns true if the user is being impersonated.
@@ -207,6 +230,7 @@ func (s *SessionStore) SetUser(r *http.Request, w http.ResponseWriter, user *Ses
 	session.Values[LastActivityKey] = time.Now()
 	session.Values[SessionRecordIDKey] = user.SessionRecordID
 	session.Values[IsSuperuserKey] = user.IsSuperuser
+	session.Values[StepUpAtKey] = user.StepUpAt
 
 	// Only store impersonation fields if actively impersonating.
 	// Clear them otherwise to prevent stale impersonation state.
@@ -258,6 +282,7 @@ func (s *SessionStore) GetUser(r *http.Request) (*SessionUser, error) {
 	impersonating, _ := session.Values[ImpersonatingKey].(bool)
 	originalUserEmail, _ := session.Values[OriginalUserEmailKey].(string)
 	impersonationLogID, _ := session.Values[ImpersonationLogIDKey].(uuid.UUID)
+	stepUpAt, _ := session.Values[StepUpAtKey].(time.Time)
 
 	return &SessionUser{
 		ID:                 userID,
@@ -274,6 +299,7 @@ func (s *SessionStore) GetUser(r *http.Request) (*SessionUser, error) {
 		OriginalUserID:     originalUserID,
 		OriginalUserEmail:  originalUserEmail,
 		ImpersonationLogID: impersonationLogID,
+		StepUpAt:           stepUpAt,
 	}, nil
 }
 
@@ -322,6 +348,7 @@ func (s *SessionStore) ClearUser(r *http.Request, w http.ResponseWriter) error {
 	delete(session.Values, IsSuperuserKey)
 	delete(session.Values, ImpersonatingUserIDKey)
 	delete(session.Values, OriginalUserIDKey)
+	delete(session.Values, StepUpAtKey)
 	// Set MaxAge to -1 to delete the cookie
 	session.Options.MaxAge = -1
 	return s.Save(r, w, session)
@@ -455,3 +482,145 @@ func (s *SessionStore) GetOriginalUserID(r *http.Request) uuid.UUID {
 	id, _ := session.Values[OriginalUserIDKey].(uuid.UUID)
 	return id
 }
+
+// SetStepUp records a successful re-authentication for step-up checks.
+func (s *SessionStore) SetStepUp(r *http.Request, w http.ResponseWriter, at time.Time) error {
+	session, err := s.Get(r)
+	if err != nil {
+		return err
+	}
+	session.Values[StepUpAtKey] = at
+	return s.Save(r, w, session)
+}
+
+// SetPendingMFA records a password login that still needs a second factor.
+func (s *SessionStore) SetPendingMFA(r *http.Request, w http.ResponseWriter, userID uuid.UUID) error {
+	session, err := s.Get(r)
+	if err != nil {
+		return err
+	}
+	session.Values[PendingMFAUserIDKey] = userID
+	session.Values[PendingMFAAtKey] = time.Now()
+	return s.Save(r, w, session)
+}
+
+// GetPendingMFA returns the user awaiting a second factor, if the pending login has not expired.
+func (s *SessionStore) GetPendingMFA(r *http.Request) (uuid.UUID, error) {
+	session, err := s.Get(r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	userID, ok := session.Values[PendingMFAUserIDKey].(uuid.UUID)
+	if !ok {
+		return uuid.Nil, fmt.Errorf("no pending MFA login")
+	}
+	startedAt, _ := session.Values[PendingMFAAtKey].(time.Time)
+	if time.Since(startedAt) > PendingMFATimeout {
+		return uuid.Nil, fmt.Errorf("pending MFA login expired")
+	}
+	return userID, nil
+}
+
+// ClearPendingMFA removes pending MFA login state.
+func (s *SessionStore) ClearPendingMFA(r *http.Request, w http.ResponseWriter) error {
+	session, err := s.Get(r)
+	if err != nil {
+		return err
+	}
+	delete(session.Values, PendingMFAUserIDKey)
+	delete(session.Values, PendingMFAAtKey)
+	return s.Save(r, w, session)
+}
+
+// SetWebAuthnChallenge stores the challenge for an in-progress WebAuthn ceremony.
+func (s *SessionStore) SetWebAuthnChallenge(r *http.Request, w http.ResponseWriter, challenge []byte) error {
+	session, err := s.Get(r)
+	if err != nil {
+		return err
+	}
+	session.Values[WebAuthnChallengeKey] = challenge
+	session.Values[WebAuthnChallengeAtKey] = time.Now()
+	return s.Save(r, w, session)
+}
+
+// TakeWebAuthnChallenge retrieves and clears the outstanding WebAuthn challenge,
+// so each challenge can be answered at most once.
+func (s *SessionStore) TakeWebAuthnChallenge(r *http.Request, w http.ResponseWriter) ([]byte, error) {
+	session, err := s.Get(r)
+	if err != nil {
+		return nil, err
+	}
+	challenge, ok := session.Values[WebAuthnChallengeKey].([]byte)
+	issuedAt, _ := session.Values[WebAuthnChallengeAtKey].(time.Time)
+	delete(session.Values, WebAuthnChallengeKey)
+	delete(session.Values, WebAuthnChallengeAtKey)
+	if err := s.Save(r, w, session); err != nil {
+		return nil, err
+	}
+	if !ok || len(challenge) == 0 {
+		return nil, fmt.Errorf("no webauthn challenge in session")
+	}
+	if time.Since(issuedAt) > PendingMFATimeout {
+		return nil, fmt.Errorf("webauthn challenge expired")
+	}
+	return challenge, nil
+}
+
+// deriveRelayKey derives the key used to sign SAML RelayState from the
+// session secret, so the two never share key material directly.
+func deriveRelayKey(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("keldris-saml-relay-state"))
+	return mac.Sum(nil)
+}
+
+// SignSAMLRelayState returns a RelayState value binding an outstanding
+// AuthnRequest to its organization. The session cookie is not sent on the
+// IdP's cross-site POST back to the ACS endpoint, so the pending request is
+// carried in the signed RelayState instead.
+func (s *SessionStore) SignSAMLRelayState(orgID uuid.UUID, requestID string) string {
+	payload := orgID.String() + "|" + requestID + "|" + strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, s.relayKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySAMLRelayState checks a RelayState produced by SignSAMLRelayState
+// and returns the organization and AuthnRequest ID it carries.
+func (s *SessionStore) VerifySAMLRelayState(relayState string) (uuid.UUID, string, error) {
+	encPayload, encMAC, ok := strings.Cut(relayState, ".")
+	if !ok {
+		return uuid.Nil, "", fmt.Errorf("malformed relay state")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encPayload)
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("malformed relay state")
+	}
+	gotMAC, err := base64.RawURLEncoding.DecodeString(encMAC)
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("malformed relay state")
+	}
+	mac := hmac.New(sha256.New, s.relayKey)
+	mac.Write(payload)
+	if !hmac.Equal(gotMAC, mac.Sum(nil)) {
+		return uuid.Nil, "", fmt.Errorf("invalid relay state signature")
+	}
+
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 3 {
+		return uuid.Nil, "", fmt.Errorf("malformed relay state")
+	}
+	orgID, err := uuid.Parse(parts[0])
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("malformed relay state")
+	}
+	issued, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("malformed relay state")
+	}
+	if time.Since(time.Unix(issued, 0)) > SAMLRequestTimeout {
+		return uuid.Nil, "", fmt.Errorf("SAML login request expired")
+	}
+	return orgID, parts[1], nil
+}
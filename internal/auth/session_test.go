@@ -209,6 +209,34 @@ func TestSessionStore_OIDCState(t *testing.T) {
 	}
 }
 
+func TestSessionStore_SAMLRelayState(t *testing.T) {
+	store := newTestSessionStore(t)
+	orgID := uuid.New()
+
+	relayState := store.SignSAMLRelayState(orgID, "_req123")
+	gotOrg, gotRequest, err := store.VerifySAMLRelayState(relayState)
+	if err != nil {
+		t.Fatalf("failed to verify relay state: %v", err)
+	}
+	if gotOrg != orgID || gotRequest != "_req123" {
+		t.Errorf("got (%s, %s), want (%s, _req123)", gotOrg, gotRequest, orgID)
+	}
+
+	// Tampered payload must be rejected
+	if _, _, err := store.VerifySAMLRelayState("x" + relayState); err == nil {
+		t.Error("expected error for tampered relay state")
+	}
+
+	// Relay state signed with another secret must be rejected
+	other, err := NewSessionStore(DefaultSessionConfig([]byte("another-secret-that-is-at-least-32-bytes"), false, 0, 0), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	if _, _, err := other.VerifySAMLRelayState(relayState); err == nil {
+		t.Error("expected error for relay state signed with another secret")
+	}
+}
+
 func TestSessionStore_User(t *testing.T) {
 	store := newTestSessionStore(t)
 
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// TOTPDigits is the number of digits in a TOTP code.
+	TOTPDigits = 6
+	// TOTPPeriod is the TOTP time step.
+	TOTPPeriod = 30 * time.Second
+	// TOTPSkew is the number of time steps accepted on either side of now.
+	TOTPSkew = 1
+	// totpSecretBytes is the size of generated TOTP secrets (160 bits per RFC 4226).
+	totpSecretBytes = 20
+	// RecoveryCodeCount is the number of recovery codes issued per user.
+	RecoveryCodeCount = 10
+)
+
+// totpEncoding is unpadded base32, the format authenticator apps expect.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret generates a new random base32-encoded TOTP secret.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("generate totp secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPProvisioningURI returns the otpauth:// URI used to enroll an authenticator app.
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", TOTPDigits))
+	params.Set("period", fmt.Sprintf("%d", int(TOTPPeriod.Seconds())))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// GenerateTOTPCode computes the RFC 6238 code for the given secret and time.
+func GenerateTOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(t.Unix())/uint64(TOTPPeriod.Seconds())), nil
+}
+
+// ValidateTOTPCode checks a code against the secret, allowing TOTPSkew steps of clock drift.
+func ValidateTOTPCode(secret, code string, t time.Time) bool {
+	_, ok := MatchTOTPCode(secret, code, t)
+	return ok
+}
+
+// MatchTOTPCode checks a code like ValidateTOTPCode and also returns the time
+// step it matched, so callers can reject replays of an already-used code.
+func MatchTOTPCode(secret, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	counter := TOTPStep(t)
+	for i := -TOTPSkew; i <= TOTPSkew; i++ {
+		c := counter + int64(i)
+		if c < 0 {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(key, uint64(c))), []byte(code)) == 1 {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPStep returns the TOTP time step containing t.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// decodeTOTPSecret decodes a base32 secret, tolerating lowercase and padding.
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	normalized := strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "="))
+	key, err := totpEncoding.DecodeString(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("decode totp secret: %w", err)
+	}
+	return key, nil
+}
+
+// hotp computes an RFC 4226 HOTP value.
+func hotp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod)
+}
+
+// GenerateRecoveryCodes generates single-use recovery codes in xxxxx-xxxxx format.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		raw, err := generateRandomCode(10)
+		if err != nil {
+			return nil, fmt.Errorf("generate recovery code: %w", err)
+		}
+		codes = append(codes, strings.ToLower(raw[:5]+"-"+raw[5:]))
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode returns the storage hash for a recovery code.
+// Codes are normalized so that case and dashes do not matter when redeeming.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key from RFC 6238 Appendix B, base32 encoded.
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestGenerateTOTPCode_RFC6238Vectors(t *testing.T) {
+	// RFC 6238 publishes 8-digit values; the 6-digit code is the low 6 digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := GenerateTOTPCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("GenerateTOTPCode(%d) error: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("GenerateTOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error: %v", err)
+	}
+	now := time.Now()
+	code, _ := GenerateTOTPCode(secret, now)
+
+	t.Run("current step", func(t *testing.T) {
+		if !ValidateTOTPCode(secret, code, now) {
+			t.Error("expected current code to validate")
+		}
+	})
+
+	t.Run("one step of drift", func(t *testing.T) {
+		if !ValidateTOTPCode(secret, code, now.Add(TOTPPeriod)) {
+			t.Error("expected code from previous step to validate")
+		}
+	})
+
+	t.Run("outside skew", func(t *testing.T) {
+		if ValidateTOTPCode(secret, code, now.Add(3*TOTPPeriod)) {
+			t.Error("expected code three steps old to be rejected")
+		}
+	})
+
+	t.Run("wrong length", func(t *testing.T) {
+		if ValidateTOTPCode(secret, code[:5], now) {
+			t.Error("expected short code to be rejected")
+		}
+	})
+
+	t.Run("lowercase secret", func(t *testing.T) {
+		if !ValidateTOTPCode(strings.ToLower(secret), code, now) {
+			t.Error("expected lowercase secret to be accepted")
+		}
+	})
+}
+
+func TestMatchTOTPCode_ReturnsStep(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := GenerateTOTPCode(rfc6238Secret, now.Add(-TOTPPeriod))
+
+	step, ok := MatchTOTPCode(rfc6238Secret, code, now)
+	if !ok {
+		t.Fatal("expected code to match")
+	}
+	if step != TOTPStep(now)-1 {
+		t.Errorf("step = %d, want %d", step, TOTPStep(now)-1)
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("Keldris", "alice@example.com", "ABCDEF")
+	if !strings.HasPrefix(uri, "otpauth://totp/Keldris:alice@example.com?") {
+		t.Errorf("unexpected URI prefix: %s", uri)
+	}
+	for _, want := range []string{"secret=ABCDEF", "issuer=Keldris", "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("URI %s missing %s", uri, want)
+		}
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("expected %d codes, got %d", RecoveryCodeCount, len(codes))
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected code format: %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCode_Normalizes(t *testing.T) {
+	want := HashRecoveryCode("abcde-fghij")
+	for _, input := range []string{"ABCDE-FGHIJ", "abcdefghij", " abcde-fghij "} {
+		if got := HashRecoveryCode(input); got != want {
+			t.Errorf("HashRecoveryCode(%q) did not normalize", input)
+		}
+	}
+	if HashRecoveryCode("abcde-fghik") == want {
+		t.Error("expected different codes to hash differently")
+	}
+}
@@ -0,0 +1,426 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+)
+
+// WebAuthn authenticator data flags.
+const (
+	webAuthnFlagUserPresent  = 0x01
+	webAuthnFlagUserVerified = 0x04
+	webAuthnFlagAttestedData = 0x40
+)
+
+// COSE algorithm identifiers supported for passkeys.
+const (
+	COSEAlgES256 = -7
+	COSEAlgEdDSA = -8
+	COSEAlgRS256 = -257
+)
+
+// webAuthnChallengeBytes is the size of generated ceremony challenges.
+const webAuthnChallengeBytes = 32
+
+// webAuthnTimeoutMs is the client-side ceremony timeout sent to browsers.
+const webAuthnTimeoutMs = 120000
+
+var (
+	// ErrWebAuthnChallengeMismatch is returned when the signed challenge is not the one issued.
+	ErrWebAuthnChallengeMismatch = errors.New("webauthn challenge mismatch")
+	// ErrWebAuthnOriginMismatch is returned when the ceremony came from an unexpected origin.
+	ErrWebAuthnOriginMismatch = errors.New("webauthn origin not allowed")
+	// ErrWebAuthnSignCount is returned when the authenticator counter moved backwards (possible clone).
+	ErrWebAuthnSignCount = errors.New("webauthn signature counter did not increase")
+)
+
+// b64url is the unpadded base64url encoding used throughout WebAuthn.
+var b64url = base64.RawURLEncoding
+
+// WebAuthnConfig identifies the relying party for WebAuthn ceremonies.
+type WebAuthnConfig struct {
+	// RPID is the relying party ID, normally the server's hostname.
+	RPID string
+	// RPName is the human-readable relying party name shown by authenticators.
+	RPName string
+	// Origins are the allowed origins (scheme://host[:port]) for ceremonies.
+	Origins []string
+}
+
+// WebAuthnCredential is a verified credential produced by a registration ceremony.
+type WebAuthnCredential struct {
+	ID        []byte
+	PublicKey []byte // PKIX DER encoded
+	Algorithm int
+	SignCount uint32
+	AAGUID    []byte
+}
+
+// WebAuthnCredentialDescriptor identifies an existing credential to the browser.
+type WebAuthnCredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// WebAuthnCreationOptions are the publicKey options passed to navigator.credentials.create().
+type WebAuthnCreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int                            `json:"timeout"`
+	Attestation            string                         `json:"attestation"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+}
+
+// WebAuthnRequestOptions are the publicKey options passed to navigator.credentials.get().
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	RPID             string                         `json:"rpId"`
+	Timeout          int                            `json:"timeout"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// NewWebAuthnChallenge generates a random ceremony challenge.
+func NewWebAuthnChallenge() ([]byte, error) {
+	challenge := make([]byte, webAuthnChallengeBytes)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("generate webauthn challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// NewWebAuthnCreationOptions builds registration options for a user.
+func NewWebAuthnCreationOptions(cfg WebAuthnConfig, challenge, userHandle []byte, userName, displayName string, existing [][]byte) *WebAuthnCreationOptions {
+	opts := &WebAuthnCreationOptions{
+		Challenge:   b64url.EncodeToString(challenge),
+		Timeout:     webAuthnTimeoutMs,
+		Attestation: "none",
+	}
+	opts.RP.ID = cfg.RPID
+	opts.RP.Name = cfg.RPName
+	opts.User.ID = b64url.EncodeToString(userHandle)
+	opts.User.Name = userName
+	opts.User.DisplayName = displayName
+	for _, alg := range []int{COSEAlgES256, COSEAlgEdDSA, COSEAlgRS256} {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int    `json:"alg"`
+		}{Type: "public-key", Alg: alg})
+	}
+	for _, id := range existing {
+		opts.ExcludeCredentials = append(opts.ExcludeCredentials, WebAuthnCredentialDescriptor{Type: "public-key", ID: b64url.EncodeToString(id)})
+	}
+	opts.AuthenticatorSelection.ResidentKey = "preferred"
+	opts.AuthenticatorSelection.UserVerification = "preferred"
+	return opts
+}
+
+// NewWebAuthnRequestOptions builds authentication options for a set of credentials.
+func NewWebAuthnRequestOptions(cfg WebAuthnConfig, challenge []byte, credentialIDs [][]byte) *WebAuthnRequestOptions {
+	opts := &WebAuthnRequestOptions{
+		Challenge:        b64url.EncodeToString(challenge),
+		RPID:             cfg.RPID,
+		Timeout:          webAuthnTimeoutMs,
+		UserVerification: "preferred",
+	}
+	for _, id := range credentialIDs {
+		opts.AllowCredentials = append(opts.AllowCredentials, WebAuthnCredentialDescriptor{Type: "public-key", ID: b64url.EncodeToString(id)})
+	}
+	return opts
+}
+
+// webAuthnClientData is the parsed clientDataJSON.
+type webAuthnClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// verifyClientData checks the type, challenge and origin of clientDataJSON.
+func (cfg WebAuthnConfig) verifyClientData(clientDataJSON []byte, expectedType string, challenge []byte) error {
+	var cd webAuthnClientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return fmt.Errorf("parse client data: %w", err)
+	}
+	if cd.Type != expectedType {
+		return fmt.Errorf("unexpected client data type %q", cd.Type)
+	}
+	got, err := b64url.DecodeString(cd.Challenge)
+	if err != nil || !bytes.Equal(got, challenge) {
+		return ErrWebAuthnChallengeMismatch
+	}
+	for _, o := range cfg.Origins {
+		if o == cd.Origin {
+			return nil
+		}
+	}
+	return ErrWebAuthnOriginMismatch
+}
+
+// webAuthnAuthData is the parsed authenticator data.
+type webAuthnAuthData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	COSEKey      map[interface{}]interface{}
+}
+
+// parseAuthData parses authenticator data, including attested credential data when present.
+func parseAuthData(data []byte) (*webAuthnAuthData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+	ad := &webAuthnAuthData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if ad.Flags&webAuthnFlagAttestedData == 0 {
+		return ad, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, errors.New("attested credential data too short")
+	}
+	ad.AAGUID = rest[:16]
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return nil, errors.New("credential ID truncated")
+	}
+	ad.CredentialID = rest[:idLen]
+
+	key, _, err := decodeCBOR(rest[idLen:])
+	if err != nil {
+		return nil, fmt.Errorf("decode credential public key: %w", err)
+	}
+	m, ok := key.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("credential public key is not a COSE map")
+	}
+	ad.COSEKey = m
+	return ad, nil
+}
+
+// checkRPIDHash verifies the authenticator scoped the credential to this relying party.
+func (cfg WebAuthnConfig) checkRPIDHash(hash []byte) error {
+	expected := sha256.Sum256([]byte(cfg.RPID))
+	if !bytes.Equal(hash, expected[:]) {
+		return errors.New("relying party ID hash mismatch")
+	}
+	return nil
+}
+
+// VerifyRegistration verifies a registration ceremony response and returns the new credential.
+// Attestation statements are not validated; Keldris requests "none" attestation.
+func (cfg WebAuthnConfig) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (*WebAuthnCredential, error) {
+	if err := cfg.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	obj, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("decode attestation object: %w", err)
+	}
+	att, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("attestation object is not a map")
+	}
+	authData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object missing authData")
+	}
+
+	ad, err := parseAuthData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkRPIDHash(ad.RPIDHash); err != nil {
+		return nil, err
+	}
+	if ad.Flags&webAuthnFlagUserPresent == 0 {
+		return nil, errors.New("user presence not asserted")
+	}
+	if ad.COSEKey == nil {
+		return nil, errors.New("no attested credential data")
+	}
+
+	pub, alg, err := parseCOSEKey(ad.COSEKey)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("marshal public key: %w", err)
+	}
+
+	return &WebAuthnCredential{
+		ID:        append([]byte(nil), ad.CredentialID...),
+		PublicKey: der,
+		Algorithm: alg,
+		SignCount: ad.SignCount,
+		AAGUID:    append([]byte(nil), ad.AAGUID...),
+	}, nil
+}
+
+// VerifyAssertion verifies an authentication ceremony response against a stored
+// credential and returns the authenticator's new signature counter.
+func (cfg WebAuthnConfig) VerifyAssertion(challenge []byte, cred *WebAuthnCredential, clientDataJSON, authenticatorData, signature []byte) (uint32, error) {
+	if err := cfg.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	ad, err := parseAuthData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := cfg.checkRPIDHash(ad.RPIDHash); err != nil {
+		return 0, err
+	}
+	if ad.Flags&webAuthnFlagUserPresent == 0 {
+		return 0, errors.New("user presence not asserted")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, fmt.Errorf("parse stored public key: %w", err)
+	}
+
+	clientHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorData...), clientHash[:]...)
+	if err := verifyWebAuthnSignature(pub, signed, signature); err != nil {
+		return 0, err
+	}
+
+	if (ad.SignCount != 0 || cred.SignCount != 0) && ad.SignCount <= cred.SignCount {
+		return 0, ErrWebAuthnSignCount
+	}
+	return ad.SignCount, nil
+}
+
+// verifyWebAuthnSignature verifies an assertion signature with the credential's key type.
+func verifyWebAuthnSignature(pub crypto.PublicKey, signed, signature []byte) error {
+	digest := sha256.Sum256(signed)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], signature) {
+			return errors.New("invalid assertion signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid assertion signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, signed, signature) {
+			return errors.New("invalid assertion signature")
+		}
+	default:
+		return errors.New("unsupported public key type")
+	}
+	return nil
+}
+
+// parseCOSEKey converts a COSE_Key map into a Go public key.
+func parseCOSEKey(m map[interface{}]interface{}) (crypto.PublicKey, int, error) {
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == COSEAlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, errors.New("invalid P-256 COSE key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, errors.New("P-256 point not on curve")
+		}
+		return pub, COSEAlgES256, nil
+	case kty == 1 && alg == COSEAlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, errors.New("invalid Ed25519 COSE key")
+		}
+		return ed25519.PublicKey(x), COSEAlgEdDSA, nil
+	case kty == 3 && alg == COSEAlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, errors.New("invalid RSA COSE key")
+		}
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, COSEAlgRS256, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported COSE key (kty=%d, alg=%d)", kty, alg)
+	}
+}
+
+// DecodeWebAuthnBase64 decodes a base64url value as sent by browsers, tolerating padding.
+func DecodeWebAuthnBase64(s string) ([]byte, error) {
+	if b, err := b64url.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
+
+// WebAuthnConfigFromURL derives the relying party from the server's public URL.
+// The RP ID is the URL's hostname and the URL's origin is always allowed;
+// extraOrigins (e.g. a separately hosted frontend) are allowed in addition.
+func WebAuthnConfigFromURL(serverURL, rpName string, extraOrigins []string) (WebAuthnConfig, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return WebAuthnConfig{}, fmt.Errorf("invalid server URL %q for webauthn", serverURL)
+	}
+	cfg := WebAuthnConfig{
+		RPID:    u.Hostname(),
+		RPName:  rpName,
+		Origins: []string{u.Scheme + "://" + u.Host},
+	}
+	for _, o := range extraOrigins {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o != "" && o != cfg.Origins[0] {
+			cfg.Origins = append(cfg.Origins, o)
+		}
+	}
+	return cfg, nil
+}
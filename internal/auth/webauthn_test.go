@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// cborHead encodes a CBOR initial byte and argument.
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	}
+}
+
+// cborInt encodes a (possibly negative) small integer.
+func cborInt(n int) []byte {
+	if n < 0 {
+		return cborHead(1, -1-n)
+	}
+	return cborHead(0, n)
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, len(b)), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, len(s)), s...) }
+
+// testAuthenticator is a software WebAuthn authenticator holding a P-256 key.
+type testAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	credID    []byte
+	signCount uint32
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return &testAuthenticator{key: key, credID: []byte("test-credential-id")}
+}
+
+func (a *testAuthenticator) coseKey() []byte {
+	x := a.key.PublicKey.X.FillBytes(make([]byte, 32))
+	y := a.key.PublicKey.Y.FillBytes(make([]byte, 32))
+	var b []byte
+	b = append(b, cborHead(5, 5)...)
+	b = append(b, cborInt(1)...)
+	b = append(b, cborInt(2)...) // kty: EC2
+	b = append(b, cborInt(3)...)
+	b = append(b, cborInt(COSEAlgES256)...)
+	b = append(b, cborInt(-1)...)
+	b = append(b, cborInt(1)...) // crv: P-256
+	b = append(b, cborInt(-2)...)
+	b = append(b, cborBytes(x)...)
+	b = append(b, cborInt(-3)...)
+	b = append(b, cborBytes(y)...)
+	return b
+}
+
+func (a *testAuthenticator) authData(rpID string, flags byte, attested bool) []byte {
+	rpHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte(nil), rpHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credID)))
+		data = append(data, a.credID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func clientDataJSON(t *testing.T, typ string, challenge []byte, origin string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": b64url.EncodeToString(challenge),
+		"origin":    origin,
+	})
+	if err != nil {
+		t.Fatalf("marshal client data: %v", err)
+	}
+	return data
+}
+
+func (a *testAuthenticator) register(t *testing.T, rpID string) []byte {
+	authData := a.authData(rpID, webAuthnFlagUserPresent|webAuthnFlagAttestedData, true)
+	var obj []byte
+	obj = append(obj, cborHead(5, 3)...)
+	obj = append(obj, cborText("fmt")...)
+	obj = append(obj, cborText("none")...)
+	obj = append(obj, cborText("attStmt")...)
+	obj = append(obj, cborHead(5, 0)...)
+	obj = append(obj, cborText("authData")...)
+	obj = append(obj, cborBytes(authData)...)
+	return obj
+}
+
+func (a *testAuthenticator) assert(t *testing.T, rpID string, clientData []byte) (authData, sig []byte) {
+	t.Helper()
+	a.signCount++
+	authData = a.authData(rpID, webAuthnFlagUserPresent|webAuthnFlagUserVerified, false)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("sign assertion: %v", err)
+	}
+	return authData, sig
+}
+
+var testWebAuthnConfig = WebAuthnConfig{
+	RPID:    "keldris.example.com",
+	RPName:  "Keldris",
+	Origins: []string{"https://keldris.example.com"},
+}
+
+func TestWebAuthn_RegisterAndAssert(t *testing.T) {
+	authr := newTestAuthenticator(t)
+	challenge, _ := NewWebAuthnChallenge()
+
+	cred, err := testWebAuthnConfig.VerifyRegistration(
+		challenge,
+		clientDataJSON(t, "webauthn.create", challenge, "https://keldris.example.com"),
+		authr.register(t, testWebAuthnConfig.RPID),
+	)
+	if err != nil {
+		t.Fatalf("VerifyRegistration() error: %v", err)
+	}
+	if string(cred.ID) != string(authr.credID) {
+		t.Errorf("credential ID = %q, want %q", cred.ID, authr.credID)
+	}
+	if cred.Algorithm != COSEAlgES256 {
+		t.Errorf("algorithm = %d, want %d", cred.Algorithm, COSEAlgES256)
+	}
+
+	loginChallenge, _ := NewWebAuthnChallenge()
+	cd := clientDataJSON(t, "webauthn.get", loginChallenge, "https://keldris.example.com")
+	authData, sig := authr.assert(t, testWebAuthnConfig.RPID, cd)
+
+	count, err := testWebAuthnConfig.VerifyAssertion(loginChallenge, cred, cd, authData, sig)
+	if err != nil {
+		t.Fatalf("VerifyAssertion() error: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("sign count = %d, want 1", count)
+	}
+
+	t.Run("replayed counter", func(t *testing.T) {
+		cred.SignCount = count
+		authr.signCount = 0
+		authData, sig := authr.assert(t, testWebAuthnConfig.RPID, cd)
+		if _, err := testWebAuthnConfig.VerifyAssertion(loginChallenge, cred, cd, authData, sig); !errors.Is(err, ErrWebAuthnSignCount) {
+			t.Errorf("expected ErrWebAuthnSignCount, got %v", err)
+		}
+	})
+
+	t.Run("tampered signature", func(t *testing.T) {
+		authData, sig := authr.assert(t, testWebAuthnConfig.RPID, cd)
+		sig[len(sig)-1] ^= 0xff
+		if _, err := testWebAuthnConfig.VerifyAssertion(loginChallenge, cred, cd, authData, sig); err == nil {
+			t.Error("expected tampered signature to be rejected")
+		}
+	})
+
+	t.Run("wrong challenge", func(t *testing.T) {
+		authData, sig := authr.assert(t, testWebAuthnConfig.RPID, cd)
+		other, _ := NewWebAuthnChallenge()
+		if _, err := testWebAuthnConfig.VerifyAssertion(other, cred, cd, authData, sig); !errors.Is(err, ErrWebAuthnChallengeMismatch) {
+			t.Errorf("expected ErrWebAuthnChallengeMismatch, got %v", err)
+		}
+	})
+
+	t.Run("wrong rp", func(t *testing.T) {
+		authData, sig := authr.assert(t, "evil.example.com", cd)
+		if _, err := testWebAuthnConfig.VerifyAssertion(loginChallenge, cred, cd, authData, sig); err == nil {
+			t.Error("expected RP ID mismatch to be rejected")
+		}
+	})
+}
+
+func TestWebAuthn_VerifyRegistration_Rejects(t *testing.T) {
+	authr := newTestAuthenticator(t)
+	challenge, _ := NewWebAuthnChallenge()
+	att := authr.register(t, testWebAuthnConfig.RPID)
+
+	t.Run("wrong origin", func(t *testing.T) {
+		cd := clientDataJSON(t, "webauthn.create", challenge, "https://evil.example.com")
+		if _, err := testWebAuthnConfig.VerifyRegistration(challenge, cd, att); !errors.Is(err, ErrWebAuthnOriginMismatch) {
+			t.Errorf("expected ErrWebAuthnOriginMismatch, got %v", err)
+		}
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		cd := clientDataJSON(t, "webauthn.get", challenge, "https://keldris.example.com")
+		if _, err := testWebAuthnConfig.VerifyRegistration(challenge, cd, att); err == nil {
+			t.Error("expected wrong ceremony type to be rejected")
+		}
+	})
+
+	t.Run("truncated attestation", func(t *testing.T) {
+		cd := clientDataJSON(t, "webauthn.create", challenge, "https://keldris.example.com")
+		if _, err := testWebAuthnConfig.VerifyRegistration(challenge, cd, att[:len(att)-10]); err == nil {
+			t.Error("expected truncated attestation to be rejected")
+		}
+	})
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	t.Run("nested map", func(t *testing.T) {
+		var b []byte
+		b = append(b, cborHead(5, 2)...)
+		b = append(b, cborInt(-7)...)
+		b = append(b, cborText("x")...)
+		b = append(b, cborText("list")...)
+		b = append(b, cborHead(4, 2)...)
+		b = append(b, cborInt(300)...)
+		b = append(b, 0xf5) // true
+
+		v, rest, err := decodeCBOR(b)
+		if err != nil {
+			t.Fatalf("decodeCBOR() error: %v", err)
+		}
+		if len(rest) != 0 {
+			t.Errorf("expected no remaining input, got %d bytes", len(rest))
+		}
+		m := v.(map[interface{}]interface{})
+		if m[int64(-7)] != "x" {
+			t.Errorf("m[-7] = %v, want x", m[int64(-7)])
+		}
+		list := m["list"].([]interface{})
+		if list[0] != int64(300) || list[1] != true {
+			t.Errorf("unexpected list %v", list)
+		}
+	})
+
+	t.Run("indefinite length rejected", func(t *testing.T) {
+		if _, _, err := decodeCBOR([]byte{0x9f, 0x01, 0xff}); err == nil {
+			t.Error("expected indefinite-length array to be rejected")
+		}
+	})
+
+	t.Run("oversized length rejected", func(t *testing.T) {
+		if _, _, err := decodeCBOR([]byte{0x5a, 0xff, 0xff, 0xff, 0xff}); err == nil {
+			t.Error("expected truncated byte string to be rejected")
+		}
+	})
+}
+
+func TestWebAuthnConfigFromURL(t *testing.T) {
+	cfg, err := WebAuthnConfigFromURL("https://backup.example.com:8443/app", "Keldris", []string{"https://ui.example.com/", ""})
+	if err != nil {
+		t.Fatalf("WebAuthnConfigFromURL() error: %v", err)
+	}
+	if cfg.RPID != "backup.example.com" {
+		t.Errorf("RPID = %q, want backup.example.com", cfg.RPID)
+	}
+	if len(cfg.Origins) != 2 || cfg.Origins[0] != "https://backup.example.com:8443" || cfg.Origins[1] != "https://ui.example.com" {
+		t.Errorf("unexpected origins %v", cfg.Origins)
+	}
+
+	if _, err := WebAuthnConfigFromURL("not a url", "Keldris", nil); err == nil {
+		t.Error("expected invalid URL to be rejected")
+	}
+}
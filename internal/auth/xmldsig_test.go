@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseSAMLXML_RejectsDTD(t *testing.T) {
+	for _, doc := range []string{
+		`<!DOCTYPE a [<!ENTITY e "x">]><a>&e;</a>`,
+		`<!DOCTYPE a [<!ENTITY e "x">]><a>x</a>`,
+	} {
+		if _, err := parseSAMLXML([]byte(doc)); err == nil {
+			t.Errorf("expected error for document with DTD: %s", doc)
+		}
+	}
+}
+
+func TestVerifySAMLSignature(t *testing.T) {
+	current, next := newTestIdP(t), newTestIdP(t)
+	a := defaultTestAssertion()
+	certs := append(mustParseCerts(t, current.certPEM), mustParseCerts(t, next.certPEM)...)
+
+	t.Run("any certificate during rollover", func(t *testing.T) {
+		for _, idp := range []*testIdP{current, next} {
+			el, err := parseSAMLXML([]byte(idp.sign(t, a.xml(), a.ID)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			signed, err := verifySAMLSignature(el, certs, time.Now())
+			if err != nil {
+				t.Fatalf("verifySAMLSignature() error: %v", err)
+			}
+			if samlChild(signed, xmlDSigNS, "Signature") != nil {
+				t.Error("signed content still carries the signature")
+			}
+		}
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		el, err := parseSAMLXML([]byte(a.xml()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifySAMLSignature(el, certs, time.Now()); !errors.Is(err, errXMLNotSigned) {
+			t.Fatalf("expected errXMLNotSigned, got %v", err)
+		}
+	})
+
+	t.Run("untrusted key", func(t *testing.T) {
+		el, err := parseSAMLXML([]byte(newTestIdP(t).sign(t, a.xml(), a.ID)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifySAMLSignature(el, certs, time.Now()); !errors.Is(err, errXMLInvalidSig) {
+			t.Fatalf("expected errXMLInvalidSig, got %v", err)
+		}
+	})
+}
+
+func mustParseCerts(t *testing.T, pemData string) []*x509.Certificate {
+	t.Helper()
+	certs, err := ParseSAMLCertificates(pemData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certs
+}
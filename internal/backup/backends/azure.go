@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -23,6 +24,11 @@ type AzureBackend struct {
 	ContainerName string `json:"container_name"`
 	Endpoint      string `json:"endpoint,omitempty"`
 	Prefix        string `json:"prefix,omitempty"`
+	// CredentialMode is static (default) or ambient. Ambient credentials use
+	// the managed identity or workload identity of the machine running restic.
+	CredentialMode CredentialMode `json:"credential_mode,omitempty"`
+	// ClientID selects a user-assigned managed identity in ambient mode.
+	ClientID string `json:"client_id,omitempty"`
 }
 
 // Type returns the repository type.
@@ -40,7 +46,16 @@ func (b *AzureBackend) ToResticConfig(password string) ResticConfig {
 
 	env := map[string]string{
 		"AZURE_ACCOUNT_NAME": b.AccountName,
-		"AZURE_ACCOUNT_KEY":  b.AccountKey,
+	}
+
+	// Without an account key restic falls back to the Azure default
+	// credential chain, which covers managed and workload identity.
+	if b.CredentialMode == CredentialModeAmbient {
+		if b.ClientID != "" {
+			env["AZURE_CLIENT_ID"] = b.ClientID
+		}
+	} else {
+		env["AZURE_ACCOUNT_KEY"] = b.AccountKey
 	}
 
 	if b.Endpoint != "" {
@@ -59,13 +74,25 @@ func (b *AzureBackend) Validate() error {
 	if b.AccountName == "" {
 		return errors.New("azure backend: account_name is required")
 	}
-	if b.AccountKey == "" {
-		return errors.New("azure backend: account_key is required")
-	}
 	if b.ContainerName == "" {
 		return errors.New("azure backend: container_name is required")
 	}
 
+	mode, err := resolveCredentialMode("azure", b.CredentialMode, CredentialModeStatic, CredentialModeAmbient)
+	if err != nil {
+		return err
+	}
+	if mode == CredentialModeAmbient {
+		if b.AccountKey != "" {
+			return errors.New("azure backend: account_key must not be set with ambient credentials")
+		}
+		return checkAmbientAllowed("azure")
+	}
+
+	if b.AccountKey == "" {
+		return errors.New("azure backend: account_key is required")
+	}
+
 	// Validate that the account key is valid base64
 	if _, err := base64.StdEncoding.DecodeString(b.AccountKey); err != nil {
 		return fmt.Errorf("azure backend: account_key is not valid base64: %w", err)
@@ -100,12 +127,23 @@ func (b *AzureBackend) TestConnection() error {
 	req.Header.Set("x-ms-date", now)
 	req.Header.Set("x-ms-version", "2020-10-02")
 
-	// Sign the request with SharedKey
-	authHeader, err := b.signRequest(req, host)
-	if err != nil {
-		return fmt.Errorf("azure backend: failed to sign request: %w", err)
+	if b.CredentialMode == CredentialModeAmbient {
+		token, err := b.ambientToken(ctx)
+		if err != nil {
+			return fmt.Errorf("azure backend: failed to resolve ambient credentials: %w", err)
+		}
+		if token == "" {
+			return nil
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		// Sign the request with SharedKey
+		authHeader, err := b.signRequest(req, host)
+		if err != nil {
+			return fmt.Errorf("azure backend: failed to sign request: %w", err)
+		}
+		req.Header.Set("Authorization", authHeader)
 	}
-	req.Header.Set("Authorization", authHeader)
 
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
@@ -127,6 +165,19 @@ func (b *AzureBackend) TestConnection() error {
 	return nil
 }
 
+// ambientToken resolves a storage access token from the machine's identity.
+// With workload identity the federated token can only be exchanged through
+// Entra ID, so only its presence is checked and an empty token is returned.
+func (b *AzureBackend) ambientToken(ctx context.Context) (string, error) {
+	if path := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); path != "" {
+		if err := checkTokenFile(path); err != nil {
+			return "", err
+		}
+		return "", nil
+	}
+	return azureManagedIdentityToken(ctx, b.ClientID)
+}
+
 // signRequest creates a SharedKey authorization header for an Azure Storage request.
 func (b *AzureBackend) signRequest(req *http.Request, host string) (string, error) {
 	// Decode the account key
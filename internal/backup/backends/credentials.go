@@ -0,0 +1,147 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// CredentialMode selects how a cloud backend authenticates to its provider.
+type CredentialMode string
+
+const (
+	// CredentialModeStatic uses long-lived keys stored in the repository config.
+	CredentialModeStatic CredentialMode = "static"
+	// CredentialModeAmbient uses the identity of the machine running restic:
+	// EC2 instance profiles, EKS IRSA and other web identity tokens, GCE and
+	// GKE workload identity, or Azure managed identity. No secrets are stored.
+	CredentialModeAmbient CredentialMode = "ambient"
+	// CredentialModeAssumeRole assumes an AWS IAM role, optionally with an
+	// external ID, on top of static or ambient base credentials.
+	CredentialModeAssumeRole CredentialMode = "assume_role"
+)
+
+// ambientCredentialsAllowed reports whether repositories may fall back to the
+// identity of the machine running restic. Connection tests and maintenance
+// run on the server, so this would let any organization act as the server's
+// own cloud identity; it is off unless the operator opts in.
+var ambientCredentialsAllowed atomic.Bool
+
+// SetAmbientCredentialsAllowed enables credential modes that use the machine
+// identity: ambient, and S3 assume_role without stored keys.
+func SetAmbientCredentialsAllowed(allowed bool) {
+	ambientCredentialsAllowed.Store(allowed)
+}
+
+// checkAmbientAllowed returns an error unless ambient credentials are enabled.
+func checkAmbientAllowed(backend string) error {
+	if !ambientCredentialsAllowed.Load() {
+		return fmt.Errorf("%s backend: ambient credentials are not enabled on this server", backend)
+	}
+	return nil
+}
+
+// resolveCredentialMode validates a configured mode, treating an empty mode as
+// static so existing repository configs keep working.
+func resolveCredentialMode(backend string, mode CredentialMode, allowed ...CredentialMode) (CredentialMode, error) {
+	if mode == "" {
+		mode = CredentialModeStatic
+	}
+	for _, m := range allowed {
+		if mode == m {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("%s backend: unsupported credential_mode %q", backend, mode)
+}
+
+// metadataClient is used for instance metadata requests. Metadata services
+// are link-local and answer quickly, so a short timeout keeps connection
+// tests from hanging off-cloud.
+var metadataClient = &http.Client{Timeout: 5 * time.Second}
+
+// gceMetadataHost returns the GCE metadata server host, honouring the
+// GCE_METADATA_HOST override used by Google's client libraries.
+func gceMetadataHost() string {
+	if host := os.Getenv("GCE_METADATA_HOST"); host != "" {
+		return host
+	}
+	return "metadata.google.internal"
+}
+
+// gceAccessToken fetches an access token for the instance's default service
+// account from the GCE metadata server.
+func gceAccessToken(ctx context.Context) (string, error) {
+	reqURL := fmt.Sprintf("http://%s/computeMetadata/v1/instance/service-accounts/default/token", gceMetadataHost())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return fetchMetadataToken(req)
+}
+
+// azureIMDSTokenURL is the Azure Instance Metadata Service token endpoint.
+var azureIMDSTokenURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// azureManagedIdentityToken fetches a storage access token for the VM's
+// managed identity. clientID selects a user-assigned identity.
+func azureManagedIdentityToken(ctx context.Context, clientID string) (string, error) {
+	query := url.Values{}
+	query.Set("api-version", "2018-02-01")
+	query.Set("resource", "https://storage.azure.com/")
+	if clientID != "" {
+		query.Set("client_id", clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, azureIMDSTokenURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	return fetchMetadataToken(req)
+}
+
+// fetchMetadataToken performs a metadata token request and returns the
+// access_token from the JSON response.
+func fetchMetadataToken(req *http.Request) (string, error) {
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("metadata service unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("metadata service returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decode metadata token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("metadata service returned an empty token")
+	}
+	return token.AccessToken, nil
+}
+
+// checkTokenFile verifies a federated identity token file can be read.
+func checkTokenFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read identity token file: %w", err)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("identity token file %s is empty", path)
+	}
+	return nil
+}
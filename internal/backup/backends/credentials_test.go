@@ -0,0 +1,480 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// isolateAWSEnv clears credential sources the AWS SDK would otherwise pick up
+// from the test machine.
+func isolateAWSEnv(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	for _, key := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		"AWS_EC2_METADATA_DISABLED",
+	} {
+		t.Setenv(key, "")
+	}
+}
+
+// allowAmbientCredentials enables ambient credential modes for the test.
+func allowAmbientCredentials(t *testing.T) {
+	t.Helper()
+	SetAmbientCredentialsAllowed(true)
+	t.Cleanup(func() { SetAmbientCredentialsAllowed(false) })
+}
+
+// newIMDSStub starts an EC2 instance metadata service stand-in that vends the
+// given access key for the "keldris-agent" instance role.
+func newIMDSStub(t *testing.T, accessKey string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+			fmt.Fprint(w, "imds-token")
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprint(w, "keldris-agent")
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/keldris-agent":
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"Code":            "Success",
+				"Type":            "AWS-HMAC",
+				"AccessKeyId":     accessKey,
+				"SecretAccessKey": "instance-secret",
+				"Token":           "instance-session",
+				"Expiration":      "2099-01-01T00:00:00Z",
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", server.URL)
+}
+
+// newS3Stub starts a fake S3 endpoint recording the access key used to sign
+// each request.
+func newS3Stub(t *testing.T) (*httptest.Server, *string) {
+	t.Helper()
+	var signedWith string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, after, ok := strings.Cut(r.Header.Get("Authorization"), "Credential="); ok {
+			signedWith, _, _ = strings.Cut(after, "/")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &signedWith
+}
+
+func TestS3Backend_CredentialModeValidate(t *testing.T) {
+	allowAmbientCredentials(t)
+
+	tests := []struct {
+		name    string
+		backend S3Backend
+		errMsg  string
+	}{
+		{
+			name:    "ambient without keys",
+			backend: S3Backend{Bucket: "b", CredentialMode: CredentialModeAmbient},
+		},
+		{
+			name:    "ambient rejects stored keys",
+			backend: S3Backend{Bucket: "b", CredentialMode: CredentialModeAmbient, AccessKeyID: "AKIA"},
+			errMsg:  "access keys must not be set",
+		},
+		{
+			name:    "assume role on ambient credentials",
+			backend: S3Backend{Bucket: "b", CredentialMode: CredentialModeAssumeRole, RoleARN: "arn:aws:iam::123456789012:role/backup"},
+		},
+		{
+			name:    "assume role requires role arn",
+			backend: S3Backend{Bucket: "b", CredentialMode: CredentialModeAssumeRole, RoleARN: "backup"},
+			errMsg:  "role_arn is required",
+		},
+		{
+			name: "assume role requires complete key pair",
+			backend: S3Backend{
+				Bucket: "b", CredentialMode: CredentialModeAssumeRole,
+				RoleARN: "arn:aws:iam::123456789012:role/backup", AccessKeyID: "AKIA",
+			},
+			errMsg: "must be set together",
+		},
+		{
+			name: "assume role with aws sts endpoint",
+			backend: S3Backend{
+				Bucket: "b", CredentialMode: CredentialModeAssumeRole,
+				RoleARN: "arn:aws:iam::123456789012:role/backup", STSEndpoint: "https://sts.eu-west-1.amazonaws.com",
+			},
+		},
+		{
+			name: "assume role with vpc sts endpoint",
+			backend: S3Backend{
+				Bucket: "b", CredentialMode: CredentialModeAssumeRole,
+				RoleARN:     "arn:aws:iam::123456789012:role/backup",
+				STSEndpoint: "https://vpce-0123456789abcdef-abcdefgh.sts.eu-west-1.vpce.amazonaws.com",
+			},
+		},
+		{
+			name: "assume role rejects other sts hosts",
+			backend: S3Backend{
+				Bucket: "b", CredentialMode: CredentialModeAssumeRole,
+				RoleARN: "arn:aws:iam::123456789012:role/backup", STSEndpoint: "https://sts.amazonaws.com.attacker.example",
+			},
+			errMsg: "sts_endpoint must be an https AWS STS endpoint",
+		},
+		{
+			name: "assume role rejects plain http sts endpoint",
+			backend: S3Backend{
+				Bucket: "b", CredentialMode: CredentialModeAssumeRole,
+				RoleARN: "arn:aws:iam::123456789012:role/backup", STSEndpoint: "http://sts.amazonaws.com",
+			},
+			errMsg: "sts_endpoint must be an https AWS STS endpoint",
+		},
+		{
+			name:    "unknown mode",
+			backend: S3Backend{Bucket: "b", CredentialMode: "sso"},
+			errMsg:  "unsupported credential_mode",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.backend.Validate()
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestAmbientCredentials_DisabledByDefault(t *testing.T) {
+	role := "arn:aws:iam::123456789012:role/backup"
+	tests := []struct {
+		name    string
+		backend Backend
+		wantErr bool
+	}{
+		{"s3 ambient", &S3Backend{Bucket: "b", CredentialMode: CredentialModeAmbient}, true},
+		{"s3 assume role on ambient credentials", &S3Backend{Bucket: "b", CredentialMode: CredentialModeAssumeRole, RoleARN: role}, true},
+		{"s3 assume role on stored keys", &S3Backend{
+			Bucket: "b", CredentialMode: CredentialModeAssumeRole, RoleARN: role,
+			AccessKeyID: "AKIA", SecretAccessKey: "secret",
+		}, false},
+		{"gcs ambient", &GCSBackend{BucketName: "b", ProjectID: "p", CredentialMode: CredentialModeAmbient}, true},
+		{"azure ambient", &AzureBackend{AccountName: "a", ContainerName: "c", CredentialMode: CredentialModeAmbient}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.backend.Validate()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "ambient credentials are not enabled") {
+					t.Errorf("Validate() error = %v, want ambient credentials disabled", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestS3Backend_CredentialModeResticEnv(t *testing.T) {
+	t.Run("ambient omits keys", func(t *testing.T) {
+		b := &S3Backend{Bucket: "b", Region: "eu-west-1", CredentialMode: CredentialModeAmbient}
+		env := b.ToResticConfig("pw").Env
+		if _, ok := env["AWS_ACCESS_KEY_ID"]; ok {
+			t.Error("ambient mode should not set AWS_ACCESS_KEY_ID")
+		}
+		if env["AWS_DEFAULT_REGION"] != "eu-west-1" {
+			t.Errorf("AWS_DEFAULT_REGION = %q", env["AWS_DEFAULT_REGION"])
+		}
+	})
+
+	t.Run("assume role", func(t *testing.T) {
+		b := &S3Backend{
+			Bucket:         "b",
+			Region:         "eu-west-1",
+			CredentialMode: CredentialModeAssumeRole,
+			RoleARN:        "arn:aws:iam::123456789012:role/backup",
+			ExternalID:     "tenant-42",
+			STSEndpoint:    "https://sts.eu-west-1.amazonaws.com",
+		}
+		env := b.ToResticConfig("pw").Env
+		want := map[string]string{
+			"RESTIC_AWS_ASSUME_ROLE_ARN":          b.RoleARN,
+			"RESTIC_AWS_ASSUME_ROLE_EXTERNAL_ID":  "tenant-42",
+			"RESTIC_AWS_ASSUME_ROLE_SESSION_NAME": "keldris",
+			"RESTIC_AWS_ASSUME_ROLE_REGION":       "eu-west-1",
+			"RESTIC_AWS_ASSUME_ROLE_STS_ENDPOINT": b.STSEndpoint,
+		}
+		for k, v := range want {
+			if env[k] != v {
+				t.Errorf("%s = %q, want %q", k, env[k], v)
+			}
+		}
+		if _, ok := env["AWS_ACCESS_KEY_ID"]; ok {
+			t.Error("assume role on ambient credentials should not set AWS_ACCESS_KEY_ID")
+		}
+	})
+}
+
+func TestS3Backend_TestConnection_InstanceMetadata(t *testing.T) {
+	isolateAWSEnv(t)
+	allowAmbientCredentials(t)
+	newIMDSStub(t, "ASIAINSTANCE")
+	s3Server, signedWith := newS3Stub(t)
+
+	b := &S3Backend{
+		Endpoint:       s3Server.URL,
+		Bucket:         "test-bucket",
+		Region:         "us-east-1",
+		CredentialMode: CredentialModeAmbient,
+	}
+	if err := b.TestConnection(); err != nil {
+		t.Fatalf("TestConnection() error = %v", err)
+	}
+	if *signedWith != "ASIAINSTANCE" {
+		t.Errorf("request signed with %q, want instance credentials", *signedWith)
+	}
+}
+
+func TestS3Backend_TestConnection_AmbientUnavailable(t *testing.T) {
+	isolateAWSEnv(t)
+	allowAmbientCredentials(t)
+	imds := httptest.NewServer(http.NotFoundHandler())
+	defer imds.Close()
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds.URL)
+	s3Server, _ := newS3Stub(t)
+
+	b := &S3Backend{
+		Endpoint:       s3Server.URL,
+		Bucket:         "test-bucket",
+		Region:         "us-east-1",
+		CredentialMode: CredentialModeAmbient,
+	}
+	err := b.TestConnection()
+	if err == nil || !strings.Contains(err.Error(), "failed to resolve ambient credentials") {
+		t.Errorf("TestConnection() error = %v, want credential resolution failure", err)
+	}
+}
+
+func TestS3Backend_TestConnection_AssumeRole(t *testing.T) {
+	isolateAWSEnv(t)
+	allowAmbientCredentials(t)
+	newIMDSStub(t, "ASIAINSTANCE")
+	s3Server, signedWith := newS3Stub(t)
+
+	var externalID, sourceKey string
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.Form.Get("Action") != "AssumeRole" {
+			http.Error(w, "unexpected action", http.StatusBadRequest)
+			return
+		}
+		externalID = r.Form.Get("ExternalId")
+		if _, after, ok := strings.Cut(r.Header.Get("Authorization"), "Credential="); ok {
+			sourceKey, _, _ = strings.Cut(after, "/")
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAASSUMED</AccessKeyId>
+      <SecretAccessKey>assumed-secret</SecretAccessKey>
+      <SessionToken>assumed-session</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::123456789012:assumed-role/backup/keldris</Arn>
+      <AssumedRoleId>AROA:keldris</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`)
+	}))
+	defer sts.Close()
+	// The stub STS endpoint is local, so skip the AWS host check.
+	orig := validateSTSEndpoint
+	validateSTSEndpoint = func(string) error { return nil }
+	defer func() { validateSTSEndpoint = orig }()
+
+	b := &S3Backend{
+		Endpoint:       s3Server.URL,
+		Bucket:         "test-bucket",
+		Region:         "us-east-1",
+		CredentialMode: CredentialModeAssumeRole,
+		RoleARN:        "arn:aws:iam::123456789012:role/backup",
+		ExternalID:     "tenant-42",
+		STSEndpoint:    sts.URL,
+	}
+	if err := b.TestConnection(); err != nil {
+		t.Fatalf("TestConnection() error = %v", err)
+	}
+	if sourceKey != "ASIAINSTANCE" {
+		t.Errorf("AssumeRole signed with %q, want instance credentials", sourceKey)
+	}
+	if externalID != "tenant-42" {
+		t.Errorf("ExternalId = %q, want tenant-42", externalID)
+	}
+	if *signedWith != "ASIAASSUMED" {
+		t.Errorf("request signed with %q, want assumed role credentials", *signedWith)
+	}
+}
+
+func TestGCSBackend_AmbientCredentials(t *testing.T) {
+	allowAmbientCredentials(t)
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+
+	b := &GCSBackend{BucketName: "b", ProjectID: "p", CredentialMode: CredentialModeAmbient}
+	if _, ok := b.ToResticConfig("pw").Env["GOOGLE_APPLICATION_CREDENTIALS"]; ok {
+		t.Error("ambient mode should not set GOOGLE_APPLICATION_CREDENTIALS")
+	}
+
+	t.Run("rejects stored credentials", func(t *testing.T) {
+		withFile := &GCSBackend{BucketName: "b", ProjectID: "p", CredentialMode: CredentialModeAmbient, CredentialsFile: "/key.json"}
+		if err := withFile.Validate(); err == nil {
+			t.Error("expected error for credentials with ambient mode")
+		}
+		assume := &GCSBackend{BucketName: "b", ProjectID: "p", CredentialMode: CredentialModeAssumeRole}
+		if err := assume.Validate(); err == nil {
+			t.Error("expected error for assume_role mode")
+		}
+	})
+
+	t.Run("metadata server", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`)
+		}))
+		defer server.Close()
+		t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+
+		if err := b.TestConnection(); err != nil {
+			t.Errorf("TestConnection() error = %v", err)
+		}
+	})
+
+	t.Run("metadata server unavailable", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+		t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+
+		if err := b.TestConnection(); err == nil {
+			t.Error("expected error when metadata server has no identity")
+		}
+	})
+
+	t.Run("workload identity file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "adc.json")
+		if err := os.WriteFile(path, []byte(`{"type":"external_account"}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+
+		if err := b.TestConnection(); err != nil {
+			t.Errorf("TestConnection() error = %v", err)
+		}
+	})
+}
+
+func TestAzureBackend_AmbientCredentials(t *testing.T) {
+	allowAmbientCredentials(t)
+	b := &AzureBackend{
+		AccountName:    "keldris",
+		ContainerName:  "backups",
+		CredentialMode: CredentialModeAmbient,
+		ClientID:       "00000000-0000-0000-0000-000000000001",
+	}
+	if err := b.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	env := b.ToResticConfig("pw").Env
+	if _, ok := env["AZURE_ACCOUNT_KEY"]; ok {
+		t.Error("ambient mode should not set AZURE_ACCOUNT_KEY")
+	}
+	if env["AZURE_CLIENT_ID"] != b.ClientID {
+		t.Errorf("AZURE_CLIENT_ID = %q", env["AZURE_CLIENT_ID"])
+	}
+
+	withKey := *b
+	withKey.AccountKey = "dGVzdA=="
+	if err := withKey.Validate(); err == nil {
+		t.Error("expected error for account_key with ambient mode")
+	}
+
+	t.Run("managed identity token", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			if r.Header.Get("Metadata") != "true" || q.Get("resource") != "https://storage.azure.com/" || q.Get("client_id") != b.ClientID {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"eyJ0eXAi","token_type":"Bearer"}`)
+		}))
+		defer server.Close()
+		orig := azureIMDSTokenURL
+		azureIMDSTokenURL = server.URL
+		defer func() { azureIMDSTokenURL = orig }()
+		t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+
+		token, err := b.ambientToken(context.Background())
+		if err != nil || token != "eyJ0eXAi" {
+			t.Errorf("ambientToken() = %q, %v", token, err)
+		}
+	})
+
+	t.Run("no managed identity", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error":"invalid_request","error_description":"Identity not found"}`, http.StatusBadRequest)
+		}))
+		defer server.Close()
+		orig := azureIMDSTokenURL
+		azureIMDSTokenURL = server.URL
+		defer func() { azureIMDSTokenURL = orig }()
+		t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+
+		err := b.TestConnection()
+		if err == nil || !strings.Contains(err.Error(), "failed to resolve ambient credentials") {
+			t.Errorf("TestConnection() error = %v, want credential resolution failure", err)
+		}
+	})
+
+	t.Run("workload identity", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "token")
+		t.Setenv("AZURE_FEDERATED_TOKEN_FILE", path)
+		if err := b.TestConnection(); err == nil {
+			t.Error("expected error for missing federated token file")
+		}
+
+		if err := os.WriteFile(path, []byte("eyJhbGci"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.TestConnection(); err != nil {
+			t.Errorf("TestConnection() error = %v", err)
+		}
+	})
+}
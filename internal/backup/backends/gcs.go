@@ -1,11 +1,13 @@
 package backends
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/MacJediWizard/keldris/internal/models"
 )
@@ -17,6 +19,10 @@ type GCSBackend struct {
 	ProjectID       string `json:"project_id"`
 	CredentialsJSON string `json:"credentials_json,omitempty"` // base64-encoded service account JSON
 	CredentialsFile string `json:"credentials_file,omitempty"` // path to credentials file
+	// CredentialMode is static (default) or ambient. Ambient credentials use
+	// Application Default Credentials: GCE/GKE workload identity or a
+	// GOOGLE_APPLICATION_CREDENTIALS file on the machine running restic.
+	CredentialMode CredentialMode `json:"credential_mode,omitempty"`
 }
 
 // Type returns the repository type.
@@ -37,8 +43,12 @@ func (b *GCSBackend) ToResticConfig(password string) ResticConfig {
 		"RESTIC_PASSWORD":   password,
 	}
 
-	// If base64-encoded credentials JSON is provided, decode it and write to a temp file
-	if b.CredentialsJSON != "" {
+	// Ambient credentials are resolved by restic through Application Default
+	// Credentials, so no credentials file is passed.
+	switch {
+	case b.CredentialMode == CredentialModeAmbient:
+	case b.CredentialsJSON != "":
+		// If base64-encoded credentials JSON is provided, decode it and write to a temp file
 		decoded, err := base64.StdEncoding.DecodeString(b.CredentialsJSON)
 		if err == nil {
 			tmpDir := os.TempDir()
@@ -47,7 +57,7 @@ func (b *GCSBackend) ToResticConfig(password string) ResticConfig {
 				env["GOOGLE_APPLICATION_CREDENTIALS"] = credFile
 			}
 		}
-	} else if b.CredentialsFile != "" {
+	case b.CredentialsFile != "":
 		env["GOOGLE_APPLICATION_CREDENTIALS"] = b.CredentialsFile
 	}
 
@@ -66,13 +76,46 @@ func (b *GCSBackend) Validate() error {
 	if b.ProjectID == "" {
 		return errors.New("gcs backend: project_id is required")
 	}
+
+	mode, err := resolveCredentialMode("gcs", b.CredentialMode, CredentialModeStatic, CredentialModeAmbient)
+	if err != nil {
+		return err
+	}
+
+	if mode == CredentialModeAmbient {
+		if b.CredentialsJSON != "" || b.CredentialsFile != "" {
+			return errors.New("gcs backend: credentials must not be set with ambient credentials")
+		}
+		return checkAmbientAllowed("gcs")
+	}
 	if b.CredentialsJSON == "" && b.CredentialsFile == "" {
 		return errors.New("gcs backend: either credentials_json or credentials_file is required")
 	}
 	return nil
 }
 
-// TestConnection validates the GCS backend configuration.
+// TestConnection validates the GCS backend configuration. In ambient mode it
+// also checks that Application Default Credentials can be resolved.
 func (b *GCSBackend) TestConnection() error {
-	return b.Validate()
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	if b.CredentialMode != CredentialModeAmbient {
+		return nil
+	}
+
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		if err := checkTokenFile(path); err != nil {
+			return fmt.Errorf("gcs backend: failed to resolve ambient credentials: %w", err)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := gceAccessToken(ctx); err != nil {
+		return fmt.Errorf("gcs backend: failed to resolve ambient credentials: %w", err)
+	}
+	return nil
 }
@@ -13,6 +13,18 @@ type ResticConfig struct {
 	Repository string
 	Password   string
 	Env        map[string]string
+	// Options are global restic flags, such as transfer limits and
+	// backend -o options, passed to every command run on the repository.
+	Options []string
+}
+
+// CommandArgs returns the restic arguments for a command with the global
+// options prepended.
+func (c ResticConfig) CommandArgs(args []string) []string {
+	if len(c.Options) == 0 {
+		return args
+	}
+	return append(append([]string{}, c.Options...), args...)
 }
 
 // Backend defines the interface for backup storage backends.
@@ -89,6 +101,13 @@ func ParseBackend(repoType models.RepositoryType, configJSON []byte) (Backend, e
 		}
 		return &b, nil
 
+	case models.RepositoryTypeRclone:
+		var b RcloneBackend
+		if err := json.Unmarshal(configJSON, &b); err != nil {
+			return nil, fmt.Errorf("parse rclone backend config: %w", err)
+		}
+		return &b, nil
+
 	default:
 		return nil, fmt.Errorf("unsupported repository type: %s", repoType)
 	}
@@ -56,6 +56,12 @@ func TestBackendFactory_Create(t *testing.T) {
 			config:   `{"account_name": "myaccount", "account_key": "dGVzdGtleQ==", "container_name": "mycontainer"}`,
 			wantType: models.RepositoryTypeAzure,
 		},
+		{
+			name:     "rclone backend",
+			repoType: models.RepositoryTypeRclone,
+			config:   `{"provider": "onedrive", "path": "backups", "options": {"drive_type": "business"}}`,
+			wantType: models.RepositoryTypeRclone,
+		},
 	}
 
 	for _, tt := range tests {
@@ -200,6 +206,15 @@ func TestBackendConfig_RoundTrip(t *testing.T) {
 				Prefix:        "backups",
 			},
 		},
+		{
+			name:     "rclone",
+			repoType: models.RepositoryTypeRclone,
+			backend: &RcloneBackend{
+				Provider: "webdav",
+				Path:     "restic",
+				Options:  map[string]string{"url": "https://dav.example.com", "vendor": "nextcloud"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
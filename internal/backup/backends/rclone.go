@@ -0,0 +1,242 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+)
+
+// RcloneConfigEnv is the ResticConfig.Env key carrying a rendered rclone
+// config. It is never passed to restic as-is: MaterializeEnv writes it to a
+// temporary file and points RCLONE_CONFIG at that file instead.
+const RcloneConfigEnv = "KELDRIS_RCLONE_CONFIG"
+
+// rcloneOAuthOptions are the options shared by rclone's OAuth-based remotes.
+var rcloneOAuthOptions = []string{"client_id", "client_secret", "token"}
+
+// rcloneProviderOptions lists the rclone remote types a repository may use,
+// with the options each accepts. The server runs rclone itself to test the
+// connection, so local and wrapper remotes (local, alias, union, combine,
+// chunker, crypt, ...) are left out because they reach the server's own
+// filesystem, and so are options that name a program, a command or a file on
+// the host, such as sftp's ssh, *_command, service_account_file or env_auth.
+var rcloneProviderOptions = map[string][]string{
+	"onedrive":             append([]string{"drive_id", "drive_type", "region", "chunk_size"}, rcloneOAuthOptions...),
+	"drive":                append([]string{"scope", "root_folder_id", "team_drive", "service_account_credentials", "chunk_size"}, rcloneOAuthOptions...),
+	"google cloud storage": append([]string{"project_number", "service_account_credentials", "location", "storage_class", "bucket_policy_only"}, rcloneOAuthOptions...),
+	"dropbox":              append([]string{"chunk_size"}, rcloneOAuthOptions...),
+	"box":                  append([]string{"box_sub_type", "root_folder_id", "chunk_size"}, rcloneOAuthOptions...),
+	"pcloud":               append([]string{"hostname", "root_folder_id"}, rcloneOAuthOptions...),
+	"jottacloud":           {"token", "hard_delete"},
+	"yandex":               append([]string{"hard_delete"}, rcloneOAuthOptions...),
+	"webdav":               {"url", "vendor", "user", "pass", "bearer_token"},
+	"swift": {
+		"user", "key", "auth", "user_id", "domain", "tenant", "tenant_id", "tenant_domain",
+		"region", "storage_url", "auth_version", "auth_token", "endpoint_type", "storage_policy",
+		"application_credential_id", "application_credential_name", "application_credential_secret",
+		"chunk_size",
+	},
+	"storj":   {"provider", "access_grant", "satellite_address", "api_key", "passphrase"},
+	"mega":    {"user", "pass", "hard_delete"},
+	"koofr":   {"provider", "endpoint", "user", "password", "mountid"},
+	"seafile": {"url", "user", "pass", "library", "library_key", "create_library"},
+}
+
+// RcloneProviderAllowed reports whether an rclone remote type may be used
+// as a repository backend.
+func RcloneProviderAllowed(provider string) bool {
+	_, ok := rcloneProviderOptions[provider]
+	return ok
+}
+
+func rcloneOptionAllowed(provider, key string) bool {
+	for _, allowed := range rcloneProviderOptions[provider] {
+		if key == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// RcloneBackend represents a cloud storage provider supported by rclone
+// (OneDrive, Google Drive, WebDAV, Swift, Storj, ...). The remote definition
+// is stored with the rest of the repository config, so it is encrypted at
+// rest, and is materialized as a temporary rclone config file only while
+// restic or rclone runs.
+type RcloneBackend struct {
+	// Provider is the rclone backend type, e.g. "onedrive", "drive" or "webdav".
+	Provider string `json:"provider"`
+	// Path is the repository location within the remote, e.g. "bucket/restic".
+	Path string `json:"path"`
+	// Options are the remote parameters exactly as they appear in rclone.conf.
+	// Only the options listed for the provider in rcloneProviderOptions are
+	// accepted. Password options must be obscured with `rclone obscure`, as rclone
+	// expects in its config file.
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// Type returns the repository type.
+func (b *RcloneBackend) Type() models.RepositoryType {
+	return models.RepositoryTypeRclone
+}
+
+// ToResticConfig converts the backend to a ResticConfig.
+// The remote definition travels in Env under RcloneConfigEnv.
+func (b *RcloneBackend) ToResticConfig(password string) ResticConfig {
+	return ResticConfig{
+		Repository: "rclone:" + b.remotePath(),
+		Password:   password,
+		Env: map[string]string{
+			RcloneConfigEnv: b.rcloneConfig(),
+		},
+	}
+}
+
+// Validate checks if the configuration is valid.
+func (b *RcloneBackend) Validate() error {
+	if b.Provider == "" {
+		return errors.New("rclone backend: provider is required")
+	}
+	if !RcloneProviderAllowed(b.Provider) {
+		return fmt.Errorf("rclone backend: unsupported provider %q", b.Provider)
+	}
+	if strings.ContainsAny(b.Path, "\r\n") {
+		return errors.New("rclone backend: path must not contain line breaks")
+	}
+	for key, value := range b.Options {
+		if key == "type" {
+			return errors.New("rclone backend: set the remote type with provider, not options")
+		}
+		if !rcloneOptionAllowed(b.Provider, key) {
+			return fmt.Errorf("rclone backend: unsupported option %q for provider %q", key, b.Provider)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("rclone backend: option %q must not contain line breaks", key)
+		}
+	}
+	return nil
+}
+
+// TestConnection tests the remote by listing the repository path with rclone lsd.
+func (b *RcloneBackend) TestConnection() error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := exec.LookPath("rclone"); err != nil {
+		return errors.New("rclone backend: rclone is not installed")
+	}
+
+	configPath, err := writeRcloneConfig(b.rcloneConfig())
+	if err != nil {
+		return fmt.Errorf("rclone backend: %w", err)
+	}
+	defer os.Remove(configPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "rclone", "lsd", b.remotePath(), "--max-depth", "1", "--config", configPath)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		errMsg := strings.TrimSpace(stderr.String())
+		if errMsg == "" {
+			errMsg = err.Error()
+		}
+		return fmt.Errorf("rclone backend: connection test failed: %s", errMsg)
+	}
+
+	return nil
+}
+
+// remoteSection renders the remote parameters with sorted option names so
+// that the same definition always produces the same config.
+func (b *RcloneBackend) remoteSection() string {
+	keys := make([]string, 0, len(b.Options))
+	for key := range b.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "type = %s\n", b.Provider)
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "%s = %s\n", key, b.Options[key])
+	}
+	return sb.String()
+}
+
+// remoteName derives the remote name from its definition, so the source and
+// target of a snapshot copy can share one config file without clashing.
+func (b *RcloneBackend) remoteName() string {
+	sum := sha256.Sum256([]byte(b.remoteSection()))
+	return "keldris-" + hex.EncodeToString(sum[:6])
+}
+
+func (b *RcloneBackend) remotePath() string {
+	return b.remoteName() + ":" + b.Path
+}
+
+func (b *RcloneBackend) rcloneConfig() string {
+	return "[" + b.remoteName() + "]\n" + b.remoteSection()
+}
+
+// MaterializeEnv returns the environment variables to pass to restic.
+// Rendered rclone configs carried in Env are written to a private temporary
+// file referenced by RCLONE_CONFIG; call cleanup once restic has exited.
+func (c ResticConfig) MaterializeEnv() (env map[string]string, cleanup func(), err error) {
+	env = make(map[string]string, len(c.Env))
+	var configs []string
+	for k, v := range c.Env {
+		// The suffix match also catches the prefixed copy of a second
+		// repository's config (RESTIC2_ for copy, RESTIC_FROM_ for init).
+		if strings.HasSuffix(k, RcloneConfigEnv) {
+			configs = append(configs, v)
+			continue
+		}
+		env[k] = v
+	}
+	if len(configs) == 0 {
+		return env, func() {}, nil
+	}
+
+	sort.Strings(configs)
+	path, err := writeRcloneConfig(strings.Join(configs, "\n"))
+	if err != nil {
+		return nil, nil, err
+	}
+	env["RCLONE_CONFIG"] = path
+	return env, func() { os.Remove(path) }, nil
+}
+
+// writeRcloneConfig writes config to a temporary file readable only by the
+// current user and returns its path.
+func writeRcloneConfig(config string) (string, error) {
+	f, err := os.CreateTemp("", "keldris-rclone-*.conf")
+	if err != nil {
+		return "", fmt.Errorf("create rclone config: %w", err)
+	}
+	if _, err := f.WriteString(config); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("write rclone config: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("write rclone config: %w", err)
+	}
+	return f.Name(), nil
+}
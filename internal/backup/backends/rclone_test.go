@@ -0,0 +1,233 @@
+package backends
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+)
+
+func TestRcloneBackend_Init(t *testing.T) {
+	b := &RcloneBackend{Provider: "drive"}
+	if b.Type() != models.RepositoryTypeRclone {
+		t.Errorf("Type() = %v, want %v", b.Type(), models.RepositoryTypeRclone)
+	}
+}
+
+func TestRcloneBackend_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend RcloneBackend
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name:    "valid provider only",
+			backend: RcloneBackend{Provider: "drive"},
+		},
+		{
+			name: "valid with options",
+			backend: RcloneBackend{
+				Provider: "swift",
+				Path:     "container/restic",
+				Options:  map[string]string{"user": "backup", "key": "secret", "auth": "https://auth.example.com/v3"},
+			},
+		},
+		{
+			name:    "provider with spaces",
+			backend: RcloneBackend{Provider: "google cloud storage"},
+		},
+		{
+			name:    "missing provider",
+			backend: RcloneBackend{Path: "backups"},
+			wantErr: true,
+			errMsg:  "provider is required",
+		},
+		{
+			name:    "invalid provider",
+			backend: RcloneBackend{Provider: "drive]\n[other"},
+			wantErr: true,
+			errMsg:  "unsupported provider",
+		},
+		{
+			name:    "local provider",
+			backend: RcloneBackend{Provider: "local", Path: "/etc"},
+			wantErr: true,
+			errMsg:  "unsupported provider",
+		},
+		{
+			name:    "alias provider",
+			backend: RcloneBackend{Provider: "alias", Options: map[string]string{"remote": "/"}},
+			wantErr: true,
+			errMsg:  "unsupported provider",
+		},
+		{
+			name:    "sftp provider",
+			backend: RcloneBackend{Provider: "sftp", Options: map[string]string{"host": "example.com"}},
+			wantErr: true,
+			errMsg:  "unsupported provider",
+		},
+		{
+			name:    "invalid option name",
+			backend: RcloneBackend{Provider: "drive", Options: map[string]string{"client id": "x"}},
+			wantErr: true,
+			errMsg:  "unsupported option",
+		},
+		{
+			name:    "command option",
+			backend: RcloneBackend{Provider: "webdav", Options: map[string]string{"bearer_token_command": "id"}},
+			wantErr: true,
+			errMsg:  "unsupported option",
+		},
+		{
+			name:    "option of another provider",
+			backend: RcloneBackend{Provider: "drive", Options: map[string]string{"url": "https://dav.example.com"}},
+			wantErr: true,
+			errMsg:  "unsupported option",
+		},
+		{
+			name:    "type option",
+			backend: RcloneBackend{Provider: "drive", Options: map[string]string{"type": "local"}},
+			wantErr: true,
+			errMsg:  "provider, not options",
+		},
+		{
+			name:    "option value with newline",
+			backend: RcloneBackend{Provider: "drive", Options: map[string]string{"token": "x\n[evil]"}},
+			wantErr: true,
+			errMsg:  "line breaks",
+		},
+		{
+			name:    "path with newline",
+			backend: RcloneBackend{Provider: "drive", Path: "a\nb"},
+			wantErr: true,
+			errMsg:  "line breaks",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.backend.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && err != nil && tt.errMsg != "" {
+				if got := err.Error(); !contains(got, tt.errMsg) {
+					t.Errorf("Validate() error = %q, want to contain %q", got, tt.errMsg)
+				}
+			}
+		})
+	}
+}
+
+func TestRcloneBackend_ToResticConfig(t *testing.T) {
+	b := &RcloneBackend{
+		Provider: "onedrive",
+		Path:     "backups/restic",
+		Options:  map[string]string{"token": `{"access_token":"abc"}`, "drive_type": "business"},
+	}
+
+	cfg := b.ToResticConfig("pass")
+
+	name := b.remoteName()
+	if !strings.HasPrefix(name, "keldris-") {
+		t.Errorf("remoteName() = %q, want keldris- prefix", name)
+	}
+	if cfg.Repository != "rclone:"+name+":backups/restic" {
+		t.Errorf("Repository = %v", cfg.Repository)
+	}
+	if cfg.Password != "pass" {
+		t.Errorf("Password = %v, want pass", cfg.Password)
+	}
+
+	want := "[" + name + "]\ntype = onedrive\ndrive_type = business\ntoken = {\"access_token\":\"abc\"}\n"
+	if cfg.Env[RcloneConfigEnv] != want {
+		t.Errorf("Env[%s] = %q, want %q", RcloneConfigEnv, cfg.Env[RcloneConfigEnv], want)
+	}
+
+	// The remote name is stable for a definition and differs between definitions.
+	if b.ToResticConfig("pass").Repository != cfg.Repository {
+		t.Error("repository should be deterministic")
+	}
+	other := &RcloneBackend{Provider: "onedrive", Path: "backups/restic"}
+	if other.remoteName() == name {
+		t.Error("different remote definitions should get different names")
+	}
+}
+
+func TestResticConfig_MaterializeEnv(t *testing.T) {
+	t.Run("without rclone config", func(t *testing.T) {
+		cfg := ResticConfig{Env: map[string]string{"AWS_ACCESS_KEY_ID": "key"}}
+
+		env, cleanup, err := cfg.MaterializeEnv()
+		if err != nil {
+			t.Fatalf("MaterializeEnv() error = %v", err)
+		}
+		defer cleanup()
+
+		if len(env) != 1 || env["AWS_ACCESS_KEY_ID"] != "key" {
+			t.Errorf("env = %v, want unchanged", env)
+		}
+	})
+
+	t.Run("writes temporary config", func(t *testing.T) {
+		source := (&RcloneBackend{Provider: "drive", Path: "a"}).ToResticConfig("pass")
+		target := (&RcloneBackend{Provider: "webdav", Path: "b"}).ToResticConfig("pass")
+		cfg := ResticConfig{Env: map[string]string{
+			RcloneConfigEnv:              source.Env[RcloneConfigEnv],
+			"RESTIC2_" + RcloneConfigEnv: target.Env[RcloneConfigEnv],
+		}}
+
+		env, cleanup, err := cfg.MaterializeEnv()
+		if err != nil {
+			t.Fatalf("MaterializeEnv() error = %v", err)
+		}
+
+		if _, ok := env[RcloneConfigEnv]; ok {
+			t.Error("rendered config must not be passed through")
+		}
+		path := env["RCLONE_CONFIG"]
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat rclone config: %v", err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("config permissions = %v, want 0600", info.Mode().Perm())
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read rclone config: %v", err)
+		}
+		for _, section := range []string{source.Env[RcloneConfigEnv], target.Env[RcloneConfigEnv]} {
+			if !strings.Contains(string(data), section) {
+				t.Errorf("config %q missing section %q", data, section)
+			}
+		}
+
+		cleanup()
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("cleanup should remove %s", path)
+		}
+	})
+}
+
+func TestRcloneBackend_TestConnection_InvalidConfig(t *testing.T) {
+	b := &RcloneBackend{}
+	if err := b.TestConnection(); err == nil {
+		t.Error("TestConnection() expected error for invalid config, got nil")
+	}
+}
+
+func TestRcloneBackend_TestConnection_RcloneNotInstalled(t *testing.T) {
+	if _, err := exec.LookPath("rclone"); err == nil {
+		t.Skip("rclone is installed, skipping not-installed test")
+	}
+
+	b := &RcloneBackend{Provider: "drive"}
+	err := b.TestConnection()
+	if err == nil || !contains(err.Error(), "rclone is not installed") {
+		t.Errorf("TestConnection() error = %v, want rclone is not installed", err)
+	}
+}
@@ -16,6 +16,16 @@ type RestBackend struct {
 	URL      string `json:"url"`
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
+
+	// Hosted marks a repository stored by the Keldris server's built-in REST
+	// endpoint. URL, Username and Password are then filled in by the server;
+	// agents authenticate with credentials derived from their API key instead.
+	Hosted bool `json:"hosted,omitempty"`
+	// AppendOnly stops agents from deleting anything but locks in a hosted
+	// repository.
+	AppendOnly bool `json:"append_only,omitempty"`
+	// QuotaBytes caps the on-disk size of a hosted repository (0 = unlimited).
+	QuotaBytes int64 `json:"quota_bytes,omitempty"`
 }
 
 // Type returns the repository type.
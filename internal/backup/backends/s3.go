@@ -5,13 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
 // S3Backend represents an S3-compatible storage backend.
@@ -24,6 +28,20 @@ type S3Backend struct {
 	AccessKeyID     string `json:"access_key_id"`
 	SecretAccessKey string `json:"secret_access_key"`
 	UseSSL          bool   `json:"use_ssl"`
+	// CredentialMode is static (default), ambient or assume_role. Ambient
+	// credentials come from the instance profile, IRSA or another web
+	// identity token on the machine running restic.
+	CredentialMode CredentialMode `json:"credential_mode,omitempty"`
+	// RoleARN is the IAM role assumed in assume_role mode, using the access
+	// keys if set and ambient credentials otherwise.
+	RoleARN         string `json:"role_arn,omitempty"`
+	ExternalID      string `json:"external_id,omitempty"`
+	RoleSessionName string `json:"role_session_name,omitempty"`
+	// STSEndpoint overrides the STS endpoint, e.g. for a VPC endpoint.
+	STSEndpoint string `json:"sts_endpoint,omitempty"`
+	// ObjectLock requires the bucket to have S3 Object Lock enabled, so that
+	// immutability locks can be enforced at the storage layer.
+	ObjectLock bool `json:"object_lock,omitempty"`
 }
 
 // Type returns the repository type.
@@ -56,15 +74,33 @@ func (b *S3Backend) ToResticConfig(password string) ResticConfig {
 		repository = repository + "/" + b.Prefix
 	}
 
-	env := map[string]string{
-		"AWS_ACCESS_KEY_ID":     b.AccessKeyID,
-		"AWS_SECRET_ACCESS_KEY": b.SecretAccessKey,
+	env := map[string]string{}
+
+	// Ambient credentials are resolved by restic itself from the instance
+	// profile or web identity token, so no keys are passed.
+	if b.AccessKeyID != "" && b.CredentialMode != CredentialModeAmbient {
+		env["AWS_ACCESS_KEY_ID"] = b.AccessKeyID
+		env["AWS_SECRET_ACCESS_KEY"] = b.SecretAccessKey
 	}
 
 	if b.Region != "" {
 		env["AWS_DEFAULT_REGION"] = b.Region
 	}
 
+	if b.CredentialMode == CredentialModeAssumeRole {
+		env["RESTIC_AWS_ASSUME_ROLE_ARN"] = b.RoleARN
+		env["RESTIC_AWS_ASSUME_ROLE_SESSION_NAME"] = b.roleSessionName()
+		if b.ExternalID != "" {
+			env["RESTIC_AWS_ASSUME_ROLE_EXTERNAL_ID"] = b.ExternalID
+		}
+		if b.Region != "" {
+			env["RESTIC_AWS_ASSUME_ROLE_REGION"] = b.Region
+		}
+		if b.STSEndpoint != "" {
+			env["RESTIC_AWS_ASSUME_ROLE_STS_ENDPOINT"] = b.STSEndpoint
+		}
+	}
+
 	return ResticConfig{
 		Repository: repository,
 		Password:   password,
@@ -77,11 +113,61 @@ func (b *S3Backend) Validate() error {
 	if b.Bucket == "" {
 		return errors.New("s3 backend: bucket is required")
 	}
-	if b.AccessKeyID == "" {
-		return errors.New("s3 backend: access_key_id is required")
+
+	mode, err := resolveCredentialMode("s3", b.CredentialMode,
+		CredentialModeStatic, CredentialModeAmbient, CredentialModeAssumeRole)
+	if err != nil {
+		return err
 	}
-	if b.SecretAccessKey == "" {
-		return errors.New("s3 backend: secret_access_key is required")
+
+	switch mode {
+	case CredentialModeStatic:
+		if b.AccessKeyID == "" {
+			return errors.New("s3 backend: access_key_id is required")
+		}
+		if b.SecretAccessKey == "" {
+			return errors.New("s3 backend: secret_access_key is required")
+		}
+	case CredentialModeAmbient:
+		if b.AccessKeyID != "" || b.SecretAccessKey != "" {
+			return errors.New("s3 backend: access keys must not be set with ambient credentials")
+		}
+		if err := checkAmbientAllowed("s3"); err != nil {
+			return err
+		}
+	case CredentialModeAssumeRole:
+		if !strings.HasPrefix(b.RoleARN, "arn:") {
+			return errors.New("s3 backend: role_arn is required for assume_role credentials")
+		}
+		if (b.AccessKeyID == "") != (b.SecretAccessKey == "") {
+			return errors.New("s3 backend: access_key_id and secret_access_key must be set together")
+		}
+		// Without stored keys the role is assumed with the machine identity.
+		if b.AccessKeyID == "" {
+			if err := checkAmbientAllowed("s3"); err != nil {
+				return err
+			}
+		}
+		if b.STSEndpoint != "" {
+			if err := validateSTSEndpoint(b.STSEndpoint); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stsHostPattern matches AWS STS endpoint hosts: global, regional, FIPS,
+// China and VPC interface endpoints.
+var stsHostPattern = regexp.MustCompile(`^(sts(-fips)?(\.[a-z0-9-]+)?|vpce-[a-z0-9-]+\.sts\.[a-z0-9-]+\.vpce)\.amazonaws\.com(\.cn)?$`)
+
+// validateSTSEndpoint rejects STS endpoints other than AWS's own, since
+// AssumeRole requests are signed with the base credentials.
+var validateSTSEndpoint = func(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || !stsHostPattern.MatchString(u.Host) {
+		return errors.New("s3 backend: sts_endpoint must be an https AWS STS endpoint")
 	}
 	return nil
 }
@@ -95,6 +181,36 @@ func (b *S3Backend) TestConnection() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	client, err := b.newClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Resolve credentials first so a broken instance profile or role trust
+	// policy is reported as such rather than as a bucket access failure.
+	if _, err := client.Options().Credentials.Retrieve(ctx); err != nil {
+		return fmt.Errorf("s3 backend: failed to resolve %s credentials: %w", b.credentialMode(), err)
+	}
+
+	// Try to head the bucket to verify access
+	_, err = client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(b.Bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("s3 backend: failed to access bucket: %w", err)
+	}
+
+	if b.ObjectLock {
+		if err := NewS3ObjectLock(client, b.Bucket, b.Prefix).CheckEnabled(ctx); err != nil {
+			return fmt.Errorf("s3 backend: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// newClient builds an S3 API client for the backend's endpoint and credentials.
+func (b *S3Backend) newClient(ctx context.Context) (*s3.Client, error) {
 	// Build AWS config
 	region := b.Region
 	if region == "" {
@@ -103,16 +219,35 @@ func (b *S3Backend) TestConnection() error {
 
 	opts := []func(*config.LoadOptions) error{
 		config.WithRegion(region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+	}
+	// Without static keys the SDK's default chain is used, which covers
+	// environment variables, web identity tokens and instance metadata.
+	if b.AccessKeyID != "" && b.credentialMode() != CredentialModeAmbient {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
 			b.AccessKeyID,
 			b.SecretAccessKey,
 			"",
-		)),
+		)))
 	}
 
 	cfg, err := config.LoadDefaultConfig(ctx, opts...)
 	if err != nil {
-		return fmt.Errorf("s3 backend: failed to load config: %w", err)
+		return nil, fmt.Errorf("s3 backend: failed to load config: %w", err)
+	}
+
+	if b.credentialMode() == CredentialModeAssumeRole {
+		stsClient := sts.NewFromConfig(cfg, func(o *sts.Options) {
+			if b.STSEndpoint != "" {
+				o.BaseEndpoint = aws.String(b.STSEndpoint)
+			}
+		})
+		provider := stscreds.NewAssumeRoleProvider(stsClient, b.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = b.roleSessionName()
+			if b.ExternalID != "" {
+				o.ExternalID = aws.String(b.ExternalID)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
 	}
 
 	// Create S3 client
@@ -134,15 +269,21 @@ func (b *S3Backend) TestConnection() error {
 		})
 	}
 
-	client := s3.NewFromConfig(cfg, clientOpts...)
+	return s3.NewFromConfig(cfg, clientOpts...), nil
+}
 
-	// Try to head the bucket to verify access
-	_, err = client.HeadBucket(ctx, &s3.HeadBucketInput{
-		Bucket: aws.String(b.Bucket),
-	})
-	if err != nil {
-		return fmt.Errorf("s3 backend: failed to access bucket: %w", err)
+// credentialMode returns the configured credential mode, defaulting to static.
+func (b *S3Backend) credentialMode() CredentialMode {
+	if b.CredentialMode == "" {
+		return CredentialModeStatic
 	}
+	return b.CredentialMode
+}
 
-	return nil
+// roleSessionName returns the session name used when assuming a role.
+func (b *S3Backend) roleSessionName() string {
+	if b.RoleSessionName != "" {
+		return b.RoleSessionName
+	}
+	return "keldris"
 }
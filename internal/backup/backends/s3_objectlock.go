@@ -0,0 +1,266 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrObjectLockNotEnabled is returned when a bucket does not have S3 Object Lock enabled.
+var ErrObjectLockNotEnabled = errors.New("s3 object lock is not enabled on the bucket")
+
+// S3ObjectLockAPI is the subset of the S3 API used to manage Object Lock.
+type S3ObjectLockAPI interface {
+	GetObjectLockConfiguration(ctx context.Context, params *s3.GetObjectLockConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	GetObjectRetention(ctx context.Context, params *s3.GetObjectRetentionInput, optFns ...func(*s3.Options)) (*s3.GetObjectRetentionOutput, error)
+	PutObjectRetention(ctx context.Context, params *s3.PutObjectRetentionInput, optFns ...func(*s3.Options)) (*s3.PutObjectRetentionOutput, error)
+	PutObjectLegalHold(ctx context.Context, params *s3.PutObjectLegalHoldInput, optFns ...func(*s3.Options)) (*s3.PutObjectLegalHoldOutput, error)
+}
+
+// S3Object is an object stored in an S3 repository.
+type S3Object struct {
+	Key          string
+	LastModified time.Time
+}
+
+// S3ObjectLock applies S3 Object Lock retention and legal holds to the
+// objects of a restic repository, so that locked snapshots cannot be deleted
+// even by someone holding the bucket credentials.
+type S3ObjectLock struct {
+	client S3ObjectLockAPI
+	bucket string
+	prefix string
+}
+
+// NewS3ObjectLock creates an S3ObjectLock for the repository stored under
+// prefix in bucket.
+func NewS3ObjectLock(client S3ObjectLockAPI, bucket, prefix string) *S3ObjectLock {
+	return &S3ObjectLock{
+		client: client,
+		bucket: bucket,
+		prefix: strings.Trim(prefix, "/"),
+	}
+}
+
+// OpenObjectLock returns an S3ObjectLock for the backend's repository.
+func (b *S3Backend) OpenObjectLock(ctx context.Context) (*S3ObjectLock, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := b.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewS3ObjectLock(client, b.Bucket, b.Prefix), nil
+}
+
+// CheckEnabled verifies that the bucket has Object Lock enabled.
+func (l *S3ObjectLock) CheckEnabled(ctx context.Context) error {
+	out, err := l.client.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(l.bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrObjectLockNotEnabled, err.Error())
+	}
+	if out.ObjectLockConfiguration == nil ||
+		out.ObjectLockConfiguration.ObjectLockEnabled != types.ObjectLockEnabledEnabled {
+		return ErrObjectLockNotEnabled
+	}
+	return nil
+}
+
+// ListObjects returns every object of the repository.
+func (l *S3ObjectLock) ListObjects(ctx context.Context) ([]S3Object, error) {
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(l.bucket)}
+	if l.prefix != "" {
+		input.Prefix = aws.String(l.prefix + "/")
+	}
+
+	var objects []S3Object
+	for {
+		out, err := l.client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("list repository objects: %w", err)
+		}
+		for _, obj := range out.Contents {
+			objects = append(objects, S3Object{
+				Key:          aws.ToString(obj.Key),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+		if !aws.ToBool(out.IsTruncated) {
+			return objects, nil
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+}
+
+// SnapshotFiles names the files of a restic repository a snapshot needs to
+// be restored: its snapshot file, the packs holding its trees and file
+// contents, and the index files describing those packs.
+type SnapshotFiles struct {
+	// SnapshotID may be a short ID.
+	SnapshotID string
+	Packs      []string
+	Indexes    []string
+}
+
+// objectLockConcurrency bounds the Object Lock requests in flight at once.
+const objectLockConcurrency = 16
+
+// SnapshotObjectKeys returns the keys of the objects holding a snapshot's
+// files, plus the repository config and keys without which none of them can
+// be read. It fails if the snapshot or any of its packs is missing.
+func (l *S3ObjectLock) SnapshotObjectKeys(objects []S3Object, files SnapshotFiles) ([]string, error) {
+	if files.SnapshotID == "" {
+		return nil, errors.New("snapshot ID is required")
+	}
+	base := ""
+	if l.prefix != "" {
+		base = l.prefix + "/"
+	}
+	packs := make(map[string]bool, len(files.Packs))
+	for _, id := range files.Packs {
+		packs[id] = false
+	}
+	indexes := make(map[string]bool, len(files.Indexes))
+	for _, id := range files.Indexes {
+		indexes[id] = true
+	}
+
+	var keys []string
+	found := false
+	for _, obj := range objects {
+		name := strings.TrimPrefix(obj.Key, base)
+		switch {
+		case name == "config", strings.HasPrefix(name, "keys/"):
+			keys = append(keys, obj.Key)
+		case strings.HasPrefix(name, "snapshots/"+files.SnapshotID):
+			keys = append(keys, obj.Key)
+			found = true
+		case strings.HasPrefix(name, "index/"):
+			if indexes[path.Base(name)] {
+				keys = append(keys, obj.Key)
+			}
+		case strings.HasPrefix(name, "data/"):
+			if _, ok := packs[path.Base(name)]; ok {
+				keys = append(keys, obj.Key)
+				packs[path.Base(name)] = true
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("snapshot %s not found in the bucket", files.SnapshotID)
+	}
+	for id, seen := range packs {
+		if !seen {
+			return nil, fmt.Errorf("pack %s of snapshot %s not found in the bucket", id, files.SnapshotID)
+		}
+	}
+	return keys, nil
+}
+
+// SetRetention sets Object Lock retention on keys until the given time.
+// Objects already retained at least that long are left untouched, as
+// retention can only be extended. Up to objectLockConcurrency objects are
+// updated at once. It returns the number of objects updated.
+func (l *S3ObjectLock) SetRetention(ctx context.Context, keys []string, mode models.S3ObjectLockMode, until time.Time) (int, error) {
+	var mu sync.Mutex
+	updated := 0
+	err := l.forEachKey(ctx, keys, func(ctx context.Context, key string) error {
+		current, err := l.client.GetObjectRetention(ctx, &s3.GetObjectRetentionInput{
+			Bucket: aws.String(l.bucket),
+			Key:    aws.String(key),
+		})
+		// Objects without retention return an error; fall through and set it.
+		if err == nil && current.Retention != nil && current.Retention.RetainUntilDate != nil &&
+			!current.Retention.RetainUntilDate.Before(until) {
+			return nil
+		}
+
+		_, err = l.client.PutObjectRetention(ctx, &s3.PutObjectRetentionInput{
+			Bucket: aws.String(l.bucket),
+			Key:    aws.String(key),
+			Retention: &types.ObjectLockRetention{
+				Mode:            types.ObjectLockRetentionMode(mode),
+				RetainUntilDate: aws.Time(until),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("set retention on %s: %w", key, err)
+		}
+		mu.Lock()
+		updated++
+		mu.Unlock()
+		return nil
+	})
+	return updated, err
+}
+
+// SetLegalHold turns the Object Lock legal hold on keys on or off.
+func (l *S3ObjectLock) SetLegalHold(ctx context.Context, keys []string, on bool) error {
+	status := types.ObjectLockLegalHoldStatusOff
+	if on {
+		status = types.ObjectLockLegalHoldStatusOn
+	}
+	return l.forEachKey(ctx, keys, func(ctx context.Context, key string) error {
+		_, err := l.client.PutObjectLegalHold(ctx, &s3.PutObjectLegalHoldInput{
+			Bucket:    aws.String(l.bucket),
+			Key:       aws.String(key),
+			LegalHold: &types.ObjectLockLegalHold{Status: status},
+		})
+		if err != nil {
+			return fmt.Errorf("set legal hold on %s: %w", key, err)
+		}
+		return nil
+	})
+}
+
+// forEachKey calls fn for every key, objectLockConcurrency at a time. The
+// first error cancels the remaining calls and is returned.
+func (l *S3ObjectLock) forEachKey(ctx context.Context, keys []string, fn func(ctx context.Context, key string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, objectLockConcurrency)
+	for _, key := range keys {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, key); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(key)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,261 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type fakeObjectLockClient struct {
+	mu         sync.Mutex
+	inFlight   int
+	maxFlight  int
+	putErr     error
+	lockConfig *types.ObjectLockConfiguration
+	configErr  error
+	pages      [][]types.Object
+	retention  map[string]time.Time
+	legalHold  map[string]types.ObjectLockLegalHoldStatus
+	puts       []string
+}
+
+func newFakeObjectLockClient() *fakeObjectLockClient {
+	return &fakeObjectLockClient{
+		lockConfig: &types.ObjectLockConfiguration{ObjectLockEnabled: types.ObjectLockEnabledEnabled},
+		retention:  make(map[string]time.Time),
+		legalHold:  make(map[string]types.ObjectLockLegalHoldStatus),
+	}
+}
+
+func (f *fakeObjectLockClient) GetObjectLockConfiguration(_ context.Context, _ *s3.GetObjectLockConfigurationInput, _ ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error) {
+	if f.configErr != nil {
+		return nil, f.configErr
+	}
+	return &s3.GetObjectLockConfigurationOutput{ObjectLockConfiguration: f.lockConfig}, nil
+}
+
+func (f *fakeObjectLockClient) ListObjectsV2(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	page := 0
+	if params.ContinuationToken != nil {
+		page = len(aws.ToString(params.ContinuationToken))
+	}
+	out := &s3.ListObjectsV2Output{Contents: f.pages[page]}
+	if page+1 < len(f.pages) {
+		out.IsTruncated = aws.Bool(true)
+		token := make([]byte, page+1)
+		for i := range token {
+			token[i] = 'x'
+		}
+		out.NextContinuationToken = aws.String(string(token))
+	}
+	return out, nil
+}
+
+func (f *fakeObjectLockClient) GetObjectRetention(_ context.Context, params *s3.GetObjectRetentionInput, _ ...func(*s3.Options)) (*s3.GetObjectRetentionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	until, ok := f.retention[aws.ToString(params.Key)]
+	if !ok {
+		return nil, errors.New("NoSuchObjectLockConfiguration")
+	}
+	return &s3.GetObjectRetentionOutput{Retention: &types.ObjectLockRetention{RetainUntilDate: aws.Time(until)}}, nil
+}
+
+func (f *fakeObjectLockClient) PutObjectRetention(_ context.Context, params *s3.PutObjectRetentionInput, _ ...func(*s3.Options)) (*s3.PutObjectRetentionOutput, error) {
+	f.mu.Lock()
+	f.inFlight++
+	f.maxFlight = max(f.maxFlight, f.inFlight)
+	f.mu.Unlock()
+	time.Sleep(time.Millisecond)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inFlight--
+	if f.putErr != nil {
+		return nil, f.putErr
+	}
+	key := aws.ToString(params.Key)
+	f.retention[key] = aws.ToTime(params.Retention.RetainUntilDate)
+	f.puts = append(f.puts, key)
+	return &s3.PutObjectRetentionOutput{}, nil
+}
+
+func (f *fakeObjectLockClient) PutObjectLegalHold(_ context.Context, params *s3.PutObjectLegalHoldInput, _ ...func(*s3.Options)) (*s3.PutObjectLegalHoldOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.legalHold[aws.ToString(params.Key)] = params.LegalHold.Status
+	return &s3.PutObjectLegalHoldOutput{}, nil
+}
+
+func TestS3ObjectLock_CheckEnabled(t *testing.T) {
+	t.Run("enabled", func(t *testing.T) {
+		l := NewS3ObjectLock(newFakeObjectLockClient(), "bucket", "")
+		if err := l.CheckEnabled(context.Background()); err != nil {
+			t.Errorf("CheckEnabled() error = %v", err)
+		}
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		client := newFakeObjectLockClient()
+		client.configErr = errors.New("ObjectLockConfigurationNotFoundError")
+		l := NewS3ObjectLock(client, "bucket", "")
+		if err := l.CheckEnabled(context.Background()); !errors.Is(err, ErrObjectLockNotEnabled) {
+			t.Errorf("CheckEnabled() error = %v, want ErrObjectLockNotEnabled", err)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client := newFakeObjectLockClient()
+		client.lockConfig = &types.ObjectLockConfiguration{}
+		l := NewS3ObjectLock(client, "bucket", "")
+		if err := l.CheckEnabled(context.Background()); !errors.Is(err, ErrObjectLockNotEnabled) {
+			t.Errorf("CheckEnabled() error = %v, want ErrObjectLockNotEnabled", err)
+		}
+	})
+}
+
+func TestS3ObjectLock_ListObjects(t *testing.T) {
+	client := newFakeObjectLockClient()
+	client.pages = [][]types.Object{
+		{{Key: aws.String("repo/config")}, {Key: aws.String("repo/keys/k1")}},
+		{{Key: aws.String("repo/data/00/pack1")}},
+	}
+	l := NewS3ObjectLock(client, "bucket", "/repo/")
+
+	objects, err := l.ListObjects(context.Background())
+	if err != nil {
+		t.Fatalf("ListObjects() error = %v", err)
+	}
+	if len(objects) != 3 {
+		t.Errorf("ListObjects() returned %d objects, want 3", len(objects))
+	}
+}
+
+func TestS3ObjectLock_SnapshotObjectKeys(t *testing.T) {
+	objects := []S3Object{
+		{Key: "repo/config"},
+		{Key: "repo/keys/k1"},
+		{Key: "repo/snapshots/abcd1234ffff"},
+		{Key: "repo/snapshots/99990000aaaa"},
+		{Key: "repo/index/i1"},
+		{Key: "repo/index/i2"},
+		{Key: "repo/data/00/pack1"},
+		{Key: "repo/data/01/pack2"},
+		{Key: "repo/locks/l1"},
+	}
+	l := NewS3ObjectLock(nil, "bucket", "repo")
+	files := SnapshotFiles{SnapshotID: "abcd1234", Packs: []string{"pack1"}, Indexes: []string{"i1"}}
+
+	got, err := l.SnapshotObjectKeys(objects, files)
+	if err != nil {
+		t.Fatalf("SnapshotObjectKeys() error = %v", err)
+	}
+	sort.Strings(got)
+	// Packs and indexes of other snapshots are left alone.
+	want := []string{
+		"repo/config",
+		"repo/data/00/pack1",
+		"repo/index/i1",
+		"repo/keys/k1",
+		"repo/snapshots/abcd1234ffff",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("SnapshotObjectKeys() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("SnapshotObjectKeys()[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	for name, files := range map[string]SnapshotFiles{
+		"missing snapshot": {SnapshotID: "deadbeef"},
+		"empty ID":         {},
+		"missing pack":     {SnapshotID: "abcd1234", Packs: []string{"pack1", "pack9"}},
+	} {
+		if keys, err := l.SnapshotObjectKeys(objects, files); err == nil {
+			t.Errorf("SnapshotObjectKeys() for %s = %v, want an error", name, keys)
+		}
+	}
+}
+
+func TestS3ObjectLock_SetRetention(t *testing.T) {
+	until := time.Now().Add(30 * 24 * time.Hour)
+	client := newFakeObjectLockClient()
+	client.retention["already"] = until.Add(time.Hour)
+	client.retention["shorter"] = until.Add(-time.Hour)
+	l := NewS3ObjectLock(client, "bucket", "")
+
+	updated, err := l.SetRetention(context.Background(), []string{"new", "already", "shorter"}, models.S3ObjectLockModeGovernance, until)
+	if err != nil {
+		t.Fatalf("SetRetention() error = %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("SetRetention() updated = %d, want 2", updated)
+	}
+	for _, key := range []string{"new", "shorter"} {
+		if !client.retention[key].Equal(until) {
+			t.Errorf("retention[%s] = %v, want %v", key, client.retention[key], until)
+		}
+	}
+	if !client.retention["already"].After(until) {
+		t.Error("longer retention must not be shortened")
+	}
+}
+
+func TestS3ObjectLock_SetRetentionConcurrency(t *testing.T) {
+	until := time.Now().Add(24 * time.Hour)
+	keys := make([]string, 4*objectLockConcurrency)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("data/%02d/pack", i)
+	}
+
+	client := newFakeObjectLockClient()
+	l := NewS3ObjectLock(client, "bucket", "")
+	updated, err := l.SetRetention(context.Background(), keys, models.S3ObjectLockModeGovernance, until)
+	if err != nil {
+		t.Fatalf("SetRetention() error = %v", err)
+	}
+	if updated != len(keys) {
+		t.Errorf("SetRetention() updated = %d, want %d", updated, len(keys))
+	}
+	if client.maxFlight > objectLockConcurrency {
+		t.Errorf("%d requests in flight, want at most %d", client.maxFlight, objectLockConcurrency)
+	}
+
+	failing := newFakeObjectLockClient()
+	failing.putErr = errors.New("AccessDenied")
+	l = NewS3ObjectLock(failing, "bucket", "")
+	if _, err := l.SetRetention(context.Background(), keys, models.S3ObjectLockModeGovernance, until); err == nil {
+		t.Error("SetRetention() expected the put error")
+	}
+}
+
+func TestS3ObjectLock_SetLegalHold(t *testing.T) {
+	client := newFakeObjectLockClient()
+	l := NewS3ObjectLock(client, "bucket", "")
+	ctx := context.Background()
+
+	if err := l.SetLegalHold(ctx, []string{"a", "b"}, true); err != nil {
+		t.Fatalf("SetLegalHold(on) error = %v", err)
+	}
+	if client.legalHold["a"] != types.ObjectLockLegalHoldStatusOn || client.legalHold["b"] != types.ObjectLockLegalHoldStatusOn {
+		t.Errorf("legal holds = %v, want ON", client.legalHold)
+	}
+
+	if err := l.SetLegalHold(ctx, []string{"a"}, false); err != nil {
+		t.Fatalf("SetLegalHold(off) error = %v", err)
+	}
+	if client.legalHold["a"] != types.ObjectLockLegalHoldStatusOff {
+		t.Errorf("legal hold on a = %v, want OFF", client.legalHold["a"])
+	}
+}
@@ -0,0 +1,75 @@
+package backends
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+)
+
+// optionNamespaces maps repository types to the prefix restic uses for
+// their -o options.
+var optionNamespaces = map[models.RepositoryType]string{
+	models.RepositoryTypeLocal:   "local",
+	models.RepositoryTypeS3:      "s3",
+	models.RepositoryTypeB2:      "b2",
+	models.RepositoryTypeSFTP:    "sftp",
+	models.RepositoryTypeRest:    "rest",
+	models.RepositoryTypeDropbox: "rclone",
+	models.RepositoryTypeAzure:   "azure",
+	models.RepositoryTypeGCS:     "gs",
+	models.RepositoryTypeRclone:  "rclone",
+}
+
+// OptionNamespace returns the restic -o option prefix for a repository type,
+// such as "s3" or "gs".
+func OptionNamespace(repoType models.RepositoryType) string {
+	return optionNamespaces[repoType]
+}
+
+// TransferOptions converts transfer settings into global restic flags for a
+// repository of the given type. scheduleUploadLimitKB, when set, overrides
+// the repository's upload limit. Backend options for other backends are
+// dropped because restic rejects them, and so are options that
+// models.ValidateBackendOption does not accept, such as ones saved before
+// the allowlist existed.
+func TransferOptions(repoType models.RepositoryType, settings *models.RepositoryTransferSettings, scheduleUploadLimitKB *int) []string {
+	var opts []string
+	uploadLimit := scheduleUploadLimitKB
+	if uploadLimit == nil && settings != nil {
+		uploadLimit = settings.UploadLimitKB
+	}
+	if uploadLimit != nil && *uploadLimit > 0 {
+		opts = append(opts, "--limit-upload="+strconv.Itoa(*uploadLimit))
+	}
+	if settings == nil {
+		return opts
+	}
+
+	if settings.DownloadLimitKB != nil && *settings.DownloadLimitKB > 0 {
+		opts = append(opts, "--limit-download="+strconv.Itoa(*settings.DownloadLimitKB))
+	}
+	if settings.PackSizeMB != nil && *settings.PackSizeMB > 0 {
+		opts = append(opts, "--pack-size="+strconv.Itoa(*settings.PackSizeMB))
+	}
+
+	namespace := OptionNamespace(repoType)
+	if namespace == "" {
+		return opts
+	}
+	if settings.Connections != nil && *settings.Connections > 0 {
+		opts = append(opts, "--option="+namespace+".connections="+strconv.Itoa(*settings.Connections))
+	}
+	keys := make([]string, 0, len(settings.BackendOptions))
+	for key := range settings.BackendOptions {
+		if strings.HasPrefix(key, namespace+".") && models.ValidateBackendOption(key, settings.BackendOptions[key]) == nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		opts = append(opts, "--option="+key+"="+settings.BackendOptions[key])
+	}
+	return opts
+}
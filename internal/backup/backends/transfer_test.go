@@ -0,0 +1,106 @@
+package backends
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+)
+
+func TestTransferOptions(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+
+	tests := []struct {
+		name     string
+		repoType models.RepositoryType
+		settings *models.RepositoryTransferSettings
+		schedule *int
+		want     []string
+	}{
+		{
+			name:     "no settings",
+			repoType: models.RepositoryTypeS3,
+		},
+		{
+			name:     "schedule limit only",
+			repoType: models.RepositoryTypeS3,
+			schedule: intPtr(256),
+			want:     []string{"--limit-upload=256"},
+		},
+		{
+			name:     "schedule limit overrides repository limit",
+			repoType: models.RepositoryTypeS3,
+			settings: &models.RepositoryTransferSettings{UploadLimitKB: intPtr(1024)},
+			schedule: intPtr(256),
+			want:     []string{"--limit-upload=256"},
+		},
+		{
+			name:     "all settings",
+			repoType: models.RepositoryTypeS3,
+			settings: &models.RepositoryTransferSettings{
+				UploadLimitKB:   intPtr(1024),
+				DownloadLimitKB: intPtr(2048),
+				PackSizeMB:      intPtr(64),
+				Connections:     intPtr(8),
+				BackendOptions: map[string]string{
+					"s3.storage-class":  "STANDARD_IA",
+					"s3.bucket-lookup":  "dns",
+					"sftp.args":         "-i key",
+					"azure.access-tier": "Cool",
+				},
+			},
+			want: []string{
+				"--limit-upload=1024",
+				"--limit-download=2048",
+				"--pack-size=64",
+				"--option=s3.connections=8",
+				"--option=s3.bucket-lookup=dns",
+				"--option=s3.storage-class=STANDARD_IA",
+			},
+		},
+		{
+			name:     "unsupported options are dropped",
+			repoType: models.RepositoryTypeSFTP,
+			settings: &models.RepositoryTransferSettings{
+				BackendOptions: map[string]string{
+					"sftp.command": "sh -c id",
+					"sftp.args":    "-o ProxyCommand=id",
+				},
+			},
+		},
+		{
+			name:     "gcs uses gs namespace",
+			repoType: models.RepositoryTypeGCS,
+			settings: &models.RepositoryTransferSettings{Connections: intPtr(4)},
+			want:     []string{"--option=gs.connections=4"},
+		},
+		{
+			name:     "dropbox uses rclone namespace",
+			repoType: models.RepositoryTypeDropbox,
+			settings: &models.RepositoryTransferSettings{Connections: intPtr(2)},
+			want:     []string{"--option=rclone.connections=2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TransferOptions(tt.repoType, tt.settings, tt.schedule)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TransferOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResticConfig_CommandArgs(t *testing.T) {
+	cfg := ResticConfig{Options: []string{"--limit-download=10"}}
+	got := cfg.CommandArgs([]string{"snapshots", "--json"})
+	want := []string{"--limit-download=10", "snapshots", "--json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CommandArgs() = %v, want %v", got, want)
+	}
+
+	if got := (ResticConfig{}).CommandArgs([]string{"check"}); !reflect.DeepEqual(got, []string{"check"}) {
+		t.Errorf("CommandArgs() without options = %v", got)
+	}
+}
@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// ErrDatabaseRestoreRunning is returned when a database restore is already running.
+var ErrDatabaseRestoreRunning = errors.New("database restore is already running")
+
+// DatabaseRestoreStore defines the persistence operations the database restorer needs.
+type DatabaseRestoreStore interface {
+	GetRepository(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	GetScheduleByID(ctx context.Context, id uuid.UUID) (*models.Schedule, error)
+	UpdateDatabaseRestore(ctx context.Context, restore *models.DatabaseRestore) error
+}
+
+// DatabaseRestoreStreamer streams a dump from a snapshot back into the
+// database server of a postgres or mysql schedule. It is implemented
+// outside this package by the database dumpers.
+type DatabaseRestoreStreamer interface {
+	StreamScheduleRestore(ctx context.Context, schedule models.Schedule, orgID uuid.UUID, restic *Restic, cfg ResticConfig, snapshotID, filename, database string) (*models.DatabaseRestoreResult, error)
+}
+
+// DatabaseRestorer restores PostgreSQL and MySQL dumps that postgres and
+// mysql schedules streamed into a repository. Like those backups, restores
+// run on the server and connect with the schedule's credentials.
+type DatabaseRestorer struct {
+	store    DatabaseRestoreStore
+	restic   *Restic
+	streamer DatabaseRestoreStreamer
+	repos    *RepositoryConfigResolver
+	logger   zerolog.Logger
+
+	runs runGuard
+}
+
+// NewDatabaseRestorer creates a new DatabaseRestorer.
+func NewDatabaseRestorer(
+	store DatabaseRestoreStore,
+	restic *Restic,
+	streamer DatabaseRestoreStreamer,
+	decrypt DecryptFunc,
+	password func(repoID uuid.UUID) (string, error),
+	logger zerolog.Logger,
+) *DatabaseRestorer {
+	return &DatabaseRestorer{
+		store:    store,
+		restic:   restic,
+		streamer: streamer,
+		repos:    NewRepositoryConfigResolver(store, decrypt, password),
+		logger:   logger.With().Str("component", "database_restorer").Logger(),
+	}
+}
+
+// StartRestore runs a restore in the background.
+func (d *DatabaseRestorer) StartRestore(ctx context.Context, restore *models.DatabaseRestore) error {
+	if !d.runs.claim(restore.ID) {
+		return ErrDatabaseRestoreRunning
+	}
+	go func() {
+		defer d.runs.release(restore.ID)
+		if err := d.run(ctx, restore); err != nil {
+			d.logger.Error().Err(err).Str("restore_id", restore.ID.String()).Msg("database restore failed")
+		}
+	}()
+	return nil
+}
+
+// Run runs a restore to completion in the calling goroutine.
+func (d *DatabaseRestorer) Run(ctx context.Context, restore *models.DatabaseRestore) error {
+	if !d.runs.claim(restore.ID) {
+		return ErrDatabaseRestoreRunning
+	}
+	defer d.runs.release(restore.ID)
+	return d.run(ctx, restore)
+}
+
+func (d *DatabaseRestorer) run(ctx context.Context, restore *models.DatabaseRestore) error {
+	restore.Start()
+	if err := d.store.UpdateDatabaseRestore(ctx, restore); err != nil {
+		return fmt.Errorf("update database restore: %w", err)
+	}
+
+	result, err := d.restore(ctx, restore)
+	if err != nil {
+		restore.Fail(err.Error())
+	} else {
+		restore.Complete(result)
+	}
+	if updateErr := d.store.UpdateDatabaseRestore(context.WithoutCancel(ctx), restore); updateErr != nil {
+		d.logger.Error().Err(updateErr).Str("restore_id", restore.ID.String()).Msg("failed to save database restore")
+	}
+	return err
+}
+
+func (d *DatabaseRestorer) restore(ctx context.Context, restore *models.DatabaseRestore) (*models.DatabaseRestoreResult, error) {
+	if d.streamer == nil {
+		return nil, errors.New("database streamer not configured")
+	}
+	_, resticCfg, err := d.repos.Resolve(ctx, restore.RepositoryID)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := d.store.GetScheduleByID(ctx, restore.ScheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("get schedule: %w", err)
+	}
+
+	filename := restore.Filename
+	if filename == "" {
+		if filename, err = d.findDump(ctx, resticCfg, restore.SnapshotID); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.streamer.StreamScheduleRestore(ctx, *schedule, restore.OrgID, d.restic, resticCfg, restore.SnapshotID, filename, restore.Database)
+}
+
+// findDump returns the name of the only file in a snapshot, which is the
+// dump for snapshots taken by postgres and mysql schedules.
+func (d *DatabaseRestorer) findDump(ctx context.Context, cfg ResticConfig, snapshotID string) (string, error) {
+	files, err := d.restic.ListFiles(ctx, cfg, snapshotID, "")
+	if err != nil {
+		return "", fmt.Errorf("list snapshot files: %w", err)
+	}
+	var dumps []string
+	for _, f := range files {
+		if f.Type == "file" {
+			dumps = append(dumps, path.Base(f.Path))
+		}
+	}
+	if len(dumps) != 1 {
+		return "", fmt.Errorf("snapshot %s holds %d files, set filename to pick the dump", snapshotID, len(dumps))
+	}
+	return dumps[0], nil
+}
@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type fakeDatabaseRestoreStore struct {
+	repo     *models.Repository
+	schedule *models.Schedule
+	restore  models.DatabaseRestore
+}
+
+func (s *fakeDatabaseRestoreStore) GetRepository(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	if s.repo == nil || s.repo.ID != id {
+		return nil, errors.New("not found")
+	}
+	return s.repo, nil
+}
+
+func (s *fakeDatabaseRestoreStore) GetScheduleByID(_ context.Context, id uuid.UUID) (*models.Schedule, error) {
+	if s.schedule == nil || s.schedule.ID != id {
+		return nil, errors.New("not found")
+	}
+	return s.schedule, nil
+}
+
+func (s *fakeDatabaseRestoreStore) UpdateDatabaseRestore(_ context.Context, r *models.DatabaseRestore) error {
+	s.restore = *r
+	return nil
+}
+
+type fakeDatabaseRestoreStreamer struct {
+	schedule   models.Schedule
+	orgID      uuid.UUID
+	snapshotID string
+	filename   string
+	database   string
+}
+
+func (f *fakeDatabaseRestoreStreamer) StreamScheduleRestore(_ context.Context, schedule models.Schedule, orgID uuid.UUID, _ *Restic, _ ResticConfig, snapshotID, filename, database string) (*models.DatabaseRestoreResult, error) {
+	f.schedule = schedule
+	f.orgID = orgID
+	f.snapshotID = snapshotID
+	f.filename = filename
+	f.database = database
+	return &models.DatabaseRestoreResult{Filename: filename, Database: database, SizeBytes: 42}, nil
+}
+
+func newTestDatabaseRestorer(t *testing.T, files []SnapshotFile) (*DatabaseRestorer, *fakeDatabaseRestoreStore, *fakeDatabaseRestoreStreamer, *models.DatabaseRestore) {
+	t.Helper()
+	dir := t.TempDir()
+	script := filepath.Join(dir, "restic")
+	if err := os.WriteFile(script, []byte(proxmoxRestoreScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{`{"struct_type":"snapshot","id":"aaaa1111"}`}
+	for _, f := range files {
+		b, _ := json.Marshal(f)
+		lines = append(lines, string(b))
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ls.json"), []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DIR", dir)
+
+	orgID := uuid.New()
+	repo := models.NewRepository(orgID, "db", models.RepositoryTypeLocal, []byte(`{"path":"`+dir+`"}`))
+	schedule := &models.Schedule{ID: uuid.New(), BackupType: models.BackupTypePostgres}
+	store := &fakeDatabaseRestoreStore{repo: repo, schedule: schedule}
+	streamer := &fakeDatabaseRestoreStreamer{}
+
+	decrypt := func(b []byte) ([]byte, error) { return b, nil }
+	password := func(uuid.UUID) (string, error) { return "secret", nil }
+	d := NewDatabaseRestorer(store, NewResticWithBinary(script, zerolog.Nop()), streamer, decrypt, password, zerolog.Nop())
+
+	restore := models.NewDatabaseRestore(orgID, schedule.ID, repo.ID, "aaaa1111")
+	return d, store, streamer, restore
+}
+
+func TestDatabaseRestorer_Run(t *testing.T) {
+	files := []SnapshotFile{{Name: "postgres_app.dump", Type: "file", Path: "/postgres_app.dump", Size: 42}}
+	d, store, streamer, restore := newTestDatabaseRestorer(t, files)
+	restore.Database = "app_restored"
+
+	if err := d.Run(context.Background(), restore); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if streamer.schedule.ID != restore.ScheduleID || streamer.orgID != restore.OrgID {
+		t.Errorf("streamer called with schedule %s org %s", streamer.schedule.ID, streamer.orgID)
+	}
+	if streamer.snapshotID != "aaaa1111" || streamer.filename != "postgres_app.dump" || streamer.database != "app_restored" {
+		t.Errorf("streamer restored %s %s into %q", streamer.snapshotID, streamer.filename, streamer.database)
+	}
+	got := store.restore
+	if got.Status != models.DatabaseRestoreStatusCompleted || got.Result == nil || got.Result.SizeBytes != 42 {
+		t.Errorf("restore = %s %q %+v", got.Status, got.ErrorMessage, got.Result)
+	}
+}
+
+func TestDatabaseRestorer_Run_Filename(t *testing.T) {
+	files := []SnapshotFile{
+		{Type: "file", Path: "/postgres_a.dump"},
+		{Type: "file", Path: "/postgres_b.dump"},
+	}
+
+	t.Run("ambiguous snapshot", func(t *testing.T) {
+		d, store, _, restore := newTestDatabaseRestorer(t, files)
+		if err := d.Run(context.Background(), restore); err == nil {
+			t.Fatal("expected an error for a snapshot with two files")
+		}
+		if store.restore.Status != models.DatabaseRestoreStatusFailed {
+			t.Errorf("status = %s, want failed", store.restore.Status)
+		}
+	})
+
+	t.Run("explicit filename", func(t *testing.T) {
+		d, _, streamer, restore := newTestDatabaseRestorer(t, files)
+		restore.Filename = "postgres_b.dump"
+		if err := d.Run(context.Background(), restore); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if streamer.filename != "postgres_b.dump" {
+			t.Errorf("filename = %q, want postgres_b.dump", streamer.filename)
+		}
+	})
+}
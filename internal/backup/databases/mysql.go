@@ -16,6 +16,8 @@ import (
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
 	"github.com/rs/zerolog"
 )
 
@@ -386,6 +388,114 @@ func (m *MySQLBackup) Backup(ctx context.Context, outputDir string) (*BackupResu
 	return result, nil
 }
 
+// StreamBackup dumps the configured databases straight into the repository
+// as a single file, without writing it to disk first. Compress is ignored:
+// restic compresses the stream itself, and gzip would defeat deduplication
+// between snapshots.
+func (m *MySQLBackup) StreamBackup(ctx context.Context, restic *backup.Restic, cfg backends.ResticConfig, tags []string, opts *backup.BackupOptions) (*StreamResult, error) {
+	mysqldump, err := m.findMySQLDump()
+	if err != nil {
+		return nil, err
+	}
+
+	var databases []string
+	if m.config.Database != "" {
+		databases = []string{m.config.Database}
+	} else if len(m.config.Databases) > 0 {
+		databases = m.config.Databases
+	}
+	filename := "mysql_all.sql"
+	if len(databases) == 1 {
+		filename = fmt.Sprintf("mysql_%s.sql", databases[0])
+	}
+
+	args := m.buildDumpArgs(databases)
+	m.logger.Info().
+		Str("host", m.config.Host).
+		Strs("databases", databases).
+		Str("filename", filename).
+		Strs("args", m.sanitizeArgs(args)).
+		Msg("streaming MySQL backup")
+
+	ctx, cancel := context.WithTimeout(ctx, m.config.DumpTimeout)
+	defer cancel()
+
+	tags = append(append([]string{}, tags...), "database:mysql")
+	result, err := streamDump(ctx, restic, cfg, filename, exec.CommandContext(ctx, mysqldump, args...), tags, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackupFailed, err)
+	}
+	result.Database = strings.Join(databases, ",")
+	if len(databases) == 0 {
+		result.Database = "all_databases"
+	}
+
+	m.logger.Info().
+		Str("snapshot_id", result.SnapshotID).
+		Int64("size_bytes", result.SizeBytes).
+		Str("sha256", result.SHA256).
+		Dur("duration", result.Duration).
+		Msg("MySQL backup streamed")
+
+	return result, nil
+}
+
+// StreamRestore streams a dump from a snapshot into the mysql client,
+// decompressing .gz dumps on the way. database selects the default
+// database for dumps that do not name one.
+func (m *MySQLBackup) StreamRestore(ctx context.Context, restic *backup.Restic, cfg backends.ResticConfig, snapshotID, filename, database string) (*StreamResult, error) {
+	client, err := m.findMySQLClient()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		fmt.Sprintf("--host=%s", m.config.Host),
+		fmt.Sprintf("--port=%d", m.config.Port),
+		fmt.Sprintf("--user=%s", m.config.Username),
+	}
+	switch m.config.SSLMode {
+	case "required", "verify-ca", "verify-identity":
+		args = append(args, "--ssl-mode="+strings.ToUpper(m.config.SSLMode))
+	}
+	if database != "" {
+		args = append(args, database)
+	}
+
+	cmd := exec.CommandContext(ctx, client, args...)
+	// The password is passed in the environment so it stays out of the
+	// process list.
+	cmd.Env = os.Environ()
+	if m.config.Password != "" {
+		cmd.Env = append(cmd.Env, "MYSQL_PWD="+m.config.Password)
+	}
+
+	var decode func(io.Reader) (io.Reader, error)
+	if strings.HasSuffix(filename, ".gz") {
+		decode = func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }
+	}
+
+	m.logger.Info().
+		Str("snapshot_id", snapshotID).
+		Str("filename", filename).
+		Str("database", database).
+		Msg("streaming MySQL restore")
+
+	result, err := streamRestore(ctx, restic, cfg, snapshotID, filename, decode, cmd)
+	if err != nil {
+		return nil, err
+	}
+	result.Database = database
+
+	m.logger.Info().
+		Int64("size_bytes", result.SizeBytes).
+		Str("sha256", result.SHA256).
+		Dur("duration", result.Duration).
+		Msg("MySQL restore completed")
+
+	return result, nil
+}
+
 // buildDumpArgs constructs the mysqldump command arguments.
 func (m *MySQLBackup) buildDumpArgs(databases []string) []string {
 	args := []string{
@@ -492,6 +602,27 @@ func (m *MySQLBackup) findMySQLDump() (string, error) {
 	return "", ErrMySQLDumpNotFound
 }
 
+// findMySQLClient finds the mysql or mariadb client, looking next to a
+// configured mysqldump first.
+func (m *MySQLBackup) findMySQLClient() (string, error) {
+	names := []string{"mysql", "mariadb"}
+	if m.config.MySQLDumpPath != "" {
+		dir := filepath.Dir(m.config.MySQLDumpPath)
+		for _, name := range names {
+			p := filepath.Join(dir, name)
+			if _, err := os.Stat(p); err == nil {
+				return p, nil
+			}
+		}
+	}
+	for _, name := range names {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+	return "", errors.New("mysql client not found")
+}
+
 // GetRestoreInstructions returns instructions for restoring a MySQL backup.
 func (m *MySQLBackup) GetRestoreInstructions(backupPath string) string {
 	isCompressed := strings.HasSuffix(backupPath, ".gz")
@@ -8,11 +8,14 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
 	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/rs/zerolog"
 )
@@ -22,6 +25,7 @@ const (
 	defaultPgDumpBinary    = "pg_dump"
 	defaultPgDumpAllBinary = "pg_dumpall"
 	defaultPsqlBinary      = "psql"
+	defaultPgRestoreBinary = "pg_restore"
 	defaultPostgresPort    = 5432
 	defaultPgBackupTimeout = 30 * time.Minute
 	defaultPgConnTimeout   = 30 * time.Second
@@ -377,6 +381,143 @@ func (p *PostgresBackup) backupAllDatabases(ctx context.Context, outputDir strin
 	return result, nil
 }
 
+// StreamBackup dumps the configured databases straight into the repository
+// without writing dump files, one snapshot per database. A failed database
+// does not stop the others; its error is returned alongside the results.
+func (p *PostgresBackup) StreamBackup(ctx context.Context, restic *backup.Restic, cfg backends.ResticConfig, tags []string, opts *backup.BackupOptions) ([]*StreamResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.Config.OutputFormat == models.PostgresFormatDirectory {
+		return nil, errors.New("directory format cannot be streamed, use custom or tar")
+	}
+	tags = append(append([]string{}, tags...), "database:postgres")
+
+	databases := p.Config.Databases
+	if p.Config.Database != "" {
+		databases = []string{p.Config.Database}
+	}
+	if len(databases) == 0 {
+		result, err := p.streamDump(ctx, restic, cfg, "", tags, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []*StreamResult{result}, nil
+	}
+
+	var results []*StreamResult
+	var errs []error
+	for _, database := range databases {
+		result, err := p.streamDump(ctx, restic, cfg, database, tags, opts)
+		if err != nil {
+			p.logger.Error().Err(err).Str("database", database).Msg("failed to stream database backup")
+			errs = append(errs, fmt.Errorf("database %s: %w", database, err))
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, errors.Join(errs...)
+}
+
+// streamDump streams one database with pg_dump, or all of them with
+// pg_dumpall when database is empty.
+func (p *PostgresBackup) streamDump(ctx context.Context, restic *backup.Restic, cfg backends.ResticConfig, database string, tags []string, opts *backup.BackupOptions) (*StreamResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultPgBackupTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	var filename string
+	if database == "" {
+		filename = "postgres_all.sql"
+		cmd = exec.CommandContext(ctx, p.findBinary(defaultPgDumpAllBinary), p.buildPgDumpAllArgs()...)
+	} else {
+		filename = fmt.Sprintf("postgres_%s%s", database, p.getFileExtension())
+		cmd = exec.CommandContext(ctx, p.findBinary(defaultPgDumpBinary), p.buildPgDumpArgs(database, "")...)
+	}
+	cmd.Env = p.buildEnvironment()
+
+	p.logger.Info().
+		Str("host", p.Config.Host).
+		Str("database", database).
+		Str("filename", filename).
+		Msg("streaming PostgreSQL backup")
+
+	result, err := streamDump(ctx, restic, cfg, filename, cmd, tags, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.Database = database
+	if database == "" {
+		result.Database = "all"
+	}
+
+	p.logger.Info().
+		Str("snapshot_id", result.SnapshotID).
+		Int64("size_bytes", result.SizeBytes).
+		Str("sha256", result.SHA256).
+		Dur("duration", result.Duration).
+		Msg("PostgreSQL backup streamed")
+
+	return result, nil
+}
+
+// StreamRestore streams a dump from a snapshot into the server. Plain SQL
+// dumps are run with psql and archive formats with pg_restore; both stop at
+// the first error. The target database is required for archive formats. A
+// single database is restored in one transaction, so a failed restore
+// leaves it unchanged.
+func (p *PostgresBackup) StreamRestore(ctx context.Context, restic *backup.Restic, cfg backends.ResticConfig, snapshotID, filename, database string) (*StreamResult, error) {
+	conn := []string{
+		"-h", p.Config.Host,
+		"-p", strconv.Itoa(p.Config.Port),
+		"-U", p.Config.Username,
+	}
+
+	var cmd *exec.Cmd
+	switch ext := path.Ext(filename); ext {
+	case ".sql":
+		// A pg_dumpall script connects to each database itself.
+		target := "postgres"
+		if database != "" {
+			target = database
+		}
+		args := append(conn, "-d", target, "-v", "ON_ERROR_STOP=1", "-q")
+		if database != "" {
+			args = append(args, "--single-transaction")
+		}
+		cmd = exec.CommandContext(ctx, p.findBinary(defaultPsqlBinary), args...)
+	case ".dump", ".tar":
+		if database == "" {
+			return nil, fmt.Errorf("a target database is required to restore %s", filename)
+		}
+		args := append(conn, "-d", database, "--exit-on-error", "--single-transaction")
+		cmd = exec.CommandContext(ctx, p.findBinary(defaultPgRestoreBinary), args...)
+	default:
+		return nil, fmt.Errorf("cannot restore %s: unknown dump format %q", filename, ext)
+	}
+	cmd.Env = p.buildEnvironment()
+
+	p.logger.Info().
+		Str("snapshot_id", snapshotID).
+		Str("filename", filename).
+		Str("database", database).
+		Msg("streaming PostgreSQL restore")
+
+	result, err := streamRestore(ctx, restic, cfg, snapshotID, filename, nil, cmd)
+	if err != nil {
+		return nil, err
+	}
+	result.Database = database
+
+	p.logger.Info().
+		Int64("size_bytes", result.SizeBytes).
+		Str("sha256", result.SHA256).
+		Dur("duration", result.Duration).
+		Msg("PostgreSQL restore completed")
+
+	return result, nil
+}
+
 // buildPgDumpArgs builds the command line arguments for pg_dump.
 func (p *PostgresBackup) buildPgDumpArgs(database, outputFile string) []string {
 	args := []string{
@@ -428,8 +569,10 @@ func (p *PostgresBackup) buildPgDumpArgs(database, outputFile string) []string {
 		args = append(args, "-t", table)
 	}
 
-	// Output file
-	args = append(args, "-f", outputFile)
+	// Output file, or stdout when streaming
+	if outputFile != "" {
+		args = append(args, "-f", outputFile)
+	}
 
 	return args
 }
@@ -0,0 +1,191 @@
+package databases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// ConnectionStore looks up the database connections MySQL schedules use.
+type ConnectionStore interface {
+	GetDatabaseConnectionByID(ctx context.Context, id uuid.UUID) (*models.DatabaseConnection, error)
+}
+
+// SecretDecrypter decrypts stored database passwords.
+type SecretDecrypter interface {
+	Decrypt(ciphertext []byte) ([]byte, error)
+	DecryptString(encodedCiphertext string) (string, error)
+}
+
+// ScheduleStreamer runs postgres and mysql schedules by streaming their
+// dumps straight into the repository. It implements backup.DatabaseStreamer.
+type ScheduleStreamer struct {
+	connections ConnectionStore
+	secrets     SecretDecrypter
+	logger      zerolog.Logger
+}
+
+// NewScheduleStreamer creates a new ScheduleStreamer.
+func NewScheduleStreamer(connections ConnectionStore, secrets SecretDecrypter, logger zerolog.Logger) *ScheduleStreamer {
+	return &ScheduleStreamer{
+		connections: connections,
+		secrets:     secrets,
+		logger:      logger.With().Str("component", "database_schedule_streamer").Logger(),
+	}
+}
+
+// StreamScheduleBackup dumps the schedule's databases into the repository,
+// one snapshot per dump, and returns the stats of each snapshot. If some
+// postgres databases fail, the others' stats are returned with the error.
+// orgID is the organization that owns the schedule's agent.
+func (s *ScheduleStreamer) StreamScheduleBackup(ctx context.Context, schedule models.Schedule, orgID uuid.UUID, restic *backup.Restic, cfg backends.ResticConfig, tags []string) ([]*backup.BackupStats, error) {
+	var results []*StreamResult
+	var streamErr error
+	switch {
+	case schedule.IsPostgresBackup():
+		pg, err := s.postgresBackup(schedule)
+		if err != nil {
+			return nil, err
+		}
+		results, streamErr = pg.StreamBackup(ctx, restic, cfg, tags, nil)
+	case schedule.IsMySQLBackup():
+		mysql, err := s.mysqlBackup(ctx, schedule, orgID)
+		if err != nil {
+			return nil, err
+		}
+		result, err := mysql.StreamBackup(ctx, restic, cfg, tags, nil)
+		if err != nil {
+			return nil, err
+		}
+		results = []*StreamResult{result}
+	default:
+		return nil, fmt.Errorf("schedule %s is not a database backup", schedule.ID)
+	}
+
+	if len(results) == 0 && streamErr == nil {
+		return nil, errors.New("no databases were dumped")
+	}
+	stats := make([]*backup.BackupStats, 0, len(results))
+	for _, result := range results {
+		stats = append(stats, &backup.BackupStats{
+			SnapshotID: result.SnapshotID,
+			SizeBytes:  result.SizeBytes,
+			Duration:   result.Duration,
+		})
+	}
+	return stats, streamErr
+}
+
+// StreamScheduleRestore streams a dump from a snapshot into the database
+// server of a postgres or mysql schedule, with the same connection and
+// credentials its backups use. It implements backup.DatabaseRestoreStreamer.
+func (s *ScheduleStreamer) StreamScheduleRestore(ctx context.Context, schedule models.Schedule, orgID uuid.UUID, restic *backup.Restic, cfg backends.ResticConfig, snapshotID, filename, database string) (*models.DatabaseRestoreResult, error) {
+	var result *StreamResult
+	switch {
+	case schedule.IsPostgresBackup():
+		pg, err := s.postgresBackup(schedule)
+		if err != nil {
+			return nil, err
+		}
+		if result, err = pg.StreamRestore(ctx, restic, cfg, snapshotID, filename, database); err != nil {
+			return nil, err
+		}
+	case schedule.IsMySQLBackup():
+		mysql, err := s.mysqlBackup(ctx, schedule, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if result, err = mysql.StreamRestore(ctx, restic, cfg, snapshotID, filename, database); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("schedule %s is not a database backup", schedule.ID)
+	}
+
+	return &models.DatabaseRestoreResult{
+		Filename:   result.Filename,
+		Database:   result.Database,
+		SizeBytes:  result.SizeBytes,
+		SHA256:     result.SHA256,
+		DurationMs: result.Duration.Milliseconds(),
+	}, nil
+}
+
+// postgresBackup builds the dumper for a postgres schedule. The pg_dump path
+// override is ignored: the server runs the dump, so a schedule must not
+// choose the program it executes.
+func (s *ScheduleStreamer) postgresBackup(schedule models.Schedule) (*PostgresBackup, error) {
+	if schedule.PostgresConfig == nil {
+		return nil, errors.New("postgres_config is required for PostgreSQL backups")
+	}
+	config := *schedule.PostgresConfig
+	config.PgDumpPath = ""
+
+	pg := NewPostgresBackup(&config, s.logger)
+	if config.PasswordEncrypted != "" {
+		password, err := s.secrets.DecryptString(config.PasswordEncrypted)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt postgres password: %w", err)
+		}
+		pg.DecryptedPassword = password
+	}
+	return pg, nil
+}
+
+// mysqlBackup builds the dumper for a mysql schedule from its database
+// connection, which must belong to orgID and, if it is agent-specific, to
+// the schedule's agent. Extra mysqldump arguments are ignored because the
+// server runs the dump.
+func (s *ScheduleStreamer) mysqlBackup(ctx context.Context, schedule models.Schedule, orgID uuid.UUID) (*MySQLBackup, error) {
+	opts := schedule.MySQLConfig
+	if opts == nil || opts.DatabaseConnectionID == nil {
+		return nil, errors.New("mysql_config with a database_connection_id is required for MySQL backups")
+	}
+
+	conn, err := s.connections.GetDatabaseConnectionByID(ctx, *opts.DatabaseConnectionID)
+	if err != nil || conn.OrgID != orgID {
+		return nil, errors.New("database connection not found")
+	}
+	if conn.AgentID != nil && *conn.AgentID != schedule.AgentID {
+		return nil, errors.New("database connection belongs to another agent")
+	}
+	if !conn.Enabled {
+		return nil, errors.New("database connection is disabled")
+	}
+
+	databases := append([]string{opts.Database}, opts.Databases...)
+	databases = append(databases, opts.ExcludeDatabases...)
+	for _, name := range databases {
+		if strings.HasPrefix(name, "-") {
+			return nil, fmt.Errorf("invalid database name %q", name)
+		}
+	}
+
+	credJSON, err := s.secrets.Decrypt(conn.CredentialsEncrypted)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt database credentials: %w", err)
+	}
+	var credentials models.DatabaseCredentials
+	if err := json.Unmarshal(credJSON, &credentials); err != nil {
+		return nil, fmt.Errorf("parse database credentials: %w", err)
+	}
+
+	return NewMySQLBackup(&MySQLConfig{
+		Host:             conn.Host,
+		Port:             conn.Port,
+		Username:         conn.Username,
+		Password:         credentials.Password,
+		SSLMode:          conn.SSLMode,
+		Database:         opts.Database,
+		Databases:        opts.Databases,
+		ExcludeDatabases: opts.ExcludeDatabases,
+	}, s.logger), nil
+}
@@ -0,0 +1,167 @@
+package databases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+)
+
+type fakeConnectionStore struct {
+	conns map[uuid.UUID]*models.DatabaseConnection
+}
+
+func (f *fakeConnectionStore) GetDatabaseConnectionByID(_ context.Context, id uuid.UUID) (*models.DatabaseConnection, error) {
+	conn, ok := f.conns[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return conn, nil
+}
+
+// plainSecrets treats ciphertexts as plaintext.
+type plainSecrets struct{}
+
+func (plainSecrets) Decrypt(ciphertext []byte) ([]byte, error) { return ciphertext, nil }
+
+func (plainSecrets) DecryptString(ciphertext string) (string, error) { return ciphertext, nil }
+
+func TestScheduleStreamer_PostgresBackup(t *testing.T) {
+	streamer := NewScheduleStreamer(&fakeConnectionStore{}, plainSecrets{}, testLogger())
+
+	t.Run("missing config", func(t *testing.T) {
+		_, err := streamer.postgresBackup(models.Schedule{BackupType: models.BackupTypePostgres})
+		if err == nil {
+			t.Error("expected error for missing postgres_config")
+		}
+	})
+
+	t.Run("decrypts password and ignores binary override", func(t *testing.T) {
+		schedule := models.Schedule{
+			BackupType: models.BackupTypePostgres,
+			PostgresConfig: &models.PostgresBackupConfig{
+				Host:              "db.internal",
+				Username:          "backup",
+				PasswordEncrypted: "secret",
+				PgDumpPath:        "/bin/sh",
+			},
+		}
+		pg, err := streamer.postgresBackup(schedule)
+		if err != nil {
+			t.Fatalf("postgresBackup() error = %v", err)
+		}
+		if pg.DecryptedPassword != "secret" {
+			t.Errorf("DecryptedPassword = %q, want secret", pg.DecryptedPassword)
+		}
+		if pg.Config.PgDumpPath != "" {
+			t.Errorf("PgDumpPath = %q, want it ignored", pg.Config.PgDumpPath)
+		}
+		if schedule.PostgresConfig.PgDumpPath != "/bin/sh" {
+			t.Error("the schedule's config must not be modified")
+		}
+	})
+}
+
+func TestScheduleStreamer_MySQLBackup(t *testing.T) {
+	orgID := uuid.New()
+	agentID := uuid.New()
+	otherAgent := uuid.New()
+	creds, _ := json.Marshal(models.DatabaseCredentials{Password: "s3cret"})
+
+	newConn := func(org uuid.UUID, agent *uuid.UUID, enabled bool) *models.DatabaseConnection {
+		return &models.DatabaseConnection{
+			ID:                   uuid.New(),
+			OrgID:                org,
+			AgentID:              agent,
+			Type:                 models.DatabaseTypeMySQL,
+			Host:                 "mysql.internal",
+			Port:                 3306,
+			Username:             "backup",
+			CredentialsEncrypted: creds,
+			Enabled:              enabled,
+		}
+	}
+	shared := newConn(orgID, nil, true)
+	pinned := newConn(orgID, &otherAgent, true)
+	foreign := newConn(uuid.New(), nil, true)
+	disabled := newConn(orgID, nil, false)
+	store := &fakeConnectionStore{conns: map[uuid.UUID]*models.DatabaseConnection{
+		shared.ID: shared, pinned.ID: pinned, foreign.ID: foreign, disabled.ID: disabled,
+	}}
+	streamer := NewScheduleStreamer(store, plainSecrets{}, testLogger())
+
+	schedule := func(connID *uuid.UUID, databases ...string) models.Schedule {
+		return models.Schedule{
+			AgentID:     agentID,
+			BackupType:  models.BackupTypeMySQL,
+			MySQLConfig: &models.MySQLBackupConfig{DatabaseConnectionID: connID, Databases: databases, ExtraArgs: []string{"--result-file=/etc/passwd"}},
+		}
+	}
+
+	t.Run("builds config from connection", func(t *testing.T) {
+		m, err := streamer.mysqlBackup(context.Background(), schedule(&shared.ID, "app"), orgID)
+		if err != nil {
+			t.Fatalf("mysqlBackup() error = %v", err)
+		}
+		if m.config.Host != "mysql.internal" || m.config.Password != "s3cret" {
+			t.Errorf("config = %+v, want connection host and password", m.config)
+		}
+		if len(m.config.ExtraArgs) != 0 {
+			t.Errorf("ExtraArgs = %v, want them ignored", m.config.ExtraArgs)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		sched   models.Schedule
+		wantErr string
+	}{
+		{"no connection", schedule(nil), "database_connection_id is required"},
+		{"unknown connection", schedule(ptrUUID(uuid.New())), "not found"},
+		{"other organization", schedule(&foreign.ID), "not found"},
+		{"other agent", schedule(&pinned.ID), "another agent"},
+		{"disabled", schedule(&disabled.ID), "disabled"},
+		{"option-like database", schedule(&shared.ID, "--result-file=/tmp/x"), "invalid database name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := streamer.mysqlBackup(context.Background(), tt.sched, orgID)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("mysqlBackup() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func ptrUUID(id uuid.UUID) *uuid.UUID {
+	return &id
+}
+
+func TestScheduleStreamer_StreamScheduleRestore(t *testing.T) {
+	orgID := uuid.New()
+	conn := &models.DatabaseConnection{ID: uuid.New(), OrgID: uuid.New(), Type: models.DatabaseTypeMySQL, Enabled: true}
+	streamer := NewScheduleStreamer(&fakeConnectionStore{conns: map[uuid.UUID]*models.DatabaseConnection{conn.ID: conn}}, plainSecrets{}, testLogger())
+
+	t.Run("not a database schedule", func(t *testing.T) {
+		_, err := streamer.StreamScheduleRestore(context.Background(), models.Schedule{BackupType: models.BackupTypeFile}, orgID, nil, backends.ResticConfig{}, "abc", "dump.sql", "")
+		if err == nil {
+			t.Error("expected error for a file schedule")
+		}
+	})
+
+	t.Run("connection of another organization", func(t *testing.T) {
+		schedule := models.Schedule{
+			BackupType:  models.BackupTypeMySQL,
+			MySQLConfig: &models.MySQLBackupConfig{DatabaseConnectionID: &conn.ID},
+		}
+		_, err := streamer.StreamScheduleRestore(context.Background(), schedule, orgID, nil, backends.ResticConfig{}, "abc", "mysql_all.sql", "")
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("error = %v, want database connection not found", err)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/backup/streamio"
+)
+
+// stderrLimit caps how much of a dump or restore command's stderr is kept
+// for error messages.
+const stderrLimit = 4096
+
+// StreamResult describes a dump streamed into or out of a restic repository.
+type StreamResult struct {
+	Database   string        `json:"database"`
+	Filename   string        `json:"filename"`
+	SnapshotID string        `json:"snapshot_id"`
+	SizeBytes  int64         `json:"size_bytes"`
+	SHA256     string        `json:"sha256,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// streamDump runs a dump command and pipes its stdout into restic backup
+// --stdin as filename. If the command fails, restic is stopped before the
+// input ends, so no snapshot of a partial dump is created.
+func streamDump(ctx context.Context, restic *backup.Restic, cfg backends.ResticConfig, filename string, cmd *exec.Cmd, tags []string, opts *backup.BackupOptions) (*StreamResult, error) {
+	start := time.Now()
+
+	pr, pw := io.Pipe()
+	stderr := streamio.NewTailBuffer(stderrLimit)
+	cmd.Stdout = pw
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", commandName(cmd), err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(commandError(cmd, cmd.Wait(), stderr))
+	}()
+
+	stats, err := restic.BackupStdin(ctx, cfg, filename, pr, tags, opts)
+	// Stop a dump that restic is no longer reading.
+	pr.Close()
+	if err != nil && cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+	<-done
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamResult{
+		Filename:   filename,
+		SnapshotID: stats.SnapshotID,
+		SizeBytes:  stats.StdinBytes,
+		SHA256:     stats.StdinSHA256,
+		Duration:   time.Since(start),
+	}, nil
+}
+
+// streamRestore pipes filename from a snapshot into a restore command's
+// stdin, through decode when it is set. If reading the snapshot fails, the
+// command is killed before its input ends, so it never applies a truncated
+// dump as if it were complete.
+func streamRestore(ctx context.Context, restic *backup.Restic, cfg backends.ResticConfig, snapshotID, filename string, decode func(io.Reader) (io.Reader, error), cmd *exec.Cmd) (*StreamResult, error) {
+	start := time.Now()
+
+	dump, err := restic.Dump(ctx, cfg, snapshotID, filename, "")
+	if err != nil {
+		return nil, err
+	}
+	defer dump.Close()
+
+	digest := streamio.NewDigestReader(dump)
+	var src io.Reader = digest
+	if decode != nil {
+		src = &lazyReader{open: func() (io.Reader, error) { return decode(digest) }}
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := streamio.NewTailBuffer(stderrLimit)
+	cmd.Stdout = io.Discard
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", commandName(cmd), err)
+	}
+
+	readErr := copyInput(stdin, src)
+	if readErr != nil {
+		cmd.Process.Kill()
+	}
+	stdin.Close()
+	waitErr := cmd.Wait()
+	if readErr != nil {
+		return nil, fmt.Errorf("read %s from snapshot %s: %w", filename, snapshotID, readErr)
+	}
+	if err := commandError(cmd, waitErr, stderr); err != nil {
+		return nil, err
+	}
+
+	return &StreamResult{
+		Filename:   filename,
+		SnapshotID: snapshotID,
+		SizeBytes:  digest.N(),
+		SHA256:     digest.SHA256(),
+		Duration:   time.Since(start),
+	}, nil
+}
+
+// copyInput copies src to dst until src ends or dst stops accepting data,
+// and returns only errors from reading src. A command that exits early
+// reports its own failure from Wait.
+func copyInput(dst io.Writer, src io.Reader) error {
+	buf := make([]byte, 256*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// commandError describes a failed dump or restore command with the tail of
+// its stderr.
+func commandError(cmd *exec.Cmd, err error, stderr *streamio.TailBuffer) error {
+	if err == nil {
+		return nil
+	}
+	msg := strings.TrimSpace(stderr.String())
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && msg != "" {
+		return fmt.Errorf("%s: %w: %s", commandName(cmd), err, msg)
+	}
+	return fmt.Errorf("%s: %w", commandName(cmd), err)
+}
+
+func commandName(cmd *exec.Cmd) string {
+	if len(cmd.Args) > 0 {
+		return cmd.Args[0]
+	}
+	return cmd.Path
+}
+
+// lazyReader opens its source on the first read, so decoder errors such as
+// a bad gzip header are reported like any other read error.
+type lazyReader struct {
+	open func() (io.Reader, error)
+	r    io.Reader
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.r == nil {
+		r, err := l.open()
+		if err != nil {
+			return 0, err
+		}
+		l.r = r
+	}
+	return l.r.Read(p)
+}
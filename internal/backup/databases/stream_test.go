@@ -0,0 +1,234 @@
+package databases
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/models"
+)
+
+// fakeResticScript stores backup arguments and input in $DIR, and dumps
+// $DIR/snapshot, failing afterwards when $DUMP_FAIL is set. Backups only
+// report a snapshot once their input has ended.
+const fakeResticScript = `echo "$@" > "$DIR/restic.args"
+case "$1" in
+backup)
+	cat > "$DIR/restic.stdin"
+	echo '{"message_type":"summary","snapshot_id":"snap1","files_new":1}' ;;
+dump)
+	cat "$DIR/snapshot"
+	[ -z "$DUMP_FAIL" ] || { echo "pack not found" >&2; exit 1; } ;;
+esac`
+
+// streamHost installs fake restic and database tools on PATH and returns
+// the directory they record into.
+func streamHost(t *testing.T, tools map[string]string) (string, *backup.Restic, backends.ResticConfig) {
+	t.Helper()
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tools["restic"] = fakeResticScript
+	for name, body := range tools {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("DIR", dir)
+	restic := backup.NewResticWithBinary(filepath.Join(bin, "restic"), testLogger())
+	return dir, restic, backends.ResticConfig{Repository: "/tmp/repo", Password: "secret"}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestPostgresBackup_StreamBackup(t *testing.T) {
+	dir, restic, cfg := streamHost(t, map[string]string{
+		"pg_dump": `for a; do [ "$a" = crm ] && { echo "connection refused" >&2; exit 1; }; done
+echo "pg_dump $* PGPASSWORD=$PGPASSWORD"`,
+		"pg_dumpall": `echo "pg_dumpall $*"`,
+	})
+	newBackup := func(config *models.PostgresBackupConfig) *PostgresBackup {
+		config.Host, config.Username = "db", "app"
+		p := NewPostgresBackup(config, testLogger())
+		p.DecryptedPassword = "pw"
+		return p
+	}
+
+	t.Run("single database", func(t *testing.T) {
+		results, err := newBackup(&models.PostgresBackupConfig{Database: "shop"}).StreamBackup(context.Background(), restic, cfg, []string{"agent:a1"}, nil)
+		if err != nil {
+			t.Fatalf("StreamBackup() error = %v", err)
+		}
+		want := "pg_dump -h db -p 5432 -U app -d shop -F c PGPASSWORD=pw\n"
+		if got := readFile(t, filepath.Join(dir, "restic.stdin")); got != want {
+			t.Errorf("restic input = %q, want %q", got, want)
+		}
+		if len(results) != 1 {
+			t.Fatalf("got %d results, want 1", len(results))
+		}
+		r := results[0]
+		if r.SnapshotID != "snap1" || r.Database != "shop" || r.Filename != "postgres_shop.dump" {
+			t.Errorf("result = %+v", r)
+		}
+		if r.SizeBytes != int64(len(want)) || r.SHA256 != sha256Hex(want) {
+			t.Errorf("size = %d, sha256 = %s, want %d, %s", r.SizeBytes, r.SHA256, len(want), sha256Hex(want))
+		}
+		args := readFile(t, filepath.Join(dir, "restic.args"))
+		if !strings.Contains(args, "--stdin --stdin-filename postgres_shop.dump --tag agent:a1 --tag database:postgres") {
+			t.Errorf("restic args = %q", args)
+		}
+	})
+
+	t.Run("all databases", func(t *testing.T) {
+		results, err := newBackup(&models.PostgresBackupConfig{}).StreamBackup(context.Background(), restic, cfg, nil, nil)
+		if err != nil {
+			t.Fatalf("StreamBackup() error = %v", err)
+		}
+		if len(results) != 1 || results[0].Filename != "postgres_all.sql" || results[0].Database != "all" {
+			t.Errorf("results = %+v", results)
+		}
+	})
+
+	t.Run("failed database creates no snapshot", func(t *testing.T) {
+		results, err := newBackup(&models.PostgresBackupConfig{Databases: []string{"shop", "crm"}}).StreamBackup(context.Background(), restic, cfg, nil, nil)
+		if err == nil || !strings.Contains(err.Error(), "database crm") || !strings.Contains(err.Error(), "connection refused") {
+			t.Fatalf("StreamBackup() error = %v, want crm failure", err)
+		}
+		if len(results) != 1 || results[0].Database != "shop" {
+			t.Errorf("results = %+v, want only shop", results)
+		}
+	})
+
+	t.Run("directory format", func(t *testing.T) {
+		_, err := newBackup(&models.PostgresBackupConfig{Database: "shop", OutputFormat: models.PostgresFormatDirectory}).StreamBackup(context.Background(), restic, cfg, nil, nil)
+		if err == nil {
+			t.Error("expected error for directory format")
+		}
+	})
+}
+
+func TestPostgresBackup_StreamRestore(t *testing.T) {
+	client := `echo "$(basename "$0") $*" > "$DIR/client.args"
+cat > "$DIR/client.stdin"
+touch "$DIR/client.done"`
+	dir, restic, cfg := streamHost(t, map[string]string{"psql": client, "pg_restore": client})
+	p := NewPostgresBackup(&models.PostgresBackupConfig{Host: "db", Username: "app"}, testLogger())
+	data := "CREATE TABLE t ();"
+	if err := os.WriteFile(filepath.Join(dir, "snapshot"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		database string
+		args     string
+	}{
+		{"plain dump", "postgres_shop.sql", "shop", "psql -h db -p 5432 -U app -d shop -v ON_ERROR_STOP=1 -q --single-transaction\n"},
+		{"pg_dumpall script", "postgres_all.sql", "", "psql -h db -p 5432 -U app -d postgres -v ON_ERROR_STOP=1 -q\n"},
+		{"custom archive", "postgres_shop.dump", "shop", "pg_restore -h db -p 5432 -U app -d shop --exit-on-error --single-transaction\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := p.StreamRestore(context.Background(), restic, cfg, "snap1", tt.filename, tt.database)
+			if err != nil {
+				t.Fatalf("StreamRestore() error = %v", err)
+			}
+			if got := readFile(t, filepath.Join(dir, "client.args")); got != tt.args {
+				t.Errorf("client args = %q, want %q", got, tt.args)
+			}
+			if got := readFile(t, filepath.Join(dir, "client.stdin")); got != data {
+				t.Errorf("client input = %q, want %q", got, data)
+			}
+			if result.SizeBytes != int64(len(data)) || result.SHA256 != sha256Hex(data) {
+				t.Errorf("result = %+v", result)
+			}
+			if got := readFile(t, filepath.Join(dir, "restic.args")); !strings.Contains(got, "dump --repo /tmp/repo snap1 /"+tt.filename) {
+				t.Errorf("restic args = %q", got)
+			}
+		})
+	}
+
+	t.Run("archive needs a database", func(t *testing.T) {
+		if _, err := p.StreamRestore(context.Background(), restic, cfg, "snap1", "postgres_shop.dump", ""); err == nil {
+			t.Error("expected error without target database")
+		}
+	})
+
+	t.Run("failed dump stops the client", func(t *testing.T) {
+		os.Remove(filepath.Join(dir, "client.done"))
+		t.Setenv("DUMP_FAIL", "1")
+		_, err := p.StreamRestore(context.Background(), restic, cfg, "snap1", "postgres_shop.sql", "shop")
+		if err == nil || !strings.Contains(err.Error(), "pack not found") {
+			t.Fatalf("StreamRestore() error = %v, want dump error", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "client.done")); !os.IsNotExist(err) {
+			t.Error("psql read the whole input after the dump failed")
+		}
+	})
+}
+
+func TestMySQLBackup_Stream(t *testing.T) {
+	dir, restic, cfg := streamHost(t, map[string]string{
+		"mysqldump": `echo "-- mysqldump $*"`,
+		"mysql":     `echo "$* MYSQL_PWD=$MYSQL_PWD" > "$DIR/client.args"; cat > "$DIR/client.stdin"`,
+	})
+	m := NewMySQLBackup(&MySQLConfig{Host: "db", Username: "root", Password: "pw", Database: "shop", Compress: true}, testLogger())
+
+	result, err := m.StreamBackup(context.Background(), restic, cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("StreamBackup() error = %v", err)
+	}
+	dump := readFile(t, filepath.Join(dir, "restic.stdin"))
+	if !strings.HasPrefix(dump, "-- mysqldump --host=db --port=3306 --user=root") || !strings.HasSuffix(dump, " shop\n") {
+		t.Errorf("restic input = %q", dump)
+	}
+	if result.Filename != "mysql_shop.sql" || result.Database != "shop" || result.SHA256 != sha256Hex(dump) {
+		t.Errorf("result = %+v", result)
+	}
+
+	// Dumps written by Backup with Compress are gzipped.
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("INSERT INTO t VALUES (1);"))
+	w.Close()
+	if err := os.WriteFile(filepath.Join(dir, "snapshot"), gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = m.StreamRestore(context.Background(), restic, cfg, "snap1", "mysql_shop.sql.gz", "shop")
+	if err != nil {
+		t.Fatalf("StreamRestore() error = %v", err)
+	}
+	if got := readFile(t, filepath.Join(dir, "client.stdin")); got != "INSERT INTO t VALUES (1);" {
+		t.Errorf("client input = %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "client.args")); got != "--host=db --port=3306 --user=root shop MYSQL_PWD=pw\n" {
+		t.Errorf("client args = %q", got)
+	}
+	if result.SizeBytes != int64(gz.Len()) {
+		t.Errorf("SizeBytes = %d, want %d", result.SizeBytes, gz.Len())
+	}
+}
@@ -182,9 +182,15 @@ func (r *Restic) extractFile(ctx context.Context, cfg ResticConfig, snapshotID,
 	// Use restic dump to extract the file content
 	args := []string{"dump", "--repo", cfg.Repository, snapshotID, filePath}
 
-	cmd := exec.CommandContext(ctx, r.binary, args...)
+	env, cleanup, err := cfg.MaterializeEnv()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, r.binary, cfg.CommandArgs(args)...)
 	cmd.Env = append(cmd.Environ(), fmt.Sprintf("RESTIC_PASSWORD=%s", cfg.Password))
-	for k, v := range cfg.Env {
+	for k, v := range env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
 
@@ -267,9 +273,15 @@ func (r *Restic) GetFileFromSnapshot(ctx context.Context, cfg ResticConfig, snap
 
 	args := []string{"dump", "--repo", cfg.Repository, snapshotID, filePath}
 
-	cmd := exec.CommandContext(ctx, r.binary, args...)
+	env, cleanup, err := cfg.MaterializeEnv()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, r.binary, cfg.CommandArgs(args)...)
 	cmd.Env = append(cmd.Environ(), fmt.Sprintf("RESTIC_PASSWORD=%s", cfg.Password))
-	for k, v := range cfg.Env {
+	for k, v := range env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
 
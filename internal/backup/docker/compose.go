@@ -3,6 +3,7 @@ package docker
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
@@ -182,24 +183,61 @@ type StackRestoreOptions struct {
 	TargetDir       string            // Directory to restore to
 	RestoreVolumes  bool              // Whether to restore volumes
 	RestoreImages   bool              // Whether to restore images
-	PathMappings    map[string]string // Map original paths to new paths
+	PathMappings    map[string]string // Map original bind mount paths (or their parents) to new paths
 	StartContainers bool              // Whether to start containers after restore
+
+	// Remapping for restores onto another host. Volume and network names
+	// are the names on the source host or their compose keys; ports are
+	// published host ports such as "8080" or "53/udp".
+	ProjectName     string            // Compose project name (defaults to the backed up stack name)
+	VolumeMappings  map[string]string // Map original volume names to new names
+	NetworkMappings map[string]string // Map original network names to new names
+	SubnetMappings  map[string]string // Map original network subnets to new subnets
+	PortMappings    map[string]string // Map published host ports to new ports
+	DryRun          bool              // Only plan the restore; change nothing
+	Force           bool              // Restore even if the plan reports conflicts
 }
 
 // ComposeBackup provides Docker Compose stack backup functionality.
+// Stack lifecycle (docker compose) always uses the CLI; everything else,
+// including copying volume data, goes through the Engine API when it is
+// reachable.
 type ComposeBackup struct {
+	engine *EngineClient
 	logger zerolog.Logger
 }
 
-// NewComposeBackup creates a new ComposeBackup instance.
+// NewComposeBackup creates a new ComposeBackup instance that uses the shared Engine API client.
 func NewComposeBackup(logger zerolog.Logger) *ComposeBackup {
 	return &ComposeBackup{
+		engine: DefaultEngineClient(logger),
 		logger: logger.With().Str("component", "compose_backup").Logger(),
 	}
 }
 
+// SetEngineClient sets the Engine API client. With nil, only the CLI is used.
+func (cb *ComposeBackup) SetEngineClient(engine *EngineClient) {
+	cb.engine = engine
+}
+
+// useEngine reports whether an Engine API call's result should be used. It
+// is false when the daemon socket was unreachable and the CLI should be tried.
+func (cb *ComposeBackup) useEngine(err error) bool {
+	if engineUnavailable(err) {
+		cb.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+		return false
+	}
+	return true
+}
+
 // CheckDockerAvailable verifies that Docker is installed and accessible.
 func (cb *ComposeBackup) CheckDockerAvailable(ctx context.Context) error {
+	if cb.engine != nil {
+		if err := cb.engine.Ping(ctx); cb.useEngine(err) {
+			return err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, "docker", "version", "--format", "{{.Server.Version}}")
 	if err := cmd.Run(); err != nil {
 		return ErrDockerNotAvailable
@@ -380,23 +418,16 @@ func (cb *ComposeBackup) GetContainerStates(ctx context.Context, composePath, _
 		}
 
 		// Get detailed container info
-		inspectCmd := exec.CommandContext(ctx, "docker", "inspect", container.ID, "--format",
-			`{"created":"{{.Created}}","started":"{{.State.StartedAt}}","image_id":"{{.Image}}"}`)
-		inspectOutput, err := inspectCmd.Output()
-		if err == nil {
-			var inspect struct {
-				Created  string `json:"created"`
-				Started  string `json:"started"`
-				ImageID  string `json:"image_id"`
-			}
+		if inspectOutput, err := cb.inspectContainer(ctx, container.ID); err == nil {
+			var inspect dockerInspectOutput
 			if err := json.Unmarshal(inspectOutput, &inspect); err == nil {
 				if t, err := time.Parse(time.RFC3339Nano, inspect.Created); err == nil {
 					state.Created = t
 				}
-				if t, err := time.Parse(time.RFC3339Nano, inspect.Started); err == nil {
+				if t, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt); err == nil {
 					state.Started = t
 				}
-				state.ImageID = inspect.ImageID
+				state.ImageID = inspect.Image
 			}
 		}
 
@@ -406,6 +437,16 @@ func (cb *ComposeBackup) GetContainerStates(ctx context.Context, composePath, _
 	return states, nil
 }
 
+// inspectContainer returns the inspect document of a container.
+func (cb *ComposeBackup) inspectContainer(ctx context.Context, containerID string) ([]byte, error) {
+	if cb.engine != nil {
+		if raw, err := cb.engine.ContainerInspectRaw(ctx, containerID); cb.useEngine(err) {
+			return raw, err
+		}
+	}
+	return exec.CommandContext(ctx, "docker", "inspect", containerID, "--format", "{{json .}}").Output()
+}
+
 // ExtractVolumes extracts volume information from a compose file and running containers.
 func (cb *ComposeBackup) ExtractVolumes(ctx context.Context, compose *ComposeFile, composePath string) ([]VolumeBackupInfo, []BindMountBackupInfo, error) {
 	var namedVolumes []VolumeBackupInfo
@@ -477,9 +518,7 @@ func (cb *ComposeBackup) parseVolumeSpec(ctx context.Context, spec, serviceName,
 	}
 
 	// Get volume info from Docker
-	cmd := exec.CommandContext(ctx, "docker", "volume", "inspect", volumeName, "--format",
-		`{"name":"{{.Name}}","mountpoint":"{{.Mountpoint}}"}`)
-	output, err := cmd.Output()
+	output, err := cb.inspectVolume(ctx, volumeName)
 	if err != nil {
 		// Volume might not exist yet
 		return &VolumeBackupInfo{
@@ -491,8 +530,8 @@ func (cb *ComposeBackup) parseVolumeSpec(ctx context.Context, spec, serviceName,
 	}
 
 	var volInfo struct {
-		Name       string `json:"name"`
-		Mountpoint string `json:"mountpoint"`
+		Name       string `json:"Name"`
+		Mountpoint string `json:"Mountpoint"`
 	}
 	if err := json.Unmarshal(output, &volInfo); err != nil {
 		return nil, nil, fmt.Errorf("parse volume info: %w", err)
@@ -510,6 +549,16 @@ func (cb *ComposeBackup) parseVolumeSpec(ctx context.Context, spec, serviceName,
 	}, nil, nil
 }
 
+// inspectVolume returns the inspect document of a volume.
+func (cb *ComposeBackup) inspectVolume(ctx context.Context, volumeName string) ([]byte, error) {
+	if cb.engine != nil {
+		if raw, err := cb.engine.VolumeInspectRaw(ctx, volumeName); cb.useEngine(err) {
+			return raw, err
+		}
+	}
+	return exec.CommandContext(ctx, "docker", "volume", "inspect", volumeName, "--format", "{{json .}}").Output()
+}
+
 // getPathStats returns the total size and file count for a path.
 func (cb *ComposeBackup) getPathStats(path string) (int64, int) {
 	var totalSize int64
@@ -728,6 +777,12 @@ func (cb *ComposeBackup) BackupStack(ctx context.Context, opts StackBackupOption
 func (cb *ComposeBackup) backupVolume(ctx context.Context, volumeName, backupPath string) error {
 	cb.logger.Debug().Str("volume", volumeName).Str("path", backupPath).Msg("backing up volume")
 
+	if cb.engine != nil {
+		if err := cb.backupVolumeEngine(ctx, volumeName, backupPath); cb.useEngine(err) {
+			return err
+		}
+	}
+
 	// Use a temporary container to read volume data
 	cmd := exec.CommandContext(ctx, "docker", "run", "--rm",
 		"-v", volumeName+":/source:ro",
@@ -743,6 +798,27 @@ func (cb *ComposeBackup) backupVolume(ctx context.Context, volumeName, backupPat
 	return nil
 }
 
+// backupVolumeEngine archives a volume through a stopped helper container
+// and compresses the archive into backupPath.
+func (cb *ComposeBackup) backupVolumeEngine(ctx context.Context, volumeName, backupPath string) error {
+	return cb.engine.withHelperContainer(ctx, []string{volumeName + ":/source:ro"}, func(id string) error {
+		f, err := os.Create(backupPath)
+		if err != nil {
+			return fmt.Errorf("create volume backup: %w", err)
+		}
+		defer f.Close()
+
+		gz := gzip.NewWriter(f)
+		if err := cb.engine.ContainerArchive(ctx, id, "/source/.", gz); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("write volume backup: %w", err)
+		}
+		return f.Close()
+	})
+}
+
 // backupPath backs up a host path to a tar.gz file.
 func (cb *ComposeBackup) backupPath(ctx context.Context, sourcePath, backupPath string) error {
 	cb.logger.Debug().Str("source", sourcePath).Str("path", backupPath).Msg("backing up path")
@@ -792,10 +868,8 @@ func (cb *ComposeBackup) collectImages(compose *ComposeFile, states []ContainerS
 func (cb *ComposeBackup) exportImage(ctx context.Context, imageName, backupPath string) (*ImageBackupInfo, error) {
 	cb.logger.Debug().Str("image", imageName).Str("path", backupPath).Msg("exporting image")
 
-	cmd := exec.CommandContext(ctx, "docker", "save", "-o", backupPath, imageName)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return nil, fmt.Errorf("export image: %w: %s", err, string(output))
+	if err := cb.saveImage(ctx, imageName, backupPath); err != nil {
+		return nil, err
 	}
 
 	// Get file size
@@ -804,19 +878,62 @@ func (cb *ComposeBackup) exportImage(ctx context.Context, imageName, backupPath
 		return nil, fmt.Errorf("stat image backup: %w", err)
 	}
 
-	// Get image ID
-	inspectCmd := exec.CommandContext(ctx, "docker", "image", "inspect", imageName, "--format", "{{.Id}}")
-	idOutput, _ := inspectCmd.Output()
-
 	return &ImageBackupInfo{
 		ImageName:  imageName,
-		ImageID:    strings.TrimSpace(string(idOutput)),
+		ImageID:    cb.imageID(ctx, imageName),
 		SizeBytes:  info.Size(),
 		BackupPath: backupPath,
 		BackedUpAt: time.Now(),
 	}, nil
 }
 
+// saveImage writes an image to a tar file.
+func (cb *ComposeBackup) saveImage(ctx context.Context, imageName, backupPath string) error {
+	if cb.engine != nil {
+		f, err := os.Create(backupPath)
+		if err != nil {
+			return fmt.Errorf("create image backup: %w", err)
+		}
+		err = cb.engine.ImageSave(ctx, imageName, f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if cb.useEngine(err) {
+			if err != nil {
+				os.Remove(backupPath)
+				return fmt.Errorf("export image: %w", err)
+			}
+			return nil
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "docker", "save", "-o", backupPath, imageName)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("export image: %w: %s", err, string(output))
+	}
+	return nil
+}
+
+// imageID returns the ID of an image, or an empty string if it cannot be inspected.
+func (cb *ComposeBackup) imageID(ctx context.Context, imageName string) string {
+	if cb.engine != nil {
+		raw, err := cb.engine.ImageInspectRaw(ctx, imageName)
+		if cb.useEngine(err) {
+			var inspect struct {
+				ID string `json:"Id"`
+			}
+			if err == nil {
+				_ = json.Unmarshal(raw, &inspect)
+			}
+			return inspect.ID
+		}
+	}
+
+	idOutput, _ := exec.CommandContext(ctx, "docker", "image", "inspect", imageName, "--format", "{{.Id}}").Output()
+	return strings.TrimSpace(string(idOutput))
+}
+
 // backupEnvFiles backs up .env files associated with the compose file.
 func (cb *ComposeBackup) backupEnvFiles(composePath, backupRoot string) ([]string, error) {
 	composeDir := filepath.Dir(composePath)
@@ -880,36 +997,48 @@ func (cb *ComposeBackup) startStack(ctx context.Context, composePath string) err
 	return cmd.Run()
 }
 
-// RestoreStack restores a Docker Compose stack from a backup.
-func (cb *ComposeBackup) RestoreStack(ctx context.Context, opts StackRestoreOptions) error {
+// RestoreStack restores a Docker Compose stack from a backup. It plans the
+// restore first and, unless opts.Force is set, refuses to create anything
+// when the plan reports conflicts. With opts.DryRun only the plan is
+// returned.
+func (cb *ComposeBackup) RestoreStack(ctx context.Context, opts StackRestoreOptions) (*StackRestorePlan, error) {
 	cb.logger.Info().
 		Str("manifest_path", opts.ManifestPath).
 		Str("target_dir", opts.TargetDir).
+		Str("project", opts.ProjectName).
 		Bool("restore_volumes", opts.RestoreVolumes).
 		Bool("restore_images", opts.RestoreImages).
+		Bool("dry_run", opts.DryRun).
 		Msg("starting stack restore")
 
-	// Load manifest
-	manifestData, err := os.ReadFile(opts.ManifestPath)
+	plan, err := cb.PlanRestore(ctx, opts)
 	if err != nil {
-		return fmt.Errorf("read manifest: %w", err)
+		return nil, err
 	}
-
-	var manifest StackBackupManifest
-	if err := json.Unmarshal(manifestData, &manifest); err != nil {
-		return fmt.Errorf("parse manifest: %w", err)
+	for _, c := range plan.Conflicts {
+		cb.logger.Warn().
+			Str("type", c.ConflictType).
+			Str("name", c.NetworkName).
+			Str("existing", c.ExistingValue).
+			Str("backup", c.BackupValue).
+			Msg("stack restore conflict")
+	}
+	if opts.DryRun {
+		return plan, nil
+	}
+	if plan.HasConflicts() && !opts.Force {
+		return plan, fmt.Errorf("%w: %d conflicts", ErrStackRestoreConflict, len(plan.Conflicts))
 	}
 
 	backupRoot := filepath.Dir(opts.ManifestPath)
 
-	// Restore compose file
-	srcCompose := filepath.Join(backupRoot, "docker-compose.yml")
+	// Restore the remapped compose file
 	dstCompose := filepath.Join(opts.TargetDir, "docker-compose.yml")
 	if err := os.MkdirAll(opts.TargetDir, 0755); err != nil {
-		return fmt.Errorf("create target directory: %w", err)
+		return plan, fmt.Errorf("create target directory: %w", err)
 	}
-	if err := cb.copyFile(srcCompose, dstCompose); err != nil {
-		return fmt.Errorf("restore compose file: %w", err)
+	if err := os.WriteFile(dstCompose, []byte(plan.ComposeFile), 0644); err != nil {
+		return plan, fmt.Errorf("restore compose file: %w", err)
 	}
 
 	// Restore env files
@@ -926,54 +1055,63 @@ func (cb *ComposeBackup) RestoreStack(ctx context.Context, opts StackRestoreOpti
 	}
 
 	// Restore images if requested
-	if opts.RestoreImages && manifest.IncludesImages {
-		for _, img := range manifest.Images {
-			if err := cb.loadImage(ctx, img.BackupPath); err != nil {
-				cb.logger.Warn().Err(err).Str("image", img.ImageName).Msg("failed to restore image")
-			}
+	for _, img := range plan.Images {
+		path := filepath.Join(backupRoot, "images", strings.ReplaceAll(img, "/", "_")+".tar")
+		if err := cb.loadImage(ctx, path); err != nil {
+			cb.logger.Warn().Err(err).Str("image", img).Msg("failed to restore image")
 		}
 	}
 
 	// Create volumes and restore data
 	if opts.RestoreVolumes {
-		for _, vol := range manifest.Volumes {
-			if err := cb.restoreVolume(ctx, vol.VolumeName, vol.BackupPath); err != nil {
-				cb.logger.Warn().Err(err).Str("volume", vol.VolumeName).Msg("failed to restore volume")
+		for _, vol := range plan.Volumes {
+			if err := cb.restoreVolume(ctx, vol.Target, vol.BackupPath); err != nil {
+				cb.logger.Warn().Err(err).Str("volume", vol.Target).Msg("failed to restore volume")
 			}
 		}
 
 		// Restore bind mounts
-		for _, mount := range manifest.BindMounts {
-			targetPath := mount.HostPath
-			if mapping, ok := opts.PathMappings[mount.HostPath]; ok {
-				targetPath = mapping
-			}
-			if err := cb.restorePath(ctx, mount.BackupPath, targetPath); err != nil {
-				cb.logger.Warn().Err(err).Str("path", targetPath).Msg("failed to restore bind mount")
+		for _, mount := range plan.BindMounts {
+			if err := cb.restorePath(ctx, mount.BackupPath, mount.Target); err != nil {
+				cb.logger.Warn().Err(err).Str("path", mount.Target).Msg("failed to restore bind mount")
 			}
 		}
 	}
 
 	// Start containers if requested
 	if opts.StartContainers {
-		cb.logger.Info().Msg("starting stack")
-		cmd := exec.CommandContext(ctx, "docker", "compose", "-f", dstCompose, "up", "-d")
+		cb.logger.Info().Str("project", plan.ProjectName).Msg("starting stack")
+		cmd := exec.CommandContext(ctx, "docker", "compose", "-p", plan.ProjectName, "-f", dstCompose, "up", "-d")
 		cmd.Dir = opts.TargetDir
 		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("start stack: %w: %s", err, string(output))
+			return plan, fmt.Errorf("start stack: %w: %s", err, string(output))
 		}
 	}
 
 	cb.logger.Info().
 		Str("target_dir", opts.TargetDir).
+		Str("project", plan.ProjectName).
 		Msg("stack restore completed")
 
-	return nil
+	return plan, nil
 }
 
 // loadImage loads a Docker image from a tar file.
 func (cb *ComposeBackup) loadImage(ctx context.Context, imagePath string) error {
 	cb.logger.Debug().Str("path", imagePath).Msg("loading image")
+
+	if cb.engine != nil {
+		f, err := os.Open(imagePath)
+		if err != nil {
+			return fmt.Errorf("open image: %w", err)
+		}
+		_, err = cb.engine.ImageLoad(ctx, f)
+		f.Close()
+		if cb.useEngine(err) {
+			return err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, "docker", "load", "-i", imagePath)
 	return cmd.Run()
 }
@@ -983,11 +1121,24 @@ func (cb *ComposeBackup) restoreVolume(ctx context.Context, volumeName, backupPa
 	cb.logger.Debug().Str("volume", volumeName).Str("path", backupPath).Msg("restoring volume")
 
 	// Create volume if it doesn't exist
-	createCmd := exec.CommandContext(ctx, "docker", "volume", "create", volumeName)
-	if err := createCmd.Run(); err != nil {
+	if err := cb.createVolume(ctx, volumeName); err != nil {
 		cb.logger.Debug().Err(err).Msg("volume might already exist")
 	}
 
+	if cb.engine != nil {
+		err := cb.engine.withHelperContainer(ctx, []string{volumeName + ":/target"}, func(id string) error {
+			f, err := os.Open(backupPath)
+			if err != nil {
+				return fmt.Errorf("open volume backup: %w", err)
+			}
+			defer f.Close()
+			return cb.engine.ContainerExtract(ctx, id, "/target", f)
+		})
+		if cb.useEngine(err) {
+			return err
+		}
+	}
+
 	// Restore data using a temporary container
 	cmd := exec.CommandContext(ctx, "docker", "run", "--rm",
 		"-v", volumeName+":/target",
@@ -1003,6 +1154,16 @@ func (cb *ComposeBackup) restoreVolume(ctx context.Context, volumeName, backupPa
 	return nil
 }
 
+// createVolume creates a named volume.
+func (cb *ComposeBackup) createVolume(ctx context.Context, volumeName string) error {
+	if cb.engine != nil {
+		if err := cb.engine.VolumeCreate(ctx, volumeName, nil); cb.useEngine(err) {
+			return err
+		}
+	}
+	return exec.CommandContext(ctx, "docker", "volume", "create", volumeName).Run()
+}
+
 // restorePath restores a host path from a tar.gz file.
 func (cb *ComposeBackup) restorePath(ctx context.Context, backupPath, targetPath string) error {
 	cb.logger.Debug().Str("backup", backupPath).Str("target", targetPath).Msg("restoring path")
@@ -0,0 +1,779 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrStackRestoreConflict is returned when a stack restore would collide
+// with ports, networks, volumes or paths already in use on the host.
+var ErrStackRestoreConflict = errors.New("stack restore conflicts with existing resources")
+
+// projectNamePattern matches the project names docker compose accepts.
+var projectNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// StackRestorePlan describes what RestoreStack creates on this host once the
+// remappings in StackRestoreOptions are applied. Conflicts reuse
+// NetworkConflict; for port, volume, path and container conflicts
+// NetworkName holds the service, volume or path concerned.
+type StackRestorePlan struct {
+	SourceProject string                 `json:"source_project"`
+	ProjectName   string                 `json:"project_name"`
+	TargetDir     string                 `json:"target_dir"`
+	Volumes       []VolumeRestorePlan    `json:"volumes,omitempty"`
+	BindMounts    []BindMountRestorePlan `json:"bind_mounts,omitempty"`
+	Networks      []NetworkRestorePlan   `json:"networks,omitempty"`
+	Ports         []PortRestorePlan      `json:"ports,omitempty"`
+	Images        []string               `json:"images,omitempty"`
+	Conflicts     []NetworkConflict      `json:"conflicts,omitempty"`
+	Warnings      []string               `json:"warnings,omitempty"`
+	ComposeFile   string                 `json:"compose_file"` // Remapped docker-compose.yml
+}
+
+// VolumeRestorePlan describes a named volume to create and fill.
+type VolumeRestorePlan struct {
+	Source     string `json:"source"`
+	Target     string `json:"target"`
+	BackupPath string `json:"backup_path"`
+}
+
+// BindMountRestorePlan describes a host directory to restore.
+type BindMountRestorePlan struct {
+	ServiceName string `json:"service_name"`
+	Source      string `json:"source"`
+	Target      string `json:"target"`
+	BackupPath  string `json:"backup_path"`
+}
+
+// NetworkRestorePlan describes a network the stack uses on this host.
+type NetworkRestorePlan struct {
+	Source   string   `json:"source"`
+	Target   string   `json:"target"`
+	Subnets  []string `json:"subnets,omitempty"`
+	External bool     `json:"external"`
+}
+
+// PortRestorePlan describes a published port. Ports are host ports or
+// ranges such as "8000-8010".
+type PortRestorePlan struct {
+	ServiceName   string `json:"service_name"`
+	HostIP        string `json:"host_ip,omitempty"`
+	Source        string `json:"source"`
+	Target        string `json:"target"`
+	ContainerPort string `json:"container_port"`
+	Protocol      string `json:"protocol"`
+}
+
+// HasConflicts reports whether the plan found anything that blocks a restore.
+func (p *StackRestorePlan) HasConflicts() bool {
+	return len(p.Conflicts) > 0
+}
+
+// PlanRestore works out how a stack backup maps onto this host without
+// changing anything: the remapped compose file, the volumes, bind mounts,
+// networks and ports it will use, and any of those that are already taken.
+func (cb *ComposeBackup) PlanRestore(ctx context.Context, opts StackRestoreOptions) (*StackRestorePlan, error) {
+	if opts.TargetDir == "" {
+		return nil, errors.New("target directory is required")
+	}
+
+	manifest, err := loadStackManifest(opts.ManifestPath)
+	if err != nil {
+		return nil, err
+	}
+	backupRoot := filepath.Dir(opts.ManifestPath)
+
+	data, err := os.ReadFile(filepath.Join(backupRoot, "docker-compose.yml"))
+	if err != nil {
+		return nil, fmt.Errorf("read backed up compose file: %w", err)
+	}
+
+	project := opts.ProjectName
+	if project == "" {
+		project = manifest.StackName
+	}
+	if !projectNamePattern.MatchString(project) {
+		return nil, fmt.Errorf("invalid project name %q: use lowercase letters, digits, '-' and '_'", project)
+	}
+
+	// Compose derived resource names from the directory the stack ran in.
+	sourcePrefix := manifest.StackName
+	if manifest.ComposeFilePath != "" {
+		sourcePrefix = filepath.Base(filepath.Dir(manifest.ComposeFilePath))
+	}
+
+	r := &stackRemapper{
+		opts:         opts,
+		sourcePrefix: sourcePrefix,
+		sourceDir:    filepath.Dir(manifest.ComposeFilePath),
+		project:      project,
+		volumes:      make(map[string]string),
+		networks:     make(map[string]*NetworkRestorePlan),
+		plan: &StackRestorePlan{
+			SourceProject: manifest.StackName,
+			ProjectName:   project,
+			TargetDir:     opts.TargetDir,
+		},
+	}
+	compose, err := r.rewrite(data)
+	if err != nil {
+		return nil, err
+	}
+	plan := r.plan
+	plan.ComposeFile = compose
+
+	seenVolumes := make(map[string]bool)
+	for _, vol := range manifest.Volumes {
+		if seenVolumes[vol.VolumeName] {
+			continue
+		}
+		seenVolumes[vol.VolumeName] = true
+		target, ok := r.volumes[vol.VolumeName]
+		if !ok {
+			target = mappedName(opts.VolumeMappings, vol.VolumeName, "")
+		}
+		plan.Volumes = append(plan.Volumes, VolumeRestorePlan{
+			Source:     vol.VolumeName,
+			Target:     target,
+			BackupPath: resolveBackupPath(backupRoot, "volumes", vol.BackupPath),
+		})
+	}
+	for _, mount := range manifest.BindMounts {
+		plan.BindMounts = append(plan.BindMounts, BindMountRestorePlan{
+			ServiceName: mount.ServiceName,
+			Source:      mount.HostPath,
+			Target:      r.mapBindPath(mount.HostPath),
+			BackupPath:  resolveBackupPath(backupRoot, "bind_mounts", mount.BackupPath),
+		})
+	}
+	if opts.RestoreImages && manifest.IncludesImages {
+		for _, img := range manifest.Images {
+			plan.Images = append(plan.Images, img.ImageName)
+		}
+	}
+
+	if err := cb.detectRestoreConflicts(ctx, plan, r.containerNames); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// loadStackManifest reads a stack backup manifest.
+func loadStackManifest(path string) (*StackBackupManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	var manifest StackBackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// resolveBackupPath returns where a backed up file lives now. Manifests
+// record absolute paths on the source host; when the backup was copied or
+// restored elsewhere, the file is found relative to the manifest instead.
+func resolveBackupPath(backupRoot, subdir, recorded string) string {
+	if recorded == "" {
+		return ""
+	}
+	if _, err := os.Stat(recorded); err == nil {
+		return recorded
+	}
+	return filepath.Join(backupRoot, subdir, filepath.Base(recorded))
+}
+
+// mappedName looks a resource up by its full name, then by its compose key.
+func mappedName(mappings map[string]string, name, key string) string {
+	if target, ok := mappings[name]; ok && target != "" {
+		return target
+	}
+	if target, ok := mappings[key]; ok && key != "" && target != "" {
+		return target
+	}
+	return name
+}
+
+// stackRemapper rewrites a backed up compose file for the restore target.
+type stackRemapper struct {
+	opts         StackRestoreOptions
+	sourcePrefix string
+	sourceDir    string
+	project      string
+
+	plan           *StackRestorePlan
+	volumes        map[string]string              // original volume name -> target
+	networks       map[string]*NetworkRestorePlan // compose key -> plan
+	remapped       map[string]bool                // compose keys of networks with remapped subnets
+	containerNames []string
+}
+
+// rewrite applies the project name and all remappings to a compose file,
+// keeping everything it does not need to touch as written.
+func (r *stackRemapper) rewrite(data []byte) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidComposeFile, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return "", fmt.Errorf("%w: not a mapping", ErrInvalidComposeFile)
+	}
+	root := doc.Content[0]
+
+	setMapValue(root, "name", r.project)
+	r.remapped = make(map[string]bool)
+
+	if volumes := mapValue(root, "volumes"); volumes != nil && volumes.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(volumes.Content); i += 2 {
+			r.rewriteVolume(volumes.Content[i].Value, volumes.Content[i+1])
+		}
+	}
+	if networks := mapValue(root, "networks"); networks != nil && networks.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(networks.Content); i += 2 {
+			r.rewriteNetwork(networks.Content[i].Value, networks.Content[i+1])
+		}
+	}
+	if services := mapValue(root, "services"); services != nil && services.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(services.Content); i += 2 {
+			if err := r.rewriteService(services.Content[i].Value, services.Content[i+1]); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(r.networks) {
+		r.plan.Networks = append(r.plan.Networks, *r.networks[key])
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return "", fmt.Errorf("encode compose file: %w", err)
+	}
+	enc.Close()
+	return buf.String(), nil
+}
+
+// rewriteVolume names a top-level volume explicitly when it is remapped.
+func (r *stackRemapper) rewriteVolume(key string, def *yaml.Node) {
+	explicit, external := resourceName(def)
+	original := explicit
+	if original == "" {
+		original = r.sourcePrefix + "_" + key
+		if external {
+			original = key
+		}
+	}
+
+	target := mappedName(r.opts.VolumeMappings, original, key)
+	if target == original && explicit == "" && !external {
+		// Unnamed volumes follow the new project name.
+		target = r.project + "_" + key
+	} else if target != original {
+		setMapValue(ensureMapping(def), "name", target)
+	}
+	r.volumes[original] = target
+}
+
+// rewriteNetwork applies name and subnet remappings to a top-level network.
+func (r *stackRemapper) rewriteNetwork(key string, def *yaml.Node) {
+	explicit, external := resourceName(def)
+	original := explicit
+	if original == "" {
+		original = r.sourcePrefix + "_" + key
+		if external {
+			original = key
+		}
+	}
+
+	target := mappedName(r.opts.NetworkMappings, original, key)
+	if target == original && explicit == "" && !external {
+		target = r.project + "_" + key
+	} else if target != original {
+		setMapValue(ensureMapping(def), "name", target)
+	}
+
+	plan := &NetworkRestorePlan{Source: original, Target: target, External: external}
+	r.networks[key] = plan
+
+	ipam := mapValue(def, "ipam")
+	config := mapValue(ipam, "config")
+	if config == nil || config.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, pool := range config.Content {
+		subnet := mapValue(pool, "subnet")
+		if subnet == nil || subnet.Value == "" {
+			continue
+		}
+		if newSubnet, ok := r.opts.SubnetMappings[subnet.Value]; ok && newSubnet != "" && newSubnet != subnet.Value {
+			// The old gateway and range lie outside the new subnet, so
+			// let Docker pick them.
+			subnet.Value = newSubnet
+			deleteMapValue(pool, "gateway")
+			deleteMapValue(pool, "ip_range")
+			r.remapped[key] = true
+		}
+		plan.Subnets = append(plan.Subnets, subnet.Value)
+	}
+}
+
+// rewriteService remaps a service's bind mounts and published ports.
+func (r *stackRemapper) rewriteService(name string, svc *yaml.Node) error {
+	if n := mapValue(svc, "container_name"); n != nil && n.Value != "" {
+		r.containerNames = append(r.containerNames, n.Value)
+	}
+
+	if volumes := mapValue(svc, "volumes"); volumes != nil && volumes.Kind == yaml.SequenceNode {
+		for _, vol := range volumes.Content {
+			r.rewriteBindMount(vol)
+		}
+	}
+
+	if ports := mapValue(svc, "ports"); ports != nil && ports.Kind == yaml.SequenceNode {
+		for _, port := range ports.Content {
+			if err := r.rewritePort(name, port); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Static addresses are kept as written and may fall outside a remapped subnet.
+	if networks := mapValue(svc, "networks"); networks != nil && networks.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(networks.Content); i += 2 {
+			key := networks.Content[i].Value
+			if !r.remapped[key] {
+				continue
+			}
+			if addr := mapValue(networks.Content[i+1], "ipv4_address"); addr != nil && addr.Value != "" {
+				r.plan.Warnings = append(r.plan.Warnings, fmt.Sprintf(
+					"service %s uses static address %s on network %s, whose subnet was remapped", name, addr.Value, key))
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteBindMount points a bind mount at its restored location.
+func (r *stackRemapper) rewriteBindMount(vol *yaml.Node) {
+	switch vol.Kind {
+	case yaml.ScalarNode:
+		src, tail, ok := strings.Cut(vol.Value, ":")
+		if !ok || !isHostPath(src) {
+			return
+		}
+		if target, changed := r.remapBindSource(src); changed {
+			vol.Value = target + ":" + tail
+		}
+	case yaml.MappingNode:
+		if t := mapValue(vol, "type"); t == nil || t.Value != "bind" {
+			return
+		}
+		source := mapValue(vol, "source")
+		if source == nil || source.Value == "" {
+			return
+		}
+		if target, changed := r.remapBindSource(source.Value); changed {
+			source.Value = target
+		}
+	}
+}
+
+// remapBindSource returns the bind mount source to write and whether it
+// changed. Relative sources that move with the stack stay relative.
+func (r *stackRemapper) remapBindSource(src string) (string, bool) {
+	if strings.HasPrefix(src, "~") {
+		return src, false
+	}
+	target := r.mapBindPath(r.hostPath(src))
+	if !filepath.IsAbs(src) && target == filepath.Join(r.opts.TargetDir, src) {
+		return src, false
+	}
+	return target, target != src
+}
+
+// hostPath resolves a bind mount source as compose did on the source host.
+func (r *stackRemapper) hostPath(src string) string {
+	if filepath.IsAbs(src) {
+		return filepath.Clean(src)
+	}
+	return filepath.Join(r.sourceDir, src)
+}
+
+// mapBindPath returns where a source host path is restored: the longest
+// matching PathMappings prefix wins, and paths inside the stack directory
+// move with it to TargetDir.
+func (r *stackRemapper) mapBindPath(hostPath string) string {
+	best := ""
+	for from := range r.opts.PathMappings {
+		if pathWithin(hostPath, from) && len(from) > len(best) {
+			best = from
+		}
+	}
+	if best != "" {
+		rel, _ := filepath.Rel(filepath.Clean(best), hostPath)
+		return filepath.Join(r.opts.PathMappings[best], rel)
+	}
+	if r.sourceDir != "" && r.sourceDir != "." && pathWithin(hostPath, r.sourceDir) {
+		rel, _ := filepath.Rel(r.sourceDir, hostPath)
+		return filepath.Join(r.opts.TargetDir, rel)
+	}
+	return hostPath
+}
+
+// rewritePort applies PortMappings to a published port in short
+// ("[ip:]host:container[/proto]") or long syntax.
+func (r *stackRemapper) rewritePort(service string, port *yaml.Node) error {
+	p := PortRestorePlan{ServiceName: service, Protocol: "tcp"}
+	var published *yaml.Node
+
+	switch port.Kind {
+	case yaml.ScalarNode:
+		spec := port.Value
+		if before, proto, ok := strings.Cut(spec, "/"); ok {
+			spec, p.Protocol = before, proto
+		}
+		i := strings.LastIndex(spec, ":")
+		if i < 0 {
+			return nil // Container port only; Docker picks a free host port.
+		}
+		p.ContainerPort = spec[i+1:]
+		p.HostIP, p.Source = "", spec[:i]
+		if j := strings.LastIndex(p.Source, ":"); j >= 0 {
+			p.HostIP, p.Source = strings.Trim(p.Source[:j], "[]"), p.Source[j+1:]
+		}
+		if p.Source == "" {
+			return nil
+		}
+		p.Target = r.mapPort(p.Source, p.Protocol)
+		if p.Target != p.Source {
+			host := p.Target
+			if p.HostIP != "" {
+				ip := p.HostIP
+				if strings.Contains(ip, ":") {
+					ip = "[" + ip + "]"
+				}
+				host = ip + ":" + host
+			}
+			port.Value = host + ":" + p.ContainerPort
+			if p.Protocol != "tcp" || strings.Contains(port.Value, "/") {
+				port.Value += "/" + p.Protocol
+			}
+		}
+	case yaml.MappingNode:
+		published = mapValue(port, "published")
+		if published == nil || published.Value == "" {
+			return nil
+		}
+		if proto := mapValue(port, "protocol"); proto != nil && proto.Value != "" {
+			p.Protocol = proto.Value
+		}
+		if ip := mapValue(port, "host_ip"); ip != nil {
+			p.HostIP = ip.Value
+		}
+		if target := mapValue(port, "target"); target != nil {
+			p.ContainerPort = target.Value
+		}
+		p.Source = published.Value
+		p.Target = r.mapPort(p.Source, p.Protocol)
+		if p.Target != p.Source {
+			published.Value = p.Target
+			published.Tag = "!!str"
+			published.Style = yaml.DoubleQuotedStyle
+		}
+	default:
+		return nil
+	}
+
+	if _, _, err := parsePortRange(p.Target); err != nil {
+		return fmt.Errorf("service %s: %w", service, err)
+	}
+	r.plan.Ports = append(r.plan.Ports, p)
+	return nil
+}
+
+// mapPort looks a host port up as "port/protocol", then as "port".
+func (r *stackRemapper) mapPort(port, protocol string) string {
+	if target, ok := r.opts.PortMappings[port+"/"+protocol]; ok && target != "" {
+		return target
+	}
+	if target, ok := r.opts.PortMappings[port]; ok && target != "" {
+		return target
+	}
+	return port
+}
+
+// detectRestoreConflicts checks the plan against this host: published ports
+// already bound, networks whose names or subnets clash, and volumes, paths
+// and container names that already exist.
+func (cb *ComposeBackup) detectRestoreConflicts(ctx context.Context, plan *StackRestorePlan, containerNames []string) error {
+	// Ports published twice within the stack, then ports taken on the host.
+	published := make(map[string]string)
+	for _, p := range plan.Ports {
+		first, last, _ := parsePortRange(p.Target)
+		for port := first; port <= last; port++ {
+			key := fmt.Sprintf("%s:%d/%s", p.HostIP, port, p.Protocol)
+			if other, ok := published[key]; ok {
+				plan.Conflicts = append(plan.Conflicts, NetworkConflict{
+					NetworkName:   p.ServiceName,
+					ConflictType:  "port",
+					ExistingValue: "published by service " + other,
+					BackupValue:   fmt.Sprintf("%d/%s", port, p.Protocol),
+					Resolution:    "Map one of the ports to a free port",
+				})
+				continue
+			}
+			published[key] = p.ServiceName
+			if portInUse(p.HostIP, port, p.Protocol) {
+				plan.Conflicts = append(plan.Conflicts, NetworkConflict{
+					NetworkName:   p.ServiceName,
+					ConflictType:  "port",
+					ExistingValue: "in use on this host",
+					BackupValue:   fmt.Sprintf("%d/%s", port, p.Protocol),
+					Resolution:    "Map the port to a free port",
+				})
+			}
+		}
+	}
+
+	// Networks the stack creates must not clash by name or subnet; external
+	// networks must already exist.
+	networks := NewNetworksWithPath("docker", cb.logger)
+	networks.SetEngineClient(cb.engine)
+	var created NetworkBackup
+	for _, n := range plan.Networks {
+		if n.External {
+			if _, err := networks.inspectNetworkRaw(ctx, n.Target); err != nil {
+				plan.Conflicts = append(plan.Conflicts, NetworkConflict{
+					NetworkName:  n.Target,
+					ConflictType: "missing",
+					BackupValue:  n.Source,
+					Resolution:   "Create the external network or map it to an existing one",
+				})
+			}
+			continue
+		}
+		def := NetworkDefinition{Name: n.Target}
+		if len(n.Subnets) > 0 {
+			def.IPAM = &NetworkIPAM{}
+			for _, subnet := range n.Subnets {
+				def.IPAM.Config = append(def.IPAM.Config, NetworkIPAMSubnet{Subnet: subnet})
+			}
+		}
+		created.Networks = append(created.Networks, def)
+	}
+	if len(created.Networks) > 0 {
+		conflicts, err := networks.DetectConflicts(ctx, &created)
+		if err != nil {
+			return err
+		}
+		for i := range conflicts {
+			if conflicts[i].ConflictType == "subnet_overlap" {
+				conflicts[i].Resolution = "Map the subnet to a free range"
+			}
+		}
+		plan.Conflicts = append(plan.Conflicts, conflicts...)
+	}
+
+	for _, v := range plan.Volumes {
+		if _, err := cb.inspectVolume(ctx, v.Target); err == nil {
+			plan.Conflicts = append(plan.Conflicts, NetworkConflict{
+				NetworkName:   v.Target,
+				ConflictType:  "volume",
+				ExistingValue: "volume exists",
+				BackupValue:   v.Source,
+				Resolution:    "Map the volume to a new name; restoring would overwrite its data",
+			})
+		}
+	}
+
+	paths := []string{filepath.Join(plan.TargetDir, "docker-compose.yml")}
+	for _, m := range plan.BindMounts {
+		paths = append(paths, m.Target)
+	}
+	for _, path := range paths {
+		if pathOccupied(path) {
+			plan.Conflicts = append(plan.Conflicts, NetworkConflict{
+				NetworkName:   path,
+				ConflictType:  "path",
+				ExistingValue: "path exists and is not empty",
+				Resolution:    "Restore to another directory or map the path",
+			})
+		}
+	}
+
+	for _, name := range containerNames {
+		if _, err := cb.inspectContainer(ctx, name); err == nil {
+			plan.Conflicts = append(plan.Conflicts, NetworkConflict{
+				NetworkName:   name,
+				ConflictType:  "container",
+				ExistingValue: "container exists",
+				Resolution:    "Remove the container or change container_name",
+			})
+		}
+	}
+	return nil
+}
+
+// portInUse reports whether a host port cannot be bound because something
+// else holds it. Other bind errors, such as missing privileges for low
+// ports, are not conflicts.
+func portInUse(hostIP string, port int, protocol string) bool {
+	if hostIP == "0.0.0.0" || hostIP == "::" {
+		hostIP = ""
+	}
+	addr := net.JoinHostPort(hostIP, strconv.Itoa(port))
+	var err error
+	if protocol == "udp" {
+		var conn net.PacketConn
+		if conn, err = net.ListenPacket("udp", addr); err == nil {
+			conn.Close()
+		}
+	} else {
+		var l net.Listener
+		if l, err = net.Listen("tcp", addr); err == nil {
+			l.Close()
+		}
+	}
+	return errors.Is(err, syscall.EADDRINUSE)
+}
+
+// parsePortRange parses a host port or range such as "8000-8010".
+func parsePortRange(spec string) (int, int, error) {
+	from, to, isRange := strings.Cut(spec, "-")
+	first, err := strconv.Atoi(from)
+	if err != nil || first < 1 || first > 65535 {
+		return 0, 0, fmt.Errorf("invalid port %q", spec)
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	last, err := strconv.Atoi(to)
+	if err != nil || last < first || last > 65535 {
+		return 0, 0, fmt.Errorf("invalid port range %q", spec)
+	}
+	return first, last, nil
+}
+
+// pathOccupied reports whether a file exists or a directory is not empty.
+func pathOccupied(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if !info.IsDir() {
+		return true
+	}
+	entries, err := os.ReadDir(path)
+	return err == nil && len(entries) > 0
+}
+
+// pathWithin reports whether path is dir or lies below it.
+func pathWithin(path, dir string) bool {
+	dir = filepath.Clean(dir)
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// isHostPath reports whether a volume source is a host path rather than a
+// named volume.
+func isHostPath(src string) bool {
+	return strings.HasPrefix(src, "/") || strings.HasPrefix(src, ".") || strings.HasPrefix(src, "~")
+}
+
+// resourceName returns the explicit name of a top-level volume or network
+// definition and whether it is external.
+func resourceName(def *yaml.Node) (string, bool) {
+	var name string
+	if n := mapValue(def, "name"); n != nil {
+		name = n.Value
+	}
+	ext := mapValue(def, "external")
+	if ext == nil {
+		return name, false
+	}
+	if ext.Kind == yaml.MappingNode {
+		// Legacy form: external: {name: ...}
+		if n := mapValue(ext, "name"); n != nil && name == "" {
+			name = n.Value
+		}
+		return name, true
+	}
+	external, _ := strconv.ParseBool(ext.Value)
+	return name, external
+}
+
+// mapValue returns the value of key in a mapping node, or nil.
+func mapValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMapValue sets key to a string value in a mapping node, adding the key
+// first for new top-level names and last otherwise.
+func setMapValue(node *yaml.Node, key, value string) {
+	if v := mapValue(node, key); v != nil {
+		v.Kind, v.Tag, v.Value, v.Content = yaml.ScalarNode, "!!str", value, nil
+		return
+	}
+	pair := []*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+	}
+	if key == "name" {
+		node.Content = append(pair, node.Content...)
+		return
+	}
+	node.Content = append(node.Content, pair...)
+}
+
+// deleteMapValue removes key from a mapping node.
+func deleteMapValue(node *yaml.Node, key string) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// ensureMapping turns an empty definition ("data:") into a mapping node.
+func ensureMapping(node *yaml.Node) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		node.Kind, node.Tag, node.Value, node.Content = yaml.MappingNode, "!!map", "", nil
+	}
+	return node
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
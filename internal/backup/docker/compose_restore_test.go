@@ -0,0 +1,220 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+const testStackCompose = `services:
+  web:
+    image: nginx
+    container_name: shop-web
+    ports:
+      - "8080:80"
+      - "127.0.0.1:9090:9090/udp"
+      - "443"
+    volumes:
+      - ./uploads:/var/www/uploads
+      - /data/media:/media:ro
+    networks:
+      front:
+        ipv4_address: 172.28.0.10
+  db:
+    image: postgres
+    volumes:
+      - db:/var/lib/postgresql/data
+    ports:
+      - target: 5432
+        published: 5432
+volumes:
+  db:
+networks:
+  front:
+    ipam:
+      config:
+        - subnet: 172.28.0.0/16
+          gateway: 172.28.0.1
+`
+
+// stackBackupDir writes a stack backup taken from /srv/shop on another host,
+// with the manifest recording that host's backup paths.
+func stackBackupDir(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	manifest := StackBackupManifest{
+		Version:         "1.0",
+		StackName:       "shop",
+		ComposeFilePath: "/srv/shop/docker-compose.yml",
+		Volumes: []VolumeBackupInfo{
+			{VolumeName: "shop_db", ServiceName: "db", BackupPath: "/backups/shop_1/volumes/shop_db.tar.gz"},
+		},
+		BindMounts: []BindMountBackupInfo{
+			{HostPath: "/srv/shop/uploads", ServiceName: "web", BackupPath: "/backups/shop_1/bind_mounts/srv_shop_uploads.tar.gz"},
+			{HostPath: "/data/media", ServiceName: "web", BackupPath: "/backups/shop_1/bind_mounts/data_media.tar.gz"},
+		},
+	}
+	data, _ := json.Marshal(manifest)
+	if err := os.WriteFile(filepath.Join(root, "manifest.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "docker-compose.yml"), []byte(testStackCompose), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// targetHostEngine fakes a Docker host with a "lan" network on
+// 10.20.0.0/16, a "legacy_db" volume and a "shop-web" container.
+func targetHostEngine(t *testing.T) *EngineClient {
+	return fakeEngine(t, "1.41", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:]
+		switch path {
+		case "/networks":
+			writeJSON(w, []map[string]string{{"Name": "bridge"}, {"Name": "lan"}})
+		case "/networks/lan":
+			writeJSON(w, map[string]interface{}{
+				"Id": "n1", "Name": "lan",
+				"IPAM": map[string]interface{}{"Config": []map[string]string{{"Subnet": "10.20.0.0/16"}}},
+			})
+		case "/volumes/legacy_db":
+			writeJSON(w, map[string]string{"Name": "legacy_db"})
+		case "/containers/shop-web/json":
+			writeJSON(w, map[string]string{"Id": "c1"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]string{"message": "not found"})
+		}
+	}))
+}
+
+func TestComposeBackup_PlanRestore(t *testing.T) {
+	backupRoot := stackBackupDir(t)
+	target := t.TempDir()
+
+	// A port that is already taken on this host.
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	busy := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+
+	cb := NewComposeBackup(zerolog.Nop())
+	cb.SetEngineClient(targetHostEngine(t))
+	opts := StackRestoreOptions{
+		ManifestPath:   filepath.Join(backupRoot, "manifest.json"),
+		TargetDir:      filepath.Join(target, "shop"),
+		RestoreVolumes: true,
+		ProjectName:    "shop-dr",
+		PathMappings:   map[string]string{"/data": filepath.Join(target, "data")},
+		VolumeMappings: map[string]string{"db": "legacy_db"},
+		SubnetMappings: map[string]string{"172.28.0.0/16": "10.20.0.0/16"},
+		PortMappings:   map[string]string{"8080": "18080", "9090/udp": "19090", "5432": busy},
+		DryRun:         true,
+	}
+
+	plan, err := cb.RestoreStack(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("RestoreStack() dry run error = %v", err)
+	}
+	if _, err := os.Stat(opts.TargetDir); !os.IsNotExist(err) {
+		t.Error("dry run created the target directory")
+	}
+
+	for _, want := range []string{
+		"name: shop-dr\n",
+		`- "18080:80"`,
+		`- "127.0.0.1:19090:9090/udp"`,
+		`- "443"`,
+		"- ./uploads:/var/www/uploads\n",
+		"- " + filepath.Join(target, "data", "media") + ":/media:ro\n",
+		`published: "` + busy + `"`,
+		"name: legacy_db\n",
+		"subnet: 10.20.0.0/16\n",
+	} {
+		if !strings.Contains(plan.ComposeFile, want) {
+			t.Errorf("compose file missing %q:\n%s", want, plan.ComposeFile)
+		}
+	}
+	if strings.Contains(plan.ComposeFile, "gateway") {
+		t.Errorf("remapped subnet kept its gateway:\n%s", plan.ComposeFile)
+	}
+
+	if len(plan.Volumes) != 1 || plan.Volumes[0].Target != "legacy_db" ||
+		plan.Volumes[0].BackupPath != filepath.Join(backupRoot, "volumes", "shop_db.tar.gz") {
+		t.Errorf("volumes = %+v", plan.Volumes)
+	}
+	if len(plan.BindMounts) != 2 ||
+		plan.BindMounts[0].Target != filepath.Join(opts.TargetDir, "uploads") ||
+		plan.BindMounts[1].Target != filepath.Join(target, "data", "media") {
+		t.Errorf("bind mounts = %+v", plan.BindMounts)
+	}
+	if len(plan.Networks) != 1 || plan.Networks[0].Source != "shop_front" || plan.Networks[0].Target != "shop-dr_front" {
+		t.Errorf("networks = %+v", plan.Networks)
+	}
+	if len(plan.Ports) != 3 {
+		t.Errorf("ports = %+v, want 3 published ports", plan.Ports)
+	}
+	if len(plan.Warnings) != 1 || !strings.Contains(plan.Warnings[0], "172.28.0.10") {
+		t.Errorf("warnings = %v", plan.Warnings)
+	}
+
+	var types []string
+	for _, c := range plan.Conflicts {
+		types = append(types, c.ConflictType+":"+c.NetworkName)
+	}
+	sort.Strings(types)
+	want := []string{"container:shop-web", "port:db", "subnet_overlap:shop-dr_front", "volume:legacy_db"}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("conflicts = %v, want %v", types, want)
+	}
+
+	// Without the dry run, conflicts stop the restore before anything is created.
+	opts.DryRun = false
+	if _, err := cb.RestoreStack(context.Background(), opts); !errors.Is(err, ErrStackRestoreConflict) {
+		t.Fatalf("RestoreStack() error = %v, want ErrStackRestoreConflict", err)
+	}
+	if _, err := os.Stat(opts.TargetDir); !os.IsNotExist(err) {
+		t.Error("conflicting restore created the target directory")
+	}
+}
+
+func TestComposeBackup_PlanRestore_Defaults(t *testing.T) {
+	backupRoot := stackBackupDir(t)
+	cb := NewComposeBackup(zerolog.Nop())
+	cb.SetEngineClient(targetHostEngine(t))
+	opts := StackRestoreOptions{
+		ManifestPath: filepath.Join(backupRoot, "manifest.json"),
+		TargetDir:    filepath.Join(t.TempDir(), "shop"),
+	}
+
+	plan, err := cb.PlanRestore(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("PlanRestore() error = %v", err)
+	}
+	if plan.ProjectName != "shop" || plan.Volumes[0].Target != "shop_db" {
+		t.Errorf("plan = %+v, want original names", plan)
+	}
+	if plan.BindMounts[1].Target != "/data/media" || !strings.Contains(plan.ComposeFile, "- /data/media:/media:ro\n") {
+		t.Errorf("unmapped absolute bind mount moved: %+v", plan.BindMounts[1])
+	}
+	if !strings.Contains(plan.ComposeFile, "gateway: 172.28.0.1") {
+		t.Errorf("subnet rewritten without a mapping:\n%s", plan.ComposeFile)
+	}
+
+	opts.ProjectName = "Shop DR"
+	if _, err := cb.PlanRestore(context.Background(), opts); err == nil {
+		t.Error("expected error for invalid project name")
+	}
+}
@@ -0,0 +1,532 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/backup/streamio"
+	"github.com/rs/zerolog"
+)
+
+// DatabaseEngine identifies the database server running in a container.
+type DatabaseEngine string
+
+const (
+	// DatabaseEnginePostgres is PostgreSQL, dumped with pg_dump or pg_dumpall.
+	DatabaseEnginePostgres DatabaseEngine = "postgres"
+	// DatabaseEngineMySQL is MySQL or MariaDB, dumped with mysqldump or mariadb-dump.
+	DatabaseEngineMySQL DatabaseEngine = "mysql"
+	// DatabaseEngineMongoDB is MongoDB, dumped with mongodump as a gzipped archive.
+	DatabaseEngineMongoDB DatabaseEngine = "mongodb"
+	// DatabaseEngineRedis is Redis, dumped as an RDB file after a BGSAVE.
+	DatabaseEngineRedis DatabaseEngine = "redis"
+)
+
+// databaseImages maps image names, without registry, namespace and tag, to
+// the engine they run.
+var databaseImages = map[string]DatabaseEngine{
+	"postgres":                 DatabaseEnginePostgres,
+	"postgresql":               DatabaseEnginePostgres,
+	"postgis":                  DatabaseEnginePostgres,
+	"timescaledb":              DatabaseEnginePostgres,
+	"timescaledb-ha":           DatabaseEnginePostgres,
+	"mysql":                    DatabaseEngineMySQL,
+	"mysql-server":             DatabaseEngineMySQL,
+	"mariadb":                  DatabaseEngineMySQL,
+	"percona":                  DatabaseEngineMySQL,
+	"percona-server":           DatabaseEngineMySQL,
+	"mongo":                    DatabaseEngineMongoDB,
+	"mongodb":                  DatabaseEngineMongoDB,
+	"mongodb-community-server": DatabaseEngineMongoDB,
+	"redis":                    DatabaseEngineRedis,
+	"redis-stack-server":       DatabaseEngineRedis,
+}
+
+// databaseLabelEngines maps keldris.backup.database values to engines.
+var databaseLabelEngines = map[string]DatabaseEngine{
+	"postgres":   DatabaseEnginePostgres,
+	"postgresql": DatabaseEnginePostgres,
+	"mysql":      DatabaseEngineMySQL,
+	"mariadb":    DatabaseEngineMySQL,
+	"mongo":      DatabaseEngineMongoDB,
+	"mongodb":    DatabaseEngineMongoDB,
+	"redis":      DatabaseEngineRedis,
+}
+
+// envNamePattern matches environment variable names.
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseDatabaseLabel returns the engine named by a keldris.backup.database
+// label, and whether the label disables database dumps.
+func parseDatabaseLabel(val string) (DatabaseEngine, bool) {
+	val = strings.ToLower(strings.TrimSpace(val))
+	switch val {
+	case "false", "no", "0", "off", "none", "disabled":
+		return "", true
+	}
+	return databaseLabelEngines[val], false
+}
+
+// validDatabaseLabel reports whether val names a database engine.
+func validDatabaseLabel(val string) bool {
+	_, ok := databaseLabelEngines[strings.ToLower(strings.TrimSpace(val))]
+	return ok
+}
+
+// imageName returns the name of an image reference without its registry,
+// namespace, tag and digest.
+func imageName(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, "/"); i >= 0 {
+		ref = ref[i+1:]
+	}
+	ref, _, _ = strings.Cut(ref, ":")
+	return strings.ToLower(ref)
+}
+
+// DatabaseContainer is a running container whose database is dumped from
+// inside the container.
+type DatabaseContainer struct {
+	ContainerID   string         `json:"container_id"`
+	ContainerName string         `json:"container_name"`
+	Image         string         `json:"image"`
+	Engine        DatabaseEngine `json:"engine"`
+	// Database limits the dump to one database. Empty dumps all of them.
+	Database string `json:"database,omitempty"`
+	// User overrides the user the dump connects as.
+	User string `json:"user,omitempty"`
+	// PasswordEnv names the container environment variable holding the
+	// password, so the password itself never leaves the container.
+	PasswordEnv string `json:"password_env,omitempty"`
+}
+
+// Filename returns the name of the dump file in the snapshot.
+func (d *DatabaseContainer) Filename() string {
+	return d.ContainerName + databaseCommands[d.Engine].extension
+}
+
+// env returns the variables that pass the labels to the dump scripts.
+func (d *DatabaseContainer) env() []string {
+	var env []string
+	if d.Database != "" {
+		env = append(env, "KELDRIS_DB_NAME="+d.Database)
+	}
+	if d.User != "" {
+		env = append(env, "KELDRIS_DB_USER="+d.User)
+	}
+	if d.PasswordEnv != "" {
+		env = append(env, "KELDRIS_DB_PASSWORD_ENV="+d.PasswordEnv)
+	}
+	return env
+}
+
+// DetectDatabase returns the database run by a container, from its
+// keldris.backup.database label or else its image name. It returns nil for
+// containers that run no known database or opt out with the label.
+func DetectDatabase(container ContainerInfo) *DatabaseContainer {
+	engine, disabled := parseDatabaseLabel(container.Labels[LabelDatabase])
+	if disabled {
+		return nil
+	}
+	if engine == "" {
+		engine = databaseImages[imageName(container.Image)]
+	}
+	if engine == "" {
+		return nil
+	}
+
+	db := &DatabaseContainer{
+		ContainerID:   container.ID,
+		ContainerName: container.Name,
+		Image:         container.Image,
+		Engine:        engine,
+		Database:      strings.TrimSpace(container.Labels[LabelDatabaseName]),
+		User:          strings.TrimSpace(container.Labels[LabelDatabaseUser]),
+	}
+	if env := strings.TrimSpace(container.Labels[LabelDatabasePasswordEnv]); envNamePattern.MatchString(env) {
+		db.PasswordEnv = env
+	}
+	return db
+}
+
+// DetectDatabases returns the databases of the running containers.
+func DetectDatabases(containers []ContainerInfo) []*DatabaseContainer {
+	var databases []*DatabaseContainer
+	for _, c := range containers {
+		if c.Status != "running" {
+			continue
+		}
+		if db := DetectDatabase(c); db != nil {
+			databases = append(databases, db)
+		}
+	}
+	return databases
+}
+
+// passwordPrelude starts every script: it stops on errors and reads the
+// password from the variable named by the password-env label.
+const passwordPrelude = `set -e
+if [ -n "$KELDRIS_DB_PASSWORD_ENV" ]; then eval "KELDRIS_DB_PASSWORD=\${$KELDRIS_DB_PASSWORD_ENV:-}"; fi
+`
+
+// redisPrelude defines a redis-cli wrapper that authenticates when a
+// password is set.
+const redisPrelude = passwordPrelude + `KELDRIS_DB_PASSWORD="${KELDRIS_DB_PASSWORD:-${REDIS_PASSWORD:-}}"
+cli() { redis-cli ${KELDRIS_DB_PASSWORD:+--no-auth-warning -a "$KELDRIS_DB_PASSWORD"} "$@"; }
+cli ping | grep -q PONG || { echo "cannot connect to redis" >&2; exit 1; }
+dir=$(cli config get dir | tail -n 1)
+file=$(cli config get dbfilename | tail -n 1)
+`
+
+const (
+	postgresPrelude = passwordPrelude + `export PGPASSWORD="${KELDRIS_DB_PASSWORD:-${POSTGRES_PASSWORD:-}}"
+user="${KELDRIS_DB_USER:-${POSTGRES_USER:-postgres}}"
+`
+	mysqlPrelude = passwordPrelude + `export MYSQL_PWD="${KELDRIS_DB_PASSWORD:-${MYSQL_ROOT_PASSWORD:-${MARIADB_ROOT_PASSWORD:-}}}"
+user="${KELDRIS_DB_USER:-root}"
+`
+	mongoPrelude = passwordPrelude + `user="${KELDRIS_DB_USER:-${MONGO_INITDB_ROOT_USERNAME:-}}"
+if [ -n "$user" ]; then
+	set -- "$@" --username "$user" --password "${KELDRIS_DB_PASSWORD:-${MONGO_INITDB_ROOT_PASSWORD:-}}" --authenticationDatabase admin
+fi
+`
+)
+
+// databaseScripts are the shell scripts run inside a container. dump writes
+// the dump to stdout and restore reads it from stdin. When activate is set,
+// restore only stages the data: activate then puts it in place and the
+// container is restarted to load it, while discard removes staged data
+// after a failed restore.
+type databaseScripts struct {
+	extension string
+	dump      string
+	restore   string
+	activate  string
+	discard   string
+}
+
+var databaseCommands = map[DatabaseEngine]databaseScripts{
+	DatabaseEnginePostgres: {
+		extension: ".sql",
+		dump: postgresPrelude + `if [ -n "$KELDRIS_DB_NAME" ]; then
+	exec pg_dump -U "$user" --clean --if-exists --create -d "$KELDRIS_DB_NAME"
+fi
+exec pg_dumpall -U "$user" --clean --if-exists`,
+		restore: postgresPrelude + `exec psql -U "$user" -d postgres -q`,
+	},
+	DatabaseEngineMySQL: {
+		extension: ".sql",
+		dump: mysqlPrelude + `dump=$(command -v mariadb-dump || command -v mysqldump) || { echo "mysqldump not found" >&2; exit 127; }
+if [ -n "$KELDRIS_DB_NAME" ]; then set -- --databases "$KELDRIS_DB_NAME"; else set -- --all-databases; fi
+exec "$dump" -u "$user" --single-transaction --routines --events --triggers "$@"`,
+		restore: mysqlPrelude + `client=$(command -v mariadb || command -v mysql) || { echo "mysql client not found" >&2; exit 127; }
+exec "$client" -u "$user"`,
+	},
+	DatabaseEngineMongoDB: {
+		extension: ".archive.gz",
+		dump: `set -- --archive --gzip --quiet
+` + mongoPrelude + `if [ -n "$KELDRIS_DB_NAME" ]; then set -- "$@" --db "$KELDRIS_DB_NAME"; fi
+exec mongodump "$@"`,
+		restore: `set -- --archive --gzip --quiet --drop
+` + mongoPrelude + `if [ -n "$KELDRIS_DB_NAME" ]; then set -- "$@" --nsInclude "$KELDRIS_DB_NAME.*"; fi
+exec mongorestore "$@"`,
+	},
+	DatabaseEngineRedis: {
+		extension: ".rdb",
+		dump: redisPrelude + `persistence() { cli info persistence | tr -d '\r'; }
+cli bgsave >/dev/null || true
+while persistence | grep -q '^rdb_bgsave_in_progress:1'; do sleep 1; done
+persistence | grep -q '^rdb_last_bgsave_status:ok' || { echo "redis BGSAVE failed" >&2; exit 1; }
+exec cat "$dir/$file"`,
+		restore: redisPrelude + `if [ "$(cli config get appendonly | tail -n 1)" = "yes" ]; then
+	echo "appendonly is enabled, redis would load the AOF instead of the restored RDB" >&2
+	exit 1
+fi
+cat > "$dir/$file.keldris-restore"`,
+		// Without save points redis does not overwrite the restored file
+		// when the container stops.
+		activate: redisPrelude + `cli config set save "" >/dev/null
+mv "$dir/$file.keldris-restore" "$dir/$file"`,
+		discard: redisPrelude + `rm -f "$dir/$file.keldris-restore"`,
+	},
+}
+
+// DatabaseDumpResult describes the snapshot of one container's database.
+type DatabaseDumpResult struct {
+	ContainerName string         `json:"container_name"`
+	Engine        DatabaseEngine `json:"engine"`
+	Filename      string         `json:"filename"`
+	SnapshotID    string         `json:"snapshot_id"`
+	SizeBytes     int64          `json:"size_bytes"`
+	Duration      time.Duration  `json:"duration"`
+}
+
+// DatabaseDumper dumps databases from inside their containers straight into
+// restic and streams them back for restores, without temporary files.
+type DatabaseDumper struct {
+	restic       *backup.Restic
+	engine       *EngineClient
+	dockerBinary string
+	logger       zerolog.Logger
+}
+
+// NewDatabaseDumper creates a DatabaseDumper that uses the shared Engine API client.
+func NewDatabaseDumper(restic *backup.Restic, logger zerolog.Logger) *DatabaseDumper {
+	return &DatabaseDumper{
+		restic:       restic,
+		engine:       DefaultEngineClient(logger),
+		dockerBinary: "docker",
+		logger:       logger.With().Str("component", "docker_databases").Logger(),
+	}
+}
+
+// NewDatabaseDumperWithBinary creates a DatabaseDumper that only uses the given docker binary.
+func NewDatabaseDumperWithBinary(binary string, restic *backup.Restic, logger zerolog.Logger) *DatabaseDumper {
+	return &DatabaseDumper{
+		restic:       restic,
+		dockerBinary: binary,
+		logger:       logger.With().Str("component", "docker_databases").Logger(),
+	}
+}
+
+// SetEngineClient sets the Engine API client. With nil, only the CLI is used.
+func (d *DatabaseDumper) SetEngineClient(engine *EngineClient) {
+	d.engine = engine
+}
+
+// Detect returns the databases of the running containers on the host.
+func (d *DatabaseDumper) Detect(ctx context.Context) ([]*DatabaseContainer, error) {
+	if d.engine != nil {
+		containers, err := d.engine.ListContainers(ctx)
+		if err == nil {
+			return DetectDatabases(containers), nil
+		}
+		if !engineUnavailable(err) {
+			return nil, err
+		}
+		d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+
+	listed, err := NewDockerClientWithBinary(d.dockerBinary, d.logger).ListContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	containers := make([]ContainerInfo, 0, len(listed))
+	for _, c := range listed {
+		containers = append(containers, ContainerInfo{ID: c.ID, Name: c.Name, Image: c.Image, Labels: c.Labels, Status: c.State})
+	}
+	return DetectDatabases(containers), nil
+}
+
+// Dump streams a dump of the container's database into the repository as a
+// single file. The snapshot is tagged with the container and engine. A dump
+// that fails part way creates no snapshot.
+func (d *DatabaseDumper) Dump(ctx context.Context, cfg backends.ResticConfig, db *DatabaseContainer, tags []string, opts *backup.BackupOptions) (*DatabaseDumpResult, error) {
+	scripts, ok := databaseCommands[db.Engine]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database engine %q", db.Engine)
+	}
+
+	d.logger.Info().
+		Str("container", db.ContainerName).
+		Str("engine", string(db.Engine)).
+		Msg("dumping container database")
+
+	start := time.Now()
+	pr, pw := io.Pipe()
+	dumpErr := make(chan error, 1)
+	go func() {
+		err := d.exec(ctx, db, scripts.dump, nil, pw)
+		pw.CloseWithError(err)
+		dumpErr <- err
+	}()
+
+	input := &countingReader{r: pr}
+	tags = append(append([]string{}, tags...), "docker-database:"+db.ContainerName, "database:"+string(db.Engine))
+	stats, err := d.restic.BackupStdin(ctx, cfg, db.Filename(), input, tags, opts)
+	// Stops the dump if restic exited before reading all of it.
+	pr.Close()
+	<-dumpErr
+	if err != nil {
+		return nil, fmt.Errorf("dump %s database in %s: %w", db.Engine, db.ContainerName, err)
+	}
+
+	result := &DatabaseDumpResult{
+		ContainerName: db.ContainerName,
+		Engine:        db.Engine,
+		Filename:      db.Filename(),
+		SnapshotID:    stats.SnapshotID,
+		SizeBytes:     input.n,
+		Duration:      time.Since(start),
+	}
+	d.logger.Info().
+		Str("container", db.ContainerName).
+		Str("snapshot_id", result.SnapshotID).
+		Int64("size_bytes", result.SizeBytes).
+		Dur("duration", result.Duration).
+		Msg("container database dumped")
+	return result, nil
+}
+
+// Restore streams a dump file from a snapshot into the container's database.
+// An empty filename uses the container's own dump file. Redis data is staged
+// next to the live file and the container is restarted to load it.
+func (d *DatabaseDumper) Restore(ctx context.Context, cfg backends.ResticConfig, snapshotID, filename string, db *DatabaseContainer) error {
+	scripts, ok := databaseCommands[db.Engine]
+	if !ok {
+		return fmt.Errorf("unsupported database engine %q", db.Engine)
+	}
+	if filename == "" {
+		filename = db.Filename()
+	}
+
+	d.logger.Info().
+		Str("container", db.ContainerName).
+		Str("engine", string(db.Engine)).
+		Str("snapshot_id", snapshotID).
+		Str("filename", filename).
+		Msg("restoring container database")
+
+	stream, err := d.restic.Dump(ctx, cfg, snapshotID, "/"+filename, "")
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	input := &countingReader{r: stream}
+	err = d.exec(ctx, db, scripts.restore, input, io.Discard)
+	if input.err != nil {
+		err = fmt.Errorf("read %s from snapshot %s: %w", filename, snapshotID, input.err)
+	}
+	if err != nil {
+		if scripts.discard != "" {
+			d.exec(context.WithoutCancel(ctx), db, scripts.discard, nil, io.Discard)
+		}
+		return fmt.Errorf("restore %s database in %s: %w", db.Engine, db.ContainerName, err)
+	}
+
+	if scripts.activate != "" {
+		if err := d.exec(ctx, db, scripts.activate, nil, io.Discard); err != nil {
+			return fmt.Errorf("activate restored %s data in %s: %w", db.Engine, db.ContainerName, err)
+		}
+		if err := d.restart(ctx, db.ContainerID); err != nil {
+			return fmt.Errorf("restart %s: %w", db.ContainerName, err)
+		}
+	}
+
+	d.logger.Info().
+		Str("container", db.ContainerName).
+		Int64("size_bytes", input.n).
+		Msg("container database restored")
+	return nil
+}
+
+// exec runs a script in the container through the Engine API when
+// available and with docker exec otherwise. A non-zero exit code is
+// returned as an error that includes the end of stderr.
+func (d *DatabaseDumper) exec(ctx context.Context, db *DatabaseContainer, script string, stdin io.Reader, stdout io.Writer) error {
+	cmd := []string{"sh", "-c", script}
+	stderr := streamio.NewTailBuffer(4096)
+
+	exitCode := 0
+	var err error
+	useCLI := d.engine == nil
+	if d.engine != nil {
+		opts := ExecOptions{Env: db.env()}
+		in := &countingReader{r: stdin}
+		if stdin != nil {
+			opts.Stdin = in
+		}
+		out := &countingWriter{w: stdout}
+		exitCode, err = d.engine.ContainerExecStream(ctx, db.ContainerID, cmd, opts, out, stderr)
+		// The CLI can only take over before any data has moved.
+		if err != nil && engineUnavailable(err) && in.n == 0 && out.n == 0 {
+			d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+			useCLI = true
+		}
+	}
+	if useCLI {
+		args := []string{"exec"}
+		if stdin != nil {
+			args = append(args, "-i")
+		}
+		for _, env := range db.env() {
+			args = append(args, "-e", env)
+		}
+		args = append(append(args, db.ContainerID), cmd...)
+
+		c := exec.CommandContext(ctx, d.dockerBinary, args...)
+		c.Stdin = stdin
+		c.Stdout = stdout
+		c.Stderr = stderr
+		err = c.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode, err = exitErr.ExitCode(), nil
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("command exited with code %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// restart stops and starts a container.
+func (d *DatabaseDumper) restart(ctx context.Context, containerID string) error {
+	if d.engine != nil {
+		err := d.engine.StopContainer(ctx, containerID, nil)
+		if err == nil {
+			return d.engine.StartContainer(ctx, containerID)
+		}
+		if !engineUnavailable(err) {
+			return err
+		}
+	}
+	for _, action := range []string{"stop", "start"} {
+		if out, err := exec.CommandContext(ctx, d.dockerBinary, action, containerID).CombinedOutput(); err != nil {
+			return fmt.Errorf("docker %s: %w: %s", action, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// countingReader counts the bytes read and remembers the first read error
+// other than EOF.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && err != io.EOF && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// countingWriter counts the bytes written.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
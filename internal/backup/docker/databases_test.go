@@ -0,0 +1,294 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/backup"
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/rs/zerolog"
+)
+
+func TestImageName(t *testing.T) {
+	tests := map[string]string{
+		"postgres":                              "postgres",
+		"postgres:16-alpine":                    "postgres",
+		"docker.io/library/mariadb:11":          "mariadb",
+		"bitnami/postgresql:16":                 "postgresql",
+		"localhost:5000/redis":                  "redis",
+		"ghcr.io/org/mongo@sha256:0123abcd":     "mongo",
+		"registry.example.com:443/team/app:1.0": "app",
+	}
+	for ref, want := range tests {
+		if got := imageName(ref); got != want {
+			t.Errorf("imageName(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestDetectDatabase(t *testing.T) {
+	tests := []struct {
+		name   string
+		image  string
+		labels map[string]string
+		want   DatabaseEngine
+	}{
+		{"postgres image", "postgres:16", nil, DatabaseEnginePostgres},
+		{"mariadb image", "mariadb:11", nil, DatabaseEngineMySQL},
+		{"mongo image", "mongo:7", nil, DatabaseEngineMongoDB},
+		{"redis image", "redis:7-alpine", nil, DatabaseEngineRedis},
+		{"unknown image", "nginx", nil, ""},
+		{"label names engine", "ghcr.io/org/custom-db", map[string]string{LabelDatabase: "MySQL"}, DatabaseEngineMySQL},
+		{"label disables", "postgres:16", map[string]string{LabelDatabase: "false"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := DetectDatabase(ContainerInfo{ID: "c1", Name: "db", Image: tt.image, Labels: tt.labels})
+			if tt.want == "" {
+				if db != nil {
+					t.Errorf("DetectDatabase() = %+v, want nil", db)
+				}
+				return
+			}
+			if db == nil || db.Engine != tt.want {
+				t.Errorf("DetectDatabase() = %+v, want engine %s", db, tt.want)
+			}
+		})
+	}
+
+	db := DetectDatabase(ContainerInfo{ID: "c1", Name: "shop-db", Image: "postgres", Labels: map[string]string{
+		LabelDatabaseName:        "shop",
+		LabelDatabaseUser:        "backup",
+		LabelDatabasePasswordEnv: "$(reboot)",
+	}})
+	if db.Database != "shop" || db.User != "backup" || db.PasswordEnv != "" {
+		t.Errorf("labels = %+v, want database and user without the invalid password env", db)
+	}
+	if db.Filename() != "shop-db.sql" {
+		t.Errorf("Filename() = %q", db.Filename())
+	}
+
+	running := DetectDatabases([]ContainerInfo{
+		{Name: "up", Image: "redis", Status: "running"},
+		{Name: "down", Image: "redis", Status: "exited"},
+		{Name: "web", Image: "nginx", Status: "running"},
+	})
+	if len(running) != 1 || running[0].ContainerName != "up" {
+		t.Errorf("DetectDatabases() = %+v", running)
+	}
+}
+
+func TestValidateLabels_Database(t *testing.T) {
+	p := NewLabelParser()
+	errs := p.ValidateLabels(map[string]string{LabelDatabase: "oracle", LabelDatabasePasswordEnv: "DB-PASS"})
+	if len(errs) != 2 {
+		t.Errorf("ValidateLabels() = %v, want 2 errors", errs)
+	}
+	if errs := p.ValidateLabels(map[string]string{LabelDatabase: "off", LabelDatabasePasswordEnv: "DB_PASS"}); len(errs) != 0 {
+		t.Errorf("ValidateLabels() = %v, want none", errs)
+	}
+}
+
+// databaseHost fakes a container host: docker exec runs the script locally
+// with the -e variables set, and the database tools are shell scripts that
+// record their input and arguments in dir.
+type databaseHost struct {
+	dir    string
+	dumper *DatabaseDumper
+	cfg    backends.ResticConfig
+}
+
+func newDatabaseHost(t *testing.T, tools map[string]string) *databaseHost {
+	t.Helper()
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	scripts := map[string]string{
+		"docker": `case "$1" in
+exec) shift ;;
+*) echo "$1 $2" >> "$DIR/docker.log"; exit 0 ;;
+esac
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-i) shift ;;
+	-e) export "$2"; shift 2 ;;
+	*) break ;;
+	esac
+done
+shift
+exec "$@"`,
+		// backup stores stdin and reports a snapshot once the input ended;
+		// dump prints $DUMP_DATA and fails when $DUMP_FAIL is set.
+		"restic": `echo "$@" > "$DIR/restic.args"
+case "$1" in
+backup)
+	cat > "$DIR/restic.stdin"
+	echo '{"message_type":"summary","snapshot_id":"db-snap","files_new":1}' ;;
+dump)
+	printf '%s' "$DUMP_DATA"
+	[ -z "$DUMP_FAIL" ] || { echo "dump failed" >&2; exit 1; } ;;
+esac`,
+	}
+	for name, body := range tools {
+		scripts[name] = body
+	}
+	for name, body := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("DIR", dir)
+	restic := backup.NewResticWithBinary(filepath.Join(bin, "restic"), zerolog.Nop())
+	return &databaseHost{
+		dir:    dir,
+		dumper: NewDatabaseDumperWithBinary(filepath.Join(bin, "docker"), restic, zerolog.Nop()),
+		cfg:    backends.ResticConfig{Repository: "/tmp/repo", Password: "secret"},
+	}
+}
+
+func (h *databaseHost) read(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(h.dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDatabaseDumper_Dump(t *testing.T) {
+	h := newDatabaseHost(t, map[string]string{
+		"pg_dumpall": `echo "pg_dumpall $* password=$PGPASSWORD"`,
+		"pg_dump":    `echo "partial"; echo "connection lost" >&2; exit 2`,
+	})
+	t.Setenv("POSTGRES_USER", "app")
+	t.Setenv("DB_PASS", "from-env")
+
+	db := &DatabaseContainer{ContainerID: "c1", ContainerName: "shop-db", Engine: DatabaseEnginePostgres, PasswordEnv: "DB_PASS"}
+	result, err := h.dumper.Dump(context.Background(), h.cfg, db, []string{"agent:a1"}, nil)
+	if err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+
+	want := "pg_dumpall -U app --clean --if-exists password=from-env\n"
+	if got := h.read(t, "restic.stdin"); got != want {
+		t.Errorf("restic input = %q, want %q", got, want)
+	}
+	if result.SnapshotID != "db-snap" || result.SizeBytes != int64(len(want)) || result.Filename != "shop-db.sql" {
+		t.Errorf("result = %+v", result)
+	}
+	args := h.read(t, "restic.args")
+	for _, arg := range []string{"--stdin-filename shop-db.sql", "--tag agent:a1", "--tag docker-database:shop-db", "--tag database:postgres"} {
+		if !strings.Contains(args, arg) {
+			t.Errorf("restic args = %q, want %q", args, arg)
+		}
+	}
+
+	t.Run("failed dump creates no snapshot", func(t *testing.T) {
+		os.Remove(filepath.Join(h.dir, "restic.stdin"))
+		db := &DatabaseContainer{ContainerID: "c1", ContainerName: "shop-db", Engine: DatabaseEnginePostgres, Database: "shop"}
+		result, err := h.dumper.Dump(context.Background(), h.cfg, db, nil, nil)
+		if err == nil || !strings.Contains(err.Error(), "code 2: connection lost") {
+			t.Fatalf("Dump() = %+v, %v, want exit code error", result, err)
+		}
+	})
+}
+
+func TestDatabaseDumper_Restore(t *testing.T) {
+	t.Run("postgres", func(t *testing.T) {
+		h := newDatabaseHost(t, map[string]string{
+			"psql": `echo "$*" > "$DIR/psql.args"; cat > "$DIR/psql.stdin"`,
+		})
+		t.Setenv("DUMP_DATA", "CREATE TABLE t ();")
+
+		db := &DatabaseContainer{ContainerID: "c1", ContainerName: "shop-db", Engine: DatabaseEnginePostgres}
+		if err := h.dumper.Restore(context.Background(), h.cfg, "db-snap", "", db); err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		if got := h.read(t, "psql.stdin"); got != "CREATE TABLE t ();" {
+			t.Errorf("psql input = %q", got)
+		}
+		if got := h.read(t, "psql.args"); got != "-U postgres -d postgres -q\n" {
+			t.Errorf("psql args = %q", got)
+		}
+		if got := h.read(t, "restic.args"); !strings.Contains(got, "dump --repo /tmp/repo db-snap /shop-db.sql") {
+			t.Errorf("restic args = %q", got)
+		}
+	})
+
+	redisCLI := `while [ "$1" = "--no-auth-warning" ] || [ "$1" = "-a" ]; do [ "$1" = "-a" ] && shift; shift; done
+case "$*" in
+ping) echo PONG ;;
+"config get dir") printf 'dir\n%s\n' "$DIR" ;;
+"config get dbfilename") printf 'dbfilename\ndump.rdb\n' ;;
+"config get appendonly") printf 'appendonly\nno\n' ;;
+"config set save "*) echo "$*" >> "$DIR/redis.log"; echo OK ;;
+esac`
+
+	t.Run("redis stages data and restarts", func(t *testing.T) {
+		h := newDatabaseHost(t, map[string]string{"redis-cli": redisCLI})
+		os.WriteFile(filepath.Join(h.dir, "dump.rdb"), []byte("old"), 0644)
+		t.Setenv("DUMP_DATA", "REDIS0011")
+
+		db := &DatabaseContainer{ContainerID: "c1", ContainerName: "cache", Engine: DatabaseEngineRedis}
+		if err := h.dumper.Restore(context.Background(), h.cfg, "db-snap", "", db); err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		if got := h.read(t, "dump.rdb"); got != "REDIS0011" {
+			t.Errorf("dump.rdb = %q", got)
+		}
+		if got := h.read(t, "redis.log"); got != "config set save \n" {
+			t.Errorf("redis commands = %q", got)
+		}
+		if got := h.read(t, "docker.log"); got != "stop c1\nstart c1\n" {
+			t.Errorf("docker commands = %q", got)
+		}
+	})
+
+	t.Run("redis discards a partial restore", func(t *testing.T) {
+		h := newDatabaseHost(t, map[string]string{"redis-cli": redisCLI})
+		os.WriteFile(filepath.Join(h.dir, "dump.rdb"), []byte("old"), 0644)
+		t.Setenv("DUMP_DATA", "REDIS")
+		t.Setenv("DUMP_FAIL", "1")
+
+		db := &DatabaseContainer{ContainerID: "c1", ContainerName: "cache", Engine: DatabaseEngineRedis}
+		err := h.dumper.Restore(context.Background(), h.cfg, "db-snap", "", db)
+		if err == nil || !strings.Contains(err.Error(), "read cache.rdb from snapshot db-snap") {
+			t.Fatalf("Restore() error = %v, want read error", err)
+		}
+		if got := h.read(t, "dump.rdb"); got != "old" {
+			t.Errorf("dump.rdb = %q, want it untouched", got)
+		}
+		if _, err := os.Stat(filepath.Join(h.dir, "dump.rdb.keldris-restore")); !os.IsNotExist(err) {
+			t.Errorf("staged file left behind: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(h.dir, "docker.log")); !os.IsNotExist(err) {
+			t.Error("container restarted after a failed restore")
+		}
+	})
+}
+
+func TestDatabaseDumper_DetectFallsBackToCLI(t *testing.T) {
+	h := newDatabaseHost(t, map[string]string{})
+	ps := `{"ID":"c1","Names":"db","Image":"mysql:8","State":"running","Labels":"keldris.backup.database.name=shop"}`
+	docker := filepath.Join(h.dir, "bin", "docker-ps")
+	os.WriteFile(docker, []byte(fmt.Sprintf("#!/bin/sh\necho '%s'\n", ps)), 0755)
+	h.dumper.dockerBinary = docker
+	h.dumper.SetEngineClient(deadEngine(t))
+
+	databases, err := h.dumper.Detect(context.Background())
+	if err != nil {
+		t.Fatalf("Detect() error = %v", err)
+	}
+	if len(databases) != 1 || databases[0].Engine != DatabaseEngineMySQL || databases[0].Database != "shop" {
+		t.Errorf("Detect() = %+v", databases)
+	}
+}
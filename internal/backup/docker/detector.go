@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
 // DetectDocker checks if Docker is available and returns the version string.
@@ -18,6 +19,13 @@ func DetectDocker() (bool, string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if engine := DefaultEngineClient(log.Logger); engine != nil {
+		version, _, err := engine.ServerVersion(ctx)
+		if !engineUnavailable(err) {
+			return err == nil && version != "", version
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, "docker", "version", "--format", "{{.Server.Version}}")
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
@@ -39,6 +47,12 @@ func IsDockerRunning() bool {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if engine := DefaultEngineClient(log.Logger); engine != nil {
+		if err := engine.Ping(ctx); !engineUnavailable(err) {
+			return err == nil
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, "docker", "info", "--format", "{{.ServerVersion}}")
 	return cmd.Run() == nil
 }
@@ -48,21 +62,13 @@ func GetDockerInfo() (*DockerInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "docker", "info", "--format", "{{json .}}")
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		errMsg := stderr.String()
-		if errMsg == "" {
-			errMsg = stdout.String()
-		}
-		return nil, fmt.Errorf("docker info: %w: %s", err, strings.TrimSpace(errMsg))
+	output, err := dockerInfoJSON(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	var raw dockerInfoOutput
-	if err := json.Unmarshal(stdout.Bytes(), &raw); err != nil {
+	if err := json.Unmarshal(output, &raw); err != nil {
 		return nil, fmt.Errorf("parse docker info: %w", err)
 	}
 
@@ -80,6 +86,31 @@ func GetDockerInfo() (*DockerInfo, error) {
 	}, nil
 }
 
+// dockerInfoJSON returns the daemon's system information from the Engine
+// API, or from `docker info` when the socket is unreachable.
+func dockerInfoJSON(ctx context.Context) ([]byte, error) {
+	if engine := DefaultEngineClient(log.Logger); engine != nil {
+		raw, err := engine.Info(ctx)
+		if !engineUnavailable(err) {
+			return raw, err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "docker", "info", "--format", "{{json .}}")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		errMsg := stderr.String()
+		if errMsg == "" {
+			errMsg = stdout.String()
+		}
+		return nil, fmt.Errorf("docker info: %w: %s", err, strings.TrimSpace(errMsg))
+	}
+	return stdout.Bytes(), nil
+}
+
 // DetectorInfo contains information about the Docker installation on an agent.
 type DetectorInfo struct {
 	Available       bool       `json:"available"`
@@ -104,18 +135,20 @@ type DetectorInfo struct {
 // Detector provides Docker detection functionality.
 type Detector struct {
 	binary string
+	engine *EngineClient
 	logger zerolog.Logger
 }
 
-// NewDetector creates a new Detector instance.
+// NewDetector creates a new Detector instance that uses the shared Engine API client.
 func NewDetector(logger zerolog.Logger) *Detector {
 	return &Detector{
 		binary: "docker",
+		engine: DefaultEngineClient(logger),
 		logger: logger.With().Str("component", "docker_detector").Logger(),
 	}
 }
 
-// NewDetectorWithBinary creates a new Detector with a custom docker binary path.
+// NewDetectorWithBinary creates a new Detector that only uses the given docker binary.
 func NewDetectorWithBinary(binary string, logger zerolog.Logger) *Detector {
 	return &Detector{
 		binary: binary,
@@ -123,6 +156,11 @@ func NewDetectorWithBinary(binary string, logger zerolog.Logger) *Detector {
 	}
 }
 
+// SetEngineClient sets the Engine API client. With nil, only the CLI is used.
+func (d *Detector) SetEngineClient(engine *EngineClient) {
+	d.engine = engine
+}
+
 // Detect checks if Docker is available and returns information about the installation.
 func (d *Detector) Detect(ctx context.Context) (*DetectorInfo, error) {
 	d.logger.Debug().Msg("detecting Docker")
@@ -131,6 +169,19 @@ func (d *Detector) Detect(ctx context.Context) (*DetectorInfo, error) {
 		DetectedAt: time.Now(),
 	}
 
+	if d.engine != nil {
+		err := d.detectEngine(ctx, info)
+		if !engineUnavailable(err) {
+			if err != nil {
+				info.Available = false
+				info.Error = err.Error()
+				d.logger.Debug().Err(err).Msg("docker not available")
+			}
+			return info, nil
+		}
+		d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+
 	// First check if docker binary exists
 	if !d.isBinaryAvailable() {
 		info.Available = false
@@ -198,14 +249,78 @@ func (d *Detector) Detect(ctx context.Context) (*DetectorInfo, error) {
 	return info, nil
 }
 
+// detectEngine fills info from the Engine API. Only a failure to reach the
+// daemon is returned; missing details are logged.
+func (d *Detector) detectEngine(ctx context.Context, info *DetectorInfo) error {
+	version, apiVersion, err := d.engine.ServerVersion(ctx)
+	if err != nil {
+		return err
+	}
+	info.Available = true
+	info.Version = version
+	info.APIVersion = apiVersion
+	info.ServerVersion = version
+
+	if raw, err := d.engine.Info(ctx); err != nil {
+		d.logger.Warn().Err(err).Msg("failed to get docker system info")
+	} else {
+		var sysInfo struct {
+			dockerSystemInfo
+			OSType       string `json:"OSType"`
+			Architecture string `json:"Architecture"`
+		}
+		if err := json.Unmarshal(raw, &sysInfo); err != nil {
+			d.logger.Warn().Err(err).Msg("failed to parse docker system info")
+		} else {
+			info.Platform = sysInfo.OSType + "/" + sysInfo.Architecture
+			info.StorageDriver = sysInfo.Driver
+			info.RootDir = sysInfo.DockerRootDir
+			info.ContainerCount = sysInfo.Containers
+			info.RunningCount = sysInfo.ContainersRunning
+			info.PausedCount = sysInfo.ContainersPaused
+			info.StoppedCount = sysInfo.ContainersStopped
+			info.ImageCount = sysInfo.Images
+		}
+	}
+
+	if volumes, err := d.engine.VolumeList(ctx); err != nil {
+		d.logger.Warn().Err(err).Msg("failed to list volumes")
+	} else {
+		info.VolumeCount = len(volumes)
+		info.Volumes = volumes
+	}
+
+	if containers, err := d.engine.ContainerList(ctx, true); err != nil {
+		d.logger.Warn().Err(err).Msg("failed to list containers")
+	} else {
+		info.Containers = containers
+	}
+
+	d.logger.Info().
+		Str("version", info.Version).
+		Int("containers", info.ContainerCount).
+		Int("volumes", info.VolumeCount).
+		Msg("docker detected")
+	return nil
+}
+
 // IsAvailable checks if Docker is available on the system.
 func (d *Detector) IsAvailable(ctx context.Context) bool {
 	info, _ := d.Detect(ctx)
 	return info != nil && info.Available
 }
 
-// GetVersion returns the Docker version information.
+// GetVersion returns the Docker version information. Through the Engine
+// API this is the daemon's version.
 func (d *Detector) GetVersion(ctx context.Context) (string, error) {
+	if d.engine != nil {
+		version, _, err := d.engine.ServerVersion(ctx)
+		if !engineUnavailable(err) {
+			return version, err
+		}
+		d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+
 	version, err := d.getVersion(ctx)
 	if err != nil {
 		return "", err
@@ -1,10 +1,14 @@
 package docker
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/rs/zerolog"
 )
 
 // withFakeDockerInPath creates a fake "docker" script in a temp directory and
@@ -255,3 +259,46 @@ func TestGetDockerInfo_NotInstalled(t *testing.T) {
 		t.Error("GetDockerInfo() expected error when docker not installed")
 	}
 }
+
+func TestDetector_Engine(t *testing.T) {
+	t.Run("uses engine API", func(t *testing.T) {
+		d := NewDetectorWithBinary(filepath.Join(t.TempDir(), "missing-docker"), zerolog.Nop())
+		d.SetEngineClient(fakeEngine(t, "1.41", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1.41/version":
+				writeJSON(w, map[string]string{"Version": "24.0.7", "ApiVersion": "1.43"})
+			case "/v1.41/info":
+				writeJSON(w, map[string]interface{}{"Driver": "overlay2", "OSType": "linux", "Architecture": "x86_64", "Containers": 3, "ContainersRunning": 2})
+			case "/v1.41/volumes":
+				writeJSON(w, map[string]interface{}{"Volumes": []map[string]string{{"Name": "pgdata"}}})
+			case "/v1.41/containers/json":
+				writeJSON(w, []map[string]interface{}{{"Id": "c1", "Names": []string{"/db"}, "State": "running"}})
+			default:
+				http.NotFound(w, r)
+			}
+		})))
+
+		info, err := d.Detect(context.Background())
+		if err != nil {
+			t.Fatalf("Detect() error = %v", err)
+		}
+		if !info.Available || info.Version != "24.0.7" || info.APIVersion != "1.43" || info.Platform != "linux/x86_64" ||
+			info.StorageDriver != "overlay2" || info.ContainerCount != 3 || info.RunningCount != 2 ||
+			info.VolumeCount != 1 || len(info.Containers) != 1 || info.Containers[0].Name != "db" {
+			t.Errorf("info = %+v", info)
+		}
+	})
+
+	t.Run("falls back to CLI when socket is unreachable", func(t *testing.T) {
+		d := NewDetectorWithBinary(filepath.Join(t.TempDir(), "missing-docker"), zerolog.Nop())
+		d.SetEngineClient(deadEngine(t))
+
+		info, err := d.Detect(context.Background())
+		if err != nil {
+			t.Fatalf("Detect() error = %v", err)
+		}
+		if info.Available || info.Error != "docker binary not found" {
+			t.Errorf("info = %+v, want the CLI result", info)
+		}
+	})
+}
@@ -195,15 +195,52 @@ func (s *DiscoveryService) DiscoverContainers(ctx context.Context, agentID uuid.
 
 	// Track which containers we've seen
 	seenContainerIDs := make(map[string]bool)
+	for _, container := range containers {
+		seenContainerIDs[container.ID] = true
+	}
+
+	// Containers are recreated with a new ID when their labels change, so
+	// configs whose container is gone can be claimed by a container with the
+	// same name.
+	orphansByName := make(map[string]*models.DockerContainerConfig)
+	for _, config := range existingConfigs {
+		if !seenContainerIDs[config.ContainerID] {
+			orphansByName[config.ContainerName] = config
+		}
+	}
 
 	// Process each discovered container
 	for _, container := range containers {
-		seenContainerIDs[container.ID] = true
+		existing, exists := existingByContainerID[container.ID]
+		if !exists {
+			if orphan, ok := orphansByName[container.Name]; ok {
+				delete(orphansByName, container.Name)
+				delete(existingByContainerID, orphan.ContainerID)
+				logger.Info().
+					Str("container_name", container.Name).
+					Str("old_container_id", orphan.ContainerID).
+					Str("container_id", container.ID).
+					Msg("container recreated")
+				orphan.ContainerID = container.ID
+				existingByContainerID[container.ID] = orphan
+				existing, exists = orphan, true
+			}
+		}
 
 		// Parse labels into config
 		config := s.parser.ParseConfig(agentID, container)
 		if config == nil {
-			// Container doesn't have backup labels, skip
+			// Backup labels were removed or disabled; stop label-driven backups
+			if exists && existing.Enabled && existing.Overrides == nil {
+				existing.Enabled = false
+				existing.Labels = s.parser.filterKeldrisLabels(container.Labels)
+				existing.UpdatedAt = time.Now()
+				if err := s.store.UpdateDockerContainer(ctx, existing); err != nil {
+					logger.Error().Err(err).
+						Str("container_id", container.ID).
+						Msg("failed to disable container config")
+				}
+			}
 			continue
 		}
 
@@ -213,7 +250,6 @@ func (s *DiscoveryService) DiscoverContainers(ctx context.Context, agentID uuid.
 		}
 
 		// Check if this container already exists
-		existing, exists := existingByContainerID[container.ID]
 		if exists {
 			// Update existing configuration (preserve overrides)
 			s.updateExistingConfig(existing, config)
@@ -13,6 +13,7 @@ import (
 
 	"github.com/MacJediWizard/keldris/internal/backup"
 	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/backup/fssnapshot"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 )
@@ -26,21 +27,24 @@ var ErrContainerNotFound = errors.New("container not found")
 // ErrVolumeNotFound is returned when a volume cannot be found.
 var ErrVolumeNotFound = errors.New("volume not found")
 
-// DockerCLI wraps the Docker CLI for container and volume operations.
+// DockerCLI provides container and volume operations through the Engine API,
+// falling back to the Docker CLI when the daemon socket is unreachable.
 type DockerCLI struct {
 	binary string
+	engine *EngineClient
 	logger zerolog.Logger
 }
 
-// NewDockerClient creates a new DockerCLI.
+// NewDockerClient creates a new DockerCLI that uses the shared Engine API client.
 func NewDockerClient(logger zerolog.Logger) *DockerCLI {
 	return &DockerCLI{
 		binary: "docker",
+		engine: DefaultEngineClient(logger),
 		logger: logger.With().Str("component", "docker").Logger(),
 	}
 }
 
-// NewDockerClientWithBinary creates a new DockerCLI with a custom binary path.
+// NewDockerClientWithBinary creates a new DockerCLI that only uses the given CLI binary.
 func NewDockerClientWithBinary(binary string, logger zerolog.Logger) *DockerCLI {
 	return &DockerCLI{
 		binary: binary,
@@ -92,6 +96,9 @@ type BackupContainerConfig struct {
 type BackupOptions struct {
 	// PauseContainers pauses running containers during volume backup for consistency.
 	PauseContainers bool `json:"pause_containers"`
+	// FilesystemSnapshot reads volumes from LVM, ZFS or btrfs snapshots.
+	// Containers are then only paused if a volume cannot be snapshotted.
+	FilesystemSnapshot bool `json:"filesystem_snapshot"`
 	// VolumeIDs specifies which volumes to backup. Empty means all volumes.
 	VolumeIDs []string `json:"volume_ids,omitempty"`
 	// ContainerIDs specifies which container configs to backup. Empty means all containers.
@@ -115,26 +122,31 @@ type BackupResult struct {
 
 // DockerBackup provides Docker backup functionality using restic.
 type DockerBackup struct {
-	binary string // docker binary path
-	restic *backup.Restic
-	logger zerolog.Logger
+	binary    string // docker binary path
+	engine    *EngineClient
+	restic    *backup.Restic
+	snapshots *fssnapshot.Manager
+	logger    zerolog.Logger
 }
 
-// NewDockerBackup creates a new DockerBackup instance.
+// NewDockerBackup creates a new DockerBackup instance that uses the shared Engine API client.
 func NewDockerBackup(restic *backup.Restic, logger zerolog.Logger) *DockerBackup {
 	return &DockerBackup{
-		binary: "docker",
-		restic: restic,
-		logger: logger.With().Str("component", "docker_backup").Logger(),
+		binary:    "docker",
+		engine:    DefaultEngineClient(logger),
+		restic:    restic,
+		snapshots: fssnapshot.NewManager(logger),
+		logger:    logger.With().Str("component", "docker_backup").Logger(),
 	}
 }
 
-// NewDockerBackupWithBinary creates a new DockerBackup with a custom docker binary path.
+// NewDockerBackupWithBinary creates a new DockerBackup that only uses the given docker binary.
 func NewDockerBackupWithBinary(binary string, restic *backup.Restic, logger zerolog.Logger) *DockerBackup {
 	return &DockerBackup{
-		binary: binary,
-		restic: restic,
-		logger: logger.With().Str("component", "docker_backup").Logger(),
+		binary:    binary,
+		restic:    restic,
+		snapshots: fssnapshot.NewManager(logger),
+		logger:    logger.With().Str("component", "docker_backup").Logger(),
 	}
 }
 
@@ -142,10 +154,23 @@ func NewDockerBackupWithBinary(binary string, restic *backup.Restic, logger zero
 // DockerCLI methods
 // ---------------------------------------------------------------------------
 
+// SetEngineClient sets the Engine API client. With nil, only the CLI is used.
+func (d *DockerCLI) SetEngineClient(engine *EngineClient) {
+	d.engine = engine
+}
+
 // ListContainers returns all containers (including stopped ones).
 func (d *DockerCLI) ListContainers(ctx context.Context) ([]Container, error) {
 	d.logger.Debug().Msg("listing containers")
 
+	if d.engine != nil {
+		containers, err := d.engine.ContainerList(ctx, true)
+		if !engineUnavailable(err) {
+			return containers, err
+		}
+		d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+
 	args := []string{"ps", "-a", "--no-trunc", "--format", "{{json .}}"}
 	output, err := d.run(ctx, args)
 	if err != nil {
@@ -186,6 +211,14 @@ func (d *DockerCLI) ListContainers(ctx context.Context) ([]Container, error) {
 func (d *DockerCLI) ListVolumes(ctx context.Context) ([]Volume, error) {
 	d.logger.Debug().Msg("listing volumes")
 
+	if d.engine != nil {
+		volumes, err := d.engine.VolumeList(ctx)
+		if !engineUnavailable(err) {
+			return volumes, err
+		}
+		d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+
 	args := []string{"volume", "ls", "--format", "{{json .}}"}
 	output, err := d.run(ctx, args)
 	if err != nil {
@@ -225,10 +258,9 @@ func (d *DockerCLI) ListVolumes(ctx context.Context) ([]Volume, error) {
 func (d *DockerCLI) InspectContainer(ctx context.Context, id string) (*InspectContainerInfo, error) {
 	d.logger.Debug().Str("container_id", id).Msg("inspecting container")
 
-	args := []string{"inspect", "--format", "{{json .}}", id}
-	output, err := d.run(ctx, args)
+	output, err := d.inspect(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("inspect container %s: %w", id, err)
+		return nil, err
 	}
 
 	var raw dockerInspectOutput
@@ -288,9 +320,8 @@ func (d *DockerCLI) InspectContainer(ctx context.Context, id string) (*InspectCo
 func (d *DockerCLI) PauseContainer(ctx context.Context, id string) error {
 	d.logger.Info().Str("container_id", id).Msg("pausing container")
 
-	args := []string{"pause", id}
-	if _, err := d.run(ctx, args); err != nil {
-		return fmt.Errorf("pause container %s: %w", id, err)
+	if err := d.containerAction(ctx, "pause", id); err != nil {
+		return err
 	}
 
 	d.logger.Info().Str("container_id", id).Msg("container paused")
@@ -301,15 +332,46 @@ func (d *DockerCLI) PauseContainer(ctx context.Context, id string) error {
 func (d *DockerCLI) UnpauseContainer(ctx context.Context, id string) error {
 	d.logger.Info().Str("container_id", id).Msg("unpausing container")
 
-	args := []string{"unpause", id}
-	if _, err := d.run(ctx, args); err != nil {
-		return fmt.Errorf("unpause container %s: %w", id, err)
+	if err := d.containerAction(ctx, "unpause", id); err != nil {
+		return err
 	}
 
 	d.logger.Info().Str("container_id", id).Msg("container unpaused")
 	return nil
 }
 
+// inspect returns the inspect document of a container.
+func (d *DockerCLI) inspect(ctx context.Context, id string) ([]byte, error) {
+	if d.engine != nil {
+		raw, err := d.engine.ContainerInspectRaw(ctx, id)
+		if !engineUnavailable(err) {
+			return raw, err
+		}
+		d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+
+	output, err := d.run(ctx, []string{"inspect", "--format", "{{json .}}", id})
+	if err != nil {
+		return nil, fmt.Errorf("inspect container %s: %w", id, err)
+	}
+	return output, nil
+}
+
+// containerAction pauses or unpauses a container.
+func (d *DockerCLI) containerAction(ctx context.Context, action, id string) error {
+	if d.engine != nil {
+		err := d.engine.containerAction(ctx, id, action, nil)
+		if !engineUnavailable(err) {
+			return err
+		}
+		d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+	if _, err := d.run(ctx, []string{action, id}); err != nil {
+		return fmt.Errorf("%s container %s: %w", action, id, err)
+	}
+	return nil
+}
+
 // run executes a docker command and returns the output.
 func (d *DockerCLI) run(ctx context.Context, args []string) ([]byte, error) {
 	cmd := exec.CommandContext(ctx, d.binary, args...)
@@ -344,10 +406,23 @@ func (d *DockerCLI) run(ctx context.Context, args []string) ([]byte, error) {
 // DockerBackup methods
 // ---------------------------------------------------------------------------
 
+// SetEngineClient sets the Engine API client. With nil, only the CLI is used.
+func (d *DockerBackup) SetEngineClient(engine *EngineClient) {
+	d.engine = engine
+}
+
 // ListContainers returns all containers on the system.
 func (d *DockerBackup) ListContainers(ctx context.Context) ([]Container, error) {
 	d.logger.Debug().Msg("listing containers")
 
+	if d.engine != nil {
+		containers, err := d.engine.ContainerList(ctx, true)
+		if !engineUnavailable(err) {
+			return containers, err
+		}
+		d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+
 	args := []string{"ps", "-a", "--format", "{{json .}}"}
 	output, err := d.run(ctx, args)
 	if err != nil {
@@ -388,6 +463,15 @@ func (d *DockerBackup) ListContainers(ctx context.Context) ([]Container, error)
 func (d *DockerBackup) ListVolumes(ctx context.Context) ([]Volume, error) {
 	d.logger.Debug().Msg("listing volumes")
 
+	// The API lists volumes with their details, so no per-volume inspect is needed.
+	if d.engine != nil {
+		volumes, err := d.engine.VolumeList(ctx)
+		if !engineUnavailable(err) {
+			return volumes, err
+		}
+		d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+
 	args := []string{"volume", "ls", "--format", "{{json .}}"}
 	output, err := d.run(ctx, args)
 	if err != nil {
@@ -468,18 +552,9 @@ func (d *DockerBackup) inspectVolume(ctx context.Context, name string) (*Volume,
 func (d *DockerBackup) GetContainerConfig(ctx context.Context, containerID string) (*BackupContainerConfig, error) {
 	d.logger.Debug().Str("container_id", containerID).Msg("getting container config")
 
-	args := []string{"inspect", containerID}
-	output, err := d.run(ctx, args)
+	inspectResult, err := d.inspectContainer(ctx, containerID)
 	if err != nil {
-		if strings.Contains(err.Error(), "No such container") {
-			return nil, ErrContainerNotFound
-		}
-		return nil, fmt.Errorf("inspect container: %w", err)
-	}
-
-	var inspectResult []json.RawMessage
-	if err := json.Unmarshal(output, &inspectResult); err != nil {
-		return nil, fmt.Errorf("parse container inspect: %w", err)
+		return nil, err
 	}
 
 	if len(inspectResult) == 0 {
@@ -575,6 +650,14 @@ func (d *DockerBackup) GetContainerConfig(ctx context.Context, containerID strin
 func (d *DockerBackup) PauseContainer(ctx context.Context, containerID string) error {
 	d.logger.Info().Str("container_id", containerID).Msg("pausing container")
 
+	if d.engine != nil {
+		err := d.engine.ContainerPause(ctx, containerID)
+		if !engineUnavailable(err) {
+			return err
+		}
+		d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+
 	args := []string{"pause", containerID}
 	_, err := d.run(ctx, args)
 	if err != nil {
@@ -587,6 +670,14 @@ func (d *DockerBackup) PauseContainer(ctx context.Context, containerID string) e
 func (d *DockerBackup) UnpauseContainer(ctx context.Context, containerID string) error {
 	d.logger.Info().Str("container_id", containerID).Msg("unpausing container")
 
+	if d.engine != nil {
+		err := d.engine.ContainerUnpause(ctx, containerID)
+		if !engineUnavailable(err) {
+			return err
+		}
+		d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+
 	args := []string{"unpause", containerID}
 	_, err := d.run(ctx, args)
 	if err != nil {
@@ -631,9 +722,33 @@ func (d *DockerBackup) BackupVolumes(ctx context.Context, cfg backends.ResticCon
 		return nil, errors.New("no volumes to backup")
 	}
 
+	// Collect paths to backup
+	var paths []string
+	for _, v := range targetVolumes {
+		if v.Mountpoint != "" {
+			paths = append(paths, v.Mountpoint)
+			result.VolumesBackedUp = append(result.VolumesBackedUp, v.Name)
+		}
+	}
+
+	// Snapshots are consistent without pausing the containers.
+	var backupOpts *backup.BackupOptions
+	pause := opts.PauseContainers
+	if opts.FilesystemSnapshot {
+		session, err := d.snapshots.Snapshot(ctx, paths, false)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot volumes: %w", err)
+		}
+		defer session.Close()
+		if len(session.Paths) > 0 {
+			backupOpts = &backup.BackupOptions{PathMounts: session.Paths}
+		}
+		pause = pause && len(session.Live) > 0
+	}
+
 	// Pause containers if requested
 	var pausedContainers []string
-	if opts.PauseContainers {
+	if pause {
 		containers, err := d.ListContainers(ctx)
 		if err != nil {
 			d.logger.Warn().Err(err).Msg("failed to list containers for pausing")
@@ -660,20 +775,11 @@ func (d *DockerBackup) BackupVolumes(ctx context.Context, cfg backends.ResticCon
 		}
 	}()
 
-	// Collect paths to backup
-	var paths []string
-	for _, v := range targetVolumes {
-		if v.Mountpoint != "" {
-			paths = append(paths, v.Mountpoint)
-			result.VolumesBackedUp = append(result.VolumesBackedUp, v.Name)
-		}
-	}
-
 	// Add docker volume tag
 	tags := append([]string{"docker-volume"}, opts.Tags...)
 
 	// Run restic backup
-	stats, err := d.restic.Backup(ctx, cfg, paths, nil, tags)
+	stats, err := d.restic.BackupWithOptions(ctx, cfg, paths, nil, tags, backupOpts)
 	if err != nil {
 		return nil, fmt.Errorf("restic backup: %w", err)
 	}
@@ -732,6 +838,38 @@ type DockerBackupMetadata struct {
 	AgentHostname    string                  `json:"agent_hostname"`
 }
 
+// inspectContainer returns the inspect documents for a container, in the
+// array form `docker inspect` prints.
+func (d *DockerBackup) inspectContainer(ctx context.Context, containerID string) ([]json.RawMessage, error) {
+	if d.engine != nil {
+		raw, err := d.engine.ContainerInspectRaw(ctx, containerID)
+		if err == nil {
+			return []json.RawMessage{raw}, nil
+		}
+		if errors.Is(err, ErrContainerNotFound) {
+			return nil, ErrContainerNotFound
+		}
+		if !engineUnavailable(err) {
+			return nil, err
+		}
+		d.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+
+	output, err := d.run(ctx, []string{"inspect", containerID})
+	if err != nil {
+		if strings.Contains(err.Error(), "No such container") {
+			return nil, ErrContainerNotFound
+		}
+		return nil, fmt.Errorf("inspect container: %w", err)
+	}
+
+	var inspectResult []json.RawMessage
+	if err := json.Unmarshal(output, &inspectResult); err != nil {
+		return nil, fmt.Errorf("parse container inspect: %w", err)
+	}
+	return inspectResult, nil
+}
+
 // run executes a docker command and returns the output.
 func (d *DockerBackup) run(ctx context.Context, args []string) ([]byte, error) {
 	cmd := exec.CommandContext(ctx, d.binary, args...)
@@ -0,0 +1,1430 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultDockerSocket is the Docker daemon's default Unix socket.
+	defaultDockerSocket = "/var/run/docker.sock"
+	// rootfulPodmanSocket is the system Podman API socket.
+	rootfulPodmanSocket = "/run/podman/podman.sock"
+	// defaultEngineAPIVersion is the newest API version the client speaks.
+	// Older daemons are talked to at their own version.
+	defaultEngineAPIVersion = "1.41"
+	// engineRequestTimeout bounds non-streaming API requests.
+	engineRequestTimeout = 60 * time.Second
+)
+
+// EngineConfig contains connection settings for the Docker Engine API.
+type EngineConfig struct {
+	// Host is the daemon address: unix:///path/to/socket or tcp://host:port.
+	Host string
+	// TLSVerify verifies the daemon certificate against ca.pem in CertPath.
+	TLSVerify bool
+	// CertPath is the directory holding ca.pem, cert.pem and key.pem for tcp hosts.
+	CertPath string
+	// APIVersion pins the API version instead of negotiating it with the daemon.
+	APIVersion string
+}
+
+// EngineConfigFromEnv returns the Engine API configuration from the standard
+// DOCKER_HOST, DOCKER_TLS_VERIFY, DOCKER_CERT_PATH and DOCKER_API_VERSION
+// variables. Without DOCKER_HOST the Docker socket is used, or the Podman
+// socket when only Podman is running.
+func EngineConfigFromEnv() EngineConfig {
+	cfg := EngineConfig{
+		Host:       os.Getenv("DOCKER_HOST"),
+		TLSVerify:  os.Getenv("DOCKER_TLS_VERIFY") != "",
+		CertPath:   os.Getenv("DOCKER_CERT_PATH"),
+		APIVersion: os.Getenv("DOCKER_API_VERSION"),
+	}
+	if cfg.Host == "" {
+		cfg.Host = detectEngineHost()
+	}
+	if cfg.CertPath == "" && cfg.TLSVerify {
+		if home, err := os.UserHomeDir(); err == nil {
+			cfg.CertPath = filepath.Join(home, ".docker")
+		}
+	}
+	return cfg
+}
+
+// detectEngineHost returns the first Docker or Podman socket that exists.
+func detectEngineHost() string {
+	candidates := []string{defaultDockerSocket}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "podman", "podman.sock"))
+	}
+	candidates = append(candidates, rootfulPodmanSocket)
+
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return "unix://" + path
+		}
+	}
+	return ""
+}
+
+// EngineClient talks to the Docker Engine API over a Unix socket or TCP.
+// It also works against Podman's Docker-compatible API.
+type EngineClient struct {
+	host       string
+	baseURL    string
+	httpClient *http.Client
+	logger     zerolog.Logger
+
+	mu         sync.Mutex
+	apiVersion string
+	podman     bool
+}
+
+// EngineClient implements DockerClient.
+var _ DockerClient = (*EngineClient)(nil)
+
+// NewEngineClient creates a new Engine API client. It does not connect to
+// the daemon until the first request.
+func NewEngineClient(cfg EngineConfig, logger zerolog.Logger) (*EngineClient, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("docker host is required")
+	}
+	u, err := url.Parse(cfg.Host)
+	if err != nil {
+		return nil, fmt.Errorf("parse docker host: %w", err)
+	}
+
+	transport := &http.Transport{
+		MaxIdleConns:    4,
+		IdleConnTimeout: 90 * time.Second,
+	}
+	c := &EngineClient{
+		host:       cfg.Host,
+		apiVersion: strings.TrimPrefix(cfg.APIVersion, "v"),
+		httpClient: &http.Client{Transport: transport},
+		logger:     logger.With().Str("component", "docker_engine").Logger(),
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		if socket == "" {
+			socket = u.Host
+		}
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		// The host name is ignored when dialing a socket.
+		c.baseURL = "http://docker"
+	case "tcp", "http", "https":
+		scheme := "http"
+		if cfg.TLSVerify || cfg.CertPath != "" || u.Scheme == "https" {
+			tlsConfig, err := engineTLSConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = tlsConfig
+			scheme = "https"
+		}
+		c.baseURL = scheme + "://" + u.Host
+	default:
+		return nil, fmt.Errorf("unsupported docker host scheme %q", u.Scheme)
+	}
+
+	return c, nil
+}
+
+// engineTLSConfig loads the CA and client certificate from cfg.CertPath.
+// As with the docker CLI, the server certificate is only verified when
+// TLSVerify is set.
+func engineTLSConfig(cfg EngineConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: !cfg.TLSVerify, //nolint:gosec // matches DOCKER_TLS_VERIFY semantics
+	}
+	if cfg.CertPath == "" {
+		return tlsConfig, nil
+	}
+
+	ca, err := os.ReadFile(filepath.Join(cfg.CertPath, "ca.pem"))
+	if err != nil && cfg.TLSVerify {
+		return nil, fmt.Errorf("read docker CA: %w", err)
+	}
+	if err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("invalid docker CA certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile, keyFile := filepath.Join(cfg.CertPath, "cert.pem"), filepath.Join(cfg.CertPath, "key.pem")
+	if _, err := os.Stat(certFile); err == nil {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load docker client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+var (
+	defaultEngineOnce   sync.Once
+	defaultEngineClient *EngineClient
+)
+
+// DefaultEngineClient returns the shared Engine API client configured from
+// the environment, or nil when no daemon socket or DOCKER_HOST is found. The
+// subsystems in this package fall back to the docker CLI when it is nil.
+func DefaultEngineClient(logger zerolog.Logger) *EngineClient {
+	defaultEngineOnce.Do(func() {
+		cfg := EngineConfigFromEnv()
+		if cfg.Host == "" {
+			logger.Debug().Msg("no docker socket found, using docker CLI")
+			return
+		}
+		client, err := NewEngineClient(cfg, logger)
+		if err != nil {
+			logger.Warn().Err(err).Str("host", cfg.Host).Msg("cannot use docker engine API, using docker CLI")
+			return
+		}
+		defaultEngineClient = client
+	})
+	return defaultEngineClient
+}
+
+// Host returns the daemon address the client connects to.
+func (c *EngineClient) Host() string {
+	return c.host
+}
+
+// IsPodman reports whether the daemon is Podman. It is only known once the
+// daemon has been pinged.
+func (c *EngineClient) IsPodman() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.podman
+}
+
+// Ping checks that the daemon is reachable. Unless the API version is
+// pinned, it also negotiates the version used for later requests.
+func (c *EngineClient) Ping(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ping(ctx)
+}
+
+// version returns the API version to use, negotiating it on first use.
+// A failed negotiation is not cached so the client recovers once the
+// daemon comes up.
+func (c *EngineClient) version(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.apiVersion == "" {
+		if err := c.ping(ctx); err != nil {
+			return "", err
+		}
+	}
+	return c.apiVersion, nil
+}
+
+// ping calls the unversioned /_ping endpoint. c.mu must be held.
+func (c *EngineClient) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, engineRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/_ping", nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return c.transportError(ctx, err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: ping returned status %d", ErrDockerNotAvailable, resp.StatusCode)
+	}
+
+	// Podman's compat API also reports its native libpod API version.
+	c.podman = resp.Header.Get("Libpod-Api-Version") != ""
+	if c.apiVersion == "" {
+		c.apiVersion = negotiateAPIVersion(resp.Header.Get("Api-Version"))
+		c.logger.Debug().
+			Str("host", c.host).
+			Str("api_version", c.apiVersion).
+			Bool("podman", c.podman).
+			Msg("connected to docker engine API")
+	}
+	return nil
+}
+
+// negotiateAPIVersion returns the lower of the server's and the client's API version.
+func negotiateAPIVersion(server string) string {
+	if server == "" || compareAPIVersions(server, defaultEngineAPIVersion) >= 0 {
+		return defaultEngineAPIVersion
+	}
+	return server
+}
+
+// compareAPIVersions compares two "major.minor" API versions.
+func compareAPIVersions(a, b string) int {
+	pa, pb := strings.SplitN(a, ".", 2), strings.SplitN(b, ".", 2)
+	for i := 0; i < 2; i++ {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(pb[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// engineStatusError is a failed Engine API response.
+type engineStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *engineStatusError) Error() string {
+	return fmt.Sprintf("docker API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// notFound replaces a 404 response error with target.
+func notFound(err, target error) error {
+	var statusErr *engineStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", target, statusErr.Message)
+	}
+	return err
+}
+
+// transportError reports a failed connection as ErrDockerNotAvailable,
+// unless the caller's context ended.
+func (c *EngineClient) transportError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return fmt.Errorf("%w: %v", ErrDockerNotAvailable, err)
+}
+
+// do sends a request to a versioned API path. The caller must close the
+// response body of a successful response.
+func (c *EngineClient) do(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	version, err := c.version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	target := c.baseURL + "/v" + version + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, c.transportError(ctx, err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			msg = apiErr.Message
+		}
+		return nil, &engineStatusError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	return resp, nil
+}
+
+// doJSON sends in as a JSON body and decodes the JSON response into out.
+// Either may be nil.
+func (c *EngineClient) doJSON(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, engineRequestTimeout)
+	defer cancel()
+
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	resp, err := c.do(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// System
+// ---------------------------------------------------------------------------
+
+// Info returns the daemon's system information, as `docker info` shows it.
+func (c *EngineClient) Info(ctx context.Context) (json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := c.doJSON(ctx, http.MethodGet, "/info", nil, nil, &raw); err != nil {
+		return nil, fmt.Errorf("docker info: %w", err)
+	}
+	return raw, nil
+}
+
+// ServerVersion returns the daemon version and its API version.
+func (c *EngineClient) ServerVersion(ctx context.Context) (version, apiVersion string, err error) {
+	var v struct {
+		Version    string `json:"Version"`
+		APIVersion string `json:"ApiVersion"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/version", nil, nil, &v); err != nil {
+		return "", "", fmt.Errorf("docker version: %w", err)
+	}
+	return v.Version, v.APIVersion, nil
+}
+
+// ---------------------------------------------------------------------------
+// Containers
+// ---------------------------------------------------------------------------
+
+// engineContainerSummary is an item of the container list response.
+type engineContainerSummary struct {
+	ID      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Image   string            `json:"Image"`
+	Created int64             `json:"Created"`
+	State   string            `json:"State"`
+	Status  string            `json:"Status"`
+	Labels  map[string]string `json:"Labels"`
+	Mounts  []struct {
+		Type        string `json:"Type"`
+		Name        string `json:"Name"`
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+		RW          bool   `json:"RW"`
+	} `json:"Mounts"`
+}
+
+func (s engineContainerSummary) name() string {
+	if len(s.Names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(s.Names[0], "/")
+}
+
+func (c *EngineClient) containerSummaries(ctx context.Context, all bool) ([]engineContainerSummary, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "1")
+	}
+	var summaries []engineContainerSummary
+	if err := c.doJSON(ctx, http.MethodGet, "/containers/json", query, nil, &summaries); err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+	return summaries, nil
+}
+
+// ContainerList returns containers, including stopped ones when all is set.
+func (c *EngineClient) ContainerList(ctx context.Context, all bool) ([]Container, error) {
+	summaries, err := c.containerSummaries(ctx, all)
+	if err != nil {
+		return nil, err
+	}
+	containers := make([]Container, 0, len(summaries))
+	for _, s := range summaries {
+		container := Container{
+			ID:      s.ID,
+			Name:    s.name(),
+			Image:   s.Image,
+			State:   s.State,
+			Status:  s.Status,
+			Labels:  s.Labels,
+			Created: time.Unix(s.Created, 0),
+		}
+		for _, m := range s.Mounts {
+			container.Mounts = append(container.Mounts, Mount{
+				Type:        m.Type,
+				Name:        m.Name,
+				Source:      m.Source,
+				Destination: m.Destination,
+				ReadOnly:    !m.RW,
+			})
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+// ListContainers returns all containers with their labels.
+func (c *EngineClient) ListContainers(ctx context.Context) ([]ContainerInfo, error) {
+	summaries, err := c.containerSummaries(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	containers := make([]ContainerInfo, 0, len(summaries))
+	for _, s := range summaries {
+		info := ContainerInfo{
+			ID:        s.ID,
+			Name:      s.name(),
+			Image:     s.Image,
+			Labels:    s.Labels,
+			CreatedAt: time.Unix(s.Created, 0),
+			Status:    s.State,
+		}
+		for _, m := range s.Mounts {
+			info.Mounts = append(info.Mounts, MountInfo{
+				Type:        m.Type,
+				Name:        m.Name,
+				Source:      m.Source,
+				Destination: m.Destination,
+				ReadOnly:    !m.RW,
+			})
+		}
+		containers = append(containers, info)
+	}
+	return containers, nil
+}
+
+// ContainerInspectRaw returns the inspect document of a container, as one
+// element of `docker inspect` output.
+func (c *EngineClient) ContainerInspectRaw(ctx context.Context, containerID string) (json.RawMessage, error) {
+	var raw json.RawMessage
+	err := c.doJSON(ctx, http.MethodGet, "/containers/"+url.PathEscape(containerID)+"/json", nil, nil, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("inspect container %s: %w", containerID, notFound(err, ErrContainerNotFound))
+	}
+	return raw, nil
+}
+
+// InspectContainer returns detailed information about a container.
+func (c *EngineClient) InspectContainer(ctx context.Context, containerID string) (*ContainerInfo, error) {
+	raw, err := c.ContainerInspectRaw(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	var inspect dockerInspectOutput
+	if err := json.Unmarshal(raw, &inspect); err != nil {
+		return nil, fmt.Errorf("parse inspect output: %w", err)
+	}
+
+	info := &ContainerInfo{
+		ID:     inspect.ID,
+		Name:   strings.TrimPrefix(inspect.Name, "/"),
+		Image:  inspect.Config.Image,
+		Labels: inspect.Config.Labels,
+		Status: inspect.State.Status,
+	}
+	if t, err := time.Parse(time.RFC3339Nano, inspect.Created); err == nil {
+		info.CreatedAt = t
+	}
+	for _, m := range inspect.Mounts {
+		info.Mounts = append(info.Mounts, MountInfo{
+			Type:        m.Type,
+			Name:        m.Name,
+			Source:      m.Source,
+			Destination: m.Destination,
+			ReadOnly:    !m.RW,
+		})
+	}
+	return info, nil
+}
+
+// containerAction posts a state change to a container. 304 Not Modified,
+// returned when the container is already in the requested state, is success.
+func (c *EngineClient) containerAction(ctx context.Context, containerID, action string, query url.Values) error {
+	err := c.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(containerID)+"/"+action, query, nil, nil)
+	if err != nil {
+		return fmt.Errorf("%s container %s: %w", action, containerID, notFound(err, ErrContainerNotFound))
+	}
+	return nil
+}
+
+// StopContainer stops a container. A nil timeout uses the container's own stop timeout.
+func (c *EngineClient) StopContainer(ctx context.Context, containerID string, timeout *time.Duration) error {
+	query := url.Values{}
+	if timeout != nil {
+		query.Set("t", strconv.Itoa(int(timeout.Seconds())))
+		// Leave room for the daemon to kill the container after the timeout.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout+engineRequestTimeout)
+		defer cancel()
+	}
+	return c.containerAction(ctx, containerID, "stop", query)
+}
+
+// StartContainer starts a container.
+func (c *EngineClient) StartContainer(ctx context.Context, containerID string) error {
+	return c.containerAction(ctx, containerID, "start", nil)
+}
+
+// ContainerPause pauses a running container.
+func (c *EngineClient) ContainerPause(ctx context.Context, containerID string) error {
+	return c.containerAction(ctx, containerID, "pause", nil)
+}
+
+// ContainerUnpause unpauses a paused container.
+func (c *EngineClient) ContainerUnpause(ctx context.Context, containerID string) error {
+	return c.containerAction(ctx, containerID, "unpause", nil)
+}
+
+// ContainerCreate creates a container from an Engine API create request
+// body and returns its ID. The container is not started.
+func (c *EngineClient) ContainerCreate(ctx context.Context, name string, config interface{}) (string, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/containers/create", query, config, &created); err != nil {
+		return "", fmt.Errorf("create container %s: %w", name, err)
+	}
+	return created.ID, nil
+}
+
+// ContainerRemove removes a container. Its volumes are kept.
+func (c *EngineClient) ContainerRemove(ctx context.Context, containerID string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+	err := c.doJSON(ctx, http.MethodDelete, "/containers/"+url.PathEscape(containerID), query, nil, nil)
+	if err != nil {
+		return fmt.Errorf("remove container %s: %w", containerID, notFound(err, ErrContainerNotFound))
+	}
+	return nil
+}
+
+// ContainerArchive writes the file or directory at path in a container as a
+// tar archive to w, as `docker cp` does. A path ending in "/." archives the
+// directory's contents.
+func (c *EngineClient) ContainerArchive(ctx context.Context, containerID, path string, w io.Writer) error {
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(containerID)+"/archive", url.Values{"path": {path}}, nil, "")
+	if err != nil {
+		return fmt.Errorf("copy %s from container %s: %w", path, containerID, notFound(err, ErrContainerNotFound))
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("copy %s from container %s: %w", path, containerID, err)
+	}
+	return nil
+}
+
+// ContainerExtract extracts a tar archive, optionally gzip compressed, into
+// the directory at path in a container.
+func (c *EngineClient) ContainerExtract(ctx context.Context, containerID, path string, r io.Reader) error {
+	resp, err := c.do(ctx, http.MethodPut, "/containers/"+url.PathEscape(containerID)+"/archive", url.Values{"path": {path}}, r, "application/x-tar")
+	if err != nil {
+		return fmt.Errorf("copy to %s in container %s: %w", path, containerID, notFound(err, ErrContainerNotFound))
+	}
+	resp.Body.Close()
+	return nil
+}
+
+const (
+	// helperImage is the image of the stopped helper containers that give
+	// the Engine API access to the files in a volume.
+	helperImage = "alpine:latest"
+	// helperLabel marks helper containers.
+	helperLabel = "keldris.helper"
+)
+
+// withHelperContainer creates a stopped helper container with binds, calls
+// fn with its ID and removes the container again. The helper image is
+// pulled when the daemon does not have it.
+func (c *EngineClient) withHelperContainer(ctx context.Context, binds []string, fn func(id string) error) error {
+	config := map[string]interface{}{
+		"Image":      helperImage,
+		"Cmd":        []string{"true"},
+		"Labels":     map[string]string{helperLabel: "true"},
+		"HostConfig": map[string]interface{}{"Binds": binds},
+	}
+	id, err := c.ContainerCreate(ctx, "", config)
+	var statusErr *engineStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		if _, err = c.ImagePull(ctx, helperImage); err == nil {
+			id, err = c.ContainerCreate(ctx, "", config)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := c.ContainerRemove(context.WithoutCancel(ctx), id, true); err != nil {
+			c.logger.Warn().Err(err).Str("container", id).Msg("failed to remove helper container")
+		}
+	}()
+	return fn(id)
+}
+
+// ---------------------------------------------------------------------------
+// Events
+// ---------------------------------------------------------------------------
+
+// EngineEvent is a message from the daemon's event stream.
+type EngineEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+// Time returns when the event occurred.
+func (e EngineEvent) Time() time.Time {
+	return time.Unix(0, e.TimeNano)
+}
+
+// Events streams daemon events matching filters to fn until ctx is
+// cancelled or the stream breaks. When since is set, buffered events from
+// that time on are replayed first. A broken stream returns an error
+// wrapping ErrDockerNotAvailable.
+func (c *EngineClient) Events(ctx context.Context, since time.Time, filters map[string][]string, fn func(EngineEvent)) error {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", strconv.FormatFloat(float64(since.UnixNano())/1e9, 'f', 9, 64))
+	}
+	if len(filters) > 0 {
+		data, err := json.Marshal(filters)
+		if err != nil {
+			return fmt.Errorf("marshal event filters: %w", err)
+		}
+		query.Set("filters", string(data))
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/events", query, nil, "")
+	if err != nil {
+		return fmt.Errorf("subscribe to events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var event EngineEvent
+		if err := dec.Decode(&event); err != nil {
+			return fmt.Errorf("read events: %w", c.transportError(ctx, err))
+		}
+		fn(event)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Exec
+// ---------------------------------------------------------------------------
+
+// ExecOptions configures a command run inside a container.
+type ExecOptions struct {
+	User       string
+	WorkingDir string
+	Env        []string
+	// Stdin is written to the command's standard input when set.
+	Stdin io.Reader
+}
+
+// ExecResult is the output and exit code of a command run inside a container.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// ContainerExec runs a command inside a container and waits for it to exit.
+// A non-zero exit code is reported in the result, not as an error.
+func (c *EngineClient) ContainerExec(ctx context.Context, containerID string, cmd []string, opts ExecOptions) (*ExecResult, error) {
+	var stdout, stderr bytes.Buffer
+	exitCode, err := c.ContainerExecStream(ctx, containerID, cmd, opts, &stdout, &stderr)
+	if err != nil {
+		return nil, err
+	}
+	return &ExecResult{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: exitCode}, nil
+}
+
+// ContainerExecStream runs a command inside a container, copying its output
+// to stdout and stderr as it is produced, and returns its exit code.
+func (c *EngineClient) ContainerExecStream(ctx context.Context, containerID string, cmd []string, opts ExecOptions, stdout, stderr io.Writer) (int, error) {
+	createReq := map[string]interface{}{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"AttachStdin":  opts.Stdin != nil,
+		"Tty":          false,
+		"Cmd":          cmd,
+	}
+	if opts.User != "" {
+		createReq["User"] = opts.User
+	}
+	if opts.WorkingDir != "" {
+		createReq["WorkingDir"] = opts.WorkingDir
+	}
+	if len(opts.Env) > 0 {
+		createReq["Env"] = opts.Env
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err := c.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(containerID)+"/exec", nil, createReq, &created)
+	if err != nil {
+		return -1, fmt.Errorf("create exec in %s: %w", containerID, notFound(err, ErrContainerNotFound))
+	}
+
+	if err := c.execStart(ctx, created.ID, opts.Stdin, stdout, stderr); err != nil {
+		return -1, fmt.Errorf("exec in %s: %w", containerID, err)
+	}
+
+	var inspect struct {
+		Running  bool `json:"Running"`
+		ExitCode int  `json:"ExitCode"`
+	}
+	if err := c.doJSON(context.WithoutCancel(ctx), http.MethodGet, "/exec/"+created.ID+"/json", nil, nil, &inspect); err != nil {
+		return -1, fmt.Errorf("inspect exec: %w", err)
+	}
+	return inspect.ExitCode, nil
+}
+
+// execStart starts an exec instance and demultiplexes its output. With
+// stdin, the connection is hijacked so input can be streamed while output
+// is read.
+func (c *EngineClient) execStart(ctx context.Context, execID string, stdin io.Reader, stdout, stderr io.Writer) error {
+	body := []byte(`{"Detach":false,"Tty":false}`)
+	if stdin == nil {
+		resp, err := c.do(ctx, http.MethodPost, "/exec/"+execID+"/start", nil, bytes.NewReader(body), "application/json")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return demuxStream(resp.Body, stdout, stderr)
+	}
+
+	conn, reader, err := c.hijack(ctx, "/exec/"+execID+"/start", body)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	copyErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(conn, stdin)
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+		copyErr <- err
+	}()
+
+	if err := demuxStream(reader, stdout, stderr); err != nil {
+		return err
+	}
+	select {
+	case err := <-copyErr:
+		// The command may exit without reading all of its input.
+		if err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, io.ErrClosedPipe) {
+			c.logger.Debug().Err(err).Msg("exec stdin copy ended early")
+		}
+	default:
+	}
+	return nil
+}
+
+// hijack sends a POST request that upgrades the connection to a raw stream,
+// as the daemon does for attached exec sessions.
+func (c *EngineClient) hijack(ctx context.Context, path string, body []byte) (net.Conn, *bufio.Reader, error) {
+	version, err := c.version(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	transport, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok {
+		return nil, nil, errors.New("docker client transport does not support streaming input")
+	}
+
+	u, _ := url.Parse(c.baseURL)
+	var conn net.Conn
+	if transport.DialContext != nil {
+		conn, err = transport.DialContext(ctx, "tcp", u.Host)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", u.Host)
+	}
+	if err != nil {
+		return nil, nil, c.transportError(ctx, err)
+	}
+	if u.Scheme == "https" {
+		tlsConfig := transport.TLSClientConfig.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, nil, c.transportError(ctx, err)
+		}
+		conn = tlsConn
+	}
+	// Unblock reads and writes when the context ends.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/v"+version+path, bytes.NewReader(body))
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	if err := req.Write(conn); err != nil {
+		stop()
+		conn.Close()
+		return nil, nil, c.transportError(ctx, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, nil, c.transportError(ctx, err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		stop()
+		conn.Close()
+		return nil, nil, &engineStatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+	return &hijackedConn{Conn: conn, stop: stop}, reader, nil
+}
+
+// hijackedConn releases the context watcher when the connection is closed.
+type hijackedConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *hijackedConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// CloseWrite half-closes the connection so the command sees end of input.
+func (c *hijackedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// demuxStream splits the daemon's multiplexed output stream. Each frame has
+// an 8 byte header: the stream type, three zero bytes and the big-endian
+// payload length.
+func demuxStream(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("read exec output: %w", err)
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+
+		var w io.Writer
+		switch header[0] {
+		case 0, 1:
+			w = stdout
+		case 2:
+			w = stderr
+		case 3:
+			// System errors from the daemon.
+			var msg bytes.Buffer
+			io.CopyN(&msg, r, size)
+			return fmt.Errorf("exec failed: %s", strings.TrimSpace(msg.String()))
+		default:
+			return fmt.Errorf("unexpected exec stream type %d", header[0])
+		}
+		if w == nil {
+			w = io.Discard
+		}
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return fmt.Errorf("read exec output: %w", err)
+		}
+	}
+}
+
+// ExecCommand executes a command inside a container and returns its output.
+// A non-zero exit code is returned as an error that includes stderr.
+func (c *EngineClient) ExecCommand(ctx context.Context, containerID string, cmd []string) (string, error) {
+	result, err := c.ContainerExec(ctx, containerID, cmd, ExecOptions{})
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return result.Stdout, fmt.Errorf("command exited with code %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return result.Stdout, nil
+}
+
+// ---------------------------------------------------------------------------
+// Volumes
+// ---------------------------------------------------------------------------
+
+// VolumeList returns all volumes.
+func (c *EngineClient) VolumeList(ctx context.Context) ([]Volume, error) {
+	var resp struct {
+		Volumes []struct {
+			Name       string            `json:"Name"`
+			Driver     string            `json:"Driver"`
+			Mountpoint string            `json:"Mountpoint"`
+			Scope      string            `json:"Scope"`
+			CreatedAt  string            `json:"CreatedAt"`
+			Labels     map[string]string `json:"Labels"`
+		} `json:"Volumes"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/volumes", nil, nil, &resp); err != nil {
+		return nil, fmt.Errorf("list volumes: %w", err)
+	}
+	volumes := make([]Volume, 0, len(resp.Volumes))
+	for _, v := range resp.Volumes {
+		volumes = append(volumes, Volume{
+			Name:       v.Name,
+			Driver:     v.Driver,
+			Mountpoint: v.Mountpoint,
+			Scope:      v.Scope,
+			CreatedAt:  v.CreatedAt,
+			Labels:     v.Labels,
+		})
+	}
+	return volumes, nil
+}
+
+// VolumeInspectRaw returns the inspect document of a volume.
+func (c *EngineClient) VolumeInspectRaw(ctx context.Context, name string) (json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := c.doJSON(ctx, http.MethodGet, "/volumes/"+url.PathEscape(name), nil, nil, &raw); err != nil {
+		return nil, fmt.Errorf("inspect volume %s: %w", name, notFound(err, ErrVolumeNotFound))
+	}
+	return raw, nil
+}
+
+// VolumeCreate creates a volume. Creating an existing volume is a no-op.
+func (c *EngineClient) VolumeCreate(ctx context.Context, name string, labels map[string]string) error {
+	req := map[string]interface{}{"Name": name}
+	if len(labels) > 0 {
+		req["Labels"] = labels
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/volumes/create", nil, req, nil); err != nil {
+		return fmt.Errorf("create volume %s: %w", name, err)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Networks
+// ---------------------------------------------------------------------------
+
+// NetworkList returns the names of all networks.
+func (c *EngineClient) NetworkList(ctx context.Context) ([]string, error) {
+	var networks []struct {
+		Name string `json:"Name"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/networks", nil, nil, &networks); err != nil {
+		return nil, fmt.Errorf("list networks: %w", err)
+	}
+	names := make([]string, 0, len(networks))
+	for _, n := range networks {
+		names = append(names, n.Name)
+	}
+	return names, nil
+}
+
+// NetworkInspectRaw returns the inspect document of a network, including
+// its connected containers.
+func (c *EngineClient) NetworkInspectRaw(ctx context.Context, name string) (json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := c.doJSON(ctx, http.MethodGet, "/networks/"+url.PathEscape(name), nil, nil, &raw); err != nil {
+		return nil, fmt.Errorf("inspect network %s: %w", name, notFound(err, ErrNetworkNotFound))
+	}
+	return raw, nil
+}
+
+// NetworkCreate creates a network from a backed up definition.
+func (c *EngineClient) NetworkCreate(ctx context.Context, def *NetworkDefinition) error {
+	req := map[string]interface{}{
+		"Name":           def.Name,
+		"Driver":         string(def.Driver),
+		"Internal":       def.Internal,
+		"Attachable":     def.Attachable,
+		"EnableIPv6":     def.EnableIPv6,
+		"Labels":         def.Labels,
+		"Options":        def.Options,
+		"CheckDuplicate": true,
+	}
+	if def.IPAM != nil {
+		ipam := dockerIPAM{Driver: def.IPAM.Driver, Options: def.IPAM.Options}
+		for _, cfg := range def.IPAM.Config {
+			ipam.Config = append(ipam.Config, dockerIPAMConfig{
+				Subnet:             cfg.Subnet,
+				IPRange:            cfg.IPRange,
+				Gateway:            cfg.Gateway,
+				AuxiliaryAddresses: cfg.AuxAddress,
+			})
+		}
+		req["IPAM"] = ipam
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/networks/create", nil, req, nil); err != nil {
+		return fmt.Errorf("create network %s: %w", def.Name, err)
+	}
+	return nil
+}
+
+// NetworkRemove removes a network.
+func (c *EngineClient) NetworkRemove(ctx context.Context, name string) error {
+	if err := c.doJSON(ctx, http.MethodDelete, "/networks/"+url.PathEscape(name), nil, nil, nil); err != nil {
+		return fmt.Errorf("remove network %s: %w", name, notFound(err, ErrNetworkNotFound))
+	}
+	return nil
+}
+
+// NetworkConnect connects a container to a network, optionally with static addresses.
+func (c *EngineClient) NetworkConnect(ctx context.Context, network, containerID, ipv4, ipv6 string) error {
+	req := map[string]interface{}{"Container": containerID}
+	if ipv4 != "" || ipv6 != "" {
+		req["EndpointConfig"] = map[string]interface{}{
+			"IPAMConfig": map[string]string{"IPv4Address": ipv4, "IPv6Address": ipv6},
+		}
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/networks/"+url.PathEscape(network)+"/connect", nil, req, nil); err != nil {
+		return fmt.Errorf("connect %s to network %s: %w", containerID, network, err)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Images
+// ---------------------------------------------------------------------------
+
+// ImageList returns all images.
+func (c *EngineClient) ImageList(ctx context.Context) ([]ImageInfo, error) {
+	var summaries []struct {
+		ID          string            `json:"Id"`
+		RepoTags    []string          `json:"RepoTags"`
+		RepoDigests []string          `json:"RepoDigests"`
+		Size        int64             `json:"Size"`
+		Created     int64             `json:"Created"`
+		Labels      map[string]string `json:"Labels"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/images/json", nil, nil, &summaries); err != nil {
+		return nil, fmt.Errorf("list images: %w", err)
+	}
+	images := make([]ImageInfo, 0, len(summaries))
+	for _, s := range summaries {
+		images = append(images, ImageInfo{
+			ID:          s.ID,
+			RepoTags:    s.RepoTags,
+			RepoDigests: s.RepoDigests,
+			Size:        s.Size,
+			Created:     time.Unix(s.Created, 0),
+			Labels:      s.Labels,
+		})
+	}
+	return images, nil
+}
+
+// ImageInspectRaw returns the inspect document of an image.
+func (c *EngineClient) ImageInspectRaw(ctx context.Context, image string) (json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := c.doJSON(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil, &raw); err != nil {
+		return nil, fmt.Errorf("inspect image %s: %w", image, err)
+	}
+	return raw, nil
+}
+
+// ImageSave writes an image as a tar archive to w, as `docker save` does.
+func (c *EngineClient) ImageSave(ctx context.Context, image string, w io.Writer) error {
+	resp, err := c.do(ctx, http.MethodGet, "/images/get", url.Values{"names": {image}}, nil, "")
+	if err != nil {
+		return fmt.Errorf("save image %s: %w", image, err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("save image %s: %w", image, err)
+	}
+	return nil
+}
+
+// ImageLoad loads images from a tar archive, as `docker load` does, and
+// returns the daemon's progress output.
+func (c *EngineClient) ImageLoad(ctx context.Context, r io.Reader) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/images/load", url.Values{"quiet": {"1"}}, r, "application/x-tar")
+	if err != nil {
+		return "", fmt.Errorf("load image: %w", err)
+	}
+	defer resp.Body.Close()
+	output, err := readJSONMessages(resp.Body)
+	if err != nil {
+		return output, fmt.Errorf("load image: %w", err)
+	}
+	return output, nil
+}
+
+// ImagePull pulls an image, as `docker pull` does, and returns the daemon's
+// progress output. An image without a tag or digest pulls :latest.
+func (c *EngineClient) ImagePull(ctx context.Context, image string) (string, error) {
+	query := url.Values{"fromImage": {image}}
+	if !strings.Contains(image, "@") && !strings.Contains(image[strings.LastIndex(image, "/")+1:], ":") {
+		query.Set("tag", "latest")
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/images/create", query, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("pull image %s: %w", image, err)
+	}
+	defer resp.Body.Close()
+	output, err := readJSONMessages(resp.Body)
+	if err != nil {
+		return output, fmt.Errorf("pull image %s: %w", image, err)
+	}
+	return output, nil
+}
+
+// readJSONMessages reads a stream of daemon progress messages. Errors that
+// occur after the response started are reported inside the stream.
+func readJSONMessages(r io.Reader) (string, error) {
+	var output strings.Builder
+	dec := json.NewDecoder(r)
+	for {
+		var msg struct {
+			Stream string `json:"stream"`
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return output.String(), nil
+			}
+			return output.String(), fmt.Errorf("read progress: %w", err)
+		}
+		if msg.Error != "" {
+			return output.String(), errors.New(msg.Error)
+		}
+		output.WriteString(msg.Stream)
+		if msg.Status != "" {
+			output.WriteString(msg.Status + "\n")
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Swarm secrets, configs and services
+// ---------------------------------------------------------------------------
+
+// swarmObject is the common shape of swarm secrets and configs.
+type swarmObject struct {
+	ID        string    `json:"ID"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+	Spec      struct {
+		Name   string            `json:"Name"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Spec"`
+}
+
+func (c *EngineClient) swarmList(ctx context.Context, kind string, secretType SecretType) ([]*DockerSecret, error) {
+	var objects []swarmObject
+	if err := c.doJSON(ctx, http.MethodGet, "/"+kind+"s", nil, nil, &objects); err != nil {
+		return nil, fmt.Errorf("list %ss: %w", kind, err)
+	}
+	secrets := make([]*DockerSecret, 0, len(objects))
+	for _, o := range objects {
+		secrets = append(secrets, &DockerSecret{
+			ID:        o.ID,
+			Name:      o.Spec.Name,
+			Type:      secretType,
+			CreatedAt: o.CreatedAt,
+			UpdatedAt: o.UpdatedAt,
+			Labels:    o.Spec.Labels,
+		})
+	}
+	return secrets, nil
+}
+
+// SecretList returns all swarm secrets without their data.
+func (c *EngineClient) SecretList(ctx context.Context) ([]*DockerSecret, error) {
+	return c.swarmList(ctx, "secret", SecretTypeSecret)
+}
+
+// ConfigList returns all swarm configs.
+func (c *EngineClient) ConfigList(ctx context.Context) ([]*DockerSecret, error) {
+	return c.swarmList(ctx, "config", SecretTypeConfig)
+}
+
+// SecretInspectRaw returns the inspect document of a secret.
+func (c *EngineClient) SecretInspectRaw(ctx context.Context, idOrName string) (json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := c.doJSON(ctx, http.MethodGet, "/secrets/"+url.PathEscape(idOrName), nil, nil, &raw); err != nil {
+		return nil, fmt.Errorf("inspect secret %s: %w", idOrName, notFound(err, ErrSecretNotFound))
+	}
+	return raw, nil
+}
+
+// ConfigInspectRaw returns the inspect document of a config, including its data.
+func (c *EngineClient) ConfigInspectRaw(ctx context.Context, idOrName string) (json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := c.doJSON(ctx, http.MethodGet, "/configs/"+url.PathEscape(idOrName), nil, nil, &raw); err != nil {
+		return nil, fmt.Errorf("inspect config %s: %w", idOrName, notFound(err, ErrConfigNotFound))
+	}
+	return raw, nil
+}
+
+// SecretCreate creates a swarm secret. driver selects an external secret
+// store and may be empty.
+func (c *EngineClient) SecretCreate(ctx context.Context, name string, labels map[string]string, driver string, data []byte) error {
+	req := map[string]interface{}{
+		"Name":   name,
+		"Labels": labels,
+		"Data":   base64.StdEncoding.EncodeToString(data),
+	}
+	if driver != "" {
+		req["Driver"] = map[string]string{"Name": driver}
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/secrets/create", nil, req, nil); err != nil {
+		return fmt.Errorf("create secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// ConfigCreate creates a swarm config. templateDriver may be empty.
+func (c *EngineClient) ConfigCreate(ctx context.Context, name string, labels map[string]string, templateDriver string, data []byte) error {
+	req := map[string]interface{}{
+		"Name":   name,
+		"Labels": labels,
+		"Data":   base64.StdEncoding.EncodeToString(data),
+	}
+	if templateDriver != "" {
+		req["Templating"] = map[string]string{"Name": templateDriver}
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/configs/create", nil, req, nil); err != nil {
+		return fmt.Errorf("create config %s: %w", name, err)
+	}
+	return nil
+}
+
+// SecretRemove removes a swarm secret.
+func (c *EngineClient) SecretRemove(ctx context.Context, idOrName string) error {
+	if err := c.doJSON(ctx, http.MethodDelete, "/secrets/"+url.PathEscape(idOrName), nil, nil, nil); err != nil {
+		return fmt.Errorf("remove secret %s: %w", idOrName, notFound(err, ErrSecretNotFound))
+	}
+	return nil
+}
+
+// ConfigRemove removes a swarm config.
+func (c *EngineClient) ConfigRemove(ctx context.Context, idOrName string) error {
+	if err := c.doJSON(ctx, http.MethodDelete, "/configs/"+url.PathEscape(idOrName), nil, nil, nil); err != nil {
+		return fmt.Errorf("remove config %s: %w", idOrName, notFound(err, ErrConfigNotFound))
+	}
+	return nil
+}
+
+// SwarmServiceRefs lists the secrets and configs a swarm service uses, by
+// both ID and name.
+type SwarmServiceRefs struct {
+	ID      string
+	Name    string
+	Secrets []string
+	Configs []string
+}
+
+// ServiceRefs returns the secret and config references of all swarm services.
+func (c *EngineClient) ServiceRefs(ctx context.Context) ([]SwarmServiceRefs, error) {
+	var services []struct {
+		ID   string `json:"ID"`
+		Spec struct {
+			Name         string `json:"Name"`
+			TaskTemplate struct {
+				ContainerSpec struct {
+					Secrets []struct {
+						SecretID   string `json:"SecretID"`
+						SecretName string `json:"SecretName"`
+					} `json:"Secrets"`
+					Configs []struct {
+						ConfigID   string `json:"ConfigID"`
+						ConfigName string `json:"ConfigName"`
+					} `json:"Configs"`
+				} `json:"ContainerSpec"`
+			} `json:"TaskTemplate"`
+		} `json:"Spec"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/services", nil, nil, &services); err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+	refs := make([]SwarmServiceRefs, 0, len(services))
+	for _, s := range services {
+		ref := SwarmServiceRefs{ID: s.ID, Name: s.Spec.Name}
+		for _, secret := range s.Spec.TaskTemplate.ContainerSpec.Secrets {
+			ref.Secrets = append(ref.Secrets, secret.SecretID, secret.SecretName)
+		}
+		for _, config := range s.Spec.TaskTemplate.ContainerSpec.Configs {
+			ref.Configs = append(ref.Configs, config.ConfigID, config.ConfigName)
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// engineUnavailable reports whether a subsystem should fall back to the
+// docker CLI after an Engine API call failed.
+func engineUnavailable(err error) bool {
+	return errors.Is(err, ErrDockerNotAvailable)
+}
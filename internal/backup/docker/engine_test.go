@@ -0,0 +1,447 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// fakeEngine serves handler on a Unix socket and returns a client for it.
+// The ping endpoint reports apiVersion.
+func fakeEngine(t *testing.T, apiVersion string, header http.Header, handler http.Handler) *EngineClient {
+	t.Helper()
+	// Socket paths are limited to ~100 bytes, too short for some t.TempDir paths.
+	dir, err := os.MkdirTemp("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_ping", func(w http.ResponseWriter, _ *http.Request) {
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Api-Version", apiVersion)
+		w.Write([]byte("OK"))
+	})
+	mux.Handle("/", handler)
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	client, err := NewEngineClient(EngineConfig{Host: "unix://" + socket}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// deadEngine returns a client for a socket nothing listens on.
+func deadEngine(t *testing.T) *EngineClient {
+	t.Helper()
+	client, err := NewEngineClient(EngineConfig{Host: "unix://" + filepath.Join(t.TempDir(), "missing.sock")}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestNewEngineClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     EngineConfig
+		wantURL string
+		wantErr bool
+	}{
+		{name: "unix socket", cfg: EngineConfig{Host: "unix:///var/run/docker.sock"}, wantURL: "http://docker"},
+		{name: "plain tcp", cfg: EngineConfig{Host: "tcp://10.0.0.5:2375"}, wantURL: "http://10.0.0.5:2375"},
+		{name: "missing certs", cfg: EngineConfig{Host: "tcp://10.0.0.5:2376", TLSVerify: true, CertPath: "/nonexistent"}, wantErr: true},
+		{name: "ssh unsupported", cfg: EngineConfig{Host: "ssh://user@host"}, wantErr: true},
+		{name: "empty host", cfg: EngineConfig{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewEngineClient(tt.cfg, zerolog.Nop())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewEngineClient() error = %v", err)
+			}
+			if client.baseURL != tt.wantURL {
+				t.Errorf("baseURL = %q, want %q", client.baseURL, tt.wantURL)
+			}
+		})
+	}
+}
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{"1.45", "1.41"},
+		{"1.41", "1.41"},
+		{"1.40", "1.40"},
+		{"1.9", "1.9"},
+		{"", "1.41"},
+	}
+	for _, tt := range tests {
+		if got := negotiateAPIVersion(tt.server); got != tt.want {
+			t.Errorf("negotiateAPIVersion(%q) = %q, want %q", tt.server, got, tt.want)
+		}
+	}
+}
+
+func TestEngineClient_VersionNegotiation(t *testing.T) {
+	var gotPath string
+	client := fakeEngine(t, "1.40", http.Header{"Libpod-Api-Version": {"4.9.3"}}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		writeJSON(w, map[string]interface{}{"Volumes": []interface{}{}})
+	}))
+
+	if _, err := client.VolumeList(context.Background()); err != nil {
+		t.Fatalf("VolumeList() error = %v", err)
+	}
+	if gotPath != "/v1.40/volumes" {
+		t.Errorf("path = %q, want /v1.40/volumes", gotPath)
+	}
+	if !client.IsPodman() {
+		t.Error("expected Podman to be detected")
+	}
+}
+
+func TestEngineClient_ListContainers(t *testing.T) {
+	client := fakeEngine(t, "1.43", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1.41/containers/json" || r.URL.Query().Get("all") != "1" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, []map[string]interface{}{{
+			"Id":      "abc123",
+			"Names":   []string{"/postgres"},
+			"Image":   "postgres:16",
+			"Created": 1700000000,
+			"State":   "running",
+			"Status":  "Up 2 hours",
+			"Labels":  map[string]string{"keldris.backup": "true"},
+			"Mounts":  []map[string]interface{}{{"Type": "volume", "Name": "pgdata", "Source": "/var/lib/docker/volumes/pgdata/_data", "Destination": "/var/lib/postgresql/data", "RW": true}},
+		}})
+	}))
+
+	containers, err := client.ListContainers(context.Background())
+	if err != nil {
+		t.Fatalf("ListContainers() error = %v", err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("got %d containers, want 1", len(containers))
+	}
+	c := containers[0]
+	if c.ID != "abc123" || c.Name != "postgres" || c.Status != "running" || c.Labels["keldris.backup"] != "true" {
+		t.Errorf("container = %+v", c)
+	}
+	if c.CreatedAt.Unix() != 1700000000 {
+		t.Errorf("CreatedAt = %v", c.CreatedAt)
+	}
+	if len(c.Mounts) != 1 || c.Mounts[0].Destination != "/var/lib/postgresql/data" || c.Mounts[0].ReadOnly {
+		t.Errorf("mounts = %+v", c.Mounts)
+	}
+}
+
+func TestEngineClient_NotFound(t *testing.T) {
+	client := fakeEngine(t, "1.41", nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]string{"message": "No such container: web"})
+	}))
+
+	_, err := client.InspectContainer(context.Background(), "web")
+	if !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("InspectContainer() error = %v, want ErrContainerNotFound", err)
+	}
+	if _, err := client.NetworkInspectRaw(context.Background(), "backend"); !errors.Is(err, ErrNetworkNotFound) {
+		t.Errorf("NetworkInspectRaw() error = %v, want ErrNetworkNotFound", err)
+	}
+}
+
+func TestEngineClient_Unavailable(t *testing.T) {
+	client := deadEngine(t)
+	if err := client.Ping(context.Background()); !errors.Is(err, ErrDockerNotAvailable) {
+		t.Errorf("Ping() error = %v, want ErrDockerNotAvailable", err)
+	}
+	if _, err := client.ListContainers(context.Background()); !errors.Is(err, ErrDockerNotAvailable) {
+		t.Errorf("ListContainers() error = %v, want ErrDockerNotAvailable", err)
+	}
+}
+
+// frame encodes a multiplexed stream frame.
+func frame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func TestEngineClient_Exec(t *testing.T) {
+	var created map[string]interface{}
+	client := fakeEngine(t, "1.41", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.41/containers/db/exec":
+			json.NewDecoder(r.Body).Decode(&created)
+			writeJSON(w, map[string]string{"Id": "exec1"})
+		case "/v1.41/exec/exec1/start":
+			w.Header().Set("Content-Type", "application/vnd.docker.multiplexed-stream")
+			w.Write(frame(1, "dumped "))
+			w.Write(frame(2, "warning\n"))
+			w.Write(frame(1, "42 rows\n"))
+		case "/v1.41/exec/exec1/json":
+			writeJSON(w, map[string]interface{}{"Running": false, "ExitCode": 3})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	result, err := client.ContainerExec(context.Background(), "db", []string{"pg_dump", "app"}, ExecOptions{User: "postgres"})
+	if err != nil {
+		t.Fatalf("ContainerExec() error = %v", err)
+	}
+	if result.Stdout != "dumped 42 rows\n" || result.Stderr != "warning\n" || result.ExitCode != 3 {
+		t.Errorf("result = %+v", result)
+	}
+	if created["User"] != "postgres" {
+		t.Errorf("exec create request = %v", created)
+	}
+
+	if _, err := client.ExecCommand(context.Background(), "db", []string{"false"}); err == nil || !strings.Contains(err.Error(), "code 3") {
+		t.Errorf("ExecCommand() error = %v, want exit code error", err)
+	}
+}
+
+func TestDemuxStream(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(frame(1, "out"))
+	stream.Write(frame(3, "oci runtime error"))
+
+	var stdout, stderr bytes.Buffer
+	err := demuxStream(&stream, &stdout, &stderr)
+	if err == nil || !strings.Contains(err.Error(), "oci runtime error") {
+		t.Errorf("demuxStream() error = %v", err)
+	}
+	if stdout.String() != "out" {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+}
+
+func TestDockerCLI_EngineFallback(t *testing.T) {
+	cliOutput := `{"ID":"cli1","Names":"from-cli","Image":"nginx","State":"running","Status":"Up","Labels":"","CreatedAt":"2024-01-15 10:30:00 +0000 UTC"}`
+
+	t.Run("uses engine API", func(t *testing.T) {
+		client := NewDockerClientWithBinary(fakeDockerBinary(t, "", 1), zerolog.Nop())
+		client.SetEngineClient(fakeEngine(t, "1.41", nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			writeJSON(w, []map[string]interface{}{{"Id": "api1", "Names": []string{"/from-api"}, "State": "running"}})
+		})))
+
+		containers, err := client.ListContainers(context.Background())
+		if err != nil {
+			t.Fatalf("ListContainers() error = %v", err)
+		}
+		if len(containers) != 1 || containers[0].Name != "from-api" {
+			t.Errorf("containers = %+v", containers)
+		}
+	})
+
+	t.Run("falls back to CLI when socket is unreachable", func(t *testing.T) {
+		client := NewDockerClientWithBinary(fakeDockerBinary(t, cliOutput, 0), zerolog.Nop())
+		client.SetEngineClient(deadEngine(t))
+
+		containers, err := client.ListContainers(context.Background())
+		if err != nil {
+			t.Fatalf("ListContainers() error = %v", err)
+		}
+		if len(containers) != 1 || containers[0].Name != "from-cli" {
+			t.Errorf("containers = %+v", containers)
+		}
+	})
+
+	t.Run("does not fall back on API errors", func(t *testing.T) {
+		client := NewDockerClientWithBinary(fakeDockerBinary(t, `{"Id":"cli"}`, 0), zerolog.Nop())
+		client.SetEngineClient(fakeEngine(t, "1.41", nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]string{"message": "No such container: gone"})
+		})))
+
+		if _, err := client.InspectContainer(context.Background(), "gone"); !errors.Is(err, ErrContainerNotFound) {
+			t.Errorf("InspectContainer() error = %v, want ErrContainerNotFound", err)
+		}
+	})
+}
+
+func TestComposeBackup_VolumeEngine(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	tw.WriteHeader(&tar.Header{Name: "./data.txt", Mode: 0644, Size: 5, Typeflag: tar.TypeReg})
+	tw.Write([]byte("hello"))
+	tw.Close()
+
+	var created []map[string]interface{}
+	var pulled, removed []string
+	var extracted []byte
+	haveImage := false
+	cb := NewComposeBackup(zerolog.Nop())
+	cb.SetEngineClient(fakeEngine(t, "1.41", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1.41/containers/create":
+			if !haveImage {
+				w.WriteHeader(http.StatusNotFound)
+				writeJSON(w, map[string]string{"message": "No such image: alpine:latest"})
+				return
+			}
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			created = append(created, body)
+			writeJSON(w, map[string]string{"Id": "helper1"})
+		case r.URL.Path == "/v1.41/images/create":
+			pulled = append(pulled, r.URL.Query().Get("fromImage"))
+			haveImage = true
+			writeJSON(w, map[string]string{"status": "Downloaded newer image for alpine:latest"})
+		case r.URL.Path == "/v1.41/containers/helper1/archive" && r.Method == http.MethodGet:
+			if r.URL.Query().Get("path") != "/source/." {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(archive.Bytes())
+		case r.URL.Path == "/v1.41/containers/helper1/archive" && r.Method == http.MethodPut:
+			if r.URL.Query().Get("path") != "/target" {
+				http.NotFound(w, r)
+				return
+			}
+			extracted, _ = io.ReadAll(r.Body)
+		case r.URL.Path == "/v1.41/containers/helper1" && r.Method == http.MethodDelete:
+			removed = append(removed, "helper1")
+		default:
+			http.NotFound(w, r)
+		}
+	})))
+
+	backupPath := filepath.Join(t.TempDir(), "shop_db.tar.gz")
+	if err := cb.backupVolume(context.Background(), "shop_db", backupPath); err != nil {
+		t.Fatalf("backupVolume() error = %v", err)
+	}
+	if len(pulled) != 1 || pulled[0] != "alpine:latest" {
+		t.Errorf("pulled = %v, want the helper image once", pulled)
+	}
+	binds := created[0]["HostConfig"].(map[string]interface{})["Binds"].([]interface{})
+	if len(binds) != 1 || binds[0] != "shop_db:/source:ro" {
+		t.Errorf("binds = %v", binds)
+	}
+
+	f, err := os.Open(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("backup is not gzip compressed: %v", err)
+	}
+	hdr, err := tar.NewReader(gz).Next()
+	if err != nil || hdr.Name != "./data.txt" {
+		t.Errorf("first entry = %v, %v", hdr, err)
+	}
+
+	if err := cb.restoreVolume(context.Background(), "shop_db", backupPath); err != nil {
+		t.Fatalf("restoreVolume() error = %v", err)
+	}
+	compressed, _ := os.ReadFile(backupPath)
+	if !bytes.Equal(extracted, compressed) {
+		t.Errorf("extracted %d bytes, want the %d byte backup", len(extracted), len(compressed))
+	}
+	if len(removed) != 2 {
+		t.Errorf("removed %d helper containers, want 2", len(removed))
+	}
+}
+
+func TestImageRestoreService_Engine(t *testing.T) {
+	var created map[string]interface{}
+	var connected, pulled []string
+	s := NewImageRestoreService(nil, zerolog.Nop())
+	s.SetEngineClient(fakeEngine(t, "1.41", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.41/containers/web/json":
+			writeJSON(w, map[string]interface{}{"Id": "c1", "State": map[string]bool{"Running": true}})
+		case "/v1.41/containers/create":
+			json.NewDecoder(r.Body).Decode(&created)
+			writeJSON(w, map[string]string{"Id": "c2"})
+		case "/v1.41/networks/backend/connect":
+			connected = append(connected, "backend")
+		case "/v1.41/images/create":
+			pulled = append(pulled, r.URL.Query().Get("fromImage")+":"+r.URL.Query().Get("tag"))
+			writeJSON(w, map[string]string{"status": "Status: Image is up to date"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]string{"message": "No such container"})
+		}
+	})))
+	ctx := context.Background()
+
+	if exists, running, err := s.checkContainerStatus(ctx, "web"); err != nil || !exists || !running {
+		t.Errorf("checkContainerStatus(web) = %v, %v, %v", exists, running, err)
+	}
+	if exists, _, err := s.checkContainerStatus(ctx, "gone"); err != nil || exists {
+		t.Errorf("checkContainerStatus(gone) = %v, %v", exists, err)
+	}
+
+	err := s.createContainerFromInfo(ctx, ImageRestoreContainerInfo{
+		Name:     "api",
+		Image:    "shop/api:1.2",
+		Ports:    []string{"8080:80/tcp"},
+		Volumes:  []string{"shop_data:/data"},
+		Networks: []string{"frontend", "backend"},
+		Labels:   map[string]string{"app": "shop"},
+	})
+	if err != nil {
+		t.Fatalf("createContainerFromInfo() error = %v", err)
+	}
+	hostConfig := created["HostConfig"].(map[string]interface{})
+	bindings := hostConfig["PortBindings"].(map[string]interface{})["80/tcp"].([]interface{})
+	if created["Image"] != "shop/api:1.2" || hostConfig["NetworkMode"] != "frontend" ||
+		bindings[0].(map[string]interface{})["HostPort"] != "8080" || hostConfig["Binds"].([]interface{})[0] != "shop_data:/data" {
+		t.Errorf("create request = %v", created)
+	}
+	if len(connected) != 1 {
+		t.Errorf("connected networks = %v, want backend", connected)
+	}
+
+	if err := s.pullImage(ctx, "nginx"); err != nil {
+		t.Fatalf("pullImage() error = %v", err)
+	}
+	if len(pulled) != 1 || pulled[0] != "nginx:latest" {
+		t.Errorf("pulled = %v, want nginx with the latest tag", pulled)
+	}
+}
@@ -0,0 +1,386 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// holdLabel marks the placeholder containers an EventWatcher creates to keep
+// a removed container's volumes in use. Its value is the owner container ID.
+const holdLabel = "keldris.hold"
+
+// EventHandler receives the container changes seen by an EventWatcher.
+type EventHandler interface {
+	// ContainersChanged is called with every container on the host after a
+	// container carrying backup labels was created, started, renamed or
+	// removed, so that label changes reach the server within seconds.
+	ContainersChanged(ctx context.Context, containers []ContainerInfo) error
+
+	// ContainerRemoved is called when a container labelled
+	// keldris.backup.on-remove=true has been removed. Its volumes are held
+	// until the call returns.
+	ContainerRemoved(ctx context.Context, container ContainerInfo) error
+}
+
+// EventWatcherConfig holds configuration for the event watcher.
+type EventWatcherConfig struct {
+	// Debounce is how long to wait after a change before reporting, so that
+	// a burst of events such as docker compose up is reported once.
+	Debounce time.Duration
+
+	// ReconnectDelay is the initial delay before resubscribing after the
+	// event stream breaks. It doubles up to MaxReconnectDelay.
+	ReconnectDelay time.Duration
+
+	// MaxReconnectDelay caps the reconnect backoff.
+	MaxReconnectDelay time.Duration
+
+	// FinalBackupTimeout bounds the final backup of a removed container.
+	FinalBackupTimeout time.Duration
+}
+
+// DefaultEventWatcherConfig returns an EventWatcherConfig with sensible defaults.
+func DefaultEventWatcherConfig() EventWatcherConfig {
+	return EventWatcherConfig{
+		Debounce:           2 * time.Second,
+		ReconnectDelay:     time.Second,
+		MaxReconnectDelay:  time.Minute,
+		FinalBackupTimeout: 6 * time.Hour,
+	}
+}
+
+// EventWatcher subscribes to the Docker events stream and reports containers
+// with keldris.backup labels as they appear, change or disappear, instead of
+// waiting for the next discovery run.
+//
+// Containers labelled keldris.backup.on-remove=true get a final backup when
+// they are removed. Docker has no hook that runs before removal, so when such
+// a container stops the watcher creates a placeholder container that mounts
+// the same volumes. Docker refuses to delete volumes that are still in use,
+// so docker volume rm and docker compose down -v leave them in place until
+// the final backup has finished and the placeholder is removed. The hold is
+// best effort: anonymous volumes removed together with the container by
+// docker rm -v are gone before the stop event arrives.
+type EventWatcher struct {
+	engine  *EngineClient
+	handler EventHandler
+	parser  *LabelParser
+	config  EventWatcherConfig
+	logger  zerolog.Logger
+
+	mu         sync.Mutex
+	containers map[string]ContainerInfo // labelled containers by ID
+	holds      map[string]string        // owner container ID -> placeholder ID
+	lastEvent  time.Time
+	reportCh   chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewEventWatcher creates a new EventWatcher.
+func NewEventWatcher(engine *EngineClient, handler EventHandler, config EventWatcherConfig, logger zerolog.Logger) *EventWatcher {
+	return &EventWatcher{
+		engine:     engine,
+		handler:    handler,
+		parser:     NewLabelParser(),
+		config:     config,
+		logger:     logger.With().Str("component", "docker_events").Logger(),
+		containers: make(map[string]ContainerInfo),
+		holds:      make(map[string]string),
+		reportCh:   make(chan struct{}, 1),
+	}
+}
+
+// Run watches events until ctx is cancelled, resubscribing with backoff when
+// the stream breaks. Events missed while disconnected are replayed from the
+// daemon's buffer. Run waits for running final backups before returning.
+func (w *EventWatcher) Run(ctx context.Context) {
+	defer w.wg.Wait()
+
+	w.wg.Add(1)
+	go w.reportLoop(ctx)
+
+	delay := w.config.ReconnectDelay
+	for {
+		if err := w.resync(ctx); err != nil {
+			w.logger.Warn().Err(err).Msg("failed to list containers")
+		} else {
+			w.requestReport()
+		}
+
+		w.mu.Lock()
+		since := w.lastEvent
+		w.mu.Unlock()
+		if since.IsZero() {
+			since = time.Now()
+		}
+
+		connected := time.Now()
+		err := w.engine.Events(ctx, since, map[string][]string{"type": {"container"}}, w.handleEvent)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(connected) > w.config.MaxReconnectDelay {
+			delay = w.config.ReconnectDelay
+		}
+		w.logger.Warn().Err(err).Dur("retry_in", delay).Msg("docker event stream interrupted")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, w.config.MaxReconnectDelay)
+	}
+}
+
+// resync rebuilds the container cache from a full listing and adopts or
+// clears placeholders left behind by a previous run.
+func (w *EventWatcher) resync(ctx context.Context) error {
+	containers, err := w.engine.ListContainers(ctx)
+	if err != nil {
+		return err
+	}
+
+	labelled := make(map[string]ContainerInfo)
+	var holds []ContainerInfo
+	for _, c := range containers {
+		if _, ok := c.Labels[holdLabel]; ok {
+			holds = append(holds, c)
+			continue
+		}
+		if w.parser.HasBackupLabel(c.Labels) {
+			labelled[c.ID] = c
+		}
+	}
+
+	w.mu.Lock()
+	// Keep containers that vanished while the stream was down if they need a
+	// final backup; their replayed destroy event removes them.
+	for id, c := range w.containers {
+		if _, ok := labelled[id]; !ok && w.parser.BackupOnRemove(c.Labels) {
+			labelled[id] = c
+		}
+	}
+	w.containers = labelled
+	var stale []string
+	for _, h := range holds {
+		owner := h.Labels[holdLabel]
+		if c, ok := labelled[owner]; ok && c.Status != "running" {
+			w.holds[owner] = h.ID
+		} else if _, tracked := w.holds[owner]; !tracked {
+			stale = append(stale, h.ID)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, id := range stale {
+		if err := w.engine.ContainerRemove(ctx, id, true); err != nil {
+			w.logger.Warn().Err(err).Str("hold_id", id).Msg("failed to remove stale volume hold")
+		}
+	}
+	return nil
+}
+
+// handleEvent updates the cache for one container event.
+func (w *EventWatcher) handleEvent(event EngineEvent) {
+	if event.Type != "container" {
+		return
+	}
+	id := event.Actor.ID
+	if _, ok := event.Actor.Attributes[holdLabel]; ok {
+		return
+	}
+
+	w.mu.Lock()
+	if t := event.Time(); t.After(w.lastEvent) {
+		w.lastEvent = t
+	}
+	cached, known := w.containers[id]
+	w.mu.Unlock()
+
+	// Container events carry the container's labels as attributes.
+	labelled := known || w.parser.HasBackupLabel(event.Actor.Attributes)
+	if !labelled {
+		return
+	}
+
+	// Handlers run on the event stream goroutine; use a bounded context
+	// that is independent of the stream.
+	ctx, cancel := context.WithTimeout(context.Background(), engineRequestTimeout)
+	defer cancel()
+
+	action, _, _ := strings.Cut(event.Action, ":")
+	switch action {
+	case "create", "start", "rename", "update":
+		info, err := w.engine.InspectContainer(ctx, id)
+		if err != nil {
+			w.logger.Debug().Err(err).Str("container_id", id).Msg("failed to inspect container")
+			return
+		}
+		w.mu.Lock()
+		if w.parser.HasBackupLabel(info.Labels) {
+			w.containers[id] = *info
+		} else {
+			delete(w.containers, id)
+		}
+		w.mu.Unlock()
+		if action == "start" {
+			w.releaseHold(ctx, id)
+		}
+		w.requestReport()
+
+	case "die":
+		if known && w.parser.BackupOnRemove(cached.Labels) {
+			w.placeHold(ctx, cached)
+		}
+
+	case "destroy", "remove":
+		w.mu.Lock()
+		delete(w.containers, id)
+		w.mu.Unlock()
+		w.requestReport()
+
+		if known && w.parser.BackupOnRemove(cached.Labels) {
+			w.wg.Add(1)
+			go w.finalBackup(cached)
+		}
+	}
+}
+
+// placeHold creates a stopped placeholder container that mounts the named
+// volumes of c at the same paths, which also keeps the image from creating
+// fresh anonymous volumes for them.
+func (w *EventWatcher) placeHold(ctx context.Context, c ContainerInfo) {
+	w.mu.Lock()
+	_, held := w.holds[c.ID]
+	w.mu.Unlock()
+	if held {
+		return
+	}
+
+	var binds []string
+	for _, m := range c.Mounts {
+		if m.Type == "volume" && m.Name != "" {
+			binds = append(binds, m.Name+":"+m.Destination)
+		}
+	}
+	if len(binds) == 0 {
+		return
+	}
+
+	holdID, err := w.engine.ContainerCreate(ctx, "keldris-hold-"+shortContainerID(c.ID), map[string]interface{}{
+		"Image":      c.Image,
+		"Labels":     map[string]string{holdLabel: c.ID},
+		"HostConfig": map[string]interface{}{"Binds": binds},
+	})
+	if err != nil {
+		w.logger.Warn().Err(err).Str("container", c.Name).Msg("failed to hold volumes for final backup")
+		return
+	}
+
+	w.mu.Lock()
+	w.holds[c.ID] = holdID
+	w.mu.Unlock()
+	w.logger.Debug().Str("container", c.Name).Strs("volumes", binds).Msg("holding volumes until container is restarted or backed up")
+}
+
+// releaseHold removes the placeholder for a container, if any.
+func (w *EventWatcher) releaseHold(ctx context.Context, containerID string) {
+	w.mu.Lock()
+	holdID, ok := w.holds[containerID]
+	delete(w.holds, containerID)
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+	if err := w.engine.ContainerRemove(ctx, holdID, true); err != nil && !errors.Is(err, ErrContainerNotFound) {
+		w.logger.Warn().Err(err).Str("hold_id", holdID).Msg("failed to release volume hold")
+	}
+}
+
+// finalBackup runs the handler's final backup of a removed container and
+// then releases its volumes.
+func (w *EventWatcher) finalBackup(c ContainerInfo) {
+	defer w.wg.Done()
+
+	logger := w.logger.With().Str("container_id", c.ID).Str("container", c.Name).Logger()
+	logger.Info().Msg("container removed, running final backup")
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.config.FinalBackupTimeout)
+	defer cancel()
+
+	if err := w.handler.ContainerRemoved(ctx, c); err != nil {
+		logger.Error().Err(err).Msg("final backup failed")
+	} else {
+		logger.Info().Msg("final backup completed")
+	}
+	w.releaseHold(ctx, c.ID)
+}
+
+// requestReport schedules a report without blocking.
+func (w *EventWatcher) requestReport() {
+	select {
+	case w.reportCh <- struct{}{}:
+	default:
+	}
+}
+
+// reportLoop sends the current container list to the handler once changes
+// have settled for the debounce period.
+func (w *EventWatcher) reportLoop(ctx context.Context) {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.reportCh:
+		}
+
+		// Coalesce further changes that arrive during the debounce period.
+		timer := time.NewTimer(w.config.Debounce)
+	settle:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-w.reportCh:
+				timer.Reset(w.config.Debounce)
+			case <-timer.C:
+				break settle
+			}
+		}
+
+		if err := w.report(ctx); err != nil {
+			w.logger.Warn().Err(err).Msg("failed to report containers")
+		}
+	}
+}
+
+// report lists all containers, without placeholders, and passes them to the handler.
+func (w *EventWatcher) report(ctx context.Context) error {
+	containers, err := w.engine.ListContainers(ctx)
+	if err != nil {
+		return err
+	}
+	filtered := containers[:0]
+	for _, c := range containers {
+		if _, ok := c.Labels[holdLabel]; !ok {
+			filtered = append(filtered, c)
+		}
+	}
+	return w.handler.ContainersChanged(ctx, filtered)
+}
+
+// shortContainerID returns the 12-character form of a container ID.
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,221 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type recordingEventHandler struct {
+	mu      sync.Mutex
+	reports [][]ContainerInfo
+	removed []ContainerInfo
+	changed chan struct{}
+}
+
+func newRecordingEventHandler() *recordingEventHandler {
+	return &recordingEventHandler{changed: make(chan struct{}, 16)}
+}
+
+func (h *recordingEventHandler) ContainersChanged(_ context.Context, containers []ContainerInfo) error {
+	h.mu.Lock()
+	h.reports = append(h.reports, containers)
+	h.mu.Unlock()
+	h.changed <- struct{}{}
+	return nil
+}
+
+func (h *recordingEventHandler) ContainerRemoved(_ context.Context, container ContainerInfo) error {
+	h.mu.Lock()
+	h.removed = append(h.removed, container)
+	h.mu.Unlock()
+	h.changed <- struct{}{}
+	return nil
+}
+
+func (h *recordingEventHandler) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-h.changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for handler")
+	}
+}
+
+// fakeEventDaemon is a minimal daemon with a controllable event stream.
+type fakeEventDaemon struct {
+	mu         sync.Mutex
+	containers []map[string]interface{}
+	holds      []map[string]interface{}
+	removed    []string
+	events     chan EngineEvent
+}
+
+func (d *fakeEventDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1.41")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case path == "/events":
+		d.mu.Unlock()
+		defer d.mu.Lock()
+		w.Header().Set("Content-Type", "application/json")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-d.events:
+				json.NewEncoder(w).Encode(event)
+				w.(http.Flusher).Flush()
+			}
+		}
+	case path == "/containers/json":
+		writeJSON(w, d.containers)
+	case path == "/containers/create":
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		d.holds = append(d.holds, body)
+		writeJSON(w, map[string]string{"Id": "hold1"})
+	case r.Method == http.MethodDelete:
+		d.removed = append(d.removed, strings.TrimPrefix(path, "/containers/"))
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasSuffix(path, "/json"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json")
+		for _, c := range d.containers {
+			if c["Id"] == id {
+				writeJSON(w, map[string]interface{}{
+					"Id":     id,
+					"Name":   c["Names"].([]string)[0],
+					"Config": map[string]interface{}{"Image": c["Image"], "Labels": c["Labels"]},
+					"State":  map[string]interface{}{"Status": c["State"]},
+					"Mounts": c["Mounts"],
+				})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]string{"message": "No such container: " + id})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func containerEvent(action, id string, attributes map[string]string) EngineEvent {
+	event := EngineEvent{Type: "container", Action: action, TimeNano: time.Now().UnixNano()}
+	event.Actor.ID = id
+	event.Actor.Attributes = attributes
+	return event
+}
+
+func TestEventWatcher(t *testing.T) {
+	dbLabels := map[string]string{"keldris.backup": "true", "keldris.backup.on-remove": "true"}
+	daemon := &fakeEventDaemon{
+		events: make(chan EngineEvent),
+		containers: []map[string]interface{}{
+			{
+				"Id": "db1", "Names": []string{"/db"}, "Image": "postgres:16", "State": "running", "Labels": dbLabels,
+				"Mounts": []map[string]interface{}{{"Type": "volume", "Name": "pgdata", "Source": "/var/lib/docker/volumes/pgdata/_data", "Destination": "/var/lib/postgresql/data", "RW": true}},
+			},
+			{"Id": "other", "Names": []string{"/other"}, "Image": "busybox", "State": "running"},
+		},
+	}
+	engine := fakeEngine(t, "1.41", nil, daemon)
+	handler := newRecordingEventHandler()
+
+	cfg := DefaultEventWatcherConfig()
+	cfg.Debounce = 10 * time.Millisecond
+	watcher := NewEventWatcher(engine, handler, cfg, zerolog.Nop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watcher.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// Initial report after subscribing
+	handler.wait(t)
+
+	// A new labelled container is reported
+	daemon.mu.Lock()
+	daemon.containers = append(daemon.containers, map[string]interface{}{
+		"Id": "web1", "Names": []string{"/web"}, "Image": "nginx", "State": "created",
+		"Labels": map[string]string{"keldris.backup": "true"},
+	})
+	daemon.mu.Unlock()
+	daemon.events <- containerEvent("create", "web1", map[string]string{"keldris.backup": "true", "name": "web"})
+	handler.wait(t)
+
+	handler.mu.Lock()
+	last := handler.reports[len(handler.reports)-1]
+	handler.mu.Unlock()
+	if len(last) != 3 {
+		t.Errorf("report has %d containers, want 3", len(last))
+	}
+
+	// Unlabelled containers do not trigger reports
+	daemon.events <- containerEvent("start", "other", map[string]string{"name": "other"})
+
+	// Stopping the on-remove container holds its volumes
+	daemon.events <- containerEvent("die", "db1", dbLabels)
+	// Removing it runs the final backup, then releases the hold
+	daemon.mu.Lock()
+	daemon.containers = daemon.containers[1:]
+	daemon.mu.Unlock()
+	daemon.events <- containerEvent("destroy", "db1", dbLabels)
+
+	deadline := time.After(5 * time.Second)
+	for {
+		handler.mu.Lock()
+		removed := len(handler.removed)
+		handler.mu.Unlock()
+		daemon.mu.Lock()
+		released := len(daemon.removed)
+		daemon.mu.Unlock()
+		if removed == 1 && released == 1 {
+			break
+		}
+		select {
+		case <-handler.changed:
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("removed = %d, released = %d", removed, released)
+		}
+	}
+
+	handler.mu.Lock()
+	removed := handler.removed[0]
+	handler.mu.Unlock()
+	if removed.Name != "db" || len(removed.Mounts) != 1 || removed.Mounts[0].Name != "pgdata" {
+		t.Errorf("removed container = %+v", removed)
+	}
+
+	daemon.mu.Lock()
+	defer daemon.mu.Unlock()
+	if len(daemon.holds) != 1 {
+		t.Fatalf("created %d holds, want 1", len(daemon.holds))
+	}
+	hold := daemon.holds[0]
+	binds := hold["HostConfig"].(map[string]interface{})["Binds"].([]interface{})
+	if len(binds) != 1 || binds[0] != "pgdata:/var/lib/postgresql/data" {
+		t.Errorf("hold binds = %v", binds)
+	}
+	if hold["Labels"].(map[string]interface{})[holdLabel] != "db1" {
+		t.Errorf("hold labels = %v", hold["Labels"])
+	}
+	if daemon.removed[0] != "hold1" {
+		t.Errorf("removed containers = %v, want hold1", daemon.removed)
+	}
+}
@@ -24,18 +24,20 @@ var (
 // HookExecutor handles execution of backup hooks inside Docker containers.
 type HookExecutor struct {
 	dockerBinary string
+	engine       *EngineClient
 	logger       zerolog.Logger
 }
 
-// NewHookExecutor creates a new HookExecutor.
+// NewHookExecutor creates a new HookExecutor that uses the shared Engine API client.
 func NewHookExecutor(logger zerolog.Logger) *HookExecutor {
 	return &HookExecutor{
 		dockerBinary: "docker",
+		engine:       DefaultEngineClient(logger),
 		logger:       logger.With().Str("component", "docker_hooks").Logger(),
 	}
 }
 
-// NewHookExecutorWithBinary creates a new HookExecutor with a custom docker binary path.
+// NewHookExecutorWithBinary creates a new HookExecutor that only uses the given docker binary.
 func NewHookExecutorWithBinary(binary string, logger zerolog.Logger) *HookExecutor {
 	return &HookExecutor{
 		dockerBinary: binary,
@@ -43,6 +45,11 @@ func NewHookExecutorWithBinary(binary string, logger zerolog.Logger) *HookExecut
 	}
 }
 
+// SetEngineClient sets the Engine API client. With nil, only the CLI is used.
+func (e *HookExecutor) SetEngineClient(engine *EngineClient) {
+	e.engine = engine
+}
+
 // ExecuteHook runs a hook command inside the specified container.
 func (e *HookExecutor) ExecuteHook(ctx context.Context, hook *models.ContainerBackupHook, backupID uuid.UUID) (*models.ContainerHookExecution, error) {
 	e.logger.Info().
@@ -72,31 +79,17 @@ func (e *HookExecutor) ExecuteHook(ctx context.Context, hook *models.ContainerBa
 	hookCtx, cancel := context.WithTimeout(ctx, time.Duration(hook.TimeoutSeconds)*time.Second)
 	defer cancel()
 
-	// Build docker exec command
-	args := e.buildExecArgs(hook, command)
-
-	e.logger.Debug().
-		Strs("args", args).
-		Msg("running docker exec")
-
-	// Execute the command
-	cmd := exec.CommandContext(hookCtx, e.dockerBinary, args...)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
+	stdout, stderr, exitCode, err := e.run(hookCtx, hook, command)
 	execution.CompletedAt = time.Now()
 	execution.Duration = execution.CompletedAt.Sub(execution.StartedAt)
 
 	// Combine stdout and stderr for output
-	output := stdout.String()
-	if stderr.Len() > 0 {
+	output := stdout
+	if stderr != "" {
 		if output != "" {
 			output += "\n"
 		}
-		output += stderr.String()
+		output += stderr
 	}
 
 	// Truncate output if too long (max 64KB)
@@ -119,16 +112,11 @@ func (e *HookExecutor) ExecuteHook(ctx context.Context, hook *models.ContainerBa
 			return execution, ErrHookTimeout
 		}
 
-		// Get exit code if available
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			execution.ExitCode = exitErr.ExitCode()
-		} else {
-			execution.ExitCode = -1
-		}
+		execution.ExitCode = exitCode
 		execution.Error = err.Error()
 
 		// Check for container not found
-		if strings.Contains(output, "No such container") || strings.Contains(err.Error(), "No such container") {
+		if errors.Is(err, ErrContainerNotFound) || strings.Contains(output, "No such container") || strings.Contains(err.Error(), "No such container") {
 			e.logger.Error().
 				Str("hook_id", hook.ID.String()).
 				Str("container", hook.ContainerName).
@@ -158,6 +146,50 @@ func (e *HookExecutor) ExecuteHook(ctx context.Context, hook *models.ContainerBa
 	return execution, nil
 }
 
+// run executes the hook command in its container, through the Engine API
+// when available and with docker exec otherwise. A non-zero exit code is
+// returned as an error.
+func (e *HookExecutor) run(ctx context.Context, hook *models.ContainerBackupHook, command string) (stdout, stderr string, exitCode int, err error) {
+	if e.engine != nil {
+		result, err := e.engine.ContainerExec(ctx, hook.ContainerName, []string{"sh", "-c", command}, ExecOptions{
+			User:       hook.User,
+			WorkingDir: hook.WorkingDir,
+		})
+		if err == nil {
+			if result.ExitCode != 0 {
+				return result.Stdout, result.Stderr, result.ExitCode, fmt.Errorf("exit status %d", result.ExitCode)
+			}
+			return result.Stdout, result.Stderr, 0, nil
+		}
+		if !engineUnavailable(err) {
+			return "", "", -1, err
+		}
+		e.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+	}
+
+	args := e.buildExecArgs(hook, command)
+
+	e.logger.Debug().
+		Strs("args", args).
+		Msg("running docker exec")
+
+	cmd := exec.CommandContext(ctx, e.dockerBinary, args...)
+
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+
+	err = cmd.Run()
+	exitCode = 0
+	if err != nil {
+		exitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	return outBuf.String(), errBuf.String(), exitCode, err
+}
+
 // buildExecArgs builds the docker exec command arguments.
 func (e *HookExecutor) buildExecArgs(hook *models.ContainerBackupHook, command string) []string {
 	args := []string{"exec"}
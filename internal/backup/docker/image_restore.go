@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -73,17 +74,34 @@ type ImageRestoreResult struct {
 // ImageRestoreService provides image-aware Docker restore functionality.
 type ImageRestoreService struct {
 	imageService *ImageBackupService
+	engine       *EngineClient
 	logger       zerolog.Logger
 }
 
-// NewImageRestoreService creates a new image restore service.
+// NewImageRestoreService creates a new image restore service that uses the shared Engine API client.
 func NewImageRestoreService(imageService *ImageBackupService, logger zerolog.Logger) *ImageRestoreService {
 	return &ImageRestoreService{
 		imageService: imageService,
+		engine:       DefaultEngineClient(logger),
 		logger:       logger.With().Str("component", "docker_image_restore").Logger(),
 	}
 }
 
+// SetEngineClient sets the Engine API client. With nil, only the CLI is used.
+func (s *ImageRestoreService) SetEngineClient(engine *EngineClient) {
+	s.engine = engine
+}
+
+// useEngine reports whether an Engine API call's result should be used. It
+// is false when the daemon socket was unreachable and the CLI should be tried.
+func (s *ImageRestoreService) useEngine(err error) bool {
+	if engineUnavailable(err) {
+		s.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+		return false
+	}
+	return true
+}
+
 // RestoreContainersWithImages restores Docker containers with image pre-loading.
 func (s *ImageRestoreService) RestoreContainersWithImages(
 	ctx context.Context,
@@ -198,6 +216,12 @@ func (s *ImageRestoreService) restoreRequiredImages(
 func (s *ImageRestoreService) pullImage(ctx context.Context, image string) error {
 	s.logger.Info().Str("image", image).Msg("pulling image")
 
+	if s.engine != nil {
+		if _, err := s.engine.ImagePull(ctx, image); s.useEngine(err) {
+			return err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, "docker", "pull", image)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
@@ -272,6 +296,27 @@ func (s *ImageRestoreService) restoreContainer(
 
 // checkContainerStatus checks if a container exists and its running state.
 func (s *ImageRestoreService) checkContainerStatus(ctx context.Context, name string) (exists bool, running bool, err error) {
+	if s.engine != nil {
+		raw, err := s.engine.ContainerInspectRaw(ctx, name)
+		if s.useEngine(err) {
+			if errors.Is(err, ErrContainerNotFound) {
+				return false, false, nil
+			}
+			if err != nil {
+				return false, false, err
+			}
+			var inspect struct {
+				State struct {
+					Running bool `json:"Running"`
+				} `json:"State"`
+			}
+			if err := json.Unmarshal(raw, &inspect); err != nil {
+				return false, false, fmt.Errorf("parse inspect: %w", err)
+			}
+			return true, inspect.State.Running, nil
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, "docker", "inspect", "--format", "{{.State.Running}}", name)
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
@@ -288,6 +333,14 @@ func (s *ImageRestoreService) checkContainerStatus(ctx context.Context, name str
 func (s *ImageRestoreService) forceRemoveContainer(ctx context.Context, name string) error {
 	s.logger.Debug().Str("container", name).Msg("removing container")
 
+	if s.engine != nil {
+		err := s.engine.StopContainer(ctx, name, nil)
+		if s.useEngine(err) {
+			// Removal is forced, so a failed stop does not matter.
+			return s.engine.ContainerRemove(ctx, name, true)
+		}
+	}
+
 	stopCmd := exec.CommandContext(ctx, "docker", "stop", name)
 	stopCmd.Run() // Ignore error if already stopped
 
@@ -309,6 +362,12 @@ func (s *ImageRestoreService) createContainerFromInfo(ctx context.Context, conta
 		Str("image", container.Image).
 		Msg("creating container")
 
+	if s.engine != nil {
+		if err := s.createContainerEngine(ctx, container); s.useEngine(err) {
+			return err
+		}
+	}
+
 	args := []string{"create", "--name", container.Name}
 
 	for _, port := range container.Ports {
@@ -342,10 +401,65 @@ func (s *ImageRestoreService) createContainerFromInfo(ctx context.Context, conta
 	return nil
 }
 
+// createContainerEngine creates a container from backup info through the
+// Engine API with the same settings `docker create` is given.
+func (s *ImageRestoreService) createContainerEngine(ctx context.Context, container ImageRestoreContainerInfo) error {
+	exposed := make(map[string]struct{})
+	bindings := make(map[string][]map[string]string)
+	for _, port := range container.Ports {
+		hostPort, containerPort, ok := strings.Cut(port, ":")
+		if !ok {
+			hostPort, containerPort = "", port
+		}
+		if !strings.Contains(containerPort, "/") {
+			containerPort += "/tcp"
+		}
+		exposed[containerPort] = struct{}{}
+		bindings[containerPort] = append(bindings[containerPort], map[string]string{"HostPort": hostPort})
+	}
+
+	var networks []string
+	for _, net := range container.Networks {
+		if net != "bridge" && net != "host" && net != "none" {
+			networks = append(networks, net)
+		}
+	}
+	hostConfig := map[string]interface{}{
+		"Binds":        container.Volumes,
+		"PortBindings": bindings,
+	}
+	if len(networks) > 0 {
+		hostConfig["NetworkMode"] = networks[0]
+	}
+
+	id, err := s.engine.ContainerCreate(ctx, container.Name, map[string]interface{}{
+		"Image":        container.Image,
+		"Labels":       container.Labels,
+		"ExposedPorts": exposed,
+		"HostConfig":   hostConfig,
+	})
+	if err != nil {
+		return err
+	}
+	// A container is created on one network and connected to the others.
+	for i := 1; i < len(networks); i++ {
+		if err := s.engine.NetworkConnect(ctx, networks[i], id, "", ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // startContainerByName starts a container by name.
 func (s *ImageRestoreService) startContainerByName(ctx context.Context, name string) error {
 	s.logger.Debug().Str("container", name).Msg("starting container")
 
+	if s.engine != nil {
+		if err := s.engine.StartContainer(ctx, name); s.useEngine(err) {
+			return err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, "docker", "start", name)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
@@ -361,6 +475,25 @@ func (s *ImageRestoreService) startContainerByName(ctx context.Context, name str
 func (s *ImageRestoreService) GetContainerInfoForBackup(ctx context.Context) ([]ImageRestoreContainerInfo, error) {
 	s.logger.Debug().Msg("getting container information")
 
+	if s.engine != nil {
+		list, err := s.engine.ContainerList(ctx, true)
+		if s.useEngine(err) {
+			if err != nil {
+				return nil, err
+			}
+			var containers []ImageRestoreContainerInfo
+			for _, c := range list {
+				info, err := s.inspectContainerForImageRestore(ctx, c.ID)
+				if err != nil {
+					s.logger.Warn().Str("container", c.ID).Err(err).Msg("failed to inspect container")
+					continue
+				}
+				containers = append(containers, *info)
+			}
+			return containers, nil
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, "docker", "ps", "-a", "--format", "{{json .}}", "--no-trunc")
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -404,8 +537,19 @@ func (s *ImageRestoreService) GetContainerInfoForBackup(ctx context.Context) ([]
 	return containers, nil
 }
 
-// inspectContainerForImageRestore gets detailed container information.
-func (s *ImageRestoreService) inspectContainerForImageRestore(ctx context.Context, containerID string) (*ImageRestoreContainerInfo, error) {
+// inspectContainers returns the inspect documents of containers as a JSON
+// array, as `docker inspect` prints them.
+func (s *ImageRestoreService) inspectContainers(ctx context.Context, containerID string) ([]byte, error) {
+	if s.engine != nil {
+		raw, err := s.engine.ContainerInspectRaw(ctx, containerID)
+		if s.useEngine(err) {
+			if err != nil {
+				return nil, err
+			}
+			return append(append([]byte("["), raw...), ']'), nil
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, "docker", "inspect", containerID)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -414,6 +558,15 @@ func (s *ImageRestoreService) inspectContainerForImageRestore(ctx context.Contex
 	if err := cmd.Run(); err != nil {
 		return nil, fmt.Errorf("docker inspect: %w: %s", err, stderr.String())
 	}
+	return stdout.Bytes(), nil
+}
+
+// inspectContainerForImageRestore gets detailed container information.
+func (s *ImageRestoreService) inspectContainerForImageRestore(ctx context.Context, containerID string) (*ImageRestoreContainerInfo, error) {
+	output, err := s.inspectContainers(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
 
 	var results []struct {
 		ID      string `json:"Id"`
@@ -440,7 +593,7 @@ func (s *ImageRestoreService) inspectContainerForImageRestore(ctx context.Contex
 		} `json:"NetworkSettings"`
 	}
 
-	if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
+	if err := json.Unmarshal(output, &results); err != nil {
 		return nil, fmt.Errorf("parse inspect: %w", err)
 	}
 
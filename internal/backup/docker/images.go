@@ -115,6 +115,7 @@ type RegistryBackupInfo struct {
 // ImageBackupService provides Docker image backup functionality.
 type ImageBackupService struct {
 	config    ImageBackupConfig
+	engine    *EngineClient
 	logger    zerolog.Logger
 	mu        sync.Mutex
 
@@ -124,20 +125,46 @@ type ImageBackupService struct {
 	backupPathCache map[string]string // checksum -> backup path
 }
 
-// NewImageBackupService creates a new image backup service.
+// NewImageBackupService creates a new image backup service that uses the
+// shared Engine API client.
 func NewImageBackupService(config ImageBackupConfig, logger zerolog.Logger) *ImageBackupService {
 	return &ImageBackupService{
 		config:          config,
+		engine:          DefaultEngineClient(logger),
 		logger:          logger.With().Str("component", "docker_image_backup").Logger(),
 		checksumCache:   make(map[string]string),
 		backupPathCache: make(map[string]string),
 	}
 }
 
+// SetEngineClient sets the Engine API client. With nil, only the CLI is used.
+func (s *ImageBackupService) SetEngineClient(engine *EngineClient) {
+	s.engine = engine
+}
+
+// useEngine reports whether an Engine API call's result should be used. It
+// is false when the daemon socket was unreachable and the CLI should be tried.
+func (s *ImageBackupService) useEngine(err error) bool {
+	if engineUnavailable(err) {
+		s.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+		return false
+	}
+	return true
+}
+
 // ListImages returns all Docker images on the system.
 func (s *ImageBackupService) ListImages(ctx context.Context) ([]ImageInfo, error) {
 	s.logger.Debug().Msg("listing Docker images")
 
+	if s.engine != nil {
+		if images, err := s.engine.ImageList(ctx); s.useEngine(err) {
+			if err == nil {
+				s.logger.Debug().Int("count", len(images)).Msg("images listed")
+			}
+			return images, err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, "docker", "images", "--format", "{{json .}}", "--no-trunc")
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -182,16 +209,37 @@ func (s *ImageBackupService) ListImages(ctx context.Context) ([]ImageInfo, error
 
 // inspectImage gets detailed information about a Docker image.
 func (s *ImageBackupService) inspectImage(ctx context.Context, imageID string) (*ImageInfo, error) {
-	cmd := exec.CommandContext(ctx, "docker", "inspect", imageID)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	var inspectResults []json.RawMessage
+	if s.engine != nil {
+		raw, err := s.engine.ImageInspectRaw(ctx, imageID)
+		if s.useEngine(err) {
+			if err != nil {
+				return nil, err
+			}
+			inspectResults = []json.RawMessage{raw}
+		}
+	}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("docker inspect failed: %w: %s", err, stderr.String())
+	if inspectResults == nil {
+		cmd := exec.CommandContext(ctx, "docker", "inspect", imageID)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("docker inspect failed: %w: %s", err, stderr.String())
+		}
+
+		if err := json.Unmarshal(stdout.Bytes(), &inspectResults); err != nil {
+			return nil, fmt.Errorf("parse inspect result: %w", err)
+		}
 	}
 
-	var inspectResults []struct {
+	if len(inspectResults) == 0 {
+		return nil, fmt.Errorf("no inspect results for image %s", imageID)
+	}
+
+	var result struct {
 		ID          string    `json:"Id"`
 		RepoTags    []string  `json:"RepoTags"`
 		RepoDigests []string  `json:"RepoDigests"`
@@ -201,16 +249,10 @@ func (s *ImageBackupService) inspectImage(ctx context.Context, imageID string) (
 			Labels map[string]string `json:"Labels"`
 		} `json:"Config"`
 	}
-
-	if err := json.Unmarshal(stdout.Bytes(), &inspectResults); err != nil {
+	if err := json.Unmarshal(inspectResults[0], &result); err != nil {
 		return nil, fmt.Errorf("parse inspect result: %w", err)
 	}
 
-	if len(inspectResults) == 0 {
-		return nil, fmt.Errorf("no inspect results for image %s", imageID)
-	}
-
-	result := inspectResults[0]
 	return &ImageInfo{
 		ID:          result.ID,
 		RepoTags:    result.RepoTags,
@@ -275,6 +317,20 @@ func (s *ImageBackupService) ExportImage(ctx context.Context, imageID string, ou
 	}
 	defer outFile.Close()
 
+	if s.engine != nil {
+		if err := s.engine.ImageSave(ctx, imageID, outFile); s.useEngine(err) {
+			if err != nil {
+				os.Remove(outputPath)
+				return err
+			}
+			s.logger.Info().
+				Str("image_id", imageID).
+				Str("output_path", outputPath).
+				Msg("image exported successfully")
+			return nil
+		}
+	}
+
 	// Run docker save
 	cmd := exec.CommandContext(ctx, "docker", "save", imageID)
 	cmd.Stdout = outFile
@@ -308,6 +364,23 @@ func (s *ImageBackupService) LoadImage(ctx context.Context, inputPath string) er
 	}
 	defer inFile.Close()
 
+	if s.engine != nil {
+		// A refused connection means nothing was read from the file yet.
+		if output, err := s.engine.ImageLoad(ctx, inFile); s.useEngine(err) {
+			if err != nil {
+				return err
+			}
+			s.logger.Info().
+				Str("input_path", inputPath).
+				Str("output", output).
+				Msg("image loaded successfully")
+			return nil
+		}
+		if _, err := inFile.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("rewind input file: %w", err)
+		}
+	}
+
 	// Run docker load
 	cmd := exec.CommandContext(ctx, "docker", "load")
 	cmd.Stdin = inFile
@@ -332,31 +405,13 @@ func (s *ImageBackupService) LoadImage(ctx context.Context, inputPath string) er
 func (s *ImageBackupService) GetContainerImages(ctx context.Context) ([]ImageVersion, error) {
 	s.logger.Debug().Msg("getting container images")
 
-	cmd := exec.CommandContext(ctx, "docker", "ps", "--format", "{{json .}}", "--no-trunc")
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("docker ps failed: %w: %s", err, stderr.String())
+	containers, err := s.runningContainers(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	var versions []ImageVersion
-	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-
-		var container struct {
-			ID    string `json:"ID"`
-			Names string `json:"Names"`
-			Image string `json:"Image"`
-		}
-		if err := json.Unmarshal([]byte(line), &container); err != nil {
-			s.logger.Warn().Str("line", line).Err(err).Msg("failed to parse container info")
-			continue
-		}
+	for _, container := range containers {
 
 		// Get image ID for the container
 		imageInfo, err := s.inspectImage(ctx, container.Image)
@@ -371,7 +426,7 @@ func (s *ImageBackupService) GetContainerImages(ctx context.Context) ([]ImageVer
 
 		version := ImageVersion{
 			ContainerID:   container.ID,
-			ContainerName: container.Names,
+			ContainerName: container.Name,
 			ImageID:       imageInfo.ID,
 			ImageTag:      container.Image,
 			BackupTime:    time.Now(),
@@ -388,6 +443,71 @@ func (s *ImageBackupService) GetContainerImages(ctx context.Context) ([]ImageVer
 	return versions, nil
 }
 
+// runningContainers returns the running containers.
+func (s *ImageBackupService) runningContainers(ctx context.Context) ([]Container, error) {
+	if s.engine != nil {
+		if containers, err := s.engine.ContainerList(ctx, false); s.useEngine(err) {
+			return containers, err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "docker", "ps", "--format", "{{json .}}", "--no-trunc")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("docker ps failed: %w: %s", err, stderr.String())
+	}
+
+	var containers []Container
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		var container struct {
+			ID    string `json:"ID"`
+			Names string `json:"Names"`
+			Image string `json:"Image"`
+		}
+		if err := json.Unmarshal([]byte(line), &container); err != nil {
+			s.logger.Warn().Str("line", line).Err(err).Msg("failed to parse container info")
+			continue
+		}
+		containers = append(containers, Container{ID: container.ID, Name: container.Names, Image: container.Image})
+	}
+	return containers, nil
+}
+
+// containerImageID returns the ID of the image a container was created from.
+func (s *ImageBackupService) containerImageID(ctx context.Context, containerID string) (string, error) {
+	if s.engine != nil {
+		raw, err := s.engine.ContainerInspectRaw(ctx, containerID)
+		if s.useEngine(err) {
+			if err != nil {
+				return "", err
+			}
+			var inspect struct {
+				Image string `json:"Image"`
+			}
+			if err := json.Unmarshal(raw, &inspect); err != nil {
+				return "", fmt.Errorf("parse container inspect: %w", err)
+			}
+			return inspect.Image, nil
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "docker", "inspect", "--format", "{{.Image}}", containerID)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
 // BackupImages backs up Docker images based on configuration.
 func (s *ImageBackupService) BackupImages(ctx context.Context, containerIDs []string) (*ImageBackupResult, error) {
 	s.mu.Lock()
@@ -415,15 +535,12 @@ func (s *ImageBackupService) BackupImages(ctx context.Context, containerIDs []st
 	if len(containerIDs) > 0 {
 		// Backup images for specific containers
 		for _, containerID := range containerIDs {
-			cmd := exec.CommandContext(ctx, "docker", "inspect", "--format", "{{.Image}}", containerID)
-			var stdout bytes.Buffer
-			cmd.Stdout = &stdout
-			if err := cmd.Run(); err != nil {
+			imageID, err := s.containerImageID(ctx, containerID)
+			if err != nil {
 				result.Errors = append(result.Errors, fmt.Sprintf("failed to get image for container %s: %v", containerID, err))
 				continue
 			}
 
-			imageID := strings.TrimSpace(stdout.String())
 			info, err := s.inspectImage(ctx, imageID)
 			if err != nil {
 				result.Errors = append(result.Errors, fmt.Sprintf("failed to inspect image %s: %v", imageID, err))
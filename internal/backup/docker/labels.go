@@ -56,6 +56,21 @@ const (
 
 	// LabelPriority sets the backup priority (keldris.backup.priority=high).
 	LabelPriority = "keldris.backup.priority"
+
+	// LabelBackupOnRemove runs a final backup when the container is removed (keldris.backup.on-remove=true).
+	LabelBackupOnRemove = "keldris.backup.on-remove"
+
+	// LabelDatabase sets or disables the database engine dumped from the container (keldris.backup.database=postgres).
+	LabelDatabase = "keldris.backup.database"
+
+	// LabelDatabaseName limits the dump to one database (keldris.backup.database.name=shop).
+	LabelDatabaseName = "keldris.backup.database.name"
+
+	// LabelDatabaseUser sets the user the dump connects as (keldris.backup.database.user=backup).
+	LabelDatabaseUser = "keldris.backup.database.user"
+
+	// LabelDatabasePasswordEnv names the container environment variable holding the password (keldris.backup.database.password-env=DB_PASS).
+	LabelDatabasePasswordEnv = "keldris.backup.database.password-env"
 )
 
 // LabelParser parses Docker container labels into backup configuration.
@@ -80,6 +95,7 @@ type ContainerInfo struct {
 // MountInfo represents a container mount point.
 type MountInfo struct {
 	Type        string // "volume" or "bind"
+	Name        string // Volume name, for volume mounts
 	Source      string
 	Destination string
 	ReadOnly    bool
@@ -251,6 +267,43 @@ func (p *LabelParser) filterKeldrisLabels(labels map[string]string) map[string]s
 	return filtered
 }
 
+// BackupOnRemove reports whether a final backup should run when the container is removed.
+func (p *LabelParser) BackupOnRemove(labels map[string]string) bool {
+	return p.isBackupEnabled(labels) && p.getBool(labels, LabelBackupOnRemove, false)
+}
+
+// BackupPaths returns the host paths to back up for a container according to
+// its labels, and its exclude labels translated from container paths to host
+// paths. Excludes that do not fall under a backed-up mount, such as glob
+// patterns, are passed through unchanged.
+func (p *LabelParser) BackupPaths(container ContainerInfo) (paths, excludes []string) {
+	backupVolumes := p.getBool(container.Labels, LabelBackupVolumes, true)
+	backupBindMounts := p.getBool(container.Labels, LabelBackupBindMounts, false)
+
+	var mounts []MountInfo
+	for _, m := range container.Mounts {
+		include := (m.Type == "volume" && backupVolumes) || (m.Type == "bind" && backupBindMounts)
+		if !include || m.Source == "" {
+			continue
+		}
+		mounts = append(mounts, m)
+		paths = append(paths, m.Source)
+	}
+
+	for _, exclude := range p.parseCSV(p.getString(container.Labels, LabelExclude)) {
+		translated := exclude
+		for _, m := range mounts {
+			dest := strings.TrimSuffix(m.Destination, "/")
+			if exclude == dest || strings.HasPrefix(exclude, dest+"/") {
+				translated = m.Source + strings.TrimPrefix(exclude, dest)
+				break
+			}
+		}
+		excludes = append(excludes, translated)
+	}
+	return paths, excludes
+}
+
 // HasBackupLabel checks if a container has any Keldris backup label.
 func (p *LabelParser) HasBackupLabel(labels map[string]string) bool {
 	for key := range labels {
@@ -283,7 +336,7 @@ func (p *LabelParser) ValidateLabels(labels map[string]string) []string {
 	}
 
 	// Validate boolean values
-	boolLabels := []string{LabelEnabled, LabelStopOnBackup, LabelBackupVolumes, LabelBackupBindMounts}
+	boolLabels := []string{LabelEnabled, LabelStopOnBackup, LabelBackupVolumes, LabelBackupBindMounts, LabelBackupOnRemove}
 	validBoolValues := map[string]bool{
 		"true": true, "false": true, "yes": true, "no": true,
 		"1": true, "0": true, "on": true, "off": true, "enabled": true, "disabled": true,
@@ -306,6 +359,16 @@ func (p *LabelParser) ValidateLabels(labels map[string]string) []string {
 		}
 	}
 
+	// Validate database labels
+	if val, ok := labels[LabelDatabase]; ok {
+		if _, disabled := parseDatabaseLabel(val); !disabled && !validDatabaseLabel(val) {
+			errors = append(errors, "invalid database engine for "+LabelDatabase+": "+val+". Use postgres, mysql, mariadb, mongodb, redis, or false")
+		}
+	}
+	if val, ok := labels[LabelDatabasePasswordEnv]; ok && !envNamePattern.MatchString(val) {
+		errors = append(errors, "invalid environment variable name for "+LabelDatabasePasswordEnv+": "+val)
+	}
+
 	return errors
 }
 
@@ -425,6 +488,46 @@ func (p *LabelParser) GenerateLabelDocs() *models.DockerLabelDocs {
 				Examples:    []string{"high", "medium", "low"},
 				Required:    false,
 			},
+			{
+				Label:       LabelBackupOnRemove,
+				Description: "Run a final backup of the container's volumes when the container is removed. The agent holds the volumes until the backup completes so that docker compose down -v cannot delete them first.",
+				Type:        "boolean",
+				Default:     "false",
+				Examples:    []string{"true", "false"},
+				Required:    false,
+			},
+			{
+				Label:       LabelDatabase,
+				Description: "Database engine to dump from inside the container when the schedule has database dumps enabled. Detected from the image name when unset; false disables the dump.",
+				Type:        "string",
+				Default:     "",
+				Examples:    []string{"postgres", "mysql", "mariadb", "mongodb", "redis", "false"},
+				Required:    false,
+			},
+			{
+				Label:       LabelDatabaseName,
+				Description: "Dump only this database instead of all databases on the server.",
+				Type:        "string",
+				Default:     "",
+				Examples:    []string{"shop", "wordpress"},
+				Required:    false,
+			},
+			{
+				Label:       LabelDatabaseUser,
+				Description: "User the dump connects as. Defaults to the image's administrator (POSTGRES_USER, root, MONGO_INITDB_ROOT_USERNAME).",
+				Type:        "string",
+				Default:     "",
+				Examples:    []string{"postgres", "backup"},
+				Required:    false,
+			},
+			{
+				Label:       LabelDatabasePasswordEnv,
+				Description: "Name of the container environment variable that holds the password. Defaults to the image's standard variable, so the password never appears in labels.",
+				Type:        "string",
+				Default:     "",
+				Examples:    []string{"DB_PASSWORD", "MYSQL_ROOT_PASSWORD"},
+				Required:    false,
+			},
 		},
 		GeneratedAt: time.Now(),
 	}
@@ -386,6 +386,46 @@ func TestLabelParser_HasBackupLabel(t *testing.T) {
 	}
 }
 
+func TestLabelParser_BackupPaths(t *testing.T) {
+	parser := NewLabelParser()
+
+	container := ContainerInfo{
+		Name: "app",
+		Labels: map[string]string{
+			"keldris.backup":             "true",
+			"keldris.backup.on-remove":   "true",
+			"keldris.backup.bind-mounts": "true",
+			"keldris.backup.exclude":     "/data/cache, *.log, /etc/app/tmp",
+		},
+		Mounts: []MountInfo{
+			{Type: "volume", Name: "appdata", Source: "/var/lib/docker/volumes/appdata/_data", Destination: "/data"},
+			{Type: "bind", Source: "/srv/app/config", Destination: "/etc/app/"},
+			{Type: "tmpfs", Destination: "/run"},
+		},
+	}
+
+	paths, excludes := parser.BackupPaths(container)
+	wantPaths := []string{"/var/lib/docker/volumes/appdata/_data", "/srv/app/config"}
+	if strings.Join(paths, ",") != strings.Join(wantPaths, ",") {
+		t.Errorf("paths = %v, want %v", paths, wantPaths)
+	}
+	wantExcludes := []string{"/var/lib/docker/volumes/appdata/_data/cache", "*.log", "/srv/app/config/tmp"}
+	if strings.Join(excludes, ",") != strings.Join(wantExcludes, ",") {
+		t.Errorf("excludes = %v, want %v", excludes, wantExcludes)
+	}
+	if !parser.BackupOnRemove(container.Labels) {
+		t.Error("expected on-remove backup")
+	}
+
+	container.Labels = map[string]string{"keldris.backup": "true"}
+	if paths, _ := parser.BackupPaths(container); len(paths) != 1 {
+		t.Errorf("bind mounts should be skipped by default, got %v", paths)
+	}
+	if parser.BackupOnRemove(map[string]string{"keldris.backup.on-remove": "true"}) {
+		t.Error("on-remove requires backup to be enabled")
+	}
+}
+
 func TestDockerContainerConfig_GetEffectiveCronExpression(t *testing.T) {
 	tests := []struct {
 		name     string
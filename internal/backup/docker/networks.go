@@ -137,17 +137,19 @@ type NetworkRestoreResult struct {
 type Networks struct {
 	logger     zerolog.Logger
 	dockerPath string
+	engine     *EngineClient
 }
 
-// NewNetworks creates a new Networks instance.
+// NewNetworks creates a new Networks instance that uses the shared Engine API client.
 func NewNetworks(logger zerolog.Logger) *Networks {
 	return &Networks{
 		logger:     logger.With().Str("component", "docker_networks").Logger(),
 		dockerPath: "docker",
+		engine:     DefaultEngineClient(logger),
 	}
 }
 
-// NewNetworksWithPath creates a new Networks instance with a custom Docker path.
+// NewNetworksWithPath creates a new Networks instance that only uses the given Docker CLI.
 func NewNetworksWithPath(dockerPath string, logger zerolog.Logger) *Networks {
 	return &Networks{
 		logger:     logger.With().Str("component", "docker_networks").Logger(),
@@ -155,8 +157,29 @@ func NewNetworksWithPath(dockerPath string, logger zerolog.Logger) *Networks {
 	}
 }
 
+// SetEngineClient sets the Engine API client. With nil, only the CLI is used.
+func (n *Networks) SetEngineClient(engine *EngineClient) {
+	n.engine = engine
+}
+
+// useEngine reports whether an Engine API call's result should be used. It
+// is false when the daemon socket was unreachable and the CLI should be tried.
+func (n *Networks) useEngine(err error) bool {
+	if engineUnavailable(err) {
+		n.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+		return false
+	}
+	return true
+}
+
 // CheckDockerAvailable verifies that Docker is available and accessible.
 func (n *Networks) CheckDockerAvailable(ctx context.Context) error {
+	if n.engine != nil {
+		if err := n.engine.Ping(ctx); n.useEngine(err) {
+			return err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, n.dockerPath, "version", "--format", "{{.Server.Version}}")
 	if err := cmd.Run(); err != nil {
 		return ErrDockerNotAvailable
@@ -230,6 +253,12 @@ func (n *Networks) Backup(ctx context.Context) (*NetworkBackup, error) {
 
 // listNetworks returns all Docker network names.
 func (n *Networks) listNetworks(ctx context.Context) ([]string, error) {
+	if n.engine != nil {
+		if names, err := n.engine.NetworkList(ctx); n.useEngine(err) {
+			return names, err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, n.dockerPath, "network", "ls", "--format", "{{.Name}}")
 	output, err := cmd.Output()
 	if err != nil {
@@ -248,10 +277,9 @@ func (n *Networks) listNetworks(ctx context.Context) ([]string, error) {
 
 // inspectNetwork returns detailed configuration for a network.
 func (n *Networks) inspectNetwork(ctx context.Context, name string) (*NetworkDefinition, error) {
-	cmd := exec.CommandContext(ctx, n.dockerPath, "network", "inspect", name, "--format", "{{json .}}")
-	output, err := cmd.Output()
+	output, err := n.inspectNetworkRaw(ctx, name)
 	if err != nil {
-		return nil, fmt.Errorf("docker network inspect: %w", err)
+		return nil, err
 	}
 
 	// Docker inspect returns a raw JSON object
@@ -299,6 +327,22 @@ func (n *Networks) inspectNetwork(ctx context.Context, name string) (*NetworkDef
 	return config, nil
 }
 
+// inspectNetworkRaw returns the inspect document of a network.
+func (n *Networks) inspectNetworkRaw(ctx context.Context, name string) ([]byte, error) {
+	if n.engine != nil {
+		if raw, err := n.engine.NetworkInspectRaw(ctx, name); n.useEngine(err) {
+			return raw, err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, n.dockerPath, "network", "inspect", name, "--format", "{{json .}}")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker network inspect: %w", err)
+	}
+	return output, nil
+}
+
 // dockerNetworkInspect represents the raw Docker network inspect output.
 type dockerNetworkInspect struct {
 	ID         string                         `json:"Id"`
@@ -339,14 +383,13 @@ type dockerContainer struct {
 
 // getNetworkAssignments returns container assignments for a network.
 func (n *Networks) getNetworkAssignments(ctx context.Context, config *NetworkDefinition) (*NetworkAssignment, error) {
-	cmd := exec.CommandContext(ctx, n.dockerPath, "network", "inspect", config.Name, "--format", "{{json .Containers}}")
-	output, err := cmd.Output()
+	output, err := n.inspectNetworkRaw(ctx, config.Name)
 	if err != nil {
 		return nil, fmt.Errorf("docker network inspect containers: %w", err)
 	}
 
-	var containers map[string]dockerContainer
-	if err := json.Unmarshal(output, &containers); err != nil {
+	var inspect dockerNetworkInspect
+	if err := json.Unmarshal(output, &inspect); err != nil {
 		// Empty or null containers
 		return &NetworkAssignment{
 			NetworkID:   config.ID,
@@ -356,7 +399,7 @@ func (n *Networks) getNetworkAssignments(ctx context.Context, config *NetworkDef
 	}
 
 	var endpoints []ContainerEndpoint
-	for containerID, container := range containers {
+	for containerID, container := range inspect.Containers {
 		endpoint := ContainerEndpoint{
 			ContainerID:   containerID,
 			ContainerName: strings.TrimPrefix(container.Name, "/"),
@@ -381,6 +424,30 @@ func (n *Networks) getNetworkAssignments(ctx context.Context, config *NetworkDef
 
 // isStaticIP checks if a container's IP on a network was statically assigned.
 func (n *Networks) isStaticIP(ctx context.Context, containerID, networkName string) bool {
+	if n.engine != nil {
+		raw, err := n.engine.ContainerInspectRaw(ctx, containerID)
+		if n.useEngine(err) {
+			if err != nil {
+				return false
+			}
+			var inspect struct {
+				NetworkSettings struct {
+					Networks map[string]struct {
+						IPAMConfig *struct {
+							IPv4Address string `json:"IPv4Address"`
+							IPv6Address string `json:"IPv6Address"`
+						} `json:"IPAMConfig"`
+					} `json:"Networks"`
+				} `json:"NetworkSettings"`
+			}
+			if err := json.Unmarshal(raw, &inspect); err != nil {
+				return false
+			}
+			ipam := inspect.NetworkSettings.Networks[networkName].IPAMConfig
+			return ipam != nil && (ipam.IPv4Address != "" || ipam.IPv6Address != "")
+		}
+	}
+
 	// Inspect container to check network settings
 	cmd := exec.CommandContext(ctx, n.dockerPath, "inspect", containerID,
 		"--format", fmt.Sprintf("{{index .NetworkSettings.Networks \"%s\"}}", networkName))
@@ -403,6 +470,20 @@ func stripCIDR(addr string) string {
 
 // getDockerInfo returns Docker host and API version.
 func (n *Networks) getDockerInfo(ctx context.Context) (host, apiVersion string) {
+	if n.engine != nil {
+		raw, err := n.engine.Info(ctx)
+		if n.useEngine(err) {
+			var info struct {
+				Name string `json:"Name"`
+			}
+			if err == nil && json.Unmarshal(raw, &info) == nil {
+				host = info.Name
+			}
+			_, apiVersion, _ = n.engine.ServerVersion(ctx)
+			return host, apiVersion
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, n.dockerPath, "info", "--format", "{{.Name}}")
 	if output, err := cmd.Output(); err == nil {
 		host = strings.TrimSpace(string(output))
@@ -548,6 +629,16 @@ func (n *Networks) Restore(ctx context.Context, backup *NetworkBackup, opts Netw
 
 // networkExists checks if a network with the given name exists.
 func (n *Networks) networkExists(ctx context.Context, name string) (bool, error) {
+	if n.engine != nil {
+		_, err := n.engine.NetworkInspectRaw(ctx, name)
+		if n.useEngine(err) {
+			if errors.Is(err, ErrNetworkNotFound) {
+				return false, nil
+			}
+			return err == nil, err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, n.dockerPath, "network", "inspect", name)
 	err := cmd.Run()
 	if err != nil {
@@ -563,6 +654,12 @@ func (n *Networks) networkExists(ctx context.Context, name string) (bool, error)
 
 // removeNetwork removes a Docker network.
 func (n *Networks) removeNetwork(ctx context.Context, name string) error {
+	if n.engine != nil {
+		if err := n.engine.NetworkRemove(ctx, name); n.useEngine(err) {
+			return err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, n.dockerPath, "network", "rm", name)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
@@ -574,6 +671,12 @@ func (n *Networks) removeNetwork(ctx context.Context, name string) error {
 
 // createNetwork creates a Docker network from configuration.
 func (n *Networks) createNetwork(ctx context.Context, config *NetworkDefinition) error {
+	if n.engine != nil {
+		if err := n.engine.NetworkCreate(ctx, config); n.useEngine(err) {
+			return err
+		}
+	}
+
 	args := []string{"network", "create"}
 
 	// Driver
@@ -641,6 +744,13 @@ func (n *Networks) createNetwork(ctx context.Context, config *NetworkDefinition)
 
 // connectContainer connects a container to a network.
 func (n *Networks) connectContainer(ctx context.Context, networkName string, endpoint ContainerEndpoint, restoreStaticIP bool) error {
+	if n.engine != nil {
+		err := n.connectContainerEngine(ctx, networkName, endpoint, restoreStaticIP)
+		if n.useEngine(err) {
+			return err
+		}
+	}
+
 	// Check if container exists
 	cmd := exec.CommandContext(ctx, n.dockerPath, "inspect", endpoint.ContainerName)
 	if err := cmd.Run(); err != nil {
@@ -676,6 +786,27 @@ func (n *Networks) connectContainer(ctx context.Context, networkName string, end
 	return nil
 }
 
+// connectContainerEngine connects a container to a network through the Engine API.
+func (n *Networks) connectContainerEngine(ctx context.Context, networkName string, endpoint ContainerEndpoint, restoreStaticIP bool) error {
+	if _, err := n.engine.ContainerInspectRaw(ctx, endpoint.ContainerName); err != nil {
+		if errors.Is(err, ErrContainerNotFound) {
+			return fmt.Errorf("container %s not found", endpoint.ContainerName)
+		}
+		return err
+	}
+
+	var ipv4, ipv6 string
+	if restoreStaticIP && endpoint.IsStatic {
+		ipv4, ipv6 = endpoint.IPv4Address, endpoint.IPv6Address
+	}
+	err := n.engine.NetworkConnect(ctx, networkName, endpoint.ContainerName, ipv4, ipv6)
+	// Ignore if already connected
+	if err != nil && strings.Contains(err.Error(), "already exists") {
+		return nil
+	}
+	return err
+}
+
 // DetectConflicts checks for conflicts between backup and existing networks.
 func (n *Networks) DetectConflicts(ctx context.Context, backup *NetworkBackup) ([]NetworkConflict, error) {
 	n.logger.Debug().Msg("detecting network conflicts")
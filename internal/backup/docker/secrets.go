@@ -171,19 +171,22 @@ type MaskedSecret struct {
 type SecretsManager struct {
 	keyManager *crypto.KeyManager
 	dockerPath string
+	engine     *EngineClient
 	logger     zerolog.Logger
 }
 
-// NewSecretsManager creates a new SecretsManager instance.
+// NewSecretsManager creates a new SecretsManager instance that uses the
+// shared Engine API client.
 func NewSecretsManager(keyManager *crypto.KeyManager, logger zerolog.Logger) *SecretsManager {
 	return &SecretsManager{
 		keyManager: keyManager,
 		dockerPath: "docker",
+		engine:     DefaultEngineClient(logger),
 		logger:     logger.With().Str("component", "docker_secrets").Logger(),
 	}
 }
 
-// NewSecretsManagerWithPath creates a new SecretsManager with a custom Docker binary path.
+// NewSecretsManagerWithPath creates a new SecretsManager that only uses the given Docker binary.
 func NewSecretsManagerWithPath(keyManager *crypto.KeyManager, dockerPath string, logger zerolog.Logger) *SecretsManager {
 	return &SecretsManager{
 		keyManager: keyManager,
@@ -192,8 +195,29 @@ func NewSecretsManagerWithPath(keyManager *crypto.KeyManager, dockerPath string,
 	}
 }
 
+// SetEngineClient sets the Engine API client. With nil, only the CLI is used.
+func (sm *SecretsManager) SetEngineClient(engine *EngineClient) {
+	sm.engine = engine
+}
+
+// useEngine reports whether an Engine API call's result should be used. It
+// is false when the daemon socket was unreachable and the CLI should be tried.
+func (sm *SecretsManager) useEngine(err error) bool {
+	if engineUnavailable(err) {
+		sm.logger.Debug().Err(err).Msg("engine API unavailable, using docker CLI")
+		return false
+	}
+	return true
+}
+
 // CheckDocker verifies Docker is available and running.
 func (sm *SecretsManager) CheckDocker(ctx context.Context) error {
+	if sm.engine != nil {
+		if err := sm.engine.Ping(ctx); sm.useEngine(err) {
+			return err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, sm.dockerPath, "info", "--format", "{{.ServerVersion}}")
 	output, err := cmd.Output()
 	if err != nil {
@@ -205,15 +229,17 @@ func (sm *SecretsManager) CheckDocker(ctx context.Context) error {
 	return nil
 }
 
-// CheckSwarm verifies Docker Swarm is active.
+// CheckSwarm verifies Docker Swarm is active. Podman keeps secrets without
+// a swarm, so it always passes against the Podman API.
 func (sm *SecretsManager) CheckSwarm(ctx context.Context) error {
-	cmd := exec.CommandContext(ctx, sm.dockerPath, "info", "--format", "{{.Swarm.LocalNodeState}}")
-	output, err := cmd.Output()
+	state, err := sm.swarmState(ctx)
 	if err != nil {
 		return fmt.Errorf("check swarm: %w", err)
 	}
 
-	state := strings.TrimSpace(string(output))
+	if sm.engine != nil && sm.engine.IsPodman() {
+		return nil
+	}
 	if state != "active" {
 		sm.logger.Debug().Str("state", state).Msg("swarm not active")
 		return ErrSwarmNotActive
@@ -223,12 +249,46 @@ func (sm *SecretsManager) CheckSwarm(ctx context.Context) error {
 	return nil
 }
 
+// swarmState returns the swarm state of the local node.
+func (sm *SecretsManager) swarmState(ctx context.Context) (string, error) {
+	if sm.engine != nil {
+		raw, err := sm.engine.Info(ctx)
+		if sm.useEngine(err) {
+			if err != nil {
+				return "", err
+			}
+			var info struct {
+				Swarm struct {
+					LocalNodeState string `json:"LocalNodeState"`
+				} `json:"Swarm"`
+			}
+			if err := json.Unmarshal(raw, &info); err != nil {
+				return "", fmt.Errorf("parse docker info: %w", err)
+			}
+			return info.Swarm.LocalNodeState, nil
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, sm.dockerPath, "info", "--format", "{{.Swarm.LocalNodeState}}")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
 // ListSecrets returns all Docker secrets.
 func (sm *SecretsManager) ListSecrets(ctx context.Context) ([]*DockerSecret, error) {
 	if err := sm.CheckSwarm(ctx); err != nil {
 		return nil, err
 	}
 
+	if sm.engine != nil {
+		if secrets, err := sm.engine.SecretList(ctx); sm.useEngine(err) {
+			return secrets, err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, sm.dockerPath, "secret", "ls", "--format", "{{json .}}")
 	output, err := cmd.Output()
 	if err != nil {
@@ -244,6 +304,16 @@ func (sm *SecretsManager) ListConfigs(ctx context.Context) ([]*DockerSecret, err
 		return nil, err
 	}
 
+	if sm.engine != nil {
+		if sm.engine.IsPodman() {
+			// Podman has no configs.
+			return []*DockerSecret{}, nil
+		}
+		if configs, err := sm.engine.ConfigList(ctx); sm.useEngine(err) {
+			return configs, err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, sm.dockerPath, "config", "ls", "--format", "{{json .}}")
 	output, err := cmd.Output()
 	if err != nil {
@@ -286,13 +356,9 @@ func (sm *SecretsManager) ListSwarmSecrets(ctx context.Context) ([]*DockerSecret
 
 // InspectSecret returns detailed information about a secret.
 func (sm *SecretsManager) InspectSecret(ctx context.Context, secretID string) (*DockerSecret, error) {
-	cmd := exec.CommandContext(ctx, sm.dockerPath, "secret", "inspect", secretID, "--format", "{{json .}}")
-	output, err := cmd.Output()
+	output, err := sm.inspectSecretRaw(ctx, secretID)
 	if err != nil {
-		if strings.Contains(err.Error(), "No such secret") {
-			return nil, ErrSecretNotFound
-		}
-		return nil, fmt.Errorf("inspect secret: %w", err)
+		return nil, err
 	}
 
 	var rawSecret struct {
@@ -345,15 +411,34 @@ func (sm *SecretsManager) InspectSecret(ctx context.Context, secretID string) (*
 	return secret, nil
 }
 
-// InspectConfig returns detailed information about a config.
-func (sm *SecretsManager) InspectConfig(ctx context.Context, configID string) (*DockerSecret, error) {
-	cmd := exec.CommandContext(ctx, sm.dockerPath, "config", "inspect", configID, "--format", "{{json .}}")
+// inspectSecretRaw returns the inspect document of a secret.
+func (sm *SecretsManager) inspectSecretRaw(ctx context.Context, secretID string) ([]byte, error) {
+	if sm.engine != nil {
+		raw, err := sm.engine.SecretInspectRaw(ctx, secretID)
+		if sm.useEngine(err) {
+			if errors.Is(err, ErrSecretNotFound) {
+				return nil, ErrSecretNotFound
+			}
+			return raw, err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, sm.dockerPath, "secret", "inspect", secretID, "--format", "{{json .}}")
 	output, err := cmd.Output()
 	if err != nil {
-		if strings.Contains(err.Error(), "No such config") {
-			return nil, ErrConfigNotFound
+		if strings.Contains(err.Error(), "No such secret") {
+			return nil, ErrSecretNotFound
 		}
-		return nil, fmt.Errorf("inspect config: %w", err)
+		return nil, fmt.Errorf("inspect secret: %w", err)
+	}
+	return output, nil
+}
+
+// InspectConfig returns detailed information about a config.
+func (sm *SecretsManager) InspectConfig(ctx context.Context, configID string) (*DockerSecret, error) {
+	output, err := sm.inspectConfigRaw(ctx, configID)
+	if err != nil {
+		return nil, err
 	}
 
 	var rawConfig struct {
@@ -401,6 +486,29 @@ func (sm *SecretsManager) InspectConfig(ctx context.Context, configID string) (*
 	return config, nil
 }
 
+// inspectConfigRaw returns the inspect document of a config.
+func (sm *SecretsManager) inspectConfigRaw(ctx context.Context, configID string) ([]byte, error) {
+	if sm.engine != nil {
+		raw, err := sm.engine.ConfigInspectRaw(ctx, configID)
+		if sm.useEngine(err) {
+			if errors.Is(err, ErrConfigNotFound) {
+				return nil, ErrConfigNotFound
+			}
+			return raw, err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, sm.dockerPath, "config", "inspect", configID, "--format", "{{json .}}")
+	output, err := cmd.Output()
+	if err != nil {
+		if strings.Contains(err.Error(), "No such config") {
+			return nil, ErrConfigNotFound
+		}
+		return nil, fmt.Errorf("inspect config: %w", err)
+	}
+	return output, nil
+}
+
 // BackupSecrets creates a complete backup of all Docker secrets and configs.
 func (sm *SecretsManager) BackupSecrets(ctx context.Context) (*SecretBackup, error) {
 	backup := &SecretBackup{
@@ -538,13 +646,20 @@ func (sm *SecretsManager) backupSecret(ctx context.Context, secret *DockerSecret
 // backupConfig performs double encryption on a config.
 func (sm *SecretsManager) backupConfig(ctx context.Context, config *DockerSecret) (*SecretData, error) {
 	// Docker configs can be read via inspect
-	cmd := exec.CommandContext(ctx, sm.dockerPath, "config", "inspect", config.ID, "--format", "{{.Spec.Data}}")
-	output, err := cmd.Output()
+	output, err := sm.inspectConfigRaw(ctx, config.ID)
 	if err != nil {
 		return nil, fmt.Errorf("read config data: %w", err)
 	}
+	var rawConfig struct {
+		Spec struct {
+			Data string `json:"Data"`
+		} `json:"Spec"`
+	}
+	if err := json.Unmarshal(output, &rawConfig); err != nil {
+		return nil, fmt.Errorf("parse config data: %w", err)
+	}
 
-	configData := strings.TrimSpace(string(output))
+	configData := rawConfig.Spec.Data
 
 	// First layer: Docker's base64 encoding (already applied)
 	dockerEncrypted := configData
@@ -647,6 +762,17 @@ func (sm *SecretsManager) restoreDockerSecret(ctx context.Context, metadata *Doc
 		return fmt.Errorf("check existing secret: %w", err)
 	}
 
+	if sm.engine != nil {
+		err := sm.engine.SecretCreate(ctx, metadata.Name, metadata.Labels, metadata.Driver, data)
+		if sm.useEngine(err) {
+			if err != nil {
+				return err
+			}
+			sm.logger.Info().Str("name", metadata.Name).Msg("secret restored successfully")
+			return nil
+		}
+	}
+
 	// Build create command
 	args := []string{"secret", "create"}
 
@@ -688,6 +814,21 @@ func (sm *SecretsManager) restoreDockerConfig(ctx context.Context, metadata *Doc
 		return fmt.Errorf("check existing config: %w", err)
 	}
 
+	if sm.engine != nil {
+		templateDriver := ""
+		if metadata.Templating != nil {
+			templateDriver = metadata.Templating.Name
+		}
+		err := sm.engine.ConfigCreate(ctx, metadata.Name, metadata.Labels, templateDriver, data)
+		if sm.useEngine(err) {
+			if err != nil {
+				return err
+			}
+			sm.logger.Info().Str("name", metadata.Name).Msg("config restored successfully")
+			return nil
+		}
+	}
+
 	// Build create command
 	args := []string{"config", "create"}
 
@@ -717,6 +858,12 @@ func (sm *SecretsManager) restoreDockerConfig(ctx context.Context, metadata *Doc
 
 // removeSecret removes a Docker secret.
 func (sm *SecretsManager) removeSecret(ctx context.Context, name string) error {
+	if sm.engine != nil {
+		if err := sm.engine.SecretRemove(ctx, name); sm.useEngine(err) {
+			return err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, sm.dockerPath, "secret", "rm", name)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -727,6 +874,12 @@ func (sm *SecretsManager) removeSecret(ctx context.Context, name string) error {
 
 // removeConfig removes a Docker config.
 func (sm *SecretsManager) removeConfig(ctx context.Context, name string) error {
+	if sm.engine != nil {
+		if err := sm.engine.ConfigRemove(ctx, name); sm.useEngine(err) {
+			return err
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, sm.dockerPath, "config", "rm", name)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -949,6 +1102,22 @@ func (sm *SecretsManager) parseSecretList(output []byte, secretType SecretType)
 
 // getSecretDependencies finds services that use a specific secret.
 func (sm *SecretsManager) getSecretDependencies(ctx context.Context, secretID string) ([]string, error) {
+	if sm.engine != nil {
+		services, err := sm.engine.ServiceRefs(ctx)
+		if sm.useEngine(err) {
+			if err != nil {
+				return nil, err
+			}
+			dependencies := make([]string, 0)
+			for _, svc := range services {
+				if contains(svc.Secrets, secretID) {
+					dependencies = append(dependencies, svc.Name)
+				}
+			}
+			return dependencies, nil
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, sm.dockerPath, "service", "ls", "--format", "{{.ID}}")
 	output, err := cmd.Output()
 	if err != nil {
@@ -983,6 +1152,22 @@ func (sm *SecretsManager) getSecretDependencies(ctx context.Context, secretID st
 
 // getConfigDependencies finds services that use a specific config.
 func (sm *SecretsManager) getConfigDependencies(ctx context.Context, configID string) ([]string, error) {
+	if sm.engine != nil {
+		services, err := sm.engine.ServiceRefs(ctx)
+		if sm.useEngine(err) {
+			if err != nil {
+				return nil, err
+			}
+			dependencies := make([]string, 0)
+			for _, svc := range services {
+				if contains(svc.Configs, configID) {
+					dependencies = append(dependencies, svc.Name)
+				}
+			}
+			return dependencies, nil
+		}
+	}
+
 	cmd := exec.CommandContext(ctx, sm.dockerPath, "service", "ls", "--format", "{{.ID}}")
 	output, err := cmd.Output()
 	if err != nil {
@@ -8,22 +8,25 @@ import (
 
 	"github.com/MacJediWizard/keldris/internal/backup"
 	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/backup/fssnapshot"
 	"github.com/rs/zerolog"
 )
 
 // VolumeBackup handles backing up Docker volumes via restic.
 type VolumeBackup struct {
-	docker *DockerCLI
-	restic *backup.Restic
-	logger zerolog.Logger
+	docker    *DockerCLI
+	restic    *backup.Restic
+	snapshots *fssnapshot.Manager
+	logger    zerolog.Logger
 }
 
 // NewVolumeBackup creates a new VolumeBackup instance.
 func NewVolumeBackup(docker *DockerCLI, restic *backup.Restic, logger zerolog.Logger) *VolumeBackup {
 	return &VolumeBackup{
-		docker: docker,
-		restic: restic,
-		logger: logger.With().Str("component", "docker-volume-backup").Logger(),
+		docker:    docker,
+		restic:    restic,
+		snapshots: fssnapshot.NewManager(logger),
+		logger:    logger.With().Str("component", "docker-volume-backup").Logger(),
 	}
 }
 
@@ -77,12 +80,16 @@ func (vb *VolumeBackup) ListVolumeContents(ctx context.Context, volumeName strin
 
 // BackupVolumeOptions configures a Docker volume backup operation.
 type BackupVolumeOptions struct {
-	VolumeName       string
-	Tags             []string
-	Excludes         []string
-	PauseContainers  bool
-	BandwidthLimitKB *int
-	CompressionLevel *string
+	VolumeName      string
+	Tags            []string
+	Excludes        []string
+	PauseContainers bool
+	// FilesystemSnapshot reads the volume from an LVM, ZFS or btrfs
+	// snapshot. Containers are only paused if the volume cannot be
+	// snapshotted.
+	FilesystemSnapshot bool
+	BandwidthLimitKB   *int
+	CompressionLevel   *string
 }
 
 // BackupVolume backs up a Docker volume using restic.
@@ -98,16 +105,6 @@ func (vb *VolumeBackup) BackupVolume(ctx context.Context, cfg backends.ResticCon
 		return nil, err
 	}
 
-	// Find and optionally pause containers using this volume.
-	var pausedContainers []string
-	if opts.PauseContainers {
-		pausedContainers, err = vb.pauseVolumeContainers(ctx, opts.VolumeName)
-		if err != nil {
-			return nil, fmt.Errorf("pause containers for volume %s: %w", opts.VolumeName, err)
-		}
-		defer vb.unpauseContainers(ctx, pausedContainers)
-	}
-
 	tags := append(opts.Tags, "docker-volume:"+opts.VolumeName)
 
 	backupOpts := &backup.BackupOptions{
@@ -115,6 +112,29 @@ func (vb *VolumeBackup) BackupVolume(ctx context.Context, cfg backends.ResticCon
 		CompressionLevel: opts.CompressionLevel,
 	}
 
+	// A snapshot is consistent without pausing the containers.
+	pause := opts.PauseContainers
+	if opts.FilesystemSnapshot {
+		session, err := vb.snapshots.Snapshot(ctx, []string{mountpoint}, false)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot volume %s: %w", opts.VolumeName, err)
+		}
+		defer session.Close()
+		if len(session.Paths) > 0 {
+			backupOpts.PathMounts = session.Paths
+			pause = false
+		}
+	}
+
+	// Find and optionally pause containers using this volume.
+	if pause {
+		pausedContainers, err := vb.pauseVolumeContainers(ctx, opts.VolumeName)
+		if err != nil {
+			return nil, fmt.Errorf("pause containers for volume %s: %w", opts.VolumeName, err)
+		}
+		defer vb.unpauseContainers(ctx, pausedContainers)
+	}
+
 	stats, err := vb.restic.BackupWithOptions(ctx, cfg, []string{mountpoint}, opts.Excludes, tags, backupOpts)
 	if err != nil {
 		return nil, fmt.Errorf("backup volume %s: %w", opts.VolumeName, err)
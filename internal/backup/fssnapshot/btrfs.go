@@ -0,0 +1,129 @@
+package fssnapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// btrfsProvider snapshots btrfs subvolumes.
+type btrfsProvider struct {
+	run CommandRunner
+}
+
+// NewBtrfsProvider creates a provider for btrfs subvolumes.
+func NewBtrfsProvider(run CommandRunner) Provider {
+	return &btrfsProvider{run: run}
+}
+
+// Name returns "btrfs".
+func (p *btrfsProvider) Name() string {
+	return "btrfs"
+}
+
+// Volume returns the innermost subvolume containing path. Snapshots do not
+// descend into nested subvolumes, so the subvolume of the path itself is
+// snapshotted rather than the one mounted at m.
+func (p *btrfsProvider) Volume(_ context.Context, m *Mount, path string) (*Volume, error) {
+	if m.FSType != "btrfs" {
+		return nil, ErrUnsupported
+	}
+
+	dir := path
+	for {
+		root, err := isSubvolumeRoot(dir)
+		if err != nil {
+			return nil, err
+		}
+		if root {
+			break
+		}
+		if dir == m.MountPoint || dir == filepath.Dir(dir) {
+			return nil, fmt.Errorf("%w: %s is not mounted from a subvolume", ErrUnsupported, m.MountPoint)
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	return &Volume{
+		Provider: p.Name(),
+		Name:     dir,
+		Path:     dir,
+		Root:     "/",
+		Device:   m.Source,
+		FSType:   m.FSType,
+	}, nil
+}
+
+// snapshotPath returns where the read-only snapshot subvolume of v is
+// created. It must be on the same filesystem, so it lives in v itself.
+func snapshotPath(v *Volume, name string) string {
+	return filepath.Join(v.Path, "."+name)
+}
+
+// Snapshot creates a read-only snapshot of each subvolume and mounts it by
+// subvolume ID.
+func (p *btrfsProvider) Snapshot(ctx context.Context, name string, volumes []*Volume, dirs []string) ([]*Snapshot, error) {
+	var snaps []*Snapshot
+	for i, v := range volumes {
+		snap := &Snapshot{Volume: v, Name: snapshotPath(v, name), Dir: dirs[i]}
+		if _, err := p.run(ctx, "btrfs", "subvolume", "snapshot", "-r", v.Path, snap.Name); err != nil {
+			p.releaseAll(snaps)
+			return nil, fmt.Errorf("create snapshot of %s: %w", v.Path, err)
+		}
+		snaps = append(snaps, snap)
+	}
+
+	for _, snap := range snaps {
+		out, err := p.run(ctx, "btrfs", "inspect-internal", "rootid", snap.Name)
+		if err != nil {
+			p.releaseAll(snaps)
+			return nil, fmt.Errorf("get subvolume id of %s: %w", snap.Name, err)
+		}
+		subvolID := "subvolid=" + strings.TrimSpace(string(out))
+		if err := mountReadOnly(ctx, p.run, "btrfs", snap.Volume.Device, snap.Dir, subvolID); err != nil {
+			p.releaseAll(snaps)
+			return nil, err
+		}
+	}
+	return snaps, nil
+}
+
+// releaseAll releases snapshots after a failed Snapshot.
+func (p *btrfsProvider) releaseAll(snaps []*Snapshot) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	for _, snap := range snaps {
+		p.Release(ctx, snap)
+	}
+}
+
+// Release unmounts and deletes the snapshot subvolume.
+func (p *btrfsProvider) Release(ctx context.Context, snap *Snapshot) error {
+	if err := unmount(ctx, p.run, snap.Dir); err != nil {
+		return err
+	}
+	if _, err := p.run(ctx, "btrfs", "subvolume", "delete", snap.Name); err != nil {
+		return fmt.Errorf("delete snapshot %s: %w", snap.Name, err)
+	}
+	return nil
+}
+
+// CleanupStale deletes snapshot subvolumes left in the top directory of
+// each mounted btrfs subvolume.
+func (p *btrfsProvider) CleanupStale(ctx context.Context, mounts []*Mount) error {
+	var errs []error
+	for _, m := range mounts {
+		if m.FSType != "btrfs" {
+			continue
+		}
+		matches, _ := filepath.Glob(filepath.Join(m.MountPoint, "."+namePrefix+"*"))
+		for _, snap := range matches {
+			if _, err := p.run(ctx, "btrfs", "subvolume", "delete", snap); err != nil {
+				errs = append(errs, fmt.Errorf("delete snapshot %s: %w", snap, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,419 @@
+// Package fssnapshot takes filesystem-level snapshots of backup paths on LVM
+// thin volumes, ZFS datasets and btrfs subvolumes, so that restic reads a
+// crash-consistent, read-only copy of the data instead of live files.
+//
+// A Manager detects which volume each path lives on, snapshots all of them
+// together and mounts every snapshot read-only below its run directory. The
+// returned Session maps each backup path to the same path in its snapshot;
+// pass it to restic as backup.BackupOptions.PathMounts so that the restic
+// snapshot still records the original paths.
+package fssnapshot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// DefaultRunDir is where snapshots are mounted while a backup reads them.
+const DefaultRunDir = "/run/keldris/snapshots"
+
+// namePrefix starts the name of every snapshot, logical volume and mount
+// directory this package creates, so leftovers of a crashed run can be found.
+const namePrefix = "keldris-snap-"
+
+// releaseTimeout bounds cleanup, which must run even after the backup's
+// context was cancelled.
+const releaseTimeout = 2 * time.Minute
+
+// ErrUnsupported is returned for paths that are not on a volume any provider
+// can snapshot.
+var ErrUnsupported = errors.New("filesystem snapshots not supported")
+
+// CommandRunner runs a command and returns its standard output. Errors
+// include the command's standard error.
+type CommandRunner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// ExecRunner runs commands with os/exec.
+func ExecRunner(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.Bytes(), fmt.Errorf("%s: %s: %w", name, msg, err)
+		}
+		return stdout.Bytes(), fmt.Errorf("%s: %w", name, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Volume is something a provider snapshots as a unit: an LVM logical
+// volume, a ZFS dataset or a btrfs subvolume.
+type Volume struct {
+	Provider string
+	// Name identifies the volume to its provider: vg/lv, the dataset name
+	// or the subvolume's path.
+	Name string
+	// Path is the live directory whose contents the snapshot captures.
+	Path string
+	// Root is the directory of the snapshot that corresponds to Path. It
+	// is "/" unless a subdirectory of the filesystem is mounted at Path.
+	Root   string
+	Device string
+	FSType string
+}
+
+// Snapshot is a snapshot of a Volume, mounted read-only at Dir.
+type Snapshot struct {
+	Volume *Volume
+	// Name identifies the snapshot to its provider.
+	Name string
+	Dir  string
+}
+
+// Provider snapshots one kind of volume.
+type Provider interface {
+	// Name returns the provider name, such as "zfs".
+	Name() string
+
+	// Volume returns the volume containing path, which lives on mount m.
+	// It returns ErrUnsupported when m is not the provider's kind of volume.
+	Volume(ctx context.Context, m *Mount, path string) (*Volume, error)
+
+	// Snapshot snapshots the volumes at one point in time where the
+	// provider allows it and mounts snapshot i read-only at dirs[i]. On
+	// error, nothing is left behind.
+	Snapshot(ctx context.Context, name string, volumes []*Volume, dirs []string) ([]*Snapshot, error)
+
+	// Release unmounts and destroys a snapshot.
+	Release(ctx context.Context, snap *Snapshot) error
+
+	// CleanupStale destroys snapshots left behind by a previous process.
+	// Their mounts have already been removed.
+	CleanupStale(ctx context.Context, mounts []*Mount) error
+}
+
+// Manager detects volumes and takes snapshots across providers.
+type Manager struct {
+	providers []Provider
+	run       CommandRunner
+	runDir    string
+	mountInfo string
+	logger    zerolog.Logger
+}
+
+// NewManager creates a Manager with the LVM, ZFS and btrfs providers.
+func NewManager(logger zerolog.Logger) *Manager {
+	return NewManagerWithProviders(ExecRunner, DefaultRunDir, []Provider{
+		NewLVMProvider(ExecRunner),
+		NewZFSProvider(ExecRunner),
+		NewBtrfsProvider(ExecRunner),
+	}, logger)
+}
+
+// NewManagerWithProviders creates a Manager with the given providers, which
+// mounts snapshots below runDir.
+func NewManagerWithProviders(run CommandRunner, runDir string, providers []Provider, logger zerolog.Logger) *Manager {
+	return &Manager{
+		providers: providers,
+		run:       run,
+		runDir:    runDir,
+		mountInfo: DefaultMountInfoPath,
+		logger:    logger.With().Str("component", "fs_snapshot").Logger(),
+	}
+}
+
+// Detect returns the volume each path lives on. Paths that cannot be
+// snapshotted map to an error wrapping ErrUnsupported or describing why
+// detection failed.
+func (m *Manager) Detect(ctx context.Context, paths []string) (map[string]*Volume, map[string]error, error) {
+	mounts, err := readMountInfo(m.mountInfo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	volumes := make(map[string]*Volume)
+	failed := make(map[string]error)
+	for _, path := range paths {
+		vol, err := m.volumeFor(ctx, mounts, path)
+		if err != nil {
+			failed[path] = err
+			continue
+		}
+		volumes[path] = vol
+	}
+	return volumes, failed, nil
+}
+
+// volumeFor finds the volume holding path.
+func (m *Manager) volumeFor(ctx context.Context, mounts []*Mount, path string) (*Volume, error) {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	// The snapshots are mounted below runDir; mounting a snapshot over a
+	// path that contains it would hide the snapshot.
+	if within(m.runDir, resolved) {
+		return nil, fmt.Errorf("%w: path contains the snapshot directory %s", ErrUnsupported, m.runDir)
+	}
+
+	mount := findMount(mounts, resolved)
+	if mount == nil {
+		return nil, fmt.Errorf("%w: no mount found for %s", ErrUnsupported, resolved)
+	}
+	unsupported := fmt.Errorf("%w: %s is on %s", ErrUnsupported, resolved, mount.FSType)
+	for _, p := range m.providers {
+		vol, err := p.Volume(ctx, mount, resolved)
+		if errors.Is(err, ErrUnsupported) {
+			// Keep a provider's explanation of why it declined.
+			if err != ErrUnsupported {
+				unsupported = err
+			}
+			continue
+		}
+		return vol, err
+	}
+	return nil, unsupported
+}
+
+// resolvePath returns the absolute path without symlinks.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// Session holds the snapshots of one backup run.
+type Session struct {
+	// Paths maps each snapshotted backup path to the same path in its
+	// read-only snapshot.
+	Paths map[string]string
+	// Live lists the backup paths that are read from the live filesystem
+	// because they could not be snapshotted.
+	Live []string
+
+	snapshots []sessionSnapshot
+	dir       string
+	logger    zerolog.Logger
+}
+
+type sessionSnapshot struct {
+	provider Provider
+	snapshot *Snapshot
+}
+
+// Snapshot snapshots the volumes holding paths and mounts them read-only.
+// Volumes of one provider are captured at one point in time: ZFS datasets in
+// a single atomic zfs snapshot per pool, LVM volumes while their filesystems
+// are frozen. btrfs subvolumes and volumes of different providers are
+// snapshotted back to back.
+//
+// Unless required is set, paths that cannot be snapshotted are listed in
+// Session.Live and read from the live filesystem. The caller must Close the
+// session once the backup has finished.
+func (m *Manager) Snapshot(ctx context.Context, paths []string, required bool) (*Session, error) {
+	session := &Session{
+		Paths:  make(map[string]string),
+		logger: m.logger,
+	}
+
+	volumes, failed, err := m.Detect(ctx, paths)
+	if err != nil {
+		if required {
+			return nil, err
+		}
+		m.logger.Warn().Err(err).Msg("filesystem snapshots unavailable, reading live paths")
+		session.Live = paths
+		return session, nil
+	}
+	for _, path := range paths {
+		if err, ok := failed[path]; ok {
+			if required {
+				return nil, fmt.Errorf("snapshot %s: %w", path, err)
+			}
+			m.logger.Warn().Err(err).Str("path", path).Msg("cannot snapshot path, reading it live")
+			session.Live = append(session.Live, path)
+		}
+	}
+
+	// Snapshot every volume once, grouped by provider.
+	byProvider := make(map[string][]*Volume)
+	seen := make(map[string]*Volume)
+	for _, path := range paths {
+		vol, ok := volumes[path]
+		if !ok {
+			continue
+		}
+		key := vol.Provider + ":" + vol.Name
+		if existing, ok := seen[key]; ok {
+			volumes[path] = existing
+			continue
+		}
+		seen[key] = vol
+		byProvider[vol.Provider] = append(byProvider[vol.Provider], vol)
+	}
+	if len(seen) == 0 {
+		return session, nil
+	}
+
+	name := namePrefix + time.Now().UTC().Format("20060102t150405") + "-" + uuid.New().String()[:8]
+	session.dir = filepath.Join(m.runDir, name)
+	if err := os.MkdirAll(session.dir, 0700); err != nil {
+		return nil, fmt.Errorf("create snapshot directory: %w", err)
+	}
+
+	snapshots := make(map[*Volume]*Snapshot)
+	for _, p := range m.providers {
+		vols := byProvider[p.Name()]
+		if len(vols) == 0 {
+			continue
+		}
+		dirs := make([]string, len(vols))
+		for i := range vols {
+			dirs[i] = filepath.Join(session.dir, fmt.Sprintf("%s-%d", p.Name(), i))
+			if err := os.Mkdir(dirs[i], 0700); err != nil {
+				session.Close()
+				return nil, fmt.Errorf("create snapshot directory: %w", err)
+			}
+		}
+
+		snaps, err := p.Snapshot(ctx, name, vols, dirs)
+		if err != nil {
+			session.Close()
+			return nil, fmt.Errorf("%s snapshot: %w", p.Name(), err)
+		}
+		for _, snap := range snaps {
+			session.snapshots = append(session.snapshots, sessionSnapshot{provider: p, snapshot: snap})
+			snapshots[snap.Volume] = snap
+			m.logger.Info().
+				Str("provider", p.Name()).
+				Str("volume", snap.Volume.Name).
+				Str("snapshot", snap.Name).
+				Str("mount", snap.Dir).
+				Msg("filesystem snapshot created")
+		}
+	}
+
+	for path, vol := range volumes {
+		resolved, err := resolvePath(path)
+		if err != nil {
+			session.Close()
+			return nil, err
+		}
+		rel, err := filepath.Rel(vol.Path, resolved)
+		if err != nil {
+			session.Close()
+			return nil, err
+		}
+		session.Paths[path] = filepath.Join(snapshots[vol].Dir, vol.Root, rel)
+	}
+
+	return session, nil
+}
+
+// Close unmounts and destroys the session's snapshots. It runs with its own
+// timeout so that cleanup also happens after the backup was cancelled.
+func (s *Session) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(s.snapshots) - 1; i >= 0; i-- {
+		snap := s.snapshots[i]
+		if err := snap.provider.Release(ctx, snap.snapshot); err != nil {
+			s.logger.Error().Err(err).Str("snapshot", snap.snapshot.Name).Msg("failed to release filesystem snapshot")
+			errs = append(errs, err)
+			continue
+		}
+		os.Remove(snap.snapshot.Dir)
+		s.logger.Debug().Str("snapshot", snap.snapshot.Name).Msg("filesystem snapshot released")
+	}
+	s.snapshots = nil
+
+	if s.dir != "" {
+		// Only removes the directories once they are empty, so a failed
+		// unmount never exposes snapshot contents to deletion.
+		entries, _ := os.ReadDir(s.dir)
+		for _, e := range entries {
+			os.Remove(filepath.Join(s.dir, e.Name()))
+		}
+		os.Remove(s.dir)
+	}
+	return errors.Join(errs...)
+}
+
+// CleanupStale unmounts and destroys snapshots left behind by a process that
+// exited before closing its sessions. Call it before taking snapshots.
+func (m *Manager) CleanupStale(ctx context.Context) error {
+	mounts, err := readMountInfo(m.mountInfo)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	// Unmount the deepest mounts first.
+	for i := len(mounts) - 1; i >= 0; i-- {
+		mp := mounts[i].MountPoint
+		if mp == m.runDir || !within(mp, m.runDir) {
+			continue
+		}
+		if err := unmount(ctx, m.run, mp); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m.logger.Info().Str("mount", mp).Msg("unmounted stale filesystem snapshot")
+	}
+
+	for _, p := range m.providers {
+		if err := p.CleanupStale(ctx, mounts); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+		}
+	}
+
+	sessions, _ := os.ReadDir(m.runDir)
+	for _, s := range sessions {
+		if !strings.HasPrefix(s.Name(), namePrefix) {
+			continue
+		}
+		dir := filepath.Join(m.runDir, s.Name())
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+		os.Remove(dir)
+	}
+	return errors.Join(errs...)
+}
+
+// mountReadOnly mounts source read-only at dir.
+func mountReadOnly(ctx context.Context, run CommandRunner, fstype, source, dir string, options ...string) error {
+	opts := strings.Join(append([]string{"ro"}, options...), ",")
+	if _, err := run(ctx, "mount", "-t", fstype, "-o", opts, source, dir); err != nil {
+		return fmt.Errorf("mount snapshot: %w", err)
+	}
+	return nil
+}
+
+// unmount unmounts dir, treating a directory that is not mounted as done.
+func unmount(ctx context.Context, run CommandRunner, dir string) error {
+	if _, err := run(ctx, "umount", dir); err != nil {
+		if strings.Contains(err.Error(), "not mounted") || strings.Contains(err.Error(), "no mount point") {
+			return nil
+		}
+		return fmt.Errorf("unmount snapshot: %w", err)
+	}
+	return nil
+}
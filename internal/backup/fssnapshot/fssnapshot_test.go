@@ -0,0 +1,300 @@
+package fssnapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// fakeRunner records commands and answers them by prefix.
+type fakeRunner struct {
+	mu      sync.Mutex
+	calls   []string
+	outputs map[string]string
+	fail    string
+}
+
+func (f *fakeRunner) run(_ context.Context, name string, args ...string) ([]byte, error) {
+	call := strings.Join(append([]string{name}, args...), " ")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+	if f.fail != "" && strings.HasPrefix(call, f.fail) {
+		return nil, errors.New("command failed")
+	}
+	for prefix, out := range f.outputs {
+		if strings.HasPrefix(call, prefix) {
+			return []byte(out), nil
+		}
+	}
+	return nil, nil
+}
+
+// index returns the position of the first call starting with prefix, or -1.
+func (f *fakeRunner) index(prefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, call := range f.calls {
+		if strings.HasPrefix(call, prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *fakeRunner) count(prefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, call := range f.calls {
+		if strings.HasPrefix(call, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+const testLVS = `  253|3|vg0|srv|thin
+  253|4|vg0|data|thin
+  253|5|vg0|thick|linear
+`
+
+// testHost lays out directories that a fake mount table places on LVM, ZFS
+// and plain volumes.
+type testHost struct {
+	dir    string
+	runDir string
+	runner *fakeRunner
+	mgr    *Manager
+}
+
+func newTestHost(t *testing.T, extraMounts ...string) *testHost {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range []string{"srv/www", "data", "pool/db", "pool2", "backup", "other", "thick"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mountInfo := []string{
+		"22 1 8:1 / / rw - ext4 /dev/sda1 rw",
+		fmt.Sprintf("40 22 253:3 / %s/srv rw - xfs /dev/mapper/vg0-srv rw", dir),
+		fmt.Sprintf("41 22 253:4 / %s/data rw - ext4 /dev/mapper/vg0-data rw", dir),
+		fmt.Sprintf("42 22 0:45 / %s/pool rw - zfs tank/pool rw", dir),
+		fmt.Sprintf("43 22 0:46 / %s/pool2 rw - zfs tank/pool2 rw", dir),
+		fmt.Sprintf("44 22 0:47 / %s/backup rw - zfs backup/vol rw", dir),
+		fmt.Sprintf("45 22 8:17 / %s/other rw - ext4 /dev/sdb1 rw", dir),
+		fmt.Sprintf("46 22 253:5 / %s/thick rw - ext4 /dev/mapper/vg0-thick rw", dir),
+	}
+	mountInfo = append(mountInfo, extraMounts...)
+	mountInfoPath := filepath.Join(dir, "mountinfo")
+	if err := os.WriteFile(mountInfoPath, []byte(strings.Join(mountInfo, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &fakeRunner{outputs: map[string]string{
+		"lvs --noheadings --separator | -o lv_kernel_major": testLVS,
+		"btrfs inspect-internal rootid":                     "259\n",
+	}}
+	runDir := filepath.Join(dir, "run")
+	mgr := NewManagerWithProviders(runner.run, runDir, []Provider{
+		NewLVMProvider(runner.run),
+		NewZFSProvider(runner.run),
+		NewBtrfsProvider(runner.run),
+	}, zerolog.Nop())
+	mgr.mountInfo = mountInfoPath
+
+	return &testHost{dir: dir, runDir: runDir, runner: runner, mgr: mgr}
+}
+
+func (h *testHost) path(sub string) string {
+	return filepath.Join(h.dir, sub)
+}
+
+func TestManager_Snapshot(t *testing.T) {
+	h := newTestHost(t)
+	paths := []string{h.path("srv/www"), h.path("data"), h.path("pool/db"), h.path("pool2"), h.path("backup"), h.path("other")}
+
+	session, err := h.mgr.Snapshot(context.Background(), paths, false)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	if len(session.Live) != 1 || session.Live[0] != h.path("other") {
+		t.Errorf("Live = %v, want [%s]", session.Live, h.path("other"))
+	}
+	if len(session.Paths) != 5 {
+		t.Fatalf("Paths = %v, want 5 entries", session.Paths)
+	}
+
+	entries, err := os.ReadDir(h.runDir)
+	if err != nil || len(entries) != 1 || !strings.HasPrefix(entries[0].Name(), namePrefix) {
+		t.Fatalf("run directory entries = %v, %v", entries, err)
+	}
+	name := entries[0].Name()
+	sessionDir := filepath.Join(h.runDir, name)
+
+	want := map[string]string{
+		h.path("srv/www"): filepath.Join(sessionDir, "lvm-0", "www"),
+		h.path("data"):    filepath.Join(sessionDir, "lvm-1"),
+		h.path("pool/db"): filepath.Join(sessionDir, "zfs-0", "db"),
+		h.path("pool2"):   filepath.Join(sessionDir, "zfs-1"),
+		h.path("backup"):  filepath.Join(sessionDir, "zfs-2"),
+	}
+	for path, snapPath := range want {
+		if session.Paths[path] != snapPath {
+			t.Errorf("Paths[%s] = %q, want %q", path, session.Paths[path], snapPath)
+		}
+	}
+
+	// LVM snapshots are taken while both filesystems are frozen.
+	r := h.runner
+	lvcreate := "lvcreate --config " + lvmNoArchive + " --snapshot --setactivationskip n --activate y --name " + name
+	freeze, create, thaw := r.index("fsfreeze --freeze"), r.index(lvcreate+"-1 vg0/data"), r.index("fsfreeze --unfreeze")
+	if r.count("fsfreeze --freeze") != 2 || r.count("fsfreeze --unfreeze") != 2 {
+		t.Errorf("calls = %v, want both filesystems frozen and thawed", r.calls)
+	}
+	if freeze < 0 || r.index(lvcreate+"-0 vg0/srv") < freeze || create < 0 || thaw < create {
+		t.Errorf("calls = %v, want lvcreate between freeze and thaw", r.calls)
+	}
+	if r.index(fmt.Sprintf("mount -t xfs -o ro,nouuid /dev/vg0/%s-0 %s/lvm-0", name, sessionDir)) < thaw {
+		t.Errorf("calls = %v, want xfs snapshot mounted with nouuid after thaw", r.calls)
+	}
+
+	// One atomic zfs snapshot per pool.
+	if r.index(fmt.Sprintf("zfs snapshot tank/pool@%s tank/pool2@%s", name, name)) < 0 ||
+		r.index(fmt.Sprintf("zfs snapshot backup/vol@%s", name)) < 0 {
+		t.Errorf("calls = %v, want one zfs snapshot per pool", r.calls)
+	}
+	if r.index(fmt.Sprintf("mount -t zfs -o ro tank/pool@%s %s/zfs-0", name, sessionDir)) < 0 {
+		t.Errorf("calls = %v, want zfs snapshot mounted read-only", r.calls)
+	}
+
+	if err := session.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	for _, prefix := range []string{
+		"umount " + sessionDir + "/lvm-0",
+		"lvremove --config " + lvmNoArchive + " --yes vg0/" + name + "-0",
+		"lvremove --config " + lvmNoArchive + " --yes vg0/" + name + "-1",
+		"zfs destroy tank/pool@" + name,
+		"zfs destroy backup/vol@" + name,
+	} {
+		if r.index(prefix) < 0 {
+			t.Errorf("calls = %v, want %q", r.calls, prefix)
+		}
+	}
+	if _, err := os.Stat(sessionDir); !os.IsNotExist(err) {
+		t.Errorf("session directory still exists: %v", err)
+	}
+}
+
+func TestManager_SnapshotRequired(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{"plain filesystem", "other", "is on ext4"},
+		{"thick volume", "thick", "only thin volumes"},
+		{"contains run directory", "", "contains the snapshot directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHost(t)
+			_, err := h.mgr.Snapshot(context.Background(), []string{h.path("srv"), h.path(tt.path)}, true)
+			if !errors.Is(err, ErrUnsupported) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Snapshot() error = %v, want ErrUnsupported with %q", err, tt.wantErr)
+			}
+			if h.runner.count("lvcreate") != 0 {
+				t.Errorf("calls = %v, want no snapshots taken", h.runner.calls)
+			}
+		})
+	}
+
+	t.Run("auto reads them live", func(t *testing.T) {
+		h := newTestHost(t)
+		session, err := h.mgr.Snapshot(context.Background(), []string{h.path("other"), h.path("thick")}, false)
+		if err != nil {
+			t.Fatalf("Snapshot() error = %v", err)
+		}
+		if len(session.Paths) != 0 || len(session.Live) != 2 {
+			t.Errorf("Paths = %v, Live = %v", session.Paths, session.Live)
+		}
+		if err := session.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	})
+}
+
+func TestManager_SnapshotFailureCleansUp(t *testing.T) {
+	h := newTestHost(t)
+	h.runner.fail = "mount -t ext4"
+
+	_, err := h.mgr.Snapshot(context.Background(), []string{h.path("srv"), h.path("data"), h.path("pool")}, false)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	r := h.runner
+	if r.count("lvremove") != 2 {
+		t.Errorf("calls = %v, want both LVM snapshots removed", r.calls)
+	}
+	if r.count("fsfreeze --unfreeze") != 2 {
+		t.Errorf("calls = %v, want filesystems thawed", r.calls)
+	}
+	if r.count("zfs snapshot") != 0 {
+		t.Errorf("calls = %v, want no snapshots after the failure", r.calls)
+	}
+	entries, _ := os.ReadDir(h.runDir)
+	if len(entries) != 0 {
+		t.Errorf("run directory not cleaned up: %v", entries)
+	}
+}
+
+func TestManager_CleanupStale(t *testing.T) {
+	h := newTestHost(t)
+	stale := filepath.Join(h.runDir, namePrefix+"old", "lvm-0")
+	if err := os.MkdirAll(stale, 0700); err != nil {
+		t.Fatal(err)
+	}
+	h.mgr.mountInfo = filepath.Join(h.dir, "mountinfo-stale")
+	mountInfo := fmt.Sprintf("22 1 8:1 / / rw - ext4 /dev/sda1 rw\n50 22 253:9 / %s rw - xfs /dev/mapper/vg0-%sold--0 ro\n", stale, namePrefix)
+	if err := os.WriteFile(h.mgr.mountInfo, []byte(mountInfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h.runner.outputs["lvs --noheadings --separator | -o vg_name,lv_name"] = "  vg0|srv\n  vg0|" + namePrefix + "old-0\n"
+	h.runner.outputs["zfs list -H -t snapshot"] = "tank/pool@daily\ntank/pool@" + namePrefix + "old\n"
+
+	if err := h.mgr.CleanupStale(context.Background()); err != nil {
+		t.Fatalf("CleanupStale() error = %v", err)
+	}
+
+	r := h.runner
+	for _, prefix := range []string{
+		"umount " + stale,
+		"lvremove --config " + lvmNoArchive + " --yes vg0/" + namePrefix + "old-0",
+		"zfs destroy tank/pool@" + namePrefix + "old",
+	} {
+		if r.index(prefix) < 0 {
+			t.Errorf("calls = %v, want %q", r.calls, prefix)
+		}
+	}
+	if r.index("lvremove --config "+lvmNoArchive+" --yes vg0/srv") >= 0 || r.index("zfs destroy tank/pool@daily") >= 0 {
+		t.Errorf("calls = %v, removed a volume or snapshot it does not own", r.calls)
+	}
+	if _, err := os.Stat(filepath.Dir(stale)); !os.IsNotExist(err) {
+		t.Errorf("stale session directory still exists: %v", err)
+	}
+}
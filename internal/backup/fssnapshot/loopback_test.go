@@ -0,0 +1,111 @@
+//go:build linux
+
+package fssnapshot
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// requireTools skips the test unless it runs as root with the given
+// commands installed.
+func requireTools(t *testing.T, tools ...string) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("loopback tests require root")
+	}
+	for _, tool := range append([]string{"losetup", "mount", "umount"}, tools...) {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not installed", tool)
+		}
+	}
+}
+
+// loopDevice attaches a sparse image of the given size to a loop device.
+func loopDevice(t *testing.T, dir string, size int64) string {
+	t.Helper()
+	img := filepath.Join(dir, "disk.img")
+	f, err := os.Create(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	out, err := ExecRunner(context.Background(), "losetup", "--find", "--show", img)
+	if err != nil {
+		t.Skipf("attach loop device: %v", err)
+	}
+	dev := strings.TrimSpace(string(out))
+	t.Cleanup(func() {
+		ExecRunner(context.Background(), "losetup", "--detach", dev)
+	})
+	return dev
+}
+
+func TestBtrfsLoopback(t *testing.T) {
+	requireTools(t, "mkfs.btrfs", "btrfs")
+	ctx := context.Background()
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := loopDevice(t, dir, 256<<20)
+	mnt := filepath.Join(dir, "mnt")
+	if err := os.Mkdir(mnt, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range [][]string{
+		{"mkfs.btrfs", "-q", dev},
+		{"mount", dev, mnt},
+	} {
+		if _, err := ExecRunner(ctx, cmd[0], cmd[1:]...); err != nil {
+			t.Fatalf("%s: %v", cmd[0], err)
+		}
+	}
+	t.Cleanup(func() {
+		ExecRunner(context.Background(), "umount", mnt)
+	})
+
+	data := filepath.Join(mnt, "data")
+	if _, err := ExecRunner(ctx, "btrfs", "subvolume", "create", data); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(data, "file")
+	if err := os.WriteFile(file, []byte("before"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewManagerWithProviders(ExecRunner, filepath.Join(dir, "run"), []Provider{NewBtrfsProvider(ExecRunner)}, zerolog.Nop())
+	session, err := mgr.Snapshot(ctx, []string{data}, true)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	if err := os.WriteFile(file, []byte("after"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(session.Paths[data], "file"))
+	if err != nil || string(got) != "before" {
+		t.Errorf("snapshot file = %q, %v, want %q", got, err, "before")
+	}
+	if err := os.WriteFile(filepath.Join(session.Paths[data], "new"), nil, 0644); err == nil {
+		t.Error("snapshot is writable")
+	}
+
+	if err := session.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(data, "."+namePrefix+"*")); len(left) != 0 {
+		t.Errorf("snapshots left after Close: %v", left)
+	}
+}
@@ -0,0 +1,183 @@
+package fssnapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// freezeTimeout bounds the time filesystems stay frozen while LVM snapshots
+// are created. Anything that writes to a frozen filesystem blocks, so the
+// commands in that window are killed rather than left hanging.
+const freezeTimeout = 30 * time.Second
+
+// lvmNoArchive keeps lvcreate from writing metadata backups to /etc/lvm,
+// which may live on one of the frozen filesystems.
+const lvmNoArchive = "backup { backup = 0 archive = 0 }"
+
+// lvmFilesystems are the filesystems that support freezing and can be
+// mounted from a snapshot next to their origin.
+var lvmFilesystems = map[string]bool{"ext2": true, "ext3": true, "ext4": true, "xfs": true}
+
+// lvmProvider snapshots LVM thin volumes. Thin snapshots need no size
+// reservation and share the pool with their origin.
+type lvmProvider struct {
+	run CommandRunner
+}
+
+// NewLVMProvider creates a provider for LVM thin volumes.
+func NewLVMProvider(run CommandRunner) Provider {
+	return &lvmProvider{run: run}
+}
+
+// Name returns "lvm".
+func (p *lvmProvider) Name() string {
+	return "lvm"
+}
+
+// Volume matches the mount's device number against the active logical volumes.
+func (p *lvmProvider) Volume(ctx context.Context, m *Mount, _ string) (*Volume, error) {
+	if !strings.HasPrefix(m.Source, "/dev/") || !lvmFilesystems[m.FSType] {
+		return nil, ErrUnsupported
+	}
+
+	out, err := p.run(ctx, "lvs", "--noheadings", "--separator", "|",
+		"-o", "lv_kernel_major,lv_kernel_minor,vg_name,lv_name,segtype")
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, ErrUnsupported
+		}
+		return nil, fmt.Errorf("list logical volumes: %w", err)
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		if len(fields) != 5 {
+			continue
+		}
+		if fields[0]+":"+fields[1] != m.Device {
+			continue
+		}
+		name := fields[2] + "/" + fields[3]
+		if fields[4] != "thin" {
+			return nil, fmt.Errorf("%w: %s is a %s volume, only thin volumes can be snapshotted", ErrUnsupported, name, fields[4])
+		}
+		return &Volume{
+			Provider: p.Name(),
+			Name:     name,
+			Path:     m.MountPoint,
+			Root:     m.Root,
+			Device:   m.Source,
+			FSType:   m.FSType,
+		}, nil
+	}
+	return nil, ErrUnsupported
+}
+
+// Snapshot freezes the filesystems of all volumes, creates a thin snapshot
+// of each and thaws them before mounting the snapshots.
+func (p *lvmProvider) Snapshot(ctx context.Context, name string, volumes []*Volume, dirs []string) ([]*Snapshot, error) {
+	snaps, err := p.create(ctx, name, volumes, dirs)
+	if err != nil {
+		p.releaseAll(snaps)
+		return nil, err
+	}
+
+	for i, snap := range snaps {
+		var opts []string
+		if snap.Volume.FSType == "xfs" {
+			// The snapshot carries its origin's UUID.
+			opts = append(opts, "nouuid")
+		}
+		if err := mountReadOnly(ctx, p.run, snap.Volume.FSType, "/dev/"+snap.Name, dirs[i], opts...); err != nil {
+			p.releaseAll(snaps)
+			return nil, err
+		}
+	}
+	return snaps, nil
+}
+
+// create takes the snapshots while the filesystems are frozen. Nothing in
+// here may write to disk, including logging.
+func (p *lvmProvider) create(ctx context.Context, name string, volumes []*Volume, dirs []string) ([]*Snapshot, error) {
+	frozenCtx, cancel := context.WithTimeout(ctx, freezeTimeout)
+	defer cancel()
+
+	var frozen []string
+	defer func() {
+		thawCtx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+		defer cancel()
+		for _, dir := range frozen {
+			p.run(thawCtx, "fsfreeze", "--unfreeze", dir)
+		}
+	}()
+	// A single volume is frozen by lvcreate itself.
+	if len(volumes) > 1 {
+		for _, v := range volumes {
+			if _, err := p.run(frozenCtx, "fsfreeze", "--freeze", v.Path); err != nil {
+				return nil, fmt.Errorf("freeze %s: %w", v.Path, err)
+			}
+			frozen = append(frozen, v.Path)
+		}
+	}
+
+	var snaps []*Snapshot
+	for i, v := range volumes {
+		vg, _, _ := strings.Cut(v.Name, "/")
+		lvName := fmt.Sprintf("%s-%d", name, i)
+		_, err := p.run(frozenCtx, "lvcreate", "--config", lvmNoArchive,
+			"--snapshot", "--setactivationskip", "n", "--activate", "y",
+			"--name", lvName, v.Name)
+		if err != nil {
+			return snaps, fmt.Errorf("create snapshot of %s: %w", v.Name, err)
+		}
+		snaps = append(snaps, &Snapshot{Volume: v, Name: vg + "/" + lvName, Dir: dirs[i]})
+	}
+	return snaps, nil
+}
+
+// releaseAll releases snapshots after a failed Snapshot.
+func (p *lvmProvider) releaseAll(snaps []*Snapshot) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	for _, snap := range snaps {
+		p.Release(ctx, snap)
+	}
+}
+
+// Release unmounts the snapshot and removes its logical volume.
+func (p *lvmProvider) Release(ctx context.Context, snap *Snapshot) error {
+	if err := unmount(ctx, p.run, snap.Dir); err != nil {
+		return err
+	}
+	if _, err := p.run(ctx, "lvremove", "--config", lvmNoArchive, "--yes", snap.Name); err != nil {
+		return fmt.Errorf("remove snapshot %s: %w", snap.Name, err)
+	}
+	return nil
+}
+
+// CleanupStale removes logical volumes named like this package's snapshots.
+func (p *lvmProvider) CleanupStale(ctx context.Context, _ []*Mount) error {
+	out, err := p.run(ctx, "lvs", "--noheadings", "--separator", "|", "-o", "vg_name,lv_name")
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("list logical volumes: %w", err)
+	}
+
+	var errs []error
+	for _, line := range strings.Split(string(out), "\n") {
+		vg, lv, ok := strings.Cut(strings.TrimSpace(line), "|")
+		if !ok || !strings.HasPrefix(lv, namePrefix) {
+			continue
+		}
+		if _, err := p.run(ctx, "lvremove", "--config", lvmNoArchive, "--yes", vg+"/"+lv); err != nil {
+			errs = append(errs, fmt.Errorf("remove snapshot %s/%s: %w", vg, lv, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,113 @@
+package fssnapshot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultMountInfoPath is the kernel's mount table for the current process.
+const DefaultMountInfoPath = "/proc/self/mountinfo"
+
+// Mount is one entry of the mount table.
+type Mount struct {
+	Device     string // major:minor of the filesystem
+	Root       string // directory of the filesystem mounted at MountPoint
+	MountPoint string
+	FSType     string
+	Source     string // device path, dataset name or other source
+}
+
+// readMountInfo reads and parses a mountinfo file.
+func readMountInfo(path string) ([]*Mount, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read mount table: %w", err)
+	}
+	defer f.Close()
+	return parseMountInfo(f)
+}
+
+// parseMountInfo parses the format of /proc/<pid>/mountinfo:
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfo(r io.Reader) ([]*Mount, error) {
+	var mounts []*Mount
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+2 >= len(fields) {
+			return nil, fmt.Errorf("malformed mountinfo line: %q", line)
+		}
+		mounts = append(mounts, &Mount{
+			Device:     fields[2],
+			Root:       unescapeMountField(fields[3]),
+			MountPoint: unescapeMountField(fields[4]),
+			FSType:     fields[sep+1],
+			Source:     unescapeMountField(fields[sep+2]),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read mount table: %w", err)
+	}
+	return mounts, nil
+}
+
+// unescapeMountField decodes the octal escapes (\040 for space and so on)
+// the kernel uses in mount table fields.
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// findMount returns the mount that contains path, which must be absolute
+// and free of symlinks. When a mount point is mounted over, the most recent
+// mount wins.
+func findMount(mounts []*Mount, path string) *Mount {
+	var best *Mount
+	for _, m := range mounts {
+		if !within(path, m.MountPoint) {
+			continue
+		}
+		if best == nil || len(m.MountPoint) >= len(best.MountPoint) {
+			best = m
+		}
+	}
+	return best
+}
+
+// within reports whether path is dir or lies below it.
+func within(path, dir string) bool {
+	if dir == "/" || path == dir {
+		return true
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
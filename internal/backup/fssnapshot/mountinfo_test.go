@@ -0,0 +1,68 @@
+package fssnapshot
+
+import (
+	"strings"
+	"testing"
+)
+
+const testMountInfo = `22 1 259:2 / / rw,relatime shared:1 - ext4 /dev/nvme0n1p2 rw
+25 22 0:21 / /proc rw,nosuid shared:12 - proc proc rw
+40 22 253:3 / /srv rw,relatime shared:20 - xfs /dev/mapper/vg0-srv rw,attr2
+41 40 0:45 / /srv/pool rw shared:21 - zfs tank/data rw,xattr
+42 22 0:46 /@home /home rw,relatime shared:22 - btrfs /dev/sda3 rw,subvol=/@home
+43 22 0:47 / /mnt/my\040disk rw shared:23 master:1 - ext4 /dev/sdb1 rw
+44 40 253:3 / /srv rw,relatime shared:24 - xfs /dev/mapper/vg0-srv rw,attr2
+`
+
+func TestParseMountInfo(t *testing.T) {
+	mounts, err := parseMountInfo(strings.NewReader(testMountInfo))
+	if err != nil {
+		t.Fatalf("parseMountInfo() error = %v", err)
+	}
+	if len(mounts) != 7 {
+		t.Fatalf("got %d mounts, want 7", len(mounts))
+	}
+
+	home := mounts[4]
+	if home.Device != "0:46" || home.Root != "/@home" || home.MountPoint != "/home" ||
+		home.FSType != "btrfs" || home.Source != "/dev/sda3" {
+		t.Errorf("home = %+v", home)
+	}
+	if mounts[5].MountPoint != "/mnt/my disk" {
+		t.Errorf("escaped mount point = %q, want %q", mounts[5].MountPoint, "/mnt/my disk")
+	}
+	if mounts[5].FSType != "ext4" {
+		t.Errorf("fstype with optional fields = %q, want ext4", mounts[5].FSType)
+	}
+
+	if _, err := parseMountInfo(strings.NewReader("22 1 259:2 / / rw\n")); err == nil {
+		t.Error("expected error for malformed line")
+	}
+}
+
+func TestFindMount(t *testing.T) {
+	mounts, err := parseMountInfo(strings.NewReader(testMountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want int // index in mounts
+	}{
+		{"/", 0},
+		{"/etc/hosts", 0},
+		{"/srv/www", 6}, // mounted over
+		{"/srv/pool", 3},
+		{"/srv/pool/db", 3},
+		{"/srv/poolside", 6},
+		{"/home/alice", 4},
+		{"/mnt/my disk/file", 5},
+	}
+	for _, tt := range tests {
+		got := findMount(mounts, tt.path)
+		if got != mounts[tt.want] {
+			t.Errorf("findMount(%q) = %+v, want %+v", tt.path, got, mounts[tt.want])
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package fssnapshot
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// btrfsFirstFreeObjectID is the inode number of every btrfs subvolume's
+// top directory.
+const btrfsFirstFreeObjectID = 256
+
+// isSubvolumeRoot reports whether path is the top directory of a btrfs
+// subvolume.
+func isSubvolumeRoot(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, fmt.Errorf("%w: cannot stat %s", ErrUnsupported, path)
+	}
+	return info.IsDir() && stat.Ino == btrfsFirstFreeObjectID, nil
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package fssnapshot
+
+// isSubvolumeRoot reports whether path is the top directory of a btrfs
+// subvolume, which never applies on Windows.
+func isSubvolumeRoot(string) (bool, error) {
+	return false, ErrUnsupported
+}
@@ -0,0 +1,120 @@
+package fssnapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// zfsProvider snapshots ZFS datasets.
+type zfsProvider struct {
+	run CommandRunner
+}
+
+// NewZFSProvider creates a provider for ZFS datasets.
+func NewZFSProvider(run CommandRunner) Provider {
+	return &zfsProvider{run: run}
+}
+
+// Name returns "zfs".
+func (p *zfsProvider) Name() string {
+	return "zfs"
+}
+
+// Volume returns the dataset mounted at m.
+func (p *zfsProvider) Volume(_ context.Context, m *Mount, _ string) (*Volume, error) {
+	if m.FSType != "zfs" || strings.Contains(m.Source, "@") {
+		return nil, ErrUnsupported
+	}
+	return &Volume{
+		Provider: p.Name(),
+		Name:     m.Source,
+		Path:     m.MountPoint,
+		Root:     m.Root,
+		Device:   m.Source,
+		FSType:   m.FSType,
+	}, nil
+}
+
+// Snapshot snapshots the datasets of each pool in one zfs snapshot command,
+// which ZFS performs atomically, and mounts the snapshots.
+func (p *zfsProvider) Snapshot(ctx context.Context, name string, volumes []*Volume, dirs []string) ([]*Snapshot, error) {
+	snaps := make([]*Snapshot, len(volumes))
+	var pools []string
+	byPool := make(map[string][]*Snapshot)
+	for i, v := range volumes {
+		snaps[i] = &Snapshot{Volume: v, Name: v.Name + "@" + name, Dir: dirs[i]}
+		pool, _, _ := strings.Cut(v.Name, "/")
+		if _, ok := byPool[pool]; !ok {
+			pools = append(pools, pool)
+		}
+		byPool[pool] = append(byPool[pool], snaps[i])
+	}
+
+	// A single zfs snapshot command cannot span pools.
+	var created []*Snapshot
+	for _, pool := range pools {
+		args := []string{"snapshot"}
+		for _, snap := range byPool[pool] {
+			args = append(args, snap.Name)
+		}
+		if _, err := p.run(ctx, "zfs", args...); err != nil {
+			p.releaseAll(created)
+			return nil, fmt.Errorf("create snapshots in pool %s: %w", pool, err)
+		}
+		created = append(created, byPool[pool]...)
+	}
+
+	for _, snap := range snaps {
+		if err := mountReadOnly(ctx, p.run, "zfs", snap.Name, snap.Dir); err != nil {
+			p.releaseAll(created)
+			return nil, err
+		}
+	}
+	return snaps, nil
+}
+
+// releaseAll releases snapshots after a failed Snapshot.
+func (p *zfsProvider) releaseAll(snaps []*Snapshot) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	for _, snap := range snaps {
+		p.Release(ctx, snap)
+	}
+}
+
+// Release unmounts and destroys the snapshot.
+func (p *zfsProvider) Release(ctx context.Context, snap *Snapshot) error {
+	if err := unmount(ctx, p.run, snap.Dir); err != nil {
+		return err
+	}
+	if _, err := p.run(ctx, "zfs", "destroy", snap.Name); err != nil {
+		return fmt.Errorf("destroy snapshot %s: %w", snap.Name, err)
+	}
+	return nil
+}
+
+// CleanupStale destroys snapshots named like this package's snapshots.
+func (p *zfsProvider) CleanupStale(ctx context.Context, _ []*Mount) error {
+	out, err := p.run(ctx, "zfs", "list", "-H", "-t", "snapshot", "-o", "name")
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("list snapshots: %w", err)
+	}
+
+	var errs []error
+	for _, line := range strings.Split(string(out), "\n") {
+		snap := strings.TrimSpace(line)
+		if !strings.Contains(snap, "@"+namePrefix) {
+			continue
+		}
+		if _, err := p.run(ctx, "zfs", "destroy", snap); err != nil {
+			errs = append(errs, fmt.Errorf("destroy snapshot %s: %w", snap, err))
+		}
+	}
+	return errors.Join(errs...)
+}
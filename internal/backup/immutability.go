@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/MacJediWizard/keldris/internal/models"
@@ -19,6 +20,9 @@ var (
 	ErrImmutabilityNotFound = errors.New("immutability lock not found")
 	// ErrCannotShortenLock is returned when attempting to shorten a lock period.
 	ErrCannotShortenLock = errors.New("cannot shorten immutability period; can only extend")
+	// ErrObjectLockPending is returned when S3 Object Lock retention of a lock
+	// is still being applied.
+	ErrObjectLockPending = errors.New("s3 object lock retention is still being applied")
 )
 
 // ImmutabilityStore defines the interface for immutability persistence operations.
@@ -53,8 +57,13 @@ type ImmutabilityStore interface {
 
 // ImmutabilityManager manages immutability locks for snapshots.
 type ImmutabilityManager struct {
-	store  ImmutabilityStore
-	logger zerolog.Logger
+	store         ImmutabilityStore
+	objectLockers ObjectLockerResolver
+	logger        zerolog.Logger
+
+	// retaining holds the IDs of locks whose object retention is being applied.
+	retaining runGuard
+	jobs      sync.WaitGroup
 }
 
 // NewImmutabilityManager creates a new ImmutabilityManager.
@@ -65,6 +74,11 @@ func NewImmutabilityManager(store ImmutabilityStore, logger zerolog.Logger) *Imm
 	}
 }
 
+// SetObjectLockers enables S3 Object Lock enforcement of locks at the storage layer.
+func (m *ImmutabilityManager) SetObjectLockers(resolve ObjectLockerResolver) {
+	m.objectLockers = resolve
+}
+
 // LockSnapshot creates an immutability lock on a snapshot.
 func (m *ImmutabilityManager) LockSnapshot(
 	ctx context.Context,
@@ -75,6 +89,39 @@ func (m *ImmutabilityManager) LockSnapshot(
 	days int,
 	lockedBy *uuid.UUID,
 	reason string,
+) (*models.SnapshotImmutability, error) {
+	return m.lockSnapshot(ctx, orgID, repositoryID, snapshotID, shortID, days, lockedBy, reason, nil)
+}
+
+// LockSnapshotWithObjectLock creates an immutability lock on a snapshot and
+// enforces it with S3 Object Lock retention on the snapshot's objects, so it
+// holds even against someone with the bucket credentials. The bucket is
+// checked up front; retention is applied in the background and the lock's
+// S3ObjectLockStatus reports when it has taken effect.
+func (m *ImmutabilityManager) LockSnapshotWithObjectLock(
+	ctx context.Context,
+	orgID uuid.UUID,
+	repositoryID uuid.UUID,
+	snapshotID string,
+	shortID string,
+	days int,
+	lockedBy *uuid.UUID,
+	reason string,
+	mode models.S3ObjectLockMode,
+) (*models.SnapshotImmutability, error) {
+	return m.lockSnapshot(ctx, orgID, repositoryID, snapshotID, shortID, days, lockedBy, reason, &mode)
+}
+
+func (m *ImmutabilityManager) lockSnapshot(
+	ctx context.Context,
+	orgID uuid.UUID,
+	repositoryID uuid.UUID,
+	snapshotID string,
+	shortID string,
+	days int,
+	lockedBy *uuid.UUID,
+	reason string,
+	mode *models.S3ObjectLockMode,
 ) (*models.SnapshotImmutability, error) {
 	// Check if snapshot is already locked
 	existing, err := m.store.GetSnapshotImmutability(ctx, repositoryID, snapshotID)
@@ -94,10 +141,28 @@ func (m *ImmutabilityManager) LockSnapshot(
 		reason,
 	)
 
+	var locker ObjectLocker
+	if mode != nil {
+		// Check the bucket first so an unsupported backend leaves no lock row
+		// claiming storage-level protection that can never exist.
+		locker, err = m.objectLocker(ctx, repositoryID)
+		if err != nil {
+			return nil, err
+		}
+		lock.SetS3ObjectLock(*mode)
+	}
+
 	if err := m.store.CreateSnapshotImmutability(ctx, lock); err != nil {
 		return nil, fmt.Errorf("create immutability lock: %w", err)
 	}
 
+	if locker != nil {
+		if !m.retaining.claim(lock.ID) {
+			return nil, ErrObjectLockPending
+		}
+		m.retainObjects(ctx, locker, lock)
+	}
+
 	m.logger.Info().
 		Str("snapshot_id", snapshotID).
 		Str("repository_id", repositoryID.String()).
@@ -126,6 +191,20 @@ func (m *ImmutabilityManager) ExtendLock(
 		return nil, fmt.Errorf("lock has already expired")
 	}
 
+	// Retention is reapplied on every extension, which also retries locks
+	// whose retention failed or was interrupted by a restart.
+	var locker ObjectLocker
+	if lock.S3ObjectLockEnabled && lock.S3ObjectLockMode != nil {
+		locker, err = m.objectLocker(ctx, repositoryID)
+		if err != nil {
+			return nil, err
+		}
+		if !m.retaining.claim(lock.ID) {
+			return nil, ErrObjectLockPending
+		}
+		lock.SetS3ObjectLock(*lock.S3ObjectLockMode)
+	}
+
 	newLockedUntil := lock.LockedUntil.AddDate(0, 0, additionalDays)
 	lock.LockedUntil = newLockedUntil
 	lock.UpdatedAt = time.Now()
@@ -134,9 +213,16 @@ func (m *ImmutabilityManager) ExtendLock(
 	}
 
 	if err := m.store.UpdateSnapshotImmutability(ctx, lock); err != nil {
+		if locker != nil {
+			m.retaining.release(lock.ID)
+		}
 		return nil, fmt.Errorf("update immutability lock: %w", err)
 	}
 
+	if locker != nil {
+		m.retainObjects(ctx, locker, lock)
+	}
+
 	m.logger.Info().
 		Str("snapshot_id", snapshotID).
 		Str("repository_id", repositoryID.String()).
@@ -147,6 +233,60 @@ func (m *ImmutabilityManager) ExtendLock(
 	return lock, nil
 }
 
+// objectLocker resolves the ObjectLocker of a repository and checks that its
+// bucket has Object Lock enabled.
+func (m *ImmutabilityManager) objectLocker(ctx context.Context, repositoryID uuid.UUID) (ObjectLocker, error) {
+	if m.objectLockers == nil {
+		return nil, ErrObjectLockUnsupported
+	}
+	locker, err := m.objectLockers(ctx, repositoryID)
+	if err != nil {
+		return nil, err
+	}
+	if err := locker.CheckEnabled(ctx); err != nil {
+		return nil, fmt.Errorf("apply s3 object lock: %w", err)
+	}
+	return locker, nil
+}
+
+// retainObjects sets S3 Object Lock retention on the objects of a locked
+// snapshot until the lock expires. It runs in the background on a copy of
+// lock, which must already be claimed in m.retaining, and records the outcome
+// on the lock row.
+func (m *ImmutabilityManager) retainObjects(ctx context.Context, locker ObjectLocker, lock *models.SnapshotImmutability) {
+	job := *lock
+	ctx = context.WithoutCancel(ctx)
+
+	m.jobs.Add(1)
+	go func() {
+		defer m.jobs.Done()
+		defer m.retaining.release(job.ID)
+
+		count, err := lockSnapshotObjects(ctx, locker, job.SnapshotID, *job.S3ObjectLockMode, job.LockedUntil)
+		if err != nil {
+			job.FailS3ObjectLock(err.Error())
+			m.logger.Error().Err(err).
+				Str("snapshot_id", job.SnapshotID).
+				Str("repository_id", job.RepositoryID.String()).
+				Msg("failed to apply s3 object lock retention")
+		} else {
+			job.CompleteS3ObjectLock(count)
+			m.logger.Info().
+				Str("snapshot_id", job.SnapshotID).
+				Str("mode", string(*job.S3ObjectLockMode)).
+				Int("objects", count).
+				Time("retain_until", job.LockedUntil).
+				Msg("s3 object lock retention applied")
+		}
+
+		if err := m.store.UpdateSnapshotImmutability(ctx, &job); err != nil {
+			m.logger.Error().Err(err).
+				Str("lock_id", job.ID.String()).
+				Msg("failed to save s3 object lock status")
+		}
+	}()
+}
+
 // CheckDeleteAllowed checks if a snapshot can be deleted.
 // Returns nil if deletion is allowed, or an error with details if not.
 func (m *ImmutabilityManager) CheckDeleteAllowed(
@@ -0,0 +1,460 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// ManifestDirPrefix prefixes the staging directory of exported manifests,
+	// so a restore can find it among a snapshot's paths.
+	ManifestDirPrefix = "keldris-k8s-"
+	// IndexFile lists every exported object and volume in the staging directory.
+	IndexFile = "index.json"
+	// clusterDir holds cluster-scoped objects such as CRDs.
+	clusterDir = "_cluster"
+	// manifestVersion is the layout version written to the index.
+	manifestVersion = 1
+)
+
+// Cipher encrypts exported Secrets so they never reach the repository in
+// plain text. *crypto.KeyManager satisfies it.
+type Cipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// Manifest is the index of a Kubernetes backup.
+type Manifest struct {
+	Version    int             `json:"version"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Namespaces []string        `json:"namespaces"`
+	Resources  []ManifestEntry `json:"resources"`
+	Volumes    []VolumeEntry   `json:"volumes,omitempty"`
+	Warnings   []string        `json:"warnings,omitempty"`
+}
+
+// ManifestEntry is one exported object.
+type ManifestEntry struct {
+	Resource  Resource `json:"resource"`
+	Namespace string   `json:"namespace,omitempty"`
+	Name      string   `json:"name"`
+	// File is relative to the staging directory.
+	File      string `json:"file"`
+	Encrypted bool   `json:"encrypted,omitempty"`
+}
+
+// VolumeEntry is a PVC whose data is part of the backup.
+type VolumeEntry struct {
+	Namespace  string `json:"namespace"`
+	Claim      string `json:"claim"`
+	VolumeName string `json:"volume_name,omitempty"`
+	// Path is where the volume data was read on the node; empty if skipped.
+	Path       string `json:"path,omitempty"`
+	SkipReason string `json:"skip_reason,omitempty"`
+}
+
+// Backup exports Kubernetes workloads for a restic snapshot.
+type Backup struct {
+	client Client
+	cipher Cipher
+	logger zerolog.Logger
+}
+
+// NewBackup creates a new Kubernetes backup service. cipher may be nil when
+// Secrets are not exported.
+func NewBackup(client Client, cipher Cipher, logger zerolog.Logger) *Backup {
+	return &Backup{
+		client: client,
+		cipher: cipher,
+		logger: logger.With().Str("component", "kubernetes_backup").Logger(),
+	}
+}
+
+// BackupRun is a prepared backup: manifests are staged in Dir, pre hooks have
+// run and volumes are resolved. Finish must be called once the snapshot is taken.
+type BackupRun struct {
+	// Dir is the staging directory holding the exported manifests.
+	Dir      string
+	Manifest *Manifest
+
+	backup     *Backup
+	opts       *models.KubernetesBackupOptions
+	namespaces []string
+	scaled     []scaledWorkload
+}
+
+// Prepare exports manifests, runs pre hooks and resolves PVC data paths.
+func (b *Backup) Prepare(ctx context.Context, opts *models.KubernetesBackupOptions) (*BackupRun, error) {
+	if opts == nil {
+		opts = models.DefaultKubernetesOptions()
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid kubernetes options: %w", err)
+	}
+	if opts.IncludeSecrets && b.cipher == nil {
+		return nil, errors.New("secrets cannot be backed up without an encryption key")
+	}
+
+	namespaces, err := b.selectNamespaces(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(namespaces) == 0 {
+		return nil, errors.New("no namespaces to back up")
+	}
+
+	dir, err := os.MkdirTemp("", ManifestDirPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("create staging directory: %w", err)
+	}
+	run := &BackupRun{
+		Dir:        dir,
+		Manifest:   &Manifest{Version: manifestVersion, CreatedAt: time.Now(), Namespaces: namespaces},
+		backup:     b,
+		opts:       opts,
+		namespaces: namespaces,
+	}
+
+	if err := run.export(ctx); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := run.runHooks(ctx, models.KubernetesHookPre); err != nil {
+		if finishErr := run.Finish(ctx); finishErr != nil {
+			b.logger.Warn().Err(finishErr).Msg("failed to clean up after pre hook failure")
+		}
+		return nil, err
+	}
+	if opts.BackupVolumes {
+		run.resolveVolumes(ctx)
+	}
+	if err := run.writeIndex(); err != nil {
+		if finishErr := run.Finish(ctx); finishErr != nil {
+			b.logger.Warn().Err(finishErr).Msg("failed to clean up after index failure")
+		}
+		return nil, err
+	}
+
+	b.logger.Info().
+		Strs("namespaces", namespaces).
+		Int("resources", len(run.Manifest.Resources)).
+		Int("volumes", len(run.Paths())-1).
+		Msg("kubernetes backup prepared")
+	return run, nil
+}
+
+// Paths returns the paths to snapshot: the staging directory and every
+// resolved volume.
+func (r *BackupRun) Paths() []string {
+	paths := []string{r.Dir}
+	for _, v := range r.Manifest.Volumes {
+		if v.Path != "" {
+			paths = append(paths, v.Path)
+		}
+	}
+	return paths
+}
+
+// Finish runs post hooks, scales quiesced workloads back up and removes the
+// staging directory. It is safe to call after a failed snapshot.
+func (r *BackupRun) Finish(ctx context.Context) error {
+	var errs []error
+	if err := r.runHooks(ctx, models.KubernetesHookPost); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.scaleUp(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := os.RemoveAll(r.Dir); err != nil {
+		errs = append(errs, fmt.Errorf("remove staging directory: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// selectNamespaces returns the namespaces to back up, sorted.
+func (b *Backup) selectNamespaces(ctx context.Context, opts *models.KubernetesBackupOptions) ([]string, error) {
+	objs, err := b.client.List(ctx, NamespaceResource, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("list namespaces: %w", err)
+	}
+	existing := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		existing = append(existing, obj.Name())
+	}
+
+	var selected []string
+	if len(opts.Namespaces) > 0 {
+		for _, ns := range opts.Namespaces {
+			if !slices.Contains(existing, ns) {
+				return nil, fmt.Errorf("namespace %s does not exist", ns)
+			}
+			selected = append(selected, ns)
+		}
+	} else {
+		for _, ns := range existing {
+			if slices.Contains(opts.ExcludeNamespaces, ns) || slices.Contains(models.DefaultKubernetesExcludedNamespaces, ns) {
+				continue
+			}
+			selected = append(selected, ns)
+		}
+	}
+	slices.Sort(selected)
+	return selected, nil
+}
+
+// export writes the manifests of every selected namespace to the staging directory.
+func (r *BackupRun) export(ctx context.Context) error {
+	client := r.backup.client
+
+	var customs []Resource
+	if r.opts.IncludeCRDs {
+		var crds []Object
+		var err error
+		customs, crds, err = customResources(ctx, client)
+		if err != nil {
+			return err
+		}
+		for _, crd := range crds {
+			if err := r.writeObject(CRDResource, crd); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, ns := range r.namespaces {
+		nsObj, err := client.Get(ctx, NamespaceResource, "", ns)
+		if err != nil {
+			return fmt.Errorf("get namespace %s: %w", ns, err)
+		}
+		if err := r.writeObject(NamespaceResource, nsObj); err != nil {
+			return err
+		}
+
+		resources := slices.Clone(namespacedResources)
+		for _, res := range customs {
+			if res.Namespaced {
+				resources = append(resources, res)
+			}
+		}
+		for _, res := range resources {
+			if res == SecretResource && !r.opts.IncludeSecrets {
+				continue
+			}
+			objs, err := client.List(ctx, res, ns, r.opts.LabelSelector)
+			if err != nil {
+				if errors.Is(err, ErrNotFound) {
+					// The API group is not served by this cluster.
+					continue
+				}
+				return fmt.Errorf("list %s in %s: %w", res.Name, ns, err)
+			}
+			for _, obj := range objs {
+				if skipExport(res, obj) {
+					continue
+				}
+				if err := r.writeObject(res, obj); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, res := range customs {
+		if res.Namespaced {
+			continue
+		}
+		objs, err := client.List(ctx, res, "", "")
+		if err != nil {
+			r.warn(fmt.Sprintf("list %s: %v", res.Name, err))
+			continue
+		}
+		for _, obj := range objs {
+			if err := r.writeObject(res, obj); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeObject sanitizes an object and writes it to the staging directory,
+// encrypting Secrets.
+func (r *BackupRun) writeObject(res Resource, obj Object) error {
+	obj = sanitize(obj)
+	namespace := ""
+	dirName := clusterDir
+	if res.Namespaced {
+		namespace = obj.Namespace()
+		dirName = namespace
+	}
+	rel := filepath.Join(dirName, resourceDirName(res), obj.Name()+".json")
+
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal %s %s: %w", res.Kind, obj.Name(), err)
+	}
+	encrypted := res == SecretResource
+	if encrypted {
+		data, err = r.backup.cipher.Encrypt(data)
+		if err != nil {
+			return fmt.Errorf("encrypt secret %s/%s: %w", namespace, obj.Name(), err)
+		}
+		rel += ".enc"
+	}
+
+	path := filepath.Join(r.Dir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create manifest directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("write manifest %s: %w", rel, err)
+	}
+
+	r.Manifest.Resources = append(r.Manifest.Resources, ManifestEntry{
+		Resource:  res,
+		Namespace: namespace,
+		Name:      obj.Name(),
+		File:      rel,
+		Encrypted: encrypted,
+	})
+	return nil
+}
+
+// resourceDirName keeps resources of different API groups with the same
+// plural name apart.
+func resourceDirName(res Resource) string {
+	if res.Group == "" {
+		return res.Name
+	}
+	return res.Name + "." + res.Group
+}
+
+// resolveVolumes finds the node-local data path of each bound PVC.
+func (r *BackupRun) resolveVolumes(ctx context.Context) {
+	for _, ns := range r.namespaces {
+		claims, err := r.backup.client.List(ctx, PVCResource, ns, r.opts.LabelSelector)
+		if err != nil {
+			r.warn(fmt.Sprintf("list persistent volume claims in %s: %v", ns, err))
+			continue
+		}
+		for _, claim := range claims {
+			entry := VolumeEntry{
+				Namespace:  ns,
+				Claim:      claim.Name(),
+				VolumeName: nestedString(claim, "spec", "volumeName"),
+			}
+			path, err := ResolveVolumePath(ctx, r.backup.client, r.opts.KubeletRootDir, ns, claim.Name())
+			switch {
+			case err != nil:
+				entry.SkipReason = err.Error()
+			case path == "":
+				entry.SkipReason = "not mounted on this node"
+			default:
+				entry.Path = path
+			}
+			if entry.SkipReason != "" {
+				r.warn(fmt.Sprintf("volume %s/%s skipped: %s", ns, claim.Name(), entry.SkipReason))
+			}
+			r.Manifest.Volumes = append(r.Manifest.Volumes, entry)
+		}
+	}
+}
+
+// ResolveVolumePath returns the directory on this node holding the data of a
+// PVC, or "" when the data is not reachable from here. hostPath and local
+// volumes are read in place; other volumes are read through the kubelet
+// mount of a running pod using the claim.
+func ResolveVolumePath(ctx context.Context, client Client, kubeletRoot, namespace, claim string) (string, error) {
+	pvc, err := client.Get(ctx, PVCResource, namespace, claim)
+	if err != nil {
+		return "", err
+	}
+	pvName := nestedString(pvc, "spec", "volumeName")
+	if pvName == "" {
+		return "", errors.New("claim is not bound")
+	}
+
+	pv, err := client.Get(ctx, PVResource, "", pvName)
+	if err != nil {
+		return "", err
+	}
+	for _, source := range []string{"hostPath", "local"} {
+		if path := nestedString(pv, "spec", source, "path"); path != "" {
+			if dirExists(path) {
+				return path, nil
+			}
+			return "", nil
+		}
+	}
+
+	if kubeletRoot == "" {
+		kubeletRoot = models.DefaultKubernetesOptions().KubeletRootDir
+	}
+	pods, err := client.List(ctx, PodResource, namespace, "")
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods {
+		if nestedString(pod, "status", "phase") != "Running" || !podUsesClaim(pod, claim) {
+			continue
+		}
+		uid := nestedString(pod, "metadata", "uid")
+		if uid == "" {
+			continue
+		}
+		matches, _ := filepath.Glob(filepath.Join(kubeletRoot, "pods", uid, "volumes", "*", pvName))
+		for _, match := range matches {
+			// CSI volumes are mounted one level deeper.
+			if mount := filepath.Join(match, "mount"); dirExists(mount) {
+				return mount, nil
+			}
+			if dirExists(match) {
+				return match, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// podUsesClaim reports whether a pod mounts the given PVC.
+func podUsesClaim(pod Object, claim string) bool {
+	for _, vol := range nestedSlice(pod, "spec", "volumes") {
+		if nestedString(vol, "persistentVolumeClaim", "claimName") == claim {
+			return true
+		}
+	}
+	return false
+}
+
+// writeIndex writes the manifest index to the staging directory.
+func (r *BackupRun) writeIndex() error {
+	data, err := json.MarshalIndent(r.Manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(r.Dir, IndexFile), data, 0o600); err != nil {
+		return fmt.Errorf("write manifest index: %w", err)
+	}
+	return nil
+}
+
+// warn records a non-fatal problem in the manifest and the log.
+func (r *BackupRun) warn(msg string) {
+	r.Manifest.Warnings = append(r.Manifest.Warnings, msg)
+	r.backup.logger.Warn().Msg(msg)
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,293 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/rs/zerolog"
+)
+
+// newTestCluster returns a cluster with a "shop" namespace running a web
+// Deployment whose pod mounts the CSI-backed "data" claim, a hostPath-backed
+// "logs" claim, an unbound "cache" claim and a Widget custom resource.
+func newTestCluster(t *testing.T) (*fakeClient, string, string) {
+	t.Helper()
+	kubelet := t.TempDir()
+	csiMount := filepath.Join(kubelet, "pods", "pod-uid-1", "volumes", "kubernetes.io~csi", "pv-data", "mount")
+	if err := os.MkdirAll(csiMount, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	hostPath := t.TempDir()
+
+	webLabels := map[string]interface{}{"app": "web"}
+	client := newFakeClient(
+		testNamespace("shop"),
+		testNamespace("kube-system"),
+		testNamespace("staging"),
+		testObject("v1", "ConfigMap", "shop", "settings", map[string]interface{}{
+			"data": map[string]interface{}{"mode": "prod"},
+		}),
+		testObject("v1", "ConfigMap", "shop", "kube-root-ca.crt", nil),
+		testObject("v1", "ConfigMap", "kube-system", "coredns", nil),
+		testObject("v1", "Secret", "shop", "db-creds", map[string]interface{}{
+			"type": "Opaque",
+			"data": map[string]interface{}{"password": "aHVudGVyMg=="},
+		}),
+		testObject("v1", "Secret", "shop", "default-token", map[string]interface{}{
+			"type": "kubernetes.io/service-account-token",
+		}),
+		testObject("v1", "PersistentVolumeClaim", "shop", "data", map[string]interface{}{
+			"spec":   map[string]interface{}{"volumeName": "pv-data"},
+			"status": map[string]interface{}{"phase": "Bound"},
+		}),
+		testObject("v1", "PersistentVolumeClaim", "shop", "logs", map[string]interface{}{
+			"spec": map[string]interface{}{"volumeName": "pv-logs"},
+		}),
+		testObject("v1", "PersistentVolumeClaim", "shop", "cache", map[string]interface{}{
+			"spec": map[string]interface{}{},
+		}),
+		testObject("v1", "PersistentVolume", "", "pv-data", map[string]interface{}{
+			"spec": map[string]interface{}{"csi": map[string]interface{}{"driver": "ebs.csi.aws.com"}},
+		}),
+		testObject("v1", "PersistentVolume", "", "pv-logs", map[string]interface{}{
+			"spec": map[string]interface{}{"hostPath": map[string]interface{}{"path": hostPath}},
+		}),
+		testObject("v1", "Service", "shop", "web", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"clusterIP":  "10.96.0.12",
+				"clusterIPs": []interface{}{"10.96.0.12"},
+				"type":       "NodePort",
+				"ports":      []interface{}{map[string]interface{}{"port": float64(80), "nodePort": float64(30080)}},
+			},
+		}),
+		testDeployment("shop", "web", 2, webLabels, map[string]interface{}{
+			"volumes": []interface{}{
+				map[string]interface{}{"name": "data", "persistentVolumeClaim": map[string]interface{}{"claimName": "data"}},
+				map[string]interface{}{"name": "cfg", "configMap": map[string]interface{}{"name": "settings"}},
+			},
+			"containers": []interface{}{map[string]interface{}{
+				"name":    "web",
+				"envFrom": []interface{}{map[string]interface{}{"secretRef": map[string]interface{}{"name": "db-creds"}}},
+			}},
+		}),
+		testPod("shop", "web-1", "pod-uid-1", "Running", webLabels, "data"),
+		testObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "widgets.example.com", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"group": "example.com",
+				"scope": "Namespaced",
+				"names": map[string]interface{}{"kind": "Widget", "plural": "widgets"},
+				"versions": []interface{}{
+					map[string]interface{}{"name": "v1beta1", "storage": false},
+					map[string]interface{}{"name": "v1", "storage": true},
+				},
+			},
+		}),
+		testObject("example.com/v1", "Widget", "shop", "w1", map[string]interface{}{
+			"spec": map[string]interface{}{"size": float64(3)},
+		}),
+	)
+	return client, kubelet, csiMount
+}
+
+func testBackupOptions(kubelet string) *models.KubernetesBackupOptions {
+	opts := models.DefaultKubernetesOptions()
+	opts.KubeletRootDir = kubelet
+	return opts
+}
+
+func TestBackupPrepare(t *testing.T) {
+	client, kubelet, csiMount := newTestCluster(t)
+	opts := testBackupOptions(kubelet)
+	opts.Hooks = []models.KubernetesHook{
+		{Name: "flush", Phase: models.KubernetesHookPre, Action: models.KubernetesHookExec, LabelSelector: "app=web", Container: "web", Command: []string{"sync"}},
+		{Name: "quiesce", Phase: models.KubernetesHookPre, Action: models.KubernetesHookScaleDown, LabelSelector: "app=web"},
+		{Name: "notify", Phase: models.KubernetesHookPost, Action: models.KubernetesHookExec, LabelSelector: "app=web", Command: []string{"echo", "done"}},
+	}
+
+	run, err := NewBackup(client, xorCipher{}, zerolog.Nop()).Prepare(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+
+	if want := []string{"shop", "staging"}; !slices.Equal(run.Manifest.Namespaces, want) {
+		t.Errorf("namespaces = %v, want %v", run.Manifest.Namespaces, want)
+	}
+
+	files := make(map[string]ManifestEntry)
+	for _, entry := range run.Manifest.Resources {
+		files[entry.File] = entry
+	}
+	for _, want := range []string{
+		"_cluster/customresourcedefinitions.apiextensions.k8s.io/widgets.example.com.json",
+		"_cluster/namespaces/shop.json",
+		"shop/configmaps/settings.json",
+		"shop/secrets/db-creds.json.enc",
+		"shop/persistentvolumeclaims/data.json",
+		"shop/services/web.json",
+		"shop/deployments.apps/web.json",
+		"shop/widgets.example.com/w1.json",
+	} {
+		if _, ok := files[want]; !ok {
+			t.Errorf("missing manifest %s", want)
+		}
+		if _, err := os.Stat(filepath.Join(run.Dir, want)); err != nil {
+			t.Errorf("manifest file %s: %v", want, err)
+		}
+	}
+	for _, unwanted := range []string{"shop/configmaps/kube-root-ca.crt.json", "shop/secrets/default-token.json.enc", "kube-system/configmaps/coredns.json"} {
+		if _, ok := files[unwanted]; ok {
+			t.Errorf("unexpected manifest %s", unwanted)
+		}
+	}
+
+	// Secrets must not be readable without the key.
+	raw, err := os.ReadFile(filepath.Join(run.Dir, "shop/secrets/db-creds.json.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "aHVudGVyMg==") {
+		t.Error("secret data stored in plain text")
+	}
+
+	// Manifests are sanitized and record the original replica count.
+	var deployment Object
+	data, _ := os.ReadFile(filepath.Join(run.Dir, "shop/deployments.apps/web.json"))
+	if err := json.Unmarshal(data, &deployment); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := deployment["status"]; ok {
+		t.Error("status not stripped")
+	}
+	for _, field := range []string{"uid", "resourceVersion", "creationTimestamp", "managedFields"} {
+		if _, ok := deployment.Metadata()[field]; ok {
+			t.Errorf("metadata.%s not stripped", field)
+		}
+	}
+	if replicas, _ := nestedInt(deployment, "spec", "replicas"); replicas != 2 {
+		t.Errorf("exported replicas = %d, want 2", replicas)
+	}
+
+	// Volumes: CSI data through the pod mount, hostPath in place, unbound skipped.
+	volumes := make(map[string]VolumeEntry)
+	for _, v := range run.Manifest.Volumes {
+		volumes[v.Namespace+"/"+v.Claim] = v
+	}
+	if got := volumes["shop/data"].Path; got != csiMount {
+		t.Errorf("data volume path = %q, want %q", got, csiMount)
+	}
+	if got := volumes["shop/logs"].Path; got == "" {
+		t.Error("hostPath volume not resolved")
+	}
+	if got := volumes["shop/cache"]; got.Path != "" || got.SkipReason == "" {
+		t.Errorf("unbound volume = %+v, want skipped", got)
+	}
+	if paths := run.Paths(); len(paths) != 3 || paths[0] != run.Dir {
+		t.Errorf("Paths() = %v", paths)
+	}
+	if _, err := LoadManifest(run.Dir); err != nil {
+		t.Errorf("LoadManifest() error = %v", err)
+	}
+
+	// Pre hooks ran in order: exec, then scale down.
+	if len(client.execs) != 1 || client.execs[0] != "shop/web-1[web]: sync" {
+		t.Errorf("execs = %v", client.execs)
+	}
+	if !slices.Equal(client.scales, []string{"shop/web=0"}) {
+		t.Errorf("scales = %v", client.scales)
+	}
+
+	if err := run.Finish(context.Background()); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	if !slices.Equal(client.scales, []string{"shop/web=0", "shop/web=2"}) {
+		t.Errorf("scales after finish = %v", client.scales)
+	}
+	if len(client.execs) != 2 || client.execs[1] != "shop/web-1[]: echo done" {
+		t.Errorf("post hook execs = %v", client.execs)
+	}
+	if _, err := os.Stat(run.Dir); !os.IsNotExist(err) {
+		t.Errorf("staging directory not removed: %v", err)
+	}
+}
+
+func TestBackupPrepare_HookFailure(t *testing.T) {
+	failing := errors.New("exit code 1")
+
+	t.Run("aborts and scales back", func(t *testing.T) {
+		client, kubelet, _ := newTestCluster(t)
+		client.execErr["web-1"] = failing
+		opts := testBackupOptions(kubelet)
+		opts.Hooks = []models.KubernetesHook{
+			{Name: "quiesce", Phase: models.KubernetesHookPre, Action: models.KubernetesHookScaleDown, LabelSelector: "app=web"},
+			{Name: "flush", Phase: models.KubernetesHookPre, Action: models.KubernetesHookExec, LabelSelector: "app=web", Command: []string{"sync"}},
+		}
+
+		_, err := NewBackup(client, xorCipher{}, zerolog.Nop()).Prepare(context.Background(), opts)
+		if err == nil || !strings.Contains(err.Error(), "hook flush") || !strings.Contains(err.Error(), "boom") {
+			t.Fatalf("Prepare() error = %v, want hook flush failure with stderr", err)
+		}
+		if !slices.Equal(client.scales, []string{"shop/web=0", "shop/web=2"}) {
+			t.Errorf("scales = %v, want scaled back after failure", client.scales)
+		}
+	})
+
+	t.Run("continue on error", func(t *testing.T) {
+		client, kubelet, _ := newTestCluster(t)
+		client.execErr["web-1"] = failing
+		opts := testBackupOptions(kubelet)
+		opts.Hooks = []models.KubernetesHook{
+			{Name: "flush", Phase: models.KubernetesHookPre, Action: models.KubernetesHookExec, LabelSelector: "app=web", Command: []string{"sync"}, ContinueOnError: true},
+		}
+
+		run, err := NewBackup(client, xorCipher{}, zerolog.Nop()).Prepare(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Prepare() error = %v", err)
+		}
+		defer run.Finish(context.Background())
+		if len(run.Manifest.Warnings) == 0 || !strings.Contains(strings.Join(run.Manifest.Warnings, "\n"), "hook flush failed") {
+			t.Errorf("warnings = %v", run.Manifest.Warnings)
+		}
+	})
+}
+
+func TestBackupPrepare_Options(t *testing.T) {
+	client, kubelet, _ := newTestCluster(t)
+
+	t.Run("secrets require a cipher", func(t *testing.T) {
+		_, err := NewBackup(client, nil, zerolog.Nop()).Prepare(context.Background(), testBackupOptions(kubelet))
+		if err == nil {
+			t.Fatal("expected error without cipher")
+		}
+	})
+
+	t.Run("explicit namespaces without secrets or CRDs", func(t *testing.T) {
+		opts := &models.KubernetesBackupOptions{Namespaces: []string{"shop"}, KubeletRootDir: kubelet}
+		run, err := NewBackup(client, nil, zerolog.Nop()).Prepare(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Prepare() error = %v", err)
+		}
+		defer run.Finish(context.Background())
+		for _, entry := range run.Manifest.Resources {
+			if entry.Resource == SecretResource || entry.Resource == CRDResource || entry.Resource.Kind == "Widget" {
+				t.Errorf("unexpected %s %s", entry.Resource.Kind, entry.Name)
+			}
+		}
+		if len(run.Manifest.Volumes) != 0 || len(run.Paths()) != 1 {
+			t.Errorf("volumes = %+v, want none", run.Manifest.Volumes)
+		}
+	})
+
+	t.Run("unknown namespace", func(t *testing.T) {
+		opts := &models.KubernetesBackupOptions{Namespaces: []string{"missing"}}
+		if _, err := NewBackup(client, nil, zerolog.Nop()).Prepare(context.Background(), opts); err == nil {
+			t.Fatal("expected error for missing namespace")
+		}
+	})
+}
@@ -0,0 +1,379 @@
+// Package kubernetes backs up and restores Kubernetes workloads: resource
+// manifests, quiesce hooks and the data of persistent volume claims.
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// serviceAccountDir is where Kubernetes mounts a pod's service account credentials.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+var (
+	// ErrNotFound is returned when a resource does not exist.
+	ErrNotFound = errors.New("kubernetes resource not found")
+	// ErrConflict is returned when a resource already exists or was modified concurrently.
+	ErrConflict = errors.New("kubernetes resource conflict")
+)
+
+// Object is a Kubernetes resource in its JSON form.
+type Object map[string]interface{}
+
+// Resource identifies a Kubernetes API resource type.
+type Resource struct {
+	Group      string `json:"group,omitempty"`
+	Version    string `json:"version"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"` // Plural resource name, e.g. "deployments"
+	Namespaced bool   `json:"namespaced"`
+}
+
+// APIVersion returns the resource's apiVersion, e.g. "apps/v1".
+func (r Resource) APIVersion() string {
+	if r.Group == "" {
+		return r.Version
+	}
+	return r.Group + "/" + r.Version
+}
+
+// path returns the API path for the resource collection or a single object.
+func (r Resource) path(namespace, name string) string {
+	var b strings.Builder
+	if r.Group == "" {
+		b.WriteString("/api/" + r.Version)
+	} else {
+		b.WriteString("/apis/" + r.Group + "/" + r.Version)
+	}
+	if r.Namespaced && namespace != "" {
+		b.WriteString("/namespaces/" + url.PathEscape(namespace))
+	}
+	b.WriteString("/" + r.Name)
+	if name != "" {
+		b.WriteString("/" + url.PathEscape(name))
+	}
+	return b.String()
+}
+
+// Client is the subset of the Kubernetes API used for backup and restore.
+type Client interface {
+	// List returns the objects of a resource, in all namespaces when namespace is empty.
+	List(ctx context.Context, res Resource, namespace, labelSelector string) ([]Object, error)
+	// Get returns a single object.
+	Get(ctx context.Context, res Resource, namespace, name string) (Object, error)
+	// Create creates an object.
+	Create(ctx context.Context, res Resource, namespace string, obj Object) (Object, error)
+	// Update replaces an object; obj must carry the current resourceVersion.
+	Update(ctx context.Context, res Resource, namespace string, obj Object) (Object, error)
+	// Scale sets the replica count of a workload through its scale subresource.
+	Scale(ctx context.Context, res Resource, namespace, name string, replicas int64) error
+	// Exec runs a command in a pod container and returns its output.
+	Exec(ctx context.Context, namespace, pod, container string, command []string) (stdout, stderr string, err error)
+}
+
+// Config contains connection settings for a Kubernetes API server.
+type Config struct {
+	// Server is the API server URL, e.g. https://10.0.0.1:6443.
+	Server string
+	// Token is a bearer token, usually a service account token.
+	Token string
+	// CAData is the PEM encoded CA bundle for the API server certificate.
+	// Without it the system roots are used.
+	CAData []byte
+}
+
+// InClusterConfig returns the configuration for the cluster the process runs
+// in, using the pod's service account.
+func InClusterConfig() (*Config, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("read service account token: %w", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("read service account CA: %w", err)
+	}
+	return &Config{
+		Server: "https://" + net.JoinHostPort(host, port),
+		Token:  strings.TrimSpace(string(token)),
+		CAData: ca,
+	}, nil
+}
+
+// RESTClient talks to the Kubernetes API over HTTPS.
+type RESTClient struct {
+	config     *Config
+	tlsConfig  *tls.Config
+	httpClient *http.Client
+	logger     zerolog.Logger
+}
+
+// NewRESTClient creates a new Kubernetes API client.
+func NewRESTClient(config *Config, logger zerolog.Logger) (*RESTClient, error) {
+	if config.Server == "" {
+		return nil, errors.New("kubernetes server URL is required")
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(config.CAData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(config.CAData) {
+			return nil, errors.New("invalid kubernetes CA data")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &RESTClient{
+		config:    config,
+		tlsConfig: tlsConfig,
+		httpClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			Timeout:   60 * time.Second,
+		},
+		logger: logger.With().Str("component", "kubernetes_client").Logger(),
+	}, nil
+}
+
+// doRequest performs a request against the API server and decodes a JSON response into v.
+func (c *RESTClient) doRequest(ctx context.Context, method, path, contentType string, body, v interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.config.Server, "/")+path, reader)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return statusError(resp.StatusCode, data)
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// statusError converts a failed API response into an error, wrapping
+// ErrNotFound and ErrConflict where they apply.
+func statusError(code int, body []byte) error {
+	var status struct {
+		Message string `json:"message"`
+	}
+	msg := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &status) == nil && status.Message != "" {
+		msg = status.Message
+	}
+	switch code {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, msg)
+	case http.StatusConflict:
+		return fmt.Errorf("%w: %s", ErrConflict, msg)
+	}
+	return fmt.Errorf("kubernetes API error (status %d): %s", code, msg)
+}
+
+// List returns the objects of a resource, following pagination.
+func (c *RESTClient) List(ctx context.Context, res Resource, namespace, labelSelector string) ([]Object, error) {
+	var objects []Object
+	continueToken := ""
+	for {
+		query := url.Values{"limit": {"500"}}
+		if labelSelector != "" {
+			query.Set("labelSelector", labelSelector)
+		}
+		if continueToken != "" {
+			query.Set("continue", continueToken)
+		}
+
+		var list struct {
+			Metadata struct {
+				Continue string `json:"continue"`
+			} `json:"metadata"`
+			Items []Object `json:"items"`
+		}
+		if err := c.doRequest(ctx, http.MethodGet, res.path(namespace, "")+"?"+query.Encode(), "", nil, &list); err != nil {
+			return nil, fmt.Errorf("list %s: %w", res.Name, err)
+		}
+		for _, item := range list.Items {
+			// List items omit their type; restore it so objects can be applied as-is.
+			item["apiVersion"] = res.APIVersion()
+			item["kind"] = res.Kind
+			objects = append(objects, item)
+		}
+		if list.Metadata.Continue == "" {
+			return objects, nil
+		}
+		continueToken = list.Metadata.Continue
+	}
+}
+
+// Get returns a single object.
+func (c *RESTClient) Get(ctx context.Context, res Resource, namespace, name string) (Object, error) {
+	var obj Object
+	if err := c.doRequest(ctx, http.MethodGet, res.path(namespace, name), "", nil, &obj); err != nil {
+		return nil, fmt.Errorf("get %s %s: %w", res.Kind, name, err)
+	}
+	return obj, nil
+}
+
+// Create creates an object.
+func (c *RESTClient) Create(ctx context.Context, res Resource, namespace string, obj Object) (Object, error) {
+	var created Object
+	if err := c.doRequest(ctx, http.MethodPost, res.path(namespace, ""), "application/json", obj, &created); err != nil {
+		return nil, fmt.Errorf("create %s %s: %w", res.Kind, obj.Name(), err)
+	}
+	return created, nil
+}
+
+// Update replaces an object.
+func (c *RESTClient) Update(ctx context.Context, res Resource, namespace string, obj Object) (Object, error) {
+	var updated Object
+	if err := c.doRequest(ctx, http.MethodPut, res.path(namespace, obj.Name()), "application/json", obj, &updated); err != nil {
+		return nil, fmt.Errorf("update %s %s: %w", res.Kind, obj.Name(), err)
+	}
+	return updated, nil
+}
+
+// Scale sets the replica count of a workload.
+func (c *RESTClient) Scale(ctx context.Context, res Resource, namespace, name string, replicas int64) error {
+	patch := map[string]interface{}{"spec": map[string]interface{}{"replicas": replicas}}
+	if err := c.doRequest(ctx, http.MethodPatch, res.path(namespace, name)+"/scale", "application/merge-patch+json", patch, nil); err != nil {
+		return fmt.Errorf("scale %s %s: %w", res.Kind, name, err)
+	}
+	return nil
+}
+
+// Name returns metadata.name.
+func (o Object) Name() string {
+	return o.metadataString("name")
+}
+
+// Namespace returns metadata.namespace.
+func (o Object) Namespace() string {
+	return o.metadataString("namespace")
+}
+
+// Kind returns the object's kind.
+func (o Object) Kind() string {
+	kind, _ := o["kind"].(string)
+	return kind
+}
+
+// Metadata returns the metadata map, creating it if needed.
+func (o Object) Metadata() map[string]interface{} {
+	md, ok := o["metadata"].(map[string]interface{})
+	if !ok {
+		md = map[string]interface{}{}
+		o["metadata"] = md
+	}
+	return md
+}
+
+func (o Object) metadataString(key string) string {
+	md, _ := o["metadata"].(map[string]interface{})
+	s, _ := md[key].(string)
+	return s
+}
+
+// nestedMap returns the map at the given path, or nil if it does not exist.
+func nestedMap(obj map[string]interface{}, path ...string) map[string]interface{} {
+	cur := obj
+	for _, key := range path {
+		next, ok := cur[key].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = next
+	}
+	return cur
+}
+
+// nestedSlice returns the slice of maps at the given path.
+func nestedSlice(obj map[string]interface{}, path ...string) []map[string]interface{} {
+	if len(path) == 0 {
+		return nil
+	}
+	parent := nestedMap(obj, path[:len(path)-1]...)
+	if parent == nil {
+		return nil
+	}
+	items, _ := parent[path[len(path)-1]].([]interface{})
+	result := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// nestedString returns the string at the given path.
+func nestedString(obj map[string]interface{}, path ...string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	parent := nestedMap(obj, path[:len(path)-1]...)
+	s, _ := parent[path[len(path)-1]].(string)
+	return s
+}
+
+// nestedInt returns the number at the given path; JSON numbers decode as float64.
+func nestedInt(obj map[string]interface{}, path ...string) (int64, bool) {
+	if len(path) == 0 {
+		return 0, false
+	}
+	parent := nestedMap(obj, path[:len(path)-1]...)
+	switch v := parent[path[len(path)-1]].(type) {
+	case float64:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,187 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+)
+
+func newTestRESTClient(t *testing.T, handler http.HandlerFunc) *RESTClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := NewRESTClient(&Config{Server: server.URL, Token: "test-token"}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestResourcePath(t *testing.T) {
+	tests := []struct {
+		res       Resource
+		namespace string
+		name      string
+		want      string
+	}{
+		{NamespaceResource, "", "shop", "/api/v1/namespaces/shop"},
+		{PodResource, "shop", "", "/api/v1/namespaces/shop/pods"},
+		{PodResource, "", "", "/api/v1/pods"},
+		{DeploymentResource, "shop", "web", "/apis/apps/v1/namespaces/shop/deployments/web"},
+		{CRDResource, "ignored", "widgets.example.com", "/apis/apiextensions.k8s.io/v1/customresourcedefinitions/widgets.example.com"},
+	}
+	for _, tt := range tests {
+		if got := tt.res.path(tt.namespace, tt.name); got != tt.want {
+			t.Errorf("path(%s, %q, %q) = %q, want %q", tt.res.Kind, tt.namespace, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRESTClient_List(t *testing.T) {
+	calls := 0
+	client := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if r.URL.Path != "/apis/apps/v1/namespaces/shop/deployments" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("labelSelector"); got != "app=web" {
+			t.Errorf("labelSelector = %q", got)
+		}
+		if r.URL.Query().Get("continue") == "" {
+			w.Write([]byte(`{"metadata":{"continue":"page2"},"items":[{"metadata":{"name":"a"}}]}`))
+			return
+		}
+		w.Write([]byte(`{"metadata":{},"items":[{"metadata":{"name":"b"}}]}`))
+	})
+
+	objs, err := client.List(context.Background(), DeploymentResource, "shop", "app=web")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if calls != 2 || len(objs) != 2 || objs[0].Name() != "a" || objs[1].Name() != "b" {
+		t.Fatalf("List() = %v after %d calls", objs, calls)
+	}
+	if objs[0].Kind() != "Deployment" || objs[0]["apiVersion"] != "apps/v1" {
+		t.Errorf("list item type not set: %v", objs[0])
+	}
+}
+
+func TestRESTClient_Errors(t *testing.T) {
+	client := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind":"Status","message":"configmaps \"x\" not found","reason":"NotFound"}`))
+		case http.MethodPost:
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"kind":"Status","message":"already exists","reason":"AlreadyExists"}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"kind":"Status","message":"forbidden: cannot update"}`))
+		}
+	})
+	ctx := context.Background()
+	cm := Resource{Version: "v1", Kind: "ConfigMap", Name: "configmaps", Namespaced: true}
+
+	if _, err := client.Get(ctx, cm, "shop", "x"); !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), `configmaps "x" not found`) {
+		t.Errorf("Get() error = %v, want ErrNotFound", err)
+	}
+	if _, err := client.Create(ctx, cm, "shop", Object{"metadata": map[string]interface{}{"name": "x"}}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Create() error = %v, want ErrConflict", err)
+	}
+	_, err := client.Update(ctx, cm, "shop", Object{"metadata": map[string]interface{}{"name": "x"}})
+	if err == nil || errors.Is(err, ErrConflict) || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("Update() error = %v", err)
+	}
+}
+
+func TestRESTClient_Scale(t *testing.T) {
+	client := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/apis/apps/v1/namespaces/shop/statefulsets/db/scale" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/merge-patch+json" {
+			t.Errorf("Content-Type = %q", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"spec":{"replicas":3}}` {
+			t.Errorf("body = %s", body)
+		}
+		w.Write([]byte(`{}`))
+	})
+	if err := client.Scale(context.Background(), StatefulSetResource, "shop", "db", 3); err != nil {
+		t.Fatalf("Scale() error = %v", err)
+	}
+}
+
+func TestRESTClient_Exec(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{execProtocol}}
+	client := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/shop/pods/db-0/exec" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if got := query["command"]; strings.Join(got, " ") != "sh -c sync" || query.Get("container") != "postgres" {
+			t.Errorf("query = %v", query)
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+		if conn.Subprotocol() != execProtocol {
+			t.Errorf("subprotocol = %q", conn.Subprotocol())
+		}
+		conn.WriteMessage(websocket.BinaryMessage, append([]byte{execChannelStdout}, "flushed\n"...))
+		conn.WriteMessage(websocket.BinaryMessage, append([]byte{execChannelStderr}, "warning\n"...))
+		status, _ := json.Marshal(execStatus{Status: "Success"})
+		conn.WriteMessage(websocket.BinaryMessage, append([]byte{execChannelStatus}, status...))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	})
+
+	stdout, stderr, err := client.Exec(context.Background(), "shop", "db-0", "postgres", []string{"sh", "-c", "sync"})
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if stdout != "flushed\n" || stderr != "warning\n" {
+		t.Errorf("Exec() = %q, %q", stdout, stderr)
+	}
+}
+
+func TestRESTClient_ExecFailure(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{execProtocol}}
+	client := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		status, _ := json.Marshal(execStatus{Status: "Failure", Message: "command terminated with non-zero exit code"})
+		conn.WriteMessage(websocket.BinaryMessage, append([]byte{execChannelStatus}, status...))
+	})
+
+	_, _, err := client.Exec(context.Background(), "shop", "db-0", "", []string{"false"})
+	if err == nil || !strings.Contains(err.Error(), "non-zero exit code") {
+		t.Fatalf("Exec() error = %v", err)
+	}
+}
+
+func TestInClusterConfig_NotInCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "")
+	if _, err := InClusterConfig(); err == nil {
+		t.Fatal("expected error outside a cluster")
+	}
+}
@@ -0,0 +1,118 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// execProtocol is the Kubernetes remote command websocket protocol. Each
+// binary message starts with a channel byte: 1 stdout, 2 stderr, 3 status.
+const execProtocol = "v4.channel.k8s.io"
+
+const (
+	execChannelStdout = 1
+	execChannelStderr = 2
+	execChannelStatus = 3
+)
+
+// execStatus is the Status object sent on the status channel when the command exits.
+type execStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// Exec runs a command in a pod container over the exec websocket and
+// returns its output. A non-zero exit status is returned as an error.
+func (c *RESTClient) Exec(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+	if len(command) == 0 {
+		return "", "", errors.New("exec command is empty")
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(c.config.Server, "/"))
+	if err != nil {
+		return "", "", fmt.Errorf("parse server URL: %w", err)
+	}
+	switch endpoint.Scheme {
+	case "https":
+		endpoint.Scheme = "wss"
+	case "http":
+		endpoint.Scheme = "ws"
+	}
+	endpoint.Path += fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/exec", url.PathEscape(namespace), url.PathEscape(pod))
+	query := url.Values{"stdout": {"true"}, "stderr": {"true"}, "command": command}
+	if container != "" {
+		query.Set("container", container)
+	}
+	endpoint.RawQuery = query.Encode()
+
+	header := http.Header{}
+	if c.config.Token != "" {
+		header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+	dialer := websocket.Dialer{
+		TLSClientConfig:  c.tlsConfig,
+		Subprotocols:     []string{execProtocol},
+		HandshakeTimeout: c.httpClient.Timeout,
+	}
+	conn, resp, err := dialer.DialContext(ctx, endpoint.String(), header)
+	if err != nil {
+		if resp != nil {
+			return "", "", fmt.Errorf("exec in %s/%s: %w (status %d)", namespace, pod, err, resp.StatusCode)
+		}
+		return "", "", fmt.Errorf("exec in %s/%s: %w", namespace, pod, err)
+	}
+	defer conn.Close()
+
+	// Unblock ReadMessage when the context is canceled.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	var stdout, stderr bytes.Buffer
+	var status *execStatus
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return stdout.String(), stderr.String(), ctx.Err()
+			}
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) || status != nil {
+				break
+			}
+			return stdout.String(), stderr.String(), fmt.Errorf("read exec stream: %w", err)
+		}
+		if len(msg) == 0 {
+			continue
+		}
+		switch msg[0] {
+		case execChannelStdout:
+			stdout.Write(msg[1:])
+		case execChannelStderr:
+			stderr.Write(msg[1:])
+		case execChannelStatus:
+			status = &execStatus{}
+			if err := json.Unmarshal(msg[1:], status); err != nil {
+				return stdout.String(), stderr.String(), fmt.Errorf("decode exec status: %w", err)
+			}
+		}
+	}
+
+	if status != nil && status.Status != "Success" {
+		return stdout.String(), stderr.String(), fmt.Errorf("command failed in %s/%s: %s", namespace, pod, status.Message)
+	}
+	return stdout.String(), stderr.String(), nil
+}
@@ -0,0 +1,243 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeClient is an in-memory clientset for tests.
+type fakeClient struct {
+	mu       sync.Mutex
+	objects  map[string]Object // keyed by resource/namespace/name
+	version  int
+	execs    []string
+	execErr  map[string]error // keyed by pod name
+	scales   []string
+	creates  []string
+	updates  []string
+	createFn func(res Resource, obj Object) error
+}
+
+func newFakeClient(objs ...Object) *fakeClient {
+	f := &fakeClient{objects: make(map[string]Object), execErr: make(map[string]error)}
+	for _, obj := range objs {
+		f.add(obj)
+	}
+	return f
+}
+
+// resourceFor finds the resource of an object from its kind.
+func resourceFor(obj Object) Resource {
+	all := append([]Resource{NamespaceResource, PodResource, PVResource, CRDResource}, namespacedResources...)
+	for _, res := range all {
+		if res.Kind == obj.Kind() && res.APIVersion() == obj["apiVersion"] {
+			return res
+		}
+	}
+	group, version, _ := strings.Cut(obj["apiVersion"].(string), "/")
+	return Resource{Group: group, Version: version, Kind: obj.Kind(), Name: strings.ToLower(obj.Kind()) + "s", Namespaced: obj.Namespace() != ""}
+}
+
+func fakeKey(res Resource, namespace, name string) string {
+	if !res.Namespaced {
+		namespace = ""
+	}
+	return resourceDirName(res) + "/" + namespace + "/" + name
+}
+
+func (f *fakeClient) add(obj Object) {
+	f.version++
+	obj.Metadata()["resourceVersion"] = strconv.Itoa(f.version)
+	f.objects[fakeKey(resourceFor(obj), obj.Namespace(), obj.Name())] = obj
+}
+
+// copyObject deep-copies an object so tests observe what the client was sent.
+func copyObject(obj Object) Object {
+	data, _ := json.Marshal(obj)
+	var out Object
+	_ = json.Unmarshal(data, &out)
+	return out
+}
+
+func matchesSelector(obj Object, selector string) bool {
+	if selector == "" {
+		return true
+	}
+	labels, _ := obj.Metadata()["labels"].(map[string]interface{})
+	for _, term := range strings.Split(selector, ",") {
+		key, value, _ := strings.Cut(term, "=")
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeClient) List(_ context.Context, res Resource, namespace, labelSelector string) ([]Object, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prefix := resourceDirName(res) + "/"
+	if res.Namespaced && namespace != "" {
+		prefix += namespace + "/"
+	}
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var objs []Object
+	for _, key := range keys {
+		if obj := f.objects[key]; matchesSelector(obj, labelSelector) {
+			objs = append(objs, copyObject(obj))
+		}
+	}
+	return objs, nil
+}
+
+func (f *fakeClient) Get(_ context.Context, res Resource, namespace, name string) (Object, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[fakeKey(res, namespace, name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotFound, res.Kind, name)
+	}
+	return copyObject(obj), nil
+}
+
+func (f *fakeClient) Create(_ context.Context, res Resource, namespace string, obj Object) (Object, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.createFn != nil {
+		if err := f.createFn(res, obj); err != nil {
+			return nil, err
+		}
+	}
+	key := fakeKey(res, namespace, obj.Name())
+	if _, ok := f.objects[key]; ok {
+		return nil, fmt.Errorf("%w: %s %s already exists", ErrConflict, res.Kind, obj.Name())
+	}
+	obj = copyObject(obj)
+	f.version++
+	obj.Metadata()["resourceVersion"] = strconv.Itoa(f.version)
+	f.objects[key] = obj
+	f.creates = append(f.creates, key)
+	return obj, nil
+}
+
+func (f *fakeClient) Update(_ context.Context, res Resource, namespace string, obj Object) (Object, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := fakeKey(res, namespace, obj.Name())
+	existing, ok := f.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if existing.metadataString("resourceVersion") != obj.metadataString("resourceVersion") {
+		return nil, ErrConflict
+	}
+	obj = copyObject(obj)
+	f.version++
+	obj.Metadata()["resourceVersion"] = strconv.Itoa(f.version)
+	f.objects[key] = obj
+	f.updates = append(f.updates, key)
+	return obj, nil
+}
+
+func (f *fakeClient) Scale(_ context.Context, res Resource, namespace, name string, replicas int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[fakeKey(res, namespace, name)]
+	if !ok {
+		return ErrNotFound
+	}
+	obj["spec"].(map[string]interface{})["replicas"] = float64(replicas)
+	obj["status"] = map[string]interface{}{"replicas": float64(replicas)}
+	f.scales = append(f.scales, fmt.Sprintf("%s/%s=%d", namespace, name, replicas))
+	return nil
+}
+
+func (f *fakeClient) Exec(_ context.Context, namespace, pod, container string, command []string) (string, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.execs = append(f.execs, fmt.Sprintf("%s/%s[%s]: %s", namespace, pod, container, strings.Join(command, " ")))
+	if err := f.execErr[pod]; err != nil {
+		return "", "boom", err
+	}
+	return "ok", "", nil
+}
+
+// Test object builders.
+
+func testObject(apiVersion, kind, namespace, name string, fields map[string]interface{}) Object {
+	md := map[string]interface{}{
+		"name":              name,
+		"uid":               "uid-" + name,
+		"creationTimestamp": "2026-01-01T00:00:00Z",
+		"managedFields":     []interface{}{map[string]interface{}{"manager": "kubectl"}},
+	}
+	if namespace != "" {
+		md["namespace"] = namespace
+	}
+	obj := Object{"apiVersion": apiVersion, "kind": kind, "metadata": md}
+	for k, v := range fields {
+		if k == "labels" {
+			md["labels"] = v
+			continue
+		}
+		obj[k] = v
+	}
+	return obj
+}
+
+func testNamespace(name string) Object {
+	return testObject("v1", "Namespace", "", name, map[string]interface{}{
+		"labels": map[string]interface{}{"kubernetes.io/metadata.name": name},
+	})
+}
+
+func testDeployment(namespace, name string, replicas int, labels map[string]interface{}, podSpec map[string]interface{}) Object {
+	return testObject("apps/v1", "Deployment", namespace, name, map[string]interface{}{
+		"labels": labels,
+		"spec": map[string]interface{}{
+			"replicas": float64(replicas),
+			"template": map[string]interface{}{"spec": podSpec},
+		},
+		"status": map[string]interface{}{"replicas": float64(replicas)},
+	})
+}
+
+func testPod(namespace, name, uid, phase string, labels map[string]interface{}, claim string) Object {
+	pod := testObject("v1", "Pod", namespace, name, map[string]interface{}{
+		"labels": labels,
+		"spec":   map[string]interface{}{},
+		"status": map[string]interface{}{"phase": phase},
+	})
+	pod.Metadata()["uid"] = uid
+	if claim != "" {
+		pod["spec"] = map[string]interface{}{"volumes": []interface{}{
+			map[string]interface{}{"name": "data", "persistentVolumeClaim": map[string]interface{}{"claimName": claim}},
+		}}
+	}
+	return pod
+}
+
+// xorCipher is a reversible test cipher that visibly changes the data.
+type xorCipher struct{}
+
+func (xorCipher) Encrypt(p []byte) ([]byte, error) { return xorBytes(p), nil }
+func (xorCipher) Decrypt(c []byte) ([]byte, error) { return xorBytes(c), nil }
+
+func xorBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[i] ^ 0x5a
+	}
+	return out
+}
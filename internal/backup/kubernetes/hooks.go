@@ -0,0 +1,161 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+)
+
+// defaultHookTimeout bounds a hook without timeout_seconds.
+const defaultHookTimeout = 5 * time.Minute
+
+// scalePollInterval is how often scaled-down workloads are checked for
+// terminated replicas.
+var scalePollInterval = 2 * time.Second
+
+// scaledWorkload remembers a workload's replica count before a scale_down hook.
+type scaledWorkload struct {
+	resource  Resource
+	namespace string
+	name      string
+	replicas  int64
+}
+
+// runHooks runs the hooks of one phase in the order they are configured.
+func (r *BackupRun) runHooks(ctx context.Context, phase models.KubernetesHookPhase) error {
+	for _, hook := range r.opts.Hooks {
+		if hook.Phase != phase {
+			continue
+		}
+		if err := r.runHook(ctx, hook); err != nil {
+			if hook.ContinueOnError {
+				r.warn(fmt.Sprintf("hook %s failed: %v", hook.Name, err))
+				continue
+			}
+			return fmt.Errorf("hook %s: %w", hook.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *BackupRun) runHook(ctx context.Context, hook models.KubernetesHook) error {
+	timeout := defaultHookTimeout
+	if hook.TimeoutSeconds > 0 {
+		timeout = time.Duration(hook.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	namespaces := r.namespaces
+	if hook.Namespace != "" {
+		namespaces = []string{hook.Namespace}
+	}
+
+	r.backup.logger.Info().
+		Str("hook", hook.Name).
+		Str("phase", string(hook.Phase)).
+		Str("action", string(hook.Action)).
+		Msg("running kubernetes hook")
+
+	switch hook.Action {
+	case models.KubernetesHookExec:
+		return r.execHook(ctx, hook, namespaces)
+	case models.KubernetesHookScaleDown:
+		return r.scaleDown(ctx, hook, namespaces)
+	}
+	return fmt.Errorf("unsupported hook action %q", hook.Action)
+}
+
+// execHook runs the hook command in every running pod matching its selector.
+func (r *BackupRun) execHook(ctx context.Context, hook models.KubernetesHook, namespaces []string) error {
+	ran := 0
+	for _, ns := range namespaces {
+		pods, err := r.backup.client.List(ctx, PodResource, ns, hook.LabelSelector)
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods {
+			if nestedString(pod, "status", "phase") != "Running" {
+				continue
+			}
+			_, stderr, err := r.backup.client.Exec(ctx, ns, pod.Name(), hook.Container, hook.Command)
+			if err != nil {
+				if stderr = strings.TrimSpace(stderr); stderr != "" {
+					return fmt.Errorf("%s/%s: %w: %s", ns, pod.Name(), err, stderr)
+				}
+				return fmt.Errorf("%s/%s: %w", ns, pod.Name(), err)
+			}
+			ran++
+		}
+	}
+	if ran == 0 {
+		r.warn(fmt.Sprintf("hook %s matched no running pods", hook.Name))
+	}
+	return nil
+}
+
+// scaleDown scales matching Deployments and StatefulSets to zero and waits
+// for their replicas to terminate.
+func (r *BackupRun) scaleDown(ctx context.Context, hook models.KubernetesHook, namespaces []string) error {
+	var pending []scaledWorkload
+	for _, ns := range namespaces {
+		for _, res := range []Resource{DeploymentResource, StatefulSetResource} {
+			objs, err := r.backup.client.List(ctx, res, ns, hook.LabelSelector)
+			if err != nil {
+				return err
+			}
+			for _, obj := range objs {
+				replicas, ok := nestedInt(obj, "spec", "replicas")
+				if !ok || replicas == 0 {
+					continue
+				}
+				if err := r.backup.client.Scale(ctx, res, ns, obj.Name(), 0); err != nil {
+					return err
+				}
+				w := scaledWorkload{resource: res, namespace: ns, name: obj.Name(), replicas: replicas}
+				r.scaled = append(r.scaled, w)
+				pending = append(pending, w)
+			}
+		}
+	}
+
+	for len(pending) > 0 {
+		remaining := pending[:0]
+		for _, w := range pending {
+			obj, err := r.backup.client.Get(ctx, w.resource, w.namespace, w.name)
+			if err != nil {
+				return err
+			}
+			if replicas, _ := nestedInt(obj, "status", "replicas"); replicas > 0 {
+				remaining = append(remaining, w)
+			}
+		}
+		pending = remaining
+		if len(pending) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %s %s/%s to scale down: %w", pending[0].resource.Kind, pending[0].namespace, pending[0].name, ctx.Err())
+		case <-time.After(scalePollInterval):
+		}
+	}
+	return nil
+}
+
+// scaleUp restores the replica counts recorded by scale_down hooks.
+func (r *BackupRun) scaleUp(ctx context.Context) error {
+	var errs []error
+	for i := len(r.scaled) - 1; i >= 0; i-- {
+		w := r.scaled[i]
+		if err := r.backup.client.Scale(ctx, w.resource, w.namespace, w.name, w.replicas); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	r.scaled = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,109 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Well-known resources used directly by backup, hooks and restore.
+var (
+	NamespaceResource   = Resource{Version: "v1", Kind: "Namespace", Name: "namespaces"}
+	PodResource         = Resource{Version: "v1", Kind: "Pod", Name: "pods", Namespaced: true}
+	SecretResource      = Resource{Version: "v1", Kind: "Secret", Name: "secrets", Namespaced: true}
+	PVCResource         = Resource{Version: "v1", Kind: "PersistentVolumeClaim", Name: "persistentvolumeclaims", Namespaced: true}
+	PVResource          = Resource{Version: "v1", Kind: "PersistentVolume", Name: "persistentvolumes"}
+	DeploymentResource  = Resource{Group: "apps", Version: "v1", Kind: "Deployment", Name: "deployments", Namespaced: true}
+	StatefulSetResource = Resource{Group: "apps", Version: "v1", Kind: "StatefulSet", Name: "statefulsets", Namespaced: true}
+	CRDResource         = Resource{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition", Name: "customresourcedefinitions"}
+)
+
+// namespacedResources are exported for every namespace, in the order they
+// are applied on restore: dependencies first, workloads last.
+var namespacedResources = []Resource{
+	{Version: "v1", Kind: "ServiceAccount", Name: "serviceaccounts", Namespaced: true},
+	{Version: "v1", Kind: "ConfigMap", Name: "configmaps", Namespaced: true},
+	SecretResource,
+	PVCResource,
+	{Version: "v1", Kind: "Service", Name: "services", Namespaced: true},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "Role", Name: "roles", Namespaced: true},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding", Name: "rolebindings", Namespaced: true},
+	DeploymentResource,
+	StatefulSetResource,
+	{Group: "apps", Version: "v1", Kind: "DaemonSet", Name: "daemonsets", Namespaced: true},
+	{Group: "batch", Version: "v1", Kind: "CronJob", Name: "cronjobs", Namespaced: true},
+	{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress", Name: "ingresses", Namespaced: true},
+}
+
+// sanitizedMetadata are server-populated metadata fields that must not be
+// sent back to the API server on restore.
+var sanitizedMetadata = []string{
+	"uid", "resourceVersion", "creationTimestamp", "deletionTimestamp",
+	"deletionGracePeriodSeconds", "generation", "managedFields", "selfLink",
+}
+
+// sanitize strips server-populated fields and status from an object.
+func sanitize(obj Object) Object {
+	md := obj.Metadata()
+	for _, field := range sanitizedMetadata {
+		delete(md, field)
+	}
+	delete(obj, "status")
+	return obj
+}
+
+// skipExport reports whether an object is recreated by the cluster itself
+// and therefore not worth backing up.
+func skipExport(res Resource, obj Object) bool {
+	if refs, ok := obj.Metadata()["ownerReferences"].([]interface{}); ok && len(refs) > 0 {
+		return true
+	}
+	switch res.Kind {
+	case "ConfigMap":
+		return obj.Name() == "kube-root-ca.crt"
+	case "ServiceAccount":
+		return obj.Name() == "default"
+	case "Secret":
+		return nestedString(obj, "type") == "kubernetes.io/service-account-token"
+	case "Service":
+		return obj.Namespace() == "default" && obj.Name() == "kubernetes"
+	}
+	return false
+}
+
+// customResources returns the served storage version of every CRD along
+// with the CRD objects themselves.
+func customResources(ctx context.Context, client Client) ([]Resource, []Object, error) {
+	crds, err := client.List(ctx, CRDResource, "", "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("list custom resource definitions: %w", err)
+	}
+
+	var resources []Resource
+	for _, crd := range crds {
+		group := nestedString(crd, "spec", "group")
+		kind := nestedString(crd, "spec", "names", "kind")
+		plural := nestedString(crd, "spec", "names", "plural")
+		if group == "" || kind == "" || plural == "" {
+			continue
+		}
+		version := ""
+		for _, v := range nestedSlice(crd, "spec", "versions") {
+			if storage, _ := v["storage"].(bool); storage {
+				version, _ = v["name"].(string)
+				break
+			}
+		}
+		if version == "" {
+			continue
+		}
+		resources = append(resources, Resource{
+			Group:      group,
+			Version:    version,
+			Kind:       kind,
+			Name:       plural,
+			Namespaced: strings.EqualFold(nestedString(crd, "spec", "scope"), "Namespaced"),
+		})
+	}
+	return resources, crds, nil
+}
@@ -0,0 +1,345 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/rs/zerolog"
+)
+
+// RestoreOptions selects and remaps what a restore applies.
+type RestoreOptions struct {
+	// Namespaces limits the restore to these source namespaces; empty means all.
+	Namespaces []string
+	// NamespaceMapping renames source namespaces.
+	NamespaceMapping map[string]string
+	// NameMapping renames objects and the references to them.
+	NameMapping map[string]string
+	// Overwrite replaces existing objects instead of skipping them.
+	Overwrite bool
+}
+
+// targetNamespace returns the namespace a source namespace is restored into.
+func (o RestoreOptions) targetNamespace(ns string) string {
+	if mapped, ok := o.NamespaceMapping[ns]; ok && mapped != "" {
+		return mapped
+	}
+	return ns
+}
+
+// targetName returns the name an object is restored under.
+func (o RestoreOptions) targetName(name string) string {
+	if mapped, ok := o.NameMapping[name]; ok && mapped != "" {
+		return mapped
+	}
+	return name
+}
+
+// includes reports whether a source namespace is part of the restore.
+func (o RestoreOptions) includes(ns string) bool {
+	return len(o.Namespaces) == 0 || slices.Contains(o.Namespaces, ns)
+}
+
+// VolumeRestore maps a backed up volume to the claim its data is restored into.
+type VolumeRestore struct {
+	Source    VolumeEntry
+	Namespace string
+	Claim     string
+}
+
+// Restorer applies exported manifests to a cluster.
+type Restorer struct {
+	client Client
+	cipher Cipher
+	logger zerolog.Logger
+}
+
+// NewRestorer creates a new Kubernetes restorer. cipher may be nil when the
+// backup contains no Secrets.
+func NewRestorer(client Client, cipher Cipher, logger zerolog.Logger) *Restorer {
+	return &Restorer{
+		client: client,
+		cipher: cipher,
+		logger: logger.With().Str("component", "kubernetes_restore").Logger(),
+	}
+}
+
+// LoadManifest reads the index of a restored staging directory.
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, IndexFile))
+	if err != nil {
+		return nil, fmt.Errorf("read manifest index: %w", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest index: %w", err)
+	}
+	if manifest.Version > manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+// Restore applies the manifests in dir. Objects that fail to apply are
+// reported as warnings so one bad object does not abort a namespace restore.
+func (r *Restorer) Restore(ctx context.Context, dir string, manifest *Manifest, opts RestoreOptions) (*models.KubernetesRestoreResult, error) {
+	result := &models.KubernetesRestoreResult{}
+	for _, ns := range opts.Namespaces {
+		if !slices.Contains(manifest.Namespaces, ns) {
+			return nil, fmt.Errorf("namespace %s is not in the backup", ns)
+		}
+	}
+
+	for _, entry := range manifest.Resources {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if !r.selected(entry, opts) {
+			continue
+		}
+
+		obj, err := r.readObject(dir, entry)
+		if err != nil {
+			result.Warnings = append(result.Warnings, err.Error())
+			continue
+		}
+		namespace := remap(entry.Resource, obj, opts)
+
+		outcome, err := r.apply(ctx, entry.Resource, namespace, obj, opts.Overwrite)
+		if err != nil {
+			msg := fmt.Sprintf("%s %s/%s: %v", entry.Resource.Kind, namespace, obj.Name(), err)
+			result.Warnings = append(result.Warnings, msg)
+			r.logger.Warn().Msg("failed to restore " + msg)
+			continue
+		}
+		switch outcome {
+		case applyCreated:
+			result.Created++
+		case applyUpdated:
+			result.Updated++
+		case applySkipped:
+			result.Skipped++
+		}
+	}
+	return result, nil
+}
+
+// PlanVolumes returns the volumes whose data belongs to the restored namespaces.
+func PlanVolumes(manifest *Manifest, opts RestoreOptions) []VolumeRestore {
+	var plan []VolumeRestore
+	for _, v := range manifest.Volumes {
+		if v.Path == "" || !opts.includes(v.Namespace) {
+			continue
+		}
+		plan = append(plan, VolumeRestore{
+			Source:    v,
+			Namespace: opts.targetNamespace(v.Namespace),
+			Claim:     opts.targetName(v.Claim),
+		})
+	}
+	return plan
+}
+
+// selected reports whether a manifest entry is part of the restore. CRDs are
+// always applied since restored custom resources depend on them.
+func (r *Restorer) selected(entry ManifestEntry, opts RestoreOptions) bool {
+	if entry.Resource == NamespaceResource {
+		return opts.includes(entry.Name)
+	}
+	if !entry.Resource.Namespaced {
+		return true
+	}
+	return opts.includes(entry.Namespace)
+}
+
+// readObject reads and, for Secrets, decrypts an exported object.
+func (r *Restorer) readObject(dir string, entry ManifestEntry) (Object, error) {
+	rel := filepath.Clean(entry.File)
+	if filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("invalid manifest path %q", entry.File)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, rel))
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", entry.File, err)
+	}
+	if entry.Encrypted {
+		if r.cipher == nil {
+			return nil, fmt.Errorf("%s is encrypted but no key is configured", entry.File)
+		}
+		data, err = r.cipher.Decrypt(data)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt %s: %w", entry.File, err)
+		}
+	}
+	var obj Object
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", entry.File, err)
+	}
+	return obj, nil
+}
+
+// applyOutcome is what apply did with an object.
+type applyOutcome int
+
+const (
+	applyCreated applyOutcome = iota
+	applyUpdated
+	applySkipped
+)
+
+// apply creates an object, or replaces an existing one when overwrite is
+// set. Existing namespaces are left alone.
+func (r *Restorer) apply(ctx context.Context, res Resource, namespace string, obj Object, overwrite bool) (applyOutcome, error) {
+	_, err := r.client.Create(ctx, res, namespace, obj)
+	if err == nil {
+		return applyCreated, nil
+	}
+	if !errors.Is(err, ErrConflict) {
+		return applySkipped, err
+	}
+	if !overwrite || res == NamespaceResource {
+		return applySkipped, nil
+	}
+
+	existing, err := r.client.Get(ctx, res, namespace, obj.Name())
+	if err != nil {
+		return applySkipped, err
+	}
+	obj.Metadata()["resourceVersion"] = existing.metadataString("resourceVersion")
+	if res.Kind == "Service" {
+		// clusterIP is immutable; keep the one the existing Service was given.
+		if spec := nestedMap(obj, "spec"); spec != nil {
+			if ip := nestedString(existing, "spec", "clusterIP"); ip != "" {
+				spec["clusterIP"] = ip
+			}
+		}
+	}
+	if _, err := r.client.Update(ctx, res, namespace, obj); err != nil {
+		return applySkipped, err
+	}
+	return applyUpdated, nil
+}
+
+// remap rewrites an object's namespace, name and references for the restore
+// target and drops fields bound to the source cluster. It returns the
+// target namespace.
+func remap(res Resource, obj Object, opts RestoreOptions) string {
+	md := obj.Metadata()
+	if res == NamespaceResource {
+		name := opts.targetNamespace(obj.Name())
+		md["name"] = name
+		if labels, ok := md["labels"].(map[string]interface{}); ok {
+			labels["kubernetes.io/metadata.name"] = name
+		}
+		return ""
+	}
+	if !res.Namespaced {
+		return ""
+	}
+
+	namespace := opts.targetNamespace(obj.Namespace())
+	md["namespace"] = namespace
+	md["name"] = opts.targetName(obj.Name())
+
+	switch res.Kind {
+	case "Service":
+		if spec := nestedMap(obj, "spec"); spec != nil {
+			delete(spec, "clusterIP")
+			delete(spec, "clusterIPs")
+			for _, port := range nestedSlice(obj, "spec", "ports") {
+				delete(port, "nodePort")
+			}
+		}
+	case "PersistentVolumeClaim":
+		if spec := nestedMap(obj, "spec"); spec != nil {
+			delete(spec, "volumeName")
+		}
+		if annotations, ok := md["annotations"].(map[string]interface{}); ok {
+			for key := range annotations {
+				if strings.HasPrefix(key, "pv.kubernetes.io/") || strings.HasPrefix(key, "volume.kubernetes.io/") || strings.HasPrefix(key, "volume.beta.kubernetes.io/") {
+					delete(annotations, key)
+				}
+			}
+		}
+	case "Deployment", "DaemonSet":
+		remapPodSpec(nestedMap(obj, "spec", "template", "spec"), opts)
+	case "StatefulSet":
+		remapPodSpec(nestedMap(obj, "spec", "template", "spec"), opts)
+		renameField(nestedMap(obj, "spec"), "serviceName", opts)
+	case "CronJob":
+		remapPodSpec(nestedMap(obj, "spec", "jobTemplate", "spec", "template", "spec"), opts)
+	case "RoleBinding":
+		for _, subject := range nestedSlice(obj, "subjects") {
+			if subject["kind"] == "ServiceAccount" {
+				renameField(subject, "name", opts)
+				if ns, _ := subject["namespace"].(string); ns != "" {
+					subject["namespace"] = opts.targetNamespace(ns)
+				}
+			}
+		}
+		if nestedString(obj, "roleRef", "kind") == "Role" {
+			renameField(nestedMap(obj, "roleRef"), "name", opts)
+		}
+	case "Ingress":
+		for _, rule := range nestedSlice(obj, "spec", "rules") {
+			for _, path := range nestedSlice(rule, "http", "paths") {
+				renameField(nestedMap(path, "backend", "service"), "name", opts)
+			}
+		}
+		renameField(nestedMap(obj, "spec", "defaultBackend", "service"), "name", opts)
+		for _, tls := range nestedSlice(obj, "spec", "tls") {
+			renameField(tls, "secretName", opts)
+		}
+	}
+	return namespace
+}
+
+// remapPodSpec renames references to claims, ConfigMaps, Secrets and
+// service accounts in a pod template.
+func remapPodSpec(spec map[string]interface{}, opts RestoreOptions) {
+	if spec == nil || len(opts.NameMapping) == 0 {
+		return
+	}
+	renameField(spec, "serviceAccountName", opts)
+	for _, ref := range nestedSlice(spec, "imagePullSecrets") {
+		renameField(ref, "name", opts)
+	}
+	for _, vol := range nestedSlice(spec, "volumes") {
+		renameField(nestedMap(vol, "persistentVolumeClaim"), "claimName", opts)
+		renameField(nestedMap(vol, "configMap"), "name", opts)
+		renameField(nestedMap(vol, "secret"), "secretName", opts)
+		for _, source := range nestedSlice(vol, "projected", "sources") {
+			renameField(nestedMap(source, "configMap"), "name", opts)
+			renameField(nestedMap(source, "secret"), "name", opts)
+		}
+	}
+	for _, key := range []string{"containers", "initContainers"} {
+		for _, container := range nestedSlice(spec, key) {
+			for _, from := range nestedSlice(container, "envFrom") {
+				renameField(nestedMap(from, "configMapRef"), "name", opts)
+				renameField(nestedMap(from, "secretRef"), "name", opts)
+			}
+			for _, env := range nestedSlice(container, "env") {
+				renameField(nestedMap(env, "valueFrom", "configMapKeyRef"), "name", opts)
+				renameField(nestedMap(env, "valueFrom", "secretKeyRef"), "name", opts)
+			}
+		}
+	}
+}
+
+// renameField applies the name mapping to a string field of m.
+func renameField(m map[string]interface{}, field string, opts RestoreOptions) {
+	if m == nil {
+		return
+	}
+	if name, ok := m[field].(string); ok && name != "" {
+		m[field] = opts.targetName(name)
+	}
+}
@@ -0,0 +1,225 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// prepareTestBackup exports the test cluster and returns its staging directory.
+func prepareTestBackup(t *testing.T) (string, *Manifest) {
+	t.Helper()
+	source, kubelet, _ := newTestCluster(t)
+	run, err := NewBackup(source, xorCipher{}, zerolog.Nop()).Prepare(context.Background(), testBackupOptions(kubelet))
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	// Finish removes the staging directory, so run it when the test ends.
+	t.Cleanup(func() { run.Finish(context.Background()) })
+
+	manifest, err := LoadManifest(run.Dir)
+	if err != nil {
+		t.Fatalf("LoadManifest() error = %v", err)
+	}
+	return run.Dir, manifest
+}
+
+func TestRestore_RemapsIntoAnotherCluster(t *testing.T) {
+	dir, manifest := prepareTestBackup(t)
+	target := newFakeClient()
+	opts := RestoreOptions{
+		Namespaces:       []string{"shop"},
+		NamespaceMapping: map[string]string{"shop": "shop-restore"},
+		NameMapping:      map[string]string{"data": "data-copy", "settings": "settings-v2"},
+	}
+
+	result, err := NewRestorer(target, xorCipher{}, zerolog.Nop()).Restore(context.Background(), dir, manifest, opts)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("warnings = %v", result.Warnings)
+	}
+	if result.Created == 0 || result.Updated != 0 || result.Skipped != 0 {
+		t.Errorf("result = %+v", result)
+	}
+
+	ctx := context.Background()
+	ns, err := target.Get(ctx, NamespaceResource, "", "shop-restore")
+	if err != nil {
+		t.Fatalf("namespace not restored: %v", err)
+	}
+	if got := nestedString(ns, "metadata", "labels", "kubernetes.io/metadata.name"); got != "shop-restore" {
+		t.Errorf("namespace label = %q", got)
+	}
+	if _, err := target.Get(ctx, NamespaceResource, "", "staging"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("staging restored although not selected: %v", err)
+	}
+
+	cm, err := target.Get(ctx, Resource{Version: "v1", Kind: "ConfigMap", Name: "configmaps", Namespaced: true}, "shop-restore", "settings-v2")
+	if err != nil {
+		t.Fatalf("configmap not renamed: %v", err)
+	}
+	if got := nestedString(cm, "data", "mode"); got != "prod" {
+		t.Errorf("configmap data = %q", got)
+	}
+
+	secret, err := target.Get(ctx, SecretResource, "shop-restore", "db-creds")
+	if err != nil {
+		t.Fatalf("secret not restored: %v", err)
+	}
+	if got := nestedString(secret, "data", "password"); got != "aHVudGVyMg==" {
+		t.Errorf("secret data = %q, want decrypted value", got)
+	}
+
+	pvc, err := target.Get(ctx, PVCResource, "shop-restore", "data-copy")
+	if err != nil {
+		t.Fatalf("pvc not renamed: %v", err)
+	}
+	if got := nestedString(pvc, "spec", "volumeName"); got != "" {
+		t.Errorf("pvc still bound to %q", got)
+	}
+
+	svc, err := target.Get(ctx, Resource{Version: "v1", Kind: "Service", Name: "services", Namespaced: true}, "shop-restore", "web")
+	if err != nil {
+		t.Fatalf("service not restored: %v", err)
+	}
+	if nestedString(svc, "spec", "clusterIP") != "" || nestedMap(svc, "spec")["clusterIPs"] != nil {
+		t.Error("service cluster IPs not dropped")
+	}
+	if _, ok := nestedSlice(svc, "spec", "ports")[0]["nodePort"]; ok {
+		t.Error("service nodePort not dropped")
+	}
+
+	deployment, err := target.Get(ctx, DeploymentResource, "shop-restore", "web")
+	if err != nil {
+		t.Fatalf("deployment not restored: %v", err)
+	}
+	podSpec := nestedMap(deployment, "spec", "template", "spec")
+	volumes := nestedSlice(podSpec, "volumes")
+	if got := nestedString(volumes[0], "persistentVolumeClaim", "claimName"); got != "data-copy" {
+		t.Errorf("claimName = %q, want data-copy", got)
+	}
+	if got := nestedString(volumes[1], "configMap", "name"); got != "settings-v2" {
+		t.Errorf("configMap name = %q, want settings-v2", got)
+	}
+	if got := nestedString(nestedSlice(nestedSlice(podSpec, "containers")[0], "envFrom")[0], "secretRef", "name"); got != "db-creds" {
+		t.Errorf("unmapped secretRef = %q", got)
+	}
+
+	if _, err := target.Get(ctx, CRDResource, "", "widgets.example.com"); err != nil {
+		t.Errorf("CRD not restored: %v", err)
+	}
+	widget := Resource{Group: "example.com", Version: "v1", Kind: "Widget", Name: "widgets", Namespaced: true}
+	if _, err := target.Get(ctx, widget, "shop-restore", "w1"); err != nil {
+		t.Errorf("custom resource not restored: %v", err)
+	}
+
+	// CRDs come before namespaced objects and workloads after their dependencies.
+	crdIdx := slices.Index(target.creates, "customresourcedefinitions.apiextensions.k8s.io//widgets.example.com")
+	pvcIdx := slices.Index(target.creates, "persistentvolumeclaims/shop-restore/data-copy")
+	deployIdx := slices.Index(target.creates, "deployments.apps/shop-restore/web")
+	if crdIdx < 0 || pvcIdx < crdIdx || deployIdx < pvcIdx {
+		t.Errorf("apply order = %v", target.creates)
+	}
+
+	plan := PlanVolumes(manifest, opts)
+	var claims []string
+	for _, v := range plan {
+		claims = append(claims, v.Namespace+"/"+v.Claim)
+	}
+	slices.Sort(claims)
+	if want := []string{"shop-restore/data-copy", "shop-restore/logs"}; !slices.Equal(claims, want) {
+		t.Errorf("volume plan = %v, want %v", claims, want)
+	}
+}
+
+func TestRestore_ExistingObjects(t *testing.T) {
+	dir, manifest := prepareTestBackup(t)
+	target := newFakeClient()
+	restorer := NewRestorer(target, xorCipher{}, zerolog.Nop())
+	opts := RestoreOptions{Namespaces: []string{"shop"}}
+
+	first, err := restorer.Restore(context.Background(), dir, manifest, opts)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		result, err := restorer.Restore(context.Background(), dir, manifest, opts)
+		if err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		if result.Created != 0 || result.Updated != 0 || result.Skipped != first.Created {
+			t.Errorf("result = %+v, want %d skipped", result, first.Created)
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		opts := opts
+		opts.Overwrite = true
+		result, err := restorer.Restore(context.Background(), dir, manifest, opts)
+		if err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		// Existing namespaces are never replaced.
+		if result.Created != 0 || result.Skipped != 1 || result.Updated != first.Created-1 || len(result.Warnings) != 0 {
+			t.Errorf("result = %+v", result)
+		}
+	})
+}
+
+func TestRestore_Errors(t *testing.T) {
+	dir, manifest := prepareTestBackup(t)
+
+	t.Run("unknown namespace", func(t *testing.T) {
+		_, err := NewRestorer(newFakeClient(), xorCipher{}, zerolog.Nop()).Restore(context.Background(), dir, manifest, RestoreOptions{Namespaces: []string{"nope"}})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("secrets without key become warnings", func(t *testing.T) {
+		result, err := NewRestorer(newFakeClient(), nil, zerolog.Nop()).Restore(context.Background(), dir, manifest, RestoreOptions{Namespaces: []string{"shop"}})
+		if err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "encrypted") {
+			t.Errorf("warnings = %v", result.Warnings)
+		}
+	})
+
+	t.Run("api failures become warnings", func(t *testing.T) {
+		target := newFakeClient()
+		target.createFn = func(res Resource, _ Object) error {
+			if res.Kind == "Widget" {
+				return errors.New("no matches for kind Widget")
+			}
+			return nil
+		}
+		result, err := NewRestorer(target, xorCipher{}, zerolog.Nop()).Restore(context.Background(), dir, manifest, RestoreOptions{})
+		if err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "Widget shop/w1") {
+			t.Errorf("warnings = %v", result.Warnings)
+		}
+	})
+
+	t.Run("path traversal", func(t *testing.T) {
+		bad := &Manifest{Namespaces: []string{"shop"}, Resources: []ManifestEntry{
+			{Resource: NamespaceResource, Name: "shop", File: "../../etc/passwd"},
+		}}
+		result, err := NewRestorer(newFakeClient(), nil, zerolog.Nop()).Restore(context.Background(), dir, bad, RestoreOptions{})
+		if err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "invalid manifest path") {
+			t.Errorf("warnings = %v", result.Warnings)
+		}
+	})
+}
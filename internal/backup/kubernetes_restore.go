@@ -0,0 +1,313 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MacJediWizard/keldris/internal/backup/kubernetes"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// ErrKubernetesRestoreRunning is returned when a Kubernetes restore is already running.
+var ErrKubernetesRestoreRunning = errors.New("kubernetes restore is already running")
+
+// ErrKubernetesTargetRequired is returned when the server is asked to restore
+// into its own cluster. Those restores run on an in-cluster agent.
+var ErrKubernetesTargetRequired = errors.New("restores into the local cluster run on an in-cluster agent")
+
+// KubernetesRestoreStore defines the persistence operations used by the
+// Kubernetes restorer.
+type KubernetesRestoreStore interface {
+	GetRepository(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	UpdateKubernetesRestore(ctx context.Context, restore *models.KubernetesRestore) error
+}
+
+// KubernetesRestorer restores namespaces from Kubernetes backup snapshots
+// into another cluster, using the API server credentials given for the
+// restore. The server never restores into the cluster it runs in; agents do
+// that with a KubernetesSnapshotRestorer and their own service account.
+type KubernetesRestorer struct {
+	store  KubernetesRestoreStore
+	restic *Restic
+	repos  *RepositoryConfigResolver
+	cipher kubernetes.Cipher
+	logger zerolog.Logger
+
+	runs runGuard
+}
+
+// NewKubernetesRestorer creates a new KubernetesRestorer. cipher decrypts
+// the Secrets in a backup.
+func NewKubernetesRestorer(
+	store KubernetesRestoreStore,
+	restic *Restic,
+	decrypt DecryptFunc,
+	password func(repoID uuid.UUID) (string, error),
+	cipher kubernetes.Cipher,
+	logger zerolog.Logger,
+) *KubernetesRestorer {
+	return &KubernetesRestorer{
+		store:  store,
+		restic: restic,
+		repos:  NewRepositoryConfigResolver(store, decrypt, password),
+		cipher: cipher,
+		logger: logger.With().Str("component", "kubernetes_restorer").Logger(),
+	}
+}
+
+// StartRestore runs a restore into the target cluster in the background.
+// Target credentials are only held for the duration of the restore.
+func (k *KubernetesRestorer) StartRestore(ctx context.Context, restore *models.KubernetesRestore, target *kubernetes.Config) error {
+	if target == nil {
+		return ErrKubernetesTargetRequired
+	}
+	if !k.runs.claim(restore.ID) {
+		return ErrKubernetesRestoreRunning
+	}
+	go func() {
+		defer k.runs.release(restore.ID)
+		if err := k.run(ctx, restore, target); err != nil {
+			k.logger.Error().Err(err).Str("restore_id", restore.ID.String()).Msg("kubernetes restore failed")
+		}
+	}()
+	return nil
+}
+
+// Run runs a restore to completion in the calling goroutine.
+func (k *KubernetesRestorer) Run(ctx context.Context, restore *models.KubernetesRestore, target *kubernetes.Config) error {
+	if target == nil {
+		return ErrKubernetesTargetRequired
+	}
+	if !k.runs.claim(restore.ID) {
+		return ErrKubernetesRestoreRunning
+	}
+	defer k.runs.release(restore.ID)
+	return k.run(ctx, restore, target)
+}
+
+func (k *KubernetesRestorer) run(ctx context.Context, restore *models.KubernetesRestore, target *kubernetes.Config) error {
+	restore.Start()
+	if err := k.store.UpdateKubernetesRestore(ctx, restore); err != nil {
+		return fmt.Errorf("update kubernetes restore: %w", err)
+	}
+
+	result, err := k.restore(ctx, restore, target)
+	if err != nil {
+		restore.Fail(err.Error())
+	} else {
+		restore.Complete(result)
+	}
+	if updateErr := k.store.UpdateKubernetesRestore(context.WithoutCancel(ctx), restore); updateErr != nil {
+		k.logger.Error().Err(updateErr).Str("restore_id", restore.ID.String()).Msg("failed to save kubernetes restore")
+	}
+	return err
+}
+
+func (k *KubernetesRestorer) restore(ctx context.Context, restore *models.KubernetesRestore, target *kubernetes.Config) (*models.KubernetesRestoreResult, error) {
+	_, resticCfg, err := k.repos.Resolve(ctx, restore.RepositoryID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewRESTClient(target, k.logger)
+	if err != nil {
+		return nil, fmt.Errorf("connect to kubernetes: %w", err)
+	}
+
+	// Volume data can only be written through the target cluster's own nodes,
+	// so no kubelet root is given and every volume is left pending.
+	restorer := NewKubernetesSnapshotRestorer(k.restic, client, k.cipher, "", k.logger)
+	opts := kubernetes.RestoreOptions{
+		Namespaces:       restore.Namespaces,
+		NamespaceMapping: restore.NamespaceMapping,
+		NameMapping:      restore.NameMapping,
+		Overwrite:        restore.Overwrite,
+	}
+	result, err := restorer.Restore(ctx, resticCfg, restore.SnapshotID, opts, restore.RestoreVolumes)
+	if err != nil {
+		return nil, err
+	}
+
+	k.logger.Info().
+		Str("restore_id", restore.ID.String()).
+		Int("created", result.Created).
+		Int("updated", result.Updated).
+		Int("skipped", result.Skipped).
+		Int("volumes", result.Volumes).
+		Int("warnings", len(result.Warnings)).
+		Msg("kubernetes restore completed")
+	return result, nil
+}
+
+// KubernetesSnapshotRestorer applies the manifests of a Kubernetes backup
+// snapshot through a cluster client and writes PVC data into claims mounted
+// on the local node.
+type KubernetesSnapshotRestorer struct {
+	restic *Restic
+	client kubernetes.Client
+	cipher kubernetes.Cipher
+	// kubeletRoot is where pod volumes are mounted on this node. Empty
+	// leaves every volume pending.
+	kubeletRoot string
+	logger      zerolog.Logger
+}
+
+// NewKubernetesSnapshotRestorer creates a KubernetesSnapshotRestorer. cipher
+// may be nil, in which case encrypted Secrets are skipped with a warning.
+func NewKubernetesSnapshotRestorer(restic *Restic, client kubernetes.Client, cipher kubernetes.Cipher, kubeletRoot string, logger zerolog.Logger) *KubernetesSnapshotRestorer {
+	return &KubernetesSnapshotRestorer{
+		restic:      restic,
+		client:      client,
+		cipher:      cipher,
+		kubeletRoot: kubeletRoot,
+		logger:      logger,
+	}
+}
+
+// Restore applies the snapshot's manifests with opts and, when
+// restoreVolumes is set, restores the data of the claims it can reach.
+func (r *KubernetesSnapshotRestorer) Restore(ctx context.Context, cfg ResticConfig, snapshotID string, opts kubernetes.RestoreOptions, restoreVolumes bool) (*models.KubernetesRestoreResult, error) {
+	snapshot, manifestPath, err := r.findManifest(ctx, cfg, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	tempDir, err := os.MkdirTemp("", "keldris-k8s-restore-")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manifestDir := filepath.Join(tempDir, "manifests")
+	if err := r.restic.Restore(ctx, cfg, snapshot.ID, RestoreOptions{TargetPath: manifestDir, Include: []string{manifestPath}}); err != nil {
+		return nil, fmt.Errorf("restore manifests: %w", err)
+	}
+	dir := filepath.Join(manifestDir, manifestPath)
+	manifest, err := kubernetes.LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := kubernetes.NewRestorer(r.client, r.cipher, r.logger).Restore(ctx, dir, manifest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if restoreVolumes {
+		plan := kubernetes.PlanVolumes(manifest, opts)
+		if r.kubeletRoot == "" {
+			for _, v := range plan {
+				result.PendingVolumes = append(result.PendingVolumes, v.Namespace+"/"+v.Claim)
+			}
+			if len(plan) > 0 {
+				result.Warnings = append(result.Warnings, "volume data is only restored by an agent running in the target cluster")
+			}
+		} else {
+			r.restoreVolumes(ctx, cfg, snapshot.ID, plan, filepath.Join(tempDir, "volumes"), result)
+		}
+	}
+	return result, nil
+}
+
+// findManifest returns the snapshot and the path of its manifest staging directory.
+func (r *KubernetesSnapshotRestorer) findManifest(ctx context.Context, cfg ResticConfig, snapshotID string) (*Snapshot, string, error) {
+	snapshots, err := r.restic.Snapshots(ctx, cfg)
+	if err != nil {
+		return nil, "", fmt.Errorf("list snapshots: %w", err)
+	}
+	for i := range snapshots {
+		snap := &snapshots[i]
+		if snap.ID != snapshotID && snap.ShortID != snapshotID {
+			continue
+		}
+		for _, path := range snap.Paths {
+			if strings.HasPrefix(filepath.Base(path), kubernetes.ManifestDirPrefix) {
+				return snap, path, nil
+			}
+		}
+		return nil, "", fmt.Errorf("snapshot %s is not a kubernetes backup", snapshotID)
+	}
+	return nil, "", fmt.Errorf("snapshot %s not found", snapshotID)
+}
+
+// restoreVolumes writes backed up volume data into the target claims that
+// are mounted on this node and records the rest as pending.
+func (r *KubernetesSnapshotRestorer) restoreVolumes(ctx context.Context, cfg ResticConfig, snapshotID string, plan []kubernetes.VolumeRestore, tempDir string, result *models.KubernetesRestoreResult) {
+	for _, v := range plan {
+		name := v.Namespace + "/" + v.Claim
+		dest, err := kubernetes.ResolveVolumePath(ctx, r.client, r.kubeletRoot, v.Namespace, v.Claim)
+		if err != nil || dest == "" {
+			result.PendingVolumes = append(result.PendingVolumes, name)
+			if err != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("volume %s: %v", name, err))
+			}
+			continue
+		}
+
+		if err := r.restic.Restore(ctx, cfg, snapshotID, RestoreOptions{TargetPath: tempDir, Include: []string{v.Source.Path}}); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("volume %s: restore data: %v", name, err))
+			continue
+		}
+		if err := copyDir(filepath.Join(tempDir, v.Source.Path), dest); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("volume %s: copy data: %v", name, err))
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(tempDir, v.Source.Path)); err != nil {
+			r.logger.Warn().Err(err).Msg("failed to remove restored volume data")
+		}
+		result.Volumes++
+	}
+}
+
+// copyDir copies a directory tree into dst, overwriting existing files.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyRegularFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyRegularFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
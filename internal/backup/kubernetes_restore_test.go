@@ -0,0 +1,144 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/backup/kubernetes"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type fakeKubernetesRestoreStore struct {
+	repo    *models.Repository
+	restore models.KubernetesRestore
+	updates int
+}
+
+func (s *fakeKubernetesRestoreStore) GetRepository(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	if s.repo == nil || s.repo.ID != id {
+		return nil, errors.New("not found")
+	}
+	return s.repo, nil
+}
+
+func (s *fakeKubernetesRestoreStore) UpdateKubernetesRestore(_ context.Context, r *models.KubernetesRestore) error {
+	s.restore = *r
+	s.updates++
+	return nil
+}
+
+var testKubernetesTarget = &kubernetes.Config{Server: "https://dr.example.com:6443", Token: "token"}
+
+func newTestKubernetesRestorer(t *testing.T, restic *Restic) (*KubernetesRestorer, *fakeKubernetesRestoreStore, *models.KubernetesRestore) {
+	t.Helper()
+	orgID := uuid.New()
+	repo := models.NewRepository(orgID, "k8s", models.RepositoryTypeLocal, []byte(`{"path":"`+t.TempDir()+`"}`))
+	store := &fakeKubernetesRestoreStore{repo: repo}
+	decrypt := func(b []byte) ([]byte, error) { return b, nil }
+	password := func(uuid.UUID) (string, error) { return "secret", nil }
+	k := NewKubernetesRestorer(store, restic, decrypt, password, nil, zerolog.Nop())
+	return k, store, models.NewKubernetesRestore(orgID, repo.ID, "aaaa1111")
+}
+
+func TestKubernetesRestorer_Run(t *testing.T) {
+	tests := []struct {
+		name      string
+		snapshots string
+		wantErr   string
+	}{
+		{
+			name:      "not a kubernetes backup",
+			snapshots: `[{"id":"aaaa1111","short_id":"aaaa1111","time":"2026-01-01T00:00:00Z","paths":["/srv/www"]}]`,
+			wantErr:   "not a kubernetes backup",
+		},
+		{
+			name:      "snapshot not found",
+			snapshots: `[{"id":"bbbb2222","short_id":"bbbb2222","time":"2026-01-01T00:00:00Z","paths":["/tmp/keldris-k8s-1"]}]`,
+			wantErr:   "not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restic, cleanup := newTestRestic(tt.snapshots)
+			defer cleanup()
+
+			k, store, restore := newTestKubernetesRestorer(t, restic)
+			err := k.Run(context.Background(), restore, testKubernetesTarget)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+			if store.updates != 2 {
+				t.Errorf("updates = %d, want 2", store.updates)
+			}
+			if store.restore.Status != models.KubernetesRestoreStatusFailed || !strings.Contains(store.restore.ErrorMessage, tt.wantErr) {
+				t.Errorf("restore = %s %q", store.restore.Status, store.restore.ErrorMessage)
+			}
+		})
+	}
+}
+
+func TestKubernetesRestorer_AlreadyRunning(t *testing.T) {
+	k, _, restore := newTestKubernetesRestorer(t, nil)
+	if !k.runs.claim(restore.ID) {
+		t.Fatal("claim() should succeed")
+	}
+	defer k.runs.release(restore.ID)
+
+	if err := k.Run(context.Background(), restore, testKubernetesTarget); !errors.Is(err, ErrKubernetesRestoreRunning) {
+		t.Errorf("Run() error = %v, want ErrKubernetesRestoreRunning", err)
+	}
+	if err := k.StartRestore(context.Background(), restore, testKubernetesTarget); !errors.Is(err, ErrKubernetesRestoreRunning) {
+		t.Errorf("StartRestore() error = %v, want ErrKubernetesRestoreRunning", err)
+	}
+}
+
+func TestKubernetesRestorer_RequiresTarget(t *testing.T) {
+	k, store, restore := newTestKubernetesRestorer(t, nil)
+	if err := k.Run(context.Background(), restore, nil); !errors.Is(err, ErrKubernetesTargetRequired) {
+		t.Errorf("Run() error = %v, want ErrKubernetesTargetRequired", err)
+	}
+	if err := k.StartRestore(context.Background(), restore, nil); !errors.Is(err, ErrKubernetesTargetRequired) {
+		t.Errorf("StartRestore() error = %v, want ErrKubernetesTargetRequired", err)
+	}
+	if store.updates != 0 {
+		t.Errorf("updates = %d, want 0", store.updates)
+	}
+}
+
+func TestCopyDir(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "db", "base"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "db", "base", "1"), []byte("rows"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("base/1", filepath.Join(src, "db", "latest")); err != nil {
+		t.Fatal(err)
+	}
+	// Existing files in the claim are overwritten.
+	if err := os.MkdirAll(filepath.Join(dst, "db", "base"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dst, "db", "base", "1"), []byte("stale data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyDir(src, dst); err != nil {
+		t.Fatalf("copyDir() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dst, "db", "base", "1"))
+	if err != nil || string(data) != "rows" {
+		t.Errorf("copied file = %q, %v", data, err)
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "db", "latest")); err != nil || link != "base/1" {
+		t.Errorf("symlink = %q, %v", link, err)
+	}
+}
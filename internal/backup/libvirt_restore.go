@@ -0,0 +1,368 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MacJediWizard/keldris/internal/backup/vms"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/rs/zerolog"
+)
+
+// LibvirtRestoreOptions select how a libvirt restore defines the domain.
+type LibvirtRestoreOptions struct {
+	// Domain is the domain in the snapshot; it may be empty when the
+	// snapshot holds a single domain.
+	Domain string
+	// NewName defines the domain under another name with a fresh UUID and
+	// MAC addresses.
+	NewName string
+	// TargetDir restores the disk images into this directory instead of
+	// their original paths.
+	TargetDir string
+	// Overwrite replaces existing images and the shut off domain the
+	// snapshot was taken from.
+	Overwrite bool
+	// Start starts the domain once it is defined.
+	Start bool
+}
+
+// LibvirtSnapshotRestorer restores libvirt domains from libvirt backup
+// snapshots on the KVM host it runs on. It writes the disk images back,
+// adapts the backed up definition to the restored paths and name, and
+// defines the domain again. Every image it writes and every disk the
+// definition references must be inside the images directory, and the
+// definition must pass vms.CheckDomainXML.
+type LibvirtSnapshotRestorer struct {
+	restic    *Restic
+	conn      vms.LibvirtConn
+	imagesDir string
+	logger    zerolog.Logger
+}
+
+// NewLibvirtSnapshotRestorer creates a LibvirtSnapshotRestorer. An empty
+// imagesDir uses models.DefaultLibvirtImagesDir.
+func NewLibvirtSnapshotRestorer(restic *Restic, conn vms.LibvirtConn, imagesDir string, logger zerolog.Logger) *LibvirtSnapshotRestorer {
+	if imagesDir == "" {
+		imagesDir = models.DefaultLibvirtImagesDir
+	}
+	return &LibvirtSnapshotRestorer{
+		restic:    restic,
+		conn:      conn,
+		imagesDir: filepath.Clean(imagesDir),
+		logger:    logger.With().Str("component", "libvirt_restorer").Logger(),
+	}
+}
+
+// Restore restores a domain from the snapshot and defines it with opts.
+func (l *LibvirtSnapshotRestorer) Restore(ctx context.Context, cfg ResticConfig, snapshotID string, opts LibvirtRestoreOptions) (*models.LibvirtRestoreResult, error) {
+	if opts.TargetDir != "" && !models.LibvirtPathWithin(l.imagesDir, opts.TargetDir) {
+		return nil, fmt.Errorf("target_dir %s is outside the libvirt images directory %s", opts.TargetDir, l.imagesDir)
+	}
+
+	snapshot, manifestPath, err := l.findManifest(ctx, cfg, snapshotID, opts.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	tempDir, err := os.MkdirTemp("", "keldris-libvirt-restore-")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := l.restic.Restore(ctx, cfg, snapshot.ID, RestoreOptions{TargetPath: tempDir, Include: []string{manifestPath}}); err != nil {
+		return nil, fmt.Errorf("restore domain definition: %w", err)
+	}
+	manifest, domainXML, err := vms.LoadLibvirtManifest(filepath.Join(tempDir, manifestPath))
+	if err != nil {
+		return nil, err
+	}
+	if err := vms.CheckDomainXML(domainXML); err != nil {
+		return nil, err
+	}
+
+	name := manifest.Domain
+	if opts.NewName != "" {
+		name = opts.NewName
+	}
+	result := &models.LibvirtRestoreResult{Domain: name}
+
+	domains, err := l.conn.ConnectListAllDomains(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var existing *vms.LibvirtDomain
+	for i := range domains {
+		if domains[i].Name == name {
+			existing = &domains[i]
+		}
+	}
+	if existing != nil {
+		if !opts.Overwrite {
+			return nil, fmt.Errorf("domain %s already exists; set overwrite to replace it", name)
+		}
+		// Only the domain the snapshot was taken from may be replaced, never
+		// an unrelated domain that happens to have the requested name.
+		if manifest.UUID == "" || !strings.EqualFold(existing.UUID, manifest.UUID) {
+			return nil, fmt.Errorf("domain %s already exists and is not the domain backed up in snapshot %s; overwrite only replaces the backed up domain", name, snapshotID)
+		}
+		if existing.Active() {
+			return nil, fmt.Errorf("domain %s is %s; shut it down before overwriting it", name, existing.State)
+		}
+	}
+
+	paths, err := planLibvirtDisks(manifest, opts.TargetDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, dest := range paths {
+		if err := l.checkImagePath(dest); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.checkDisksInUse(ctx, domains, existing, paths); err != nil {
+		return nil, err
+	}
+	if !opts.Overwrite {
+		for _, dest := range paths {
+			if _, err := os.Stat(dest); err == nil {
+				return nil, fmt.Errorf("disk image %s already exists; set overwrite to replace it", dest)
+			}
+		}
+	}
+
+	// Backing files are referenced from the images, not the definition.
+	rewrite := vms.DomainRewrite{Name: opts.NewName, Paths: make(map[string]string)}
+	for _, d := range manifest.Disks {
+		rewrite.Paths[d.Source] = paths[d.Source]
+	}
+	if opts.NewName == manifest.Domain {
+		rewrite.Name = ""
+	}
+	newXML, err := vms.RewriteDomainXML(domainXML, rewrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.checkDomainDisks(newXML); err != nil {
+		return nil, err
+	}
+	if rewrite.Name != "" && vms.HasNVRAM(domainXML) {
+		result.Warnings = append(result.Warnings, "the NVRAM file was not restored; libvirt creates fresh UEFI variables for the renamed domain")
+	}
+	if opts.TargetDir != "" {
+		for _, d := range manifest.Disks {
+			if len(d.BackingFiles) > 0 {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("disk %s has a backing chain whose paths are recorded in the image; rebase it with qemu-img if the original paths do not exist", d.Target))
+			}
+		}
+	}
+	if len(manifest.Skipped) > 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("disks %s were not in the backup and must be provided before the domain starts", strings.Join(manifest.Skipped, ", ")))
+	}
+
+	for _, source := range manifest.Files() {
+		dest := paths[source]
+		if err := l.restoreDisk(ctx, cfg, snapshot.ID, source, dest); err != nil {
+			return nil, fmt.Errorf("restore disk image %s: %w", source, err)
+		}
+		result.Disks = append(result.Disks, dest)
+	}
+
+	if existing != nil {
+		if err := l.conn.DomainUndefine(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.conn.DomainDefineXML(ctx, newXML); err != nil {
+		return nil, err
+	}
+
+	if opts.Start {
+		if err := l.conn.DomainCreate(ctx, name); err != nil {
+			return nil, err
+		}
+		result.Started = true
+	}
+
+	l.logger.Info().
+		Str("snapshot_id", snapshot.ID).
+		Str("domain", name).
+		Int("disks", len(result.Disks)).
+		Bool("started", result.Started).
+		Int("warnings", len(result.Warnings)).
+		Msg("libvirt restore completed")
+	return result, nil
+}
+
+// findManifest returns the snapshot and the path of the manifest directory
+// of the requested domain. domain may be empty when the snapshot holds a
+// single domain.
+func (l *LibvirtSnapshotRestorer) findManifest(ctx context.Context, cfg ResticConfig, snapshotID, domain string) (*Snapshot, string, error) {
+	snapshots, err := l.restic.Snapshots(ctx, cfg)
+	if err != nil {
+		return nil, "", fmt.Errorf("list snapshots: %w", err)
+	}
+	for i := range snapshots {
+		snap := &snapshots[i]
+		if snap.ID != snapshotID && snap.ShortID != snapshotID {
+			continue
+		}
+		var found []string
+		for _, path := range snap.Paths {
+			base := filepath.Base(path)
+			if !strings.HasPrefix(base, vms.LibvirtManifestDirPrefix) {
+				continue
+			}
+			if domain == "" || strings.TrimPrefix(base, vms.LibvirtManifestDirPrefix) == domain {
+				found = append(found, path)
+			}
+		}
+		switch {
+		case len(found) == 1:
+			return snap, found[0], nil
+		case len(found) > 1:
+			return nil, "", fmt.Errorf("snapshot %s holds %d domains; choose one", snapshotID, len(found))
+		case domain != "":
+			return nil, "", fmt.Errorf("domain %s not found in snapshot %s", domain, snapshotID)
+		}
+		return nil, "", fmt.Errorf("snapshot %s is not a libvirt backup", snapshotID)
+	}
+	return nil, "", fmt.Errorf("snapshot %s not found", snapshotID)
+}
+
+// checkDisksInUse refuses to replace images that another domain uses, such
+// as the original's disks when a renamed copy is restored next to it.
+// replaced is the shut off domain being overwritten, whose images may be
+// replaced.
+func (l *LibvirtSnapshotRestorer) checkDisksInUse(ctx context.Context, domains []vms.LibvirtDomain, replaced *vms.LibvirtDomain, paths map[string]string) error {
+	dests := make(map[string]bool)
+	for _, dest := range paths {
+		dests[dest] = true
+	}
+	for _, dom := range domains {
+		if replaced != nil && dom.Name == replaced.Name {
+			continue
+		}
+		domXML, err := l.conn.DomainGetXMLDesc(ctx, dom.Name, false)
+		if err != nil {
+			return err
+		}
+		_, _, disks, err := vms.ParseDomainDisks(domXML)
+		if err != nil {
+			return err
+		}
+		for _, d := range disks {
+			for _, f := range append([]string{d.Source}, d.BackingFiles...) {
+				if dests[f] {
+					return fmt.Errorf("disk image %s is in use by domain %s; restore into target_dir instead", f, dom.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkImagePath refuses paths outside the images directory. Symlinks in
+// the existing part of the path are resolved first, so a link inside the
+// directory cannot point the restore elsewhere.
+func (l *LibvirtSnapshotRestorer) checkImagePath(path string) error {
+	dir, err := resolveExistingPath(l.imagesDir)
+	if err != nil {
+		return fmt.Errorf("resolve images directory: %w", err)
+	}
+	resolved, err := resolveExistingPath(path)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", path, err)
+	}
+	if !models.LibvirtPathWithin(dir, resolved) {
+		return fmt.Errorf("disk image %s is outside the libvirt images directory %s; restore into a target_dir inside it", path, l.imagesDir)
+	}
+	return nil
+}
+
+// checkDomainDisks refuses definitions with local disks outside the images
+// directory, such as host block devices or disks that were not backed up.
+func (l *LibvirtSnapshotRestorer) checkDomainDisks(domainXML string) error {
+	_, _, disks, err := vms.ParseDomainDisks(domainXML)
+	if err != nil {
+		return err
+	}
+	for _, d := range disks {
+		if (d.Type != "file" && d.Type != "block") || d.Source == "" {
+			continue
+		}
+		if err := l.checkImagePath(d.Source); err != nil {
+			return fmt.Errorf("disk %s: %w", d.Target, err)
+		}
+	}
+	return nil
+}
+
+// resolveExistingPath resolves symlinks in the longest existing prefix of
+// path and appends the rest unchanged.
+func resolveExistingPath(path string) (string, error) {
+	path = filepath.Clean(path)
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// planLibvirtDisks maps every image file of the domain to the path it is
+// restored to.
+func planLibvirtDisks(manifest *vms.LibvirtManifest, targetDir string) (map[string]string, error) {
+	paths := make(map[string]string)
+	used := make(map[string]string)
+	for _, source := range manifest.Files() {
+		dest := source
+		if targetDir != "" {
+			dest = filepath.Join(targetDir, filepath.Base(source))
+		}
+		if other, ok := used[dest]; ok && other != source {
+			return nil, fmt.Errorf("disk images %s and %s would both be restored to %s", other, source, dest)
+		}
+		used[dest] = source
+		paths[source] = dest
+	}
+	return paths, nil
+}
+
+// restoreDisk restores one image file into a staging directory next to
+// dest and renames it into place, so a failed restore never leaves a
+// partial image at dest.
+func (l *LibvirtSnapshotRestorer) restoreDisk(ctx context.Context, cfg ResticConfig, snapshotID, source, dest string) error {
+	dir := filepath.Dir(dest)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+	staging, err := os.MkdirTemp(dir, ".keldris-restore-")
+	if err != nil {
+		return fmt.Errorf("create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if err := l.restic.Restore(ctx, cfg, snapshotID, RestoreOptions{TargetPath: staging, Include: []string{source}}); err != nil {
+		return err
+	}
+	if err := os.Rename(filepath.Join(staging, source), dest); err != nil {
+		return fmt.Errorf("move image into place: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/backup/vms"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/rs/zerolog"
+)
+
+// libvirtRestoreScript fakes restic snapshots from $DIR/snapshots.json and
+// restic restore by copying the included path from the $DIR/snap tree.
+const libvirtRestoreScript = `#!/bin/sh
+cmd=$1
+while [ $# -gt 0 ]; do
+  case "$1" in
+  --target) target=$2; shift ;;
+  --include) include=$2; shift ;;
+  esac
+  shift
+done
+case "$cmd" in
+snapshots) cat "$DIR/snapshots.json" ;;
+restore)
+  mkdir -p "$target$(dirname "$include")"
+  cp -r "$DIR/snap$include" "$target$include" ;;
+esac
+`
+
+const (
+	libvirtManifestDir = "/tmp/keldris-libvirt-backup-1/keldris-libvirt-web"
+	libvirtWebImage    = "/var/lib/libvirt/images/web.qcow2"
+	libvirtBaseImage   = "/var/lib/libvirt/images/debian-12.qcow2"
+)
+
+const libvirtWebXML = `<domain type='kvm'>
+  <name>web</name>
+  <uuid>4dea22b3-1d52-d8f3-2516-782e98ab3fa0</uuid>
+  <devices>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2'/>
+      <source file='/var/lib/libvirt/images/web.qcow2'/>
+      <target dev='vda' bus='virtio'/>
+    </disk>
+    <interface type='network'>
+      <mac address='52:54:00:12:34:56'/>
+    </interface>
+  </devices>
+</domain>
+`
+
+// fakeLibvirtConn records the domains the restorer defines and starts.
+type fakeLibvirtConn struct {
+	vms.LibvirtConn
+	domains   []vms.LibvirtDomain
+	liveXML   map[string]string
+	defined   []string
+	undefined []string
+	started   []string
+}
+
+func (c *fakeLibvirtConn) ConnectListAllDomains(context.Context) ([]vms.LibvirtDomain, error) {
+	return c.domains, nil
+}
+
+func (c *fakeLibvirtConn) DomainGetXMLDesc(_ context.Context, domain string, _ bool) (string, error) {
+	return c.liveXML[domain], nil
+}
+
+func (c *fakeLibvirtConn) DomainDefineXML(_ context.Context, domainXML string) error {
+	c.defined = append(c.defined, domainXML)
+	return nil
+}
+
+func (c *fakeLibvirtConn) DomainUndefine(_ context.Context, domain string) error {
+	c.undefined = append(c.undefined, domain)
+	return nil
+}
+
+func (c *fakeLibvirtConn) DomainCreate(_ context.Context, domain string) error {
+	c.started = append(c.started, domain)
+	return nil
+}
+
+const libvirtWebUUID = "4dea22b3-1d52-d8f3-2516-782e98ab3fa0"
+
+// newTestLibvirtRestorer returns a restorer over a fake restic repository
+// holding a backup of domain web, using imagesDir as its images directory.
+func newTestLibvirtRestorer(t *testing.T, conn *fakeLibvirtConn, imagesDir, domainXML string) (*LibvirtSnapshotRestorer, ResticConfig) {
+	t.Helper()
+	dir := t.TempDir()
+	script := filepath.Join(dir, "restic")
+	if err := os.WriteFile(script, []byte(libvirtRestoreScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots := []Snapshot{{ID: "aaaa1111", ShortID: "aaaa1111", Paths: []string{libvirtManifestDir, libvirtWebImage, libvirtBaseImage}}}
+	data, _ := json.Marshal(snapshots)
+	if err := os.WriteFile(filepath.Join(dir, "snapshots.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := vms.LibvirtManifest{
+		Domain:   "web",
+		UUID:     libvirtWebUUID,
+		Snapshot: true,
+		Disks: []models.LibvirtDiskInfo{{
+			Target: "vda", Device: "disk", Type: "file", Format: "qcow2",
+			Source: libvirtWebImage, BackingFiles: []string{libvirtBaseImage},
+		}},
+	}
+	manifestJSON, _ := json.Marshal(manifest)
+	files := map[string]string{
+		libvirtManifestDir + "/" + vms.LibvirtManifestFile:  string(manifestJSON),
+		libvirtManifestDir + "/" + vms.LibvirtDomainXMLFile: domainXML,
+		libvirtWebImage:  "web image",
+		libvirtBaseImage: "base image",
+	}
+	for path, content := range files {
+		full := filepath.Join(dir, "snap", path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("DIR", dir)
+
+	l := NewLibvirtSnapshotRestorer(NewResticWithBinary(script, zerolog.Nop()), conn, imagesDir, zerolog.Nop())
+	return l, ResticConfig{Repository: dir, Password: "secret"}
+}
+
+func TestLibvirtSnapshotRestorer_Restore(t *testing.T) {
+	conn := &fakeLibvirtConn{
+		domains: []vms.LibvirtDomain{{Name: "web", UUID: libvirtWebUUID, State: "running", Persistent: true}},
+		liveXML: map[string]string{"web": libvirtWebXML},
+	}
+	imagesDir := t.TempDir()
+	l, cfg := newTestLibvirtRestorer(t, conn, imagesDir, libvirtWebXML)
+	target := filepath.Join(imagesDir, "dr")
+
+	result, err := l.Restore(context.Background(), cfg, "aaaa1111", LibvirtRestoreOptions{NewName: "web-dr", TargetDir: target, Start: true})
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	for name, want := range map[string]string{"web.qcow2": "web image", "debian-12.qcow2": "base image"} {
+		data, err := os.ReadFile(filepath.Join(target, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v", name, data, err)
+		}
+	}
+	if entries, _ := os.ReadDir(target); len(entries) != 2 {
+		t.Errorf("staging directory left behind: %v", entries)
+	}
+
+	if len(conn.defined) != 1 {
+		t.Fatalf("defined %d domains", len(conn.defined))
+	}
+	defined := conn.defined[0]
+	if !strings.Contains(defined, "<name>web-dr</name>") || strings.Contains(defined, "<uuid>") ||
+		strings.Contains(defined, "<mac ") || !strings.Contains(defined, "<source file='"+filepath.Join(target, "web.qcow2")+"'/>") {
+		t.Errorf("defined xml:\n%s", defined)
+	}
+	if len(conn.undefined) != 0 || len(conn.started) != 1 || conn.started[0] != "web-dr" {
+		t.Errorf("undefined = %v, started = %v", conn.undefined, conn.started)
+	}
+
+	if result.Domain != "web-dr" || !result.Started || len(result.Disks) != 2 || len(result.Warnings) != 1 ||
+		!strings.Contains(result.Warnings[0], "backing chain") {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestLibvirtSnapshotRestorer_Conflicts(t *testing.T) {
+	const hostdevXML = `<domain type='kvm'>
+  <name>web</name>
+  <devices>
+    <hostdev mode='subsystem' type='pci'/>
+  </devices>
+</domain>
+`
+	tests := []struct {
+		name      string
+		conn      *fakeLibvirtConn
+		opts      LibvirtRestoreOptions
+		domainXML string
+		wantErr   string
+	}{
+		{
+			name:    "existing domain",
+			conn:    &fakeLibvirtConn{domains: []vms.LibvirtDomain{{Name: "web", UUID: libvirtWebUUID, State: "shut off"}}},
+			wantErr: "already exists",
+		},
+		{
+			name:    "running domain",
+			conn:    &fakeLibvirtConn{domains: []vms.LibvirtDomain{{Name: "web", UUID: libvirtWebUUID, State: "running"}}},
+			opts:    LibvirtRestoreOptions{Overwrite: true},
+			wantErr: "shut it down",
+		},
+		{
+			name:    "overwrite of a different domain",
+			conn:    &fakeLibvirtConn{domains: []vms.LibvirtDomain{{Name: "web", UUID: "0b6e1c2a-7f4d-4a55-9d3e-2c1f0e9b8a77", State: "shut off"}}},
+			opts:    LibvirtRestoreOptions{Overwrite: true},
+			wantErr: "overwrite only replaces the backed up domain",
+		},
+		{
+			name: "images in use by another domain",
+			conn: &fakeLibvirtConn{
+				domains: []vms.LibvirtDomain{{Name: "web", UUID: libvirtWebUUID, State: "shut off"}},
+				liveXML: map[string]string{"web": libvirtWebXML},
+			},
+			opts:    LibvirtRestoreOptions{NewName: "web-dr", Overwrite: true},
+			wantErr: "in use by domain web",
+		},
+		{
+			name:    "target outside the images directory",
+			conn:    &fakeLibvirtConn{},
+			opts:    LibvirtRestoreOptions{TargetDir: "/srv/dr", Overwrite: true},
+			wantErr: "outside the libvirt images directory",
+		},
+		{
+			name:    "unknown domain",
+			conn:    &fakeLibvirtConn{},
+			opts:    LibvirtRestoreOptions{Domain: "db"},
+			wantErr: "domain db not found in snapshot",
+		},
+		{
+			name:      "device outside the allowlist",
+			conn:      &fakeLibvirtConn{},
+			domainXML: hostdevXML,
+			wantErr:   "hostdev",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domainXML := tt.domainXML
+			if domainXML == "" {
+				domainXML = libvirtWebXML
+			}
+			l, cfg := newTestLibvirtRestorer(t, tt.conn, "", domainXML)
+			_, err := l.Restore(context.Background(), cfg, "aaaa1111", tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Restore() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(tt.conn.defined) != 0 || len(tt.conn.undefined) != 0 {
+				t.Errorf("defined = %d, undefined = %v", len(tt.conn.defined), tt.conn.undefined)
+			}
+		})
+	}
+}
+
+func TestLibvirtSnapshotRestorer_SymlinkOutsideImagesDir(t *testing.T) {
+	conn := &fakeLibvirtConn{}
+	imagesDir, outside := t.TempDir(), t.TempDir()
+	l, cfg := newTestLibvirtRestorer(t, conn, imagesDir, libvirtWebXML)
+	if err := os.Symlink(outside, filepath.Join(imagesDir, "dr")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := l.Restore(context.Background(), cfg, "aaaa1111", LibvirtRestoreOptions{TargetDir: filepath.Join(imagesDir, "dr"), Overwrite: true})
+	if err == nil || !strings.Contains(err.Error(), "outside the libvirt images directory") {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("wrote through the symlink: %v", entries)
+	}
+	if len(conn.defined) != 0 {
+		t.Errorf("defined = %d", len(conn.defined))
+	}
+}
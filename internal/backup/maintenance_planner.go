@@ -0,0 +1,540 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// ErrMaintenanceRunning is returned when maintenance is already running for a repository.
+var ErrMaintenanceRunning = errors.New("repository maintenance is already running")
+
+// Maintenance run triggers.
+const (
+	MaintenanceTriggerScheduled = "scheduled"
+	MaintenanceTriggerManual    = "manual"
+	// MaintenanceTriggerPurge prunes data unreferenced by a snapshot purge.
+	MaintenanceTriggerPurge = "purge"
+)
+
+// MaintenancePlannerStore defines the persistence operations used by the
+// maintenance planner.
+type MaintenancePlannerStore interface {
+	GetRepository(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	GetEnabledRepositoryMaintenancePolicies(ctx context.Context) ([]*models.RepositoryMaintenancePolicy, error)
+	UpdateRepositoryMaintenancePolicyLastRun(ctx context.Context, id uuid.UUID, lastRunAt time.Time) error
+	GetLastPruneRepositoryMaintenanceRun(ctx context.Context, repositoryID uuid.UUID) (*models.RepositoryMaintenanceRun, error)
+	CreateRepositoryMaintenanceRun(ctx context.Context, run *models.RepositoryMaintenanceRun) error
+	UpdateRepositoryMaintenanceRun(ctx context.Context, run *models.RepositoryMaintenanceRun) error
+	ListActiveMaintenanceWindows(ctx context.Context, orgID uuid.UUID, now time.Time) ([]*models.MaintenanceWindow, error)
+	GetStorageTierConfigs(ctx context.Context, orgID uuid.UUID) ([]*models.StorageTierConfig, error)
+}
+
+// MaintenancePlannerConfig holds configuration for the maintenance planner.
+type MaintenancePlannerConfig struct {
+	// CheckInterval is how often policies are checked for due maintenance.
+	CheckInterval time.Duration
+
+	// PasswordFunc retrieves the repository password.
+	PasswordFunc func(repoID uuid.UUID) (string, error)
+
+	// DecryptFunc decrypts the repository configuration.
+	DecryptFunc DecryptFunc
+}
+
+// DefaultMaintenancePlannerConfig returns a MaintenancePlannerConfig with sensible defaults.
+func DefaultMaintenancePlannerConfig() MaintenancePlannerConfig {
+	return MaintenancePlannerConfig{
+		CheckInterval: 15 * time.Minute,
+	}
+}
+
+// MaintenancePlanner runs restic maintenance on repositories according to
+// their maintenance policies. Each run upgrades version 1 repositories to
+// version 2, estimates what prune would reclaim with a dry run, weighs that
+// against early-deletion fees of the storage class, and then prunes and
+// compresses old packs. Scheduled runs only start inside a maintenance
+// window and are cancelled when the window ends.
+type MaintenancePlanner struct {
+	store  MaintenancePlannerStore
+	restic *Restic
+	config MaintenancePlannerConfig
+	repos  *RepositoryConfigResolver
+	logger zerolog.Logger
+
+	runs   runGuard
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewMaintenancePlanner creates a new MaintenancePlanner.
+func NewMaintenancePlanner(store MaintenancePlannerStore, restic *Restic, config MaintenancePlannerConfig, logger zerolog.Logger) *MaintenancePlanner {
+	return &MaintenancePlanner{
+		store:  store,
+		restic: restic,
+		config: config,
+		repos:  NewRepositoryConfigResolver(store, config.DecryptFunc, config.PasswordFunc),
+		logger: logger.With().Str("component", "maintenance_planner").Logger(),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start begins checking for due maintenance.
+func (p *MaintenancePlanner) Start(ctx context.Context) {
+	p.wg.Add(1)
+	go p.loop(ctx)
+	p.logger.Info().
+		Dur("check_interval", p.config.CheckInterval).
+		Msg("maintenance planner started")
+}
+
+// Stop stops checking for due maintenance and waits for scheduled runs to finish.
+func (p *MaintenancePlanner) Stop() {
+	close(p.stopCh)
+	p.wg.Wait()
+	p.logger.Info().Msg("maintenance planner stopped")
+}
+
+func (p *MaintenancePlanner) loop(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stopCh:
+			return
+		case <-ticker.C:
+			p.RunDue(ctx)
+		}
+	}
+}
+
+// RunDue runs maintenance for every enabled policy that is due. Policies that
+// require a maintenance window wait until one is active.
+func (p *MaintenancePlanner) RunDue(ctx context.Context) {
+	policies, err := p.store.GetEnabledRepositoryMaintenancePolicies(ctx)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("failed to list repository maintenance policies")
+		return
+	}
+
+	now := time.Now()
+	for _, policy := range policies {
+		if !policy.IsDue(now) {
+			continue
+		}
+
+		runCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.RequireMaintenanceWindow {
+			window, err := p.activeWindow(ctx, policy.OrgID, now)
+			if err != nil {
+				p.logger.Error().Err(err).Str("org_id", policy.OrgID.String()).Msg("failed to list maintenance windows")
+				continue
+			}
+			if window == nil {
+				continue
+			}
+			runCtx, cancel = context.WithDeadline(ctx, window.EndsAt)
+		}
+
+		if _, err := p.Run(runCtx, policy, MaintenanceTriggerScheduled); err != nil && !errors.Is(err, ErrMaintenanceRunning) {
+			p.logger.Error().Err(err).Str("repository_id", policy.RepositoryID.String()).Msg("repository maintenance failed")
+		}
+		cancel()
+	}
+}
+
+// activeWindow returns the active maintenance window ending last, or nil.
+func (p *MaintenancePlanner) activeWindow(ctx context.Context, orgID uuid.UUID, now time.Time) (*models.MaintenanceWindow, error) {
+	windows, err := p.store.ListActiveMaintenanceWindows(ctx, orgID, now)
+	if err != nil {
+		return nil, err
+	}
+	var active *models.MaintenanceWindow
+	for _, w := range windows {
+		if w.IsActive(now) && (active == nil || w.EndsAt.After(active.EndsAt)) {
+			active = w
+		}
+	}
+	return active, nil
+}
+
+// StartRun runs maintenance for a policy in the background. It returns
+// ErrMaintenanceRunning if maintenance is already running for the repository.
+func (p *MaintenancePlanner) StartRun(ctx context.Context, policy *models.RepositoryMaintenancePolicy) error {
+	if !p.runs.claim(policy.RepositoryID) {
+		return ErrMaintenanceRunning
+	}
+	go func() {
+		defer p.runs.release(policy.RepositoryID)
+		if _, err := p.run(ctx, policy, MaintenanceTriggerManual); err != nil {
+			p.logger.Error().Err(err).Str("repository_id", policy.RepositoryID.String()).Msg("repository maintenance failed")
+		}
+	}()
+	return nil
+}
+
+// StartPrune prunes a repository in the background, outside of any policy,
+// and records it as a maintenance run. It shares the per-repository lock with
+// maintenance and returns ErrMaintenanceRunning if a run is in progress.
+func (p *MaintenancePlanner) StartPrune(ctx context.Context, orgID, repositoryID uuid.UUID, trigger string) error {
+	if !p.runs.claim(repositoryID) {
+		return ErrMaintenanceRunning
+	}
+	go func() {
+		defer p.runs.release(repositoryID)
+		if _, err := p.runPrune(ctx, orgID, repositoryID, trigger); err != nil {
+			p.logger.Error().Err(err).Str("repository_id", repositoryID.String()).Msg("repository prune failed")
+		}
+	}()
+	return nil
+}
+
+func (p *MaintenancePlanner) runPrune(ctx context.Context, orgID, repositoryID uuid.UUID, trigger string) (*models.RepositoryMaintenanceRun, error) {
+	run := models.NewRepositoryMaintenanceRun(orgID, repositoryID, trigger)
+	if err := p.store.CreateRepositoryMaintenanceRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("create maintenance run: %w", err)
+	}
+	logger := p.logger.With().Str("repository_id", repositoryID.String()).Str("run_id", run.ID.String()).Logger()
+
+	err := p.prune(ctx, repositoryID, run, logger)
+	if err != nil {
+		run.Finish(models.RepositoryMaintenanceRunStatusFailed, err.Error())
+	} else {
+		run.Finish(models.RepositoryMaintenanceRunStatusCompleted, "")
+	}
+	if updateErr := p.store.UpdateRepositoryMaintenanceRun(context.WithoutCancel(ctx), run); updateErr != nil {
+		logger.Error().Err(updateErr).Msg("failed to record maintenance run")
+	}
+
+	logger.Info().
+		Str("status", string(run.Status)).
+		Int64("reclaimed_bytes", run.ReclaimedBytes()).
+		Msg("repository prune finished")
+	return run, err
+}
+
+func (p *MaintenancePlanner) prune(ctx context.Context, repositoryID uuid.UUID, run *models.RepositoryMaintenanceRun, logger zerolog.Logger) error {
+	_, cfg, err := p.repos.ResolveWritable(ctx, repositoryID)
+	if err != nil {
+		return err
+	}
+
+	before, err := p.restic.RawStats(ctx, cfg)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to read repository stats before prune")
+	}
+	run.StatsBefore = toRepoStatsRecord(before)
+
+	if _, err := p.restic.PruneWithOptions(ctx, cfg, PruneOptions{}); err != nil {
+		return err
+	}
+	run.Actions = append(run.Actions, models.MaintenanceActionPrune)
+
+	after, err := p.restic.RawStats(ctx, cfg)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to read repository stats after prune")
+	}
+	run.StatsAfter = toRepoStatsRecord(after)
+	return nil
+}
+
+// Run runs maintenance for a policy in the calling goroutine and returns the
+// recorded run.
+func (p *MaintenancePlanner) Run(ctx context.Context, policy *models.RepositoryMaintenancePolicy, trigger string) (*models.RepositoryMaintenanceRun, error) {
+	if !p.runs.claim(policy.RepositoryID) {
+		return nil, ErrMaintenanceRunning
+	}
+	defer p.runs.release(policy.RepositoryID)
+	return p.run(ctx, policy, trigger)
+}
+
+// Plan estimates what maintenance would do for a policy without changing the
+// repository.
+func (p *MaintenancePlanner) Plan(ctx context.Context, policy *models.RepositoryMaintenancePolicy) (*models.RepositoryMaintenancePlan, error) {
+	repo, cfg, err := p.repos.Resolve(ctx, policy.RepositoryID)
+	if err != nil {
+		return nil, err
+	}
+	plan, _, err := p.plan(ctx, policy, repo, cfg)
+	return plan, err
+}
+
+func (p *MaintenancePlanner) plan(
+	ctx context.Context,
+	policy *models.RepositoryMaintenancePolicy,
+	repo *models.Repository,
+	cfg ResticConfig,
+) (*models.RepositoryMaintenancePlan, *RepoStats, error) {
+	version, err := p.restic.RepositoryVersion(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats, err := p.restic.RawStats(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	profile := models.StorageClassProfileFor(repo.Type, policy.StorageClass)
+	opts := pruneOptionsFor(policy, profile, version)
+	opts.DryRun = true
+	estimate, err := p.restic.PruneWithOptions(ctx, cfg, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var lastPrune *time.Time
+	last, err := p.store.GetLastPruneRepositoryMaintenanceRun(ctx, repo.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get last prune: %w", err)
+	}
+	if last != nil {
+		lastPrune = last.CompletedAt
+	}
+
+	tiers, err := p.store.GetStorageTierConfigs(ctx, repo.OrgID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get storage tier configs: %w", err)
+	}
+
+	plan := PlanRepositoryMaintenance(policy, profile, version, stats, estimate, lastPrune, tierCostPerGBMonth(tiers, profile.Tier), time.Now())
+	plan.RepositoryID = repo.ID
+	return plan, stats, nil
+}
+
+// PlanRepositoryMaintenance decides what a maintenance run should do from the
+// repository version, its raw-data stats and a prune dry run.
+//
+// Upgrading only changes the repository config, so it is always worthwhile.
+// Pruning is skipped when it reclaims less than the policy's minimum, and
+// deferred when the packs it would delete are likely younger than the
+// storage class's minimum storage duration and the early-deletion fee
+// exceeds a month of savings. Archive tiers are never repacked because their
+// packs cannot be read without a restore.
+func PlanRepositoryMaintenance(
+	policy *models.RepositoryMaintenancePolicy,
+	profile models.StorageClassProfile,
+	version int,
+	stats *RepoStats,
+	estimate *PruneEstimate,
+	lastPrune *time.Time,
+	costPerGBMonth float64,
+	now time.Time,
+) *models.RepositoryMaintenancePlan {
+	opts := pruneOptionsFor(policy, profile, version)
+	plan := &models.RepositoryMaintenancePlan{
+		RepositoryID:          policy.RepositoryID,
+		RepositoryVersion:     version,
+		Upgrade:               policy.UpgradeRepository && version < 2,
+		MaxUnused:             opts.MaxUnused,
+		StorageClass:          profile,
+		EstimatedReclaimBytes: estimate.ReclaimBytes,
+		EstimatedRepackBytes:  estimate.RepackBytes,
+		Stats:                 toRepoStatsRecord(stats),
+		PlannedAt:             now,
+	}
+
+	plan.RepackUncompressed = policy.RepackUncompressed && (version >= 2 || plan.Upgrade) &&
+		profile.Tier != models.StorageTierArchive && stats.CompressionProgress < 100
+	if plan.RepackUncompressed && !opts.RepackUncompressed {
+		// The dry run could not include compression because the repository
+		// is still version 1, so all of its data will be rewritten.
+		plan.EstimatedRepackBytes += int64(float64(stats.TotalSize) * (100 - stats.CompressionProgress) / 100)
+	}
+	if policy.RepackUncompressed && profile.Tier == models.StorageTierArchive {
+		plan.SkipReasons = append(plan.SkipReasons, "archive storage cannot be repacked; only unused packs are deleted")
+	}
+
+	plan.Prune = plan.RepackUncompressed || plan.EstimatedReclaimBytes > 0
+	if plan.Prune && !plan.RepackUncompressed && plan.EstimatedReclaimBytes < policy.MinReclaimBytes {
+		plan.Prune = false
+		plan.SkipReasons = append(plan.SkipReasons, fmt.Sprintf("prune would reclaim %s, below the %s minimum",
+			formatBytes(plan.EstimatedReclaimBytes), formatBytes(policy.MinReclaimBytes)))
+	}
+
+	const bytesPerGB = 1 << 30
+	plan.EstimatedMonthlySavings = float64(plan.EstimatedReclaimBytes) / bytesPerGB * costPerGBMonth
+
+	if plan.Prune && profile.MinStorageDays > 0 && lastPrune != nil {
+		// Packs written by the last prune's repack are the youngest ones this
+		// prune can delete.
+		remaining := float64(profile.MinStorageDays) - now.Sub(*lastPrune).Hours()/24
+		if remaining > 0 {
+			deleted := float64(plan.EstimatedReclaimBytes+plan.EstimatedRepackBytes) / bytesPerGB
+			plan.EstimatedEarlyDeletionCost = deleted * costPerGBMonth * remaining / 30
+			if plan.EstimatedEarlyDeletionCost > plan.EstimatedMonthlySavings {
+				plan.Prune = false
+				plan.RepackUncompressed = false
+				plan.SkipReasons = append(plan.SkipReasons, fmt.Sprintf(
+					"early-deletion fee of %.2f exceeds monthly savings of %.2f; deferred until %s",
+					plan.EstimatedEarlyDeletionCost, plan.EstimatedMonthlySavings,
+					lastPrune.AddDate(0, 0, profile.MinStorageDays).Format("2006-01-02")))
+			}
+		}
+	}
+
+	return plan
+}
+
+// pruneOptionsFor returns the prune options for a policy on the given
+// storage class and repository version.
+func pruneOptionsFor(policy *models.RepositoryMaintenancePolicy, profile models.StorageClassProfile, version int) PruneOptions {
+	opts := PruneOptions{
+		MaxUnused:          policy.MaxUnused,
+		MaxRepackSize:      policy.MaxRepackSize,
+		RepackUncompressed: policy.RepackUncompressed && version >= 2,
+	}
+	if profile.Tier == models.StorageTierArchive {
+		opts.MaxUnused = "unlimited"
+		opts.RepackUncompressed = false
+	}
+	return opts
+}
+
+// tierCostPerGBMonth returns the organization's storage cost for a tier,
+// falling back to the default tier pricing.
+func tierCostPerGBMonth(configs []*models.StorageTierConfig, tier models.StorageTierType) float64 {
+	for _, c := range configs {
+		if c.TierType == tier && c.Enabled {
+			return c.CostPerGBMonth
+		}
+	}
+	for _, c := range models.DefaultTierConfigs(uuid.Nil) {
+		if c.TierType == tier {
+			return c.CostPerGBMonth
+		}
+	}
+	return 0
+}
+
+func (p *MaintenancePlanner) run(ctx context.Context, policy *models.RepositoryMaintenancePolicy, trigger string) (*models.RepositoryMaintenanceRun, error) {
+	run := models.NewRepositoryMaintenanceRun(policy.OrgID, policy.RepositoryID, trigger)
+	if err := p.store.CreateRepositoryMaintenanceRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("create maintenance run: %w", err)
+	}
+	logger := p.logger.With().Str("repository_id", policy.RepositoryID.String()).Str("run_id", run.ID.String()).Logger()
+
+	err := p.maintain(ctx, policy, run, logger)
+	switch {
+	case err != nil:
+		run.Finish(models.RepositoryMaintenanceRunStatusFailed, err.Error())
+	case len(run.Actions) == 0:
+		run.Finish(models.RepositoryMaintenanceRunStatusSkipped, "")
+	default:
+		run.Finish(models.RepositoryMaintenanceRunStatusCompleted, "")
+	}
+
+	// Record the outcome even if the maintenance window has closed.
+	saveCtx := context.WithoutCancel(ctx)
+	if updateErr := p.store.UpdateRepositoryMaintenanceRun(saveCtx, run); updateErr != nil {
+		logger.Error().Err(updateErr).Msg("failed to record maintenance run")
+	}
+	if updateErr := p.store.UpdateRepositoryMaintenancePolicyLastRun(saveCtx, policy.ID, run.StartedAt); updateErr != nil {
+		logger.Error().Err(updateErr).Msg("failed to update maintenance policy")
+	}
+
+	logger.Info().
+		Str("status", string(run.Status)).
+		Strs("actions", run.Actions).
+		Int64("reclaimed_bytes", run.ReclaimedBytes()).
+		Msg("repository maintenance finished")
+	return run, err
+}
+
+func (p *MaintenancePlanner) maintain(ctx context.Context, policy *models.RepositoryMaintenancePolicy, run *models.RepositoryMaintenanceRun, logger zerolog.Logger) error {
+	repo, cfg, err := p.repos.ResolveWritable(ctx, policy.RepositoryID)
+	if err != nil {
+		return err
+	}
+
+	plan, stats, err := p.plan(ctx, policy, repo, cfg)
+	if err != nil {
+		return err
+	}
+	run.RepositoryVersionBefore = plan.RepositoryVersion
+	run.RepositoryVersionAfter = plan.RepositoryVersion
+	run.StatsBefore = plan.Stats
+	run.SkipReasons = plan.SkipReasons
+	run.EstimatedReclaimBytes = plan.EstimatedReclaimBytes
+	run.EstimatedEarlyDeletionCost = plan.EstimatedEarlyDeletionCost
+	if !plan.HasWork() {
+		run.StatsAfter = plan.Stats
+		return nil
+	}
+
+	if plan.Upgrade {
+		logger.Info().Msg("upgrading repository to version 2")
+		if err := p.restic.UpgradeRepoV2(ctx, cfg); err != nil {
+			return err
+		}
+		run.Actions = append(run.Actions, models.MaintenanceActionUpgrade)
+		run.RepositoryVersionAfter = 2
+
+		// restic recommends checking the repository after the upgrade.
+		if _, err := p.restic.CheckWithOptions(ctx, cfg, CheckOptions{}); err != nil {
+			return err
+		}
+		run.Actions = append(run.Actions, models.MaintenanceActionCheck)
+	}
+
+	if plan.Prune {
+		opts := PruneOptions{
+			MaxUnused:          plan.MaxUnused,
+			MaxRepackSize:      policy.MaxRepackSize,
+			RepackUncompressed: plan.RepackUncompressed,
+		}
+		if _, err := p.restic.PruneWithOptions(ctx, cfg, opts); err != nil {
+			return err
+		}
+		run.Actions = append(run.Actions, models.MaintenanceActionPrune)
+		if plan.RepackUncompressed {
+			run.Actions = append(run.Actions, models.MaintenanceActionRepackUncompressed)
+		}
+	}
+
+	after, err := p.restic.RawStats(ctx, cfg)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to read repository stats after maintenance")
+		after = stats
+	}
+	run.StatsAfter = toRepoStatsRecord(after)
+	return nil
+}
+
+func toRepoStatsRecord(stats *RepoStats) *models.RepoStatsRecord {
+	if stats == nil {
+		return nil
+	}
+	return &models.RepoStatsRecord{
+		TotalSize:             stats.TotalSize,
+		TotalUncompressedSize: stats.TotalUncompressedSize,
+		CompressionRatio:      stats.CompressionRatio,
+		CompressionProgress:   stats.CompressionProgress,
+		BlobCount:             stats.TotalBlobCount,
+		SnapshotCount:         stats.SnapshotsCount,
+	}
+}
+
+// formatBytes formats bytes into a human-readable string.
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,376 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const prunePlanOutput = `loading indexes...
+collecting packs for deletion and repacking
+
+to repack:            69 blobs / 1.000 GiB
+this removes:         67 blobs / 512.000 MiB
+to delete:             7 blobs / 1.500 GiB
+total prune:          74 blobs / 2.000 GiB
+remaining:         16613 blobs / 10.000 GiB
+unused size after prune: 0 B (0.00% of remaining size)
+`
+
+func TestParsePruneOutput(t *testing.T) {
+	got := parsePruneOutput([]byte(prunePlanOutput))
+	if got.RepackBytes != 1<<30 || got.ReclaimBytes != 2<<30 || got.RemainingBytes != 10<<30 {
+		t.Errorf("estimate = %+v", got)
+	}
+
+	if got := parsePruneOutput([]byte("nothing to do\n")); got.ReclaimBytes != 0 {
+		t.Errorf("expected empty estimate, got %+v", got)
+	}
+
+	for in, want := range map[string]int64{
+		"512 B":     512,
+		"1.5 KiB":   1536,
+		" 2 MiB":    2 << 20,
+		"1 parsecs": 0,
+		"":          0,
+	} {
+		if got := parseResticSize(in); got != want {
+			t.Errorf("parseResticSize(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestPlanRepositoryMaintenance(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	hot := models.StorageClassProfileFor(models.RepositoryTypeS3, "")
+	ia := models.StorageClassProfileFor(models.RepositoryTypeS3, "standard_ia")
+	archive := models.StorageClassProfileFor(models.RepositoryTypeS3, "DEEP_ARCHIVE")
+	compressed := &RepoStats{TotalSize: 10 << 30, CompressionProgress: 100}
+	estimate := &PruneEstimate{ReclaimBytes: 2 << 30, RepackBytes: 1 << 30}
+
+	newPolicy := func() *models.RepositoryMaintenancePolicy {
+		return models.NewRepositoryMaintenancePolicy(uuid.New(), uuid.New())
+	}
+
+	t.Run("v1 repository is upgraded and compressed", func(t *testing.T) {
+		stats := &RepoStats{TotalSize: 10 << 30}
+		plan := PlanRepositoryMaintenance(newPolicy(), hot, 1, stats, &PruneEstimate{}, nil, 0.023, now)
+		if !plan.Upgrade || !plan.Prune || !plan.RepackUncompressed {
+			t.Fatalf("plan = %+v", plan)
+		}
+		if plan.EstimatedRepackBytes != 10<<30 {
+			t.Errorf("repack bytes = %d, want all data", plan.EstimatedRepackBytes)
+		}
+	})
+
+	t.Run("upgrade disabled leaves v1 uncompressed", func(t *testing.T) {
+		policy := newPolicy()
+		policy.UpgradeRepository = false
+		plan := PlanRepositoryMaintenance(policy, hot, 1, &RepoStats{TotalSize: 1 << 30}, &PruneEstimate{}, nil, 0.023, now)
+		if plan.Upgrade || plan.RepackUncompressed || plan.Prune {
+			t.Errorf("plan = %+v", plan)
+		}
+	})
+
+	t.Run("below minimum reclaim is skipped", func(t *testing.T) {
+		policy := newPolicy()
+		policy.MinReclaimBytes = 5 << 30
+		plan := PlanRepositoryMaintenance(policy, hot, 2, compressed, estimate, nil, 0.023, now)
+		if plan.Prune || len(plan.SkipReasons) != 1 {
+			t.Errorf("plan = %+v", plan)
+		}
+	})
+
+	t.Run("early deletion fee defers prune", func(t *testing.T) {
+		lastPrune := now.AddDate(0, 0, -10)
+		plan := PlanRepositoryMaintenance(newPolicy(), ia, 2, compressed, estimate, &lastPrune, 0.0125, now)
+		if plan.Prune {
+			t.Fatalf("expected prune to be deferred: %+v", plan)
+		}
+		if plan.EstimatedEarlyDeletionCost <= plan.EstimatedMonthlySavings {
+			t.Errorf("fee %.4f should exceed savings %.4f", plan.EstimatedEarlyDeletionCost, plan.EstimatedMonthlySavings)
+		}
+		if len(plan.SkipReasons) != 1 || !strings.Contains(plan.SkipReasons[0], "2026-06-21") {
+			t.Errorf("skip reasons = %v", plan.SkipReasons)
+		}
+
+		// Once the minimum storage duration has passed there is no fee.
+		lastPrune = now.AddDate(0, 0, -45)
+		plan = PlanRepositoryMaintenance(newPolicy(), ia, 2, compressed, estimate, &lastPrune, 0.0125, now)
+		if !plan.Prune || plan.EstimatedEarlyDeletionCost != 0 {
+			t.Errorf("plan = %+v", plan)
+		}
+	})
+
+	t.Run("archive storage is never repacked", func(t *testing.T) {
+		stats := &RepoStats{TotalSize: 10 << 30}
+		plan := PlanRepositoryMaintenance(newPolicy(), archive, 2, stats, estimate, nil, 0.00099, now)
+		if plan.RepackUncompressed || plan.MaxUnused != "unlimited" {
+			t.Errorf("plan = %+v", plan)
+		}
+		if !plan.Prune {
+			t.Error("unused packs should still be deleted")
+		}
+	})
+}
+
+// maintenanceScript fakes the restic commands used by the maintenance
+// planner for a version 1 repository, logging each invocation.
+const maintenanceScript = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/calls.log"
+case "$1" in
+cat) echo '{"version":1,"id":"abc"}' ;;
+stats) echo '{"total_size":10737418240,"snapshots_count":4,"total_blob_count":100}' ;;
+prune) printf 'total prune: 74 blobs / 2.000 GiB\nto repack: 3 blobs / 1.000 GiB\n' ;;
+migrate|check) ;;
+*) echo "unexpected command $1" >&2; exit 1 ;;
+esac
+`
+
+type fakeMaintenanceStore struct {
+	repo        *models.Repository
+	windows     []*models.MaintenanceWindow
+	policies    []*models.RepositoryMaintenancePolicy
+	runs        []*models.RepositoryMaintenanceRun
+	lastRunAt   map[uuid.UUID]time.Time
+	failWindows bool
+}
+
+func (s *fakeMaintenanceStore) GetRepository(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	if id != s.repo.ID {
+		return nil, errors.New("not found")
+	}
+	return s.repo, nil
+}
+
+func (s *fakeMaintenanceStore) GetEnabledRepositoryMaintenancePolicies(_ context.Context) ([]*models.RepositoryMaintenancePolicy, error) {
+	return s.policies, nil
+}
+
+func (s *fakeMaintenanceStore) UpdateRepositoryMaintenancePolicyLastRun(_ context.Context, id uuid.UUID, lastRunAt time.Time) error {
+	s.lastRunAt[id] = lastRunAt
+	return nil
+}
+
+func (s *fakeMaintenanceStore) GetLastPruneRepositoryMaintenanceRun(_ context.Context, _ uuid.UUID) (*models.RepositoryMaintenanceRun, error) {
+	return nil, nil
+}
+
+func (s *fakeMaintenanceStore) CreateRepositoryMaintenanceRun(_ context.Context, run *models.RepositoryMaintenanceRun) error {
+	s.runs = append(s.runs, run)
+	return nil
+}
+
+func (s *fakeMaintenanceStore) UpdateRepositoryMaintenanceRun(_ context.Context, _ *models.RepositoryMaintenanceRun) error {
+	return nil
+}
+
+func (s *fakeMaintenanceStore) ListActiveMaintenanceWindows(_ context.Context, _ uuid.UUID, _ time.Time) ([]*models.MaintenanceWindow, error) {
+	if s.failWindows {
+		return nil, errors.New("db down")
+	}
+	return s.windows, nil
+}
+
+func (s *fakeMaintenanceStore) GetStorageTierConfigs(_ context.Context, _ uuid.UUID) ([]*models.StorageTierConfig, error) {
+	return nil, nil
+}
+
+func newMaintenanceTestPlanner(t *testing.T) (*MaintenancePlanner, *fakeMaintenanceStore, string) {
+	t.Helper()
+	dir := t.TempDir()
+	script := filepath.Join(dir, "restic")
+	if err := os.WriteFile(script, []byte(maintenanceScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	orgID := uuid.New()
+	repo := models.NewRepository(orgID, "nas", models.RepositoryTypeLocal, []byte(`{"path":"`+dir+`/repo"}`))
+	store := &fakeMaintenanceStore{
+		repo:      repo,
+		policies:  []*models.RepositoryMaintenancePolicy{models.NewRepositoryMaintenancePolicy(orgID, repo.ID)},
+		lastRunAt: make(map[uuid.UUID]time.Time),
+	}
+
+	config := DefaultMaintenancePlannerConfig()
+	config.DecryptFunc = func(b []byte) ([]byte, error) { return b, nil }
+	config.PasswordFunc = func(uuid.UUID) (string, error) { return "secret", nil }
+	planner := NewMaintenancePlanner(store, NewResticWithBinary(script, zerolog.Nop()), config, zerolog.Nop())
+	return planner, store, filepath.Join(dir, "calls.log")
+}
+
+func readCalls(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestMaintenancePlanner_Run(t *testing.T) {
+	planner, store, callLog := newMaintenanceTestPlanner(t)
+	policy := store.policies[0]
+
+	run, err := planner.Run(context.Background(), policy, MaintenanceTriggerManual)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if run.Status != models.RepositoryMaintenanceRunStatusCompleted {
+		t.Fatalf("status = %s: %s", run.Status, run.ErrorMessage)
+	}
+	want := []string{models.MaintenanceActionUpgrade, models.MaintenanceActionCheck, models.MaintenanceActionPrune, models.MaintenanceActionRepackUncompressed}
+	if strings.Join(run.Actions, ",") != strings.Join(want, ",") {
+		t.Errorf("actions = %v, want %v", run.Actions, want)
+	}
+	if run.RepositoryVersionBefore != 1 || run.RepositoryVersionAfter != 2 {
+		t.Errorf("versions = %d -> %d", run.RepositoryVersionBefore, run.RepositoryVersionAfter)
+	}
+	if run.StatsBefore == nil || run.StatsAfter == nil || run.StatsBefore.SnapshotCount != 4 {
+		t.Errorf("stats before=%+v after=%+v", run.StatsBefore, run.StatsAfter)
+	}
+	if _, ok := store.lastRunAt[policy.ID]; !ok {
+		t.Error("policy last run was not recorded")
+	}
+
+	calls := readCalls(t, callLog)
+	var pruneCalls []string
+	for _, call := range calls {
+		if strings.HasPrefix(call, "prune") {
+			pruneCalls = append(pruneCalls, call)
+		}
+	}
+	if len(pruneCalls) != 2 {
+		t.Fatalf("prune calls = %v", pruneCalls)
+	}
+	// The dry run cannot compress a version 1 repository; the real run does.
+	if !strings.Contains(pruneCalls[0], "--dry-run") || strings.Contains(pruneCalls[0], "--repack-uncompressed") {
+		t.Errorf("dry run = %q", pruneCalls[0])
+	}
+	if strings.Contains(pruneCalls[1], "--dry-run") || !strings.Contains(pruneCalls[1], "--repack-uncompressed") ||
+		!strings.Contains(pruneCalls[1], "--max-unused 5%") {
+		t.Errorf("prune = %q", pruneCalls[1])
+	}
+}
+
+func TestMaintenancePlanner_RunDue(t *testing.T) {
+	t.Run("waits for a maintenance window", func(t *testing.T) {
+		planner, store, callLog := newMaintenanceTestPlanner(t)
+		planner.RunDue(context.Background())
+		if len(store.runs) != 0 || len(readCalls(t, callLog)) != 0 {
+			t.Errorf("maintenance ran outside a window: runs=%d", len(store.runs))
+		}
+	})
+
+	t.Run("runs inside a maintenance window", func(t *testing.T) {
+		planner, store, _ := newMaintenanceTestPlanner(t)
+		now := time.Now()
+		store.windows = []*models.MaintenanceWindow{
+			models.NewMaintenanceWindow(store.repo.OrgID, "weekend", now.Add(-time.Hour), now.Add(time.Hour)),
+		}
+		planner.RunDue(context.Background())
+		if len(store.runs) != 1 || store.runs[0].Trigger != MaintenanceTriggerScheduled {
+			t.Fatalf("runs = %+v", store.runs)
+		}
+	})
+
+	t.Run("skips policies that are not due", func(t *testing.T) {
+		planner, store, _ := newMaintenanceTestPlanner(t)
+		recent := time.Now().Add(-time.Hour)
+		store.policies[0].LastRunAt = &recent
+		store.policies[0].RequireMaintenanceWindow = false
+		planner.RunDue(context.Background())
+		if len(store.runs) != 0 {
+			t.Errorf("runs = %d, want 0", len(store.runs))
+		}
+	})
+
+	t.Run("window lookup failure skips the policy", func(t *testing.T) {
+		planner, store, _ := newMaintenanceTestPlanner(t)
+		store.failWindows = true
+		planner.RunDue(context.Background())
+		if len(store.runs) != 0 {
+			t.Errorf("runs = %d, want 0", len(store.runs))
+		}
+	})
+}
+
+func TestMaintenancePlanner_RunningConflict(t *testing.T) {
+	planner, store, _ := newMaintenanceTestPlanner(t)
+	policy := store.policies[0]
+	if !planner.runs.claim(policy.RepositoryID) {
+		t.Fatal("claim failed")
+	}
+	defer planner.runs.release(policy.RepositoryID)
+
+	if _, err := planner.Run(context.Background(), policy, MaintenanceTriggerManual); !errors.Is(err, ErrMaintenanceRunning) {
+		t.Errorf("Run() error = %v, want ErrMaintenanceRunning", err)
+	}
+	if err := planner.StartRun(context.Background(), policy); !errors.Is(err, ErrMaintenanceRunning) {
+		t.Errorf("StartRun() error = %v, want ErrMaintenanceRunning", err)
+	}
+}
+
+func TestMaintenancePlanner_Prune(t *testing.T) {
+	planner, store, callLog := newMaintenanceTestPlanner(t)
+
+	run, err := planner.runPrune(context.Background(), store.repo.OrgID, store.repo.ID, MaintenanceTriggerPurge)
+	if err != nil {
+		t.Fatalf("runPrune() error = %v", err)
+	}
+	if run.Status != models.RepositoryMaintenanceRunStatusCompleted || run.Trigger != MaintenanceTriggerPurge {
+		t.Fatalf("run = %+v", run)
+	}
+	if strings.Join(run.Actions, ",") != models.MaintenanceActionPrune || run.StatsBefore == nil || run.StatsAfter == nil {
+		t.Errorf("run = %+v", run)
+	}
+	var pruneCalls []string
+	for _, call := range readCalls(t, callLog) {
+		if strings.HasPrefix(call, "prune") {
+			pruneCalls = append(pruneCalls, call)
+		}
+	}
+	if len(pruneCalls) != 1 || strings.Contains(pruneCalls[0], "--dry-run") {
+		t.Errorf("prune calls = %v", pruneCalls)
+	}
+
+	t.Run("waits for running maintenance", func(t *testing.T) {
+		if !planner.runs.claim(store.repo.ID) {
+			t.Fatal("claim failed")
+		}
+		defer planner.runs.release(store.repo.ID)
+		if err := planner.StartPrune(context.Background(), store.repo.OrgID, store.repo.ID, MaintenanceTriggerPurge); !errors.Is(err, ErrMaintenanceRunning) {
+			t.Errorf("StartPrune() error = %v, want ErrMaintenanceRunning", err)
+		}
+	})
+}
+
+func TestMaintenancePlanner_ReadOnlyRepository(t *testing.T) {
+	planner, store, callLog := newMaintenanceTestPlanner(t)
+	store.repo.ReadOnly = true
+
+	run, err := planner.Run(context.Background(), store.policies[0], MaintenanceTriggerManual)
+	if !errors.Is(err, ErrRepositoryReadOnly) {
+		t.Errorf("Run() error = %v, want ErrRepositoryReadOnly", err)
+	}
+	if run == nil || run.Status != models.RepositoryMaintenanceRunStatusFailed {
+		t.Errorf("run = %+v, want a failed run", run)
+	}
+	if _, err := planner.runPrune(context.Background(), store.repo.OrgID, store.repo.ID, MaintenanceTriggerPurge); !errors.Is(err, ErrRepositoryReadOnly) {
+		t.Errorf("runPrune() error = %v, want ErrRepositoryReadOnly", err)
+	}
+	if calls := readCalls(t, callLog); len(calls) != 0 {
+		t.Errorf("restic called on a read-only repository: %v", calls)
+	}
+}
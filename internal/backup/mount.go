@@ -24,6 +24,7 @@ type MountInfo struct {
 	ExpiresAt    time.Time
 	cmd          *exec.Cmd
 	cancelFunc   context.CancelFunc
+	cleanupEnv   func()
 	unmountMutex sync.Mutex
 }
 
@@ -85,17 +86,27 @@ func (m *MountManager) Mount(ctx context.Context, id uuid.UUID, cfg backends.Res
 		mountPath,
 	}
 
-	cmd := exec.CommandContext(mountCtx, m.binary, args...)
+	// The materialized environment must outlive the request: it is
+	// cleaned up when the mount process exits.
+	env, cleanupEnv, err := cfg.MaterializeEnv()
+	if err != nil {
+		cancelFunc()
+		os.RemoveAll(mountPath)
+		return nil, fmt.Errorf("prepare mount environment: %w", err)
+	}
+
+	cmd := exec.CommandContext(mountCtx, m.binary, cfg.CommandArgs(args)...)
 
 	// Set environment variables
 	cmd.Env = append(os.Environ(), fmt.Sprintf("RESTIC_PASSWORD=%s", cfg.Password))
-	for k, v := range cfg.Env {
+	for k, v := range env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
 
 	// Start the mount process
 	if err := cmd.Start(); err != nil {
 		cancelFunc()
+		cleanupEnv()
 		os.RemoveAll(mountPath)
 		return nil, fmt.Errorf("start mount process: %w", err)
 	}
@@ -109,6 +120,7 @@ func (m *MountManager) Mount(ctx context.Context, id uuid.UUID, cfg backends.Res
 		ExpiresAt:  now.Add(timeout),
 		cmd:        cmd,
 		cancelFunc: cancelFunc,
+		cleanupEnv: cleanupEnv,
 	}
 
 	// Store mount info
@@ -134,6 +146,7 @@ func (m *MountManager) Mount(ctx context.Context, id uuid.UUID, cfg backends.Res
 // waitForMount waits for the mount process to exit and cleans up.
 func (m *MountManager) waitForMount(info *MountInfo) {
 	err := info.cmd.Wait()
+	info.cleanupEnv()
 
 	m.mountMutex.Lock()
 	delete(m.mounts, info.ID)
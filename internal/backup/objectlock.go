@@ -0,0 +1,191 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+)
+
+// ErrObjectLockUnsupported is returned when storage-level locking is requested
+// for a repository whose backend does not support S3 Object Lock.
+var ErrObjectLockUnsupported = errors.New("repository backend does not support s3 object lock")
+
+// ObjectLocker applies storage-level WORM protection to repository objects.
+// It is implemented by backends.S3ObjectLock paired with the repository's
+// restic config.
+type ObjectLocker interface {
+	// CheckEnabled verifies that the bucket has Object Lock enabled.
+	CheckEnabled(ctx context.Context) error
+
+	// ListObjects returns every object of the repository.
+	ListObjects(ctx context.Context) ([]backends.S3Object, error)
+
+	// SnapshotFiles resolves the pack and index files a snapshot references.
+	SnapshotFiles(ctx context.Context, snapshotID string) (backends.SnapshotFiles, error)
+
+	// SnapshotObjectKeys selects the objects a snapshot needs to be restored.
+	SnapshotObjectKeys(objects []backends.S3Object, files backends.SnapshotFiles) ([]string, error)
+
+	// SetRetention sets retention on objects until the given time.
+	SetRetention(ctx context.Context, keys []string, mode models.S3ObjectLockMode, until time.Time) (int, error)
+
+	// SetLegalHold turns the legal hold on objects on or off.
+	SetLegalHold(ctx context.Context, keys []string, on bool) error
+}
+
+// ObjectLockerResolver returns the ObjectLocker for a repository, or
+// ErrObjectLockUnsupported when its backend has no Object Lock support.
+type ObjectLockerResolver func(ctx context.Context, repositoryID uuid.UUID) (ObjectLocker, error)
+
+// ObjectLockStore is the store used to resolve a repository's backend.
+type ObjectLockStore interface {
+	GetRepository(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+}
+
+// S3ObjectLockers returns an ObjectLockerResolver for repositories stored on
+// S3-compatible backends. restic reads the repository index to find the
+// objects each snapshot references.
+func S3ObjectLockers(store ObjectLockStore, restic *Restic, decrypt DecryptFunc, password func(repoID uuid.UUID) (string, error)) ObjectLockerResolver {
+	repos := NewRepositoryConfigResolver(store, decrypt, password)
+	return func(ctx context.Context, repositoryID uuid.UUID) (ObjectLocker, error) {
+		repo, err := store.GetRepository(ctx, repositoryID)
+		if err != nil {
+			return nil, fmt.Errorf("get repository: %w", err)
+		}
+		if repo.Type != models.RepositoryTypeS3 {
+			return nil, ErrObjectLockUnsupported
+		}
+
+		configJSON, err := decrypt(repo.ConfigEncrypted)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt repository config: %w", err)
+		}
+		backend, err := backends.ParseBackend(repo.Type, configJSON)
+		if err != nil {
+			return nil, err
+		}
+		s3Backend, ok := backend.(*backends.S3Backend)
+		if !ok {
+			return nil, ErrObjectLockUnsupported
+		}
+		lock, err := s3Backend.OpenObjectLock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		_, cfg, err := repos.Resolve(ctx, repositoryID)
+		if err != nil {
+			return nil, err
+		}
+		return &s3RepositoryLocker{S3ObjectLock: lock, restic: restic, cfg: cfg}, nil
+	}
+}
+
+// s3RepositoryLocker pairs a bucket's Object Lock client with the restic
+// config of the repository stored in it.
+type s3RepositoryLocker struct {
+	*backends.S3ObjectLock
+	restic *Restic
+	cfg    ResticConfig
+}
+
+// SnapshotFiles resolves the pack and index files a snapshot references.
+func (l *s3RepositoryLocker) SnapshotFiles(ctx context.Context, snapshotID string) (backends.SnapshotFiles, error) {
+	return l.restic.SnapshotFiles(ctx, l.cfg, snapshotID)
+}
+
+// HeldSnapshot identifies a snapshot under legal hold.
+type HeldSnapshot struct {
+	SnapshotID string
+}
+
+// snapshotObjectKeys lists the repository objects a snapshot needs.
+func snapshotObjectKeys(ctx context.Context, locker ObjectLocker, objects []backends.S3Object, snapshotID string) ([]string, error) {
+	files, err := locker.SnapshotFiles(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	return locker.SnapshotObjectKeys(objects, files)
+}
+
+// lockSnapshotObjects sets retention on the objects of a snapshot.
+func lockSnapshotObjects(ctx context.Context, locker ObjectLocker, snapshotID string, mode models.S3ObjectLockMode, until time.Time) (int, error) {
+	objects, err := locker.ListObjects(ctx)
+	if err != nil {
+		return 0, err
+	}
+	keys, err := snapshotObjectKeys(ctx, locker, objects, snapshotID)
+	if err != nil {
+		return 0, err
+	}
+	return locker.SetRetention(ctx, keys, mode, until)
+}
+
+// ApplyObjectLegalHold mirrors a legal hold on a snapshot as Object Lock legal
+// holds on its objects. Buckets without Object Lock are skipped and reported
+// with ErrObjectLockUnsupported.
+func ApplyObjectLegalHold(ctx context.Context, locker ObjectLocker, held HeldSnapshot) (int, error) {
+	if err := locker.CheckEnabled(ctx); err != nil {
+		if errors.Is(err, backends.ErrObjectLockNotEnabled) {
+			return 0, ErrObjectLockUnsupported
+		}
+		return 0, err
+	}
+	objects, err := locker.ListObjects(ctx)
+	if err != nil {
+		return 0, err
+	}
+	keys, err := snapshotObjectKeys(ctx, locker, objects, held.SnapshotID)
+	if err != nil {
+		return 0, err
+	}
+	if err := locker.SetLegalHold(ctx, keys, true); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// ReleaseObjectLegalHold removes the Object Lock legal hold mirrored for a
+// snapshot. Objects shared with snapshots that remain on hold keep theirs.
+func ReleaseObjectLegalHold(ctx context.Context, locker ObjectLocker, released HeldSnapshot, remaining []HeldSnapshot) (int, error) {
+	if err := locker.CheckEnabled(ctx); err != nil {
+		if errors.Is(err, backends.ErrObjectLockNotEnabled) {
+			return 0, ErrObjectLockUnsupported
+		}
+		return 0, err
+	}
+	objects, err := locker.ListObjects(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	keep := make(map[string]bool)
+	for _, held := range remaining {
+		keys, err := snapshotObjectKeys(ctx, locker, objects, held.SnapshotID)
+		if err != nil {
+			return 0, err
+		}
+		for _, key := range keys {
+			keep[key] = true
+		}
+	}
+
+	releasedKeys, err := snapshotObjectKeys(ctx, locker, objects, released.SnapshotID)
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	for _, key := range releasedKeys {
+		if !keep[key] {
+			keys = append(keys, key)
+		}
+	}
+	if err := locker.SetLegalHold(ctx, keys, false); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,294 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// fakeObjectLocker selects objects named "<snapshot>/..." for a snapshot and
+// records retention and legal holds per key.
+type fakeObjectLocker struct {
+	enabledErr error
+	objects    []backends.S3Object
+	retention  map[string]time.Time
+	legalHold  map[string]bool
+}
+
+func newFakeObjectLocker(keys ...string) *fakeObjectLocker {
+	f := &fakeObjectLocker{
+		retention: make(map[string]time.Time),
+		legalHold: make(map[string]bool),
+	}
+	for _, key := range keys {
+		f.objects = append(f.objects, backends.S3Object{Key: key})
+	}
+	return f
+}
+
+func (f *fakeObjectLocker) CheckEnabled(_ context.Context) error {
+	return f.enabledErr
+}
+
+func (f *fakeObjectLocker) ListObjects(_ context.Context) ([]backends.S3Object, error) {
+	return f.objects, nil
+}
+
+func (f *fakeObjectLocker) SnapshotFiles(_ context.Context, snapshotID string) (backends.SnapshotFiles, error) {
+	return backends.SnapshotFiles{SnapshotID: snapshotID}, nil
+}
+
+func (f *fakeObjectLocker) SnapshotObjectKeys(objects []backends.S3Object, files backends.SnapshotFiles) ([]string, error) {
+	var keys []string
+	for _, obj := range objects {
+		if strings.HasPrefix(obj.Key, files.SnapshotID+"/") || obj.Key == "shared" {
+			keys = append(keys, obj.Key)
+		}
+	}
+	if len(keys) <= 1 {
+		return nil, errors.New("snapshot not found")
+	}
+	return keys, nil
+}
+
+func (f *fakeObjectLocker) SetRetention(_ context.Context, keys []string, _ models.S3ObjectLockMode, until time.Time) (int, error) {
+	for _, key := range keys {
+		f.retention[key] = until
+	}
+	return len(keys), nil
+}
+
+func (f *fakeObjectLocker) SetLegalHold(_ context.Context, keys []string, on bool) error {
+	for _, key := range keys {
+		f.legalHold[key] = on
+	}
+	return nil
+}
+
+type fakeImmutabilityStore struct {
+	ImmutabilityStore
+	locks map[string]*models.SnapshotImmutability
+}
+
+func (s *fakeImmutabilityStore) CreateSnapshotImmutability(_ context.Context, lock *models.SnapshotImmutability) error {
+	s.locks[lock.SnapshotID] = lock
+	return nil
+}
+
+func (s *fakeImmutabilityStore) GetSnapshotImmutability(_ context.Context, _ uuid.UUID, snapshotID string) (*models.SnapshotImmutability, error) {
+	lock, ok := s.locks[snapshotID]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return lock, nil
+}
+
+func (s *fakeImmutabilityStore) UpdateSnapshotImmutability(_ context.Context, lock *models.SnapshotImmutability) error {
+	s.locks[lock.SnapshotID] = lock
+	return nil
+}
+
+func TestApplyObjectLegalHold(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("holds snapshot objects", func(t *testing.T) {
+		locker := newFakeObjectLocker("shared", "snap1/a", "snap2/a")
+		count, err := ApplyObjectLegalHold(ctx, locker, HeldSnapshot{SnapshotID: "snap1"})
+		if err != nil {
+			t.Fatalf("ApplyObjectLegalHold() error = %v", err)
+		}
+		if count != 2 || !locker.legalHold["shared"] || !locker.legalHold["snap1/a"] || locker.legalHold["snap2/a"] {
+			t.Errorf("count = %d, legal holds = %v", count, locker.legalHold)
+		}
+	})
+
+	t.Run("bucket without object lock", func(t *testing.T) {
+		locker := newFakeObjectLocker("shared", "snap1/a")
+		locker.enabledErr = backends.ErrObjectLockNotEnabled
+		_, err := ApplyObjectLegalHold(ctx, locker, HeldSnapshot{SnapshotID: "snap1"})
+		if !errors.Is(err, ErrObjectLockUnsupported) {
+			t.Errorf("ApplyObjectLegalHold() error = %v, want ErrObjectLockUnsupported", err)
+		}
+	})
+
+	t.Run("snapshot not found", func(t *testing.T) {
+		locker := newFakeObjectLocker("shared")
+		if _, err := ApplyObjectLegalHold(ctx, locker, HeldSnapshot{SnapshotID: "snap1"}); err == nil {
+			t.Error("ApplyObjectLegalHold() expected error for missing snapshot")
+		}
+	})
+}
+
+func TestReleaseObjectLegalHold(t *testing.T) {
+	ctx := context.Background()
+	locker := newFakeObjectLocker("shared", "snap1/a", "snap2/a")
+	for _, key := range []string{"shared", "snap1/a", "snap2/a"} {
+		locker.legalHold[key] = true
+	}
+
+	count, err := ReleaseObjectLegalHold(ctx, locker,
+		HeldSnapshot{SnapshotID: "snap1"},
+		[]HeldSnapshot{{SnapshotID: "snap2"}})
+	if err != nil {
+		t.Fatalf("ReleaseObjectLegalHold() error = %v", err)
+	}
+	if count != 1 {
+		t.Errorf("ReleaseObjectLegalHold() = %d, want 1", count)
+	}
+	if locker.legalHold["snap1/a"] {
+		t.Error("released snapshot objects should no longer be held")
+	}
+	if !locker.legalHold["shared"] || !locker.legalHold["snap2/a"] {
+		t.Error("objects covered by remaining holds must stay held")
+	}
+}
+
+func TestImmutabilityManager_ObjectLock(t *testing.T) {
+	ctx := context.Background()
+	repoID := uuid.New()
+	locker := newFakeObjectLocker("shared", "snap1/a")
+	store := &fakeImmutabilityStore{locks: make(map[string]*models.SnapshotImmutability)}
+	m := NewImmutabilityManager(store, zerolog.Nop())
+
+	_, err := m.LockSnapshotWithObjectLock(ctx, uuid.New(), repoID, "snap1", "snap1", 30, nil, "", models.S3ObjectLockModeCompliance)
+	if !errors.Is(err, ErrObjectLockUnsupported) {
+		t.Fatalf("LockSnapshotWithObjectLock() without resolver error = %v, want ErrObjectLockUnsupported", err)
+	}
+	if len(store.locks) != 0 {
+		t.Fatal("failed object lock must not create a lock record")
+	}
+
+	m.SetObjectLockers(func(_ context.Context, id uuid.UUID) (ObjectLocker, error) {
+		if id != repoID {
+			t.Errorf("resolver called with %s, want %s", id, repoID)
+		}
+		return locker, nil
+	})
+
+	locker.enabledErr = backends.ErrObjectLockNotEnabled
+	_, err = m.LockSnapshotWithObjectLock(ctx, uuid.New(), repoID, "snap1", "snap1", 30, nil, "", models.S3ObjectLockModeCompliance)
+	if !errors.Is(err, backends.ErrObjectLockNotEnabled) {
+		t.Fatalf("LockSnapshotWithObjectLock() on bucket without object lock error = %v, want ErrObjectLockNotEnabled", err)
+	}
+	if len(store.locks) != 0 {
+		t.Fatal("bucket without object lock must not create a lock record")
+	}
+	locker.enabledErr = nil
+
+	lock, err := m.LockSnapshotWithObjectLock(ctx, uuid.New(), repoID, "snap1", "snap1", 30, nil, "", models.S3ObjectLockModeCompliance)
+	if err != nil {
+		t.Fatalf("LockSnapshotWithObjectLock() error = %v", err)
+	}
+	if !lock.S3ObjectLockEnabled || lock.S3ObjectLockMode == nil || *lock.S3ObjectLockMode != models.S3ObjectLockModeCompliance {
+		t.Errorf("lock object lock fields = %v %v", lock.S3ObjectLockEnabled, lock.S3ObjectLockMode)
+	}
+	if lock.S3ObjectLockStatus != models.S3ObjectLockStatusPending {
+		t.Errorf("S3ObjectLockStatus = %q, want pending until retention is applied", lock.S3ObjectLockStatus)
+	}
+	m.jobs.Wait()
+
+	saved := store.locks["snap1"]
+	if saved.S3ObjectLockStatus != models.S3ObjectLockStatusApplied || saved.S3ObjectLockObjects != 2 {
+		t.Errorf("saved status = %q with %d objects, want applied with 2", saved.S3ObjectLockStatus, saved.S3ObjectLockObjects)
+	}
+	if !locker.retention["snap1/a"].Equal(lock.LockedUntil) {
+		t.Errorf("retention = %v, want %v", locker.retention["snap1/a"], lock.LockedUntil)
+	}
+
+	extended, err := m.ExtendLock(ctx, repoID, "snap1", 10, "")
+	if err != nil {
+		t.Fatalf("ExtendLock() error = %v", err)
+	}
+	m.jobs.Wait()
+	if !locker.retention["shared"].Equal(extended.LockedUntil) {
+		t.Errorf("retention after extend = %v, want %v", locker.retention["shared"], extended.LockedUntil)
+	}
+
+	m.retaining.claim(extended.ID)
+	if _, err := m.ExtendLock(ctx, repoID, "snap1", 10, ""); !errors.Is(err, ErrObjectLockPending) {
+		t.Errorf("ExtendLock() while retention is applied error = %v, want ErrObjectLockPending", err)
+	}
+	m.retaining.release(extended.ID)
+}
+
+func TestImmutabilityManager_ObjectLockFailure(t *testing.T) {
+	ctx := context.Background()
+	locker := newFakeObjectLocker("shared")
+	store := &fakeImmutabilityStore{locks: make(map[string]*models.SnapshotImmutability)}
+	m := NewImmutabilityManager(store, zerolog.Nop())
+	m.SetObjectLockers(func(context.Context, uuid.UUID) (ObjectLocker, error) {
+		return locker, nil
+	})
+
+	if _, err := m.LockSnapshotWithObjectLock(ctx, uuid.New(), uuid.New(), "snap1", "snap1", 30, nil, "", models.S3ObjectLockModeGovernance); err != nil {
+		t.Fatalf("LockSnapshotWithObjectLock() error = %v", err)
+	}
+	m.jobs.Wait()
+
+	saved := store.locks["snap1"]
+	if saved.S3ObjectLockStatus != models.S3ObjectLockStatusFailed || saved.S3ObjectLockError == "" {
+		t.Errorf("saved status = %q, error = %q, want failed with an error", saved.S3ObjectLockStatus, saved.S3ObjectLockError)
+	}
+	if len(locker.retention) != 0 {
+		t.Errorf("retention set on %v, want none", locker.retention)
+	}
+}
+
+// snapshotFilesScript fakes the restic cat and list commands with files in $DIR.
+const snapshotFilesScript = `#!/bin/sh
+case "$1 $2" in
+"cat snapshot") cat "$DIR/snapshot.json" ;;
+"cat blob") cat "$DIR/tree-$3.json" ;;
+"list index") cat "$DIR/indexes" ;;
+"cat index") cat "$DIR/index-$3.json" ;;
+*) exit 1 ;;
+esac
+`
+
+func TestRestic_SnapshotFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"restic":        snapshotFilesScript,
+		"snapshot.json": `{"tree":"root"}`,
+		"tree-root.json": `{"nodes":[{"type":"file","content":["d1","d2"]},
+			{"type":"dir","subtree":"sub"}]}`,
+		"tree-sub.json": `{"nodes":[{"type":"file","content":["d1","d3"]}]}`,
+		"indexes":       "i1\ni2\ni3\n",
+		"index-i1.json": `{"packs":[{"id":"p1","blobs":[{"id":"root"},{"id":"d1"}]},
+			{"id":"p2","blobs":[{"id":"other"}]}]}`,
+		"index-i2.json": `{"packs":[{"id":"p3","blobs":[{"id":"d2"},{"id":"d3"},{"id":"sub"}]}]}`,
+		"index-i3.json": `{"packs":[{"id":"p4","blobs":[{"id":"other2"}]}]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("DIR", dir)
+	r := NewResticWithBinary(filepath.Join(dir, "restic"), zerolog.Nop())
+
+	got, err := r.SnapshotFiles(context.Background(), ResticConfig{Repository: "s3:bucket/repo"}, "snap1")
+	if err != nil {
+		t.Fatalf("SnapshotFiles() error = %v", err)
+	}
+	if strings.Join(got.Packs, ",") != "p1,p3" || strings.Join(got.Indexes, ",") != "i1,i2" {
+		t.Errorf("SnapshotFiles() packs = %v, indexes = %v, want [p1 p3] and [i1 i2]", got.Packs, got.Indexes)
+	}
+
+	// A blob missing from every index means the snapshot cannot be fully locked.
+	if err := os.WriteFile(filepath.Join(dir, "indexes"), []byte("i1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.SnapshotFiles(context.Background(), ResticConfig{Repository: "s3:bucket/repo"}, "snap1"); err == nil {
+		t.Error("SnapshotFiles() expected an error for blobs missing from the index")
+	}
+}
@@ -0,0 +1,340 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/backup/vms"
+	"github.com/rs/zerolog"
+)
+
+// Restic tags recorded on snapshots pulled from Proxmox Backup Server.
+const (
+	PBSTag          = "pbs"
+	pbsDatastoreTag = "pbs-datastore:"
+	pbsSnapshotTag  = "pbs-snapshot:"
+	// pbsIndexTag records the manifest checksum of the pulled archive.
+	pbsIndexTag = "pbs-index:"
+)
+
+// PBSPullOptions selects the Proxmox Backup Server snapshots pulled into
+// restic.
+type PBSPullOptions struct {
+	Datastore string
+	Namespace string
+	// BackupType limits the pull to vm, ct or host groups.
+	BackupType string
+	// BackupIDs limits the pull to these groups (empty means all).
+	BackupIDs []string
+	// LatestOnly pulls only the newest snapshot of each group.
+	LatestOnly bool
+	// VerifiedOnly skips snapshots that have not passed verification.
+	VerifiedOnly bool
+	// Tags are added to every restic snapshot created.
+	Tags []string
+	// Backup is passed to restic for every archive.
+	Backup *BackupOptions
+}
+
+// PBSPulledArchive describes one PBS archive stored as a restic snapshot.
+type PBSPulledArchive struct {
+	Snapshot   string `json:"snapshot"`
+	Archive    string `json:"archive"`
+	Filename   string `json:"filename"`
+	SnapshotID string `json:"snapshot_id"`
+	SizeBytes  int64  `json:"size_bytes"`
+	SHA256     string `json:"sha256,omitempty"`
+	// Unchanged is set when the archive's index matched one pulled before.
+	// Nothing was downloaded; the PBS snapshot was added to the tags of the
+	// existing restic snapshot, and SizeBytes is zero.
+	Unchanged bool `json:"unchanged,omitempty"`
+}
+
+// PBSPullResult summarizes a pull.
+type PBSPullResult struct {
+	Archives []PBSPulledArchive `json:"archives"`
+	// Skipped counts archives already stored by an earlier pull.
+	Skipped int `json:"skipped"`
+	// Unchanged counts archives whose index matched an archive pulled
+	// before, so they were tagged instead of downloaded.
+	Unchanged  int           `json:"unchanged"`
+	BytesTotal int64         `json:"bytes_total"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// PBSPuller copies Proxmox Backup Server snapshots into restic. Each
+// archive is streamed decoded from PBS into restic backup --stdin, so
+// nothing is staged on disk, and is tagged with its PBS snapshot so later
+// pulls only transfer snapshots taken since.
+//
+// An archive is downloaded whole: PBS only serves decoded archives, not the
+// chunks that changed. Archives whose index checksum in the snapshot
+// manifest matches an archive pulled before, such as the disks of a VM that
+// was shut down, are not downloaded again; the existing restic snapshot is
+// tagged with the new PBS snapshot instead.
+type PBSPuller struct {
+	restic *Restic
+	logger zerolog.Logger
+}
+
+// NewPBSPuller creates a new PBSPuller.
+func NewPBSPuller(restic *Restic, logger zerolog.Logger) *PBSPuller {
+	return &PBSPuller{
+		restic: restic,
+		logger: logger.With().Str("component", "pbs_puller").Logger(),
+	}
+}
+
+// PBSSnapshotRef identifies a PBS snapshot across datastores and
+// namespaces, such as backups/prod/vm/100/2024-05-01T02:00:00Z.
+func PBSSnapshotRef(datastore, namespace string, snap vms.PBSSnapshot) string {
+	return path.Join(datastore, namespace, snap.Path())
+}
+
+// PBSArchiveFilename returns the file name an archive is stored under in
+// restic, such as vm-100-drive-scsi0.img.
+func PBSArchiveFilename(snap vms.PBSSnapshot, file vms.PBSFile) string {
+	return snap.BackupType + "-" + snap.BackupID + "-" + file.DecodedName()
+}
+
+// Pull copies the selected snapshots into restic, oldest first. Archives
+// that fail are reported in the returned error after the remaining ones
+// have been pulled; the result lists everything that was stored.
+func (p *PBSPuller) Pull(ctx context.Context, client *vms.PBSClient, cfg ResticConfig, opts PBSPullOptions) (*PBSPullResult, error) {
+	start := time.Now()
+	if opts.Datastore == "" {
+		return nil, errors.New("no PBS datastore specified")
+	}
+
+	snapshots, err := p.selectSnapshots(ctx, client, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pulled, err := p.pulledArchives(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PBSPullResult{}
+	var errs []error
+	for _, snap := range snapshots {
+		ref := PBSSnapshotRef(opts.Datastore, opts.Namespace, snap)
+		tags := append(append([]string{}, opts.Tags...),
+			PBSTag,
+			pbsDatastoreTag+opts.Datastore,
+			pbsSnapshotTag+ref,
+		)
+
+		var manifest *vms.PBSManifest
+		for _, file := range snap.ArchiveFiles() {
+			filename := PBSArchiveFilename(snap, file)
+			if pulled.refs[ref+"|/"+filename] {
+				result.Skipped++
+				continue
+			}
+			if file.Encrypted() {
+				errs = append(errs, fmt.Errorf("%s %s: archive is encrypted on the client and cannot be decoded by the server", ref, file.Filename))
+				continue
+			}
+
+			if manifest == nil {
+				if manifest, err = client.Manifest(ctx, opts.Datastore, opts.Namespace, snap); err != nil {
+					// Without checksums every archive is downloaded.
+					p.logger.Warn().Err(err).Str("snapshot", ref).Msg("failed to read PBS manifest")
+					manifest = &vms.PBSManifest{}
+				}
+			}
+			var csum string
+			if entry := manifest.File(file.Filename); entry != nil {
+				csum = entry.CSum
+			}
+
+			var archive *PBSPulledArchive
+			if id := pulled.indexes[indexKey(filename, csum)]; csum != "" && id != "" {
+				archive, err = p.tagUnchanged(ctx, cfg, id, filename, file, pbsSnapshotTag+ref)
+			} else {
+				archiveTags := tags
+				if csum != "" {
+					archiveTags = append(append([]string{}, tags...), pbsIndexTag+csum)
+				}
+				archive, err = p.pullArchive(ctx, client, cfg, opts, snap, file, filename, archiveTags)
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return result, ctx.Err()
+				}
+				errs = append(errs, fmt.Errorf("%s %s: %w", ref, file.Filename, err))
+				continue
+			}
+			if csum != "" {
+				pulled.indexes[indexKey(filename, csum)] = archive.SnapshotID
+			}
+			archive.Snapshot = ref
+			result.Archives = append(result.Archives, *archive)
+			result.BytesTotal += archive.SizeBytes
+			if archive.Unchanged {
+				result.Unchanged++
+			}
+		}
+	}
+
+	result.Duration = time.Since(start)
+	p.logger.Info().
+		Str("datastore", opts.Datastore).
+		Str("namespace", opts.Namespace).
+		Int("archives", len(result.Archives)).
+		Int("skipped", result.Skipped).
+		Int("unchanged", result.Unchanged).
+		Int("failed", len(errs)).
+		Int64("bytes", result.BytesTotal).
+		Dur("duration", result.Duration).
+		Msg("PBS pull completed")
+
+	return result, errors.Join(errs...)
+}
+
+// selectSnapshots lists the snapshots matching opts, oldest first.
+func (p *PBSPuller) selectSnapshots(ctx context.Context, client *vms.PBSClient, opts PBSPullOptions) ([]vms.PBSSnapshot, error) {
+	ids := opts.BackupIDs
+	if len(ids) == 0 {
+		ids = []string{""}
+	}
+
+	var snapshots []vms.PBSSnapshot
+	for _, id := range ids {
+		list, err := client.ListSnapshots(ctx, opts.Datastore, vms.PBSSnapshotFilter{
+			Namespace:  opts.Namespace,
+			BackupType: opts.BackupType,
+			BackupID:   id,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list PBS snapshots: %w", err)
+		}
+		snapshots = append(snapshots, list...)
+	}
+
+	latest := make(map[string]int64)
+	var selected []vms.PBSSnapshot
+	for _, snap := range snapshots {
+		if opts.VerifiedOnly && !snap.Verified() {
+			continue
+		}
+		selected = append(selected, snap)
+		group := snap.BackupType + "/" + snap.BackupID
+		if snap.BackupTime > latest[group] {
+			latest[group] = snap.BackupTime
+		}
+	}
+
+	if !opts.LatestOnly {
+		return selected, nil
+	}
+	var newest []vms.PBSSnapshot
+	for _, snap := range selected {
+		if snap.BackupTime == latest[snap.BackupType+"/"+snap.BackupID] {
+			newest = append(newest, snap)
+		}
+	}
+	return newest, nil
+}
+
+// pbsPulled describes the archives already in the repository.
+type pbsPulled struct {
+	// refs holds PBS snapshot reference and restic path pairs.
+	refs map[string]bool
+	// indexes maps restic path and index checksum pairs to the newest
+	// restic snapshot holding that archive.
+	indexes map[string]string
+}
+
+// indexKey returns the key of an archive in pbsPulled.indexes.
+func indexKey(filename, csum string) string {
+	return "/" + filename + "|" + csum
+}
+
+// pulledArchives returns the archives already in the repository.
+func (p *PBSPuller) pulledArchives(ctx context.Context, cfg ResticConfig) (*pbsPulled, error) {
+	snapshots, err := p.restic.Snapshots(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("list restic snapshots: %w", err)
+	}
+
+	pulled := &pbsPulled{refs: make(map[string]bool), indexes: make(map[string]string)}
+	for _, snap := range snapshots {
+		for _, tag := range snap.Tags {
+			if csum, ok := strings.CutPrefix(tag, pbsIndexTag); ok && len(snap.Paths) == 1 {
+				// Snapshots are listed oldest first.
+				pulled.indexes[snap.Paths[0]+"|"+csum] = snap.ID
+			}
+			ref, ok := strings.CutPrefix(tag, pbsSnapshotTag)
+			if !ok {
+				continue
+			}
+			for _, snapPath := range snap.Paths {
+				pulled.refs[ref+"|"+snapPath] = true
+			}
+		}
+	}
+	return pulled, nil
+}
+
+// tagUnchanged adds a PBS snapshot tag to the restic snapshot that already
+// holds an identical archive. Tagging rewrites the snapshot under a new ID.
+func (p *PBSPuller) tagUnchanged(ctx context.Context, cfg ResticConfig, snapshotID, filename string, file vms.PBSFile, tag string) (*PBSPulledArchive, error) {
+	p.logger.Info().
+		Str("archive", file.Filename).
+		Str("restic_snapshot", snapshotID).
+		Msg("PBS archive unchanged, tagging existing snapshot")
+
+	changes, err := p.restic.Tag(ctx, cfg, []string{snapshotID}, TagOptions{Add: []string{tag}})
+	if err != nil {
+		return nil, err
+	}
+	newID := snapshotID
+	for _, c := range changes {
+		if strings.HasPrefix(snapshotID, c.OldID) || strings.HasPrefix(c.OldID, snapshotID) {
+			newID = c.NewID
+		}
+	}
+	return &PBSPulledArchive{
+		Archive:    file.Filename,
+		Filename:   filename,
+		SnapshotID: newID,
+		Unchanged:  true,
+	}, nil
+}
+
+// pullArchive streams one decoded archive into restic. A download that
+// breaks off stops restic before its input ends, so no snapshot of a
+// truncated archive is created.
+func (p *PBSPuller) pullArchive(ctx context.Context, client *vms.PBSClient, cfg ResticConfig, opts PBSPullOptions, snap vms.PBSSnapshot, file vms.PBSFile, filename string, tags []string) (*PBSPulledArchive, error) {
+	p.logger.Info().
+		Str("snapshot", snap.Path()).
+		Str("archive", file.Filename).
+		Int64("size", file.Size).
+		Msg("pulling PBS archive")
+
+	body, err := client.DownloadFile(ctx, opts.Datastore, opts.Namespace, snap, file.Filename)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	stats, err := p.restic.BackupStdin(ctx, cfg, filename, body, tags, opts.Backup)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PBSPulledArchive{
+		Archive:    file.Filename,
+		Filename:   filename,
+		SnapshotID: stats.SnapshotID,
+		SizeBytes:  stats.StdinBytes,
+		SHA256:     stats.StdinSHA256,
+	}, nil
+}
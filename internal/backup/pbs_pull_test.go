@@ -0,0 +1,259 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/backup/vms"
+	"github.com/rs/zerolog"
+)
+
+// pbsPullScript fakes restic snapshots from $DIR/snapshots.json,
+// restic backup --stdin by storing the input as $DIR/<stdin filename> and
+// its arguments in $DIR/<stdin filename>.args, and restic tag by recording
+// its arguments in $DIR/tag.args.
+const pbsPullScript = `#!/bin/sh
+case "$1" in
+snapshots) cat "$DIR/snapshots.json" ;;
+backup)
+	args="$*"
+	while [ $# -gt 0 ]; do
+		[ "$1" = --stdin-filename ] && name=$2
+		shift
+	done
+	cat > "$DIR/$name.part" || exit 1
+	mv "$DIR/$name.part" "$DIR/$name"
+	echo "$args" > "$DIR/$name.args"
+	echo '{"message_type":"summary","snapshot_id":"snap-'"$name"'","files_new":1}' ;;
+tag)
+	echo "$*" >> "$DIR/tag.args"
+	for id; do :; done
+	echo "old snapshot ID: $id -> new snapshot ID: $id-tagged" ;;
+esac
+`
+
+// pbsPullServer serves two snapshots of VM 100 and one of CT 200, whose
+// file archive is encrypted. Downloads return the requested path.
+func pbsPullServer(t *testing.T, download http.HandlerFunc) *vms.PBSClient {
+	t.Helper()
+	snapshots := []map[string]interface{}{
+		{
+			"backup-type": "vm", "backup-id": "100", "backup-time": 1714442400,
+			"files": []map[string]interface{}{
+				{"filename": "index.json.blob"},
+				{"filename": "qemu-server.conf.blob", "crypt-mode": "none"},
+				{"filename": "drive-scsi0.img.fidx", "crypt-mode": "none"},
+			},
+		},
+		{
+			"backup-type": "vm", "backup-id": "100", "backup-time": 1714528800,
+			"files": []map[string]interface{}{
+				{"filename": "qemu-server.conf.blob", "crypt-mode": "none"},
+				{"filename": "drive-scsi0.img.fidx", "crypt-mode": "none"},
+			},
+			"verification": map[string]string{"state": "ok"},
+		},
+		{
+			"backup-type": "ct", "backup-id": "200", "backup-time": 1714528800,
+			"files": []map[string]interface{}{
+				{"filename": "pct.conf.blob", "crypt-mode": "none"},
+				{"filename": "root.pxar.didx", "crypt-mode": "encrypt"},
+			},
+		},
+	}
+	if download == nil {
+		download = func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			io.WriteString(w, q.Get("backup-type")+"/"+q.Get("backup-id")+"/"+q.Get("backup-time")+"/"+q.Get("file-name"))
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api2/json/admin/datastore/backups/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var out []map[string]interface{}
+		for _, s := range snapshots {
+			if (q.Get("backup-type") == "" || s["backup-type"] == q.Get("backup-type")) &&
+				(q.Get("backup-id") == "" || s["backup-id"] == q.Get("backup-id")) {
+				out = append(out, s)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": out})
+	})
+	mux.HandleFunc("/api2/json/admin/datastore/backups/download-decoded", download)
+	ts := httptest.NewTLSServer(mux)
+	t.Cleanup(ts.Close)
+
+	u, _ := url.Parse(ts.URL)
+	host, portStr, _ := net.SplitHostPort(u.Host)
+	port, _ := strconv.Atoi(portStr)
+	return vms.NewPBSClient(&vms.PBSConfig{Host: host, Port: port, Username: "backup@pbs", TokenID: "t", TokenSecret: "s"}, zerolog.Nop())
+}
+
+// pbsPullHost installs the fake restic and returns the directory it
+// records into, seeded with the given existing restic snapshots.
+func pbsPullHost(t *testing.T, existing string) (string, *PBSPuller) {
+	t.Helper()
+	dir := t.TempDir()
+	script := filepath.Join(dir, "restic")
+	if err := os.WriteFile(script, []byte(pbsPullScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "snapshots.json"), []byte(existing), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DIR", dir)
+	return dir, NewPBSPuller(NewResticWithBinary(script, zerolog.Nop()), zerolog.Nop())
+}
+
+func TestPBSPuller_Pull(t *testing.T) {
+	// The disk image of the older VM snapshot was pulled by an earlier run.
+	existing := `[{"id":"old","paths":["/vm-100-drive-scsi0.img"],"tags":["pbs","pbs-snapshot:backups/vm/100/2024-04-30T02:00:00Z"]}]`
+	dir, puller := pbsPullHost(t, existing)
+	client := pbsPullServer(t, nil)
+
+	result, err := puller.Pull(context.Background(), client, testResticConfig(), PBSPullOptions{
+		Datastore: "backups",
+		Tags:      []string{"schedule:s1"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "ct/200/2024-05-01T02:00:00Z root.pxar.didx: archive is encrypted") {
+		t.Fatalf("Pull() error = %v, want encrypted archive error", err)
+	}
+
+	var got []string
+	for _, a := range result.Archives {
+		got = append(got, a.Snapshot+" "+a.Filename)
+	}
+	want := []string{
+		"backups/vm/100/2024-04-30T02:00:00Z vm-100-qemu-server.conf",
+		"backups/vm/100/2024-05-01T02:00:00Z vm-100-qemu-server.conf",
+		"backups/vm/100/2024-05-01T02:00:00Z vm-100-drive-scsi0.img",
+		"backups/ct/200/2024-05-01T02:00:00Z ct-200-pct.conf",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("archives =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if result.Skipped != 1 {
+		t.Errorf("Skipped = %d, want 1", result.Skipped)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "vm-100-drive-scsi0.img"))
+	if string(data) != "vm/100/1714528800/drive-scsi0.img.fidx" {
+		t.Errorf("restic input = %q", data)
+	}
+	if a := result.Archives[2]; a.SnapshotID != "snap-vm-100-drive-scsi0.img" || a.SizeBytes != int64(len(data)) || a.SHA256 == "" {
+		t.Errorf("archive = %+v", a)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "vm-100-drive-scsi0.img.args"))
+	if !strings.Contains(string(args), "--tag schedule:s1 --tag pbs --tag pbs-datastore:backups --tag pbs-snapshot:backups/vm/100/2024-05-01T02:00:00Z") {
+		t.Errorf("restic args = %q", args)
+	}
+}
+
+func TestPBSPuller_Pull_LatestVerified(t *testing.T) {
+	_, puller := pbsPullHost(t, "[]")
+	client := pbsPullServer(t, nil)
+
+	result, err := puller.Pull(context.Background(), client, testResticConfig(), PBSPullOptions{
+		Datastore:    "backups",
+		BackupType:   "vm",
+		BackupIDs:    []string{"100"},
+		LatestOnly:   true,
+		VerifiedOnly: true,
+	})
+	if err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	if len(result.Archives) != 2 || result.Archives[0].Snapshot != "backups/vm/100/2024-05-01T02:00:00Z" {
+		t.Errorf("archives = %+v, want the newest VM snapshot only", result.Archives)
+	}
+}
+
+func TestPBSPuller_Pull_BrokenDownload(t *testing.T) {
+	dir, puller := pbsPullHost(t, "[]")
+	client := pbsPullServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Query().Get("file-name"), ".fidx") {
+			// The connection drops before the declared length is sent.
+			w.Header().Set("Content-Length", "1048576")
+			io.WriteString(w, "partial")
+			return
+		}
+		io.WriteString(w, "config")
+	})
+
+	result, err := puller.Pull(context.Background(), client, testResticConfig(), PBSPullOptions{
+		Datastore: "backups", BackupType: "vm", LatestOnly: true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "drive-scsi0.img.fidx") {
+		t.Fatalf("Pull() error = %v, want download error", err)
+	}
+	if len(result.Archives) != 1 || result.Archives[0].Filename != "vm-100-qemu-server.conf" {
+		t.Errorf("archives = %+v", result.Archives)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "vm-100-drive-scsi0.img")); !os.IsNotExist(err) {
+		t.Error("restic stored a truncated disk image")
+	}
+}
+
+func TestPBSPuller_Pull_UnchangedIndex(t *testing.T) {
+	// The disk image of the older VM snapshot was pulled with its checksum.
+	existing := `[{"id":"old","paths":["/vm-100-drive-scsi0.img"],"tags":["pbs","pbs-snapshot:backups/vm/100/2024-04-30T02:00:00Z","pbs-index:aaaa"]}]`
+	dir, puller := pbsPullHost(t, existing)
+	var downloads []string
+	client := pbsPullServer(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("file-name") == "index.json.blob" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"backup-type": q.Get("backup-type"), "backup-id": q.Get("backup-id"),
+				"files": []map[string]string{
+					{"filename": "qemu-server.conf.blob", "csum": "cccc"},
+					{"filename": "drive-scsi0.img.fidx", "csum": "aaaa"},
+				},
+			})
+			return
+		}
+		downloads = append(downloads, q.Get("backup-time")+"/"+q.Get("file-name"))
+		io.WriteString(w, "data")
+	})
+
+	result, err := puller.Pull(context.Background(), client, testResticConfig(), PBSPullOptions{
+		Datastore: "backups", BackupType: "vm",
+	})
+	if err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+
+	// The second configuration matches the first one pulled in this run.
+	want := []string{"1714442400/qemu-server.conf.blob"}
+	if strings.Join(downloads, ",") != strings.Join(want, ",") {
+		t.Errorf("downloads = %v, want %v", downloads, want)
+	}
+	if result.Unchanged != 2 || result.Skipped != 1 || len(result.Archives) != 3 {
+		t.Fatalf("result = %+v", result)
+	}
+	if a := result.Archives[2]; !a.Unchanged || a.SnapshotID != "old-tagged" || a.SizeBytes != 0 {
+		t.Errorf("disk archive = %+v", a)
+	}
+	if result.BytesTotal != int64(len("data")) {
+		t.Errorf("BytesTotal = %d", result.BytesTotal)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(dir, "vm-100-qemu-server.conf.args"))
+	if !strings.Contains(string(args), "--tag pbs-index:cccc") {
+		t.Errorf("restic backup args = %q", args)
+	}
+	tagArgs, _ := os.ReadFile(filepath.Join(dir, "tag.args"))
+	if !strings.Contains(string(tagArgs), "--add pbs-snapshot:backups/vm/100/2024-05-01T02:00:00Z old") {
+		t.Errorf("restic tag args = %q", tagArgs)
+	}
+}
@@ -0,0 +1,351 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/backup/vms"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// ErrProxmoxRestoreRunning is returned when a Proxmox restore is already running.
+var ErrProxmoxRestoreRunning = errors.New("proxmox restore is already running")
+
+// ProxmoxRestoreStore defines the persistence operations used by the
+// Proxmox restorer.
+type ProxmoxRestoreStore interface {
+	GetRepository(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	GetProxmoxConnectionByID(ctx context.Context, id uuid.UUID) (*models.ProxmoxConnection, error)
+	UpdateProxmoxRestore(ctx context.Context, restore *models.ProxmoxRestore) error
+}
+
+// ProxmoxRestorer restores vzdump archives from restic snapshots into a
+// Proxmox VE cluster. The archive is streamed from restic straight into an
+// upload to the target node, restored with qmrestore or pct restore, and
+// the guest is optionally booted and health-checked.
+type ProxmoxRestorer struct {
+	store   ProxmoxRestoreStore
+	restic  *Restic
+	decrypt DecryptFunc
+	repos   *RepositoryConfigResolver
+	logger  zerolog.Logger
+
+	// pollInterval is how often Proxmox tasks and the guest are checked.
+	pollInterval time.Duration
+	// taskTimeout bounds each upload, restore and start task.
+	taskTimeout time.Duration
+
+	runs runGuard
+}
+
+// NewProxmoxRestorer creates a new ProxmoxRestorer.
+func NewProxmoxRestorer(
+	store ProxmoxRestoreStore,
+	restic *Restic,
+	decrypt DecryptFunc,
+	password func(repoID uuid.UUID) (string, error),
+	logger zerolog.Logger,
+) *ProxmoxRestorer {
+	return &ProxmoxRestorer{
+		store:        store,
+		restic:       restic,
+		decrypt:      decrypt,
+		repos:        NewRepositoryConfigResolver(store, decrypt, password),
+		logger:       logger.With().Str("component", "proxmox_restorer").Logger(),
+		pollInterval: 5 * time.Second,
+		taskTimeout:  4 * time.Hour,
+	}
+}
+
+// StartRestore runs a restore in the background.
+func (p *ProxmoxRestorer) StartRestore(ctx context.Context, restore *models.ProxmoxRestore) error {
+	if !p.runs.claim(restore.ID) {
+		return ErrProxmoxRestoreRunning
+	}
+	go func() {
+		defer p.runs.release(restore.ID)
+		if err := p.run(ctx, restore); err != nil {
+			p.logger.Error().Err(err).Str("restore_id", restore.ID.String()).Msg("proxmox restore failed")
+		}
+	}()
+	return nil
+}
+
+// Run runs a restore to completion in the calling goroutine.
+func (p *ProxmoxRestorer) Run(ctx context.Context, restore *models.ProxmoxRestore) error {
+	if !p.runs.claim(restore.ID) {
+		return ErrProxmoxRestoreRunning
+	}
+	defer p.runs.release(restore.ID)
+	return p.run(ctx, restore)
+}
+
+func (p *ProxmoxRestorer) run(ctx context.Context, restore *models.ProxmoxRestore) error {
+	restore.Start()
+	if err := p.store.UpdateProxmoxRestore(ctx, restore); err != nil {
+		return fmt.Errorf("update proxmox restore: %w", err)
+	}
+
+	result, err := p.restore(ctx, restore)
+	if err != nil {
+		// Keep what was done so far, e.g. the VMID of a guest that was
+		// restored but failed its health check.
+		restore.Result = result
+		restore.Fail(err.Error())
+	} else {
+		restore.Complete(result)
+	}
+	if updateErr := p.store.UpdateProxmoxRestore(context.WithoutCancel(ctx), restore); updateErr != nil {
+		p.logger.Error().Err(updateErr).Str("restore_id", restore.ID.String()).Msg("failed to save proxmox restore")
+	}
+	return err
+}
+
+func (p *ProxmoxRestorer) restore(ctx context.Context, restore *models.ProxmoxRestore) (*models.ProxmoxRestoreResult, error) {
+	_, resticCfg, err := p.repos.Resolve(ctx, restore.RepositoryID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := p.client(ctx, restore)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := p.findArchive(ctx, resticCfg, restore)
+	if err != nil {
+		return nil, err
+	}
+	filename := path.Base(archive.Path)
+	guestType, sourceVMID, _ := vms.ParseVzdumpFilename(filename)
+
+	result := &models.ProxmoxRestoreResult{
+		Archive:     archive.Path,
+		ArchiveSize: archive.Size,
+		GuestType:   guestType,
+		SourceVMID:  sourceVMID,
+		VMID:        restore.NewVMID,
+		Node:        client.Node(),
+	}
+	if result.VMID == 0 {
+		if result.VMID, err = client.NextVMID(ctx); err != nil {
+			return result, fmt.Errorf("get next vmid: %w", err)
+		}
+	}
+
+	// Upload the archive to the node.
+	p.setPhase(ctx, restore, models.ProxmoxRestorePhaseUpload, "")
+	stream, err := p.restic.Dump(ctx, resticCfg, restore.SnapshotID, archive.Path, "")
+	if err != nil {
+		return result, fmt.Errorf("extract %s: %w", filename, err)
+	}
+	upid, err := client.UploadBackup(ctx, restore.UploadStorage, filename, archive.Size, stream)
+	stream.Close()
+	if err != nil {
+		return result, fmt.Errorf("upload %s to %s: %w", filename, restore.UploadStorage, err)
+	}
+	volid := vms.BackupVolid(restore.UploadStorage, filename)
+	defer func() {
+		if err := client.DeleteBackup(context.WithoutCancel(ctx), volid); err != nil {
+			p.logger.Warn().Err(err).Str("volid", volid).Msg("failed to remove uploaded vzdump archive")
+		}
+	}()
+	p.setPhase(ctx, restore, models.ProxmoxRestorePhaseUpload, upid)
+	if err := p.waitForTask(ctx, client, upid, result); err != nil {
+		return result, fmt.Errorf("upload %s: %w", filename, err)
+	}
+
+	// Restore the guest.
+	upid, err = client.RestoreGuest(ctx, vms.GuestRestoreOptions{
+		VMID:    result.VMID,
+		Type:    guestType,
+		Archive: volid,
+		Storage: restore.TargetStorage,
+		Force:   restore.Overwrite,
+		Unique:  restore.Unique,
+	})
+	if err != nil {
+		return result, fmt.Errorf("restore %s %d: %w", guestType, result.VMID, err)
+	}
+	result.RestoreUPID = upid
+	p.setPhase(ctx, restore, models.ProxmoxRestorePhaseRestore, upid)
+	if err := p.waitForTask(ctx, client, upid, result); err != nil {
+		return result, fmt.Errorf("restore %s %d: %w", guestType, result.VMID, err)
+	}
+
+	if restore.StartGuest {
+		upid, err := client.StartGuest(ctx, guestType, result.VMID)
+		if err != nil {
+			return result, fmt.Errorf("start %s %d: %w", guestType, result.VMID, err)
+		}
+		p.setPhase(ctx, restore, models.ProxmoxRestorePhaseStart, upid)
+		if err := p.waitForTask(ctx, client, upid, result); err != nil {
+			return result, fmt.Errorf("start %s %d: %w", guestType, result.VMID, err)
+		}
+		result.Started = true
+	}
+
+	if restore.HealthCheck {
+		p.setPhase(ctx, restore, models.ProxmoxRestorePhaseHealthCheck, "")
+		if err := p.healthCheck(ctx, client, restore.HealthTimeout(), result); err != nil {
+			return result, err
+		}
+	}
+
+	p.logger.Info().
+		Str("restore_id", restore.ID.String()).
+		Str("archive", result.Archive).
+		Str("node", result.Node).
+		Int("vmid", result.VMID).
+		Bool("started", result.Started).
+		Bool("healthy", result.Healthy).
+		Msg("proxmox restore completed")
+	return result, nil
+}
+
+// client returns a Proxmox client for the restore's target node.
+func (p *ProxmoxRestorer) client(ctx context.Context, restore *models.ProxmoxRestore) (*vms.ProxmoxClient, error) {
+	if p.decrypt == nil {
+		return nil, fmt.Errorf("proxmox credentials are not available")
+	}
+	conn, err := p.store.GetProxmoxConnectionByID(ctx, restore.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("get proxmox connection: %w", err)
+	}
+	if !conn.HasTokenAuth() {
+		return nil, fmt.Errorf("proxmox connection %s has no API token", conn.Name)
+	}
+	secret, err := p.decrypt(conn.TokenSecretEncrypted)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt token secret: %w", err)
+	}
+
+	client := vms.NewProxmoxClientFromConnection(conn, string(secret), p.logger)
+	client.SetPollInterval(p.pollInterval)
+	if restore.TargetNode != "" && restore.TargetNode != conn.Node {
+		client = client.ForNode(restore.TargetNode)
+	}
+	return client, nil
+}
+
+// findArchive returns the vzdump archive in the snapshot to restore.
+func (p *ProxmoxRestorer) findArchive(ctx context.Context, cfg ResticConfig, restore *models.ProxmoxRestore) (*SnapshotFile, error) {
+	files, err := p.restic.ListFiles(ctx, cfg, restore.SnapshotID, "")
+	if err != nil {
+		if errors.Is(err, ErrSnapshotNotFound) {
+			return nil, fmt.Errorf("snapshot %s not found", restore.SnapshotID)
+		}
+		return nil, fmt.Errorf("list snapshot files: %w", err)
+	}
+
+	var candidates []*SnapshotFile
+	for i := range files {
+		f := &files[i]
+		if f.Type != "file" {
+			continue
+		}
+		if restore.Archive != "" {
+			if f.Path != restore.Archive {
+				continue
+			}
+			if _, _, ok := vms.ParseVzdumpFilename(path.Base(f.Path)); !ok {
+				return nil, fmt.Errorf("%s is not a vzdump archive", f.Path)
+			}
+			return f, nil
+		}
+		_, vmid, ok := vms.ParseVzdumpFilename(path.Base(f.Path))
+		if !ok || (restore.SourceVMID != 0 && vmid != restore.SourceVMID) {
+			continue
+		}
+		candidates = append(candidates, f)
+	}
+
+	switch {
+	case restore.Archive != "":
+		return nil, fmt.Errorf("archive %s not found in snapshot %s", restore.Archive, restore.SnapshotID)
+	case len(candidates) == 0 && restore.SourceVMID != 0:
+		return nil, fmt.Errorf("snapshot %s has no vzdump archive of VM %d", restore.SnapshotID, restore.SourceVMID)
+	case len(candidates) == 0:
+		return nil, fmt.Errorf("snapshot %s has no vzdump archive", restore.SnapshotID)
+	case len(candidates) > 1:
+		names := make([]string, len(candidates))
+		for i, f := range candidates {
+			names[i] = f.Path
+		}
+		return nil, fmt.Errorf("snapshot %s has %d vzdump archives, choose one: %s", restore.SnapshotID, len(candidates), strings.Join(names, ", "))
+	}
+	return candidates[0], nil
+}
+
+// waitForTask waits for a Proxmox task and fails unless it exited OK.
+// Tasks that finished with warnings are recorded on the result.
+func (p *ProxmoxRestorer) waitForTask(ctx context.Context, client *vms.ProxmoxClient, upid string, result *models.ProxmoxRestoreResult) error {
+	job, err := client.WaitForTask(ctx, upid, p.taskTimeout)
+	if err != nil {
+		return err
+	}
+	switch {
+	case job.ExitCode == "OK":
+		return nil
+	case strings.HasPrefix(job.ExitCode, "WARNINGS"):
+		result.Warnings = append(result.Warnings, fmt.Sprintf("task %s finished with %s", upid, strings.ToLower(job.ExitCode)))
+		return nil
+	}
+	return fmt.Errorf("task failed: %s", job.ExitCode)
+}
+
+// healthCheck waits until the restored guest runs and, for VMs with the
+// QEMU guest agent enabled, until the agent responds.
+func (p *ProxmoxRestorer) healthCheck(ctx context.Context, client *vms.ProxmoxClient, timeout time.Duration, result *models.ProxmoxRestoreResult) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+
+	waitingFor := "the guest to run"
+	for {
+		status, err := client.GetGuestStatus(ctx, result.GuestType, result.VMID)
+		if err == nil {
+			result.GuestStatus = status.Status
+			if status.Status == "running" {
+				if result.GuestType != "qemu" || status.Agent != 1 {
+					if result.GuestType == "qemu" {
+						result.Warnings = append(result.Warnings, "guest agent is not enabled, only the running state was checked")
+					}
+					result.Healthy = true
+					return nil
+				}
+				waitingFor = "the guest agent to respond"
+				if client.PingGuestAgent(ctx, result.VMID) == nil {
+					result.AgentResponding = true
+					result.Healthy = true
+					return nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("health check: timed out after %s waiting for %s", timeout, waitingFor)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// setPhase records the restore's progress; a failure to save it does not
+// stop the restore.
+func (p *ProxmoxRestorer) setPhase(ctx context.Context, restore *models.ProxmoxRestore, phase models.ProxmoxRestorePhase, upid string) {
+	restore.SetPhase(phase, upid)
+	if err := p.store.UpdateProxmoxRestore(ctx, restore); err != nil {
+		p.logger.Warn().Err(err).Str("restore_id", restore.ID.String()).Msg("failed to save proxmox restore progress")
+	}
+}
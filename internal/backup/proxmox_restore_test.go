@@ -0,0 +1,289 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// proxmoxRestoreScript fakes restic ls from $DIR/ls.json and restic dump
+// by printing the dumped path.
+const proxmoxRestoreScript = `#!/bin/sh
+case "$1" in
+ls) cat "$DIR/ls.json" ;;
+dump) for last; do :; done; printf %s "$last" ;;
+esac
+`
+
+const proxmoxRestoreArchive = "/tmp/keldris-proxmox-backup-1/vm-100/vzdump-qemu-100-2024_05_01-02_00_00.vma.zst"
+
+type fakeProxmoxRestoreStore struct {
+	mu      sync.Mutex
+	repo    *models.Repository
+	conn    *models.ProxmoxConnection
+	restore models.ProxmoxRestore
+	phases  []models.ProxmoxRestorePhase
+}
+
+func (s *fakeProxmoxRestoreStore) GetRepository(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	if s.repo == nil || s.repo.ID != id {
+		return nil, errors.New("not found")
+	}
+	return s.repo, nil
+}
+
+func (s *fakeProxmoxRestoreStore) GetProxmoxConnectionByID(_ context.Context, id uuid.UUID) (*models.ProxmoxConnection, error) {
+	if s.conn == nil || s.conn.ID != id {
+		return nil, errors.New("not found")
+	}
+	return s.conn, nil
+}
+
+func (s *fakeProxmoxRestoreStore) UpdateProxmoxRestore(_ context.Context, r *models.ProxmoxRestore) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restore = *r
+	if r.Phase != "" && (len(s.phases) == 0 || s.phases[len(s.phases)-1] != r.Phase) {
+		s.phases = append(s.phases, r.Phase)
+	}
+	return nil
+}
+
+// pveRestoreStandIn records what the restorer sends to node pve2. The
+// restored VM reports running after its first status check.
+type pveRestoreStandIn struct {
+	mu       sync.Mutex
+	uploaded string
+	restore  url.Values
+	deleted  []string
+	checks   int
+	running  bool
+}
+
+func (s *pveRestoreStandIn) handler() http.Handler {
+	ok := func(w http.ResponseWriter, data interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api2/json/cluster/nextid", func(w http.ResponseWriter, r *http.Request) {
+		ok(w, "105")
+	})
+	mux.HandleFunc("/api2/json/nodes/pve2/storage/dump/upload", func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("filename")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		s.mu.Lock()
+		s.uploaded = string(data)
+		s.mu.Unlock()
+		ok(w, "UPID:pve2:upload")
+	})
+	mux.HandleFunc("/api2/json/nodes/pve2/storage/dump/content/", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.deleted = append(s.deleted, strings.TrimPrefix(r.URL.Path, "/api2/json/nodes/pve2/storage/dump/content/"))
+		s.mu.Unlock()
+		ok(w, nil)
+	})
+	mux.HandleFunc("/api2/json/nodes/pve2/qemu", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		s.mu.Lock()
+		s.restore = r.PostForm
+		s.mu.Unlock()
+		ok(w, "UPID:pve2:qmrestore")
+	})
+	mux.HandleFunc("/api2/json/nodes/pve2/qemu/105/status/start", func(w http.ResponseWriter, r *http.Request) {
+		ok(w, "UPID:pve2:qmstart")
+	})
+	mux.HandleFunc("/api2/json/nodes/pve2/qemu/105/status/current", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.checks++
+		status := "stopped"
+		if s.running || s.checks > 1 {
+			status = "running"
+		}
+		ok(w, map[string]interface{}{"status": status, "agent": 1})
+	})
+	mux.HandleFunc("/api2/json/nodes/pve2/qemu/105/agent/ping", func(w http.ResponseWriter, r *http.Request) {
+		ok(w, nil)
+	})
+	mux.HandleFunc("/api2/json/nodes/pve2/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		ok(w, map[string]interface{}{"status": "stopped", "exitstatus": "OK"})
+	})
+	return mux
+}
+
+func newTestProxmoxRestorer(t *testing.T, files []SnapshotFile, pve http.Handler) (*ProxmoxRestorer, *fakeProxmoxRestoreStore, *models.ProxmoxRestore) {
+	t.Helper()
+	dir := t.TempDir()
+	script := filepath.Join(dir, "restic")
+	if err := os.WriteFile(script, []byte(proxmoxRestoreScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{`{"struct_type":"snapshot","id":"aaaa1111"}`}
+	for _, f := range files {
+		b, _ := json.Marshal(f)
+		lines = append(lines, string(b))
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ls.json"), []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DIR", dir)
+
+	ts := httptest.NewTLSServer(pve)
+	t.Cleanup(ts.Close)
+	u, _ := url.Parse(ts.URL)
+	host, portStr, _ := net.SplitHostPort(u.Host)
+	port, _ := strconv.Atoi(portStr)
+
+	orgID := uuid.New()
+	repo := models.NewRepository(orgID, "pve", models.RepositoryTypeLocal, []byte(`{"path":"`+dir+`"}`))
+	conn := models.NewProxmoxConnection(orgID, "pve", host, port, "pve1", "root@pam")
+	conn.VerifySSL = false
+	conn.SetTokenAuth("keldris", []byte("secret"))
+	store := &fakeProxmoxRestoreStore{repo: repo, conn: conn}
+
+	decrypt := func(b []byte) ([]byte, error) { return b, nil }
+	password := func(uuid.UUID) (string, error) { return "secret", nil }
+	p := NewProxmoxRestorer(store, NewResticWithBinary(script, zerolog.Nop()), decrypt, password, zerolog.Nop())
+	p.pollInterval = 10 * time.Millisecond
+
+	restore := models.NewProxmoxRestore(orgID, conn.ID, repo.ID, "aaaa1111", "dump")
+	restore.TargetNode = "pve2"
+	return p, store, restore
+}
+
+func TestProxmoxRestorer_Run(t *testing.T) {
+	pve := &pveRestoreStandIn{}
+	files := []SnapshotFile{
+		{Name: "vm-100", Type: "dir", Path: "/tmp/keldris-proxmox-backup-1/vm-100"},
+		{Name: filepath.Base(proxmoxRestoreArchive), Type: "file", Path: proxmoxRestoreArchive, Size: int64(len(proxmoxRestoreArchive))},
+	}
+	p, store, restore := newTestProxmoxRestorer(t, files, pve.handler())
+	restore.TargetStorage = "local-lvm"
+	restore.Unique = true
+	restore.StartGuest = true
+	restore.HealthCheck = true
+
+	if err := p.Run(context.Background(), restore); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if pve.uploaded != proxmoxRestoreArchive {
+		t.Errorf("uploaded %q, want the dumped archive", pve.uploaded)
+	}
+	want := url.Values{
+		"vmid":    {"105"},
+		"archive": {"dump:backup/vzdump-qemu-100-2024_05_01-02_00_00.vma.zst"},
+		"storage": {"local-lvm"},
+		"unique":  {"1"},
+	}
+	if pve.restore.Encode() != want.Encode() {
+		t.Errorf("restore form = %v, want %v", pve.restore, want)
+	}
+	if len(pve.deleted) != 1 || !strings.Contains(pve.deleted[0], "vzdump-qemu-100") {
+		t.Errorf("deleted = %v, want the uploaded archive removed", pve.deleted)
+	}
+
+	phases := []models.ProxmoxRestorePhase{
+		models.ProxmoxRestorePhaseUpload, models.ProxmoxRestorePhaseRestore,
+		models.ProxmoxRestorePhaseStart, models.ProxmoxRestorePhaseHealthCheck,
+	}
+	if len(store.phases) != len(phases) {
+		t.Fatalf("phases = %v, want %v", store.phases, phases)
+	}
+	for i := range phases {
+		if store.phases[i] != phases[i] {
+			t.Errorf("phases = %v, want %v", store.phases, phases)
+			break
+		}
+	}
+
+	got := store.restore
+	if got.Status != models.ProxmoxRestoreStatusCompleted || got.Result == nil {
+		t.Fatalf("restore = %s %q", got.Status, got.ErrorMessage)
+	}
+	r := got.Result
+	if r.VMID != 105 || r.SourceVMID != 100 || r.GuestType != "qemu" || r.Node != "pve2" ||
+		r.RestoreUPID != "UPID:pve2:qmrestore" || !r.Started || !r.Healthy || !r.AgentResponding {
+		t.Errorf("result = %+v", r)
+	}
+}
+
+func TestProxmoxRestorer_Run_ArchiveSelection(t *testing.T) {
+	lxc := "/tmp/keldris-proxmox-backup-1/vm-200/vzdump-lxc-200-2024_05_01-02_00_00.tar.zst"
+	files := []SnapshotFile{
+		{Type: "file", Path: proxmoxRestoreArchive, Size: 10},
+		{Type: "file", Path: lxc, Size: 10},
+		{Type: "file", Path: "/tmp/keldris-proxmox-backup-1/notes.txt", Size: 10},
+	}
+	tests := []struct {
+		name    string
+		modify  func(r *models.ProxmoxRestore)
+		wantErr string
+	}{
+		{"ambiguous", func(r *models.ProxmoxRestore) {}, "has 2 vzdump archives"},
+		{"unknown vmid", func(r *models.ProxmoxRestore) { r.SourceVMID = 300 }, "no vzdump archive of VM 300"},
+		{"missing archive", func(r *models.ProxmoxRestore) { r.Archive = "/nope.vma.zst" }, "not found in snapshot"},
+		{"not vzdump", func(r *models.ProxmoxRestore) { r.Archive = "/tmp/keldris-proxmox-backup-1/notes.txt" }, "not a vzdump archive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, store, restore := newTestProxmoxRestorer(t, files, (&pveRestoreStandIn{}).handler())
+			tt.modify(restore)
+
+			err := p.Run(context.Background(), restore)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+			if store.restore.Status != models.ProxmoxRestoreStatusFailed || store.restore.ErrorMessage != err.Error() {
+				t.Errorf("restore = %s %q", store.restore.Status, store.restore.ErrorMessage)
+			}
+		})
+	}
+}
+
+func TestProxmoxRestorer_Run_HealthCheckTimeout(t *testing.T) {
+	files := []SnapshotFile{{Type: "file", Path: proxmoxRestoreArchive, Size: int64(len(proxmoxRestoreArchive))}}
+	pve := &pveRestoreStandIn{running: true}
+	handler := pve.handler().(*http.ServeMux)
+	// The VM runs but its guest agent never answers.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api2/json/nodes/pve2/qemu/105/agent/ping", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "QEMU guest agent is not running", http.StatusInternalServerError)
+	})
+	mux.Handle("/", handler)
+
+	p, store, restore := newTestProxmoxRestorer(t, files, mux)
+	restore.NewVMID = 105
+	restore.StartGuest = true
+	restore.HealthCheck = true
+	restore.HealthTimeoutSeconds = 1
+
+	err := p.Run(context.Background(), restore)
+	if err == nil || !strings.Contains(err.Error(), "waiting for the guest agent to respond") {
+		t.Fatalf("Run() error = %v, want health check timeout", err)
+	}
+	got := store.restore
+	if got.Status != models.ProxmoxRestoreStatusFailed || got.Result == nil || got.Result.VMID != 105 || !got.Result.Started || got.Result.Healthy {
+		t.Errorf("restore = %s %+v", got.Status, got.Result)
+	}
+}
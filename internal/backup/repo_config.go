@@ -0,0 +1,99 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+)
+
+// ErrRepositoryReadOnly is returned when an operation would write to a
+// read-only repository, such as the source of a completed migration.
+var ErrRepositoryReadOnly = errors.New("repository is read-only")
+
+// RepositoryGetter loads repositories by ID.
+type RepositoryGetter interface {
+	GetRepository(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+}
+
+// RepositoryConfigResolver builds the restic config of a repository from its
+// encrypted backend configuration and stored password.
+type RepositoryConfigResolver struct {
+	store    RepositoryGetter
+	decrypt  DecryptFunc
+	password func(repoID uuid.UUID) (string, error)
+}
+
+// NewRepositoryConfigResolver creates a new RepositoryConfigResolver. Without
+// decrypt or password every resolution fails.
+func NewRepositoryConfigResolver(store RepositoryGetter, decrypt DecryptFunc, password func(repoID uuid.UUID) (string, error)) *RepositoryConfigResolver {
+	return &RepositoryConfigResolver{store: store, decrypt: decrypt, password: password}
+}
+
+// Resolve loads a repository and builds its restic config.
+func (r *RepositoryConfigResolver) Resolve(ctx context.Context, repositoryID uuid.UUID) (*models.Repository, ResticConfig, error) {
+	if r.decrypt == nil || r.password == nil {
+		return nil, ResticConfig{}, errors.New("repository credentials are not available")
+	}
+	repo, err := r.store.GetRepository(ctx, repositoryID)
+	if err != nil {
+		return nil, ResticConfig{}, fmt.Errorf("get repository: %w", err)
+	}
+	configJSON, err := r.decrypt(repo.ConfigEncrypted)
+	if err != nil {
+		return nil, ResticConfig{}, fmt.Errorf("decrypt config: %w", err)
+	}
+	backend, err := ParseBackend(repo.Type, configJSON)
+	if err != nil {
+		return nil, ResticConfig{}, fmt.Errorf("parse backend: %w", err)
+	}
+	password, err := r.password(repo.ID)
+	if err != nil {
+		return nil, ResticConfig{}, fmt.Errorf("get password: %w", err)
+	}
+	return repo, backend.ToResticConfig(password), nil
+}
+
+// ResolveWritable is Resolve for operations that write to the repository. It
+// returns ErrRepositoryReadOnly for read-only repositories.
+func (r *RepositoryConfigResolver) ResolveWritable(ctx context.Context, repositoryID uuid.UUID) (*models.Repository, ResticConfig, error) {
+	repo, cfg, err := r.Resolve(ctx, repositoryID)
+	if err != nil {
+		return nil, ResticConfig{}, err
+	}
+	if repo.ReadOnly {
+		return nil, ResticConfig{}, ErrRepositoryReadOnly
+	}
+	return repo, cfg, nil
+}
+
+// runGuard tracks the IDs of operations in progress so that each runs at
+// most once at a time.
+type runGuard struct {
+	mu      sync.Mutex
+	running map[uuid.UUID]bool
+}
+
+// claim marks id as running. It returns false if id is already running.
+func (g *runGuard) claim(id uuid.UUID) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running[id] {
+		return false
+	}
+	if g.running == nil {
+		g.running = make(map[uuid.UUID]bool)
+	}
+	g.running[id] = true
+	return true
+}
+
+// release marks id as no longer running.
+func (g *runGuard) release(id uuid.UUID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.running, id)
+}
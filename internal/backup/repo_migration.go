@@ -0,0 +1,258 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// ErrMigrationRunning is returned when a repository migration is already running.
+var ErrMigrationRunning = errors.New("repository migration is already running")
+
+// RepositoryMigrationStore defines the persistence operations used by the
+// repository migrator.
+type RepositoryMigrationStore interface {
+	GetRepository(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	GetRepositoryMigrationByID(ctx context.Context, id uuid.UUID) (*models.RepositoryMigration, error)
+	GetUnfinishedRepositoryMigrations(ctx context.Context) ([]*models.RepositoryMigration, error)
+	UpdateRepositoryMigration(ctx context.Context, m *models.RepositoryMigration) error
+	CompleteRepositoryMigration(ctx context.Context, m *models.RepositoryMigration) (*models.RepositoryRepointResult, error)
+}
+
+// RepositoryMigrator moves repositories to a different backend. It initialises
+// the target with the source's chunker parameters, copies every snapshot,
+// checks the target and then repoints schedules and geo-replication configs
+// to it. DR runbooks follow their schedules. Progress is saved after every snapshot, so
+// a failed or interrupted migration resumes where it stopped.
+type RepositoryMigrator struct {
+	store  RepositoryMigrationStore
+	restic *Restic
+	repos  *RepositoryConfigResolver
+	logger zerolog.Logger
+
+	runs runGuard
+}
+
+// NewRepositoryMigrator creates a new RepositoryMigrator.
+func NewRepositoryMigrator(
+	store RepositoryMigrationStore,
+	restic *Restic,
+	decrypt DecryptFunc,
+	password func(repoID uuid.UUID) (string, error),
+	logger zerolog.Logger,
+) *RepositoryMigrator {
+	return &RepositoryMigrator{
+		store:  store,
+		restic: restic,
+		repos:  NewRepositoryConfigResolver(store, decrypt, password),
+		logger: logger.With().Str("component", "repository_migrator").Logger(),
+	}
+}
+
+// StartMigration runs a migration in the background. It returns
+// ErrMigrationRunning if the migration is already running.
+func (m *RepositoryMigrator) StartMigration(ctx context.Context, migrationID uuid.UUID) error {
+	if !m.runs.claim(migrationID) {
+		return ErrMigrationRunning
+	}
+	go func() {
+		defer m.runs.release(migrationID)
+		if err := m.run(ctx, migrationID); err != nil {
+			m.logger.Error().Err(err).Str("migration_id", migrationID.String()).Msg("repository migration failed")
+		}
+	}()
+	return nil
+}
+
+// ResumeUnfinished restarts migrations that were running when the server stopped.
+func (m *RepositoryMigrator) ResumeUnfinished(ctx context.Context) {
+	migrations, err := m.store.GetUnfinishedRepositoryMigrations(ctx)
+	if err != nil {
+		m.logger.Error().Err(err).Msg("failed to list unfinished repository migrations")
+		return
+	}
+	for _, migration := range migrations {
+		m.logger.Info().Str("migration_id", migration.ID.String()).Msg("resuming repository migration")
+		if err := m.StartMigration(ctx, migration.ID); err != nil {
+			m.logger.Error().Err(err).Str("migration_id", migration.ID.String()).Msg("failed to resume repository migration")
+		}
+	}
+}
+
+// Run runs a migration to completion in the calling goroutine.
+func (m *RepositoryMigrator) Run(ctx context.Context, migrationID uuid.UUID) error {
+	if !m.runs.claim(migrationID) {
+		return ErrMigrationRunning
+	}
+	defer m.runs.release(migrationID)
+	return m.run(ctx, migrationID)
+}
+
+func (m *RepositoryMigrator) run(ctx context.Context, migrationID uuid.UUID) error {
+	migration, err := m.store.GetRepositoryMigrationByID(ctx, migrationID)
+	if err != nil {
+		return fmt.Errorf("get repository migration: %w", err)
+	}
+	if migration.Status == models.RepositoryMigrationStatusCompleted {
+		return nil
+	}
+
+	logger := m.logger.With().Str("migration_id", migration.ID.String()).Logger()
+
+	if err := m.migrate(ctx, migration, logger); err != nil {
+		migration.Fail(err.Error())
+		if updateErr := m.store.UpdateRepositoryMigration(ctx, migration); updateErr != nil {
+			logger.Error().Err(updateErr).Msg("failed to record repository migration failure")
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *RepositoryMigrator) migrate(ctx context.Context, migration *models.RepositoryMigration, logger zerolog.Logger) error {
+	if migration.SourceRepositoryID == nil || migration.TargetRepositoryID == nil {
+		return fmt.Errorf("source or target repository no longer exists")
+	}
+
+	_, sourceCfg, err := m.repos.Resolve(ctx, *migration.SourceRepositoryID)
+	if err != nil {
+		return fmt.Errorf("source repository: %w", err)
+	}
+	_, targetCfg, err := m.repos.Resolve(ctx, *migration.TargetRepositoryID)
+	if err != nil {
+		return fmt.Errorf("target repository: %w", err)
+	}
+
+	// Initialise the target unless snapshots have already been copied into it.
+	if len(migration.CopiedSnapshotIDs) == 0 {
+		if err := m.setStatus(ctx, migration, models.RepositoryMigrationStatusInitializing); err != nil {
+			return err
+		}
+		if err := m.restic.InitWithChunkerParams(ctx, targetCfg, sourceCfg); err != nil {
+			return err
+		}
+	}
+
+	if err := m.setStatus(ctx, migration, models.RepositoryMigrationStatusCopying); err != nil {
+		return err
+	}
+	// Backups can still land in the source while earlier snapshots are being
+	// copied, so keep listing until a pass finds nothing new.
+	for {
+		copied, err := m.copySnapshots(ctx, migration, sourceCfg, targetCfg, logger)
+		if err != nil {
+			return err
+		}
+		if copied == 0 {
+			break
+		}
+	}
+
+	if err := m.setStatus(ctx, migration, models.RepositoryMigrationStatusVerifying); err != nil {
+		return err
+	}
+	opts := CheckOptions{
+		ReadData:       migration.ReadDataSubset != "",
+		ReadDataSubset: migration.ReadDataSubset,
+	}
+	if _, err := m.restic.CheckWithOptions(ctx, targetCfg, opts); err != nil {
+		return fmt.Errorf("verify target repository: %w", err)
+	}
+	targetSnapshots, err := m.restic.Snapshots(ctx, targetCfg)
+	if err != nil {
+		return fmt.Errorf("list target snapshots: %w", err)
+	}
+	if len(targetSnapshots) < len(migration.CopiedSnapshotIDs) {
+		return fmt.Errorf("target repository has %d snapshots, expected at least %d",
+			len(targetSnapshots), len(migration.CopiedSnapshotIDs))
+	}
+
+	// Backups that landed in the source while the target was being checked
+	// are copied right before the repoint, and anything a backup that was
+	// already running still writes to the source is picked up right after it.
+	if _, err := m.copySnapshots(ctx, migration, sourceCfg, targetCfg, logger); err != nil {
+		return err
+	}
+	result, err := m.store.CompleteRepositoryMigration(ctx, migration)
+	if err != nil {
+		return fmt.Errorf("repoint to target repository: %w", err)
+	}
+	if _, err := m.copySnapshots(ctx, migration, sourceCfg, targetCfg, logger); err != nil {
+		logger.Warn().Err(err).Msg("failed to copy snapshots taken during the repoint")
+	}
+	migration.CurrentSnapshotID = ""
+	if err := m.store.UpdateRepositoryMigration(ctx, migration); err != nil {
+		logger.Warn().Err(err).Msg("failed to save repository migration")
+	}
+
+	logger.Info().
+		Int("snapshots", len(migration.CopiedSnapshotIDs)).
+		Int("schedules", result.Schedules).
+		Int("geo_configs", result.GeoConfigs).
+		Msg("repository migration completed")
+	return nil
+}
+
+// copySnapshots copies every source snapshot not yet copied, oldest first,
+// and returns how many were copied.
+func (m *RepositoryMigrator) copySnapshots(
+	ctx context.Context,
+	migration *models.RepositoryMigration,
+	sourceCfg, targetCfg ResticConfig,
+	logger zerolog.Logger,
+) (int, error) {
+	snapshots, err := m.restic.Snapshots(ctx, sourceCfg)
+	if err != nil {
+		return 0, fmt.Errorf("list source snapshots: %w", err)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.Before(snapshots[j].Time) })
+
+	migration.TotalSnapshots = len(snapshots)
+	if err := m.store.UpdateRepositoryMigration(ctx, migration); err != nil {
+		return 0, fmt.Errorf("update repository migration: %w", err)
+	}
+
+	copied := 0
+	for _, snap := range snapshots {
+		if migration.IsCopied(snap.ID) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return copied, err
+		}
+
+		migration.CurrentSnapshotID = snap.ID
+		if err := m.store.UpdateRepositoryMigration(ctx, migration); err != nil {
+			return copied, fmt.Errorf("update repository migration: %w", err)
+		}
+
+		if err := m.restic.Copy(ctx, sourceCfg, targetCfg, snap.ID); err != nil {
+			return copied, fmt.Errorf("copy snapshot %s: %w", snap.ShortID, err)
+		}
+
+		migration.MarkCopied(snap.ID)
+		if err := m.store.UpdateRepositoryMigration(ctx, migration); err != nil {
+			return copied, fmt.Errorf("update repository migration: %w", err)
+		}
+		copied++
+
+		logger.Debug().
+			Str("snapshot_id", snap.ID).
+			Float64("progress_percent", migration.ProgressPercent()).
+			Msg("snapshot copied")
+	}
+	return copied, nil
+}
+
+func (m *RepositoryMigrator) setStatus(ctx context.Context, migration *models.RepositoryMigration, status models.RepositoryMigrationStatus) error {
+	migration.Start(status)
+	if err := m.store.UpdateRepositoryMigration(ctx, migration); err != nil {
+		return fmt.Errorf("update repository migration: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type fakeRepositoryMigrationStore struct {
+	repos     map[uuid.UUID]*models.Repository
+	migration *models.RepositoryMigration
+	updates   int
+	completed bool
+	// copiedAtRepoint holds the snapshots copied when the repoint ran.
+	copiedAtRepoint []string
+}
+
+func newFakeRepositoryMigrationStore(t *testing.T) *fakeRepositoryMigrationStore {
+	t.Helper()
+	orgID := uuid.New()
+	source := models.NewRepository(orgID, "old", models.RepositoryTypeLocal, []byte(`{"path":"`+t.TempDir()+`"}`))
+	target := models.NewRepository(orgID, "new", models.RepositoryTypeLocal, []byte(`{"path":"`+t.TempDir()+`"}`))
+	return &fakeRepositoryMigrationStore{
+		repos:     map[uuid.UUID]*models.Repository{source.ID: source, target.ID: target},
+		migration: models.NewRepositoryMigration(orgID, source, target, nil),
+	}
+}
+
+func (s *fakeRepositoryMigrationStore) GetRepository(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	repo, ok := s.repos[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return repo, nil
+}
+
+func (s *fakeRepositoryMigrationStore) GetRepositoryMigrationByID(_ context.Context, _ uuid.UUID) (*models.RepositoryMigration, error) {
+	copied := *s.migration
+	copied.CopiedSnapshotIDs = append([]string{}, s.migration.CopiedSnapshotIDs...)
+	return &copied, nil
+}
+
+func (s *fakeRepositoryMigrationStore) GetUnfinishedRepositoryMigrations(_ context.Context) ([]*models.RepositoryMigration, error) {
+	return nil, nil
+}
+
+func (s *fakeRepositoryMigrationStore) UpdateRepositoryMigration(_ context.Context, m *models.RepositoryMigration) error {
+	copied := *m
+	copied.CopiedSnapshotIDs = append([]string{}, m.CopiedSnapshotIDs...)
+	s.migration = &copied
+	s.updates++
+	return nil
+}
+
+func (s *fakeRepositoryMigrationStore) CompleteRepositoryMigration(_ context.Context, m *models.RepositoryMigration) (*models.RepositoryRepointResult, error) {
+	m.Complete()
+	s.migration = m
+	s.completed = true
+	s.copiedAtRepoint = append([]string{}, m.CopiedSnapshotIDs...)
+	return &models.RepositoryRepointResult{Schedules: 2}, nil
+}
+
+func newTestRepositoryMigrator(store *fakeRepositoryMigrationStore, restic *Restic) *RepositoryMigrator {
+	decrypt := func(b []byte) ([]byte, error) { return b, nil }
+	password := func(uuid.UUID) (string, error) { return "secret", nil }
+	return NewRepositoryMigrator(store, restic, decrypt, password, zerolog.Nop())
+}
+
+const migrationSnapshotsJSON = `[
+	{"id":"bbbb2222","short_id":"bbbb2222","time":"2026-02-01T00:00:00Z","hostname":"web"},
+	{"id":"aaaa1111","short_id":"aaaa1111","time":"2026-01-01T00:00:00Z","hostname":"web"}
+]`
+
+func TestRepositoryMigrator_Run(t *testing.T) {
+	restic, cleanup := newTestRestic(migrationSnapshotsJSON)
+	defer cleanup()
+
+	store := newFakeRepositoryMigrationStore(t)
+	m := newTestRepositoryMigrator(store, restic)
+
+	if err := m.Run(context.Background(), store.migration.ID); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !store.completed {
+		t.Fatal("migration should be completed and repointed")
+	}
+	got := store.migration
+	if got.Status != models.RepositoryMigrationStatusCompleted {
+		t.Errorf("status = %s, want completed", got.Status)
+	}
+	if got.TotalSnapshots != 2 {
+		t.Errorf("TotalSnapshots = %d, want 2", got.TotalSnapshots)
+	}
+	// Snapshots are copied oldest first.
+	if len(got.CopiedSnapshotIDs) != 2 || got.CopiedSnapshotIDs[0] != "aaaa1111" {
+		t.Errorf("CopiedSnapshotIDs = %v, want [aaaa1111 bbbb2222]", got.CopiedSnapshotIDs)
+	}
+	if got.ProgressPercent() != 100 {
+		t.Errorf("ProgressPercent() = %v, want 100", got.ProgressPercent())
+	}
+}
+
+// migrationCheckScript fakes a restic whose source gains a snapshot while
+// the target is being checked.
+const migrationCheckScript = `#!/bin/sh
+case "$1" in
+snapshots) cat "$DIR/snapshots.json" ;;
+check) cp "$DIR/later.json" "$DIR/snapshots.json"; echo '{}' ;;
+*) echo '{}' ;;
+esac
+`
+
+func TestRepositoryMigrator_CopiesSnapshotsTakenDuringVerify(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "restic")
+	files := map[string]string{
+		"restic":         migrationCheckScript,
+		"snapshots.json": `[{"id":"aaaa1111","short_id":"aaaa1111","time":"2026-01-01T00:00:00Z"}]`,
+		"later.json": `[{"id":"aaaa1111","short_id":"aaaa1111","time":"2026-01-01T00:00:00Z"},
+			{"id":"cccc3333","short_id":"cccc3333","time":"2026-03-01T00:00:00Z"}]`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("DIR", dir)
+
+	store := newFakeRepositoryMigrationStore(t)
+	m := newTestRepositoryMigrator(store, NewResticWithBinary(script, zerolog.Nop()))
+
+	if err := m.Run(context.Background(), store.migration.ID); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(store.copiedAtRepoint) != 2 || store.copiedAtRepoint[1] != "cccc3333" {
+		t.Errorf("copied at repoint = %v, want the snapshot taken during verification too", store.copiedAtRepoint)
+	}
+	if store.migration.CurrentSnapshotID != "" {
+		t.Errorf("CurrentSnapshotID = %q, want cleared", store.migration.CurrentSnapshotID)
+	}
+}
+
+func TestRepositoryMigrator_Resume(t *testing.T) {
+	restic, cleanup := newTestRestic(migrationSnapshotsJSON)
+	defer cleanup()
+
+	store := newFakeRepositoryMigrationStore(t)
+	store.migration.Fail("connection reset")
+	store.migration.MarkCopied("aaaa1111")
+	store.migration.MarkCopied("bbbb2222")
+	m := newTestRepositoryMigrator(store, restic)
+
+	if err := m.Run(context.Background(), store.migration.ID); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if store.migration.Status != models.RepositoryMigrationStatusCompleted {
+		t.Errorf("status = %s, want completed", store.migration.Status)
+	}
+	if store.migration.ErrorMessage != "" {
+		t.Errorf("ErrorMessage = %q, want cleared", store.migration.ErrorMessage)
+	}
+	if len(store.migration.CopiedSnapshotIDs) != 2 {
+		t.Errorf("CopiedSnapshotIDs = %v, want the two already copied", store.migration.CopiedSnapshotIDs)
+	}
+}
+
+func TestRepositoryMigrator_RunFailure(t *testing.T) {
+	restic, cleanup := newTestResticError("Fatal: unable to open repository")
+	defer cleanup()
+
+	store := newFakeRepositoryMigrationStore(t)
+	m := newTestRepositoryMigrator(store, restic)
+
+	if err := m.Run(context.Background(), store.migration.ID); err == nil {
+		t.Fatal("Run() expected error")
+	}
+	if store.completed {
+		t.Error("failed migration must not repoint")
+	}
+	if store.migration.Status != models.RepositoryMigrationStatusFailed {
+		t.Errorf("status = %s, want failed", store.migration.Status)
+	}
+	if store.migration.ErrorMessage == "" {
+		t.Error("failure should be recorded")
+	}
+	if !store.migration.CanResume() {
+		t.Error("failed migration should be resumable")
+	}
+}
+
+func TestRepositoryMigrator_AlreadyRunning(t *testing.T) {
+	store := newFakeRepositoryMigrationStore(t)
+	m := newTestRepositoryMigrator(store, NewRestic(zerolog.Nop()))
+
+	if !m.runs.claim(store.migration.ID) {
+		t.Fatal("first claim should succeed")
+	}
+	defer m.runs.release(store.migration.ID)
+
+	if err := m.StartMigration(context.Background(), store.migration.ID); !errors.Is(err, ErrMigrationRunning) {
+		t.Errorf("StartMigration() error = %v, want ErrMigrationRunning", err)
+	}
+}
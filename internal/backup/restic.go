@@ -7,12 +7,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/backup/streamio"
 	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/rs/zerolog"
 )
@@ -43,6 +47,39 @@ type BackupStats struct {
 	FilesChanged int
 	SizeBytes    int64
 	Duration     time.Duration
+	Transfer     TransferStats
+	// StdinBytes and StdinSHA256 describe the data read from standard
+	// input by BackupStdin.
+	StdinBytes  int64
+	StdinSHA256 string
+}
+
+// TransferStats describes how a backup used the repository backend, taken
+// from restic's JSON output and its retry messages.
+type TransferStats struct {
+	// BytesProcessed is the size of all files restic read.
+	BytesProcessed int64
+	// BytesUploaded is the data written to the backend after deduplication
+	// and compression.
+	BytesUploaded int64
+	// OpenDuration is the time until restic first reported progress, which
+	// covers opening the repository and loading its index.
+	OpenDuration time.Duration
+	// Retries counts backend requests that were retried.
+	Retries   int
+	RetryWait time.Duration
+	// BackendErrors counts failed backend requests.
+	BackendErrors int
+	// FileErrors counts files restic could not read.
+	FileErrors int
+}
+
+// UploadBytesPerSecond returns the upload throughput over the given duration.
+func (t TransferStats) UploadBytesPerSecond(d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(t.BytesUploaded) / d.Seconds()
 }
 
 // DryRunFile represents a file that would be backed up in a dry run.
@@ -113,11 +150,73 @@ func (r *Restic) Init(ctx context.Context, cfg ResticConfig) error {
 	return nil
 }
 
+// InitWithChunkerParams initializes a new Restic repository using the chunker
+// parameters of fromCfg's repository, so that data copied between the two
+// repositories deduplicates.
+//
+// restic opens the --from-repo backend with the same environment as the
+// target, so both repositories' credentials are merged into one environment.
+// If they need different values for the same variable (two S3 buckets with
+// different keys, say) the target is initialized with its own chunker
+// parameters instead: copies still work, they just deduplicate less.
+func (r *Restic) InitWithChunkerParams(ctx context.Context, cfg, fromCfg ResticConfig) error {
+	env, conflict := chunkerParamsEnv(cfg.Env, fromCfg.Env)
+	if conflict != "" {
+		r.logger.Warn().
+			Str("repository", cfg.Repository).
+			Str("from_repo", fromCfg.Repository).
+			Str("variable", conflict).
+			Msg("source and target repositories need different credentials, initializing without copied chunker parameters")
+		return r.Init(ctx, cfg)
+	}
+
+	r.logger.Info().
+		Str("repository", cfg.Repository).
+		Str("from_repo", fromCfg.Repository).
+		Msg("initializing repository with copied chunker parameters")
+
+	args := []string{
+		"init",
+		"--repo", cfg.Repository,
+		"--from-repo", fromCfg.Repository,
+		"--copy-chunker-params",
+		"--json",
+	}
+	env["RESTIC_FROM_PASSWORD"] = fromCfg.Password
+
+	mergedCfg := ResticConfig{
+		Repository: cfg.Repository,
+		Password:   cfg.Password,
+		Env:        env,
+	}
+
+	_, err := r.run(ctx, mergedCfg, args)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") ||
+			strings.Contains(err.Error(), "already initialized") {
+			r.logger.Debug().Msg("repository already initialized")
+			return nil
+		}
+		return fmt.Errorf("init repository: %w", err)
+	}
+
+	r.logger.Info().Msg("repository initialized successfully")
+	return nil
+}
+
 // BackupOptions contains optional parameters for backup operations.
 type BackupOptions struct {
 	BandwidthLimitKB *int    // Upload bandwidth limit in KB/s (nil = unlimited)
 	CompressionLevel *string // Compression level: off, auto, max (nil = restic default "auto")
 	MaxFileSizeMB    *int    // Maximum file size in MB to include (nil/0 = no limit)
+	ReadConcurrency  *int    // Number of files read in parallel (nil = restic default)
+
+	// PathMounts maps backup paths to directories holding a read-only copy
+	// of them, such as the same path in a filesystem snapshot. Restic then
+	// runs in a private mount namespace with each copy bind-mounted over its
+	// path, so the snapshot records the original paths. Requires Linux and
+	// root.
+	PathMounts map[string]string
 }
 
 // Backup runs a backup operation with the given paths and excludes.
@@ -137,45 +236,94 @@ func (r *Restic) BackupWithOptions(ctx context.Context, cfg ResticConfig, paths,
 		Strs("tags", tags).
 		Msg("starting backup")
 
-	start := time.Now()
-
 	args := []string{"backup", "--repo", cfg.Repository, "--json"}
-
-	for _, tag := range tags {
-		args = append(args, "--tag", tag)
-	}
-
 	for _, exclude := range excludes {
 		args = append(args, "--exclude", exclude)
 	}
+	args = appendBackupOptions(args, tags, opts)
+	args = append(args, paths...)
 
-	// Apply optional settings
+	var mounts map[string]string
 	if opts != nil {
-		if opts.BandwidthLimitKB != nil && *opts.BandwidthLimitKB > 0 {
-			args = append(args, "--limit-upload", fmt.Sprintf("%d", *opts.BandwidthLimitKB))
-		}
-		if opts.CompressionLevel != nil && *opts.CompressionLevel != "" {
-			args = append(args, "--compression", *opts.CompressionLevel)
-		}
-		if opts.MaxFileSizeMB != nil && *opts.MaxFileSizeMB > 0 {
-			maxBytes := int64(*opts.MaxFileSizeMB) * 1024 * 1024
-			args = append(args, "--exclude-larger-than", fmt.Sprintf("%d", maxBytes))
+		mounts = opts.PathMounts
+	}
+	return r.runBackup(ctx, cfg, args, mounts, nil)
+}
+
+// BackupStdin backs up the data read from stdin as a single file with the
+// given name, using restic backup --stdin. If reading stdin fails, restic is
+// stopped before it sees the end of the input, so no snapshot of partial
+// data is created.
+func (r *Restic) BackupStdin(ctx context.Context, cfg ResticConfig, filename string, stdin io.Reader, tags []string, opts *BackupOptions) (*BackupStats, error) {
+	if filename == "" {
+		return nil, errors.New("no filename specified for stdin backup")
+	}
+
+	r.logger.Info().
+		Str("filename", filename).
+		Strs("tags", tags).
+		Msg("starting stdin backup")
+
+	args := []string{"backup", "--repo", cfg.Repository, "--json", "--stdin", "--stdin-filename", filename}
+	args = appendBackupOptions(args, tags, opts)
+
+	digest := streamio.NewDigestReader(stdin)
+	stats, err := r.runBackup(ctx, cfg, args, nil, digest)
+	if stats != nil {
+		stats.StdinBytes = digest.N()
+		if err == nil {
+			stats.StdinSHA256 = digest.SHA256()
 		}
 	}
+	return stats, err
+}
 
-	args = append(args, paths...)
+// appendBackupOptions appends the tag and optional flags shared by all
+// backup commands.
+func appendBackupOptions(args, tags []string, opts *BackupOptions) []string {
+	for _, tag := range tags {
+		args = append(args, "--tag", tag)
+	}
+	if opts == nil {
+		return args
+	}
+	if opts.BandwidthLimitKB != nil && *opts.BandwidthLimitKB > 0 {
+		args = append(args, "--limit-upload", fmt.Sprintf("%d", *opts.BandwidthLimitKB))
+	}
+	if opts.CompressionLevel != nil && *opts.CompressionLevel != "" {
+		args = append(args, "--compression", *opts.CompressionLevel)
+	}
+	if opts.MaxFileSizeMB != nil && *opts.MaxFileSizeMB > 0 {
+		maxBytes := int64(*opts.MaxFileSizeMB) * 1024 * 1024
+		args = append(args, "--exclude-larger-than", fmt.Sprintf("%d", maxBytes))
+	}
+	if opts.ReadConcurrency != nil && *opts.ReadConcurrency > 0 {
+		args = append(args, "--read-concurrency", fmt.Sprintf("%d", *opts.ReadConcurrency))
+	}
+	return args
+}
 
-	output, err := r.run(ctx, cfg, args)
+// runBackup runs a backup command and parses its statistics.
+func (r *Restic) runBackup(ctx context.Context, cfg ResticConfig, args []string, mounts map[string]string, stdin io.Reader) (*BackupStats, error) {
+	start := time.Now()
+
+	res, err := r.runCaptureInput(ctx, cfg, args, mounts, stdin)
 	if err != nil {
-		return nil, fmt.Errorf("backup failed: %w", err)
+		failed := &BackupStats{Duration: time.Since(start)}
+		failed.Transfer = parseTransferStats(res.stdout, res.stderr, start, res.firstOutput)
+		return failed, fmt.Errorf("backup failed: %w", err)
 	}
 
-	stats, err := parseBackupOutput(output)
+	stats, err := parseBackupOutput(res.stdout)
 	if err != nil {
 		return nil, fmt.Errorf("parse backup output: %w", err)
 	}
 
 	stats.Duration = time.Since(start)
+	transfer := parseTransferStats(res.stdout, res.stderr, start, res.firstOutput)
+	transfer.BytesUploaded = stats.Transfer.BytesUploaded
+	transfer.BytesProcessed = stats.Transfer.BytesProcessed
+	stats.Transfer = transfer
 
 	r.logger.Info().
 		Str("snapshot_id", stats.SnapshotID).
@@ -553,10 +701,32 @@ type CheckResult struct {
 	Errors   []string      `json:"errors,omitempty"`
 }
 
-// RepoStats contains basic repository statistics.
+// RepoStats contains basic repository statistics. The compression and blob
+// fields are only reported in raw-data mode.
 type RepoStats struct {
-	TotalSize      int64 `json:"total_size"`
-	TotalFileCount int   `json:"total_file_count"`
+	TotalSize              int64   `json:"total_size"`
+	TotalFileCount         int     `json:"total_file_count"`
+	TotalUncompressedSize  int64   `json:"total_uncompressed_size,omitempty"`
+	CompressionRatio       float64 `json:"compression_ratio,omitempty"`
+	CompressionProgress    float64 `json:"compression_progress,omitempty"`
+	CompressionSpaceSaving float64 `json:"compression_space_saving,omitempty"`
+	TotalBlobCount         int     `json:"total_blob_count,omitempty"`
+	SnapshotsCount         int     `json:"snapshots_count,omitempty"`
+}
+
+// PruneOptions configures a standalone restic prune.
+type PruneOptions struct {
+	MaxUnused          string // e.g. "5%" or "1G"; restic's default when empty
+	MaxRepackSize      string // e.g. "10G"; unlimited when empty
+	RepackUncompressed bool   // compress packs written before repository v2
+	DryRun             bool   // only report what would be removed
+}
+
+// PruneEstimate summarises restic prune's plan for a repository.
+type PruneEstimate struct {
+	RepackBytes    int64 `json:"repack_bytes"`
+	ReclaimBytes   int64 `json:"reclaim_bytes"`
+	RemainingBytes int64 `json:"remaining_bytes"`
 }
 
 // Prune removes old snapshots according to the retention policy and prunes unused data.
@@ -595,6 +765,92 @@ func (r *Restic) Prune(ctx context.Context, cfg ResticConfig, retention *models.
 	return result, nil
 }
 
+// PruneWithOptions removes unreferenced data without forgetting snapshots. The
+// returned estimate is parsed from restic's plan, so it is available for dry
+// runs as well as real ones.
+func (r *Restic) PruneWithOptions(ctx context.Context, cfg ResticConfig, opts PruneOptions) (*PruneEstimate, error) {
+	r.logger.Info().
+		Str("max_unused", opts.MaxUnused).
+		Bool("repack_uncompressed", opts.RepackUncompressed).
+		Bool("dry_run", opts.DryRun).
+		Msg("pruning repository")
+
+	args := []string{"prune", "--repo", cfg.Repository}
+	if opts.MaxUnused != "" {
+		args = append(args, "--max-unused", opts.MaxUnused)
+	}
+	if opts.MaxRepackSize != "" {
+		args = append(args, "--max-repack-size", opts.MaxRepackSize)
+	}
+	if opts.RepackUncompressed {
+		args = append(args, "--repack-uncompressed")
+	}
+	if opts.DryRun {
+		args = append(args, "--dry-run")
+	}
+
+	output, err := r.run(ctx, cfg, args)
+	if err != nil {
+		return nil, fmt.Errorf("prune failed: %w", err)
+	}
+	return parsePruneOutput(output), nil
+}
+
+// RepositoryVersion returns the repository format version (1 or 2).
+func (r *Restic) RepositoryVersion(ctx context.Context, cfg ResticConfig) (int, error) {
+	output, err := r.run(ctx, cfg, []string{"cat", "config", "--repo", cfg.Repository})
+	if err != nil {
+		return 0, fmt.Errorf("read repository config: %w", err)
+	}
+	var config struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(output, &config); err != nil {
+		return 0, fmt.Errorf("parse repository config: %w", err)
+	}
+	return config.Version, nil
+}
+
+// chunkerParamsEnv merges the target and source repository environments for
+// a restic run that opens both. It returns the first variable both need with
+// different values, in which case the environments cannot be combined.
+func chunkerParamsEnv(target, source map[string]string) (map[string]string, string) {
+	env := make(map[string]string, len(target)+len(source))
+	for k, v := range target {
+		env[k] = v
+	}
+
+	keys := make([]string, 0, len(source))
+	for k := range source {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := source[k]
+		// Rendered rclone configs are merged into one config file, so the
+		// source's is kept under a separate key.
+		if strings.HasSuffix(k, backends.RcloneConfigEnv) {
+			env["RESTIC_FROM_"+k] = v
+			continue
+		}
+		if existing, ok := env[k]; ok && existing != v {
+			return nil, k
+		}
+		env[k] = v
+	}
+	return env, ""
+}
+
+// UpgradeRepoV2 upgrades a repository to format version 2, which enables
+// compression for data written afterwards.
+func (r *Restic) UpgradeRepoV2(ctx context.Context, cfg ResticConfig) error {
+	r.logger.Info().Msg("upgrading repository to version 2")
+	if _, err := r.run(ctx, cfg, []string{"migrate", "upgrade_repo_v2", "--repo", cfg.Repository}); err != nil {
+		return fmt.Errorf("upgrade repository: %w", err)
+	}
+	return nil
+}
+
 // Copy copies a snapshot from one repository to another.
 func (r *Restic) Copy(ctx context.Context, sourceCfg, targetCfg ResticConfig, snapshotID string) error {
 	r.logger.Info().
@@ -702,18 +958,85 @@ func (r *Restic) Stats(ctx context.Context, cfg ResticConfig) (*RepoStats, error
 	return &stats, nil
 }
 
+// RawStats returns statistics about the repository's stored data, including
+// compression progress.
+func (r *Restic) RawStats(ctx context.Context, cfg ResticConfig) (*RepoStats, error) {
+	args := []string{"stats", "--repo", cfg.Repository, "--mode", "raw-data", "--json"}
+	output, err := r.run(ctx, cfg, args)
+	if err != nil {
+		return nil, fmt.Errorf("stats failed: %w", err)
+	}
+
+	var stats RepoStats
+	if err := json.Unmarshal(output, &stats); err != nil {
+		return nil, fmt.Errorf("parse stats: %w", err)
+	}
+	return &stats, nil
+}
+
 // run executes a restic command with the given arguments and returns the output.
 func (r *Restic) run(ctx context.Context, cfg ResticConfig, args []string) ([]byte, error) {
-	cmd := exec.CommandContext(ctx, r.binary, args...)
+	res, err := r.runCapture(ctx, cfg, args)
+	return res.stdout, err
+}
+
+// commandResult holds the output of a restic command.
+type commandResult struct {
+	stdout      []byte
+	stderr      []byte
+	firstOutput time.Time
+}
+
+// firstWriteRecorder remembers when restic first wrote to stdout.
+type firstWriteRecorder struct {
+	bytes.Buffer
+	first time.Time
+}
+
+func (w *firstWriteRecorder) Write(p []byte) (int, error) {
+	if w.first.IsZero() && len(p) > 0 {
+		w.first = time.Now()
+	}
+	return w.Buffer.Write(p)
+}
+
+// runCapture executes a restic command and returns stdout, stderr and when
+// output started. The output is returned even when the command fails.
+func (r *Restic) runCapture(ctx context.Context, cfg ResticConfig, args []string) (commandResult, error) {
+	return r.runCaptureWithMounts(ctx, cfg, args, nil)
+}
+
+// runCaptureWithMounts is runCapture with restic running in a private mount
+// namespace that has the given path mounts applied.
+func (r *Restic) runCaptureWithMounts(ctx context.Context, cfg ResticConfig, args []string, mounts map[string]string) (commandResult, error) {
+	return r.runCaptureInput(ctx, cfg, args, mounts, nil)
+}
+
+// runCaptureInput is runCaptureWithMounts with stdin copied to restic's
+// standard input. When reading stdin fails, restic is killed before its
+// input is closed and the read error is returned.
+func (r *Restic) runCaptureInput(ctx context.Context, cfg ResticConfig, args []string, mounts map[string]string, stdin io.Reader) (commandResult, error) {
+	env, cleanup, err := cfg.MaterializeEnv()
+	if err != nil {
+		return commandResult{}, err
+	}
+	defer cleanup()
+
+	name, cmdArgs := r.binary, cfg.CommandArgs(args)
+	if len(mounts) > 0 {
+		name, cmdArgs = namespaceCommand(mounts, name, cmdArgs)
+	}
+	cmd := exec.CommandContext(ctx, name, cmdArgs...)
 
 	// Set environment variables
 	cmd.Env = os.Environ()
 	cmd.Env = append(cmd.Env, fmt.Sprintf("RESTIC_PASSWORD=%s", cfg.Password))
-	for k, v := range cfg.Env {
+	for k, v := range env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
 
-	var stdout, stderr bytes.Buffer
+	var stdout firstWriteRecorder
+	var stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
@@ -721,15 +1044,123 @@ func (r *Restic) run(ctx context.Context, cfg ResticConfig, args []string) ([]by
 		Strs("args", redactArgs(args)).
 		Msg("executing restic command")
 
-	if err := cmd.Run(); err != nil {
+	var input *inputCopier
+	if stdin != nil {
+		pipe, err := cmd.StdinPipe()
+		if err != nil {
+			return commandResult{}, err
+		}
+		input = newInputCopier(stdin, pipe)
+	}
+
+	if err = cmd.Start(); err == nil {
+		if input != nil {
+			go input.copy(cmd.Process)
+		}
+		err = cmd.Wait()
+	}
+	res := commandResult{stdout: stdout.Bytes(), stderr: stderr.Bytes(), firstOutput: stdout.first}
+	if input != nil {
+		if readErr := input.result(err); readErr != nil {
+			return res, fmt.Errorf("read input: %w", readErr)
+		}
+	}
+	if err != nil {
 		errMsg := stderr.String()
 		if errMsg == "" {
 			errMsg = err.Error()
 		}
-		return nil, fmt.Errorf("%s", strings.TrimSpace(errMsg))
+		return res, fmt.Errorf("%s", strings.TrimSpace(errMsg))
 	}
 
-	return stdout.Bytes(), nil
+	return res, nil
+}
+
+// inputCopier feeds a command's standard input from a reader.
+type inputCopier struct {
+	src     io.Reader
+	dst     io.WriteCloser
+	readErr error
+	// failed is closed when reading src fails, before the process is
+	// killed; done is closed when copying stops.
+	failed chan struct{}
+	done   chan struct{}
+}
+
+func newInputCopier(src io.Reader, dst io.WriteCloser) *inputCopier {
+	return &inputCopier{src: src, dst: dst, failed: make(chan struct{}), done: make(chan struct{})}
+}
+
+// copy copies the input until it ends. A read error kills the process
+// before its input is closed, so a partial input is never seen as complete.
+// Write errors mean the process exited and are reported by the process.
+func (c *inputCopier) copy(process *os.Process) {
+	defer close(c.done)
+	defer c.dst.Close()
+	buf := make([]byte, 256*1024)
+	for {
+		n, err := c.src.Read(buf)
+		if n > 0 {
+			if _, werr := c.dst.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			c.readErr = err
+			close(c.failed)
+			process.Kill()
+			return
+		}
+	}
+}
+
+// result returns the read error that stopped the process, if any. After a
+// successful run the input has been copied completely; after a failed one
+// the copy may still be blocked reading and is not waited for.
+func (c *inputCopier) result(runErr error) error {
+	if runErr == nil {
+		<-c.done
+		return nil
+	}
+	select {
+	case <-c.failed:
+		return c.readErr
+	default:
+		return nil
+	}
+}
+
+// namespaceScript bind-mounts each source read-only over its target and then
+// runs the command following "--".
+const namespaceScript = `set -e
+while [ "$1" != "--" ]; do
+	mount --bind "$2" "$1"
+	mount -o remount,bind,ro "$1"
+	shift 2
+done
+shift
+exec "$@"`
+
+// namespaceCommand wraps a command so that it runs in a private mount
+// namespace in which each source directory of mounts is bind-mounted over its
+// target path. Parents are mounted before the paths below them. The mounts
+// disappear with the namespace when the command exits.
+func namespaceCommand(mounts map[string]string, name string, args []string) (string, []string) {
+	targets := make([]string, 0, len(mounts))
+	for target := range mounts {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	wrapped := []string{"--mount", "--propagation", "private", "--", "/bin/sh", "-c", namespaceScript, "keldris-snapshot"}
+	for _, target := range targets {
+		wrapped = append(wrapped, target, mounts[target])
+	}
+	wrapped = append(wrapped, "--", name)
+	return "unshare", append(wrapped, args...)
 }
 
 // retentionEmpty returns true if all retention values are zero/empty,
@@ -772,11 +1203,13 @@ func (r *Restic) buildRetentionArgs(repository string, retention *models.Retenti
 // parseBackupOutput parses the JSON output from a restic backup command.
 func parseBackupOutput(output []byte) (*BackupStats, error) {
 	type backupSummary struct {
-		MessageType string `json:"message_type"`
-		SnapshotID  string `json:"snapshot_id"`
-		FilesNew    int    `json:"files_new"`
-		FilesChanged int   `json:"files_changed"`
-		DataAdded   int64  `json:"data_added"`
+		MessageType         string `json:"message_type"`
+		SnapshotID          string `json:"snapshot_id"`
+		FilesNew            int    `json:"files_new"`
+		FilesChanged        int    `json:"files_changed"`
+		DataAdded           int64  `json:"data_added"`
+		DataAddedPacked     int64  `json:"data_added_packed"`
+		TotalBytesProcessed int64  `json:"total_bytes_processed"`
 	}
 
 	lines := bytes.Split(output, []byte("\n"))
@@ -791,11 +1224,21 @@ func parseBackupOutput(output []byte) (*BackupStats, error) {
 		}
 
 		if msg.MessageType == "summary" {
+			// data_added_packed (restic 0.17+) is what was actually
+			// uploaded; older versions only report data_added.
+			uploaded := msg.DataAddedPacked
+			if uploaded == 0 {
+				uploaded = msg.DataAdded
+			}
 			return &BackupStats{
 				SnapshotID:   msg.SnapshotID,
 				FilesNew:     msg.FilesNew,
 				FilesChanged: msg.FilesChanged,
 				SizeBytes:    msg.DataAdded,
+				Transfer: TransferStats{
+					BytesProcessed: msg.TotalBytesProcessed,
+					BytesUploaded:  uploaded,
+				},
 			}, nil
 		}
 	}
@@ -803,6 +1246,57 @@ func parseBackupOutput(output []byte) (*BackupStats, error) {
 	return nil, errors.New("no summary message found in backup output")
 }
 
+// parsePruneOutput extracts the repack, prune and remaining sizes from
+// restic prune's plan, e.g. "total prune:  74 blobs / 1.072 MiB".
+func parsePruneOutput(output []byte) *PruneEstimate {
+	estimate := &PruneEstimate{}
+	for _, line := range strings.Split(string(output), "\n") {
+		label, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		_, size, ok := strings.Cut(value, "/")
+		if !ok {
+			continue
+		}
+		bytes := parseResticSize(size)
+		switch strings.TrimSpace(label) {
+		case "to repack":
+			estimate.RepackBytes = bytes
+		case "total prune":
+			estimate.ReclaimBytes = bytes
+		case "remaining":
+			estimate.RemainingBytes = bytes
+		}
+	}
+	return estimate
+}
+
+// parseResticSize parses a size as formatted by restic, such as "1.072 MiB".
+// Unparseable sizes are reported as zero.
+func parseResticSize(s string) int64 {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	units := map[string]float64{
+		"B":   1,
+		"KiB": 1 << 10,
+		"MiB": 1 << 20,
+		"GiB": 1 << 30,
+		"TiB": 1 << 40,
+	}
+	unit, ok := units[fields[1]]
+	if !ok {
+		return 0
+	}
+	return int64(value * unit)
+}
+
 // parseForgetOutput parses the JSON output from a restic forget command.
 func parseForgetOutput(output []byte) (*ForgetResult, error) {
 	if len(bytes.TrimSpace(output)) == 0 {
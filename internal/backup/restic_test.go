@@ -3,9 +3,11 @@ package backup
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -280,6 +282,125 @@ func TestRestic_BackupWithOptions(t *testing.T) {
 			t.Fatalf("BackupWithOptions() error = %v", err)
 		}
 	})
+
+	t.Run("with path mounts", func(t *testing.T) {
+		if os.Geteuid() != 0 {
+			t.Skip("mount namespaces require root")
+		}
+		if _, err := exec.LookPath("unshare"); err != nil {
+			t.Skip("unshare not installed")
+		}
+
+		target, source := t.TempDir(), t.TempDir()
+		os.WriteFile(filepath.Join(target, "marker"), []byte("live"), 0644)
+		os.WriteFile(filepath.Join(source, "marker"), []byte("snapshot"), 0644)
+
+		// The fake restic reports the marker it sees at the original path.
+		script := filepath.Join(t.TempDir(), "restic")
+		content := fmt.Sprintf("#!/bin/sh\nprintf '{\"message_type\":\"summary\",\"snapshot_id\":\"%%s\"}' \"$(cat %s/marker)\"\n", target)
+		if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+		r := NewResticWithBinary(script, zerolog.Nop())
+
+		opts := &BackupOptions{PathMounts: map[string]string{target: source}}
+		stats, err := r.BackupWithOptions(context.Background(), testResticConfig(), []string{target}, nil, nil, opts)
+		if err != nil {
+			t.Fatalf("BackupWithOptions() error = %v", err)
+		}
+		if stats.SnapshotID != "snapshot" {
+			t.Errorf("restic read %q at the original path, want the snapshot", stats.SnapshotID)
+		}
+		if got, _ := os.ReadFile(filepath.Join(target, "marker")); string(got) != "live" {
+			t.Errorf("mount leaked out of the namespace: marker = %q", got)
+		}
+	})
+}
+
+func TestNamespaceCommand(t *testing.T) {
+	name, args := namespaceCommand(map[string]string{
+		"/srv/www": "/run/snap/lvm-0/www",
+		"/srv":     "/run/snap/lvm-1",
+	}, "restic", []string{"backup", "/srv"})
+
+	if name != "unshare" {
+		t.Errorf("name = %q, want unshare", name)
+	}
+	want := []string{"--mount", "--propagation", "private", "--", "/bin/sh", "-c", namespaceScript, "keldris-snapshot",
+		"/srv", "/run/snap/lvm-1", "/srv/www", "/run/snap/lvm-0/www", "--", "restic", "backup", "/srv"}
+	if strings.Join(args, "\x00") != strings.Join(want, "\x00") {
+		t.Errorf("args = %q, want %q", args, want)
+	}
+}
+
+// failingReader returns its data and then an error instead of EOF.
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestRestic_BackupStdin(t *testing.T) {
+	// The fake restic stores its arguments and input, and only reports a
+	// snapshot once its input has ended.
+	dir := t.TempDir()
+	script := filepath.Join(dir, "restic")
+	content := fmt.Sprintf(`#!/bin/sh
+echo "$@" > %[1]s/args
+cat > %[1]s/input
+echo '{"message_type":"summary","snapshot_id":"stdin1","files_new":1,"data_added":5}'
+`, dir)
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	r := NewResticWithBinary(script, zerolog.Nop())
+
+	t.Run("streams input", func(t *testing.T) {
+		stats, err := r.BackupStdin(context.Background(), testResticConfig(), "db.sql", strings.NewReader("dump"), []string{"database:postgres"}, nil)
+		if err != nil {
+			t.Fatalf("BackupStdin() error = %v", err)
+		}
+		if stats.SnapshotID != "stdin1" {
+			t.Errorf("SnapshotID = %v, want stdin1", stats.SnapshotID)
+		}
+		args, _ := os.ReadFile(filepath.Join(dir, "args"))
+		if !strings.Contains(string(args), "--stdin --stdin-filename db.sql --tag database:postgres") {
+			t.Errorf("args = %q", args)
+		}
+		input, _ := os.ReadFile(filepath.Join(dir, "input"))
+		if string(input) != "dump" {
+			t.Errorf("input = %q, want dump", input)
+		}
+		// sha256 of "dump"
+		if stats.StdinBytes != 4 || stats.StdinSHA256 != "b6ca0868bca6a2926b70aa1a71592038d9030fe26d4214edcfbd6cf41f2f4654" {
+			t.Errorf("StdinBytes = %d, StdinSHA256 = %s", stats.StdinBytes, stats.StdinSHA256)
+		}
+	})
+
+	t.Run("read error stops restic", func(t *testing.T) {
+		readErr := errors.New("dump exited with code 1")
+		stats, err := r.BackupStdin(context.Background(), testResticConfig(), "db.sql", &failingReader{data: []byte("partial"), err: readErr}, nil, nil)
+		if !errors.Is(err, readErr) {
+			t.Fatalf("BackupStdin() error = %v, want %v", err, readErr)
+		}
+		if stats != nil && stats.SnapshotID != "" {
+			t.Errorf("snapshot %s created from partial input", stats.SnapshotID)
+		}
+	})
+
+	t.Run("filename required", func(t *testing.T) {
+		if _, err := r.BackupStdin(context.Background(), testResticConfig(), "", strings.NewReader("dump"), nil, nil); err == nil {
+			t.Error("expected error")
+		}
+	})
 }
 
 func TestRestic_Snapshots(t *testing.T) {
@@ -933,6 +1054,68 @@ echo "$RESTIC_PASSWORD|$AWS_ACCESS_KEY_ID"
 	}
 }
 
+func TestRestic_InitWithChunkerParams_Env(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("skipping in CI - needs test binary re-invocation")
+	}
+
+	// Record the arguments and the credentials restic would see.
+	outFile := filepath.Join(t.TempDir(), "out")
+	script := `#!/bin/sh
+echo "$*|$RESTIC_FROM_PASSWORD|$AWS_ACCESS_KEY_ID|$B2_ACCOUNT_ID|$RESTIC2_B2_ACCOUNT_ID" > ` + outFile + `
+`
+	scriptFile := filepath.Join(t.TempDir(), "restic.sh")
+	if err := os.WriteFile(scriptFile, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewResticWithBinary(scriptFile, zerolog.Nop())
+	target := ResticConfig{
+		Repository: "s3:s3.amazonaws.com/target",
+		Password:   "target-secret",
+		Env:        map[string]string{"AWS_ACCESS_KEY_ID": "target-key"},
+	}
+	run := func(t *testing.T, source ResticConfig) string {
+		t.Helper()
+		if err := r.InitWithChunkerParams(context.Background(), target, source); err != nil {
+			t.Fatalf("InitWithChunkerParams() error = %v", err)
+		}
+		out, err := os.ReadFile(outFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	t.Run("source credentials are passed unprefixed", func(t *testing.T) {
+		out := run(t, ResticConfig{
+			Repository: "b2:source-bucket",
+			Password:   "source-secret",
+			Env:        map[string]string{"B2_ACCOUNT_ID": "source-account"},
+		})
+		if !strings.Contains(out, "--copy-chunker-params") {
+			t.Errorf("expected chunker parameters to be copied, got: %v", out)
+		}
+		if !strings.HasSuffix(out, "|source-secret|target-key|source-account|") {
+			t.Errorf("expected source credentials in restic's environment, got: %v", out)
+		}
+	})
+
+	t.Run("conflicting credentials fall back to plain init", func(t *testing.T) {
+		out := run(t, ResticConfig{
+			Repository: "s3:s3.amazonaws.com/source",
+			Password:   "source-secret",
+			Env:        map[string]string{"AWS_ACCESS_KEY_ID": "source-key"},
+		})
+		if strings.Contains(out, "--from-repo") || strings.Contains(out, "--copy-chunker-params") {
+			t.Errorf("expected a plain init, got: %v", out)
+		}
+		if !strings.Contains(out, "|target-key|") {
+			t.Errorf("expected target credentials only, got: %v", out)
+		}
+	})
+}
+
 // Verify exec.Command properly handles a non-existent binary.
 func TestRestic_Run_BinaryNotFound(t *testing.T) {
 	r := NewResticWithBinary("/nonexistent/restic", zerolog.Nop())
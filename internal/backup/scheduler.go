@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/MacJediWizard/keldris/internal/backup/apps"
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/backup/fssnapshot"
 	"github.com/MacJediWizard/keldris/internal/backup/vms"
 	"github.com/MacJediWizard/keldris/internal/license"
 	"github.com/MacJediWizard/keldris/internal/maintenance"
@@ -52,6 +54,15 @@ type ScheduleStore interface {
 	// GetProxmoxConnectionByID returns a Proxmox connection by ID.
 	GetProxmoxConnectionByID(ctx context.Context, id uuid.UUID) (*models.ProxmoxConnection, error)
 
+	// GetPBSConnectionByID returns a Proxmox Backup Server connection by ID.
+	GetPBSConnectionByID(ctx context.Context, id uuid.UUID) (*models.PBSConnection, error)
+
+	// GetRepositoryTransferSettings returns a repository's transfer settings, or nil if it has none.
+	GetRepositoryTransferSettings(ctx context.Context, repositoryID uuid.UUID) (*models.RepositoryTransferSettings, error)
+
+	// CreateBackupTransferMetrics records the transfer metrics of a backup run.
+	CreateBackupTransferMetrics(ctx context.Context, m *models.BackupTransferMetrics) error
+
 	// Checkpoint methods for resumable backups
 	CheckpointStore
 
@@ -80,6 +91,21 @@ type SchedulerConfig struct {
 
 	// DecryptFunc decrypts the repository configuration.
 	DecryptFunc DecryptFunc
+
+	// DatabaseStreamer streams the dumps of postgres and mysql schedules
+	// into their repository. Nil fails those schedules.
+	DatabaseStreamer DatabaseStreamer
+}
+
+// DatabaseStreamer dumps the database server of a postgres or mysql
+// schedule straight into a repository, without writing dump files. It is
+// implemented outside this package by the database dumpers.
+type DatabaseStreamer interface {
+	// StreamScheduleBackup dumps the schedule's databases, one snapshot
+	// each, and returns the stats of every snapshot it created. A failed
+	// dump does not stop the others; their stats are returned alongside
+	// the error.
+	StreamScheduleBackup(ctx context.Context, schedule models.Schedule, orgID uuid.UUID, restic *Restic, cfg ResticConfig, tags []string) ([]*BackupStats, error)
 }
 
 // DefaultSchedulerConfig returns a SchedulerConfig with sensible defaults.
@@ -100,10 +126,12 @@ type Scheduler struct {
 	store              ScheduleStore
 	restic             *Restic
 	config             SchedulerConfig
+	repoConfigs        *RepositoryConfigResolver
 	notifier           *notifications.Service
 	maintenance        *maintenance.Service
 	checkpointManager  *CheckpointManager
 	largeFileScanner   *LargeFileScanner
+	snapshots          *fssnapshot.Manager
 	concurrencyManager *ConcurrencyManager
 	validator          *BackupValidator
 	validationConfig   ValidationConfig
@@ -131,9 +159,11 @@ func NewScheduler(store ScheduleStore, restic *Restic, config SchedulerConfig, n
 		store:             store,
 		restic:            restic,
 		config:            config,
+		repoConfigs:       NewRepositoryConfigResolver(store, config.DecryptFunc, config.PasswordFunc),
 		notifier:          notifier,
 		checkpointManager: checkpointManager,
 		largeFileScanner:  NewLargeFileScanner(logger),
+		snapshots:         fssnapshot.NewManager(logger),
 		cron:              cron.New(cron.WithSeconds()),
 		logger:            logger.With().Str("component", "scheduler").Logger(),
 		entries:           make(map[uuid.UUID]cron.EntryID),
@@ -357,6 +387,20 @@ func (s *Scheduler) executeBackup(schedule models.Schedule) {
 		Str("schedule_name", schedule.Name).
 		Logger()
 
+	// Kubernetes workload backups run on the schedule's agent inside the
+	// cluster, which reports them like any other agent backup.
+	if schedule.IsKubernetesBackup() {
+		logger.Debug().Msg("Kubernetes backups run on the schedule's agent")
+		return
+	}
+
+	// libvirt backups run on the schedule's agent on the KVM host, which
+	// reads the disk images and talks to its own libvirt daemon.
+	if schedule.IsLibvirtBackup() {
+		logger.Debug().Msg("libvirt backups run on the schedule's agent")
+		return
+	}
+
 	// Check if backup can run at current time based on time window and excluded hours
 	now := time.Now()
 	if !schedule.CanRunAt(now) {
@@ -457,6 +501,12 @@ func (s *Scheduler) executeBackup(schedule models.Schedule) {
 		return
 	}
 
+	// Handle PostgreSQL and MySQL dumps
+	if schedule.IsPostgresBackup() || schedule.IsMySQLBackup() {
+		s.executeDatabaseBackup(ctx, schedule, logger)
+		return
+	}
+
 	// Get enabled repositories sorted by priority
 	enabledRepos := schedule.GetEnabledRepositories()
 	if len(enabledRepos) == 0 {
@@ -659,27 +709,58 @@ func (s *Scheduler) runBackupToRepo(
 	// Build restic config
 	resticCfg := backend.ToResticConfig(password)
 
+	// Apply the repository's transfer tuning. The schedule's bandwidth limit
+	// takes precedence over the repository's upload limit.
+	transfer, err := s.store.GetRepositoryTransferSettings(ctx, repo.ID)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to load repository transfer settings")
+	}
+	resticCfg.Options = backends.TransferOptions(repo.Type, transfer, schedule.BandwidthLimitKB)
+	if schedule.BandwidthLimitKB != nil {
+		logger.Debug().Int("bandwidth_limit_kb", *schedule.BandwidthLimitKB).Msg("bandwidth limit applied")
+	}
+
 	// Build tags
 	tags := []string{
 		fmt.Sprintf("schedule:%s", schedule.ID.String()),
 		fmt.Sprintf("agent:%s", schedule.AgentID.String()),
 	}
 
-	// Build backup options with bandwidth limit and compression
+	// Build backup options with compression and read concurrency
 	var opts *BackupOptions
-	if schedule.BandwidthLimitKB != nil || (schedule.CompressionLevel != nil && *schedule.CompressionLevel != "") {
-		opts = &BackupOptions{}
-		if schedule.BandwidthLimitKB != nil {
-			opts.BandwidthLimitKB = schedule.BandwidthLimitKB
-			logger.Debug().Int("bandwidth_limit_kb", *schedule.BandwidthLimitKB).Msg("bandwidth limit applied")
+	if schedule.CompressionLevel != nil && *schedule.CompressionLevel != "" {
+		opts = &BackupOptions{CompressionLevel: schedule.CompressionLevel}
+	}
+	if transfer != nil && transfer.ReadConcurrency != nil {
+		if opts == nil {
+			opts = &BackupOptions{}
+		}
+		opts.ReadConcurrency = transfer.ReadConcurrency
+	}
+
+	// Read the paths from filesystem snapshots when the schedule asks for
+	// crash-consistent backups
+	if schedule.FilesystemSnapshot.Enabled() {
+		required := schedule.FilesystemSnapshot == models.FilesystemSnapshotRequired
+		session, err := s.snapshots.Snapshot(ctx, schedule.Paths, required)
+		if err != nil {
+			s.failBackup(ctx, backup, fmt.Sprintf("filesystem snapshot: %v", err), logger)
+			return backup, nil, resticCfg, fmt.Errorf("filesystem snapshot: %w", err)
 		}
-		if schedule.CompressionLevel != nil && *schedule.CompressionLevel != "" {
-			opts.CompressionLevel = schedule.CompressionLevel
+		defer session.Close()
+		if len(session.Paths) > 0 {
+			if opts == nil {
+				opts = &BackupOptions{}
+			}
+			opts.PathMounts = session.Paths
 		}
 	}
 
 	// Run the backup with options
 	stats, err := s.restic.BackupWithOptions(ctx, resticCfg, schedule.Paths, schedule.Excludes, tags, opts)
+	if stats != nil {
+		s.recordTransferMetrics(ctx, repo, backup, stats, err != nil, logger)
+	}
 	if err != nil {
 		s.failBackup(ctx, backup, fmt.Sprintf("backup failed: %v", err), logger)
 		return backup, nil, resticCfg, fmt.Errorf("backup failed: %w", err)
@@ -694,6 +775,30 @@ func (s *Scheduler) runBackupToRepo(
 	return backup, stats, resticCfg, nil
 }
 
+// recordTransferMetrics stores how a backup run used the repository backend.
+func (s *Scheduler) recordTransferMetrics(ctx context.Context, repo *models.Repository, backup *models.Backup, stats *BackupStats, failed bool, logger zerolog.Logger) {
+	metrics := &models.BackupTransferMetrics{
+		ID:                uuid.New(),
+		OrgID:             repo.OrgID,
+		RepositoryID:      repo.ID,
+		BackupID:          backup.ID,
+		BytesProcessed:    stats.Transfer.BytesProcessed,
+		BytesUploaded:     stats.Transfer.BytesUploaded,
+		DurationMs:        stats.Duration.Milliseconds(),
+		OpenDurationMs:    stats.Transfer.OpenDuration.Milliseconds(),
+		UploadBytesPerSec: stats.Transfer.UploadBytesPerSecond(stats.Duration),
+		Retries:           stats.Transfer.Retries,
+		RetryWaitMs:       stats.Transfer.RetryWait.Milliseconds(),
+		BackendErrors:     stats.Transfer.BackendErrors,
+		FileErrors:        stats.Transfer.FileErrors,
+		Failed:            failed,
+		RecordedAt:        time.Now(),
+	}
+	if err := s.store.CreateBackupTransferMetrics(ctx, metrics); err != nil {
+		logger.Warn().Err(err).Msg("failed to record transfer metrics")
+	}
+}
+
 // failBackup marks a backup as failed and updates the record.
 func (s *Scheduler) failBackup(ctx context.Context, backup *models.Backup, errMsg string, logger zerolog.Logger) {
 	backup.Fail(errMsg)
@@ -967,6 +1072,11 @@ func (s *Scheduler) executeProxmoxBackup(ctx context.Context, schedule models.Sc
 		return
 	}
 
+	if opts.Source == models.ProxmoxSourcePBS {
+		s.executePBSPull(ctx, schedule, backup, primaryRepo.RepositoryID, logger)
+		return
+	}
+
 	// Get the Proxmox connection
 	if opts.ConnectionID == "" {
 		s.failBackup(ctx, backup, "no Proxmox connection ID configured", logger)
@@ -1092,6 +1202,183 @@ func (s *Scheduler) executeProxmoxBackup(ctx context.Context, schedule models.Sc
 	s.sendBackupNotification(ctx, schedule, backup, true, "")
 }
 
+// executePBSPull pulls the Proxmox Backup Server snapshots selected by the
+// schedule into the primary repository. Snapshots stored by earlier runs
+// are skipped, so each run only transfers new ones.
+func (s *Scheduler) executePBSPull(ctx context.Context, schedule models.Schedule, backup *models.Backup, repoID uuid.UUID, logger zerolog.Logger) {
+	opts := schedule.ProxmoxOptions.PBS
+	if opts == nil || opts.ConnectionID == "" {
+		s.failBackup(ctx, backup, "no PBS connection ID configured", logger)
+		return
+	}
+
+	connID, err := uuid.Parse(opts.ConnectionID)
+	if err != nil {
+		s.failBackup(ctx, backup, fmt.Sprintf("invalid PBS connection ID: %v", err), logger)
+		return
+	}
+
+	conn, err := s.store.GetPBSConnectionByID(ctx, connID)
+	if err != nil {
+		s.failBackup(ctx, backup, fmt.Sprintf("get PBS connection: %v", err), logger)
+		return
+	}
+
+	if !conn.Enabled {
+		s.failBackup(ctx, backup, "PBS connection is disabled", logger)
+		return
+	}
+
+	if s.config.DecryptFunc == nil || s.config.PasswordFunc == nil {
+		s.failBackup(ctx, backup, "decrypt or password function not configured", logger)
+		return
+	}
+
+	tokenSecretBytes, err := s.config.DecryptFunc(conn.TokenSecretEncrypted)
+	if err != nil {
+		s.failBackup(ctx, backup, fmt.Sprintf("decrypt token secret: %v", err), logger)
+		return
+	}
+
+	_, resticCfg, err := s.repoConfigs.Resolve(ctx, repoID)
+	if err != nil {
+		s.failBackup(ctx, backup, err.Error(), logger)
+		return
+	}
+
+	pullOpts := PBSPullOptions{
+		Datastore:    opts.Datastore,
+		Namespace:    opts.Namespace,
+		BackupType:   opts.BackupType,
+		BackupIDs:    opts.BackupIDs,
+		LatestOnly:   opts.LatestOnly,
+		VerifiedOnly: opts.VerifiedOnly,
+		Tags: []string{
+			"proxmox",
+			fmt.Sprintf("schedule:%s", schedule.ID.String()),
+		},
+	}
+	if pullOpts.Datastore == "" {
+		pullOpts.Datastore = conn.Datastore
+	}
+	if pullOpts.Namespace == "" {
+		pullOpts.Namespace = conn.Namespace
+	}
+	if schedule.CompressionLevel != nil {
+		pullOpts.Backup = &BackupOptions{CompressionLevel: schedule.CompressionLevel}
+	}
+
+	client := vms.NewPBSClientFromConnection(conn, string(tokenSecretBytes), logger)
+	result, err := NewPBSPuller(s.restic, logger).Pull(ctx, client, resticCfg, pullOpts)
+	if err != nil {
+		s.failBackup(ctx, backup, fmt.Sprintf("PBS pull failed: %v", err), logger)
+		return
+	}
+
+	logger.Info().
+		Str("datastore", pullOpts.Datastore).
+		Int("archives", len(result.Archives)).
+		Int("skipped", result.Skipped).
+		Int("unchanged", result.Unchanged).
+		Int64("total_size", result.BytesTotal).
+		Msg("PBS pull completed successfully")
+
+	var snapshotID string
+	if n := len(result.Archives); n > 0 {
+		snapshotID = result.Archives[n-1].SnapshotID
+	}
+	backup.Complete(snapshotID, len(result.Archives), 0, result.BytesTotal)
+	if err := s.store.UpdateBackup(ctx, backup); err != nil {
+		logger.Error().Err(err).Msg("failed to update Proxmox backup record")
+	}
+
+	s.sendBackupNotification(ctx, schedule, backup, true, "")
+}
+
+// executeDatabaseBackup streams a postgres or mysql schedule's dumps into
+// its primary repository through the configured DatabaseStreamer.
+func (s *Scheduler) executeDatabaseBackup(ctx context.Context, schedule models.Schedule, logger zerolog.Logger) {
+	logger.Info().Str("backup_type", string(schedule.BackupType)).Msg("executing database backup")
+
+	enabledRepos := schedule.GetEnabledRepositories()
+	if len(enabledRepos) == 0 {
+		logger.Error().Msg("no enabled repositories for database backup")
+		return
+	}
+
+	primaryRepo := &enabledRepos[0]
+	backup := models.NewBackup(schedule.ID, schedule.AgentID, &primaryRepo.RepositoryID)
+	backup.BackupType = schedule.BackupType
+	if err := s.store.CreateBackup(ctx, backup); err != nil {
+		logger.Error().Err(err).Msg("failed to create database backup record")
+		return
+	}
+
+	if s.config.DatabaseStreamer == nil {
+		s.failBackup(ctx, backup, "database streamer not configured", logger)
+		return
+	}
+
+	agent, err := s.store.GetAgentByID(ctx, schedule.AgentID)
+	if err != nil {
+		s.failBackup(ctx, backup, fmt.Sprintf("get agent: %v", err), logger)
+		return
+	}
+
+	_, resticCfg, err := s.repoConfigs.Resolve(ctx, primaryRepo.RepositoryID)
+	if err != nil {
+		s.failBackup(ctx, backup, err.Error(), logger)
+		return
+	}
+
+	tags := []string{fmt.Sprintf("schedule:%s", schedule.ID.String())}
+	results, err := s.config.DatabaseStreamer.StreamScheduleBackup(ctx, schedule, agent.OrgID, s.restic, resticCfg, tags)
+	if err == nil && len(results) == 0 {
+		err = errors.New("no databases were dumped")
+	}
+
+	// Each dump is its own snapshot. The first one completes this backup
+	// record and every other one gets a record of its own, so no snapshot
+	// is missing from the backup history, even when another dump failed.
+	for i, stats := range results {
+		if i == 0 && err == nil {
+			continue
+		}
+		s.recordDatabaseSnapshot(ctx, schedule, primaryRepo.RepositoryID, stats, logger)
+	}
+
+	if err != nil {
+		s.failBackup(ctx, backup, fmt.Sprintf("database backup failed: %v", err), logger)
+		s.sendBackupNotification(ctx, schedule, backup, false, err.Error())
+		return
+	}
+
+	stats := results[0]
+	logger.Info().
+		Str("snapshot_id", stats.SnapshotID).
+		Int64("size_bytes", stats.SizeBytes).
+		Int("snapshots", len(results)).
+		Msg("database backup completed successfully")
+
+	backup.Complete(stats.SnapshotID, stats.FilesNew, stats.FilesChanged, stats.SizeBytes)
+	if err := s.store.UpdateBackup(ctx, backup); err != nil {
+		logger.Error().Err(err).Msg("failed to update database backup record")
+	}
+
+	s.sendBackupNotification(ctx, schedule, backup, true, "")
+}
+
+// recordDatabaseSnapshot adds a completed backup record for a database
+// snapshot beyond the first of a schedule run.
+func (s *Scheduler) recordDatabaseSnapshot(ctx context.Context, schedule models.Schedule, repositoryID uuid.UUID, stats *BackupStats, logger zerolog.Logger) {
+	record := models.NewBackup(schedule.ID, schedule.AgentID, &repositoryID)
+	record.BackupType = schedule.BackupType
+	record.Complete(stats.SnapshotID, stats.FilesNew, stats.FilesChanged, stats.SizeBytes)
+	if err := s.store.CreateBackup(ctx, record); err != nil {
+		logger.Error().Err(err).Str("snapshot_id", stats.SnapshotID).Msg("failed to record database snapshot")
+	}
+}
+
 // runBackupValidation runs automated validation after a successful backup.
 func (s *Scheduler) runBackupValidation(ctx context.Context, backup *models.Backup, resticCfg ResticConfig, sourcePaths []string, logger zerolog.Logger) {
 	if s.validator == nil {
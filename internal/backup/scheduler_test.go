@@ -3,6 +3,9 @@ package backup
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -56,6 +59,8 @@ type mockStore struct {
 	updateErr         error
 	scriptErr         error
 	replicationStatus *models.ReplicationStatus
+	transfer          map[uuid.UUID]*models.RepositoryTransferSettings
+	transferMetrics   []*models.BackupTransferMetrics
 }
 
 func newMockStore() *mockStore {
@@ -139,6 +144,23 @@ func (m *mockStore) GetProxmoxConnectionByID(_ context.Context, _ uuid.UUID) (*m
 	return nil, errors.New("proxmox connection not found")
 }
 
+func (m *mockStore) GetPBSConnectionByID(_ context.Context, _ uuid.UUID) (*models.PBSConnection, error) {
+	return nil, errors.New("PBS connection not found")
+}
+
+func (m *mockStore) GetRepositoryTransferSettings(_ context.Context, repositoryID uuid.UUID) (*models.RepositoryTransferSettings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.transfer[repositoryID], nil
+}
+
+func (m *mockStore) CreateBackupTransferMetrics(_ context.Context, metrics *models.BackupTransferMetrics) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transferMetrics = append(m.transferMetrics, metrics)
+	return nil
+}
+
 func (m *mockStore) GetEnabledBackupScriptsByScheduleID(ctx context.Context, scheduleID uuid.UUID) ([]*models.BackupScript, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -1167,6 +1189,38 @@ func TestScheduler_ExecuteBackup_NoEnabledRepos(t *testing.T) {
 	scheduler.executeBackup(schedule)
 }
 
+func TestScheduler_ExecuteBackup_KubernetesRunsOnAgent(t *testing.T) {
+	store := newMockStore()
+	logger := zerolog.Nop()
+	scheduler := NewScheduler(store, NewRestic(logger), DefaultSchedulerConfig(), nil, logger)
+
+	schedule := models.NewKubernetesSchedule(uuid.New(), "cluster", "0 0 * * * *", nil)
+	schedule.Enabled = true
+	schedule.Repositories = []models.ScheduleRepository{{RepositoryID: uuid.New(), Enabled: true}}
+
+	scheduler.executeBackup(*schedule)
+
+	if len(store.backups) != 0 {
+		t.Errorf("server created %d backups, want none: the agent runs Kubernetes schedules", len(store.backups))
+	}
+}
+
+func TestScheduler_ExecuteBackup_LibvirtRunsOnAgent(t *testing.T) {
+	store := newMockStore()
+	logger := zerolog.Nop()
+	scheduler := NewScheduler(store, NewRestic(logger), DefaultSchedulerConfig(), nil, logger)
+
+	schedule := models.NewLibvirtSchedule(uuid.New(), "kvm", "0 0 * * * *", nil)
+	schedule.Enabled = true
+	schedule.Repositories = []models.ScheduleRepository{{RepositoryID: uuid.New(), Enabled: true}}
+
+	scheduler.executeBackup(*schedule)
+
+	if len(store.backups) != 0 {
+		t.Errorf("server created %d backups, want none: the agent runs libvirt schedules", len(store.backups))
+	}
+}
+
 func TestScheduler_ExecuteBackup_OutsideTimeWindow(t *testing.T) {
 	store := newMockStore()
 	logger := zerolog.Nop()
@@ -2195,6 +2249,80 @@ func TestScheduler_RunBackupToRepo_WithBandwidthLimit(t *testing.T) {
 	}
 }
 
+func TestScheduler_RunBackupToRepo_TransferSettings(t *testing.T) {
+	store := newMockStore()
+	repoID := uuid.New()
+	orgID := uuid.New()
+	store.repos[repoID] = &models.Repository{
+		ID:              repoID,
+		OrgID:           orgID,
+		Name:            "test-repo",
+		Type:            models.RepositoryTypeLocal,
+		ConfigEncrypted: []byte("encrypted"),
+	}
+	download, readConcurrency := 2048, 4
+	store.transfer = map[uuid.UUID]*models.RepositoryTransferSettings{
+		repoID: {RepositoryID: repoID, DownloadLimitKB: &download, ReadConcurrency: &readConcurrency},
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "restic")
+	body := `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args.log"
+echo '{"message_type":"summary","snapshot_id":"abc123","data_added":1024,"data_added_packed":512,"total_bytes_processed":4096}'
+echo 'Save(<data/4d0f6c48>) returned error, retrying after 552ms: connection reset' >&2
+`
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultSchedulerConfig()
+	config.DecryptFunc = func(encrypted []byte) ([]byte, error) {
+		return []byte(`{"path":"/tmp/repo"}`), nil
+	}
+	config.PasswordFunc = func(repoID uuid.UUID) (string, error) {
+		return "test-password", nil
+	}
+	logger := zerolog.Nop()
+	scheduler := NewScheduler(store, NewResticWithBinary(script, logger), config, nil, logger)
+
+	bwLimit := 512
+	schedule := models.Schedule{ID: uuid.New(), AgentID: uuid.New(), Name: "Test", Paths: []string{"/data"}, BandwidthLimitKB: &bwLimit}
+	schedRepo := &models.ScheduleRepository{ID: uuid.New(), RepositoryID: repoID, Enabled: true}
+
+	backup, _, cfg, err := scheduler.runBackupToRepo(context.Background(), schedule, schedRepo, nil, 1, logger)
+	if err != nil {
+		t.Fatalf("runBackupToRepo() error = %v", err)
+	}
+
+	args, err := os.ReadFile(filepath.Join(dir, "args.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"--limit-upload=512", "--limit-download=2048", "--read-concurrency 4"} {
+		if !strings.Contains(string(args), want) {
+			t.Errorf("restic args %q missing %q", args, want)
+		}
+	}
+	if strings.Count(string(args), "--limit-upload") != 1 {
+		t.Errorf("upload limit should be passed once, got %q", args)
+	}
+	if len(cfg.Options) != 2 {
+		t.Errorf("returned config options = %v", cfg.Options)
+	}
+
+	if len(store.transferMetrics) != 1 {
+		t.Fatalf("expected 1 transfer metrics record, got %d", len(store.transferMetrics))
+	}
+	m := store.transferMetrics[0]
+	if m.OrgID != orgID || m.BackupID != backup.ID || m.Failed {
+		t.Errorf("metrics = %+v", m)
+	}
+	if m.BytesUploaded != 512 || m.BytesProcessed != 4096 || m.Retries != 1 || m.BackendErrors != 1 {
+		t.Errorf("metrics = %+v", m)
+	}
+}
+
 func TestScheduler_ExecuteBackup_PreScriptFailure(t *testing.T) {
 	store := newMockStore()
 	agentID := uuid.New()
@@ -2445,3 +2573,157 @@ func containsSubstr(s, substr string) bool {
 	}
 	return false
 }
+
+type fakeDatabaseStreamer struct {
+	schedule models.Schedule
+	orgID    uuid.UUID
+	cfg      ResticConfig
+	results  []*BackupStats
+	err      error
+}
+
+func (f *fakeDatabaseStreamer) StreamScheduleBackup(_ context.Context, schedule models.Schedule, orgID uuid.UUID, _ *Restic, cfg ResticConfig, _ []string) ([]*BackupStats, error) {
+	f.schedule = schedule
+	f.orgID = orgID
+	f.cfg = cfg
+	if f.results == nil && f.err == nil {
+		return []*BackupStats{{SnapshotID: "db123", SizeBytes: 2048}}, nil
+	}
+	return f.results, f.err
+}
+
+func TestScheduler_ExecuteBackup_DatabaseStreamsDump(t *testing.T) {
+	store := newMockStore()
+	repoID := uuid.New()
+	agentID := uuid.New()
+	orgID := uuid.New()
+	store.repos[repoID] = &models.Repository{
+		ID:              repoID,
+		Type:            models.RepositoryTypeLocal,
+		ConfigEncrypted: []byte("encrypted"),
+	}
+	store.agents[agentID] = &models.Agent{ID: agentID, OrgID: orgID}
+
+	streamer := &fakeDatabaseStreamer{}
+	config := DefaultSchedulerConfig()
+	config.DecryptFunc = func(encrypted []byte) ([]byte, error) {
+		return []byte(`{"path":"/tmp/repo"}`), nil
+	}
+	config.PasswordFunc = func(repoID uuid.UUID) (string, error) {
+		return "test-password", nil
+	}
+	config.DatabaseStreamer = streamer
+
+	scheduler := NewScheduler(store, NewRestic(zerolog.Nop()), config, nil, zerolog.Nop())
+
+	schedule := models.Schedule{
+		ID:             uuid.New(),
+		AgentID:        agentID,
+		Name:           "Postgres",
+		BackupType:     models.BackupTypePostgres,
+		CronExpression: "0 0 * * * *",
+		PostgresConfig: &models.PostgresBackupConfig{Host: "db.internal", Username: "backup"},
+		Enabled:        true,
+		Repositories: []models.ScheduleRepository{
+			{ID: uuid.New(), RepositoryID: repoID, Priority: 0, Enabled: true},
+		},
+	}
+
+	scheduler.executeBackup(schedule)
+
+	if streamer.schedule.ID != schedule.ID || streamer.orgID != orgID {
+		t.Fatalf("streamer called with schedule %s org %s, want %s %s", streamer.schedule.ID, streamer.orgID, schedule.ID, orgID)
+	}
+	if streamer.cfg.Repository != "/tmp/repo" || streamer.cfg.Password != "test-password" {
+		t.Errorf("restic config = %+v, want the primary repository", streamer.cfg)
+	}
+	backups := store.getBackups()
+	if len(backups) != 1 {
+		t.Fatalf("got %d backup records, want 1", len(backups))
+	}
+	if backups[0].BackupType != models.BackupTypePostgres || backups[0].SnapshotID != "db123" {
+		t.Errorf("backup = %+v, want a completed postgres backup of snapshot db123", backups[0])
+	}
+}
+
+func TestScheduler_ExecuteBackup_DatabaseRecordsEverySnapshot(t *testing.T) {
+	repoID := uuid.New()
+	agentID := uuid.New()
+
+	run := func(t *testing.T, streamer *fakeDatabaseStreamer) []*models.Backup {
+		t.Helper()
+		store := newMockStore()
+		store.repos[repoID] = &models.Repository{
+			ID:              repoID,
+			Type:            models.RepositoryTypeLocal,
+			ConfigEncrypted: []byte("encrypted"),
+		}
+		store.agents[agentID] = &models.Agent{ID: agentID, OrgID: uuid.New()}
+
+		config := DefaultSchedulerConfig()
+		config.DecryptFunc = func(encrypted []byte) ([]byte, error) {
+			return []byte(`{"path":"/tmp/repo"}`), nil
+		}
+		config.PasswordFunc = func(repoID uuid.UUID) (string, error) {
+			return "test-password", nil
+		}
+		config.DatabaseStreamer = streamer
+
+		scheduler := NewScheduler(store, NewRestic(zerolog.Nop()), config, nil, zerolog.Nop())
+		scheduler.executeBackup(models.Schedule{
+			ID:             uuid.New(),
+			AgentID:        agentID,
+			Name:           "Postgres",
+			BackupType:     models.BackupTypePostgres,
+			CronExpression: "0 0 * * * *",
+			PostgresConfig: &models.PostgresBackupConfig{Host: "db.internal", Username: "backup", Databases: []string{"a", "b", "c"}},
+			Enabled:        true,
+			Repositories: []models.ScheduleRepository{
+				{ID: uuid.New(), RepositoryID: repoID, Priority: 0, Enabled: true},
+			},
+		})
+		return store.getBackups()
+	}
+
+	snapshots := func(backups []*models.Backup) map[string]models.BackupStatus {
+		got := make(map[string]models.BackupStatus)
+		for _, b := range backups {
+			got[b.SnapshotID] = b.Status
+		}
+		return got
+	}
+
+	t.Run("all dumps succeed", func(t *testing.T) {
+		backups := run(t, &fakeDatabaseStreamer{results: []*BackupStats{
+			{SnapshotID: "snap-a"}, {SnapshotID: "snap-b"}, {SnapshotID: "snap-c"},
+		}})
+		got := snapshots(backups)
+		if len(backups) != 3 {
+			t.Fatalf("got %d backup records, want 3", len(backups))
+		}
+		for _, id := range []string{"snap-a", "snap-b", "snap-c"} {
+			if got[id] != models.BackupStatusCompleted {
+				t.Errorf("snapshot %s status = %q, want completed", id, got[id])
+			}
+		}
+	})
+
+	t.Run("one dump fails", func(t *testing.T) {
+		backups := run(t, &fakeDatabaseStreamer{
+			results: []*BackupStats{{SnapshotID: "snap-a"}, {SnapshotID: "snap-c"}},
+			err:     errors.New("database b: pg_dump failed"),
+		})
+		got := snapshots(backups)
+		if len(backups) != 3 {
+			t.Fatalf("got %d backup records, want 3", len(backups))
+		}
+		if got[""] != models.BackupStatusFailed {
+			t.Errorf("run record status = %q, want failed", got[""])
+		}
+		for _, id := range []string{"snap-a", "snap-c"} {
+			if got[id] != models.BackupStatusCompleted {
+				t.Errorf("snapshot %s status = %q, want completed", id, got[id])
+			}
+		}
+	})
+}
@@ -0,0 +1,228 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ErrSnapshotPathNotFound is returned when a path does not exist in a snapshot.
+var ErrSnapshotPathNotFound = errors.New("path not found in snapshot")
+
+// ArchiveFormat is the container format for a snapshot subtree download.
+type ArchiveFormat string
+
+const (
+	// ArchiveFormatTarGz is a gzip-compressed tar archive.
+	ArchiveFormatTarGz ArchiveFormat = "tar.gz"
+	// ArchiveFormatZip is a zip archive.
+	ArchiveFormatZip ArchiveFormat = "zip"
+)
+
+// ParseArchiveFormat validates an archive format, defaulting to tar.gz.
+func ParseArchiveFormat(s string) (ArchiveFormat, error) {
+	switch ArchiveFormat(s) {
+	case "", ArchiveFormatTarGz:
+		return ArchiveFormatTarGz, nil
+	case ArchiveFormatZip:
+		return ArchiveFormatZip, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format %q: must be tar.gz or zip", s)
+	}
+}
+
+// ContentType returns the MIME type of the archive format.
+func (f ArchiveFormat) ContentType() string {
+	if f == ArchiveFormatZip {
+		return "application/zip"
+	}
+	return "application/gzip"
+}
+
+// ArchiveSize summarizes a snapshot subtree before it is downloaded.
+// Bytes is the uncompressed size of all regular files.
+type ArchiveSize struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	Dirs  int    `json:"dirs"`
+	Bytes int64  `json:"bytes"`
+}
+
+// ArchiveSize walks a snapshot subtree and totals its files and directories.
+// It returns ErrSnapshotPathNotFound if the path does not exist.
+func (r *Restic) ArchiveSize(ctx context.Context, cfg ResticConfig, snapshotID, subtree string) (*ArchiveSize, error) {
+	subtree = cleanSnapshotPath(subtree)
+
+	args := []string{"ls", "--repo", cfg.Repository, "--json", "--recursive", snapshotID, subtree}
+	output, err := r.run(ctx, cfg, args)
+	if err != nil {
+		if strings.Contains(err.Error(), "no matching ID") {
+			return nil, ErrSnapshotNotFound
+		}
+		return nil, fmt.Errorf("list subtree: %w", err)
+	}
+
+	size := &ArchiveSize{Path: subtree}
+	found := subtree == "/"
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var file SnapshotFile
+		if err := json.Unmarshal(line, &file); err != nil || file.Path == "" {
+			continue
+		}
+		if file.Path == subtree {
+			found = true
+		} else if subtree != "/" && !strings.HasPrefix(file.Path, subtree+"/") {
+			continue
+		}
+		switch file.Type {
+		case "file":
+			size.Files++
+			size.Bytes += file.Size
+		case "dir":
+			size.Dirs++
+		}
+	}
+	if !found {
+		return nil, ErrSnapshotPathNotFound
+	}
+	return size, nil
+}
+
+// WriteArchive streams a snapshot subtree to w in the given format using
+// restic dump --archive. Nothing is buffered on disk.
+func (r *Restic) WriteArchive(ctx context.Context, cfg ResticConfig, snapshotID, subtree string, format ArchiveFormat, w io.Writer) error {
+	archive := "tar"
+	if format == ArchiveFormatZip {
+		archive = "zip"
+	}
+
+	stream, err := r.Dump(ctx, cfg, snapshotID, subtree, archive)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	if format == ArchiveFormatZip {
+		_, err = io.Copy(w, stream)
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := io.Copy(gz, stream); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+// Dump starts restic dump for a path in a snapshot and returns its output
+// as a stream. An empty archive dumps a single file's contents; "tar" or
+// "zip" dumps a directory tree. Errors reported by restic surface from Read
+// once the output is exhausted. Closing the stream early stops restic.
+func (r *Restic) Dump(ctx context.Context, cfg ResticConfig, snapshotID, filePath, archive string) (io.ReadCloser, error) {
+	r.logger.Debug().
+		Str("snapshot_id", snapshotID).
+		Str("path", filePath).
+		Str("archive", archive).
+		Msg("streaming dump from snapshot")
+
+	args := []string{"dump", "--repo", cfg.Repository}
+	if archive != "" {
+		args = append(args, "--archive", archive)
+	}
+	args = append(args, snapshotID, cleanSnapshotPath(filePath))
+
+	env, cleanup, err := cfg.MaterializeEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, r.binary, cfg.CommandArgs(args)...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("RESTIC_PASSWORD=%s", cfg.Password))
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	d := &dumpStream{cmd: cmd, cleanup: cleanup}
+	cmd.Stderr = &d.stderr
+	d.stdout, err = cmd.StdoutPipe()
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("start dump: %w", err)
+	}
+	return d, nil
+}
+
+// dumpStream is the stdout of a running restic dump.
+type dumpStream struct {
+	cmd     *exec.Cmd
+	stdout  io.ReadCloser
+	stderr  bytes.Buffer
+	cleanup func()
+
+	once    sync.Once
+	waitErr error
+}
+
+func (d *dumpStream) Read(p []byte) (int, error) {
+	n, err := d.stdout.Read(p)
+	if err == io.EOF {
+		if werr := d.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (d *dumpStream) Close() error {
+	d.once.Do(func() {
+		if d.cmd.ProcessState == nil {
+			_ = d.cmd.Process.Kill()
+		}
+		_ = d.cmd.Wait()
+		d.cleanup()
+	})
+	return nil
+}
+
+func (d *dumpStream) wait() error {
+	d.once.Do(func() {
+		err := d.cmd.Wait()
+		d.cleanup()
+		if err == nil {
+			return
+		}
+		errMsg := d.stderr.String()
+		switch {
+		case strings.Contains(errMsg, "no matching ID"):
+			d.waitErr = ErrSnapshotNotFound
+		case strings.Contains(errMsg, "not found in snapshot") || strings.Contains(errMsg, "no such file"):
+			d.waitErr = ErrSnapshotPathNotFound
+		default:
+			d.waitErr = fmt.Errorf("dump failed: %w: %s", err, strings.TrimSpace(errMsg))
+		}
+	})
+	return d.waitErr
+}
+
+// cleanSnapshotPath normalizes a user supplied path to an absolute
+// snapshot path.
+func cleanSnapshotPath(p string) string {
+	return path.Clean("/" + p)
+}
@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+)
+
+// resticTreeNode is the part of a restic tree node needed to find the blobs
+// a snapshot references.
+type resticTreeNode struct {
+	Content []string `json:"content"`
+	Subtree string   `json:"subtree"`
+}
+
+// resticIndex is the part of a restic index file mapping blobs to packs.
+type resticIndex struct {
+	Packs []struct {
+		ID    string `json:"id"`
+		Blobs []struct {
+			ID string `json:"id"`
+		} `json:"blobs"`
+	} `json:"packs"`
+}
+
+// SnapshotFiles resolves the pack and index files holding the blobs of a
+// snapshot, so storage-level locks cover only what the snapshot needs.
+// It walks the snapshot's trees with one restic run per directory, so it is
+// meant for background jobs rather than request handlers.
+func (r *Restic) SnapshotFiles(ctx context.Context, cfg ResticConfig, snapshotID string) (backends.SnapshotFiles, error) {
+	output, err := r.run(ctx, cfg, []string{"cat", "snapshot", snapshotID, "--repo", cfg.Repository})
+	if err != nil {
+		return backends.SnapshotFiles{}, fmt.Errorf("read snapshot %s: %w", snapshotID, err)
+	}
+	var snapshot struct {
+		Tree string `json:"tree"`
+	}
+	if err := json.Unmarshal(output, &snapshot); err != nil {
+		return backends.SnapshotFiles{}, fmt.Errorf("parse snapshot %s: %w", snapshotID, err)
+	}
+	if snapshot.Tree == "" {
+		return backends.SnapshotFiles{}, fmt.Errorf("snapshot %s has no tree", snapshotID)
+	}
+
+	// Collect every tree and data blob reachable from the root tree.
+	needed := map[string]bool{snapshot.Tree: true}
+	trees := []string{snapshot.Tree}
+	for len(trees) > 0 {
+		tree := trees[len(trees)-1]
+		trees = trees[:len(trees)-1]
+
+		output, err := r.run(ctx, cfg, []string{"cat", "blob", tree, "--repo", cfg.Repository})
+		if err != nil {
+			return backends.SnapshotFiles{}, fmt.Errorf("read tree %s: %w", tree, err)
+		}
+		var nodes struct {
+			Nodes []resticTreeNode `json:"nodes"`
+		}
+		if err := json.Unmarshal(output, &nodes); err != nil {
+			return backends.SnapshotFiles{}, fmt.Errorf("parse tree %s: %w", tree, err)
+		}
+		for _, node := range nodes.Nodes {
+			for _, blob := range node.Content {
+				needed[blob] = true
+			}
+			if node.Subtree != "" && !needed[node.Subtree] {
+				needed[node.Subtree] = true
+				trees = append(trees, node.Subtree)
+			}
+		}
+	}
+
+	output, err = r.run(ctx, cfg, []string{"list", "index", "--repo", cfg.Repository})
+	if err != nil {
+		return backends.SnapshotFiles{}, fmt.Errorf("list index files: %w", err)
+	}
+
+	files := backends.SnapshotFiles{SnapshotID: snapshotID}
+	found := make(map[string]bool, len(needed))
+	packs := make(map[string]bool)
+	for _, indexID := range strings.Fields(string(output)) {
+		output, err := r.run(ctx, cfg, []string{"cat", "index", indexID, "--repo", cfg.Repository})
+		if err != nil {
+			return backends.SnapshotFiles{}, fmt.Errorf("read index %s: %w", indexID, err)
+		}
+		var index resticIndex
+		if err := json.Unmarshal(output, &index); err != nil {
+			return backends.SnapshotFiles{}, fmt.Errorf("parse index %s: %w", indexID, err)
+		}
+
+		used := false
+		for _, pack := range index.Packs {
+			for _, blob := range pack.Blobs {
+				if !needed[blob.ID] {
+					continue
+				}
+				found[blob.ID] = true
+				used = true
+				if !packs[pack.ID] {
+					packs[pack.ID] = true
+					files.Packs = append(files.Packs, pack.ID)
+				}
+			}
+		}
+		if used {
+			files.Indexes = append(files.Indexes, indexID)
+		}
+	}
+
+	if missing := len(needed) - len(found); missing > 0 {
+		return backends.SnapshotFiles{}, fmt.Errorf("%d blobs of snapshot %s are not in any index", missing, snapshotID)
+	}
+	return files, nil
+}
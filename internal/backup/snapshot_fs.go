@@ -0,0 +1,266 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// SnapshotFS is a read-only webdav.FileSystem backed by a restic snapshot.
+// Directory listings come from restic ls and are cached for the lifetime of
+// the SnapshotFS, which is safe because snapshots never change. File contents
+// are streamed with restic dump on first read.
+type SnapshotFS struct {
+	restic     *Restic
+	cfg        ResticConfig
+	snapshotID string
+
+	mu   sync.Mutex
+	dirs map[string][]SnapshotFile
+}
+
+var _ webdav.FileSystem = (*SnapshotFS)(nil)
+
+// NewSnapshotFS creates a read-only file system over a snapshot.
+func NewSnapshotFS(restic *Restic, cfg ResticConfig, snapshotID string) *SnapshotFS {
+	return &SnapshotFS{
+		restic:     restic,
+		cfg:        cfg,
+		snapshotID: snapshotID,
+		dirs:       make(map[string][]SnapshotFile),
+	}
+}
+
+// Mkdir always fails; snapshots are read-only.
+func (s *SnapshotFS) Mkdir(context.Context, string, os.FileMode) error {
+	return os.ErrPermission
+}
+
+// RemoveAll always fails; snapshots are read-only.
+func (s *SnapshotFS) RemoveAll(context.Context, string) error {
+	return os.ErrPermission
+}
+
+// Rename always fails; snapshots are read-only.
+func (s *SnapshotFS) Rename(context.Context, string, string) error {
+	return os.ErrPermission
+}
+
+// Stat returns information about a path in the snapshot.
+func (s *SnapshotFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	name = cleanSnapshotPath(name)
+	if name == "/" {
+		return snapshotFileInfo{SnapshotFile{Name: "/", Type: "dir", Path: "/"}}, nil
+	}
+
+	entries, err := s.readDir(ctx, path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Path == name {
+			return snapshotFileInfo{entry}, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// OpenFile opens a file or directory for reading. Any write flag fails with
+// os.ErrPermission.
+func (s *SnapshotFS) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+	info, err := s.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotFile{
+		fs:   s,
+		ctx:  ctx,
+		path: cleanSnapshotPath(name),
+		info: info.(snapshotFileInfo),
+	}, nil
+}
+
+// readDir returns the direct children of a directory in the snapshot.
+func (s *SnapshotFS) readDir(ctx context.Context, dir string) ([]SnapshotFile, error) {
+	s.mu.Lock()
+	entries, ok := s.dirs[dir]
+	s.mu.Unlock()
+	if ok {
+		return entries, nil
+	}
+
+	files, err := s.restic.ListFiles(ctx, s.cfg, s.snapshotID, dir)
+	if err != nil {
+		return nil, err
+	}
+	entries = make([]SnapshotFile, 0, len(files))
+	found := dir == "/"
+	for _, f := range files {
+		if f.Path == dir {
+			found = f.Type == "dir"
+			continue
+		}
+		if path.Dir(f.Path) == dir {
+			entries = append(entries, f)
+		}
+	}
+	if !found {
+		return nil, os.ErrNotExist
+	}
+
+	s.mu.Lock()
+	s.dirs[dir] = entries
+	s.mu.Unlock()
+	return entries, nil
+}
+
+// snapshotFileInfo adapts a SnapshotFile to os.FileInfo.
+type snapshotFileInfo struct {
+	f SnapshotFile
+}
+
+func (i snapshotFileInfo) Name() string       { return path.Base(i.f.Path) }
+func (i snapshotFileInfo) Size() int64        { return i.f.Size }
+func (i snapshotFileInfo) ModTime() time.Time { return i.f.ModTime }
+func (i snapshotFileInfo) IsDir() bool        { return i.f.Type == "dir" }
+func (i snapshotFileInfo) Sys() any           { return nil }
+
+func (i snapshotFileInfo) Mode() fs.FileMode {
+	if i.IsDir() {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+// ContentType implements webdav.ContentTyper so that PROPFIND does not dump
+// every file to sniff its type.
+func (i snapshotFileInfo) ContentType(context.Context) (string, error) {
+	if ctype := mime.TypeByExtension(path.Ext(i.f.Path)); ctype != "" {
+		return ctype, nil
+	}
+	return "application/octet-stream", nil
+}
+
+// snapshotFile is an open file or directory in a SnapshotFS. Reads stream
+// from restic dump; seeking forward discards output and seeking backward
+// restarts the dump.
+type snapshotFile struct {
+	fs   *SnapshotFS
+	ctx  context.Context
+	path string
+	info snapshotFileInfo
+
+	stream    io.ReadCloser
+	streamPos int64
+	offset    int64
+	dirPos    int
+}
+
+func (f *snapshotFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *snapshotFile) Write([]byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (f *snapshotFile) Readdir(count int) ([]fs.FileInfo, error) {
+	if !f.info.IsDir() {
+		return nil, errors.New("not a directory")
+	}
+	entries, err := f.fs.readDir(f.ctx, f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := entries[f.dirPos:]
+	if count > 0 {
+		if len(remaining) == 0 {
+			return nil, io.EOF
+		}
+		if len(remaining) > count {
+			remaining = remaining[:count]
+		}
+	}
+	f.dirPos += len(remaining)
+
+	infos := make([]fs.FileInfo, len(remaining))
+	for i, entry := range remaining {
+		infos[i] = snapshotFileInfo{entry}
+	}
+	return infos, nil
+}
+
+func (f *snapshotFile) Read(p []byte) (int, error) {
+	if f.info.IsDir() {
+		return 0, errors.New("is a directory")
+	}
+	if f.offset >= f.info.Size() {
+		return 0, io.EOF
+	}
+
+	if f.stream != nil && f.streamPos > f.offset {
+		f.closeStream()
+	}
+	if f.stream == nil {
+		stream, err := f.fs.restic.Dump(f.ctx, f.fs.cfg, f.fs.snapshotID, f.path, "")
+		if err != nil {
+			return 0, err
+		}
+		f.stream, f.streamPos = stream, 0
+	}
+	if skip := f.offset - f.streamPos; skip > 0 {
+		n, err := io.CopyN(io.Discard, f.stream, skip)
+		f.streamPos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.stream.Read(p)
+	f.streamPos += int64(n)
+	f.offset = f.streamPos
+	return n, err
+}
+
+func (f *snapshotFile) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = f.offset + offset
+	case io.SeekEnd:
+		abs = f.info.Size() + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.offset = abs
+	return abs, nil
+}
+
+func (f *snapshotFile) Close() error {
+	f.closeStream()
+	return nil
+}
+
+func (f *snapshotFile) closeStream() {
+	if f.stream != nil {
+		f.stream.Close()
+		f.stream = nil
+	}
+}
@@ -0,0 +1,195 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// snapshotScript fakes restic ls and dump over a snapshot containing
+// /data/hello.txt.
+const snapshotScript = `#!/bin/sh
+for a in "$@"; do
+	case "$a" in
+	ls|dump) cmd=$a ;;
+	--archive) archive=1 ;;
+	esac
+	last=$a
+done
+if [ "$cmd" = ls ]; then
+	echo '{"struct_type":"snapshot","id":"abc123"}'
+	case "$last" in
+	/) echo '{"name":"data","type":"dir","path":"/data"}' ;;
+	/data)
+		echo '{"name":"data","type":"dir","path":"/data"}'
+		echo '{"name":"hello.txt","type":"file","path":"/data/hello.txt","size":11}'
+		;;
+	esac
+	exit 0
+fi
+if [ -n "$archive" ]; then
+	printf 'ARCHIVE'
+	exit 0
+fi
+case "$last" in
+/data/hello.txt) printf 'hello world' ;;
+*) echo "Fatal: cannot dump file: path \"$last\" not found in snapshot" >&2; exit 1 ;;
+esac
+`
+
+func newSnapshotTestRestic(t *testing.T) *Restic {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "restic")
+	if err := os.WriteFile(script, []byte(snapshotScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return NewResticWithBinary(script, zerolog.Nop())
+}
+
+func TestSnapshotFS(t *testing.T) {
+	ctx := context.Background()
+	fs := NewSnapshotFS(newSnapshotTestRestic(t), testResticConfig(), "abc123")
+
+	t.Run("stat", func(t *testing.T) {
+		info, err := fs.Stat(ctx, "/data/hello.txt")
+		if err != nil {
+			t.Fatalf("Stat() error = %v", err)
+		}
+		if info.IsDir() || info.Size() != 11 || info.Name() != "hello.txt" {
+			t.Errorf("info = %v %d %s", info.IsDir(), info.Size(), info.Name())
+		}
+		if _, err := fs.Stat(ctx, "/data/missing"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Stat(missing) error = %v, want ErrNotExist", err)
+		}
+		if _, err := fs.Stat(ctx, "/nope/file"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Stat(missing dir) error = %v, want ErrNotExist", err)
+		}
+	})
+
+	t.Run("readdir", func(t *testing.T) {
+		dir, err := fs.OpenFile(ctx, "/data/", os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("OpenFile() error = %v", err)
+		}
+		defer dir.Close()
+		infos, err := dir.Readdir(0)
+		if err != nil {
+			t.Fatalf("Readdir() error = %v", err)
+		}
+		if len(infos) != 1 || infos[0].Name() != "hello.txt" {
+			t.Errorf("Readdir() = %v", infos)
+		}
+	})
+
+	t.Run("read and seek", func(t *testing.T) {
+		f, err := fs.OpenFile(ctx, "/data/hello.txt", os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("OpenFile() error = %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.Seek(6, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := io.ReadAll(f); string(got) != "world" {
+			t.Errorf("read from offset 6 = %q, want %q", got, "world")
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(f, buf); err != nil || string(buf) != "hello" {
+			t.Errorf("read after rewind = %q, %v", buf, err)
+		}
+		if end, _ := f.Seek(0, io.SeekEnd); end != 11 {
+			t.Errorf("Seek(end) = %d, want 11", end)
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		if _, err := fs.OpenFile(ctx, "/data/hello.txt", os.O_WRONLY, 0); !errors.Is(err, os.ErrPermission) {
+			t.Errorf("OpenFile(O_WRONLY) error = %v, want ErrPermission", err)
+		}
+		if err := fs.Mkdir(ctx, "/new", 0o755); !errors.Is(err, os.ErrPermission) {
+			t.Errorf("Mkdir() error = %v, want ErrPermission", err)
+		}
+		if err := fs.RemoveAll(ctx, "/data"); !errors.Is(err, os.ErrPermission) {
+			t.Errorf("RemoveAll() error = %v, want ErrPermission", err)
+		}
+	})
+}
+
+func TestRestic_ArchiveSize(t *testing.T) {
+	r := newSnapshotTestRestic(t)
+
+	size, err := r.ArchiveSize(context.Background(), testResticConfig(), "abc123", "data")
+	if err != nil {
+		t.Fatalf("ArchiveSize() error = %v", err)
+	}
+	if size.Path != "/data" || size.Files != 1 || size.Dirs != 1 || size.Bytes != 11 {
+		t.Errorf("size = %+v", size)
+	}
+
+	if _, err := r.ArchiveSize(context.Background(), testResticConfig(), "abc123", "/missing"); !errors.Is(err, ErrSnapshotPathNotFound) {
+		t.Errorf("ArchiveSize(missing) error = %v, want ErrSnapshotPathNotFound", err)
+	}
+}
+
+func TestRestic_WriteArchive(t *testing.T) {
+	r := newSnapshotTestRestic(t)
+	ctx := context.Background()
+
+	t.Run("tar.gz", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := r.WriteArchive(ctx, testResticConfig(), "abc123", "/data", ArchiveFormatTarGz, &buf); err != nil {
+			t.Fatalf("WriteArchive() error = %v", err)
+		}
+		gz, err := gzip.NewReader(&buf)
+		if err != nil {
+			t.Fatalf("output is not gzip: %v", err)
+		}
+		if got, _ := io.ReadAll(gz); string(got) != "ARCHIVE" {
+			t.Errorf("archive = %q", got)
+		}
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := r.WriteArchive(ctx, testResticConfig(), "abc123", "/data", ArchiveFormatZip, &buf); err != nil {
+			t.Fatalf("WriteArchive() error = %v", err)
+		}
+		if buf.String() != "ARCHIVE" {
+			t.Errorf("archive = %q", buf.String())
+		}
+	})
+}
+
+func TestRestic_DumpError(t *testing.T) {
+	r := newSnapshotTestRestic(t)
+	stream, err := r.Dump(context.Background(), testResticConfig(), "abc123", "/missing", "")
+	if err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+	defer stream.Close()
+	if _, err := io.ReadAll(stream); !errors.Is(err, ErrSnapshotPathNotFound) {
+		t.Errorf("read error = %v, want ErrSnapshotPathNotFound", err)
+	}
+}
+
+func TestParseArchiveFormat(t *testing.T) {
+	for in, want := range map[string]ArchiveFormat{"": ArchiveFormatTarGz, "tar.gz": ArchiveFormatTarGz, "zip": ArchiveFormatZip} {
+		if got, err := ParseArchiveFormat(in); err != nil || got != want {
+			t.Errorf("ParseArchiveFormat(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseArchiveFormat("rar"); err == nil {
+		t.Error("ParseArchiveFormat(rar) expected error")
+	}
+}
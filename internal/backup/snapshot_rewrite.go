@@ -0,0 +1,195 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoSnapshotsSelected is returned when a tag or rewrite is requested
+// without any snapshot IDs, which restic would apply to every snapshot.
+var ErrNoSnapshotsSelected = errors.New("no snapshots selected")
+
+// TagOptions describes a restic tag change. Set replaces all tags and cannot
+// be combined with Add or Remove.
+type TagOptions struct {
+	Add    []string
+	Remove []string
+	Set    []string
+}
+
+// IsEmpty reports whether the options would not change any tags.
+func (o TagOptions) IsEmpty() bool {
+	return len(o.Add) == 0 && len(o.Remove) == 0 && o.Set == nil
+}
+
+// Apply returns the tags a snapshot carries after the change.
+func (o TagOptions) Apply(current []string) []string {
+	if o.Set != nil {
+		return dedupeTags(o.Set)
+	}
+	remove := make(map[string]bool, len(o.Remove))
+	for _, t := range o.Remove {
+		remove[t] = true
+	}
+	var tags []string
+	for _, t := range append(append([]string{}, current...), o.Add...) {
+		if !remove[t] {
+			tags = append(tags, t)
+		}
+	}
+	return dedupeTags(tags)
+}
+
+// SnapshotIDChange maps a snapshot to the new ID restic wrote it under.
+// Tagging and rewriting both replace the snapshot file, so the ID changes.
+type SnapshotIDChange struct {
+	OldID string `json:"old_id"`
+	NewID string `json:"new_id"`
+}
+
+// RewriteResult describes what restic rewrite did, or would do, to one snapshot.
+type RewriteResult struct {
+	// SnapshotID is the short ID of the original snapshot.
+	SnapshotID string `json:"snapshot_id"`
+	// NewSnapshotID is the short ID of the rewritten snapshot. It is empty
+	// for dry runs and unmodified snapshots.
+	NewSnapshotID string   `json:"new_snapshot_id,omitempty"`
+	Excluded      []string `json:"excluded,omitempty"`
+	Modified      bool     `json:"modified"`
+}
+
+// Tag changes the tags of the given snapshots and returns the new snapshot IDs.
+func (r *Restic) Tag(ctx context.Context, cfg ResticConfig, snapshotIDs []string, opts TagOptions) ([]SnapshotIDChange, error) {
+	if len(snapshotIDs) == 0 {
+		return nil, ErrNoSnapshotsSelected
+	}
+	if opts.Set != nil && (len(opts.Add) > 0 || len(opts.Remove) > 0) {
+		return nil, errors.New("set cannot be combined with add or remove")
+	}
+
+	r.logger.Info().
+		Strs("snapshot_ids", snapshotIDs).
+		Strs("add", opts.Add).
+		Strs("remove", opts.Remove).
+		Strs("set", opts.Set).
+		Msg("tagging snapshots")
+
+	// --verbose makes restic report the old and new ID of each modified snapshot.
+	args := []string{"tag", "--repo", cfg.Repository, "--verbose"}
+	if opts.Set != nil {
+		// An empty --set value removes all tags.
+		args = append(args, "--set", strings.Join(opts.Set, ","))
+	}
+	for _, t := range opts.Add {
+		args = append(args, "--add", t)
+	}
+	for _, t := range opts.Remove {
+		args = append(args, "--remove", t)
+	}
+	args = append(args, snapshotIDs...)
+
+	output, err := r.run(ctx, cfg, args)
+	if err != nil {
+		return nil, fmt.Errorf("tag snapshots: %w", err)
+	}
+	return parseTagOutput(output), nil
+}
+
+// Rewrite removes the excluded paths from the given snapshots. Unless dryRun
+// is set, the original snapshots are forgotten; the data itself is only
+// removed from storage by the next prune.
+func (r *Restic) Rewrite(ctx context.Context, cfg ResticConfig, snapshotIDs, excludes []string, dryRun bool) ([]RewriteResult, error) {
+	if len(snapshotIDs) == 0 {
+		return nil, ErrNoSnapshotsSelected
+	}
+	if len(excludes) == 0 {
+		return nil, errors.New("at least one exclude pattern is required")
+	}
+
+	r.logger.Info().
+		Strs("snapshot_ids", snapshotIDs).
+		Strs("excludes", excludes).
+		Bool("dry_run", dryRun).
+		Msg("rewriting snapshots")
+
+	args := []string{"rewrite", "--repo", cfg.Repository, "--forget"}
+	for _, e := range excludes {
+		args = append(args, "--exclude", e)
+	}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+	args = append(args, snapshotIDs...)
+
+	output, err := r.run(ctx, cfg, args)
+	if err != nil {
+		return nil, fmt.Errorf("rewrite snapshots: %w", err)
+	}
+	return parseRewriteOutput(output), nil
+}
+
+// parseTagOutput extracts "old snapshot ID: X -> new snapshot ID: Y" lines.
+func parseTagOutput(output []byte) []SnapshotIDChange {
+	var changes []SnapshotIDChange
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		oldPart, newPart, ok := strings.Cut(line, " -> ")
+		if !ok {
+			continue
+		}
+		oldID, ok1 := strings.CutPrefix(oldPart, "old snapshot ID: ")
+		newID, ok2 := strings.CutPrefix(newPart, "new snapshot ID: ")
+		if ok1 && ok2 {
+			changes = append(changes, SnapshotIDChange{OldID: oldID, NewID: newID})
+		}
+	}
+	return changes
+}
+
+// parseRewriteOutput reads restic rewrite's per-snapshot report:
+//
+//	snapshot 4d0f6c48 of [/home] at 2024-01-02 ... by user@host
+//	excluding /home/user/.env
+//	saved new snapshot 7f1c0e5e
+func parseRewriteOutput(output []byte) []RewriteResult {
+	var results []RewriteResult
+	var current *RewriteResult
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "snapshot ") && strings.Contains(line, " of "):
+			fields := strings.Fields(line)
+			results = append(results, RewriteResult{SnapshotID: fields[1]})
+			current = &results[len(results)-1]
+		case current == nil:
+			continue
+		case strings.HasPrefix(line, "excluding "):
+			current.Excluded = append(current.Excluded, strings.TrimPrefix(line, "excluding "))
+		case line == "would save new snapshot":
+			current.Modified = true
+		case strings.HasPrefix(line, "saved new snapshot "):
+			current.Modified = true
+			current.NewSnapshotID = strings.TrimPrefix(line, "saved new snapshot ")
+		}
+	}
+	return results
+}
+
+func dedupeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTagOptionsApply(t *testing.T) {
+	current := []string{"daily", "prod"}
+	tests := []struct {
+		name string
+		opts TagOptions
+		want []string
+	}{
+		{"add", TagOptions{Add: []string{"keep", "prod"}}, []string{"daily", "prod", "keep"}},
+		{"remove", TagOptions{Remove: []string{"daily"}}, []string{"prod"}},
+		{"add and remove", TagOptions{Add: []string{"keep"}, Remove: []string{"prod"}}, []string{"daily", "keep"}},
+		{"set", TagOptions{Set: []string{"audit"}}, []string{"audit"}},
+		{"clear", TagOptions{Set: []string{}}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.Apply(current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !(TagOptions{}).IsEmpty() || (TagOptions{Set: []string{}}).IsEmpty() {
+		t.Error("IsEmpty should only be true without any change")
+	}
+}
+
+func TestParseTagOutput(t *testing.T) {
+	output := []byte("old snapshot ID: 4d0f6c48aa -> new snapshot ID: 7f1c0e5ebb\nmodified 1 snapshots\n")
+	got := parseTagOutput(output)
+	want := []SnapshotIDChange{{OldID: "4d0f6c48aa", NewID: "7f1c0e5ebb"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTagOutput() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseRewriteOutput(t *testing.T) {
+	output := []byte(`
+snapshot 4d0f6c48 of [/home] at 2024-01-02 10:00:00 +0000 UTC by root@web-01
+excluding /home/app/.env
+saved new snapshot 7f1c0e5e
+removed old snapshot 4d0f6c48
+
+snapshot 9a8b7c6d of [/home] at 2024-01-03 10:00:00 +0000 UTC by root@web-01
+snapshot 9a8b7c6d not modified
+`)
+	got := parseRewriteOutput(output)
+	want := []RewriteResult{
+		{SnapshotID: "4d0f6c48", NewSnapshotID: "7f1c0e5e", Excluded: []string{"/home/app/.env"}, Modified: true},
+		{SnapshotID: "9a8b7c6d"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRewriteOutput() = %+v, want %+v", got, want)
+	}
+
+	dry := parseRewriteOutput([]byte("snapshot 4d0f6c48 of [/home] at now by root@web-01\nexcluding /home/app/.env\nwould save new snapshot\nwould remove old snapshot\n"))
+	if len(dry) != 1 || !dry[0].Modified || dry[0].NewSnapshotID != "" {
+		t.Errorf("dry run = %+v", dry)
+	}
+}
+
+func TestRestic_Tag(t *testing.T) {
+	r, cleanup := newTestRestic("old snapshot ID: 4d0f6c48aa -> new snapshot ID: 7f1c0e5ebb")
+	defer cleanup()
+
+	changes, err := r.Tag(context.Background(), testResticConfig(), []string{"4d0f6c48aa"}, TagOptions{Add: []string{"keep"}})
+	if err != nil {
+		t.Fatalf("Tag() error = %v", err)
+	}
+	if len(changes) != 1 || changes[0].NewID != "7f1c0e5ebb" {
+		t.Errorf("changes = %+v", changes)
+	}
+
+	if _, err := r.Tag(context.Background(), testResticConfig(), nil, TagOptions{Add: []string{"keep"}}); !errors.Is(err, ErrNoSnapshotsSelected) {
+		t.Errorf("Tag() without snapshots error = %v", err)
+	}
+	if _, err := r.Tag(context.Background(), testResticConfig(), []string{"4d0f6c48aa"}, TagOptions{Set: []string{"a"}, Add: []string{"b"}}); err == nil {
+		t.Error("expected error combining set and add")
+	}
+	if _, err := r.Rewrite(context.Background(), testResticConfig(), nil, []string{"/x"}, true); !errors.Is(err, ErrNoSnapshotsSelected) {
+		t.Errorf("Rewrite() without snapshots error = %v", err)
+	}
+}
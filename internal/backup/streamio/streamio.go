@@ -0,0 +1,64 @@
+// Package streamio provides the readers and writers shared by the backup
+// code that pipes data between commands and restic.
+package streamio
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// DigestReader counts and hashes with SHA-256 the data read through it.
+type DigestReader struct {
+	r    io.Reader
+	hash hash.Hash
+	n    int64
+}
+
+// NewDigestReader returns a DigestReader reading from r.
+func NewDigestReader(r io.Reader) *DigestReader {
+	return &DigestReader{r: r, hash: sha256.New()}
+}
+
+func (d *DigestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.hash.Write(p[:n])
+	d.n += int64(n)
+	return n, err
+}
+
+// N returns the number of bytes read so far.
+func (d *DigestReader) N() int64 {
+	return d.n
+}
+
+// SHA256 returns the hex-encoded SHA-256 of the bytes read so far.
+func (d *DigestReader) SHA256() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// TailBuffer keeps the last limit bytes written to it, such as the end of a
+// command's stderr for an error message.
+type TailBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+// NewTailBuffer returns a TailBuffer keeping at most limit bytes.
+func NewTailBuffer(limit int) *TailBuffer {
+	return &TailBuffer{limit: limit}
+}
+
+func (t *TailBuffer) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	if extra := t.buf.Len() - t.limit; extra > 0 {
+		t.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+func (t *TailBuffer) String() string {
+	return t.buf.String()
+}
@@ -0,0 +1,41 @@
+package streamio
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDigestReader(t *testing.T) {
+	data := "SELECT 1;\n"
+	d := NewDigestReader(strings.NewReader(data))
+
+	got, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(got) != data {
+		t.Errorf("read %q, want %q", got, data)
+	}
+	if d.N() != int64(len(data)) {
+		t.Errorf("N() = %d, want %d", d.N(), len(data))
+	}
+	sum := sha256.Sum256([]byte(data))
+	if d.SHA256() != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256() = %s, want %s", d.SHA256(), hex.EncodeToString(sum[:]))
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tb := NewTailBuffer(5)
+	for _, s := range []string{"abc", "defg", "h"} {
+		if n, err := tb.Write([]byte(s)); err != nil || n != len(s) {
+			t.Fatalf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+	if tb.String() != "defgh" {
+		t.Errorf("String() = %q, want %q", tb.String(), "defgh")
+	}
+}
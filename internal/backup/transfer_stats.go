@@ -0,0 +1,51 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// parseTransferStats counts backend retries and failures in restic's stderr,
+// for example "Save(<data/4d0f6c48>) returned error, retrying after 552ms: ...",
+// and file errors from JSON error messages on either stream. start and
+// firstOutput give the time restic took before it reported progress.
+func parseTransferStats(stdout, stderr []byte, start, firstOutput time.Time) TransferStats {
+	var stats TransferStats
+	if !firstOutput.IsZero() && firstOutput.After(start) {
+		stats.OpenDuration = firstOutput.Sub(start)
+	}
+
+	for _, stream := range [][]byte{stdout, stderr} {
+		scanner := bufio.NewScanner(bytes.NewReader(stream))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "{") {
+				var msg struct {
+					MessageType string `json:"message_type"`
+				}
+				if json.Unmarshal([]byte(line), &msg) == nil && msg.MessageType == "error" {
+					stats.FileErrors++
+				}
+				continue
+			}
+			if !strings.Contains(line, " returned error") {
+				continue
+			}
+			stats.BackendErrors++
+			_, after, ok := strings.Cut(line, "retrying after ")
+			if !ok {
+				continue
+			}
+			stats.Retries++
+			wait, _, _ := strings.Cut(after, ":")
+			if d, err := time.ParseDuration(strings.TrimSpace(wait)); err == nil {
+				stats.RetryWait += d
+			}
+		}
+	}
+	return stats
+}
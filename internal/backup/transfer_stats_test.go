@@ -0,0 +1,54 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTransferStats(t *testing.T) {
+	start := time.Now()
+	stdout := []byte(`{"message_type":"status","percent_done":0.5}
+{"message_type":"error","error":{"message":"permission denied"},"during":"archival","item":"/data/secret"}
+{"message_type":"summary","snapshot_id":"abc"}
+`)
+	stderr := []byte(`Save(<data/4d0f6c48>) returned error, retrying after 552ms: connection reset by peer
+Load(<index/1a2b3c>, 0, 0) returned error, retrying after 1.2s: 503 Slow Down
+List(data) returned error: permission denied
+unrelated warning
+`)
+
+	stats := parseTransferStats(stdout, stderr, start, start.Add(3*time.Second))
+
+	if stats.OpenDuration != 3*time.Second {
+		t.Errorf("OpenDuration = %v, want 3s", stats.OpenDuration)
+	}
+	if stats.BackendErrors != 3 {
+		t.Errorf("BackendErrors = %d, want 3", stats.BackendErrors)
+	}
+	if stats.Retries != 2 {
+		t.Errorf("Retries = %d, want 2", stats.Retries)
+	}
+	if stats.RetryWait != 1752*time.Millisecond {
+		t.Errorf("RetryWait = %v, want 1.752s", stats.RetryWait)
+	}
+	if stats.FileErrors != 1 {
+		t.Errorf("FileErrors = %d, want 1", stats.FileErrors)
+	}
+}
+
+func TestParseTransferStats_NoOutput(t *testing.T) {
+	stats := parseTransferStats(nil, nil, time.Now(), time.Time{})
+	if stats != (TransferStats{}) {
+		t.Errorf("stats = %+v, want zero", stats)
+	}
+}
+
+func TestTransferStats_UploadBytesPerSecond(t *testing.T) {
+	stats := TransferStats{BytesUploaded: 10 << 20}
+	if got := stats.UploadBytesPerSecond(10 * time.Second); got != 1<<20 {
+		t.Errorf("UploadBytesPerSecond() = %v, want %v", got, 1<<20)
+	}
+	if got := stats.UploadBytesPerSecond(0); got != 0 {
+		t.Errorf("UploadBytesPerSecond(0) = %v, want 0", got)
+	}
+}
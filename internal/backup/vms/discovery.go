@@ -2,6 +2,7 @@ package vms
 
 import (
 	"context"
+	"time"
 
 	"github.com/MacJediWizard/keldris/internal/models"
 	"github.com/rs/zerolog"
@@ -19,10 +20,12 @@ func NewProxmoxDiscovery(logger zerolog.Logger) *ProxmoxDiscovery {
 	}
 }
 
-// DiscoveryResult contains the results of a Proxmox discovery operation.
+// DiscoveryResult contains the results of a hypervisor discovery operation.
+// Exactly one of ProxmoxInfo and LibvirtInfo is set.
 type DiscoveryResult struct {
 	Success      bool
 	ProxmoxInfo  *models.ProxmoxInfo
+	LibvirtInfo  *models.LibvirtInfo
 	ErrorMessage string
 }
 
@@ -105,3 +108,103 @@ func (d *ProxmoxDiscovery) RefreshAgent(
 
 	return nil
 }
+
+// LibvirtDiscovery handles discovery of libvirt/KVM domains.
+type LibvirtDiscovery struct {
+	logger zerolog.Logger
+}
+
+// NewLibvirtDiscovery creates a new libvirt discovery service.
+func NewLibvirtDiscovery(logger zerolog.Logger) *LibvirtDiscovery {
+	return &LibvirtDiscovery{
+		logger: logger.With().Str("component", "libvirt_discovery").Logger(),
+	}
+}
+
+// Discover connects to a libvirt daemon and discovers all domains and their disks.
+func (d *LibvirtDiscovery) Discover(ctx context.Context, conn LibvirtConn, uri string) *DiscoveryResult {
+	result := &DiscoveryResult{
+		Success: true,
+	}
+
+	version, err := conn.ConnectGetVersion(ctx)
+	if err != nil {
+		d.logger.Error().Err(err).Str("uri", uri).Msg("failed to get libvirt version")
+		result.Success = false
+		result.ErrorMessage = err.Error()
+		result.LibvirtInfo = &models.LibvirtInfo{
+			Available: false,
+			URI:       uri,
+			Error:     err.Error(),
+		}
+		return result
+	}
+
+	hostname, err := conn.ConnectGetHostname(ctx)
+	if err != nil {
+		d.logger.Warn().Err(err).Msg("failed to get libvirt hostname")
+	}
+
+	info := &models.LibvirtInfo{
+		Available: true,
+		URI:       uri,
+		Hostname:  hostname,
+		Version:   libvirtVersionString(version),
+	}
+	result.LibvirtInfo = info
+
+	domains, err := conn.ConnectListAllDomains(ctx)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to list domains")
+		result.Success = false
+		result.ErrorMessage = err.Error()
+		info.Error = err.Error()
+		return result
+	}
+
+	for _, dom := range domains {
+		domInfo := models.LibvirtDomainInfo{
+			Name:       dom.Name,
+			UUID:       dom.UUID,
+			State:      dom.State,
+			Persistent: dom.Persistent,
+			VCPUs:      dom.VCPUs,
+			MemoryKiB:  dom.MemoryKiB,
+		}
+		// The live definition lists backing chains of running domains.
+		if domXML, err := conn.DomainGetXMLDesc(ctx, dom.Name, false); err != nil {
+			d.logger.Warn().Err(err).Str("domain", dom.Name).Msg("failed to get domain xml")
+		} else if _, _, disks, err := ParseDomainDisks(domXML); err != nil {
+			d.logger.Warn().Err(err).Str("domain", dom.Name).Msg("failed to parse domain xml")
+		} else {
+			domInfo.Disks = disks
+		}
+
+		info.Domains = append(info.Domains, domInfo)
+		if dom.Active() {
+			info.RunningCount++
+		}
+	}
+	info.DomainCount = len(info.Domains)
+	now := time.Now()
+	info.DetectedAt = &now
+
+	d.logger.Info().
+		Str("uri", uri).
+		Int("total", info.DomainCount).
+		Int("running", info.RunningCount).
+		Msg("discovered libvirt domains")
+
+	return result
+}
+
+func libvirtVersionString(v *LibvirtVersion) string {
+	switch {
+	case v.Libvirt != "" && v.Hypervisor != "":
+		return "libvirt " + v.Libvirt + ", " + v.Hypervisor
+	case v.Libvirt != "":
+		return "libvirt " + v.Libvirt
+	default:
+		return v.Hypervisor
+	}
+}
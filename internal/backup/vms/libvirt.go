@@ -0,0 +1,396 @@
+package vms
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+)
+
+// LibvirtConn is the part of the libvirt API used for discovery, backup and
+// restore. Method names follow the libvirt RPC procedures they stand for so
+// that tests can substitute the connection.
+type LibvirtConn interface {
+	ConnectGetVersion(ctx context.Context) (*LibvirtVersion, error)
+	ConnectGetHostname(ctx context.Context) (string, error)
+	ConnectListAllDomains(ctx context.Context) ([]LibvirtDomain, error)
+	// DomainGetXMLDesc returns the live definition, or the persistent one
+	// that is used on the next boot when inactive is set.
+	DomainGetXMLDesc(ctx context.Context, domain string, inactive bool) (string, error)
+	// DomainSnapshotCreateXML takes an atomic, disk-only snapshot without
+	// libvirt metadata, so the overlays are only tracked by the caller.
+	DomainSnapshotCreateXML(ctx context.Context, domain, snapshotXML string, quiesce bool) error
+	// DomainBlockCommit starts an active block commit of disk's top image
+	// into its backing file.
+	DomainBlockCommit(ctx context.Context, domain, disk string) error
+	// DomainGetBlockJobInfo returns nil when disk has no block job.
+	DomainGetBlockJobInfo(ctx context.Context, domain, disk string) (*LibvirtBlockJob, error)
+	// DomainBlockJobAbort ends disk's block job, pivoting to the commit
+	// target when pivot is set.
+	DomainBlockJobAbort(ctx context.Context, domain, disk string, pivot bool) error
+	DomainDefineXML(ctx context.Context, domainXML string) error
+	DomainUndefine(ctx context.Context, domain string) error
+	DomainCreate(ctx context.Context, domain string) error
+}
+
+// LibvirtVersion contains the libvirt daemon and hypervisor versions.
+type LibvirtVersion struct {
+	Libvirt    string
+	Hypervisor string
+}
+
+// LibvirtDomain represents a domain as listed by libvirt.
+type LibvirtDomain struct {
+	Name       string
+	UUID       string
+	State      string
+	Persistent bool
+	VCPUs      int
+	MemoryKiB  int64
+}
+
+// Active reports whether the domain has a running QEMU process.
+func (d LibvirtDomain) Active() bool {
+	return d.State != "" && d.State != "shut off" && d.State != "crashed"
+}
+
+// LibvirtBlockJob is the progress of a block job.
+type LibvirtBlockJob struct {
+	Type string
+	Cur  int64
+	End  int64
+}
+
+// Ready reports whether an active commit has caught up and can be pivoted.
+func (j *LibvirtBlockJob) Ready() bool {
+	return j.End > 0 && j.Cur == j.End
+}
+
+// CommandRunner runs a command and returns its standard output. Errors
+// include the command's standard error.
+type CommandRunner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// ExecRunner runs commands with os/exec.
+func ExecRunner(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.Bytes(), fmt.Errorf("%s: %s: %w", name, msg, err)
+		}
+		return stdout.Bytes(), fmt.Errorf("%s: %w", name, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// VirshConn implements LibvirtConn with the virsh command line client.
+type VirshConn struct {
+	uri    string
+	run    CommandRunner
+	tmpDir string
+}
+
+// NewVirshConn creates a connection to the libvirt daemon at uri. An empty
+// uri uses qemu:///system.
+func NewVirshConn(uri string, run CommandRunner) *VirshConn {
+	if uri == "" {
+		uri = models.DefaultLibvirtURI
+	}
+	if run == nil {
+		run = ExecRunner
+	}
+	return &VirshConn{uri: uri, run: run}
+}
+
+// URI returns the libvirt connection URI.
+func (c *VirshConn) URI() string {
+	return c.uri
+}
+
+func (c *VirshConn) virsh(ctx context.Context, args ...string) ([]byte, error) {
+	if !models.ValidLibvirtURI(c.uri) {
+		return nil, fmt.Errorf("libvirt URI %q is not allowed", c.uri)
+	}
+	return c.run(ctx, "virsh", append([]string{"--quiet", "-c", c.uri}, args...)...)
+}
+
+// withXMLFile writes data to a temporary file for virsh commands that only
+// read XML from files.
+func (c *VirshConn) withXMLFile(data string, fn func(path string) error) error {
+	f, err := os.CreateTemp(c.tmpDir, "keldris-libvirt-*.xml")
+	if err != nil {
+		return fmt.Errorf("create xml file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(data); err != nil {
+		f.Close()
+		return fmt.Errorf("write xml file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write xml file: %w", err)
+	}
+	return fn(f.Name())
+}
+
+// ConnectGetVersion returns the libvirt daemon and hypervisor versions.
+func (c *VirshConn) ConnectGetVersion(ctx context.Context) (*LibvirtVersion, error) {
+	out, err := c.virsh(ctx, "version", "--daemon")
+	if err != nil {
+		return nil, fmt.Errorf("get libvirt version: %w", err)
+	}
+	fields := parseColonFields(out)
+	return &LibvirtVersion{
+		Libvirt:    fields["Running against daemon"],
+		Hypervisor: fields["Running hypervisor"],
+	}, nil
+}
+
+// ConnectGetHostname returns the hostname of the libvirt host.
+func (c *VirshConn) ConnectGetHostname(ctx context.Context) (string, error) {
+	out, err := c.virsh(ctx, "hostname")
+	if err != nil {
+		return "", fmt.Errorf("get libvirt hostname: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ConnectListAllDomains returns all active and inactive domains.
+func (c *VirshConn) ConnectListAllDomains(ctx context.Context) ([]LibvirtDomain, error) {
+	out, err := c.virsh(ctx, "list", "--all", "--name")
+	if err != nil {
+		return nil, fmt.Errorf("list domains: %w", err)
+	}
+
+	var domains []LibvirtDomain
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" {
+			continue
+		}
+		info, err := c.virsh(ctx, "dominfo", "--domain", name)
+		if err != nil {
+			return nil, fmt.Errorf("get domain info for %s: %w", name, err)
+		}
+		domains = append(domains, parseDominfo(info))
+	}
+	return domains, nil
+}
+
+// DomainGetXMLDesc returns the XML definition of a domain.
+func (c *VirshConn) DomainGetXMLDesc(ctx context.Context, domain string, inactive bool) (string, error) {
+	args := []string{"dumpxml", "--domain", domain}
+	if inactive {
+		args = append(args, "--inactive")
+	}
+	out, err := c.virsh(ctx, args...)
+	if err != nil {
+		return "", fmt.Errorf("dump xml of %s: %w", domain, err)
+	}
+	return string(out), nil
+}
+
+// DomainSnapshotCreateXML takes an external disk-only snapshot.
+func (c *VirshConn) DomainSnapshotCreateXML(ctx context.Context, domain, snapshotXML string, quiesce bool) error {
+	return c.withXMLFile(snapshotXML, func(path string) error {
+		args := []string{"snapshot-create", "--domain", domain, "--xmlfile", path,
+			"--disk-only", "--atomic", "--no-metadata"}
+		if quiesce {
+			args = append(args, "--quiesce")
+		}
+		if _, err := c.virsh(ctx, args...); err != nil {
+			return fmt.Errorf("snapshot %s: %w", domain, err)
+		}
+		return nil
+	})
+}
+
+// DomainBlockCommit starts an active block commit of a disk.
+func (c *VirshConn) DomainBlockCommit(ctx context.Context, domain, disk string) error {
+	if _, err := c.virsh(ctx, "blockcommit", "--domain", domain, "--path", disk, "--active"); err != nil {
+		return fmt.Errorf("blockcommit %s %s: %w", domain, disk, err)
+	}
+	return nil
+}
+
+// DomainGetBlockJobInfo returns the progress of a disk's block job.
+func (c *VirshConn) DomainGetBlockJobInfo(ctx context.Context, domain, disk string) (*LibvirtBlockJob, error) {
+	out, err := c.virsh(ctx, "blockjob", "--domain", domain, "--path", disk, "--info", "--raw")
+	if err != nil {
+		return nil, fmt.Errorf("get block job of %s %s: %w", domain, disk, err)
+	}
+	return parseBlockJob(out), nil
+}
+
+// DomainBlockJobAbort ends a disk's block job, optionally pivoting.
+func (c *VirshConn) DomainBlockJobAbort(ctx context.Context, domain, disk string, pivot bool) error {
+	flag := "--abort"
+	if pivot {
+		flag = "--pivot"
+	}
+	if _, err := c.virsh(ctx, "blockjob", "--domain", domain, "--path", disk, flag); err != nil {
+		return fmt.Errorf("end block job of %s %s: %w", domain, disk, err)
+	}
+	return nil
+}
+
+// DomainDefineXML defines or updates a persistent domain.
+func (c *VirshConn) DomainDefineXML(ctx context.Context, domainXML string) error {
+	return c.withXMLFile(domainXML, func(path string) error {
+		if _, err := c.virsh(ctx, "define", "--file", path); err != nil {
+			return fmt.Errorf("define domain: %w", err)
+		}
+		return nil
+	})
+}
+
+// DomainUndefine removes a domain definition, keeping its storage and NVRAM.
+func (c *VirshConn) DomainUndefine(ctx context.Context, domain string) error {
+	if _, err := c.virsh(ctx, "undefine", "--domain", domain, "--keep-nvram"); err != nil {
+		return fmt.Errorf("undefine %s: %w", domain, err)
+	}
+	return nil
+}
+
+// DomainCreate starts a defined domain.
+func (c *VirshConn) DomainCreate(ctx context.Context, domain string) error {
+	if _, err := c.virsh(ctx, "start", "--domain", domain); err != nil {
+		return fmt.Errorf("start %s: %w", domain, err)
+	}
+	return nil
+}
+
+// parseColonFields parses "Key: value" lines as printed by virsh.
+func parseColonFields(out []byte) map[string]string {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return fields
+}
+
+// parseDominfo parses the output of virsh dominfo.
+func parseDominfo(out []byte) LibvirtDomain {
+	fields := parseColonFields(out)
+	d := LibvirtDomain{
+		Name:       fields["Name"],
+		UUID:       fields["UUID"],
+		State:      fields["State"],
+		Persistent: fields["Persistent"] == "yes",
+	}
+	d.VCPUs, _ = strconv.Atoi(fields["CPU(s)"])
+	if mem, ok := strings.CutSuffix(fields["Max memory"], " KiB"); ok {
+		d.MemoryKiB, _ = strconv.ParseInt(mem, 10, 64)
+	}
+	return d
+}
+
+// parseBlockJob parses the output of virsh blockjob --info --raw. It
+// returns nil when the disk has no block job.
+func parseBlockJob(out []byte) *LibvirtBlockJob {
+	var job *LibvirtBlockJob
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		if job == nil {
+			job = &LibvirtBlockJob{}
+		}
+		switch key {
+		case "type":
+			job.Type = value
+		case "cur":
+			job.Cur, _ = strconv.ParseInt(value, 10, 64)
+		case "end":
+			job.End, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return job
+}
+
+type domainXMLDoc struct {
+	Name    string `xml:"name"`
+	UUID    string `xml:"uuid"`
+	Devices struct {
+		Disks []domainDiskXML `xml:"disk"`
+	} `xml:"devices"`
+}
+
+type domainDiskXML struct {
+	Type   string `xml:"type,attr"`
+	Device string `xml:"device,attr"`
+	Driver struct {
+		Type string `xml:"type,attr"`
+	} `xml:"driver"`
+	Source struct {
+		File string `xml:"file,attr"`
+		Dev  string `xml:"dev,attr"`
+		Name string `xml:"name,attr"`
+	} `xml:"source"`
+	Target struct {
+		Dev string `xml:"dev,attr"`
+	} `xml:"target"`
+	BackingStore *backingStoreXML `xml:"backingStore"`
+}
+
+type backingStoreXML struct {
+	Type   string `xml:"type,attr"`
+	Source struct {
+		File string `xml:"file,attr"`
+		Dev  string `xml:"dev,attr"`
+	} `xml:"source"`
+	BackingStore *backingStoreXML `xml:"backingStore"`
+}
+
+// ParseDomainDisks returns the name, UUID and disks of a domain XML
+// definition. Backing chains are only listed in live definitions.
+func ParseDomainDisks(domainXML string) (name, uuid string, disks []models.LibvirtDiskInfo, err error) {
+	var doc domainXMLDoc
+	if err := xml.Unmarshal([]byte(domainXML), &doc); err != nil {
+		return "", "", nil, fmt.Errorf("parse domain xml: %w", err)
+	}
+	for _, d := range doc.Devices.Disks {
+		disk := models.LibvirtDiskInfo{
+			Target: d.Target.Dev,
+			Device: d.Device,
+			Type:   d.Type,
+			Format: d.Driver.Type,
+		}
+		if disk.Device == "" {
+			disk.Device = "disk"
+		}
+		switch d.Type {
+		case "file":
+			disk.Source = d.Source.File
+		case "block":
+			disk.Source = d.Source.Dev
+		case "network":
+			disk.Source = d.Source.Name
+		}
+		for bs := d.BackingStore; bs != nil; bs = bs.BackingStore {
+			if bs.Source.File != "" {
+				disk.BackingFiles = append(disk.BackingFiles, bs.Source.File)
+			} else if bs.Source.Dev != "" {
+				disk.BackingFiles = append(disk.BackingFiles, bs.Source.Dev)
+			}
+		}
+		disks = append(disks, disk)
+	}
+	return doc.Name, doc.UUID, disks, nil
+}
@@ -0,0 +1,457 @@
+package vms
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// LibvirtManifestDirPrefix starts the name of the directory holding a
+	// domain's XML and disk manifest in a libvirt backup snapshot.
+	LibvirtManifestDirPrefix = "keldris-libvirt-"
+	// LibvirtDomainXMLFile is the persistent domain definition.
+	LibvirtDomainXMLFile = "domain.xml"
+	// LibvirtManifestFile describes the disk images backed up for a domain.
+	LibvirtManifestFile = "disks.json"
+
+	// libvirtOverlayMarker is part of the name of every snapshot overlay, so
+	// that overlays left behind by a crashed run are recognised.
+	libvirtOverlayMarker = ".keldris-snap-"
+
+	defaultLibvirtJobTimeout = 2 * time.Hour
+)
+
+// LibvirtManifest describes one domain in a libvirt backup snapshot.
+type LibvirtManifest struct {
+	Domain string `json:"domain"`
+	UUID   string `json:"uuid"`
+	State  string `json:"state"`
+	// Snapshot is true when the disks were read from an external snapshot
+	// of the running domain, false when the domain was shut off.
+	Snapshot bool `json:"snapshot"`
+	Quiesced bool `json:"quiesced"`
+	// Disks are the file-backed disks whose images are in the snapshot.
+	Disks []models.LibvirtDiskInfo `json:"disks"`
+	// Skipped lists disks that could not be backed up, such as block
+	// devices and network disks.
+	Skipped   []string  `json:"skipped,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Files returns every image file of the domain, backing files included.
+func (m *LibvirtManifest) Files() []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, d := range m.Disks {
+		for _, f := range append([]string{d.Source}, d.BackingFiles...) {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	return files
+}
+
+// LoadLibvirtManifest reads a domain's manifest and XML from dir.
+func LoadLibvirtManifest(dir string) (*LibvirtManifest, string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, LibvirtManifestFile))
+	if err != nil {
+		return nil, "", fmt.Errorf("read libvirt manifest: %w", err)
+	}
+	var manifest LibvirtManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, "", fmt.Errorf("parse libvirt manifest: %w", err)
+	}
+	domainXML, err := os.ReadFile(filepath.Join(dir, LibvirtDomainXMLFile))
+	if err != nil {
+		return nil, "", fmt.Errorf("read domain xml: %w", err)
+	}
+	return &manifest, string(domainXML), nil
+}
+
+// LibvirtBackupService handles libvirt domain backup operations.
+type LibvirtBackupService struct {
+	logger       zerolog.Logger
+	pollInterval time.Duration
+	jobTimeout   time.Duration
+}
+
+// NewLibvirtBackupService creates a new libvirt backup service.
+func NewLibvirtBackupService(logger zerolog.Logger) *LibvirtBackupService {
+	return &LibvirtBackupService{
+		logger:       logger.With().Str("component", "libvirt_backup_service").Logger(),
+		pollInterval: 2 * time.Second,
+		jobTimeout:   defaultLibvirtJobTimeout,
+	}
+}
+
+// LibvirtBackupRun is a prepared libvirt backup. Running domains write to
+// snapshot overlays until Finish commits them back, so Finish must be called
+// once restic has read the paths in Result, even when the backup failed.
+type LibvirtBackupRun struct {
+	Result *BackupResult
+
+	service  *LibvirtBackupService
+	conn     LibvirtConn
+	overlays []libvirtOverlay
+}
+
+// libvirtOverlay is a snapshot overlay a running domain writes to.
+type libvirtOverlay struct {
+	domain string
+	disk   string
+	path   string
+}
+
+// BackupDomains writes the definition of every selected domain to tempDir
+// and takes an external disk-only snapshot of the running ones, so that their
+// disk images stop changing. The returned run lists the paths for restic.
+func (s *LibvirtBackupService) BackupDomains(
+	ctx context.Context,
+	conn LibvirtConn,
+	opts *models.LibvirtBackupOptions,
+	tempDir string,
+) (*LibvirtBackupRun, error) {
+	run := &LibvirtBackupRun{
+		Result: &BackupResult{
+			Success:     true,
+			BackupPaths: []string{},
+			VMResults:   []VMBackupResult{},
+		},
+		service: s,
+		conn:    conn,
+	}
+	result := run.Result
+
+	domains, missing, err := s.getDomainsToBackup(ctx, conn, opts)
+	if err != nil {
+		return nil, fmt.Errorf("get domains to backup: %w", err)
+	}
+	for _, name := range missing {
+		result.VMResults = append(result.VMResults, VMBackupResult{
+			Name:  name,
+			Type:  "kvm",
+			Error: fmt.Sprintf("domain %s not found", name),
+		})
+	}
+
+	if len(domains) == 0 && len(missing) == 0 {
+		s.logger.Info().Msg("no domains match backup criteria")
+		return run, nil
+	}
+
+	s.logger.Info().Int("count", len(domains)).Msg("starting libvirt backup")
+
+	seen := make(map[string]bool)
+	for _, dom := range domains {
+		vmResult, paths := s.backupDomain(ctx, run, dom, opts, tempDir)
+		result.VMResults = append(result.VMResults, vmResult)
+		if !vmResult.Success {
+			continue
+		}
+		result.VMsBackedUp++
+		result.TotalSize += vmResult.Size
+		for _, p := range paths {
+			// Domains cloned from one template share its base image.
+			if !seen[p] {
+				seen[p] = true
+				result.BackupPaths = append(result.BackupPaths, p)
+			}
+		}
+	}
+
+	for _, vmResult := range result.VMResults {
+		if vmResult.Success {
+			continue
+		}
+		result.Success = false
+		if result.ErrorMessage == "" {
+			result.ErrorMessage = vmResult.Error
+		} else {
+			result.ErrorMessage += "; " + vmResult.Error
+		}
+	}
+
+	return run, nil
+}
+
+// getDomainsToBackup returns the domains selected by opts and the names of
+// requested domains that do not exist.
+func (s *LibvirtBackupService) getDomainsToBackup(
+	ctx context.Context,
+	conn LibvirtConn,
+	opts *models.LibvirtBackupOptions,
+) ([]LibvirtDomain, []string, error) {
+	all, err := conn.ConnectListAllDomains(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	excluded := make(map[string]bool)
+	for _, name := range opts.ExcludeDomains {
+		excluded[name] = true
+	}
+	wanted := make(map[string]bool)
+	for _, name := range opts.Domains {
+		wanted[name] = true
+	}
+
+	found := make(map[string]bool)
+	var selected []LibvirtDomain
+	for _, dom := range all {
+		if excluded[dom.Name] || (len(wanted) > 0 && !wanted[dom.Name]) {
+			continue
+		}
+		found[dom.Name] = true
+		if !dom.Active() && opts.SkipShutoff {
+			s.logger.Debug().Str("domain", dom.Name).Msg("skipping shut off domain")
+			continue
+		}
+		selected = append(selected, dom)
+	}
+
+	var missing []string
+	for _, name := range opts.Domains {
+		if !found[name] && !excluded[name] {
+			missing = append(missing, name)
+		}
+	}
+	return selected, missing, nil
+}
+
+// backupDomain stages one domain's definition and freezes its disks. It
+// returns the paths restic has to read.
+func (s *LibvirtBackupService) backupDomain(
+	ctx context.Context,
+	run *LibvirtBackupRun,
+	dom LibvirtDomain,
+	opts *models.LibvirtBackupOptions,
+	tempDir string,
+) (VMBackupResult, []string) {
+	start := time.Now()
+	vmResult := VMBackupResult{
+		Name: dom.Name,
+		Type: "kvm",
+	}
+	fail := func(err error) (VMBackupResult, []string) {
+		vmResult.Error = fmt.Sprintf("domain %s: %v", dom.Name, err)
+		vmResult.Duration = time.Since(start)
+		s.logger.Error().Err(err).Str("domain", dom.Name).Msg("libvirt domain backup failed")
+		return vmResult, nil
+	}
+
+	// The live definition has the backing chain of every disk.
+	liveXML, err := run.conn.DomainGetXMLDesc(ctx, dom.Name, false)
+	if err != nil {
+		return fail(err)
+	}
+	_, uuid, disks, err := ParseDomainDisks(liveXML)
+	if err != nil {
+		return fail(err)
+	}
+	domainXML := liveXML
+	if dom.Persistent {
+		if domainXML, err = run.conn.DomainGetXMLDesc(ctx, dom.Name, true); err != nil {
+			return fail(err)
+		}
+	}
+
+	manifest := &LibvirtManifest{
+		Domain:    dom.Name,
+		UUID:      uuid,
+		State:     dom.State,
+		CreatedAt: time.Now(),
+	}
+	for _, disk := range disks {
+		if disk.Device != "disk" {
+			continue
+		}
+		if disk.Type != "file" || disk.Source == "" {
+			manifest.Skipped = append(manifest.Skipped, disk.Target)
+			s.logger.Warn().
+				Str("domain", dom.Name).
+				Str("disk", disk.Target).
+				Str("type", disk.Type).
+				Msg("skipping disk that is not backed by a file")
+			continue
+		}
+		if strings.Contains(disk.Source, libvirtOverlayMarker) {
+			return fail(fmt.Errorf("disk %s still writes to snapshot overlay %s of an earlier backup; blockcommit it first", disk.Target, disk.Source))
+		}
+		for _, file := range append([]string{disk.Source}, disk.BackingFiles...) {
+			info, err := os.Stat(file)
+			if err != nil {
+				return fail(fmt.Errorf("disk %s: %w", disk.Target, err))
+			}
+			if !info.Mode().IsRegular() {
+				return fail(fmt.Errorf("disk %s: %s is not a regular file", disk.Target, file))
+			}
+			vmResult.Size += info.Size()
+		}
+		manifest.Disks = append(manifest.Disks, disk)
+	}
+
+	if dom.Active() && len(manifest.Disks) > 0 {
+		overlays, quiesced, err := s.snapshot(ctx, run.conn, dom.Name, manifest, opts.Quiesce)
+		if err != nil {
+			return fail(err)
+		}
+		run.overlays = append(run.overlays, overlays...)
+		manifest.Snapshot = true
+		manifest.Quiesced = quiesced
+	}
+
+	dir := filepath.Join(tempDir, LibvirtManifestDirPrefix+dom.Name)
+	if err := writeLibvirtManifest(dir, manifest, domainXML); err != nil {
+		return fail(err)
+	}
+
+	vmResult.Success = true
+	vmResult.BackupPath = dir
+	vmResult.Duration = time.Since(start)
+	s.logger.Info().
+		Str("domain", dom.Name).
+		Int("disks", len(manifest.Disks)).
+		Bool("snapshot", manifest.Snapshot).
+		Bool("quiesced", manifest.Quiesced).
+		Msg("libvirt domain prepared for backup")
+
+	return vmResult, append([]string{dir}, manifest.Files()...)
+}
+
+// snapshot redirects the writes of a running domain's file disks to new
+// overlays next to their images. It falls back to a crash-consistent
+// snapshot when quiescing fails, for example without a guest agent.
+func (s *LibvirtBackupService) snapshot(
+	ctx context.Context,
+	conn LibvirtConn,
+	domain string,
+	manifest *LibvirtManifest,
+	quiesce bool,
+) ([]libvirtOverlay, bool, error) {
+	suffix := libvirtOverlayMarker + strconv.FormatInt(time.Now().Unix(), 10)
+	var overlays []libvirtOverlay
+	var b strings.Builder
+	b.WriteString("<domainsnapshot>\n  <name>keldris-backup</name>\n  <disks>\n")
+	for _, disk := range manifest.Disks {
+		overlay := libvirtOverlay{domain: domain, disk: disk.Target, path: disk.Source + suffix}
+		overlays = append(overlays, overlay)
+		fmt.Fprintf(&b, "    <disk name=%s snapshot='external'>\n      <source file=%s/>\n    </disk>\n",
+			xmlAttr(disk.Target), xmlAttr(overlay.path))
+	}
+	for _, target := range manifest.Skipped {
+		fmt.Fprintf(&b, "    <disk name=%s snapshot='no'/>\n", xmlAttr(target))
+	}
+	b.WriteString("  </disks>\n</domainsnapshot>\n")
+
+	if quiesce {
+		err := conn.DomainSnapshotCreateXML(ctx, domain, b.String(), true)
+		if err == nil {
+			return overlays, true, nil
+		}
+		s.logger.Warn().Err(err).Str("domain", domain).Msg("quiesced snapshot failed, taking a crash-consistent snapshot")
+	}
+	if err := conn.DomainSnapshotCreateXML(ctx, domain, b.String(), false); err != nil {
+		return nil, false, err
+	}
+	return overlays, false, nil
+}
+
+func writeLibvirtManifest(dir string, manifest *LibvirtManifest, domainXML string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create manifest dir: %w", err)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, LibvirtManifestFile), data, 0o600); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, LibvirtDomainXMLFile), []byte(domainXML), 0o600); err != nil {
+		return fmt.Errorf("write domain xml: %w", err)
+	}
+	return nil
+}
+
+// Finish merges every snapshot overlay back into its disk image with an
+// active block commit, pivots the domain back to the image and deletes the
+// overlay. Overlays that fail to commit are left in place, because the
+// domain still writes to them.
+func (r *LibvirtBackupRun) Finish(ctx context.Context) error {
+	var errs []error
+	for _, o := range r.overlays {
+		if err := r.service.commit(ctx, r.conn, o); err != nil {
+			r.service.logger.Error().Err(err).
+				Str("domain", o.domain).
+				Str("disk", o.disk).
+				Str("overlay", o.path).
+				Msg("failed to commit snapshot overlay; the domain keeps writing to it")
+			errs = append(errs, fmt.Errorf("domain %s disk %s: %w", o.domain, o.disk, err))
+			continue
+		}
+		if err := os.Remove(o.path); err != nil && !os.IsNotExist(err) {
+			r.service.logger.Warn().Err(err).Str("overlay", o.path).Msg("failed to remove snapshot overlay")
+		}
+	}
+	r.overlays = nil
+	return errors.Join(errs...)
+}
+
+func (s *LibvirtBackupService) commit(ctx context.Context, conn LibvirtConn, o libvirtOverlay) error {
+	if err := conn.DomainBlockCommit(ctx, o.domain, o.disk); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(s.jobTimeout)
+	for {
+		job, err := conn.DomainGetBlockJobInfo(ctx, o.domain, o.disk)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			return errors.New("block commit ended before it could be pivoted")
+		}
+		if job.Ready() {
+			break
+		}
+		if time.Now().After(deadline) {
+			if err := conn.DomainBlockJobAbort(ctx, o.domain, o.disk, false); err != nil {
+				s.logger.Warn().Err(err).Str("domain", o.domain).Msg("failed to abort block commit")
+			}
+			return fmt.Errorf("block commit did not finish within %s", s.jobTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.pollInterval):
+		}
+	}
+
+	if err := conn.DomainBlockJobAbort(ctx, o.domain, o.disk, true); err != nil {
+		return err
+	}
+	s.logger.Debug().Str("domain", o.domain).Str("disk", o.disk).Msg("snapshot overlay committed")
+	return nil
+}
+
+// xmlAttr quotes s as an XML attribute value.
+func xmlAttr(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	_ = xml.EscapeText(&b, []byte(s))
+	b.WriteByte('\'')
+	return b.String()
+}
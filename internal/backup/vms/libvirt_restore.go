@@ -0,0 +1,391 @@
+package vms
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+)
+
+var (
+	domainNamePattern = regexp.MustCompile(`<name>[^<]*</name>`)
+	domainUUIDPattern = regexp.MustCompile(`\s*<uuid>[^<]*</uuid>`)
+	macAddressPattern = regexp.MustCompile(`\s*<mac address=['"][^'"]*['"]\s*/>`)
+	nvramPattern      = regexp.MustCompile(`\s*<nvram(\s[^>]*)?(/>|>[^<]*</nvram>)`)
+)
+
+// DomainRewrite describes how a backed up domain definition is adapted
+// before it is defined again.
+type DomainRewrite struct {
+	// Name renames the domain. A renamed domain gets a fresh UUID, MAC
+	// addresses and NVRAM file from libvirt so it can run next to the
+	// original.
+	Name string
+	// Paths maps disk image paths in the definition to their restored paths.
+	Paths map[string]string
+}
+
+// RewriteDomainXML applies rw to a domain definition. It edits the XML text
+// instead of re-encoding it, so that elements Keldris does not model, such
+// as hypervisor namespaces, survive unchanged.
+func RewriteDomainXML(domainXML string, rw DomainRewrite) (string, error) {
+	out := domainXML
+
+	if rw.Name != "" {
+		loc := domainNamePattern.FindStringIndex(out)
+		if loc == nil {
+			return "", fmt.Errorf("domain xml has no name")
+		}
+		var name strings.Builder
+		name.WriteString("<name>")
+		if err := escapeXML(&name, rw.Name); err != nil {
+			return "", err
+		}
+		name.WriteString("</name>")
+		out = out[:loc[0]] + name.String() + out[loc[1]:]
+
+		if loc := domainUUIDPattern.FindStringIndex(out); loc != nil {
+			out = out[:loc[0]] + out[loc[1]:]
+		}
+		out = macAddressPattern.ReplaceAllString(out, "")
+		out = nvramPattern.ReplaceAllString(out, "")
+	}
+
+	for from, to := range rw.Paths {
+		if from == to {
+			continue
+		}
+		var oldEsc, newEsc strings.Builder
+		if err := escapeXML(&oldEsc, from); err != nil {
+			return "", err
+		}
+		if err := escapeXML(&newEsc, to); err != nil {
+			return "", err
+		}
+		replaced := false
+		for _, q := range []string{`'`, `"`} {
+			old := "file=" + q + oldEsc.String() + q
+			if strings.Contains(out, old) {
+				out = strings.ReplaceAll(out, old, "file="+q+newEsc.String()+q)
+				replaced = true
+			}
+		}
+		if !replaced {
+			return "", fmt.Errorf("disk %s not found in domain xml", from)
+		}
+	}
+
+	return out, nil
+}
+
+// HasNVRAM reports whether a domain definition references an NVRAM file,
+// which RewriteDomainXML drops when renaming.
+func HasNVRAM(domainXML string) bool {
+	return nvramPattern.MatchString(domainXML)
+}
+
+func escapeXML(b *strings.Builder, s string) error {
+	for _, r := range s {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '\'':
+			b.WriteString("&apos;")
+		case '"':
+			b.WriteString("&quot;")
+		default:
+			if r < 0x20 {
+				return fmt.Errorf("invalid character in %q", s)
+			}
+			b.WriteRune(r)
+		}
+	}
+	return nil
+}
+
+// libvirtElementRule describes an element a restored domain definition may
+// contain.
+type libvirtElementRule struct {
+	// children are the child elements allowed; any other is refused.
+	children []string
+	// attrs check attribute values; a missing attribute is checked as "".
+	attrs map[string]func(string) bool
+	// text checks the element's text, such as a path.
+	text func(string) bool
+}
+
+// libvirtDomainRules is the allowlist CheckDomainXML enforces, by element
+// path. Listed children without a rule of their own are leaves: they may
+// not have children unless they are in libvirtConfigElements.
+var libvirtDomainRules = map[string]libvirtElementRule{
+	"domain": {
+		children: []string{
+			"name", "uuid", "genid", "title", "description", "metadata",
+			"memory", "currentMemory", "maxMemory", "memoryBacking",
+			"vcpu", "vcpus", "iothreads", "iothreadids", "cputune", "numatune",
+			"memtune", "blkiotune",
+			"resource", "sysinfo", "os", "features", "cpu", "clock", "pm",
+			"perf", "on_poweroff", "on_reboot", "on_crash", "on_lockfailure",
+			"seclabel", "devices",
+		},
+		attrs: map[string]func(string) bool{"type": oneOf("kvm", "qemu")},
+	},
+	// Dynamic labels only; type='none' would run the guest unconfined.
+	"domain/seclabel": {
+		children: []string{"label", "imagelabel", "baselabel"},
+		attrs:    map[string]func(string) bool{"type": oneOf("", "dynamic")},
+	},
+	"domain/os": {
+		children: []string{"type", "loader", "nvram", "boot", "bootmenu", "smbios", "bios", "firmware"},
+	},
+	// Firmware is exposed to the guest, so it must be a distribution image;
+	// a writable loader would let the guest write it back.
+	"domain/os/loader": {
+		attrs: map[string]func(string) bool{"readonly": oneOf("", "yes")},
+		text:  under("/usr/share"),
+	},
+	"domain/os/nvram": {
+		attrs: map[string]func(string) bool{"template": under("/usr/share")},
+		text:  under(LibvirtNVRAMDir),
+	},
+	"domain/os/firmware": {children: []string{"feature"}},
+	"domain/devices": {
+		children: []string{
+			"emulator", "disk", "controller", "interface", "input", "graphics",
+			"video", "console", "serial", "channel", "sound", "memballoon",
+			"rng", "watchdog", "tpm", "panic", "vsock", "iommu", "hub",
+			"redirdev", "audio",
+		},
+	},
+	"domain/devices/emulator": {text: libvirtEmulatorPattern.MatchString},
+	// Network and volume disks reach storage the images directory does not
+	// contain, and lun passes a host SCSI device through.
+	"domain/devices/disk": {
+		children: []string{
+			"driver", "source", "target", "boot", "readonly", "shareable",
+			"transient", "serial", "wwn", "vendor", "product", "address",
+			"alias", "iotune", "blockio", "geometry", "backingStore",
+		},
+		attrs: map[string]func(string) bool{
+			"type":   oneOf("", "file", "block"),
+			"device": oneOf("", "disk", "cdrom", "floppy"),
+		},
+	},
+	"domain/devices/controller": {
+		children: []string{"model", "target", "driver", "address", "alias", "master", "pcihole64"},
+	},
+	"domain/devices/interface": {
+		children: []string{
+			"mac", "source", "model", "driver", "address", "alias", "target",
+			"boot", "link", "mtu", "virtualport", "bandwidth", "vlan",
+			"filterref", "coalesce", "tune", "rom",
+		},
+		attrs: map[string]func(string) bool{"type": oneOf("network", "bridge", "user")},
+	},
+	// A ROM file would be read from the host into the guest.
+	"domain/devices/interface/rom": {
+		attrs: map[string]func(string) bool{"file": oneOf("")},
+	},
+	"domain/devices/input": {
+		children: []string{"address", "alias", "driver"},
+		attrs:    map[string]func(string) bool{"type": oneOf("mouse", "tablet", "keyboard")},
+	},
+	"domain/devices/graphics": {
+		children: []string{"listen", "image", "streaming", "clipboard", "mouse", "filetransfer", "channel"},
+		attrs:    map[string]func(string) bool{"type": oneOf("vnc", "spice")},
+	},
+	"domain/devices/graphics/listen": {
+		attrs: map[string]func(string) bool{"type": oneOf("", "address", "network", "none")},
+	},
+	"domain/devices/video": {children: []string{"model", "driver", "address", "alias"}},
+	"domain/devices/console": {
+		children: []string{"target", "address", "alias"},
+		attrs:    map[string]func(string) bool{"type": oneOf("pty")},
+	},
+	"domain/devices/serial": {
+		children: []string{"target", "address", "alias"},
+		attrs:    map[string]func(string) bool{"type": oneOf("pty")},
+	},
+	"domain/devices/channel": {
+		children: []string{"source", "target", "address", "alias"},
+		attrs:    map[string]func(string) bool{"type": oneOf("unix", "spicevmc")},
+	},
+	"domain/devices/channel/source": {
+		attrs: map[string]func(string) bool{"path": under("/var/lib/libvirt/qemu")},
+	},
+	"domain/devices/sound":      {children: []string{"codec", "address", "alias", "audio"}},
+	"domain/devices/memballoon": {children: []string{"address", "alias", "stats", "driver"}},
+	"domain/devices/rng":        {children: []string{"backend", "rate", "address", "alias", "driver"}},
+	// The backend's bytes reach the guest, so only random devices are read.
+	"domain/devices/rng/backend": {
+		attrs: map[string]func(string) bool{"model": oneOf("random")},
+		text:  oneOf("", "/dev/random", "/dev/urandom", "/dev/hwrng"),
+	},
+	"domain/devices/watchdog": {children: []string{"address", "alias"}},
+	"domain/devices/tpm":      {children: []string{"backend", "alias"}},
+	"domain/devices/tpm/backend": {
+		children: []string{"active_pcr_banks"},
+		attrs:    map[string]func(string) bool{"type": oneOf("emulator")},
+	},
+	"domain/devices/panic": {children: []string{"address", "alias"}},
+	"domain/devices/vsock": {children: []string{"cid", "address", "alias"}},
+	"domain/devices/iommu": {children: []string{"driver", "address", "alias"}},
+	"domain/devices/hub":   {children: []string{"address", "alias"}},
+	"domain/devices/redirdev": {
+		children: []string{"address", "alias", "boot"},
+		attrs:    map[string]func(string) bool{"type": oneOf("spicevmc")},
+	},
+	// Other audio backends write to host files or connect to host sockets.
+	"domain/devices/audio": {
+		attrs: map[string]func(string) bool{"type": oneOf("none", "spice")},
+	},
+}
+
+// libvirtConfigElements only hold settings of the element they are in, so
+// their contents are not checked beyond refusing foreign namespaces.
+var libvirtConfigElements = map[string]bool{
+	"metadata": true, "sysinfo": true, "cpu": true, "features": true,
+	"clock": true, "cputune": true, "numatune": true, "memoryBacking": true,
+	"resource": true, "pm": true, "perf": true, "iothreadids": true,
+	"vcpus": true, "memtune": true, "blkiotune": true,
+	"address": true, "driver": true, "model": true, "target": true,
+	"iotune": true, "blockio": true, "geometry": true, "bandwidth": true,
+	"vlan": true, "virtualport": true, "filterref": true, "coalesce": true,
+	"tune": true, "stats": true, "rate": true, "active_pcr_banks": true,
+	"codec": true, "audio": true,
+}
+
+// LibvirtNVRAMDir is where libvirt keeps the UEFI variables of system domains.
+const LibvirtNVRAMDir = "/var/lib/libvirt/qemu/nvram"
+
+// libvirtEmulatorPattern matches the QEMU binaries distributions install.
+var libvirtEmulatorPattern = regexp.MustCompile(`^/usr/(local/)?(bin|libexec)/(qemu-system-[a-z0-9_]+|qemu-kvm|kvm)$`)
+
+func oneOf(values ...string) func(string) bool {
+	return func(v string) bool {
+		return slices.Contains(values, v)
+	}
+}
+
+// under accepts an empty value or an absolute path inside one of dirs.
+func under(dirs ...string) func(string) bool {
+	return func(v string) bool {
+		if v == "" {
+			return true
+		}
+		for _, dir := range dirs {
+			if models.LibvirtPathWithin(dir, v) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// CheckDomainXML refuses a domain definition that contains anything outside
+// libvirtDomainRules. Restores define domains as root on the agent's host,
+// so definitions that pass host devices or filesystems through, add QEMU
+// command line arguments, run another emulator or read host files into the
+// guest are refused rather than defined. Disk paths are checked by the
+// caller.
+func CheckDomainXML(domainXML string) error {
+	type frame struct {
+		path string
+		rule *libvirtElementRule
+		text strings.Builder
+	}
+	var stack []*frame
+	// depth counts the open elements below a settings element.
+	depth := 0
+
+	dec := xml.NewDecoder(strings.NewReader(domainXML))
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("parse domain xml: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			// Application data under <metadata> is namespaced by design.
+			if t.Name.Space != "" && (len(stack) == 0 || stack[len(stack)-1].path != "domain/metadata") {
+				return fmt.Errorf("domain xml element <%s> in namespace %s is not allowed", name, t.Name.Space)
+			}
+			if depth > 0 {
+				depth++
+				continue
+			}
+
+			parent, allowed := "", []string{"domain"}
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				parent, allowed = top.path, nil
+				if top.rule != nil {
+					allowed = top.rule.children
+				}
+			}
+			if !slices.Contains(allowed, name) {
+				if parent == "" {
+					return fmt.Errorf("domain xml root element <%s> is not allowed", name)
+				}
+				return fmt.Errorf("domain xml element <%s> is not allowed in %s", name, parent)
+			}
+			path := name
+			if parent != "" {
+				path = parent + "/" + name
+			}
+
+			f := &frame{path: path}
+			if rule, ok := libvirtDomainRules[path]; ok {
+				f.rule = &rule
+				for attr, check := range rule.attrs {
+					value := ""
+					for _, a := range t.Attr {
+						if a.Name.Space == "" && a.Name.Local == attr {
+							value = a.Value
+						}
+					}
+					if !check(value) {
+						return fmt.Errorf("domain xml %s %s=%q is not allowed", path, attr, value)
+					}
+				}
+			} else if libvirtConfigElements[name] {
+				depth = 1
+			}
+			stack = append(stack, f)
+
+		case xml.EndElement:
+			if depth > 1 {
+				depth--
+				continue
+			}
+			depth = 0
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if f.rule != nil && f.rule.text != nil {
+				if text := strings.TrimSpace(f.text.String()); !f.rule.text(text) {
+					return fmt.Errorf("domain xml %s %q is not allowed", f.path, text)
+				}
+			}
+
+		case xml.CharData:
+			if depth == 0 && len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+	return nil
+}
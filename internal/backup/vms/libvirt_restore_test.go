@@ -0,0 +1,150 @@
+package vms
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRewriteDomainXML(t *testing.T) {
+	domainXML := `<domain type='kvm' xmlns:qemu='http://libvirt.org/schemas/domain/qemu/1.0'>
+  <name>web</name>
+  <uuid>4dea22b3-1d52-d8f3-2516-782e98ab3fa0</uuid>
+  <os>
+    <loader readonly='yes' type='pflash'>/usr/share/OVMF/OVMF_CODE.fd</loader>
+    <nvram>/var/lib/libvirt/qemu/nvram/web_VARS.fd</nvram>
+  </os>
+  <devices>
+    <disk type='file' device='disk'>
+      <source file='/images/web &amp; co.qcow2'/>
+      <target dev='vda' bus='virtio'/>
+    </disk>
+    <interface type='network'>
+      <mac address='52:54:00:12:34:56'/>
+      <source network='default'/>
+    </interface>
+  </devices>
+  <qemu:commandline>
+    <qemu:arg value='-s'/>
+  </qemu:commandline>
+</domain>
+`
+
+	t.Run("paths only", func(t *testing.T) {
+		out, err := RewriteDomainXML(domainXML, DomainRewrite{Paths: map[string]string{"/images/web & co.qcow2": "/dr/web & co.qcow2"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"<name>web</name>", "<uuid>", "<mac address=", "<nvram>", "<source file='/dr/web &amp; co.qcow2'/>", "<qemu:arg value='-s'/>"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output misses %q:\n%s", want, out)
+			}
+		}
+	})
+
+	t.Run("renamed clone", func(t *testing.T) {
+		out, err := RewriteDomainXML(domainXML, DomainRewrite{Name: "web-dr"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, "<name>web-dr</name>") {
+			t.Errorf("name not rewritten:\n%s", out)
+		}
+		for _, gone := range []string{"<uuid>", "<mac ", "<nvram>"} {
+			if strings.Contains(out, gone) {
+				t.Errorf("output still contains %q:\n%s", gone, out)
+			}
+		}
+		if !strings.Contains(out, "<loader readonly='yes' type='pflash'>") || !strings.Contains(out, "<source network='default'/>") {
+			t.Errorf("unrelated elements changed:\n%s", out)
+		}
+		if !HasNVRAM(domainXML) || HasNVRAM(out) {
+			t.Error("HasNVRAM() mismatch")
+		}
+	})
+
+	t.Run("unknown disk", func(t *testing.T) {
+		if _, err := RewriteDomainXML(domainXML, DomainRewrite{Paths: map[string]string{"/images/db.qcow2": "/dr/db.qcow2"}}); err == nil {
+			t.Error("expected error for a disk not in the definition")
+		}
+	})
+}
+
+func TestCheckDomainXML(t *testing.T) {
+	const allowed = `<domain type='kvm'>
+  <name>web</name>
+  <uuid>4dea22b3-1d52-d8f3-2516-782e98ab3fa0</uuid>
+  <metadata>
+    <libosinfo:libosinfo xmlns:libosinfo='http://libosinfo.org/xmlns/libvirt/domain/1.0'>
+      <libosinfo:os id='http://debian.org/debian/12'/>
+    </libosinfo:libosinfo>
+  </metadata>
+  <memory unit='KiB'>2097152</memory>
+  <vcpu placement='static'>2</vcpu>
+  <os>
+    <type arch='x86_64' machine='pc-q35-8.2'>hvm</type>
+    <loader readonly='yes' type='pflash'>/usr/share/OVMF/OVMF_CODE.fd</loader>
+    <nvram>/var/lib/libvirt/qemu/nvram/web_VARS.fd</nvram>
+    <boot dev='hd'/>
+  </os>
+  <features><acpi/><apic/></features>
+  <cpu mode='host-passthrough' check='none' migratable='on'/>
+  <clock offset='utc'><timer name='rtc' tickpolicy='catchup'/></clock>
+  <on_poweroff>destroy</on_poweroff>
+  <devices>
+    <emulator>/usr/bin/qemu-system-x86_64</emulator>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2' discard='unmap'/>
+      <source file='/var/lib/libvirt/images/web.qcow2'/>
+      <target dev='vda' bus='virtio'/>
+      <address type='pci' domain='0x0000' bus='0x04' slot='0x00' function='0x0'/>
+    </disk>
+    <controller type='usb' index='0' model='qemu-xhci'/>
+    <interface type='network'>
+      <mac address='52:54:00:12:34:56'/>
+      <source network='default'/>
+      <model type='virtio'/>
+    </interface>
+    <serial type='pty'><target type='isa-serial' port='0'/></serial>
+    <console type='pty'><target type='serial' port='0'/></console>
+    <channel type='unix'><target type='virtio' name='org.qemu.guest_agent.0'/></channel>
+    <input type='tablet' bus='usb'/>
+    <graphics type='vnc' port='-1' autoport='yes'><listen type='address'/></graphics>
+    <video><model type='virtio' heads='1' primary='yes'/></video>
+    <memballoon model='virtio'/>
+    <rng model='virtio'><backend model='random'>/dev/urandom</backend></rng>
+  </devices>
+</domain>
+`
+	if err := CheckDomainXML(allowed); err != nil {
+		t.Fatalf("CheckDomainXML() error = %v", err)
+	}
+
+	refused := map[string]string{
+		"qemu commandline": `<domain type='kvm' xmlns:qemu='http://libvirt.org/schemas/domain/qemu/1.0'>
+  <qemu:commandline><qemu:arg value='-s'/></qemu:commandline></domain>`,
+		"host filesystem": `<domain type='kvm'><devices><filesystem type='mount'>
+  <source dir='/'/><target dir='host'/></filesystem></devices></domain>`,
+		"host device": `<domain type='kvm'><devices><hostdev mode='subsystem' type='pci'/></devices></domain>`,
+		"network disk": `<domain type='kvm'><devices><disk type='network' device='disk'>
+  <source protocol='rbd' name='pool/web'/></disk></devices></domain>`,
+		"volume disk": `<domain type='kvm'><devices><disk type='volume' device='disk'>
+  <source pool='default' volume='web.qcow2'/></disk></devices></domain>`,
+		"emulator": `<domain type='kvm'><devices><emulator>/tmp/x</emulator></devices></domain>`,
+		"rng file": `<domain type='kvm'><devices><rng model='virtio'><backend model='random'>/etc/shadow</backend></rng></devices></domain>`,
+		"loader":   `<domain type='kvm'><os><loader>/home/user/evil.fd</loader></os></domain>`,
+		"nvram":    `<domain type='kvm'><os><nvram>/etc/passwd</nvram></os></domain>`,
+		"tcp serial": `<domain type='kvm'><devices><serial type='tcp'>
+  <source mode='bind' host='0.0.0.0' service='4444'/></serial></devices></domain>`,
+		"direct interface": `<domain type='kvm'><devices><interface type='direct'>
+  <source dev='eth0' mode='bridge'/></interface></devices></domain>`,
+		"xen domain": `<domain type='xen'><name>web</name></domain>`,
+		"root":       `<network><name>default</name></network>`,
+	}
+	for name, domainXML := range refused {
+		t.Run(name, func(t *testing.T) {
+			if err := CheckDomainXML(domainXML); err == nil {
+				t.Errorf("CheckDomainXML() accepted:\n%s", domainXML)
+			}
+		})
+	}
+}
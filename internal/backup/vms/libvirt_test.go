@@ -0,0 +1,450 @@
+package vms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+)
+
+// mockLibvirtConn stands in for the libvirt RPC connection.
+type mockLibvirtConn struct {
+	domains  []LibvirtDomain
+	liveXML  map[string]string
+	inactive map[string]string
+
+	snapshotErr        error
+	quiesceErr         error
+	commitErr          error
+	jobPollsUntilReady int
+
+	snapshots []string
+	quiesced  []bool
+	commits   []string
+	pivots    []string
+	jobPolls  map[string]int
+	defined   []string
+	undefined []string
+	started   []string
+}
+
+func (m *mockLibvirtConn) ConnectGetVersion(context.Context) (*LibvirtVersion, error) {
+	return &LibvirtVersion{Libvirt: "9.0.0", Hypervisor: "QEMU 7.2.0"}, nil
+}
+
+func (m *mockLibvirtConn) ConnectGetHostname(context.Context) (string, error) {
+	return "kvm1", nil
+}
+
+func (m *mockLibvirtConn) ConnectListAllDomains(context.Context) ([]LibvirtDomain, error) {
+	return m.domains, nil
+}
+
+func (m *mockLibvirtConn) DomainGetXMLDesc(_ context.Context, domain string, inactive bool) (string, error) {
+	if inactive {
+		if x, ok := m.inactive[domain]; ok {
+			return x, nil
+		}
+	}
+	x, ok := m.liveXML[domain]
+	if !ok {
+		return "", fmt.Errorf("domain %s not found", domain)
+	}
+	return x, nil
+}
+
+func (m *mockLibvirtConn) DomainSnapshotCreateXML(_ context.Context, domain, snapshotXML string, quiesce bool) error {
+	if quiesce && m.quiesceErr != nil {
+		return m.quiesceErr
+	}
+	if m.snapshotErr != nil {
+		return m.snapshotErr
+	}
+	m.snapshots = append(m.snapshots, snapshotXML)
+	m.quiesced = append(m.quiesced, quiesce)
+	// Like QEMU, create the overlay files the domain now writes to.
+	for _, line := range strings.Split(snapshotXML, "\n") {
+		if _, rest, ok := strings.Cut(line, "<source file='"); ok {
+			path, _, _ := strings.Cut(rest, "'")
+			if err := os.WriteFile(path, []byte("overlay"), 0o600); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *mockLibvirtConn) DomainBlockCommit(_ context.Context, domain, disk string) error {
+	if m.commitErr != nil {
+		return m.commitErr
+	}
+	m.commits = append(m.commits, domain+"/"+disk)
+	return nil
+}
+
+func (m *mockLibvirtConn) DomainGetBlockJobInfo(_ context.Context, domain, disk string) (*LibvirtBlockJob, error) {
+	if m.jobPolls == nil {
+		m.jobPolls = make(map[string]int)
+	}
+	key := domain + "/" + disk
+	m.jobPolls[key]++
+	if m.jobPolls[key] <= m.jobPollsUntilReady {
+		return &LibvirtBlockJob{Type: "Active Block Commit", Cur: 50, End: 100}, nil
+	}
+	return &LibvirtBlockJob{Type: "Active Block Commit", Cur: 100, End: 100}, nil
+}
+
+func (m *mockLibvirtConn) DomainBlockJobAbort(_ context.Context, domain, disk string, pivot bool) error {
+	if pivot {
+		m.pivots = append(m.pivots, domain+"/"+disk)
+	}
+	return nil
+}
+
+func (m *mockLibvirtConn) DomainDefineXML(_ context.Context, domainXML string) error {
+	m.defined = append(m.defined, domainXML)
+	return nil
+}
+
+func (m *mockLibvirtConn) DomainUndefine(_ context.Context, domain string) error {
+	m.undefined = append(m.undefined, domain)
+	return nil
+}
+
+func (m *mockLibvirtConn) DomainCreate(_ context.Context, domain string) error {
+	m.started = append(m.started, domain)
+	return nil
+}
+
+func testDomainXML(name, uuid string, disks ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<domain type='kvm'>\n  <name>%s</name>\n  <uuid>%s</uuid>\n  <devices>\n", name, uuid)
+	for _, d := range disks {
+		b.WriteString(d)
+	}
+	b.WriteString("    <interface type='network'>\n      <mac address='52:54:00:12:34:56'/>\n    </interface>\n  </devices>\n</domain>\n")
+	return b.String()
+}
+
+func fileDisk(target, path string, backing ...string) string {
+	var bs string
+	for i := len(backing) - 1; i >= 0; i-- {
+		bs = fmt.Sprintf("<backingStore type='file'><format type='qcow2'/><source file='%s'/>%s</backingStore>", backing[i], bs)
+	}
+	return fmt.Sprintf("    <disk type='file' device='disk'>\n      <driver name='qemu' type='qcow2'/>\n      <source file='%s'/>\n      %s\n      <target dev='%s' bus='virtio'/>\n    </disk>\n", path, bs, target)
+}
+
+func TestVirshConn(t *testing.T) {
+	outputs := map[string]string{
+		"version":     "Compiled against library: libvirt 9.0.0\nUsing library: libvirt 9.0.0\nUsing API: QEMU 9.0.0\nRunning hypervisor: QEMU 7.2.0\nRunning against daemon: 9.0.0\n",
+		"hostname":    "kvm1\n",
+		"list":        "web\ndb\n\n",
+		"dominfo web": "Id:             1\nName:           web\nUUID:           4dea22b3-1d52-d8f3-2516-782e98ab3fa0\nOS Type:        hvm\nState:          running\nCPU(s):         2\nMax memory:     2097152 KiB\nUsed memory:    2097152 KiB\nPersistent:     yes\n",
+		"dominfo db":  "Id:             -\nName:           db\nUUID:           0f2c1a9e-5d1b-4bb4-9c60-2f4f0e4c51a7\nState:          shut off\nCPU(s):         4\nMax memory:     8388608 KiB\nPersistent:     yes\n",
+	}
+	var calls [][]string
+	var definedXML string
+	run := func(_ context.Context, name string, args ...string) ([]byte, error) {
+		if name != "virsh" || len(args) < 4 || args[0] != "--quiet" || args[1] != "-c" || args[2] != "qemu:///session" {
+			return nil, fmt.Errorf("unexpected command %s %v", name, args)
+		}
+		args = args[3:]
+		calls = append(calls, args)
+		switch args[0] {
+		case "dominfo":
+			return []byte(outputs["dominfo "+args[2]]), nil
+		case "blockjob":
+			if args[4] == "vdb" {
+				return []byte("No current block job for vdb\n"), nil
+			}
+			return []byte(" type=Active Block Commit\n bandwidth=0\n cur=1048576\n end=1048576\n"), nil
+		case "define":
+			data, err := os.ReadFile(args[2])
+			definedXML = string(data)
+			return nil, err
+		}
+		return []byte(outputs[args[0]]), nil
+	}
+	conn := NewVirshConn("qemu:///session", run)
+	ctx := context.Background()
+
+	version, err := conn.ConnectGetVersion(ctx)
+	if err != nil || version.Libvirt != "9.0.0" || version.Hypervisor != "QEMU 7.2.0" {
+		t.Errorf("ConnectGetVersion() = %+v, %v", version, err)
+	}
+	if host, _ := conn.ConnectGetHostname(ctx); host != "kvm1" {
+		t.Errorf("ConnectGetHostname() = %q", host)
+	}
+
+	domains, err := conn.ConnectListAllDomains(ctx)
+	if err != nil {
+		t.Fatalf("ConnectListAllDomains() error = %v", err)
+	}
+	if len(domains) != 2 {
+		t.Fatalf("domains = %+v", domains)
+	}
+	web, db := domains[0], domains[1]
+	if web.Name != "web" || web.State != "running" || !web.Persistent || web.VCPUs != 2 || web.MemoryKiB != 2097152 || !web.Active() {
+		t.Errorf("web = %+v", web)
+	}
+	if db.Name != "db" || db.State != "shut off" || db.Active() {
+		t.Errorf("db = %+v", db)
+	}
+
+	job, err := conn.DomainGetBlockJobInfo(ctx, "web", "vda")
+	if err != nil || job == nil || !job.Ready() || job.Type != "Active Block Commit" {
+		t.Errorf("DomainGetBlockJobInfo(vda) = %+v, %v", job, err)
+	}
+	if job, err := conn.DomainGetBlockJobInfo(ctx, "web", "vdb"); err != nil || job != nil {
+		t.Errorf("DomainGetBlockJobInfo(vdb) = %+v, %v", job, err)
+	}
+
+	if err := conn.DomainDefineXML(ctx, "<domain/>"); err != nil || definedXML != "<domain/>" {
+		t.Errorf("DomainDefineXML() defined %q, %v", definedXML, err)
+	}
+
+	calls = nil
+	if err := conn.DomainSnapshotCreateXML(ctx, "web", "<domainsnapshot/>", true); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(calls[0], " ")
+	for _, flag := range []string{"--disk-only", "--atomic", "--no-metadata", "--quiesce"} {
+		if !strings.Contains(got, flag) {
+			t.Errorf("snapshot-create %q misses %s", got, flag)
+		}
+	}
+
+	calls = nil
+	remote := NewVirshConn("qemu+ext:///system?command=/tmp/payload", run)
+	if _, err := remote.ConnectGetHostname(ctx); err == nil || len(calls) != 0 {
+		t.Errorf("ConnectGetHostname() on a remote URI = %v, ran %v", err, calls)
+	}
+}
+
+func TestParseDomainDisks(t *testing.T) {
+	domainXML := testDomainXML("web", "4dea22b3-1d52-d8f3-2516-782e98ab3fa0",
+		fileDisk("vda", "/images/web.qcow2", "/images/base.qcow2"),
+		"    <disk type='block' device='disk'><driver name='qemu' type='raw'/><source dev='/dev/vg0/web-data'/><target dev='vdb' bus='virtio'/></disk>\n",
+		"    <disk type='file' device='cdrom'><source file='/iso/debian.iso'/><target dev='sda' bus='sata'/></disk>\n",
+	)
+	name, uuid, disks, err := ParseDomainDisks(domainXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "web" || uuid != "4dea22b3-1d52-d8f3-2516-782e98ab3fa0" || len(disks) != 3 {
+		t.Fatalf("ParseDomainDisks() = %q, %q, %+v", name, uuid, disks)
+	}
+	if d := disks[0]; d.Target != "vda" || d.Type != "file" || d.Format != "qcow2" || d.Source != "/images/web.qcow2" ||
+		len(d.BackingFiles) != 1 || d.BackingFiles[0] != "/images/base.qcow2" {
+		t.Errorf("vda = %+v", d)
+	}
+	if d := disks[1]; d.Type != "block" || d.Source != "/dev/vg0/web-data" {
+		t.Errorf("vdb = %+v", d)
+	}
+	if d := disks[2]; d.Device != "cdrom" {
+		t.Errorf("sda = %+v", d)
+	}
+}
+
+func TestLibvirtDiscovery(t *testing.T) {
+	conn := &mockLibvirtConn{
+		domains: []LibvirtDomain{
+			{Name: "web", State: "running", Persistent: true},
+			{Name: "db", State: "shut off", Persistent: true},
+		},
+		liveXML: map[string]string{
+			"web": testDomainXML("web", "u1", fileDisk("vda", "/images/web.qcow2")),
+			"db":  testDomainXML("db", "u2", fileDisk("vda", "/images/db.qcow2")),
+		},
+	}
+	result := NewLibvirtDiscovery(newTestLogger()).Discover(context.Background(), conn, models.DefaultLibvirtURI)
+	if !result.Success || result.LibvirtInfo == nil || result.ProxmoxInfo != nil {
+		t.Fatalf("Discover() = %+v", result)
+	}
+	info := result.LibvirtInfo
+	if !info.Available || info.Hostname != "kvm1" || info.Version != "libvirt 9.0.0, QEMU 7.2.0" ||
+		info.DomainCount != 2 || info.RunningCount != 1 || info.DetectedAt == nil {
+		t.Errorf("LibvirtInfo = %+v", info)
+	}
+	if len(info.Domains[1].Disks) != 1 || info.Domains[1].Disks[0].Source != "/images/db.qcow2" {
+		t.Errorf("db disks = %+v", info.Domains[1].Disks)
+	}
+}
+
+func newBackupTestService() *LibvirtBackupService {
+	s := NewLibvirtBackupService(newTestLogger())
+	s.pollInterval = time.Millisecond
+	return s
+}
+
+func writeImages(t *testing.T, dir string, names ...string) map[string]string {
+	t.Helper()
+	paths := make(map[string]string)
+	for _, name := range names {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("image "+name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		paths[name] = p
+	}
+	return paths
+}
+
+func TestLibvirtBackupDomains(t *testing.T) {
+	images := writeImages(t, t.TempDir(), "base.qcow2", "web.qcow2", "db.raw", "app.qcow2")
+	webXML := testDomainXML("web", "u1",
+		fileDisk("vda", images["web.qcow2"], images["base.qcow2"]),
+		"    <disk type='block' device='disk'><source dev='/dev/vg0/web-data'/><target dev='vdb'/></disk>\n",
+		"    <disk type='file' device='cdrom'><target dev='sda'/></disk>\n",
+	)
+	conn := &mockLibvirtConn{
+		domains: []LibvirtDomain{
+			{Name: "web", State: "running", Persistent: true},
+			{Name: "db", State: "shut off", Persistent: true},
+			{Name: "app", State: "running", Persistent: true},
+		},
+		liveXML: map[string]string{
+			"web": webXML,
+			"db":  testDomainXML("db", "u2", fileDisk("vda", images["db.raw"])),
+			"app": testDomainXML("app", "u3", fileDisk("vda", images["app.qcow2"], images["base.qcow2"])),
+		},
+		inactive: map[string]string{
+			"web": testDomainXML("web", "u1", fileDisk("vda", images["web.qcow2"])),
+		},
+		jobPollsUntilReady: 2,
+	}
+	tempDir := t.TempDir()
+	s := newBackupTestService()
+
+	run, err := s.BackupDomains(context.Background(), conn, &models.LibvirtBackupOptions{
+		ExcludeDomains: []string{"app"},
+		Quiesce:        true,
+	}, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := run.Result
+	if !result.Success || result.VMsBackedUp != 2 {
+		t.Fatalf("result = %+v", result)
+	}
+
+	// Only the running domain is snapshotted, and only its file disk.
+	if len(conn.snapshots) != 1 || !conn.quiesced[0] {
+		t.Fatalf("snapshots = %v", conn.snapshots)
+	}
+	snap := conn.snapshots[0]
+	if !strings.Contains(snap, "<disk name='vda' snapshot='external'>") ||
+		!strings.Contains(snap, "<source file='"+images["web.qcow2"]+libvirtOverlayMarker) ||
+		!strings.Contains(snap, "<disk name='vdb' snapshot='no'/>") || strings.Contains(snap, "sda") {
+		t.Errorf("snapshot xml = %s", snap)
+	}
+
+	webDir := filepath.Join(tempDir, LibvirtManifestDirPrefix+"web")
+	want := []string{webDir, images["web.qcow2"], images["base.qcow2"], filepath.Join(tempDir, LibvirtManifestDirPrefix+"db"), images["db.raw"]}
+	if strings.Join(result.BackupPaths, ",") != strings.Join(want, ",") {
+		t.Errorf("BackupPaths = %v, want %v", result.BackupPaths, want)
+	}
+
+	manifest, domainXML, err := LoadLibvirtManifest(webDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Domain != "web" || manifest.UUID != "u1" || !manifest.Snapshot || !manifest.Quiesced ||
+		len(manifest.Disks) != 1 || len(manifest.Skipped) != 1 || manifest.Skipped[0] != "vdb" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	if domainXML != conn.inactive["web"] {
+		t.Errorf("domain.xml is not the persistent definition: %s", domainXML)
+	}
+
+	overlays, _ := filepath.Glob(images["web.qcow2"] + libvirtOverlayMarker + "*")
+	if len(overlays) != 1 {
+		t.Fatalf("overlays = %v", overlays)
+	}
+	if err := run.Finish(context.Background()); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	if len(conn.commits) != 1 || conn.commits[0] != "web/vda" || len(conn.pivots) != 1 || conn.jobPolls["web/vda"] != 3 {
+		t.Errorf("commits = %v, pivots = %v, polls = %v", conn.commits, conn.pivots, conn.jobPolls)
+	}
+	if _, err := os.Stat(overlays[0]); !os.IsNotExist(err) {
+		t.Errorf("overlay not removed: %v", err)
+	}
+}
+
+func TestLibvirtBackupDomains_QuiesceFallback(t *testing.T) {
+	images := writeImages(t, t.TempDir(), "web.qcow2")
+	conn := &mockLibvirtConn{
+		domains:    []LibvirtDomain{{Name: "web", State: "running"}},
+		liveXML:    map[string]string{"web": testDomainXML("web", "u1", fileDisk("vda", images["web.qcow2"]))},
+		quiesceErr: errors.New("QEMU guest agent is not connected"),
+	}
+	run, err := newBackupTestService().BackupDomains(context.Background(), conn, &models.LibvirtBackupOptions{Quiesce: true}, t.TempDir())
+	if err != nil || !run.Result.Success {
+		t.Fatalf("BackupDomains() = %+v, %v", run, err)
+	}
+	if len(conn.quiesced) != 1 || conn.quiesced[0] {
+		t.Errorf("expected a crash-consistent snapshot, got quiesced = %v", conn.quiesced)
+	}
+	if err := run.Finish(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLibvirtBackupDomains_Failures(t *testing.T) {
+	images := writeImages(t, t.TempDir(), "web.qcow2", "web.qcow2"+libvirtOverlayMarker+"1700000000")
+
+	t.Run("leftover overlay", func(t *testing.T) {
+		conn := &mockLibvirtConn{
+			domains: []LibvirtDomain{{Name: "web", State: "running"}},
+			liveXML: map[string]string{"web": testDomainXML("web", "u1",
+				fileDisk("vda", images["web.qcow2"+libvirtOverlayMarker+"1700000000"], images["web.qcow2"]))},
+		}
+		run, err := newBackupTestService().BackupDomains(context.Background(), conn, &models.LibvirtBackupOptions{}, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Result.Success || !strings.Contains(run.Result.ErrorMessage, "blockcommit it first") || len(conn.snapshots) != 0 {
+			t.Errorf("result = %+v", run.Result)
+		}
+	})
+
+	t.Run("missing domain", func(t *testing.T) {
+		conn := &mockLibvirtConn{
+			domains: []LibvirtDomain{{Name: "web", State: "shut off"}, {Name: "db", State: "shut off"}},
+			liveXML: map[string]string{"web": testDomainXML("web", "u1", fileDisk("vda", images["web.qcow2"]))},
+		}
+		run, err := newBackupTestService().BackupDomains(context.Background(), conn, &models.LibvirtBackupOptions{Domains: []string{"web", "mail"}}, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Result.Success || run.Result.VMsBackedUp != 1 || run.Result.ErrorMessage != "domain mail not found" {
+			t.Errorf("result = %+v", run.Result)
+		}
+	})
+
+	t.Run("failed commit keeps overlay", func(t *testing.T) {
+		images := writeImages(t, t.TempDir(), "app.qcow2")
+		conn := &mockLibvirtConn{
+			domains:   []LibvirtDomain{{Name: "app", State: "running"}},
+			liveXML:   map[string]string{"app": testDomainXML("app", "u1", fileDisk("vda", images["app.qcow2"]))},
+			commitErr: errors.New("block copy still active"),
+		}
+		run, err := newBackupTestService().BackupDomains(context.Background(), conn, &models.LibvirtBackupOptions{}, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := run.Finish(context.Background()); err == nil || !strings.Contains(err.Error(), "domain app disk vda") {
+			t.Errorf("Finish() error = %v", err)
+		}
+		if overlays, _ := filepath.Glob(images["app.qcow2"] + libvirtOverlayMarker + "*"); len(overlays) != 1 {
+			t.Errorf("overlay must stay while the domain writes to it, got %v", overlays)
+		}
+	})
+}
@@ -0,0 +1,655 @@
+package vms
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/rs/zerolog"
+)
+
+// DefaultPBSPort is the Proxmox Backup Server API port.
+const DefaultPBSPort = 8007
+
+// pbsManifestFile is the manifest of a snapshot.
+const pbsManifestFile = "index.json.blob"
+
+// PBS archive suffixes. Fixed indexes hold VM disk images, dynamic indexes
+// hold pxar file archives and blobs hold small files such as guest configs.
+const (
+	pbsFixedIndexSuffix   = ".fidx"
+	pbsDynamicIndexSuffix = ".didx"
+	pbsBlobSuffix         = ".blob"
+)
+
+// pbsMetadataFiles are written by PBS into every snapshot and are not part
+// of the backed up guest or host.
+var pbsMetadataFiles = map[string]bool{
+	pbsManifestFile:   true,
+	"client.log.blob": true,
+}
+
+// PBSClient handles communication with the Proxmox Backup Server API.
+type PBSClient struct {
+	config *PBSConfig
+	// httpClient is used for API calls; downloadClient has no overall
+	// timeout so that large archives can be streamed.
+	httpClient     *http.Client
+	downloadClient *http.Client
+	pollInterval   time.Duration
+	logger         zerolog.Logger
+}
+
+// PBSConfig contains connection settings for Proxmox Backup Server.
+type PBSConfig struct {
+	Host        string
+	Port        int
+	Username    string
+	TokenID     string
+	TokenSecret string
+	// Fingerprint is the SHA-256 fingerprint of the server certificate, as
+	// shown on the PBS dashboard. When set, the certificate is pinned to it
+	// instead of being verified against the system roots.
+	Fingerprint string
+	VerifySSL   bool
+}
+
+// PBSVersion contains version information from the API.
+type PBSVersion struct {
+	Version string `json:"version"`
+	Release string `json:"release"`
+	RepoID  string `json:"repoid"`
+}
+
+// PBSDatastore describes a datastore and its usage.
+type PBSDatastore struct {
+	Name    string `json:"store"`
+	Comment string `json:"comment,omitempty"`
+	Total   int64  `json:"total,omitempty"`
+	Used    int64  `json:"used,omitempty"`
+	Avail   int64  `json:"avail,omitempty"`
+}
+
+// PBSNamespace is a namespace within a datastore. The root namespace has
+// an empty name.
+type PBSNamespace struct {
+	Name    string `json:"ns"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// PBSGroup is a backup group: all snapshots of one guest or host.
+type PBSGroup struct {
+	BackupType  string   `json:"backup-type"` // vm, ct or host
+	BackupID    string   `json:"backup-id"`
+	LastBackup  int64    `json:"last-backup"`
+	BackupCount int      `json:"backup-count"`
+	Owner       string   `json:"owner,omitempty"`
+	Comment     string   `json:"comment,omitempty"`
+	Files       []string `json:"files,omitempty"`
+}
+
+// PBSSnapshot is a single backup snapshot in a group.
+type PBSSnapshot struct {
+	BackupType   string          `json:"backup-type"`
+	BackupID     string          `json:"backup-id"`
+	BackupTime   int64           `json:"backup-time"`
+	Comment      string          `json:"comment,omitempty"`
+	Owner        string          `json:"owner,omitempty"`
+	Protected    bool            `json:"protected,omitempty"`
+	Size         int64           `json:"size,omitempty"`
+	Files        []PBSFile       `json:"files"`
+	Verification *PBSVerifyState `json:"verification,omitempty"`
+}
+
+// PBSFile is an archive within a snapshot.
+type PBSFile struct {
+	Filename  string `json:"filename"`
+	Size      int64  `json:"size,omitempty"`
+	CryptMode string `json:"crypt-mode,omitempty"` // none, encrypt or sign-only
+	// CSum is the SHA-256 checksum PBS records in the snapshot manifest.
+	// For .fidx and .didx indexes it covers the digests of every chunk, so
+	// archives with equal checksums hold the same data. Snapshot listings
+	// leave it empty; see PBSClient.Manifest.
+	CSum string `json:"csum,omitempty"`
+}
+
+// PBSManifest is the index.json.blob manifest PBS writes into every snapshot.
+type PBSManifest struct {
+	BackupType string    `json:"backup-type"`
+	BackupID   string    `json:"backup-id"`
+	BackupTime int64     `json:"backup-time"`
+	Files      []PBSFile `json:"files"`
+}
+
+// File returns the manifest entry of an archive, or nil.
+func (m *PBSManifest) File(filename string) *PBSFile {
+	for i := range m.Files {
+		if m.Files[i].Filename == filename {
+			return &m.Files[i]
+		}
+	}
+	return nil
+}
+
+// PBSVerifyState is the result of the last verification of a snapshot.
+type PBSVerifyState struct {
+	State string `json:"state"` // ok or failed
+	UPID  string `json:"upid"`
+}
+
+// PBSTask is the status of a PBS worker task such as verify or garbage
+// collection.
+type PBSTask struct {
+	UPID       string     `json:"upid"`
+	Type       string     `json:"type"`
+	Status     string     `json:"status"` // running or stopped
+	ExitStatus string     `json:"exitstatus,omitempty"`
+	StartTime  time.Time  `json:"starttime"`
+	EndTime    *time.Time `json:"endtime,omitempty"`
+}
+
+// PBSSnapshotFilter narrows ListSnapshots to a namespace and group.
+type PBSSnapshotFilter struct {
+	Namespace  string
+	BackupType string
+	BackupID   string
+}
+
+// PBSVerifyOptions selects the snapshots checked by Verify. Without a
+// group, the whole namespace is verified.
+type PBSVerifyOptions struct {
+	Namespace  string
+	BackupType string
+	BackupID   string
+	BackupTime int64
+	// IgnoreVerified skips snapshots that verified successfully within
+	// OutdatedAfterDays.
+	IgnoreVerified    bool
+	OutdatedAfterDays int
+}
+
+// PBSPruneItem is the keep or remove decision for one snapshot.
+type PBSPruneItem struct {
+	BackupType string `json:"backup-type"`
+	BackupID   string `json:"backup-id"`
+	BackupTime int64  `json:"backup-time"`
+	Keep       bool   `json:"keep"`
+	Protected  bool   `json:"protected,omitempty"`
+}
+
+// NewPBSClient creates a new Proxmox Backup Server API client.
+func NewPBSClient(config *PBSConfig, logger zerolog.Logger) *PBSClient {
+	if config.Port == 0 {
+		config.Port = DefaultPBSPort
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: !config.VerifySSL}
+	if fp := normalizeFingerprint(config.Fingerprint); fp != "" {
+		// PBS usually runs with a self-signed certificate, so a pinned
+		// fingerprint replaces chain verification.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if got := hex.EncodeToString(sum[:]); got != fp {
+				return fmt.Errorf("certificate fingerprint mismatch: got %s", formatFingerprint(got))
+			}
+			return nil
+		}
+	}
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+
+	return &PBSClient{
+		config: config,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   30 * time.Second,
+		},
+		downloadClient: &http.Client{Transport: transport},
+		pollInterval:   5 * time.Second,
+		logger:         logger.With().Str("component", "pbs_client").Logger(),
+	}
+}
+
+// NewPBSClientFromConnection creates a client from a PBSConnection model.
+func NewPBSClientFromConnection(conn *models.PBSConnection, tokenSecret string, logger zerolog.Logger) *PBSClient {
+	config := &PBSConfig{
+		Host:        conn.Host,
+		Port:        conn.Port,
+		Username:    conn.Username,
+		TokenID:     conn.TokenID,
+		TokenSecret: tokenSecret,
+		Fingerprint: conn.Fingerprint,
+		VerifySSL:   conn.VerifySSL,
+	}
+	return NewPBSClient(config, logger)
+}
+
+// normalizeFingerprint lowercases a fingerprint and strips its colons.
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+}
+
+// formatFingerprint formats a hex fingerprint with colons, as PBS shows it.
+func formatFingerprint(fp string) string {
+	var parts []string
+	for i := 0; i+2 <= len(fp); i += 2 {
+		parts = append(parts, fp[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+// baseURL returns the base API URL.
+func (c *PBSClient) baseURL() string {
+	return fmt.Sprintf("https://%s:%d/api2/json", c.config.Host, c.config.Port)
+}
+
+// authHeader returns the Authorization header value.
+func (c *PBSClient) authHeader() string {
+	return fmt.Sprintf("PBSAPIToken=%s!%s:%s", c.config.Username, c.config.TokenID, c.config.TokenSecret)
+}
+
+// doRequest performs an HTTP request to the PBS API. Parameters are sent
+// in the query string for GET and DELETE and as a form body otherwise.
+func (c *PBSClient) doRequest(ctx context.Context, client *http.Client, method, path string, params url.Values) (*http.Response, error) {
+	reqURL := c.baseURL() + path
+	var body io.Reader
+	if len(params) > 0 {
+		if method == http.MethodGet || method == http.MethodDelete {
+			reqURL += "?" + params.Encode()
+		} else {
+			body = strings.NewReader(params.Encode())
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", c.authHeader())
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+
+	return resp, nil
+}
+
+// call performs an API request and decodes the data field of the response.
+func (c *PBSClient) call(ctx context.Context, method, path string, params url.Values, v interface{}) error {
+	resp, err := c.doRequest(ctx, c.httpClient, method, path, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("api error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var pbsResp proxmoxResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pbsResp); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	if pbsResp.Error != "" {
+		return fmt.Errorf("pbs error: %s", pbsResp.Error)
+	}
+
+	if v != nil && len(pbsResp.Data) > 0 {
+		if err := json.Unmarshal(pbsResp.Data, v); err != nil {
+			return fmt.Errorf("unmarshal data: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// datastorePath returns the admin API path for a datastore.
+func datastorePath(store, suffix string) string {
+	return "/admin/datastore/" + url.PathEscape(store) + suffix
+}
+
+// TestConnection tests the connection to the PBS API.
+func (c *PBSClient) TestConnection(ctx context.Context) error {
+	_, err := c.GetVersion(ctx)
+	return err
+}
+
+// GetVersion retrieves the PBS version information.
+func (c *PBSClient) GetVersion(ctx context.Context) (*PBSVersion, error) {
+	var version PBSVersion
+	if err := c.call(ctx, http.MethodGet, "/version", nil, &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// ListDatastores lists the datastores the token can access, with their
+// usage where the server reports it.
+func (c *PBSClient) ListDatastores(ctx context.Context) ([]PBSDatastore, error) {
+	var stores []PBSDatastore
+	if err := c.call(ctx, http.MethodGet, "/admin/datastore", nil, &stores); err != nil {
+		return nil, err
+	}
+
+	var usage []PBSDatastore
+	if err := c.call(ctx, http.MethodGet, "/status/datastore-usage", nil, &usage); err != nil {
+		// Usage needs Datastore.Audit; listing still works without it.
+		c.logger.Debug().Err(err).Msg("datastore usage unavailable")
+		return stores, nil
+	}
+	byName := make(map[string]PBSDatastore, len(usage))
+	for _, u := range usage {
+		byName[u.Name] = u
+	}
+	for i := range stores {
+		if u, ok := byName[stores[i].Name]; ok {
+			stores[i].Total, stores[i].Used, stores[i].Avail = u.Total, u.Used, u.Avail
+		}
+	}
+
+	return stores, nil
+}
+
+// ListNamespaces lists all namespaces in a datastore, including the root.
+func (c *PBSClient) ListNamespaces(ctx context.Context, store string) ([]PBSNamespace, error) {
+	var namespaces []PBSNamespace
+	if err := c.call(ctx, http.MethodGet, datastorePath(store, "/namespace"), nil, &namespaces); err != nil {
+		return nil, err
+	}
+	return namespaces, nil
+}
+
+// ListGroups lists the backup groups in a namespace.
+func (c *PBSClient) ListGroups(ctx context.Context, store, namespace string) ([]PBSGroup, error) {
+	params := url.Values{}
+	if namespace != "" {
+		params.Set("ns", namespace)
+	}
+
+	var groups []PBSGroup
+	if err := c.call(ctx, http.MethodGet, datastorePath(store, "/groups"), params, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// ListSnapshots lists the snapshots in a namespace, optionally limited to
+// one group, ordered oldest first.
+func (c *PBSClient) ListSnapshots(ctx context.Context, store string, filter PBSSnapshotFilter) ([]PBSSnapshot, error) {
+	params := url.Values{}
+	if filter.Namespace != "" {
+		params.Set("ns", filter.Namespace)
+	}
+	if filter.BackupType != "" {
+		params.Set("backup-type", filter.BackupType)
+	}
+	if filter.BackupID != "" {
+		params.Set("backup-id", filter.BackupID)
+	}
+
+	var snapshots []PBSSnapshot
+	if err := c.call(ctx, http.MethodGet, datastorePath(store, "/snapshots"), params, &snapshots); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].BackupTime < snapshots[j].BackupTime
+	})
+	return snapshots, nil
+}
+
+// DownloadFile streams a decoded archive from a snapshot: the raw disk
+// image for a fixed index, the pxar stream for a dynamic index and the
+// contents of a blob. Encrypted archives cannot be decoded by the server.
+// The caller must close the returned reader.
+func (c *PBSClient) DownloadFile(ctx context.Context, store, namespace string, snap PBSSnapshot, filename string) (io.ReadCloser, error) {
+	params := snapshotParams(namespace, snap)
+	params.Set("file-name", filename)
+
+	resp, err := c.doRequest(ctx, c.downloadClient, http.MethodGet, datastorePath(store, "/download-decoded"), params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("download %s from %s: api error %d: %s", filename, snap.Path(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return resp.Body, nil
+}
+
+// Manifest downloads the manifest of a snapshot, which lists its archives
+// with their checksums.
+func (c *PBSClient) Manifest(ctx context.Context, store, namespace string, snap PBSSnapshot) (*PBSManifest, error) {
+	body, err := c.DownloadFile(ctx, store, namespace, snap, pbsManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var manifest PBSManifest
+	if err := json.NewDecoder(io.LimitReader(body, 16<<20)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest of %s: %w", snap.Path(), err)
+	}
+	return &manifest, nil
+}
+
+// Verify starts a verification task on a datastore and returns its UPID.
+func (c *PBSClient) Verify(ctx context.Context, store string, opts PBSVerifyOptions) (string, error) {
+	params := url.Values{}
+	if opts.Namespace != "" {
+		params.Set("ns", opts.Namespace)
+	}
+	if opts.BackupType != "" {
+		params.Set("backup-type", opts.BackupType)
+	}
+	if opts.BackupID != "" {
+		params.Set("backup-id", opts.BackupID)
+	}
+	if opts.BackupTime > 0 {
+		params.Set("backup-time", strconv.FormatInt(opts.BackupTime, 10))
+	}
+	if opts.IgnoreVerified {
+		params.Set("ignore-verified", "true")
+		if opts.OutdatedAfterDays > 0 {
+			params.Set("outdated-after", strconv.Itoa(opts.OutdatedAfterDays))
+		}
+	}
+
+	var upid string
+	if err := c.call(ctx, http.MethodPost, datastorePath(store, "/verify"), params, &upid); err != nil {
+		return "", fmt.Errorf("start verify on %s: %w", store, err)
+	}
+	return upid, nil
+}
+
+// Prune applies a retention policy to one backup group. With dryRun the
+// decisions are returned without removing anything.
+func (c *PBSClient) Prune(ctx context.Context, store, namespace, backupType, backupID string, policy *models.RetentionPolicy, dryRun bool) ([]PBSPruneItem, error) {
+	if policy == nil {
+		return nil, errors.New("no retention policy")
+	}
+
+	params := url.Values{}
+	params.Set("backup-type", backupType)
+	params.Set("backup-id", backupID)
+	if namespace != "" {
+		params.Set("ns", namespace)
+	}
+	for key, keep := range map[string]int{
+		"keep-last":    policy.KeepLast,
+		"keep-hourly":  policy.KeepHourly,
+		"keep-daily":   policy.KeepDaily,
+		"keep-weekly":  policy.KeepWeekly,
+		"keep-monthly": policy.KeepMonthly,
+		"keep-yearly":  policy.KeepYearly,
+	} {
+		if keep > 0 {
+			params.Set(key, strconv.Itoa(keep))
+		}
+	}
+	if dryRun {
+		params.Set("dry-run", "true")
+	}
+
+	var items []PBSPruneItem
+	if err := c.call(ctx, http.MethodPost, datastorePath(store, "/prune"), params, &items); err != nil {
+		return nil, fmt.Errorf("prune %s/%s: %w", backupType, backupID, err)
+	}
+	return items, nil
+}
+
+// GarbageCollect starts garbage collection on a datastore, which frees the
+// chunks no longer referenced after pruning, and returns the task UPID.
+func (c *PBSClient) GarbageCollect(ctx context.Context, store string) (string, error) {
+	var upid string
+	if err := c.call(ctx, http.MethodPost, datastorePath(store, "/gc"), nil, &upid); err != nil {
+		return "", fmt.Errorf("start garbage collection on %s: %w", store, err)
+	}
+	return upid, nil
+}
+
+// GetTaskStatus retrieves the status of a PBS task.
+func (c *PBSClient) GetTaskStatus(ctx context.Context, upid string) (*PBSTask, error) {
+	path := fmt.Sprintf("/nodes/localhost/tasks/%s/status", url.PathEscape(upid))
+
+	var status struct {
+		Status     string  `json:"status"`
+		ExitStatus string  `json:"exitstatus"`
+		StartTime  float64 `json:"starttime"`
+		EndTime    float64 `json:"endtime,omitempty"`
+		Type       string  `json:"type"`
+	}
+	if err := c.call(ctx, http.MethodGet, path, nil, &status); err != nil {
+		return nil, err
+	}
+
+	task := &PBSTask{
+		UPID:       upid,
+		Type:       status.Type,
+		Status:     status.Status,
+		ExitStatus: status.ExitStatus,
+		StartTime:  time.Unix(int64(status.StartTime), 0),
+	}
+	if status.EndTime > 0 {
+		endTime := time.Unix(int64(status.EndTime), 0)
+		task.EndTime = &endTime
+	}
+
+	return task, nil
+}
+
+// WaitForTask waits for a task to stop and returns an error if it did not
+// finish with status OK.
+func (c *PBSClient) WaitForTask(ctx context.Context, upid string, maxWait time.Duration) (*PBSTask, error) {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	deadline := time.Now().Add(maxWait)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+			if time.Now().After(deadline) {
+				return nil, fmt.Errorf("timeout waiting for task %s", upid)
+			}
+
+			task, err := c.GetTaskStatus(ctx, upid)
+			if err != nil {
+				c.logger.Warn().Err(err).Str("upid", upid).Msg("error checking task status")
+				continue
+			}
+
+			if task.Status == "stopped" {
+				if task.ExitStatus != "OK" {
+					return task, fmt.Errorf("task %s failed: %s", upid, task.ExitStatus)
+				}
+				return task, nil
+			}
+		}
+	}
+}
+
+// snapshotParams returns the parameters identifying a snapshot.
+func snapshotParams(namespace string, snap PBSSnapshot) url.Values {
+	params := url.Values{}
+	params.Set("backup-type", snap.BackupType)
+	params.Set("backup-id", snap.BackupID)
+	params.Set("backup-time", strconv.FormatInt(snap.BackupTime, 10))
+	if namespace != "" {
+		params.Set("ns", namespace)
+	}
+	return params
+}
+
+// Time returns when the snapshot was taken.
+func (s PBSSnapshot) Time() time.Time {
+	return time.Unix(s.BackupTime, 0).UTC()
+}
+
+// Path returns the snapshot path as PBS displays it, such as
+// vm/100/2024-05-01T02:00:00Z.
+func (s PBSSnapshot) Path() string {
+	return s.BackupType + "/" + s.BackupID + "/" + s.Time().Format(time.RFC3339)
+}
+
+// Verified reports whether the last verification of the snapshot passed.
+func (s PBSSnapshot) Verified() bool {
+	return s.Verification != nil && s.Verification.State == "ok"
+}
+
+// ArchiveFiles returns the snapshot's guest data and config archives,
+// leaving out the manifest and client log PBS adds to every snapshot.
+func (s PBSSnapshot) ArchiveFiles() []PBSFile {
+	var files []PBSFile
+	for _, f := range s.Files {
+		if !pbsMetadataFiles[f.Filename] {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Encrypted reports whether the archive was encrypted on the client, in
+// which case the server cannot decode it.
+func (f PBSFile) Encrypted() bool {
+	return f.CryptMode == "encrypt"
+}
+
+// DecodedName returns the name of the archive's decoded content:
+// drive-scsi0.img for drive-scsi0.img.fidx, root.pxar for root.pxar.didx
+// and qemu-server.conf for qemu-server.conf.blob.
+func (f PBSFile) DecodedName() string {
+	for _, suffix := range []string{pbsFixedIndexSuffix, pbsDynamicIndexSuffix, pbsBlobSuffix} {
+		if strings.HasSuffix(f.Filename, suffix) {
+			return strings.TrimSuffix(f.Filename, suffix)
+		}
+	}
+	return f.Filename
+}
@@ -0,0 +1,386 @@
+package vms
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+)
+
+// pbsAPIHandler returns an http.Handler that simulates a Proxmox Backup
+// Server API with a "backups" datastore holding two snapshots of VM 100
+// and one of CT 200. Overrides replace the default handler for a path.
+func pbsAPIHandler(overrides map[string]http.HandlerFunc) http.Handler {
+	defaults := map[string]http.HandlerFunc{
+		"/api2/json/version": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{
+				"data": map[string]string{"version": "3.2", "release": "7", "repoid": "abc"},
+			})
+		},
+		"/api2/json/admin/datastore": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{
+				"data": []map[string]string{{"store": "backups", "comment": "main"}, {"store": "offsite"}},
+			})
+		},
+		"/api2/json/status/datastore-usage": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{
+				"data": []map[string]interface{}{{"store": "backups", "total": 1000, "used": 400, "avail": 600}},
+			})
+		},
+		"/api2/json/admin/datastore/backups/namespace": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{
+				"data": []map[string]string{{"ns": ""}, {"ns": "prod"}},
+			})
+		},
+		"/api2/json/admin/datastore/backups/groups": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{
+				"data": []map[string]interface{}{
+					{"backup-type": "vm", "backup-id": "100", "backup-count": 2, "last-backup": 1714528800},
+					{"backup-type": "ct", "backup-id": "200", "backup-count": 1, "last-backup": 1714528800},
+				},
+			})
+		},
+		"/api2/json/admin/datastore/backups/snapshots": func(w http.ResponseWriter, r *http.Request) {
+			snaps := []map[string]interface{}{
+				{
+					"backup-type": "vm", "backup-id": "100", "backup-time": 1714528800,
+					"files": []map[string]interface{}{
+						{"filename": "index.json.blob", "size": 400},
+						{"filename": "qemu-server.conf.blob", "size": 300, "crypt-mode": "none"},
+						{"filename": "drive-scsi0.img.fidx", "size": 4096, "crypt-mode": "none"},
+					},
+					"verification": map[string]string{"state": "ok", "upid": "UPID:verify1"},
+				},
+				{
+					"backup-type": "vm", "backup-id": "100", "backup-time": 1714442400,
+					"files": []map[string]interface{}{
+						{"filename": "qemu-server.conf.blob", "size": 300, "crypt-mode": "none"},
+						{"filename": "drive-scsi0.img.fidx", "size": 4096, "crypt-mode": "none"},
+					},
+				},
+				{
+					"backup-type": "ct", "backup-id": "200", "backup-time": 1714528800,
+					"files": []map[string]interface{}{
+						{"filename": "pct.conf.blob", "size": 200, "crypt-mode": "none"},
+						{"filename": "root.pxar.didx", "size": 2048, "crypt-mode": "encrypt"},
+						{"filename": "client.log.blob", "size": 100},
+					},
+				},
+			}
+			q := r.URL.Query()
+			var out []map[string]interface{}
+			for _, s := range snaps {
+				if t := q.Get("backup-type"); t != "" && s["backup-type"] != t {
+					continue
+				}
+				if id := q.Get("backup-id"); id != "" && s["backup-id"] != id {
+					continue
+				}
+				out = append(out, s)
+			}
+			writeJSON(w, map[string]interface{}{"data": out})
+		},
+		"/api2/json/admin/datastore/backups/download-decoded": func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			io.WriteString(w, q.Get("backup-type")+"/"+q.Get("backup-id")+"/"+q.Get("backup-time")+"/"+q.Get("file-name"))
+		},
+		"/api2/json/admin/datastore/backups/verify": func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"data": "UPID:pbs:verify"})
+		},
+		"/api2/json/admin/datastore/backups/prune": func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			writeJSON(w, map[string]interface{}{
+				"data": []map[string]interface{}{
+					{"backup-type": r.PostForm.Get("backup-type"), "backup-id": r.PostForm.Get("backup-id"), "backup-time": 1714528800, "keep": true},
+					{"backup-type": r.PostForm.Get("backup-type"), "backup-id": r.PostForm.Get("backup-id"), "backup-time": 1714442400, "keep": false},
+				},
+			})
+		},
+		"/api2/json/admin/datastore/backups/gc": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"data": "UPID:pbs:gc"})
+		},
+		"/api2/json/nodes/localhost/tasks/": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{
+				"data": map[string]interface{}{
+					"status": "stopped", "exitstatus": "OK", "type": "verify",
+					"starttime": float64(1714528800), "endtime": float64(1714529100),
+				},
+			})
+		},
+	}
+
+	mux := http.NewServeMux()
+	for path, handler := range defaults {
+		if override, ok := overrides[path]; ok {
+			handler = override
+		}
+		mux.HandleFunc(path, handler)
+	}
+	return mux
+}
+
+// newTestPBSClient starts a TLS stand-in server and returns a client for it.
+func newTestPBSClient(t *testing.T, overrides map[string]http.HandlerFunc) (*PBSClient, *httptest.Server) {
+	t.Helper()
+	ts := httptest.NewTLSServer(pbsAPIHandler(overrides))
+	t.Cleanup(ts.Close)
+	client := NewPBSClient(testPBSConfig(t, ts), newTestLogger())
+	client.pollInterval = 10 * time.Millisecond
+	return client, ts
+}
+
+func testPBSConfig(t *testing.T, ts *httptest.Server) *PBSConfig {
+	t.Helper()
+	u, _ := url.Parse(ts.URL)
+	host, portStr, _ := net.SplitHostPort(u.Host)
+	port, _ := strconv.Atoi(portStr)
+	return &PBSConfig{
+		Host:        host,
+		Port:        port,
+		Username:    "backup@pbs",
+		TokenID:     "keldris",
+		TokenSecret: "secret",
+	}
+}
+
+func TestPBSClient_GetVersion(t *testing.T) {
+	var auth string
+	client, _ := newTestPBSClient(t, map[string]http.HandlerFunc{
+		"/api2/json/version": func(w http.ResponseWriter, r *http.Request) {
+			auth = r.Header.Get("Authorization")
+			writeJSON(w, map[string]interface{}{"data": map[string]string{"version": "3.2"}})
+		},
+	})
+
+	version, err := client.GetVersion(context.Background())
+	if err != nil {
+		t.Fatalf("GetVersion() error = %v", err)
+	}
+	if version.Version != "3.2" {
+		t.Errorf("Version = %q", version.Version)
+	}
+	if auth != "PBSAPIToken=backup@pbs!keldris:secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
+
+func TestPBSClient_Fingerprint(t *testing.T) {
+	ts := httptest.NewTLSServer(pbsAPIHandler(nil))
+	defer ts.Close()
+	sum := sha256.Sum256(ts.Certificate().Raw)
+
+	config := testPBSConfig(t, ts)
+	config.VerifySSL = true
+	config.Fingerprint = strings.ToUpper(formatFingerprint(hex.EncodeToString(sum[:])))
+	if err := NewPBSClient(config, newTestLogger()).TestConnection(context.Background()); err != nil {
+		t.Errorf("pinned fingerprint rejected: %v", err)
+	}
+
+	config.Fingerprint = strings.Repeat("ab:", 31) + "ab"
+	err := NewPBSClient(config, newTestLogger()).TestConnection(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "fingerprint mismatch") {
+		t.Errorf("TestConnection() error = %v, want fingerprint mismatch", err)
+	}
+
+	// Without a fingerprint, verification uses the system roots.
+	config.Fingerprint = ""
+	if err := NewPBSClient(config, newTestLogger()).TestConnection(context.Background()); err == nil {
+		t.Error("self-signed certificate accepted without a fingerprint")
+	}
+}
+
+func TestPBSClient_ListDatastores(t *testing.T) {
+	client, _ := newTestPBSClient(t, nil)
+
+	stores, err := client.ListDatastores(context.Background())
+	if err != nil {
+		t.Fatalf("ListDatastores() error = %v", err)
+	}
+	if len(stores) != 2 {
+		t.Fatalf("got %d datastores, want 2", len(stores))
+	}
+	if stores[0].Name != "backups" || stores[0].Used != 400 || stores[0].Avail != 600 {
+		t.Errorf("stores[0] = %+v", stores[0])
+	}
+	if stores[1].Name != "offsite" || stores[1].Total != 0 {
+		t.Errorf("stores[1] = %+v", stores[1])
+	}
+
+	// Usage is optional.
+	client, _ = newTestPBSClient(t, map[string]http.HandlerFunc{
+		"/api2/json/status/datastore-usage": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "permission check failed", http.StatusForbidden)
+		},
+	})
+	if stores, err := client.ListDatastores(context.Background()); err != nil || len(stores) != 2 {
+		t.Errorf("ListDatastores() without usage = %v, %v", stores, err)
+	}
+}
+
+func TestPBSClient_ListSnapshots(t *testing.T) {
+	var query url.Values
+	client, _ := newTestPBSClient(t, map[string]http.HandlerFunc{
+		"/api2/json/admin/datastore/backups/snapshots": func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			writeJSON(w, map[string]interface{}{
+				"data": []map[string]interface{}{
+					{"backup-type": "vm", "backup-id": "100", "backup-time": 1714528800},
+					{"backup-type": "vm", "backup-id": "100", "backup-time": 1714442400},
+				},
+			})
+		},
+	})
+
+	snaps, err := client.ListSnapshots(context.Background(), "backups", PBSSnapshotFilter{Namespace: "prod", BackupType: "vm", BackupID: "100"})
+	if err != nil {
+		t.Fatalf("ListSnapshots() error = %v", err)
+	}
+	if query.Get("ns") != "prod" || query.Get("backup-type") != "vm" || query.Get("backup-id") != "100" {
+		t.Errorf("query = %v", query)
+	}
+	if len(snaps) != 2 || snaps[0].BackupTime != 1714442400 {
+		t.Fatalf("snapshots = %+v, want oldest first", snaps)
+	}
+	if got := snaps[1].Path(); got != "vm/100/2024-05-01T02:00:00Z" {
+		t.Errorf("Path() = %q", got)
+	}
+}
+
+func TestPBSClient_DownloadFile(t *testing.T) {
+	client, _ := newTestPBSClient(t, nil)
+	snap := PBSSnapshot{BackupType: "vm", BackupID: "100", BackupTime: 1714528800}
+
+	body, err := client.DownloadFile(context.Background(), "backups", "", snap, "drive-scsi0.img.fidx")
+	if err != nil {
+		t.Fatalf("DownloadFile() error = %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "vm/100/1714528800/drive-scsi0.img.fidx" {
+		t.Errorf("downloaded %q", data)
+	}
+
+	client, _ = newTestPBSClient(t, map[string]http.HandlerFunc{
+		"/api2/json/admin/datastore/backups/download-decoded": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unable to decode encrypted archive", http.StatusBadRequest)
+		},
+	})
+	_, err = client.DownloadFile(context.Background(), "backups", "", snap, "root.pxar.didx")
+	if err == nil || !strings.Contains(err.Error(), "encrypted archive") {
+		t.Errorf("DownloadFile() error = %v", err)
+	}
+}
+
+func TestPBSClient_Verify(t *testing.T) {
+	var form url.Values
+	client, _ := newTestPBSClient(t, map[string]http.HandlerFunc{
+		"/api2/json/admin/datastore/backups/verify": func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			form = r.PostForm
+			writeJSON(w, map[string]interface{}{"data": "UPID:pbs:verify"})
+		},
+	})
+
+	upid, err := client.Verify(context.Background(), "backups", PBSVerifyOptions{
+		Namespace: "prod", BackupType: "vm", BackupID: "100", IgnoreVerified: true, OutdatedAfterDays: 30,
+	})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if upid != "UPID:pbs:verify" {
+		t.Errorf("upid = %q", upid)
+	}
+	want := url.Values{"ns": {"prod"}, "backup-type": {"vm"}, "backup-id": {"100"}, "ignore-verified": {"true"}, "outdated-after": {"30"}}
+	if form.Encode() != want.Encode() {
+		t.Errorf("form = %v, want %v", form, want)
+	}
+}
+
+func TestPBSClient_Prune(t *testing.T) {
+	var form url.Values
+	client, _ := newTestPBSClient(t, map[string]http.HandlerFunc{
+		"/api2/json/admin/datastore/backups/prune": func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			form = r.PostForm
+			writeJSON(w, map[string]interface{}{
+				"data": []map[string]interface{}{{"backup-type": "vm", "backup-id": "100", "backup-time": 1, "keep": false}},
+			})
+		},
+	})
+
+	items, err := client.Prune(context.Background(), "backups", "", "vm", "100", &models.RetentionPolicy{KeepLast: 3, KeepDaily: 7}, true)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if len(items) != 1 || items[0].Keep {
+		t.Errorf("items = %+v", items)
+	}
+	want := url.Values{"backup-type": {"vm"}, "backup-id": {"100"}, "keep-last": {"3"}, "keep-daily": {"7"}, "dry-run": {"true"}}
+	if form.Encode() != want.Encode() {
+		t.Errorf("form = %v, want %v", form, want)
+	}
+
+	if _, err := client.Prune(context.Background(), "backups", "", "vm", "100", nil, true); err == nil {
+		t.Error("expected error without retention policy")
+	}
+}
+
+func TestPBSClient_WaitForTask(t *testing.T) {
+	client, _ := newTestPBSClient(t, nil)
+	task, err := client.WaitForTask(context.Background(), "UPID:pbs:verify", time.Second)
+	if err != nil {
+		t.Fatalf("WaitForTask() error = %v", err)
+	}
+	if task.Type != "verify" || task.EndTime == nil {
+		t.Errorf("task = %+v", task)
+	}
+
+	client, _ = newTestPBSClient(t, map[string]http.HandlerFunc{
+		"/api2/json/nodes/localhost/tasks/": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{
+				"data": map[string]interface{}{"status": "stopped", "exitstatus": "verification failed - 1 chunk corrupt"},
+			})
+		},
+	})
+	if _, err := client.WaitForTask(context.Background(), "UPID:pbs:verify", time.Second); err == nil || !strings.Contains(err.Error(), "chunk corrupt") {
+		t.Errorf("WaitForTask() error = %v, want task failure", err)
+	}
+}
+
+func TestPBSSnapshot_ArchiveFiles(t *testing.T) {
+	snap := PBSSnapshot{Files: []PBSFile{
+		{Filename: "index.json.blob"},
+		{Filename: "qemu-server.conf.blob"},
+		{Filename: "drive-scsi0.img.fidx"},
+		{Filename: "root.pxar.didx", CryptMode: "encrypt"},
+		{Filename: "client.log.blob"},
+	}}
+
+	var names []string
+	for _, f := range snap.ArchiveFiles() {
+		names = append(names, f.DecodedName())
+	}
+	if got := strings.Join(names, ","); got != "qemu-server.conf,drive-scsi0.img,root.pxar" {
+		t.Errorf("archives = %s", got)
+	}
+	if !snap.Files[3].Encrypted() || snap.Files[2].Encrypted() {
+		t.Error("Encrypted() mismatch")
+	}
+	if snap.Verified() {
+		t.Error("unverified snapshot reported as verified")
+	}
+}
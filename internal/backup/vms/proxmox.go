@@ -21,9 +21,10 @@ import (
 
 // ProxmoxClient handles communication with the Proxmox VE API.
 type ProxmoxClient struct {
-	config     *ProxmoxConfig
-	httpClient *http.Client
-	logger     zerolog.Logger
+	config       *ProxmoxConfig
+	httpClient   *http.Client
+	pollInterval time.Duration
+	logger       zerolog.Logger
 }
 
 // ProxmoxConfig contains connection settings for Proxmox VE.
@@ -103,7 +104,8 @@ func NewProxmoxClient(config *ProxmoxConfig, logger zerolog.Logger) *ProxmoxClie
 			Transport: transport,
 			Timeout:   30 * time.Second,
 		},
-		logger: logger.With().Str("component", "proxmox_client").Logger(),
+		pollInterval: 5 * time.Second,
+		logger:       logger.With().Str("component", "proxmox_client").Logger(),
 	}
 }
 
@@ -343,7 +345,7 @@ func (c *ProxmoxClient) GetTaskStatus(ctx context.Context, upid string) (*Backup
 
 // WaitForTask waits for a task to complete with timeout.
 func (c *ProxmoxClient) WaitForTask(ctx context.Context, upid string, maxWait time.Duration) (*BackupJob, error) {
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(c.pollInterval)
 	defer ticker.Stop()
 
 	deadline := time.Now().Add(maxWait)
@@ -0,0 +1,221 @@
+package vms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vzdumpFilenamePattern matches archive names written by vzdump, e.g.
+// vzdump-qemu-100-2024_05_01-02_00_00.vma.zst.
+var vzdumpFilenamePattern = regexp.MustCompile(`^vzdump-(qemu|lxc)-(\d+)-\d{4}_\d{2}_\d{2}-\d{2}_\d{2}_\d{2}\.(vma|tar)(\.(zst|gz|lzo))?$`)
+
+// ParseVzdumpFilename returns the guest type (qemu or lxc) and VMID encoded
+// in a vzdump archive name.
+func ParseVzdumpFilename(name string) (guestType string, vmid int, ok bool) {
+	m := vzdumpFilenamePattern.FindStringSubmatch(name)
+	if m == nil {
+		return "", 0, false
+	}
+	vmid, err := strconv.Atoi(m[2])
+	if err != nil {
+		return "", 0, false
+	}
+	return m[1], vmid, true
+}
+
+// BackupVolid returns the volume ID of a backup file on a storage.
+func BackupVolid(storage, filename string) string {
+	return storage + ":backup/" + filename
+}
+
+// GuestRestoreOptions contains options for restoring a vzdump archive.
+type GuestRestoreOptions struct {
+	VMID    int
+	Type    string // qemu or lxc
+	Archive string // volid of the vzdump archive
+	Storage string // Storage for the restored disks; empty keeps the storages in the archive
+	Force   bool   // Overwrite an existing guest with the same VMID
+	Unique  bool   // Assign new MAC addresses
+}
+
+// GuestStatus is the current state of a VM or container.
+type GuestStatus struct {
+	Status    string `json:"status"`
+	QMPStatus string `json:"qmpstatus,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Uptime    int64  `json:"uptime"`
+	Agent     int    `json:"agent,omitempty"` // 1 if the QEMU guest agent is enabled
+}
+
+// ForNode returns a client for another node of the same cluster. API
+// tokens are cluster-wide, so the connection settings are reused.
+func (c *ProxmoxClient) ForNode(node string) *ProxmoxClient {
+	config := *c.config
+	config.Node = node
+	return &ProxmoxClient{
+		config:       &config,
+		httpClient:   c.httpClient,
+		pollInterval: c.pollInterval,
+		logger:       c.logger,
+	}
+}
+
+// Node returns the node the client operates on.
+func (c *ProxmoxClient) Node() string {
+	return c.config.Node
+}
+
+// SetPollInterval sets how often WaitForTask checks a task's status.
+func (c *ProxmoxClient) SetPollInterval(d time.Duration) {
+	c.pollInterval = d
+}
+
+// NextVMID returns the next free VMID in the cluster.
+func (c *ProxmoxClient) NextVMID(ctx context.Context) (int, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/cluster/nextid", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	// Depending on the version the ID is returned as a string or a number.
+	var raw json.RawMessage
+	if err := c.parseResponse(resp, &raw); err != nil {
+		return 0, err
+	}
+	vmid, err := strconv.Atoi(strings.Trim(string(raw), `"`))
+	if err != nil {
+		return 0, fmt.Errorf("parse next vmid %s: %w", raw, err)
+	}
+	return vmid, nil
+}
+
+// UploadBackup streams a vzdump archive of the given size to a storage on
+// the node and returns the UPID of the task that moves it into place. The
+// storage must allow backup content. A reader that ends early fails the
+// upload rather than leaving a truncated archive.
+func (c *ProxmoxClient) UploadBackup(ctx context.Context, storage, filename string, size int64, r io.Reader) (string, error) {
+	var head bytes.Buffer
+	mw := multipart.NewWriter(&head)
+	if err := mw.WriteField("content", "backup"); err != nil {
+		return "", err
+	}
+	if _, err := mw.CreateFormFile("filename", filename); err != nil {
+		return "", err
+	}
+	prefix := append([]byte(nil), head.Bytes()...)
+	head.Reset()
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+	suffix := head.Bytes()
+
+	path := fmt.Sprintf("/nodes/%s/storage/%s/upload", c.config.Node, storage)
+	body := io.MultiReader(bytes.NewReader(prefix), r, bytes.NewReader(suffix))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL()+path, body)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.ContentLength = int64(len(prefix)) + size + int64(len(suffix))
+	req.Header.Set("Authorization", c.authHeader())
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	// Archives can take far longer than the API timeout to transfer.
+	uploadClient := &http.Client{Transport: c.httpClient.Transport}
+	resp, err := uploadClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("upload %s: %w", filename, err)
+	}
+
+	var upid string
+	if err := c.parseResponse(resp, &upid); err != nil {
+		return "", err
+	}
+	return upid, nil
+}
+
+// RestoreGuest restores a vzdump archive as a VM (qmrestore) or container
+// (pct restore) on the node and returns the UPID of the restore task.
+func (c *ProxmoxClient) RestoreGuest(ctx context.Context, opts GuestRestoreOptions) (string, error) {
+	params := url.Values{}
+	params.Set("vmid", strconv.Itoa(opts.VMID))
+	switch opts.Type {
+	case "qemu":
+		params.Set("archive", opts.Archive)
+	case "lxc":
+		params.Set("ostemplate", opts.Archive)
+		params.Set("restore", "1")
+	default:
+		return "", fmt.Errorf("unsupported guest type: %s", opts.Type)
+	}
+	if opts.Storage != "" {
+		params.Set("storage", opts.Storage)
+	}
+	if opts.Force {
+		params.Set("force", "1")
+	}
+	if opts.Unique {
+		params.Set("unique", "1")
+	}
+
+	path := fmt.Sprintf("/nodes/%s/%s", c.config.Node, opts.Type)
+	resp, err := c.doRequest(ctx, http.MethodPost, path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	var upid string
+	if err := c.parseResponse(resp, &upid); err != nil {
+		return "", err
+	}
+	return upid, nil
+}
+
+// StartGuest starts a VM or container and returns the UPID of the start task.
+func (c *ProxmoxClient) StartGuest(ctx context.Context, guestType string, vmid int) (string, error) {
+	path := fmt.Sprintf("/nodes/%s/%s/%d/status/start", c.config.Node, guestType, vmid)
+	resp, err := c.doRequest(ctx, http.MethodPost, path, strings.NewReader(""))
+	if err != nil {
+		return "", err
+	}
+
+	var upid string
+	if err := c.parseResponse(resp, &upid); err != nil {
+		return "", err
+	}
+	return upid, nil
+}
+
+// GetGuestStatus retrieves the current status of a VM or container.
+func (c *ProxmoxClient) GetGuestStatus(ctx context.Context, guestType string, vmid int) (*GuestStatus, error) {
+	path := fmt.Sprintf("/nodes/%s/%s/%d/status/current", c.config.Node, guestType, vmid)
+	resp, err := c.doRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var status GuestStatus
+	if err := c.parseResponse(resp, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// PingGuestAgent checks that the QEMU guest agent of a VM responds.
+func (c *ProxmoxClient) PingGuestAgent(ctx context.Context, vmid int) error {
+	path := fmt.Sprintf("/nodes/%s/qemu/%d/agent/ping", c.config.Node, vmid)
+	resp, err := c.doRequest(ctx, http.MethodPost, path, strings.NewReader(""))
+	if err != nil {
+		return err
+	}
+	return c.parseResponse(resp, nil)
+}
@@ -0,0 +1,165 @@
+package vms
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseVzdumpFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantType string
+		wantVMID int
+		wantOK   bool
+	}{
+		{"vzdump-qemu-100-2024_05_01-02_00_00.vma.zst", "qemu", 100, true},
+		{"vzdump-lxc-2001-2024_05_01-02_00_00.tar.gz", "lxc", 2001, true},
+		{"vzdump-qemu-100-2024_05_01-02_00_00.vma", "qemu", 100, true},
+		{"vzdump-qemu-100-2024_05_01-02_00_00.log", "", 0, false},
+		{"vm-100-drive-scsi0.img", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guestType, vmid, ok := ParseVzdumpFilename(tt.name)
+			if guestType != tt.wantType || vmid != tt.wantVMID || ok != tt.wantOK {
+				t.Errorf("ParseVzdumpFilename() = %q, %d, %v", guestType, vmid, ok)
+			}
+		})
+	}
+}
+
+func TestProxmoxClient_UploadBackup(t *testing.T) {
+	var gotContent, gotName, gotData string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api2/json/nodes/pve2/storage/local/upload" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		gotContent = r.FormValue("content")
+		file, header, err := r.FormFile("filename")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		gotName, gotData = header.Filename, string(data)
+		writeJSON(w, map[string]interface{}{"data": "UPID:pve2:upload"})
+	}))
+	defer ts.Close()
+
+	client := newTestClientHTTP(ts).ForNode("pve2")
+	archive := "vzdump-qemu-100-2024_05_01-02_00_00.vma.zst"
+
+	upid, err := client.UploadBackup(context.Background(), "local", archive, 7, strings.NewReader("archive"))
+	if err != nil {
+		t.Fatalf("UploadBackup() error = %v", err)
+	}
+	if upid != "UPID:pve2:upload" {
+		t.Errorf("upid = %q", upid)
+	}
+	if gotContent != "backup" || gotName != archive || gotData != "archive" {
+		t.Errorf("upload = %q %q %q", gotContent, gotName, gotData)
+	}
+
+	// A stream shorter than announced must not reach the storage.
+	gotData = ""
+	if _, err := client.UploadBackup(context.Background(), "local", archive, 1024, strings.NewReader("partial")); err == nil {
+		t.Fatal("expected error for a short archive stream")
+	}
+	if gotData != "" {
+		t.Errorf("server received a truncated archive %q", gotData)
+	}
+}
+
+func TestProxmoxClient_RestoreGuest(t *testing.T) {
+	forms := map[string]url.Values{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		forms[r.URL.Path] = r.PostForm
+		writeJSON(w, map[string]interface{}{"data": "UPID:pve2:restore"})
+	}))
+	defer ts.Close()
+
+	client := newTestClientHTTP(ts).ForNode("pve2")
+
+	if _, err := client.RestoreGuest(context.Background(), GuestRestoreOptions{
+		VMID: 900, Type: "qemu", Archive: "local:backup/vzdump-qemu-100.vma.zst", Storage: "local-lvm", Unique: true,
+	}); err != nil {
+		t.Fatalf("RestoreGuest(qemu) error = %v", err)
+	}
+	want := url.Values{"vmid": {"900"}, "archive": {"local:backup/vzdump-qemu-100.vma.zst"}, "storage": {"local-lvm"}, "unique": {"1"}}
+	if got := forms["/api2/json/nodes/pve2/qemu"]; got.Encode() != want.Encode() {
+		t.Errorf("qemu form = %v, want %v", got, want)
+	}
+
+	if _, err := client.RestoreGuest(context.Background(), GuestRestoreOptions{
+		VMID: 901, Type: "lxc", Archive: "local:backup/vzdump-lxc-200.tar.zst", Force: true,
+	}); err != nil {
+		t.Fatalf("RestoreGuest(lxc) error = %v", err)
+	}
+	want = url.Values{"vmid": {"901"}, "ostemplate": {"local:backup/vzdump-lxc-200.tar.zst"}, "restore": {"1"}, "force": {"1"}}
+	if got := forms["/api2/json/nodes/pve2/lxc"]; got.Encode() != want.Encode() {
+		t.Errorf("lxc form = %v, want %v", got, want)
+	}
+
+	if _, err := client.RestoreGuest(context.Background(), GuestRestoreOptions{VMID: 902, Type: "openvz"}); err == nil {
+		t.Error("expected error for unsupported guest type")
+	}
+}
+
+func TestProxmoxClient_NextVMID(t *testing.T) {
+	for _, data := range []interface{}{"105", 105} {
+		ts := httptest.NewServer(proxmoxAPIHandler(map[string]http.HandlerFunc{
+			"/api2/json/cluster/nextid": func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, map[string]interface{}{"data": data})
+			},
+		}))
+		vmid, err := newTestClientHTTP(ts).NextVMID(context.Background())
+		ts.Close()
+		if err != nil || vmid != 105 {
+			t.Errorf("NextVMID() = %d, %v for %#v", vmid, err, data)
+		}
+	}
+}
+
+func TestProxmoxClient_GuestStatusAndAgent(t *testing.T) {
+	ts := httptest.NewServer(proxmoxAPIHandler(map[string]http.HandlerFunc{
+		"/api2/json/nodes/pve1/qemu/900/status/current": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"data": map[string]interface{}{
+				"status": "running", "qmpstatus": "running", "uptime": 12, "agent": 1,
+			}})
+		},
+		"/api2/json/nodes/pve1/qemu/900/agent/ping": func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"data": nil})
+		},
+	}))
+	defer ts.Close()
+	client := newTestClientHTTP(ts)
+
+	status, err := client.GetGuestStatus(context.Background(), "qemu", 900)
+	if err != nil {
+		t.Fatalf("GetGuestStatus() error = %v", err)
+	}
+	if status.Status != "running" || status.Agent != 1 || status.Uptime != 12 {
+		t.Errorf("status = %+v", status)
+	}
+	if err := client.PingGuestAgent(context.Background(), 900); err != nil {
+		t.Errorf("PingGuestAgent() error = %v", err)
+	}
+	if err := client.PingGuestAgent(context.Background(), 901); err == nil {
+		t.Error("expected error for a VM without a responding agent")
+	}
+}
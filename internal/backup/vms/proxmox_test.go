@@ -1029,9 +1029,10 @@ func newTestClientHTTP(ts *httptest.Server) *ProxmoxClient {
 	}
 
 	client := &ProxmoxClient{
-		config:     config,
-		httpClient: ts.Client(),
-		logger:     newTestLogger(),
+		config:       config,
+		httpClient:   ts.Client(),
+		pollInterval: 5 * time.Second,
+		logger:       newTestLogger(),
 	}
 
 	// Override baseURL to use http:// instead of https://
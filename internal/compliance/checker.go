@@ -0,0 +1,243 @@
+package compliance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// Store defines the database operations needed by the compliance checker.
+type Store interface {
+	GetAllOrganizations(ctx context.Context) ([]*models.Organization, error)
+	GetAgentsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.Agent, error)
+	GetEnabledSchedulesByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.Schedule, error)
+	GetScheduleRepositories(ctx context.Context, scheduleID uuid.UUID) ([]models.ScheduleRepository, error)
+	GetComplianceRepositories(ctx context.Context, orgID uuid.UUID) ([]*models.ComplianceRepository, error)
+	ListGeoReplicationConfigsByOrg(ctx context.Context, orgID uuid.UUID) ([]*models.GeoReplicationConfig, error)
+	GetScheduleCompliancesByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.ScheduleCompliance, error)
+	UpsertScheduleCompliance(ctx context.Context, c *models.ScheduleCompliance) error
+}
+
+// AlertService defines the interface for raising and resolving compliance alerts.
+type AlertService interface {
+	CreateAlert(ctx context.Context, alert *models.Alert) error
+	ResolveAlertByResourceAndType(ctx context.Context, orgID uuid.UUID, resourceType models.ResourceType, resourceID uuid.UUID, alertType models.AlertType) error
+}
+
+// Config holds the configuration for the compliance checker.
+type Config struct {
+	// CheckInterval is how often every organization is re-evaluated.
+	CheckInterval time.Duration
+}
+
+// DefaultConfig returns a Config with sensible defaults.
+func DefaultConfig() Config {
+	return Config{
+		CheckInterval: 1 * time.Hour,
+	}
+}
+
+// Checker periodically evaluates 3-2-1 compliance, stores the results and
+// alerts when a previously compliant schedule drops out.
+type Checker struct {
+	store        Store
+	alertService AlertService
+	config       Config
+	logger       zerolog.Logger
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewChecker creates a new Checker instance.
+func NewChecker(store Store, alertService AlertService, config Config, logger zerolog.Logger) *Checker {
+	return &Checker{
+		store:        store,
+		alertService: alertService,
+		config:       config,
+		logger:       logger.With().Str("component", "compliance_checker").Logger(),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+// Start begins the compliance check loop.
+func (c *Checker) Start(ctx context.Context) {
+	c.wg.Add(1)
+	go c.run(ctx)
+	c.logger.Info().
+		Dur("check_interval", c.config.CheckInterval).
+		Msg("compliance checker started")
+}
+
+// Stop gracefully stops the compliance check loop.
+func (c *Checker) Stop() {
+	close(c.stopCh)
+	c.wg.Wait()
+	c.logger.Info().Msg("compliance checker stopped")
+}
+
+func (c *Checker) run(ctx context.Context) {
+	defer c.wg.Done()
+
+	// Run immediately on start
+	c.CheckAll(ctx)
+
+	ticker := time.NewTicker(c.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+			c.CheckAll(ctx)
+		}
+	}
+}
+
+// CheckAll evaluates every organization. Failures are logged per organization
+// so one bad org does not stop the others from being checked.
+func (c *Checker) CheckAll(ctx context.Context) {
+	orgs, err := c.store.GetAllOrganizations(ctx)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("failed to list organizations")
+		return
+	}
+	for _, org := range orgs {
+		if err := c.CheckOrg(ctx, org.ID); err != nil {
+			c.logger.Error().Err(err).Str("org_id", org.ID.String()).Msg("compliance check failed")
+		}
+	}
+}
+
+// CheckOrg evaluates an organization, stores the schedule results and raises
+// or resolves alerts for schedules whose compliance changed.
+func (c *Checker) CheckOrg(ctx context.Context, orgID uuid.UUID) error {
+	previous, err := c.store.GetScheduleCompliancesByOrgID(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("get previous compliance: %w", err)
+	}
+	wasCompliant := make(map[uuid.UUID]bool, len(previous))
+	for _, p := range previous {
+		wasCompliant[p.ScheduleID] = p.Compliant
+	}
+
+	report, err := c.EvaluateOrg(ctx, orgID)
+	if err != nil {
+		return err
+	}
+
+	for _, agent := range report.Agents {
+		for _, s := range agent.Schedules {
+			if err := c.store.UpsertScheduleCompliance(ctx, s); err != nil {
+				return fmt.Errorf("store compliance for schedule %s: %w", s.ScheduleID, err)
+			}
+
+			prev, known := wasCompliant[s.ScheduleID]
+			switch {
+			case known && prev && !s.Compliant:
+				c.raiseAlert(ctx, agent, s)
+			case known && !prev && s.Compliant:
+				if err := c.alertService.ResolveAlertByResourceAndType(ctx, orgID, models.ResourceTypeSchedule, s.ScheduleID, models.AlertTypeBackupCompliance); err != nil {
+					c.logger.Error().Err(err).Str("schedule_id", s.ScheduleID.String()).Msg("failed to resolve compliance alert")
+				}
+			}
+		}
+	}
+
+	c.logger.Debug().
+		Str("org_id", orgID.String()).
+		Int("score", report.Score).
+		Int("compliant_schedules", report.CompliantSchedules).
+		Int("total_schedules", report.TotalSchedules).
+		Msg("compliance evaluated")
+	return nil
+}
+
+// EvaluateOrg scores every agent and enabled schedule of an organization
+// without storing the results.
+func (c *Checker) EvaluateOrg(ctx context.Context, orgID uuid.UUID) (*models.BackupComplianceReport, error) {
+	agents, err := c.store.GetAgentsByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("get agents: %w", err)
+	}
+	schedules, err := c.store.GetEnabledSchedulesByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("get schedules: %w", err)
+	}
+	repos, err := c.store.GetComplianceRepositories(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("get repositories: %w", err)
+	}
+	replications, err := c.store.ListGeoReplicationConfigsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("get geo-replication configs: %w", err)
+	}
+	inv := NewInventory(repos, replications)
+
+	now := time.Now()
+	byAgent := make(map[uuid.UUID][]*models.ScheduleCompliance)
+	for _, schedule := range schedules {
+		repositories, err := c.store.GetScheduleRepositories(ctx, schedule.ID)
+		if err != nil {
+			return nil, fmt.Errorf("get repositories for schedule %s: %w", schedule.ID, err)
+		}
+		schedule.Repositories = repositories
+		byAgent[schedule.AgentID] = append(byAgent[schedule.AgentID], EvaluateSchedule(orgID, schedule, inv, now))
+	}
+
+	report := &models.BackupComplianceReport{
+		OrgID:       orgID,
+		Agents:      make([]*models.AgentCompliance, 0, len(agents)),
+		EvaluatedAt: now,
+	}
+	total := 0
+	for _, agent := range agents {
+		ac := EvaluateAgent(agent, byAgent[agent.ID])
+		report.Agents = append(report.Agents, ac)
+		total += ac.Score
+		if ac.Compliant {
+			report.CompliantAgents++
+		}
+		for _, s := range ac.Schedules {
+			report.TotalSchedules++
+			if s.Compliant {
+				report.CompliantSchedules++
+			}
+		}
+	}
+	report.TotalAgents = len(agents)
+	if report.TotalAgents > 0 {
+		report.Score = total / report.TotalAgents
+	}
+	return report, nil
+}
+
+func (c *Checker) raiseAlert(ctx context.Context, agent *models.AgentCompliance, s *models.ScheduleCompliance) {
+	alert := models.NewAlert(
+		s.OrgID,
+		models.AlertTypeBackupCompliance,
+		models.AlertSeverityWarning,
+		fmt.Sprintf("3-2-1 compliance lost: %s", s.ScheduleName),
+		fmt.Sprintf("Schedule %q on %s no longer meets the 3-2-1 backup rule: %s.",
+			s.ScheduleName, agent.Hostname, strings.Join(s.Gaps, "; ")),
+	)
+	alert.SetResource(models.ResourceTypeSchedule, s.ScheduleID)
+	alert.Metadata = map[string]any{
+		"agent_id": s.AgentID.String(),
+		"hostname": agent.Hostname,
+		"score":    s.Score,
+		"gaps":     s.Gaps,
+	}
+	if err := c.alertService.CreateAlert(ctx, alert); err != nil {
+		c.logger.Error().Err(err).Str("schedule_id", s.ScheduleID.String()).Msg("failed to create compliance alert")
+	}
+}
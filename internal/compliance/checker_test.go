@@ -0,0 +1,159 @@
+package compliance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockStore struct {
+	orgs         []*models.Organization
+	agents       []*models.Agent
+	schedules    []*models.Schedule
+	scheduleRepo map[uuid.UUID][]models.ScheduleRepository
+	repos        []*models.ComplianceRepository
+	stored       map[uuid.UUID]*models.ScheduleCompliance
+}
+
+func (m *mockStore) GetAllOrganizations(_ context.Context) ([]*models.Organization, error) {
+	return m.orgs, nil
+}
+
+func (m *mockStore) GetAgentsByOrgID(_ context.Context, _ uuid.UUID) ([]*models.Agent, error) {
+	return m.agents, nil
+}
+
+func (m *mockStore) GetEnabledSchedulesByOrgID(_ context.Context, _ uuid.UUID) ([]*models.Schedule, error) {
+	return m.schedules, nil
+}
+
+func (m *mockStore) GetScheduleRepositories(_ context.Context, scheduleID uuid.UUID) ([]models.ScheduleRepository, error) {
+	return m.scheduleRepo[scheduleID], nil
+}
+
+func (m *mockStore) GetComplianceRepositories(_ context.Context, _ uuid.UUID) ([]*models.ComplianceRepository, error) {
+	return m.repos, nil
+}
+
+func (m *mockStore) ListGeoReplicationConfigsByOrg(_ context.Context, _ uuid.UUID) ([]*models.GeoReplicationConfig, error) {
+	return nil, nil
+}
+
+func (m *mockStore) GetScheduleCompliancesByOrgID(_ context.Context, _ uuid.UUID) ([]*models.ScheduleCompliance, error) {
+	var results []*models.ScheduleCompliance
+	for _, c := range m.stored {
+		results = append(results, c)
+	}
+	return results, nil
+}
+
+func (m *mockStore) UpsertScheduleCompliance(_ context.Context, c *models.ScheduleCompliance) error {
+	m.stored[c.ScheduleID] = c
+	return nil
+}
+
+type mockAlertService struct {
+	created  []*models.Alert
+	resolved []uuid.UUID
+}
+
+func (m *mockAlertService) CreateAlert(_ context.Context, alert *models.Alert) error {
+	m.created = append(m.created, alert)
+	return nil
+}
+
+func (m *mockAlertService) ResolveAlertByResourceAndType(_ context.Context, _ uuid.UUID, _ models.ResourceType, resourceID uuid.UUID, _ models.AlertType) error {
+	m.resolved = append(m.resolved, resourceID)
+	return nil
+}
+
+func TestChecker_CheckOrg(t *testing.T) {
+	ctx := context.Background()
+	orgID := uuid.New()
+	agent := &models.Agent{ID: uuid.New(), OrgID: orgID, Hostname: "web-01"}
+	nas := testRepo("nas", models.RepositoryTypeLocal, "")
+	s3 := testRepo("s3", models.RepositoryTypeS3, "")
+	schedule := testSchedule(nas, s3)
+	schedule.AgentID = agent.ID
+
+	store := &mockStore{
+		agents:       []*models.Agent{agent},
+		schedules:    []*models.Schedule{schedule},
+		scheduleRepo: map[uuid.UUID][]models.ScheduleRepository{schedule.ID: schedule.Repositories},
+		repos:        []*models.ComplianceRepository{nas, s3},
+		stored:       make(map[uuid.UUID]*models.ScheduleCompliance),
+	}
+	alerts := &mockAlertService{}
+	checker := NewChecker(store, alerts, DefaultConfig(), zerolog.Nop())
+
+	// First evaluation only records the baseline.
+	if err := checker.CheckOrg(ctx, orgID); err != nil {
+		t.Fatalf("CheckOrg() error = %v", err)
+	}
+	if c := store.stored[schedule.ID]; c == nil || !c.Compliant {
+		t.Fatalf("stored = %+v", c)
+	}
+	if len(alerts.created) != 0 {
+		t.Fatalf("unexpected alerts: %d", len(alerts.created))
+	}
+
+	// The cloud copy is retired: the schedule drops out and is alerted once.
+	s3.ReadOnly = true
+	for range 2 {
+		if err := checker.CheckOrg(ctx, orgID); err != nil {
+			t.Fatalf("CheckOrg() error = %v", err)
+		}
+	}
+	if len(alerts.created) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(alerts.created))
+	}
+	alert := alerts.created[0]
+	if alert.Type != models.AlertTypeBackupCompliance || *alert.ResourceID != schedule.ID {
+		t.Errorf("alert = %+v", alert)
+	}
+
+	// Restoring compliance resolves the alert.
+	s3.ReadOnly = false
+	if err := checker.CheckOrg(ctx, orgID); err != nil {
+		t.Fatalf("CheckOrg() error = %v", err)
+	}
+	if len(alerts.resolved) != 1 || alerts.resolved[0] != schedule.ID {
+		t.Errorf("resolved = %v", alerts.resolved)
+	}
+}
+
+func TestChecker_EvaluateOrg(t *testing.T) {
+	orgID := uuid.New()
+	protected := &models.Agent{ID: uuid.New(), Hostname: "db-01"}
+	unprotected := &models.Agent{ID: uuid.New(), Hostname: "web-01"}
+	nas := testRepo("nas", models.RepositoryTypeLocal, "")
+	b2 := testRepo("b2", models.RepositoryTypeB2, "")
+	schedule := testSchedule(nas, b2)
+	schedule.AgentID = protected.ID
+
+	store := &mockStore{
+		agents:       []*models.Agent{protected, unprotected},
+		schedules:    []*models.Schedule{schedule},
+		scheduleRepo: map[uuid.UUID][]models.ScheduleRepository{schedule.ID: schedule.Repositories},
+		repos:        []*models.ComplianceRepository{nas, b2},
+		stored:       make(map[uuid.UUID]*models.ScheduleCompliance),
+	}
+	checker := NewChecker(store, &mockAlertService{}, DefaultConfig(), zerolog.Nop())
+
+	report, err := checker.EvaluateOrg(context.Background(), orgID)
+	if err != nil {
+		t.Fatalf("EvaluateOrg() error = %v", err)
+	}
+	if report.TotalAgents != 2 || report.CompliantAgents != 1 || report.TotalSchedules != 1 || report.CompliantSchedules != 1 {
+		t.Errorf("report = %+v", report)
+	}
+	if report.Score != 50 {
+		t.Errorf("score = %d, want 50", report.Score)
+	}
+	if len(store.stored) != 0 {
+		t.Error("EvaluateOrg should not store results")
+	}
+}
@@ -0,0 +1,203 @@
+// Package compliance evaluates backup schedules against the 3-2-1 rule: three
+// copies of the data, on two media types, with one copy offsite or immutable.
+package compliance
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// RequiredCopies is the number of copies of the data, production included.
+	RequiredCopies = 3
+	// RequiredMediaTypes is the number of distinct media the backups must span.
+	RequiredMediaTypes = 2
+)
+
+// Inventory is everything about an organization's storage that determines
+// where a schedule's data ends up.
+type Inventory struct {
+	Repositories map[uuid.UUID]*models.ComplianceRepository
+	Replications []*models.GeoReplicationConfig
+}
+
+// NewInventory indexes repositories by ID.
+func NewInventory(repos []*models.ComplianceRepository, replications []*models.GeoReplicationConfig) *Inventory {
+	inv := &Inventory{
+		Repositories: make(map[uuid.UUID]*models.ComplianceRepository, len(repos)),
+		Replications: replications,
+	}
+	for _, r := range repos {
+		inv.Repositories[r.ID] = r
+	}
+	return inv
+}
+
+// replicasOf returns the active geo-replication configs copying a repository.
+func (inv *Inventory) replicasOf(repoID uuid.UUID) []*models.GeoReplicationConfig {
+	var replicas []*models.GeoReplicationConfig
+	for _, cfg := range inv.Replications {
+		if cfg.SourceRepositoryID != repoID || !cfg.Enabled {
+			continue
+		}
+		switch models.GeoReplicationStatus(cfg.Status) {
+		case models.GeoReplicationStatusFailed, models.GeoReplicationStatusDisabled:
+			continue
+		}
+		replicas = append(replicas, cfg)
+	}
+	return replicas
+}
+
+// EvaluateSchedule works out the copies of a schedule's data from its enabled
+// repositories and their geo-replicas and scores them against the 3-2-1 rule.
+// Read-only repositories no longer receive backups and are not counted.
+func EvaluateSchedule(orgID uuid.UUID, schedule *models.Schedule, inv *Inventory, now time.Time) *models.ScheduleCompliance {
+	result := &models.ScheduleCompliance{
+		ScheduleID:   schedule.ID,
+		OrgID:        orgID,
+		AgentID:      schedule.AgentID,
+		ScheduleName: schedule.Name,
+		MediaTypes:   []models.ComplianceMedia{},
+		Gaps:         []string{},
+		Destinations: []models.ComplianceDestination{},
+		EvaluatedAt:  now,
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	var primaryRegion string
+	if primary := schedule.GetPrimaryRepository(); primary != nil {
+		if repo := inv.Repositories[primary.RepositoryID]; repo != nil {
+			primaryRegion = repo.Region
+		}
+	}
+
+	for _, sr := range schedule.GetEnabledRepositories() {
+		repo := inv.Repositories[sr.RepositoryID]
+		if repo == nil || repo.ReadOnly || seen[repo.ID] {
+			continue
+		}
+		seen[repo.ID] = true
+		dest := destination(repo, repo.Region)
+		if repo.Region != "" && primaryRegion != "" && repo.Region != primaryRegion {
+			dest.Offsite = true
+		}
+		result.Destinations = append(result.Destinations, dest)
+
+		for _, cfg := range inv.replicasOf(repo.ID) {
+			target := inv.Repositories[cfg.TargetRepositoryID]
+			if target == nil || seen[target.ID] {
+				continue
+			}
+			seen[target.ID] = true
+			replica := destination(target, cfg.TargetRegion)
+			replica.Replica = true
+			if cfg.TargetRegion != cfg.SourceRegion {
+				replica.Offsite = true
+			}
+			result.Destinations = append(result.Destinations, replica)
+		}
+	}
+
+	media := make(map[models.ComplianceMedia]bool)
+	for _, d := range result.Destinations {
+		if !media[d.Media] {
+			media[d.Media] = true
+			result.MediaTypes = append(result.MediaTypes, d.Media)
+		}
+		result.Offsite = result.Offsite || d.Offsite
+		result.Immutable = result.Immutable || d.Immutable
+	}
+	sort.Slice(result.MediaTypes, func(i, j int) bool { return result.MediaTypes[i] < result.MediaTypes[j] })
+
+	// Production data is the first copy.
+	result.Copies = 1 + len(result.Destinations)
+	result.Gaps = gaps(result)
+	result.Compliant = len(result.Gaps) == 0
+	result.Score = score(result)
+	return result
+}
+
+// EvaluateAgent aggregates schedule evaluations for an agent. An agent scores
+// as its weakest schedule; an agent without enabled schedules scores zero.
+func EvaluateAgent(agent *models.Agent, schedules []*models.ScheduleCompliance) *models.AgentCompliance {
+	result := &models.AgentCompliance{
+		AgentID:   agent.ID,
+		Hostname:  agent.Hostname,
+		Gaps:      []string{},
+		Schedules: schedules,
+	}
+	if result.Schedules == nil {
+		result.Schedules = []*models.ScheduleCompliance{}
+	}
+	if len(schedules) == 0 {
+		result.Gaps = append(result.Gaps, "no enabled backup schedule")
+		return result
+	}
+
+	result.Score = 100
+	result.Compliant = true
+	for _, s := range schedules {
+		if s.Score < result.Score {
+			result.Score = s.Score
+		}
+		if !s.Compliant {
+			result.Compliant = false
+			for _, gap := range s.Gaps {
+				result.Gaps = append(result.Gaps, fmt.Sprintf("%s: %s", s.ScheduleName, gap))
+			}
+		}
+	}
+	return result
+}
+
+// destination describes a copy held in repo.
+func destination(repo *models.ComplianceRepository, region string) models.ComplianceDestination {
+	media := models.MediaForRepositoryType(repo.Type)
+	return models.ComplianceDestination{
+		RepositoryID:   repo.ID,
+		RepositoryName: repo.Name,
+		RepositoryType: repo.Type,
+		Media:          media,
+		Region:         region,
+		// Cloud storage is by definition away from the protected host.
+		Offsite: media == models.ComplianceMediaCloudObject,
+		// Only repository-wide immutability protects every snapshot; a few
+		// locked snapshots say nothing about the latest backup.
+		Immutable: repo.ImmutabilityEnabled,
+	}
+}
+
+// gaps lists the parts of the 3-2-1 rule a schedule does not meet.
+func gaps(c *models.ScheduleCompliance) []string {
+	gaps := []string{}
+	if c.Copies < RequiredCopies {
+		gaps = append(gaps, fmt.Sprintf("only %d of %d copies of the data", c.Copies, RequiredCopies))
+	}
+	switch {
+	case len(c.MediaTypes) == 0:
+		gaps = append(gaps, "no backup destination")
+	case len(c.MediaTypes) < RequiredMediaTypes:
+		gaps = append(gaps, fmt.Sprintf("all backups on a single media type (%s)", c.MediaTypes[0]))
+	}
+	if !c.Offsite && !c.Immutable {
+		gaps = append(gaps, "no offsite or immutable copy")
+	}
+	return gaps
+}
+
+// score weights the three parts of the rule equally, giving partial credit
+// for copies and media types.
+func score(c *models.ScheduleCompliance) int {
+	copies := float64(min(c.Copies, RequiredCopies)) / RequiredCopies
+	media := float64(min(len(c.MediaTypes), RequiredMediaTypes)) / RequiredMediaTypes
+	var protected float64
+	if c.Offsite || c.Immutable {
+		protected = 1
+	}
+	return int((copies+media+protected)/3*100 + 0.5)
+}
@@ -0,0 +1,143 @@
+package compliance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+)
+
+func testRepo(name string, repoType models.RepositoryType, region string) *models.ComplianceRepository {
+	return &models.ComplianceRepository{ID: uuid.New(), Name: name, Type: repoType, Region: region}
+}
+
+func testSchedule(repos ...*models.ComplianceRepository) *models.Schedule {
+	s := &models.Schedule{ID: uuid.New(), AgentID: uuid.New(), Name: "nightly", Enabled: true}
+	for i, r := range repos {
+		s.Repositories = append(s.Repositories, models.ScheduleRepository{
+			ID: uuid.New(), ScheduleID: s.ID, RepositoryID: r.ID, Priority: i, Enabled: true,
+		})
+	}
+	return s
+}
+
+func TestEvaluateSchedule(t *testing.T) {
+	orgID := uuid.New()
+	now := time.Now()
+
+	t.Run("local and cloud is compliant", func(t *testing.T) {
+		nas := testRepo("nas", models.RepositoryTypeLocal, "")
+		s3 := testRepo("s3", models.RepositoryTypeS3, "us-east-1")
+		got := EvaluateSchedule(orgID, testSchedule(nas, s3), NewInventory([]*models.ComplianceRepository{nas, s3}, nil), now)
+
+		if !got.Compliant || got.Score != 100 {
+			t.Fatalf("expected compliant with score 100, got %v %d: %v", got.Compliant, got.Score, got.Gaps)
+		}
+		if got.Copies != 3 || len(got.MediaTypes) != 2 || !got.Offsite {
+			t.Errorf("got copies=%d media=%v offsite=%v", got.Copies, got.MediaTypes, got.Offsite)
+		}
+	})
+
+	t.Run("single local repository", func(t *testing.T) {
+		nas := testRepo("nas", models.RepositoryTypeLocal, "")
+		got := EvaluateSchedule(orgID, testSchedule(nas), NewInventory([]*models.ComplianceRepository{nas}, nil), now)
+
+		if got.Compliant {
+			t.Fatal("expected non-compliant")
+		}
+		if len(got.Gaps) != 3 {
+			t.Errorf("expected 3 gaps, got %v", got.Gaps)
+		}
+		// 2/3 copies + 1/2 media + 0 protection
+		if got.Score != 39 {
+			t.Errorf("score = %d, want 39", got.Score)
+		}
+	})
+
+	t.Run("no repositories", func(t *testing.T) {
+		got := EvaluateSchedule(orgID, testSchedule(), NewInventory(nil, nil), now)
+		if got.Compliant || got.Copies != 1 || got.Score != 11 {
+			t.Errorf("got compliant=%v copies=%d score=%d", got.Compliant, got.Copies, got.Score)
+		}
+	})
+
+	t.Run("geo-replica adds offsite copy", func(t *testing.T) {
+		nas := testRepo("nas", models.RepositoryTypeLocal, "")
+		sftp := testRepo("sftp", models.RepositoryTypeSFTP, "eu-west-1")
+		replica := testRepo("sftp-dr", models.RepositoryTypeSFTP, "us-east-1")
+		replication := &models.GeoReplicationConfig{
+			SourceRepositoryID: sftp.ID, TargetRepositoryID: replica.ID,
+			SourceRegion: "eu-west-1", TargetRegion: "us-east-1",
+			Enabled: true, Status: string(models.GeoReplicationStatusSynced),
+		}
+		inv := NewInventory([]*models.ComplianceRepository{nas, sftp, replica}, []*models.GeoReplicationConfig{replication})
+		got := EvaluateSchedule(orgID, testSchedule(nas, sftp), inv, now)
+
+		if !got.Compliant || got.Copies != 4 {
+			t.Fatalf("expected compliant with 4 copies, got %v %d: %v", got.Compliant, got.Copies, got.Gaps)
+		}
+		last := got.Destinations[len(got.Destinations)-1]
+		if !last.Replica || !last.Offsite {
+			t.Errorf("replica destination = %+v", last)
+		}
+
+		replication.Status = string(models.GeoReplicationStatusFailed)
+		if got := EvaluateSchedule(orgID, testSchedule(nas, sftp), inv, now); got.Copies != 3 || got.Offsite {
+			t.Errorf("failed replication should not count, got copies=%d offsite=%v", got.Copies, got.Offsite)
+		}
+	})
+
+	t.Run("immutable copy satisfies the last rule", func(t *testing.T) {
+		nas := testRepo("nas", models.RepositoryTypeLocal, "")
+		rest := testRepo("rest", models.RepositoryTypeRest, "")
+		rest.ImmutabilityEnabled = true
+		got := EvaluateSchedule(orgID, testSchedule(nas, rest), NewInventory([]*models.ComplianceRepository{nas, rest}, nil), now)
+		if !got.Compliant || got.Offsite || !got.Immutable {
+			t.Errorf("got compliant=%v offsite=%v immutable=%v gaps=%v", got.Compliant, got.Offsite, got.Immutable, got.Gaps)
+		}
+
+		rest.ImmutabilityEnabled = false
+		if got := EvaluateSchedule(orgID, testSchedule(nas, rest), NewInventory([]*models.ComplianceRepository{nas, rest}, nil), now); got.Compliant || got.Immutable {
+			t.Errorf("without repository immutability: compliant=%v immutable=%v", got.Compliant, got.Immutable)
+		}
+	})
+
+	t.Run("read-only and disabled repositories are ignored", func(t *testing.T) {
+		nas := testRepo("nas", models.RepositoryTypeLocal, "")
+		s3 := testRepo("s3", models.RepositoryTypeS3, "")
+		s3.ReadOnly = true
+		gcs := testRepo("gcs", models.RepositoryTypeGCS, "")
+		schedule := testSchedule(nas, s3, gcs)
+		schedule.Repositories[2].Enabled = false
+
+		got := EvaluateSchedule(orgID, schedule, NewInventory([]*models.ComplianceRepository{nas, s3, gcs}, nil), now)
+		if got.Copies != 2 || got.Compliant {
+			t.Errorf("got copies=%d compliant=%v", got.Copies, got.Compliant)
+		}
+	})
+}
+
+func TestEvaluateAgent(t *testing.T) {
+	agent := &models.Agent{ID: uuid.New(), Hostname: "web-01"}
+
+	t.Run("no schedules", func(t *testing.T) {
+		got := EvaluateAgent(agent, nil)
+		if got.Compliant || got.Score != 0 || len(got.Gaps) != 1 {
+			t.Errorf("got %+v", got)
+		}
+	})
+
+	t.Run("weakest schedule wins", func(t *testing.T) {
+		got := EvaluateAgent(agent, []*models.ScheduleCompliance{
+			{ScheduleName: "db", Score: 100, Compliant: true},
+			{ScheduleName: "files", Score: 67, Gaps: []string{"no offsite or immutable copy"}},
+		})
+		if got.Compliant || got.Score != 67 {
+			t.Errorf("got compliant=%v score=%d", got.Compliant, got.Score)
+		}
+		if len(got.Gaps) != 1 || got.Gaps[0] != "files: no offsite or immutable copy" {
+			t.Errorf("gaps = %v", got.Gaps)
+		}
+	})
+}
@@ -63,6 +63,10 @@ type AgentConfig struct {
 
 	// Queue settings for offline backup handling
 	MaxQueueSize int `yaml:"max_queue_size,omitempty"` // Maximum number of offline backups to queue (default: 100)
+
+	// LibvirtImagesDir is the directory libvirt restores may write disk
+	// images to (default: /var/lib/libvirt/images)
+	LibvirtImagesDir string `yaml:"libvirt_images_dir,omitempty"`
 }
 
 // ProxyConfig holds proxy settings for agent network connections.
@@ -52,6 +52,13 @@ var DefaultPricing = map[models.RepositoryType]StoragePricing{
 		ProviderName:        "Dropbox",
 		ProviderDescription: "Dropbox cloud storage",
 	},
+	models.RepositoryTypeRclone: {
+		StoragePerGBMonth:   0.0, // Rclone costs depend on the remote provider
+		EgressPerGB:         0.0,
+		OperationsPerK:      0.0,
+		ProviderName:        "Rclone",
+		ProviderDescription: "Rclone remote storage",
+	},
 	models.RepositoryTypeAzure: {
 		StoragePerGBMonth:   0.018, // Azure Blob Storage Hot tier
 		EgressPerGB:         0.087,
@@ -4,7 +4,9 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
@@ -132,6 +134,14 @@ func (km *KeyManager) DecryptString(encodedCiphertext string) (string, error) {
 	return string(plaintext), nil
 }
 
+// DeriveKey derives a purpose-specific key from the master key, so secrets
+// used for other purposes never expose the master key itself.
+func (km *KeyManager) DeriveKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, km.masterKey)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
 // GenerateMasterKey generates a new random master key for use with NewKeyManager.
 // This should be done once during initial server setup and stored securely.
 func GenerateMasterKey() ([]byte, error) {
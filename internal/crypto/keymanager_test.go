@@ -892,3 +892,22 @@ func TestKeyManager_CrossKeyIsolation(t *testing.T) {
 		}
 	}
 }
+
+func TestKeyManager_DeriveKey(t *testing.T) {
+	key, _ := GenerateMasterKey()
+	km, _ := NewKeyManager(key)
+
+	a := km.DeriveKey("purpose-a")
+	if len(a) != KeySize {
+		t.Errorf("DeriveKey() length = %d, want %d", len(a), KeySize)
+	}
+	if !bytes.Equal(a, km.DeriveKey("purpose-a")) {
+		t.Error("DeriveKey() should be deterministic")
+	}
+	if bytes.Equal(a, km.DeriveKey("purpose-b")) {
+		t.Error("DeriveKey() should differ per purpose")
+	}
+	if bytes.Equal(a, key) {
+		t.Error("DeriveKey() must not return the master key")
+	}
+}
@@ -0,0 +1,45 @@
+-- Custom Roles
+-- Organization-defined roles built from the permission catalog, bound to users
+-- or SSO groups and optionally scoped to agent groups or repositories.
+
+CREATE TABLE IF NOT EXISTS custom_roles (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    permissions JSONB NOT NULL DEFAULT '[]',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_custom_roles_org_name ON custom_roles(org_id, name);
+
+CREATE TABLE IF NOT EXISTS role_bindings (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    role_id UUID NOT NULL REFERENCES custom_roles(id) ON DELETE CASCADE,
+    subject_type VARCHAR(20) NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    sso_group_name VARCHAR(255),
+    agent_group_ids JSONB NOT NULL DEFAULT '[]',
+    repository_ids JSONB NOT NULL DEFAULT '[]',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT chk_role_binding_subject CHECK (
+        (subject_type = 'user' AND user_id IS NOT NULL) OR
+        (subject_type = 'sso_group' AND sso_group_name IS NOT NULL)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_role_bindings_org_id ON role_bindings(org_id);
+CREATE INDEX IF NOT EXISTS idx_role_bindings_role_id ON role_bindings(role_id);
+CREATE INDEX IF NOT EXISTS idx_role_bindings_user ON role_bindings(org_id, user_id) WHERE subject_type = 'user';
+CREATE INDEX IF NOT EXISTS idx_role_bindings_sso_group ON role_bindings(org_id, sso_group_name) WHERE subject_type = 'sso_group';
+
+COMMENT ON TABLE custom_roles IS 'Organization-defined roles composed from the RBAC permission catalog';
+COMMENT ON COLUMN custom_roles.permissions IS 'JSON array of permission strings (e.g. "repo:read")';
+COMMENT ON TABLE role_bindings IS 'Grants of custom roles to users or SSO groups';
+COMMENT ON COLUMN role_bindings.agent_group_ids IS 'Optional agent group scope; empty means organization-wide';
+COMMENT ON COLUMN role_bindings.repository_ids IS 'Optional repository scope; empty means organization-wide';
@@ -0,0 +1,40 @@
+-- User MFA
+-- TOTP and WebAuthn second factors and single-use recovery codes for local
+-- (password) accounts.
+
+CREATE TABLE IF NOT EXISTS user_mfa_factors (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    factor_type VARCHAR(20) NOT NULL,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    secret_encrypted BYTEA,
+    credential_id BYTEA,
+    public_key BYTEA,
+    algorithm INTEGER NOT NULL DEFAULT 0,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    confirmed_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT chk_user_mfa_factor_type CHECK (
+        (factor_type = 'totp' AND secret_encrypted IS NOT NULL) OR
+        (factor_type = 'webauthn' AND credential_id IS NOT NULL AND public_key IS NOT NULL)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_mfa_factors_user_id ON user_mfa_factors(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_mfa_factors_credential_id ON user_mfa_factors(credential_id) WHERE credential_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS user_mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_mfa_recovery_codes_hash ON user_mfa_recovery_codes(user_id, code_hash);
+
+COMMENT ON TABLE user_mfa_factors IS 'Second factors (TOTP apps, WebAuthn keys/passkeys) enrolled by local users';
+COMMENT ON COLUMN user_mfa_factors.secret_encrypted IS 'TOTP shared secret encrypted with the server master key';
+COMMENT ON COLUMN user_mfa_factors.public_key IS 'WebAuthn credential public key, PKIX DER encoded';
+COMMENT ON TABLE user_mfa_recovery_codes IS 'Single-use recovery codes, stored as SHA-256 hashes';
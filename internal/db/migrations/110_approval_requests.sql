@@ -0,0 +1,38 @@
+-- Approval requests
+-- Four-eyes approval for destructive operations. When an organization's
+-- security policy lists an action as requiring approval, the API records a
+-- pending request instead of executing it; a second admin approves (which
+-- executes the stored operation) or rejects it before it expires.
+
+CREATE TABLE IF NOT EXISTS approval_requests (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    action VARCHAR(50) NOT NULL,
+    resource_type VARCHAR(50) NOT NULL,
+    resource_id VARCHAR(255) NOT NULL,
+    summary TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    payload JSONB,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    requested_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decision_comment TEXT NOT NULL DEFAULT '',
+    error_message TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ NOT NULL,
+    decided_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT chk_approval_request_status CHECK (
+        status IN ('pending', 'approved', 'executed', 'failed', 'rejected', 'cancelled', 'expired')
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_approval_requests_org_status ON approval_requests(org_id, status);
+CREATE INDEX IF NOT EXISTS idx_approval_requests_pending_expiry ON approval_requests(expires_at) WHERE status = 'pending';
+
+-- Only one open request per action and resource
+CREATE UNIQUE INDEX IF NOT EXISTS idx_approval_requests_open
+    ON approval_requests(org_id, action, resource_id) WHERE status = 'pending';
+
+COMMENT ON TABLE approval_requests IS 'Destructive operations awaiting approval from a second administrator';
+COMMENT ON COLUMN approval_requests.payload IS 'Operation parameters replayed when the request is approved';
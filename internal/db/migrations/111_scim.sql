@@ -0,0 +1,55 @@
+-- SCIM 2.0 provisioning
+-- Identity providers push users and groups through /scim/v2 using an
+-- org-scoped bearer token. Provisioned users are linked to the organization
+-- that manages them; SCIM group membership is mapped to org roles through
+-- the organization's SSO group mappings.
+
+CREATE TABLE IF NOT EXISTS scim_tokens (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    token_prefix VARCHAR(16) NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_scim_tokens_org ON scim_tokens(org_id);
+
+CREATE TABLE IF NOT EXISTS scim_users (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_name VARCHAR(255) NOT NULL,
+    external_id VARCHAR(255) NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scim_users_user_name ON scim_users(org_id, LOWER(user_name));
+
+CREATE TABLE IF NOT EXISTS scim_groups (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    display_name VARCHAR(255) NOT NULL,
+    external_id VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scim_groups_display_name ON scim_groups(org_id, display_name);
+
+CREATE TABLE IF NOT EXISTS scim_group_members (
+    group_id UUID NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_scim_group_members_user ON scim_group_members(user_id);
+
+COMMENT ON TABLE scim_tokens IS 'Bearer tokens identity providers use to call the SCIM API for one organization';
+COMMENT ON TABLE scim_users IS 'Users provisioned and managed through SCIM, per organization';
+COMMENT ON COLUMN scim_groups.display_name IS 'Matched against sso_group_mappings.oidc_group_name to derive the org role';
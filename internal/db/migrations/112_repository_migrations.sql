@@ -0,0 +1,35 @@
+-- Repository migrations
+-- Moves a repository to a different backend without losing history: the
+-- target is initialised with the source's chunker parameters, every snapshot
+-- is copied, the target is checked, and schedules and geo-replication configs
+-- are repointed in one transaction. The source is kept read-only until an
+-- admin retires it.
+
+ALTER TABLE repositories ADD COLUMN IF NOT EXISTS read_only BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS repository_migrations (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    source_repository_id UUID REFERENCES repositories(id) ON DELETE SET NULL,
+    target_repository_id UUID REFERENCES repositories(id) ON DELETE SET NULL,
+    source_repository_name VARCHAR(255) NOT NULL,
+    target_repository_name VARCHAR(255) NOT NULL,
+    status VARCHAR(32) NOT NULL DEFAULT 'pending',
+    total_snapshots INTEGER NOT NULL DEFAULT 0,
+    copied_snapshot_ids JSONB NOT NULL DEFAULT '[]',
+    current_snapshot_id VARCHAR(64),
+    read_data_subset VARCHAR(32) NOT NULL DEFAULT '',
+    schedules_repointed INTEGER NOT NULL DEFAULT 0,
+    geo_configs_repointed INTEGER NOT NULL DEFAULT 0,
+    runbooks_repointed INTEGER NOT NULL DEFAULT 0,
+    error_message TEXT,
+    started_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_repository_migrations_org ON repository_migrations(org_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_repository_migrations_source ON repository_migrations(source_repository_id);
+CREATE INDEX IF NOT EXISTS idx_repository_migrations_target ON repository_migrations(target_repository_id);
@@ -0,0 +1,15 @@
+-- Repositories hosted by the built-in restic REST server
+-- The server stores hosted repositories on its own disk and records how much
+-- space each one uses, so quotas can be enforced and usage metered.
+
+CREATE TABLE IF NOT EXISTS hosted_repository_usage (
+    repository_id UUID PRIMARY KEY REFERENCES repositories(id) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    used_bytes BIGINT NOT NULL DEFAULT 0,
+    quota_bytes BIGINT,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_hosted_repository_usage_org ON hosted_repository_usage(org_id);
+
+ALTER TABLE usage_metrics ADD COLUMN IF NOT EXISTS hosted_storage_bytes BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,22 @@
+-- 3-2-1 backup compliance
+-- Stores the latest compliance evaluation of each schedule so dashboards and
+-- reports can read it cheaply and the checker can detect when a previously
+-- compliant schedule drops out.
+
+CREATE TABLE IF NOT EXISTS schedule_compliance (
+    schedule_id UUID PRIMARY KEY REFERENCES schedules(id) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    agent_id UUID NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    schedule_name VARCHAR(255) NOT NULL,
+    compliant BOOLEAN NOT NULL,
+    score INTEGER NOT NULL,
+    copies INTEGER NOT NULL,
+    media_types JSONB NOT NULL DEFAULT '[]',
+    offsite BOOLEAN NOT NULL DEFAULT false,
+    immutable BOOLEAN NOT NULL DEFAULT false,
+    gaps JSONB NOT NULL DEFAULT '[]',
+    destinations JSONB NOT NULL DEFAULT '[]',
+    evaluated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedule_compliance_org ON schedule_compliance(org_id);
@@ -0,0 +1,45 @@
+-- Repository maintenance planner
+-- Per-repository policies for upgrading to repository format v2, compressing
+-- old packs and pruning unused data inside maintenance windows, plus a history
+-- of runs with raw-data stats before and after each one.
+
+CREATE TABLE IF NOT EXISTS repository_maintenance_policies (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    repository_id UUID NOT NULL UNIQUE REFERENCES repositories(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    upgrade_repository BOOLEAN NOT NULL DEFAULT true,
+    repack_uncompressed BOOLEAN NOT NULL DEFAULT true,
+    max_unused VARCHAR(32) NOT NULL DEFAULT '5%',
+    max_repack_size VARCHAR(32) NOT NULL DEFAULT '',
+    min_reclaim_bytes BIGINT NOT NULL DEFAULT 0,
+    interval_hours INTEGER NOT NULL DEFAULT 168,
+    require_maintenance_window BOOLEAN NOT NULL DEFAULT true,
+    storage_class VARCHAR(64) NOT NULL DEFAULT '',
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_repository_maintenance_policies_org ON repository_maintenance_policies(org_id);
+
+CREATE TABLE IF NOT EXISTS repository_maintenance_runs (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    trigger VARCHAR(32) NOT NULL,
+    status VARCHAR(32) NOT NULL DEFAULT 'running',
+    actions JSONB NOT NULL DEFAULT '[]',
+    skip_reasons JSONB NOT NULL DEFAULT '[]',
+    repository_version_before INTEGER NOT NULL DEFAULT 0,
+    repository_version_after INTEGER NOT NULL DEFAULT 0,
+    estimated_reclaim_bytes BIGINT NOT NULL DEFAULT 0,
+    estimated_early_deletion_cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+    stats_before JSONB,
+    stats_after JSONB,
+    error_message TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_repository_maintenance_runs_repo ON repository_maintenance_runs(repository_id, started_at DESC);
@@ -0,0 +1,39 @@
+-- Per-repository transfer tuning and backend transfer metrics
+-- Settings become restic global flags (limits, pack size, -o options) for
+-- every command on the repository; metrics are captured per backup run from
+-- restic's output so backend throughput and error trends can be charted.
+
+CREATE TABLE IF NOT EXISTS repository_transfer_settings (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    repository_id UUID NOT NULL UNIQUE REFERENCES repositories(id) ON DELETE CASCADE,
+    upload_limit_kb INTEGER,
+    download_limit_kb INTEGER,
+    connections INTEGER,
+    pack_size_mb INTEGER,
+    read_concurrency INTEGER,
+    backend_options JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS backup_transfer_metrics (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    backup_id UUID NOT NULL REFERENCES backups(id) ON DELETE CASCADE,
+    agent_id UUID REFERENCES agents(id) ON DELETE SET NULL,
+    bytes_processed BIGINT NOT NULL DEFAULT 0,
+    bytes_uploaded BIGINT NOT NULL DEFAULT 0,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    open_duration_ms BIGINT NOT NULL DEFAULT 0,
+    upload_bytes_per_sec DOUBLE PRECISION NOT NULL DEFAULT 0,
+    retries INTEGER NOT NULL DEFAULT 0,
+    retry_wait_ms BIGINT NOT NULL DEFAULT 0,
+    backend_errors INTEGER NOT NULL DEFAULT 0,
+    file_errors INTEGER NOT NULL DEFAULT 0,
+    failed BOOLEAN NOT NULL DEFAULT false,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_backup_transfer_metrics_repo ON backup_transfer_metrics(repository_id, recorded_at DESC);
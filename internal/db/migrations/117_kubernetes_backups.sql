@@ -0,0 +1,32 @@
+-- Kubernetes workload backups
+-- Schedules of type "kubernetes" export namespace manifests and PVC data from
+-- the cluster the server or agent runs in; restores replay a snapshot into a
+-- namespace of the same or another cluster.
+
+ALTER TABLE schedules ADD COLUMN IF NOT EXISTS kubernetes_options JSONB;
+
+CREATE TABLE IF NOT EXISTS kubernetes_restores (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    snapshot_id VARCHAR(255) NOT NULL,
+    namespaces JSONB NOT NULL DEFAULT '[]',
+    namespace_mapping JSONB NOT NULL DEFAULT '{}',
+    name_mapping JSONB NOT NULL DEFAULT '{}',
+    target_server VARCHAR(1024) NOT NULL DEFAULT '',
+    overwrite BOOLEAN NOT NULL DEFAULT FALSE,
+    restore_volumes BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    result JSONB,
+    error_message TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_kubernetes_restores_org ON kubernetes_restores(org_id, created_at DESC);
+
+COMMENT ON COLUMN schedules.kubernetes_options IS 'Kubernetes-specific backup options as JSON';
+COMMENT ON COLUMN kubernetes_restores.target_server IS 'API server URL restored to; empty for the local cluster. Credentials are never stored.';
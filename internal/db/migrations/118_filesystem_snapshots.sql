@@ -0,0 +1,8 @@
+-- Filesystem-level snapshots for file backups
+-- Agents snapshot the LVM thin volumes, ZFS datasets or btrfs subvolumes
+-- holding a schedule's paths and back up the read-only snapshot, so files
+-- are captured crash-consistently without pausing applications.
+
+ALTER TABLE schedules ADD COLUMN IF NOT EXISTS filesystem_snapshot VARCHAR(20);
+
+COMMENT ON COLUMN schedules.filesystem_snapshot IS 'Filesystem snapshot mode: off, auto, required (null = off)';
@@ -0,0 +1,41 @@
+-- Proxmox Backup Server connections
+-- PBS datastores can be pulled into restic snapshot by snapshot, or managed
+-- as a backup target with verification, pruning and garbage collection run
+-- from Keldris.
+
+CREATE TABLE pbs_connections (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    host VARCHAR(255) NOT NULL,
+    port INTEGER DEFAULT 8007,
+    username VARCHAR(255) NOT NULL,
+    token_id VARCHAR(255),
+    token_secret_encrypted BYTEA,
+    fingerprint VARCHAR(128),
+    verify_ssl BOOLEAN DEFAULT TRUE,
+    datastore VARCHAR(255) NOT NULL,
+    namespace VARCHAR(255),
+    retention JSONB,
+    verify_outdated_days INTEGER DEFAULT 0,
+    enabled BOOLEAN DEFAULT TRUE,
+    last_connected_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for looking up connections by organization
+CREATE INDEX idx_pbs_connections_org ON pbs_connections(org_id);
+
+-- Add unique constraint on name within organization
+CREATE UNIQUE INDEX idx_pbs_connections_org_name ON pbs_connections(org_id, name);
+
+COMMENT ON TABLE pbs_connections IS 'Proxmox Backup Server API connections used as a backup source and managed target';
+COMMENT ON COLUMN pbs_connections.port IS 'PBS API port (default 8007)';
+COMMENT ON COLUMN pbs_connections.username IS 'API user (e.g., backup@pbs)';
+COMMENT ON COLUMN pbs_connections.token_secret_encrypted IS 'Encrypted API token secret';
+COMMENT ON COLUMN pbs_connections.fingerprint IS 'Pinned SHA-256 fingerprint of the server certificate';
+COMMENT ON COLUMN pbs_connections.datastore IS 'Default datastore for pulls, verification and pruning';
+COMMENT ON COLUMN pbs_connections.namespace IS 'Default namespace within the datastore (null = root)';
+COMMENT ON COLUMN pbs_connections.retention IS 'Retention policy applied to each backup group when pruning';
+COMMENT ON COLUMN pbs_connections.verify_outdated_days IS 'Re-verify snapshots last verified more than this many days ago (0 = only unverified)';
@@ -0,0 +1,38 @@
+-- Proxmox VM restores
+-- A restore streams a vzdump archive from a restic snapshot to a storage on a
+-- Proxmox VE node, runs qmrestore or pct restore there and optionally boots
+-- and health-checks the restored guest for DR tests.
+
+CREATE TABLE IF NOT EXISTS proxmox_restores (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    connection_id UUID NOT NULL REFERENCES proxmox_connections(id) ON DELETE CASCADE,
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    snapshot_id VARCHAR(255) NOT NULL,
+    archive VARCHAR(1024) NOT NULL DEFAULT '',
+    source_vmid INTEGER NOT NULL DEFAULT 0,
+    target_node VARCHAR(255) NOT NULL DEFAULT '',
+    target_storage VARCHAR(255) NOT NULL DEFAULT '',
+    upload_storage VARCHAR(255) NOT NULL,
+    new_vmid INTEGER NOT NULL DEFAULT 0,
+    overwrite BOOLEAN NOT NULL DEFAULT FALSE,
+    is_unique BOOLEAN NOT NULL DEFAULT FALSE,
+    start_guest BOOLEAN NOT NULL DEFAULT FALSE,
+    health_check BOOLEAN NOT NULL DEFAULT FALSE,
+    health_timeout_seconds INTEGER NOT NULL DEFAULT 0,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    phase VARCHAR(50) NOT NULL DEFAULT '',
+    task_upid VARCHAR(512) NOT NULL DEFAULT '',
+    result JSONB,
+    error_message TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_proxmox_restores_org ON proxmox_restores(org_id, created_at DESC);
+
+COMMENT ON COLUMN proxmox_restores.new_vmid IS 'VMID restored to; 0 uses the next free VMID, which is recorded in result';
+COMMENT ON COLUMN proxmox_restores.task_upid IS 'UPID of the Proxmox task of the current phase';
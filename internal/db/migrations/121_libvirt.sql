@@ -0,0 +1,33 @@
+-- libvirt/KVM domain backups
+-- Schedules of type "libvirt" take external disk-only snapshots of the
+-- selected domains, back up the frozen disk images and domain XML, and
+-- blockcommit the snapshot overlays afterwards. Restores bring the disk
+-- images back and redefine the domain.
+
+ALTER TABLE schedules ADD COLUMN IF NOT EXISTS libvirt_options JSONB;
+
+CREATE TABLE IF NOT EXISTS libvirt_restores (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    snapshot_id VARCHAR(255) NOT NULL,
+    uri VARCHAR(1024) NOT NULL DEFAULT '',
+    domain VARCHAR(255) NOT NULL DEFAULT '',
+    new_name VARCHAR(255) NOT NULL DEFAULT '',
+    target_dir VARCHAR(4096) NOT NULL DEFAULT '',
+    overwrite BOOLEAN NOT NULL DEFAULT FALSE,
+    start_domain BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    result JSONB,
+    error_message TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_libvirt_restores_org ON libvirt_restores(org_id, created_at DESC);
+
+COMMENT ON COLUMN schedules.libvirt_options IS 'libvirt/KVM-specific backup options as JSON';
+COMMENT ON COLUMN libvirt_restores.target_dir IS 'Directory disk images are restored into; empty restores them to their original paths.';
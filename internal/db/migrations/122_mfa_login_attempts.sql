@@ -0,0 +1,13 @@
+-- Failed second-factor attempts for password logins
+-- The pending MFA state lives in the client-side session cookie, so failures
+-- are counted here. Too many failures lock the user's MFA logins for a while.
+
+CREATE TABLE IF NOT EXISTS user_mfa_login_attempts (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE user_mfa_login_attempts IS 'Failed second factors for pending password logins, per user';
+COMMENT ON COLUMN user_mfa_login_attempts.locked_until IS 'MFA logins are refused until this time after too many failures';
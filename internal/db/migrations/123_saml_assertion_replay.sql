@@ -0,0 +1,16 @@
+-- Consumed SAML assertion IDs
+-- Assertions are recorded when a SAML login succeeds so a captured response
+-- cannot be replayed against any server instance. Rows are pruned once the
+-- assertion has expired.
+
+CREATE TABLE IF NOT EXISTS saml_consumed_assertions (
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    assertion_id VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (org_id, assertion_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_saml_consumed_assertions_expires_at ON saml_consumed_assertions(expires_at);
+
+COMMENT ON TABLE saml_consumed_assertions IS 'SAML assertion IDs already used to log in, kept until they expire';
@@ -0,0 +1,11 @@
+-- Agent-run Kubernetes restores
+-- Restores into the local cluster run on an in-cluster agent through an agent
+-- command, so manifests are applied with the agent's service account instead
+-- of the server's.
+
+ALTER TABLE kubernetes_restores ADD COLUMN IF NOT EXISTS agent_id UUID REFERENCES agents(id) ON DELETE SET NULL;
+ALTER TABLE kubernetes_restores ADD COLUMN IF NOT EXISTS command_id UUID REFERENCES agent_commands(id) ON DELETE SET NULL;
+
+COMMENT ON COLUMN kubernetes_restores.agent_id IS 'In-cluster agent that restores into its own cluster; NULL for target cluster restores';
+COMMENT ON COLUMN kubernetes_restores.command_id IS 'Agent command that runs the restore';
+COMMENT ON COLUMN kubernetes_restores.target_server IS 'API server URL restored to; empty when an agent restores into its own cluster. Credentials are never stored.';
@@ -0,0 +1,8 @@
+-- PostgreSQL schedule configuration
+-- Schedules of type "postgres" stream pg_dump output straight into the
+-- repository. The config, including the encrypted password, is stored like
+-- mysql_config.
+
+ALTER TABLE schedules ADD COLUMN IF NOT EXISTS postgres_config JSONB;
+
+COMMENT ON COLUMN schedules.postgres_config IS 'PostgreSQL server and pg_dump options; the password is stored encrypted';
@@ -0,0 +1,25 @@
+-- PostgreSQL and MySQL restores
+-- A restore streams a dump from a snapshot of a postgres or mysql schedule
+-- with restic dump into psql, pg_restore or mysql on the schedule's server.
+
+CREATE TABLE IF NOT EXISTS database_restores (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    schedule_id UUID NOT NULL REFERENCES schedules(id) ON DELETE CASCADE,
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    snapshot_id VARCHAR(255) NOT NULL,
+    filename VARCHAR(1024) NOT NULL DEFAULT '',
+    database_name VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    result JSONB,
+    error_message TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_database_restores_org ON database_restores(org_id, created_at DESC);
+
+COMMENT ON COLUMN database_restores.filename IS 'Dump restored from the snapshot; empty uses the snapshot''s only file';
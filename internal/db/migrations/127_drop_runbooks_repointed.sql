@@ -0,0 +1,4 @@
+-- DR runbooks reference a schedule rather than a repository and follow their
+-- schedule to a migration's target, so there is nothing to count.
+
+ALTER TABLE repository_migrations DROP COLUMN IF EXISTS runbooks_repointed;
@@ -0,0 +1,12 @@
+-- S3 Object Lock retention is applied by a background job after the lock row
+-- is created; track its progress so clients can see when it has taken effect.
+
+ALTER TABLE snapshot_immutability
+    ADD COLUMN IF NOT EXISTS s3_object_lock_status VARCHAR(50) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS s3_object_lock_error TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS s3_object_lock_objects INTEGER NOT NULL DEFAULT 0;
+
+-- Locks created before this change applied retention before the row existed.
+UPDATE snapshot_immutability
+SET s3_object_lock_status = 'applied'
+WHERE s3_object_lock_enabled;
@@ -0,0 +1,10 @@
+-- Agent-run libvirt restores
+-- libvirt discovery, backups and restores run on the agent of the KVM host
+-- instead of the server. Restores are queued as agent commands.
+
+ALTER TABLE libvirt_restores ADD COLUMN IF NOT EXISTS agent_id UUID REFERENCES agents(id) ON DELETE SET NULL;
+ALTER TABLE libvirt_restores ADD COLUMN IF NOT EXISTS command_id UUID REFERENCES agent_commands(id) ON DELETE SET NULL;
+
+COMMENT ON COLUMN libvirt_restores.agent_id IS 'Agent of the KVM host the domain is restored on; NULL for restores created before they moved to agents';
+COMMENT ON COLUMN libvirt_restores.command_id IS 'Agent command that runs the restore';
+COMMENT ON COLUMN libvirt_restores.target_dir IS 'Directory disk images are restored into on the agent host; empty restores them to their original paths.';
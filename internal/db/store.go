@@ -719,7 +719,7 @@ func (db *DB) GetAgentStats(ctx context.Context, agentID uuid.UUID) (*models.Age
 // GetRepositoriesByOrgID returns all repositories for an organization.
 func (db *DB) GetRepositoriesByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.Repository, error) {
 	rows, err := db.Pool.Query(ctx, `
-		SELECT id, org_id, name, type, config_encrypted, created_at, updated_at
+		SELECT id, org_id, name, type, config_encrypted, read_only, created_at, updated_at
 		FROM repositories
 		WHERE org_id = $1
 		ORDER BY name
@@ -734,7 +734,7 @@ func (db *DB) GetRepositoriesByOrgID(ctx context.Context, orgID uuid.UUID) ([]*m
 		var r models.Repository
 		var typeStr string
 		err := rows.Scan(
-			&r.ID, &r.OrgID, &r.Name, &typeStr, &r.ConfigEncrypted,
+			&r.ID, &r.OrgID, &r.Name, &typeStr, &r.ConfigEncrypted, &r.ReadOnly,
 			&r.CreatedAt, &r.UpdatedAt,
 		)
 		if err != nil {
@@ -756,11 +756,11 @@ func (db *DB) GetRepositoryByID(ctx context.Context, id uuid.UUID) (*models.Repo
 	var r models.Repository
 	var typeStr string
 	err := db.Pool.QueryRow(ctx, `
-		SELECT id, org_id, name, type, config_encrypted, created_at, updated_at
+		SELECT id, org_id, name, type, config_encrypted, read_only, created_at, updated_at
 		FROM repositories
 		WHERE id = $1
 	`, id).Scan(
-		&r.ID, &r.OrgID, &r.Name, &typeStr, &r.ConfigEncrypted,
+		&r.ID, &r.OrgID, &r.Name, &typeStr, &r.ConfigEncrypted, &r.ReadOnly,
 		&r.CreatedAt, &r.UpdatedAt,
 	)
 	if err != nil {
@@ -815,7 +815,7 @@ func (db *DB) GetSchedulesByAgentID(ctx context.Context, agentID uuid.UUID) ([]*
 		       retention_policy, bandwidth_limit_kbps, backup_window_start, backup_window_end,
 		       excluded_hours, compression_level, max_file_size_mb, on_mount_unavailable,
 		       priority, preemptible, classification_level, classification_data_types,
-		       docker_options, pihole_config, proxmox_options,
+		       docker_options, pihole_config, proxmox_options, kubernetes_options, libvirt_options, mysql_config, postgres_config, filesystem_snapshot,
 		       enabled, created_at, updated_at
 		FROM schedules
 		WHERE agent_id = $1
@@ -857,7 +857,7 @@ func (db *DB) GetScheduleByID(ctx context.Context, id uuid.UUID) (*models.Schedu
 		       retention_policy, bandwidth_limit_kbps, backup_window_start, backup_window_end,
 		       excluded_hours, compression_level, max_file_size_mb, on_mount_unavailable,
 		       priority, preemptible, classification_level, classification_data_types,
-		       docker_options, pihole_config, proxmox_options,
+		       docker_options, pihole_config, proxmox_options, kubernetes_options, libvirt_options, mysql_config, postgres_config, filesystem_snapshot,
 		       enabled, created_at, updated_at
 		FROM schedules
 		WHERE id = $1
@@ -933,6 +933,32 @@ func (db *DB) CreateSchedule(ctx context.Context, schedule *models.Schedule) err
 		return fmt.Errorf("marshal proxmox options: %w", err)
 	}
 
+	kubernetesOptionsBytes, err := schedule.KubernetesOptionsJSON()
+	if err != nil {
+		return fmt.Errorf("marshal kubernetes options: %w", err)
+	}
+
+	libvirtOptionsBytes, err := schedule.LibvirtOptionsJSON()
+	if err != nil {
+		return fmt.Errorf("marshal libvirt options: %w", err)
+	}
+
+	mysqlConfigBytes, err := schedule.MySQLConfigJSON()
+	if err != nil {
+		return fmt.Errorf("marshal mysql config: %w", err)
+	}
+
+	postgresConfigBytes, err := schedule.PostgresConfigJSON()
+	if err != nil {
+		return fmt.Errorf("marshal postgres config: %w", err)
+	}
+
+	var filesystemSnapshot *string
+	if schedule.FilesystemSnapshot.Enabled() {
+		mode := string(schedule.FilesystemSnapshot)
+		filesystemSnapshot = &mode
+	}
+
 	classificationDataTypesBytes, err := schedule.ClassificationDataTypesJSON()
 	if err != nil {
 		return fmt.Errorf("marshal classification data types: %w", err)
@@ -950,15 +976,15 @@ func (db *DB) CreateSchedule(ctx context.Context, schedule *models.Schedule) err
 		                       backup_window_start, backup_window_end, excluded_hours,
 		                       compression_level, max_file_size_mb, on_mount_unavailable,
 		                       priority, preemptible, classification_level, classification_data_types,
-		                       docker_options, pihole_config, proxmox_options,
+		                       docker_options, pihole_config, proxmox_options, kubernetes_options, libvirt_options, mysql_config, postgres_config, filesystem_snapshot,
 		                       enabled, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32)
 	`, schedule.ID, schedule.AgentID, schedule.AgentGroupID, schedule.PolicyID, schedule.Name,
 		backupType, schedule.CronExpression, pathsBytes, excludesBytes, retentionBytes,
 		schedule.BandwidthLimitKB, windowStart, windowEnd, excludedHoursBytes,
 		schedule.CompressionLevel, schedule.MaxFileSizeMB, mountBehavior,
 		schedule.Priority, schedule.Preemptible, schedule.ClassificationLevel, classificationDataTypesBytes,
-		dockerOptionsBytes, piholeConfigBytes, proxmoxOptionsBytes,
+		dockerOptionsBytes, piholeConfigBytes, proxmoxOptionsBytes, kubernetesOptionsBytes, libvirtOptionsBytes, mysqlConfigBytes, postgresConfigBytes, filesystemSnapshot,
 		schedule.Enabled, schedule.CreatedAt, schedule.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("create schedule: %w", err)
@@ -1030,6 +1056,32 @@ func (db *DB) UpdateSchedule(ctx context.Context, schedule *models.Schedule) err
 		return fmt.Errorf("marshal proxmox options: %w", err)
 	}
 
+	kubernetesOptionsBytes, err := schedule.KubernetesOptionsJSON()
+	if err != nil {
+		return fmt.Errorf("marshal kubernetes options: %w", err)
+	}
+
+	libvirtOptionsBytes, err := schedule.LibvirtOptionsJSON()
+	if err != nil {
+		return fmt.Errorf("marshal libvirt options: %w", err)
+	}
+
+	mysqlConfigBytes, err := schedule.MySQLConfigJSON()
+	if err != nil {
+		return fmt.Errorf("marshal mysql config: %w", err)
+	}
+
+	postgresConfigBytes, err := schedule.PostgresConfigJSON()
+	if err != nil {
+		return fmt.Errorf("marshal postgres config: %w", err)
+	}
+
+	var filesystemSnapshot *string
+	if schedule.FilesystemSnapshot.Enabled() {
+		mode := string(schedule.FilesystemSnapshot)
+		filesystemSnapshot = &mode
+	}
+
 	classificationDataTypesBytes, err := schedule.ClassificationDataTypesJSON()
 	if err != nil {
 		return fmt.Errorf("marshal classification data types: %w", err)
@@ -1050,13 +1102,14 @@ func (db *DB) UpdateSchedule(ctx context.Context, schedule *models.Schedule) err
 		    max_file_size_mb = $14, on_mount_unavailable = $15,
 		    priority = $16, preemptible = $17, classification_level = $18, classification_data_types = $19,
 		    docker_options = $20, pihole_config = $21, proxmox_options = $22,
-		    enabled = $23, updated_at = $24
+		    kubernetes_options = $23, libvirt_options = $24, mysql_config = $25, postgres_config = $26,
+		    filesystem_snapshot = $27, enabled = $28, updated_at = $29
 		WHERE id = $1
 	`, schedule.ID, schedule.PolicyID, schedule.Name, backupType, schedule.CronExpression, pathsBytes,
 		excludesBytes, retentionBytes, schedule.BandwidthLimitKB, windowStart, windowEnd,
 		excludedHoursBytes, schedule.CompressionLevel, schedule.MaxFileSizeMB, mountBehavior,
 		schedule.Priority, schedule.Preemptible, schedule.ClassificationLevel, classificationDataTypesBytes,
-		dockerOptionsBytes, piholeConfigBytes, proxmoxOptionsBytes,
+		dockerOptionsBytes, piholeConfigBytes, proxmoxOptionsBytes, kubernetesOptionsBytes, libvirtOptionsBytes, mysqlConfigBytes, postgresConfigBytes, filesystemSnapshot,
 		schedule.Enabled, schedule.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("update schedule: %w", err)
@@ -1215,16 +1268,16 @@ func scanSchedule(rows interface {
 }) (*models.Schedule, error) {
 	var s models.Schedule
 	var pathsBytes, excludesBytes, retentionBytes, excludedHoursBytes []byte
-	var classificationDataTypesBytes, dockerOptionsBytes, piholeConfigBytes, proxmoxOptionsBytes []byte
+	var classificationDataTypesBytes, dockerOptionsBytes, piholeConfigBytes, proxmoxOptionsBytes, kubernetesOptionsBytes, libvirtOptionsBytes, mysqlConfigBytes, postgresConfigBytes []byte
 	var agentGroupID *uuid.UUID
-	var backupType, windowStart, windowEnd, compressionLevel, mountBehavior, classificationLevel *string
+	var backupType, windowStart, windowEnd, compressionLevel, mountBehavior, classificationLevel, filesystemSnapshot *string
 	err := rows.Scan(
 		&s.ID, &s.AgentID, &agentGroupID, &s.PolicyID, &s.Name, &backupType, &s.CronExpression,
 		&pathsBytes, &excludesBytes, &retentionBytes, &s.BandwidthLimitKB,
 		&windowStart, &windowEnd, &excludedHoursBytes, &compressionLevel, &s.MaxFileSizeMB,
 		&mountBehavior,
 		&s.Priority, &s.Preemptible, &classificationLevel, &classificationDataTypesBytes,
-		&dockerOptionsBytes, &piholeConfigBytes, &proxmoxOptionsBytes,
+		&dockerOptionsBytes, &piholeConfigBytes, &proxmoxOptionsBytes, &kubernetesOptionsBytes, &libvirtOptionsBytes, &mysqlConfigBytes, &postgresConfigBytes, &filesystemSnapshot,
 		&s.Enabled, &s.CreatedAt, &s.UpdatedAt,
 	)
 	if err != nil {
@@ -1256,6 +1309,9 @@ func scanSchedule(rows interface {
 	}
 
 	// Set mount behavior
+	if filesystemSnapshot != nil {
+		s.FilesystemSnapshot = models.FilesystemSnapshotMode(*filesystemSnapshot)
+	}
 	if mountBehavior != nil {
 		s.OnMountUnavailable = models.MountBehavior(*mountBehavior)
 	}
@@ -1289,6 +1345,18 @@ func scanSchedule(rows interface {
 	if err := s.SetProxmoxOptions(proxmoxOptionsBytes); err != nil {
 		return nil, fmt.Errorf("parse proxmox options: %w", err)
 	}
+	if err := s.SetKubernetesOptions(kubernetesOptionsBytes); err != nil {
+		return nil, fmt.Errorf("parse kubernetes options: %w", err)
+	}
+	if err := s.SetLibvirtOptions(libvirtOptionsBytes); err != nil {
+		return nil, fmt.Errorf("parse libvirt options: %w", err)
+	}
+	if err := s.SetMySQLConfig(mysqlConfigBytes); err != nil {
+		return nil, fmt.Errorf("parse mysql config: %w", err)
+	}
+	if err := s.SetPostgresConfig(postgresConfigBytes); err != nil {
+		return nil, fmt.Errorf("parse postgres config: %w", err)
+	}
 
 	return &s, nil
 }
@@ -1457,7 +1525,7 @@ func (db *DB) GetSchedulesByPolicyID(ctx context.Context, policyID uuid.UUID) ([
 		       backup_window_start, backup_window_end, excluded_hours, compression_level,
 		       max_file_size_mb, on_mount_unavailable,
 		       priority, preemptible, classification_level, classification_data_types,
-		       docker_options, pihole_config, proxmox_options,
+		       docker_options, pihole_config, proxmox_options, kubernetes_options, libvirt_options, mysql_config, postgres_config, filesystem_snapshot,
 		       enabled, created_at, updated_at
 		FROM schedules
 		WHERE policy_id = $1
@@ -1735,6 +1803,24 @@ func (db *DB) SetScheduleRepositories(ctx context.Context, scheduleID uuid.UUID,
 	return nil
 }
 
+// AgentUsesRepository reports whether any of the agent's schedules backs up
+// to the repository.
+func (db *DB) AgentUsesRepository(ctx context.Context, agentID, repositoryID uuid.UUID) (bool, error) {
+	var uses bool
+	err := db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM schedule_repositories sr
+			JOIN schedules s ON s.id = sr.schedule_id
+			WHERE s.agent_id = $1 AND sr.repository_id = $2
+		)
+	`, agentID, repositoryID).Scan(&uses)
+	if err != nil {
+		return false, fmt.Errorf("check agent repository: %w", err)
+	}
+	return uses, nil
+}
+
 // ReplicationStatus methods
 
 // GetReplicationStatusBySchedule returns all replication status records for a schedule.
@@ -2261,7 +2347,7 @@ func (db *DB) GetAllSchedules(ctx context.Context) ([]*models.Schedule, error) {
 		       retention_policy, bandwidth_limit_kbps, backup_window_start, backup_window_end,
 		       excluded_hours, compression_level, max_file_size_mb, on_mount_unavailable,
 		       priority, preemptible, classification_level, classification_data_types,
-		       docker_options, pihole_config, proxmox_options,
+		       docker_options, pihole_config, proxmox_options, kubernetes_options, libvirt_options, mysql_config, postgres_config, filesystem_snapshot,
 		       enabled, created_at, updated_at
 		FROM schedules
 		WHERE enabled = true
@@ -2294,7 +2380,7 @@ func (db *DB) GetEnabledSchedules(ctx context.Context) ([]models.Schedule, error
 		       retention_policy, bandwidth_limit_kbps, backup_window_start, backup_window_end,
 		       excluded_hours, compression_level, max_file_size_mb, on_mount_unavailable,
 		       priority, preemptible, classification_level, classification_data_types,
-		       docker_options, pihole_config, proxmox_options,
+		       docker_options, pihole_config, proxmox_options, kubernetes_options, libvirt_options, mysql_config, postgres_config, filesystem_snapshot,
 		       enabled, created_at, updated_at
 		FROM schedules
 		WHERE enabled = true
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Approval request methods
+
+const approvalRequestColumns = `
+	id, org_id, action, resource_type, resource_id, summary, reason, payload, status,
+	requested_by, decided_by, decision_comment, error_message, expires_at, decided_at,
+	created_at, updated_at`
+
+// CreateApprovalRequest creates a new approval request.
+func (db *DB) CreateApprovalRequest(ctx context.Context, r *models.ApprovalRequest) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO approval_requests (id, org_id, action, resource_type, resource_id, summary, reason,
+		                               payload, status, requested_by, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`, r.ID, r.OrgID, string(r.Action), r.ResourceType, r.ResourceID, r.Summary, r.Reason,
+		r.Payload, string(r.Status), r.RequestedBy, r.ExpiresAt, r.CreatedAt, r.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create approval request: %w", err)
+	}
+	return nil
+}
+
+// GetApprovalRequestByID returns an approval request by ID.
+func (db *DB) GetApprovalRequestByID(ctx context.Context, id uuid.UUID) (*models.ApprovalRequest, error) {
+	row := db.Pool.QueryRow(ctx, `SELECT`+approvalRequestColumns+`
+		FROM approval_requests
+		WHERE id = $1
+	`, id)
+	return scanApprovalRequest(row)
+}
+
+// GetPendingApprovalRequest returns the open request for an action on a resource, or nil if there is none.
+func (db *DB) GetPendingApprovalRequest(ctx context.Context, orgID uuid.UUID, action models.ApprovalAction, resourceID string) (*models.ApprovalRequest, error) {
+	row := db.Pool.QueryRow(ctx, `SELECT`+approvalRequestColumns+`
+		FROM approval_requests
+		WHERE org_id = $1 AND action = $2 AND resource_id = $3 AND status = 'pending'
+	`, orgID, string(action), resourceID)
+	r, err := scanApprovalRequest(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return r, err
+}
+
+// GetApprovalRequestsByOrgID returns approval requests for an organization,
+// newest first. An empty status returns requests in every state.
+func (db *DB) GetApprovalRequestsByOrgID(ctx context.Context, orgID uuid.UUID, status models.ApprovalStatus) ([]*models.ApprovalRequest, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT`+approvalRequestColumns+`
+		FROM approval_requests
+		WHERE org_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+	`, orgID, string(status))
+	if err != nil {
+		return nil, fmt.Errorf("get approval requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []*models.ApprovalRequest
+	for rows.Next() {
+		r, err := scanApprovalRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate approval requests: %w", err)
+	}
+	return requests, nil
+}
+
+// DecideApprovalRequest records a decision on a pending request. It returns
+// false if the request was no longer pending, so two approvers racing on the
+// same request cannot both act on it.
+func (db *DB) DecideApprovalRequest(ctx context.Context, r *models.ApprovalRequest) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE approval_requests
+		SET status = $2, decided_by = $3, decision_comment = $4, decided_at = $5, updated_at = $6
+		WHERE id = $1 AND status = 'pending'
+	`, r.ID, string(r.Status), r.DecidedBy, r.DecisionComment, r.DecidedAt, r.UpdatedAt)
+	if err != nil {
+		return false, fmt.Errorf("decide approval request: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UpdateApprovalRequestResult records the outcome of executing an approved request.
+func (db *DB) UpdateApprovalRequestResult(ctx context.Context, r *models.ApprovalRequest) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE approval_requests
+		SET status = $2, error_message = $3, updated_at = NOW()
+		WHERE id = $1
+	`, r.ID, string(r.Status), r.ErrorMessage)
+	if err != nil {
+		return fmt.Errorf("update approval request result: %w", err)
+	}
+	return nil
+}
+
+// ExpireApprovalRequests marks pending requests past their deadline as expired.
+func (db *DB) ExpireApprovalRequests(ctx context.Context, now time.Time) (int, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE approval_requests
+		SET status = 'expired', updated_at = NOW()
+		WHERE status = 'pending' AND expires_at < $1
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("expire approval requests: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func scanApprovalRequest(row pgx.Row) (*models.ApprovalRequest, error) {
+	var r models.ApprovalRequest
+	var action, status string
+	err := row.Scan(
+		&r.ID, &r.OrgID, &action, &r.ResourceType, &r.ResourceID, &r.Summary, &r.Reason,
+		&r.Payload, &status, &r.RequestedBy, &r.DecidedBy, &r.DecisionComment, &r.ErrorMessage,
+		&r.ExpiresAt, &r.DecidedAt, &r.CreatedAt, &r.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("scan approval request: %w", err)
+	}
+	r.Action = models.ApprovalAction(action)
+	r.Status = models.ApprovalStatus(status)
+	return &r, nil
+}
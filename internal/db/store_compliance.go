@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+)
+
+// GetComplianceRepositories returns the repositories of an organization with
+// the region and immutability attributes used for 3-2-1 evaluation.
+func (db *DB) GetComplianceRepositories(ctx context.Context, orgID uuid.UUID) ([]*models.ComplianceRepository, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT r.id, r.name, r.type, r.read_only, COALESCE(r.region, ''),
+		       COALESCE(r.immutability_enabled, false)
+		FROM repositories r
+		WHERE r.org_id = $1
+		ORDER BY r.name
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list compliance repositories: %w", err)
+	}
+	defer rows.Close()
+
+	var repos []*models.ComplianceRepository
+	for rows.Next() {
+		var repo models.ComplianceRepository
+		var repoType string
+		if err := rows.Scan(&repo.ID, &repo.Name, &repoType, &repo.ReadOnly, &repo.Region,
+			&repo.ImmutabilityEnabled); err != nil {
+			return nil, fmt.Errorf("scan compliance repository: %w", err)
+		}
+		repo.Type = models.RepositoryType(repoType)
+		repos = append(repos, &repo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate compliance repositories: %w", err)
+	}
+	return repos, nil
+}
+
+// UpsertScheduleCompliance stores the latest compliance evaluation of a schedule.
+func (db *DB) UpsertScheduleCompliance(ctx context.Context, c *models.ScheduleCompliance) error {
+	mediaTypes, err := json.Marshal(c.MediaTypes)
+	if err != nil {
+		return fmt.Errorf("marshal media types: %w", err)
+	}
+	gaps, err := json.Marshal(c.Gaps)
+	if err != nil {
+		return fmt.Errorf("marshal gaps: %w", err)
+	}
+	destinations, err := json.Marshal(c.Destinations)
+	if err != nil {
+		return fmt.Errorf("marshal destinations: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO schedule_compliance (schedule_id, org_id, agent_id, schedule_name, compliant, score,
+		                                 copies, media_types, offsite, immutable, gaps, destinations, evaluated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (schedule_id) DO UPDATE SET
+			agent_id = EXCLUDED.agent_id,
+			schedule_name = EXCLUDED.schedule_name,
+			compliant = EXCLUDED.compliant,
+			score = EXCLUDED.score,
+			copies = EXCLUDED.copies,
+			media_types = EXCLUDED.media_types,
+			offsite = EXCLUDED.offsite,
+			immutable = EXCLUDED.immutable,
+			gaps = EXCLUDED.gaps,
+			destinations = EXCLUDED.destinations,
+			evaluated_at = EXCLUDED.evaluated_at
+	`, c.ScheduleID, c.OrgID, c.AgentID, c.ScheduleName, c.Compliant, c.Score,
+		c.Copies, mediaTypes, c.Offsite, c.Immutable, gaps, destinations, c.EvaluatedAt)
+	if err != nil {
+		return fmt.Errorf("upsert schedule compliance: %w", err)
+	}
+	return nil
+}
+
+// GetScheduleCompliancesByOrgID returns the stored compliance evaluations of
+// an organization's enabled schedules.
+func (db *DB) GetScheduleCompliancesByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.ScheduleCompliance, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT sc.schedule_id, sc.org_id, sc.agent_id, sc.schedule_name, sc.compliant, sc.score,
+		       sc.copies, sc.media_types, sc.offsite, sc.immutable, sc.gaps, sc.destinations,
+		       sc.evaluated_at
+		FROM schedule_compliance sc
+		JOIN schedules s ON s.id = sc.schedule_id
+		WHERE sc.org_id = $1 AND s.enabled = true
+		ORDER BY sc.compliant, sc.score, sc.schedule_name
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list schedule compliance: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*models.ScheduleCompliance
+	for rows.Next() {
+		var c models.ScheduleCompliance
+		var mediaTypes, gaps, destinations []byte
+		if err := rows.Scan(&c.ScheduleID, &c.OrgID, &c.AgentID, &c.ScheduleName, &c.Compliant, &c.Score,
+			&c.Copies, &mediaTypes, &c.Offsite, &c.Immutable, &gaps, &destinations,
+			&c.EvaluatedAt); err != nil {
+			return nil, fmt.Errorf("scan schedule compliance: %w", err)
+		}
+		if err := json.Unmarshal(mediaTypes, &c.MediaTypes); err != nil {
+			return nil, fmt.Errorf("unmarshal media types: %w", err)
+		}
+		if err := json.Unmarshal(gaps, &c.Gaps); err != nil {
+			return nil, fmt.Errorf("unmarshal gaps: %w", err)
+		}
+		if err := json.Unmarshal(destinations, &c.Destinations); err != nil {
+			return nil, fmt.Errorf("unmarshal destinations: %w", err)
+		}
+		results = append(results, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate schedule compliance: %w", err)
+	}
+	return results, nil
+}
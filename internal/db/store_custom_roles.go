@@ -0,0 +1,267 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+)
+
+// Custom Roles methods
+
+// GetCustomRolesByOrgID returns all custom roles for an organization.
+func (db *DB) GetCustomRolesByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.CustomRole, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, org_id, name, COALESCE(description, ''), permissions, created_by, created_at, updated_at
+		FROM custom_roles
+		WHERE org_id = $1
+		ORDER BY name
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("get custom roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []*models.CustomRole
+	for rows.Next() {
+		r, err := scanCustomRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate custom roles: %w", err)
+	}
+	return roles, nil
+}
+
+// GetCustomRoleByID returns a custom role by ID.
+func (db *DB) GetCustomRoleByID(ctx context.Context, id uuid.UUID) (*models.CustomRole, error) {
+	row := db.Pool.QueryRow(ctx, `
+		SELECT id, org_id, name, COALESCE(description, ''), permissions, created_by, created_at, updated_at
+		FROM custom_roles
+		WHERE id = $1
+	`, id)
+	return scanCustomRole(row)
+}
+
+// CreateCustomRole creates a new custom role.
+func (db *DB) CreateCustomRole(ctx context.Context, role *models.CustomRole) error {
+	permsJSON, err := role.PermissionsJSON()
+	if err != nil {
+		return fmt.Errorf("marshal permissions: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO custom_roles (id, org_id, name, description, permissions, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, role.ID, role.OrgID, role.Name, role.Description, permsJSON, role.CreatedBy, role.CreatedAt, role.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create custom role: %w", err)
+	}
+	return nil
+}
+
+// UpdateCustomRole updates an existing custom role.
+func (db *DB) UpdateCustomRole(ctx context.Context, role *models.CustomRole) error {
+	role.UpdatedAt = time.Now()
+
+	permsJSON, err := role.PermissionsJSON()
+	if err != nil {
+		return fmt.Errorf("marshal permissions: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE custom_roles
+		SET name = $2, description = $3, permissions = $4, updated_at = $5
+		WHERE id = $1
+	`, role.ID, role.Name, role.Description, permsJSON, role.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("update custom role: %w", err)
+	}
+	return nil
+}
+
+// DeleteCustomRole deletes a custom role and, via cascade, its bindings.
+func (db *DB) DeleteCustomRole(ctx context.Context, id uuid.UUID) error {
+	_, err := db.Pool.Exec(ctx, `DELETE FROM custom_roles WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete custom role: %w", err)
+	}
+	return nil
+}
+
+// scanCustomRole scans a row into a CustomRole.
+func scanCustomRole(row interface{ Scan(dest ...any) error }) (*models.CustomRole, error) {
+	var r models.CustomRole
+	var permsBytes []byte
+
+	err := row.Scan(&r.ID, &r.OrgID, &r.Name, &r.Description, &permsBytes, &r.CreatedBy, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("scan custom role: %w", err)
+	}
+	if err := r.SetPermissions(permsBytes); err != nil {
+		return nil, fmt.Errorf("parse permissions: %w", err)
+	}
+	return &r, nil
+}
+
+// Role Bindings methods
+
+// GetRoleBindingsByOrgID returns all role bindings for an organization.
+func (db *DB) GetRoleBindingsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.RoleBinding, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, org_id, role_id, subject_type, user_id, COALESCE(sso_group_name, ''),
+		       agent_group_ids, repository_ids, created_by, created_at, updated_at
+		FROM role_bindings
+		WHERE org_id = $1
+		ORDER BY created_at
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("get role bindings: %w", err)
+	}
+	defer rows.Close()
+
+	var bindings []*models.RoleBinding
+	for rows.Next() {
+		b, err := scanRoleBinding(rows)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate role bindings: %w", err)
+	}
+	return bindings, nil
+}
+
+// GetRoleBindingByID returns a role binding by ID.
+func (db *DB) GetRoleBindingByID(ctx context.Context, id uuid.UUID) (*models.RoleBinding, error) {
+	row := db.Pool.QueryRow(ctx, `
+		SELECT id, org_id, role_id, subject_type, user_id, COALESCE(sso_group_name, ''),
+		       agent_group_ids, repository_ids, created_by, created_at, updated_at
+		FROM role_bindings
+		WHERE id = $1
+	`, id)
+	return scanRoleBinding(row)
+}
+
+// CreateRoleBinding creates a new role binding.
+func (db *DB) CreateRoleBinding(ctx context.Context, b *models.RoleBinding) error {
+	agentGroupsJSON, err := b.AgentGroupIDsJSON()
+	if err != nil {
+		return fmt.Errorf("marshal agent group ids: %w", err)
+	}
+	reposJSON, err := b.RepositoryIDsJSON()
+	if err != nil {
+		return fmt.Errorf("marshal repository ids: %w", err)
+	}
+
+	var ssoGroupName *string
+	if b.SSOGroupName != "" {
+		ssoGroupName = &b.SSOGroupName
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO role_bindings (id, org_id, role_id, subject_type, user_id, sso_group_name,
+		                           agent_group_ids, repository_ids, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, b.ID, b.OrgID, b.RoleID, string(b.SubjectType), b.UserID, ssoGroupName,
+		agentGroupsJSON, reposJSON, b.CreatedBy, b.CreatedAt, b.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create role binding: %w", err)
+	}
+	return nil
+}
+
+// DeleteRoleBinding deletes a role binding.
+func (db *DB) DeleteRoleBinding(ctx context.Context, id uuid.UUID) error {
+	_, err := db.Pool.Exec(ctx, `DELETE FROM role_bindings WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete role binding: %w", err)
+	}
+	return nil
+}
+
+// GetEffectiveRoleBindings returns every custom role binding that applies to a
+// user in an organization, either directly or through the SSO groups recorded
+// at the user's last login, joined with the permissions of the bound role.
+func (db *DB) GetEffectiveRoleBindings(ctx context.Context, orgID, userID uuid.UUID) ([]*models.EffectiveRoleBinding, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT b.id, b.org_id, b.role_id, b.subject_type, b.user_id, COALESCE(b.sso_group_name, ''),
+		       b.agent_group_ids, b.repository_ids, b.created_by, b.created_at, b.updated_at,
+		       r.name, r.permissions
+		FROM role_bindings b
+		JOIN custom_roles r ON r.id = b.role_id
+		WHERE b.org_id = $1
+		  AND (
+		      (b.subject_type = 'user' AND b.user_id = $2)
+		      OR (b.subject_type = 'sso_group' AND b.sso_group_name IN (
+		          SELECT unnest(oidc_groups) FROM user_sso_groups WHERE user_id = $2
+		      ))
+		  )
+	`, orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get effective role bindings: %w", err)
+	}
+	defer rows.Close()
+
+	var bindings []*models.EffectiveRoleBinding
+	for rows.Next() {
+		var e models.EffectiveRoleBinding
+		var subjectType string
+		var agentGroupsBytes, reposBytes, permsBytes []byte
+		err := rows.Scan(
+			&e.ID, &e.OrgID, &e.RoleID, &subjectType, &e.UserID, &e.SSOGroupName,
+			&agentGroupsBytes, &reposBytes, &e.CreatedBy, &e.CreatedAt, &e.UpdatedAt,
+			&e.RoleName, &permsBytes,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan effective role binding: %w", err)
+		}
+		e.SubjectType = models.RoleBindingSubjectType(subjectType)
+		if err := e.SetAgentGroupIDs(agentGroupsBytes); err != nil {
+			return nil, fmt.Errorf("parse agent group ids: %w", err)
+		}
+		if err := e.SetRepositoryIDs(reposBytes); err != nil {
+			return nil, fmt.Errorf("parse repository ids: %w", err)
+		}
+		role := models.CustomRole{}
+		if err := role.SetPermissions(permsBytes); err != nil {
+			return nil, fmt.Errorf("parse permissions: %w", err)
+		}
+		e.Permissions = role.Permissions
+		bindings = append(bindings, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate effective role bindings: %w", err)
+	}
+	return bindings, nil
+}
+
+// scanRoleBinding scans a row into a RoleBinding.
+func scanRoleBinding(row interface{ Scan(dest ...any) error }) (*models.RoleBinding, error) {
+	var b models.RoleBinding
+	var subjectType string
+	var agentGroupsBytes, reposBytes []byte
+
+	err := row.Scan(
+		&b.ID, &b.OrgID, &b.RoleID, &subjectType, &b.UserID, &b.SSOGroupName,
+		&agentGroupsBytes, &reposBytes, &b.CreatedBy, &b.CreatedAt, &b.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("scan role binding: %w", err)
+	}
+	b.SubjectType = models.RoleBindingSubjectType(subjectType)
+	if err := b.SetAgentGroupIDs(agentGroupsBytes); err != nil {
+		return nil, fmt.Errorf("parse agent group ids: %w", err)
+	}
+	if err := b.SetRepositoryIDs(reposBytes); err != nil {
+		return nil, fmt.Errorf("parse repository ids: %w", err)
+	}
+	return &b, nil
+}
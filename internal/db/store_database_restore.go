@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+)
+
+// CreateDatabaseRestore creates a new database restore record.
+func (db *DB) CreateDatabaseRestore(ctx context.Context, restore *models.DatabaseRestore) error {
+	resultJSON, err := restore.ResultJSON()
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO database_restores (
+			id, org_id, schedule_id, repository_id, snapshot_id, filename, database_name,
+			status, result, error_message, started_at, completed_at, created_by,
+			created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	`, restore.ID, restore.OrgID, restore.ScheduleID, restore.RepositoryID, restore.SnapshotID,
+		restore.Filename, restore.Database, string(restore.Status), resultJSON,
+		restore.ErrorMessage, restore.StartedAt, restore.CompletedAt, restore.CreatedBy,
+		restore.CreatedAt, restore.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create database restore: %w", err)
+	}
+	return nil
+}
+
+// UpdateDatabaseRestore updates the progress and result of a database restore.
+func (db *DB) UpdateDatabaseRestore(ctx context.Context, restore *models.DatabaseRestore) error {
+	restore.UpdatedAt = time.Now()
+
+	resultJSON, err := restore.ResultJSON()
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE database_restores
+		SET status = $2, result = $3, error_message = $4, started_at = $5,
+		    completed_at = $6, updated_at = $7
+		WHERE id = $1
+	`, restore.ID, string(restore.Status), resultJSON, restore.ErrorMessage,
+		restore.StartedAt, restore.CompletedAt, restore.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("update database restore: %w", err)
+	}
+	return nil
+}
+
+// GetDatabaseRestoreByID returns a database restore by its ID.
+func (db *DB) GetDatabaseRestoreByID(ctx context.Context, id uuid.UUID) (*models.DatabaseRestore, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, org_id, schedule_id, repository_id, snapshot_id, filename, database_name,
+		       status, result, error_message, started_at, completed_at, created_by,
+		       created_at, updated_at
+		FROM database_restores
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("get database restore by ID: %w", err)
+	}
+	defer rows.Close()
+
+	restores, err := scanDatabaseRestores(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(restores) == 0 {
+		return nil, fmt.Errorf("database restore not found: %s", id)
+	}
+	return restores[0], nil
+}
+
+// GetDatabaseRestoresByOrgID returns the database restores for an organization, newest first.
+func (db *DB) GetDatabaseRestoresByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.DatabaseRestore, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, org_id, schedule_id, repository_id, snapshot_id, filename, database_name,
+		       status, result, error_message, started_at, completed_at, created_by,
+		       created_at, updated_at
+		FROM database_restores
+		WHERE org_id = $1
+		ORDER BY created_at DESC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list database restores: %w", err)
+	}
+	defer rows.Close()
+
+	return scanDatabaseRestores(rows)
+}
+
+func scanDatabaseRestores(rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+}) ([]*models.DatabaseRestore, error) {
+	var restores []*models.DatabaseRestore
+	for rows.Next() {
+		var restore models.DatabaseRestore
+		var resultJSON []byte
+		var statusStr string
+
+		err := rows.Scan(
+			&restore.ID, &restore.OrgID, &restore.ScheduleID, &restore.RepositoryID,
+			&restore.SnapshotID, &restore.Filename, &restore.Database, &statusStr,
+			&resultJSON, &restore.ErrorMessage, &restore.StartedAt, &restore.CompletedAt,
+			&restore.CreatedBy, &restore.CreatedAt, &restore.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan database restore: %w", err)
+		}
+
+		restore.Status = models.DatabaseRestoreStatus(statusStr)
+		if err := restore.SetResultFromJSON(resultJSON); err != nil {
+			return nil, fmt.Errorf("parse result: %w", err)
+		}
+
+		restores = append(restores, &restore)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate database restores: %w", err)
+	}
+	return restores, nil
+}
@@ -135,13 +135,15 @@ func (db *DB) UpdateDockerContainer(ctx context.Context, config *models.DockerCo
 			container_name = $2, image_name = $3, enabled = $4, schedule = $5,
 			cron_expression = $6, excludes = $7, pre_hook = $8, post_hook = $9,
 			stop_on_backup = $10, backup_volumes = $11, backup_bind_mounts = $12,
-			labels = $13, overrides = $14, last_backup_at = $15, updated_at = $16
+			labels = $13, overrides = $14, last_backup_at = $15, updated_at = $16,
+			container_id = $17
 		WHERE id = $1
 	`,
 		config.ID, config.ContainerName, config.ImageName, config.Enabled, string(config.Schedule),
 		config.CronExpression, excludesJSON, config.PreHook, config.PostHook,
 		config.StopOnBackup, config.BackupVolumes, config.BackupBindMounts,
 		labelsJSON, overridesJSON, config.LastBackupAt, config.UpdatedAt,
+		config.ContainerID,
 	)
 	if err != nil {
 		return fmt.Errorf("update docker container: %w", err)
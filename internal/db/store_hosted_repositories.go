@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+)
+
+// UpsertHostedRepositoryUsage records the disk used by a hosted repository.
+func (db *DB) UpsertHostedRepositoryUsage(ctx context.Context, usage *models.HostedRepositoryUsage) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO hosted_repository_usage (repository_id, org_id, used_bytes, quota_bytes, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (repository_id) DO UPDATE SET
+			used_bytes = EXCLUDED.used_bytes,
+			quota_bytes = EXCLUDED.quota_bytes,
+			updated_at = EXCLUDED.updated_at
+	`, usage.RepositoryID, usage.OrgID, usage.UsedBytes, usage.QuotaBytes, usage.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("upsert hosted repository usage: %w", err)
+	}
+	return nil
+}
+
+// GetHostedStorageByOrgID returns the total disk used by an organization's hosted repositories.
+func (db *DB) GetHostedStorageByOrgID(ctx context.Context, orgID uuid.UUID) (int64, error) {
+	var storage int64
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(used_bytes), 0)
+		FROM hosted_repository_usage
+		WHERE org_id = $1
+	`, orgID).Scan(&storage)
+	if err != nil {
+		return 0, fmt.Errorf("sum hosted storage: %w", err)
+	}
+	return storage, nil
+}
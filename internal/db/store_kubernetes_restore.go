@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+)
+
+// CreateKubernetesRestore creates a new Kubernetes restore record.
+func (db *DB) CreateKubernetesRestore(ctx context.Context, restore *models.KubernetesRestore) error {
+	namespaces := restore.Namespaces
+	if namespaces == nil {
+		namespaces = []string{}
+	}
+	namespacesJSON, err := json.Marshal(namespaces)
+	if err != nil {
+		return fmt.Errorf("marshal namespaces: %w", err)
+	}
+	namespaceMappingJSON, err := marshalStringMap(restore.NamespaceMapping)
+	if err != nil {
+		return fmt.Errorf("marshal namespace mapping: %w", err)
+	}
+	nameMappingJSON, err := marshalStringMap(restore.NameMapping)
+	if err != nil {
+		return fmt.Errorf("marshal name mapping: %w", err)
+	}
+	resultJSON, err := restore.ResultJSON()
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO kubernetes_restores (
+			id, org_id, repository_id, snapshot_id, namespaces, namespace_mapping, name_mapping,
+			target_server, agent_id, command_id, overwrite, restore_volumes, status, result, error_message,
+			started_at, completed_at, created_by, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+	`, restore.ID, restore.OrgID, restore.RepositoryID, restore.SnapshotID, namespacesJSON,
+		namespaceMappingJSON, nameMappingJSON, restore.TargetServer, restore.AgentID, restore.CommandID, restore.Overwrite,
+		restore.RestoreVolumes, string(restore.Status), resultJSON, restore.ErrorMessage,
+		restore.StartedAt, restore.CompletedAt, restore.CreatedBy, restore.CreatedAt, restore.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create kubernetes restore: %w", err)
+	}
+	return nil
+}
+
+// UpdateKubernetesRestore updates the status and result of a Kubernetes restore.
+func (db *DB) UpdateKubernetesRestore(ctx context.Context, restore *models.KubernetesRestore) error {
+	restore.UpdatedAt = time.Now()
+
+	resultJSON, err := restore.ResultJSON()
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE kubernetes_restores
+		SET status = $2, result = $3, error_message = $4, started_at = $5,
+		    completed_at = $6, updated_at = $7
+		WHERE id = $1
+	`, restore.ID, string(restore.Status), resultJSON, restore.ErrorMessage,
+		restore.StartedAt, restore.CompletedAt, restore.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("update kubernetes restore: %w", err)
+	}
+	return nil
+}
+
+// GetKubernetesRestoreByID returns a Kubernetes restore by its ID.
+func (db *DB) GetKubernetesRestoreByID(ctx context.Context, id uuid.UUID) (*models.KubernetesRestore, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, org_id, repository_id, snapshot_id, namespaces, namespace_mapping, name_mapping,
+		       target_server, agent_id, command_id, overwrite, restore_volumes, status, result, error_message,
+		       started_at, completed_at, created_by, created_at, updated_at
+		FROM kubernetes_restores
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("get kubernetes restore by ID: %w", err)
+	}
+	defer rows.Close()
+
+	restores, err := scanKubernetesRestores(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(restores) == 0 {
+		return nil, fmt.Errorf("kubernetes restore not found: %s", id)
+	}
+	return restores[0], nil
+}
+
+// GetKubernetesRestoresByOrgID returns the Kubernetes restores for an organization, newest first.
+func (db *DB) GetKubernetesRestoresByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.KubernetesRestore, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, org_id, repository_id, snapshot_id, namespaces, namespace_mapping, name_mapping,
+		       target_server, agent_id, command_id, overwrite, restore_volumes, status, result, error_message,
+		       started_at, completed_at, created_by, created_at, updated_at
+		FROM kubernetes_restores
+		WHERE org_id = $1
+		ORDER BY created_at DESC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list kubernetes restores: %w", err)
+	}
+	defer rows.Close()
+
+	return scanKubernetesRestores(rows)
+}
+
+func scanKubernetesRestores(rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+}) ([]*models.KubernetesRestore, error) {
+	var restores []*models.KubernetesRestore
+	for rows.Next() {
+		var restore models.KubernetesRestore
+		var namespacesJSON, namespaceMappingJSON, nameMappingJSON, resultJSON []byte
+		var statusStr string
+
+		err := rows.Scan(
+			&restore.ID, &restore.OrgID, &restore.RepositoryID, &restore.SnapshotID,
+			&namespacesJSON, &namespaceMappingJSON, &nameMappingJSON,
+			&restore.TargetServer, &restore.AgentID, &restore.CommandID, &restore.Overwrite, &restore.RestoreVolumes, &statusStr,
+			&resultJSON, &restore.ErrorMessage, &restore.StartedAt, &restore.CompletedAt,
+			&restore.CreatedBy, &restore.CreatedAt, &restore.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan kubernetes restore: %w", err)
+		}
+
+		restore.Status = models.KubernetesRestoreStatus(statusStr)
+		if len(namespacesJSON) > 0 {
+			if err := json.Unmarshal(namespacesJSON, &restore.Namespaces); err != nil {
+				return nil, fmt.Errorf("parse namespaces: %w", err)
+			}
+		}
+		if len(namespaceMappingJSON) > 0 {
+			if err := json.Unmarshal(namespaceMappingJSON, &restore.NamespaceMapping); err != nil {
+				return nil, fmt.Errorf("parse namespace mapping: %w", err)
+			}
+		}
+		if len(nameMappingJSON) > 0 {
+			if err := json.Unmarshal(nameMappingJSON, &restore.NameMapping); err != nil {
+				return nil, fmt.Errorf("parse name mapping: %w", err)
+			}
+		}
+		if err := restore.SetResultFromJSON(resultJSON); err != nil {
+			return nil, fmt.Errorf("parse result: %w", err)
+		}
+
+		restores = append(restores, &restore)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate kubernetes restores: %w", err)
+	}
+	return restores, nil
+}
+
+// marshalStringMap marshals a possibly nil map as a JSON object.
+func marshalStringMap(m map[string]string) ([]byte, error) {
+	if m == nil {
+		m = map[string]string{}
+	}
+	return json.Marshal(m)
+}
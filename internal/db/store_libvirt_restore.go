@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+)
+
+// CreateLibvirtRestore creates a new libvirt restore record.
+func (db *DB) CreateLibvirtRestore(ctx context.Context, restore *models.LibvirtRestore) error {
+	resultJSON, err := restore.ResultJSON()
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO libvirt_restores (
+			id, org_id, repository_id, snapshot_id, agent_id, command_id, uri, domain, new_name, target_dir,
+			overwrite, start_domain, status, result, error_message, started_at,
+			completed_at, created_by, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+	`, restore.ID, restore.OrgID, restore.RepositoryID, restore.SnapshotID, restore.AgentID, restore.CommandID, restore.URI,
+		restore.Domain, restore.NewName, restore.TargetDir, restore.Overwrite, restore.StartDomain,
+		string(restore.Status), resultJSON, restore.ErrorMessage, restore.StartedAt,
+		restore.CompletedAt, restore.CreatedBy, restore.CreatedAt, restore.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create libvirt restore: %w", err)
+	}
+	return nil
+}
+
+// UpdateLibvirtRestore updates the progress and result of a libvirt restore.
+func (db *DB) UpdateLibvirtRestore(ctx context.Context, restore *models.LibvirtRestore) error {
+	restore.UpdatedAt = time.Now()
+
+	resultJSON, err := restore.ResultJSON()
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE libvirt_restores
+		SET status = $2, result = $3, error_message = $4, started_at = $5,
+		    completed_at = $6, updated_at = $7
+		WHERE id = $1
+	`, restore.ID, string(restore.Status), resultJSON, restore.ErrorMessage,
+		restore.StartedAt, restore.CompletedAt, restore.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("update libvirt restore: %w", err)
+	}
+	return nil
+}
+
+// GetLibvirtRestoreByID returns a libvirt restore by its ID.
+func (db *DB) GetLibvirtRestoreByID(ctx context.Context, id uuid.UUID) (*models.LibvirtRestore, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, org_id, repository_id, snapshot_id, agent_id, command_id, uri, domain, new_name, target_dir,
+		       overwrite, start_domain, status, result, error_message, started_at,
+		       completed_at, created_by, created_at, updated_at
+		FROM libvirt_restores
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("get libvirt restore by ID: %w", err)
+	}
+	defer rows.Close()
+
+	restores, err := scanLibvirtRestores(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(restores) == 0 {
+		return nil, fmt.Errorf("libvirt restore not found: %s", id)
+	}
+	return restores[0], nil
+}
+
+// GetLibvirtRestoresByOrgID returns the libvirt restores for an organization, newest first.
+func (db *DB) GetLibvirtRestoresByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.LibvirtRestore, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, org_id, repository_id, snapshot_id, agent_id, command_id, uri, domain, new_name, target_dir,
+		       overwrite, start_domain, status, result, error_message, started_at,
+		       completed_at, created_by, created_at, updated_at
+		FROM libvirt_restores
+		WHERE org_id = $1
+		ORDER BY created_at DESC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list libvirt restores: %w", err)
+	}
+	defer rows.Close()
+
+	return scanLibvirtRestores(rows)
+}
+
+func scanLibvirtRestores(rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+}) ([]*models.LibvirtRestore, error) {
+	var restores []*models.LibvirtRestore
+	for rows.Next() {
+		var restore models.LibvirtRestore
+		var resultJSON []byte
+		var statusStr string
+
+		err := rows.Scan(
+			&restore.ID, &restore.OrgID, &restore.RepositoryID, &restore.SnapshotID,
+			&restore.AgentID, &restore.CommandID, &restore.URI, &restore.Domain, &restore.NewName, &restore.TargetDir,
+			&restore.Overwrite, &restore.StartDomain, &statusStr, &resultJSON,
+			&restore.ErrorMessage, &restore.StartedAt, &restore.CompletedAt,
+			&restore.CreatedBy, &restore.CreatedAt, &restore.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan libvirt restore: %w", err)
+		}
+
+		restore.Status = models.LibvirtRestoreStatus(statusStr)
+		if err := restore.SetResultFromJSON(resultJSON); err != nil {
+			return nil, fmt.Errorf("parse result: %w", err)
+		}
+
+		restores = append(restores, &restore)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate libvirt restores: %w", err)
+	}
+	return restores, nil
+}
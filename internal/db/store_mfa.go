@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// User MFA methods
+
+// GetMFAFactorsByUserID returns all MFA factors enrolled by a user, confirmed or not.
+func (db *DB) GetMFAFactorsByUserID(ctx context.Context, userID uuid.UUID) ([]*models.UserMFAFactor, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, user_id, factor_type, name, secret_encrypted, credential_id, public_key,
+		       algorithm, sign_count, confirmed_at, last_used_at, created_at
+		FROM user_mfa_factors
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get mfa factors: %w", err)
+	}
+	defer rows.Close()
+
+	var factors []*models.UserMFAFactor
+	for rows.Next() {
+		f, err := scanMFAFactor(rows)
+		if err != nil {
+			return nil, err
+		}
+		factors = append(factors, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate mfa factors: %w", err)
+	}
+	return factors, nil
+}
+
+// GetMFAFactorByID returns an MFA factor by ID.
+func (db *DB) GetMFAFactorByID(ctx context.Context, id uuid.UUID) (*models.UserMFAFactor, error) {
+	row := db.Pool.QueryRow(ctx, `
+		SELECT id, user_id, factor_type, name, secret_encrypted, credential_id, public_key,
+		       algorithm, sign_count, confirmed_at, last_used_at, created_at
+		FROM user_mfa_factors
+		WHERE id = $1
+	`, id)
+	return scanMFAFactor(row)
+}
+
+// CreateMFAFactor creates a new MFA factor.
+func (db *DB) CreateMFAFactor(ctx context.Context, f *models.UserMFAFactor) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO user_mfa_factors (id, user_id, factor_type, name, secret_encrypted, credential_id,
+		                              public_key, algorithm, sign_count, confirmed_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, f.ID, f.UserID, string(f.Type), f.Name, f.SecretEncrypted, f.CredentialID,
+		f.PublicKey, f.Algorithm, int64(f.SignCount), f.ConfirmedAt, f.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create mfa factor: %w", err)
+	}
+	return nil
+}
+
+// ConfirmMFAFactor marks a pending factor as confirmed.
+func (db *DB) ConfirmMFAFactor(ctx context.Context, id uuid.UUID) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE user_mfa_factors
+		SET confirmed_at = NOW(), last_used_at = NOW()
+		WHERE id = $1 AND confirmed_at IS NULL
+	`, id)
+	if err != nil {
+		return fmt.Errorf("confirm mfa factor: %w", err)
+	}
+	return nil
+}
+
+// UpdateMFAFactorUsage records a successful use of a factor and its new WebAuthn sign count.
+func (db *DB) UpdateMFAFactorUsage(ctx context.Context, id uuid.UUID, signCount uint32) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE user_mfa_factors
+		SET last_used_at = NOW(), sign_count = $2
+		WHERE id = $1
+	`, id, int64(signCount))
+	if err != nil {
+		return fmt.Errorf("update mfa factor usage: %w", err)
+	}
+	return nil
+}
+
+// DeleteMFAFactor deletes an MFA factor.
+func (db *DB) DeleteMFAFactor(ctx context.Context, id uuid.UUID) error {
+	_, err := db.Pool.Exec(ctx, `DELETE FROM user_mfa_factors WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete mfa factor: %w", err)
+	}
+	return nil
+}
+
+// ReplaceMFARecoveryCodes replaces all of a user's recovery codes with the given hashes.
+// Passing no hashes removes every recovery code.
+func (db *DB) ReplaceMFARecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	return db.ExecTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM user_mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return fmt.Errorf("delete recovery codes: %w", err)
+		}
+		now := time.Now()
+		for _, hash := range codeHashes {
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO user_mfa_recovery_codes (id, user_id, code_hash, created_at)
+				VALUES ($1, $2, $3, $4)
+			`, uuid.New(), userID, hash, now); err != nil {
+				return fmt.Errorf("insert recovery code: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ConsumeMFARecoveryCode marks an unused recovery code as used.
+// Returns false if no matching unused code exists.
+func (db *DB) ConsumeMFARecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE user_mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("consume recovery code: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// CountUnusedMFARecoveryCodes returns how many recovery codes a user has left.
+func (db *DB) CountUnusedMFARecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM user_mfa_recovery_codes
+		WHERE user_id = $1 AND used_at IS NULL
+	`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// RecordMFALoginFailure counts a failed second factor for a pending password
+// login. Once maxAttempts is reached the counter is reset and the user's MFA
+// logins are locked for lockout. Returns true if this failure locked them.
+func (db *DB) RecordMFALoginFailure(ctx context.Context, userID uuid.UUID, maxAttempts int, lockout time.Duration) (bool, error) {
+	var attempts int
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO user_mfa_login_attempts (user_id, failed_attempts, updated_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET failed_attempts = user_mfa_login_attempts.failed_attempts + 1, updated_at = NOW()
+		RETURNING failed_attempts
+	`, userID).Scan(&attempts)
+	if err != nil {
+		return false, fmt.Errorf("record mfa login failure: %w", err)
+	}
+	if attempts < maxAttempts {
+		return false, nil
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE user_mfa_login_attempts
+		SET failed_attempts = 0, locked_until = $2, updated_at = NOW()
+		WHERE user_id = $1
+	`, userID, time.Now().Add(lockout))
+	if err != nil {
+		return false, fmt.Errorf("lock mfa logins: %w", err)
+	}
+	return true, nil
+}
+
+// GetMFALoginLockedUntil returns when a user's MFA login lockout ends, or nil
+// if their MFA logins have never been locked.
+func (db *DB) GetMFALoginLockedUntil(ctx context.Context, userID uuid.UUID) (*time.Time, error) {
+	var lockedUntil *time.Time
+	err := db.Pool.QueryRow(ctx, `
+		SELECT locked_until FROM user_mfa_login_attempts WHERE user_id = $1
+	`, userID).Scan(&lockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get mfa login lockout: %w", err)
+	}
+	return lockedUntil, nil
+}
+
+// ResetMFALoginFailures clears a user's failed second-factor count after a
+// successful MFA login.
+func (db *DB) ResetMFALoginFailures(ctx context.Context, userID uuid.UUID) error {
+	_, err := db.Pool.Exec(ctx, `DELETE FROM user_mfa_login_attempts WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("reset mfa login failures: %w", err)
+	}
+	return nil
+}
+
+func scanMFAFactor(row interface{ Scan(dest ...any) error }) (*models.UserMFAFactor, error) {
+	var f models.UserMFAFactor
+	var factorType string
+	var signCount int64
+
+	err := row.Scan(&f.ID, &f.UserID, &factorType, &f.Name, &f.SecretEncrypted, &f.CredentialID,
+		&f.PublicKey, &f.Algorithm, &signCount, &f.ConfirmedAt, &f.LastUsedAt, &f.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("scan mfa factor: %w", err)
+	}
+	f.Type = models.MFAFactorType(factorType)
+	f.SignCount = uint32(signCount)
+	return &f, nil
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const pbsConnectionColumns = `id, org_id, name, host, port, username,
+			token_id, token_secret_encrypted, fingerprint, verify_ssl,
+			datastore, namespace, retention, verify_outdated_days, enabled,
+			last_connected_at, created_at, updated_at`
+
+// CreatePBSConnection creates a new Proxmox Backup Server connection record.
+func (db *DB) CreatePBSConnection(ctx context.Context, conn *models.PBSConnection) error {
+	retention, err := conn.RetentionJSON()
+	if err != nil {
+		return fmt.Errorf("marshal retention: %w", err)
+	}
+
+	query := `
+		INSERT INTO pbs_connections (
+			id, org_id, name, host, port, username,
+			token_id, token_secret_encrypted, fingerprint, verify_ssl,
+			datastore, namespace, retention, verify_outdated_days, enabled,
+			created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+	`
+
+	_, err = db.Pool.Exec(ctx, query,
+		conn.ID,
+		conn.OrgID,
+		conn.Name,
+		conn.Host,
+		conn.Port,
+		conn.Username,
+		conn.TokenID,
+		conn.TokenSecretEncrypted,
+		conn.Fingerprint,
+		conn.VerifySSL,
+		conn.Datastore,
+		conn.Namespace,
+		retention,
+		conn.VerifyOutdatedDays,
+		conn.Enabled,
+		conn.CreatedAt,
+		conn.UpdatedAt,
+	)
+
+	return err
+}
+
+// GetPBSConnectionByID retrieves a PBS connection by its ID.
+func (db *DB) GetPBSConnectionByID(ctx context.Context, id uuid.UUID) (*models.PBSConnection, error) {
+	query := `SELECT ` + pbsConnectionColumns + ` FROM pbs_connections WHERE id = $1`
+	return scanPBSConnection(db.Pool.QueryRow(ctx, query, id))
+}
+
+// GetPBSConnectionsByOrgID retrieves all PBS connections for an organization.
+func (db *DB) GetPBSConnectionsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.PBSConnection, error) {
+	query := `SELECT ` + pbsConnectionColumns + ` FROM pbs_connections WHERE org_id = $1 ORDER BY name ASC`
+
+	rows, err := db.Pool.Query(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var connections []*models.PBSConnection
+	for rows.Next() {
+		conn, err := scanPBSConnection(rows)
+		if err != nil {
+			return nil, err
+		}
+		connections = append(connections, conn)
+	}
+
+	return connections, rows.Err()
+}
+
+// UpdatePBSConnection updates an existing PBS connection.
+func (db *DB) UpdatePBSConnection(ctx context.Context, conn *models.PBSConnection) error {
+	conn.UpdatedAt = time.Now()
+
+	retention, err := conn.RetentionJSON()
+	if err != nil {
+		return fmt.Errorf("marshal retention: %w", err)
+	}
+
+	query := `
+		UPDATE pbs_connections SET
+			name = $2,
+			host = $3,
+			port = $4,
+			username = $5,
+			token_id = $6,
+			token_secret_encrypted = $7,
+			fingerprint = $8,
+			verify_ssl = $9,
+			datastore = $10,
+			namespace = $11,
+			retention = $12,
+			verify_outdated_days = $13,
+			enabled = $14,
+			last_connected_at = $15,
+			updated_at = $16
+		WHERE id = $1
+	`
+
+	_, err = db.Pool.Exec(ctx, query,
+		conn.ID,
+		conn.Name,
+		conn.Host,
+		conn.Port,
+		conn.Username,
+		conn.TokenID,
+		conn.TokenSecretEncrypted,
+		conn.Fingerprint,
+		conn.VerifySSL,
+		conn.Datastore,
+		conn.Namespace,
+		retention,
+		conn.VerifyOutdatedDays,
+		conn.Enabled,
+		conn.LastConnectedAt,
+		conn.UpdatedAt,
+	)
+
+	return err
+}
+
+// DeletePBSConnection removes a PBS connection.
+func (db *DB) DeletePBSConnection(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM pbs_connections WHERE id = $1`
+	_, err := db.Pool.Exec(ctx, query, id)
+	return err
+}
+
+// scanPBSConnection scans a row selected with pbsConnectionColumns.
+func scanPBSConnection(row pgx.Row) (*models.PBSConnection, error) {
+	conn := &models.PBSConnection{}
+	var tokenID, fingerprint, namespace *string
+	var retention []byte
+	err := row.Scan(
+		&conn.ID,
+		&conn.OrgID,
+		&conn.Name,
+		&conn.Host,
+		&conn.Port,
+		&conn.Username,
+		&tokenID,
+		&conn.TokenSecretEncrypted,
+		&fingerprint,
+		&conn.VerifySSL,
+		&conn.Datastore,
+		&namespace,
+		&retention,
+		&conn.VerifyOutdatedDays,
+		&conn.Enabled,
+		&conn.LastConnectedAt,
+		&conn.CreatedAt,
+		&conn.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokenID != nil {
+		conn.TokenID = *tokenID
+	}
+	if fingerprint != nil {
+		conn.Fingerprint = *fingerprint
+	}
+	if namespace != nil {
+		conn.Namespace = *namespace
+	}
+	if err := conn.SetRetention(retention); err != nil {
+		return nil, fmt.Errorf("parse retention: %w", err)
+	}
+
+	return conn, nil
+}
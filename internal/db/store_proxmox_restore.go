@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+)
+
+// CreateProxmoxRestore creates a new Proxmox restore record.
+func (db *DB) CreateProxmoxRestore(ctx context.Context, restore *models.ProxmoxRestore) error {
+	resultJSON, err := restore.ResultJSON()
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO proxmox_restores (
+			id, org_id, connection_id, repository_id, snapshot_id, archive, source_vmid,
+			target_node, target_storage, upload_storage, new_vmid, overwrite, is_unique,
+			start_guest, health_check, health_timeout_seconds, status, phase, task_upid,
+			result, error_message, started_at, completed_at, created_by, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17,
+		          $18, $19, $20, $21, $22, $23, $24, $25, $26)
+	`, restore.ID, restore.OrgID, restore.ConnectionID, restore.RepositoryID, restore.SnapshotID,
+		restore.Archive, restore.SourceVMID, restore.TargetNode, restore.TargetStorage,
+		restore.UploadStorage, restore.NewVMID, restore.Overwrite, restore.Unique,
+		restore.StartGuest, restore.HealthCheck, restore.HealthTimeoutSeconds,
+		string(restore.Status), string(restore.Phase), restore.TaskUPID, resultJSON,
+		restore.ErrorMessage, restore.StartedAt, restore.CompletedAt, restore.CreatedBy,
+		restore.CreatedAt, restore.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create proxmox restore: %w", err)
+	}
+	return nil
+}
+
+// UpdateProxmoxRestore updates the progress and result of a Proxmox restore.
+func (db *DB) UpdateProxmoxRestore(ctx context.Context, restore *models.ProxmoxRestore) error {
+	restore.UpdatedAt = time.Now()
+
+	resultJSON, err := restore.ResultJSON()
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE proxmox_restores
+		SET status = $2, phase = $3, task_upid = $4, result = $5, error_message = $6,
+		    started_at = $7, completed_at = $8, updated_at = $9
+		WHERE id = $1
+	`, restore.ID, string(restore.Status), string(restore.Phase), restore.TaskUPID, resultJSON,
+		restore.ErrorMessage, restore.StartedAt, restore.CompletedAt, restore.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("update proxmox restore: %w", err)
+	}
+	return nil
+}
+
+// GetProxmoxRestoreByID returns a Proxmox restore by its ID.
+func (db *DB) GetProxmoxRestoreByID(ctx context.Context, id uuid.UUID) (*models.ProxmoxRestore, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, org_id, connection_id, repository_id, snapshot_id, archive, source_vmid,
+		       target_node, target_storage, upload_storage, new_vmid, overwrite, is_unique,
+		       start_guest, health_check, health_timeout_seconds, status, phase, task_upid,
+		       result, error_message, started_at, completed_at, created_by, created_at, updated_at
+		FROM proxmox_restores
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("get proxmox restore by ID: %w", err)
+	}
+	defer rows.Close()
+
+	restores, err := scanProxmoxRestores(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(restores) == 0 {
+		return nil, fmt.Errorf("proxmox restore not found: %s", id)
+	}
+	return restores[0], nil
+}
+
+// GetProxmoxRestoresByOrgID returns the Proxmox restores for an organization, newest first.
+func (db *DB) GetProxmoxRestoresByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.ProxmoxRestore, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, org_id, connection_id, repository_id, snapshot_id, archive, source_vmid,
+		       target_node, target_storage, upload_storage, new_vmid, overwrite, is_unique,
+		       start_guest, health_check, health_timeout_seconds, status, phase, task_upid,
+		       result, error_message, started_at, completed_at, created_by, created_at, updated_at
+		FROM proxmox_restores
+		WHERE org_id = $1
+		ORDER BY created_at DESC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list proxmox restores: %w", err)
+	}
+	defer rows.Close()
+
+	return scanProxmoxRestores(rows)
+}
+
+func scanProxmoxRestores(rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+}) ([]*models.ProxmoxRestore, error) {
+	var restores []*models.ProxmoxRestore
+	for rows.Next() {
+		var restore models.ProxmoxRestore
+		var resultJSON []byte
+		var statusStr, phaseStr string
+
+		err := rows.Scan(
+			&restore.ID, &restore.OrgID, &restore.ConnectionID, &restore.RepositoryID,
+			&restore.SnapshotID, &restore.Archive, &restore.SourceVMID, &restore.TargetNode,
+			&restore.TargetStorage, &restore.UploadStorage, &restore.NewVMID, &restore.Overwrite,
+			&restore.Unique, &restore.StartGuest, &restore.HealthCheck, &restore.HealthTimeoutSeconds,
+			&statusStr, &phaseStr, &restore.TaskUPID, &resultJSON, &restore.ErrorMessage,
+			&restore.StartedAt, &restore.CompletedAt, &restore.CreatedBy, &restore.CreatedAt,
+			&restore.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan proxmox restore: %w", err)
+		}
+
+		restore.Status = models.ProxmoxRestoreStatus(statusStr)
+		restore.Phase = models.ProxmoxRestorePhase(phaseStr)
+		if err := restore.SetResultFromJSON(resultJSON); err != nil {
+			return nil, fmt.Errorf("parse result: %w", err)
+		}
+
+		restores = append(restores, &restore)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate proxmox restores: %w", err)
+	}
+	return restores, nil
+}
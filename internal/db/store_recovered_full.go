@@ -243,22 +243,34 @@ func (db *DB) CreateSLADefinition(ctx context.Context, s *models.SLADefinition)
 
 // CreateSnapshotImmutability creates a new immutability lock for a snapshot.
 func (db *DB) CreateSnapshotImmutability(ctx context.Context, lock *models.SnapshotImmutability) error {
-	_, err := db.Pool.Exec(ctx, `
+	// An expired lock on the same snapshot is replaced in place, so the row
+	// keeps its ID and lock.ID is updated to match.
+	err := db.Pool.QueryRow(ctx, `
 		INSERT INTO snapshot_immutability (
 			id, org_id, repository_id, snapshot_id, short_id,
 			locked_at, locked_until, locked_by, reason,
 			s3_object_lock_enabled, s3_object_lock_mode,
+			s3_object_lock_status, s3_object_lock_error, s3_object_lock_objects,
 			created_at, updated_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 		ON CONFLICT (repository_id, snapshot_id) DO UPDATE SET
+			locked_at = EXCLUDED.locked_at,
 			locked_until = EXCLUDED.locked_until,
+			locked_by = EXCLUDED.locked_by,
 			reason = EXCLUDED.reason,
+			s3_object_lock_enabled = EXCLUDED.s3_object_lock_enabled,
+			s3_object_lock_mode = EXCLUDED.s3_object_lock_mode,
+			s3_object_lock_status = EXCLUDED.s3_object_lock_status,
+			s3_object_lock_error = EXCLUDED.s3_object_lock_error,
+			s3_object_lock_objects = EXCLUDED.s3_object_lock_objects,
 			updated_at = NOW()
+		RETURNING id
 	`, lock.ID, lock.OrgID, lock.RepositoryID, lock.SnapshotID, lock.ShortID,
 		lock.LockedAt, lock.LockedUntil, lock.LockedBy, lock.Reason,
 		lock.S3ObjectLockEnabled, lock.S3ObjectLockMode,
-		lock.CreatedAt, lock.UpdatedAt)
+		string(lock.S3ObjectLockStatus), lock.S3ObjectLockError, lock.S3ObjectLockObjects,
+		lock.CreatedAt, lock.UpdatedAt).Scan(&lock.ID)
 	if err != nil {
 		return fmt.Errorf("create snapshot immutability: %w", err)
 	}
@@ -771,6 +783,7 @@ func (db *DB) GetActiveImmutabilityLocksByOrgID(ctx context.Context, orgID uuid.
 		SELECT id, org_id, repository_id, snapshot_id, short_id,
 		       locked_at, locked_until, locked_by, reason,
 		       s3_object_lock_enabled, s3_object_lock_mode,
+		       s3_object_lock_status, s3_object_lock_error, s3_object_lock_objects,
 		       created_at, updated_at
 		FROM snapshot_immutability
 		WHERE org_id = $1 AND locked_until > NOW()
@@ -791,6 +804,7 @@ func (db *DB) GetActiveImmutabilityLocksByRepositoryID(ctx context.Context, repo
 		SELECT id, org_id, repository_id, snapshot_id, short_id,
 		       locked_at, locked_until, locked_by, reason,
 		       s3_object_lock_enabled, s3_object_lock_mode,
+		       s3_object_lock_status, s3_object_lock_error, s3_object_lock_objects,
 		       created_at, updated_at
 		FROM snapshot_immutability
 		WHERE repository_id = $1 AND locked_until > NOW()
@@ -2133,7 +2147,7 @@ func (db *DB) GetEnabledSchedulesByOrgID(ctx context.Context, orgID uuid.UUID) (
 		       s.backup_window_start, s.backup_window_end,
 		       s.excluded_hours, s.compression_level, s.max_file_size_mb, s.on_mount_unavailable,
 		       s.priority, s.preemptible, s.classification_level, s.classification_data_types,
-		       s.docker_options, s.pihole_config, s.proxmox_options,
+		       s.docker_options, s.pihole_config, s.proxmox_options, s.kubernetes_options, s.libvirt_options, s.mysql_config, s.postgres_config, s.filesystem_snapshot,
 		       s.enabled, s.created_at, s.updated_at
 		FROM schedules s
 		JOIN agents a ON s.agent_id = a.id
@@ -2427,6 +2441,7 @@ func (db *DB) GetImmutabilityLocksBySnapshotIDs(ctx context.Context, repositoryI
 		SELECT id, org_id, repository_id, snapshot_id, short_id,
 		       locked_at, locked_until, locked_by, reason,
 		       s3_object_lock_enabled, s3_object_lock_mode,
+		       s3_object_lock_status, s3_object_lock_error, s3_object_lock_objects,
 		       created_at, updated_at
 		FROM snapshot_immutability
 		WHERE repository_id = $1 AND snapshot_id = ANY($2) AND locked_until > NOW()
@@ -3938,7 +3953,7 @@ func (db *DB) GetSchedulesByAgentGroupID(ctx context.Context, agentGroupID uuid.
 		       retention_policy, bandwidth_limit_kbps, backup_window_start, backup_window_end,
 		       excluded_hours, compression_level, max_file_size_mb, on_mount_unavailable,
 		       priority, preemptible, classification_level, classification_data_types,
-		       docker_options, pihole_config, proxmox_options,
+		       docker_options, pihole_config, proxmox_options, kubernetes_options, libvirt_options, mysql_config, postgres_config, filesystem_snapshot,
 		       enabled, created_at, updated_at
 		FROM schedules
 		WHERE agent_group_id = $1
@@ -4070,6 +4085,7 @@ func (db *DB) GetSnapshotImmutability(ctx context.Context, repositoryID uuid.UUI
 		SELECT id, org_id, repository_id, snapshot_id, short_id,
 		       locked_at, locked_until, locked_by, reason,
 		       s3_object_lock_enabled, s3_object_lock_mode,
+		       s3_object_lock_status, s3_object_lock_error, s3_object_lock_objects,
 		       created_at, updated_at
 		FROM snapshot_immutability
 		WHERE repository_id = $1 AND snapshot_id = $2
@@ -4077,6 +4093,7 @@ func (db *DB) GetSnapshotImmutability(ctx context.Context, repositoryID uuid.UUI
 		&lock.ID, &lock.OrgID, &lock.RepositoryID, &lock.SnapshotID, &lock.ShortID,
 		&lock.LockedAt, &lock.LockedUntil, &lock.LockedBy, &lock.Reason,
 		&lock.S3ObjectLockEnabled, &lock.S3ObjectLockMode,
+		&lock.S3ObjectLockStatus, &lock.S3ObjectLockError, &lock.S3ObjectLockObjects,
 		&lock.CreatedAt, &lock.UpdatedAt,
 	)
 	if err != nil {
@@ -4093,6 +4110,7 @@ func (db *DB) GetSnapshotImmutabilityByID(ctx context.Context, id uuid.UUID) (*m
 		SELECT id, org_id, repository_id, snapshot_id, short_id,
 		       locked_at, locked_until, locked_by, reason,
 		       s3_object_lock_enabled, s3_object_lock_mode,
+		       s3_object_lock_status, s3_object_lock_error, s3_object_lock_objects,
 		       created_at, updated_at
 		FROM snapshot_immutability
 		WHERE id = $1
@@ -4100,6 +4118,7 @@ func (db *DB) GetSnapshotImmutabilityByID(ctx context.Context, id uuid.UUID) (*m
 		&lock.ID, &lock.OrgID, &lock.RepositoryID, &lock.SnapshotID, &lock.ShortID,
 		&lock.LockedAt, &lock.LockedUntil, &lock.LockedBy, &lock.Reason,
 		&lock.S3ObjectLockEnabled, &lock.S3ObjectLockMode,
+		&lock.S3ObjectLockStatus, &lock.S3ObjectLockError, &lock.S3ObjectLockObjects,
 		&lock.CreatedAt, &lock.UpdatedAt,
 	)
 	if err != nil {
@@ -5284,17 +5303,19 @@ func (db *DB) ListPendingMaintenanceNotifications(ctx context.Context) ([]*model
 }
 
 
-// ListPendingReplications returns all enabled configs that may need replication.
+// ListPendingReplications returns all enabled configs that may need
+// replication. Configs replicating into a read-only repository are skipped.
 func (db *DB) ListPendingReplications(ctx context.Context) ([]*models.GeoReplicationConfig, error) {
 	rows, err := db.Pool.Query(ctx, `
-		SELECT id, org_id, source_repository_id, target_repository_id,
-			source_region, target_region, enabled, status,
-			last_snapshot_id, last_sync_at, last_error,
-			max_lag_snapshots, max_lag_duration_hours, alert_on_lag,
-			created_at, updated_at
-		FROM geo_replication_configs
-		WHERE enabled = true AND status != 'syncing'
-		ORDER BY last_sync_at ASC NULLS FIRST
+		SELECT g.id, g.org_id, g.source_repository_id, g.target_repository_id,
+			g.source_region, g.target_region, g.enabled, g.status,
+			g.last_snapshot_id, g.last_sync_at, g.last_error,
+			g.max_lag_snapshots, g.max_lag_duration_hours, g.alert_on_lag,
+			g.created_at, g.updated_at
+		FROM geo_replication_configs g
+		JOIN repositories r ON r.id = g.target_repository_id
+		WHERE g.enabled = true AND g.status != 'syncing' AND NOT r.read_only
+		ORDER BY g.last_sync_at ASC NULLS FIRST
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("list pending replications: %w", err)
@@ -6467,9 +6488,12 @@ func (db *DB) UpdateSavedFilter(ctx context.Context, f *models.SavedFilter) erro
 func (db *DB) UpdateSnapshotImmutability(ctx context.Context, lock *models.SnapshotImmutability) error {
 	_, err := db.Pool.Exec(ctx, `
 		UPDATE snapshot_immutability
-		SET locked_until = $2, reason = $3, updated_at = NOW()
+		SET locked_until = $2, reason = $3,
+		    s3_object_lock_status = $4, s3_object_lock_error = $5, s3_object_lock_objects = $6,
+		    updated_at = NOW()
 		WHERE id = $1
-	`, lock.ID, lock.LockedUntil, lock.Reason)
+	`, lock.ID, lock.LockedUntil, lock.Reason,
+		string(lock.S3ObjectLockStatus), lock.S3ObjectLockError, lock.S3ObjectLockObjects)
 	if err != nil {
 		return fmt.Errorf("update snapshot immutability: %w", err)
 	}
@@ -7279,6 +7303,7 @@ func scanSnapshotImmutabilityRows(rows interface{ Next() bool; Scan(dest ...inte
 			&lock.ID, &lock.OrgID, &lock.RepositoryID, &lock.SnapshotID, &lock.ShortID,
 			&lock.LockedAt, &lock.LockedUntil, &lock.LockedBy, &lock.Reason,
 			&lock.S3ObjectLockEnabled, &lock.S3ObjectLockMode,
+			&lock.S3ObjectLockStatus, &lock.S3ObjectLockError, &lock.S3ObjectLockObjects,
 			&lock.CreatedAt, &lock.UpdatedAt,
 		)
 		if err != nil {
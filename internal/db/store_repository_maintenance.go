@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Repository maintenance methods
+
+const repositoryMaintenancePolicyColumns = `
+	id, org_id, repository_id, enabled, upgrade_repository, repack_uncompressed,
+	max_unused, max_repack_size, min_reclaim_bytes, interval_hours,
+	require_maintenance_window, storage_class, last_run_at, created_at, updated_at`
+
+// GetRepositoryMaintenancePolicyByRepositoryID returns the maintenance policy
+// of a repository, or nil if it has none.
+func (db *DB) GetRepositoryMaintenancePolicyByRepositoryID(ctx context.Context, repositoryID uuid.UUID) (*models.RepositoryMaintenancePolicy, error) {
+	row := db.Pool.QueryRow(ctx, `SELECT`+repositoryMaintenancePolicyColumns+`
+		FROM repository_maintenance_policies
+		WHERE repository_id = $1
+	`, repositoryID)
+	p, err := scanRepositoryMaintenancePolicy(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return p, err
+}
+
+// GetEnabledRepositoryMaintenancePolicies returns all enabled maintenance policies.
+func (db *DB) GetEnabledRepositoryMaintenancePolicies(ctx context.Context) ([]*models.RepositoryMaintenancePolicy, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT`+repositoryMaintenancePolicyColumns+`
+		FROM repository_maintenance_policies
+		WHERE enabled = true
+		ORDER BY last_run_at ASC NULLS FIRST
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("get repository maintenance policies: %w", err)
+	}
+	defer rows.Close()
+
+	var policies []*models.RepositoryMaintenancePolicy
+	for rows.Next() {
+		p, err := scanRepositoryMaintenancePolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate repository maintenance policies: %w", err)
+	}
+	return policies, nil
+}
+
+// UpsertRepositoryMaintenancePolicy creates or replaces a repository's maintenance policy.
+func (db *DB) UpsertRepositoryMaintenancePolicy(ctx context.Context, p *models.RepositoryMaintenancePolicy) error {
+	p.UpdatedAt = time.Now()
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO repository_maintenance_policies (id, org_id, repository_id, enabled, upgrade_repository,
+		                                             repack_uncompressed, max_unused, max_repack_size,
+		                                             min_reclaim_bytes, interval_hours,
+		                                             require_maintenance_window, storage_class,
+		                                             created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (repository_id) DO UPDATE
+		SET enabled = EXCLUDED.enabled, upgrade_repository = EXCLUDED.upgrade_repository,
+		    repack_uncompressed = EXCLUDED.repack_uncompressed, max_unused = EXCLUDED.max_unused,
+		    max_repack_size = EXCLUDED.max_repack_size, min_reclaim_bytes = EXCLUDED.min_reclaim_bytes,
+		    interval_hours = EXCLUDED.interval_hours,
+		    require_maintenance_window = EXCLUDED.require_maintenance_window,
+		    storage_class = EXCLUDED.storage_class, updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at, last_run_at
+	`, p.ID, p.OrgID, p.RepositoryID, p.Enabled, p.UpgradeRepository, p.RepackUncompressed,
+		p.MaxUnused, p.MaxRepackSize, p.MinReclaimBytes, p.IntervalHours,
+		p.RequireMaintenanceWindow, p.StorageClass, p.CreatedAt, p.UpdatedAt,
+	).Scan(&p.ID, &p.CreatedAt, &p.LastRunAt)
+	if err != nil {
+		return fmt.Errorf("upsert repository maintenance policy: %w", err)
+	}
+	return nil
+}
+
+// UpdateRepositoryMaintenancePolicyLastRun records when a policy last ran.
+func (db *DB) UpdateRepositoryMaintenancePolicyLastRun(ctx context.Context, id uuid.UUID, lastRunAt time.Time) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE repository_maintenance_policies
+		SET last_run_at = $2
+		WHERE id = $1
+	`, id, lastRunAt)
+	if err != nil {
+		return fmt.Errorf("update repository maintenance policy last run: %w", err)
+	}
+	return nil
+}
+
+func scanRepositoryMaintenancePolicy(row pgx.Row) (*models.RepositoryMaintenancePolicy, error) {
+	var p models.RepositoryMaintenancePolicy
+	err := row.Scan(
+		&p.ID, &p.OrgID, &p.RepositoryID, &p.Enabled, &p.UpgradeRepository, &p.RepackUncompressed,
+		&p.MaxUnused, &p.MaxRepackSize, &p.MinReclaimBytes, &p.IntervalHours,
+		&p.RequireMaintenanceWindow, &p.StorageClass, &p.LastRunAt, &p.CreatedAt, &p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("scan repository maintenance policy: %w", err)
+	}
+	return &p, nil
+}
+
+const repositoryMaintenanceRunColumns = `
+	id, org_id, repository_id, trigger, status, actions, skip_reasons,
+	repository_version_before, repository_version_after, estimated_reclaim_bytes,
+	estimated_early_deletion_cost, stats_before, stats_after, COALESCE(error_message, ''),
+	started_at, completed_at`
+
+// CreateRepositoryMaintenanceRun records the start of a maintenance run.
+func (db *DB) CreateRepositoryMaintenanceRun(ctx context.Context, r *models.RepositoryMaintenanceRun) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO repository_maintenance_runs (id, org_id, repository_id, trigger, status, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, r.ID, r.OrgID, r.RepositoryID, r.Trigger, string(r.Status), r.StartedAt)
+	if err != nil {
+		return fmt.Errorf("create repository maintenance run: %w", err)
+	}
+	return nil
+}
+
+// UpdateRepositoryMaintenanceRun saves a maintenance run's outcome.
+func (db *DB) UpdateRepositoryMaintenanceRun(ctx context.Context, r *models.RepositoryMaintenanceRun) error {
+	actions, err := r.ActionsJSON()
+	if err != nil {
+		return fmt.Errorf("marshal actions: %w", err)
+	}
+	skipReasons, err := r.SkipReasonsJSON()
+	if err != nil {
+		return fmt.Errorf("marshal skip reasons: %w", err)
+	}
+	statsBefore, err := marshalRepoStatsRecord(r.StatsBefore)
+	if err != nil {
+		return err
+	}
+	statsAfter, err := marshalRepoStatsRecord(r.StatsAfter)
+	if err != nil {
+		return err
+	}
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE repository_maintenance_runs
+		SET status = $2, actions = $3, skip_reasons = $4, repository_version_before = $5,
+		    repository_version_after = $6, estimated_reclaim_bytes = $7,
+		    estimated_early_deletion_cost = $8, stats_before = $9, stats_after = $10,
+		    error_message = $11, completed_at = $12
+		WHERE id = $1
+	`, r.ID, string(r.Status), actions, skipReasons, r.RepositoryVersionBefore,
+		r.RepositoryVersionAfter, r.EstimatedReclaimBytes, r.EstimatedEarlyDeletionCost,
+		statsBefore, statsAfter, nullableString(r.ErrorMessage), r.CompletedAt)
+	if err != nil {
+		return fmt.Errorf("update repository maintenance run: %w", err)
+	}
+	return nil
+}
+
+// GetRepositoryMaintenanceRuns returns a repository's most recent maintenance runs, newest first.
+func (db *DB) GetRepositoryMaintenanceRuns(ctx context.Context, repositoryID uuid.UUID, limit int) ([]*models.RepositoryMaintenanceRun, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT`+repositoryMaintenanceRunColumns+`
+		FROM repository_maintenance_runs
+		WHERE repository_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2
+	`, repositoryID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get repository maintenance runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*models.RepositoryMaintenanceRun
+	for rows.Next() {
+		r, err := scanRepositoryMaintenanceRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate repository maintenance runs: %w", err)
+	}
+	return runs, nil
+}
+
+// GetLastPruneRepositoryMaintenanceRun returns the most recent completed run
+// that pruned the repository, or nil if there is none.
+func (db *DB) GetLastPruneRepositoryMaintenanceRun(ctx context.Context, repositoryID uuid.UUID) (*models.RepositoryMaintenanceRun, error) {
+	row := db.Pool.QueryRow(ctx, `SELECT`+repositoryMaintenanceRunColumns+`
+		FROM repository_maintenance_runs
+		WHERE repository_id = $1 AND status = 'completed' AND actions ? 'prune'
+		ORDER BY started_at DESC
+		LIMIT 1
+	`, repositoryID)
+	r, err := scanRepositoryMaintenanceRun(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return r, err
+}
+
+func scanRepositoryMaintenanceRun(row pgx.Row) (*models.RepositoryMaintenanceRun, error) {
+	var r models.RepositoryMaintenanceRun
+	var status string
+	var actions, skipReasons, statsBefore, statsAfter []byte
+	err := row.Scan(
+		&r.ID, &r.OrgID, &r.RepositoryID, &r.Trigger, &status, &actions, &skipReasons,
+		&r.RepositoryVersionBefore, &r.RepositoryVersionAfter, &r.EstimatedReclaimBytes,
+		&r.EstimatedEarlyDeletionCost, &statsBefore, &statsAfter, &r.ErrorMessage,
+		&r.StartedAt, &r.CompletedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("scan repository maintenance run: %w", err)
+	}
+	r.Status = models.RepositoryMaintenanceRunStatus(status)
+	if err := json.Unmarshal(actions, &r.Actions); err != nil {
+		return nil, fmt.Errorf("parse actions: %w", err)
+	}
+	if err := json.Unmarshal(skipReasons, &r.SkipReasons); err != nil {
+		return nil, fmt.Errorf("parse skip reasons: %w", err)
+	}
+	if len(statsBefore) > 0 {
+		if err := json.Unmarshal(statsBefore, &r.StatsBefore); err != nil {
+			return nil, fmt.Errorf("parse stats before: %w", err)
+		}
+	}
+	if len(statsAfter) > 0 {
+		if err := json.Unmarshal(statsAfter, &r.StatsAfter); err != nil {
+			return nil, fmt.Errorf("parse stats after: %w", err)
+		}
+	}
+	return &r, nil
+}
+
+func marshalRepoStatsRecord(stats *models.RepoStatsRecord) ([]byte, error) {
+	if stats == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return nil, fmt.Errorf("marshal repository stats: %w", err)
+	}
+	return data, nil
+}
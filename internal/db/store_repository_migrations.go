@@ -0,0 +1,272 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Repository migration methods
+
+const repositoryMigrationColumns = `
+	id, org_id, source_repository_id, target_repository_id, source_repository_name,
+	target_repository_name, status, total_snapshots, copied_snapshot_ids,
+	COALESCE(current_snapshot_id, ''), read_data_subset, schedules_repointed,
+	geo_configs_repointed, COALESCE(error_message, ''), started_by,
+	started_at, completed_at, created_at, updated_at`
+
+// CreateRepositoryMigration creates a new repository migration.
+func (db *DB) CreateRepositoryMigration(ctx context.Context, m *models.RepositoryMigration) error {
+	copied, err := m.CopiedSnapshotIDsJSON()
+	if err != nil {
+		return fmt.Errorf("marshal copied snapshots: %w", err)
+	}
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO repository_migrations (id, org_id, source_repository_id, target_repository_id,
+		                                   source_repository_name, target_repository_name, status,
+		                                   copied_snapshot_ids, read_data_subset, started_by,
+		                                   created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`, m.ID, m.OrgID, m.SourceRepositoryID, m.TargetRepositoryID, m.SourceRepositoryName,
+		m.TargetRepositoryName, string(m.Status), copied, m.ReadDataSubset, m.StartedBy,
+		m.CreatedAt, m.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create repository migration: %w", err)
+	}
+	return nil
+}
+
+// GetRepositoryMigrationByID returns a repository migration by ID.
+func (db *DB) GetRepositoryMigrationByID(ctx context.Context, id uuid.UUID) (*models.RepositoryMigration, error) {
+	row := db.Pool.QueryRow(ctx, `SELECT`+repositoryMigrationColumns+`
+		FROM repository_migrations
+		WHERE id = $1
+	`, id)
+	return scanRepositoryMigration(row)
+}
+
+// GetRepositoryMigrationsByOrgID returns an organization's repository migrations, newest first.
+func (db *DB) GetRepositoryMigrationsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.RepositoryMigration, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT`+repositoryMigrationColumns+`
+		FROM repository_migrations
+		WHERE org_id = $1
+		ORDER BY created_at DESC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("get repository migrations: %w", err)
+	}
+	return scanRepositoryMigrations(rows)
+}
+
+// GetUnfinishedRepositoryMigrations returns migrations that were running when
+// the server stopped, so they can be resumed.
+func (db *DB) GetUnfinishedRepositoryMigrations(ctx context.Context) ([]*models.RepositoryMigration, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT`+repositoryMigrationColumns+`
+		FROM repository_migrations
+		WHERE status IN ('initializing', 'copying', 'verifying')
+		ORDER BY created_at ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("get unfinished repository migrations: %w", err)
+	}
+	return scanRepositoryMigrations(rows)
+}
+
+// GetOpenRepositoryMigration returns the migration of a repository that has
+// not completed yet, or nil if there is none.
+func (db *DB) GetOpenRepositoryMigration(ctx context.Context, repositoryID uuid.UUID) (*models.RepositoryMigration, error) {
+	row := db.Pool.QueryRow(ctx, `SELECT`+repositoryMigrationColumns+`
+		FROM repository_migrations
+		WHERE (source_repository_id = $1 OR target_repository_id = $1) AND status <> 'completed'
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, repositoryID)
+	m, err := scanRepositoryMigration(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return m, err
+}
+
+// UpdateRepositoryMigration saves a migration's status and progress.
+func (db *DB) UpdateRepositoryMigration(ctx context.Context, m *models.RepositoryMigration) error {
+	m.UpdatedAt = time.Now()
+	copied, err := m.CopiedSnapshotIDsJSON()
+	if err != nil {
+		return fmt.Errorf("marshal copied snapshots: %w", err)
+	}
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE repository_migrations
+		SET status = $2, total_snapshots = $3, copied_snapshot_ids = $4, current_snapshot_id = $5,
+		    error_message = $6, started_at = $7, completed_at = $8, updated_at = $9
+		WHERE id = $1
+	`, m.ID, string(m.Status), m.TotalSnapshots, copied, nullableString(m.CurrentSnapshotID),
+		nullableString(m.ErrorMessage), m.StartedAt, m.CompletedAt, m.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("update repository migration: %w", err)
+	}
+	return nil
+}
+
+// CompleteRepositoryMigration atomically repoints schedules and
+// geo-replication configs from the migration's source repository to its
+// target, makes the source read-only and marks the migration completed.
+// DR runbooks reference a schedule rather than a repository, so they follow
+// their schedule to the target without being changed.
+func (db *DB) CompleteRepositoryMigration(ctx context.Context, m *models.RepositoryMigration) (*models.RepositoryRepointResult, error) {
+	if m.SourceRepositoryID == nil || m.TargetRepositoryID == nil {
+		return nil, fmt.Errorf("repository migration %s has no source or target repository", m.ID)
+	}
+	source, target := *m.SourceRepositoryID, *m.TargetRepositoryID
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result := &models.RepositoryRepointResult{}
+
+	rows, err := tx.Query(ctx, `SELECT DISTINCT schedule_id FROM schedule_repositories WHERE repository_id = $1`, source)
+	if err != nil {
+		return nil, fmt.Errorf("list schedules: %w", err)
+	}
+	scheduleIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("scan schedules: %w", err)
+	}
+	result.Schedules = len(scheduleIDs)
+
+	// Schedules that already write to the target just drop the source.
+	_, err = tx.Exec(ctx, `
+		DELETE FROM schedule_repositories sr
+		WHERE sr.repository_id = $1
+		  AND EXISTS (SELECT 1 FROM schedule_repositories o
+		              WHERE o.schedule_id = sr.schedule_id AND o.repository_id = $2)
+	`, source, target)
+	if err != nil {
+		return nil, fmt.Errorf("remove duplicate schedule repositories: %w", err)
+	}
+	_, err = tx.Exec(ctx, `UPDATE schedule_repositories SET repository_id = $2 WHERE repository_id = $1`, source, target)
+	if err != nil {
+		return nil, fmt.Errorf("repoint schedule repositories: %w", err)
+	}
+
+	// Per-schedule replication status is tracked by repository pair and
+	// restarts from scratch for the new repository.
+	_, err = tx.Exec(ctx, `
+		DELETE FROM replication_status
+		WHERE source_repository_id = $1 OR target_repository_id = $1
+	`, source)
+	if err != nil {
+		return nil, fmt.Errorf("reset replication status: %w", err)
+	}
+
+	// A geo-replication config between the two repositories is meaningless
+	// once they are the same, and configs that would duplicate an existing
+	// pair are dropped.
+	_, err = tx.Exec(ctx, `
+		DELETE FROM geo_replication_configs g
+		WHERE (g.source_repository_id = $1 AND g.target_repository_id = $2)
+		   OR (g.source_repository_id = $2 AND g.target_repository_id = $1)
+		   OR (g.source_repository_id = $1 AND EXISTS (
+		           SELECT 1 FROM geo_replication_configs o
+		           WHERE o.source_repository_id = $2 AND o.target_repository_id = g.target_repository_id))
+		   OR (g.target_repository_id = $1 AND EXISTS (
+		           SELECT 1 FROM geo_replication_configs o
+		           WHERE o.target_repository_id = $2 AND o.source_repository_id = g.source_repository_id))
+	`, source, target)
+	if err != nil {
+		return nil, fmt.Errorf("remove duplicate geo-replication configs: %w", err)
+	}
+	tag, err := tx.Exec(ctx, `
+		UPDATE geo_replication_configs
+		SET source_repository_id = $2,
+		    source_region = COALESCE(NULLIF((SELECT region FROM repositories WHERE id = $2), ''), source_region),
+		    status = 'pending', last_snapshot_id = NULL, last_error = NULL, updated_at = NOW()
+		WHERE source_repository_id = $1
+	`, source, target)
+	if err != nil {
+		return nil, fmt.Errorf("repoint geo-replication sources: %w", err)
+	}
+	result.GeoConfigs = int(tag.RowsAffected())
+	tag, err = tx.Exec(ctx, `
+		UPDATE geo_replication_configs
+		SET target_repository_id = $2,
+		    target_region = COALESCE(NULLIF((SELECT region FROM repositories WHERE id = $2), ''), target_region),
+		    status = 'pending', last_snapshot_id = NULL, last_error = NULL, updated_at = NOW()
+		WHERE target_repository_id = $1
+	`, source, target)
+	if err != nil {
+		return nil, fmt.Errorf("repoint geo-replication targets: %w", err)
+	}
+	result.GeoConfigs += int(tag.RowsAffected())
+
+	_, err = tx.Exec(ctx, `UPDATE repositories SET read_only = true, updated_at = NOW() WHERE id = $1`, source)
+	if err != nil {
+		return nil, fmt.Errorf("mark source repository read-only: %w", err)
+	}
+
+	m.Complete()
+	m.SchedulesRepointed = result.Schedules
+	m.GeoConfigsRepointed = result.GeoConfigs
+	m.UpdatedAt = time.Now()
+	_, err = tx.Exec(ctx, `
+		UPDATE repository_migrations
+		SET status = $2, schedules_repointed = $3, geo_configs_repointed = $4,
+		    current_snapshot_id = NULL, error_message = NULL, completed_at = $5, updated_at = $6
+		WHERE id = $1
+	`, m.ID, string(m.Status), m.SchedulesRepointed, m.GeoConfigsRepointed,
+		m.CompletedAt, m.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("complete repository migration: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit repository migration: %w", err)
+	}
+	return result, nil
+}
+
+func scanRepositoryMigrations(rows pgx.Rows) ([]*models.RepositoryMigration, error) {
+	defer rows.Close()
+
+	var migrations []*models.RepositoryMigration
+	for rows.Next() {
+		m, err := scanRepositoryMigration(rows)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate repository migrations: %w", err)
+	}
+	return migrations, nil
+}
+
+func scanRepositoryMigration(row pgx.Row) (*models.RepositoryMigration, error) {
+	var m models.RepositoryMigration
+	var status string
+	var copied []byte
+	err := row.Scan(
+		&m.ID, &m.OrgID, &m.SourceRepositoryID, &m.TargetRepositoryID, &m.SourceRepositoryName,
+		&m.TargetRepositoryName, &status, &m.TotalSnapshots, &copied,
+		&m.CurrentSnapshotID, &m.ReadDataSubset, &m.SchedulesRepointed,
+		&m.GeoConfigsRepointed, &m.ErrorMessage, &m.StartedBy,
+		&m.StartedAt, &m.CompletedAt, &m.CreatedAt, &m.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("scan repository migration: %w", err)
+	}
+	m.Status = models.RepositoryMigrationStatus(status)
+	if err := m.SetCopiedSnapshotIDs(copied); err != nil {
+		return nil, fmt.Errorf("parse copied snapshots: %w", err)
+	}
+	return &m, nil
+}
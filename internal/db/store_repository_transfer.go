@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Repository transfer methods
+
+// GetRepositoryTransferSettings returns a repository's transfer settings, or
+// nil if it has none.
+func (db *DB) GetRepositoryTransferSettings(ctx context.Context, repositoryID uuid.UUID) (*models.RepositoryTransferSettings, error) {
+	var s models.RepositoryTransferSettings
+	var options []byte
+	err := db.Pool.QueryRow(ctx, `
+		SELECT id, org_id, repository_id, upload_limit_kb, download_limit_kb, connections,
+		       pack_size_mb, read_concurrency, backend_options, created_at, updated_at
+		FROM repository_transfer_settings
+		WHERE repository_id = $1
+	`, repositoryID).Scan(
+		&s.ID, &s.OrgID, &s.RepositoryID, &s.UploadLimitKB, &s.DownloadLimitKB, &s.Connections,
+		&s.PackSizeMB, &s.ReadConcurrency, &options, &s.CreatedAt, &s.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get repository transfer settings: %w", err)
+	}
+	if err := json.Unmarshal(options, &s.BackendOptions); err != nil {
+		return nil, fmt.Errorf("parse backend options: %w", err)
+	}
+	return &s, nil
+}
+
+// UpsertRepositoryTransferSettings creates or replaces a repository's transfer settings.
+func (db *DB) UpsertRepositoryTransferSettings(ctx context.Context, s *models.RepositoryTransferSettings) error {
+	options := s.BackendOptions
+	if options == nil {
+		options = map[string]string{}
+	}
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		return fmt.Errorf("marshal backend options: %w", err)
+	}
+	s.UpdatedAt = time.Now()
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO repository_transfer_settings (id, org_id, repository_id, upload_limit_kb,
+		                                          download_limit_kb, connections, pack_size_mb,
+		                                          read_concurrency, backend_options, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (repository_id) DO UPDATE
+		SET upload_limit_kb = EXCLUDED.upload_limit_kb, download_limit_kb = EXCLUDED.download_limit_kb,
+		    connections = EXCLUDED.connections, pack_size_mb = EXCLUDED.pack_size_mb,
+		    read_concurrency = EXCLUDED.read_concurrency, backend_options = EXCLUDED.backend_options,
+		    updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at
+	`, s.ID, s.OrgID, s.RepositoryID, s.UploadLimitKB, s.DownloadLimitKB, s.Connections,
+		s.PackSizeMB, s.ReadConcurrency, optionsJSON, s.CreatedAt, s.UpdatedAt,
+	).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("upsert repository transfer settings: %w", err)
+	}
+	return nil
+}
+
+// CreateBackupTransferMetrics records the transfer metrics of a backup run.
+func (db *DB) CreateBackupTransferMetrics(ctx context.Context, m *models.BackupTransferMetrics) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO backup_transfer_metrics (id, org_id, repository_id, backup_id, agent_id,
+		                                     bytes_processed, bytes_uploaded, duration_ms,
+		                                     open_duration_ms, upload_bytes_per_sec, retries,
+		                                     retry_wait_ms, backend_errors, file_errors, failed,
+		                                     recorded_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	`, m.ID, m.OrgID, m.RepositoryID, m.BackupID, m.AgentID, m.BytesProcessed, m.BytesUploaded,
+		m.DurationMs, m.OpenDurationMs, m.UploadBytesPerSec, m.Retries, m.RetryWaitMs,
+		m.BackendErrors, m.FileErrors, m.Failed, m.RecordedAt)
+	if err != nil {
+		return fmt.Errorf("create backup transfer metrics: %w", err)
+	}
+	return nil
+}
+
+// GetBackupTransferMetrics returns a repository's most recent transfer
+// metrics, newest first.
+func (db *DB) GetBackupTransferMetrics(ctx context.Context, repositoryID uuid.UUID, limit int) ([]*models.BackupTransferMetrics, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, org_id, repository_id, backup_id, agent_id, bytes_processed, bytes_uploaded,
+		       duration_ms, open_duration_ms, upload_bytes_per_sec, retries, retry_wait_ms,
+		       backend_errors, file_errors, failed, recorded_at
+		FROM backup_transfer_metrics
+		WHERE repository_id = $1
+		ORDER BY recorded_at DESC
+		LIMIT $2
+	`, repositoryID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get backup transfer metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var metrics []*models.BackupTransferMetrics
+	for rows.Next() {
+		var m models.BackupTransferMetrics
+		if err := rows.Scan(
+			&m.ID, &m.OrgID, &m.RepositoryID, &m.BackupID, &m.AgentID, &m.BytesProcessed,
+			&m.BytesUploaded, &m.DurationMs, &m.OpenDurationMs, &m.UploadBytesPerSec, &m.Retries,
+			&m.RetryWaitMs, &m.BackendErrors, &m.FileErrors, &m.Failed, &m.RecordedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan backup transfer metrics: %w", err)
+		}
+		metrics = append(metrics, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate backup transfer metrics: %w", err)
+	}
+	return metrics, nil
+}
+
+// GetRepositoryTransferTrends aggregates a repository's transfer metrics per
+// day since the given time, oldest first.
+func (db *DB) GetRepositoryTransferTrends(ctx context.Context, repositoryID uuid.UUID, since time.Time) ([]*models.RepositoryTransferTrend, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT date_trunc('day', recorded_at) AS day,
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE failed),
+		       COALESCE(AVG(upload_bytes_per_sec) FILTER (WHERE NOT failed), 0),
+		       COALESCE(AVG(open_duration_ms), 0),
+		       COALESCE(MAX(open_duration_ms), 0),
+		       COALESCE(SUM(retries), 0),
+		       COALESCE(SUM(backend_errors), 0),
+		       COALESCE(SUM(bytes_uploaded), 0)
+		FROM backup_transfer_metrics
+		WHERE repository_id = $1 AND recorded_at >= $2
+		GROUP BY day
+		ORDER BY day
+	`, repositoryID, since)
+	if err != nil {
+		return nil, fmt.Errorf("get repository transfer trends: %w", err)
+	}
+	defer rows.Close()
+
+	var trends []*models.RepositoryTransferTrend
+	for rows.Next() {
+		var t models.RepositoryTransferTrend
+		if err := rows.Scan(
+			&t.Day, &t.Runs, &t.FailedRuns, &t.AvgUploadBytesPerSec, &t.AvgOpenDurationMs,
+			&t.MaxOpenDurationMs, &t.Retries, &t.BackendErrors, &t.BytesUploaded,
+		); err != nil {
+			return nil, fmt.Errorf("scan repository transfer trend: %w", err)
+		}
+		trends = append(trends, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate repository transfer trends: %w", err)
+	}
+	return trends, nil
+}
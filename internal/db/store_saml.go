@@ -0,0 +1,27 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ConsumeSAMLAssertion records a SAML assertion ID for an organization until
+// it expires. It returns false if the assertion was already consumed.
+func (db *DB) ConsumeSAMLAssertion(ctx context.Context, orgID uuid.UUID, assertionID string, expiresAt time.Time) (bool, error) {
+	if _, err := db.Pool.Exec(ctx, `DELETE FROM saml_consumed_assertions WHERE expires_at < NOW()`); err != nil {
+		return false, fmt.Errorf("prune consumed saml assertions: %w", err)
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		INSERT INTO saml_consumed_assertions (org_id, assertion_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (org_id, assertion_id) DO NOTHING
+	`, orgID, assertionID, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("consume saml assertion: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,420 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// SCIM token methods
+
+// CreateSCIMToken stores a new SCIM bearer token.
+func (db *DB) CreateSCIMToken(ctx context.Context, t *models.SCIMToken) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO scim_tokens (id, org_id, name, token_hash, token_prefix, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, t.ID, t.OrgID, t.Name, t.TokenHash, t.TokenPrefix, t.CreatedBy, t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create SCIM token: %w", err)
+	}
+	return nil
+}
+
+// GetSCIMTokenByHash returns the token with the given hash, or nil if there is none.
+func (db *DB) GetSCIMTokenByHash(ctx context.Context, tokenHash string) (*models.SCIMToken, error) {
+	var t models.SCIMToken
+	err := db.Pool.QueryRow(ctx, `
+		SELECT id, org_id, name, token_hash, token_prefix, created_by, last_used_at, revoked_at, created_at
+		FROM scim_tokens
+		WHERE token_hash = $1
+	`, tokenHash).Scan(&t.ID, &t.OrgID, &t.Name, &t.TokenHash, &t.TokenPrefix, &t.CreatedBy,
+		&t.LastUsedAt, &t.RevokedAt, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get SCIM token: %w", err)
+	}
+	return &t, nil
+}
+
+// ListSCIMTokens returns an organization's SCIM tokens, newest first.
+func (db *DB) ListSCIMTokens(ctx context.Context, orgID uuid.UUID) ([]*models.SCIMToken, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, org_id, name, token_hash, token_prefix, created_by, last_used_at, revoked_at, created_at
+		FROM scim_tokens
+		WHERE org_id = $1
+		ORDER BY created_at DESC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list SCIM tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*models.SCIMToken
+	for rows.Next() {
+		var t models.SCIMToken
+		if err := rows.Scan(&t.ID, &t.OrgID, &t.Name, &t.TokenHash, &t.TokenPrefix, &t.CreatedBy,
+			&t.LastUsedAt, &t.RevokedAt, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan SCIM token: %w", err)
+		}
+		tokens = append(tokens, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate SCIM tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// RevokeSCIMToken revokes a token. It returns false if the token does not
+// exist in the organization or was already revoked.
+func (db *DB) RevokeSCIMToken(ctx context.Context, orgID, id uuid.UUID) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE scim_tokens
+		SET revoked_at = NOW()
+		WHERE id = $1 AND org_id = $2 AND revoked_at IS NULL
+	`, id, orgID)
+	if err != nil {
+		return false, fmt.Errorf("revoke SCIM token: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// TouchSCIMToken records that a token was used.
+func (db *DB) TouchSCIMToken(ctx context.Context, id uuid.UUID) error {
+	_, err := db.Pool.Exec(ctx, `UPDATE scim_tokens SET last_used_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("touch SCIM token: %w", err)
+	}
+	return nil
+}
+
+// SCIM user methods
+
+const scimUserColumns = `
+	s.user_id, s.org_id, s.user_name, s.external_id, u.email, COALESCE(u.name, ''),
+	u.status = 'active', s.created_at, s.updated_at`
+
+func scanSCIMUser(row pgx.Row) (*models.SCIMUser, error) {
+	var u models.SCIMUser
+	err := row.Scan(&u.UserID, &u.OrgID, &u.UserName, &u.ExternalID, &u.Email, &u.Name,
+		&u.Active, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// CreateSCIMUser links a user to the organization provisioning it.
+func (db *DB) CreateSCIMUser(ctx context.Context, u *models.SCIMUser) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO scim_users (user_id, org_id, user_name, external_id, active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, u.UserID, u.OrgID, u.UserName, u.ExternalID, u.Active, u.CreatedAt, u.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create SCIM user: %w", err)
+	}
+	return nil
+}
+
+// GetSCIMUser returns a provisioned user, or nil if the user is not managed
+// by the organization.
+func (db *DB) GetSCIMUser(ctx context.Context, orgID, userID uuid.UUID) (*models.SCIMUser, error) {
+	u, err := scanSCIMUser(db.Pool.QueryRow(ctx, `SELECT`+scimUserColumns+`
+		FROM scim_users s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.org_id = $1 AND s.user_id = $2
+	`, orgID, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get SCIM user: %w", err)
+	}
+	return u, nil
+}
+
+// GetSCIMUserByUserName returns the provisioned user with userName
+// (case-insensitive), or nil if there is none.
+func (db *DB) GetSCIMUserByUserName(ctx context.Context, orgID uuid.UUID, userName string) (*models.SCIMUser, error) {
+	u, err := scanSCIMUser(db.Pool.QueryRow(ctx, `SELECT`+scimUserColumns+`
+		FROM scim_users s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.org_id = $1 AND LOWER(s.user_name) = LOWER($2)
+	`, orgID, userName))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get SCIM user by user name: %w", err)
+	}
+	return u, nil
+}
+
+// ListSCIMUsers returns all users provisioned by the organization.
+func (db *DB) ListSCIMUsers(ctx context.Context, orgID uuid.UUID) ([]*models.SCIMUser, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT`+scimUserColumns+`
+		FROM scim_users s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.org_id = $1
+		ORDER BY s.created_at, s.user_id
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list SCIM users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*models.SCIMUser
+	for rows.Next() {
+		u, err := scanSCIMUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan SCIM user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate SCIM users: %w", err)
+	}
+	return users, nil
+}
+
+// UpdateSCIMUser saves a provisioned user's SCIM attributes along with the
+// name, email and active status of the underlying user.
+func (db *DB) UpdateSCIMUser(ctx context.Context, u *models.SCIMUser) error {
+	u.UpdatedAt = time.Now()
+	status := models.UserStatusActive
+	if !u.Active {
+		status = models.UserStatusDisabled
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE scim_users
+		SET user_name = $3, external_id = $4, active = $5, updated_at = $6
+		WHERE org_id = $1 AND user_id = $2
+	`, u.OrgID, u.UserID, u.UserName, u.ExternalID, u.Active, u.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("update SCIM user: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users
+		SET email = $2, name = $3, status = $4, updated_at = $5
+		WHERE id = $1
+	`, u.UserID, u.Email, u.Name, string(status), u.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("update provisioned user: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit SCIM user update: %w", err)
+	}
+	return nil
+}
+
+// DeleteSCIMUser removes the organization's link to a user and the user's
+// membership in the organization's SCIM groups. The user itself is kept.
+func (db *DB) DeleteSCIMUser(ctx context.Context, orgID, userID uuid.UUID) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM scim_group_members
+		WHERE user_id = $2 AND group_id IN (SELECT id FROM scim_groups WHERE org_id = $1)
+	`, orgID, userID)
+	if err != nil {
+		return fmt.Errorf("delete SCIM group memberships: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM scim_users WHERE org_id = $1 AND user_id = $2`, orgID, userID)
+	if err != nil {
+		return fmt.Errorf("delete SCIM user: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit SCIM user delete: %w", err)
+	}
+	return nil
+}
+
+// SCIM group methods
+
+// CreateSCIMGroup creates a group and its members.
+func (db *DB) CreateSCIMGroup(ctx context.Context, g *models.SCIMGroup) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO scim_groups (id, org_id, display_name, external_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, g.ID, g.OrgID, g.DisplayName, g.ExternalID, g.CreatedAt, g.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create SCIM group: %w", err)
+	}
+	if err := insertSCIMGroupMembers(ctx, tx, g); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit SCIM group: %w", err)
+	}
+	return nil
+}
+
+// UpdateSCIMGroup saves a group's attributes and replaces its members.
+func (db *DB) UpdateSCIMGroup(ctx context.Context, g *models.SCIMGroup) error {
+	g.UpdatedAt = time.Now()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE scim_groups
+		SET display_name = $3, external_id = $4, updated_at = $5
+		WHERE id = $1 AND org_id = $2
+	`, g.ID, g.OrgID, g.DisplayName, g.ExternalID, g.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("update SCIM group: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM scim_group_members WHERE group_id = $1`, g.ID); err != nil {
+		return fmt.Errorf("clear SCIM group members: %w", err)
+	}
+	if err := insertSCIMGroupMembers(ctx, tx, g); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit SCIM group update: %w", err)
+	}
+	return nil
+}
+
+func insertSCIMGroupMembers(ctx context.Context, tx pgx.Tx, g *models.SCIMGroup) error {
+	for _, userID := range g.MemberIDs {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO scim_group_members (group_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, g.ID, userID)
+		if err != nil {
+			return fmt.Errorf("add SCIM group member: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetSCIMGroup returns a group with its members, or nil if it does not
+// exist in the organization.
+func (db *DB) GetSCIMGroup(ctx context.Context, orgID, id uuid.UUID) (*models.SCIMGroup, error) {
+	groups, err := db.querySCIMGroups(ctx, `WHERE g.org_id = $1 AND g.id = $2`, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	return groups[0], nil
+}
+
+// GetSCIMGroupByDisplayName returns the group named displayName, or nil if there is none.
+func (db *DB) GetSCIMGroupByDisplayName(ctx context.Context, orgID uuid.UUID, displayName string) (*models.SCIMGroup, error) {
+	groups, err := db.querySCIMGroups(ctx, `WHERE g.org_id = $1 AND g.display_name = $2`, orgID, displayName)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	return groups[0], nil
+}
+
+// ListSCIMGroups returns all of an organization's SCIM groups with their members.
+func (db *DB) ListSCIMGroups(ctx context.Context, orgID uuid.UUID) ([]*models.SCIMGroup, error) {
+	return db.querySCIMGroups(ctx, `WHERE g.org_id = $1`, orgID)
+}
+
+func (db *DB) querySCIMGroups(ctx context.Context, where string, args ...any) ([]*models.SCIMGroup, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT g.id, g.org_id, g.display_name, g.external_id, g.created_at, g.updated_at,
+		       COALESCE(ARRAY_AGG(m.user_id) FILTER (WHERE m.user_id IS NOT NULL), '{}')
+		FROM scim_groups g
+		LEFT JOIN scim_group_members m ON m.group_id = g.id
+		`+where+`
+		GROUP BY g.id
+		ORDER BY g.display_name
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list SCIM groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []*models.SCIMGroup
+	for rows.Next() {
+		var g models.SCIMGroup
+		if err := rows.Scan(&g.ID, &g.OrgID, &g.DisplayName, &g.ExternalID, &g.CreatedAt, &g.UpdatedAt, &g.MemberIDs); err != nil {
+			return nil, fmt.Errorf("scan SCIM group: %w", err)
+		}
+		groups = append(groups, &g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate SCIM groups: %w", err)
+	}
+	return groups, nil
+}
+
+// DeleteSCIMGroup deletes a group and its memberships.
+func (db *DB) DeleteSCIMGroup(ctx context.Context, orgID, id uuid.UUID) error {
+	_, err := db.Pool.Exec(ctx, `DELETE FROM scim_groups WHERE id = $1 AND org_id = $2`, id, orgID)
+	if err != nil {
+		return fmt.Errorf("delete SCIM group: %w", err)
+	}
+	return nil
+}
+
+// GetSCIMGroupNamesForUser returns the display names of the organization's
+// SCIM groups the user belongs to.
+func (db *DB) GetSCIMGroupNamesForUser(ctx context.Context, orgID, userID uuid.UUID) ([]string, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT g.display_name
+		FROM scim_groups g
+		JOIN scim_group_members m ON m.group_id = g.id
+		WHERE g.org_id = $1 AND m.user_id = $2
+		ORDER BY g.display_name
+	`, orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get SCIM groups for user: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan SCIM group name: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate SCIM group names: %w", err)
+	}
+	return names, nil
+}
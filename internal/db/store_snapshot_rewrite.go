@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ReplaceSnapshotID repoints a snapshot's Keldris records to the new ID restic
+// assigned after a tag change or rewrite. Historical records such as
+// verifications and replication events keep the original ID.
+func (db *DB) ReplaceSnapshotID(ctx context.Context, repositoryID uuid.UUID, oldID, newID string) error {
+	return db.ExecTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `
+			UPDATE backups SET snapshot_id = $3
+			WHERE repository_id = $1 AND snapshot_id = $2
+		`, repositoryID, oldID, newID); err != nil {
+			return fmt.Errorf("update backups: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE snapshot_tags SET snapshot_id = $2 WHERE snapshot_id = $1
+		`, oldID, newID); err != nil {
+			return fmt.Errorf("update snapshot tags: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE snapshot_comments SET snapshot_id = $2 WHERE snapshot_id = $1
+		`, oldID, newID); err != nil {
+			return fmt.Errorf("update snapshot comments: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE snapshot_tiers SET snapshot_id = $3
+			WHERE repository_id = $1 AND snapshot_id = $2
+		`, repositoryID, oldID, newID); err != nil {
+			return fmt.Errorf("update snapshot tiers: %w", err)
+		}
+		return nil
+	})
+}
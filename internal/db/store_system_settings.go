@@ -167,6 +167,36 @@ func (db *DB) UpdateOIDCSettings(ctx context.Context, orgID uuid.UUID, oidc *set
 	return db.UpsertSystemSetting(ctx, s)
 }
 
+// GetSAMLSettings returns SAML settings for an organization.
+func (db *DB) GetSAMLSettings(ctx context.Context, orgID uuid.UUID) (*settings.SAMLSettings, error) {
+	setting, err := db.GetOrgSetting(ctx, orgID, settings.SettingKeySAML)
+	if err != nil {
+		// Return defaults if not found
+		defaults := settings.DefaultSAMLSettings()
+		return &defaults, nil
+	}
+
+	var saml settings.SAMLSettings
+	if err := json.Unmarshal(setting.Value, &saml); err != nil {
+		return nil, fmt.Errorf("unmarshal SAML settings: %w", err)
+	}
+
+	return &saml, nil
+}
+
+// UpdateSAMLSettings updates SAML settings for an organization.
+func (db *DB) UpdateSAMLSettings(ctx context.Context, orgID uuid.UUID, saml *settings.SAMLSettings) error {
+	value, err := json.Marshal(saml)
+	if err != nil {
+		return fmt.Errorf("marshal SAML settings: %w", err)
+	}
+
+	s := settings.NewSystemSetting(orgID, settings.SettingKeySAML, "SAML 2.0 single sign-on configuration")
+	s.Value = value
+
+	return db.UpsertSystemSetting(ctx, s)
+}
+
 // GetStorageDefaultSettings returns storage default settings for an organization.
 func (db *DB) GetStorageDefaultSettings(ctx context.Context, orgID uuid.UUID) (*settings.StorageDefaultSettings, error) {
 	setting, err := db.GetOrgSetting(ctx, orgID, settings.SettingKeyStorageDefaults)
@@ -19,12 +19,12 @@ func (db *DB) CreateUsageMetrics(ctx context.Context, metrics *models.UsageMetri
 			id, org_id, snapshot_date, agent_count, active_agent_count,
 			user_count, active_user_count, total_storage_bytes, backup_storage_bytes,
 			backups_completed, backups_failed, backups_total, repository_count,
-			schedule_count, snapshot_count, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+			schedule_count, snapshot_count, hosted_storage_bytes, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 	`, metrics.ID, metrics.OrgID, metrics.SnapshotDate, metrics.AgentCount, metrics.ActiveAgentCount,
 		metrics.UserCount, metrics.ActiveUserCount, metrics.TotalStorageBytes, metrics.BackupStorageBytes,
 		metrics.BackupsCompleted, metrics.BackupsFailed, metrics.BackupsTotal, metrics.RepositoryCount,
-		metrics.ScheduleCount, metrics.SnapshotCount, metrics.CreatedAt, metrics.UpdatedAt)
+		metrics.ScheduleCount, metrics.SnapshotCount, metrics.HostedStorageBytes, metrics.CreatedAt, metrics.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("create usage metrics: %w", err)
 	}
@@ -38,8 +38,8 @@ func (db *DB) UpsertUsageMetrics(ctx context.Context, metrics *models.UsageMetri
 			id, org_id, snapshot_date, agent_count, active_agent_count,
 			user_count, active_user_count, total_storage_bytes, backup_storage_bytes,
 			backups_completed, backups_failed, backups_total, repository_count,
-			schedule_count, snapshot_count, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+			schedule_count, snapshot_count, hosted_storage_bytes, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 		ON CONFLICT (org_id, snapshot_date) DO UPDATE SET
 			agent_count = $4,
 			active_agent_count = $5,
@@ -53,11 +53,12 @@ func (db *DB) UpsertUsageMetrics(ctx context.Context, metrics *models.UsageMetri
 			repository_count = $13,
 			schedule_count = $14,
 			snapshot_count = $15,
-			updated_at = $17
+			hosted_storage_bytes = $16,
+			updated_at = $18
 	`, metrics.ID, metrics.OrgID, metrics.SnapshotDate, metrics.AgentCount, metrics.ActiveAgentCount,
 		metrics.UserCount, metrics.ActiveUserCount, metrics.TotalStorageBytes, metrics.BackupStorageBytes,
 		metrics.BackupsCompleted, metrics.BackupsFailed, metrics.BackupsTotal, metrics.RepositoryCount,
-		metrics.ScheduleCount, metrics.SnapshotCount, metrics.CreatedAt, metrics.UpdatedAt)
+		metrics.ScheduleCount, metrics.SnapshotCount, metrics.HostedStorageBytes, metrics.CreatedAt, metrics.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("upsert usage metrics: %w", err)
 	}
@@ -70,7 +71,7 @@ func (db *DB) GetUsageMetricsByOrgID(ctx context.Context, orgID uuid.UUID, start
 		SELECT id, org_id, snapshot_date, agent_count, active_agent_count,
 		       user_count, active_user_count, total_storage_bytes, backup_storage_bytes,
 		       backups_completed, backups_failed, backups_total, repository_count,
-		       schedule_count, snapshot_count, created_at, updated_at
+		       schedule_count, snapshot_count, hosted_storage_bytes, created_at, updated_at
 		FROM usage_metrics
 		WHERE org_id = $1 AND snapshot_date >= $2 AND snapshot_date < $3
 		ORDER BY snapshot_date ASC
@@ -90,7 +91,7 @@ func (db *DB) GetLatestUsageMetrics(ctx context.Context, orgID uuid.UUID) (*mode
 		SELECT id, org_id, snapshot_date, agent_count, active_agent_count,
 		       user_count, active_user_count, total_storage_bytes, backup_storage_bytes,
 		       backups_completed, backups_failed, backups_total, repository_count,
-		       schedule_count, snapshot_count, created_at, updated_at
+		       schedule_count, snapshot_count, hosted_storage_bytes, created_at, updated_at
 		FROM usage_metrics
 		WHERE org_id = $1
 		ORDER BY snapshot_date DESC
@@ -99,7 +100,7 @@ func (db *DB) GetLatestUsageMetrics(ctx context.Context, orgID uuid.UUID) (*mode
 		&m.ID, &m.OrgID, &m.SnapshotDate, &m.AgentCount, &m.ActiveAgentCount,
 		&m.UserCount, &m.ActiveUserCount, &m.TotalStorageBytes, &m.BackupStorageBytes,
 		&m.BackupsCompleted, &m.BackupsFailed, &m.BackupsTotal, &m.RepositoryCount,
-		&m.ScheduleCount, &m.SnapshotCount, &m.CreatedAt, &m.UpdatedAt,
+		&m.ScheduleCount, &m.SnapshotCount, &m.HostedStorageBytes, &m.CreatedAt, &m.UpdatedAt,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -119,7 +120,7 @@ func scanUsageMetrics(rows pgx.Rows) ([]*models.UsageMetrics, error) {
 			&m.ID, &m.OrgID, &m.SnapshotDate, &m.AgentCount, &m.ActiveAgentCount,
 			&m.UserCount, &m.ActiveUserCount, &m.TotalStorageBytes, &m.BackupStorageBytes,
 			&m.BackupsCompleted, &m.BackupsFailed, &m.BackupsTotal, &m.RepositoryCount,
-			&m.ScheduleCount, &m.SnapshotCount, &m.CreatedAt, &m.UpdatedAt,
+			&m.ScheduleCount, &m.SnapshotCount, &m.HostedStorageBytes, &m.CreatedAt, &m.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scan usage metrics: %w", err)
@@ -39,6 +39,8 @@ const (
 	FeatureStorageDropbox Feature = "storage_dropbox"
 	// FeatureStorageRest enables REST server storage backend (Pro+).
 	FeatureStorageRest Feature = "storage_rest"
+	// FeatureStorageRclone enables the generic rclone storage backend (Pro+).
+	FeatureStorageRclone Feature = "storage_rclone"
 	// FeatureDockerBackup enables Docker container backups (Pro+).
 	FeatureDockerBackup Feature = "docker_backup"
 	// FeatureMultiRepo enables multiple backup repositories (Pro+).
@@ -90,6 +92,7 @@ var featureAccess = map[LicenseTier][]Feature{
 		FeatureStorageSFTP,
 		FeatureStorageDropbox,
 		FeatureStorageRest,
+		FeatureStorageRclone,
 		FeatureDockerBackup,
 		FeatureMultiRepo,
 		FeatureAPIAccess,
@@ -108,6 +111,7 @@ var featureAccess = map[LicenseTier][]Feature{
 		FeatureStorageSFTP,
 		FeatureStorageDropbox,
 		FeatureStorageRest,
+		FeatureStorageRclone,
 		FeatureDockerBackup,
 		FeatureMultiRepo,
 		FeatureAPIAccess,
@@ -167,6 +171,7 @@ var featureTierMap = map[Feature]Tier{
 	FeatureStorageSFTP:          TierPro,
 	FeatureStorageDropbox:       TierPro,
 	FeatureStorageRest:          TierPro,
+	FeatureStorageRclone:        TierPro,
 	FeatureDockerBackup:         TierPro,
 	FeatureMultiRepo:            TierPro,
 	FeatureAPIAccess:            TierPro,
@@ -202,6 +207,7 @@ func AllFeatures() []Feature {
 		FeatureStorageSFTP,
 		FeatureStorageDropbox,
 		FeatureStorageRest,
+		FeatureStorageRclone,
 		FeatureDockerBackup,
 		FeatureMultiRepo,
 		FeatureAPIAccess,
@@ -317,6 +323,9 @@ func GetFeatureInfo(f Feature) FeatureInfo {
 	case FeatureStorageRest:
 		info.DisplayName = "REST Server Storage"
 		info.Description = "Use restic REST server as backup destination"
+	case FeatureStorageRclone:
+		info.DisplayName = "Rclone Storage"
+		info.Description = "Use any rclone-supported remote as backup destination"
 	case FeatureDockerBackup:
 		info.DisplayName = "Docker Backup"
 		info.Description = "Back up Docker containers and volumes"
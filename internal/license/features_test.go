@@ -87,15 +87,15 @@ func TestFeaturesForTier(t *testing.T) {
 
 	t.Run("pro tier features", func(t *testing.T) {
 		features := FeaturesForTier(TierPro)
-		if len(features) != 16 {
-			t.Errorf("FeaturesForTier(TierPro) returned %d features, want 16", len(features))
+		if len(features) != 17 {
+			t.Errorf("FeaturesForTier(TierPro) returned %d features, want 17", len(features))
 		}
 	})
 
 	t.Run("enterprise tier features", func(t *testing.T) {
 		features := FeaturesForTier(TierEnterprise)
-		if len(features) != 28 {
-			t.Errorf("FeaturesForTier(TierEnterprise) returned %d features, want 28", len(features))
+		if len(features) != 29 {
+			t.Errorf("FeaturesForTier(TierEnterprise) returned %d features, want 29", len(features))
 		}
 	})
 
@@ -225,8 +225,8 @@ func TestFeatures_FreeTierLimits(t *testing.T) {
 
 func TestFeatures_ProTierLimits(t *testing.T) {
 	features := FeaturesForTier(TierPro)
-	if len(features) != 16 {
-		t.Fatalf("pro tier should have 16 features, got %d", len(features))
+	if len(features) != 17 {
+		t.Fatalf("pro tier should have 17 features, got %d", len(features))
 	}
 
 	// Verify the exact features
@@ -247,6 +247,7 @@ func TestFeatures_ProTierLimits(t *testing.T) {
 		FeatureStorageSFTP,
 		FeatureStorageDropbox,
 		FeatureStorageRest,
+		FeatureStorageRclone,
 		FeatureDockerBackup,
 		FeatureMultiRepo,
 		FeatureAPIAccess,
@@ -283,8 +284,8 @@ func TestFeatures_ProTierLimits(t *testing.T) {
 
 func TestFeatures_EnterpriseTierLimits(t *testing.T) {
 	features := FeaturesForTier(TierEnterprise)
-	if len(features) != 28 {
-		t.Fatalf("enterprise tier should have 28 features, got %d", len(features))
+	if len(features) != 29 {
+		t.Fatalf("enterprise tier should have 29 features, got %d", len(features))
 	}
 
 	// Verify all features are present
@@ -306,6 +307,7 @@ func TestFeatures_EnterpriseTierLimits(t *testing.T) {
 		FeatureStorageSFTP,
 		FeatureStorageDropbox,
 		FeatureStorageRest,
+		FeatureStorageRclone,
 		FeatureDockerBackup,
 		FeatureMultiRepo,
 		FeatureAPIAccess,
@@ -27,6 +27,7 @@ type Store interface {
 
 	// Storage counts
 	GetTotalStorageByOrgID(ctx context.Context, orgID uuid.UUID) (int64, error)
+	GetHostedStorageByOrgID(ctx context.Context, orgID uuid.UUID) (int64, error)
 
 	// Backup counts
 	GetBackupCountByOrgIDForPeriod(ctx context.Context, orgID uuid.UUID, start, end time.Time) (completed, failed int, err error)
@@ -227,6 +228,12 @@ func (s *Service) TakeSnapshot(ctx context.Context, orgID uuid.UUID) error {
 	metrics.TotalStorageBytes = storage
 	metrics.BackupStorageBytes = storage
 
+	hosted, err := s.store.GetHostedStorageByOrgID(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("get hosted storage: %w", err)
+	}
+	metrics.HostedStorageBytes = hosted
+
 	// Collect today's backup counts
 	startOfDay := today
 	endOfDay := today.Add(24 * time.Hour)
@@ -540,6 +547,12 @@ func (s *Service) GetCurrentUsage(ctx context.Context, orgID uuid.UUID) (*models
 	}
 	usage.StorageBytes = storage
 
+	hosted, err := s.store.GetHostedStorageByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("get hosted storage: %w", err)
+	}
+	usage.HostedStorageBytes = hosted
+
 	repoCount, err := s.store.GetRepositoryCountByOrgID(ctx, orgID)
 	if err != nil {
 		return nil, fmt.Errorf("get repository count: %w", err)
@@ -33,6 +33,14 @@ const (
 	CommandTypeSnapshotDiff CommandType = "snapshot_diff"
 	// CommandTypeFileDiff diffs a file between two snapshots.
 	CommandTypeFileDiff CommandType = "file_diff"
+	// CommandTypeDockerDatabaseRestore streams a database dump back into a container.
+	CommandTypeDockerDatabaseRestore CommandType = "docker_database_restore"
+	// CommandTypeKubernetesRestore restores Kubernetes namespaces into the agent's cluster.
+	CommandTypeKubernetesRestore CommandType = "kubernetes_restore"
+	// CommandTypeLibvirtDiscover lists the libvirt domains on the agent's host.
+	CommandTypeLibvirtDiscover CommandType = "libvirt_discover"
+	// CommandTypeLibvirtRestore restores a libvirt domain on the agent's host.
+	CommandTypeLibvirtRestore CommandType = "libvirt_restore"
 )
 
 // CommandStatus represents the current status of a command.
@@ -73,6 +81,22 @@ type CommandPayload struct {
 	TargetPath   string `json:"target_path,omitempty"`
 	SnapshotID2  string `json:"snapshot_id_2,omitempty"`
 	FilePath     string `json:"file_path,omitempty"`
+	// For docker_database_restore command
+	Container string `json:"container,omitempty"`
+	// For kubernetes_restore command
+	RestoreID        string            `json:"restore_id,omitempty"`
+	Namespaces       []string          `json:"namespaces,omitempty"`
+	NamespaceMapping map[string]string `json:"namespace_mapping,omitempty"`
+	NameMapping      map[string]string `json:"name_mapping,omitempty"`
+	Overwrite        bool              `json:"overwrite,omitempty"`
+	RestoreVolumes   bool              `json:"restore_volumes,omitempty"`
+	// For libvirt_discover and libvirt_restore commands; restores also use
+	// RestoreID and Overwrite
+	LibvirtURI  string `json:"libvirt_uri,omitempty"`
+	Domain      string `json:"domain,omitempty"`
+	NewName     string `json:"new_name,omitempty"`
+	TargetDir   string `json:"target_dir,omitempty"`
+	StartDomain bool   `json:"start_domain,omitempty"`
 }
 
 // CommandResult contains the result of a command execution.
@@ -82,6 +106,12 @@ type CommandResult struct {
 	Diagnostics map[string]any       `json:"diagnostics,omitempty"`
 	BackupID    *uuid.UUID           `json:"backup_id,omitempty"`
 	DryRun      *DryRunCommandResult `json:"dry_run,omitempty"`
+	// KubernetesRestore is the result of a kubernetes_restore command.
+	KubernetesRestore *KubernetesRestoreResult `json:"kubernetes_restore,omitempty"`
+	// Libvirt is the result of a libvirt_discover command.
+	Libvirt *LibvirtInfo `json:"libvirt,omitempty"`
+	// LibvirtRestore is the result of a libvirt_restore command.
+	LibvirtRestore *LibvirtRestoreResult `json:"libvirt_restore,omitempty"`
 }
 
 // DryRunCommandResult contains the results of a dry run backup operation.
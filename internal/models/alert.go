@@ -37,6 +37,11 @@ const (
 	AlertTypeDockerDaemonUnavailable AlertType = "docker_daemon_unavailable"
 	// AlertTypeAgentReconnectedWithQueue indicates an agent reconnected with queued backups.
 	AlertTypeAgentReconnectedWithQueue AlertType = "agent_reconnected_with_queue"
+	// AlertTypeBackupCompliance indicates a schedule no longer meets the 3-2-1 backup rule.
+	AlertTypeBackupCompliance AlertType = "backup_compliance"
+	// AlertTypeDockerFinalBackupFailed indicates an agent could not run the
+	// final backup of a removed Docker container.
+	AlertTypeDockerFinalBackupFailed AlertType = "docker_final_backup_failed"
 )
 
 // AlertSeverity represents the severity level of an alert.
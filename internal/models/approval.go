@@ -0,0 +1,146 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ApprovalAction identifies a destructive operation that can be placed
+// behind four-eyes approval.
+type ApprovalAction string
+
+const (
+	// ApprovalActionRepositoryDelete deletes a repository.
+	ApprovalActionRepositoryDelete ApprovalAction = "repository_delete"
+	// ApprovalActionLegalHoldRemove removes a legal hold from a snapshot.
+	ApprovalActionLegalHoldRemove ApprovalAction = "legal_hold_remove"
+	// ApprovalActionImmutabilityReduce disables or shortens a repository's immutability lock period.
+	ApprovalActionImmutabilityReduce ApprovalAction = "immutability_reduce"
+	// ApprovalActionRetentionChange applies a new retention policy, which
+	// forgets and prunes snapshots on the next run.
+	ApprovalActionRetentionChange ApprovalAction = "retention_change"
+	// ApprovalActionSnapshotPurge rewrites snapshots without the purged
+	// paths, whose data is gone for good once the repository is pruned.
+	ApprovalActionSnapshotPurge ApprovalAction = "snapshot_purge"
+	// ApprovalActionPBSPrune applies a connection's retention policy to a
+	// Proxmox Backup Server datastore, removing snapshots on the server.
+	ApprovalActionPBSPrune ApprovalAction = "pbs_prune"
+)
+
+// ApprovalActions lists every action that can require approval.
+var ApprovalActions = []ApprovalAction{
+	ApprovalActionRepositoryDelete,
+	ApprovalActionLegalHoldRemove,
+	ApprovalActionImmutabilityReduce,
+	ApprovalActionRetentionChange,
+	ApprovalActionSnapshotPurge,
+	ApprovalActionPBSPrune,
+}
+
+// IsValid returns true if the action is a known approval action.
+func (a ApprovalAction) IsValid() bool {
+	for _, known := range ApprovalActions {
+		if a == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ApprovalStatus is the lifecycle state of an approval request.
+type ApprovalStatus string
+
+const (
+	// ApprovalStatusPending is awaiting a decision.
+	ApprovalStatusPending ApprovalStatus = "pending"
+	// ApprovalStatusApproved was approved and the operation is executing.
+	ApprovalStatusApproved ApprovalStatus = "approved"
+	// ApprovalStatusExecuted was approved and the operation succeeded.
+	ApprovalStatusExecuted ApprovalStatus = "executed"
+	// ApprovalStatusFailed was approved but the operation returned an error.
+	ApprovalStatusFailed ApprovalStatus = "failed"
+	// ApprovalStatusRejected was declined by an approver.
+	ApprovalStatusRejected ApprovalStatus = "rejected"
+	// ApprovalStatusCancelled was withdrawn by the requester.
+	ApprovalStatusCancelled ApprovalStatus = "cancelled"
+	// ApprovalStatusExpired was not decided before its deadline.
+	ApprovalStatusExpired ApprovalStatus = "expired"
+)
+
+// ApprovalRequest is a destructive operation awaiting approval from a
+// second administrator. Payload holds the operation parameters so the
+// approved request can be executed exactly as submitted.
+type ApprovalRequest struct {
+	ID              uuid.UUID       `json:"id"`
+	OrgID           uuid.UUID       `json:"org_id"`
+	Action          ApprovalAction  `json:"action"`
+	ResourceType    string          `json:"resource_type"`
+	ResourceID      string          `json:"resource_id"`
+	Summary         string          `json:"summary"`
+	Reason          string          `json:"reason,omitempty"`
+	Payload         json.RawMessage `json:"payload,omitempty"`
+	Status          ApprovalStatus  `json:"status"`
+	RequestedBy     uuid.UUID       `json:"requested_by"`
+	DecidedBy       *uuid.UUID      `json:"decided_by,omitempty"`
+	DecisionComment string          `json:"decision_comment,omitempty"`
+	ErrorMessage    string          `json:"error_message,omitempty"`
+	ExpiresAt       time.Time       `json:"expires_at"`
+	DecidedAt       *time.Time      `json:"decided_at,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// NewApprovalRequest creates a pending approval request. The expiry is set
+// when the request is submitted.
+func NewApprovalRequest(orgID, requestedBy uuid.UUID, action ApprovalAction, resourceType, resourceID, summary string) *ApprovalRequest {
+	now := time.Now()
+	return &ApprovalRequest{
+		ID:           uuid.New(),
+		OrgID:        orgID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Summary:      summary,
+		Status:       ApprovalStatusPending,
+		RequestedBy:  requestedBy,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+}
+
+// SetPayload stores the operation parameters replayed on approval.
+func (r *ApprovalRequest) SetPayload(payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	r.Payload = data
+	return nil
+}
+
+// IsPending returns true if the request is still awaiting a decision.
+func (r *ApprovalRequest) IsPending() bool {
+	return r.Status == ApprovalStatusPending
+}
+
+// IsExpired returns true if a pending request has passed its deadline.
+func (r *ApprovalRequest) IsExpired(now time.Time) bool {
+	return r.Status == ApprovalStatusPending && !r.ExpiresAt.IsZero() && now.After(r.ExpiresAt)
+}
+
+// Decide records the outcome of a decision on the request.
+func (r *ApprovalRequest) Decide(status ApprovalStatus, decidedBy uuid.UUID, comment string) {
+	now := time.Now()
+	r.Status = status
+	r.DecidedBy = &decidedBy
+	r.DecisionComment = comment
+	r.DecidedAt = &now
+	r.UpdatedAt = now
+}
+
+// ApprovalDecisionRequest is the body for approving or rejecting a request.
+type ApprovalDecisionRequest struct {
+	Comment string `json:"comment,omitempty"`
+}
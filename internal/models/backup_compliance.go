@@ -0,0 +1,127 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ComplianceMedia is the class of storage a backup copy lives on, used for
+// the "two media types" part of the 3-2-1 rule.
+type ComplianceMedia string
+
+const (
+	// ComplianceMediaLocalDisk is a disk or NAS path reachable from the agent.
+	ComplianceMediaLocalDisk ComplianceMedia = "local_disk"
+	// ComplianceMediaRemoteServer is a backup server reached over the network (SFTP, REST).
+	ComplianceMediaRemoteServer ComplianceMedia = "remote_server"
+	// ComplianceMediaCloudObject is cloud object or file storage.
+	ComplianceMediaCloudObject ComplianceMedia = "cloud_object"
+)
+
+// MediaForRepositoryType classifies a repository type into a media type.
+func MediaForRepositoryType(t RepositoryType) ComplianceMedia {
+	switch t {
+	case RepositoryTypeLocal:
+		return ComplianceMediaLocalDisk
+	case RepositoryTypeSFTP, RepositoryTypeRest:
+		return ComplianceMediaRemoteServer
+	default:
+		return ComplianceMediaCloudObject
+	}
+}
+
+// ComplianceRepository holds the repository attributes the 3-2-1 evaluation
+// depends on.
+type ComplianceRepository struct {
+	ID                  uuid.UUID      `json:"id"`
+	Name                string         `json:"name"`
+	Type                RepositoryType `json:"type"`
+	ReadOnly            bool           `json:"read_only"`
+	Region              string         `json:"region,omitempty"`
+	ImmutabilityEnabled bool           `json:"immutability_enabled"`
+}
+
+// ComplianceDestination is one backup copy of a schedule's data.
+type ComplianceDestination struct {
+	RepositoryID   uuid.UUID       `json:"repository_id"`
+	RepositoryName string          `json:"repository_name"`
+	RepositoryType RepositoryType  `json:"repository_type"`
+	Media          ComplianceMedia `json:"media"`
+	Region         string          `json:"region,omitempty"`
+	Offsite        bool            `json:"offsite"`
+	Immutable      bool            `json:"immutable"`
+	// Replica is set when the copy is made by geo-replication rather than
+	// by the schedule itself.
+	Replica bool `json:"replica"`
+}
+
+// ScheduleCompliance is the 3-2-1 evaluation of one backup schedule. Copies
+// counts the production data plus every backup destination.
+type ScheduleCompliance struct {
+	ScheduleID   uuid.UUID               `json:"schedule_id"`
+	OrgID        uuid.UUID               `json:"org_id"`
+	AgentID      uuid.UUID               `json:"agent_id"`
+	ScheduleName string                  `json:"schedule_name"`
+	Copies       int                     `json:"copies"`
+	MediaTypes   []ComplianceMedia       `json:"media_types"`
+	Offsite      bool                    `json:"offsite"`
+	Immutable    bool                    `json:"immutable"`
+	Score        int                     `json:"score"`
+	Compliant    bool                    `json:"compliant"`
+	Gaps         []string                `json:"gaps"`
+	Destinations []ComplianceDestination `json:"destinations"`
+	EvaluatedAt  time.Time               `json:"evaluated_at"`
+}
+
+// AgentCompliance aggregates the evaluations of an agent's enabled schedules.
+// An agent is only as compliant as its weakest schedule.
+type AgentCompliance struct {
+	AgentID   uuid.UUID             `json:"agent_id"`
+	Hostname  string                `json:"hostname"`
+	Score     int                   `json:"score"`
+	Compliant bool                  `json:"compliant"`
+	Gaps      []string              `json:"gaps"`
+	Schedules []*ScheduleCompliance `json:"schedules"`
+}
+
+// BackupComplianceReport is the 3-2-1 evaluation of an organization.
+type BackupComplianceReport struct {
+	OrgID              uuid.UUID          `json:"org_id"`
+	Score              int                `json:"score"`
+	CompliantAgents    int                `json:"compliant_agents"`
+	TotalAgents        int                `json:"total_agents"`
+	CompliantSchedules int                `json:"compliant_schedules"`
+	TotalSchedules     int                `json:"total_schedules"`
+	Agents             []*AgentCompliance `json:"agents"`
+	EvaluatedAt        time.Time          `json:"evaluated_at"`
+}
+
+// BackupComplianceSummary condenses stored schedule evaluations for dashboards and
+// reports.
+type BackupComplianceSummary struct {
+	Score              int                   `json:"score"`
+	CompliantSchedules int                   `json:"compliant_schedules"`
+	TotalSchedules     int                   `json:"total_schedules"`
+	NonCompliant       []*ScheduleCompliance `json:"non_compliant,omitempty"`
+}
+
+// SummarizeBackupCompliance builds a summary from schedule evaluations. The score
+// is the average schedule score.
+func SummarizeBackupCompliance(evaluations []*ScheduleCompliance) *BackupComplianceSummary {
+	summary := &BackupComplianceSummary{TotalSchedules: len(evaluations)}
+	if len(evaluations) == 0 {
+		return summary
+	}
+	total := 0
+	for _, e := range evaluations {
+		total += e.Score
+		if e.Compliant {
+			summary.CompliantSchedules++
+		} else {
+			summary.NonCompliant = append(summary.NonCompliant, e)
+		}
+	}
+	summary.Score = total / len(evaluations)
+	return summary
+}
@@ -0,0 +1,209 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoleBindingSubjectType identifies what a custom role binding is granted to.
+type RoleBindingSubjectType string
+
+const (
+	// RoleBindingSubjectUser binds a custom role to a single user.
+	RoleBindingSubjectUser RoleBindingSubjectType = "user"
+	// RoleBindingSubjectSSOGroup binds a custom role to every member of an SSO group.
+	RoleBindingSubjectSSOGroup RoleBindingSubjectType = "sso_group"
+)
+
+// IsValidRoleBindingSubjectType checks if the given subject type is valid.
+func IsValidRoleBindingSubjectType(t string) bool {
+	switch RoleBindingSubjectType(t) {
+	case RoleBindingSubjectUser, RoleBindingSubjectSSOGroup:
+		return true
+	default:
+		return false
+	}
+}
+
+// CustomRole is an organization-defined role built from the permission catalog.
+type CustomRole struct {
+	ID          uuid.UUID  `json:"id"`
+	OrgID       uuid.UUID  `json:"org_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Permissions []string   `json:"permissions"`
+	CreatedBy   *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// NewCustomRole creates a new CustomRole.
+func NewCustomRole(orgID uuid.UUID, name, description string, permissions []string) *CustomRole {
+	now := time.Now()
+	if permissions == nil {
+		permissions = []string{}
+	}
+	return &CustomRole{
+		ID:          uuid.New(),
+		OrgID:       orgID,
+		Name:        name,
+		Description: description,
+		Permissions: permissions,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// PermissionsJSON returns the permissions as JSON bytes.
+func (r *CustomRole) PermissionsJSON() ([]byte, error) {
+	if r.Permissions == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(r.Permissions)
+}
+
+// SetPermissions sets the permissions from JSON bytes.
+func (r *CustomRole) SetPermissions(data []byte) error {
+	if len(data) == 0 {
+		r.Permissions = []string{}
+		return nil
+	}
+	return json.Unmarshal(data, &r.Permissions)
+}
+
+// HasPermission checks if the role grants the given permission.
+func (r *CustomRole) HasPermission(perm string) bool {
+	for _, p := range r.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleBinding grants a custom role to a user or SSO group, optionally
+// restricted to a set of agent groups and/or repositories.
+type RoleBinding struct {
+	ID            uuid.UUID              `json:"id"`
+	OrgID         uuid.UUID              `json:"org_id"`
+	RoleID        uuid.UUID              `json:"role_id"`
+	SubjectType   RoleBindingSubjectType `json:"subject_type"`
+	UserID        *uuid.UUID             `json:"user_id,omitempty"`
+	SSOGroupName  string                 `json:"sso_group_name,omitempty"`
+	AgentGroupIDs []uuid.UUID            `json:"agent_group_ids"`
+	RepositoryIDs []uuid.UUID            `json:"repository_ids"`
+	CreatedBy     *uuid.UUID             `json:"created_by,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+}
+
+// NewUserRoleBinding creates a new RoleBinding for a single user.
+func NewUserRoleBinding(orgID, roleID, userID uuid.UUID) *RoleBinding {
+	b := newRoleBinding(orgID, roleID, RoleBindingSubjectUser)
+	b.UserID = &userID
+	return b
+}
+
+// NewSSOGroupRoleBinding creates a new RoleBinding for an SSO group.
+func NewSSOGroupRoleBinding(orgID, roleID uuid.UUID, groupName string) *RoleBinding {
+	b := newRoleBinding(orgID, roleID, RoleBindingSubjectSSOGroup)
+	b.SSOGroupName = groupName
+	return b
+}
+
+func newRoleBinding(orgID, roleID uuid.UUID, subjectType RoleBindingSubjectType) *RoleBinding {
+	now := time.Now()
+	return &RoleBinding{
+		ID:            uuid.New(),
+		OrgID:         orgID,
+		RoleID:        roleID,
+		SubjectType:   subjectType,
+		AgentGroupIDs: []uuid.UUID{},
+		RepositoryIDs: []uuid.UUID{},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+// IsScoped returns true if the binding is restricted to specific resources.
+func (b *RoleBinding) IsScoped() bool {
+	return len(b.AgentGroupIDs) > 0 || len(b.RepositoryIDs) > 0
+}
+
+// AgentGroupIDsJSON returns the agent group scope as JSON bytes.
+func (b *RoleBinding) AgentGroupIDsJSON() ([]byte, error) {
+	if b.AgentGroupIDs == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(b.AgentGroupIDs)
+}
+
+// RepositoryIDsJSON returns the repository scope as JSON bytes.
+func (b *RoleBinding) RepositoryIDsJSON() ([]byte, error) {
+	if b.RepositoryIDs == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(b.RepositoryIDs)
+}
+
+// SetAgentGroupIDs sets the agent group scope from JSON bytes.
+func (b *RoleBinding) SetAgentGroupIDs(data []byte) error {
+	if len(data) == 0 {
+		b.AgentGroupIDs = []uuid.UUID{}
+		return nil
+	}
+	return json.Unmarshal(data, &b.AgentGroupIDs)
+}
+
+// SetRepositoryIDs sets the repository scope from JSON bytes.
+func (b *RoleBinding) SetRepositoryIDs(data []byte) error {
+	if len(data) == 0 {
+		b.RepositoryIDs = []uuid.UUID{}
+		return nil
+	}
+	return json.Unmarshal(data, &b.RepositoryIDs)
+}
+
+// EffectiveRoleBinding is a role binding joined with the permissions of its role.
+// It is what RBAC evaluates when checking custom role grants for a user.
+type EffectiveRoleBinding struct {
+	RoleBinding
+	RoleName    string   `json:"role_name"`
+	Permissions []string `json:"permissions"`
+}
+
+// HasPermission checks if the bound role grants the given permission.
+func (e *EffectiveRoleBinding) HasPermission(perm string) bool {
+	for _, p := range e.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateCustomRoleRequest is the request to create a custom role.
+type CreateCustomRoleRequest struct {
+	Name        string   `json:"name" binding:"required,min=1,max=100"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// UpdateCustomRoleRequest is the request to update a custom role.
+type UpdateCustomRoleRequest struct {
+	Name        *string  `json:"name,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// CreateRoleBindingRequest is the request to bind a custom role to a subject.
+type CreateRoleBindingRequest struct {
+	RoleID        uuid.UUID   `json:"role_id" binding:"required"`
+	SubjectType   string      `json:"subject_type" binding:"required"`
+	UserID        *uuid.UUID  `json:"user_id,omitempty"`
+	SSOGroupName  string      `json:"sso_group_name,omitempty"`
+	AgentGroupIDs []uuid.UUID `json:"agent_group_ids,omitempty"`
+	RepositoryIDs []uuid.UUID `json:"repository_ids,omitempty"`
+}
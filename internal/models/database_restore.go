@@ -0,0 +1,138 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DatabaseRestoreStatus represents the current status of a database restore.
+type DatabaseRestoreStatus string
+
+const (
+	// DatabaseRestoreStatusPending indicates the restore is queued.
+	DatabaseRestoreStatusPending DatabaseRestoreStatus = "pending"
+	// DatabaseRestoreStatusRunning indicates the restore is in progress.
+	DatabaseRestoreStatusRunning DatabaseRestoreStatus = "running"
+	// DatabaseRestoreStatusCompleted indicates the restore completed.
+	DatabaseRestoreStatusCompleted DatabaseRestoreStatus = "completed"
+	// DatabaseRestoreStatusFailed indicates the restore failed.
+	DatabaseRestoreStatusFailed DatabaseRestoreStatus = "failed"
+)
+
+// DatabaseRestoreResult summarizes a database restore.
+type DatabaseRestoreResult struct {
+	// Filename is the dump in the snapshot that was restored.
+	Filename   string `json:"filename"`
+	Database   string `json:"database,omitempty"`
+	SizeBytes  int64  `json:"size_bytes"`
+	SHA256     string `json:"sha256,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// DatabaseRestore is a restore of a dump streamed by a postgres or mysql
+// schedule back into the database server of that schedule.
+type DatabaseRestore struct {
+	ID           uuid.UUID `json:"id"`
+	OrgID        uuid.UUID `json:"org_id"`
+	ScheduleID   uuid.UUID `json:"schedule_id"`
+	RepositoryID uuid.UUID `json:"repository_id"`
+	SnapshotID   string    `json:"snapshot_id"`
+	// Filename is the dump in the snapshot; empty picks the snapshot's
+	// only file.
+	Filename string `json:"filename,omitempty"`
+	// Database is the database to restore into. It is required for
+	// PostgreSQL custom and tar dumps.
+	Database     string                 `json:"database,omitempty"`
+	Status       DatabaseRestoreStatus  `json:"status"`
+	Result       *DatabaseRestoreResult `json:"result,omitempty"`
+	ErrorMessage string                 `json:"error_message,omitempty"`
+	StartedAt    *time.Time             `json:"started_at,omitempty"`
+	CompletedAt  *time.Time             `json:"completed_at,omitempty"`
+	CreatedBy    *uuid.UUID             `json:"created_by,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+}
+
+// NewDatabaseRestore creates a pending database restore.
+func NewDatabaseRestore(orgID, scheduleID, repositoryID uuid.UUID, snapshotID string) *DatabaseRestore {
+	now := time.Now()
+	return &DatabaseRestore{
+		ID:           uuid.New(),
+		OrgID:        orgID,
+		ScheduleID:   scheduleID,
+		RepositoryID: repositoryID,
+		SnapshotID:   snapshotID,
+		Status:       DatabaseRestoreStatusPending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+}
+
+// Validate checks the dump and target database names.
+func (r *DatabaseRestore) Validate() error {
+	if r.SnapshotID == "" {
+		return errors.New("snapshot_id is required")
+	}
+	// Streamed dumps sit at the root of their snapshot.
+	if r.Filename != "" && (path.Base(r.Filename) != r.Filename || strings.HasPrefix(r.Filename, ".")) {
+		return fmt.Errorf("invalid filename %q", r.Filename)
+	}
+	if strings.HasPrefix(r.Database, "-") {
+		return fmt.Errorf("invalid database name %q", r.Database)
+	}
+	return nil
+}
+
+// Start marks the restore as running.
+func (r *DatabaseRestore) Start() {
+	now := time.Now()
+	r.Status = DatabaseRestoreStatusRunning
+	r.StartedAt = &now
+	r.UpdatedAt = now
+}
+
+// Complete marks the restore as completed with its result.
+func (r *DatabaseRestore) Complete(result *DatabaseRestoreResult) {
+	now := time.Now()
+	r.Status = DatabaseRestoreStatusCompleted
+	r.Result = result
+	r.CompletedAt = &now
+	r.UpdatedAt = now
+}
+
+// Fail marks the restore as failed.
+func (r *DatabaseRestore) Fail(errMsg string) {
+	now := time.Now()
+	r.Status = DatabaseRestoreStatusFailed
+	r.ErrorMessage = errMsg
+	r.CompletedAt = &now
+	r.UpdatedAt = now
+}
+
+// ResultJSON returns the result as JSON for database storage.
+func (r *DatabaseRestore) ResultJSON() ([]byte, error) {
+	if r.Result == nil {
+		return nil, nil
+	}
+	return json.Marshal(r.Result)
+}
+
+// SetResultFromJSON sets the result from JSON data.
+func (r *DatabaseRestore) SetResultFromJSON(data []byte) error {
+	if len(data) == 0 {
+		r.Result = nil
+		return nil
+	}
+	var result DatabaseRestoreResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	r.Result = &result
+	return nil
+}
@@ -399,6 +399,15 @@ type RestoreDockerStackRequest struct {
 	RestoreImages   bool              `json:"restore_images"`
 	StartContainers bool              `json:"start_containers"`
 	PathMappings    map[string]string `json:"path_mappings,omitempty"`
+
+	// Remapping for restores onto another host, applied by the agent.
+	ProjectName     string            `json:"project_name,omitempty"`
+	VolumeMappings  map[string]string `json:"volume_mappings,omitempty"`
+	NetworkMappings map[string]string `json:"network_mappings,omitempty"`
+	SubnetMappings  map[string]string `json:"subnet_mappings,omitempty"` // Original subnet to new subnet (CIDR)
+	PortMappings    map[string]string `json:"port_mappings,omitempty"`   // Published host port ("8080" or "53/udp") to new port
+	DryRun          bool              `json:"dry_run,omitempty"`         // Only plan the restore and report conflicts
+	Force           bool              `json:"force,omitempty"`           // Restore despite conflicts
 }
 
 // DiscoverDockerStacksRequest is the request to discover Docker stacks on an agent.
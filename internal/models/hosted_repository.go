@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HostedRepositoryUsage records the disk used by a repository hosted by the
+// server's built-in restic REST endpoint.
+type HostedRepositoryUsage struct {
+	RepositoryID uuid.UUID `json:"repository_id"`
+	OrgID        uuid.UUID `json:"org_id"`
+	UsedBytes    int64     `json:"used_bytes"`
+	QuotaBytes   *int64    `json:"quota_bytes,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// NewHostedRepositoryUsage creates a usage record for a hosted repository.
+// A quota of zero means unlimited.
+func NewHostedRepositoryUsage(repositoryID, orgID uuid.UUID, usedBytes, quotaBytes int64) *HostedRepositoryUsage {
+	u := &HostedRepositoryUsage{
+		RepositoryID: repositoryID,
+		OrgID:        orgID,
+		UsedBytes:    usedBytes,
+		UpdatedAt:    time.Now(),
+	}
+	if quotaBytes > 0 {
+		u.QuotaBytes = &quotaBytes
+	}
+	return u
+}
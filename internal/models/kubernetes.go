@@ -0,0 +1,301 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// kubernetesNamePattern matches DNS-1123 labels used for namespace names.
+var kubernetesNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// DefaultKubernetesExcludedNamespaces are skipped when a Kubernetes backup
+// does not list its namespaces explicitly.
+var DefaultKubernetesExcludedNamespaces = []string{"kube-system", "kube-public", "kube-node-lease"}
+
+// KubernetesHookPhase is when a quiesce hook runs relative to the backup.
+type KubernetesHookPhase string
+
+const (
+	// KubernetesHookPre runs before manifests and volumes are captured.
+	KubernetesHookPre KubernetesHookPhase = "pre"
+	// KubernetesHookPost runs after the restic snapshot completes.
+	KubernetesHookPost KubernetesHookPhase = "post"
+)
+
+// KubernetesHookAction is what a quiesce hook does.
+type KubernetesHookAction string
+
+const (
+	// KubernetesHookExec runs a command in matching pods.
+	KubernetesHookExec KubernetesHookAction = "exec"
+	// KubernetesHookScaleDown scales matching Deployments and StatefulSets to
+	// zero before the backup and back to their replica count afterwards.
+	KubernetesHookScaleDown KubernetesHookAction = "scale_down"
+)
+
+// KubernetesHook quiesces workloads around a Kubernetes backup, for example
+// by flushing a database or scaling a writer down.
+type KubernetesHook struct {
+	Name string `json:"name"`
+	// Namespace limits the hook to one namespace; empty means every backed up namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// LabelSelector selects the pods (exec) or workloads (scale_down) to act on.
+	LabelSelector string               `json:"label_selector"`
+	Phase         KubernetesHookPhase  `json:"phase"`
+	Action        KubernetesHookAction `json:"action"`
+	// Container is the container to exec in; empty uses the pod's first container.
+	Container      string   `json:"container,omitempty"`
+	Command        []string `json:"command,omitempty"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+	// ContinueOnError keeps the backup going when the hook fails.
+	ContinueOnError bool `json:"continue_on_error,omitempty"`
+}
+
+// KubernetesBackupOptions contains Kubernetes-specific backup configuration.
+type KubernetesBackupOptions struct {
+	// Namespaces to back up; empty means all except ExcludeNamespaces and the
+	// system namespaces.
+	Namespaces        []string `json:"namespaces,omitempty"`
+	ExcludeNamespaces []string `json:"exclude_namespaces,omitempty"`
+	// LabelSelector limits exported namespaced resources.
+	LabelSelector string `json:"label_selector,omitempty"`
+	// IncludeSecrets exports Secrets, encrypted with the server key. Agents
+	// running the backup have no server key and skip them.
+	IncludeSecrets bool `json:"include_secrets"`
+	// IncludeCRDs exports CustomResourceDefinitions and their custom resources.
+	IncludeCRDs bool `json:"include_crds"`
+	// BackupVolumes backs up the data of PVCs mounted on the agent's node.
+	BackupVolumes bool `json:"backup_volumes"`
+	// KubeletRootDir is where pod volumes are mounted on the node.
+	KubeletRootDir string           `json:"kubelet_root_dir,omitempty"`
+	Hooks          []KubernetesHook `json:"hooks,omitempty"`
+}
+
+// DefaultKubernetesOptions returns a sensible default Kubernetes backup configuration.
+func DefaultKubernetesOptions() *KubernetesBackupOptions {
+	return &KubernetesBackupOptions{
+		IncludeSecrets: true,
+		IncludeCRDs:    true,
+		BackupVolumes:  true,
+		KubeletRootDir: "/var/lib/kubelet",
+	}
+}
+
+// Validate checks the options for invalid namespaces and hooks.
+func (o *KubernetesBackupOptions) Validate() error {
+	for _, ns := range append(append([]string{}, o.Namespaces...), o.ExcludeNamespaces...) {
+		if !kubernetesNamePattern.MatchString(ns) {
+			return fmt.Errorf("invalid namespace %q", ns)
+		}
+	}
+	for i, h := range o.Hooks {
+		if h.Name == "" {
+			return fmt.Errorf("hook %d: name is required", i)
+		}
+		if h.Phase != KubernetesHookPre && h.Phase != KubernetesHookPost {
+			return fmt.Errorf("hook %s: phase must be pre or post", h.Name)
+		}
+		if h.LabelSelector == "" {
+			return fmt.Errorf("hook %s: label_selector is required", h.Name)
+		}
+		switch h.Action {
+		case KubernetesHookExec:
+			if len(h.Command) == 0 {
+				return fmt.Errorf("hook %s: command is required for exec hooks", h.Name)
+			}
+		case KubernetesHookScaleDown:
+			if h.Phase != KubernetesHookPre {
+				return fmt.Errorf("hook %s: scale_down hooks run in the pre phase", h.Name)
+			}
+		default:
+			return fmt.Errorf("hook %s: action must be exec or scale_down", h.Name)
+		}
+		if h.TimeoutSeconds < 0 || h.TimeoutSeconds > 3600 {
+			return fmt.Errorf("hook %s: timeout_seconds must be between 0 and 3600", h.Name)
+		}
+	}
+	return nil
+}
+
+// KubernetesRestoreStatus represents the current status of a Kubernetes restore.
+type KubernetesRestoreStatus string
+
+const (
+	// KubernetesRestoreStatusPending indicates the restore is queued.
+	KubernetesRestoreStatusPending KubernetesRestoreStatus = "pending"
+	// KubernetesRestoreStatusRunning indicates the restore is applying resources.
+	KubernetesRestoreStatusRunning KubernetesRestoreStatus = "running"
+	// KubernetesRestoreStatusCompleted indicates the restore completed.
+	KubernetesRestoreStatusCompleted KubernetesRestoreStatus = "completed"
+	// KubernetesRestoreStatusFailed indicates the restore failed.
+	KubernetesRestoreStatusFailed KubernetesRestoreStatus = "failed"
+)
+
+// KubernetesRestoreResult summarizes what a Kubernetes restore applied.
+type KubernetesRestoreResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+	Volumes int `json:"volumes_restored"`
+	// PendingVolumes are PVCs whose data could not be written because no
+	// pod mounting them runs on the restoring node.
+	PendingVolumes []string `json:"pending_volumes,omitempty"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// KubernetesRestore is a restore of namespaces from a Kubernetes backup
+// snapshot into the same or another cluster.
+type KubernetesRestore struct {
+	ID           uuid.UUID `json:"id"`
+	OrgID        uuid.UUID `json:"org_id"`
+	RepositoryID uuid.UUID `json:"repository_id"`
+	SnapshotID   string    `json:"snapshot_id"`
+	// Namespaces limits the restore; empty restores every namespace in the snapshot.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceMapping renames namespaces, source to target.
+	NamespaceMapping map[string]string `json:"namespace_mapping,omitempty"`
+	// NameMapping renames resources, source to target, within every namespace.
+	NameMapping map[string]string `json:"name_mapping,omitempty"`
+	// TargetServer is the API server restored to; empty means the cluster
+	// of AgentID.
+	TargetServer string `json:"target_server,omitempty"`
+	// AgentID is the in-cluster agent that runs a restore into its own
+	// cluster, through the agent command CommandID.
+	AgentID        *uuid.UUID               `json:"agent_id,omitempty"`
+	CommandID      *uuid.UUID               `json:"command_id,omitempty"`
+	Overwrite      bool                     `json:"overwrite"`
+	RestoreVolumes bool                     `json:"restore_volumes"`
+	Status         KubernetesRestoreStatus  `json:"status"`
+	Result         *KubernetesRestoreResult `json:"result,omitempty"`
+	ErrorMessage   string                   `json:"error_message,omitempty"`
+	StartedAt      *time.Time               `json:"started_at,omitempty"`
+	CompletedAt    *time.Time               `json:"completed_at,omitempty"`
+	CreatedBy      *uuid.UUID               `json:"created_by,omitempty"`
+	CreatedAt      time.Time                `json:"created_at"`
+	UpdatedAt      time.Time                `json:"updated_at"`
+}
+
+// NewKubernetesRestore creates a pending Kubernetes restore.
+func NewKubernetesRestore(orgID, repositoryID uuid.UUID, snapshotID string) *KubernetesRestore {
+	now := time.Now()
+	return &KubernetesRestore{
+		ID:           uuid.New(),
+		OrgID:        orgID,
+		RepositoryID: repositoryID,
+		SnapshotID:   snapshotID,
+		Status:       KubernetesRestoreStatusPending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+}
+
+// Validate checks namespaces and mappings for invalid names.
+func (r *KubernetesRestore) Validate() error {
+	for _, ns := range r.Namespaces {
+		if !kubernetesNamePattern.MatchString(ns) {
+			return fmt.Errorf("invalid namespace %q", ns)
+		}
+	}
+	for from, to := range r.NamespaceMapping {
+		if !kubernetesNamePattern.MatchString(from) || !kubernetesNamePattern.MatchString(to) {
+			return fmt.Errorf("invalid namespace mapping %q -> %q", from, to)
+		}
+	}
+	for from, to := range r.NameMapping {
+		if from == "" || to == "" {
+			return errors.New("name mapping entries must not be empty")
+		}
+	}
+	return nil
+}
+
+// Start marks the restore as running.
+func (r *KubernetesRestore) Start() {
+	now := time.Now()
+	r.Status = KubernetesRestoreStatusRunning
+	r.StartedAt = &now
+	r.UpdatedAt = now
+}
+
+// Complete marks the restore as completed with its result.
+func (r *KubernetesRestore) Complete(result *KubernetesRestoreResult) {
+	now := time.Now()
+	r.Status = KubernetesRestoreStatusCompleted
+	r.Result = result
+	r.CompletedAt = &now
+	r.UpdatedAt = now
+}
+
+// Fail marks the restore as failed.
+func (r *KubernetesRestore) Fail(errMsg string) {
+	now := time.Now()
+	r.Status = KubernetesRestoreStatusFailed
+	r.ErrorMessage = errMsg
+	r.CompletedAt = &now
+	r.UpdatedAt = now
+}
+
+// IsTerminal reports whether the restore has completed or failed.
+func (r *KubernetesRestore) IsTerminal() bool {
+	return r.Status == KubernetesRestoreStatusCompleted || r.Status == KubernetesRestoreStatusFailed
+}
+
+// ApplyCommand updates an agent-run restore from the state of its agent
+// command and reports whether the restore changed.
+func (r *KubernetesRestore) ApplyCommand(cmd *AgentCommand) bool {
+	if r.IsTerminal() {
+		return false
+	}
+	switch cmd.Status {
+	case CommandStatusAcknowledged, CommandStatusRunning:
+		if r.Status == KubernetesRestoreStatusRunning {
+			return false
+		}
+		r.Start()
+	case CommandStatusCompleted:
+		var result *KubernetesRestoreResult
+		if cmd.Result != nil {
+			result = cmd.Result.KubernetesRestore
+		}
+		if result == nil {
+			result = &KubernetesRestoreResult{}
+		}
+		r.Complete(result)
+	case CommandStatusFailed, CommandStatusTimedOut, CommandStatusCanceled:
+		msg := "agent command " + string(cmd.Status)
+		if cmd.Result != nil && cmd.Result.Error != "" {
+			msg = cmd.Result.Error
+		}
+		r.Fail(msg)
+	default:
+		return false
+	}
+	return true
+}
+
+// ResultJSON returns the result as JSON for database storage.
+func (r *KubernetesRestore) ResultJSON() ([]byte, error) {
+	if r.Result == nil {
+		return nil, nil
+	}
+	return json.Marshal(r.Result)
+}
+
+// SetResultFromJSON sets the result from JSON data.
+func (r *KubernetesRestore) SetResultFromJSON(data []byte) error {
+	if len(data) == 0 {
+		r.Result = nil
+		return nil
+	}
+	var result KubernetesRestoreResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	r.Result = &result
+	return nil
+}
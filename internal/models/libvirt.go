@@ -0,0 +1,312 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultLibvirtURI is the libvirt connection used when none is configured.
+const DefaultLibvirtURI = "qemu:///system"
+
+// DefaultLibvirtImagesDir is the directory libvirt restores write disk
+// images to when no other directory is configured.
+const DefaultLibvirtImagesDir = "/var/lib/libvirt/images"
+
+// libvirtURIs are the libvirt connections Keldris accepts. virsh runs on the
+// agent of the KVM host, so only its local QEMU daemons are allowed: remote
+// transports such as qemu+ssh would connect from that host to any other, and
+// qemu+ext runs the program named in the URI's query.
+var libvirtURIs = map[string]bool{
+	"qemu:///system":  true,
+	"qemu:///session": true,
+}
+
+// libvirtDomainNamePattern matches the domain names Keldris accepts. libvirt
+// itself is more permissive, but names are passed to virsh as arguments.
+var libvirtDomainNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.+:@-]{0,254}$`)
+
+// ValidLibvirtURI reports whether uri is one of the allowed local libvirt
+// connections.
+func ValidLibvirtURI(uri string) bool {
+	return libvirtURIs[uri]
+}
+
+// LibvirtPathWithin reports whether path is dir or lies below it. Both must
+// be absolute; the check is lexical, so callers resolve symlinks first.
+func LibvirtPathWithin(dir, path string) bool {
+	if !filepath.IsAbs(dir) || !filepath.IsAbs(path) {
+		return false
+	}
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// LibvirtInfo contains information about a libvirt host discovered by its agent.
+type LibvirtInfo struct {
+	Available    bool                `json:"available"`
+	URI          string              `json:"uri"`
+	Hostname     string              `json:"hostname,omitempty"`
+	Version      string              `json:"version,omitempty"`
+	DomainCount  int                 `json:"domain_count"`
+	RunningCount int                 `json:"running_count"`
+	Domains      []LibvirtDomainInfo `json:"domains,omitempty"`
+	DetectedAt   *time.Time          `json:"detected_at,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// LibvirtDomainInfo represents basic information about a libvirt domain.
+type LibvirtDomainInfo struct {
+	Name       string            `json:"name"`
+	UUID       string            `json:"uuid"`
+	State      string            `json:"state"` // running, shut off, paused, ...
+	Persistent bool              `json:"persistent"`
+	VCPUs      int               `json:"vcpus"`
+	MemoryKiB  int64             `json:"memory_kib"`
+	Disks      []LibvirtDiskInfo `json:"disks,omitempty"`
+}
+
+// LibvirtDiskInfo describes a disk attached to a libvirt domain.
+type LibvirtDiskInfo struct {
+	Target string `json:"target"` // vda, sdb, ...
+	Device string `json:"device"` // disk, cdrom, floppy
+	Type   string `json:"type"`   // file, block, network, volume
+	Format string `json:"format,omitempty"`
+	Source string `json:"source,omitempty"`
+	// BackingFiles lists the backing chain below Source, top first.
+	BackingFiles []string `json:"backing_files,omitempty"`
+}
+
+// LibvirtBackupOptions contains libvirt-specific backup configuration.
+type LibvirtBackupOptions struct {
+	// URI is the libvirt connection on the schedule's agent, qemu:///system
+	// (the default) or qemu:///session. Disk images must be readable by the
+	// agent at the paths libvirt reports.
+	URI string `json:"uri,omitempty"`
+	// Domains to back up; empty means every domain except ExcludeDomains.
+	Domains        []string `json:"domains,omitempty"`
+	ExcludeDomains []string `json:"exclude_domains,omitempty"`
+	// Quiesce freezes guest filesystems through the QEMU guest agent while
+	// the disk snapshot is taken.
+	Quiesce bool `json:"quiesce"`
+	// SkipShutoff skips domains that are not running.
+	SkipShutoff bool `json:"skip_shutoff"`
+}
+
+// DefaultLibvirtOptions returns a sensible default libvirt backup configuration.
+func DefaultLibvirtOptions() *LibvirtBackupOptions {
+	return &LibvirtBackupOptions{
+		URI: DefaultLibvirtURI,
+	}
+}
+
+// ConnectionURI returns the configured URI or the default.
+func (o *LibvirtBackupOptions) ConnectionURI() string {
+	if o.URI == "" {
+		return DefaultLibvirtURI
+	}
+	return o.URI
+}
+
+// Validate checks the connection URI and domain names.
+func (o *LibvirtBackupOptions) Validate() error {
+	if o.URI != "" && !ValidLibvirtURI(o.URI) {
+		return fmt.Errorf("invalid libvirt URI %q: must be qemu:///system or qemu:///session", o.URI)
+	}
+	for _, name := range append(append([]string{}, o.Domains...), o.ExcludeDomains...) {
+		if !libvirtDomainNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid domain name %q", name)
+		}
+	}
+	return nil
+}
+
+// LibvirtRestoreStatus represents the current status of a libvirt restore.
+type LibvirtRestoreStatus string
+
+const (
+	// LibvirtRestoreStatusPending indicates the restore is queued.
+	LibvirtRestoreStatusPending LibvirtRestoreStatus = "pending"
+	// LibvirtRestoreStatusRunning indicates disk images are being restored.
+	LibvirtRestoreStatusRunning LibvirtRestoreStatus = "running"
+	// LibvirtRestoreStatusCompleted indicates the domain was redefined.
+	LibvirtRestoreStatusCompleted LibvirtRestoreStatus = "completed"
+	// LibvirtRestoreStatusFailed indicates the restore failed.
+	LibvirtRestoreStatusFailed LibvirtRestoreStatus = "failed"
+)
+
+// LibvirtRestoreResult summarizes a libvirt restore.
+type LibvirtRestoreResult struct {
+	Domain   string   `json:"domain"`
+	Disks    []string `json:"disks,omitempty"`
+	Started  bool     `json:"started"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// LibvirtRestore is a restore of a libvirt domain's disk images and
+// definition from a libvirt backup snapshot.
+type LibvirtRestore struct {
+	ID           uuid.UUID `json:"id"`
+	OrgID        uuid.UUID `json:"org_id"`
+	RepositoryID uuid.UUID `json:"repository_id"`
+	SnapshotID   string    `json:"snapshot_id"`
+	// AgentID is the agent of the KVM host the domain is restored on.
+	AgentID *uuid.UUID `json:"agent_id,omitempty"`
+	// CommandID is the agent command that runs the restore.
+	CommandID *uuid.UUID `json:"command_id,omitempty"`
+	// URI is the libvirt connection on the agent the domain is defined on;
+	// empty means qemu:///system.
+	URI string `json:"uri,omitempty"`
+	// Domain is the domain in the snapshot; it may be empty when the
+	// snapshot holds a single domain.
+	Domain string `json:"domain,omitempty"`
+	// NewName defines the domain under another name with a fresh UUID and
+	// MAC addresses, so it can run next to the original.
+	NewName string `json:"new_name,omitempty"`
+	// TargetDir restores disk images into this directory instead of their
+	// original paths. Both must be inside the agent's libvirt images
+	// directory.
+	TargetDir string `json:"target_dir,omitempty"`
+	// Overwrite replaces existing images and the shut off domain the
+	// snapshot was taken from. Other domains are never replaced.
+	Overwrite    bool                  `json:"overwrite"`
+	StartDomain  bool                  `json:"start"`
+	Status       LibvirtRestoreStatus  `json:"status"`
+	Result       *LibvirtRestoreResult `json:"result,omitempty"`
+	ErrorMessage string                `json:"error_message,omitempty"`
+	StartedAt    *time.Time            `json:"started_at,omitempty"`
+	CompletedAt  *time.Time            `json:"completed_at,omitempty"`
+	CreatedBy    *uuid.UUID            `json:"created_by,omitempty"`
+	CreatedAt    time.Time             `json:"created_at"`
+	UpdatedAt    time.Time             `json:"updated_at"`
+}
+
+// NewLibvirtRestore creates a pending libvirt restore.
+func NewLibvirtRestore(orgID, repositoryID uuid.UUID, snapshotID string) *LibvirtRestore {
+	now := time.Now()
+	return &LibvirtRestore{
+		ID:           uuid.New(),
+		OrgID:        orgID,
+		RepositoryID: repositoryID,
+		SnapshotID:   snapshotID,
+		Status:       LibvirtRestoreStatusPending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+}
+
+// ConnectionURI returns the configured URI or the default.
+func (r *LibvirtRestore) ConnectionURI() string {
+	if r.URI == "" {
+		return DefaultLibvirtURI
+	}
+	return r.URI
+}
+
+// Validate checks the URI, domain names and target directory.
+func (r *LibvirtRestore) Validate() error {
+	if r.URI != "" && !ValidLibvirtURI(r.URI) {
+		return fmt.Errorf("invalid libvirt URI %q: must be qemu:///system or qemu:///session", r.URI)
+	}
+	if r.Domain != "" && !libvirtDomainNamePattern.MatchString(r.Domain) {
+		return fmt.Errorf("invalid domain name %q", r.Domain)
+	}
+	if r.NewName != "" && !libvirtDomainNamePattern.MatchString(r.NewName) {
+		return fmt.Errorf("invalid domain name %q", r.NewName)
+	}
+	if r.TargetDir != "" && (!filepath.IsAbs(r.TargetDir) || filepath.Clean(r.TargetDir) == "/") {
+		return fmt.Errorf("target_dir must be an absolute directory other than /")
+	}
+	return nil
+}
+
+// Start marks the restore as running.
+func (r *LibvirtRestore) Start() {
+	now := time.Now()
+	r.Status = LibvirtRestoreStatusRunning
+	r.StartedAt = &now
+	r.UpdatedAt = now
+}
+
+// Complete marks the restore as completed with its result.
+func (r *LibvirtRestore) Complete(result *LibvirtRestoreResult) {
+	now := time.Now()
+	r.Status = LibvirtRestoreStatusCompleted
+	r.Result = result
+	r.CompletedAt = &now
+	r.UpdatedAt = now
+}
+
+// Fail marks the restore as failed.
+func (r *LibvirtRestore) Fail(errMsg string) {
+	now := time.Now()
+	r.Status = LibvirtRestoreStatusFailed
+	r.ErrorMessage = errMsg
+	r.CompletedAt = &now
+	r.UpdatedAt = now
+}
+
+// IsTerminal reports whether the restore has completed or failed.
+func (r *LibvirtRestore) IsTerminal() bool {
+	return r.Status == LibvirtRestoreStatusCompleted || r.Status == LibvirtRestoreStatusFailed
+}
+
+// ApplyCommand updates the restore from the state of its agent command and
+// reports whether the restore changed.
+func (r *LibvirtRestore) ApplyCommand(cmd *AgentCommand) bool {
+	if r.IsTerminal() {
+		return false
+	}
+	switch cmd.Status {
+	case CommandStatusAcknowledged, CommandStatusRunning:
+		if r.Status == LibvirtRestoreStatusRunning {
+			return false
+		}
+		r.Start()
+	case CommandStatusCompleted:
+		var result *LibvirtRestoreResult
+		if cmd.Result != nil {
+			result = cmd.Result.LibvirtRestore
+		}
+		if result == nil {
+			result = &LibvirtRestoreResult{}
+		}
+		r.Complete(result)
+	case CommandStatusFailed, CommandStatusTimedOut, CommandStatusCanceled:
+		msg := "agent command " + string(cmd.Status)
+		if cmd.Result != nil && cmd.Result.Error != "" {
+			msg = cmd.Result.Error
+		}
+		r.Fail(msg)
+	default:
+		return false
+	}
+	return true
+}
+
+// ResultJSON returns the result as JSON for database storage.
+func (r *LibvirtRestore) ResultJSON() ([]byte, error) {
+	if r.Result == nil {
+		return nil, nil
+	}
+	return json.Marshal(r.Result)
+}
+
+// SetResultFromJSON sets the result from JSON data.
+func (r *LibvirtRestore) SetResultFromJSON(data []byte) error {
+	if len(data) == 0 {
+		r.Result = nil
+		return nil
+	}
+	var result LibvirtRestoreResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	r.Result = &result
+	return nil
+}
@@ -101,6 +101,11 @@ type DashboardStats struct {
 	// Ransomware alerts (displayed prominently)
 	RansomwareAlertsActive   int `json:"ransomware_alerts_active"`
 	RansomwareAlertsCritical int `json:"ransomware_alerts_critical"`
+
+	// 3-2-1 backup compliance from the latest evaluation
+	ComplianceScore              int `json:"compliance_score"`
+	ComplianceSchedulesCompliant int `json:"compliance_schedules_compliant"`
+	ComplianceSchedulesTotal     int `json:"compliance_schedules_total"`
 }
 
 // BackupSuccessRate represents backup success rate for a time period.
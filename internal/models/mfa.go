@@ -0,0 +1,133 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MFAFactorType is the kind of second factor a user has enrolled.
+type MFAFactorType string
+
+const (
+	// MFAFactorTOTP is a time-based one-time password authenticator app.
+	MFAFactorTOTP MFAFactorType = "totp"
+	// MFAFactorWebAuthn is a WebAuthn security key or passkey.
+	MFAFactorWebAuthn MFAFactorType = "webauthn"
+)
+
+// MFA methods accepted when completing a login or step-up challenge.
+const (
+	MFAMethodTOTP         = "totp"
+	MFAMethodWebAuthn     = "webauthn"
+	MFAMethodRecoveryCode = "recovery_code"
+	MFAMethodPassword     = "password"
+)
+
+// UserMFAFactor is an enrolled second factor for a local user account.
+// TOTP factors carry an encrypted shared secret; WebAuthn factors carry
+// the credential ID and public key registered by the authenticator.
+type UserMFAFactor struct {
+	ID              uuid.UUID     `json:"id"`
+	UserID          uuid.UUID     `json:"user_id"`
+	Type            MFAFactorType `json:"type"`
+	Name            string        `json:"name"`
+	SecretEncrypted []byte        `json:"-"`
+	CredentialID    []byte        `json:"-"`
+	PublicKey       []byte        `json:"-"`
+	Algorithm       int           `json:"-"`
+	SignCount       uint32        `json:"-"`
+	ConfirmedAt     *time.Time    `json:"confirmed_at,omitempty"`
+	LastUsedAt      *time.Time    `json:"last_used_at,omitempty"`
+	CreatedAt       time.Time     `json:"created_at"`
+}
+
+// NewTOTPFactor creates an unconfirmed TOTP factor with an encrypted secret.
+func NewTOTPFactor(userID uuid.UUID, name string, secretEncrypted []byte) *UserMFAFactor {
+	return &UserMFAFactor{
+		ID:              uuid.New(),
+		UserID:          userID,
+		Type:            MFAFactorTOTP,
+		Name:            name,
+		SecretEncrypted: secretEncrypted,
+		CreatedAt:       time.Now(),
+	}
+}
+
+// NewWebAuthnFactor creates a confirmed WebAuthn factor from a verified registration.
+func NewWebAuthnFactor(userID uuid.UUID, name string, credentialID, publicKey []byte, algorithm int, signCount uint32) *UserMFAFactor {
+	now := time.Now()
+	return &UserMFAFactor{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Type:         MFAFactorWebAuthn,
+		Name:         name,
+		CredentialID: credentialID,
+		PublicKey:    publicKey,
+		Algorithm:    algorithm,
+		SignCount:    signCount,
+		ConfirmedAt:  &now,
+		CreatedAt:    now,
+	}
+}
+
+// IsConfirmed returns true if the factor has completed enrollment.
+func (f *UserMFAFactor) IsConfirmed() bool {
+	return f.ConfirmedAt != nil
+}
+
+// MFAStatusResponse describes a user's second-factor enrollment.
+type MFAStatusResponse struct {
+	Enabled                bool             `json:"enabled"`
+	Factors                []*UserMFAFactor `json:"factors"`
+	RecoveryCodesRemaining int              `json:"recovery_codes_remaining"`
+	EnrollmentRequired     bool             `json:"enrollment_required"`
+	EnrollmentDeadline     *time.Time       `json:"enrollment_deadline,omitempty"`
+}
+
+// TOTPEnrollRequest starts TOTP enrollment.
+type TOTPEnrollRequest struct {
+	Name string `json:"name" binding:"max=100"`
+}
+
+// TOTPEnrollResponse contains the secret to load into an authenticator app.
+type TOTPEnrollResponse struct {
+	FactorID        uuid.UUID `json:"factor_id"`
+	Secret          string    `json:"secret"`
+	ProvisioningURI string    `json:"provisioning_uri"`
+}
+
+// TOTPConfirmRequest confirms TOTP enrollment with a code from the app.
+type TOTPConfirmRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// WebAuthnRegisterFinishRequest completes a WebAuthn registration ceremony.
+// Binary fields are base64url encoded as produced by the browser.
+type WebAuthnRegisterFinishRequest struct {
+	Name              string `json:"name" binding:"max=100"`
+	ClientDataJSON    string `json:"client_data_json" binding:"required"`
+	AttestationObject string `json:"attestation_object" binding:"required"`
+}
+
+// WebAuthnAssertion is a WebAuthn authentication ceremony response.
+// Binary fields are base64url encoded as produced by the browser.
+type WebAuthnAssertion struct {
+	CredentialID      string `json:"credential_id" binding:"required"`
+	ClientDataJSON    string `json:"client_data_json" binding:"required"`
+	AuthenticatorData string `json:"authenticator_data" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+}
+
+// MFAVerifyRequest completes an MFA login or step-up challenge.
+type MFAVerifyRequest struct {
+	Method   string             `json:"method" binding:"required"`
+	Code     string             `json:"code,omitempty"`
+	Password string             `json:"password,omitempty"`
+	WebAuthn *WebAuthnAssertion `json:"webauthn,omitempty"`
+}
+
+// RecoveryCodesResponse returns freshly generated recovery codes. They are shown once.
+type RecoveryCodesResponse struct {
+	Codes []string `json:"codes"`
+}
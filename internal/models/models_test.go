@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -1213,3 +1214,168 @@ func TestNewTag_DefaultColor(t *testing.T) {
 		t.Errorf("expected default Color '#6366f1', got %s", tag.Color)
 	}
 }
+
+func TestProxmoxRestore_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(r *ProxmoxRestore)
+		wantErr string
+	}{
+		{"valid", func(r *ProxmoxRestore) {}, ""},
+		{"health check with start", func(r *ProxmoxRestore) { r.StartGuest, r.HealthCheck = true, true }, ""},
+		{"missing upload storage", func(r *ProxmoxRestore) { r.UploadStorage = "" }, "upload storage"},
+		{"invalid node", func(r *ProxmoxRestore) { r.TargetNode = "pve/../x" }, "target node"},
+		{"reserved vmid", func(r *ProxmoxRestore) { r.NewVMID = 99 }, "new_vmid"},
+		{"health check without start", func(r *ProxmoxRestore) { r.HealthCheck = true }, "requires start"},
+		{"health timeout too long", func(r *ProxmoxRestore) { r.HealthTimeoutSeconds = 7200 }, "health_timeout_seconds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewProxmoxRestore(uuid.New(), uuid.New(), uuid.New(), "abcd1234", "local")
+			tt.modify(r)
+			err := r.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDatabaseRestore_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(r *DatabaseRestore)
+		wantErr string
+	}{
+		{"valid", func(r *DatabaseRestore) {}, ""},
+		{"filename and database", func(r *DatabaseRestore) { r.Filename, r.Database = "postgres_app.dump", "app" }, ""},
+		{"missing snapshot", func(r *DatabaseRestore) { r.SnapshotID = "" }, "snapshot_id"},
+		{"filename with directory", func(r *DatabaseRestore) { r.Filename = "dumps/app.sql" }, "filename"},
+		{"hidden filename", func(r *DatabaseRestore) { r.Filename = ".." }, "filename"},
+		{"database option", func(r *DatabaseRestore) { r.Database = "--execute=DROP" }, "database"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewDatabaseRestore(uuid.New(), uuid.New(), uuid.New(), "abcd1234")
+			tt.modify(r)
+			err := r.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLibvirtBackupOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    LibvirtBackupOptions
+		wantErr bool
+	}{
+		{"defaults", *DefaultLibvirtOptions(), false},
+		{"empty uri", LibvirtBackupOptions{Domains: []string{"web-01", "db.lan"}}, false},
+		{"session uri", LibvirtBackupOptions{URI: "qemu:///session"}, false},
+		{"ssh uri", LibvirtBackupOptions{URI: "qemu+ssh://root@kvm1/system"}, true},
+		{"ext uri", LibvirtBackupOptions{URI: "qemu+ext:///system?command=/tmp/x"}, true},
+		{"query on local uri", LibvirtBackupOptions{URI: "qemu:///system?no_verify=1"}, true},
+		{"invalid uri", LibvirtBackupOptions{URI: "system"}, true},
+		{"option-like domain", LibvirtBackupOptions{Domains: []string{"--all"}}, true},
+		{"domain with slash", LibvirtBackupOptions{ExcludeDomains: []string{"a/b"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLibvirtPathWithin(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/var/lib/libvirt/images", true},
+		{"/var/lib/libvirt/images/web.qcow2", true},
+		{"/var/lib/libvirt/images/dr/web.qcow2", true},
+		{"/var/lib/libvirt/images/../qemu/nvram", false},
+		{"/var/lib/libvirt/images-old/web.qcow2", false},
+		{"/etc/shadow", false},
+		{"images/web.qcow2", false},
+	}
+	for _, tt := range tests {
+		if got := LibvirtPathWithin("/var/lib/libvirt/images/", tt.path); got != tt.want {
+			t.Errorf("LibvirtPathWithin(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLibvirtRestore_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(r *LibvirtRestore)
+		wantErr string
+	}{
+		{"valid", func(r *LibvirtRestore) {}, ""},
+		{"renamed clone", func(r *LibvirtRestore) { r.NewName, r.TargetDir = "web-dr", "/var/lib/libvirt/dr" }, ""},
+		{"invalid uri", func(r *LibvirtRestore) { r.URI = "qemu system" }, "URI"},
+		{"remote uri", func(r *LibvirtRestore) { r.URI = "qemu+ssh://root@kvm1/system" }, "URI"},
+		{"invalid new name", func(r *LibvirtRestore) { r.NewName = "-x" }, "domain name"},
+		{"relative target dir", func(r *LibvirtRestore) { r.TargetDir = "images" }, "target_dir"},
+		{"root target dir", func(r *LibvirtRestore) { r.TargetDir = "/" }, "target_dir"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewLibvirtRestore(uuid.New(), uuid.New(), "abcd1234")
+			tt.modify(r)
+			err := r.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchedule_PostgresConfigJSON(t *testing.T) {
+	s := &Schedule{PostgresConfig: &PostgresBackupConfig{
+		Host:              "db.internal",
+		Username:          "backup",
+		PasswordEncrypted: "ciphertext",
+		Database:          "app",
+	}}
+
+	data, err := s.PostgresConfigJSON()
+	if err != nil {
+		t.Fatalf("PostgresConfigJSON() error = %v", err)
+	}
+
+	var loaded Schedule
+	if err := loaded.SetPostgresConfig(data); err != nil {
+		t.Fatalf("SetPostgresConfig() error = %v", err)
+	}
+	if loaded.PostgresConfig.PasswordEncrypted != "ciphertext" {
+		t.Errorf("PasswordEncrypted = %q, want the stored ciphertext", loaded.PostgresConfig.PasswordEncrypted)
+	}
+	if loaded.PostgresConfig.Host != "db.internal" || loaded.PostgresConfig.Database != "app" {
+		t.Errorf("PostgresConfig = %+v, want host and database kept", loaded.PostgresConfig)
+	}
+}
@@ -28,6 +28,7 @@ const (
 	EventMaintenanceScheduled NotificationEventType = "maintenance_scheduled"
 	EventTestRestoreFailed    NotificationEventType = "test_restore_failed"
 	EventValidationFailed     NotificationEventType = "validation_failed"
+	EventApprovalRequested    NotificationEventType = "approval_requested"
 )
 
 // NotificationStatus represents the status of a notification
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PBSConnection represents a Proxmox Backup Server API connection. It is
+// used both as a source whose snapshots are pulled into restic and as a
+// managed backup target whose verification and retention are run from
+// Keldris.
+type PBSConnection struct {
+	ID                   uuid.UUID `json:"id"`
+	OrgID                uuid.UUID `json:"org_id"`
+	Name                 string    `json:"name"`
+	Host                 string    `json:"host"`
+	Port                 int       `json:"port"`
+	Username             string    `json:"username"`
+	TokenID              string    `json:"token_id,omitempty"`
+	TokenSecretEncrypted []byte    `json:"-"` // Never expose in JSON
+	Fingerprint          string    `json:"fingerprint,omitempty"`
+	VerifySSL            bool      `json:"verify_ssl"`
+	// Datastore and Namespace are the defaults for pulls, verification
+	// and pruning when a request does not name them.
+	Datastore string `json:"datastore"`
+	Namespace string `json:"namespace,omitempty"`
+	// Retention is applied to every backup group in the datastore
+	// namespace when the connection is pruned.
+	Retention *RetentionPolicy `json:"retention,omitempty"`
+	// VerifyOutdatedDays re-verifies snapshots whose last successful
+	// verification is older than this many days (0 = verify only new ones).
+	VerifyOutdatedDays int        `json:"verify_outdated_days,omitempty"`
+	Enabled            bool       `json:"enabled"`
+	LastConnectedAt    *time.Time `json:"last_connected_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// NewPBSConnection creates a new PBSConnection with the given details.
+func NewPBSConnection(orgID uuid.UUID, name, host string, port int, username, datastore string) *PBSConnection {
+	now := time.Now()
+	return &PBSConnection{
+		ID:        uuid.New(),
+		OrgID:     orgID,
+		Name:      name,
+		Host:      host,
+		Port:      port,
+		Username:  username,
+		Datastore: datastore,
+		VerifySSL: true,
+		Enabled:   true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// SetTokenAuth sets API token authentication credentials.
+func (c *PBSConnection) SetTokenAuth(tokenID string, tokenSecretEncrypted []byte) {
+	c.TokenID = tokenID
+	c.TokenSecretEncrypted = tokenSecretEncrypted
+}
+
+// HasTokenAuth returns true if token authentication is configured.
+func (c *PBSConnection) HasTokenAuth() bool {
+	return c.TokenID != "" && len(c.TokenSecretEncrypted) > 0
+}
+
+// GetAPIURL returns the base URL for the PBS API.
+func (c *PBSConnection) GetAPIURL() string {
+	return fmt.Sprintf("https://%s:%d/api2/json", c.Host, c.Port)
+}
+
+// MarkConnected updates the last connected timestamp.
+func (c *PBSConnection) MarkConnected() {
+	now := time.Now()
+	c.LastConnectedAt = &now
+	c.UpdatedAt = now
+}
+
+// SetRetention sets the retention policy from JSON bytes.
+func (c *PBSConnection) SetRetention(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	var policy RetentionPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return err
+	}
+	c.Retention = &policy
+	return nil
+}
+
+// RetentionJSON returns the retention policy as JSON bytes for database storage.
+func (c *PBSConnection) RetentionJSON() ([]byte, error) {
+	if c.Retention == nil {
+		return nil, nil
+	}
+	return json.Marshal(c.Retention)
+}
+
+// Proxmox backup sources.
+const (
+	// ProxmoxSourceVzdump runs vzdump on Proxmox VE and stores the archive.
+	ProxmoxSourceVzdump = "vzdump"
+	// ProxmoxSourcePBS pulls existing snapshots from Proxmox Backup Server.
+	ProxmoxSourcePBS = "pbs"
+)
+
+// PBSPullOptions selects the Proxmox Backup Server snapshots a schedule
+// pulls into restic. Snapshots pulled by an earlier run are skipped.
+type PBSPullOptions struct {
+	// ConnectionID is the ID of the PBS connection to pull from.
+	ConnectionID string `json:"connection_id"`
+	// Datastore overrides the connection's datastore.
+	Datastore string `json:"datastore,omitempty"`
+	// Namespace overrides the connection's namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// BackupType limits the pull to vm, ct or host backups.
+	BackupType string `json:"backup_type,omitempty"`
+	// BackupIDs limits the pull to these guests or hosts (empty means all).
+	BackupIDs []string `json:"backup_ids,omitempty"`
+	// LatestOnly pulls only the newest snapshot of each group.
+	LatestOnly bool `json:"latest_only,omitempty"`
+	// VerifiedOnly skips snapshots that have not passed verification.
+	VerifiedOnly bool `json:"verified_only,omitempty"`
+}
+
+// Validate checks the backup source and, for PBS pulls, the snapshot
+// selection.
+func (o *ProxmoxBackupOptions) Validate() error {
+	switch o.Source {
+	case "", ProxmoxSourceVzdump:
+		return nil
+	case ProxmoxSourcePBS:
+	default:
+		return fmt.Errorf("invalid Proxmox source %q: must be vzdump or pbs", o.Source)
+	}
+
+	if o.PBS == nil || o.PBS.ConnectionID == "" {
+		return errors.New("pbs.connection_id is required for PBS backups")
+	}
+	if _, err := uuid.Parse(o.PBS.ConnectionID); err != nil {
+		return fmt.Errorf("invalid pbs.connection_id: %w", err)
+	}
+	switch o.PBS.BackupType {
+	case "", "vm", "ct", "host":
+	default:
+		return fmt.Errorf("invalid pbs.backup_type %q: must be vm, ct or host", o.PBS.BackupType)
+	}
+	if len(o.PBS.BackupIDs) > 0 && o.PBS.BackupType == "" {
+		return errors.New("pbs.backup_ids requires pbs.backup_type")
+	}
+	return nil
+}
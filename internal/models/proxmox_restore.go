@@ -0,0 +1,212 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// proxmoxIDPattern matches Proxmox storage and node identifiers.
+var proxmoxIDPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9._-]*$`)
+
+// DefaultProxmoxHealthTimeout is how long a restored guest has to come up
+// when a health check is requested without a timeout.
+const DefaultProxmoxHealthTimeout = 5 * time.Minute
+
+// ProxmoxRestoreStatus represents the current status of a Proxmox restore.
+type ProxmoxRestoreStatus string
+
+const (
+	// ProxmoxRestoreStatusPending indicates the restore is queued.
+	ProxmoxRestoreStatusPending ProxmoxRestoreStatus = "pending"
+	// ProxmoxRestoreStatusRunning indicates the restore is in progress.
+	ProxmoxRestoreStatusRunning ProxmoxRestoreStatus = "running"
+	// ProxmoxRestoreStatusCompleted indicates the restore completed.
+	ProxmoxRestoreStatusCompleted ProxmoxRestoreStatus = "completed"
+	// ProxmoxRestoreStatusFailed indicates the restore failed.
+	ProxmoxRestoreStatusFailed ProxmoxRestoreStatus = "failed"
+)
+
+// ProxmoxRestorePhase is the step a running Proxmox restore is at.
+type ProxmoxRestorePhase string
+
+const (
+	// ProxmoxRestorePhaseUpload streams the archive from restic to the node.
+	ProxmoxRestorePhaseUpload ProxmoxRestorePhase = "upload"
+	// ProxmoxRestorePhaseRestore runs qmrestore or pct restore.
+	ProxmoxRestorePhaseRestore ProxmoxRestorePhase = "restore"
+	// ProxmoxRestorePhaseStart boots the restored guest.
+	ProxmoxRestorePhaseStart ProxmoxRestorePhase = "start"
+	// ProxmoxRestorePhaseHealthCheck waits for the guest to come up.
+	ProxmoxRestorePhaseHealthCheck ProxmoxRestorePhase = "health_check"
+)
+
+// ProxmoxRestoreResult summarizes a Proxmox restore.
+type ProxmoxRestoreResult struct {
+	// Archive is the path of the vzdump archive in the snapshot.
+	Archive     string `json:"archive"`
+	ArchiveSize int64  `json:"archive_size"`
+	GuestType   string `json:"guest_type"` // qemu or lxc
+	SourceVMID  int    `json:"source_vmid"`
+	VMID        int    `json:"vmid"`
+	Node        string `json:"node"`
+	RestoreUPID string `json:"restore_upid,omitempty"`
+	Started     bool   `json:"started"`
+	// GuestStatus and AgentResponding report the health check.
+	GuestStatus     string   `json:"guest_status,omitempty"`
+	AgentResponding bool     `json:"agent_responding,omitempty"`
+	Healthy         bool     `json:"healthy"`
+	Warnings        []string `json:"warnings,omitempty"`
+}
+
+// ProxmoxRestore is a restore of a vzdump archive from a restic snapshot
+// back into a Proxmox VE cluster.
+type ProxmoxRestore struct {
+	ID           uuid.UUID `json:"id"`
+	OrgID        uuid.UUID `json:"org_id"`
+	ConnectionID uuid.UUID `json:"connection_id"`
+	RepositoryID uuid.UUID `json:"repository_id"`
+	SnapshotID   string    `json:"snapshot_id"`
+	// Archive is the vzdump archive in the snapshot; empty picks the only
+	// archive of SourceVMID, or the only archive in the snapshot.
+	Archive    string `json:"archive,omitempty"`
+	SourceVMID int    `json:"source_vmid,omitempty"`
+	// TargetNode defaults to the connection's node.
+	TargetNode string `json:"target_node,omitempty"`
+	// TargetStorage receives the restored disks; empty keeps the storages
+	// recorded in the archive.
+	TargetStorage string `json:"target_storage,omitempty"`
+	// UploadStorage holds the archive during the restore and must allow
+	// backup content.
+	UploadStorage string `json:"upload_storage"`
+	// NewVMID is the VMID to restore to; zero uses the next free VMID.
+	NewVMID              int                   `json:"new_vmid,omitempty"`
+	Overwrite            bool                  `json:"overwrite"`
+	Unique               bool                  `json:"unique"`
+	StartGuest           bool                  `json:"start"`
+	HealthCheck          bool                  `json:"health_check"`
+	HealthTimeoutSeconds int                   `json:"health_timeout_seconds,omitempty"`
+	Status               ProxmoxRestoreStatus  `json:"status"`
+	Phase                ProxmoxRestorePhase   `json:"phase,omitempty"`
+	TaskUPID             string                `json:"task_upid,omitempty"`
+	Result               *ProxmoxRestoreResult `json:"result,omitempty"`
+	ErrorMessage         string                `json:"error_message,omitempty"`
+	StartedAt            *time.Time            `json:"started_at,omitempty"`
+	CompletedAt          *time.Time            `json:"completed_at,omitempty"`
+	CreatedBy            *uuid.UUID            `json:"created_by,omitempty"`
+	CreatedAt            time.Time             `json:"created_at"`
+	UpdatedAt            time.Time             `json:"updated_at"`
+}
+
+// NewProxmoxRestore creates a pending Proxmox restore.
+func NewProxmoxRestore(orgID, connectionID, repositoryID uuid.UUID, snapshotID, uploadStorage string) *ProxmoxRestore {
+	now := time.Now()
+	return &ProxmoxRestore{
+		ID:            uuid.New(),
+		OrgID:         orgID,
+		ConnectionID:  connectionID,
+		RepositoryID:  repositoryID,
+		SnapshotID:    snapshotID,
+		UploadStorage: uploadStorage,
+		Status:        ProxmoxRestoreStatusPending,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+// Validate checks the target and health check settings.
+func (r *ProxmoxRestore) Validate() error {
+	if r.SnapshotID == "" {
+		return errors.New("snapshot_id is required")
+	}
+	if !proxmoxIDPattern.MatchString(r.UploadStorage) {
+		return fmt.Errorf("invalid upload storage %q", r.UploadStorage)
+	}
+	if r.TargetStorage != "" && !proxmoxIDPattern.MatchString(r.TargetStorage) {
+		return fmt.Errorf("invalid target storage %q", r.TargetStorage)
+	}
+	if r.TargetNode != "" && !proxmoxIDPattern.MatchString(r.TargetNode) {
+		return fmt.Errorf("invalid target node %q", r.TargetNode)
+	}
+	if r.SourceVMID < 0 {
+		return errors.New("source_vmid must not be negative")
+	}
+	if r.NewVMID != 0 && (r.NewVMID < 100 || r.NewVMID > 999999999) {
+		return errors.New("new_vmid must be between 100 and 999999999")
+	}
+	if r.HealthCheck && !r.StartGuest {
+		return errors.New("health_check requires start")
+	}
+	if r.HealthTimeoutSeconds < 0 || r.HealthTimeoutSeconds > 3600 {
+		return errors.New("health_timeout_seconds must be between 0 and 3600")
+	}
+	return nil
+}
+
+// HealthTimeout returns how long the restored guest has to pass its health check.
+func (r *ProxmoxRestore) HealthTimeout() time.Duration {
+	if r.HealthTimeoutSeconds == 0 {
+		return DefaultProxmoxHealthTimeout
+	}
+	return time.Duration(r.HealthTimeoutSeconds) * time.Second
+}
+
+// Start marks the restore as running.
+func (r *ProxmoxRestore) Start() {
+	now := time.Now()
+	r.Status = ProxmoxRestoreStatusRunning
+	r.StartedAt = &now
+	r.UpdatedAt = now
+}
+
+// SetPhase records the step the restore is at and the Proxmox task
+// running it, if any.
+func (r *ProxmoxRestore) SetPhase(phase ProxmoxRestorePhase, upid string) {
+	r.Phase = phase
+	r.TaskUPID = upid
+	r.UpdatedAt = time.Now()
+}
+
+// Complete marks the restore as completed with its result.
+func (r *ProxmoxRestore) Complete(result *ProxmoxRestoreResult) {
+	now := time.Now()
+	r.Status = ProxmoxRestoreStatusCompleted
+	r.Result = result
+	r.CompletedAt = &now
+	r.UpdatedAt = now
+}
+
+// Fail marks the restore as failed.
+func (r *ProxmoxRestore) Fail(errMsg string) {
+	now := time.Now()
+	r.Status = ProxmoxRestoreStatusFailed
+	r.ErrorMessage = errMsg
+	r.CompletedAt = &now
+	r.UpdatedAt = now
+}
+
+// ResultJSON returns the result as JSON for database storage.
+func (r *ProxmoxRestore) ResultJSON() ([]byte, error) {
+	if r.Result == nil {
+		return nil, nil
+	}
+	return json.Marshal(r.Result)
+}
+
+// SetResultFromJSON sets the result from JSON data.
+func (r *ProxmoxRestore) SetResultFromJSON(data []byte) error {
+	if len(data) == 0 {
+		r.Result = nil
+		return nil
+	}
+	var result ProxmoxRestoreResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	r.Result = &result
+	return nil
+}
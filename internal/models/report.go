@@ -106,6 +106,8 @@ type ReportData struct {
 	AgentSummary   AgentSummary   `json:"agent_summary"`
 	AlertSummary   AlertSummary   `json:"alert_summary"`
 	TopIssues      []ReportIssue  `json:"top_issues,omitempty"`
+	// Compliance is the latest 3-2-1 evaluation; nil if it could not be loaded.
+	Compliance *BackupComplianceSummary `json:"compliance,omitempty"`
 }
 
 // BackupSummary contains backup statistics for the report period.
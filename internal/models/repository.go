@@ -27,6 +27,8 @@ const (
 	RepositoryTypeAzure RepositoryType = "azure"
 	// RepositoryTypeGCS is a Google Cloud Storage repository.
 	RepositoryTypeGCS RepositoryType = "gcs"
+	// RepositoryTypeRclone is a repository on any rclone-supported remote.
+	RepositoryTypeRclone RepositoryType = "rclone"
 )
 
 // Repository represents a backup storage destination.
@@ -35,7 +37,8 @@ type Repository struct {
 	OrgID           uuid.UUID              `json:"org_id"`
 	Name            string                 `json:"name"`
 	Type            RepositoryType         `json:"type"`
-	ConfigEncrypted []byte                 `json:"-"` // Encrypted, never expose in JSON
+	ConfigEncrypted []byte                 `json:"-"`         // Encrypted, never expose in JSON
+	ReadOnly        bool                   `json:"read_only"` // Kept for restores after a migration; no new backups
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
 	CreatedAt       time.Time              `json:"created_at"`
 	UpdatedAt       time.Time              `json:"updated_at"`
@@ -66,6 +69,7 @@ func ValidRepositoryTypes() []RepositoryType {
 		RepositoryTypeDropbox,
 		RepositoryTypeAzure,
 		RepositoryTypeGCS,
+		RepositoryTypeRclone,
 	}
 }
 
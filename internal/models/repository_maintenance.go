@@ -0,0 +1,241 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RepositoryMaintenancePolicy configures automatic restic maintenance of a
+// repository: upgrading it to format version 2, compressing old packs and
+// pruning unused data.
+type RepositoryMaintenancePolicy struct {
+	ID           uuid.UUID `json:"id"`
+	OrgID        uuid.UUID `json:"org_id"`
+	RepositoryID uuid.UUID `json:"repository_id"`
+	Enabled      bool      `json:"enabled"`
+	// UpgradeRepository runs "restic migrate upgrade_repo_v2" on version 1
+	// repositories so new data is compressed.
+	UpgradeRepository bool `json:"upgrade_repository"`
+	// RepackUncompressed compresses packs written before the upgrade.
+	RepackUncompressed bool   `json:"repack_uncompressed"`
+	MaxUnused          string `json:"max_unused"`
+	MaxRepackSize      string `json:"max_repack_size,omitempty"`
+	// MinReclaimBytes skips a prune that would free less than this.
+	MinReclaimBytes int64 `json:"min_reclaim_bytes"`
+	IntervalHours   int   `json:"interval_hours"`
+	// RequireMaintenanceWindow only runs scheduled maintenance while one of
+	// the organization's maintenance windows is active.
+	RequireMaintenanceWindow bool `json:"require_maintenance_window"`
+	// StorageClass is the backend storage class holding the packs, such as
+	// STANDARD_IA, COLDLINE or Cool. It determines early-deletion fees.
+	StorageClass string     `json:"storage_class,omitempty"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// NewRepositoryMaintenancePolicy creates a policy with the default settings:
+// weekly, inside maintenance windows, upgrading and compressing old data.
+func NewRepositoryMaintenancePolicy(orgID, repositoryID uuid.UUID) *RepositoryMaintenancePolicy {
+	now := time.Now()
+	return &RepositoryMaintenancePolicy{
+		ID:                       uuid.New(),
+		OrgID:                    orgID,
+		RepositoryID:             repositoryID,
+		Enabled:                  true,
+		UpgradeRepository:        true,
+		RepackUncompressed:       true,
+		MaxUnused:                "5%",
+		IntervalHours:            168,
+		RequireMaintenanceWindow: true,
+		CreatedAt:                now,
+		UpdatedAt:                now,
+	}
+}
+
+// IsDue returns true if the policy has not run within its interval.
+func (p *RepositoryMaintenancePolicy) IsDue(now time.Time) bool {
+	if !p.Enabled {
+		return false
+	}
+	if p.LastRunAt == nil {
+		return true
+	}
+	return now.Sub(*p.LastRunAt) >= time.Duration(p.IntervalHours)*time.Hour
+}
+
+// StorageClassProfile describes the cost characteristics of a storage class.
+type StorageClassProfile struct {
+	Tier StorageTierType `json:"tier"`
+	// MinStorageDays is the minimum billed storage duration. Objects deleted
+	// earlier are charged for the remaining days.
+	MinStorageDays int `json:"min_storage_days"`
+}
+
+// storageClassProfiles maps backend storage classes to their tier and minimum
+// storage duration, per repository type.
+var storageClassProfiles = map[RepositoryType]map[string]StorageClassProfile{
+	RepositoryTypeS3: {
+		"STANDARD":            {Tier: StorageTierHot},
+		"INTELLIGENT_TIERING": {Tier: StorageTierWarm},
+		"STANDARD_IA":         {Tier: StorageTierWarm, MinStorageDays: 30},
+		"ONEZONE_IA":          {Tier: StorageTierWarm, MinStorageDays: 30},
+		"GLACIER_IR":          {Tier: StorageTierCold, MinStorageDays: 90},
+		"GLACIER":             {Tier: StorageTierArchive, MinStorageDays: 90},
+		"DEEP_ARCHIVE":        {Tier: StorageTierArchive, MinStorageDays: 180},
+	},
+	RepositoryTypeGCS: {
+		"STANDARD": {Tier: StorageTierHot},
+		"NEARLINE": {Tier: StorageTierWarm, MinStorageDays: 30},
+		"COLDLINE": {Tier: StorageTierCold, MinStorageDays: 90},
+		"ARCHIVE":  {Tier: StorageTierArchive, MinStorageDays: 365},
+	},
+	RepositoryTypeAzure: {
+		"HOT":     {Tier: StorageTierHot},
+		"COOL":    {Tier: StorageTierWarm, MinStorageDays: 30},
+		"COLD":    {Tier: StorageTierCold, MinStorageDays: 90},
+		"ARCHIVE": {Tier: StorageTierArchive, MinStorageDays: 180},
+	},
+}
+
+// StorageClassProfileFor returns the profile of a repository's storage class.
+// Unknown classes and backends are treated as hot storage without a minimum
+// storage duration.
+func StorageClassProfileFor(repoType RepositoryType, storageClass string) StorageClassProfile {
+	if profile, ok := storageClassProfiles[repoType][strings.ToUpper(storageClass)]; ok {
+		return profile
+	}
+	return StorageClassProfile{Tier: StorageTierHot}
+}
+
+// RepositoryMaintenancePlan is what a maintenance run would do, based on a
+// prune dry run.
+type RepositoryMaintenancePlan struct {
+	RepositoryID       uuid.UUID `json:"repository_id"`
+	RepositoryVersion  int       `json:"repository_version"`
+	Upgrade            bool      `json:"upgrade"`
+	Prune              bool      `json:"prune"`
+	RepackUncompressed bool      `json:"repack_uncompressed"`
+	// MaxUnused is the --max-unused value prune will run with. Archive tiers
+	// use "unlimited" so packs are only deleted, never read back to repack.
+	MaxUnused    string              `json:"max_unused,omitempty"`
+	StorageClass StorageClassProfile `json:"storage_class"`
+	// EstimatedReclaimBytes is the space prune would free.
+	EstimatedReclaimBytes int64 `json:"estimated_reclaim_bytes"`
+	// EstimatedRepackBytes is the data prune would rewrite.
+	EstimatedRepackBytes int64 `json:"estimated_repack_bytes"`
+	// EstimatedEarlyDeletionCost is the fee for deleting packs before the
+	// storage class's minimum storage duration, in the tier's currency.
+	EstimatedEarlyDeletionCost float64 `json:"estimated_early_deletion_cost"`
+	// EstimatedMonthlySavings is the storage cost of the reclaimed data.
+	EstimatedMonthlySavings float64          `json:"estimated_monthly_savings"`
+	SkipReasons             []string         `json:"skip_reasons,omitempty"`
+	Stats                   *RepoStatsRecord `json:"stats,omitempty"`
+	PlannedAt               time.Time        `json:"planned_at"`
+}
+
+// HasWork returns true if the plan upgrades or prunes the repository.
+func (p *RepositoryMaintenancePlan) HasWork() bool {
+	return p.Upgrade || p.Prune
+}
+
+// RepoStatsRecord is a point-in-time copy of a repository's raw-data stats.
+type RepoStatsRecord struct {
+	TotalSize             int64   `json:"total_size"`
+	TotalUncompressedSize int64   `json:"total_uncompressed_size"`
+	CompressionRatio      float64 `json:"compression_ratio"`
+	CompressionProgress   float64 `json:"compression_progress"`
+	BlobCount             int     `json:"blob_count"`
+	SnapshotCount         int     `json:"snapshot_count"`
+}
+
+// RepositoryMaintenanceRunStatus is the state of a maintenance run.
+type RepositoryMaintenanceRunStatus string
+
+const (
+	// RepositoryMaintenanceRunStatusRunning is in progress.
+	RepositoryMaintenanceRunStatusRunning RepositoryMaintenanceRunStatus = "running"
+	// RepositoryMaintenanceRunStatusCompleted finished successfully.
+	RepositoryMaintenanceRunStatusCompleted RepositoryMaintenanceRunStatus = "completed"
+	// RepositoryMaintenanceRunStatusSkipped had nothing worth doing.
+	RepositoryMaintenanceRunStatusSkipped RepositoryMaintenanceRunStatus = "skipped"
+	// RepositoryMaintenanceRunStatusFailed stopped with an error.
+	RepositoryMaintenanceRunStatusFailed RepositoryMaintenanceRunStatus = "failed"
+)
+
+// Repository maintenance actions recorded on a run.
+const (
+	MaintenanceActionUpgrade            = "upgrade_repo_v2"
+	MaintenanceActionPrune              = "prune"
+	MaintenanceActionRepackUncompressed = "repack_uncompressed"
+	MaintenanceActionCheck              = "check"
+)
+
+// RepositoryMaintenanceRun records one maintenance run and the repository
+// stats before and after it.
+type RepositoryMaintenanceRun struct {
+	ID                         uuid.UUID                      `json:"id"`
+	OrgID                      uuid.UUID                      `json:"org_id"`
+	RepositoryID               uuid.UUID                      `json:"repository_id"`
+	Trigger                    string                         `json:"trigger"`
+	Status                     RepositoryMaintenanceRunStatus `json:"status"`
+	Actions                    []string                       `json:"actions"`
+	SkipReasons                []string                       `json:"skip_reasons,omitempty"`
+	RepositoryVersionBefore    int                            `json:"repository_version_before"`
+	RepositoryVersionAfter     int                            `json:"repository_version_after"`
+	EstimatedReclaimBytes      int64                          `json:"estimated_reclaim_bytes"`
+	EstimatedEarlyDeletionCost float64                        `json:"estimated_early_deletion_cost"`
+	StatsBefore                *RepoStatsRecord               `json:"stats_before,omitempty"`
+	StatsAfter                 *RepoStatsRecord               `json:"stats_after,omitempty"`
+	ErrorMessage               string                         `json:"error_message,omitempty"`
+	StartedAt                  time.Time                      `json:"started_at"`
+	CompletedAt                *time.Time                     `json:"completed_at,omitempty"`
+}
+
+// NewRepositoryMaintenanceRun creates a running maintenance run.
+func NewRepositoryMaintenanceRun(orgID, repositoryID uuid.UUID, trigger string) *RepositoryMaintenanceRun {
+	return &RepositoryMaintenanceRun{
+		ID:           uuid.New(),
+		OrgID:        orgID,
+		RepositoryID: repositoryID,
+		Trigger:      trigger,
+		Status:       RepositoryMaintenanceRunStatusRunning,
+		Actions:      []string{},
+		StartedAt:    time.Now(),
+	}
+}
+
+// ReclaimedBytes returns how much the repository shrank during the run.
+func (r *RepositoryMaintenanceRun) ReclaimedBytes() int64 {
+	if r.StatsBefore == nil || r.StatsAfter == nil {
+		return 0
+	}
+	return r.StatsBefore.TotalSize - r.StatsAfter.TotalSize
+}
+
+// Finish marks the run with its final status.
+func (r *RepositoryMaintenanceRun) Finish(status RepositoryMaintenanceRunStatus, errMsg string) {
+	now := time.Now()
+	r.Status = status
+	r.ErrorMessage = errMsg
+	r.CompletedAt = &now
+}
+
+// ActionsJSON returns the actions as JSON for database storage.
+func (r *RepositoryMaintenanceRun) ActionsJSON() ([]byte, error) {
+	if r.Actions == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(r.Actions)
+}
+
+// SkipReasonsJSON returns the skip reasons as JSON for database storage.
+func (r *RepositoryMaintenanceRun) SkipReasonsJSON() ([]byte, error) {
+	if r.SkipReasons == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(r.SkipReasons)
+}
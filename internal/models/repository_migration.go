@@ -0,0 +1,159 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RepositoryMigrationStatus is the phase of a repository migration.
+type RepositoryMigrationStatus string
+
+const (
+	// RepositoryMigrationStatusPending is waiting to start.
+	RepositoryMigrationStatusPending RepositoryMigrationStatus = "pending"
+	// RepositoryMigrationStatusInitializing is creating the target repository.
+	RepositoryMigrationStatusInitializing RepositoryMigrationStatus = "initializing"
+	// RepositoryMigrationStatusCopying is copying snapshots to the target.
+	RepositoryMigrationStatusCopying RepositoryMigrationStatus = "copying"
+	// RepositoryMigrationStatusVerifying is checking the target repository.
+	RepositoryMigrationStatusVerifying RepositoryMigrationStatus = "verifying"
+	// RepositoryMigrationStatusCompleted has repointed everything to the target.
+	RepositoryMigrationStatusCompleted RepositoryMigrationStatus = "completed"
+	// RepositoryMigrationStatusFailed stopped with an error and can be resumed.
+	RepositoryMigrationStatusFailed RepositoryMigrationStatus = "failed"
+)
+
+// RepositoryMigration moves a repository's snapshots to a repository on a
+// different backend and repoints everything that used the source.
+type RepositoryMigration struct {
+	ID                   uuid.UUID                 `json:"id"`
+	OrgID                uuid.UUID                 `json:"org_id"`
+	SourceRepositoryID   *uuid.UUID                `json:"source_repository_id,omitempty"`
+	TargetRepositoryID   *uuid.UUID                `json:"target_repository_id,omitempty"`
+	SourceRepositoryName string                    `json:"source_repository_name"`
+	TargetRepositoryName string                    `json:"target_repository_name"`
+	Status               RepositoryMigrationStatus `json:"status"`
+	TotalSnapshots       int                       `json:"total_snapshots"`
+	CopiedSnapshotIDs    []string                  `json:"copied_snapshot_ids"`
+	CurrentSnapshotID    string                    `json:"current_snapshot_id,omitempty"`
+	ReadDataSubset       string                    `json:"read_data_subset,omitempty"`
+	SchedulesRepointed   int                       `json:"schedules_repointed"`
+	GeoConfigsRepointed  int                       `json:"geo_configs_repointed"`
+	ErrorMessage         string                    `json:"error_message,omitempty"`
+	StartedBy            *uuid.UUID                `json:"started_by,omitempty"`
+	StartedAt            *time.Time                `json:"started_at,omitempty"`
+	CompletedAt          *time.Time                `json:"completed_at,omitempty"`
+	CreatedAt            time.Time                 `json:"created_at"`
+	UpdatedAt            time.Time                 `json:"updated_at"`
+}
+
+// NewRepositoryMigration creates a pending migration from source to target.
+func NewRepositoryMigration(orgID uuid.UUID, source, target *Repository, startedBy *uuid.UUID) *RepositoryMigration {
+	now := time.Now()
+	return &RepositoryMigration{
+		ID:                   uuid.New(),
+		OrgID:                orgID,
+		SourceRepositoryID:   &source.ID,
+		TargetRepositoryID:   &target.ID,
+		SourceRepositoryName: source.Name,
+		TargetRepositoryName: target.Name,
+		Status:               RepositoryMigrationStatusPending,
+		CopiedSnapshotIDs:    []string{},
+		StartedBy:            startedBy,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}
+}
+
+// IsActive returns true while the migration is running.
+func (m *RepositoryMigration) IsActive() bool {
+	switch m.Status {
+	case RepositoryMigrationStatusInitializing, RepositoryMigrationStatusCopying, RepositoryMigrationStatusVerifying:
+		return true
+	}
+	return false
+}
+
+// CanResume returns true if the migration can be (re)started.
+func (m *RepositoryMigration) CanResume() bool {
+	return m.Status == RepositoryMigrationStatusPending || m.Status == RepositoryMigrationStatusFailed
+}
+
+// IsCopied returns true if the source snapshot has already been copied.
+func (m *RepositoryMigration) IsCopied(snapshotID string) bool {
+	for _, id := range m.CopiedSnapshotIDs {
+		if id == snapshotID {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkCopied records a copied source snapshot.
+func (m *RepositoryMigration) MarkCopied(snapshotID string) {
+	if !m.IsCopied(snapshotID) {
+		m.CopiedSnapshotIDs = append(m.CopiedSnapshotIDs, snapshotID)
+	}
+	m.CurrentSnapshotID = ""
+}
+
+// ProgressPercent returns the share of snapshots copied so far.
+func (m *RepositoryMigration) ProgressPercent() float64 {
+	if m.TotalSnapshots == 0 {
+		if m.Status == RepositoryMigrationStatusCompleted {
+			return 100
+		}
+		return 0
+	}
+	return float64(len(m.CopiedSnapshotIDs)) / float64(m.TotalSnapshots) * 100
+}
+
+// Start moves the migration into the given running phase.
+func (m *RepositoryMigration) Start(status RepositoryMigrationStatus) {
+	now := time.Now()
+	if m.StartedAt == nil {
+		m.StartedAt = &now
+	}
+	m.Status = status
+	m.ErrorMessage = ""
+}
+
+// Fail marks the migration as failed with the given error.
+func (m *RepositoryMigration) Fail(errMsg string) {
+	m.Status = RepositoryMigrationStatusFailed
+	m.ErrorMessage = errMsg
+	m.CurrentSnapshotID = ""
+}
+
+// Complete marks the migration as completed.
+func (m *RepositoryMigration) Complete() {
+	now := time.Now()
+	m.Status = RepositoryMigrationStatusCompleted
+	m.CompletedAt = &now
+	m.CurrentSnapshotID = ""
+}
+
+// CopiedSnapshotIDsJSON returns the copied snapshot IDs as JSON for database storage.
+func (m *RepositoryMigration) CopiedSnapshotIDsJSON() ([]byte, error) {
+	if m.CopiedSnapshotIDs == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(m.CopiedSnapshotIDs)
+}
+
+// SetCopiedSnapshotIDs sets the copied snapshot IDs from JSON bytes.
+func (m *RepositoryMigration) SetCopiedSnapshotIDs(data []byte) error {
+	m.CopiedSnapshotIDs = []string{}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, &m.CopiedSnapshotIDs)
+}
+
+// RepositoryRepointResult reports what was moved to the target repository.
+type RepositoryRepointResult struct {
+	Schedules  int `json:"schedules"`
+	GeoConfigs int `json:"geo_configs"`
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// storageClassPattern matches S3 storage class names such as "STANDARD_IA".
+var storageClassPattern = regexp.MustCompile(`^[A-Z][A-Z_]{1,31}$`)
+
+// tuningBackendOptions lists the restic -o options transfer settings may set,
+// with a check for their values. Options that name a program or pass
+// arguments to one, such as sftp.command or rclone.program, are left out
+// because they would run commands on the host.
+var tuningBackendOptions = map[string]func(string) bool{
+	"s3.storage-class":   storageClassPattern.MatchString,
+	"s3.bucket-lookup":   oneOf("auto", "dns", "path"),
+	"s3.list-objects-v1": isBool,
+	"azure.access-tier":  oneOf("Hot", "Cool", "Cold"),
+	"rclone.timeout":     isPositiveDuration,
+}
+
+func oneOf(values ...string) func(string) bool {
+	return func(v string) bool {
+		for _, allowed := range values {
+			if v == allowed {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func isBool(v string) bool {
+	_, err := strconv.ParseBool(v)
+	return err == nil
+}
+
+func isPositiveDuration(v string) bool {
+	d, err := time.ParseDuration(v)
+	return err == nil && d > 0
+}
+
+// ValidateBackendOption checks that a restic -o option is one of the
+// supported tuning options and that its value is accepted.
+func ValidateBackendOption(key, value string) error {
+	if strings.HasSuffix(key, ".connections") {
+		return errors.New("set connections with the connections field")
+	}
+	valid, ok := tuningBackendOptions[key]
+	if !ok {
+		return fmt.Errorf("unsupported backend option %q", key)
+	}
+	if !valid(value) {
+		return fmt.Errorf("invalid value for backend option %q", key)
+	}
+	return nil
+}
+
+// RepositoryTransferSettings tunes how restic talks to a repository's backend.
+// Nil fields keep restic's defaults.
+type RepositoryTransferSettings struct {
+	ID           uuid.UUID `json:"id"`
+	OrgID        uuid.UUID `json:"org_id"`
+	RepositoryID uuid.UUID `json:"repository_id"`
+	// UploadLimitKB is the default --limit-upload in KiB/s. A schedule's
+	// bandwidth limit takes precedence.
+	UploadLimitKB *int `json:"upload_limit_kb,omitempty"`
+	// DownloadLimitKB is --limit-download in KiB/s.
+	DownloadLimitKB *int `json:"download_limit_kb,omitempty"`
+	// Connections is the backend's "<backend>.connections" option.
+	Connections *int `json:"connections,omitempty"`
+	// PackSizeMB is --pack-size in MiB.
+	PackSizeMB *int `json:"pack_size_mb,omitempty"`
+	// ReadConcurrency is backup --read-concurrency, the number of files read in parallel.
+	ReadConcurrency *int `json:"read_concurrency,omitempty"`
+	// BackendOptions are extra -o tuning options, e.g. {"s3.storage-class": "STANDARD_IA"}.
+	// Only the options accepted by ValidateBackendOption are allowed. Options
+	// for a different backend than the repository's are ignored.
+	BackendOptions map[string]string `json:"backend_options,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// NewRepositoryTransferSettings creates transfer settings that keep restic's defaults.
+func NewRepositoryTransferSettings(orgID, repositoryID uuid.UUID) *RepositoryTransferSettings {
+	now := time.Now()
+	return &RepositoryTransferSettings{
+		ID:           uuid.New(),
+		OrgID:        orgID,
+		RepositoryID: repositoryID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+}
+
+// Validate checks the settings against restic's accepted ranges.
+func (s *RepositoryTransferSettings) Validate() error {
+	checks := []struct {
+		name     string
+		value    *int
+		min, max int
+	}{
+		{"upload_limit_kb", s.UploadLimitKB, 1, 10_000_000},
+		{"download_limit_kb", s.DownloadLimitKB, 1, 10_000_000},
+		{"connections", s.Connections, 1, 128},
+		{"pack_size_mb", s.PackSizeMB, 4, 128},
+		{"read_concurrency", s.ReadConcurrency, 1, 64},
+	}
+	for _, c := range checks {
+		if c.value != nil && (*c.value < c.min || *c.value > c.max) {
+			return fmt.Errorf("%s must be between %d and %d", c.name, c.min, c.max)
+		}
+	}
+	for key, value := range s.BackendOptions {
+		if err := ValidateBackendOption(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackupTransferMetrics records how a backup run used the repository backend,
+// as reported by restic.
+type BackupTransferMetrics struct {
+	ID           uuid.UUID  `json:"id"`
+	OrgID        uuid.UUID  `json:"org_id"`
+	RepositoryID uuid.UUID  `json:"repository_id"`
+	BackupID     uuid.UUID  `json:"backup_id"`
+	AgentID      *uuid.UUID `json:"agent_id,omitempty"`
+	// BytesProcessed is the size of all files restic read.
+	BytesProcessed int64 `json:"bytes_processed"`
+	// BytesUploaded is the data written to the backend after deduplication.
+	BytesUploaded int64 `json:"bytes_uploaded"`
+	DurationMs    int64 `json:"duration_ms"`
+	// OpenDurationMs is the time until restic started reading files, which
+	// covers opening the repository and loading its index from the backend.
+	OpenDurationMs    int64   `json:"open_duration_ms"`
+	UploadBytesPerSec float64 `json:"upload_bytes_per_sec"`
+	// Retries counts backend requests restic retried.
+	Retries     int   `json:"retries"`
+	RetryWaitMs int64 `json:"retry_wait_ms"`
+	// BackendErrors counts failed backend requests, retried or not.
+	BackendErrors int `json:"backend_errors"`
+	// FileErrors counts files restic could not read.
+	FileErrors int       `json:"file_errors"`
+	Failed     bool      `json:"failed"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// RepositoryTransferTrend aggregates a repository's transfer metrics per day.
+type RepositoryTransferTrend struct {
+	Day                  time.Time `json:"day"`
+	Runs                 int       `json:"runs"`
+	FailedRuns           int       `json:"failed_runs"`
+	AvgUploadBytesPerSec float64   `json:"avg_upload_bytes_per_sec"`
+	AvgOpenDurationMs    float64   `json:"avg_open_duration_ms"`
+	MaxOpenDurationMs    int64     `json:"max_open_duration_ms"`
+	Retries              int       `json:"retries"`
+	BackendErrors        int       `json:"backend_errors"`
+	BytesUploaded        int64     `json:"bytes_uploaded"`
+}
@@ -53,6 +53,10 @@ const (
 	BackupTypePostgres BackupType = "postgres"
 	// BackupTypeProxmox backs up Proxmox VMs and containers via vzdump.
 	BackupTypeProxmox BackupType = "proxmox"
+	// BackupTypeKubernetes backs up Kubernetes manifests and PVC data.
+	BackupTypeKubernetes BackupType = "kubernetes"
+	// BackupTypeLibvirt backs up libvirt/KVM domains via external disk snapshots.
+	BackupTypeLibvirt BackupType = "libvirt"
 )
 
 // ValidBackupTypes returns all valid backup types.
@@ -65,6 +69,8 @@ func ValidBackupTypes() []BackupType {
 		BackupTypeMySQL,
 		BackupTypePostgres,
 		BackupTypeProxmox,
+		BackupTypeKubernetes,
+		BackupTypeLibvirt,
 	}
 }
 
@@ -78,6 +84,35 @@ func IsValidBackupType(t BackupType) bool {
 	return false
 }
 
+// FilesystemSnapshotMode controls whether file backups read a filesystem
+// snapshot of their paths instead of the live files.
+type FilesystemSnapshotMode string
+
+const (
+	// FilesystemSnapshotOff reads the live paths.
+	FilesystemSnapshotOff FilesystemSnapshotMode = "off"
+	// FilesystemSnapshotAuto snapshots paths on LVM thin volumes, ZFS
+	// datasets and btrfs subvolumes and reads other paths live.
+	FilesystemSnapshotAuto FilesystemSnapshotMode = "auto"
+	// FilesystemSnapshotRequired fails the backup if a path cannot be
+	// snapshotted.
+	FilesystemSnapshotRequired FilesystemSnapshotMode = "required"
+)
+
+// IsValid checks if the filesystem snapshot mode is valid. Empty means off.
+func (m FilesystemSnapshotMode) IsValid() bool {
+	switch m {
+	case "", FilesystemSnapshotOff, FilesystemSnapshotAuto, FilesystemSnapshotRequired:
+		return true
+	}
+	return false
+}
+
+// Enabled returns true if backups should read from a filesystem snapshot.
+func (m FilesystemSnapshotMode) Enabled() bool {
+	return m == FilesystemSnapshotAuto || m == FilesystemSnapshotRequired
+}
+
 // DockerBackupOptions contains Docker-specific backup configuration.
 type DockerBackupOptions struct {
 	// VolumeIDs specifies which Docker volumes to backup. Empty means all volumes.
@@ -88,6 +123,9 @@ type DockerBackupOptions struct {
 	PauseContainers bool `json:"pause_containers"`
 	// IncludeContainerConfigs backs up container configurations as JSON.
 	IncludeContainerConfigs bool `json:"include_container_configs"`
+	// DatabaseDumps dumps detected database containers from inside the
+	// container and streams each dump into the repository.
+	DatabaseDumps bool `json:"database_dumps,omitempty"`
 }
 
 // PiholeBackupConfig contains Pi-hole specific backup configuration.
@@ -188,6 +226,11 @@ type ProxmoxBackupOptions struct {
 	IncludeRAM bool `json:"include_ram"`
 	// RemoveAfter removes the backup from Proxmox after storing in Restic.
 	RemoveAfter bool `json:"remove_after"`
+	// Source is where backups come from: vzdump (default) or pbs.
+	Source string `json:"source,omitempty"`
+	// PBS selects the snapshots pulled from Proxmox Backup Server when
+	// Source is pbs.
+	PBS *PBSPullOptions `json:"pbs,omitempty"`
 }
 
 // Schedule represents a backup schedule configuration.
@@ -211,6 +254,7 @@ type Schedule struct {
 	OnMountUnavailable   MountBehavior        `json:"on_mount_unavailable,omitempty"` // Behavior when network mount unavailable
 	DockerVolumes        []string             `json:"docker_volumes,omitempty"`        // Docker volume names to back up
 	DockerPauseContainers bool                `json:"docker_pause_containers,omitempty"` // Pause containers during volume backup
+	FilesystemSnapshot    FilesystemSnapshotMode `json:"filesystem_snapshot,omitempty"`   // Read paths from an LVM, ZFS or btrfs snapshot: off, auto, required
 	MaxFileSizeMB           *int                 `json:"max_file_size_mb,omitempty"`     // Max file size in MB (0 = disabled)
 	ClassificationLevel     string               `json:"classification_level,omitempty"` // Data classification level: public, internal, confidential, restricted
 	ClassificationDataTypes []string             `json:"classification_data_types,omitempty"` // Data types: pii, phi, pci, proprietary, general
@@ -226,6 +270,8 @@ type Schedule struct {
 	MySQLConfig             *MySQLBackupConfig     `json:"mysql_config,omitempty"`         // MySQL/MariaDB specific backup configuration
 	PostgresConfig          *PostgresBackupConfig  `json:"postgres_config,omitempty"`      // PostgreSQL specific backup configuration
 	ProxmoxOptions          *ProxmoxBackupOptions  `json:"proxmox_options,omitempty"`      // Proxmox-specific backup options
+	KubernetesOptions       *KubernetesBackupOptions `json:"kubernetes_options,omitempty"` // Kubernetes-specific backup options
+	LibvirtOptions          *LibvirtBackupOptions    `json:"libvirt_options,omitempty"`    // libvirt/KVM-specific backup options
 	Metadata                map[string]interface{} `json:"metadata,omitempty"`
 	RepositoryID     uuid.UUID        `json:"repository_id"`
 }
@@ -332,6 +378,46 @@ func NewProxmoxSchedule(agentID uuid.UUID, name, cronExpr string, opts *ProxmoxB
 	}
 }
 
+// NewKubernetesSchedule creates a new Schedule for Kubernetes workload backups.
+func NewKubernetesSchedule(agentID uuid.UUID, name, cronExpr string, opts *KubernetesBackupOptions) *Schedule {
+	now := time.Now()
+	return &Schedule{
+		ID:                 uuid.New(),
+		AgentID:            agentID,
+		Name:               name,
+		CronExpression:     cronExpr,
+		BackupType:         BackupTypeKubernetes,
+		Paths:              []string{}, // Kubernetes backups discover their own paths
+		KubernetesOptions:  opts,
+		OnMountUnavailable: MountBehaviorFail,
+		Priority:           PriorityMedium,
+		Preemptible:        false,
+		Enabled:            true,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+}
+
+// NewLibvirtSchedule creates a new Schedule for libvirt/KVM domain backups.
+func NewLibvirtSchedule(agentID uuid.UUID, name, cronExpr string, opts *LibvirtBackupOptions) *Schedule {
+	now := time.Now()
+	return &Schedule{
+		ID:                 uuid.New(),
+		AgentID:            agentID,
+		Name:               name,
+		CronExpression:     cronExpr,
+		BackupType:         BackupTypeLibvirt,
+		Paths:              []string{}, // libvirt backups discover their disk images
+		LibvirtOptions:     opts,
+		OnMountUnavailable: MountBehaviorFail,
+		Priority:           PriorityMedium,
+		Preemptible:        false,
+		Enabled:            true,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+}
+
 // IsDockerBackup returns true if this is a Docker backup schedule.
 func (s *Schedule) IsDockerBackup() bool {
 	return s.BackupType == BackupTypeDocker
@@ -352,6 +438,16 @@ func (s *Schedule) IsProxmoxBackup() bool {
 	return s.BackupType == BackupTypeProxmox
 }
 
+// IsKubernetesBackup returns true if this is a Kubernetes backup schedule.
+func (s *Schedule) IsKubernetesBackup() bool {
+	return s.BackupType == BackupTypeKubernetes
+}
+
+// IsLibvirtBackup returns true if this is a libvirt/KVM backup schedule.
+func (s *Schedule) IsLibvirtBackup() bool {
+	return s.BackupType == BackupTypeLibvirt
+}
+
 // SetDockerOptions sets the Docker backup options from JSON bytes.
 func (s *Schedule) SetDockerOptions(data []byte) error {
 	if len(data) == 0 {
@@ -716,20 +812,32 @@ func (s *Schedule) SetPostgresConfig(data []byte) error {
 		s.PostgresConfig = nil
 		return nil
 	}
-	var config PostgresBackupConfig
-	if err := json.Unmarshal(data, &config); err != nil {
+	var stored storedPostgresConfig
+	if err := json.Unmarshal(data, &stored); err != nil {
 		return err
 	}
+	config := stored.PostgresBackupConfig
+	config.PasswordEncrypted = stored.PasswordEncrypted
 	s.PostgresConfig = &config
 	return nil
 }
 
 // PostgresConfigJSON returns the PostgreSQL config as JSON bytes for database storage.
+// Unlike API responses, the stored config keeps the encrypted password.
 func (s *Schedule) PostgresConfigJSON() ([]byte, error) {
 	if s.PostgresConfig == nil {
 		return nil, nil
 	}
-	return json.Marshal(s.PostgresConfig)
+	return json.Marshal(storedPostgresConfig{
+		PostgresBackupConfig: *s.PostgresConfig,
+		PasswordEncrypted:    s.PostgresConfig.PasswordEncrypted,
+	})
+}
+
+// storedPostgresConfig is the stored form of a PostgresBackupConfig.
+type storedPostgresConfig struct {
+	PostgresBackupConfig
+	PasswordEncrypted string `json:"password_encrypted,omitempty"`
 }
 
 // DefaultPostgresConfig returns a sensible default PostgreSQL backup configuration.
@@ -766,6 +874,50 @@ func (s *Schedule) ProxmoxOptionsJSON() ([]byte, error) {
 	return json.Marshal(s.ProxmoxOptions)
 }
 
+// SetKubernetesOptions sets the Kubernetes options from JSON bytes.
+func (s *Schedule) SetKubernetesOptions(data []byte) error {
+	if len(data) == 0 {
+		s.KubernetesOptions = nil
+		return nil
+	}
+	var opts KubernetesBackupOptions
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return err
+	}
+	s.KubernetesOptions = &opts
+	return nil
+}
+
+// KubernetesOptionsJSON returns the Kubernetes options as JSON bytes for database storage.
+func (s *Schedule) KubernetesOptionsJSON() ([]byte, error) {
+	if s.KubernetesOptions == nil {
+		return nil, nil
+	}
+	return json.Marshal(s.KubernetesOptions)
+}
+
+// SetLibvirtOptions sets the libvirt options from JSON bytes.
+func (s *Schedule) SetLibvirtOptions(data []byte) error {
+	if len(data) == 0 {
+		s.LibvirtOptions = nil
+		return nil
+	}
+	var opts LibvirtBackupOptions
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return err
+	}
+	s.LibvirtOptions = &opts
+	return nil
+}
+
+// LibvirtOptionsJSON returns the libvirt options as JSON bytes for database storage.
+func (s *Schedule) LibvirtOptionsJSON() ([]byte, error) {
+	if s.LibvirtOptions == nil {
+		return nil, nil
+	}
+	return json.Marshal(s.LibvirtOptions)
+}
+
 // DefaultProxmoxOptions returns a sensible default Proxmox backup configuration.
 func DefaultProxmoxOptions() *ProxmoxBackupOptions {
 	return &ProxmoxBackupOptions{
@@ -344,3 +344,27 @@ func TestSchedule_ExcludedHoursJSON(t *testing.T) {
 		}
 	})
 }
+
+func TestProxmoxBackupOptions_Validate(t *testing.T) {
+	connID := uuid.New().String()
+	tests := []struct {
+		name    string
+		opts    ProxmoxBackupOptions
+		wantErr bool
+	}{
+		{"vzdump default", ProxmoxBackupOptions{}, false},
+		{"unknown source", ProxmoxBackupOptions{Source: "pbs2"}, true},
+		{"pbs without connection", ProxmoxBackupOptions{Source: ProxmoxSourcePBS}, true},
+		{"pbs invalid connection", ProxmoxBackupOptions{Source: ProxmoxSourcePBS, PBS: &PBSPullOptions{ConnectionID: "x"}}, true},
+		{"pbs invalid type", ProxmoxBackupOptions{Source: ProxmoxSourcePBS, PBS: &PBSPullOptions{ConnectionID: connID, BackupType: "qemu"}}, true},
+		{"pbs ids without type", ProxmoxBackupOptions{Source: ProxmoxSourcePBS, PBS: &PBSPullOptions{ConnectionID: connID, BackupIDs: []string{"100"}}}, true},
+		{"pbs valid", ProxmoxBackupOptions{Source: ProxmoxSourcePBS, PBS: &PBSPullOptions{ConnectionID: connID, BackupType: "vm", BackupIDs: []string{"100"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SCIMToken is a bearer token an identity provider uses to call the SCIM
+// provisioning API for one organization. Only the token hash is stored.
+type SCIMToken struct {
+	ID          uuid.UUID  `json:"id"`
+	OrgID       uuid.UUID  `json:"org_id"`
+	Name        string     `json:"name"`
+	TokenHash   string     `json:"-"`
+	TokenPrefix string     `json:"token_prefix"`
+	CreatedBy   *uuid.UUID `json:"created_by,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// NewSCIMToken creates a new SCIMToken record for a token hash.
+func NewSCIMToken(orgID uuid.UUID, name, tokenHash, tokenPrefix string, createdBy uuid.UUID) *SCIMToken {
+	return &SCIMToken{
+		ID:          uuid.New(),
+		OrgID:       orgID,
+		Name:        name,
+		TokenHash:   tokenHash,
+		TokenPrefix: tokenPrefix,
+		CreatedBy:   &createdBy,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// IsRevoked returns true if the token has been revoked.
+func (t *SCIMToken) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
+
+// CreateSCIMTokenRequest is the request to create a SCIM token.
+type CreateSCIMTokenRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+// CreateSCIMTokenResponse returns the plaintext token once, at creation.
+type CreateSCIMTokenResponse struct {
+	SCIMToken
+	Token string `json:"token"`
+}
+
+// SCIMUser links a Keldris user to the organization that provisions it
+// through SCIM. The Keldris user ID is the SCIM resource ID; Email and Name
+// are stored on the user itself.
+type SCIMUser struct {
+	UserID     uuid.UUID `json:"user_id"`
+	OrgID      uuid.UUID `json:"org_id"`
+	UserName   string    `json:"user_name"`
+	ExternalID string    `json:"external_id,omitempty"`
+	Email      string    `json:"email"`
+	Name       string    `json:"name"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// NewSCIMUser creates a new SCIMUser link for an existing user.
+func NewSCIMUser(orgID uuid.UUID, user *User, userName, externalID string) *SCIMUser {
+	now := time.Now()
+	return &SCIMUser{
+		UserID:     user.ID,
+		OrgID:      orgID,
+		UserName:   userName,
+		ExternalID: externalID,
+		Email:      user.Email,
+		Name:       user.Name,
+		Active:     user.IsActive(),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+}
+
+// SCIMGroup is a group pushed by an organization's identity provider. Its
+// display name is matched against SSO group mappings to derive org roles.
+type SCIMGroup struct {
+	ID          uuid.UUID   `json:"id"`
+	OrgID       uuid.UUID   `json:"org_id"`
+	DisplayName string      `json:"display_name"`
+	ExternalID  string      `json:"external_id,omitempty"`
+	MemberIDs   []uuid.UUID `json:"member_ids"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// NewSCIMGroup creates a new SCIMGroup.
+func NewSCIMGroup(orgID uuid.UUID, displayName, externalID string) *SCIMGroup {
+	now := time.Now()
+	return &SCIMGroup{
+		ID:          uuid.New(),
+		OrgID:       orgID,
+		DisplayName: displayName,
+		ExternalID:  externalID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
@@ -16,21 +16,37 @@ const (
 	S3ObjectLockModeCompliance S3ObjectLockMode = "COMPLIANCE"
 )
 
+// S3ObjectLockStatus is the progress of applying S3 Object Lock retention to
+// a locked snapshot's objects.
+type S3ObjectLockStatus string
+
+const (
+	// S3ObjectLockStatusPending means retention is being applied in the background.
+	S3ObjectLockStatusPending S3ObjectLockStatus = "pending"
+	// S3ObjectLockStatusApplied means every object of the snapshot is retained.
+	S3ObjectLockStatusApplied S3ObjectLockStatus = "applied"
+	// S3ObjectLockStatusFailed means retention could not be applied; see the error.
+	S3ObjectLockStatusFailed S3ObjectLockStatus = "failed"
+)
+
 // SnapshotImmutability represents an immutability lock on a snapshot.
 type SnapshotImmutability struct {
-	ID                  uuid.UUID         `json:"id"`
-	OrgID               uuid.UUID         `json:"org_id"`
-	RepositoryID        uuid.UUID         `json:"repository_id"`
-	SnapshotID          string            `json:"snapshot_id"`
-	ShortID             string            `json:"short_id"`
-	LockedAt            time.Time         `json:"locked_at"`
-	LockedUntil         time.Time         `json:"locked_until"`
-	LockedBy            *uuid.UUID        `json:"locked_by,omitempty"`
-	Reason              string            `json:"reason,omitempty"`
-	S3ObjectLockEnabled bool              `json:"s3_object_lock_enabled"`
-	S3ObjectLockMode    *S3ObjectLockMode `json:"s3_object_lock_mode,omitempty"`
-	CreatedAt           time.Time         `json:"created_at"`
-	UpdatedAt           time.Time         `json:"updated_at"`
+	ID                  uuid.UUID          `json:"id"`
+	OrgID               uuid.UUID          `json:"org_id"`
+	RepositoryID        uuid.UUID          `json:"repository_id"`
+	SnapshotID          string             `json:"snapshot_id"`
+	ShortID             string             `json:"short_id"`
+	LockedAt            time.Time          `json:"locked_at"`
+	LockedUntil         time.Time          `json:"locked_until"`
+	LockedBy            *uuid.UUID         `json:"locked_by,omitempty"`
+	Reason              string             `json:"reason,omitempty"`
+	S3ObjectLockEnabled bool               `json:"s3_object_lock_enabled"`
+	S3ObjectLockMode    *S3ObjectLockMode  `json:"s3_object_lock_mode,omitempty"`
+	S3ObjectLockStatus  S3ObjectLockStatus `json:"s3_object_lock_status,omitempty"`
+	S3ObjectLockError   string             `json:"s3_object_lock_error,omitempty"`
+	S3ObjectLockObjects int                `json:"s3_object_lock_objects,omitempty"`
+	CreatedAt           time.Time          `json:"created_at"`
+	UpdatedAt           time.Time          `json:"updated_at"`
 }
 
 // NewSnapshotImmutability creates a new SnapshotImmutability.
@@ -73,10 +89,28 @@ func (s *SnapshotImmutability) RemainingDays() int {
 	return int(remaining.Hours() / 24)
 }
 
-// SetS3ObjectLock configures S3 Object Lock settings.
+// SetS3ObjectLock configures S3 Object Lock settings. Retention starts out
+// pending until it has been applied to the snapshot's objects.
 func (s *SnapshotImmutability) SetS3ObjectLock(mode S3ObjectLockMode) {
 	s.S3ObjectLockEnabled = true
 	s.S3ObjectLockMode = &mode
+	s.S3ObjectLockStatus = S3ObjectLockStatusPending
+	s.S3ObjectLockError = ""
+	s.UpdatedAt = time.Now()
+}
+
+// CompleteS3ObjectLock records that retention was applied to count objects.
+func (s *SnapshotImmutability) CompleteS3ObjectLock(count int) {
+	s.S3ObjectLockStatus = S3ObjectLockStatusApplied
+	s.S3ObjectLockError = ""
+	s.S3ObjectLockObjects = count
+	s.UpdatedAt = time.Now()
+}
+
+// FailS3ObjectLock records that retention could not be applied.
+func (s *SnapshotImmutability) FailS3ObjectLock(errMsg string) {
+	s.S3ObjectLockStatus = S3ObjectLockStatusFailed
+	s.S3ObjectLockError = errMsg
 	s.UpdatedAt = time.Now()
 }
 
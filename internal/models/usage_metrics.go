@@ -24,6 +24,9 @@ type UsageMetrics struct {
 	// Storage metrics (in bytes)
 	TotalStorageBytes  int64 `json:"total_storage_bytes"`
 	BackupStorageBytes int64 `json:"backup_storage_bytes"`
+	// HostedStorageBytes is the disk used by repositories hosted by the
+	// server's built-in REST endpoint.
+	HostedStorageBytes int64 `json:"hosted_storage_bytes"`
 
 	// Backup counts for the period
 	BackupsCompleted int `json:"backups_completed"`
@@ -226,6 +229,9 @@ type CurrentUsage struct {
 	RepositoryCount  int   `json:"repository_count"`
 	BackupsThisMonth int   `json:"backups_this_month"`
 
+	// HostedStorageBytes is the disk used by server-hosted repositories.
+	HostedStorageBytes int64 `json:"hosted_storage_bytes"`
+
 	// Limits (nil means unlimited)
 	AgentLimit      *int   `json:"agent_limit,omitempty"`
 	UserLimit       *int   `json:"user_limit,omitempty"`
@@ -20,6 +20,7 @@ func TestRepository_IsValidType(t *testing.T) {
 		{"dropbox", RepositoryTypeDropbox, true},
 		{"azure", RepositoryTypeAzure, true},
 		{"gcs", RepositoryTypeGCS, true},
+		{"rclone", RepositoryTypeRclone, true},
 		{"invalid type", RepositoryType("ftp"), false},
 		{"empty type", RepositoryType(""), false},
 	}
@@ -36,8 +37,8 @@ func TestRepository_IsValidType(t *testing.T) {
 
 func TestValidRepositoryTypes(t *testing.T) {
 	types := ValidRepositoryTypes()
-	if len(types) != 8 {
-		t.Errorf("expected 8 valid types, got %d", len(types))
+	if len(types) != 9 {
+		t.Errorf("expected 9 valid types, got %d", len(types))
 	}
 
 	expected := map[RepositoryType]bool{
@@ -49,6 +50,7 @@ func TestValidRepositoryTypes(t *testing.T) {
 		RepositoryTypeDropbox: true,
 		RepositoryTypeAzure:  true,
 		RepositoryTypeGCS:    true,
+		RepositoryTypeRclone: true,
 	}
 	for _, rt := range types {
 		if !expected[rt] {
@@ -2,6 +2,7 @@ package monitoring
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/MacJediWizard/keldris/internal/db"
@@ -162,6 +163,31 @@ func (s *AlertServiceImpl) ResolveAlertsByResource(ctx context.Context, resource
 	return nil
 }
 
+// ResolveAlertByResourceAndType resolves the active alert of one type for a
+// resource, leaving alerts of other types untouched. It is a no-op when no
+// such alert is active.
+func (s *AlertServiceImpl) ResolveAlertByResourceAndType(ctx context.Context, orgID uuid.UUID, resourceType models.ResourceType, resourceID uuid.UUID, alertType models.AlertType) error {
+	alert, err := s.store.GetAlertByResourceAndType(ctx, orgID, resourceType, resourceID, alertType)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("get alert: %w", err)
+	}
+
+	alert.Resolve()
+	if err := s.store.UpdateAlert(ctx, alert); err != nil {
+		return fmt.Errorf("update alert: %w", err)
+	}
+
+	s.logger.Info().
+		Str("alert_id", alert.ID.String()).
+		Str("type", string(alertType)).
+		Msg("alert resolved")
+
+	return nil
+}
+
 // HasActiveAlert checks if there's an active alert for a specific resource and type.
 func (s *AlertServiceImpl) HasActiveAlert(ctx context.Context, orgID uuid.UUID, resourceType models.ResourceType, resourceID uuid.UUID, alertType models.AlertType) (bool, error) {
 	_, err := s.store.GetAlertByResourceAndType(ctx, orgID, resourceType, resourceID, alertType)
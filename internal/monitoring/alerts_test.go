@@ -3,6 +3,7 @@ package monitoring
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/MacJediWizard/keldris/internal/models"
@@ -512,6 +513,33 @@ func TestAlertManager_Resolve(t *testing.T) {
 			t.Fatal("expected error")
 		}
 	})
+
+	t.Run("resolve alert by resource and type", func(t *testing.T) {
+		store := newMockAlertStore()
+		svc := NewAlertService(store, nil, zerolog.Nop())
+
+		alert := models.NewAlert(orgID, models.AlertTypeBackupCompliance, models.AlertSeverityWarning, "Title", "Msg")
+		store.resourceAlert = alert
+
+		err := svc.ResolveAlertByResourceAndType(context.Background(), orgID, models.ResourceTypeSchedule, uuid.New(), models.AlertTypeBackupCompliance)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if alert.Status != models.AlertStatusResolved {
+			t.Errorf("expected resolved, got %s", alert.Status)
+		}
+	})
+
+	t.Run("resolve by resource and type without active alert", func(t *testing.T) {
+		store := newMockAlertStore()
+		store.resourceAlertErr = fmt.Errorf("get alert by resource: %w", pgx.ErrNoRows)
+		svc := NewAlertService(store, nil, zerolog.Nop())
+
+		err := svc.ResolveAlertByResourceAndType(context.Background(), orgID, models.ResourceTypeSchedule, uuid.New(), models.AlertTypeBackupCompliance)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
 }
 
 func TestAlertRuleCRUD(t *testing.T) {
@@ -104,6 +104,17 @@ type MaintenanceScheduledData struct {
 	Duration string
 }
 
+// ApprovalRequestedData holds data for approval requested email template
+type ApprovalRequestedData struct {
+	RequestID   string
+	Action      string
+	Summary     string
+	Reason      string
+	RequestedBy string
+	RequestedAt time.Time
+	ExpiresAt   time.Time
+}
+
 // TestRestoreFailedData holds data for test restore failed email template
 type TestRestoreFailedData struct {
 	RepositoryName   string
@@ -151,6 +162,7 @@ type ReportData struct {
 	AgentSummary   ReportAgentSummary   `json:"agent_summary"`
 	AlertSummary   ReportAlertSummary   `json:"alert_summary"`
 	TopIssues      []ReportIssue        `json:"top_issues,omitempty"`
+	Compliance     *ReportCompliance    `json:"compliance,omitempty"`
 }
 
 // ReportBackupSummary contains backup statistics for the report period
@@ -199,6 +211,20 @@ type ReportIssue struct {
 	OccurredAt  time.Time `json:"occurred_at"`
 }
 
+// ReportCompliance contains the 3-2-1 backup compliance summary
+type ReportCompliance struct {
+	Score              int                   `json:"score"`
+	CompliantSchedules int                   `json:"compliant_schedules"`
+	TotalSchedules     int                   `json:"total_schedules"`
+	NonCompliant       []ReportComplianceGap `json:"non_compliant,omitempty"`
+}
+
+// ReportComplianceGap lists why a schedule is not 3-2-1 compliant
+type ReportComplianceGap struct {
+	ScheduleName string   `json:"schedule_name"`
+	Gaps         []string `json:"gaps"`
+}
+
 // InvitationData holds data for invitation email template
 type InvitationData struct {
 	OrgName     string
@@ -247,6 +273,12 @@ func (s *EmailService) SendMaintenanceScheduled(to []string, data MaintenanceSch
 	return s.sendTemplate(to, subject, "maintenance_scheduled.html", data)
 }
 
+// SendApprovalRequested sends an approval requested notification email
+func (s *EmailService) SendApprovalRequested(to []string, data ApprovalRequestedData) error {
+	subject := fmt.Sprintf("Approval Required: %s", data.Summary)
+	return s.sendTemplate(to, subject, "approval_requested.html", data)
+}
+
 // SendTestRestoreFailed sends a test restore failed notification email
 func (s *EmailService) SendTestRestoreFailed(to []string, data TestRestoreFailedData) error {
 	subject := fmt.Sprintf("Test Restore Failed: %s", data.RepositoryName)
@@ -291,6 +291,10 @@ func TestEmailService_SendTemplate_ReportSummary(t *testing.T) {
 			StorageSummary: ReportStorageSummary{TotalRawSize: 1024 * 1024 * 1024, TotalRestoreSize: 500 * 1024 * 1024},
 			AgentSummary:   ReportAgentSummary{TotalAgents: 10, ActiveAgents: 9, OfflineAgents: 1},
 			AlertSummary:   ReportAlertSummary{TotalAlerts: 5, CriticalAlerts: 1},
+			Compliance: &ReportCompliance{
+				Score: 78, CompliantSchedules: 1, TotalSchedules: 2,
+				NonCompliant: []ReportComplianceGap{{ScheduleName: "files", Gaps: []string{"no offsite or immutable copy"}}},
+			},
 		},
 		TotalDataFormatted:   "1.00 GB",
 		RawSizeFormatted:     "1.00 GB",
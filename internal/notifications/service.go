@@ -688,6 +688,140 @@ func (s *Service) sendMaintenanceEmail(ctx context.Context, channel *models.Noti
 	s.finalizeLog(ctx, log, sendErr, channel.ID.String(), strings.Join(recipients, ", "))
 }
 
+// NotifyApprovalRequested notifies approvers that a destructive operation is waiting for a second admin.
+func (s *Service) NotifyApprovalRequested(ctx context.Context, req *models.ApprovalRequest, requestedBy string) {
+	prefs, err := s.store.GetEnabledPreferencesForEvent(ctx, req.OrgID, models.EventApprovalRequested)
+	if err != nil {
+		s.logger.Error().Err(err).
+			Str("org_id", req.OrgID.String()).
+			Str("approval_request_id", req.ID.String()).
+			Msg("failed to get notification preferences")
+		return
+	}
+
+	if len(prefs) == 0 {
+		s.logger.Debug().
+			Str("org_id", req.OrgID.String()).
+			Str("event_type", string(models.EventApprovalRequested)).
+			Msg("no notification preferences enabled for event")
+		return
+	}
+
+	data := ApprovalRequestedData{
+		RequestID:   req.ID.String(),
+		Action:      string(req.Action),
+		Summary:     req.Summary,
+		Reason:      req.Reason,
+		RequestedBy: requestedBy,
+		RequestedAt: req.CreatedAt,
+		ExpiresAt:   req.ExpiresAt,
+	}
+
+	for _, pref := range prefs {
+		pref := pref
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			s.sendApprovalRequestedNotification(ctx, pref, data, req.OrgID)
+		}()
+	}
+}
+
+// sendApprovalRequestedNotification sends an approval requested notification.
+func (s *Service) sendApprovalRequestedNotification(ctx context.Context, pref *models.NotificationPreference, data ApprovalRequestedData, orgID uuid.UUID) {
+	channel, err := s.store.GetNotificationChannelByID(ctx, pref.ChannelID)
+	if err != nil {
+		s.logger.Error().Err(err).
+			Str("channel_id", pref.ChannelID.String()).
+			Msg("failed to get notification channel")
+		return
+	}
+
+	subject := fmt.Sprintf("Approval Required: %s", data.Summary)
+	recipient := s.getChannelRecipient(channel)
+	body := fmt.Sprintf("%s requested: %s\nRequest ID: %s\nExpires: %s",
+		data.RequestedBy, data.Summary, data.RequestID, data.ExpiresAt.Format(time.RFC822))
+	if data.Reason != "" {
+		body += "\nReason: " + data.Reason
+	}
+
+	log := models.NewNotificationLog(orgID, &channel.ID, string(models.EventApprovalRequested), recipient, subject)
+	if err := s.store.CreateNotificationLog(ctx, log); err != nil {
+		s.logger.Error().Err(err).Msg("failed to create notification log")
+	}
+
+	var sendErr error
+	switch channel.Type {
+	case models.ChannelTypeEmail:
+		sendErr = s.sendEmailApprovalRequested(channel, data)
+	case models.ChannelTypeSlack:
+		var cfg models.SlackChannelConfig
+		if sendErr = s.decryptConfig(channel.ConfigEncrypted, &cfg); sendErr == nil {
+			msg := NotificationMessage{Title: subject, Body: body, EventType: string(models.EventApprovalRequested), Severity: "warning"}
+			sendErr = s.slackSenderFunc(s.logger).Send(ctx, cfg.WebhookURL, msg)
+		}
+	case models.ChannelTypeTeams:
+		var cfg models.TeamsChannelConfig
+		if sendErr = s.decryptConfig(channel.ConfigEncrypted, &cfg); sendErr == nil {
+			msg := NotificationMessage{Title: subject, Body: body, EventType: string(models.EventApprovalRequested), Severity: "warning"}
+			sendErr = s.teamsSenderFunc(s.logger).Send(ctx, cfg.WebhookURL, msg)
+		}
+	case models.ChannelTypeDiscord:
+		var cfg models.DiscordChannelConfig
+		if sendErr = s.decryptConfig(channel.ConfigEncrypted, &cfg); sendErr == nil {
+			msg := NotificationMessage{Title: subject, Body: body, EventType: string(models.EventApprovalRequested), Severity: "warning"}
+			sendErr = s.discordSenderFunc(s.logger).Send(ctx, cfg.WebhookURL, msg)
+		}
+	case models.ChannelTypePagerDuty:
+		var cfg models.PagerDutyChannelConfig
+		if sendErr = s.decryptConfig(channel.ConfigEncrypted, &cfg); sendErr == nil {
+			event := PagerDutyEvent{Summary: subject, Source: "keldris", Severity: "warning", Group: "approvals"}
+			sendErr = s.pagerDutySenderFunc(s.logger).Send(ctx, cfg.RoutingKey, event)
+		}
+	case models.ChannelTypeWebhook:
+		var cfg models.WebhookChannelConfig
+		if sendErr = s.decryptConfig(channel.ConfigEncrypted, &cfg); sendErr == nil {
+			payload := WebhookPayload{EventType: string(models.EventApprovalRequested), Timestamp: time.Now(), Data: data}
+			sendErr = s.webhookSenderFunc(s.logger).Send(ctx, cfg.URL, payload, cfg.Secret)
+		}
+	default:
+		s.logger.Warn().
+			Str("channel_type", string(channel.Type)).
+			Msg("unsupported notification channel type")
+		return
+	}
+
+	s.finalizeLog(ctx, log, sendErr, channel.ID.String(), recipient)
+}
+
+// sendEmailApprovalRequested sends an approval requested notification via email.
+func (s *Service) sendEmailApprovalRequested(channel *models.NotificationChannel, data ApprovalRequestedData) error {
+	var emailConfig models.EmailChannelConfig
+	if err := s.decryptConfig(channel.ConfigEncrypted, &emailConfig); err != nil {
+		return fmt.Errorf("decrypt email config: %w", err)
+	}
+
+	smtpConfig := SMTPConfig{
+		Host:     emailConfig.Host,
+		Port:     emailConfig.Port,
+		Username: emailConfig.Username,
+		Password: emailConfig.Password,
+		From:     emailConfig.From,
+		TLS:      emailConfig.TLS,
+	}
+
+	emailService, err := NewEmailService(smtpConfig, s.logger)
+	if err != nil {
+		return fmt.Errorf("create email service: %w", err)
+	}
+
+	recipients := emailConfig.Recipients
+	if len(recipients) == 0 {
+		recipients = []string{emailConfig.From}
+	}
+	return emailService.SendApprovalRequested(recipients, data)
+}
+
 // finalizeLog updates a notification log with the send result.
 func (s *Service) finalizeLog(ctx context.Context, log *models.NotificationLog, sendErr error, channelID, recipient string) {
 	// Redact recipient if it looks like a URL (webhook URLs contain auth tokens)
@@ -16,6 +16,7 @@ type ReportStore interface {
 	GetStorageStatsSummary(ctx context.Context, orgID uuid.UUID) (*models.StorageStatsSummary, error)
 	GetAgentsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.Agent, error)
 	GetAlertsByOrgIDAndDateRange(ctx context.Context, orgID uuid.UUID, start, end time.Time) ([]*models.Alert, error)
+	GetScheduleCompliancesByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.ScheduleCompliance, error)
 }
 
 // Generator generates report data.
@@ -75,6 +76,14 @@ func (g *Generator) GenerateReport(ctx context.Context, orgID uuid.UUID, periodS
 		report.TopIssues = topIssues
 	}
 
+	// Summarize 3-2-1 compliance from the latest background evaluation
+	compliances, err := g.store.GetScheduleCompliancesByOrgID(ctx, orgID)
+	if err != nil {
+		g.logger.Error().Err(err).Msg("failed to generate compliance summary")
+	} else {
+		report.Compliance = models.SummarizeBackupCompliance(compliances)
+	}
+
 	return report, nil
 }
 
@@ -18,6 +18,7 @@ type mockReportStore struct {
 	storageStats *models.StorageStatsSummary
 	agents       []*models.Agent
 	alerts       []*models.Alert
+	compliances  []*models.ScheduleCompliance
 
 	backupsErr      error
 	schedulesErr    error
@@ -46,6 +47,10 @@ func (m *mockReportStore) GetAlertsByOrgIDAndDateRange(_ context.Context, _ uuid
 	return m.alerts, m.alertsErr
 }
 
+func (m *mockReportStore) GetScheduleCompliancesByOrgID(_ context.Context, _ uuid.UUID) ([]*models.ScheduleCompliance, error) {
+	return m.compliances, nil
+}
+
 func newTestGenerator(store ReportStore) *Generator {
 	logger := zerolog.Nop()
 	return NewGenerator(store, logger)
@@ -84,6 +89,10 @@ func TestGenerator_GenerateReport(t *testing.T) {
 			{ID: uuid.New(), Severity: models.AlertSeverityCritical, Status: models.AlertStatusActive, Type: models.AlertTypeAgentOffline, Title: "Agent down", Message: "Agent is offline", CreatedAt: now},
 			{ID: uuid.New(), Severity: models.AlertSeverityWarning, Status: models.AlertStatusAcknowledged, Type: models.AlertTypeStorageUsage, Title: "Storage high", Message: "Above 80%", CreatedAt: now},
 		},
+		compliances: []*models.ScheduleCompliance{
+			{ScheduleName: "db", Score: 100, Compliant: true},
+			{ScheduleName: "files", Score: 67, Gaps: []string{"no offsite or immutable copy"}},
+		},
 	}
 
 	gen := newTestGenerator(store)
@@ -137,6 +146,17 @@ func TestGenerator_GenerateReport(t *testing.T) {
 	if len(report.TopIssues) != 1 {
 		t.Errorf("TopIssues len = %d, want 1", len(report.TopIssues))
 	}
+
+	// 3-2-1 compliance
+	if report.Compliance == nil {
+		t.Fatal("Compliance is nil")
+	}
+	if report.Compliance.Score != 83 || report.Compliance.CompliantSchedules != 1 || report.Compliance.TotalSchedules != 2 {
+		t.Errorf("Compliance = %+v", report.Compliance)
+	}
+	if len(report.Compliance.NonCompliant) != 1 || report.Compliance.NonCompliant[0].ScheduleName != "files" {
+		t.Errorf("NonCompliant = %+v", report.Compliance.NonCompliant)
+	}
 }
 
 func TestGenerator_BackupSummary(t *testing.T) {
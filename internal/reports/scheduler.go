@@ -332,6 +332,21 @@ func (s *Scheduler) SendReport(ctx context.Context, schedule *models.ReportSched
 		}
 	}
 
+	// Convert 3-2-1 compliance
+	if data.Compliance != nil {
+		emailData.Data.Compliance = &notifications.ReportCompliance{
+			Score:              data.Compliance.Score,
+			CompliantSchedules: data.Compliance.CompliantSchedules,
+			TotalSchedules:     data.Compliance.TotalSchedules,
+		}
+		for _, c := range data.Compliance.NonCompliant {
+			emailData.Data.Compliance.NonCompliant = append(emailData.Data.Compliance.NonCompliant, notifications.ReportComplianceGap{
+				ScheduleName: c.ScheduleName,
+				Gaps:         c.Gaps,
+			})
+		}
+	}
+
 	// Send report email
 	err = emailService.SendReport(schedule.Recipients, emailData)
 
@@ -23,6 +23,7 @@ type mockSchedulerStore struct {
 	storageStats *models.StorageStatsSummary
 	agents       []*models.Agent
 	alerts       []*models.Alert
+	compliances  []*models.ScheduleCompliance
 
 	backupsErr      error
 	schedulesErr    error
@@ -75,6 +76,10 @@ func (m *mockSchedulerStore) GetAlertsByOrgIDAndDateRange(_ context.Context, _ u
 	return m.alerts, m.alertsErr
 }
 
+func (m *mockSchedulerStore) GetScheduleCompliancesByOrgID(_ context.Context, _ uuid.UUID) ([]*models.ScheduleCompliance, error) {
+	return m.compliances, nil
+}
+
 func (m *mockSchedulerStore) GetEnabledReportSchedules(_ context.Context) ([]*models.ReportSchedule, error) {
 	return m.reportSchedules, m.reportSchedulesErr
 }
@@ -0,0 +1,585 @@
+// Package restserver implements the restic REST backend protocol so the
+// Keldris server can host repositories on its own disk.
+//
+// Hosted repositories are regular "rest" repositories whose config has
+// hosted=true. They are served under /restic/<repository-id>/ and stored in
+// <dir>/<repository-id>. Agents authenticate with credentials derived from
+// their API key (see AgentCredentials) and may only access repositories their
+// own schedules back up to; the server itself uses the username
+// ServerUsername and the password stored in the repository config.
+package restserver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MacJediWizard/keldris/internal/backup/backends"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// PathPrefix is the URL prefix hosted repositories are served under.
+	PathPrefix = "/restic"
+
+	// ServerUsername is the username the Keldris server itself uses to access
+	// hosted repositories, e.g. for verification and retention.
+	ServerUsername = "keldris"
+
+	// secretPurpose derives the key agent passwords are computed with.
+	secretPurpose = "restic-rest-server"
+
+	mediaTypeV1 = "application/vnd.x.restic.rest.v1"
+	mediaTypeV2 = "application/vnd.x.restic.rest.v2"
+)
+
+// fileTypes are the directories of a restic repository.
+var fileTypes = []string{"data", "index", "keys", "locks", "snapshots"}
+
+// validName matches restic file names (hex-encoded SHA-256 IDs).
+var validName = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// errQuotaExceeded is reported when an upload does not fit in the
+// repository's quota.
+var errQuotaExceeded = errors.New("repository quota exceeded")
+
+// Store defines the persistence operations used by the REST server.
+type Store interface {
+	GetRepositoryByID(ctx context.Context, id uuid.UUID) (*models.Repository, error)
+	GetAgentByID(ctx context.Context, id uuid.UUID) (*models.Agent, error)
+	AgentUsesRepository(ctx context.Context, agentID, repositoryID uuid.UUID) (bool, error)
+	UpsertHostedRepositoryUsage(ctx context.Context, usage *models.HostedRepositoryUsage) error
+}
+
+// KeyManager provides the server's encryption operations.
+type KeyManager interface {
+	Decrypt(ciphertext []byte) ([]byte, error)
+	DeriveKey(purpose string) []byte
+}
+
+// Config holds configuration for the REST server.
+type Config struct {
+	// Dir is the directory repositories are stored in, on local disk or a
+	// mounted volume.
+	Dir string
+	// AppendOnly applies append-only mode to every hosted repository,
+	// regardless of the repository's own setting.
+	AppendOnly bool
+}
+
+// Server serves hosted repositories over the restic REST protocol.
+type Server struct {
+	dir        string
+	appendOnly bool
+	store      Store
+	keys       KeyManager
+	logger     zerolog.Logger
+
+	mu    sync.Mutex
+	usage map[uuid.UUID]int64
+	// reserved holds the quota reserved by uploads in progress.
+	reserved map[uuid.UUID]int64
+}
+
+// New creates a new Server, creating the storage directory if needed.
+func New(cfg Config, store Store, keys KeyManager, logger zerolog.Logger) (*Server, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("restserver: storage directory is required")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("restserver: create storage directory: %w", err)
+	}
+	return &Server{
+		dir:        cfg.Dir,
+		appendOnly: cfg.AppendOnly,
+		store:      store,
+		keys:       keys,
+		logger:     logger.With().Str("component", "rest_server").Logger(),
+		usage:      make(map[uuid.UUID]int64),
+		reserved:   make(map[uuid.UUID]int64),
+	}, nil
+}
+
+// RepositoryURL returns the URL of a hosted repository on the server at serverURL.
+func RepositoryURL(serverURL string, repositoryID uuid.UUID) string {
+	return strings.TrimRight(serverURL, "/") + PathPrefix + "/" + repositoryID.String() + "/"
+}
+
+// AgentCredentials returns the REST credentials an agent uses for hosted
+// repositories. The password is derived from the agent's API key hash, so it
+// changes whenever the key is rotated or revoked.
+func AgentCredentials(keys KeyManager, agent *models.Agent) (username, password string) {
+	mac := hmac.New(sha256.New, keys.DeriveKey(secretPurpose))
+	mac.Write([]byte(agent.ID.String()))
+	mac.Write([]byte{0})
+	mac.Write([]byte(agent.APIKeyHash))
+	return agent.ID.String(), hex.EncodeToString(mac.Sum(nil))
+}
+
+// repoRequest is an authenticated request for a hosted repository.
+type repoRequest struct {
+	repo    *models.Repository
+	backend *backends.RestBackend
+	// agent is nil when the server itself is the client.
+	agent *models.Agent
+	dir   string
+}
+
+// ServeHTTP handles a restic REST request. The request path must not include
+// PathPrefix.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	repoID, err := uuid.Parse(parts[0])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	rr, status := s.authorize(r, repoID)
+	if status != http.StatusOK {
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="keldris"`)
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 || (len(parts) == 2 && parts[1] == ""):
+		s.handleRepository(w, r, rr)
+	case len(parts) == 2 && parts[1] == "config":
+		s.handleFile(w, r, rr, "config", filepath.Join(rr.dir, "config"))
+	case isFileType(parts[1]) && (len(parts) == 2 || (len(parts) == 3 && parts[2] == "")):
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		s.list(w, r, rr, parts[1])
+	case isFileType(parts[1]) && len(parts) == 3 && validName.MatchString(parts[2]):
+		s.handleFile(w, r, rr, parts[1], filePath(rr.dir, parts[1], parts[2]))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorize checks the request's basic auth credentials against the
+// repository. Agents must also use the repository in one of their schedules.
+// It returns http.StatusOK on success.
+func (s *Server) authorize(r *http.Request, repoID uuid.UUID) (*repoRequest, int) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, http.StatusUnauthorized
+	}
+
+	ctx := r.Context()
+	repo, err := s.store.GetRepositoryByID(ctx, repoID)
+	if err != nil || repo.Type != models.RepositoryTypeRest {
+		return nil, http.StatusNotFound
+	}
+	configJSON, err := s.keys.Decrypt(repo.ConfigEncrypted)
+	if err != nil {
+		s.logger.Error().Err(err).Str("repo_id", repoID.String()).Msg("failed to decrypt repository config")
+		return nil, http.StatusInternalServerError
+	}
+	backend, err := backends.ParseBackend(repo.Type, configJSON)
+	if err != nil {
+		return nil, http.StatusNotFound
+	}
+	rest, ok := backend.(*backends.RestBackend)
+	if !ok || !rest.Hosted {
+		return nil, http.StatusNotFound
+	}
+
+	rr := &repoRequest{repo: repo, backend: rest, dir: filepath.Join(s.dir, repo.ID.String())}
+
+	if username == ServerUsername {
+		if rest.Password == "" || !equal(password, rest.Password) {
+			s.logger.Warn().Str("repo_id", repoID.String()).Msg("rejected server credentials")
+			return nil, http.StatusUnauthorized
+		}
+		return rr, http.StatusOK
+	}
+
+	agentID, err := uuid.Parse(username)
+	if err != nil {
+		return nil, http.StatusUnauthorized
+	}
+	agent, err := s.store.GetAgentByID(ctx, agentID)
+	if err != nil || agent.OrgID != repo.OrgID || agent.APIKeyHash == "" {
+		s.logger.Warn().Str("repo_id", repoID.String()).Str("agent_id", agentID.String()).Msg("rejected agent credentials")
+		return nil, http.StatusUnauthorized
+	}
+	if _, want := AgentCredentials(s.keys, agent); !equal(password, want) {
+		s.logger.Warn().Str("repo_id", repoID.String()).Str("agent_id", agentID.String()).Msg("rejected agent credentials")
+		return nil, http.StatusUnauthorized
+	}
+	uses, err := s.store.AgentUsesRepository(ctx, agent.ID, repo.ID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("repo_id", repoID.String()).Str("agent_id", agentID.String()).Msg("failed to check agent repository access")
+		return nil, http.StatusInternalServerError
+	}
+	if !uses {
+		s.logger.Warn().Str("repo_id", repoID.String()).Str("agent_id", agentID.String()).Msg("rejected agent without a schedule using the repository")
+		return nil, http.StatusForbidden
+	}
+	rr.agent = agent
+	return rr, http.StatusOK
+}
+
+// isAppendOnly reports whether deletes are restricted for the request. The
+// server itself is never restricted, so retention still works.
+func (s *Server) isAppendOnly(rr *repoRequest) bool {
+	return rr.agent != nil && (s.appendOnly || rr.backend.AppendOnly)
+}
+
+func (s *Server) handleRepository(w http.ResponseWriter, r *http.Request, rr *repoRequest) {
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPost:
+		if r.URL.Query().Get("create") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if err := createRepository(rr.dir); err != nil {
+			s.logger.Error().Err(err).Str("repo_id", rr.repo.ID.String()).Msg("failed to create repository")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		s.logger.Info().Str("repo_id", rr.repo.ID.String()).Msg("hosted repository created")
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request, rr *repoRequest, fileType, path string) {
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		serveFile(w, r, path)
+	case http.MethodPost:
+		s.saveFile(w, r, rr, fileType, path)
+	case http.MethodDelete:
+		s.deleteFile(w, r, rr, fileType, path)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func serveFile(w http.ResponseWriter, r *http.Request, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	// ServeContent handles HEAD and Range requests.
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
+
+// saveFile stores an uploaded file. Existing files are never overwritten,
+// and every file except config must match the SHA-256 ID in its name.
+func (s *Server) saveFile(w http.ResponseWriter, r *http.Request, rr *repoRequest, fileType, path string) {
+	if _, err := os.Stat(path); err == nil {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	if fileType == "data" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Usage is computed before the upload lands so it is counted once.
+	if _, err := s.usedBytes(rr); err != nil {
+		s.logger.Error().Err(err).Str("repo_id", rr.repo.ID.String()).Msg("failed to compute repository usage")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	body := io.Reader(r.Body)
+	limit := int64(-1)
+	if rr.backend.QuotaBytes > 0 {
+		// The upload's size is reserved before it is read, so the quota
+		// holds across concurrent uploads.
+		if r.ContentLength < 0 {
+			http.Error(w, http.StatusText(http.StatusLengthRequired), http.StatusLengthRequired)
+			return
+		}
+		release, ok := s.reserveQuota(rr, r.ContentLength)
+		if !ok {
+			http.Error(w, errQuotaExceeded.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		defer release()
+		limit = r.ContentLength
+		body = io.LimitReader(r.Body, limit+1)
+	}
+
+	// Pack uploads can take longer than the server-wide read timeout.
+	_ = http.NewResponseController(w).SetReadDeadline(time.Time{})
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(tmp, io.TeeReader(body, hash))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.logger.Warn().Err(err).Str("repo_id", rr.repo.ID.String()).Msg("upload failed")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if limit >= 0 && size > limit {
+		http.Error(w, errQuotaExceeded.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if fileType != "config" && hex.EncodeToString(hash.Sum(nil)) != filepath.Base(path) {
+		http.Error(w, "file content does not match its name", http.StatusBadRequest)
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	s.addUsage(r.Context(), rr, size)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) deleteFile(w http.ResponseWriter, r *http.Request, rr *repoRequest, fileType, path string) {
+	if fileType != "locks" && s.isAppendOnly(rr) {
+		s.logger.Warn().
+			Str("repo_id", rr.repo.ID.String()).
+			Str("agent_id", rr.agent.ID.String()).
+			Str("type", fileType).
+			Msg("delete rejected in append-only mode")
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	s.addUsage(r.Context(), rr, -info.Size())
+	w.WriteHeader(http.StatusOK)
+}
+
+type listEntry struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// list returns the files of one type. Clients asking for API v2 get sizes too.
+func (s *Server) list(w http.ResponseWriter, r *http.Request, rr *repoRequest, fileType string) {
+	dir := filepath.Join(rr.dir, fileType)
+	dirs := []string{dir}
+	if fileType == "data" {
+		subdirs, err := os.ReadDir(dir)
+		if err != nil {
+			listError(w, r, err)
+			return
+		}
+		dirs = dirs[:0]
+		for _, d := range subdirs {
+			if d.IsDir() {
+				dirs = append(dirs, filepath.Join(dir, d.Name()))
+			}
+		}
+	}
+
+	entries := []listEntry{}
+	for _, d := range dirs {
+		files, err := os.ReadDir(d)
+		if err != nil {
+			listError(w, r, err)
+			return
+		}
+		for _, f := range files {
+			if !validName.MatchString(f.Name()) {
+				continue
+			}
+			info, err := f.Info()
+			if err != nil {
+				continue
+			}
+			entries = append(entries, listEntry{Name: f.Name(), Size: info.Size()})
+		}
+	}
+
+	if r.Header.Get("Accept") == mediaTypeV2 {
+		w.Header().Set("Content-Type", mediaTypeV2)
+		_ = json.NewEncoder(w).Encode(entries)
+		return
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+	}
+	w.Header().Set("Content-Type", mediaTypeV1)
+	_ = json.NewEncoder(w).Encode(names)
+}
+
+func listError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// usedBytes returns the disk used by a repository, walking it on first use.
+func (s *Server) usedBytes(rr *repoRequest) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if used, ok := s.usage[rr.repo.ID]; ok {
+		return used, nil
+	}
+	used, err := dirSize(rr.dir)
+	if err != nil {
+		return 0, err
+	}
+	s.usage[rr.repo.ID] = used
+	return used, nil
+}
+
+// reserveQuota reserves n bytes of the repository's quota for an upload in
+// progress, reporting false if it does not fit. The returned func releases
+// the reservation and must be called once the upload's usage has been
+// recorded or the upload has failed. Usage must already be known.
+func (s *Server) reserveQuota(rr *repoRequest, n int64) (func(), bool) {
+	id := rr.repo.ID
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.usage[id]+s.reserved[id]+n > rr.backend.QuotaBytes {
+		return nil, false
+	}
+	s.reserved[id] += n
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.reserved[id] -= n; s.reserved[id] <= 0 {
+			delete(s.reserved, id)
+		}
+	}, true
+}
+
+// addUsage adjusts a repository's usage and records it for metering.
+func (s *Server) addUsage(ctx context.Context, rr *repoRequest, delta int64) {
+	if _, err := s.usedBytes(rr); err != nil {
+		s.logger.Error().Err(err).Str("repo_id", rr.repo.ID.String()).Msg("failed to compute repository usage")
+		return
+	}
+	s.mu.Lock()
+	s.usage[rr.repo.ID] += delta
+	used := s.usage[rr.repo.ID]
+	s.mu.Unlock()
+
+	usage := models.NewHostedRepositoryUsage(rr.repo.ID, rr.repo.OrgID, used, rr.backend.QuotaBytes)
+	if err := s.store.UpsertHostedRepositoryUsage(ctx, usage); err != nil {
+		s.logger.Error().Err(err).Str("repo_id", rr.repo.ID.String()).Msg("failed to record repository usage")
+	}
+}
+
+// createRepository creates the directory layout of a new repository.
+func createRepository(dir string) error {
+	for _, t := range fileTypes {
+		if err := os.MkdirAll(filepath.Join(dir, t), 0o700); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < 256; i++ {
+		if err := os.MkdirAll(filepath.Join(dir, "data", fmt.Sprintf("%02x", i)), 0o700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirSize returns the total size of the regular files under dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func filePath(dir, fileType, name string) string {
+	if fileType == "data" {
+		return filepath.Join(dir, "data", name[:2], name)
+	}
+	return filepath.Join(dir, fileType, name)
+}
+
+func isFileType(s string) bool {
+	for _, t := range fileTypes {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,314 @@
+package restserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/crypto"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type fakeStore struct {
+	repos  map[uuid.UUID]*models.Repository
+	agents map[uuid.UUID]*models.Agent
+	usage  map[uuid.UUID]*models.HostedRepositoryUsage
+	// uses holds the agent/repository pairs linked by a schedule.
+	uses map[[2]uuid.UUID]bool
+}
+
+func (s *fakeStore) GetRepositoryByID(_ context.Context, id uuid.UUID) (*models.Repository, error) {
+	repo, ok := s.repos[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return repo, nil
+}
+
+func (s *fakeStore) GetAgentByID(_ context.Context, id uuid.UUID) (*models.Agent, error) {
+	agent, ok := s.agents[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return agent, nil
+}
+
+func (s *fakeStore) AgentUsesRepository(_ context.Context, agentID, repositoryID uuid.UUID) (bool, error) {
+	return s.uses[[2]uuid.UUID{agentID, repositoryID}], nil
+}
+
+func (s *fakeStore) UpsertHostedRepositoryUsage(_ context.Context, usage *models.HostedRepositoryUsage) error {
+	s.usage[usage.RepositoryID] = usage
+	return nil
+}
+
+type testEnv struct {
+	server *httptest.Server
+	store  *fakeStore
+	keys   *crypto.KeyManager
+	repo   *models.Repository
+	agent  *models.Agent
+}
+
+func newTestEnv(t *testing.T, appendOnly bool, config string) *testEnv {
+	t.Helper()
+	key, _ := crypto.GenerateMasterKey()
+	keys, _ := crypto.NewKeyManager(key)
+
+	orgID := uuid.New()
+	configEncrypted, err := keys.Encrypt([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := models.NewRepository(orgID, "hosted", models.RepositoryTypeRest, configEncrypted)
+	agent := &models.Agent{ID: uuid.New(), OrgID: orgID, APIKeyHash: "hash-1"}
+
+	store := &fakeStore{
+		repos:  map[uuid.UUID]*models.Repository{repo.ID: repo},
+		agents: map[uuid.UUID]*models.Agent{agent.ID: agent},
+		usage:  make(map[uuid.UUID]*models.HostedRepositoryUsage),
+		uses:   map[[2]uuid.UUID]bool{{agent.ID, repo.ID}: true},
+	}
+	srv, err := New(Config{Dir: t.TempDir(), AppendOnly: appendOnly}, store, keys, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ts := httptest.NewServer(http.StripPrefix(PathPrefix, srv))
+	t.Cleanup(ts.Close)
+	return &testEnv{server: ts, store: store, keys: keys, repo: repo, agent: agent}
+}
+
+const hostedConfig = `{"url":"https://keldris.example.com/restic/","username":"keldris","password":"server-secret","hosted":true}`
+
+func (e *testEnv) do(t *testing.T, method, path, body string, asAgent bool, header ...string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, RepositoryURL(e.server.URL, e.repo.ID)+path, strings.NewReader(body))
+	if asAgent {
+		req.SetBasicAuth(AgentCredentials(e.keys, e.agent))
+	} else {
+		req.SetBasicAuth(ServerUsername, "server-secret")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func blobName(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func expectStatus(t *testing.T, resp *http.Response, want int) {
+	t.Helper()
+	if resp.StatusCode != want {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: status = %d, want %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, want, body)
+	}
+}
+
+func TestServer_Protocol(t *testing.T) {
+	env := newTestEnv(t, false, hostedConfig)
+	data := "pack contents"
+	name := blobName(data)
+
+	expectStatus(t, env.do(t, http.MethodPost, "?create=true", "", true), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPost, "config", "repo config", true), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPost, "data/"+name, data, true), http.StatusOK)
+
+	t.Run("get with range", func(t *testing.T) {
+		resp := env.do(t, http.MethodGet, "data/"+name, "", true, "Range", "bytes=5-12")
+		expectStatus(t, resp, http.StatusPartialContent)
+		got, _ := io.ReadAll(resp.Body)
+		if string(got) != "contents" {
+			t.Errorf("body = %q, want %q", got, "contents")
+		}
+	})
+
+	t.Run("head", func(t *testing.T) {
+		resp := env.do(t, http.MethodHead, "config", "", true)
+		expectStatus(t, resp, http.StatusOK)
+		if resp.ContentLength != int64(len("repo config")) {
+			t.Errorf("Content-Length = %d", resp.ContentLength)
+		}
+		expectStatus(t, env.do(t, http.MethodHead, "keys/"+blobName("missing"), "", true), http.StatusNotFound)
+	})
+
+	t.Run("list v2", func(t *testing.T) {
+		resp := env.do(t, http.MethodGet, "data/", "", true, "Accept", mediaTypeV2)
+		expectStatus(t, resp, http.StatusOK)
+		var entries []listEntry
+		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name != name || entries[0].Size != int64(len(data)) {
+			t.Errorf("entries = %+v", entries)
+		}
+	})
+
+	t.Run("list v1", func(t *testing.T) {
+		resp := env.do(t, http.MethodGet, "snapshots/", "", true)
+		expectStatus(t, resp, http.StatusOK)
+		var names []string
+		if err := json.NewDecoder(resp.Body).Decode(&names); err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 0 {
+			t.Errorf("names = %v, want none", names)
+		}
+	})
+
+	t.Run("rejects content not matching name", func(t *testing.T) {
+		expectStatus(t, env.do(t, http.MethodPost, "index/"+blobName("other"), "tampered", true), http.StatusBadRequest)
+	})
+
+	t.Run("never overwrites", func(t *testing.T) {
+		expectStatus(t, env.do(t, http.MethodPost, "data/"+name, data, true), http.StatusForbidden)
+	})
+
+	t.Run("records usage", func(t *testing.T) {
+		usage := env.store.usage[env.repo.ID]
+		if usage == nil || usage.UsedBytes != int64(len("repo config")+len(data)) {
+			t.Errorf("usage = %+v", usage)
+		}
+		expectStatus(t, env.do(t, http.MethodDelete, "data/"+name, "", true), http.StatusOK)
+		if got := env.store.usage[env.repo.ID].UsedBytes; got != int64(len("repo config")) {
+			t.Errorf("UsedBytes after delete = %d", got)
+		}
+	})
+}
+
+func TestServer_AppendOnly(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		appendOnly bool
+		config     string
+	}{
+		{"server-wide", true, hostedConfig},
+		{"per repository", false, strings.Replace(hostedConfig, `"hosted":true`, `"hosted":true,"append_only":true`, 1)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, tt.appendOnly, tt.config)
+			snapshot, lock := "snapshot", "lock"
+			expectStatus(t, env.do(t, http.MethodPost, "?create=true", "", true), http.StatusOK)
+			expectStatus(t, env.do(t, http.MethodPost, "snapshots/"+blobName(snapshot), snapshot, true), http.StatusOK)
+			expectStatus(t, env.do(t, http.MethodPost, "locks/"+blobName(lock), lock, true), http.StatusOK)
+
+			expectStatus(t, env.do(t, http.MethodDelete, "snapshots/"+blobName(snapshot), "", true), http.StatusForbidden)
+			expectStatus(t, env.do(t, http.MethodDelete, "config", "", true), http.StatusForbidden)
+			expectStatus(t, env.do(t, http.MethodDelete, "locks/"+blobName(lock), "", true), http.StatusOK)
+
+			// The server itself still applies retention.
+			expectStatus(t, env.do(t, http.MethodDelete, "snapshots/"+blobName(snapshot), "", false), http.StatusOK)
+		})
+	}
+}
+
+func TestServer_Quota(t *testing.T) {
+	env := newTestEnv(t, false, strings.Replace(hostedConfig, `"hosted":true`, `"hosted":true,"quota_bytes":10`, 1))
+	expectStatus(t, env.do(t, http.MethodPost, "?create=true", "", true), http.StatusOK)
+
+	small, large := "12345678", "this is more than ten bytes"
+	expectStatus(t, env.do(t, http.MethodPost, "data/"+blobName(small), small, true), http.StatusOK)
+	expectStatus(t, env.do(t, http.MethodPost, "data/"+blobName(large), large, true), http.StatusRequestEntityTooLarge)
+
+	t.Run("concurrent uploads", func(t *testing.T) {
+		// Only one of these fits in the 2 bytes left.
+		blobs := []string{"ab", "cd", "ef", "gh"}
+		statuses := make(chan int, len(blobs))
+		var wg sync.WaitGroup
+		for _, b := range blobs {
+			wg.Add(1)
+			go func(b string) {
+				defer wg.Done()
+				statuses <- env.do(t, http.MethodPost, "data/"+blobName(b), b, true).StatusCode
+			}(b)
+		}
+		wg.Wait()
+		close(statuses)
+		ok := 0
+		for status := range statuses {
+			if status == http.StatusOK {
+				ok++
+			}
+		}
+		if ok != 1 {
+			t.Errorf("%d uploads succeeded, want 1", ok)
+		}
+	})
+
+	usage := env.store.usage[env.repo.ID]
+	if usage.QuotaBytes == nil || *usage.QuotaBytes != 10 || usage.UsedBytes != 10 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestServer_Auth(t *testing.T) {
+	env := newTestEnv(t, false, hostedConfig)
+	url := RepositoryURL(env.server.URL, env.repo.ID) + "config"
+
+	request := func(username, password string) int {
+		req, _ := http.NewRequest(http.MethodHead, url, nil)
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	username, password := AgentCredentials(env.keys, env.agent)
+	other := &models.Agent{ID: uuid.New(), OrgID: uuid.New(), APIKeyHash: "hash-2"}
+	env.store.agents[other.ID] = other
+	otherUser, otherPass := AgentCredentials(env.keys, other)
+	unbound := &models.Agent{ID: uuid.New(), OrgID: env.repo.OrgID, APIKeyHash: "hash-3"}
+	env.store.agents[unbound.ID] = unbound
+	unboundUser, unboundPass := AgentCredentials(env.keys, unbound)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     int
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized},
+		{"agent", username, password, http.StatusNotFound},
+		{"server", ServerUsername, "server-secret", http.StatusNotFound},
+		{"wrong server password", ServerUsername, "guess", http.StatusUnauthorized},
+		{"wrong agent password", username, "guess", http.StatusUnauthorized},
+		{"agent from another organization", otherUser, otherPass, http.StatusUnauthorized},
+		{"agent without a schedule using the repository", unboundUser, unboundPass, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := request(tt.username, tt.password); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("rotated API key", func(t *testing.T) {
+		env.agent.APIKeyHash = "hash-rotated"
+		if got := request(username, password); got != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", got)
+		}
+	})
+}
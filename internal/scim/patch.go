@@ -0,0 +1,297 @@
+package scim
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// PatchRequest is a SCIM PATCH request body.
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is a single add, replace or remove operation.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func (op PatchOperation) kind() (string, error) {
+	kind := strings.ToLower(op.Op)
+	switch kind {
+	case "add", "replace", "remove":
+		return kind, nil
+	default:
+		return "", errInvalidValue("unsupported patch operation: " + op.Op)
+	}
+}
+
+// applyUserPatch applies patch operations to u. Attributes Keldris does not
+// store are ignored so that identity providers pushing extra profile fields
+// keep working.
+func applyUserPatch(u *User, ops []PatchOperation) error {
+	for _, op := range ops {
+		kind, err := op.kind()
+		if err != nil {
+			return err
+		}
+		if op.Path == "" {
+			if kind == "remove" {
+				return errInvalidPath("remove requires a path")
+			}
+			var attrs map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &attrs); err != nil {
+				return errInvalidValue("patch value must be an object when no path is given")
+			}
+			for attr, value := range attrs {
+				if err := setUserAttribute(u, attr, value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if kind == "remove" {
+			if err := setUserAttribute(u, op.Path, json.RawMessage(`null`)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := setUserAttribute(u, op.Path, op.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setUserAttribute(u *User, attr string, value json.RawMessage) error {
+	attr = strings.TrimPrefix(strings.ToLower(attr), strings.ToLower(SchemaUser)+":")
+	if u.Name == nil {
+		u.Name = &Name{}
+	}
+
+	switch {
+	case attr == "active":
+		active, err := decodeBool(value)
+		if err != nil {
+			return err
+		}
+		u.Active = &active
+	case attr == "username":
+		return decodeString(value, &u.UserName)
+	case attr == "externalid":
+		return decodeString(value, &u.ExternalID)
+	case attr == "displayname":
+		return decodeString(value, &u.DisplayName)
+	case attr == "name":
+		name := Name{}
+		if !isNull(value) {
+			if err := json.Unmarshal(value, &name); err != nil {
+				return errInvalidValue("invalid name")
+			}
+		}
+		u.Name = &name
+	case attr == "name.formatted":
+		return decodeString(value, &u.Name.Formatted)
+	case attr == "name.givenname":
+		u.Name.Formatted = ""
+		return decodeString(value, &u.Name.GivenName)
+	case attr == "name.familyname":
+		u.Name.Formatted = ""
+		return decodeString(value, &u.Name.FamilyName)
+	case attr == "emails":
+		var emails []MultiValue
+		if !isNull(value) {
+			if err := json.Unmarshal(value, &emails); err != nil {
+				return errInvalidValue("invalid emails")
+			}
+		}
+		u.Emails = emails
+	case strings.HasPrefix(attr, "emails[") || attr == "emails.value":
+		// emails[type eq "work"].value, as sent by Entra ID
+		var email string
+		if err := decodeString(value, &email); err != nil {
+			return err
+		}
+		u.Emails = []MultiValue{{Value: email, Primary: true}}
+	}
+	return nil
+}
+
+// applyGroupPatch applies patch operations to g.
+func applyGroupPatch(g *Group, ops []PatchOperation) error {
+	for _, op := range ops {
+		kind, err := op.kind()
+		if err != nil {
+			return err
+		}
+		path := strings.ToLower(op.Path)
+
+		switch {
+		case path == "":
+			if kind == "remove" {
+				return errInvalidPath("remove requires a path")
+			}
+			var attrs map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &attrs); err != nil {
+				return errInvalidValue("patch value must be an object when no path is given")
+			}
+			for attr, value := range attrs {
+				switch strings.ToLower(attr) {
+				case "displayname":
+					if err := decodeString(value, &g.DisplayName); err != nil {
+						return err
+					}
+				case "externalid":
+					if err := decodeString(value, &g.ExternalID); err != nil {
+						return err
+					}
+				case "members":
+					members, err := decodeMembers(value)
+					if err != nil {
+						return err
+					}
+					if kind == "add" {
+						g.Members = addMembers(g.Members, members)
+					} else {
+						g.Members = members
+					}
+				}
+			}
+		case path == "displayname":
+			if kind == "remove" {
+				return errInvalidValue("displayName is required")
+			}
+			if err := decodeString(op.Value, &g.DisplayName); err != nil {
+				return err
+			}
+		case path == "externalid":
+			if kind == "remove" {
+				g.ExternalID = ""
+				continue
+			}
+			if err := decodeString(op.Value, &g.ExternalID); err != nil {
+				return err
+			}
+		case path == "members":
+			var members []MultiValue
+			if kind != "remove" || !isNull(op.Value) {
+				if members, err = decodeMembers(op.Value); err != nil {
+					return err
+				}
+			}
+			switch kind {
+			case "add":
+				g.Members = addMembers(g.Members, members)
+			case "replace":
+				g.Members = members
+			case "remove":
+				if len(members) == 0 {
+					g.Members = nil
+				} else {
+					g.Members = removeMembers(g.Members, members)
+				}
+			}
+		case strings.HasPrefix(path, "members["):
+			// members[value eq "id"], as sent by Okta
+			if kind != "remove" {
+				return errInvalidPath("filtered member paths are only supported for remove")
+			}
+			id, ok := memberFilterValue(op.Path)
+			if !ok {
+				return errInvalidPath("unsupported member filter: " + op.Path)
+			}
+			g.Members = removeMembers(g.Members, []MultiValue{{Value: id}})
+		default:
+			return errInvalidPath("unsupported group attribute: " + op.Path)
+		}
+	}
+	return nil
+}
+
+var memberFilterPattern = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]*)"\s*\]$`)
+
+func memberFilterValue(path string) (string, bool) {
+	m := memberFilterPattern.FindStringSubmatch(strings.TrimSpace(path))
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+func addMembers(members, add []MultiValue) []MultiValue {
+	seen := make(map[string]bool, len(members))
+	for _, m := range members {
+		seen[m.Value] = true
+	}
+	for _, m := range add {
+		if !seen[m.Value] {
+			seen[m.Value] = true
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+func removeMembers(members, remove []MultiValue) []MultiValue {
+	drop := make(map[string]bool, len(remove))
+	for _, m := range remove {
+		drop[m.Value] = true
+	}
+	kept := members[:0]
+	for _, m := range members {
+		if !drop[m.Value] {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+func decodeMembers(value json.RawMessage) ([]MultiValue, error) {
+	var members []MultiValue
+	if err := json.Unmarshal(value, &members); err != nil {
+		// A single member object is accepted as well.
+		var member MultiValue
+		if err := json.Unmarshal(value, &member); err != nil {
+			return nil, errInvalidValue("invalid members")
+		}
+		members = []MultiValue{member}
+	}
+	return members, nil
+}
+
+func isNull(value json.RawMessage) bool {
+	return len(value) == 0 || string(value) == "null"
+}
+
+func decodeString(value json.RawMessage, dst *string) error {
+	if isNull(value) {
+		*dst = ""
+		return nil
+	}
+	if err := json.Unmarshal(value, dst); err != nil {
+		return errInvalidValue("expected a string value")
+	}
+	return nil
+}
+
+// decodeBool accepts JSON booleans and the "True"/"False" strings some
+// identity providers send.
+func decodeBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, errInvalidValue("expected a boolean value")
+}
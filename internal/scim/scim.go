@@ -0,0 +1,293 @@
+// Package scim implements SCIM 2.0 (RFC 7643, RFC 7644) user and group
+// provisioning.
+//
+// Identity providers call the API with an org-scoped bearer token. Users
+// provisioned by an organization are linked to it and managed only through
+// that link; deactivating a user disables the account and revokes its
+// sessions. SCIM groups are matched by display name against the
+// organization's SSO group mappings to derive each member's org role.
+package scim
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SCIM schema and message URNs.
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// ContentType is the media type of SCIM requests and responses.
+const ContentType = "application/scim+json"
+
+const (
+	// TokenPrefix is the prefix of all SCIM bearer tokens.
+	TokenPrefix = "kscim_"
+	// tokenDisplayLength is how much of a token is kept for display.
+	tokenDisplayLength = 12
+
+	// DefaultPageSize is the number of resources returned when count is not given.
+	DefaultPageSize = 100
+	// MaxPageSize caps the number of resources returned in one page.
+	MaxPageSize = 1000
+)
+
+// GenerateToken returns a new random SCIM bearer token.
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate SCIM token: %w", err)
+	}
+	return TokenPrefix + hex.EncodeToString(b), nil
+}
+
+// HashToken returns the hash stored for a token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenDisplayPrefix returns the leading part of a token shown in listings.
+func TokenDisplayPrefix(token string) string {
+	if len(token) <= tokenDisplayLength {
+		return token
+	}
+	return token[:tokenDisplayLength]
+}
+
+// Meta is the common resource metadata.
+type Meta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+}
+
+// Name is the components of a user's name.
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// MultiValue is an element of a multi-valued attribute such as emails or members.
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// User is the SCIM User resource.
+type User struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	Name        *Name        `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Emails      []MultiValue `json:"emails,omitempty"`
+	Active      *bool        `json:"active,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+// IsActive reports whether the user is active. Active defaults to true
+// when the attribute is omitted.
+func (u *User) IsActive() bool {
+	return u.Active == nil || *u.Active
+}
+
+// email returns the user's primary email, falling back to the first email
+// and then to a userName that looks like an email address.
+func (u *User) email() string {
+	for _, e := range u.Emails {
+		if e.Primary && e.Value != "" {
+			return e.Value
+		}
+	}
+	for _, e := range u.Emails {
+		if e.Value != "" {
+			return e.Value
+		}
+	}
+	if strings.Contains(u.UserName, "@") {
+		return u.UserName
+	}
+	return ""
+}
+
+// displayName returns the name stored on the Keldris user.
+func (u *User) displayName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	if u.Name != nil {
+		if u.Name.Formatted != "" {
+			return u.Name.Formatted
+		}
+		if full := strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName); full != "" {
+			return full
+		}
+	}
+	return u.email()
+}
+
+// Group is the SCIM Group resource.
+type Group struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+// ListResponse is a page of resources returned from a list or filter query.
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+// newListResponse returns the page of resources selected by startIndex
+// (1-based) and count.
+func newListResponse[T any](all []T, startIndex, count int) *ListResponse {
+	resp := &ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(all),
+		StartIndex:   startIndex,
+		Resources:    []any{},
+	}
+	for i := startIndex - 1; i < len(all) && len(resp.Resources) < count; i++ {
+		resp.Resources = append(resp.Resources, all[i])
+	}
+	resp.ItemsPerPage = len(resp.Resources)
+	return resp
+}
+
+// ParsePagination parses the startIndex and count query parameters,
+// applying the defaults and limits from RFC 7644 section 3.4.2.4.
+func ParsePagination(startIndex, count string) (int, int) {
+	start, err := strconv.Atoi(startIndex)
+	if err != nil || start < 1 {
+		start = 1
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		n = DefaultPageSize
+	}
+	if n < 0 {
+		n = 0
+	}
+	if n > MaxPageSize {
+		n = MaxPageSize
+	}
+	return start, n
+}
+
+// Error is a SCIM error response.
+type Error struct {
+	Status   int
+	SCIMType string
+	Detail   string
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.SCIMType != "" {
+		return fmt.Sprintf("scim %d %s: %s", e.Status, e.SCIMType, e.Detail)
+	}
+	return fmt.Sprintf("scim %d: %s", e.Status, e.Detail)
+}
+
+// MarshalJSON renders the error in the format of RFC 7644 section 3.12.
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		SCIMType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail,omitempty"`
+	}{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(e.Status),
+		SCIMType: e.SCIMType,
+		Detail:   e.Detail,
+	})
+}
+
+// ErrorFrom returns err as a SCIM error, hiding the detail of unexpected errors.
+func ErrorFrom(err error) *Error {
+	if scimErr, ok := err.(*Error); ok {
+		return scimErr
+	}
+	return &Error{Status: http.StatusInternalServerError, Detail: "internal server error"}
+}
+
+// NewError returns a SCIM error with the given status and detail.
+func NewError(status int, detail string) *Error {
+	return &Error{Status: status, Detail: detail}
+}
+
+func errNotFound(resource string) *Error {
+	return &Error{Status: http.StatusNotFound, Detail: resource + " not found"}
+}
+
+func errInvalidValue(detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: detail}
+}
+
+func errUniqueness(detail string) *Error {
+	return &Error{Status: http.StatusConflict, SCIMType: "uniqueness", Detail: detail}
+}
+
+func errInvalidFilter(detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, SCIMType: "invalidFilter", Detail: detail}
+}
+
+func errInvalidPath(detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, SCIMType: "invalidPath", Detail: detail}
+}
+
+// Filter is an equality filter, the form identity providers use to look up
+// resources before creating them (for example userName eq "jdoe").
+type Filter struct {
+	Attribute string
+	Value     string
+}
+
+var filterPattern = regexp.MustCompile(`(?i)^\s*([A-Za-z][\w.:]*)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// ParseFilter parses a filter expression. Only "attribute eq value" is
+// supported; an empty expression returns nil.
+func ParseFilter(expr string) (*Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	m := filterPattern.FindStringSubmatch(expr)
+	if m == nil {
+		return nil, errInvalidFilter("only 'attribute eq \"value\"' filters are supported")
+	}
+	var value string
+	if err := json.Unmarshal([]byte(m[2]), &value); err != nil {
+		return nil, errInvalidFilter("invalid filter value")
+	}
+	return &Filter{Attribute: strings.ToLower(m[1]), Value: value}, nil
+}
@@ -0,0 +1,219 @@
+package scim
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr      string
+		attribute string
+		value     string
+		wantErr   bool
+	}{
+		{expr: `userName eq "jdoe@example.com"`, attribute: "username", value: "jdoe@example.com"},
+		{expr: `externalId EQ "00u1"`, attribute: "externalid", value: "00u1"},
+		{expr: `displayName eq "Backup \"Admins\""`, attribute: "displayname", value: `Backup "Admins"`},
+		{expr: `emails.value eq "a@b.c"`, attribute: "emails.value", value: "a@b.c"},
+		{expr: `userName sw "j"`, wantErr: true},
+		{expr: `userName eq "a" and active eq true`, wantErr: true},
+		{expr: `userName eq jdoe`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", f)
+				}
+				if ErrorFrom(err).SCIMType != "invalidFilter" {
+					t.Errorf("scimType = %q, want invalidFilter", ErrorFrom(err).SCIMType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFilter() error: %v", err)
+			}
+			if f.Attribute != tt.attribute || f.Value != tt.value {
+				t.Errorf("got (%q, %q), want (%q, %q)", f.Attribute, f.Value, tt.attribute, tt.value)
+			}
+		})
+	}
+
+	if f, err := ParseFilter(""); f != nil || err != nil {
+		t.Errorf("empty filter: got (%v, %v), want (nil, nil)", f, err)
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		start, count       string
+		wantStart, wantCnt int
+	}{
+		{"", "", 1, DefaultPageSize},
+		{"0", "-5", 1, 0},
+		{"3", "10", 3, 10},
+		{"x", "5000", 1, MaxPageSize},
+	}
+	for _, tt := range tests {
+		start, count := ParsePagination(tt.start, tt.count)
+		if start != tt.wantStart || count != tt.wantCnt {
+			t.Errorf("ParsePagination(%q, %q) = (%d, %d), want (%d, %d)", tt.start, tt.count, start, count, tt.wantStart, tt.wantCnt)
+		}
+	}
+}
+
+func TestNewListResponse(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+
+	resp := newListResponse(items, 2, 2)
+	if resp.TotalResults != 5 || resp.ItemsPerPage != 2 || resp.StartIndex != 2 {
+		t.Fatalf("unexpected page: %+v", resp)
+	}
+	if resp.Resources[0] != 2 || resp.Resources[1] != 3 {
+		t.Errorf("resources = %v, want [2 3]", resp.Resources)
+	}
+
+	resp = newListResponse(items, 10, 2)
+	if resp.ItemsPerPage != 0 || resp.Resources == nil {
+		t.Errorf("out of range page should be empty, got %+v", resp)
+	}
+}
+
+func TestErrorJSON(t *testing.T) {
+	data, err := json.Marshal(errUniqueness("userName is already provisioned"))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	got := string(data)
+	for _, want := range []string{`"status":"409"`, `"scimType":"uniqueness"`, SchemaError} {
+		if !strings.Contains(got, want) {
+			t.Errorf("error JSON %s missing %s", got, want)
+		}
+	}
+
+	if ErrorFrom(json.Unmarshal([]byte("{"), &struct{}{})).Status != 500 {
+		t.Error("unexpected errors should map to 500")
+	}
+}
+
+func decodeOps(t *testing.T, body string) []PatchOperation {
+	t.Helper()
+	var req PatchRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("decode patch: %v", err)
+	}
+	return req.Operations
+}
+
+func TestApplyUserPatch(t *testing.T) {
+	t.Run("okta deactivate", func(t *testing.T) {
+		u := &User{UserName: "jdoe"}
+		if err := applyUserPatch(u, decodeOps(t, `{"Operations":[{"op":"replace","value":{"active":false}}]}`)); err != nil {
+			t.Fatalf("applyUserPatch() error: %v", err)
+		}
+		if u.IsActive() {
+			t.Error("expected user to be inactive")
+		}
+	})
+
+	t.Run("entra string boolean and email path", func(t *testing.T) {
+		u := &User{UserName: "jdoe"}
+		ops := decodeOps(t, `{"Operations":[
+			{"op":"Replace","path":"active","value":"False"},
+			{"op":"Replace","path":"emails[type eq \"work\"].value","value":"new@example.com"},
+			{"op":"Add","path":"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department","value":"IT"}
+		]}`)
+		if err := applyUserPatch(u, ops); err != nil {
+			t.Fatalf("applyUserPatch() error: %v", err)
+		}
+		if u.IsActive() {
+			t.Error("expected user to be inactive")
+		}
+		if u.email() != "new@example.com" {
+			t.Errorf("email = %q", u.email())
+		}
+	})
+
+	t.Run("name parts replace formatted name", func(t *testing.T) {
+		u := &User{UserName: "jdoe", Name: &Name{Formatted: "Old Name"}}
+		ops := decodeOps(t, `{"Operations":[
+			{"op":"replace","path":"name.givenName","value":"Jane"},
+			{"op":"replace","path":"name.familyName","value":"Doe"}
+		]}`)
+		if err := applyUserPatch(u, ops); err != nil {
+			t.Fatalf("applyUserPatch() error: %v", err)
+		}
+		if u.displayName() != "Jane Doe" {
+			t.Errorf("displayName = %q, want Jane Doe", u.displayName())
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`{"Operations":[{"op":"move","path":"active","value":true}]}`,
+			`{"Operations":[{"op":"replace","path":"active","value":"maybe"}]}`,
+			`{"Operations":[{"op":"remove"}]}`,
+		} {
+			if err := applyUserPatch(&User{}, decodeOps(t, body)); err == nil {
+				t.Errorf("expected error for %s", body)
+			}
+		}
+	})
+}
+
+func TestApplyGroupPatch(t *testing.T) {
+	members := func(g *Group) string {
+		var ids []string
+		for _, m := range g.Members {
+			ids = append(ids, m.Value)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	g := &Group{DisplayName: "ops", Members: []MultiValue{{Value: "a"}}}
+	steps := []struct {
+		body string
+		want string
+	}{
+		{`{"Operations":[{"op":"add","path":"members","value":[{"value":"b"},{"value":"a"}]}]}`, "a,b"},
+		{`{"Operations":[{"op":"remove","path":"members[value eq \"a\"]"}]}`, "b"},
+		{`{"Operations":[{"op":"Add","path":"members","value":[{"value":"c"}]},{"op":"Remove","path":"members","value":[{"value":"b"}]}]}`, "c"},
+		{`{"Operations":[{"op":"replace","value":{"displayName":"operators","members":[{"value":"d"}]}}]}`, "d"},
+		{`{"Operations":[{"op":"remove","path":"members"}]}`, ""},
+	}
+	for _, step := range steps {
+		if err := applyGroupPatch(g, decodeOps(t, step.body)); err != nil {
+			t.Fatalf("applyGroupPatch(%s) error: %v", step.body, err)
+		}
+		if got := members(g); got != step.want {
+			t.Errorf("after %s members = %q, want %q", step.body, got, step.want)
+		}
+	}
+	if g.DisplayName != "operators" {
+		t.Errorf("displayName = %q, want operators", g.DisplayName)
+	}
+
+	if err := applyGroupPatch(g, decodeOps(t, `{"Operations":[{"op":"add","path":"owner","value":"x"}]}`)); err == nil {
+		t.Error("expected error for unsupported path")
+	}
+}
+
+func TestTokens(t *testing.T) {
+	token, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("GenerateToken() error: %v", err)
+	}
+	if !strings.HasPrefix(token, TokenPrefix) || len(token) != len(TokenPrefix)+64 {
+		t.Errorf("unexpected token format: %s", token)
+	}
+	if HashToken(token) == HashToken(token+"x") || len(HashToken(token)) != 64 {
+		t.Error("unexpected token hash")
+	}
+	if TokenDisplayPrefix(token) != token[:tokenDisplayLength] {
+		t.Error("unexpected display prefix")
+	}
+}
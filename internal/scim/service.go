@@ -0,0 +1,634 @@
+package scim
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/MacJediWizard/keldris/internal/auth"
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// Store defines the persistence operations needed by the SCIM service.
+type Store interface {
+	GetSCIMUser(ctx context.Context, orgID, userID uuid.UUID) (*models.SCIMUser, error)
+	GetSCIMUserByUserName(ctx context.Context, orgID uuid.UUID, userName string) (*models.SCIMUser, error)
+	ListSCIMUsers(ctx context.Context, orgID uuid.UUID) ([]*models.SCIMUser, error)
+	CreateSCIMUser(ctx context.Context, u *models.SCIMUser) error
+	UpdateSCIMUser(ctx context.Context, u *models.SCIMUser) error
+	DeleteSCIMUser(ctx context.Context, orgID, userID uuid.UUID) error
+
+	GetSCIMGroup(ctx context.Context, orgID, id uuid.UUID) (*models.SCIMGroup, error)
+	GetSCIMGroupByDisplayName(ctx context.Context, orgID uuid.UUID, displayName string) (*models.SCIMGroup, error)
+	ListSCIMGroups(ctx context.Context, orgID uuid.UUID) ([]*models.SCIMGroup, error)
+	CreateSCIMGroup(ctx context.Context, g *models.SCIMGroup) error
+	UpdateSCIMGroup(ctx context.Context, g *models.SCIMGroup) error
+	DeleteSCIMGroup(ctx context.Context, orgID, id uuid.UUID) error
+	GetSCIMGroupNamesForUser(ctx context.Context, orgID, userID uuid.UUID) ([]string, error)
+
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	CreateUser(ctx context.Context, user *models.User) error
+	GetMembershipByUserAndOrg(ctx context.Context, userID, orgID uuid.UUID) (*models.OrgMembership, error)
+	CreateMembership(ctx context.Context, m *models.OrgMembership) error
+	UpdateMembershipRole(ctx context.Context, membershipID uuid.UUID, role models.OrgRole) error
+	DeleteMembership(ctx context.Context, userID, orgID uuid.UUID) error
+	GetSSOGroupMappingsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.SSOGroupMapping, error)
+	GetOrganizationSSOSettings(ctx context.Context, orgID uuid.UUID) (defaultRole *string, autoCreateOrgs bool, err error)
+	RevokeAllUserSessions(ctx context.Context, userID uuid.UUID, exceptSessionID *uuid.UUID) (int64, error)
+}
+
+// Service implements SCIM provisioning for organizations.
+type Service struct {
+	store  Store
+	logger zerolog.Logger
+}
+
+// NewService creates a new SCIM service.
+func NewService(store Store, logger zerolog.Logger) *Service {
+	return &Service{
+		store:  store,
+		logger: logger.With().Str("component", "scim_service").Logger(),
+	}
+}
+
+// Users
+
+// GetUser returns a user provisioned by the organization.
+func (s *Service) GetUser(ctx context.Context, orgID uuid.UUID, id string) (*User, error) {
+	su, err := s.loadUser(ctx, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	return toUser(su), nil
+}
+
+// ListUsers returns the page of the organization's users matching filter.
+func (s *Service) ListUsers(ctx context.Context, orgID uuid.UUID, filter *Filter, startIndex, count int) (*ListResponse, error) {
+	all, err := s.store.ListSCIMUsers(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*User
+	for _, su := range all {
+		u := toUser(su)
+		match, err := matchUser(u, filter)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			users = append(users, u)
+		}
+	}
+	return newListResponse(users, startIndex, count), nil
+}
+
+// CreateUser provisions a user in the organization. An existing account
+// whose home organization is orgID is adopted rather than duplicated;
+// accounts belonging to other organizations are never linked.
+func (s *Service) CreateUser(ctx context.Context, orgID uuid.UUID, in *User) (*User, error) {
+	if in.UserName == "" {
+		return nil, errInvalidValue("userName is required")
+	}
+	email := in.email()
+	if email == "" {
+		return nil, errInvalidValue("an email address is required")
+	}
+
+	existing, err := s.store.GetSCIMUserByUserName(ctx, orgID, in.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, errUniqueness("userName is already provisioned")
+	}
+
+	user, err := s.store.GetUserByEmail(ctx, email)
+	if err == nil {
+		if user.OrgID != orgID {
+			return nil, errUniqueness("email address belongs to another organization")
+		}
+		linked, err := s.store.GetSCIMUser(ctx, orgID, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if linked != nil {
+			return nil, errUniqueness("email address is already provisioned")
+		}
+	} else {
+		// The SAML subject lets the user sign in through the organization's
+		// IdP, where the NameID is normally the SCIM userName.
+		user = models.NewUser(orgID, auth.SAMLSubject(orgID, in.UserName), email, in.displayName(), models.UserRoleUser)
+		if err := s.store.CreateUser(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	su := models.NewSCIMUser(orgID, user, in.UserName, in.ExternalID)
+	su.Email = email
+	su.Name = in.displayName()
+	su.Active = in.IsActive()
+	if err := s.store.CreateSCIMUser(ctx, su); err != nil {
+		return nil, err
+	}
+	// Writes the name, email and status onto the user, which matters for
+	// adopted accounts and users provisioned as inactive.
+	if err := s.store.UpdateSCIMUser(ctx, su); err != nil {
+		return nil, err
+	}
+	if !su.Active {
+		s.revokeSessions(ctx, su.UserID)
+	}
+	if err := s.syncRole(ctx, orgID, su.UserID, false); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("org_id", orgID.String()).
+		Str("user_id", su.UserID.String()).
+		Str("user_name", su.UserName).
+		Msg("provisioned SCIM user")
+
+	return toUser(su), nil
+}
+
+// ReplaceUser replaces a user's attributes.
+func (s *Service) ReplaceUser(ctx context.Context, orgID uuid.UUID, id string, in *User) (*User, error) {
+	su, err := s.loadUser(ctx, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.saveUser(ctx, su, in)
+}
+
+// PatchUser applies PATCH operations to a user.
+func (s *Service) PatchUser(ctx context.Context, orgID uuid.UUID, id string, req *PatchRequest) (*User, error) {
+	su, err := s.loadUser(ctx, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	u := toUser(su)
+	if err := applyUserPatch(u, req.Operations); err != nil {
+		return nil, err
+	}
+	return s.saveUser(ctx, su, u)
+}
+
+func (s *Service) saveUser(ctx context.Context, su *models.SCIMUser, in *User) (*User, error) {
+	if in.UserName == "" {
+		return nil, errInvalidValue("userName is required")
+	}
+	email := in.email()
+	if email == "" {
+		return nil, errInvalidValue("an email address is required")
+	}
+	if !strings.EqualFold(in.UserName, su.UserName) {
+		existing, err := s.store.GetSCIMUserByUserName(ctx, su.OrgID, in.UserName)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, errUniqueness("userName is already provisioned")
+		}
+	}
+
+	wasActive := su.Active
+	su.UserName = in.UserName
+	su.ExternalID = in.ExternalID
+	su.Email = email
+	su.Name = in.displayName()
+	su.Active = in.IsActive()
+	if err := s.store.UpdateSCIMUser(ctx, su); err != nil {
+		return nil, err
+	}
+
+	if wasActive && !su.Active {
+		s.revokeSessions(ctx, su.UserID)
+		s.logger.Info().
+			Str("org_id", su.OrgID.String()).
+			Str("user_id", su.UserID.String()).
+			Msg("deactivated SCIM user")
+	}
+	return toUser(su), nil
+}
+
+// DeleteUser deprovisions a user: the account is disabled, its sessions are
+// revoked and it is removed from the organization. The user record is kept
+// so audit history stays attributable.
+func (s *Service) DeleteUser(ctx context.Context, orgID uuid.UUID, id string) error {
+	su, err := s.loadUser(ctx, orgID, id)
+	if err != nil {
+		return err
+	}
+
+	su.Active = false
+	if err := s.store.UpdateSCIMUser(ctx, su); err != nil {
+		return err
+	}
+	s.revokeSessions(ctx, su.UserID)
+
+	membership, err := s.store.GetMembershipByUserAndOrg(ctx, su.UserID, orgID)
+	if err == nil && !membership.IsOwner() {
+		if err := s.store.DeleteMembership(ctx, su.UserID, orgID); err != nil {
+			return err
+		}
+	}
+	if err := s.store.DeleteSCIMUser(ctx, orgID, su.UserID); err != nil {
+		return err
+	}
+
+	s.logger.Info().
+		Str("org_id", orgID.String()).
+		Str("user_id", su.UserID.String()).
+		Msg("deprovisioned SCIM user")
+	return nil
+}
+
+func (s *Service) loadUser(ctx context.Context, orgID uuid.UUID, id string) (*models.SCIMUser, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errNotFound("user")
+	}
+	su, err := s.store.GetSCIMUser(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if su == nil {
+		return nil, errNotFound("user")
+	}
+	return su, nil
+}
+
+func (s *Service) revokeSessions(ctx context.Context, userID uuid.UUID) {
+	revoked, err := s.store.RevokeAllUserSessions(ctx, userID, nil)
+	if err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID.String()).Msg("failed to revoke sessions of deactivated user")
+		return
+	}
+	s.logger.Info().Str("user_id", userID.String()).Int64("sessions_revoked", revoked).Msg("revoked sessions of deactivated user")
+}
+
+func toUser(su *models.SCIMUser) *User {
+	active := su.Active
+	created, modified := su.CreatedAt, su.UpdatedAt
+	u := &User{
+		Schemas:    []string{SchemaUser},
+		ID:         su.UserID.String(),
+		ExternalID: su.ExternalID,
+		UserName:   su.UserName,
+		Active:     &active,
+		Meta:       &Meta{ResourceType: "User", Created: &created, LastModified: &modified},
+	}
+	if su.Name != "" {
+		u.Name = &Name{Formatted: su.Name}
+	}
+	if su.Email != "" {
+		u.Emails = []MultiValue{{Value: su.Email, Type: "work", Primary: true}}
+	}
+	return u
+}
+
+func matchUser(u *User, f *Filter) (bool, error) {
+	if f == nil {
+		return true, nil
+	}
+	switch f.Attribute {
+	case "username":
+		return strings.EqualFold(u.UserName, f.Value), nil
+	case "externalid":
+		return u.ExternalID == f.Value, nil
+	case "id":
+		return u.ID == f.Value, nil
+	case "emails", "emails.value":
+		for _, e := range u.Emails {
+			if strings.EqualFold(e.Value, f.Value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return false, errInvalidFilter("unsupported filter attribute: " + f.Attribute)
+	}
+}
+
+// Groups
+
+// GetGroup returns one of the organization's groups.
+func (s *Service) GetGroup(ctx context.Context, orgID uuid.UUID, id string) (*Group, error) {
+	g, err := s.loadGroup(ctx, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	return toGroup(g), nil
+}
+
+// ListGroups returns the page of the organization's groups matching filter.
+func (s *Service) ListGroups(ctx context.Context, orgID uuid.UUID, filter *Filter, startIndex, count int) (*ListResponse, error) {
+	all, err := s.store.ListSCIMGroups(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*Group
+	for _, g := range all {
+		group := toGroup(g)
+		match, err := matchGroup(group, filter)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			groups = append(groups, group)
+		}
+	}
+	return newListResponse(groups, startIndex, count), nil
+}
+
+// CreateGroup creates a group and applies the role its members receive
+// through the organization's SSO group mappings.
+func (s *Service) CreateGroup(ctx context.Context, orgID uuid.UUID, in *Group) (*Group, error) {
+	if in.DisplayName == "" {
+		return nil, errInvalidValue("displayName is required")
+	}
+	existing, err := s.store.GetSCIMGroupByDisplayName(ctx, orgID, in.DisplayName)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, errUniqueness("displayName is already provisioned")
+	}
+
+	g := models.NewSCIMGroup(orgID, in.DisplayName, in.ExternalID)
+	if g.MemberIDs, err = s.resolveMembers(ctx, orgID, in.Members); err != nil {
+		return nil, err
+	}
+	if err := s.store.CreateSCIMGroup(ctx, g); err != nil {
+		return nil, err
+	}
+	if err := s.syncRoles(ctx, orgID, g.MemberIDs); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("org_id", orgID.String()).
+		Str("group_id", g.ID.String()).
+		Str("display_name", g.DisplayName).
+		Int("members", len(g.MemberIDs)).
+		Msg("provisioned SCIM group")
+
+	return toGroup(g), nil
+}
+
+// ReplaceGroup replaces a group's attributes and members.
+func (s *Service) ReplaceGroup(ctx context.Context, orgID uuid.UUID, id string, in *Group) (*Group, error) {
+	g, err := s.loadGroup(ctx, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.saveGroup(ctx, g, in)
+}
+
+// PatchGroup applies PATCH operations to a group.
+func (s *Service) PatchGroup(ctx context.Context, orgID uuid.UUID, id string, req *PatchRequest) (*Group, error) {
+	g, err := s.loadGroup(ctx, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	group := toGroup(g)
+	if err := applyGroupPatch(group, req.Operations); err != nil {
+		return nil, err
+	}
+	return s.saveGroup(ctx, g, group)
+}
+
+func (s *Service) saveGroup(ctx context.Context, g *models.SCIMGroup, in *Group) (*Group, error) {
+	if in.DisplayName == "" {
+		return nil, errInvalidValue("displayName is required")
+	}
+	if in.DisplayName != g.DisplayName {
+		existing, err := s.store.GetSCIMGroupByDisplayName(ctx, g.OrgID, in.DisplayName)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, errUniqueness("displayName is already provisioned")
+		}
+	}
+
+	members, err := s.resolveMembers(ctx, g.OrgID, in.Members)
+	if err != nil {
+		return nil, err
+	}
+	// Former members may lose the role the group granted them.
+	affected := append(append([]uuid.UUID{}, g.MemberIDs...), members...)
+
+	g.DisplayName = in.DisplayName
+	g.ExternalID = in.ExternalID
+	g.MemberIDs = members
+	if err := s.store.UpdateSCIMGroup(ctx, g); err != nil {
+		return nil, err
+	}
+	if err := s.syncRoles(ctx, g.OrgID, affected); err != nil {
+		return nil, err
+	}
+	return toGroup(g), nil
+}
+
+// DeleteGroup deletes a group and recomputes its former members' roles.
+func (s *Service) DeleteGroup(ctx context.Context, orgID uuid.UUID, id string) error {
+	g, err := s.loadGroup(ctx, orgID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.store.DeleteSCIMGroup(ctx, orgID, g.ID); err != nil {
+		return err
+	}
+	return s.syncRoles(ctx, orgID, g.MemberIDs)
+}
+
+func (s *Service) loadGroup(ctx context.Context, orgID uuid.UUID, id string) (*models.SCIMGroup, error) {
+	groupID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errNotFound("group")
+	}
+	g, err := s.store.GetSCIMGroup(ctx, orgID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, errNotFound("group")
+	}
+	return g, nil
+}
+
+// resolveMembers validates that every member is a user provisioned by the organization.
+func (s *Service) resolveMembers(ctx context.Context, orgID uuid.UUID, members []MultiValue) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(members))
+	seen := make(map[uuid.UUID]bool, len(members))
+	for _, m := range members {
+		userID, err := uuid.Parse(m.Value)
+		if err != nil {
+			return nil, errInvalidValue("unknown member: " + m.Value)
+		}
+		if seen[userID] {
+			continue
+		}
+		su, err := s.store.GetSCIMUser(ctx, orgID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if su == nil {
+			return nil, errInvalidValue("unknown member: " + m.Value)
+		}
+		seen[userID] = true
+		ids = append(ids, userID)
+	}
+	return ids, nil
+}
+
+func toGroup(g *models.SCIMGroup) *Group {
+	created, modified := g.CreatedAt, g.UpdatedAt
+	group := &Group{
+		Schemas:     []string{SchemaGroup},
+		ID:          g.ID.String(),
+		ExternalID:  g.ExternalID,
+		DisplayName: g.DisplayName,
+		Members:     make([]MultiValue, 0, len(g.MemberIDs)),
+		Meta:        &Meta{ResourceType: "Group", Created: &created, LastModified: &modified},
+	}
+	for _, id := range g.MemberIDs {
+		group.Members = append(group.Members, MultiValue{Value: id.String()})
+	}
+	return group
+}
+
+func matchGroup(g *Group, f *Filter) (bool, error) {
+	if f == nil {
+		return true, nil
+	}
+	switch f.Attribute {
+	case "displayname":
+		return g.DisplayName == f.Value, nil
+	case "externalid":
+		return g.ExternalID == f.Value, nil
+	case "id":
+		return g.ID == f.Value, nil
+	default:
+		return false, errInvalidFilter("unsupported filter attribute: " + f.Attribute)
+	}
+}
+
+// Roles
+
+// roleRank orders org roles by privilege.
+var roleRank = map[models.OrgRole]int{
+	models.OrgRoleReadonly: 1,
+	models.OrgRoleMember:   2,
+	models.OrgRoleAdmin:    3,
+	models.OrgRoleOwner:    4,
+}
+
+func (s *Service) syncRoles(ctx context.Context, orgID uuid.UUID, userIDs []uuid.UUID) error {
+	seen := make(map[uuid.UUID]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		if err := s.syncRole(ctx, orgID, userID, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncRole sets the user's org role to the most privileged role mapped from
+// their SCIM groups. Without a mapped group a new membership gets the
+// organization's SSO default role, and with fallback an existing one is
+// reset to it. Owners are never changed, so SCIM cannot orphan an
+// organization.
+func (s *Service) syncRole(ctx context.Context, orgID, userID uuid.UUID, fallback bool) error {
+	groups, err := s.store.GetSCIMGroupNamesForUser(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	role, err := s.mappedRole(ctx, orgID, groups)
+	if err != nil {
+		return err
+	}
+
+	membership, err := s.store.GetMembershipByUserAndOrg(ctx, userID, orgID)
+	if err != nil {
+		if role == "" {
+			role = s.defaultRole(ctx, orgID)
+		}
+		if err := s.store.CreateMembership(ctx, models.NewOrgMembership(userID, orgID, role)); err != nil {
+			return fmt.Errorf("create membership: %w", err)
+		}
+		return nil
+	}
+
+	if membership.IsOwner() {
+		return nil
+	}
+	if role == "" {
+		if !fallback {
+			return nil
+		}
+		role = s.defaultRole(ctx, orgID)
+	}
+	if membership.Role == role {
+		return nil
+	}
+	if err := s.store.UpdateMembershipRole(ctx, membership.ID, role); err != nil {
+		return fmt.Errorf("update membership role: %w", err)
+	}
+	s.logger.Info().
+		Str("org_id", orgID.String()).
+		Str("user_id", userID.String()).
+		Str("old_role", string(membership.Role)).
+		Str("new_role", string(role)).
+		Msg("updated membership role from SCIM groups")
+	return nil
+}
+
+// mappedRole returns the most privileged role the organization's SSO group
+// mappings grant for groups, or "" if none of the groups is mapped. Like the
+// default role, it never grants owner: an owner mapping yields admin.
+func (s *Service) mappedRole(ctx context.Context, orgID uuid.UUID, groups []string) (models.OrgRole, error) {
+	if len(groups) == 0 {
+		return "", nil
+	}
+	mappings, err := s.store.GetSSOGroupMappingsByOrgID(ctx, orgID)
+	if err != nil {
+		return "", fmt.Errorf("get group mappings: %w", err)
+	}
+
+	member := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		member[g] = true
+	}
+	var role models.OrgRole
+	for _, m := range mappings {
+		mapped := m.Role
+		if mapped == models.OrgRoleOwner {
+			mapped = models.OrgRoleAdmin
+		}
+		if member[m.OIDCGroupName] && roleRank[mapped] > roleRank[role] {
+			role = mapped
+		}
+	}
+	return role, nil
+}
+
+func (s *Service) defaultRole(ctx context.Context, orgID uuid.UUID) models.OrgRole {
+	defaultRole, _, err := s.store.GetOrganizationSSOSettings(ctx, orgID)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("org_id", orgID.String()).Msg("failed to get SSO default role")
+	}
+	if defaultRole != nil && models.IsValidOrgRole(*defaultRole) && models.OrgRole(*defaultRole) != models.OrgRoleOwner {
+		return models.OrgRole(*defaultRole)
+	}
+	return models.OrgRoleMember
+}
@@ -0,0 +1,450 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/MacJediWizard/keldris/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type mockStore struct {
+	users       map[uuid.UUID]*models.User
+	links       map[uuid.UUID]*models.SCIMUser
+	groups      map[uuid.UUID]*models.SCIMGroup
+	memberships map[uuid.UUID]*models.OrgMembership
+	mappings    []*models.SSOGroupMapping
+	defaultRole *string
+	revoked     map[uuid.UUID]int
+}
+
+func newMockStore() *mockStore {
+	return &mockStore{
+		users:       make(map[uuid.UUID]*models.User),
+		links:       make(map[uuid.UUID]*models.SCIMUser),
+		groups:      make(map[uuid.UUID]*models.SCIMGroup),
+		memberships: make(map[uuid.UUID]*models.OrgMembership),
+		revoked:     make(map[uuid.UUID]int),
+	}
+}
+
+func (m *mockStore) GetSCIMUser(_ context.Context, orgID, userID uuid.UUID) (*models.SCIMUser, error) {
+	if su, ok := m.links[userID]; ok && su.OrgID == orgID {
+		copied := *su
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (m *mockStore) GetSCIMUserByUserName(_ context.Context, orgID uuid.UUID, userName string) (*models.SCIMUser, error) {
+	for _, su := range m.links {
+		if su.OrgID == orgID && strings.EqualFold(su.UserName, userName) {
+			copied := *su
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockStore) ListSCIMUsers(_ context.Context, orgID uuid.UUID) ([]*models.SCIMUser, error) {
+	var out []*models.SCIMUser
+	for _, su := range m.links {
+		if su.OrgID == orgID {
+			out = append(out, su)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockStore) CreateSCIMUser(_ context.Context, u *models.SCIMUser) error {
+	copied := *u
+	m.links[u.UserID] = &copied
+	return nil
+}
+
+func (m *mockStore) UpdateSCIMUser(_ context.Context, u *models.SCIMUser) error {
+	copied := *u
+	m.links[u.UserID] = &copied
+	user := m.users[u.UserID]
+	user.Email, user.Name = u.Email, u.Name
+	user.Status = models.UserStatusActive
+	if !u.Active {
+		user.Status = models.UserStatusDisabled
+	}
+	return nil
+}
+
+func (m *mockStore) DeleteSCIMUser(_ context.Context, _, userID uuid.UUID) error {
+	delete(m.links, userID)
+	for _, g := range m.groups {
+		g.MemberIDs = removeID(g.MemberIDs, userID)
+	}
+	return nil
+}
+
+func (m *mockStore) GetSCIMGroup(_ context.Context, orgID, id uuid.UUID) (*models.SCIMGroup, error) {
+	if g, ok := m.groups[id]; ok && g.OrgID == orgID {
+		copied := *g
+		copied.MemberIDs = append([]uuid.UUID{}, g.MemberIDs...)
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (m *mockStore) GetSCIMGroupByDisplayName(_ context.Context, orgID uuid.UUID, displayName string) (*models.SCIMGroup, error) {
+	for _, g := range m.groups {
+		if g.OrgID == orgID && g.DisplayName == displayName {
+			return g, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockStore) ListSCIMGroups(_ context.Context, orgID uuid.UUID) ([]*models.SCIMGroup, error) {
+	var out []*models.SCIMGroup
+	for _, g := range m.groups {
+		if g.OrgID == orgID {
+			out = append(out, g)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockStore) CreateSCIMGroup(_ context.Context, g *models.SCIMGroup) error {
+	copied := *g
+	m.groups[g.ID] = &copied
+	return nil
+}
+
+func (m *mockStore) UpdateSCIMGroup(_ context.Context, g *models.SCIMGroup) error {
+	copied := *g
+	m.groups[g.ID] = &copied
+	return nil
+}
+
+func (m *mockStore) DeleteSCIMGroup(_ context.Context, _, id uuid.UUID) error {
+	delete(m.groups, id)
+	return nil
+}
+
+func (m *mockStore) GetSCIMGroupNamesForUser(_ context.Context, orgID, userID uuid.UUID) ([]string, error) {
+	var names []string
+	for _, g := range m.groups {
+		if g.OrgID != orgID {
+			continue
+		}
+		for _, id := range g.MemberIDs {
+			if id == userID {
+				names = append(names, g.DisplayName)
+			}
+		}
+	}
+	return names, nil
+}
+
+func (m *mockStore) GetUserByEmail(_ context.Context, email string) (*models.User, error) {
+	for _, u := range m.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (m *mockStore) CreateUser(_ context.Context, user *models.User) error {
+	m.users[user.ID] = user
+	return nil
+}
+
+func (m *mockStore) GetMembershipByUserAndOrg(_ context.Context, userID, orgID uuid.UUID) (*models.OrgMembership, error) {
+	if ms, ok := m.memberships[userID]; ok && ms.OrgID == orgID {
+		copied := *ms
+		return &copied, nil
+	}
+	return nil, errors.New("membership not found")
+}
+
+func (m *mockStore) CreateMembership(_ context.Context, ms *models.OrgMembership) error {
+	m.memberships[ms.UserID] = ms
+	return nil
+}
+
+func (m *mockStore) UpdateMembershipRole(_ context.Context, membershipID uuid.UUID, role models.OrgRole) error {
+	for _, ms := range m.memberships {
+		if ms.ID == membershipID {
+			ms.Role = role
+		}
+	}
+	return nil
+}
+
+func (m *mockStore) DeleteMembership(_ context.Context, userID, _ uuid.UUID) error {
+	delete(m.memberships, userID)
+	return nil
+}
+
+func (m *mockStore) GetSSOGroupMappingsByOrgID(_ context.Context, orgID uuid.UUID) ([]*models.SSOGroupMapping, error) {
+	var out []*models.SSOGroupMapping
+	for _, mapping := range m.mappings {
+		if mapping.OrgID == orgID {
+			out = append(out, mapping)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockStore) GetOrganizationSSOSettings(_ context.Context, _ uuid.UUID) (*string, bool, error) {
+	return m.defaultRole, false, nil
+}
+
+func (m *mockStore) RevokeAllUserSessions(_ context.Context, userID uuid.UUID, _ *uuid.UUID) (int64, error) {
+	m.revoked[userID]++
+	return 1, nil
+}
+
+func removeID(ids []uuid.UUID, id uuid.UUID) []uuid.UUID {
+	var out []uuid.UUID
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func newTestUser(userName string) *User {
+	return &User{
+		UserName: userName,
+		Name:     &Name{GivenName: "Jane", FamilyName: "Doe"},
+		Emails:   []MultiValue{{Value: userName, Primary: true}},
+	}
+}
+
+func scimStatus(err error) int {
+	var scimErr *Error
+	if errors.As(err, &scimErr) {
+		return scimErr.Status
+	}
+	return 0
+}
+
+func TestService_UserLifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+	svc := NewService(store, zerolog.Nop())
+	orgID := uuid.New()
+
+	created, err := svc.CreateUser(ctx, orgID, newTestUser("jdoe@example.com"))
+	if err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+	userID := uuid.MustParse(created.ID)
+	user := store.users[userID]
+	if user.OrgID != orgID || user.Name != "Jane Doe" || !strings.HasPrefix(user.OIDCSubject, "saml:"+orgID.String()+":") {
+		t.Errorf("unexpected provisioned user: %+v", user)
+	}
+	if ms := store.memberships[userID]; ms == nil || ms.Role != models.OrgRoleMember {
+		t.Fatalf("expected member membership, got %+v", ms)
+	}
+
+	if _, err := svc.CreateUser(ctx, orgID, newTestUser("JDOE@example.com")); scimStatus(err) != http.StatusConflict {
+		t.Errorf("duplicate userName: expected 409, got %v", err)
+	}
+
+	list, err := svc.ListUsers(ctx, orgID, &Filter{Attribute: "username", Value: "JDoe@Example.com"}, 1, 10)
+	if err != nil || list.TotalResults != 1 {
+		t.Fatalf("filter by userName: %+v, %v", list, err)
+	}
+
+	// Deactivation disables the account and revokes its sessions.
+	patch := &PatchRequest{Operations: decodeOps(t, `{"Operations":[{"op":"replace","path":"active","value":false}]}`)}
+	patched, err := svc.PatchUser(ctx, orgID, created.ID, patch)
+	if err != nil {
+		t.Fatalf("PatchUser() error: %v", err)
+	}
+	if patched.IsActive() || user.Status != models.UserStatusDisabled {
+		t.Errorf("expected disabled user, got active=%v status=%s", patched.IsActive(), user.Status)
+	}
+	if store.revoked[userID] != 1 {
+		t.Errorf("expected sessions to be revoked once, got %d", store.revoked[userID])
+	}
+
+	// Reactivation does not revoke again.
+	patch = &PatchRequest{Operations: decodeOps(t, `{"Operations":[{"op":"replace","value":{"active":true}}]}`)}
+	if _, err := svc.PatchUser(ctx, orgID, created.ID, patch); err != nil {
+		t.Fatalf("PatchUser() error: %v", err)
+	}
+	if user.Status != models.UserStatusActive || store.revoked[userID] != 1 {
+		t.Errorf("unexpected state after reactivation: status=%s revoked=%d", user.Status, store.revoked[userID])
+	}
+
+	// Another organization cannot see or modify the user.
+	if _, err := svc.GetUser(ctx, uuid.New(), created.ID); scimStatus(err) != http.StatusNotFound {
+		t.Errorf("cross-org get: expected 404, got %v", err)
+	}
+
+	if err := svc.DeleteUser(ctx, orgID, created.ID); err != nil {
+		t.Fatalf("DeleteUser() error: %v", err)
+	}
+	if user.Status != models.UserStatusDisabled || store.revoked[userID] != 2 {
+		t.Errorf("delete should disable and revoke: status=%s revoked=%d", user.Status, store.revoked[userID])
+	}
+	if _, ok := store.memberships[userID]; ok {
+		t.Error("delete should remove the org membership")
+	}
+	if _, err := svc.GetUser(ctx, orgID, created.ID); scimStatus(err) != http.StatusNotFound {
+		t.Errorf("deleted user: expected 404, got %v", err)
+	}
+}
+
+func TestService_CreateUserExistingAccount(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+	svc := NewService(store, zerolog.Nop())
+	orgID := uuid.New()
+
+	existing := models.NewUser(orgID, "oidc-sub", "admin@example.com", "Admin", models.UserRoleAdmin)
+	store.users[existing.ID] = existing
+	store.memberships[existing.ID] = models.NewOrgMembership(existing.ID, orgID, models.OrgRoleAdmin)
+
+	created, err := svc.CreateUser(ctx, orgID, newTestUser("admin@example.com"))
+	if err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+	if created.ID != existing.ID.String() || len(store.users) != 1 {
+		t.Fatalf("expected existing account to be adopted")
+	}
+	if existing.OIDCSubject != "oidc-sub" || store.memberships[existing.ID].Role != models.OrgRoleAdmin {
+		t.Errorf("adoption must keep the subject and role: %+v %+v", existing, store.memberships[existing.ID])
+	}
+
+	other := models.NewUser(uuid.New(), "other-sub", "other@example.com", "Other", models.UserRoleUser)
+	store.users[other.ID] = other
+	if _, err := svc.CreateUser(ctx, orgID, newTestUser("other@example.com")); scimStatus(err) != http.StatusConflict {
+		t.Errorf("account of another org: expected 409, got %v", err)
+	}
+}
+
+func TestService_GroupRoles(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+	svc := NewService(store, zerolog.Nop())
+	orgID := uuid.New()
+	readonly := string(models.OrgRoleReadonly)
+	store.defaultRole = &readonly
+	store.mappings = []*models.SSOGroupMapping{
+		models.NewSSOGroupMapping(orgID, "backup-admins", models.OrgRoleAdmin),
+		models.NewSSOGroupMapping(orgID, "backup-operators", models.OrgRoleMember),
+		models.NewSSOGroupMapping(uuid.New(), "staff", models.OrgRoleOwner),
+	}
+
+	u, err := svc.CreateUser(ctx, orgID, newTestUser("jdoe@example.com"))
+	if err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+	userID := uuid.MustParse(u.ID)
+	role := func() models.OrgRole { return store.memberships[userID].Role }
+	if role() != models.OrgRoleReadonly {
+		t.Fatalf("new user should get the SSO default role, got %s", role())
+	}
+
+	members := []MultiValue{{Value: u.ID}}
+	operators, err := svc.CreateGroup(ctx, orgID, &Group{DisplayName: "backup-operators", Members: members})
+	if err != nil {
+		t.Fatalf("CreateGroup() error: %v", err)
+	}
+	if role() != models.OrgRoleMember {
+		t.Errorf("operators: role = %s, want member", role())
+	}
+
+	admins, err := svc.CreateGroup(ctx, orgID, &Group{DisplayName: "backup-admins", Members: members})
+	if err != nil {
+		t.Fatalf("CreateGroup() error: %v", err)
+	}
+	if role() != models.OrgRoleAdmin {
+		t.Errorf("admins: role = %s, want admin", role())
+	}
+
+	// A group mapped only in another organization grants nothing here.
+	if _, err := svc.CreateGroup(ctx, orgID, &Group{DisplayName: "staff", Members: members}); err != nil {
+		t.Fatalf("CreateGroup() error: %v", err)
+	}
+	if role() != models.OrgRoleAdmin {
+		t.Errorf("unmapped group changed role to %s", role())
+	}
+
+	remove := &PatchRequest{Operations: decodeOps(t, `{"Operations":[{"op":"remove","path":"members[value eq \"`+u.ID+`\"]"}]}`)}
+	if _, err := svc.PatchGroup(ctx, orgID, admins.ID, remove); err != nil {
+		t.Fatalf("PatchGroup() error: %v", err)
+	}
+	if role() != models.OrgRoleMember {
+		t.Errorf("after leaving admins: role = %s, want member", role())
+	}
+
+	if err := svc.DeleteGroup(ctx, orgID, operators.ID); err != nil {
+		t.Fatalf("DeleteGroup() error: %v", err)
+	}
+	if role() != models.OrgRoleReadonly {
+		t.Errorf("after losing all mapped groups: role = %s, want readonly", role())
+	}
+
+	if _, err := svc.CreateGroup(ctx, orgID, &Group{DisplayName: "staff"}); scimStatus(err) != http.StatusConflict {
+		t.Errorf("duplicate displayName: expected 409, got %v", err)
+	}
+	if _, err := svc.CreateGroup(ctx, orgID, &Group{DisplayName: "x", Members: []MultiValue{{Value: uuid.NewString()}}}); scimStatus(err) != http.StatusBadRequest {
+		t.Errorf("unknown member: expected 400, got %v", err)
+	}
+}
+
+func TestService_GroupRoleCappedAtAdmin(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+	svc := NewService(store, zerolog.Nop())
+	orgID := uuid.New()
+	store.mappings = []*models.SSOGroupMapping{models.NewSSOGroupMapping(orgID, "owners", models.OrgRoleOwner)}
+
+	u, err := svc.CreateUser(ctx, orgID, newTestUser("jdoe@example.com"))
+	if err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+	if _, err := svc.CreateGroup(ctx, orgID, &Group{DisplayName: "owners", Members: []MultiValue{{Value: u.ID}}}); err != nil {
+		t.Fatalf("CreateGroup() error: %v", err)
+	}
+	if role := store.memberships[uuid.MustParse(u.ID)].Role; role != models.OrgRoleAdmin {
+		t.Errorf("owner-mapped group: role = %s, want admin", role)
+	}
+}
+
+func TestService_OwnerRoleUnchanged(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+	svc := NewService(store, zerolog.Nop())
+	orgID := uuid.New()
+	store.mappings = []*models.SSOGroupMapping{models.NewSSOGroupMapping(orgID, "readers", models.OrgRoleReadonly)}
+
+	owner := models.NewUser(orgID, "owner-sub", "owner@example.com", "Owner", models.UserRoleAdmin)
+	store.users[owner.ID] = owner
+	store.memberships[owner.ID] = models.NewOrgMembership(owner.ID, orgID, models.OrgRoleOwner)
+
+	u, err := svc.CreateUser(ctx, orgID, newTestUser("owner@example.com"))
+	if err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+	if _, err := svc.CreateGroup(ctx, orgID, &Group{DisplayName: "readers", Members: []MultiValue{{Value: u.ID}}}); err != nil {
+		t.Fatalf("CreateGroup() error: %v", err)
+	}
+	if store.memberships[owner.ID].Role != models.OrgRoleOwner {
+		t.Errorf("owner role changed to %s", store.memberships[owner.ID].Role)
+	}
+
+	if err := svc.DeleteUser(ctx, orgID, u.ID); err != nil {
+		t.Fatalf("DeleteUser() error: %v", err)
+	}
+	if _, ok := store.memberships[owner.ID]; !ok {
+		t.Error("deprovisioning must not remove an owner membership")
+	}
+}
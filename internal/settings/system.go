@@ -21,6 +21,7 @@ const (
 	SettingKeyOIDC            SettingKey = "oidc"
 	SettingKeyStorageDefaults SettingKey = "storage_defaults"
 	SettingKeySecurity        SettingKey = "security"
+	SettingKeySAML            SettingKey = "saml"
 )
 
 // SystemSetting represents a system-wide configuration entry.
@@ -169,6 +170,71 @@ func (s *OIDCSettings) Validate() error {
 	return nil
 }
 
+// SAMLSettings holds the SAML 2.0 identity provider configuration for an
+// organization. The SP signing key pair is generated when SAML is first
+// enabled.
+type SAMLSettings struct {
+	Enabled         bool     `json:"enabled"`
+	IdPEntityID     string   `json:"idp_entity_id"`
+	IdPSSOURL       string   `json:"idp_sso_url"`
+	IdPCertificate  string   `json:"idp_certificate"`            // PEM, several allowed during rollover
+	SPEntityID      string   `json:"sp_entity_id,omitempty"`     // Defaults to the metadata URL
+	ACSURL          string   `json:"acs_url,omitempty"`          // Defaults to the org's ACS endpoint
+	SPCertificate   string   `json:"sp_certificate,omitempty"`   // PEM, published in SP metadata
+	SPPrivateKey    string   `json:"sp_private_key,omitempty"`   // PEM, never returned by the API
+	EmailAttribute  string   `json:"email_attribute,omitempty"`  // Falls back to common names and the NameID
+	NameAttribute   string   `json:"name_attribute,omitempty"`   // Falls back to common names
+	GroupsAttribute string   `json:"groups_attribute,omitempty"` // Feeds SSO group mappings
+	AutoCreateUsers bool     `json:"auto_create_users"`
+	DefaultRole     string   `json:"default_role"` // member, readonly
+	AllowedDomains  []string `json:"allowed_domains,omitempty"`
+}
+
+// DefaultSAMLSettings returns SAMLSettings with sensible defaults.
+func DefaultSAMLSettings() SAMLSettings {
+	return SAMLSettings{
+		Enabled:         false,
+		AutoCreateUsers: false,
+		DefaultRole:     "member",
+	}
+}
+
+// Validate validates the SAML settings.
+func (s *SAMLSettings) Validate() error {
+	if !s.Enabled {
+		return nil // Skip validation if disabled
+	}
+
+	if s.IdPEntityID == "" {
+		return errors.New("SAML IdP entity ID is required")
+	}
+
+	if s.IdPSSOURL == "" {
+		return errors.New("SAML IdP SSO URL is required")
+	}
+
+	if u, err := url.Parse(s.IdPSSOURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("invalid SAML IdP SSO URL")
+	}
+
+	if s.IdPCertificate == "" {
+		return errors.New("SAML IdP certificate is required")
+	}
+
+	if s.ACSURL != "" {
+		if u, err := url.Parse(s.ACSURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("invalid SAML ACS URL")
+		}
+	}
+
+	validRoles := map[string]bool{"member": true, "readonly": true}
+	if !validRoles[s.DefaultRole] {
+		return errors.New("default role must be 'member' or 'readonly'")
+	}
+
+	return nil
+}
+
 // StorageDefaultSettings holds default storage configuration.
 type StorageDefaultSettings struct {
 	DefaultRetentionDays    int    `json:"default_retention_days"`
@@ -211,7 +277,7 @@ func (s *StorageDefaultSettings) Validate() error {
 		return errors.New("max retention days cannot exceed 3650 (10 years)")
 	}
 
-	validBackends := map[string]bool{"local": true, "s3": true, "b2": true, "sftp": true, "rest": true, "dropbox": true}
+	validBackends := map[string]bool{"local": true, "s3": true, "b2": true, "sftp": true, "rest": true, "dropbox": true, "rclone": true}
 	if !validBackends[s.DefaultStorageBackend] {
 		return errors.New("invalid default storage backend")
 	}
@@ -232,24 +298,34 @@ func (s *StorageDefaultSettings) Validate() error {
 	return nil
 }
 
+// DefaultStepUpMaxAgeMinutes is how long a re-authentication satisfies step-up checks by default.
+const DefaultStepUpMaxAgeMinutes = 5
+
+// DefaultApprovalExpiryHours is how long an approval request stays open by default.
+const DefaultApprovalExpiryHours = 72
+
 // SecuritySettings holds security configuration.
 type SecuritySettings struct {
-	SessionTimeoutMinutes        int      `json:"session_timeout_minutes"`
-	MaxConcurrentSessions        int      `json:"max_concurrent_sessions"`
-	RequireMFA                   bool     `json:"require_mfa"`
-	MFAGracePeriodDays           int      `json:"mfa_grace_period_days"`
-	AllowedIPRanges              []string `json:"allowed_ip_ranges,omitempty"` // CIDR format
-	BlockedIPRanges              []string `json:"blocked_ip_ranges,omitempty"` // CIDR format
-	FailedLoginLockoutAttempts   int      `json:"failed_login_lockout_attempts"`
-	FailedLoginLockoutMinutes    int      `json:"failed_login_lockout_minutes"`
-	APIKeyExpirationDays         int      `json:"api_key_expiration_days"` // 0 means no expiration
-	EnableAuditLogging           bool     `json:"enable_audit_logging"`
-	AuditLogRetentionDays        int      `json:"audit_log_retention_days"`
-	ForceHTTPS                   bool     `json:"force_https"`
-	AllowPasswordLogin           bool     `json:"allow_password_login"`
-	RequireEmailVerification     bool     `json:"require_email_verification"`      // Require email verification for non-OIDC users
-	EmailVerificationTokenHours  int      `json:"email_verification_token_hours"`  // How long verification tokens are valid (default 24)
-	AllowAdminVerificationBypass bool     `json:"allow_admin_verification_bypass"` // Allow admins to manually verify users
+	SessionTimeoutMinutes        int        `json:"session_timeout_minutes"`
+	MaxConcurrentSessions        int        `json:"max_concurrent_sessions"`
+	RequireMFA                   bool       `json:"require_mfa"`
+	MFAGracePeriodDays           int        `json:"mfa_grace_period_days"`
+	MFARequiredSince             *time.Time `json:"mfa_required_since,omitempty"` // When RequireMFA was last enabled; grace period counts from here
+	StepUpMaxAgeMinutes          int        `json:"step_up_max_age_minutes"`      // How recent re-authentication must be for sensitive operations (0 uses default)
+	AllowedIPRanges              []string   `json:"allowed_ip_ranges,omitempty"`  // CIDR format
+	BlockedIPRanges              []string   `json:"blocked_ip_ranges,omitempty"`  // CIDR format
+	FailedLoginLockoutAttempts   int        `json:"failed_login_lockout_attempts"`
+	FailedLoginLockoutMinutes    int        `json:"failed_login_lockout_minutes"`
+	APIKeyExpirationDays         int        `json:"api_key_expiration_days"` // 0 means no expiration
+	EnableAuditLogging           bool       `json:"enable_audit_logging"`
+	AuditLogRetentionDays        int        `json:"audit_log_retention_days"`
+	ForceHTTPS                   bool       `json:"force_https"`
+	AllowPasswordLogin           bool       `json:"allow_password_login"`
+	RequireEmailVerification     bool       `json:"require_email_verification"`          // Require email verification for non-OIDC users
+	EmailVerificationTokenHours  int        `json:"email_verification_token_hours"`      // How long verification tokens are valid (default 24)
+	AllowAdminVerificationBypass bool       `json:"allow_admin_verification_bypass"`     // Allow admins to manually verify users
+	ApprovalRequiredActions      []string   `json:"approval_required_actions,omitempty"` // Destructive actions that need a second admin's approval
+	ApprovalExpiryHours          int        `json:"approval_expiry_hours"`               // How long approval requests stay open (0 uses default)
 }
 
 // DefaultSecuritySettings returns SecuritySettings with sensible defaults.
@@ -259,6 +335,7 @@ func DefaultSecuritySettings() SecuritySettings {
 		MaxConcurrentSessions:        5,
 		RequireMFA:                   false,
 		MFAGracePeriodDays:           7,
+		StepUpMaxAgeMinutes:          DefaultStepUpMaxAgeMinutes,
 		FailedLoginLockoutAttempts:   5,
 		FailedLoginLockoutMinutes:    30,
 		APIKeyExpirationDays:         0, // No expiration
@@ -269,6 +346,7 @@ func DefaultSecuritySettings() SecuritySettings {
 		RequireEmailVerification:     true,  // Require email verification by default
 		EmailVerificationTokenHours:  24,    // 24 hours
 		AllowAdminVerificationBypass: true,  // Allow admins to manually verify users
+		ApprovalExpiryHours:          DefaultApprovalExpiryHours,
 	}
 }
 
@@ -286,6 +364,14 @@ func (s *SecuritySettings) Validate() error {
 		return errors.New("MFA grace period must be between 0 and 30 days")
 	}
 
+	if s.StepUpMaxAgeMinutes < 0 || s.StepUpMaxAgeMinutes > 60 {
+		return errors.New("step-up max age must be between 1 and 60 minutes")
+	}
+
+	if s.ApprovalExpiryHours < 0 || s.ApprovalExpiryHours > 720 {
+		return errors.New("approval expiry must be between 1 and 720 hours")
+	}
+
 	// Validate CIDR ranges
 	for _, cidr := range s.AllowedIPRanges {
 		if _, _, err := net.ParseCIDR(cidr); err != nil {
@@ -318,6 +404,32 @@ func (s *SecuritySettings) Validate() error {
 	return nil
 }
 
+// StepUpMaxAge returns how recent a re-authentication must be for sensitive operations.
+func (s *SecuritySettings) StepUpMaxAge() time.Duration {
+	if s.StepUpMaxAgeMinutes <= 0 {
+		return DefaultStepUpMaxAgeMinutes * time.Minute
+	}
+	return time.Duration(s.StepUpMaxAgeMinutes) * time.Minute
+}
+
+// RequiresApproval returns true if the action must be approved by a second admin.
+func (s *SecuritySettings) RequiresApproval(action string) bool {
+	for _, a := range s.ApprovalRequiredActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// ApprovalExpiry returns how long an approval request stays open.
+func (s *SecuritySettings) ApprovalExpiry() time.Duration {
+	if s.ApprovalExpiryHours <= 0 {
+		return DefaultApprovalExpiryHours * time.Hour
+	}
+	return time.Duration(s.ApprovalExpiryHours) * time.Hour
+}
+
 // Request/Response types for API
 
 // UpdateSMTPSettingsRequest is the request for updating SMTP settings.
@@ -348,11 +460,28 @@ type UpdateOIDCSettingsRequest struct {
 	RequireEmailVerification *bool    `json:"require_email_verification,omitempty"`
 }
 
+// UpdateSAMLSettingsRequest is the request for updating SAML settings.
+type UpdateSAMLSettingsRequest struct {
+	Enabled         *bool    `json:"enabled,omitempty"`
+	IdPEntityID     *string  `json:"idp_entity_id,omitempty" binding:"omitempty,max=500"`
+	IdPSSOURL       *string  `json:"idp_sso_url,omitempty" binding:"omitempty,url,max=500"`
+	IdPCertificate  *string  `json:"idp_certificate,omitempty" binding:"omitempty,max=20000"`
+	SPEntityID      *string  `json:"sp_entity_id,omitempty" binding:"omitempty,max=500"`
+	ACSURL          *string  `json:"acs_url,omitempty" binding:"omitempty,url,max=500"`
+	EmailAttribute  *string  `json:"email_attribute,omitempty" binding:"omitempty,max=255"`
+	NameAttribute   *string  `json:"name_attribute,omitempty" binding:"omitempty,max=255"`
+	GroupsAttribute *string  `json:"groups_attribute,omitempty" binding:"omitempty,max=255"`
+	AutoCreateUsers *bool    `json:"auto_create_users,omitempty"`
+	DefaultRole     *string  `json:"default_role,omitempty" binding:"omitempty,oneof=member readonly"`
+	AllowedDomains  []string `json:"allowed_domains,omitempty"`
+	RegenerateSPKey *bool    `json:"regenerate_sp_key,omitempty"`
+}
+
 // UpdateStorageDefaultsRequest is the request for updating storage defaults.
 type UpdateStorageDefaultsRequest struct {
 	DefaultRetentionDays    *int    `json:"default_retention_days,omitempty" binding:"omitempty,min=1,max=3650"`
 	MaxRetentionDays        *int    `json:"max_retention_days,omitempty" binding:"omitempty,min=1,max=3650"`
-	DefaultStorageBackend   *string `json:"default_storage_backend,omitempty" binding:"omitempty,oneof=local s3 b2 sftp rest dropbox"`
+	DefaultStorageBackend   *string `json:"default_storage_backend,omitempty" binding:"omitempty,oneof=local s3 b2 sftp rest dropbox rclone"`
 	MaxBackupSizeGB         *int    `json:"max_backup_size_gb,omitempty" binding:"omitempty,min=1,max=10000"`
 	EnableCompression       *bool   `json:"enable_compression,omitempty"`
 	CompressionLevel        *int    `json:"compression_level,omitempty" binding:"omitempty,min=1,max=9"`
@@ -367,6 +496,7 @@ type UpdateSecuritySettingsRequest struct {
 	MaxConcurrentSessions        *int     `json:"max_concurrent_sessions,omitempty" binding:"omitempty,min=1,max=100"`
 	RequireMFA                   *bool    `json:"require_mfa,omitempty"`
 	MFAGracePeriodDays           *int     `json:"mfa_grace_period_days,omitempty" binding:"omitempty,min=0,max=30"`
+	StepUpMaxAgeMinutes          *int     `json:"step_up_max_age_minutes,omitempty" binding:"omitempty,min=1,max=60"`
 	AllowedIPRanges              []string `json:"allowed_ip_ranges,omitempty"`
 	BlockedIPRanges              []string `json:"blocked_ip_ranges,omitempty"`
 	FailedLoginLockoutAttempts   *int     `json:"failed_login_lockout_attempts,omitempty" binding:"omitempty,min=1,max=20"`
@@ -379,6 +509,8 @@ type UpdateSecuritySettingsRequest struct {
 	RequireEmailVerification     *bool    `json:"require_email_verification,omitempty"`
 	EmailVerificationTokenHours  *int     `json:"email_verification_token_hours,omitempty" binding:"omitempty,min=1,max=168"`
 	AllowAdminVerificationBypass *bool    `json:"allow_admin_verification_bypass,omitempty"`
+	ApprovalRequiredActions      []string `json:"approval_required_actions,omitempty"`
+	ApprovalExpiryHours          *int     `json:"approval_expiry_hours,omitempty" binding:"omitempty,min=1,max=720"`
 }
 
 // SystemSettingsResponse is the response containing all system settings.
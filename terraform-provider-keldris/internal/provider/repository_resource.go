@@ -144,10 +144,10 @@ Store it securely as it's needed to access the encrypted backups.
 				Required:    true,
 			},
 			"type": schema.StringAttribute{
-				Description: "The type of repository (s3, b2, sftp, local, rest, dropbox).",
+				Description: "The type of repository (s3, b2, sftp, local, rest, dropbox, rclone).",
 				Required:    true,
 				Validators: []validator.String{
-					stringvalidator.OneOf("s3", "b2", "sftp", "local", "rest", "dropbox"),
+					stringvalidator.OneOf("s3", "b2", "sftp", "local", "rest", "dropbox", "rclone"),
 				},
 				PlanModifiers: []planmodifier.String{
 					stringplanmodifier.RequiresReplace(),